@@ -0,0 +1,245 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// --- Shell completion ---
+
+// cmdNode is one command word and the words that may follow it.
+type cmdNode struct {
+	children map[string]*cmdNode
+	flags    map[string]bool
+}
+
+func newCmdNode() *cmdNode {
+	return &cmdNode{children: map[string]*cmdNode{}, flags: map[string]bool{}}
+}
+
+var (
+	cmdWord   = regexp.MustCompile(`^[a-z][a-z-]*$`)
+	flagToken = regexp.MustCompile(`--[a-z][a-z_-]*`)
+)
+
+// commandTree parses the command lines of usage: the leading plain words
+// of a line (or a|b and <a|b> alternatives) are its command path, and the
+// --flags on it and its continuation lines belong to the last word.
+func commandTree() *cmdNode {
+	root := newCmdNode()
+	var current []*cmdNode
+	inCommands := false
+	for _, line := range strings.Split(usage, "\n") {
+		switch {
+		case line == "Commands:":
+			inCommands = true
+			continue
+		case line == "Flags:":
+			inCommands = false
+		}
+		if !inCommands || strings.TrimSpace(line) == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "  ") && !strings.HasPrefix(line, "   ") {
+			current = []*cmdNode{root}
+			for _, tok := range strings.Fields(line) {
+				alts := commandAlternatives(tok)
+				if alts == nil {
+					break
+				}
+				var next []*cmdNode
+				for _, n := range current {
+					for _, word := range alts {
+						child := n.children[word]
+						if child == nil {
+							child = newCmdNode()
+							n.children[word] = child
+						}
+						next = append(next, child)
+					}
+				}
+				current = next
+			}
+		}
+		for _, f := range flagToken.FindAllString(line, -1) {
+			for _, n := range current {
+				n.flags[f] = true
+			}
+		}
+	}
+	return root
+}
+
+// commandAlternatives returns the command words a usage token stands for,
+// or nil if it is an argument or flag.
+func commandAlternatives(tok string) []string {
+	if inner, ok := strings.CutPrefix(tok, "<"); ok {
+		inner, ok = strings.CutSuffix(inner, ">")
+		if !ok || !strings.Contains(inner, "|") {
+			return nil
+		}
+		tok = inner
+	}
+	alts := strings.Split(tok, "|")
+	for _, a := range alts {
+		if !cmdWord.MatchString(a) {
+			return nil
+		}
+	}
+	return alts
+}
+
+// globalFlags are accepted by every command.
+var globalFlags = []string{"--pretty", "--output", "--jsonpath", "--query", "--dry-run"}
+
+// Live resources offered as the first argument of these commands, or as
+// the value of these flags.
+var (
+	stateKeyCommands = map[string]bool{
+		"state get": true, "state set": true, "state delete": true, "state meta": true,
+		"state history": true, "state rollback": true, "state diff": true,
+	}
+	instanceCommands = map[string]bool{
+		"instances get": true, "instances delete": true, "activate": true, "heartbeat start": true, "heartbeat stop": true,
+		"heartbeat status": true, "messages inbox": true,
+	}
+	instanceFlags = map[string]bool{"--instance": true, "--instance_id": true, "--to": true, "--sign-as": true}
+)
+
+// completeWords returns the candidates for the word after words, the
+// arguments already typed after "koor-cli". Server resources are fetched
+// with cfg; if the server is unreachable they are left out.
+func completeWords(cfg *config, words []string) []string {
+	node := commandTree()
+	var path []string
+	i := 0
+	for ; i < len(words); i++ {
+		child := node.children[words[i]]
+		if child == nil {
+			break
+		}
+		node = child
+		path = append(path, words[i])
+	}
+	if len(path) == 0 && len(words) > 0 {
+		return nil // unknown command
+	}
+	args := words[i:]
+	if len(args) == 0 && len(node.children) > 0 {
+		return sortedKeys(node.children)
+	}
+
+	cmd := strings.Join(path, " ")
+	if len(args) > 0 && instanceFlags[args[len(args)-1]] && node.flags[args[len(args)-1]] {
+		return fetchIDs(cfg, "/api/instances", "id")
+	}
+	var out []string
+	positional := 0
+	for _, a := range args {
+		if !strings.HasPrefix(a, "-") {
+			positional++
+		}
+	}
+	if positional == 0 {
+		switch {
+		case stateKeyCommands[cmd]:
+			out = append(out, fetchIDs(cfg, "/api/state", "key")...)
+		case instanceCommands[cmd]:
+			out = append(out, fetchIDs(cfg, "/api/instances", "id")...)
+		}
+	}
+	out = append(out, sortedKeys(node.flags)...)
+	return append(out, globalFlags...)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// fetchIDs lists a resource and returns field of each item. Completion
+// must stay quick, so it gives up after two seconds and ignores errors.
+func fetchIDs(cfg *config, path, field string) []string {
+	req, err := http.NewRequest("GET", strings.TrimRight(cfg.Server, "/")+path, nil)
+	if err != nil {
+		return nil
+	}
+	if cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+cfg.Token)
+	}
+	resp, err := (&http.Client{Timeout: 2 * time.Second}).Do(req)
+	if err != nil {
+		return nil
+	}
+	defer resp.Body.Close()
+	var items []map[string]any
+	if resp.StatusCode != http.StatusOK || json.NewDecoder(resp.Body).Decode(&items) != nil {
+		return nil
+	}
+	var out []string
+	for _, item := range items {
+		if v, ok := item[field].(string); ok && v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// handleComplete serves the hidden __complete command the completion
+// scripts call: it prints one candidate per line.
+func handleComplete(args []string) {
+	for _, c := range completeWords(loadConfig(), args) {
+		fmt.Println(c)
+	}
+}
+
+func handleCompletion(args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: koor-cli completion <bash|zsh|fish>")
+		os.Exit(1)
+	}
+	script, ok := completionScripts[args[0]]
+	if !ok {
+		fatal(fmt.Errorf("unsupported shell %q (want bash, zsh or fish)", args[0]))
+	}
+	fmt.Print(script)
+}
+
+// completionScripts hand the words typed so far to koor-cli __complete,
+// which knows the command tree and the server's resources.
+var completionScripts = map[string]string{
+	"bash": `# koor-cli bash completion. Load with: source <(koor-cli completion bash)
+_koor_cli() {
+    local cur=${COMP_WORDS[COMP_CWORD]}
+    local IFS=$'\n'
+    COMPREPLY=($(compgen -W "$(koor-cli __complete "${COMP_WORDS[@]:1:COMP_CWORD-1}" 2>/dev/null)" -- "$cur"))
+}
+complete -o default -F _koor_cli koor-cli
+`,
+	"zsh": `#compdef koor-cli
+# koor-cli zsh completion. Load with: source <(koor-cli completion zsh)
+_koor_cli() {
+    local -a candidates
+    candidates=(${(f)"$(koor-cli __complete ${words[2,CURRENT-1]} 2>/dev/null)"})
+    compadd -a candidates
+}
+compdef _koor_cli koor-cli
+`,
+	"fish": `# koor-cli fish completion. Load with: koor-cli completion fish | source
+function __koor_cli_complete
+    set -l tokens (commandline -opc)
+    koor-cli __complete $tokens[2..-1] 2>/dev/null
+end
+complete -c koor-cli -f -a '(__koor_cli_complete)'
+`,
+}
@@ -1,13 +1,40 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"debug/buildinfo"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/fs"
 	"net/http"
+	"net/http/httputil"
+	"net/url"
 	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"regexp/syntax"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
+
+	"github.com/DavidRHerbert/koor/internal/contracts"
+	"github.com/DavidRHerbert/koor/internal/specs"
+	"github.com/DavidRHerbert/koor/internal/wizard"
+	"github.com/DavidRHerbert/koor/pkg/client"
 )
 
 type config struct {
@@ -20,6 +47,18 @@ func main() {
 		printUsage()
 		os.Exit(1)
 	}
+	if os.Args[1] == "__complete" {
+		// Before output flags are parsed: the words may end with a bare -o.
+		handleComplete(os.Args[2:])
+		return
+	}
+	if err := parseOutputFlags(); err != nil {
+		fatal(err)
+	}
+	if len(os.Args) < 2 {
+		printUsage()
+		os.Exit(1)
+	}
 
 	switch os.Args[1] {
 	case "config":
@@ -39,9 +78,15 @@ func main() {
 	case "instances":
 		cfg := loadConfig()
 		handleInstances(cfg, os.Args[2:])
+	case "heartbeat":
+		cfg := loadConfig()
+		handleHeartbeat(cfg, os.Args[2:])
 	case "rules":
 		cfg := loadConfig()
 		handleRules(cfg, os.Args[2:])
+	case "rulepacks":
+		cfg := loadConfig()
+		handleRulePacks(cfg, os.Args[2:])
 	case "contract":
 		cfg := loadConfig()
 		handleContract(cfg, os.Args[2:])
@@ -75,6 +120,50 @@ func main() {
 	case "llm":
 		cfg := loadConfig()
 		handleLLM(cfg, os.Args[2:])
+	case "search":
+		cfg := loadConfig()
+		handleSearch(cfg, os.Args[2:])
+	case "digest":
+		cfg := loadConfig()
+		handleDigest(cfg, os.Args[2:])
+	case "validate":
+		cfg := loadConfig()
+		handleValidate(cfg, os.Args[2:])
+	case "projects":
+		cfg := loadConfig()
+		handleProjects(cfg, os.Args[2:])
+	case "policies":
+		cfg := loadConfig()
+		handlePolicies(cfg, os.Args[2:])
+	case "milestones":
+		cfg := loadConfig()
+		handleMilestones(cfg, os.Args[2:])
+	case "schedules":
+		cfg := loadConfig()
+		handleSchedules(cfg, os.Args[2:])
+	case "admin":
+		cfg := loadConfig()
+		handleAdmin(cfg, os.Args[2:])
+	case "tokens":
+		cfg := loadConfig()
+		handleTokens(cfg, os.Args[2:])
+	case "users":
+		cfg := loadConfig()
+		handleUsers(cfg, os.Args[2:])
+	case "tasks":
+		cfg := loadConfig()
+		handleTasks(cfg, os.Args[2:])
+	case "messages":
+		cfg := loadConfig()
+		handleMessages(cfg, os.Args[2:])
+	case "workspace":
+		cfg := loadConfig()
+		handleWorkspace(cfg, os.Args[2:])
+	case "completion":
+		handleCompletion(os.Args[2:])
+	case "repl":
+		cfg := loadConfig()
+		handleREPL(cfg)
 	case "help", "--help", "-h":
 		printUsage()
 	default:
@@ -85,81 +174,277 @@ func main() {
 }
 
 func printUsage() {
-	fmt.Fprintln(os.Stderr, `Usage: koor-cli <command> [args]
+	fmt.Fprintln(os.Stderr, usage)
+}
+
+// usage is the help text. Shell completion and the REPL read the command
+// tree from it too, so every command line starts with two spaces.
+const usage = `Usage: koor-cli <command> [args]
 
 Commands:
   config set server <url>         Set server URL
   config set token <token>        Set auth token
   status                          Check server health
+  completion <bash|zsh|fish>      Print a shell completion script
+  repl                            Interactive shell with history and Tab completion
 
-  state list                      List all state keys
+  state list [--prefix <p>] [--owner <id>] [--tag <t>] [--orphaned] [--limit N] [--cursor <key>]
+                                 List state keys with their metadata
   state get <key>                 Get state value
   state set <key> --file <path>   Set state from file
   state set <key> --data <json>   Set state from inline data
+  state set <key> ... --if-version N   Only write if the key is still at version N (0: must not exist)
   state delete <key>              Delete state key
+  state meta <key> [--owner <id>] [--description <d>] [--tag <t>]... [--schema <project/name>] [--delete]
+                                 Show, set or delete a key's metadata
   state history <key> [--limit N] List version history for a key
-  state rollback <key> --version N  Rollback to a previous version
+  state rollback <key> --version N [--dry-run]  Rollback to a previous version
   state diff <key> --v1 N --v2 N  Diff two versions of a key
+  state watch <key> [--interval 2s] [--events] [--exec <cmd>]
+                                 Print each new version of a key as it arrives
+  state compact <key> [--keep N] [--max-age <dur>]   Delete old versions of a key, by its retention policy or the flags
+  state compact --all             Apply the retention policies to every key now (admin)
+  state retention                 Show history retention policies
+  state retention set --file <path>   Replace the history retention policies (admin)
 
   specs list <project>            List specs for a project
-  specs get <project>/<name>      Get a spec
+  specs get <project>/<name> [--version N]   Get a spec, or an earlier version of it
   specs set <project>/<name> --file <path>   Set spec from file
   specs set <project>/<name> --data <json>   Set spec from inline data
   specs delete <project>/<name>   Delete a spec
-
-  events publish <topic> --data <json>   Publish an event
+  specs diff <project>/<name> --file <path> [--version N]
+                                 Diff a stored spec, or an earlier version, against a local file
+  specs merge <project>/<name> --file <path> --base N [--output <path>] [--push]
+                                 Three-way merge a local edit of version N with the current spec
+
+  events publish <topic> --data <json> [--sign-as <instance-id> --key-file <path>]   Publish an event
+  events publish <topic> --stdin [--set key=value] [--set key:=json]   Publish piped/templated payload
+  events publish --batch-file <events.ndjson|->   Publish one event per line in a single request
   events history [--last N] [--topic pattern] [--from ISO] [--to ISO] [--source name]
-  events subscribe [pattern]     Stream events via WebSocket
-
-  contract set <project>/<name> --file <path>   Store a contract
+                 [--after ID] [--before ID] [--limit N]
+  events latest [pattern]         Latest event of each matching topic
+  events subscribe [pattern] [--after <id>]
+                                 Stream events via WebSocket, replaying those after an ID
+  events retention               Show per-topic retention classes
+  events retention set --file <path>   Replace the retention classes (admin)
+
+  contract init --from-examples <req.json|-> [resp.json] --endpoint "POST /api/x" [--output <path>]
+  contract import <project>/<name> --openapi <spec.yaml> [--dry-run]   Convert an OpenAPI 3 spec into a contract
+  contract set <project>/<name> --file <path> [--dry-run]
+                                 Store a contract, after printing its compatibility report
   contract get <project>/<name>                Get a contract
+  contract diff <project>/<name> [--v1 N] [--v2 N]   Breaking and additive changes between stored versions
   contract validate <project>/<name> --endpoint "POST /api/x" --direction request --payload '{"k":"v"}'
-  contract test <project>/<name> --target http://localhost:8080
-
-  rules import --file <path>     Import rules from JSON file
+  contract test <project>/<name> --target http://localhost:8080 [--parallel N]
+  contract test <project>/<name> --env staging=https://...,local=http://... [--parallel N]
+  contract test-suite <project>/<name> --target <url> [--endpoint "GET /x"] [--case <name>]
+                                 Run the contract's named test cases, PASS/FAIL per case
+  contract drift <project>/<name>              Latest scheduled drift check against the running service
+  contract mock <project>/<name> [--port 8081] [--version N]   Serve a mock of the contract on a local port
+  contract record <project>/<name> --target http://localhost:8080 [--listen :8089] [--output <path>]
+                                 Proxy traffic to a service and store a draft contract from it
+
+  rules list <project>                     List a project's rules
+  rules import --file <path> [--dry-run]   Import rules from JSON file
+  rules lint --file <path>                 Check a rules file offline before importing
   rules export [--source <s>] [--output <path>]   Export rules as JSON
+  rules accept <project> <rule-id>... | --all     Accept proposed rules in bulk
+  rules auto-accept <project> [--severities <s,...> --min-accepted N | --delete]   Show or set the auto-accept policy
+
+  rulepacks install <file|url> --project <p> [--allow-downgrade]   Install or upgrade a rule pack
+  rulepacks list [--project <p>]           List installed rule packs
+  rulepacks sign <file> --key-file <path> [--output <path>]   Sign a rule pack with an Ed25519 key
 
   webhooks list                   List registered webhooks
-  webhooks add --id <id> --url <url> [--patterns "a.*,b.*"] [--secret <s>]
+  webhooks add --id <id> --url <url> [--patterns "a.*,b.*"] [--secret <s>] [--transform <preset> | --transform-file <path>]
+  webhooks update <id> [--url <url>] [--patterns "a.*,b.*"] [--active true|false] [--transform <preset> | --transform-file <path>]
+                                 Change a webhook; presets: slack, discord, json
   webhooks delete <id>           Delete a webhook
   webhooks test <id>             Fire a test event to a webhook
+  webhooks replay <id> --event <event-id> | --from <event-id> [--to <event-id>]   Re-deliver stored events
+  webhooks rotate-secret <id> [--secret <s>] [--grace 24h] Change (or generate) secret, signing with both during grace
+  webhooks verify --secret <s> --timestamp <ts> --event-id <id> --signature <sig> [--body-file <path>] [--tolerance 5m]
+                                 Check a delivery's X-Koor-Signature-256 (body from stdin by default)
+  webhooks deliveries <id> [--status success|failed|retrying] [--event <event-id>] [--limit N]
+                                 Show the delivery log
+  webhooks redeliver <id> <delivery-id>   Send a logged delivery again
+  webhooks dead-letters <id>     List events that exhausted their retries
 
   compliance history [--instance_id <id>] [--limit N]   Recent compliance runs
-  compliance run                 Force compliance check now
+  compliance run [--wait] [--fail-on error|warning]   Force compliance check now; exit 1 on failures
+  compliance report --instance_id <id> --kind <kind> [--path <p>]   Report a sandbox violation
+  compliance incidents [--instance_id <id>]   List sandbox incidents
+  compliance score [--instance_id <id>] [--since 24h]   Compliance score per agent
+  compliance contract-tests add --project <p> --contract <name> --target <url> [--interval 1h]
+  compliance contract-tests <list|delete|run|results> [id]   Scheduled live contract tests
+  compliance policies add --project <p> --check <check> [--name <n>] [--params <json>] [--severity error|warning]
+  compliance policies <list [--project <p>]|get <id>|delete <id>>   Per-project compliance policies
 
   templates list [--kind <k>] [--tag <t>]              List templates
   templates get <id>                                    Get template details
-  templates create --id <id> --name <name> --kind <kind> --file <path> [--tags "a,b"]
+  templates create --id <id> --name <name> --kind <kind> --file <path> [--tags "a,b"] [--params-file <path>]
   templates delete <id>                                 Delete a template
-  templates apply <id> --project <project>              Apply template to project
+  templates apply <id> --project <project> [--var key=value]... [--dry-run]
+                                                        Apply template to project
 
   audit [--actor <a>] [--action <a>] [--from ISO] [--to ISO] [--limit N]  Query audit log
   audit summary [--from ISO] [--to ISO]               Audit summary report
+  audit tail [--actor <a>] [--action <a>] [--last N] [--interval 2s]   Follow new audit entries live
+  audit export [--format ndjson|csv] [--from ISO] [--to ISO] [--output <path>]   Stream the full audit log
 
   metrics agents [--instance_id <id>] [--period <p>]  Per-agent metrics
   metrics agents <id> [--period <p>]                   Metrics for specific agent
+  metrics agents --agg p50,p95 [--group-by hour]       Aggregate hourly buckets (--csv for CSV)
 
   llm usage [--instance X] [--project X] [--session X] [--from ISO] [--to ISO] [--limit N]
                                  Query LLM usage records
   llm summary [--by model|instance|project|session_tag] [--from ISO] [--to ISO]
                                  LLM usage summary by grouping
 
+  search <query> [--types state,specs,rules,events,templates] [--limit N]
+                                 Full-text search across resources
+
+  digest --since <event-id|time|duration> [--project <p>] [--markdown]
+                                 Summarize activity since a checkpoint
+
+  validate <project> <file>... [--stack <s>] [--format github|gitlab] [--output <path>] [--no-baseline]
+                                 Check files against project rules; exit 1 on errors,
+                                 or write review annotations with --format
+  validate <project> <file>... --baseline [--stack <s>]
+                                 Record current violations as the project baseline
+  validate <project> --clear-baseline
+                                 Remove the project baseline
+  validate --daemon --project <p> --watch <dir>... [--stack <s>] [--interval 1s] [--publish]
+                                 Watch directories and validate files as they change
+  validate diff <project> --file <patch|-> [--stack <s>] [--format github|gitlab] [--output <path>] [--no-baseline]
+                                 Check only the lines a unified diff adds; exit 1 on errors
+
+  projects list                  List registered projects
+  projects init --file <koor.yaml> [--dir <parent>] [--no-scaffold] [--no-preload]
+                                 Scaffold workspaces and pre-load specs, rules and templates from a definition
+  projects create <project> [--description <text>]
+                                 Register a project (admin), so project tokens can be issued
+  projects status <project>      Agents, tasks, pending requests and milestones in one view
+  projects pending <project>     Prioritized list of requests, stale agents, unclaimed tasks and proposals
+  projects handoff <project> [--markdown] [--decisions N]
+                                 Briefing for a new controller session: plan, agents, approvals, decisions
+  projects budgets <project>     Each agent's failure rate against the project's error budgets
+  projects settings <project> [--file <path>] [--set key=value]... [--reset]
+                                 Show or update project settings
+  projects export <project> [--output <path>] [--state-prefix <p>] [--secrets] [--no-webhooks]
+                                 Export a project as a portable bundle
+  projects import <project> --file <path> [--state-prefix <p>] [--no-webhooks] [--dry-run]
+                                 Import a bundle, optionally under a new project name
+  projects delete <project> [--state-prefix <p>] [--dry-run]
+                                 Delete a project's specs, rules, settings, registration and state
+
+  milestones list <project>      Milestones with progress
+  milestones add <project> --name <n> [--due YYYY-MM-DD] [--task <t>]... [--event <topic>]...
+                                 Add a milestone
+  milestones get|delete <project> <id>   Show (with burn-down) or remove a milestone
+
+  schedules list                 List cron schedules with their next run
+  schedules add --cron "0 9 * * 1-5" --topic <topic> [--name <n>] [--timezone <tz>] [--data <json>|--file <path>]
+                                 Publish an event on a schedule
+  schedules get|delete|run <id>  Show, remove or fire a schedule now
+  schedules pause|resume <id>    Stop or restart a schedule's runs
+
+  policies list [--action <a>]   List write policies
+  policies add --action <event.publish|state.write> --resource <pattern> --condition <expr> [--name <n>]
+                                 Add a write policy
+  policies get|delete <id>       Show or remove a policy
+  policies check --action <a> --resource <r> [--instance_id <id>]
+                                 Check whether an instance may write
+
+  tasks list [--project <p>] [--queue <q>] [--status <s>] [--claimed-by <id>] [--limit N]
+                                 List tasks in claim order
+  tasks get <id>                 Show a task
+  tasks create <project> --title <t> [--queue <q>] [--priority N] [--payload <json>] [--max-attempts N]
+                                 Queue a task
+  tasks claim <project> --instance <id> [--queue <q>] [--visibility 30m]
+                                 Claim the next task; exit 2 if none is available
+  tasks complete <id> [--instance <id>] [--result <json>]   Mark a claimed task done
+  tasks fail <id> [--instance <id>] [--error <msg>]         Fail a claimed task (retried up to max attempts)
+  tasks requeue <id> [--queue <q>] [--priority N]           Reset a task to pending
+
+  messages send (--to <instance> | --capability <c> [--project <p>]) [--subject <s>] [--body <json|text>] [--reply-to <id>]
+                                 Send a message to an agent, or every active agent with a capability
+  messages inbox <instance> [--unread] [--limit N]          List an agent's messages, oldest first
+  messages get <id>              Show a message
+  messages ack <id>... [--instance <id>]                    Mark messages read
+
+  workspace verify               Check the agent workspace in the current directory:
+                                 instructions, mcp.json, ./koor-cli, server and instance
+
+  tokens list [--instance <id>]  List API tokens (admin)
+  tokens create --name <n> [--instance <id>] [--project <p>] [--scope <s>]... [--expires-in 720h] [--allow-topic <p>]... [--deny-topic <p>]...
+                                 Issue a scoped token; the secret is shown once
+  tokens rotate <id> [--grace 24h]
+                                 New secret; the old one keeps working during grace
+  tokens topics <id> [--allow-topic <p>]... [--deny-topic <p>]...
+                                 Replace the event topics a token may see; no patterns clears the limit
+  tokens revoke <id>             Revoke a token
+  tokens whoami                  Show the identity and scopes of the current token
+
+  users list                     List users and their roles (admin)
+  users add --name <n> --role <viewer|agent|controller|admin>
+                                 Create a user; the secret is shown once
+  users set-role <name> <role>   Change a user's role
+  users reset <name>             Issue a new secret for a user
+  users delete <name>            Delete a user
+
+  admin gc-report [--min-failures N]
+                                 Report orphaned state, rules, webhooks and templates
+  admin gc --category <c>... [--min-failures N] [--dry-run]
+                                 Delete orphaned resources in the given categories
+  admin generate-key             Print a new random encryption key
+  admin rotate-key               Re-encrypt state and specs under the current key
+  admin quarantine [--kind state|message] [--instance <id>]
+                                 List data quarantined from deregistered instances
+  admin quarantine sweep         Quarantine orphaned data now
+  admin quarantine restore <id>  Put a quarantined state key back
+  admin quarantine purge <id>    Delete a quarantined item
+  admin snapshot --output <path> [--format sqlite|json]
+                                 Save a copy of the whole server database
+  admin restore --file <path> [--yes]
+                                 Replace all server data with a snapshot (asks first)
+
   backup --output <path>         Backup all data to JSON file
-  restore --file <path>          Restore data from backup file
+  restore --file <path> [--dry-run]   Restore data from backup file
 
-  register <name> [--workspace <path>] [--intent <text>]   Register this agent
+  register <name> [--workspace <path>] [--intent <text>] [--project <p>] [--signing]
+                                 Register this agent
   activate <instance-id>         Activate agent (confirms CLI connectivity)
   instances list                 List registered instances
   instances get <id>             Get instance details
   instances stale                List stale (unresponsive) agents
+  instances match [--capability <c>]... [--prefer <c>]... [--stack <s>] [--project <p>] [--for <text>] [--max-open <n>] [--limit <n>]
+                                 Rank active agents for a piece of work
+  instances delete <id> [--cascade]
+                                 Deregister an instance; --cascade also deletes its state and inbox
+  instances stale-policy list    List stale-instance escalation policies
+  instances stale-policy get <project>
+                                 Show a project's escalation policy ("*" covers the rest)
+  instances stale-policy set <project> [--event] [--webhook <id>] [--reassign-tasks] [--deregister-after <dur>]
+                                 Set what happens when the project's agents go stale
+  instances stale-policy delete <project>
+                                 Remove a project's escalation policy
+  heartbeat start <instance-id> [--interval 60s] [--foreground]
+                                 Keep an agent from going stale: send heartbeats in the background
+  heartbeat stop <instance-id>   Stop the background heartbeat sender
+  heartbeat status <instance-id> Show whether the sender is running and when the agent was last seen
 
 Flags:
   --pretty                        Pretty-print JSON output
+  -o, --output table|json|yaml    Output format for list and get commands
+  --jsonpath, --query <expr>      Print part of the response, e.g. '.[0].id' or '{.[*].name}'
+  --dry-run                       Show what would change without changing it
+                                  (rules import, templates apply, state rollback,
+                                  projects import/delete, restore)
 
 Environment:
   KOOR_SERVER                     Server URL (overrides config)
-  KOOR_TOKEN                      Auth token (overrides config)`)
-}
+  KOOR_TOKEN                      Auth token (overrides config)`
 
 // --- Config management ---
 
@@ -254,13 +539,29 @@ func handleStatus(cfg *config) {
 
 func handleState(cfg *config, args []string) {
 	if len(args) < 1 {
-		fmt.Fprintln(os.Stderr, "usage: koor-cli state <list|get|set|delete> [args]")
+		fmt.Fprintln(os.Stderr, "usage: koor-cli state <list|get|set|delete|meta> [args]")
 		os.Exit(1)
 	}
 
 	switch args[0] {
 	case "list":
-		resp, err := doRequest(cfg, "GET", "/api/state", nil)
+		params := url.Values{}
+		for i := 1; i < len(args); i++ {
+			switch args[i] {
+			case "--owner", "--tag", "--prefix", "--limit", "--cursor":
+				if i+1 < len(args) {
+					params.Set(strings.TrimPrefix(args[i], "--"), args[i+1])
+					i++
+				}
+			case "--orphaned":
+				params.Set("orphaned", "true")
+			}
+		}
+		path := "/api/state"
+		if len(params) > 0 {
+			path += "?" + params.Encode()
+		}
+		resp, err := doRequest(cfg, "GET", path, nil)
 		if err != nil {
 			fatal(err)
 		}
@@ -281,20 +582,36 @@ func handleState(cfg *config, args []string) {
 
 	case "set":
 		if len(args) < 4 {
-			fmt.Fprintln(os.Stderr, "usage: koor-cli state set <key> --file <path> | --data <json>")
+			fmt.Fprintln(os.Stderr, "usage: koor-cli state set <key> --file <path> | --data <json> [--if-version N]")
 			os.Exit(1)
 		}
 		key := args[1]
-		body, err := readBodyArg(args[2:])
+		var rest []string
+		headers := map[string]string{}
+		for i := 2; i < len(args); i++ {
+			switch {
+			case args[i] == "--if-version" && i+1 < len(args):
+				headers["X-Koor-Expected-Version"] = args[i+1]
+				i++
+			case args[i] == "--pretty":
+			default:
+				rest = append(rest, args[i])
+			}
+		}
+		body, err := readBodyArg(rest)
 		if err != nil {
 			fatal(err)
 		}
-		resp, err := doRequest(cfg, "PUT", "/api/state/"+key, strings.NewReader(string(body)))
+		resp, err := doRequestWithHeaders(cfg, "PUT", "/api/state/"+key, strings.NewReader(string(body)), headers)
 		if err != nil {
 			fatal(err)
 		}
 		defer resp.Body.Close()
 		printResponse(resp)
+		if resp.StatusCode == http.StatusConflict {
+			// Someone else wrote the key since it was read; let scripts retry.
+			os.Exit(1)
+		}
 
 	case "delete":
 		if len(args) < 2 {
@@ -308,6 +625,46 @@ func handleState(cfg *config, args []string) {
 		defer resp.Body.Close()
 		printResponse(resp)
 
+	case "meta":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "usage: koor-cli state meta <key> [--owner <id>] [--description <d>] [--tag <t>]... [--schema <project/name>] [--delete]")
+			os.Exit(1)
+		}
+		path := "/api/state/" + args[1] + "/meta"
+		meta := map[string]any{}
+		tags := []string{}
+		method := "GET"
+		for i := 2; i < len(args); i++ {
+			switch args[i] {
+			case "--owner", "--description", "--schema":
+				if i+1 < len(args) {
+					meta[strings.TrimPrefix(args[i], "--")] = args[i+1]
+					method = "PUT"
+					i++
+				}
+			case "--tag":
+				if i+1 < len(args) {
+					tags = append(tags, args[i+1])
+					method = "PUT"
+					i++
+				}
+			case "--delete":
+				method = "DELETE"
+			}
+		}
+		var body io.Reader
+		if method == "PUT" {
+			meta["tags"] = tags
+			data, _ := json.Marshal(meta)
+			body = bytes.NewReader(data)
+		}
+		resp, err := doRequest(cfg, method, path, body)
+		if err != nil {
+			fatal(err)
+		}
+		defer resp.Body.Close()
+		printResponse(resp)
+
 	case "history":
 		if len(args) < 2 {
 			fmt.Fprintln(os.Stderr, "usage: koor-cli state history <key> [--limit N]")
@@ -339,17 +696,20 @@ func handleState(cfg *config, args []string) {
 		}
 		key := args[1]
 		version := ""
+		dryRun := ""
 		for i := 2; i < len(args); i++ {
 			if args[i] == "--version" && i+1 < len(args) {
 				version = args[i+1]
 				i++
+			} else if args[i] == "--dry-run" {
+				dryRun = "&dry_run=1"
 			}
 		}
 		if version == "" {
-			fmt.Fprintln(os.Stderr, "usage: koor-cli state rollback <key> --version N")
+			fmt.Fprintln(os.Stderr, "usage: koor-cli state rollback <key> --version N [--dry-run]")
 			os.Exit(1)
 		}
-		resp, err := doRequest(cfg, "POST", "/api/state/"+key+"?rollback="+version, nil)
+		resp, err := doRequest(cfg, "POST", "/api/state/"+key+"?rollback="+version+dryRun, nil)
 		if err != nil {
 			fatal(err)
 		}
@@ -388,6 +748,70 @@ func handleState(cfg *config, args []string) {
 		defer resp.Body.Close()
 		printResponse(resp)
 
+	case "watch":
+		watchState(cfg, args[1:])
+
+	case "compact":
+		if len(args) == 2 && args[1] == "--all" {
+			resp, err := doRequest(cfg, "POST", "/api/state-retention/compact", nil)
+			if err != nil {
+				fatal(err)
+			}
+			defer resp.Body.Close()
+			printResponse(resp)
+			return
+		}
+		if len(args) < 2 || strings.HasPrefix(args[1], "--") {
+			fmt.Fprintln(os.Stderr, "usage: koor-cli state compact <key> [--keep N] [--max-age <dur>] | --all")
+			os.Exit(1)
+		}
+		params := url.Values{"compact": {"1"}}
+		for i := 2; i < len(args); i++ {
+			switch args[i] {
+			case "--keep":
+				if i+1 < len(args) {
+					params.Set("keep", args[i+1])
+					i++
+				}
+			case "--max-age":
+				if i+1 < len(args) {
+					params.Set("max_age", args[i+1])
+					i++
+				}
+			}
+		}
+		resp, err := doRequest(cfg, "POST", "/api/state/"+args[1]+"?"+params.Encode(), nil)
+		if err != nil {
+			fatal(err)
+		}
+		defer resp.Body.Close()
+		printResponse(resp)
+
+	case "retention":
+		if len(args) == 1 {
+			resp, err := doRequest(cfg, "GET", "/api/state-retention", nil)
+			if err != nil {
+				fatal(err)
+			}
+			defer resp.Body.Close()
+			printResponse(resp)
+			return
+		}
+		if args[1] != "set" || len(args) != 4 || args[2] != "--file" {
+			fmt.Fprintln(os.Stderr, "usage: koor-cli state retention [set --file <path>]")
+			os.Exit(1)
+		}
+		data, err := os.ReadFile(args[3])
+		if err != nil {
+			fatal(err)
+		}
+		resp, err := doRequest(cfg, "PUT", "/api/state-retention", bytes.NewReader(data))
+		if err != nil {
+			fatal(err)
+		}
+		defer resp.Body.Close()
+		printResponse(resp)
+
 	default:
 		fmt.Fprintf(os.Stderr, "unknown state command: %s\n", args[0])
 		os.Exit(1)
@@ -398,7 +822,7 @@ func handleState(cfg *config, args []string) {
 
 func handleSpecs(cfg *config, args []string) {
 	if len(args) < 1 {
-		fmt.Fprintln(os.Stderr, "usage: koor-cli specs <list|get|set|delete> [args]")
+		fmt.Fprintln(os.Stderr, "usage: koor-cli specs <list|get|set|delete|diff|merge> [args]")
 		os.Exit(1)
 	}
 
@@ -417,11 +841,15 @@ func handleSpecs(cfg *config, args []string) {
 
 	case "get":
 		if len(args) < 2 {
-			fmt.Fprintln(os.Stderr, "usage: koor-cli specs get <project>/<name>")
+			fmt.Fprintln(os.Stderr, "usage: koor-cli specs get <project>/<name> [--version N]")
 			os.Exit(1)
 		}
 		project, name := parseSpecPath(args[1])
-		resp, err := doRequest(cfg, "GET", "/api/specs/"+project+"/"+name, nil)
+		path := "/api/specs/" + project + "/" + name
+		if len(args) >= 4 && args[2] == "--version" {
+			path += "?version=" + url.QueryEscape(args[3])
+		}
+		resp, err := doRequest(cfg, "GET", path, nil)
 		if err != nil {
 			fatal(err)
 		}
@@ -458,33 +886,390 @@ func handleSpecs(cfg *config, args []string) {
 		defer resp.Body.Close()
 		printResponse(resp)
 
+	case "diff":
+		file, version := "", ""
+		for i := 2; i+1 < len(args); i += 2 {
+			switch args[i] {
+			case "--file":
+				file = args[i+1]
+			case "--version":
+				version = args[i+1]
+			}
+		}
+		if len(args) < 4 || file == "" {
+			fmt.Fprintln(os.Stderr, "usage: koor-cli specs diff <project>/<name> --file <path> [--version N]")
+			os.Exit(1)
+		}
+		project, name := parseSpecPath(args[1])
+		localVal := readJSONFile(file)
+		storedVal, storedVersion := fetchSpec(cfg, project, name, version)
+
+		lines := diffJSON("", storedVal, localVal)
+		if len(lines) == 0 {
+			fmt.Println("no differences")
+			return
+		}
+		label := project + "/" + name
+		if version != "" {
+			label += " v" + storedVersion
+		}
+		fmt.Printf("--- %s (server)\n+++ %s (local)\n", label, file)
+		for _, line := range lines {
+			fmt.Println(line)
+		}
+		os.Exit(1)
+
+	case "merge":
+		specsMerge(cfg, args[1:])
+
 	default:
 		fmt.Fprintf(os.Stderr, "unknown specs command: %s\n", args[0])
 		os.Exit(1)
 	}
 }
 
+// diffJSON compares two decoded JSON values and returns one line per
+// difference: "+ path: value" for additions, "- path: value" for removals
+// and "~ path: old -> new" for changes. Objects are compared key by key;
+// arrays are compared element by element.
+func diffJSON(path string, old, new any) []string {
+	label := path
+	if label == "" {
+		label = "(root)"
+	}
+	oldMap, oldIsMap := old.(map[string]any)
+	newMap, newIsMap := new.(map[string]any)
+	if oldIsMap && newIsMap {
+		keys := map[string]bool{}
+		for k := range oldMap {
+			keys[k] = true
+		}
+		for k := range newMap {
+			keys[k] = true
+		}
+		sorted := make([]string, 0, len(keys))
+		for k := range keys {
+			sorted = append(sorted, k)
+		}
+		sort.Strings(sorted)
+
+		var lines []string
+		for _, k := range sorted {
+			sub := k
+			if path != "" {
+				sub = path + "." + k
+			}
+			o, inOld := oldMap[k]
+			n, inNew := newMap[k]
+			switch {
+			case !inOld:
+				lines = append(lines, "+ "+sub+": "+compactJSON(n))
+			case !inNew:
+				lines = append(lines, "- "+sub+": "+compactJSON(o))
+			default:
+				lines = append(lines, diffJSON(sub, o, n)...)
+			}
+		}
+		return lines
+	}
+
+	oldArr, oldIsArr := old.([]any)
+	newArr, newIsArr := new.([]any)
+	if oldIsArr && newIsArr {
+		var lines []string
+		for i := 0; i < len(oldArr) || i < len(newArr); i++ {
+			sub := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= len(oldArr):
+				lines = append(lines, "+ "+sub+": "+compactJSON(newArr[i]))
+			case i >= len(newArr):
+				lines = append(lines, "- "+sub+": "+compactJSON(oldArr[i]))
+			default:
+				lines = append(lines, diffJSON(sub, oldArr[i], newArr[i])...)
+			}
+		}
+		return lines
+	}
+
+	if o, n := compactJSON(old), compactJSON(new); o != n {
+		return []string{"~ " + label + ": " + o + " -> " + n}
+	}
+	return nil
+}
+
+func compactJSON(v any) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// readJSONFile reads and decodes a local JSON file, exiting on failure.
+func readJSONFile(path string) any {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fatal(fmt.Errorf("read file %s: %w", path, err))
+	}
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		fatal(fmt.Errorf("invalid JSON in %s: %w", path, err))
+	}
+	return v
+}
+
+// fetchSpec gets a spec, or one version of it when version is set, and
+// returns it decoded with its version number. It exits on failure.
+func fetchSpec(cfg *config, project, name, version string) (any, string) {
+	path := "/api/specs/" + project + "/" + name
+	if version != "" {
+		path += "?version=" + url.QueryEscape(version)
+	}
+	resp, err := doRequest(cfg, "GET", path, nil)
+	if err != nil {
+		fatal(err)
+	}
+	stored, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		fmt.Print(string(stored))
+		os.Exit(1)
+	}
+	var v any
+	if err := json.Unmarshal(stored, &v); err != nil {
+		fatal(fmt.Errorf("stored spec is not JSON: %w", err))
+	}
+	return v, resp.Header.Get("X-Koor-Version")
+}
+
+// specsMerge merges the changes made to a local copy of version --base of a
+// spec with the changes made on the server since, and prints the result.
+// Conflicting changes keep the local value and are listed on stderr.
+func specsMerge(cfg *config, args []string) {
+	file, base, output, push := "", "", "", false
+	for i := 1; i < len(args); i++ {
+		switch args[i] {
+		case "--file":
+			if i+1 < len(args) {
+				file = args[i+1]
+				i++
+			}
+		case "--base":
+			if i+1 < len(args) {
+				base = args[i+1]
+				i++
+			}
+		case "--output":
+			if i+1 < len(args) {
+				output = args[i+1]
+				i++
+			}
+		case "--push":
+			push = true
+		}
+	}
+	if len(args) < 1 || file == "" || base == "" {
+		fmt.Fprintln(os.Stderr, "usage: koor-cli specs merge <project>/<name> --file <path> --base N [--output <path>] [--push]")
+		os.Exit(1)
+	}
+	project, name := parseSpecPath(args[0])
+	localVal := readJSONFile(file)
+	baseVal, _ := fetchSpec(cfg, project, name, base)
+	serverVal, serverVersion := fetchSpec(cfg, project, name, "")
+
+	merged, conflicts := mergeJSON("", baseVal, serverVal, localVal)
+	data, _ := json.MarshalIndent(merged, "", "  ")
+	data = append(data, '\n')
+	if output != "" {
+		if err := os.WriteFile(output, data, 0o644); err != nil {
+			fatal(fmt.Errorf("write %s: %w", output, err))
+		}
+	} else if !push || len(conflicts) > 0 {
+		os.Stdout.Write(data)
+	}
+
+	fmt.Fprintf(os.Stderr, "merged %s (base v%s, server v%s) with %s: %d conflict(s)\n",
+		project+"/"+name, base, serverVersion, file, len(conflicts))
+	for _, c := range conflicts {
+		fmt.Fprintln(os.Stderr, c)
+	}
+	if len(conflicts) > 0 {
+		if push {
+			fmt.Fprintln(os.Stderr, "not pushed: resolve the conflicts and push with specs set")
+		}
+		os.Exit(1)
+	}
+	if push {
+		resp, err := doRequest(cfg, "PUT", "/api/specs/"+project+"/"+name, bytes.NewReader(data))
+		if err != nil {
+			fatal(err)
+		}
+		defer resp.Body.Close()
+		printResponse(resp)
+	}
+}
+
+// absent stands for a key that is missing from one side of a merge.
+type absent struct{}
+
+// mergeJSON merges the changes base->local into base->server. Where only
+// one side changed a value, that change wins; where both sides changed it
+// to the same thing, so does that. Objects changed on both sides are merged
+// key by key; any other value changed differently on both sides, arrays
+// included, is a conflict that keeps the local value and is reported as
+// "! path: base B, server S, local L".
+func mergeJSON(path string, base, server, local any) (any, []string) {
+	switch {
+	case sameJSON(server, local), sameJSON(base, local):
+		return server, nil
+	case sameJSON(base, server):
+		return local, nil
+	}
+
+	serverMap, serverIsMap := server.(map[string]any)
+	localMap, localIsMap := local.(map[string]any)
+	baseMap, baseIsMap := base.(map[string]any)
+	if _, none := base.(absent); none {
+		baseMap, baseIsMap = map[string]any{}, true
+	}
+	if serverIsMap && localIsMap && baseIsMap {
+		keys := map[string]bool{}
+		for _, m := range []map[string]any{baseMap, serverMap, localMap} {
+			for k := range m {
+				keys[k] = true
+			}
+		}
+		sorted := make([]string, 0, len(keys))
+		for k := range keys {
+			sorted = append(sorted, k)
+		}
+		sort.Strings(sorted)
+
+		out := map[string]any{}
+		var conflicts []string
+		for _, k := range sorted {
+			sub := k
+			if path != "" {
+				sub = path + "." + k
+			}
+			v, c := mergeJSON(sub, valueOrAbsent(baseMap, k), valueOrAbsent(serverMap, k), valueOrAbsent(localMap, k))
+			if _, none := v.(absent); !none {
+				out[k] = v
+			}
+			conflicts = append(conflicts, c...)
+		}
+		return out, conflicts
+	}
+
+	label := path
+	if label == "" {
+		label = "(root)"
+	}
+	return local, []string{fmt.Sprintf("! %s: base %s, server %s, local %s",
+		label, mergeText(base), mergeText(server), mergeText(local))}
+}
+
+func valueOrAbsent(m map[string]any, key string) any {
+	if v, ok := m[key]; ok {
+		return v
+	}
+	return absent{}
+}
+
+func sameJSON(a, b any) bool {
+	_, aNone := a.(absent)
+	_, bNone := b.(absent)
+	if aNone || bNone {
+		return aNone == bNone
+	}
+	return compactJSON(a) == compactJSON(b)
+}
+
+func mergeText(v any) string {
+	if _, none := v.(absent); none {
+		return "(none)"
+	}
+	return compactJSON(v)
+}
+
 // --- Events commands ---
 
 func handleEvents(cfg *config, args []string) {
 	if len(args) < 1 {
-		fmt.Fprintln(os.Stderr, "usage: koor-cli events <publish|history|subscribe> [args]")
+		fmt.Fprintln(os.Stderr, "usage: koor-cli events <publish|history|latest|subscribe|retention> [args]")
 		os.Exit(1)
 	}
 
 	switch args[0] {
 	case "publish":
-		if len(args) < 4 {
-			fmt.Fprintln(os.Stderr, "usage: koor-cli events publish <topic> --data <json>")
+		if len(args) >= 2 && args[1] == "--batch-file" {
+			publishBatch(cfg, args[1:])
+			return
+		}
+		if len(args) < 3 {
+			fmt.Fprintln(os.Stderr, "usage: koor-cli events publish <topic> <--data <json>|--file <path>|--stdin> [--set key=value ...] [--sign-as <instance-id> --key-file <path>]")
 			os.Exit(1)
 		}
 		topic := args[1]
-		body, err := readBodyArg(args[2:])
-		if err != nil {
-			fatal(err)
+		var body []byte
+		var sets []string
+		var signAs, keyFile string
+		for i := 2; i < len(args); i++ {
+			switch args[i] {
+			case "--data", "--file":
+				if i+1 < len(args) {
+					data, err := readBodyArg(args[i : i+2])
+					if err != nil {
+						fatal(err)
+					}
+					body = data
+					i++
+				}
+			case "--stdin":
+				data, err := io.ReadAll(os.Stdin)
+				if err != nil {
+					fatal(fmt.Errorf("read stdin: %w", err))
+				}
+				body = data
+			case "--set":
+				if i+1 < len(args) {
+					sets = append(sets, args[i+1])
+					i++
+				}
+			case "--sign-as":
+				if i+1 < len(args) {
+					signAs = args[i+1]
+					i++
+				}
+			case "--key-file":
+				if i+1 < len(args) {
+					keyFile = args[i+1]
+					i++
+				}
+			}
+		}
+		body = bytes.TrimSpace(body)
+		if len(body) == 0 && len(sets) == 0 {
+			fatal(fmt.Errorf("expected --data, --file, --stdin or --set"))
+		}
+		if len(sets) > 0 {
+			templated, err := applySets(body, sets)
+			if err != nil {
+				fatal(err)
+			}
+			body = templated
+		}
+		if (signAs == "") != (keyFile == "") {
+			fmt.Fprintln(os.Stderr, "--sign-as and --key-file must be used together")
+			os.Exit(1)
+		}
+		var headers map[string]string
+		if signAs != "" {
+			sig, err := signEvent(keyFile, topic, body)
+			if err != nil {
+				fatal(err)
+			}
+			headers = map[string]string{"X-Koor-Instance": signAs, "X-Koor-Signature": sig}
 		}
 		payload := fmt.Sprintf(`{"topic":%q,"data":%s}`, topic, string(body))
-		resp, err := doRequest(cfg, "POST", "/api/events/publish", strings.NewReader(payload))
+		resp, err := doRequestWithHeaders(cfg, "POST", "/api/events/publish", strings.NewReader(payload), headers)
 		if err != nil {
 			fatal(err)
 		}
@@ -521,29 +1306,95 @@ func handleEvents(cfg *config, args []string) {
 					params = append(params, "source="+args[i+1])
 					i++
 				}
-			}
-		}
-		if len(params) > 0 {
-			path += "?" + strings.Join(params, "&")
-		}
-		resp, err := doRequest(cfg, "GET", path, nil)
-		if err != nil {
-			fatal(err)
+			case "--after":
+				if i+1 < len(args) {
+					params = append(params, "after_id="+args[i+1])
+					i++
+				}
+			case "--before":
+				if i+1 < len(args) {
+					params = append(params, "before_id="+args[i+1])
+					i++
+				}
+			case "--limit":
+				if i+1 < len(args) {
+					params = append(params, "limit="+args[i+1])
+					i++
+				}
+			}
+		}
+		if len(params) > 0 {
+			path += "?" + strings.Join(params, "&")
+		}
+		resp, err := doRequest(cfg, "GET", path, nil)
+		if err != nil {
+			fatal(err)
+		}
+		defer resp.Body.Close()
+		printResponse(resp)
+
+	case "latest":
+		path := "/api/events/latest"
+		if len(args) > 1 {
+			path += "?topic=" + url.QueryEscape(args[1])
+		}
+		resp, err := doRequest(cfg, "GET", path, nil)
+		if err != nil {
+			fatal(err)
 		}
 		defer resp.Body.Close()
 		printResponse(resp)
 
 	case "subscribe":
 		pattern := "*"
-		if len(args) >= 2 {
-			pattern = args[1]
+		after := int64(-1)
+		for i := 1; i < len(args); i++ {
+			switch {
+			case args[i] == "--after" && i+1 < len(args):
+				n, err := strconv.ParseInt(args[i+1], 10, 64)
+				if err != nil || n < 0 {
+					fatal(fmt.Errorf("--after must be an event ID"))
+				}
+				after = n
+				i++
+			case !strings.HasPrefix(args[i], "--"):
+				pattern = args[i]
+			}
 		}
 		wsURL := strings.Replace(cfg.Server, "http://", "ws://", 1)
 		wsURL = strings.Replace(wsURL, "https://", "wss://", 1)
 		wsURL = strings.TrimRight(wsURL, "/") + "/api/events/subscribe?pattern=" + pattern
+		if after >= 0 {
+			wsURL += "&after_id=" + strconv.FormatInt(after, 10)
+		}
 
 		fmt.Fprintf(os.Stderr, "subscribing to %s (pattern: %s)...\n", wsURL, pattern)
-		streamWebSocket(cfg, wsURL)
+		streamWebSocket(cfg, wsURL, pattern, after)
+
+	case "retention":
+		if len(args) == 1 {
+			resp, err := doRequest(cfg, "GET", "/api/events/retention", nil)
+			if err != nil {
+				fatal(err)
+			}
+			defer resp.Body.Close()
+			printResponse(resp)
+			return
+		}
+		if args[1] != "set" || len(args) != 4 || args[2] != "--file" {
+			fmt.Fprintln(os.Stderr, "usage: koor-cli events retention [set --file <path>]")
+			os.Exit(1)
+		}
+		data, err := os.ReadFile(args[3])
+		if err != nil {
+			fatal(err)
+		}
+		resp, err := doRequest(cfg, "PUT", "/api/events/retention", bytes.NewReader(data))
+		if err != nil {
+			fatal(err)
+		}
+		defer resp.Body.Close()
+		printResponse(resp)
 
 	default:
 		fmt.Fprintf(os.Stderr, "unknown events command: %s\n", args[0])
@@ -551,7 +1402,9 @@ func handleEvents(cfg *config, args []string) {
 	}
 }
 
-func streamWebSocket(cfg *config, wsURL string) {
+// streamWebSocket follows events matching pattern. With after >= 0 it
+// starts with the events after that ID instead of the last few.
+func streamWebSocket(cfg *config, wsURL, pattern string, after int64) {
 	// Use nhooyr.io/websocket via the server's WS endpoint.
 	// The CLI uses a simple HTTP-upgrade approach with stdlib for portability.
 	dialer := &http.Client{}
@@ -578,30 +1431,56 @@ func streamWebSocket(cfg *config, wsURL string) {
 	fmt.Fprintln(os.Stderr, "")
 	fmt.Fprintln(os.Stderr, "falling back to polling history every 2 seconds...")
 
-	seen := map[int64]bool{}
-	for {
-		resp, err := doRequest(cfg, "GET", "/api/events/history?last=10", nil)
+	// Print the last few events, then follow the after_id cursor so each
+	// event is printed exactly once, however many arrive between polls.
+	topic := url.QueryEscape(pattern)
+	getJSON := func(path string, v any) error {
+		resp, err := doRequest(cfg, "GET", path, nil)
 		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != 200 {
+			return fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+		}
+		return json.Unmarshal(data, v)
+	}
+	var cursor int64
+	var recent []json.RawMessage
+	if after >= 0 {
+		cursor = after
+	} else if err := getJSON("/api/events/history?last=10&topic="+topic, &recent); err != nil {
+		fatal(err)
+	}
+	for i := len(recent) - 1; i >= 0; i-- {
+		var ev struct {
+			ID int64 `json:"id"`
+		}
+		json.Unmarshal(recent[i], &ev)
+		cursor = max(cursor, ev.ID)
+		fmt.Println(string(recent[i]))
+	}
+
+	for {
+		var page struct {
+			Events  []json.RawMessage `json:"events"`
+			HasMore bool              `json:"has_more"`
+			Cursor  int64             `json:"cursor"`
+		}
+		path := fmt.Sprintf("/api/events/history?after_id=%d&topic=%s&limit=100", cursor, topic)
+		if err := getJSON(path, &page); err != nil {
 			fmt.Fprintf(os.Stderr, "poll error: %v\n", err)
 			time.Sleep(2 * time.Second)
 			continue
 		}
-		data, _ := io.ReadAll(resp.Body)
-		resp.Body.Close()
-
-		var rawEvts []json.RawMessage
-		json.Unmarshal(data, &rawEvts)
-		for _, raw := range rawEvts {
-			var ev struct {
-				ID int64 `json:"id"`
-			}
-			json.Unmarshal(raw, &ev)
-			if !seen[ev.ID] {
-				seen[ev.ID] = true
-				fmt.Println(string(raw))
-			}
+		for _, raw := range page.Events {
+			fmt.Println(string(raw))
+		}
+		cursor = page.Cursor
+		if !page.HasMore {
+			time.Sleep(2 * time.Second)
 		}
-		time.Sleep(2 * time.Second)
 	}
 }
 
@@ -609,14 +1488,23 @@ func streamWebSocket(cfg *config, wsURL string) {
 
 func handleRegister(cfg *config, args []string) {
 	if len(args) < 1 {
-		fmt.Fprintln(os.Stderr, "usage: koor-cli register <name> [--workspace <path>] [--intent <text>]")
+		fmt.Fprintln(os.Stderr, "usage: koor-cli register <name> [--workspace <path>] [--intent <text>] [--project <p>] [--signing]")
 		os.Exit(1)
 	}
 	name := args[0]
 	workspace := ""
 	intent := ""
+	project := ""
+	signing := false
 	for i := 1; i < len(args); i++ {
 		switch args[i] {
+		case "--signing":
+			signing = true
+		case "--project":
+			if i+1 < len(args) {
+				project = args[i+1]
+				i++
+			}
 		case "--workspace":
 			if i+1 < len(args) {
 				workspace = args[i+1]
@@ -630,7 +1518,7 @@ func handleRegister(cfg *config, args []string) {
 		}
 	}
 
-	payload := fmt.Sprintf(`{"name":%q,"workspace":%q,"intent":%q}`, name, workspace, intent)
+	payload := fmt.Sprintf(`{"name":%q,"workspace":%q,"intent":%q,"project":%q,"signing":%t}`, name, workspace, intent, project, signing)
 	resp, err := doRequest(cfg, "POST", "/api/instances/register", strings.NewReader(payload))
 	if err != nil {
 		fatal(err)
@@ -653,9 +1541,194 @@ func handleActivate(cfg *config, args []string) {
 	printResponse(resp)
 }
 
+// --- Heartbeat commands ---
+
+// heartbeatPidFile is where a heartbeat sender for the instance records
+// its process ID, in the workspace next to settings.json.
+func heartbeatPidFile(id string) string {
+	return ".koor-heartbeat-" + id + ".pid"
+}
+
+func handleHeartbeat(cfg *config, args []string) {
+	if len(args) < 2 {
+		fmt.Fprintln(os.Stderr, "usage: koor-cli heartbeat <start|stop|status> <instance-id> [--interval 60s] [--foreground]")
+		os.Exit(1)
+	}
+	id := args[1]
+	pidFile := heartbeatPidFile(id)
+
+	switch args[0] {
+	case "start":
+		interval := 60 * time.Second
+		foreground := false
+		for i := 2; i < len(args); i++ {
+			switch args[i] {
+			case "--interval":
+				if i+1 < len(args) {
+					d, err := time.ParseDuration(args[i+1])
+					if err != nil || d < time.Second {
+						fatal(fmt.Errorf("invalid --interval %q (e.g. 30s, 2m; at least 1s)", args[i+1]))
+					}
+					interval = d
+					i++
+				}
+			case "--foreground":
+				foreground = true
+			}
+		}
+		// The detached sender finds the pidfile its parent wrote for it.
+		if pid, running := heartbeatRunning(pidFile); running && pid != os.Getpid() {
+			fatal(fmt.Errorf("heartbeat for %s already running (pid %d)", id, pid))
+		}
+		if foreground {
+			runHeartbeat(cfg, id, interval, pidFile)
+			return
+		}
+
+		// Run this command again in the foreground, detached, logging to a file.
+		exe, err := os.Executable()
+		if err != nil {
+			fatal(fmt.Errorf("find koor-cli executable: %w", err))
+		}
+		logFile := strings.TrimSuffix(pidFile, ".pid") + ".log"
+		logOut, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			fatal(fmt.Errorf("open log %s: %w", logFile, err))
+		}
+		defer logOut.Close()
+		cmd := exec.Command(exe, "heartbeat", "start", id, "--interval", interval.String(), "--foreground")
+		cmd.Stdout = logOut
+		cmd.Stderr = logOut
+		if err := cmd.Start(); err != nil {
+			fatal(fmt.Errorf("start heartbeat: %w", err))
+		}
+		if err := os.WriteFile(pidFile, []byte(strconv.Itoa(cmd.Process.Pid)+"\n"), 0o644); err != nil {
+			cmd.Process.Kill()
+			fatal(fmt.Errorf("write %s: %w", pidFile, err))
+		}
+		fmt.Printf("heartbeat for %s started every %s (pid %d, log %s)\n", id, interval, cmd.Process.Pid, logFile)
+		cmd.Process.Release()
+
+	case "stop":
+		pid, running := heartbeatRunning(pidFile)
+		if pid == 0 {
+			fatal(fmt.Errorf("no heartbeat running for %s", id))
+		}
+		if running {
+			proc, _ := os.FindProcess(pid)
+			if err := proc.Signal(os.Interrupt); err != nil {
+				proc.Kill()
+			}
+		}
+		os.Remove(pidFile)
+		fmt.Printf("heartbeat for %s stopped (pid %d)\n", id, pid)
+
+	case "status":
+		pid, running := heartbeatRunning(pidFile)
+		status := map[string]any{"instance_id": id, "running": running}
+		if running {
+			status["pid"] = pid
+		}
+		resp, err := doRequest(cfg, "GET", "/api/instances/"+id, nil)
+		if err == nil {
+			var inst struct {
+				Status   string `json:"status"`
+				LastSeen string `json:"last_seen"`
+			}
+			if resp.StatusCode == http.StatusOK && json.NewDecoder(resp.Body).Decode(&inst) == nil {
+				status["status"] = inst.Status
+				status["last_seen"] = inst.LastSeen
+			}
+			resp.Body.Close()
+		}
+		data, _ := json.Marshal(status)
+		printData(append(data, '\n'), true)
+		if !running {
+			os.Exit(1)
+		}
+
+	default:
+		fmt.Fprintf(os.Stderr, "unknown heartbeat command: %s\n", args[0])
+		os.Exit(1)
+	}
+}
+
+// heartbeatRunning reads a heartbeat pidfile and reports the recorded pid
+// and whether that process is still alive. A stale pidfile is removed.
+func heartbeatRunning(pidFile string) (int, bool) {
+	data, err := os.ReadFile(pidFile)
+	if err != nil {
+		return 0, false
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		os.Remove(pidFile)
+		return 0, false
+	}
+	proc, err := os.FindProcess(pid)
+	if err != nil || proc.Signal(syscall.Signal(0)) != nil {
+		os.Remove(pidFile)
+		return pid, false
+	}
+	return pid, true
+}
+
+// runHeartbeat sends a heartbeat now and then every interval until
+// interrupted or the instance is deregistered. Failed heartbeats are
+// logged and retried on the next tick.
+func runHeartbeat(cfg *config, id string, interval time.Duration, pidFile string) {
+	if err := os.WriteFile(pidFile, []byte(strconv.Itoa(os.Getpid())+"\n"), 0o644); err != nil {
+		fatal(fmt.Errorf("write %s: %w", pidFile, err))
+	}
+	defer os.Remove(pidFile)
+
+	// Keep running when the terminal that started the sender closes.
+	signal.Ignore(syscall.SIGHUP)
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+
+	beat := func() bool {
+		resp, err := doRequest(cfg, "POST", "/api/instances/"+id+"/heartbeat", nil)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s heartbeat failed: %v\n", time.Now().Format(time.RFC3339), err)
+			return true
+		}
+		defer resp.Body.Close()
+		switch resp.StatusCode {
+		case http.StatusOK:
+			return true
+		case http.StatusNotFound:
+			fmt.Fprintf(os.Stderr, "%s instance %s not found, stopping\n", time.Now().Format(time.RFC3339), id)
+			return false
+		}
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		fmt.Fprintf(os.Stderr, "%s heartbeat failed: HTTP %d: %s\n", time.Now().Format(time.RFC3339), resp.StatusCode, strings.TrimSpace(string(body)))
+		return true
+	}
+
+	fmt.Fprintf(os.Stderr, "%s sending heartbeats for %s every %s\n", time.Now().Format(time.RFC3339), id, interval)
+	if !beat() {
+		os.Remove(pidFile)
+		os.Exit(1)
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if !beat() {
+				os.Remove(pidFile)
+				os.Exit(1)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
 func handleInstances(cfg *config, args []string) {
 	if len(args) < 1 {
-		fmt.Fprintln(os.Stderr, "usage: koor-cli instances <list|get|stale> [args]")
+		fmt.Fprintln(os.Stderr, "usage: koor-cli instances <list|get|stale|match|delete|stale-policy> [args]")
 		os.Exit(1)
 	}
 
@@ -688,17 +1761,148 @@ func handleInstances(cfg *config, args []string) {
 		defer resp.Body.Close()
 		printResponse(resp)
 
+	case "match":
+		match := map[string]any{}
+		var caps, prefer []string
+		for i := 1; i < len(args); i++ {
+			if i+1 >= len(args) {
+				break
+			}
+			switch args[i] {
+			case "--capability":
+				caps = append(caps, args[i+1])
+			case "--prefer":
+				prefer = append(prefer, args[i+1])
+			case "--stack", "--project":
+				match[strings.TrimPrefix(args[i], "--")] = args[i+1]
+			case "--for":
+				match["description"] = args[i+1]
+			case "--max-open":
+				n, err := strconv.Atoi(args[i+1])
+				if err != nil {
+					fatal(fmt.Errorf("--max-open must be a number"))
+				}
+				match["max_open_tasks"] = n
+			case "--limit":
+				n, err := strconv.Atoi(args[i+1])
+				if err != nil {
+					fatal(fmt.Errorf("--limit must be a number"))
+				}
+				match["limit"] = n
+			default:
+				continue
+			}
+			i++
+		}
+		if caps != nil {
+			match["capabilities"] = caps
+		}
+		if prefer != nil {
+			match["prefer"] = prefer
+		}
+		data, _ := json.Marshal(match)
+		resp, err := doRequest(cfg, "POST", "/api/instances/match", bytes.NewReader(data))
+		if err != nil {
+			fatal(err)
+		}
+		defer resp.Body.Close()
+		printResponse(resp)
+
+	case "delete":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "usage: koor-cli instances delete <id> [--cascade]")
+			os.Exit(1)
+		}
+		path := "/api/instances/" + args[1]
+		if slices.Contains(args[2:], "--cascade") {
+			path += "?cascade=1"
+		}
+		resp, err := doRequest(cfg, "DELETE", path, nil)
+		if err != nil {
+			fatal(err)
+		}
+		defer resp.Body.Close()
+		printResponse(resp)
+
+	case "stale-policy":
+		handleStalePolicy(cfg, args[1:])
+
 	default:
 		fmt.Fprintf(os.Stderr, "unknown instances command: %s\n", args[0])
 		os.Exit(1)
 	}
 }
 
+func handleStalePolicy(cfg *config, args []string) {
+	if len(args) < 1 || args[0] != "list" && len(args) < 2 {
+		fmt.Fprintln(os.Stderr, "usage: koor-cli instances stale-policy <list|get|set|delete> [project]")
+		os.Exit(1)
+	}
+
+	var resp *http.Response
+	var err error
+	switch args[0] {
+	case "list":
+		resp, err = doRequest(cfg, "GET", "/api/liveness/policies", nil)
+
+	case "get":
+		resp, err = doRequest(cfg, "GET", "/api/liveness/policies/"+url.PathEscape(args[1]), nil)
+
+	case "set":
+		policy := map[string]any{"event": false, "reassign_tasks": false}
+		for i := 2; i < len(args); i++ {
+			switch args[i] {
+			case "--event":
+				policy["event"] = true
+			case "--reassign-tasks":
+				policy["reassign_tasks"] = true
+			case "--webhook":
+				if i+1 < len(args) {
+					policy["webhook"] = args[i+1]
+					i++
+				}
+			case "--deregister-after":
+				if i+1 < len(args) {
+					policy["deregister_after"] = args[i+1]
+					i++
+				}
+			}
+		}
+		body, _ := json.Marshal(policy)
+		resp, err = doRequest(cfg, "PUT", "/api/liveness/policies/"+url.PathEscape(args[1]), bytes.NewReader(body))
+
+	case "delete":
+		resp, err = doRequest(cfg, "DELETE", "/api/liveness/policies/"+url.PathEscape(args[1]), nil)
+
+	default:
+		fmt.Fprintf(os.Stderr, "unknown stale-policy command: %s\n", args[0])
+		os.Exit(1)
+	}
+	if err != nil {
+		fatal(err)
+	}
+	defer resp.Body.Close()
+	printResponse(resp)
+}
+
 // --- Webhook commands ---
 
+// webhookTransform returns a transform from --transform (a preset name or
+// template) or --transform-file (a template file).
+func webhookTransform(flag, value string) string {
+	if flag != "--transform-file" {
+		return value
+	}
+	data, err := os.ReadFile(value)
+	if err != nil {
+		fatal(err)
+	}
+	return string(data)
+}
+
 func handleWebhooks(cfg *config, args []string) {
 	if len(args) < 1 {
-		fmt.Fprintln(os.Stderr, "usage: koor-cli webhooks <list|add|delete|test> [args]")
+		fmt.Fprintln(os.Stderr, "usage: koor-cli webhooks <list|add|update|delete|test|replay|rotate-secret|verify|deliveries|redeliver|dead-letters> [args]")
 		os.Exit(1)
 	}
 
@@ -713,6 +1917,7 @@ func handleWebhooks(cfg *config, args []string) {
 
 	case "add":
 		id, url, patterns, secret := "", "", "", ""
+		body := map[string]any{}
 		for i := 1; i < len(args); i++ {
 			switch args[i] {
 			case "--id":
@@ -735,19 +1940,62 @@ func handleWebhooks(cfg *config, args []string) {
 					secret = args[i+1]
 					i++
 				}
+			case "--transform", "--transform-file":
+				if i+1 < len(args) {
+					body["transform"] = webhookTransform(args[i], args[i+1])
+					i++
+				}
 			}
 		}
 		if id == "" || url == "" {
-			fmt.Fprintln(os.Stderr, "usage: koor-cli webhooks add --id <id> --url <url> [--patterns \"a.*,b.*\"] [--secret <s>]")
+			fmt.Fprintln(os.Stderr, "usage: koor-cli webhooks add --id <id> --url <url> [--patterns \"a.*,b.*\"] [--secret <s>] [--transform <preset> | --transform-file <path>]")
 			os.Exit(1)
 		}
 		patternList := []string{"*"}
 		if patterns != "" {
 			patternList = strings.Split(patterns, ",")
 		}
-		patternsJSON, _ := json.Marshal(patternList)
-		payload := fmt.Sprintf(`{"id":%q,"url":%q,"patterns":%s,"secret":%q}`, id, url, string(patternsJSON), secret)
-		resp, err := doRequest(cfg, "POST", "/api/webhooks", strings.NewReader(payload))
+		body["id"], body["url"], body["patterns"], body["secret"] = id, url, patternList, secret
+		data, _ := json.Marshal(body)
+		resp, err := doRequest(cfg, "POST", "/api/webhooks", bytes.NewReader(data))
+		if err != nil {
+			fatal(err)
+		}
+		defer resp.Body.Close()
+		printResponse(resp)
+
+	case "update":
+		if len(args) < 2 || strings.HasPrefix(args[1], "--") {
+			fmt.Fprintln(os.Stderr, "usage: koor-cli webhooks update <id> [--url <url>] [--patterns \"a.*,b.*\"] [--active true|false] [--transform <preset> | --transform-file <path>]")
+			os.Exit(1)
+		}
+		body := map[string]any{}
+		for i := 2; i < len(args); i++ {
+			switch args[i] {
+			case "--url":
+				if i+1 < len(args) {
+					body["url"] = args[i+1]
+					i++
+				}
+			case "--patterns":
+				if i+1 < len(args) {
+					body["patterns"] = strings.Split(args[i+1], ",")
+					i++
+				}
+			case "--active":
+				if i+1 < len(args) {
+					body["active"] = args[i+1] == "true"
+					i++
+				}
+			case "--transform", "--transform-file":
+				if i+1 < len(args) {
+					body["transform"] = webhookTransform(args[i], args[i+1])
+					i++
+				}
+			}
+		}
+		data, _ := json.Marshal(body)
+		resp, err := doRequest(cfg, "PATCH", "/api/webhooks/"+args[1], bytes.NewReader(data))
 		if err != nil {
 			fatal(err)
 		}
@@ -778,40 +2026,129 @@ func handleWebhooks(cfg *config, args []string) {
 		defer resp.Body.Close()
 		printResponse(resp)
 
-	default:
-		fmt.Fprintf(os.Stderr, "unknown webhooks command: %s\n", args[0])
-		os.Exit(1)
-	}
-}
-
-// --- Compliance commands ---
-
-func handleCompliance(cfg *config, args []string) {
-	if len(args) < 1 {
-		fmt.Fprintln(os.Stderr, "usage: koor-cli compliance <history|run> [args]")
-		os.Exit(1)
-	}
-
-	switch args[0] {
-	case "history":
-		path := "/api/compliance/history"
-		params := []string{}
-		for i := 1; i < len(args); i++ {
+	case "replay":
+		body := map[string]int64{}
+		for i := 2; i < len(args); i++ {
 			switch args[i] {
-			case "--instance_id":
+			case "--event", "--from", "--to":
 				if i+1 < len(args) {
-					params = append(params, "instance_id="+args[i+1])
+					n, err := strconv.ParseInt(args[i+1], 10, 64)
+					if err != nil {
+						fatal(fmt.Errorf("%s must be an event ID", args[i]))
+					}
+					key := map[string]string{"--event": "event_id", "--from": "from_id", "--to": "to_id"}[args[i]]
+					body[key] = n
 					i++
 				}
-			case "--limit":
+			}
+		}
+		if len(args) < 2 || strings.HasPrefix(args[1], "--") || (body["event_id"] == 0 && body["from_id"] == 0) {
+			fmt.Fprintln(os.Stderr, "usage: koor-cli webhooks replay <id> --event <event-id>")
+			fmt.Fprintln(os.Stderr, "       koor-cli webhooks replay <id> --from <event-id> [--to <event-id>]")
+			os.Exit(1)
+		}
+		data, _ := json.Marshal(body)
+		resp, err := doRequest(cfg, "POST", "/api/webhooks/"+args[1]+"/replay", bytes.NewReader(data))
+		if err != nil {
+			fatal(err)
+		}
+		defer resp.Body.Close()
+		printResponse(resp)
+
+	case "verify":
+		flags := map[string]string{}
+		for i := 1; i < len(args); i++ {
+			switch args[i] {
+			case "--secret", "--timestamp", "--event-id", "--signature", "--body-file", "--tolerance":
 				if i+1 < len(args) {
-					params = append(params, "limit="+args[i+1])
+					flags[args[i]] = args[i+1]
+					i++
+				}
+			}
+		}
+		secret := flags["--secret"]
+		if secret == "" {
+			secret = os.Getenv("KOOR_WEBHOOK_SECRET")
+		}
+		if secret == "" || flags["--timestamp"] == "" || flags["--event-id"] == "" || flags["--signature"] == "" {
+			fmt.Fprintln(os.Stderr, "usage: koor-cli webhooks verify --secret <s> --timestamp <ts> --event-id <id> --signature <sig> [--body-file <path>] [--tolerance 5m]")
+			os.Exit(1)
+		}
+		var tolerance time.Duration
+		if v := flags["--tolerance"]; v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				fatal(fmt.Errorf("--tolerance must be a positive duration, e.g. 10m"))
+			}
+			tolerance = d
+		}
+		// The body is read raw, from the file or stdin: any reformatting
+		// breaks the signature.
+		var body []byte
+		var err error
+		if path := flags["--body-file"]; path != "" {
+			body, err = os.ReadFile(path)
+		} else {
+			body, err = io.ReadAll(os.Stdin)
+		}
+		if err != nil {
+			fatal(fmt.Errorf("read body: %w", err))
+		}
+		header := http.Header{}
+		header.Set("X-Koor-Timestamp", flags["--timestamp"])
+		header.Set("X-Koor-Event-Id", flags["--event-id"])
+		header.Set("X-Koor-Signature-256", flags["--signature"])
+		if err := client.VerifyWebhook(secret, header, body, tolerance); err != nil {
+			fatal(err)
+		}
+		fmt.Println("signature valid")
+
+	case "rotate-secret":
+		body := map[string]string{}
+		for i := 2; i < len(args); i++ {
+			switch args[i] {
+			case "--secret", "--grace":
+				if i+1 < len(args) {
+					body[strings.TrimPrefix(args[i], "--")] = args[i+1]
+					i++
+				}
+			}
+		}
+		if len(args) < 2 || strings.HasPrefix(args[1], "--") {
+			fmt.Fprintln(os.Stderr, "usage: koor-cli webhooks rotate-secret <id> [--secret <s>] [--grace 24h]")
+			os.Exit(1)
+		}
+		data, _ := json.Marshal(body)
+		resp, err := doRequest(cfg, "POST", "/api/webhooks/"+args[1]+"/rotate-secret", bytes.NewReader(data))
+		if err != nil {
+			fatal(err)
+		}
+		defer resp.Body.Close()
+		printResponse(resp)
+
+	case "deliveries":
+		if len(args) < 2 || strings.HasPrefix(args[1], "--") {
+			fmt.Fprintln(os.Stderr, "usage: koor-cli webhooks deliveries <id> [--status success|failed|retrying] [--event <event-id>] [--limit N]")
+			os.Exit(1)
+		}
+		params := url.Values{}
+		for i := 2; i < len(args); i++ {
+			switch args[i] {
+			case "--status", "--limit":
+				if i+1 < len(args) {
+					params.Set(strings.TrimPrefix(args[i], "--"), args[i+1])
+					i++
+				}
+			case "--event":
+				if i+1 < len(args) {
+					params.Set("event_id", args[i+1])
 					i++
 				}
 			}
 		}
+		path := "/api/webhooks/" + args[1] + "/deliveries"
 		if len(params) > 0 {
-			path += "?" + strings.Join(params, "&")
+			path += "?" + params.Encode()
 		}
 		resp, err := doRequest(cfg, "GET", path, nil)
 		if err != nil {
@@ -820,8 +2157,24 @@ func handleCompliance(cfg *config, args []string) {
 		defer resp.Body.Close()
 		printResponse(resp)
 
-	case "run":
-		resp, err := doRequest(cfg, "POST", "/api/compliance/run", nil)
+	case "redeliver":
+		if len(args) < 3 {
+			fmt.Fprintln(os.Stderr, "usage: koor-cli webhooks redeliver <id> <delivery-id>")
+			os.Exit(1)
+		}
+		resp, err := doRequest(cfg, "POST", "/api/webhooks/"+args[1]+"/deliveries/"+args[2]+"/redeliver", nil)
+		if err != nil {
+			fatal(err)
+		}
+		defer resp.Body.Close()
+		printResponse(resp)
+
+	case "dead-letters":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "usage: koor-cli webhooks dead-letters <id>")
+			os.Exit(1)
+		}
+		resp, err := doRequest(cfg, "GET", "/api/webhooks/"+args[1]+"/dead-letters", nil)
 		if err != nil {
 			fatal(err)
 		}
@@ -829,33 +2182,33 @@ func handleCompliance(cfg *config, args []string) {
 		printResponse(resp)
 
 	default:
-		fmt.Fprintf(os.Stderr, "unknown compliance command: %s\n", args[0])
+		fmt.Fprintf(os.Stderr, "unknown webhooks command: %s\n", args[0])
 		os.Exit(1)
 	}
 }
 
-// --- Template commands ---
+// --- Compliance commands ---
 
-func handleTemplates(cfg *config, args []string) {
+func handleCompliance(cfg *config, args []string) {
 	if len(args) < 1 {
-		fmt.Fprintln(os.Stderr, "usage: koor-cli templates <list|get|create|delete|apply> [args]")
+		fmt.Fprintln(os.Stderr, "usage: koor-cli compliance <history|run|score|report|incidents|contract-tests|policies> [args]")
 		os.Exit(1)
 	}
 
 	switch args[0] {
-	case "list":
-		path := "/api/templates"
+	case "history":
+		path := "/api/compliance/history"
 		params := []string{}
 		for i := 1; i < len(args); i++ {
 			switch args[i] {
-			case "--kind":
+			case "--instance_id":
 				if i+1 < len(args) {
-					params = append(params, "kind="+args[i+1])
+					params = append(params, "instance_id="+args[i+1])
 					i++
 				}
-			case "--tag":
+			case "--limit":
 				if i+1 < len(args) {
-					params = append(params, "tag="+args[i+1])
+					params = append(params, "limit="+args[i+1])
 					i++
 				}
 			}
@@ -870,113 +2223,224 @@ func handleTemplates(cfg *config, args []string) {
 		defer resp.Body.Close()
 		printResponse(resp)
 
-	case "get":
-		if len(args) < 2 {
-			fmt.Fprintln(os.Stderr, "usage: koor-cli templates get <id>")
-			os.Exit(1)
+	case "run":
+		wait := false
+		failOn := ""
+		for i := 1; i < len(args); i++ {
+			switch args[i] {
+			case "--wait":
+				wait = true
+			case "--fail-on":
+				if i+1 < len(args) {
+					failOn = args[i+1]
+					i++
+				}
+			}
 		}
-		resp, err := doRequest(cfg, "GET", "/api/templates/"+args[1], nil)
+		if failOn != "" && failOn != "error" && failOn != "warning" {
+			fatal(fmt.Errorf("--fail-on must be error or warning"))
+		}
+		resp, err := doRequest(cfg, "POST", "/api/compliance/run", nil)
 		if err != nil {
 			fatal(err)
 		}
 		defer resp.Body.Close()
-		printResponse(resp)
+		if !wait && failOn == "" {
+			printResponse(resp)
+			return
+		}
+		if failOn == "" {
+			failOn = "error"
+		}
+		os.Exit(gateComplianceRun(resp, failOn))
 
-	case "create":
-		id, name, kind, filePath, tags := "", "", "rules", "", ""
+	case "score", "incidents":
+		path := "/api/compliance/" + args[0]
+		params := []string{}
 		for i := 1; i < len(args); i++ {
 			switch args[i] {
-			case "--id":
-				if i+1 < len(args) {
-					id = args[i+1]
-					i++
-				}
-			case "--name":
-				if i+1 < len(args) {
-					name = args[i+1]
-					i++
-				}
-			case "--kind":
-				if i+1 < len(args) {
-					kind = args[i+1]
-					i++
-				}
-			case "--file":
+			case "--instance_id", "--since", "--limit":
 				if i+1 < len(args) {
-					filePath = args[i+1]
+					params = append(params, strings.TrimPrefix(args[i], "--")+"="+url.QueryEscape(args[i+1]))
 					i++
 				}
-			case "--tags":
+			}
+		}
+		if len(params) > 0 {
+			path += "?" + strings.Join(params, "&")
+		}
+		resp, err := doRequest(cfg, "GET", path, nil)
+		if err != nil {
+			fatal(err)
+		}
+		defer resp.Body.Close()
+		printResponse(resp)
+
+	case "report":
+		body := map[string]string{}
+		for i := 1; i < len(args); i++ {
+			switch args[i] {
+			case "--instance_id", "--kind", "--path", "--detail", "--reported_by":
 				if i+1 < len(args) {
-					tags = args[i+1]
+					body[strings.TrimPrefix(args[i], "--")] = args[i+1]
 					i++
 				}
 			}
 		}
-		if id == "" || name == "" || filePath == "" {
-			fmt.Fprintln(os.Stderr, "usage: koor-cli templates create --id <id> --name <name> --kind <kind> --file <path> [--tags \"a,b\"]")
+		if body["instance_id"] == "" || body["kind"] == "" {
+			fmt.Fprintln(os.Stderr, "usage: koor-cli compliance report --instance_id <id> --kind <write_outside_workspace|cross_agent_read|other> [--path <p>] [--detail <text>]")
 			os.Exit(1)
 		}
-
-		data, err := os.ReadFile(filePath)
+		data, _ := json.Marshal(body)
+		resp, err := doRequest(cfg, "POST", "/api/compliance/incidents", strings.NewReader(string(data)))
 		if err != nil {
-			fatal(fmt.Errorf("read file %s: %w", filePath, err))
+			fatal(err)
 		}
+		defer resp.Body.Close()
+		printResponse(resp)
 
-		tagList := []string{}
-		if tags != "" {
-			for _, t := range strings.Split(tags, ",") {
-				tagList = append(tagList, strings.TrimSpace(t))
+	case "contract-tests":
+		handleContractTests(cfg, args[1:])
+
+	case "policies":
+		handleCompliancePolicies(cfg, args[1:])
+
+	default:
+		fmt.Fprintf(os.Stderr, "unknown compliance command: %s\n", args[0])
+		os.Exit(1)
+	}
+}
+
+// gateComplianceRun prints one line per run from a completed compliance
+// run response and returns the exit status: 1 if any run has a violation
+// at or above failOn ("error" or "warning"), otherwise 0.
+func gateComplianceRun(resp *http.Response, failOn string) int {
+	data, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != 200 {
+		fmt.Print(string(data))
+		return 1
+	}
+	type issue struct {
+		Path     string `json:"path"`
+		Policy   string `json:"policy"`
+		Message  string `json:"message"`
+		Severity string `json:"severity"`
+	}
+	var result struct {
+		Runs []struct {
+			InstanceID string  `json:"instance_id"`
+			Project    string  `json:"project"`
+			Contract   string  `json:"contract"`
+			Policy     string  `json:"policy"`
+			Violations []issue `json:"violations"`
+			Findings   []issue `json:"findings"`
+		} `json:"runs"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		fatal(fmt.Errorf("decode compliance run: %w", err))
+	}
+
+	failed := 0
+	for _, run := range result.Runs {
+		// Policy findings are reported like contract violations.
+		subject := run.Contract
+		if run.Policy != "" {
+			subject = "policy " + run.Policy
+		}
+		for _, f := range run.Findings {
+			f.Path = f.Policy
+			run.Violations = append(run.Violations, f)
+		}
+		errs, warns := 0, 0
+		for _, v := range run.Violations {
+			if v.Severity == "warning" {
+				warns++
+			} else {
+				errs++
+			}
+		}
+		status := "PASS"
+		if errs > 0 || (failOn == "warning" && warns > 0) {
+			status = "FAIL"
+			failed++
+		} else if warns > 0 {
+			status = "WARN"
+		}
+		fmt.Printf("%s  %s  %s/%s  (%d errors, %d warnings)\n", status, run.InstanceID, run.Project, subject, errs, warns)
+		for _, v := range run.Violations {
+			severity := v.Severity
+			if severity == "" {
+				severity = "error"
 			}
+			fmt.Printf("      %s: %s: %s\n", severity, v.Path, v.Message)
 		}
+	}
+	fmt.Printf("%d runs, %d failed (fail-on: %s)\n", len(result.Runs), failed, failOn)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
 
-		reqBody, _ := json.Marshal(map[string]any{
-			"id":   id,
-			"name": name,
-			"kind": kind,
-			"data": json.RawMessage(data),
-			"tags": tagList,
-		})
+// handleContractTests manages scheduled live contract test runs.
+func handleContractTests(cfg *config, args []string) {
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, "usage: koor-cli compliance contract-tests <list|add|delete|run|results> [args]")
+		os.Exit(1)
+	}
 
-		resp, err := doRequest(cfg, "POST", "/api/templates", strings.NewReader(string(reqBody)))
+	switch args[0] {
+	case "list":
+		resp, err := doRequest(cfg, "GET", "/api/compliance/contract-tests", nil)
 		if err != nil {
 			fatal(err)
 		}
 		defer resp.Body.Close()
 		printResponse(resp)
 
-	case "delete":
-		if len(args) < 2 {
-			fmt.Fprintln(os.Stderr, "usage: koor-cli templates delete <id>")
+	case "add":
+		body := map[string]string{}
+		for i := 1; i < len(args); i++ {
+			switch args[i] {
+			case "--project", "--contract", "--target", "--interval":
+				if i+1 < len(args) {
+					body[strings.TrimPrefix(args[i], "--")] = args[i+1]
+					i++
+				}
+			}
+		}
+		if body["project"] == "" || body["contract"] == "" || body["target"] == "" {
+			fmt.Fprintln(os.Stderr, "usage: koor-cli compliance contract-tests add --project <p> --contract <name> --target <url> [--interval 1h]")
 			os.Exit(1)
 		}
-		resp, err := doRequest(cfg, "DELETE", "/api/templates/"+args[1], nil)
+		reqJSON, _ := json.Marshal(body)
+		resp, err := doRequest(cfg, "POST", "/api/compliance/contract-tests", strings.NewReader(string(reqJSON)))
 		if err != nil {
 			fatal(err)
 		}
 		defer resp.Body.Close()
 		printResponse(resp)
 
-	case "apply":
+	case "delete", "run", "results":
 		if len(args) < 2 {
-			fmt.Fprintln(os.Stderr, "usage: koor-cli templates apply <id> --project <project>")
+			fmt.Fprintf(os.Stderr, "usage: koor-cli compliance contract-tests %s <id>\n", args[0])
 			os.Exit(1)
 		}
-		tmplID := args[1]
-		project := ""
-		for i := 2; i < len(args); i++ {
-			if args[i] == "--project" && i+1 < len(args) {
-				project = args[i+1]
-				i++
+		id := args[1]
+		method, path := "DELETE", "/api/compliance/contract-tests/"+id
+		switch args[0] {
+		case "run":
+			method, path = "POST", path+"/run"
+		case "results":
+			method, path = "GET", path+"/results"
+			for i := 2; i < len(args); i++ {
+				if args[i] == "--limit" && i+1 < len(args) {
+					path += "?limit=" + args[i+1]
+					i++
+				}
 			}
 		}
-		if project == "" {
-			fmt.Fprintln(os.Stderr, "usage: koor-cli templates apply <id> --project <project>")
-			os.Exit(1)
-		}
-
-		reqBody, _ := json.Marshal(map[string]string{"project": project})
-		resp, err := doRequest(cfg, "POST", "/api/templates/"+tmplID+"/apply", strings.NewReader(string(reqBody)))
+		resp, err := doRequest(cfg, method, path, nil)
 		if err != nil {
 			fatal(err)
 		}
@@ -984,110 +2448,107 @@ func handleTemplates(cfg *config, args []string) {
 		printResponse(resp)
 
 	default:
-		fmt.Fprintf(os.Stderr, "unknown templates command: %s\n", args[0])
+		fmt.Fprintf(os.Stderr, "unknown contract-tests command: %s\n", args[0])
 		os.Exit(1)
 	}
 }
 
-// --- Audit commands ---
+// handleCompliancePolicies manages per-project compliance policies.
+func handleCompliancePolicies(cfg *config, args []string) {
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, "usage: koor-cli compliance policies <list|add|get|delete> [args]")
+		os.Exit(1)
+	}
 
-func handleAudit(cfg *config, args []string) {
-	// Check for "summary" subcommand.
-	if len(args) > 0 && args[0] == "summary" {
-		path := "/api/audit/summary"
-		params := []string{}
+	var resp *http.Response
+	var err error
+	switch args[0] {
+	case "list":
+		path := "/api/compliance/policies"
+		for i := 1; i < len(args); i++ {
+			if args[i] == "--project" && i+1 < len(args) {
+				path += "?project=" + url.QueryEscape(args[i+1])
+				i++
+			}
+		}
+		resp, err = doRequest(cfg, "GET", path, nil)
+
+	case "add":
+		body := map[string]any{}
 		for i := 1; i < len(args); i++ {
 			switch args[i] {
-			case "--from":
+			case "--project", "--check", "--name", "--severity", "--description":
 				if i+1 < len(args) {
-					params = append(params, "from="+args[i+1])
+					body[strings.TrimPrefix(args[i], "--")] = args[i+1]
 					i++
 				}
-			case "--to":
+			case "--params":
 				if i+1 < len(args) {
-					params = append(params, "to="+args[i+1])
+					if !json.Valid([]byte(args[i+1])) {
+						fatal(fmt.Errorf("--params must be a JSON object"))
+					}
+					body["params"] = json.RawMessage(args[i+1])
 					i++
 				}
 			}
 		}
-		if len(params) > 0 {
-			path += "?" + strings.Join(params, "&")
+		if body["project"] == nil || body["check"] == nil {
+			fmt.Fprintln(os.Stderr, "usage: koor-cli compliance policies add --project <p> --check <heartbeat_freshness|required_capabilities|required_state_keys|recent_validation_pass|max_pending_tasks> [--name <n>] [--params <json>] [--severity error|warning]")
+			os.Exit(1)
 		}
-		resp, err := doRequest(cfg, "GET", path, nil)
-		if err != nil {
-			fatal(err)
+		data, _ := json.Marshal(body)
+		resp, err = doRequest(cfg, "POST", "/api/compliance/policies", bytes.NewReader(data))
+
+	case "get", "delete":
+		if len(args) < 2 {
+			fmt.Fprintf(os.Stderr, "usage: koor-cli compliance policies %s <id>\n", args[0])
+			os.Exit(1)
 		}
-		defer resp.Body.Close()
-		printResponse(resp)
-		return
+		method := "GET"
+		if args[0] == "delete" {
+			method = "DELETE"
+		}
+		resp, err = doRequest(cfg, method, "/api/compliance/policies/"+args[1], nil)
+
+	default:
+		fmt.Fprintf(os.Stderr, "unknown policies command: %s\n", args[0])
+		os.Exit(1)
+	}
+	if err != nil {
+		fatal(err)
 	}
+	defer resp.Body.Close()
+	printResponse(resp)
+}
 
-	// Default: query audit log.
-	path := "/api/audit"
-	params := []string{}
-	for i := 0; i < len(args); i++ {
-		switch args[i] {
-		case "--actor":
-			if i+1 < len(args) {
-				params = append(params, "actor="+args[i+1])
-				i++
-			}
-		case "--action":
-			if i+1 < len(args) {
-				params = append(params, "action="+args[i+1])
-				i++
-			}
-		case "--from":
-			if i+1 < len(args) {
-				params = append(params, "from="+args[i+1])
-				i++
-			}
-		case "--to":
-			if i+1 < len(args) {
-				params = append(params, "to="+args[i+1])
-				i++
-			}
-		case "--limit":
-			if i+1 < len(args) {
-				params = append(params, "limit="+args[i+1])
-				i++
-			}
-		}
-	}
-	if len(params) > 0 {
-		path += "?" + strings.Join(params, "&")
-	}
-	resp, err := doRequest(cfg, "GET", path, nil)
-	if err != nil {
-		fatal(err)
-	}
-	defer resp.Body.Close()
-	printResponse(resp)
-}
-
-// --- Agent metrics commands ---
+// --- Template commands ---
 
-func handleMetricsCLI(cfg *config, args []string) {
-	if len(args) < 1 || args[0] != "agents" {
-		fmt.Fprintln(os.Stderr, "usage: koor-cli metrics agents [--instance_id <id>] [--period <p>]")
-		fmt.Fprintln(os.Stderr, "       koor-cli metrics agents <id> [--period <p>]")
+func handleTemplates(cfg *config, args []string) {
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, "usage: koor-cli templates <list|get|create|delete|apply> [args]")
 		os.Exit(1)
 	}
 
-	// Check if the second arg is an ID (not a flag).
-	if len(args) >= 2 && !strings.HasPrefix(args[1], "--") {
-		// metrics agents <id> [--period <p>]
-		id := args[1]
-		path := "/api/metrics/agents/" + id
-		period := ""
-		for i := 2; i < len(args); i++ {
-			if args[i] == "--period" && i+1 < len(args) {
-				period = args[i+1]
-				i++
+	switch args[0] {
+	case "list":
+		path := "/api/templates"
+		params := []string{}
+		for i := 1; i < len(args); i++ {
+			switch args[i] {
+			case "--kind":
+				if i+1 < len(args) {
+					params = append(params, "kind="+args[i+1])
+					i++
+				}
+			case "--tag":
+				if i+1 < len(args) {
+					params = append(params, "tag="+args[i+1])
+					i++
+				}
 			}
 		}
-		if period != "" {
-			path += "?period=" + period
+		if len(params) > 0 {
+			path += "?" + strings.Join(params, "&")
 		}
 		resp, err := doRequest(cfg, "GET", path, nil)
 		if err != nil {
@@ -1095,506 +2556,3769 @@ func handleMetricsCLI(cfg *config, args []string) {
 		}
 		defer resp.Body.Close()
 		printResponse(resp)
-		return
-	}
-
-	// metrics agents [--instance_id <id>] [--period <p>]
-	path := "/api/metrics/agents"
-	params := []string{}
-	for i := 1; i < len(args); i++ {
-		switch args[i] {
-		case "--instance_id":
-			if i+1 < len(args) {
-				params = append(params, "instance_id="+args[i+1])
-				i++
-			}
-		case "--period":
-			if i+1 < len(args) {
-				params = append(params, "period="+args[i+1])
-				i++
-			}
-		}
-	}
-	if len(params) > 0 {
-		path += "?" + strings.Join(params, "&")
-	}
-	resp, err := doRequest(cfg, "GET", path, nil)
-	if err != nil {
-		fatal(err)
-	}
-	defer resp.Body.Close()
-	printResponse(resp)
-}
-
-// --- Rules commands ---
-
-func handleRules(cfg *config, args []string) {
-	if len(args) < 1 {
-		fmt.Fprintln(os.Stderr, "usage: koor-cli rules <import|export> [args]")
-		os.Exit(1)
-	}
 
-	switch args[0] {
-	case "import":
-		filePath := ""
-		for i := 1; i < len(args); i++ {
-			if args[i] == "--file" && i+1 < len(args) {
-				filePath = args[i+1]
-				i++
-			}
-		}
-		if filePath == "" {
-			fmt.Fprintln(os.Stderr, "usage: koor-cli rules import --file <path>")
+	case "get":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "usage: koor-cli templates get <id>")
 			os.Exit(1)
 		}
-
-		data, err := os.ReadFile(filePath)
-		if err != nil {
-			fatal(fmt.Errorf("read file %s: %w", filePath, err))
-		}
-
-		// Validate it's a JSON array.
-		var rules []json.RawMessage
-		if err := json.Unmarshal(data, &rules); err != nil {
-			fatal(fmt.Errorf("invalid JSON in %s: %w", filePath, err))
-		}
-
-		resp, err := doRequest(cfg, "POST", "/api/rules/import", strings.NewReader(string(data)))
+		resp, err := doRequest(cfg, "GET", "/api/templates/"+args[1], nil)
 		if err != nil {
 			fatal(err)
 		}
 		defer resp.Body.Close()
 		printResponse(resp)
 
-	case "export":
-		source := ""
-		output := ""
+	case "create":
+		id, name, kind, filePath, tags, paramsPath := "", "", "rules", "", "", ""
 		for i := 1; i < len(args); i++ {
 			switch args[i] {
-			case "--source":
+			case "--params-file":
 				if i+1 < len(args) {
-					source = args[i+1]
+					paramsPath = args[i+1]
 					i++
 				}
-			case "--output":
+			case "--id":
 				if i+1 < len(args) {
-					output = args[i+1]
+					id = args[i+1]
+					i++
+				}
+			case "--name":
+				if i+1 < len(args) {
+					name = args[i+1]
+					i++
+				}
+			case "--kind":
+				if i+1 < len(args) {
+					kind = args[i+1]
+					i++
+				}
+			case "--file":
+				if i+1 < len(args) {
+					filePath = args[i+1]
+					i++
+				}
+			case "--tags":
+				if i+1 < len(args) {
+					tags = args[i+1]
 					i++
 				}
 			}
 		}
-
-		path := "/api/rules/export"
-		if source != "" {
-			path += "?source=" + source
+		if id == "" || name == "" || filePath == "" {
+			fmt.Fprintln(os.Stderr, "usage: koor-cli templates create --id <id> --name <name> --kind <kind> --file <path> [--tags \"a,b\"] [--params-file <path>]")
+			os.Exit(1)
 		}
 
-		resp, err := doRequest(cfg, "GET", path, nil)
+		data, err := os.ReadFile(filePath)
 		if err != nil {
-			fatal(err)
+			fatal(fmt.Errorf("read file %s: %w", filePath, err))
 		}
-		defer resp.Body.Close()
 
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			fatal(fmt.Errorf("read response: %w", err))
+		tagList := []string{}
+		if tags != "" {
+			for _, t := range strings.Split(tags, ",") {
+				tagList = append(tagList, strings.TrimSpace(t))
+			}
 		}
 
-		// Pretty-print the JSON.
-		var v any
-		if err := json.Unmarshal(body, &v); err == nil {
-			body, _ = json.MarshalIndent(v, "", "  ")
+		body := map[string]any{
+			"id":   id,
+			"name": name,
+			"kind": kind,
+			"data": json.RawMessage(data),
+			"tags": tagList,
 		}
-
-		if output != "" {
-			if err := os.WriteFile(output, append(body, '\n'), 0o644); err != nil {
-				fatal(fmt.Errorf("write file %s: %w", output, err))
+		if paramsPath != "" {
+			params, err := os.ReadFile(paramsPath)
+			if err != nil {
+				fatal(fmt.Errorf("read file %s: %w", paramsPath, err))
 			}
-			fmt.Fprintf(os.Stderr, "exported to %s\n", output)
-		} else {
-			fmt.Println(string(body))
+			body["params"] = json.RawMessage(params)
 		}
 
-	default:
-		fmt.Fprintf(os.Stderr, "unknown rules command: %s\n", args[0])
-		os.Exit(1)
-	}
-}
-
-// --- Contract commands ---
-
-func handleContract(cfg *config, args []string) {
-	if len(args) < 1 {
-		fmt.Fprintln(os.Stderr, "usage: koor-cli contract <set|get|validate|test> [args]")
-		os.Exit(1)
-	}
+		reqBody, _ := json.Marshal(body)
 
-	switch args[0] {
-	case "set":
-		if len(args) < 4 {
-			fmt.Fprintln(os.Stderr, "usage: koor-cli contract set <project>/<name> --file <path>")
-			os.Exit(1)
-		}
-		project, name := parseSpecPath(args[1])
-		body, err := readBodyArg(args[2:])
+		resp, err := doRequest(cfg, "POST", "/api/templates", strings.NewReader(string(reqBody)))
 		if err != nil {
 			fatal(err)
 		}
+		defer resp.Body.Close()
+		printResponse(resp)
 
-		// Validate it's a valid contract before storing.
-		var contract map[string]any
-		if err := json.Unmarshal(body, &contract); err != nil {
-			fatal(fmt.Errorf("invalid JSON: %w", err))
-		}
-		if contract["kind"] != "contract" {
-			fatal(fmt.Errorf("JSON must have \"kind\": \"contract\""))
+	case "delete":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "usage: koor-cli templates delete <id>")
+			os.Exit(1)
 		}
-
-		resp, err := doRequest(cfg, "PUT", "/api/specs/"+project+"/"+name, strings.NewReader(string(body)))
+		resp, err := doRequest(cfg, "DELETE", "/api/templates/"+args[1], nil)
 		if err != nil {
 			fatal(err)
 		}
 		defer resp.Body.Close()
 		printResponse(resp)
 
-	case "get":
+	case "apply":
 		if len(args) < 2 {
-			fmt.Fprintln(os.Stderr, "usage: koor-cli contract get <project>/<name>")
+			fmt.Fprintln(os.Stderr, "usage: koor-cli templates apply <id> --project <project>")
 			os.Exit(1)
 		}
-		project, name := parseSpecPath(args[1])
-		resp, err := doRequest(cfg, "GET", "/api/specs/"+project+"/"+name, nil)
+		tmplID := args[1]
+		project := ""
+		vars := map[string]string{}
+		path := "/api/templates/" + tmplID + "/apply"
+		for i := 2; i < len(args); i++ {
+			if args[i] == "--project" && i+1 < len(args) {
+				project = args[i+1]
+				i++
+			} else if args[i] == "--var" && i+1 < len(args) {
+				k, v, ok := strings.Cut(args[i+1], "=")
+				if !ok || k == "" {
+					fatal(fmt.Errorf("--var must be key=value, got %q", args[i+1]))
+				}
+				vars[k] = v
+				i++
+			} else if args[i] == "--dry-run" {
+				path += "?dry_run=1"
+			}
+		}
+		if project == "" {
+			fmt.Fprintln(os.Stderr, "usage: koor-cli templates apply <id> --project <project> [--var key=value]... [--dry-run]")
+			os.Exit(1)
+		}
+
+		reqBody, _ := json.Marshal(map[string]any{"project": project, "vars": vars})
+		resp, err := doRequest(cfg, "POST", path, strings.NewReader(string(reqBody)))
 		if err != nil {
 			fatal(err)
 		}
 		defer resp.Body.Close()
+		printResponse(resp)
 
-		data, _ := io.ReadAll(resp.Body)
-		if resp.StatusCode != 200 {
-			fmt.Print(string(data))
-			os.Exit(1)
-		}
-
-		// Always pretty-print contracts for readability.
-		var v any
-		if err := json.Unmarshal(data, &v); err == nil {
-			formatted, _ := json.MarshalIndent(v, "", "  ")
-			fmt.Println(string(formatted))
-		} else {
-			fmt.Print(string(data))
-		}
+	default:
+		fmt.Fprintf(os.Stderr, "unknown templates command: %s\n", args[0])
+		os.Exit(1)
+	}
+}
 
-	case "validate":
-		// Parse flags: --endpoint, --direction, --payload, --file
-		endpoint := ""
-		direction := "request"
-		var payload string
+// --- Audit commands ---
+
+func handleAudit(cfg *config, args []string) {
+	if len(args) > 0 && args[0] == "tail" {
+		auditTail(cfg, args[1:])
+		return
+	}
+	if len(args) > 0 && args[0] == "export" {
+		auditExport(cfg, args[1:])
+		return
+	}
+
+	// Check for "summary" subcommand.
+	if len(args) > 0 && args[0] == "summary" {
+		path := "/api/audit/summary"
+		params := []string{}
 		for i := 1; i < len(args); i++ {
 			switch args[i] {
-			case "--endpoint":
-				if i+1 < len(args) {
-					endpoint = args[i+1]
-					i++
-				}
-			case "--direction":
-				if i+1 < len(args) {
-					direction = args[i+1]
-					i++
-				}
-			case "--payload":
+			case "--from":
 				if i+1 < len(args) {
-					payload = args[i+1]
+					params = append(params, "from="+args[i+1])
 					i++
 				}
-			case "--file":
+			case "--to":
 				if i+1 < len(args) {
-					data, err := os.ReadFile(args[i+1])
-					if err != nil {
-						fatal(fmt.Errorf("read payload file: %w", err))
-					}
-					payload = string(data)
+					params = append(params, "to="+args[i+1])
 					i++
 				}
 			}
 		}
-		if len(args) < 2 || endpoint == "" {
-			fmt.Fprintln(os.Stderr, "usage: koor-cli contract validate <project>/<name> --endpoint \"POST /api/x\" [--direction request] --payload '{...}'")
-			os.Exit(1)
+		if len(params) > 0 {
+			path += "?" + strings.Join(params, "&")
 		}
-		project, name := parseSpecPath(args[1])
+		resp, err := doRequest(cfg, "GET", path, nil)
+		if err != nil {
+			fatal(err)
+		}
+		defer resp.Body.Close()
+		printResponse(resp)
+		return
+	}
 
-		// Build the validation request.
-		reqBody := map[string]any{
-			"endpoint":  endpoint,
-			"direction": direction,
+	// Default: query audit log.
+	path := "/api/audit"
+	params := []string{}
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--actor":
+			if i+1 < len(args) {
+				params = append(params, "actor="+args[i+1])
+				i++
+			}
+		case "--action":
+			if i+1 < len(args) {
+				params = append(params, "action="+args[i+1])
+				i++
+			}
+		case "--from":
+			if i+1 < len(args) {
+				params = append(params, "from="+args[i+1])
+				i++
+			}
+		case "--to":
+			if i+1 < len(args) {
+				params = append(params, "to="+args[i+1])
+				i++
+			}
+		case "--limit":
+			if i+1 < len(args) {
+				params = append(params, "limit="+args[i+1])
+				i++
+			}
 		}
-		if payload != "" {
-			var p map[string]any
-			if err := json.Unmarshal([]byte(payload), &p); err != nil {
-				fatal(fmt.Errorf("invalid payload JSON: %w", err))
+	}
+	if len(params) > 0 {
+		path += "?" + strings.Join(params, "&")
+	}
+	resp, err := doRequest(cfg, "GET", path, nil)
+	if err != nil {
+		fatal(err)
+	}
+	defer resp.Body.Close()
+	printResponse(resp)
+}
+
+// auditEntry mirrors an entry returned by GET /api/audit.
+type auditEntry struct {
+	ID        int64     `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	Actor     string    `json:"actor"`
+	Action    string    `json:"action"`
+	Resource  string    `json:"resource"`
+	Outcome   string    `json:"outcome"`
+}
+
+// auditTail prints the most recent audit entries, then follows new ones
+// from GET /api/audit/stream until interrupted.
+func auditTail(cfg *config, args []string) {
+	filter := url.Values{}
+	last := "10"
+	interval := 2 * time.Second
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--actor", "--action":
+			if i+1 < len(args) {
+				filter.Set(strings.TrimPrefix(args[i], "--"), args[i+1])
+				i++
+			}
+		case "--last":
+			if i+1 < len(args) {
+				last = args[i+1]
+				i++
+			}
+		case "--interval":
+			if i+1 < len(args) {
+				d, err := time.ParseDuration(args[i+1])
+				if err != nil || d <= 0 {
+					fatal(fmt.Errorf("invalid --interval %q", args[i+1]))
+				}
+				interval = d
+				i++
 			}
-			reqBody["payload"] = p
-		} else {
-			reqBody["payload"] = map[string]any{}
 		}
+	}
 
-		reqJSON, _ := json.Marshal(reqBody)
-		resp, err := doRequest(cfg, "POST", "/api/contracts/"+project+"/"+name+"/validate", strings.NewReader(string(reqJSON)))
+	fetch := func(params url.Values) []auditEntry {
+		resp, err := doRequest(cfg, "GET", "/api/audit?"+params.Encode(), nil)
 		if err != nil {
 			fatal(err)
 		}
 		defer resp.Body.Close()
-
 		data, _ := io.ReadAll(resp.Body)
 		if resp.StatusCode != 200 {
 			fmt.Print(string(data))
 			os.Exit(1)
 		}
+		var entries []auditEntry
+		if err := json.Unmarshal(data, &entries); err != nil {
+			fatal(fmt.Errorf("decode audit entries: %w", err))
+		}
+		return entries
+	}
+	show := func(e auditEntry) {
+		fmt.Printf("%s  %-20s  %-22s  %-8s  %s\n", e.Timestamp.Local().Format("15:04:05"), e.Actor, e.Action, e.Outcome, e.Resource)
+	}
 
-		// Parse and print results.
-		var result struct {
-			Valid      bool `json:"valid"`
-			Violations []struct {
-				Path    string `json:"path"`
-				Message string `json:"message"`
-			} `json:"violations"`
+	// Start from the newest entry overall so filtered-out entries are not replayed.
+	var cursor int64
+	if newest := fetch(url.Values{"limit": {"1"}}); len(newest) > 0 {
+		cursor = newest[0].ID
+	}
+	if last != "0" {
+		params := url.Values{"limit": {last}}
+		for k, v := range filter {
+			params[k] = v
 		}
-		json.Unmarshal(data, &result)
+		recent := fetch(params)
+		for i := len(recent) - 1; i >= 0; i-- {
+			show(recent[i])
+		}
+	}
 
-		if result.Valid {
-			fmt.Printf("PASS  %s %s\n", direction, endpoint)
-		} else {
-			fmt.Printf("FAIL  %s %s\n", direction, endpoint)
-			for _, v := range result.Violations {
-				fmt.Printf("  - [%s] %s\n", v.Path, v.Message)
-			}
+	// Follow the live stream, reconnecting from the last entry shown if it
+	// drops. Servers without /api/audit/stream are polled instead.
+	for {
+		params := url.Values{"after_id": {strconv.FormatInt(cursor, 10)}}
+		for k, v := range filter {
+			params[k] = v
+		}
+		resp, err := doRequest(cfg, "GET", "/api/audit/stream?"+params.Encode(), nil)
+		if err == nil && resp.StatusCode == http.StatusNotFound {
+			resp.Body.Close()
+			break
+		}
+		if err == nil && resp.StatusCode != http.StatusOK {
+			printResponse(resp)
 			os.Exit(1)
 		}
+		if err == nil {
+			lines := bufio.NewScanner(resp.Body)
+			lines.Buffer(make([]byte, 64*1024), 4<<20)
+			for lines.Scan() {
+				data, ok := strings.CutPrefix(lines.Text(), "data: ")
+				if !ok {
+					continue
+				}
+				var e auditEntry
+				if json.Unmarshal([]byte(data), &e) == nil {
+					show(e)
+					cursor = e.ID
+				}
+			}
+			resp.Body.Close()
+		}
+		time.Sleep(interval)
+	}
 
-	case "test":
-		// Parse flags: --target
-		target := ""
-		for i := 1; i < len(args); i++ {
-			if args[i] == "--target" && i+1 < len(args) {
-				target = args[i+1]
-				i++
+	for {
+		time.Sleep(interval)
+		for {
+			params := url.Values{"after_id": {strconv.FormatInt(cursor, 10)}, "limit": {"100"}}
+			for k, v := range filter {
+				params[k] = v
+			}
+			entries := fetch(params)
+			for _, e := range entries {
+				show(e)
+				cursor = e.ID
+			}
+			if len(entries) < 100 {
+				break
 			}
 		}
-		if len(args) < 2 || target == "" {
-			fmt.Fprintln(os.Stderr, "usage: koor-cli contract test <project>/<name> --target http://localhost:8080")
-			os.Exit(1)
+	}
+}
+
+// auditExport streams GET /api/audit/export to stdout or a file.
+func auditExport(cfg *config, args []string) {
+	params := url.Values{}
+	output := ""
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--format", "--actor", "--action", "--from", "--to":
+			if i+1 < len(args) {
+				params.Set(strings.TrimPrefix(args[i], "--"), args[i+1])
+				i++
+			}
+		case "--output":
+			if i+1 < len(args) {
+				output = args[i+1]
+				i++
+			}
 		}
-		project, name := parseSpecPath(args[1])
+	}
 
-		// First, fetch the contract to get the list of endpoints.
-		resp, err := doRequest(cfg, "GET", "/api/specs/"+project+"/"+name, nil)
+	resp, err := doRequest(cfg, "GET", "/api/audit/export?"+params.Encode(), nil)
+	if err != nil {
+		fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		printResponse(resp)
+		os.Exit(1)
+	}
+
+	var out io.Writer = os.Stdout
+	if output != "" {
+		f, err := os.Create(output)
 		if err != nil {
-			fatal(err)
+			fatal(fmt.Errorf("create %s: %w", output, err))
 		}
-		contractData, _ := io.ReadAll(resp.Body)
-		resp.Body.Close()
-		if resp.StatusCode != 200 {
-			fmt.Print(string(contractData))
-			os.Exit(1)
+		defer f.Close()
+		out = f
+	}
+	if _, err := io.Copy(out, resp.Body); err != nil {
+		fatal(fmt.Errorf("audit export: %w", err))
+	}
+}
+
+// --- Agent metrics commands ---
+
+func handleMetricsCLI(cfg *config, args []string) {
+	if len(args) < 1 || args[0] != "agents" {
+		fmt.Fprintln(os.Stderr, "usage: koor-cli metrics agents [--instance_id <id>] [--period <p>] [aggregation flags]")
+		fmt.Fprintln(os.Stderr, "       koor-cli metrics agents <id> [--period <p>] [aggregation flags]")
+		fmt.Fprintln(os.Stderr, "aggregation flags: [--agg p50,p95,max] [--group-by hour|day|instance] [--metric <name>] [--since 24h] [--csv]")
+		os.Exit(1)
+	}
+
+	// metrics agents <id> ... or metrics agents [--instance_id <id>] ...
+	path := "/api/metrics/agents"
+	rest := args[1:]
+	if len(rest) > 0 && !strings.HasPrefix(rest[0], "--") {
+		path += "/" + rest[0]
+		rest = rest[1:]
+	}
+	params := []string{}
+	for i := 0; i < len(rest); i++ {
+		switch rest[i] {
+		case "--instance_id", "--period", "--agg", "--metric", "--since":
+			if i+1 < len(rest) {
+				params = append(params, strings.TrimPrefix(rest[i], "--")+"="+url.QueryEscape(rest[i+1]))
+				i++
+			}
+		case "--group-by":
+			if i+1 < len(rest) {
+				params = append(params, "group_by="+url.QueryEscape(rest[i+1]))
+				i++
+			}
+		case "--csv":
+			params = append(params, "format=csv")
 		}
+	}
+	if len(params) > 0 {
+		path += "?" + strings.Join(params, "&")
+	}
+	resp, err := doRequest(cfg, "GET", path, nil)
+	if err != nil {
+		fatal(err)
+	}
+	defer resp.Body.Close()
+	printResponse(resp)
+}
 
-		var contract struct {
-			Endpoints map[string]json.RawMessage `json:"endpoints"`
+// --- Rules commands ---
+
+func handleRules(cfg *config, args []string) {
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, "usage: koor-cli rules <list|import|export|lint|accept|auto-accept> [args]")
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "list":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "usage: koor-cli rules list <project>")
+			os.Exit(1)
 		}
-		if err := json.Unmarshal(contractData, &contract); err != nil {
-			fatal(fmt.Errorf("parse contract: %w", err))
+		resp, err := doRequest(cfg, "GET", "/api/validate/"+url.PathEscape(args[1])+"/rules", nil)
+		if err != nil {
+			fatal(err)
 		}
+		defer resp.Body.Close()
+		printResponse(resp)
 
-		pass := 0
-		fail := 0
+	case "lint":
+		filePath := ""
+		for i := 1; i < len(args); i++ {
+			if args[i] == "--file" && i+1 < len(args) {
+				filePath = args[i+1]
+				i++
+			}
+		}
+		if filePath == "" {
+			fmt.Fprintln(os.Stderr, "usage: koor-cli rules lint --file <path>")
+			os.Exit(1)
+		}
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			fatal(fmt.Errorf("read file %s: %w", filePath, err))
+		}
+		var rules []lintRule
+		if err := json.Unmarshal(data, &rules); err != nil {
+			fatal(fmt.Errorf("invalid JSON in %s: %w", filePath, err))
+		}
+		problems := lintRules(rules)
+		errCount := 0
+		for _, p := range problems {
+			if p.Level == "error" {
+				errCount++
+			}
+			fmt.Printf("%s[%d] %s: %s: %s\n", filePath, p.Index, p.RuleID, p.Level, p.Message)
+		}
+		fmt.Printf("%d rules, %d errors, %d warnings\n", len(rules), errCount, len(problems)-errCount)
+		if errCount > 0 {
+			os.Exit(1)
+		}
+
+	case "import":
+		filePath := ""
+		path := "/api/rules/import"
+		for i := 1; i < len(args); i++ {
+			if args[i] == "--file" && i+1 < len(args) {
+				filePath = args[i+1]
+				i++
+			} else if args[i] == "--dry-run" {
+				path += "?dry_run=1"
+			}
+		}
+		if filePath == "" {
+			fmt.Fprintln(os.Stderr, "usage: koor-cli rules import --file <path> [--dry-run]")
+			os.Exit(1)
+		}
+
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			fatal(fmt.Errorf("read file %s: %w", filePath, err))
+		}
+
+		// Validate it's a JSON array.
+		var rules []json.RawMessage
+		if err := json.Unmarshal(data, &rules); err != nil {
+			fatal(fmt.Errorf("invalid JSON in %s: %w", filePath, err))
+		}
+
+		resp, err := doRequest(cfg, "POST", path, strings.NewReader(string(data)))
+		if err != nil {
+			fatal(err)
+		}
+		defer resp.Body.Close()
+		printResponse(resp)
+
+	case "export":
+		source := ""
+		output := ""
+		for i := 1; i < len(args); i++ {
+			switch args[i] {
+			case "--source":
+				if i+1 < len(args) {
+					source = args[i+1]
+					i++
+				}
+			case "--output":
+				if i+1 < len(args) {
+					output = args[i+1]
+					i++
+				}
+			}
+		}
+
+		path := "/api/rules/export"
+		if source != "" {
+			path += "?source=" + source
+		}
+
+		resp, err := doRequest(cfg, "GET", path, nil)
+		if err != nil {
+			fatal(err)
+		}
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			fatal(fmt.Errorf("read response: %w", err))
+		}
+
+		// Pretty-print the JSON.
+		var v any
+		if err := json.Unmarshal(body, &v); err == nil {
+			body, _ = json.MarshalIndent(v, "", "  ")
+		}
+
+		if output != "" {
+			if err := os.WriteFile(output, append(body, '\n'), 0o644); err != nil {
+				fatal(fmt.Errorf("write file %s: %w", output, err))
+			}
+			fmt.Fprintf(os.Stderr, "exported to %s\n", output)
+		} else {
+			fmt.Println(string(body))
+		}
+
+	case "accept":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "usage: koor-cli rules accept <project> <rule-id>... | --all")
+			os.Exit(1)
+		}
+		req := map[string]any{}
+		ids := []string{}
+		for _, a := range args[2:] {
+			if a == "--all" {
+				req["all"] = true
+			} else {
+				ids = append(ids, a)
+			}
+		}
+		if len(ids) > 0 {
+			req["rule_ids"] = ids
+		}
+		body, _ := json.Marshal(req)
+		resp, err := doRequest(cfg, "POST", "/api/rules/"+args[1]+"/accept", strings.NewReader(string(body)))
+		if err != nil {
+			fatal(err)
+		}
+		defer resp.Body.Close()
+		printResponse(resp)
+
+	case "auto-accept":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "usage: koor-cli rules auto-accept <project> [--severities <s,...> --min-accepted N | --delete]")
+			os.Exit(1)
+		}
+		path := "/api/rules/" + args[1] + "/auto-accept"
+		method := "GET"
+		policy := map[string]any{}
+		for i := 2; i < len(args); i++ {
+			switch args[i] {
+			case "--severities":
+				if i+1 < len(args) {
+					policy["severities"] = strings.Split(args[i+1], ",")
+					method = "PUT"
+					i++
+				}
+			case "--min-accepted":
+				if i+1 < len(args) {
+					n, err := strconv.Atoi(args[i+1])
+					if err != nil {
+						fatal(fmt.Errorf("invalid --min-accepted %q", args[i+1]))
+					}
+					policy["min_accepted"] = n
+					method = "PUT"
+					i++
+				}
+			case "--delete":
+				method = "DELETE"
+			}
+		}
+		var body io.Reader
+		if method == "PUT" {
+			data, _ := json.Marshal(policy)
+			body = strings.NewReader(string(data))
+		}
+		resp, err := doRequest(cfg, method, path, body)
+		if err != nil {
+			fatal(err)
+		}
+		defer resp.Body.Close()
+		printResponse(resp)
+
+	default:
+		fmt.Fprintf(os.Stderr, "unknown rules command: %s\n", args[0])
+		os.Exit(1)
+	}
+}
+
+// lintRule is the subset of a rule file entry that rules lint checks.
+type lintRule struct {
+	Project   string `json:"project"`
+	RuleID    string `json:"rule_id"`
+	Severity  string `json:"severity"`
+	MatchType string `json:"match_type"`
+	Pattern   string `json:"pattern"`
+}
+
+// lintProblem is a single finding from rules lint.
+type lintProblem struct {
+	Index   int
+	RuleID  string
+	Level   string // "error" or "warning"
+	Message string
+}
+
+// lintRules checks rules the way the server will use them: required fields,
+// known match types and severities, unique project/rule_id pairs, and
+// patterns that compile (or parse, for go-ast rules). Nested unbounded
+// quantifiers such as (a+)+ are flagged as warnings: Go's engine runs them
+// in linear time, but the same pattern backtracks catastrophically in most
+// other regex engines.
+func lintRules(rules []lintRule) []lintProblem {
+	var problems []lintProblem
+	seen := map[string]int{}
+	for i, rule := range rules {
+		add := func(level, format string, a ...any) {
+			problems = append(problems, lintProblem{Index: i, RuleID: rule.RuleID, Level: level, Message: fmt.Sprintf(format, a...)})
+		}
+		if rule.Project == "" {
+			add("error", "missing project")
+		}
+		if rule.RuleID == "" {
+			add("error", "missing rule_id")
+		} else if first, ok := seen[rule.Project+"/"+rule.RuleID]; ok {
+			add("error", "duplicate rule_id (first defined at index %d)", first)
+		} else {
+			seen[rule.Project+"/"+rule.RuleID] = i
+		}
+		switch rule.Severity {
+		case "", "error", "warning", "info":
+		default:
+			add("warning", "unknown severity %q", rule.Severity)
+		}
+		switch rule.MatchType {
+		case "", "regex", "missing", "custom", "go-ast":
+		default:
+			add("error", "unknown match_type %q (expected regex, missing, custom or go-ast)", rule.MatchType)
+			continue
+		}
+		if rule.Pattern == "" {
+			add("error", "missing pattern")
+			continue
+		}
+		if rule.MatchType == "go-ast" {
+			if err := specs.CheckGoASTPattern(rule.Pattern); err != nil {
+				add("error", "%v", err)
+			}
+			continue
+		}
+		if rule.MatchType == "custom" && rule.Pattern == "no-console-log" {
+			continue
+		}
+		re, err := syntax.Parse(rule.Pattern, syntax.Perl)
+		if err != nil {
+			add("error", "pattern does not compile: %v", err)
+			continue
+		}
+		if nestedQuantifier(re, false) {
+			add("warning", "pattern nests unbounded quantifiers and may backtrack catastrophically outside Go")
+		}
+	}
+	return problems
+}
+
+// nestedQuantifier reports whether re contains an unbounded repetition
+// inside another one.
+func nestedQuantifier(re *syntax.Regexp, inside bool) bool {
+	unbounded := re.Op == syntax.OpStar || re.Op == syntax.OpPlus || (re.Op == syntax.OpRepeat && re.Max == -1)
+	if unbounded && inside {
+		return true
+	}
+	for _, sub := range re.Sub {
+		if nestedQuantifier(sub, inside || unbounded) {
+			return true
+		}
+	}
+	return false
+}
+
+// --- Rule pack commands ---
+
+func handleRulePacks(cfg *config, args []string) {
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, "usage: koor-cli rulepacks <install|list|sign> [args]")
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "install":
+		source, project, allowDowngrade := "", "", false
+		for i := 1; i < len(args); i++ {
+			switch args[i] {
+			case "--project":
+				if i+1 < len(args) {
+					project = args[i+1]
+					i++
+				}
+			case "--allow-downgrade":
+				allowDowngrade = true
+			default:
+				source = args[i]
+			}
+		}
+		if source == "" || project == "" {
+			fmt.Fprintln(os.Stderr, "usage: koor-cli rulepacks install <file|url> --project <p> [--allow-downgrade]")
+			os.Exit(1)
+		}
+		data, err := readRulePack(source)
+		if err != nil {
+			fatal(err)
+		}
+		path := "/api/rulepacks/install?project=" + url.QueryEscape(project)
+		if allowDowngrade {
+			path += "&allow_downgrade=true"
+		}
+		resp, err := doRequest(cfg, "POST", path, bytes.NewReader(data))
+		if err != nil {
+			fatal(err)
+		}
+		defer resp.Body.Close()
+		printResponse(resp)
+
+	case "list":
+		path := "/api/rulepacks"
+		for i := 1; i < len(args); i++ {
+			if args[i] == "--project" && i+1 < len(args) {
+				path += "?project=" + url.QueryEscape(args[i+1])
+				i++
+			}
+		}
+		resp, err := doRequest(cfg, "GET", path, nil)
+		if err != nil {
+			fatal(err)
+		}
+		defer resp.Body.Close()
+		printResponse(resp)
+
+	case "sign":
+		file, keyFile, output := "", "", ""
+		for i := 1; i < len(args); i++ {
+			switch args[i] {
+			case "--key-file":
+				if i+1 < len(args) {
+					keyFile = args[i+1]
+					i++
+				}
+			case "--output":
+				if i+1 < len(args) {
+					output = args[i+1]
+					i++
+				}
+			default:
+				file = args[i]
+			}
+		}
+		if file == "" || keyFile == "" {
+			fmt.Fprintln(os.Stderr, "usage: koor-cli rulepacks sign <file> --key-file <path> [--output <path>]")
+			os.Exit(1)
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			fatal(fmt.Errorf("read file %s: %w", file, err))
+		}
+		signed, err := signRulePack(data, keyFile)
+		if err != nil {
+			fatal(err)
+		}
+		if output == "" {
+			output = file
+		}
+		if err := os.WriteFile(output, append(signed, '\n'), 0o644); err != nil {
+			fatal(fmt.Errorf("write file %s: %w", output, err))
+		}
+		fmt.Printf("Signed %s\n", output)
+
+	default:
+		fmt.Fprintf(os.Stderr, "unknown rulepacks command: %s\n", args[0])
+		os.Exit(1)
+	}
+}
+
+// readRulePack reads a pack from a local file or an http(s) URL.
+func readRulePack(source string) ([]byte, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		data, err := os.ReadFile(source)
+		if err != nil {
+			return nil, fmt.Errorf("read file %s: %w", source, err)
+		}
+		return data, nil
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(source)
+	if err != nil {
+		return nil, fmt.Errorf("fetch %s: %w", source, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch %s: status %d", source, resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 10<<20))
+}
+
+// signRulePack adds a signature to a pack. The signature covers the pack
+// without its "signature" field, encoded with sorted keys and no
+// whitespace, which is what koor-server verifies.
+func signRulePack(data []byte, keyFile string) ([]byte, error) {
+	key, err := readSigningKey(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	var pack map[string]any
+	if err := json.Unmarshal(data, &pack); err != nil {
+		return nil, fmt.Errorf("invalid pack JSON: %w", err)
+	}
+	delete(pack, "signature")
+	msg, err := json.Marshal(pack)
+	if err != nil {
+		return nil, err
+	}
+	pack["signature"] = map[string]string{
+		"public_key": base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey)),
+		"value":      base64.StdEncoding.EncodeToString(ed25519.Sign(key, msg)),
+	}
+	return json.MarshalIndent(pack, "", "  ")
+}
+
+// --- Contract commands ---
+
+func handleContract(cfg *config, args []string) {
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, "usage: koor-cli contract <init|import|set|get|diff|validate|test|test-suite|drift|mock|record> [args]")
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "init":
+		contractInit(args[1:])
+
+	case "import":
+		specPath, filePath := "", ""
+		query := "?format=openapi"
+		for i := 1; i < len(args); i++ {
+			if args[i] == "--openapi" && i+1 < len(args) {
+				filePath = args[i+1]
+				i++
+			} else if args[i] == "--dry-run" {
+				query += "&dry_run=1"
+			} else if specPath == "" && !strings.HasPrefix(args[i], "--") {
+				specPath = args[i]
+			}
+		}
+		if specPath == "" || filePath == "" {
+			fmt.Fprintln(os.Stderr, "usage: koor-cli contract import <project>/<name> --openapi <spec.yaml|spec.json> [--dry-run]")
+			os.Exit(1)
+		}
+		project, name := parseSpecPath(specPath)
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			fatal(fmt.Errorf("read file %s: %w", filePath, err))
+		}
+		resp, err := doRequest(cfg, "POST", "/api/contracts/"+project+"/"+name+"/import"+query, bytes.NewReader(data))
+		if err != nil {
+			fatal(err)
+		}
+		defer resp.Body.Close()
+		printResponse(resp)
+
+	case "set":
+		if len(args) < 4 {
+			fmt.Fprintln(os.Stderr, "usage: koor-cli contract set <project>/<name> --file <path> [--dry-run]")
+			os.Exit(1)
+		}
+		project, name := parseSpecPath(args[1])
+		body, err := readBodyArg(args[2:])
+		if err != nil {
+			fatal(err)
+		}
+
+		// Validate it's a valid contract before storing.
+		var contract map[string]any
+		if err := json.Unmarshal(body, &contract); err != nil {
+			fatal(fmt.Errorf("invalid JSON: %w", err))
+		}
+		if contract["kind"] != "contract" {
+			fatal(fmt.Errorf("JSON must have \"kind\": \"contract\""))
+		}
+
+		// Report what the change means for consumers before overwriting.
+		resp, err := doRequest(cfg, "POST", "/api/contracts/"+project+"/"+name+"/diff", bytes.NewReader(body))
+		if err != nil {
+			fatal(err)
+		}
+		report, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		switch resp.StatusCode {
+		case http.StatusOK:
+			printCompatibility(report)
+		case http.StatusNotFound:
+			fmt.Fprintln(os.Stderr, "new contract: no earlier version to compare with")
+		default:
+			fmt.Fprintf(os.Stderr, "compatibility check failed: %s\n", strings.TrimSpace(string(report)))
+		}
+		if slices.Contains(args, "--dry-run") {
+			return
+		}
+
+		resp, err = doRequest(cfg, "PUT", "/api/specs/"+project+"/"+name, strings.NewReader(string(body)))
+		if err != nil {
+			fatal(err)
+		}
+		defer resp.Body.Close()
+		printResponse(resp)
+
+	case "get":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "usage: koor-cli contract get <project>/<name>")
+			os.Exit(1)
+		}
+		project, name := parseSpecPath(args[1])
+		resp, err := doRequest(cfg, "GET", "/api/specs/"+project+"/"+name, nil)
+		if err != nil {
+			fatal(err)
+		}
+		defer resp.Body.Close()
+
+		data, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != 200 {
+			fmt.Print(string(data))
+			os.Exit(1)
+		}
+
+		// Always pretty-print contracts for readability.
+		var v any
+		if err := json.Unmarshal(data, &v); err == nil {
+			formatted, _ := json.MarshalIndent(v, "", "  ")
+			fmt.Println(string(formatted))
+		} else {
+			fmt.Print(string(data))
+		}
+
+	case "validate":
+		// Parse flags: --endpoint, --direction, --payload, --file
+		endpoint := ""
+		direction := "request"
+		var payload string
+		for i := 1; i < len(args); i++ {
+			switch args[i] {
+			case "--endpoint":
+				if i+1 < len(args) {
+					endpoint = args[i+1]
+					i++
+				}
+			case "--direction":
+				if i+1 < len(args) {
+					direction = args[i+1]
+					i++
+				}
+			case "--payload":
+				if i+1 < len(args) {
+					payload = args[i+1]
+					i++
+				}
+			case "--file":
+				if i+1 < len(args) {
+					data, err := os.ReadFile(args[i+1])
+					if err != nil {
+						fatal(fmt.Errorf("read payload file: %w", err))
+					}
+					payload = string(data)
+					i++
+				}
+			}
+		}
+		if len(args) < 2 || endpoint == "" {
+			fmt.Fprintln(os.Stderr, "usage: koor-cli contract validate <project>/<name> --endpoint \"POST /api/x\" [--direction request] --payload '{...}'")
+			os.Exit(1)
+		}
+		project, name := parseSpecPath(args[1])
+
+		// Build the validation request.
+		reqBody := map[string]any{
+			"endpoint":  endpoint,
+			"direction": direction,
+		}
+		if payload != "" {
+			var p map[string]any
+			if err := json.Unmarshal([]byte(payload), &p); err != nil {
+				fatal(fmt.Errorf("invalid payload JSON: %w", err))
+			}
+			reqBody["payload"] = p
+		} else {
+			reqBody["payload"] = map[string]any{}
+		}
+
+		reqJSON, _ := json.Marshal(reqBody)
+		resp, err := doRequest(cfg, "POST", "/api/contracts/"+project+"/"+name+"/validate", strings.NewReader(string(reqJSON)))
+		if err != nil {
+			fatal(err)
+		}
+		defer resp.Body.Close()
+
+		data, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != 200 {
+			fmt.Print(string(data))
+			os.Exit(1)
+		}
+
+		// Parse and print results.
+		var result struct {
+			Valid      bool `json:"valid"`
+			Violations []struct {
+				Path    string `json:"path"`
+				Message string `json:"message"`
+			} `json:"violations"`
+		}
+		json.Unmarshal(data, &result)
+
+		if result.Valid {
+			fmt.Printf("PASS  %s %s\n", direction, endpoint)
+		} else {
+			fmt.Printf("FAIL  %s %s\n", direction, endpoint)
+			for _, v := range result.Violations {
+				fmt.Printf("  - [%s] %s\n", v.Path, v.Message)
+			}
+			os.Exit(1)
+		}
+
+	case "test":
+		// Parse flags: --target, --env, --parallel
+		target := ""
+		envList := ""
+		parallel := 1
+		for i := 1; i < len(args); i++ {
+			switch args[i] {
+			case "--target":
+				if i+1 < len(args) {
+					target = args[i+1]
+					i++
+				}
+			case "--env":
+				if i+1 < len(args) {
+					envList = args[i+1]
+					i++
+				}
+			case "--parallel":
+				if i+1 < len(args) {
+					n, err := strconv.Atoi(args[i+1])
+					if err != nil || n < 1 {
+						fatal(fmt.Errorf("--parallel must be a positive integer"))
+					}
+					parallel = n
+					i++
+				}
+			}
+		}
+		if len(args) < 2 || (target == "" && envList == "") {
+			fmt.Fprintln(os.Stderr, "usage: koor-cli contract test <project>/<name> --target http://localhost:8080 [--parallel N]")
+			fmt.Fprintln(os.Stderr, "       koor-cli contract test <project>/<name> --env staging=https://...,local=http://... [--parallel N]")
+			os.Exit(1)
+		}
+		project, name := parseSpecPath(args[1])
+
+		var targets []contractTarget
+		if envList != "" {
+			for _, pair := range strings.Split(envList, ",") {
+				envName, url, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if !ok || envName == "" || url == "" {
+					fatal(fmt.Errorf("invalid --env entry %q (expected name=url)", pair))
+				}
+				targets = append(targets, contractTarget{Name: envName, URL: url})
+			}
+		} else {
+			targets = []contractTarget{{Name: target, URL: target}}
+		}
+
+		// First, fetch the contract to get the list of endpoints.
+		resp, err := doRequest(cfg, "GET", "/api/specs/"+project+"/"+name, nil)
+		if err != nil {
+			fatal(err)
+		}
+		contractData, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != 200 {
+			fmt.Print(string(contractData))
+			os.Exit(1)
+		}
+
+		var contract struct {
+			Endpoints map[string]json.RawMessage `json:"endpoints"`
+		}
+		if err := json.Unmarshal(contractData, &contract); err != nil {
+			fatal(fmt.Errorf("parse contract: %w", err))
+		}
+		endpoints := make([]string, 0, len(contract.Endpoints))
 		for ep := range contract.Endpoints {
-			reqBody, _ := json.Marshal(map[string]any{
-				"endpoint": ep,
-				"base_url": target,
+			endpoints = append(endpoints, ep)
+		}
+		sort.Strings(endpoints)
+
+		results := runContractTests(cfg, project, name, endpoints, targets, parallel)
+
+		fail := 0
+		for _, t := range targets {
+			if len(targets) > 1 {
+				fmt.Printf("== %s (%s)\n", t.Name, t.URL)
+			}
+			pass := 0
+			for _, ep := range endpoints {
+				result := results[t.Name][ep]
+				if result.Valid {
+					fmt.Printf("PASS  %s (status: %d)\n", ep, result.StatusCode)
+					pass++
+					continue
+				}
+				fmt.Printf("FAIL  %s (status: %d)\n", ep, result.StatusCode)
+				if result.Error != "" {
+					fmt.Printf("  - error: %s\n", result.Error)
+				}
+				for _, v := range result.RequestViolations {
+					fmt.Printf("  - [req] [%s] %s\n", v.Path, v.Message)
+				}
+				for _, v := range result.ResponseViolations {
+					fmt.Printf("  - [resp] [%s] %s\n", v.Path, v.Message)
+				}
+				fail++
+			}
+			fmt.Printf("\n%d/%d endpoints PASS", pass, len(endpoints))
+			if pass < len(endpoints) {
+				fmt.Printf(", %d FAIL", len(endpoints)-pass)
+			}
+			fmt.Println()
+			if len(targets) > 1 {
+				fmt.Println()
+			}
+		}
+
+		if len(targets) > 1 {
+			printContractMatrix(endpoints, targets, results)
+		}
+		if fail > 0 {
+			os.Exit(1)
+		}
+
+	case "diff":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "usage: koor-cli contract diff <project>/<name> [--v1 N] [--v2 N]")
+			os.Exit(1)
+		}
+		project, name := parseSpecPath(args[1])
+		q := url.Values{}
+		for i := 2; i+1 < len(args); i++ {
+			if args[i] == "--v1" || args[i] == "--v2" {
+				q.Set(args[i][2:], args[i+1])
+				i++
+			}
+		}
+		path := "/api/contracts/" + project + "/" + name + "/diff"
+		if len(q) > 0 {
+			path += "?" + q.Encode()
+		}
+		resp, err := doRequest(cfg, "GET", path, nil)
+		if err != nil {
+			fatal(err)
+		}
+		defer resp.Body.Close()
+		printResponse(resp)
+
+	case "test-suite":
+		target, endpoint, caseName := "", "", ""
+		for i := 2; i+1 < len(args); i++ {
+			switch args[i] {
+			case "--target":
+				target = args[i+1]
+				i++
+			case "--endpoint":
+				endpoint = args[i+1]
+				i++
+			case "--case":
+				caseName = args[i+1]
+				i++
+			}
+		}
+		if len(args) < 2 || target == "" {
+			fmt.Fprintln(os.Stderr, "usage: koor-cli contract test-suite <project>/<name> --target http://localhost:8080 [--endpoint \"GET /api/x\"] [--case <name>]")
+			os.Exit(1)
+		}
+		project, name := parseSpecPath(args[1])
+		reqJSON, _ := json.Marshal(map[string]string{"base_url": target, "endpoint": endpoint, "case": caseName})
+		resp, err := doRequest(cfg, "POST", "/api/contracts/"+project+"/"+name+"/test-suite", bytes.NewReader(reqJSON))
+		if err != nil {
+			fatal(err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != 200 {
+			fmt.Print(string(data))
+			os.Exit(1)
+		}
+
+		var result struct {
+			Pass  int `json:"pass"`
+			Fail  int `json:"fail"`
+			Cases []struct {
+				Endpoint           string   `json:"endpoint"`
+				Case               string   `json:"case"`
+				Pass               bool     `json:"pass"`
+				StatusCode         int      `json:"status_code"`
+				Failures           []string `json:"failures"`
+				ResponseViolations []struct {
+					Path    string `json:"path"`
+					Message string `json:"message"`
+				} `json:"response_violations"`
+				Error string `json:"error"`
+			} `json:"cases"`
+		}
+		if err := json.Unmarshal(data, &result); err != nil {
+			fatal(fmt.Errorf("parse test-suite result: %w", err))
+		}
+		if len(result.Cases) == 0 {
+			fmt.Println("no test cases: add \"cases\" to the contract's endpoints")
+			return
+		}
+		for _, c := range result.Cases {
+			verdict := "PASS"
+			if !c.Pass {
+				verdict = "FAIL"
+			}
+			fmt.Printf("%s  %s  %s (status: %d)\n", verdict, c.Endpoint, c.Case, c.StatusCode)
+			if c.Error != "" {
+				fmt.Printf("  - error: %s\n", c.Error)
+			}
+			for _, f := range c.Failures {
+				fmt.Printf("  - %s\n", f)
+			}
+			for _, v := range c.ResponseViolations {
+				fmt.Printf("  - [resp] [%s] %s\n", v.Path, v.Message)
+			}
+		}
+		fmt.Printf("\n%d/%d cases PASS", result.Pass, len(result.Cases))
+		if result.Fail > 0 {
+			fmt.Printf(", %d FAIL\n", result.Fail)
+			os.Exit(1)
+		}
+		fmt.Println()
+
+	case "drift":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "usage: koor-cli contract drift <project>/<name>")
+			os.Exit(1)
+		}
+		project, name := parseSpecPath(args[1])
+		resp, err := doRequest(cfg, "GET", "/api/contracts/"+project+"/"+name+"/drift", nil)
+		if err != nil {
+			fatal(err)
+		}
+		defer resp.Body.Close()
+		printResponse(resp)
+
+	case "mock":
+		contractMock(cfg, args[1:])
+
+	case "record":
+		contractRecord(cfg, args[1:])
+
+	default:
+		fmt.Fprintf(os.Stderr, "unknown contract command: %s\n", args[0])
+		os.Exit(1)
+	}
+}
+
+// contractMock starts a server-side mock of a contract and serves it on a
+// local port, so a client can be pointed at http://localhost:<port> as if
+// the real service were running. The mock is stopped on interrupt.
+func contractMock(cfg *config, args []string) {
+	specPath, port, version := "", "8081", ""
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--port" && i+1 < len(args):
+			port = args[i+1]
+			i++
+		case args[i] == "--version" && i+1 < len(args):
+			version = args[i+1]
+			i++
+		case specPath == "" && !strings.HasPrefix(args[i], "--"):
+			specPath = args[i]
+		}
+	}
+	project, name := parseSpecPath(specPath)
+	if project == "" || name == "" {
+		fmt.Fprintln(os.Stderr, "usage: koor-cli contract mock <project>/<name> [--port 8081] [--version N]")
+		os.Exit(1)
+	}
+	var body io.Reader
+	if version != "" {
+		n, err := strconv.Atoi(version)
+		if err != nil || n < 1 {
+			fatal(fmt.Errorf("--version must be a positive integer"))
+		}
+		body = strings.NewReader(fmt.Sprintf(`{"version":%d}`, n))
+	}
+	resp, err := doRequest(cfg, "POST", "/api/contracts/"+project+"/"+name+"/mock/start", body)
+	if err != nil {
+		fatal(err)
+	}
+	data, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		printData(data, false)
+		os.Exit(1)
+	}
+	var mock struct {
+		Version   int64    `json:"version"`
+		URL       string   `json:"url"`
+		Endpoints []string `json:"endpoints"`
+	}
+	if err := json.Unmarshal(data, &mock); err != nil {
+		fatal(fmt.Errorf("parse mock: %w", err))
+	}
+
+	// Forward every local request to the mock on the server.
+	local := &http.Server{Addr: "localhost:" + port, Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers := map[string]string{}
+		for _, h := range []string{"Accept", "Content-Type", "X-Koor-Mock-Status"} {
+			if v := r.Header.Get(h); v != "" {
+				headers[h] = v
+			}
+		}
+		path := mock.URL + r.URL.Path
+		if r.URL.RawQuery != "" {
+			path += "?" + r.URL.RawQuery
+		}
+		var reqBody io.Reader
+		if r.ContentLength != 0 {
+			reqBody = r.Body
+		}
+		resp, err := doRequestWithHeaders(cfg, r.Method, path, reqBody, headers)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+		for k, v := range resp.Header {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+	})}
+	errc := make(chan error, 1)
+	go func() { errc <- local.ListenAndServe() }()
+
+	fmt.Fprintf(os.Stderr, "Mocking %s/%s v%d at http://localhost:%s (Ctrl-C to stop)\n", project, name, mock.Version, port)
+	for _, ep := range mock.Endpoints {
+		fmt.Fprintf(os.Stderr, "  %s\n", ep)
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	select {
+	case err = <-errc:
+	case <-stop:
+		local.Close()
+	}
+	if resp, err := doRequest(cfg, "POST", "/api/contracts/"+project+"/"+name+"/mock/stop", nil); err == nil {
+		resp.Body.Close()
+	}
+	if err != nil && err != http.ErrServerClosed {
+		fatal(err)
+	}
+}
+
+// recordedBodyLimit caps how much of each body contractRecord keeps.
+const recordedBodyLimit = 1 << 20
+
+type recordKey struct{}
+
+// recordedRequest is what contractRecord keeps of a request until its
+// response arrives.
+type recordedRequest struct {
+	method, path string
+	query        url.Values
+	body         []byte
+}
+
+// contractRecord runs a reverse proxy in front of a service, infers the
+// shapes of the JSON it sees go by, and on interrupt stores them as a
+// draft contract for review. It refuses to overwrite an existing spec.
+func contractRecord(cfg *config, args []string) {
+	specPath, target, listen, output := "", "", ":8089", ""
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--target" && i+1 < len(args):
+			target = args[i+1]
+			i++
+		case args[i] == "--listen" && i+1 < len(args):
+			listen = args[i+1]
+			i++
+		case args[i] == "--output" && i+1 < len(args):
+			output = args[i+1]
+			i++
+		case specPath == "" && !strings.HasPrefix(args[i], "--"):
+			specPath = args[i]
+		}
+	}
+	project, name := parseSpecPath(specPath)
+	if target == "" || output == "" && (project == "" || name == "") {
+		fmt.Fprintln(os.Stderr, "usage: koor-cli contract record <project>/<name> --target http://localhost:8080 [--listen :8089] [--output <path>]")
+		os.Exit(1)
+	}
+	targetURL, err := url.Parse(target)
+	if err != nil || targetURL.Scheme == "" || targetURL.Host == "" {
+		fatal(fmt.Errorf("--target must be a URL like http://localhost:8080"))
+	}
+	if output == "" {
+		resp, err := doRequest(cfg, "GET", "/api/specs/"+project+"/"+name, nil)
+		if err != nil {
+			fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			fatal(fmt.Errorf("%s/%s already exists; record under a new name or use --output, then review and `contract set` it", project, name))
+		}
+	}
+
+	rec := contracts.NewRecorder()
+	proxy := httputil.NewSingleHostReverseProxy(targetURL)
+	director := proxy.Director
+	proxy.Director = func(r *http.Request) {
+		director(r)
+		// Let the transport negotiate compression, so bodies arrive decoded.
+		r.Header.Del("Accept-Encoding")
+	}
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		req, _ := resp.Request.Context().Value(recordKey{}).(*recordedRequest)
+		if req == nil {
+			return nil
+		}
+		body, err := io.ReadAll(io.LimitReader(resp.Body, recordedBodyLimit+1))
+		if err != nil {
+			return err
+		}
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+		if len(body) > recordedBodyLimit {
+			body = nil
+		}
+		endpoint := rec.Observe(contracts.Exchange{Method: req.method, Path: req.path, Query: req.query,
+			Request: req.body, Status: resp.StatusCode, Response: body})
+		fmt.Fprintf(os.Stderr, "  %s %s -> %d  (%s)\n", req.method, req.path, resp.StatusCode, endpoint)
+		return nil
+	}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := &recordedRequest{method: r.Method, path: r.URL.Path, query: r.URL.Query()}
+		if r.Body != nil {
+			body, err := io.ReadAll(io.LimitReader(r.Body, recordedBodyLimit+1))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+			if len(body) <= recordedBodyLimit {
+				req.body = body
+			}
+		}
+		proxy.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), recordKey{}, req)))
+	})
+
+	local := &http.Server{Addr: listen, Handler: handler}
+	errc := make(chan error, 1)
+	go func() { errc <- local.ListenAndServe() }()
+	fmt.Fprintf(os.Stderr, "Recording traffic to %s at %s (Ctrl-C to stop and write the draft contract)\n", target, listen)
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	select {
+	case err := <-errc:
+		fatal(err)
+	case <-stop:
+		local.Close()
+	}
+	if rec.Len() == 0 {
+		fatal(fmt.Errorf("no requests recorded; nothing to write"))
+	}
+
+	data, _ := json.MarshalIndent(rec.Contract(), "", "  ")
+	data = append(data, '\n')
+	if output != "" {
+		if err := os.WriteFile(output, data, 0o644); err != nil {
+			fatal(err)
+		}
+		fmt.Printf("Wrote draft contract with %d endpoint(s) to %s\n", rec.Len(), output)
+		return
+	}
+	resp, err := doRequest(cfg, "PUT", "/api/specs/"+project+"/"+name, bytes.NewReader(data))
+	if err != nil {
+		fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		fmt.Fprintf(os.Stderr, "Stored draft contract %s/%s with %d endpoint(s); review it with `koor-cli contract get %s/%s`\n",
+			project, name, rec.Len(), project, name)
+	}
+	printResponse(resp)
+}
+
+// printCompatibility prints a contract diff report to stderr, breaking
+// changes first.
+func printCompatibility(data []byte) {
+	var report struct {
+		V1          int64 `json:"v1"`
+		FromVersion int   `json:"from_version"`
+		ToVersion   int   `json:"to_version"`
+		Breaking    []struct {
+			Path    string `json:"path"`
+			Message string `json:"message"`
+		} `json:"breaking"`
+		Additive []struct {
+			Path    string `json:"path"`
+			Message string `json:"message"`
+		} `json:"additive"`
+	}
+	if err := json.Unmarshal(data, &report); err != nil {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "compared with stored v%d (contract version %d -> %d): %d breaking, %d additive\n",
+		report.V1, report.FromVersion, report.ToVersion, len(report.Breaking), len(report.Additive))
+	for _, c := range report.Breaking {
+		fmt.Fprintf(os.Stderr, "  BREAKING  %s: %s\n", c.Path, c.Message)
+	}
+	for _, c := range report.Additive {
+		fmt.Fprintf(os.Stderr, "  additive  %s: %s\n", c.Path, c.Message)
+	}
+}
+
+// contractInit prints a starter contract inferred from example payloads.
+// It runs locally and never contacts the server.
+func contractInit(args []string) {
+	var files []string
+	endpoint, output := "", ""
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--from-examples":
+			for i+1 < len(args) && !strings.HasPrefix(args[i+1], "--") {
+				files = append(files, args[i+1])
+				i++
+			}
+		case "--endpoint":
+			if i+1 < len(args) {
+				endpoint = args[i+1]
+				i++
+			}
+		case "--output":
+			if i+1 < len(args) {
+				output = args[i+1]
+				i++
+			}
+		}
+	}
+	if endpoint == "" || len(files) == 0 || len(files) > 2 {
+		fmt.Fprintln(os.Stderr, "usage: koor-cli contract init --from-examples <request.json|-> [response.json] --endpoint \"POST /api/x\" [--output <path>]")
+		os.Exit(1)
+	}
+
+	ep := map[string]any{}
+	for i, file := range files {
+		if file == "-" {
+			continue
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			fatal(fmt.Errorf("read example: %w", err))
+		}
+		var example any
+		if err := json.Unmarshal(data, &example); err != nil {
+			fatal(fmt.Errorf("invalid JSON in %s: %w", file, err))
+		}
+		field := contracts.InferField(example)
+		if field.Type != "object" && !(field.Type == "array" && field.Items != nil && field.Items.Type == "object") {
+			fatal(fmt.Errorf("%s: example must be a JSON object or an array of objects", file))
+		}
+		switch {
+		case i == 0 && field.Type == "object":
+			ep["request"] = field.Fields
+		case i == 0:
+			fatal(fmt.Errorf("%s: request example must be a JSON object", file))
+		case field.Type == "object":
+			ep["response"] = field.Fields
+		default:
+			ep["response_array"] = field.Items.Fields
+		}
+	}
+	if len(ep) == 0 {
+		fatal(fmt.Errorf("no example payloads given"))
+	}
+
+	contract := map[string]any{
+		"kind":      "contract",
+		"version":   1,
+		"endpoints": map[string]any{endpoint: ep},
+	}
+	data, _ := json.MarshalIndent(contract, "", "  ")
+	data = append(data, '\n')
+	if output == "" {
+		os.Stdout.Write(data)
+		return
+	}
+	if err := os.WriteFile(output, data, 0o644); err != nil {
+		fatal(err)
+	}
+	fmt.Printf("Wrote %s\n", output)
+}
+
+// contractTarget is a named base URL for live contract tests.
+type contractTarget struct {
+	Name string
+	URL  string
+}
+
+// contractTestResult mirrors the response of POST /api/contracts/{project}/{name}/test.
+type contractTestResult struct {
+	Valid             bool   `json:"valid"`
+	StatusCode        int    `json:"status_code"`
+	Error             string `json:"error"`
+	RequestViolations []struct {
+		Path    string `json:"path"`
+		Message string `json:"message"`
+	} `json:"request_violations"`
+	ResponseViolations []struct {
+		Path    string `json:"path"`
+		Message string `json:"message"`
+	} `json:"response_violations"`
+}
+
+// runContractTests tests every endpoint against every target using up to
+// parallel concurrent requests. Results are keyed by target name, then endpoint.
+func runContractTests(cfg *config, project, name string, endpoints []string, targets []contractTarget, parallel int) map[string]map[string]contractTestResult {
+	type job struct {
+		target   contractTarget
+		endpoint string
+	}
+	jobs := make(chan job)
+	results := make(map[string]map[string]contractTestResult, len(targets))
+	for _, t := range targets {
+		results[t.Name] = make(map[string]contractTestResult, len(endpoints))
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for w := 0; w < parallel; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				var result contractTestResult
+				reqBody, _ := json.Marshal(map[string]any{
+					"endpoint": j.endpoint,
+					"base_url": j.target.URL,
+				})
+				resp, err := doRequest(cfg, "POST", "/api/contracts/"+project+"/"+name+"/test", strings.NewReader(string(reqBody)))
+				if err != nil {
+					result.Error = fmt.Sprintf("request error: %v", err)
+				} else {
+					data, _ := io.ReadAll(resp.Body)
+					resp.Body.Close()
+					if resp.StatusCode != 200 {
+						result.Error = strings.TrimSpace(string(data))
+					} else {
+						json.Unmarshal(data, &result)
+					}
+				}
+				mu.Lock()
+				results[j.target.Name][j.endpoint] = result
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, t := range targets {
+		for _, ep := range endpoints {
+			jobs <- job{target: t, endpoint: ep}
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
+
+// printContractMatrix prints a PASS/FAIL grid of endpoints by environment.
+func printContractMatrix(endpoints []string, targets []contractTarget, results map[string]map[string]contractTestResult) {
+	width := len("ENDPOINT")
+	for _, ep := range endpoints {
+		if len(ep) > width {
+			width = len(ep)
+		}
+	}
+	fmt.Printf("%-*s", width, "ENDPOINT")
+	for _, t := range targets {
+		fmt.Printf("  %-*s", max(len(t.Name), 4), t.Name)
+	}
+	fmt.Println()
+	for _, ep := range endpoints {
+		fmt.Printf("%-*s", width, ep)
+		for _, t := range targets {
+			cell := "FAIL"
+			if results[t.Name][ep].Valid {
+				cell = "PASS"
+			}
+			fmt.Printf("  %-*s", max(len(t.Name), 4), cell)
+		}
+		fmt.Println()
+	}
+}
+
+// --- Backup/Restore commands ---
+
+func handleBackup(cfg *config, args []string) {
+	output := ""
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--output" && i+1 < len(args) {
+			output = args[i+1]
+			i++
+		}
+	}
+	if output == "" {
+		fmt.Fprintln(os.Stderr, "usage: koor-cli backup --output <path>")
+		os.Exit(1)
+	}
+
+	backup := map[string]any{}
+
+	// Backup state.
+	resp, err := doRequest(cfg, "GET", "/api/state", nil)
+	if err != nil {
+		fatal(fmt.Errorf("backup state list: %w", err))
+	}
+	stateListData, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	var stateItems []struct {
+		Key string `json:"key"`
+	}
+	json.Unmarshal(stateListData, &stateItems)
+
+	stateBackup := map[string]json.RawMessage{}
+	for _, item := range stateItems {
+		resp, err := doRequest(cfg, "GET", "/api/state/"+item.Key, nil)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: could not backup state key %s: %v\n", item.Key, err)
+			continue
+		}
+		data, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		stateBackup[item.Key] = json.RawMessage(data)
+	}
+	backup["state"] = stateBackup
+
+	// Backup rules.
+	resp, err = doRequest(cfg, "GET", "/api/rules/export?source=local,learned,external,user-rules", nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: could not backup rules: %v\n", err)
+	} else {
+		rulesData, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		var rules []json.RawMessage
+		json.Unmarshal(rulesData, &rules)
+		backup["rules"] = rules
+	}
+
+	data, _ := json.MarshalIndent(backup, "", "  ")
+	if err := os.WriteFile(output, data, 0o644); err != nil {
+		fatal(fmt.Errorf("write backup file: %w", err))
+	}
+	fmt.Printf("backup saved to %s\n", output)
+	fmt.Printf("  state keys: %d\n", len(stateBackup))
+	if rules, ok := backup["rules"].([]json.RawMessage); ok {
+		fmt.Printf("  rules: %d\n", len(rules))
+	}
+}
+
+func handleRestore(cfg *config, args []string) {
+	filePath := ""
+	dryRun := false
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--file" && i+1 < len(args) {
+			filePath = args[i+1]
+			i++
+		} else if args[i] == "--dry-run" {
+			dryRun = true
+		}
+	}
+	if filePath == "" {
+		fmt.Fprintln(os.Stderr, "usage: koor-cli restore --file <path> [--dry-run]")
+		os.Exit(1)
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		fatal(fmt.Errorf("read backup file: %w", err))
+	}
+
+	var backup struct {
+		State map[string]json.RawMessage `json:"state"`
+		Rules []json.RawMessage          `json:"rules"`
+	}
+	if err := json.Unmarshal(data, &backup); err != nil {
+		fatal(fmt.Errorf("invalid backup JSON: %w", err))
+	}
+	if dryRun {
+		restoreDryRun(cfg, backup.State, backup.Rules)
+		return
+	}
+
+	// Restore state.
+	stateCount := 0
+	for key, val := range backup.State {
+		resp, err := doRequest(cfg, "PUT", "/api/state/"+key, strings.NewReader(string(val)))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: could not restore state key %s: %v\n", key, err)
+			continue
+		}
+		resp.Body.Close()
+		stateCount++
+	}
+
+	// Restore rules.
+	rulesCount := 0
+	if len(backup.Rules) > 0 {
+		rulesJSON, _ := json.Marshal(backup.Rules)
+		resp, err := doRequest(cfg, "POST", "/api/rules/import", strings.NewReader(string(rulesJSON)))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: could not restore rules: %v\n", err)
+		} else {
+			respData, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			var result struct {
+				Imported int `json:"imported"`
+			}
+			json.Unmarshal(respData, &result)
+			rulesCount = result.Imported
+		}
+	}
+
+	fmt.Printf("restore complete from %s\n", filePath)
+	fmt.Printf("  state keys: %d\n", stateCount)
+	fmt.Printf("  rules: %d\n", rulesCount)
+}
+
+// restoreDryRun prints what a restore would change without writing anything.
+func restoreDryRun(cfg *config, stateBackup map[string]json.RawMessage, rules []json.RawMessage) {
+	plan := map[string][]string{"created": {}, "updated": {}, "unchanged": {}}
+
+	keys := make([]string, 0, len(stateBackup))
+	for key := range stateBackup {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		resp, err := doRequest(cfg, "GET", "/api/state/"+key, nil)
+		if err != nil {
+			fatal(err)
+		}
+		current, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		switch {
+		case resp.StatusCode == http.StatusNotFound:
+			plan["created"] = append(plan["created"], "state:"+key)
+		case string(current) == string(stateBackup[key]):
+			plan["unchanged"] = append(plan["unchanged"], "state:"+key)
+		default:
+			plan["updated"] = append(plan["updated"], "state:"+key)
+		}
+	}
+
+	if len(rules) > 0 {
+		rulesJSON, _ := json.Marshal(rules)
+		resp, err := doRequest(cfg, "POST", "/api/rules/import?dry_run=1", strings.NewReader(string(rulesJSON)))
+		if err != nil {
+			fatal(err)
+		}
+		var rulesPlan struct {
+			Created []string `json:"created"`
+			Updated []string `json:"updated"`
+		}
+		json.NewDecoder(resp.Body).Decode(&rulesPlan)
+		resp.Body.Close()
+		plan["created"] = append(plan["created"], rulesPlan.Created...)
+		plan["updated"] = append(plan["updated"], rulesPlan.Updated...)
+	}
+
+	out, _ := json.MarshalIndent(map[string]any{
+		"dry_run":   true,
+		"created":   plan["created"],
+		"updated":   plan["updated"],
+		"unchanged": plan["unchanged"],
+	}, "", "  ")
+	fmt.Println(string(out))
+}
+
+// --- Search commands ---
+
+func handleSearch(cfg *config, args []string) {
+	var terms []string
+	params := []string{}
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--types":
+			if i+1 < len(args) {
+				params = append(params, "types="+url.QueryEscape(args[i+1]))
+				i++
+			}
+		case "--limit":
+			if i+1 < len(args) {
+				params = append(params, "limit="+args[i+1])
+				i++
+			}
+		case "--pretty":
+		default:
+			terms = append(terms, args[i])
+		}
+	}
+	if len(terms) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: koor-cli search <query> [--types state,specs,rules,events,templates] [--limit N]")
+		os.Exit(1)
+	}
+	params = append([]string{"q=" + url.QueryEscape(strings.Join(terms, " "))}, params...)
+
+	resp, err := doRequest(cfg, "GET", "/api/search?"+strings.Join(params, "&"), nil)
+	if err != nil {
+		fatal(err)
+	}
+	defer resp.Body.Close()
+	printResponse(resp)
+}
+
+// --- Digest command ---
+
+func handleDigest(cfg *config, args []string) {
+	params := url.Values{}
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--since":
+			if i+1 < len(args) {
+				params.Set("since", args[i+1])
+				i++
+			}
+		case "--project":
+			if i+1 < len(args) {
+				params.Set("project", args[i+1])
+				i++
+			}
+		case "--markdown":
+			params.Set("format", "markdown")
+		}
+	}
+	if params.Get("since") == "" {
+		fmt.Fprintln(os.Stderr, "usage: koor-cli digest --since <event-id|time|duration> [--project <p>] [--markdown]")
+		os.Exit(1)
+	}
+
+	resp, err := doRequest(cfg, "GET", "/api/digest?"+params.Encode(), nil)
+	if err != nil {
+		fatal(err)
+	}
+	defer resp.Body.Close()
+	printResponse(resp)
+}
+
+// --- Validate command ---
+
+func handleValidate(cfg *config, args []string) {
+	if len(args) > 0 && args[0] == "diff" {
+		validateDiff(cfg, args[1:])
+		return
+	}
+	var project, stack, format, output string
+	var files []string
+	daemon, publish := false, false
+	baseline, noBaseline, clearBaseline := false, false, false
+	var watch []string
+	interval := time.Second
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--daemon":
+			daemon = true
+		case "--publish":
+			publish = true
+		case "--baseline":
+			baseline = true
+		case "--no-baseline":
+			noBaseline = true
+		case "--clear-baseline":
+			clearBaseline = true
+		case "--project":
+			if i+1 < len(args) {
+				project = args[i+1]
+				i++
+			}
+		case "--watch":
+			if i+1 < len(args) {
+				watch = append(watch, args[i+1])
+				i++
+			}
+		case "--interval":
+			if i+1 < len(args) {
+				d, err := time.ParseDuration(args[i+1])
+				if err != nil || d <= 0 {
+					fatal(fmt.Errorf("invalid --interval %q", args[i+1]))
+				}
+				interval = d
+				i++
+			}
+		case "--stack":
+			if i+1 < len(args) {
+				stack = args[i+1]
+				i++
+			}
+		case "--format":
+			if i+1 < len(args) {
+				format = args[i+1]
+				i++
+			}
+		case "--output":
+			if i+1 < len(args) {
+				output = args[i+1]
+				i++
+			}
+		case "--pretty":
+		default:
+			if project == "" {
+				project = args[i]
+			} else {
+				files = append(files, args[i])
+			}
+		}
+	}
+	if daemon {
+		if project == "" || len(watch) == 0 {
+			fmt.Fprintln(os.Stderr, "usage: koor-cli validate --daemon --project <project> --watch <dir>... [--stack <s>] [--interval 1s] [--publish]")
+			os.Exit(1)
+		}
+		validateDaemon(cfg, project, stack, watch, interval, publish)
+		return
+	}
+	if clearBaseline && project != "" {
+		resp, err := doRequest(cfg, "DELETE", "/api/validate/"+url.PathEscape(project)+"/baseline", nil)
+		if err != nil {
+			fatal(err)
+		}
+		defer resp.Body.Close()
+		printResponse(resp)
+		return
+	}
+	if project == "" || len(files) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: koor-cli validate <project> <file>... [--stack <s>] [--format github|gitlab] [--output <path>] [--baseline|--no-baseline]")
+		os.Exit(1)
+	}
+	if baseline {
+		captureBaseline(cfg, project, stack, files)
+		return
+	}
+	path := "/api/validate/" + url.PathEscape(project)
+	query := url.Values{}
+	if format != "" {
+		query.Set("format", format)
+	}
+	if noBaseline {
+		query.Set("baseline", "false")
+	}
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	// Annotations from every file are merged into one array; without
+	// --format, violations are printed one per line, compiler style.
+	annotations := []json.RawMessage{}
+	failed := false
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			fatal(err)
+		}
+		name := strings.ReplaceAll(file, "\\", "/")
+		body, _ := json.Marshal(map[string]string{"filename": name, "content": string(content), "stack": stack})
+		resp, err := doRequest(cfg, "POST", path, bytes.NewReader(body))
+		if err != nil {
+			fatal(err)
+		}
+		data, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			fmt.Fprintf(os.Stderr, "%s: HTTP %d: %s\n", file, resp.StatusCode, strings.TrimSpace(string(data)))
+			os.Exit(1)
+		}
+
+		if format != "" {
+			var items []json.RawMessage
+			if err := json.Unmarshal(data, &items); err != nil {
+				fatal(fmt.Errorf("%s: %w", file, err))
+			}
+			annotations = append(annotations, items...)
+			continue
+		}
+		var result struct {
+			Violations []violation `json:"violations"`
+		}
+		json.Unmarshal(data, &result)
+		for _, v := range result.Violations {
+			fmt.Printf("%s:%d: %s [%s] %s\n", name, max(v.Line, 1), v.Severity, v.RuleID, v.Message)
+			if v.Severity == "error" {
+				failed = true
+			}
+		}
+	}
+
+	if format != "" {
+		out, _ := json.MarshalIndent(annotations, "", "  ")
+		if output == "" {
+			fmt.Println(string(out))
+			return
+		}
+		if err := os.WriteFile(output, append(out, '\n'), 0o644); err != nil {
+			fatal(err)
+		}
+		fmt.Fprintf(os.Stderr, "wrote %d annotations to %s\n", len(annotations), output)
+		return
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// validateDiff checks the lines a patch adds against project rules.
+func validateDiff(cfg *config, args []string) {
+	var project, file, stack, format, output string
+	noBaseline := false
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--no-baseline":
+			noBaseline = true
+		case "--project":
+			if i+1 < len(args) {
+				project = args[i+1]
+				i++
+			}
+		case "--file":
+			if i+1 < len(args) {
+				file = args[i+1]
+				i++
+			}
+		case "--stack":
+			if i+1 < len(args) {
+				stack = args[i+1]
+				i++
+			}
+		case "--format":
+			if i+1 < len(args) {
+				format = args[i+1]
+				i++
+			}
+		case "--output":
+			if i+1 < len(args) {
+				output = args[i+1]
+				i++
+			}
+		default:
+			if project == "" {
+				project = args[i]
+			}
+		}
+	}
+	if project == "" || file == "" {
+		fmt.Fprintln(os.Stderr, "usage: koor-cli validate diff <project> --file <patch|-> [--stack <s>] [--format github|gitlab] [--output <path>] [--no-baseline]")
+		os.Exit(1)
+	}
+	var patch []byte
+	var err error
+	if file == "-" {
+		patch, err = io.ReadAll(os.Stdin)
+	} else {
+		patch, err = os.ReadFile(file)
+	}
+	if err != nil {
+		fatal(err)
+	}
+
+	path := "/api/validate/" + url.PathEscape(project) + "/diff"
+	query := url.Values{}
+	if format != "" {
+		query.Set("format", format)
+	}
+	if noBaseline {
+		query.Set("baseline", "false")
+	}
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	body, _ := json.Marshal(map[string]string{"diff": string(patch), "stack": stack})
+	resp, err := doRequest(cfg, "POST", path, bytes.NewReader(body))
+	if err != nil {
+		fatal(err)
+	}
+	data, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		fmt.Fprintf(os.Stderr, "HTTP %d: %s\n", resp.StatusCode, strings.TrimSpace(string(data)))
+		os.Exit(1)
+	}
+
+	if format != "" {
+		if output == "" {
+			fmt.Println(string(data))
+			return
+		}
+		if err := os.WriteFile(output, data, 0o644); err != nil {
+			fatal(err)
+		}
+		fmt.Fprintf(os.Stderr, "wrote annotations to %s\n", output)
+		return
+	}
+	var result struct {
+		Violations []struct {
+			violation
+			Filename string `json:"filename"`
+			Hunk     int    `json:"hunk"`
+		} `json:"violations"`
+	}
+	json.Unmarshal(data, &result)
+	failed := false
+	for _, v := range result.Violations {
+		fmt.Printf("%s:%d: %s [%s] %s (hunk %d)\n", v.Filename, v.Line, v.Severity, v.RuleID, v.Message, v.Hunk)
+		if v.Severity == "error" {
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// violation is a rule violation reported by POST /api/validate.
+type violation struct {
+	RuleID   string `json:"rule_id"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+	Line     int    `json:"line"`
+}
+
+// maxWatchedFile is the largest file the validate daemon sends to the server.
+const maxWatchedFile = 1 << 20
+
+// watchedFile is what the validate daemon remembers about a file.
+type watchedFile struct {
+	modTime    time.Time
+	size       int64
+	violations int
+}
+
+// captureBaseline makes the violations in files the project's baseline, so
+// later validations report only new ones.
+func captureBaseline(cfg *config, project, stack string, files []string) {
+	type file struct {
+		Filename string `json:"filename"`
+		Content  string `json:"content"`
+	}
+	var list []file
+	for _, f := range files {
+		content, err := os.ReadFile(f)
+		if err != nil {
+			fatal(err)
+		}
+		list = append(list, file{Filename: strings.ReplaceAll(f, "\\", "/"), Content: string(content)})
+	}
+	body, _ := json.Marshal(map[string]any{"files": list, "stack": stack})
+	resp, err := doRequest(cfg, "POST", "/api/validate/"+url.PathEscape(project)+"/baseline", bytes.NewReader(body))
+	if err != nil {
+		fatal(err)
+	}
+	data, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		fmt.Fprintf(os.Stderr, "HTTP %d: %s\n", resp.StatusCode, strings.TrimSpace(string(data)))
+		os.Exit(1)
+	}
+	var result struct {
+		Violations int `json:"violations"`
+	}
+	json.Unmarshal(data, &result)
+	fmt.Printf("baseline for %s: %d violation(s) in %d file(s)\n", project, result.Violations, len(files))
+}
+
+// validateDaemon watches directories and validates each file when it is
+// created or changed, printing violations as they appear and a line when a
+// file becomes clean. With publish, each result is also published as a
+// validation.<project>.result event so other agents can react. Directories
+// are rescanned every interval; hidden directories, node_modules and
+// vendor are skipped.
+func validateDaemon(cfg *config, project, stack string, dirs []string, interval time.Duration, publish bool) {
+	path := "/api/validate/" + url.PathEscape(project)
+	seen := map[string]*watchedFile{}
+
+	check := func(file string, content []byte) ([]violation, error) {
+		name := filepath.ToSlash(file)
+		body, _ := json.Marshal(map[string]string{"filename": name, "content": string(content), "stack": stack})
+		resp, err := doRequest(cfg, "POST", path, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+		}
+		var result struct {
+			Violations []violation `json:"violations"`
+		}
+		if err := json.Unmarshal(data, &result); err != nil {
+			return nil, err
+		}
+		return result.Violations, nil
+	}
+
+	scan := func() {
+		present := map[string]bool{}
+		for _, dir := range dirs {
+			filepath.WalkDir(dir, func(file string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return nil
+				}
+				if d.IsDir() {
+					name := d.Name()
+					if file != dir && (strings.HasPrefix(name, ".") || name == "node_modules" || name == "vendor") {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+				info, err := d.Info()
+				if err != nil || !info.Mode().IsRegular() || info.Size() > maxWatchedFile {
+					return nil
+				}
+				present[file] = true
+				prev := seen[file]
+				if prev != nil && prev.modTime.Equal(info.ModTime()) && prev.size == info.Size() {
+					return nil
+				}
+				content, err := os.ReadFile(file)
+				if err != nil {
+					return nil
+				}
+				violations, err := check(file, content)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "%s: %v\n", file, err)
+					return nil
+				}
+				name := filepath.ToSlash(file)
+				for _, v := range violations {
+					fmt.Printf("%s:%d: %s [%s] %s\n", name, max(v.Line, 1), v.Severity, v.RuleID, v.Message)
+				}
+				if len(violations) == 0 && prev != nil && prev.violations > 0 {
+					fmt.Printf("%s: ok\n", name)
+				}
+				if publish && (len(violations) > 0 || (prev != nil && prev.violations > 0)) {
+					publishValidation(cfg, project, name, violations)
+				}
+				seen[file] = &watchedFile{modTime: info.ModTime(), size: info.Size(), violations: len(violations)}
+				return nil
 			})
-			resp, err := doRequest(cfg, "POST", "/api/contracts/"+project+"/"+name+"/test", strings.NewReader(string(reqBody)))
+		}
+		for file := range seen {
+			if !present[file] {
+				delete(seen, file)
+			}
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "watching %s for %s (every %s, Ctrl+C to stop)\n", strings.Join(dirs, ", "), project, interval)
+	scan()
+	for {
+		time.Sleep(interval)
+		scan()
+	}
+}
+
+// publishValidation publishes a file's validation result to the event bus.
+func publishValidation(cfg *config, project, file string, violations []violation) {
+	failed := 0
+	for _, v := range violations {
+		if v.Severity == "error" {
+			failed++
+		}
+	}
+	body, _ := json.Marshal(map[string]any{
+		"topic": "validation." + project + ".result",
+		"data":  map[string]any{"file": file, "violations": violations, "errors": failed},
+	})
+	resp, err := doRequest(cfg, "POST", "/api/events/publish", bytes.NewReader(body))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "publish %s: %v\n", file, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		fmt.Fprintf(os.Stderr, "publish %s: HTTP %d\n", file, resp.StatusCode)
+	}
+}
+
+// --- Project export/import commands ---
+
+// projectsInit scaffolds the workspaces of a project definition (koor.yaml)
+// and pre-loads the configured server with its specs, rules and templates.
+func projectsInit(cfg *config, args []string) {
+	file, dir := "", ""
+	scaffold, preload := true, true
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--file":
+			if i+1 < len(args) {
+				file = args[i+1]
+				i++
+			}
+		case "--dir":
+			if i+1 < len(args) {
+				dir = args[i+1]
+				i++
+			}
+		case "--no-scaffold":
+			scaffold = false
+		case "--no-preload":
+			preload = false
+		}
+	}
+	if file == "" {
+		fmt.Fprintln(os.Stderr, "usage: koor-cli projects init --file <koor.yaml> [--dir <parent>] [--no-scaffold] [--no-preload]")
+		os.Exit(1)
+	}
+	def, err := wizard.LoadDefinition(file)
+	if err != nil {
+		fatal(err)
+	}
+	if dir != "" {
+		def.ParentDir = dir
+	}
+
+	out := map[string]any{"project": def.Project}
+	if scaffold {
+		pc := def.ProjectConfig(wizard.FindCLI(), wizard.Templates{Dir: wizard.DefaultTemplateDir(), Lang: wizard.LangFromEnv()})
+		if err := wizard.ScaffoldProject(pc); err != nil {
+			fatal(fmt.Errorf("scaffold: %w", err))
+		}
+		slug := wizard.Slug(def.Project)
+		dirs := []string{filepath.Join(def.ParentDir, slug+"-controller")}
+		for _, a := range def.Agents {
+			dirs = append(dirs, filepath.Join(def.ParentDir, slug+"-"+wizard.Slug(a.Name)))
+		}
+		out["workspaces"] = dirs
+	}
+	if preload {
+		res, err := wizard.Preload(context.Background(), def, cfg.Server, cfg.Token)
+		if err != nil {
+			fatal(err)
+		}
+		out["preloaded"] = res
+	}
+	data, _ := json.Marshal(out)
+	printData(data, true)
+}
+
+func handleProjects(cfg *config, args []string) {
+	if len(args) == 1 && args[0] == "list" {
+		resp, err := doRequest(cfg, "GET", "/api/projects", nil)
+		if err != nil {
+			fatal(err)
+		}
+		defer resp.Body.Close()
+		printResponse(resp)
+		return
+	}
+	if len(args) > 0 && args[0] == "init" {
+		projectsInit(cfg, args[1:])
+		return
+	}
+	if len(args) < 2 {
+		fmt.Fprintln(os.Stderr, "usage: koor-cli projects <list|init|create|status|pending|handoff|budgets|settings|export|import|delete> <project> [args]")
+		os.Exit(1)
+	}
+	project := args[1]
+	params := []string{}
+	output, filePath, description := "", "", ""
+	var sets []string
+	reset := false
+	for i := 2; i < len(args); i++ {
+		switch args[i] {
+		case "--description":
+			if i+1 < len(args) {
+				description = args[i+1]
+				i++
+			}
+		case "--set":
+			if i+1 < len(args) {
+				sets = append(sets, args[i+1])
+				i++
+			}
+		case "--reset":
+			reset = true
+		case "--output":
+			if i+1 < len(args) {
+				output = args[i+1]
+				i++
+			}
+		case "--file":
+			if i+1 < len(args) {
+				filePath = args[i+1]
+				i++
+			}
+		case "--state-prefix":
+			if i+1 < len(args) {
+				params = append(params, "state_prefix="+url.QueryEscape(args[i+1]))
+				i++
+			}
+		case "--secrets":
+			params = append(params, "secrets=true")
+		case "--no-webhooks":
+			params = append(params, "webhooks=false")
+		case "--dry-run":
+			params = append(params, "dry_run=1")
+		case "--markdown":
+			params = append(params, "format=markdown")
+		case "--decisions":
+			if i+1 < len(args) {
+				params = append(params, "decisions="+url.QueryEscape(args[i+1]))
+				i++
+			}
+		}
+	}
+	query := ""
+	if len(params) > 0 {
+		query = "?" + strings.Join(params, "&")
+	}
+
+	switch args[0] {
+	case "create":
+		data, _ := json.Marshal(map[string]string{"name": project, "description": description})
+		resp, err := doRequest(cfg, "POST", "/api/projects", bytes.NewReader(data))
+		if err != nil {
+			fatal(err)
+		}
+		defer resp.Body.Close()
+		printResponse(resp)
+
+	case "status", "pending", "budgets", "handoff":
+		resp, err := doRequest(cfg, "GET", "/api/projects/"+project+"/"+args[0]+query, nil)
+		if err != nil {
+			fatal(err)
+		}
+		defer resp.Body.Close()
+		printResponse(resp)
+
+	case "settings":
+		projectSettings(cfg, project, filePath, sets, reset)
+
+	case "export":
+		resp, err := doRequest(cfg, "GET", "/api/projects/"+project+"/export"+query, nil)
+		if err != nil {
+			fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || output == "" {
+			printResponse(resp)
+			return
+		}
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			fatal(fmt.Errorf("read response: %w", err))
+		}
+		var v any
+		if err := json.Unmarshal(body, &v); err == nil {
+			body, _ = json.MarshalIndent(v, "", "  ")
+		}
+		if err := os.WriteFile(output, append(body, '\n'), 0o644); err != nil {
+			fatal(fmt.Errorf("write file %s: %w", output, err))
+		}
+		fmt.Fprintf(os.Stderr, "exported %s to %s\n", project, output)
+
+	case "import":
+		if filePath == "" {
+			fmt.Fprintln(os.Stderr, "usage: koor-cli projects import <project> --file <path> [--state-prefix <p>] [--dry-run]")
+			os.Exit(1)
+		}
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			fatal(fmt.Errorf("read file %s: %w", filePath, err))
+		}
+		resp, err := doRequest(cfg, "POST", "/api/projects/"+project+"/import"+query, strings.NewReader(string(data)))
+		if err != nil {
+			fatal(err)
+		}
+		defer resp.Body.Close()
+		printResponse(resp)
+
+	case "delete":
+		resp, err := doRequest(cfg, "DELETE", "/api/projects/"+project+query, nil)
+		if err != nil {
+			fatal(err)
+		}
+		defer resp.Body.Close()
+		printResponse(resp)
+
+	default:
+		fmt.Fprintf(os.Stderr, "unknown projects command: %s\n", args[0])
+		os.Exit(1)
+	}
+}
+
+// projectSettings shows a project's settings, or updates them from a file
+// and/or --set overrides applied on top of the current settings.
+func projectSettings(cfg *config, project, filePath string, sets []string, reset bool) {
+	path := "/api/projects/" + url.PathEscape(project) + "/settings"
+	if reset {
+		resp, err := doRequest(cfg, "DELETE", path, nil)
+		if err != nil {
+			fatal(err)
+		}
+		defer resp.Body.Close()
+		printResponse(resp)
+		return
+	}
+	if filePath == "" && len(sets) == 0 {
+		resp, err := doRequest(cfg, "GET", path, nil)
+		if err != nil {
+			fatal(err)
+		}
+		defer resp.Body.Close()
+		printResponse(resp)
+		return
+	}
+
+	var body []byte
+	if filePath != "" {
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			fatal(fmt.Errorf("read file %s: %w", filePath, err))
+		}
+		body = data
+	} else {
+		resp, err := doRequest(cfg, "GET", path, nil)
+		if err != nil {
+			fatal(err)
+		}
+		body, err = io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			fatal(fmt.Errorf("read response: %w", err))
+		}
+		if resp.StatusCode != http.StatusOK {
+			fatal(fmt.Errorf("get settings: %s", strings.TrimSpace(string(body))))
+		}
+	}
+	body, err := applySets(body, sets)
+	if err != nil {
+		fatal(err)
+	}
+	resp, err := doRequest(cfg, "PUT", path, bytes.NewReader(body))
+	if err != nil {
+		fatal(err)
+	}
+	defer resp.Body.Close()
+	printResponse(resp)
+}
+
+// --- Milestone commands ---
+
+func handleMilestones(cfg *config, args []string) {
+	if len(args) < 2 {
+		fmt.Fprintln(os.Stderr, "usage: koor-cli milestones <list|add|get|delete> <project> [args]")
+		os.Exit(1)
+	}
+	project := args[1]
+	base := "/api/projects/" + url.PathEscape(project) + "/milestones"
+
+	var resp *http.Response
+	var err error
+	switch args[0] {
+	case "list":
+		resp, err = doRequest(cfg, "GET", base, nil)
+
+	case "get", "delete":
+		if len(args) < 3 {
+			fmt.Fprintf(os.Stderr, "usage: koor-cli milestones %s <project> <id>\n", args[0])
+			os.Exit(1)
+		}
+		method := "GET"
+		if args[0] == "delete" {
+			method = "DELETE"
+		}
+		resp, err = doRequest(cfg, method, base+"/"+args[2], nil)
+
+	case "add":
+		body := map[string]any{}
+		tasks, topics := []string{}, []string{}
+		for i := 2; i < len(args); i++ {
+			if i+1 >= len(args) {
+				break
+			}
+			switch args[i] {
+			case "--name", "--description", "--due":
+				body[strings.TrimPrefix(args[i], "--")] = args[i+1]
+				i++
+			case "--task":
+				tasks = append(tasks, args[i+1])
+				i++
+			case "--event":
+				topics = append(topics, args[i+1])
+				i++
+			}
+		}
+		if body["name"] == nil || len(tasks)+len(topics) == 0 {
+			fmt.Fprintln(os.Stderr, "usage: koor-cli milestones add <project> --name <n> [--due YYYY-MM-DD] [--task <t>]... [--event <topic>]...")
+			os.Exit(1)
+		}
+		body["tasks"], body["events"] = tasks, topics
+		data, _ := json.Marshal(body)
+		resp, err = doRequest(cfg, "POST", base, strings.NewReader(string(data)))
+
+	default:
+		fmt.Fprintf(os.Stderr, "unknown milestones command: %s\n", args[0])
+		os.Exit(1)
+	}
+	if err != nil {
+		fatal(err)
+	}
+	defer resp.Body.Close()
+	printResponse(resp)
+}
+
+// --- Schedule commands ---
+
+func handleSchedules(cfg *config, args []string) {
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, "usage: koor-cli schedules <list|add|get|delete|run|pause|resume> [args]")
+		os.Exit(1)
+	}
+
+	var resp *http.Response
+	var err error
+	switch args[0] {
+	case "list":
+		resp, err = doRequest(cfg, "GET", "/api/schedules", nil)
+
+	case "get", "delete", "run":
+		if len(args) < 2 {
+			fmt.Fprintf(os.Stderr, "usage: koor-cli schedules %s <id>\n", args[0])
+			os.Exit(1)
+		}
+		switch args[0] {
+		case "get":
+			resp, err = doRequest(cfg, "GET", "/api/schedules/"+args[1], nil)
+		case "delete":
+			resp, err = doRequest(cfg, "DELETE", "/api/schedules/"+args[1], nil)
+		default:
+			resp, err = doRequest(cfg, "POST", "/api/schedules/"+args[1]+"/run", nil)
+		}
+
+	case "pause", "resume":
+		if len(args) < 2 {
+			fmt.Fprintf(os.Stderr, "usage: koor-cli schedules %s <id>\n", args[0])
+			os.Exit(1)
+		}
+		resp, err = setSchedulePaused(cfg, args[1], args[0] == "pause")
+
+	case "add":
+		body := map[string]any{}
+		for i := 1; i < len(args); i++ {
+			if i+1 >= len(args) {
+				break
+			}
+			switch args[i] {
+			case "--cron", "--topic", "--name", "--timezone", "--description":
+				body[strings.TrimPrefix(args[i], "--")] = args[i+1]
+				i++
+			case "--data", "--file":
+				data, err := readBodyArg(args[i : i+2])
+				if err != nil {
+					fatal(err)
+				}
+				if !json.Valid(data) {
+					fatal(fmt.Errorf("payload is not valid JSON"))
+				}
+				body["payload"] = json.RawMessage(data)
+				i++
+			}
+		}
+		if body["cron"] == nil || body["topic"] == nil {
+			fmt.Fprintln(os.Stderr, `usage: koor-cli schedules add --cron "0 9 * * 1-5" --topic <topic> [--name <n>] [--timezone <tz>] [--description <text>] [--data <json>|--file <path>]`)
+			os.Exit(1)
+		}
+		data, _ := json.Marshal(body)
+		resp, err = doRequest(cfg, "POST", "/api/schedules", strings.NewReader(string(data)))
+
+	default:
+		fmt.Fprintf(os.Stderr, "unknown schedules command: %s\n", args[0])
+		os.Exit(1)
+	}
+	if err != nil {
+		fatal(err)
+	}
+	defer resp.Body.Close()
+	printResponse(resp)
+}
+
+// setSchedulePaused reads a schedule and writes it back with paused set,
+// since the API replaces schedules whole.
+func setSchedulePaused(cfg *config, id string, paused bool) (*http.Response, error) {
+	resp, err := doRequest(cfg, "GET", "/api/schedules/"+id, nil)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return resp, nil
+	}
+	var sc map[string]any
+	err = json.NewDecoder(resp.Body).Decode(&sc)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("decode schedule: %w", err)
+	}
+	sc["paused"] = paused
+	data, _ := json.Marshal(sc)
+	return doRequest(cfg, "PUT", "/api/schedules/"+id, strings.NewReader(string(data)))
+}
+
+// --- Policy commands ---
+
+func handlePolicies(cfg *config, args []string) {
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, "usage: koor-cli policies <list|get|add|delete|check> [args]")
+		os.Exit(1)
+	}
+
+	// Collect --flag value pairs into a JSON body.
+	body := map[string]string{}
+	for i := 1; i < len(args); i++ {
+		switch args[i] {
+		case "--name", "--action", "--resource", "--condition", "--description", "--instance_id":
+			if i+1 < len(args) {
+				body[strings.TrimPrefix(args[i], "--")] = args[i+1]
+				i++
+			}
+		}
+	}
+
+	var resp *http.Response
+	var err error
+	switch args[0] {
+	case "list":
+		path := "/api/policies"
+		if body["action"] != "" {
+			path += "?action=" + url.QueryEscape(body["action"])
+		}
+		resp, err = doRequest(cfg, "GET", path, nil)
+
+	case "get", "delete":
+		if len(args) < 2 {
+			fmt.Fprintf(os.Stderr, "usage: koor-cli policies %s <id>\n", args[0])
+			os.Exit(1)
+		}
+		method := "GET"
+		if args[0] == "delete" {
+			method = "DELETE"
+		}
+		resp, err = doRequest(cfg, method, "/api/policies/"+args[1], nil)
+
+	case "add":
+		if body["action"] == "" || body["resource"] == "" || body["condition"] == "" {
+			fmt.Fprintln(os.Stderr, `usage: koor-cli policies add --action <event.publish|state.write> --resource <pattern> --condition "role=controller" [--name <n>] [--description <text>]`)
+			os.Exit(1)
+		}
+		data, _ := json.Marshal(body)
+		resp, err = doRequest(cfg, "POST", "/api/policies", strings.NewReader(string(data)))
+
+	case "check":
+		if body["action"] == "" || body["resource"] == "" {
+			fmt.Fprintln(os.Stderr, "usage: koor-cli policies check --action <action> --resource <topic-or-key> [--instance_id <id>]")
+			os.Exit(1)
+		}
+		data, _ := json.Marshal(body)
+		resp, err = doRequest(cfg, "POST", "/api/policies/evaluate", strings.NewReader(string(data)))
+
+	default:
+		fmt.Fprintf(os.Stderr, "unknown policies command: %s\n", args[0])
+		os.Exit(1)
+	}
+	if err != nil {
+		fatal(err)
+	}
+	defer resp.Body.Close()
+	printResponse(resp)
+}
+
+// --- Token commands ---
+
+func handleTokens(cfg *config, args []string) {
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, "usage: koor-cli tokens <list|create|rotate|topics|revoke|whoami> [args]")
+		os.Exit(1)
+	}
+	var name, instance, project, expiresIn, grace string
+	var scopes, allow, deny []string
+	for i := 1; i < len(args); i++ {
+		if i+1 >= len(args) {
+			break
+		}
+		switch args[i] {
+		case "--name":
+			name = args[i+1]
+			i++
+		case "--instance":
+			instance = args[i+1]
+			i++
+		case "--project":
+			project = args[i+1]
+			i++
+		case "--scope":
+			scopes = append(scopes, args[i+1])
+			i++
+		case "--expires-in":
+			expiresIn = args[i+1]
+			i++
+		case "--grace":
+			grace = args[i+1]
+			i++
+		case "--allow-topic":
+			allow = append(allow, args[i+1])
+			i++
+		case "--deny-topic":
+			deny = append(deny, args[i+1])
+			i++
+		}
+	}
+	var topics map[string][]string
+	if len(allow) > 0 || len(deny) > 0 {
+		topics = map[string][]string{"allow": allow, "deny": deny}
+	}
+
+	var resp *http.Response
+	var err error
+	switch args[0] {
+	case "list":
+		path := "/api/tokens"
+		if instance != "" {
+			path += "?instance_id=" + url.QueryEscape(instance)
+		}
+		resp, err = doRequest(cfg, "GET", path, nil)
+
+	case "create":
+		if name == "" {
+			fmt.Fprintln(os.Stderr, "usage: koor-cli tokens create --name <n> [--instance <id>] [--project <p>] [--scope <s>]... [--expires-in 720h] [--allow-topic <p>]... [--deny-topic <p>]...")
+			os.Exit(1)
+		}
+		data, _ := json.Marshal(map[string]any{
+			"name": name, "instance_id": instance, "project": project, "scopes": scopes, "expires_in": expiresIn, "topics": topics,
+		})
+		resp, err = doRequest(cfg, "POST", "/api/tokens", bytes.NewReader(data))
+
+	case "rotate":
+		if len(args) < 2 || strings.HasPrefix(args[1], "--") {
+			fmt.Fprintln(os.Stderr, "usage: koor-cli tokens rotate <id> [--grace 24h]")
+			os.Exit(1)
+		}
+		data, _ := json.Marshal(map[string]string{"grace": grace})
+		resp, err = doRequest(cfg, "POST", "/api/tokens/"+args[1]+"/rotate", bytes.NewReader(data))
+
+	case "topics":
+		if len(args) < 2 || strings.HasPrefix(args[1], "--") {
+			fmt.Fprintln(os.Stderr, "usage: koor-cli tokens topics <id> [--allow-topic <p>]... [--deny-topic <p>]...")
+			os.Exit(1)
+		}
+		data, _ := json.Marshal(map[string][]string{"allow": allow, "deny": deny})
+		resp, err = doRequest(cfg, "PUT", "/api/tokens/"+args[1]+"/topics", bytes.NewReader(data))
+
+	case "revoke":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "usage: koor-cli tokens revoke <id>")
+			os.Exit(1)
+		}
+		resp, err = doRequest(cfg, "DELETE", "/api/tokens/"+args[1], nil)
+
+	case "whoami":
+		resp, err = doRequest(cfg, "GET", "/api/tokens/whoami", nil)
+
+	default:
+		fmt.Fprintf(os.Stderr, "unknown tokens command: %s\n", args[0])
+		os.Exit(1)
+	}
+	if err != nil {
+		fatal(err)
+	}
+	defer resp.Body.Close()
+	printResponse(resp)
+}
+
+// --- User commands ---
+
+func handleUsers(cfg *config, args []string) {
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, "usage: koor-cli users <list|add|set-role|reset|delete> [args]")
+		os.Exit(1)
+	}
+
+	var resp *http.Response
+	var err error
+	switch args[0] {
+	case "list":
+		resp, err = doRequest(cfg, "GET", "/api/users", nil)
+
+	case "add":
+		var name, role string
+		for i := 1; i+1 < len(args); i++ {
+			switch args[i] {
+			case "--name":
+				name = args[i+1]
+				i++
+			case "--role":
+				role = args[i+1]
+				i++
+			}
+		}
+		if name == "" || role == "" {
+			fmt.Fprintln(os.Stderr, "usage: koor-cli users add --name <n> --role <viewer|agent|controller|admin>")
+			os.Exit(1)
+		}
+		data, _ := json.Marshal(map[string]string{"name": name, "role": role})
+		resp, err = doRequest(cfg, "POST", "/api/users", bytes.NewReader(data))
+
+	case "set-role":
+		if len(args) < 3 {
+			fmt.Fprintln(os.Stderr, "usage: koor-cli users set-role <name> <viewer|agent|controller|admin>")
+			os.Exit(1)
+		}
+		data, _ := json.Marshal(map[string]string{"role": args[2]})
+		resp, err = doRequest(cfg, "PUT", "/api/users/"+url.PathEscape(args[1]), bytes.NewReader(data))
+
+	case "reset":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "usage: koor-cli users reset <name>")
+			os.Exit(1)
+		}
+		resp, err = doRequest(cfg, "POST", "/api/users/"+url.PathEscape(args[1])+"/reset", nil)
+
+	case "delete":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "usage: koor-cli users delete <name>")
+			os.Exit(1)
+		}
+		resp, err = doRequest(cfg, "DELETE", "/api/users/"+url.PathEscape(args[1]), nil)
+
+	default:
+		fmt.Fprintf(os.Stderr, "unknown users command: %s\n", args[0])
+		os.Exit(1)
+	}
+	if err != nil {
+		fatal(err)
+	}
+	defer resp.Body.Close()
+	printResponse(resp)
+}
+
+// --- Task commands ---
+
+func handleTasks(cfg *config, args []string) {
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, "usage: koor-cli tasks <list|get|create|claim|complete|fail|requeue> [args]")
+		os.Exit(1)
+	}
+	flags := map[string]string{}
+	var positional []string
+	for i := 1; i < len(args); i++ {
+		switch args[i] {
+		case "--project", "--queue", "--status", "--claimed-by", "--limit", "--title", "--priority",
+			"--payload", "--max-attempts", "--instance", "--visibility", "--result", "--error":
+			if i+1 < len(args) {
+				flags[args[i]] = args[i+1]
+				i++
+			}
+		case "--pretty":
+		default:
+			positional = append(positional, args[i])
+		}
+	}
+	intFlag := func(name string) int {
+		v, ok := flags[name]
+		if !ok {
+			return 0
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			fatal(fmt.Errorf("%s must be an integer", name))
+		}
+		return n
+	}
+	jsonFlag := func(name string) json.RawMessage {
+		v, ok := flags[name]
+		if !ok {
+			return nil
+		}
+		if !json.Valid([]byte(v)) {
+			fatal(fmt.Errorf("%s must be valid JSON", name))
+		}
+		return json.RawMessage(v)
+	}
+	needArg := func(usage string) string {
+		if len(positional) < 1 {
+			fmt.Fprintln(os.Stderr, "usage: koor-cli tasks "+usage)
+			os.Exit(1)
+		}
+		return positional[0]
+	}
+
+	var resp *http.Response
+	var err error
+	switch args[0] {
+	case "list":
+		q := url.Values{}
+		for _, f := range []string{"project", "queue", "status", "claimed-by", "limit"} {
+			if v, ok := flags["--"+f]; ok {
+				q.Set(strings.ReplaceAll(f, "-", "_"), v)
+			}
+		}
+		path := "/api/tasks"
+		if len(q) > 0 {
+			path += "?" + q.Encode()
+		}
+		resp, err = doRequest(cfg, "GET", path, nil)
+
+	case "get":
+		id := needArg("get <id>")
+		resp, err = doRequest(cfg, "GET", "/api/tasks/"+id, nil)
+
+	case "create":
+		project := needArg("create <project> --title <t> [--queue <q>] [--priority N] [--payload <json>] [--max-attempts N]")
+		if flags["--title"] == "" {
+			fmt.Fprintln(os.Stderr, "usage: koor-cli tasks create <project> --title <t> [--queue <q>] [--priority N] [--payload <json>] [--max-attempts N]")
+			os.Exit(1)
+		}
+		data, _ := json.Marshal(map[string]any{
+			"project": project, "queue": flags["--queue"], "title": flags["--title"],
+			"payload": jsonFlag("--payload"), "priority": intFlag("--priority"), "max_attempts": intFlag("--max-attempts"),
+		})
+		resp, err = doRequest(cfg, "POST", "/api/tasks", bytes.NewReader(data))
+
+	case "claim":
+		project := needArg("claim <project> --instance <id> [--queue <q>] [--visibility 30m]")
+		data, _ := json.Marshal(map[string]any{
+			"project": project, "queue": flags["--queue"], "instance_id": flags["--instance"],
+			"visibility_timeout": flags["--visibility"],
+		})
+		resp, err = doRequest(cfg, "POST", "/api/tasks/claim", bytes.NewReader(data))
+		if err == nil && resp.StatusCode == http.StatusNoContent {
+			resp.Body.Close()
+			fmt.Fprintln(os.Stderr, "no task available")
+			os.Exit(2)
+		}
+
+	case "complete":
+		id := needArg("complete <id> [--instance <id>] [--result <json>]")
+		data, _ := json.Marshal(map[string]any{"instance_id": flags["--instance"], "result": jsonFlag("--result")})
+		resp, err = doRequest(cfg, "POST", "/api/tasks/"+id+"/complete", bytes.NewReader(data))
+
+	case "fail":
+		id := needArg("fail <id> [--instance <id>] [--error <msg>]")
+		data, _ := json.Marshal(map[string]any{"instance_id": flags["--instance"], "error": flags["--error"]})
+		resp, err = doRequest(cfg, "POST", "/api/tasks/"+id+"/fail", bytes.NewReader(data))
+
+	case "requeue":
+		id := needArg("requeue <id> [--queue <q>] [--priority N]")
+		body := map[string]any{}
+		if q, ok := flags["--queue"]; ok {
+			body["queue"] = q
+		}
+		if _, ok := flags["--priority"]; ok {
+			body["priority"] = intFlag("--priority")
+		}
+		data, _ := json.Marshal(body)
+		resp, err = doRequest(cfg, "POST", "/api/tasks/"+id+"/requeue", bytes.NewReader(data))
+
+	default:
+		fmt.Fprintf(os.Stderr, "unknown tasks command: %s\n", args[0])
+		os.Exit(1)
+	}
+	if err != nil {
+		fatal(err)
+	}
+	defer resp.Body.Close()
+	printResponse(resp)
+}
+
+// --- Message commands ---
+
+func handleMessages(cfg *config, args []string) {
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, "usage: koor-cli messages <send|inbox|get|ack> [args]")
+		os.Exit(1)
+	}
+	flags := map[string]string{}
+	var positional []string
+	unread := false
+	for i := 1; i < len(args); i++ {
+		switch args[i] {
+		case "--to", "--capability", "--project", "--subject", "--body", "--from", "--reply-to",
+			"--limit", "--instance":
+			if i+1 < len(args) {
+				flags[args[i]] = args[i+1]
+				i++
+			}
+		case "--unread":
+			unread = true
+		case "--pretty":
+		default:
+			positional = append(positional, args[i])
+		}
+	}
+	needArg := func(usage string) string {
+		if len(positional) < 1 {
+			fmt.Fprintln(os.Stderr, "usage: koor-cli messages "+usage)
+			os.Exit(1)
+		}
+		return positional[0]
+	}
+
+	var resp *http.Response
+	var err error
+	switch args[0] {
+	case "send":
+		if (flags["--to"] == "") == (flags["--capability"] == "") {
+			fmt.Fprintln(os.Stderr, "usage: koor-cli messages send (--to <instance> | --capability <c> [--project <p>]) [--subject <s>] [--body <json|text>] [--reply-to <id>]")
+			os.Exit(1)
+		}
+		// A body that is not JSON is sent as a string.
+		var body json.RawMessage
+		if v, ok := flags["--body"]; ok {
+			body = json.RawMessage(v)
+			if !json.Valid(body) {
+				body, _ = json.Marshal(v)
+			}
+		}
+		data, _ := json.Marshal(map[string]any{
+			"to": flags["--to"], "capability": flags["--capability"], "project": flags["--project"],
+			"from": flags["--from"], "subject": flags["--subject"], "body": body, "reply_to": flags["--reply-to"],
+		})
+		resp, err = doRequest(cfg, "POST", "/api/messages", bytes.NewReader(data))
+
+	case "inbox":
+		instanceID := needArg("inbox <instance> [--unread] [--limit N]")
+		q := url.Values{}
+		if unread {
+			q.Set("unread", "1")
+		}
+		if v, ok := flags["--limit"]; ok {
+			q.Set("limit", v)
+		}
+		path := "/api/messages/inbox/" + instanceID
+		if len(q) > 0 {
+			path += "?" + q.Encode()
+		}
+		resp, err = doRequest(cfg, "GET", path, nil)
+
+	case "get":
+		id := needArg("get <id>")
+		resp, err = doRequest(cfg, "GET", "/api/messages/"+id, nil)
+
+	case "ack":
+		needArg("ack <id>... [--instance <id>]")
+		data, _ := json.Marshal(map[string]string{"instance_id": flags["--instance"]})
+		for _, id := range positional {
+			resp, err := doRequest(cfg, "POST", "/api/messages/"+id+"/ack", bytes.NewReader(data))
 			if err != nil {
-				fmt.Printf("FAIL  %s (request error: %v)\n", ep, err)
-				fail++
-				continue
+				fatal(err)
 			}
-			data, _ := io.ReadAll(resp.Body)
+			printResponse(resp)
 			resp.Body.Close()
+		}
+		return
+
+	default:
+		fmt.Fprintf(os.Stderr, "unknown messages command: %s\n", args[0])
+		os.Exit(1)
+	}
+	if err != nil {
+		fatal(err)
+	}
+	defer resp.Body.Close()
+	printResponse(resp)
+}
+
+// --- Admin commands ---
+
+// --- Workspace commands ---
+
+func handleWorkspace(cfg *config, args []string) {
+	if len(args) < 1 || args[0] != "verify" {
+		fmt.Fprintln(os.Stderr, "usage: koor-cli workspace verify")
+		os.Exit(1)
+	}
+	failed := 0
+	for _, c := range verifyWorkspace(cfg) {
+		if c.level == "FAIL" {
+			failed++
+		}
+		fmt.Printf("%-5s %-13s %s\n", c.level, c.name, c.detail)
+	}
+	if failed > 0 {
+		fmt.Printf("\n%d check(s) failed\n", failed)
+		os.Exit(1)
+	}
+	fmt.Println("\nworkspace OK")
+}
+
+// workspaceCheck is one line of `workspace verify` output. level is "ok",
+// "warn" or "FAIL"; only failures make the command exit non-zero.
+type workspaceCheck struct {
+	level, name, detail string
+}
+
+var (
+	serverLineRe   = regexp.MustCompile(`(?m)^- Server: (\S+)`)
+	instanceNameRe = regexp.MustCompile("register_instance`? with name=([A-Za-z0-9_.-]+)")
+)
+
+// verifyWorkspace checks the agent workspace in the current directory the
+// way koor-wizard scaffolds it: instruction files, mcp.json, the bundled
+// koor-cli, and that the server the workspace points at is reachable.
+func verifyWorkspace(cfg *config) []workspaceCheck {
+	var checks []workspaceCheck
+	add := func(level, name, format string, args ...any) {
+		checks = append(checks, workspaceCheck{level, name, fmt.Sprintf(format, args...)})
+	}
+	server := strings.TrimRight(cfg.Server, "/")
+
+	// Instructions: CLAUDE.md and .cursorrules are written from the same template.
+	claude, claudeErr := os.ReadFile("CLAUDE.md")
+	cursor, cursorErr := os.ReadFile(".cursorrules")
+	instructions := claude
+	switch {
+	case claudeErr != nil && cursorErr != nil:
+		add("FAIL", "instructions", "no CLAUDE.md or .cursorrules; is this a koor workspace?")
+	case claudeErr != nil:
+		add("warn", "instructions", "CLAUDE.md missing (.cursorrules present)")
+		instructions = cursor
+	case cursorErr != nil:
+		add("warn", "instructions", ".cursorrules missing (CLAUDE.md present)")
+	case !bytes.Equal(claude, cursor):
+		add("warn", "instructions", "CLAUDE.md and .cursorrules differ")
+	default:
+		add("ok", "instructions", "CLAUDE.md and .cursorrules match")
+	}
+	if m := serverLineRe.FindSubmatch(instructions); m != nil {
+		if declared := strings.TrimRight(string(m[1]), "/"); declared != server {
+			add("FAIL", "instructions", "instructions name server %s, koor-cli is configured for %s", declared, server)
+		}
+	}
+
+	// MCP config for Claude Code and Cursor.
+	wantMCP := server + "/mcp"
+	found := 0
+	for _, path := range []string{".claude/mcp.json", ".cursor/mcp.json"} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		found++
+		var mcp struct {
+			MCPServers map[string]struct {
+				URL string `json:"url"`
+			} `json:"mcpServers"`
+		}
+		if err := json.Unmarshal(data, &mcp); err != nil {
+			add("FAIL", "mcp.json", "%s: %v", path, err)
+			continue
+		}
+		entry, ok := mcp.MCPServers["koor"]
+		switch {
+		case !ok:
+			add("FAIL", "mcp.json", "%s has no \"koor\" server", path)
+		case strings.TrimRight(entry.URL, "/") != wantMCP:
+			add("FAIL", "mcp.json", "%s points at %s, expected %s", path, entry.URL, wantMCP)
+		default:
+			add("ok", "mcp.json", "%s points at %s", path, entry.URL)
+		}
+	}
+	if found == 0 {
+		add("FAIL", "mcp.json", "neither .claude/mcp.json nor .cursor/mcp.json exists")
+	}
+
+	// The instructions call ./koor-cli, so the workspace needs its own copy.
+	cli := "koor-cli"
+	if runtime.GOOS == "windows" {
+		cli += ".exe"
+	}
+	if _, err := os.Stat(cli); err != nil {
+		add("FAIL", "koor-cli", "./%s not found; the instructions call it directly", cli)
+	} else if bundled, err := buildinfo.ReadFile(cli); err != nil {
+		add("warn", "koor-cli", "cannot read the version of ./%s: %v", cli, err)
+	} else if running, ok := debug.ReadBuildInfo(); ok && binaryVersion(bundled) != binaryVersion(running) {
+		add("warn", "koor-cli", "./%s is %s, this koor-cli is %s", cli, binaryVersion(bundled), binaryVersion(running))
+	} else {
+		add("ok", "koor-cli", "./%s is %s", cli, binaryVersion(bundled))
+	}
+
+	// Server reachability and the declared instance.
+	resp, err := doRequest(cfg, "GET", "/health", nil)
+	if err != nil {
+		add("FAIL", "server", "%s unreachable: %v", server, err)
+		return checks
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		add("FAIL", "server", "%s/health returned %d", server, resp.StatusCode)
+		return checks
+	}
+	add("ok", "server", "%s is up", server)
+
+	var name string
+	if m := instanceNameRe.FindSubmatch(instructions); m != nil {
+		name = string(m[1])
+	}
+	if name == "" {
+		add("warn", "instance", "no instance name found in the instructions")
+		return checks
+	}
+	resp, err = doRequest(cfg, "GET", "/api/instances?name="+url.QueryEscape(name), nil)
+	if err != nil {
+		add("FAIL", "instance", "%v", err)
+		return checks
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		add("FAIL", "instance", "server rejected the configured token (%d)", resp.StatusCode)
+		return checks
+	}
+	var list []struct {
+		ID     string `json:"id"`
+		Name   string `json:"name"`
+		Status string `json:"status"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		add("FAIL", "instance", "list instances: HTTP %d", resp.StatusCode)
+		return checks
+	}
+	var matches []string
+	for _, inst := range list {
+		if inst.Name == name {
+			matches = append(matches, inst.ID+" ("+inst.Status+")")
+		}
+	}
+	switch len(matches) {
+	case 0:
+		add("ok", "instance", "%s is not registered yet; it registers at session start", name)
+	case 1:
+		add("ok", "instance", "%s registered as %s", name, matches[0])
+	default:
+		add("warn", "instance", "%s registered %d times: %s", name, len(matches), strings.Join(matches, ", "))
+	}
+	return checks
+}
 
-			var result struct {
-				Valid              bool `json:"valid"`
-				StatusCode         int  `json:"status_code"`
-				Error              string `json:"error"`
-				RequestViolations  []struct {
-					Path    string `json:"path"`
-					Message string `json:"message"`
-				} `json:"request_violations"`
-				ResponseViolations []struct {
-					Path    string `json:"path"`
-					Message string `json:"message"`
-				} `json:"response_violations"`
-			}
-			json.Unmarshal(data, &result)
+// binaryVersion describes a Go binary's build: its module version, or for
+// development builds the VCS revision it was built from.
+func binaryVersion(bi *debug.BuildInfo) string {
+	if v := bi.Main.Version; v != "" && v != "(devel)" {
+		return v
+	}
+	v := "(devel)"
+	for _, s := range bi.Settings {
+		if s.Key == "vcs.revision" && len(s.Value) >= 12 {
+			v = s.Value[:12]
+		}
+	}
+	return v
+}
 
-			if result.Valid {
-				fmt.Printf("PASS  %s (status: %d)\n", ep, result.StatusCode)
-				pass++
-			} else {
-				fmt.Printf("FAIL  %s (status: %d)\n", ep, result.StatusCode)
-				if result.Error != "" {
-					fmt.Printf("  - error: %s\n", result.Error)
-				}
-				for _, v := range result.RequestViolations {
-					fmt.Printf("  - [req] [%s] %s\n", v.Path, v.Message)
-				}
-				for _, v := range result.ResponseViolations {
-					fmt.Printf("  - [resp] [%s] %s\n", v.Path, v.Message)
+func handleAdmin(cfg *config, args []string) {
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, "usage: koor-cli admin <gc-report|gc|generate-key|rotate-key|quarantine|snapshot|restore> [args]")
+		os.Exit(1)
+	}
+	minFailures, dryRun := 0, false
+	var categories []string
+	for i := 1; i < len(args); i++ {
+		switch args[i] {
+		case "--category":
+			if i+1 < len(args) {
+				categories = append(categories, strings.Split(args[i+1], ",")...)
+				i++
+			}
+		case "--min-failures":
+			if i+1 < len(args) {
+				n, err := strconv.Atoi(args[i+1])
+				if err != nil {
+					fatal(fmt.Errorf("invalid --min-failures %q", args[i+1]))
 				}
-				fail++
+				minFailures = n
+				i++
 			}
+		case "--dry-run":
+			dryRun = true
 		}
+	}
 
-		total := pass + fail
-		fmt.Printf("\n%d/%d endpoints PASS", pass, total)
-		if fail > 0 {
-			fmt.Printf(", %d FAIL", fail)
+	var resp *http.Response
+	var err error
+	switch args[0] {
+	case "gc-report":
+		path := "/api/admin/gc-report"
+		if minFailures > 0 {
+			path += "?min_failures=" + strconv.Itoa(minFailures)
 		}
-		fmt.Println()
-		if fail > 0 {
+		resp, err = doRequest(cfg, "GET", path, nil)
+
+	case "gc":
+		if len(categories) == 0 {
+			fmt.Fprintln(os.Stderr, "usage: koor-cli admin gc --category <state|rules|webhooks|templates>... [--min-failures N] [--dry-run]")
 			os.Exit(1)
 		}
+		data, _ := json.Marshal(map[string]any{"categories": categories, "min_failures": minFailures})
+		path := "/api/admin/gc"
+		if dryRun {
+			path += "?dry_run=1"
+		}
+		resp, err = doRequest(cfg, "POST", path, bytes.NewReader(data))
+
+	case "generate-key":
+		// 32 random bytes: an AES-256 key for KOOR_ENCRYPTION_KEY.
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			fatal(err)
+		}
+		fmt.Println(base64.StdEncoding.EncodeToString(key))
+		return
+
+	case "rotate-key":
+		resp, err = doRequest(cfg, "POST", "/api/admin/rotate-key", nil)
+
+	case "quarantine":
+		resp, err = adminQuarantine(cfg, args[1:])
+
+	case "snapshot":
+		adminSnapshot(cfg, args[1:])
+		return
+
+	case "restore":
+		adminRestore(cfg, args[1:])
+		return
 
 	default:
-		fmt.Fprintf(os.Stderr, "unknown contract command: %s\n", args[0])
+		fmt.Fprintf(os.Stderr, "unknown admin command: %s\n", args[0])
 		os.Exit(1)
 	}
+	if err != nil {
+		fatal(err)
+	}
+	defer resp.Body.Close()
+	printResponse(resp)
 }
 
-// --- Backup/Restore commands ---
+// adminQuarantine lists quarantined data, or sweeps, restores or purges it.
+func adminQuarantine(cfg *config, args []string) (*http.Response, error) {
+	sub := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "--") {
+		sub, args = args[0], args[1:]
+	}
+	switch sub {
+	case "":
+		q := url.Values{}
+		for i := 0; i+1 < len(args); i++ {
+			switch args[i] {
+			case "--kind", "--instance":
+				q.Set(strings.TrimPrefix(args[i], "--"), args[i+1])
+				i++
+			}
+		}
+		path := "/api/admin/quarantine"
+		if len(q) > 0 {
+			path += "?" + q.Encode()
+		}
+		return doRequest(cfg, "GET", path, nil)
+	case "sweep":
+		return doRequest(cfg, "POST", "/api/admin/quarantine/sweep", nil)
+	case "restore", "purge":
+		if len(args) < 1 {
+			fmt.Fprintf(os.Stderr, "usage: koor-cli admin quarantine %s <id>\n", sub)
+			os.Exit(1)
+		}
+		if sub == "restore" {
+			return doRequest(cfg, "POST", "/api/admin/quarantine/"+args[0]+"/restore", nil)
+		}
+		return doRequest(cfg, "DELETE", "/api/admin/quarantine/"+args[0], nil)
+	}
+	fmt.Fprintf(os.Stderr, "unknown admin quarantine command: %s\n", sub)
+	os.Exit(1)
+	return nil, nil
+}
 
-func handleBackup(cfg *config, args []string) {
-	output := ""
-	for i := 0; i < len(args); i++ {
-		if args[i] == "--output" && i+1 < len(args) {
+// adminSnapshot saves a copy of the whole server database to a file.
+func adminSnapshot(cfg *config, args []string) {
+	output, format := "", ""
+	for i := 0; i+1 < len(args); i++ {
+		switch args[i] {
+		case "--output":
 			output = args[i+1]
 			i++
+		case "--format":
+			format = args[i+1]
+			i++
 		}
 	}
 	if output == "" {
-		fmt.Fprintln(os.Stderr, "usage: koor-cli backup --output <path>")
+		fmt.Fprintln(os.Stderr, "usage: koor-cli admin snapshot --output <path> [--format sqlite|json]")
 		os.Exit(1)
 	}
-
-	backup := map[string]any{}
-
-	// Backup state.
-	resp, err := doRequest(cfg, "GET", "/api/state", nil)
-	if err != nil {
-		fatal(fmt.Errorf("backup state list: %w", err))
+	path := "/api/admin/snapshot"
+	if format != "" {
+		path += "?format=" + url.QueryEscape(format)
 	}
-	stateListData, _ := io.ReadAll(resp.Body)
-	resp.Body.Close()
-
-	var stateItems []struct {
-		Key string `json:"key"`
+	resp, err := doRequest(cfg, "POST", path, nil)
+	if err != nil {
+		fatal(err)
 	}
-	json.Unmarshal(stateListData, &stateItems)
-
-	stateBackup := map[string]json.RawMessage{}
-	for _, item := range stateItems {
-		resp, err := doRequest(cfg, "GET", "/api/state/"+item.Key, nil)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "warning: could not backup state key %s: %v\n", item.Key, err)
-			continue
-		}
-		data, _ := io.ReadAll(resp.Body)
-		resp.Body.Close()
-		stateBackup[item.Key] = json.RawMessage(data)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		printResponse(resp)
+		os.Exit(1)
 	}
-	backup["state"] = stateBackup
 
-	// Backup rules.
-	resp, err = doRequest(cfg, "GET", "/api/rules/export?source=local,learned,external,user-rules", nil)
+	f, err := os.OpenFile(output, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "warning: could not backup rules: %v\n", err)
-	} else {
-		rulesData, _ := io.ReadAll(resp.Body)
-		resp.Body.Close()
-		var rules []json.RawMessage
-		json.Unmarshal(rulesData, &rules)
-		backup["rules"] = rules
+		fatal(fmt.Errorf("create snapshot file: %w", err))
 	}
-
-	data, _ := json.MarshalIndent(backup, "", "  ")
-	if err := os.WriteFile(output, data, 0o644); err != nil {
-		fatal(fmt.Errorf("write backup file: %w", err))
+	n, err := io.Copy(f, resp.Body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
 	}
-	fmt.Printf("backup saved to %s\n", output)
-	fmt.Printf("  state keys: %d\n", len(stateBackup))
-	if rules, ok := backup["rules"].([]json.RawMessage); ok {
-		fmt.Printf("  rules: %d\n", len(rules))
+	if err != nil {
+		os.Remove(output)
+		fatal(fmt.Errorf("write snapshot file: %w", err))
 	}
+	fmt.Printf("snapshot saved to %s (%d bytes)\n", output, n)
 }
 
-func handleRestore(cfg *config, args []string) {
-	filePath := ""
+// adminRestore replaces all server data with a snapshot file, after the
+// user confirms (or with --yes).
+func adminRestore(cfg *config, args []string) {
+	file, yes := "", false
 	for i := 0; i < len(args); i++ {
-		if args[i] == "--file" && i+1 < len(args) {
-			filePath = args[i+1]
-			i++
+		switch args[i] {
+		case "--file":
+			if i+1 < len(args) {
+				file = args[i+1]
+				i++
+			}
+		case "--yes", "-y":
+			yes = true
 		}
 	}
-	if filePath == "" {
-		fmt.Fprintln(os.Stderr, "usage: koor-cli restore --file <path>")
+	if file == "" {
+		fmt.Fprintln(os.Stderr, "usage: koor-cli admin restore --file <path> [--yes]")
 		os.Exit(1)
 	}
-
-	data, err := os.ReadFile(filePath)
+	f, err := os.Open(file)
 	if err != nil {
-		fatal(fmt.Errorf("read backup file: %w", err))
-	}
-
-	var backup struct {
-		State map[string]json.RawMessage `json:"state"`
-		Rules []json.RawMessage          `json:"rules"`
-	}
-	if err := json.Unmarshal(data, &backup); err != nil {
-		fatal(fmt.Errorf("invalid backup JSON: %w", err))
+		fatal(fmt.Errorf("open snapshot file: %w", err))
 	}
-
-	// Restore state.
-	stateCount := 0
-	for key, val := range backup.State {
-		resp, err := doRequest(cfg, "PUT", "/api/state/"+key, strings.NewReader(string(val)))
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "warning: could not restore state key %s: %v\n", key, err)
-			continue
+	defer f.Close()
+
+	if !yes {
+		fmt.Fprintf(os.Stderr, "This replaces ALL data on %s with the snapshot %s.\n", cfg.Server, file)
+		fmt.Fprint(os.Stderr, "Type \"restore\" to continue: ")
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if strings.TrimSpace(answer) != "restore" {
+			fmt.Fprintln(os.Stderr, "aborted")
+			os.Exit(1)
 		}
-		resp.Body.Close()
-		stateCount++
 	}
-
-	// Restore rules.
-	rulesCount := 0
-	if len(backup.Rules) > 0 {
-		rulesJSON, _ := json.Marshal(backup.Rules)
-		resp, err := doRequest(cfg, "POST", "/api/rules/import", strings.NewReader(string(rulesJSON)))
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "warning: could not restore rules: %v\n", err)
-		} else {
-			respData, _ := io.ReadAll(resp.Body)
-			resp.Body.Close()
-			var result struct {
-				Imported int `json:"imported"`
-			}
-			json.Unmarshal(respData, &result)
-			rulesCount = result.Imported
-		}
+	resp, err := doRequestWithHeaders(cfg, "POST", "/api/admin/restore", f, map[string]string{
+		"Content-Type": "application/octet-stream",
+	})
+	if err != nil {
+		fatal(err)
 	}
-
-	fmt.Printf("restore complete from %s\n", filePath)
-	fmt.Printf("  state keys: %d\n", stateCount)
-	fmt.Printf("  rules: %d\n", rulesCount)
+	defer resp.Body.Close()
+	printResponse(resp)
 }
 
 // --- LLM cost tracking commands ---
@@ -1694,6 +6418,11 @@ func handleLLM(cfg *config, args []string) {
 // --- HTTP client helpers ---
 
 func doRequest(cfg *config, method, path string, body io.Reader) (*http.Response, error) {
+	return doRequestWithHeaders(cfg, method, path, body, nil)
+}
+
+// doRequestWithHeaders is doRequest with extra request headers.
+func doRequestWithHeaders(cfg *config, method, path string, body io.Reader, headers map[string]string) (*http.Response, error) {
 	url := strings.TrimRight(cfg.Server, "/") + path
 	req, err := http.NewRequest(method, url, body)
 	if err != nil {
@@ -1705,6 +6434,9 @@ func doRequest(cfg *config, method, path string, body io.Reader) (*http.Response
 	if body != nil {
 		req.Header.Set("Content-Type", "application/json")
 	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("request failed: %w", err)
@@ -1718,6 +6450,23 @@ func printResponse(resp *http.Response) {
 		fmt.Fprintf(os.Stderr, "error reading response: %v\n", err)
 		os.Exit(1)
 	}
+	printData(data, resp.StatusCode < 400)
+}
+
+// printData prints a response body, or output the CLI put together
+// itself, honouring --pretty and the output format flags. Error bodies
+// (ok false) are printed as they are.
+func printData(data []byte, ok bool) {
+	if (outputFormat != "" || outputQuery != "") && ok {
+		out, isJSON, err := formatOutput(data)
+		if err != nil {
+			fatal(err)
+		}
+		if isJSON {
+			fmt.Print(out)
+			return
+		}
+	}
 
 	// Check if --pretty was passed anywhere in os.Args.
 	pretty := false
@@ -1758,6 +6507,160 @@ func readBodyArg(args []string) ([]byte, error) {
 	}
 }
 
+// applySets fills in payload fields from --set arguments. "key=value" sets
+// a string and "key:=json" sets a raw JSON value; dotted keys such as
+// "owner.name=Ann" create nested objects. An empty payload starts as {}.
+func applySets(body []byte, sets []string) ([]byte, error) {
+	payload := map[string]any{}
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return nil, fmt.Errorf("--set needs a JSON object payload: %w", err)
+		}
+	}
+	for _, set := range sets {
+		i := strings.Index(set, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid --set %q (expected key=value or key:=json)", set)
+		}
+		key, raw := set[:i], set[i+1:]
+		var value any = raw
+		if strings.HasSuffix(key, ":") {
+			key = strings.TrimSuffix(key, ":")
+			if err := json.Unmarshal([]byte(raw), &value); err != nil {
+				return nil, fmt.Errorf("invalid JSON in --set %q: %w", set, err)
+			}
+		}
+		parts := strings.Split(key, ".")
+		obj := payload
+		for _, part := range parts[:len(parts)-1] {
+			next, ok := obj[part].(map[string]any)
+			if !ok {
+				next = map[string]any{}
+				obj[part] = next
+			}
+			obj = next
+		}
+		obj[parts[len(parts)-1]] = value
+	}
+	return json.Marshal(payload)
+}
+
+// publishBatch publishes the events in an NDJSON file, one
+// {"topic": ..., "data": ...} object per line, in a single request. The
+// server stores all of them or none. "-" reads the file from stdin.
+func publishBatch(cfg *config, args []string) {
+	var file, signAs, keyFile string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--batch-file":
+			if i+1 < len(args) {
+				file = args[i+1]
+				i++
+			}
+		case "--sign-as":
+			if i+1 < len(args) {
+				signAs = args[i+1]
+				i++
+			}
+		case "--key-file":
+			if i+1 < len(args) {
+				keyFile = args[i+1]
+				i++
+			}
+		}
+	}
+	if file == "" {
+		fmt.Fprintln(os.Stderr, "usage: koor-cli events publish --batch-file <events.ndjson|-> [--sign-as <instance-id> --key-file <path>]")
+		os.Exit(1)
+	}
+	if (signAs == "") != (keyFile == "") {
+		fmt.Fprintln(os.Stderr, "--sign-as and --key-file must be used together")
+		os.Exit(1)
+	}
+
+	var in io.Reader = os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			fatal(err)
+		}
+		defer f.Close()
+		in = f
+	}
+	type batchEvent struct {
+		Topic     string          `json:"topic"`
+		Data      json.RawMessage `json:"data,omitempty"`
+		Signature string          `json:"signature,omitempty"`
+	}
+	var batch []batchEvent
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10<<20)
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		var ev batchEvent
+		if err := json.Unmarshal(text, &ev); err != nil {
+			fatal(fmt.Errorf("%s:%d: %w", file, line, err))
+		}
+		if ev.Topic == "" {
+			fatal(fmt.Errorf("%s:%d: topic is required", file, line))
+		}
+		if signAs != "" {
+			sig, err := signEvent(keyFile, ev.Topic, ev.Data)
+			if err != nil {
+				fatal(err)
+			}
+			ev.Signature = sig
+		}
+		batch = append(batch, ev)
+	}
+	if err := scanner.Err(); err != nil {
+		fatal(err)
+	}
+	if len(batch) == 0 {
+		fatal(fmt.Errorf("%s: no events", file))
+	}
+
+	var headers map[string]string
+	if signAs != "" {
+		headers = map[string]string{"X-Koor-Instance": signAs}
+	}
+	body, _ := json.Marshal(batch)
+	resp, err := doRequestWithHeaders(cfg, "POST", "/api/events/publish-batch", bytes.NewReader(body), headers)
+	if err != nil {
+		fatal(err)
+	}
+	defer resp.Body.Close()
+	printResponse(resp)
+}
+
+// signEvent signs topic + "\n" + data with the base64 Ed25519 private key
+// in keyFile, matching what koor-server verifies.
+func signEvent(keyFile, topic string, data []byte) (string, error) {
+	key, err := readSigningKey(keyFile)
+	if err != nil {
+		return "", err
+	}
+	msg := append([]byte(topic+"\n"), data...)
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(key, msg)), nil
+}
+
+// readSigningKey reads a base64 Ed25519 private key, such as the
+// private_key returned by register --signing.
+func readSigningKey(keyFile string) (ed25519.PrivateKey, error) {
+	raw, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("read key file %s: %w", keyFile, err)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(raw)))
+	if err != nil || len(key) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("key file %s does not contain a base64 Ed25519 private key", keyFile)
+	}
+	return ed25519.PrivateKey(key), nil
+}
+
 func parseSpecPath(s string) (project, name string) {
 	parts := strings.SplitN(s, "/", 2)
 	if len(parts) == 2 {
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v3"
+)
+
+// --- Output formats ---
+
+// outputFormat and outputQuery come from the global --output/-o and
+// --jsonpath/--query flags. With neither set, responses are printed as
+// the server sent them.
+var (
+	outputFormat string
+	outputQuery  string
+)
+
+var outputFormats = []string{"table", "json", "yaml"}
+
+// column is one table column: a header and the dotted field path of its
+// value in each row.
+type column struct {
+	Header string
+	Path   string
+}
+
+// tableLayouts are the table columns of list commands, keyed by command.
+// Other responses get columns from their fields.
+var tableLayouts = map[string][]column{
+	"instances list":  instanceColumns,
+	"instances stale": instanceColumns,
+	"state list": {
+		{"KEY", "key"}, {"VERSION", "version"}, {"CONTENT-TYPE", "content_type"},
+		{"OWNER", "meta.owner"}, {"UPDATED", "updated_at"},
+	},
+	"events history": eventColumns,
+	"events latest":  eventColumns,
+	"rules list": {
+		{"RULE", "rule_id"}, {"SEVERITY", "severity"}, {"STATUS", "status"},
+		{"SOURCE", "source"}, {"STACK", "stack"}, {"MESSAGE", "message"},
+	},
+	"rulepacks list": {
+		{"PROJECT", "project"}, {"NAME", "name"}, {"VERSION", "version"}, {"SIGNED-BY", "signed_by"},
+		{"RULES", "rules"}, {"INSTALLED", "installed_at"},
+	},
+	"templates list": {
+		{"ID", "id"}, {"NAME", "name"}, {"KIND", "kind"}, {"VERSION", "version"},
+		{"SOURCE", "source"}, {"TAGS", "tags"},
+	},
+	"audit": {
+		{"ID", "id"}, {"TIME", "timestamp"}, {"ACTOR", "actor"}, {"ACTION", "action"},
+		{"RESOURCE", "resource"}, {"OUTCOME", "outcome"},
+	},
+}
+
+var instanceColumns = []column{
+	{"ID", "id"}, {"NAME", "name"}, {"PROJECT", "project"}, {"STACK", "stack"},
+	{"STATUS", "status"}, {"LAST SEEN", "last_seen"},
+}
+
+var eventColumns = []column{
+	{"ID", "id"}, {"TOPIC", "topic"}, {"SOURCE", "source"}, {"CREATED", "created_at"}, {"DATA", "data"},
+}
+
+// parseOutputFlags takes the output flags out of os.Args, so commands
+// never see them. -o always names a format; --output only does when its
+// value is a format, since several commands use --output <path> for a file.
+func parseOutputFlags() error {
+	args := os.Args[:1]
+	for i := 1; i < len(os.Args); i++ {
+		arg := os.Args[i]
+		name, value, hasValue := strings.Cut(arg, "=")
+		next := func() (string, bool) {
+			if hasValue {
+				return value, true
+			}
+			if i+1 < len(os.Args) {
+				i++
+				return os.Args[i], true
+			}
+			return "", false
+		}
+		switch {
+		case name == "-o":
+			v, ok := next()
+			if !ok || !slices.Contains(outputFormats, v) {
+				return fmt.Errorf("-o must be one of %s", strings.Join(outputFormats, ", "))
+			}
+			outputFormat = v
+		case name == "--output" && (hasValue && slices.Contains(outputFormats, value) ||
+			!hasValue && i+1 < len(os.Args) && slices.Contains(outputFormats, os.Args[i+1])):
+			outputFormat, _ = next()
+		case name == "--jsonpath" || name == "--query":
+			v, ok := next()
+			if !ok || v == "" {
+				return fmt.Errorf("%s needs an expression, e.g. '.items[0].name'", name)
+			}
+			outputQuery = v
+		default:
+			args = append(args, arg)
+		}
+	}
+	os.Args = args
+	return nil
+}
+
+// formatOutput renders a JSON response in the selected format. ok is
+// false if data is not JSON, so it should be printed as it is.
+func formatOutput(data []byte) (out string, ok bool, err error) {
+	var v any
+	if json.Unmarshal(data, &v) != nil {
+		return "", false, nil
+	}
+	if outputQuery != "" {
+		if v, err = queryJSON(v, outputQuery); err != nil {
+			return "", true, err
+		}
+		// A selected scalar prints bare, so it can be used in scripts.
+		if outputFormat == "" {
+			switch v := v.(type) {
+			case string:
+				return v + "\n", true, nil
+			case float64, bool:
+				return cell(v) + "\n", true, nil
+			}
+		}
+	}
+
+	switch outputFormat {
+	case "table":
+		// A query changes the shape, so the command's layout no longer fits.
+		var cols []column
+		if outputQuery == "" {
+			cols = tableLayouts[commandKey()]
+		}
+		return renderTable(v, cols), true, nil
+	case "yaml":
+		b, err := yaml.Marshal(v)
+		return string(b), true, err
+	default:
+		b, err := json.MarshalIndent(v, "", "  ")
+		return string(b) + "\n", true, err
+	}
+}
+
+// commandKey names the running command, e.g. "instances list", for
+// looking up its table layout.
+func commandKey() string {
+	if len(os.Args) < 2 {
+		return ""
+	}
+	if len(os.Args) > 2 && !strings.HasPrefix(os.Args[2], "-") {
+		key := os.Args[1] + " " + os.Args[2]
+		if _, ok := tableLayouts[key]; ok {
+			return key
+		}
+	}
+	return os.Args[1]
+}
+
+// queryJSON selects part of a JSON value with a JSONPath-like expression:
+// ".field", "[n]" (negative counts from the end) and "[*]", optionally
+// wrapped as "{$.items[*].name}". A field applied to an array selects it
+// from every element.
+func queryJSON(v any, expr string) (any, error) {
+	path := strings.TrimSpace(expr)
+	path = strings.TrimSuffix(strings.TrimPrefix(path, "{"), "}")
+	path = strings.TrimPrefix(path, "$")
+
+	for path != "" {
+		switch {
+		case path[0] == '.':
+			path = path[1:]
+			end := strings.IndexAny(path, ".[")
+			if end < 0 {
+				end = len(path)
+			}
+			field := path[:end]
+			path = path[end:]
+			if field == "" || field == "*" {
+				continue
+			}
+			v = selectField(v, field)
+		case path[0] == '[':
+			end := strings.IndexByte(path, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid jsonpath %q: missing ]", expr)
+			}
+			index := path[1:end]
+			path = path[end+1:]
+			list, ok := v.([]any)
+			if !ok {
+				return nil, fmt.Errorf("jsonpath %q: [%s] applied to a non-array", expr, index)
+			}
+			if index == "*" {
+				continue
+			}
+			n, err := strconv.Atoi(index)
+			if err != nil {
+				return nil, fmt.Errorf("invalid jsonpath %q: bad index %q", expr, index)
+			}
+			if n < 0 {
+				n += len(list)
+			}
+			if n < 0 || n >= len(list) {
+				return nil, fmt.Errorf("jsonpath %q: index %s out of range (%d items)", expr, index, len(list))
+			}
+			v = list[n]
+		default:
+			return nil, fmt.Errorf("invalid jsonpath %q: expected . or [ at %q", expr, path)
+		}
+	}
+	return v, nil
+}
+
+// selectField returns an object's field, or the field of every element
+// of an array.
+func selectField(v any, field string) any {
+	switch v := v.(type) {
+	case map[string]any:
+		return v[field]
+	case []any:
+		out := []any{}
+		for _, item := range v {
+			if f := selectField(item, field); f != nil {
+				out = append(out, f)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// renderTable lays out an array of objects as rows, using cols or, if
+// there are none, the scalar fields of the rows. With cols, an object
+// wrapping a single list (e.g. {"project": ..., "rules": [...]}) is shown
+// as that list. Other objects are shown as FIELD/VALUE pairs and a scalar
+// as itself.
+func renderTable(v any, cols []column) string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+
+	if obj, ok := v.(map[string]any); ok && cols != nil {
+		var lists []any
+		for _, field := range obj {
+			if list, ok := field.([]any); ok {
+				lists = append(lists, list)
+			}
+		}
+		if len(lists) == 1 {
+			v = lists[0]
+		}
+	}
+
+	switch v := v.(type) {
+	case []any:
+		if len(v) == 0 {
+			return "No results.\n"
+		}
+		if cols == nil {
+			cols = inferColumns(v)
+		}
+		if cols == nil {
+			// Not objects: one value per line.
+			for _, item := range v {
+				fmt.Fprintln(w, cell(item))
+			}
+			break
+		}
+		headers := make([]string, len(cols))
+		for i, c := range cols {
+			headers[i] = c.Header
+		}
+		fmt.Fprintln(w, strings.Join(headers, "\t"))
+		for _, item := range v {
+			row := make([]string, len(cols))
+			for i, c := range cols {
+				row[i] = cell(lookupPath(item, c.Path))
+			}
+			fmt.Fprintln(w, strings.Join(row, "\t"))
+		}
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		fmt.Fprintln(w, "FIELD\tVALUE")
+		for _, k := range keys {
+			fmt.Fprintf(w, "%s\t%s\n", k, cell(v[k]))
+		}
+	default:
+		fmt.Fprintln(w, cell(v))
+	}
+	w.Flush()
+	return b.String()
+}
+
+// inferColumns picks the scalar fields of the first row, in name order,
+// with "id" and "name" first.
+func inferColumns(rows []any) []column {
+	first, ok := rows[0].(map[string]any)
+	if !ok {
+		return nil
+	}
+	var names []string
+	for k, val := range first {
+		switch val.(type) {
+		case map[string]any:
+			continue
+		case []any:
+			if !scalarList(val.([]any)) {
+				continue
+			}
+		}
+		names = append(names, k)
+	}
+	rank := func(k string) int {
+		switch k {
+		case "id":
+			return 0
+		case "name":
+			return 1
+		}
+		return 2
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if rank(names[i]) != rank(names[j]) {
+			return rank(names[i]) < rank(names[j])
+		}
+		return names[i] < names[j]
+	})
+	cols := make([]column, len(names))
+	for i, k := range names {
+		cols[i] = column{Header: strings.ToUpper(strings.ReplaceAll(k, "_", "-")), Path: k}
+	}
+	return cols
+}
+
+// lookupPath follows a dotted field path through nested objects.
+func lookupPath(v any, path string) any {
+	for _, field := range strings.Split(path, ".") {
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		v = obj[field]
+	}
+	return v
+}
+
+// cell formats a value for a table cell: lists of scalars are joined with
+// commas and nested values are shown as compact JSON, shortened to fit.
+func cell(v any) string {
+	var s string
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		s = v
+	case float64:
+		s = strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		s = strconv.FormatBool(v)
+	case []any:
+		if scalarList(v) {
+			parts := make([]string, len(v))
+			for i, item := range v {
+				parts[i] = cell(item)
+			}
+			s = strings.Join(parts, ",")
+			break
+		}
+		s = compactJSON(v)
+	default:
+		s = compactJSON(v)
+	}
+	s = strings.ReplaceAll(s, "\n", " ")
+	if r := []rune(s); len(r) > 60 {
+		s = string(r[:57]) + "..."
+	}
+	return s
+}
+
+func scalarList(list []any) bool {
+	for _, item := range list {
+		switch item.(type) {
+		case map[string]any, []any:
+			return false
+		}
+	}
+	return true
+}
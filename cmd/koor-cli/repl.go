@@ -0,0 +1,335 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/x/term"
+)
+
+// --- REPL ---
+
+// handleREPL reads commands interactively and runs each as koor-cli with
+// the configuration loaded at start. Commands run as child processes, so
+// one that fails does not end the session. On a terminal the line editor
+// keeps history (up/down) and completes commands, flags, state keys and
+// instance IDs with Tab.
+func handleREPL(cfg *config) {
+	self, err := os.Executable()
+	if err != nil {
+		fatal(err)
+	}
+	env := append(os.Environ(), "KOOR_SERVER="+cfg.Server, "KOOR_TOKEN="+cfg.Token)
+
+	// Ctrl-C interrupts the running command, not the REPL.
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	defer signal.Stop(sig)
+	go func() {
+		for range sig {
+		}
+	}()
+
+	var ed *lineEditor
+	var lines *bufio.Scanner
+	if term.IsTerminal(os.Stdin.Fd()) {
+		ed = &lineEditor{in: bufio.NewReader(os.Stdin), prompt: "koor> ", complete: func(words []string) []string {
+			return completeWords(cfg, words)
+		}}
+		fmt.Fprintf(os.Stderr, "koor-cli REPL on %s. Type help for commands, exit to quit.\n", cfg.Server)
+	} else {
+		lines = bufio.NewScanner(os.Stdin)
+	}
+
+	var history []string
+	for {
+		var line string
+		if ed != nil {
+			ed.history = history
+			line, err = ed.readLine()
+		} else if lines.Scan() {
+			line = lines.Text()
+		} else {
+			err = io.EOF
+		}
+		if err != nil {
+			if ed != nil {
+				fmt.Println()
+			}
+			return
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if len(history) == 0 || history[len(history)-1] != line {
+			history = append(history, line)
+		}
+
+		args, err := splitCommandLine(line)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			continue
+		}
+		if args[0] == "koor-cli" {
+			args = args[1:]
+		}
+		switch args[0] {
+		case "exit", "quit":
+			return
+		case "help":
+			if len(args) == 1 {
+				fmt.Fprintln(os.Stderr, usage)
+				fmt.Fprintln(os.Stderr, "\nREPL:\n  history                        List this session's commands\n  exit, quit                     Leave the REPL")
+				continue
+			}
+		case "history":
+			for i, h := range history {
+				fmt.Printf("%4d  %s\n", i+1, h)
+			}
+			continue
+		case "repl":
+			fmt.Fprintln(os.Stderr, "already in the REPL")
+			continue
+		}
+
+		out := &lineTracker{w: os.Stdout}
+		cmd := exec.Command(self, args...)
+		cmd.Stdin, cmd.Stdout, cmd.Stderr, cmd.Env = os.Stdin, out, os.Stderr, env
+		if err := cmd.Run(); err != nil {
+			var exit *exec.ExitError
+			if !errors.As(err, &exit) {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			}
+		}
+		if out.last != 0 && out.last != '\n' {
+			fmt.Println() // start the prompt on a fresh line
+		}
+	}
+}
+
+// lineTracker passes output through and remembers its last byte.
+type lineTracker struct {
+	w    io.Writer
+	last byte
+}
+
+func (t *lineTracker) Write(p []byte) (int, error) {
+	if len(p) > 0 {
+		t.last = p[len(p)-1]
+	}
+	return t.w.Write(p)
+}
+
+// splitCommandLine splits a line into words like a shell would for simple
+// input: whitespace separates words, single and double quotes group them,
+// and a backslash escapes the next character outside single quotes.
+func splitCommandLine(line string) ([]string, error) {
+	var words []string
+	var cur strings.Builder
+	inWord := false
+	var quote rune
+	escaped := false
+	for _, r := range line {
+		switch {
+		case escaped:
+			cur.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped, inWord = true, true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				cur.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t':
+			if inWord {
+				words = append(words, cur.String())
+				cur.Reset()
+				inWord = false
+			}
+		default:
+			cur.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inWord {
+		words = append(words, cur.String())
+	}
+	if len(words) == 0 {
+		return nil, fmt.Errorf("empty command")
+	}
+	return words, nil
+}
+
+// lineEditor reads one line at a time from a terminal in raw mode, with
+// cursor movement, history and Tab completion.
+type lineEditor struct {
+	in       *bufio.Reader
+	prompt   string
+	history  []string
+	complete func(words []string) []string
+
+	buf []rune
+	pos int
+}
+
+// readLine returns the next line, or io.EOF on Ctrl-D at an empty prompt.
+// Ctrl-C discards the line being typed.
+func (e *lineEditor) readLine() (string, error) {
+	state, err := term.MakeRaw(os.Stdin.Fd())
+	if err != nil {
+		return "", err
+	}
+	defer term.Restore(os.Stdin.Fd(), state)
+
+	e.buf, e.pos = nil, 0
+	hist := len(e.history)
+	draft := ""
+	e.redraw()
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		switch r {
+		case '\r', '\n':
+			fmt.Print("\r\n")
+			return string(e.buf), nil
+		case 3: // Ctrl-C
+			fmt.Print("^C\r\n")
+			e.buf, e.pos = nil, 0
+			hist = len(e.history)
+			e.redraw()
+		case 4: // Ctrl-D
+			if len(e.buf) == 0 {
+				return "", io.EOF
+			}
+		case 1: // Ctrl-A
+			e.pos = 0
+			e.redraw()
+		case 5: // Ctrl-E
+			e.pos = len(e.buf)
+			e.redraw()
+		case 21: // Ctrl-U
+			e.buf, e.pos = e.buf[e.pos:], 0
+			e.redraw()
+		case 127, 8: // Backspace
+			if e.pos > 0 {
+				e.buf = append(e.buf[:e.pos-1], e.buf[e.pos:]...)
+				e.pos--
+				e.redraw()
+			}
+		case '\t':
+			e.completeWord()
+		case 27: // escape sequence
+			if b, _ := e.in.ReadByte(); b != '[' && b != 'O' {
+				continue
+			}
+			switch b, _ := e.in.ReadByte(); b {
+			case 'A', 'B':
+				if hist == len(e.history) {
+					draft = string(e.buf)
+				}
+				if b == 'A' && hist > 0 {
+					hist--
+				} else if b == 'B' && hist < len(e.history) {
+					hist++
+				}
+				line := draft
+				if hist < len(e.history) {
+					line = e.history[hist]
+				}
+				e.buf = []rune(line)
+				e.pos = len(e.buf)
+			case 'C':
+				e.pos = min(e.pos+1, len(e.buf))
+			case 'D':
+				e.pos = max(e.pos-1, 0)
+			case 'H':
+				e.pos = 0
+			case 'F':
+				e.pos = len(e.buf)
+			case '3': // Delete: ESC [ 3 ~
+				e.in.ReadByte()
+				if e.pos < len(e.buf) {
+					e.buf = append(e.buf[:e.pos], e.buf[e.pos+1:]...)
+				}
+			}
+			e.redraw()
+		default:
+			if r < 32 || r == utf8.RuneError {
+				continue
+			}
+			e.buf = append(e.buf[:e.pos], append([]rune{r}, e.buf[e.pos:]...)...)
+			e.pos++
+			e.redraw()
+		}
+	}
+}
+
+// redraw rewrites the prompt line and puts the cursor back in place.
+func (e *lineEditor) redraw() {
+	fmt.Printf("\r\x1b[K%s%s", e.prompt, string(e.buf))
+	if back := len(e.buf) - e.pos; back > 0 {
+		fmt.Printf("\x1b[%dD", back)
+	}
+}
+
+// completeWord completes the word before the cursor: a single candidate
+// is inserted, several are extended to their common prefix, or listed
+// when they have none.
+func (e *lineEditor) completeWord() {
+	before := string(e.buf[:e.pos])
+	words := strings.Fields(before)
+	prefix := ""
+	if len(words) > 0 && !strings.HasSuffix(before, " ") {
+		prefix = words[len(words)-1]
+		words = words[:len(words)-1]
+	}
+	if len(words) > 0 && words[0] == "koor-cli" {
+		words = words[1:]
+	}
+	var matches []string
+	for _, c := range e.complete(words) {
+		if strings.HasPrefix(c, prefix) {
+			matches = append(matches, c)
+		}
+	}
+	if len(matches) == 0 {
+		return
+	}
+	insert := commonPrefix(matches)[len(prefix):]
+	if len(matches) == 1 {
+		insert += " "
+	} else if insert == "" {
+		fmt.Print("\r\n" + strings.Join(matches, "  ") + "\r\n")
+	}
+	ins := []rune(insert)
+	e.buf = append(e.buf[:e.pos], append(ins, e.buf[e.pos:]...)...)
+	e.pos += len(ins)
+	e.redraw()
+}
+
+func commonPrefix(words []string) string {
+	p := words[0]
+	for _, w := range words[1:] {
+		for !strings.HasPrefix(w, p) {
+			p = p[:len(p)-1]
+		}
+	}
+	return p
+}
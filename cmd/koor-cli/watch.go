@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+// --- State watch ---
+
+// stateVersion is one version of a watched key, printed as a JSON line.
+type stateVersion struct {
+	Key     string          `json:"key"`
+	Version int64           `json:"version"`
+	Deleted bool            `json:"deleted,omitempty"`
+	Value   json.RawMessage `json:"value,omitempty"`
+	raw     []byte
+}
+
+// watchState prints a state key's current value, then each new version as
+// it arrives, one JSON line per version. By default it polls the key,
+// sending its ETag so an unchanged key costs a 304. With --events it
+// follows state.changed events instead, which reports every write, even
+// one that leaves the value unchanged, but needs the server to publish
+// them (--change-events). --exec runs a command after each change.
+func watchState(cfg *config, args []string) {
+	if len(args) < 1 || args[0] == "" || args[0][0] == '-' {
+		fmt.Fprintln(os.Stderr, "usage: koor-cli state watch <key> [--interval 2s] [--events] [--exec <cmd>]")
+		os.Exit(1)
+	}
+	key := args[0]
+	interval := 2 * time.Second
+	useEvents := false
+	command := ""
+	for i := 1; i < len(args); i++ {
+		switch args[i] {
+		case "--interval":
+			if i+1 < len(args) {
+				d, err := time.ParseDuration(args[i+1])
+				if err != nil || d <= 0 {
+					fatal(fmt.Errorf("invalid --interval %q", args[i+1]))
+				}
+				interval = d
+				i++
+			}
+		case "--events":
+			useEvents = true
+		case "--exec":
+			if i+1 < len(args) {
+				command = args[i+1]
+				i++
+			}
+		}
+	}
+
+	current, etag, err := fetchStateVersion(cfg, key, "", 0)
+	if err != nil {
+		fatal(err)
+	}
+	emit := func(v *stateVersion, changed bool) {
+		line, _ := json.Marshal(v)
+		fmt.Println(string(line))
+		if changed && command != "" {
+			runOnChange(command, v)
+		}
+	}
+	emit(current, false)
+
+	if useEvents {
+		watchStateEvents(cfg, key, interval, current, emit)
+		return
+	}
+	for {
+		time.Sleep(interval)
+		next, nextTag, err := fetchStateVersion(cfg, key, etag, 0)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "poll error: %v\n", err)
+			continue
+		}
+		if next == nil || next.Deleted && current.Deleted {
+			continue // unchanged
+		}
+		current, etag = next, nextTag
+		emit(current, true)
+	}
+}
+
+// watchStateEvents follows state.changed events for key from the newest
+// event on, fetching each version they announce.
+func watchStateEvents(cfg *config, key string, interval time.Duration, current *stateVersion, emit func(*stateVersion, bool)) {
+	fmt.Fprintln(os.Stderr, "following state.changed events; the server must publish them for this key (--change-events)")
+	getJSON := func(path string, v any) error {
+		resp, err := doRequest(cfg, "GET", path, nil)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("status %d: %s", resp.StatusCode, data)
+		}
+		return json.Unmarshal(data, v)
+	}
+
+	var latest []struct {
+		ID int64 `json:"id"`
+	}
+	if err := getJSON("/api/events/history?last=1", &latest); err != nil {
+		fatal(err)
+	}
+	var cursor int64
+	if len(latest) > 0 {
+		cursor = latest[0].ID
+	}
+	for {
+		var page struct {
+			Events []struct {
+				Data struct {
+					Op         string `json:"op"`
+					Key        string `json:"key"`
+					NewVersion int64  `json:"new_version"`
+				} `json:"data"`
+			} `json:"events"`
+			HasMore bool  `json:"has_more"`
+			Cursor  int64 `json:"cursor"`
+		}
+		path := fmt.Sprintf("/api/events/history?after_id=%d&topic=state.changed&limit=100", cursor)
+		if err := getJSON(path, &page); err != nil {
+			fmt.Fprintf(os.Stderr, "poll error: %v\n", err)
+			time.Sleep(interval)
+			continue
+		}
+		for _, ev := range page.Events {
+			if ev.Data.Key != key ||
+				ev.Data.Op == "delete" && current.Deleted ||
+				ev.Data.Op != "delete" && ev.Data.NewVersion <= current.Version {
+				continue // another key, or a version already printed
+			}
+			next := &stateVersion{Key: key, Deleted: true}
+			if ev.Data.Op != "delete" {
+				v, _, err := fetchStateVersion(cfg, key, "", ev.Data.NewVersion)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "fetch error: %v\n", err)
+					continue
+				}
+				next = v
+			}
+			current = next
+			emit(current, true)
+		}
+		cursor = page.Cursor
+		if !page.HasMore {
+			time.Sleep(interval)
+		}
+	}
+}
+
+// fetchStateVersion reads a key, or one version of it. With etag it
+// returns nil if the value has not changed. A missing key is returned as
+// deleted.
+func fetchStateVersion(cfg *config, key, etag string, version int64) (*stateVersion, string, error) {
+	path := "/api/state/" + key
+	if version > 0 {
+		path += "?version=" + strconv.FormatInt(version, 10)
+	}
+	var headers map[string]string
+	if etag != "" {
+		headers = map[string]string{"If-None-Match": etag}
+	}
+	resp, err := doRequestWithHeaders(cfg, "GET", path, nil, headers)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return nil, etag, nil
+	case http.StatusNotFound:
+		return &stateVersion{Key: key, Deleted: true}, "", nil
+	case http.StatusOK:
+	default:
+		return nil, "", fmt.Errorf("status %d: %s", resp.StatusCode, data)
+	}
+	v := &stateVersion{Key: key, raw: data}
+	v.Version, _ = strconv.ParseInt(resp.Header.Get("X-Koor-Version"), 10, 64)
+	if json.Valid(data) {
+		v.Value = data
+	} else {
+		v.Value, _ = json.Marshal(string(data))
+	}
+	return v, resp.Header.Get("ETag"), nil
+}
+
+// runOnChange runs command through the shell with the new value on stdin
+// and the key and version in KOOR_KEY, KOOR_VERSION and KOOR_DELETED. A
+// failing command is reported but does not stop the watch.
+func runOnChange(command string, v *stateVersion) {
+	shell, flag := "sh", "-c"
+	if runtime.GOOS == "windows" {
+		shell, flag = "cmd", "/C"
+	}
+	cmd := exec.Command(shell, flag, command)
+	cmd.Env = append(os.Environ(),
+		"KOOR_KEY="+v.Key,
+		"KOOR_VERSION="+strconv.FormatInt(v.Version, 10),
+		"KOOR_DELETED="+strconv.FormatBool(v.Deleted),
+	)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	if len(v.raw) > 0 {
+		cmd.Stdin = bytes.NewReader(v.raw)
+	}
+	if err := cmd.Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "--exec: %v\n", err)
+	}
+}
@@ -2,38 +2,76 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
 	"encoding/json"
 	"flag"
+	"fmt"
 	"log/slog"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
 	"time"
 
 	"github.com/DavidRHerbert/koor/internal/audit"
 	"github.com/DavidRHerbert/koor/internal/compliance"
+	"github.com/DavidRHerbert/koor/internal/contracts"
 	"github.com/DavidRHerbert/koor/internal/db"
+	"github.com/DavidRHerbert/koor/internal/encryption"
 	"github.com/DavidRHerbert/koor/internal/events"
+	"github.com/DavidRHerbert/koor/internal/federation"
 	"github.com/DavidRHerbert/koor/internal/instances"
 	"github.com/DavidRHerbert/koor/internal/liveness"
 	"github.com/DavidRHerbert/koor/internal/llmcost"
 	koormcp "github.com/DavidRHerbert/koor/internal/mcp"
+	"github.com/DavidRHerbert/koor/internal/messages"
+	"github.com/DavidRHerbert/koor/internal/milestones"
 	"github.com/DavidRHerbert/koor/internal/server"
 	"github.com/DavidRHerbert/koor/internal/server/serverconfig"
 	"github.com/DavidRHerbert/koor/internal/observability"
+	"github.com/DavidRHerbert/koor/internal/orphans"
+	"github.com/DavidRHerbert/koor/internal/policy"
+	"github.com/DavidRHerbert/koor/internal/projections"
+	"github.com/DavidRHerbert/koor/internal/projects"
+	"github.com/DavidRHerbert/koor/internal/replication"
+	"github.com/DavidRHerbert/koor/internal/rulepacks"
+	"github.com/DavidRHerbert/koor/internal/schedules"
+	"github.com/DavidRHerbert/koor/internal/search"
 	"github.com/DavidRHerbert/koor/internal/specs"
 	"github.com/DavidRHerbert/koor/internal/state"
+	"github.com/DavidRHerbert/koor/internal/tasks"
 	"github.com/DavidRHerbert/koor/internal/templates"
+	"github.com/DavidRHerbert/koor/internal/tenants"
+	"github.com/DavidRHerbert/koor/internal/tokens"
+	"github.com/DavidRHerbert/koor/internal/users"
 	"github.com/DavidRHerbert/koor/internal/webhooks"
 )
 
 // fileConfig mirrors the JSON structure in settings.json.
 type fileConfig struct {
-	Bind          string `json:"bind"`
-	DashboardBind string `json:"dashboard_bind"`
-	DataDir       string `json:"data_dir"`
-	AuthToken     string `json:"auth_token"`
-	LogLevel      string `json:"log_level"`
+	Bind              string `json:"bind"`
+	DashboardBind     string `json:"dashboard_bind"`
+	DataDir           string `json:"data_dir"`
+	AuthToken         string `json:"auth_token"`
+	LogLevel          string `json:"log_level"`
+	ChangeEvents      string `json:"change_events"`
+	ReplicateFrom     string `json:"replicate_from"`
+	ReplicateInterval string `json:"replicate_interval"`
+	FederateFrom      string `json:"federate_from"`
+	FederateInterval  string `json:"federate_interval"`
+	StatusBind        string `json:"status_bind"`
+	StatusProjects    string `json:"status_projects"`
+	StatusExpose      string `json:"status_expose"`
+	AuditRetention    string `json:"audit_retention"`
+	EncryptionKeyFile string `json:"encryption_key_file"`
+	MCPStateResources string `json:"mcp_state_resources"`
+
+	RequireSignedEvents bool `json:"require_signed_events"`
+	MCPDataTools        bool `json:"mcp_data_tools"`
+	StrictJSON          bool `json:"strict_json"`
+	Tenants             bool `json:"tenants"`
 }
 
 func main() {
@@ -48,6 +86,23 @@ func main() {
 	dataDir := flag.String("data-dir", fc.DataDir, "SQLite database directory (default: current directory)")
 	authToken := flag.String("auth-token", fc.AuthToken, "bearer token (empty = no auth)")
 	logLevel := flag.String("log-level", fc.LogLevel, "log level: debug|info|warn|error")
+	changeEvents := flag.String("change-events", fc.ChangeEvents, "publish state.changed/spec.changed for these prefixes, e.g. \"state:config/,specs:*\" or \"*\" (empty = disabled)")
+	replicateFrom := flag.String("replicate-from", fc.ReplicateFrom, "run as a read-only replica of the primary at this URL (empty = primary)")
+	replicateInterval := flag.String("replicate-interval", fc.ReplicateInterval, "how often a replica pulls a snapshot from the primary")
+	replicateToken := flag.String("replicate-token", "", "bearer token for the primary (default: --auth-token)")
+	federateFrom := flag.String("federate-from", fc.FederateFrom, "pull shared rules and templates from the koor server at this URL (empty = disabled)")
+	federateInterval := flag.String("federate-interval", fc.FederateInterval, "how often to pull the upstream federation pack")
+	federateToken := flag.String("federate-token", "", "bearer token for the upstream server")
+	requireSigned := flag.Bool("require-signed-events", fc.RequireSignedEvents, "reject events not signed by a registered instance key")
+	mcpDataTools := flag.Bool("mcp-data-tools", fc.MCPDataTools, "offer publish_event, get_state and set_state MCP tools to agents that cannot use REST")
+	mcpStateResources := flag.String("mcp-state-resources", fc.MCPStateResources, "state key prefixes MCP clients can read as resources, e.g. \"config/,Truck-Wash/\" or \"*\" (empty = none)")
+	strictJSON := flag.Bool("strict-json", fc.StrictJSON, "reject unknown request body fields and report invalid bodies as 422 with the offending fields")
+	multiTenant := flag.Bool("tenants", fc.Tenants, "host several tenants, each with its own database under data-dir/tenants, managed at /api/admin/tenants")
+	statusBind := flag.String("status-bind", fc.StatusBind, "public read-only status page listen address (empty = disabled)")
+	statusProjects := flag.String("status-projects", fc.StatusProjects, "comma-separated projects shown on the status page")
+	statusExpose := flag.String("status-expose", fc.StatusExpose, "comma-separated status page sections: agents,milestones,last_event")
+	auditRetention := flag.String("audit-retention", fc.AuditRetention, "delete audit entries older than this, e.g. \"90d\" (empty = keep forever)")
+	encryptionKeyFile := flag.String("encryption-key-file", fc.EncryptionKeyFile, "file of base64 AES-256 keys, current key first, to encrypt state values and specs at rest (empty = disabled)")
 	configFile := flag.String("config", "", "path to config file (default: ./settings.json)")
 	flag.Parse()
 
@@ -55,7 +110,7 @@ func main() {
 	if *configFile != "" {
 		fc = loadConfigFileFrom(*configFile, defaultDataDir)
 		// Re-apply file values for any flags not explicitly set on CLI.
-		applyFileDefaults(fc, bind, dashBind, dataDir, authToken, logLevel)
+		applyFileDefaults(fc, bind, dashBind, dataDir, authToken, logLevel, changeEvents, replicateFrom, replicateInterval, federateFrom, federateInterval, requireSigned, mcpDataTools, strictJSON, multiTenant, statusBind, statusProjects, statusExpose, auditRetention, encryptionKeyFile, mcpStateResources)
 	}
 
 	// 3. Environment variables override config file + flag defaults.
@@ -74,6 +129,57 @@ func main() {
 	if v := os.Getenv("KOOR_LOG_LEVEL"); v != "" {
 		*logLevel = v
 	}
+	if v := os.Getenv("KOOR_CHANGE_EVENTS"); v != "" {
+		*changeEvents = v
+	}
+	if v := os.Getenv("KOOR_REPLICATE_FROM"); v != "" {
+		*replicateFrom = v
+	}
+	if v := os.Getenv("KOOR_REPLICATE_INTERVAL"); v != "" {
+		*replicateInterval = v
+	}
+	if v := os.Getenv("KOOR_REPLICATE_TOKEN"); v != "" {
+		*replicateToken = v
+	}
+	if v := os.Getenv("KOOR_FEDERATE_FROM"); v != "" {
+		*federateFrom = v
+	}
+	if v := os.Getenv("KOOR_FEDERATE_INTERVAL"); v != "" {
+		*federateInterval = v
+	}
+	if v := os.Getenv("KOOR_FEDERATE_TOKEN"); v != "" {
+		*federateToken = v
+	}
+	if v := os.Getenv("KOOR_REQUIRE_SIGNED_EVENTS"); v != "" {
+		*requireSigned = v == "1" || v == "true"
+	}
+	if v := os.Getenv("KOOR_MCP_DATA_TOOLS"); v != "" {
+		*mcpDataTools = v == "1" || v == "true"
+	}
+	if v := os.Getenv("KOOR_MCP_STATE_RESOURCES"); v != "" {
+		*mcpStateResources = v
+	}
+	if v := os.Getenv("KOOR_STRICT_JSON"); v != "" {
+		*strictJSON = v == "1" || v == "true"
+	}
+	if v := os.Getenv("KOOR_TENANTS"); v != "" {
+		*multiTenant = v == "1" || v == "true"
+	}
+	if v := os.Getenv("KOOR_STATUS_BIND"); v != "" {
+		*statusBind = v
+	}
+	if v := os.Getenv("KOOR_STATUS_PROJECTS"); v != "" {
+		*statusProjects = v
+	}
+	if v := os.Getenv("KOOR_STATUS_EXPOSE"); v != "" {
+		*statusExpose = v
+	}
+	if v := os.Getenv("KOOR_AUDIT_RETENTION"); v != "" {
+		*auditRetention = v
+	}
+	if v := os.Getenv("KOOR_ENCRYPTION_KEY_FILE"); v != "" {
+		*encryptionKeyFile = v
+	}
 
 	// 4. CLI flags (if explicitly set) win over everything — already handled
 	//    by flag.Parse() above since explicitly-set flags overwrite the pointer.
@@ -83,83 +189,381 @@ func main() {
 	level.UnmarshalText([]byte(*logLevel))
 	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
 
-	// Open database.
-	database, err := db.Open(*dataDir)
+	// Encryption at rest: keys come from KOOR_ENCRYPTION_KEY, which is
+	// never a flag or config value so it stays out of process listings
+	// and settings files, or from a key file.
+	var keyring *encryption.Keyring
+	var err error
+	switch {
+	case os.Getenv("KOOR_ENCRYPTION_KEY") != "":
+		keyring, err = encryption.ParseKeys(os.Getenv("KOOR_ENCRYPTION_KEY"))
+	case *encryptionKeyFile != "":
+		keyring, err = encryption.LoadKeyFile(*encryptionKeyFile)
+	}
+	if err != nil {
+		logger.Error("invalid encryption key", "error", err)
+		os.Exit(1)
+	}
+
+	// Create server.
+	cfg := server.Config{
+		Bind:          *bind,
+		DashboardBind: *dashBind,
+		DataDir:       *dataDir,
+		AuthToken:     *authToken,
+		ChangeEvents:  *changeEvents,
+		MCPDataTools:  *mcpDataTools,
+
+		MCPStateResources: *mcpStateResources,
+
+		StatusBind:     *statusBind,
+		StatusProjects: *statusProjects,
+		StatusExpose:   *statusExpose,
+
+		RequireSignedEvents: *requireSigned,
+		StrictJSON:          *strictJSON,
+	}
+	if _, err := server.ParseStatusExpose(*statusExpose); err != nil {
+		logger.Error("invalid status-expose", "value", *statusExpose, "error", err)
+		os.Exit(1)
+	}
+	retention, err := audit.ParseRetention(*auditRetention)
+	if err != nil {
+		logger.Error("invalid audit-retention", "value", *auditRetention, "error", err)
+		os.Exit(1)
+	}
+	opts := stackOptions{
+		cfg:       cfg,
+		dataDir:   *dataDir,
+		keyring:   keyring,
+		retention: retention,
+	}
+
+	// A replica only serves reads; background writers run on the primary.
+	replica := *replicateFrom != ""
+	if replica {
+		interval, err := time.ParseDuration(*replicateInterval)
+		if err != nil {
+			logger.Error("invalid replicate-interval", "value", *replicateInterval, "error", err)
+			os.Exit(1)
+		}
+		opts.replicateFrom, opts.replicateInterval = *replicateFrom, interval
+		opts.replicateToken = *replicateToken
+		if opts.replicateToken == "" {
+			opts.replicateToken = *authToken
+		}
+	}
+
+	// Pull shared rules and templates from an upstream server. A replica
+	// gets them from its primary instead.
+	if *federateFrom != "" && !replica {
+		interval, err := time.ParseDuration(*federateInterval)
+		if err != nil {
+			logger.Error("invalid federate-interval", "value", *federateInterval, "error", err)
+			os.Exit(1)
+		}
+		opts.federateFrom, opts.federateInterval, opts.federateToken = *federateFrom, interval, *federateToken
+	}
+
+	host, err := startStack(opts, logger)
 	if err != nil {
 		logger.Error("failed to open database", "error", err)
 		os.Exit(1)
 	}
-	defer database.Close()
+	defer host.Close()
+	if !replica {
+		seedAdmin(host.users, *dataDir, logger)
+	}
+	srv := host.srv
+
+	// Host tenants, each with its own database under data-dir/tenants.
+	if *multiTenant {
+		if replica {
+			logger.Error("--tenants needs a primary server")
+			os.Exit(1)
+		}
+		mgr := tenants.New(host.db, filepath.Join(*dataDir, "tenants"), tenantBuilder(opts, logger), logger)
+		defer mgr.Close()
+		srv.SetTenants(mgr)
+	}
+
+	// Graceful shutdown on SIGINT/SIGTERM.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	logger.Info("koor server starting",
+		"api", *bind,
+		"dashboard", *dashBind,
+		"status_page", *statusBind,
+		"data_dir", *dataDir,
+		"auth", *authToken != "",
+		"replicate_from", *replicateFrom,
+		"federate_from", *federateFrom,
+		"require_signed_events", *requireSigned,
+		"mcp_data_tools", *mcpDataTools,
+		"mcp_state_resources", *mcpStateResources,
+		"strict_json", *strictJSON,
+		"tenants", *multiTenant,
+		"audit_retention", *auditRetention,
+		"encryption", keyring.KeyID(),
+	)
+
+	if err := srv.ListenAndServe(ctx); err != nil {
+		logger.Error("server error", "error", err)
+		os.Exit(1)
+	}
+}
+
+// stackOptions configures a server stack: the host's, or a tenant's.
+type stackOptions struct {
+	cfg       server.Config
+	dataDir   string
+	keyring   *encryption.Keyring
+	retention time.Duration
+
+	// Host only; tenants neither replicate nor federate.
+	replicateFrom     string
+	replicateInterval time.Duration
+	replicateToken    string
+	federateFrom      string
+	federateInterval  time.Duration
+	federateToken     string
+}
+
+// stack is a server with its database, stores and background workers.
+type stack struct {
+	srv     *server.Server
+	db      *sql.DB
+	users   *users.Store
+	closers []func()
+}
+
+// Close stops the stack's background workers and closes its database, in
+// the reverse order they were started.
+func (st *stack) Close() {
+	for i := len(st.closers) - 1; i >= 0; i-- {
+		st.closers[i]()
+	}
+}
+
+// startStack opens a database, creates the stores and the server over it,
+// and starts the background workers. A replica starts no workers that write.
+func startStack(o stackOptions, logger *slog.Logger) (*stack, error) {
+	database, err := db.Open(o.dataDir)
+	if err != nil {
+		return nil, err
+	}
+	st := &stack{db: database, closers: []func(){func() { database.Close() }}}
+	onClose := func(f func()) { st.closers = append(st.closers, f) }
 
 	// Create stores.
 	stateStore := state.New(database)
 	specReg := specs.New(database)
+	stateStore.SetKeyring(o.keyring)
+	specReg.SetKeyring(o.keyring)
 	eventBus := events.New(database, 1000)
 	instanceReg := instances.New(database)
 
 	// Create MCP transport.
 	mcpTransport := koormcp.New(instanceReg, specReg, serverconfig.Endpoints{
-		APIBase: "http://" + *bind,
+		APIBase: "http://" + o.cfg.Bind,
 	})
 
-	// Create server.
-	cfg := server.Config{
-		Bind:          *bind,
-		DashboardBind: *dashBind,
-		DataDir:       *dataDir,
-		AuthToken:     *authToken,
+	srv := server.New(o.cfg, stateStore, specReg, eventBus, instanceReg, mcpTransport, logger)
+	srv.SetReplicationSource(replication.NewSource(database))
+	st.srv = srv
+
+	replica := o.replicateFrom != ""
+	if replica {
+		follower := replication.NewFollower(database, o.replicateFrom, o.replicateToken, o.replicateInterval, logger)
+		follower.Start()
+		onClose(follower.Stop)
+		srv.SetReplica(follower)
 	}
-	srv := server.New(cfg, stateStore, specReg, eventBus, instanceReg, mcpTransport, logger)
 
-	// Start liveness monitor (checks every 60s, marks stale after 5m of no heartbeat).
+	// Create liveness monitor (checks every 60s, marks stale after 5m of no
+	// heartbeat). It starts once the stores its policies act on exist.
 	liveMon := liveness.New(instanceReg, eventBus, 5*time.Minute, 60*time.Second, logger)
-	liveMon.Start()
-	defer liveMon.Stop()
+	liveMon.SetPolicies(liveness.NewPolicyStore(database))
 	srv.SetLiveness(liveMon)
 
 	// Start webhook dispatcher (subscribes to all events, dispatches to registered URLs).
 	webhookDisp := webhooks.New(database, eventBus, logger)
-	webhookDisp.Start()
-	defer webhookDisp.Stop()
+	if !replica {
+		webhookDisp.Start()
+		onClose(webhookDisp.Stop)
+	}
 	srv.SetWebhooks(webhookDisp)
+	liveMon.SetWebhooks(webhookDisp)
 
-	// Start compliance scheduler (checks active agents every 5 minutes).
+	// Start compliance scheduler (checks active agents every 5 minutes,
+	// and the contract targets in project settings for drift).
+	settingsStore := projects.New(database)
 	compSched := compliance.New(database, instanceReg, specReg, eventBus, 5*time.Minute, logger)
-	compSched.Start()
-	defer compSched.Stop()
+	compSched.SetProjectSettings(settingsStore)
+	if !replica {
+		compSched.Start()
+		onClose(compSched.Stop)
+	}
 	srv.SetCompliance(compSched)
 
 	// Create template store.
 	templateStore := templates.New(database)
 	srv.SetTemplates(templateStore)
+	srv.SetRulePacks(rulepacks.New(database, specReg))
+
+	if o.federateFrom != "" {
+		sub := federation.NewSubscriber(o.federateFrom, o.federateToken, o.federateInterval, specReg, templateStore, logger)
+		sub.Start()
+		onClose(sub.Stop)
+		srv.SetFederation(sub)
+	}
 
 	// Create audit log and observability metrics.
 	auditLog := audit.New(database)
+	auditLog.SetRetention(o.retention)
+	auditLog.SetEvents(eventBus)
 	srv.SetAudit(auditLog)
+	mcpTransport.SetAudit(auditLog)
 	metricsStore := observability.New(database)
 	srv.SetObservability(metricsStore)
 	llmCostStore := llmcost.New(database)
 	srv.SetLLMCost(llmCostStore)
+	srv.SetDeprecations(contracts.NewUsageLog(database))
+	srv.SetContractExamples(contracts.NewExampleStore(database))
+	tokenStore := tokens.New(database)
+	srv.SetTokens(tokenStore)
+	st.users = users.New(database)
+	srv.SetUsers(st.users)
+	taskStore := tasks.New(database, eventBus)
+	srv.SetTasks(taskStore)
+	liveMon.SetTasks(taskStore)
+	liveMon.SetTokens(tokenStore)
+	if !replica {
+		liveMon.Start()
+		onClose(liveMon.Stop)
+	}
+	srv.SetMessages(messages.New(database, eventBus))
+
+	// Start orphan cleanup (every 10 minutes, quarantines the state and
+	// messages of deregistered instances and releases their tasks).
+	orphanCleaner := orphans.New(database, eventBus, 10*time.Minute, logger)
+	orphanCleaner.SetTasks(taskStore)
+	if !replica {
+		orphanCleaner.Start()
+		onClose(orphanCleaner.Stop)
+	}
+	srv.SetOrphans(orphanCleaner)
+	compSched.SetState(stateStore)
+	compSched.SetMetrics(metricsStore)
+	compSched.SetTasks(taskStore)
+	mcpTransport.SetTasks(taskStore)
+	srv.SetProjectSettings(settingsStore)
+	eventBus.SetRetention(settingsStore.EventRetention)
+	srv.SetSearch(search.New(database))
+	srv.SetPolicies(policy.New(database))
+	projectionStore := projections.New(database, stateStore)
+	eventBus.SetProjections(projectionStore.Apply)
+	srv.SetProjections(projectionStore)
+
+	// Start the cron scheduler (checks every 15 seconds for schedules that
+	// are due and publishes their events).
+	scheduler := schedules.New(database, eventBus, 15*time.Second, logger)
+	if !replica {
+		scheduler.Start()
+		onClose(scheduler.Stop)
+	}
+	srv.SetSchedules(scheduler)
+	srv.SetMilestones(milestones.New(database))
+	srv.SetEncryption(o.keyring)
 
 	// Start background event pruning (every 60 seconds).
-	eventBus.StartPruning(60 * time.Second)
-	defer eventBus.Stop()
+	if !replica {
+		eventBus.StartPruning(60 * time.Second)
+		onClose(eventBus.Stop)
+	}
 
-	// Graceful shutdown on SIGINT/SIGTERM.
-	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
-	defer stop()
+	// Start background state history compaction (hourly).
+	if !replica {
+		stateStore.StartCompaction(time.Hour)
+		onClose(stateStore.Stop)
+	}
 
-	logger.Info("koor server starting",
-		"api", *bind,
-		"dashboard", *dashBind,
-		"data_dir", *dataDir,
-		"auth", *authToken != "",
-	)
+	// Start background audit pruning (hourly) when a retention is set.
+	if !replica && o.retention > 0 {
+		auditLog.StartPruning(time.Hour)
+		onClose(auditLog.Stop)
+	}
 
-	if err := srv.ListenAndServe(ctx); err != nil {
-		logger.Error("server error", "error", err)
-		os.Exit(1)
+	// Save the token tax counters every 30 seconds and on shutdown.
+	if !replica {
+		srv.StartCounterFlush(30 * time.Second)
+		onClose(srv.StopCounterFlush)
+	}
+	return st, nil
+}
+
+// tenantBuilder starts tenant stacks like the host's, each on its own
+// SQLite database. Tenants always require a credential: the host's
+// --auth-token, or one of the tenant's own tokens and users, starting with
+// the admin user created with the tenant.
+func tenantBuilder(host stackOptions, logger *slog.Logger) tenants.BuildFunc {
+	return func(t tenants.Tenant, dir string) (*tenants.Stack, error) {
+		o := stackOptions{
+			cfg:       host.cfg,
+			dataDir:   dir,
+			keyring:   host.keyring,
+			retention: host.retention,
+		}
+		o.cfg.DataDir = dir
+		o.cfg.DashboardBind, o.cfg.StatusBind = "", ""
+		o.cfg.Tenant = t.ID
+		if o.cfg.AuthToken == "" {
+			// No local mode for tenants: an unguessable token nobody
+			// holds keeps requests without a credential out.
+			buf := make([]byte, 32)
+			if _, err := rand.Read(buf); err != nil {
+				return nil, err
+			}
+			o.cfg.AuthToken = hex.EncodeToString(buf)
+		}
+		st, err := startStack(o, logger.With("tenant", t.ID))
+		if err != nil {
+			return nil, err
+		}
+		secret, err := st.users.EnsureAdmin(context.Background())
+		if err != nil {
+			st.Close()
+			return nil, fmt.Errorf("seed admin user: %w", err)
+		}
+		return &tenants.Stack{
+			API:         st.srv.Handler(),
+			Dashboard:   st.srv.DashboardHandler(),
+			Knows:       st.srv.KnowsToken,
+			AdminSecret: secret,
+			Close:       st.Close,
+		}, nil
+	}
+}
+
+// seedAdmin creates the first admin user on a fresh database and writes
+// its secret to admin-token in the data directory, readable only by the
+// owner. The secret is not logged.
+func seedAdmin(store *users.Store, dataDir string, logger *slog.Logger) {
+	secret, err := store.EnsureAdmin(context.Background())
+	if err != nil {
+		logger.Error("failed to seed admin user", "error", err)
+		return
+	}
+	if secret == "" {
+		return
 	}
+	path := filepath.Join(dataDir, "admin-token")
+	if err := os.WriteFile(path, []byte(secret+"\n"), 0o600); err != nil {
+		logger.Error("failed to write admin token; reset it with koor-cli users reset admin", "path", path, "error", err)
+		return
+	}
+	logger.Warn("created admin user; its secret is in the file shown, delete the file once stored safely", "path", path)
 }
 
 // loadConfigFile tries ./settings.json.
@@ -196,17 +600,20 @@ func readConfigFile(path, defaultDataDir string) (fileConfig, bool) {
 
 func defaults(defaultDataDir string) fileConfig {
 	return fileConfig{
-		Bind:          "localhost:9800",
-		DashboardBind: "localhost:9847",
-		DataDir:       defaultDataDir,
-		AuthToken:     "",
-		LogLevel:      "info",
+		Bind:              "localhost:9800",
+		DashboardBind:     "localhost:9847",
+		DataDir:           defaultDataDir,
+		AuthToken:         "",
+		LogLevel:          "info",
+		ReplicateInterval: "10s",
+		FederateInterval:  "5m",
+		StatusExpose:      "milestones,last_event",
 	}
 }
 
 // applyFileDefaults sets flag values from the config file for any flags
 // that were NOT explicitly set on the command line.
-func applyFileDefaults(fc fileConfig, bind, dashBind, dataDir, authToken, logLevel *string) {
+func applyFileDefaults(fc fileConfig, bind, dashBind, dataDir, authToken, logLevel, changeEvents, replicateFrom, replicateInterval, federateFrom, federateInterval *string, requireSigned, mcpDataTools, strictJSON, multiTenant *bool, statusBind, statusProjects, statusExpose, auditRetention, encryptionKeyFile, mcpStateResources *string) {
 	explicitly := map[string]bool{}
 	flag.Visit(func(f *flag.Flag) { explicitly[f.Name] = true })
 
@@ -225,4 +632,49 @@ func applyFileDefaults(fc fileConfig, bind, dashBind, dataDir, authToken, logLev
 	if !explicitly["log-level"] {
 		*logLevel = fc.LogLevel
 	}
+	if !explicitly["change-events"] {
+		*changeEvents = fc.ChangeEvents
+	}
+	if !explicitly["replicate-from"] {
+		*replicateFrom = fc.ReplicateFrom
+	}
+	if !explicitly["replicate-interval"] {
+		*replicateInterval = fc.ReplicateInterval
+	}
+	if !explicitly["federate-from"] {
+		*federateFrom = fc.FederateFrom
+	}
+	if !explicitly["federate-interval"] {
+		*federateInterval = fc.FederateInterval
+	}
+	if !explicitly["require-signed-events"] {
+		*requireSigned = fc.RequireSignedEvents
+	}
+	if !explicitly["mcp-data-tools"] {
+		*mcpDataTools = fc.MCPDataTools
+	}
+	if !explicitly["strict-json"] {
+		*strictJSON = fc.StrictJSON
+	}
+	if !explicitly["tenants"] {
+		*multiTenant = fc.Tenants
+	}
+	if !explicitly["status-bind"] {
+		*statusBind = fc.StatusBind
+	}
+	if !explicitly["status-projects"] {
+		*statusProjects = fc.StatusProjects
+	}
+	if !explicitly["status-expose"] {
+		*statusExpose = fc.StatusExpose
+	}
+	if !explicitly["audit-retention"] {
+		*auditRetention = fc.AuditRetention
+	}
+	if !explicitly["encryption-key-file"] {
+		*encryptionKeyFile = fc.EncryptionKeyFile
+	}
+	if !explicitly["mcp-state-resources"] {
+		*mcpStateResources = fc.MCPStateResources
+	}
 }
@@ -10,9 +10,37 @@ import (
 
 func main() {
 	accessible := flag.Bool("accessible", false, "run in accessible mode (no TUI chrome)")
+	templates := flag.String("templates", wizard.DefaultTemplateDir(), "directory of CLAUDE.md template overrides (env: KOOR_TEMPLATES)")
+	lang := flag.String("lang", wizard.LangFromEnv(), "language variant of the templates to prefer, e.g. de (env: KOOR_LANG, LANG)")
+	export := flag.String("export-templates", "", "write the built-in templates into this directory and exit")
+	from := flag.String("from", "", "scaffold and pre-load the server from a project definition (koor.yaml) without prompts")
+	token := flag.String("token", os.Getenv("KOOR_TOKEN"), "bearer token for pre-loading the server with --from (env: KOOR_TOKEN)")
+	noPreload := flag.Bool("no-preload", false, "with --from, only scaffold the workspaces")
 	flag.Parse()
 
-	if err := wizard.Run(wizard.Options{Accessible: *accessible}); err != nil {
+	if *export != "" {
+		written, err := wizard.ExportTemplates(*export)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		for _, path := range written {
+			fmt.Println(path)
+		}
+		return
+	}
+
+	opts := wizard.Options{
+		Accessible: *accessible,
+		Templates:  wizard.Templates{Dir: *templates, Lang: *lang},
+		Token:      *token,
+		NoPreload:  *noPreload,
+	}
+	run := wizard.Run
+	if *from != "" {
+		run = func(opts wizard.Options) error { return wizard.RunFromFile(*from, opts) }
+	}
+	if err := run(opts); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
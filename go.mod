@@ -2,7 +2,11 @@ module github.com/DavidRHerbert/koor
 
 go 1.25
 
-require modernc.org/sqlite v1.45.0
+require (
+	gopkg.in/yaml.v3 v3.0.1
+	modernc.org/sqlite v1.45.0
+	nhooyr.io/websocket v1.8.17
+)
 
 require (
 	github.com/atotto/clipboard v0.1.4 // indirect
@@ -44,9 +48,7 @@ require (
 	golang.org/x/sync v0.17.0 // indirect
 	golang.org/x/sys v0.37.0 // indirect
 	golang.org/x/text v0.23.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 	modernc.org/libc v1.67.6 // indirect
 	modernc.org/mathutil v1.7.1 // indirect
 	modernc.org/memory v1.11.0 // indirect
-	nhooyr.io/websocket v1.8.17 // indirect
 )
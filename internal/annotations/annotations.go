@@ -0,0 +1,115 @@
+// Package annotations renders validation findings as code review
+// annotations, so violations show up inline on a pull or merge request:
+// GitHub check-run annotations and GitLab Code Quality reports.
+package annotations
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+)
+
+// Supported output formats.
+const (
+	FormatGitHub = "github"
+	FormatGitLab = "gitlab"
+)
+
+// Finding is one problem at a file and line.
+type Finding struct {
+	File     string
+	Line     int    // 1-based; 0 means the whole file and is reported as line 1
+	Severity string // "error", "warning" or "info"
+	Rule     string
+	Message  string
+}
+
+// GitHubAnnotation is an annotation accepted by the GitHub Checks API.
+type GitHubAnnotation struct {
+	Path            string `json:"path"`
+	StartLine       int    `json:"start_line"`
+	EndLine         int    `json:"end_line"`
+	AnnotationLevel string `json:"annotation_level"` // notice, warning or failure
+	Title           string `json:"title,omitempty"`
+	Message         string `json:"message"`
+}
+
+// CodeQualityIssue is an entry in a GitLab Code Quality report.
+type CodeQualityIssue struct {
+	Description string `json:"description"`
+	CheckName   string `json:"check_name"`
+	Fingerprint string `json:"fingerprint"`
+	Severity    string `json:"severity"` // info, minor, major, critical or blocker
+	Location    struct {
+		Path  string `json:"path"`
+		Lines struct {
+			Begin int `json:"begin"`
+		} `json:"lines"`
+	} `json:"location"`
+}
+
+// Valid reports whether format is a supported output format.
+func Valid(format string) bool {
+	return format == FormatGitHub || format == FormatGitLab
+}
+
+// Render converts findings to the given format. The result is a JSON array
+// (never nil) ready to upload.
+func Render(format string, findings []Finding) (any, error) {
+	switch format {
+	case FormatGitHub:
+		out := []GitHubAnnotation{}
+		for _, f := range findings {
+			line := max(f.Line, 1)
+			out = append(out, GitHubAnnotation{
+				Path: f.File, StartLine: line, EndLine: line,
+				AnnotationLevel: githubLevel(f.Severity),
+				Title:           f.Rule,
+				Message:         f.Message,
+			})
+		}
+		return out, nil
+	case FormatGitLab:
+		out := []CodeQualityIssue{}
+		for _, f := range findings {
+			var issue CodeQualityIssue
+			issue.Description = f.Message
+			issue.CheckName = f.Rule
+			issue.Fingerprint = Fingerprint(f)
+			issue.Severity = gitlabSeverity(f.Severity)
+			issue.Location.Path = f.File
+			issue.Location.Lines.Begin = max(f.Line, 1)
+			out = append(out, issue)
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("unknown annotation format %q (want %s or %s)", format, FormatGitHub, FormatGitLab)
+}
+
+// Fingerprint identifies a finding across runs, so GitLab can tell new
+// issues from existing ones.
+func Fingerprint(f Finding) string {
+	sum := sha256.Sum256([]byte(f.Rule + "\x00" + f.File + "\x00" + strconv.Itoa(f.Line) + "\x00" + f.Message))
+	return hex.EncodeToString(sum[:16])
+}
+
+func githubLevel(severity string) string {
+	switch severity {
+	case "error", "":
+		return "failure"
+	case "warning":
+		return "warning"
+	}
+	return "notice"
+}
+
+func gitlabSeverity(severity string) string {
+	switch severity {
+	case "error", "":
+		return "major"
+	case "warning":
+		return "minor"
+	}
+	return "info"
+}
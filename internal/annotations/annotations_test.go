@@ -0,0 +1,51 @@
+package annotations
+
+import "testing"
+
+func TestRender(t *testing.T) {
+	findings := []Finding{
+		{File: "a.go", Line: 3, Severity: "error", Rule: "r1", Message: "bad"},
+		{File: "b.go", Severity: "warning", Rule: "r2", Message: "meh"},
+		{File: "c.go", Line: 9, Severity: "info", Rule: "r3", Message: "fyi"},
+	}
+
+	out, err := Render(FormatGitHub, findings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gh := out.([]GitHubAnnotation)
+	wantLevels := []string{"failure", "warning", "notice"}
+	for i, a := range gh {
+		if a.AnnotationLevel != wantLevels[i] {
+			t.Errorf("%s: level %q, want %q", a.Path, a.AnnotationLevel, wantLevels[i])
+		}
+	}
+	if gh[1].StartLine != 1 || gh[1].EndLine != 1 {
+		t.Errorf("unknown line should map to 1, got %d-%d", gh[1].StartLine, gh[1].EndLine)
+	}
+
+	out, err = Render(FormatGitLab, findings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gl := out.([]CodeQualityIssue)
+	wantSeverities := []string{"major", "minor", "info"}
+	for i, issue := range gl {
+		if issue.Severity != wantSeverities[i] {
+			t.Errorf("%s: severity %q, want %q", issue.Location.Path, issue.Severity, wantSeverities[i])
+		}
+	}
+	if gl[0].Location.Lines.Begin != 3 || gl[0].Fingerprint != Fingerprint(findings[0]) {
+		t.Errorf("unexpected issue: %+v", gl[0])
+	}
+	if gl[0].Fingerprint == gl[1].Fingerprint {
+		t.Error("distinct findings should have distinct fingerprints")
+	}
+
+	if out, _ := Render(FormatGitHub, nil); out == nil || len(out.([]GitHubAnnotation)) != 0 {
+		t.Errorf("no findings should render an empty array, got %#v", out)
+	}
+	if _, err := Render("sarif", findings); err == nil {
+		t.Error("unknown format should fail")
+	}
+}
@@ -5,9 +5,17 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/DavidRHerbert/koor/internal/events"
 )
 
+// Topic is the internal event topic every appended entry is published on,
+// for live streams of the log.
+const Topic = events.InternalPrefix + "audit"
+
 // Entry is a single audit log record.
 type Entry struct {
 	ID        int64     `json:"id"`
@@ -30,12 +38,89 @@ type Summary struct {
 
 // Log provides append-only audit logging backed by SQLite.
 type Log struct {
-	db *sql.DB
+	db        *sql.DB
+	retention time.Duration
+	stopPrune chan struct{}
+	bus       *events.Bus
 }
 
 // New creates a new audit Log.
 func New(db *sql.DB) *Log {
-	return &Log{db: db}
+	return &Log{db: db, stopPrune: make(chan struct{})}
+}
+
+// ParseRetention parses an audit retention such as "90d" or "720h". Days
+// are accepted on top of Go durations. Empty means keep entries forever.
+func ParseRetention(v string) (time.Duration, error) {
+	if v == "" {
+		return 0, nil
+	}
+	var d time.Duration
+	if days, ok := strings.CutSuffix(v, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid audit retention %q", v)
+		}
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		var err error
+		if d, err = time.ParseDuration(v); err != nil {
+			return 0, fmt.Errorf("invalid audit retention %q", v)
+		}
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("audit retention must be positive")
+	}
+	return d, nil
+}
+
+// SetEvents publishes every appended entry on Topic.
+func (l *Log) SetEvents(bus *events.Bus) {
+	l.bus = bus
+}
+
+// SetRetention sets how long entries are kept; zero keeps them forever.
+func (l *Log) SetRetention(d time.Duration) {
+	l.retention = d
+}
+
+// StartPruning launches a background goroutine that periodically removes
+// entries older than the retention. Call Stop() to shut it down.
+func (l *Log) StartPruning(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				l.Prune(context.Background())
+			case <-l.stopPrune:
+				return
+			}
+		}
+	}()
+}
+
+// Stop shuts down the background pruning goroutine.
+func (l *Log) Stop() {
+	select {
+	case l.stopPrune <- struct{}{}:
+	default:
+	}
+}
+
+// Prune removes entries older than the retention and reports how many
+// were removed. It does nothing when no retention is set.
+func (l *Log) Prune(ctx context.Context) (int64, error) {
+	if l.retention <= 0 {
+		return 0, nil
+	}
+	cutoff := time.Now().UTC().Add(-l.retention).Format("2006-01-02 15:04:05")
+	res, err := l.db.ExecContext(ctx, `DELETE FROM audit_log WHERE timestamp < ?`, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("audit prune: %w", err)
+	}
+	return res.RowsAffected()
 }
 
 // Append writes a single audit entry. Detail should be a JSON string.
@@ -46,13 +131,24 @@ func (l *Log) Append(ctx context.Context, actor, action, resource, detail, outco
 	if outcome == "" {
 		outcome = "success"
 	}
-	_, err := l.db.ExecContext(ctx,
+	res, err := l.db.ExecContext(ctx,
 		`INSERT INTO audit_log (actor, action, resource, detail, outcome)
 		 VALUES (?, ?, ?, ?, ?)`,
 		actor, action, resource, detail, outcome)
 	if err != nil {
 		return fmt.Errorf("audit append: %w", err)
 	}
+	if l.bus != nil {
+		id, _ := res.LastInsertId()
+		var e Entry
+		err := l.db.QueryRowContext(ctx,
+			`SELECT id, timestamp, actor, action, resource, detail, outcome FROM audit_log WHERE id = ?`, id).
+			Scan(&e.ID, &e.Timestamp, &e.Actor, &e.Action, &e.Resource, &e.Detail, &e.Outcome)
+		if err == nil {
+			data, _ := json.Marshal(e)
+			l.bus.PublishInternal(Topic, data, "audit")
+		}
+	}
 	return nil
 }
 
@@ -94,16 +190,94 @@ func (l *Log) Query(ctx context.Context, actor, action, from, to string, limit i
 	var entries []Entry
 	for rows.Next() {
 		var e Entry
-		var ts string
-		if err := rows.Scan(&e.ID, &ts, &e.Actor, &e.Action, &e.Resource, &e.Detail, &e.Outcome); err != nil {
+		if err := rows.Scan(&e.ID, &e.Timestamp, &e.Actor, &e.Action, &e.Resource, &e.Detail, &e.Outcome); err != nil {
 			return nil, fmt.Errorf("audit scan: %w", err)
 		}
-		e.Timestamp, _ = time.Parse("2006-01-02 15:04:05", ts)
 		entries = append(entries, e)
 	}
 	return entries, rows.Err()
 }
 
+// Since returns up to limit entries with an ID greater than afterID, oldest
+// first, so callers can follow the log by passing the last ID they saw.
+// Actor and action filters are optional.
+func (l *Log) Since(ctx context.Context, afterID int64, actor, action string, limit int) ([]Entry, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+
+	query := `SELECT id, timestamp, actor, action, resource, detail, outcome FROM audit_log WHERE id > ?`
+	args := []any{afterID}
+	if actor != "" {
+		query += ` AND actor = ?`
+		args = append(args, actor)
+	}
+	if action != "" {
+		query += ` AND action = ?`
+		args = append(args, action)
+	}
+	query += ` ORDER BY id ASC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := l.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("audit since: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []Entry
+	for rows.Next() {
+		var e Entry
+		if err := rows.Scan(&e.ID, &e.Timestamp, &e.Actor, &e.Action, &e.Resource, &e.Detail, &e.Outcome); err != nil {
+			return nil, fmt.Errorf("audit scan: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// Export calls fn for every entry in the time range, oldest first, without
+// loading the range into memory. Empty filters match everything. Export
+// stops at the first error fn returns.
+func (l *Log) Export(ctx context.Context, actor, action, from, to string, fn func(Entry) error) error {
+	query := `SELECT id, timestamp, actor, action, resource, detail, outcome FROM audit_log WHERE 1=1`
+	args := []any{}
+	if actor != "" {
+		query += ` AND actor = ?`
+		args = append(args, actor)
+	}
+	if action != "" {
+		query += ` AND action = ?`
+		args = append(args, action)
+	}
+	if from != "" {
+		query += ` AND timestamp >= ?`
+		args = append(args, from)
+	}
+	if to != "" {
+		query += ` AND timestamp <= ?`
+		args = append(args, to)
+	}
+	query += ` ORDER BY id ASC`
+
+	rows, err := l.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("audit export: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e Entry
+		if err := rows.Scan(&e.ID, &e.Timestamp, &e.Actor, &e.Action, &e.Resource, &e.Detail, &e.Outcome); err != nil {
+			return fmt.Errorf("audit scan: %w", err)
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
 // QuerySummary returns aggregated audit statistics for the given time range.
 func (l *Log) QuerySummary(ctx context.Context, from, to string) (*Summary, error) {
 	baseWhere := ` WHERE 1=1`
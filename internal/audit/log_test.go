@@ -2,7 +2,9 @@ package audit_test
 
 import (
 	"context"
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/DavidRHerbert/koor/internal/audit"
 	"github.com/DavidRHerbert/koor/internal/db"
@@ -97,6 +99,34 @@ func TestQueryLimit(t *testing.T) {
 	}
 }
 
+func TestSince(t *testing.T) {
+	l := testLog(t)
+	ctx := context.Background()
+
+	l.Append(ctx, "agent-1", "state.put", "key1", "{}", "success")
+	l.Append(ctx, "agent-2", "state.put", "key2", "{}", "success")
+	l.Append(ctx, "agent-1", "state.delete", "key3", "{}", "success")
+
+	first, err := l.Since(ctx, 0, "", "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first) != 1 || first[0].Resource != "key1" {
+		t.Fatalf("expected oldest entry first, got %+v", first)
+	}
+	if first[0].Timestamp.IsZero() {
+		t.Error("expected timestamp to be set")
+	}
+
+	rest, err := l.Since(ctx, first[0].ID, "agent-1", "", 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rest) != 1 || rest[0].Resource != "key3" {
+		t.Fatalf("expected only key3 after first entry for agent-1, got %+v", rest)
+	}
+}
+
 func TestQuerySummary(t *testing.T) {
 	l := testLog(t)
 	ctx := context.Background()
@@ -167,6 +197,59 @@ func TestEmptyQuery(t *testing.T) {
 	}
 }
 
+func TestParseRetention(t *testing.T) {
+	for in, want := range map[string]time.Duration{"": 0, "90d": 90 * 24 * time.Hour, "36h": 36 * time.Hour} {
+		got, err := audit.ParseRetention(in)
+		if err != nil || got != want {
+			t.Errorf("ParseRetention(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"d", "-1d", "0h", "ninety"} {
+		if _, err := audit.ParseRetention(in); err == nil {
+			t.Errorf("ParseRetention(%q): expected error", in)
+		}
+	}
+}
+
+func TestPruneAndExport(t *testing.T) {
+	database, err := db.OpenMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	l := audit.New(database)
+	ctx := context.Background()
+
+	database.Exec(`INSERT INTO audit_log (timestamp, actor, action, resource) VALUES (datetime('now', '-100 days'), 'agent-1', 'state.put', 'old')`)
+	l.Append(ctx, "agent-1", "state.put", "new", "", "")
+	l.Append(ctx, "agent-2", "spec.put", "newer", "", "")
+
+	// No retention: nothing is pruned.
+	if n, err := l.Prune(ctx); err != nil || n != 0 {
+		t.Fatalf("expected no pruning without retention, got %d, %v", n, err)
+	}
+	l.SetRetention(90 * 24 * time.Hour)
+	if n, err := l.Prune(ctx); err != nil || n != 1 {
+		t.Fatalf("expected 1 pruned entry, got %d, %v", n, err)
+	}
+
+	var got []string
+	err = l.Export(ctx, "", "", "", "", func(e audit.Entry) error {
+		got = append(got, e.Resource)
+		return nil
+	})
+	if err != nil || len(got) != 2 || got[0] != "new" || got[1] != "newer" {
+		t.Errorf("expected remaining entries oldest first, got %v, %v", got, err)
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	err = l.Export(ctx, "", "", "", "", func(audit.Entry) error { calls++; return stop })
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Errorf("expected export to stop at the first error, got %v after %d calls", err, calls)
+	}
+}
+
 func TestDetailJSON(t *testing.T) {
 	got := audit.DetailJSON(map[string]any{"version": 5, "key": "test"})
 	if got == "{}" {
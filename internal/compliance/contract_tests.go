@@ -0,0 +1,276 @@
+package compliance
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/DavidRHerbert/koor/internal/contracts"
+	"github.com/google/uuid"
+)
+
+// ContractSchedule is a recurring live test of a contract against a target service.
+type ContractSchedule struct {
+	ID       string     `json:"id"`
+	Project  string     `json:"project"`
+	Contract string     `json:"contract"`
+	Target   string     `json:"target"`
+	Interval string     `json:"interval"`
+	Created  time.Time  `json:"created_at"`
+	LastRun  *time.Time `json:"last_run,omitempty"`
+
+	intervalSeconds int64
+}
+
+// ContractTestResult is the stored outcome of testing one endpoint in a scheduled run.
+type ContractTestResult struct {
+	ID         int64           `json:"id"`
+	ScheduleID string          `json:"schedule_id"`
+	Project    string          `json:"project"`
+	Contract   string          `json:"contract"`
+	Target     string          `json:"target"`
+	Endpoint   string          `json:"endpoint"`
+	Pass       bool            `json:"pass"`
+	StatusCode int             `json:"status_code"`
+	Violations json.RawMessage `json:"violations"`
+	Error      string          `json:"error,omitempty"`
+	Regression bool            `json:"regression,omitempty"`
+	RunAt      time.Time       `json:"run_at"`
+}
+
+// AddContractSchedule registers a recurring contract test run.
+func (s *Scheduler) AddContractSchedule(ctx context.Context, project, contract, target string, interval time.Duration) (*ContractSchedule, error) {
+	if interval < time.Minute {
+		return nil, fmt.Errorf("interval must be at least 1m")
+	}
+	id := uuid.New().String()
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO contract_schedules (id, project, contract, target, interval_seconds)
+		 VALUES (?, ?, ?, ?, ?)`,
+		id, project, contract, target, int64(interval/time.Second))
+	if err != nil {
+		return nil, fmt.Errorf("insert contract schedule: %w", err)
+	}
+	return s.GetContractSchedule(ctx, id)
+}
+
+// GetContractSchedule returns a single schedule by ID.
+func (s *Scheduler) GetContractSchedule(ctx context.Context, id string) (*ContractSchedule, error) {
+	row := s.db.QueryRowContext(ctx,
+		`SELECT id, project, contract, target, interval_seconds, created_at, last_run
+		 FROM contract_schedules WHERE id = ?`, id)
+	return scanContractSchedule(row)
+}
+
+// ListContractSchedules returns all contract test schedules.
+func (s *Scheduler) ListContractSchedules(ctx context.Context) ([]ContractSchedule, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, project, contract, target, interval_seconds, created_at, last_run
+		 FROM contract_schedules ORDER BY created_at, id`)
+	if err != nil {
+		return nil, fmt.Errorf("query contract schedules: %w", err)
+	}
+	defer rows.Close()
+
+	var list []ContractSchedule
+	for rows.Next() {
+		cs, err := scanContractSchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *cs)
+	}
+	return list, rows.Err()
+}
+
+// DeleteContractSchedule removes a schedule and its stored results.
+func (s *Scheduler) DeleteContractSchedule(ctx context.Context, id string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM contract_schedules WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("delete contract schedule: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	s.db.ExecContext(ctx, `DELETE FROM contract_test_results WHERE schedule_id = ?`, id)
+	return nil
+}
+
+// RunDueContractTests runs every schedule whose interval has elapsed.
+func (s *Scheduler) RunDueContractTests(ctx context.Context) {
+	list, err := s.ListContractSchedules(ctx)
+	if err != nil {
+		s.logger.Error("compliance: list contract schedules", "error", err)
+		return
+	}
+	now := time.Now().UTC()
+	for _, cs := range list {
+		if cs.LastRun != nil && now.Sub(*cs.LastRun) < time.Duration(cs.intervalSeconds)*time.Second {
+			continue
+		}
+		if _, err := s.RunContractSchedule(ctx, cs.ID); err != nil {
+			s.logger.Error("compliance: contract test run", "schedule", cs.ID, "error", err)
+		}
+	}
+}
+
+// RunContractSchedule tests every endpoint of the scheduled contract against
+// its target, stores the results, and publishes a contract.test.regression
+// event for each endpoint that passed on the previous run but fails now.
+func (s *Scheduler) RunContractSchedule(ctx context.Context, id string) ([]ContractTestResult, error) {
+	cs, err := s.GetContractSchedule(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	spec, err := s.specReg.Get(ctx, cs.Project, cs.Contract)
+	if err != nil {
+		return nil, fmt.Errorf("get contract %s/%s: %w", cs.Project, cs.Contract, err)
+	}
+	contract, err := contracts.Parse(spec.Data)
+	if err != nil {
+		return nil, fmt.Errorf("parse contract %s/%s: %w", cs.Project, cs.Contract, err)
+	}
+
+	endpoints := make([]string, 0, len(contract.Endpoints))
+	for ep := range contract.Endpoints {
+		endpoints = append(endpoints, ep)
+	}
+	sort.Strings(endpoints)
+
+	var results []ContractTestResult
+	for _, ep := range endpoints {
+		r := ContractTestResult{
+			ScheduleID: cs.ID,
+			Project:    cs.Project,
+			Contract:   cs.Contract,
+			Target:     cs.Target,
+			Endpoint:   ep,
+		}
+		var violations []contracts.Violation
+		tr, err := contracts.TestEndpoint(contract, ep, cs.Target, nil)
+		if err != nil {
+			r.Error = err.Error()
+		} else {
+			r.StatusCode = tr.StatusCode
+			r.Error = tr.Error
+			violations = append(tr.RequestViolations, tr.ResponseViolations...)
+		}
+		if violations == nil {
+			violations = []contracts.Violation{}
+		}
+		r.Pass = r.Error == "" && len(violations) == 0
+		r.Violations, _ = json.Marshal(violations)
+
+		prevPass, hasPrev := s.lastEndpointResult(ctx, cs.ID, ep)
+		r.Regression = hasPrev && prevPass && !r.Pass
+
+		if err := s.storeContractResult(ctx, &r); err != nil {
+			return nil, err
+		}
+		if r.Regression {
+			data, _ := json.Marshal(map[string]any{
+				"schedule_id": cs.ID,
+				"project":     cs.Project,
+				"contract":    cs.Contract,
+				"target":      cs.Target,
+				"endpoint":    ep,
+				"status_code": r.StatusCode,
+				"violations":  violations,
+				"error":       r.Error,
+			})
+			s.eventBus.Publish(ctx, "contract.test.regression", data, "compliance-scheduler")
+		}
+		results = append(results, r)
+	}
+
+	s.db.ExecContext(ctx, `UPDATE contract_schedules SET last_run = datetime('now') WHERE id = ?`, cs.ID)
+	return results, nil
+}
+
+// ContractTestHistory returns recent results for a schedule, newest first.
+func (s *Scheduler) ContractTestHistory(ctx context.Context, scheduleID string, limit int) ([]ContractTestResult, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, schedule_id, project, contract, target, endpoint, pass, status_code, violations, error, regression, run_at
+		 FROM contract_test_results WHERE schedule_id = ? ORDER BY id DESC LIMIT ?`,
+		scheduleID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query contract test results: %w", err)
+	}
+	defer rows.Close()
+
+	var results []ContractTestResult
+	for rows.Next() {
+		var r ContractTestResult
+		var passInt, regressionInt int
+		var violations string
+		if err := rows.Scan(&r.ID, &r.ScheduleID, &r.Project, &r.Contract, &r.Target, &r.Endpoint,
+			&passInt, &r.StatusCode, &violations, &r.Error, &regressionInt, &r.RunAt); err != nil {
+			return nil, fmt.Errorf("scan contract test result: %w", err)
+		}
+		r.Pass = passInt == 1
+		r.Regression = regressionInt == 1
+		r.Violations = json.RawMessage(violations)
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// lastEndpointResult reports whether the most recent stored result for an
+// endpoint passed, and whether any result exists.
+func (s *Scheduler) lastEndpointResult(ctx context.Context, scheduleID, endpoint string) (pass, ok bool) {
+	var passInt int
+	err := s.db.QueryRowContext(ctx,
+		`SELECT pass FROM contract_test_results WHERE schedule_id = ? AND endpoint = ?
+		 ORDER BY id DESC LIMIT 1`, scheduleID, endpoint).Scan(&passInt)
+	if err != nil {
+		return false, false
+	}
+	return passInt == 1, true
+}
+
+func (s *Scheduler) storeContractResult(ctx context.Context, r *ContractTestResult) error {
+	passInt, regressionInt := 0, 0
+	if r.Pass {
+		passInt = 1
+	}
+	if r.Regression {
+		regressionInt = 1
+	}
+	res, err := s.db.ExecContext(ctx,
+		`INSERT INTO contract_test_results (schedule_id, project, contract, target, endpoint, pass, status_code, violations, error, regression, run_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, datetime('now'))`,
+		r.ScheduleID, r.Project, r.Contract, r.Target, r.Endpoint, passInt, r.StatusCode, string(r.Violations), r.Error, regressionInt)
+	if err != nil {
+		return fmt.Errorf("store contract test result: %w", err)
+	}
+	r.ID, _ = res.LastInsertId()
+	r.RunAt = time.Now().UTC()
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanContractSchedule(row rowScanner) (*ContractSchedule, error) {
+	var cs ContractSchedule
+	var lastRun sql.NullTime
+	if err := row.Scan(&cs.ID, &cs.Project, &cs.Contract, &cs.Target, &cs.intervalSeconds, &cs.Created, &lastRun); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, err
+		}
+		return nil, fmt.Errorf("scan contract schedule: %w", err)
+	}
+	cs.Interval = (time.Duration(cs.intervalSeconds) * time.Second).String()
+	if lastRun.Valid {
+		cs.LastRun = &lastRun.Time
+	}
+	return &cs, nil
+}
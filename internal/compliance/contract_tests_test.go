@@ -0,0 +1,125 @@
+package compliance_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestContractScheduleCRUD(t *testing.T) {
+	env := setup(t)
+	ctx := context.Background()
+
+	cs, err := env.sched.AddContractSchedule(ctx, "TW", "api", "http://localhost:8080", 30*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cs.ID == "" || cs.Interval != "30m0s" || cs.LastRun != nil {
+		t.Errorf("unexpected schedule: %+v", cs)
+	}
+
+	list, _ := env.sched.ListContractSchedules(ctx)
+	if len(list) != 1 {
+		t.Fatalf("expected 1 schedule, got %d", len(list))
+	}
+
+	if err := env.sched.DeleteContractSchedule(ctx, cs.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.sched.DeleteContractSchedule(ctx, cs.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected ErrNoRows deleting twice, got %v", err)
+	}
+}
+
+func TestContractScheduleRejectsShortInterval(t *testing.T) {
+	env := setup(t)
+	if _, err := env.sched.AddContractSchedule(context.Background(), "TW", "api", "http://x", time.Second); err == nil {
+		t.Error("expected error for interval under 1m")
+	}
+}
+
+func TestRunContractScheduleRegression(t *testing.T) {
+	env := setup(t)
+	ctx := context.Background()
+
+	// Backend serves the right shape on the first call, then drifts.
+	var calls atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if calls.Add(1) == 1 {
+			json.NewEncoder(w).Encode(map[string]any{"id": "1"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"item_id": "1"})
+	}))
+	defer backend.Close()
+
+	contract := `{"kind":"contract","version":1,"endpoints":{"GET /api/items/1":{"response_status":200,"response":{"id":{"type":"string","required":true}}}}}`
+	env.specReg.Put(ctx, "TW", "api", []byte(contract))
+
+	cs, err := env.sched.AddContractSchedule(ctx, "TW", "api", backend.URL, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub := env.eventBus.Subscribe("contract.test.*")
+	defer env.eventBus.Unsubscribe(sub)
+
+	results, err := env.sched.RunContractSchedule(ctx, cs.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || !results[0].Pass {
+		t.Fatalf("first run should pass: %+v", results)
+	}
+
+	results, _ = env.sched.RunContractSchedule(ctx, cs.ID)
+	if results[0].Pass || !results[0].Regression {
+		t.Fatalf("second run should be a regression: %+v", results[0])
+	}
+
+	select {
+	case ev := <-sub.Ch:
+		if ev.Topic != "contract.test.regression" {
+			t.Errorf("unexpected topic %s", ev.Topic)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected contract.test.regression event")
+	}
+
+	history, _ := env.sched.ContractTestHistory(ctx, cs.ID, 10)
+	if len(history) != 2 || history[0].Pass || !history[1].Pass {
+		t.Errorf("unexpected history: %+v", history)
+	}
+
+	got, _ := env.sched.GetContractSchedule(ctx, cs.ID)
+	if got.LastRun == nil {
+		t.Error("expected last_run to be set")
+	}
+}
+
+func TestRunDueContractTestsSkipsRecent(t *testing.T) {
+	env := setup(t)
+	ctx := context.Background()
+
+	var calls atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(200)
+	}))
+	defer backend.Close()
+
+	env.specReg.Put(ctx, "TW", "api", []byte(`{"kind":"contract","version":1,"endpoints":{"GET /ping":{"response_status":200}}}`))
+	env.sched.AddContractSchedule(ctx, "TW", "api", backend.URL, time.Hour)
+
+	env.sched.RunDueContractTests(ctx)
+	env.sched.RunDueContractTests(ctx)
+	if calls.Load() != 1 {
+		t.Errorf("expected schedule to run once within its interval, ran %d times", calls.Load())
+	}
+}
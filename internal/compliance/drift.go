@@ -0,0 +1,228 @@
+package compliance
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/DavidRHerbert/koor/internal/contracts"
+	"github.com/DavidRHerbert/koor/internal/projects"
+	"github.com/google/uuid"
+)
+
+// driftRetention is how long drift check results are kept.
+const driftRetention = 7 * 24 * time.Hour
+
+// DriftResult is the outcome of checking one contract endpoint against the
+// running service that implements it.
+type DriftResult struct {
+	Endpoint   string          `json:"endpoint"`
+	Pass       bool            `json:"pass"`
+	StatusCode int             `json:"status_code"`
+	Violations json.RawMessage `json:"violations"`
+	Error      string          `json:"error,omitempty"`
+}
+
+// DriftCheck is one check of a contract against its target.
+type DriftCheck struct {
+	Project   string        `json:"project"`
+	Contract  string        `json:"contract"`
+	Target    string        `json:"target"`
+	Drifting  bool          `json:"drifting"`
+	Failed    int           `json:"failed"`
+	CheckedAt *time.Time    `json:"checked_at,omitempty"`
+	Endpoints []DriftResult `json:"endpoints"`
+}
+
+// SetProjectSettings attaches the project settings that name the services
+// checked for contract drift (contract_targets and drift_interval).
+func (s *Scheduler) SetProjectSettings(st *projects.Store) {
+	s.settings = st
+}
+
+// RunDueDriftChecks checks every project whose drift interval has elapsed
+// since its last check.
+func (s *Scheduler) RunDueDriftChecks(ctx context.Context) {
+	if s.settings == nil {
+		return
+	}
+	list, err := s.settings.List(ctx)
+	if err != nil {
+		s.logger.Error("compliance: list project settings", "error", err)
+		return
+	}
+	now := time.Now()
+	for _, st := range list {
+		if len(st.ContractTargets) == 0 {
+			continue
+		}
+		every, err := st.DriftEvery()
+		if err != nil {
+			continue
+		}
+		s.mu.Lock()
+		last, ok := s.lastDrift[st.Project]
+		due := !ok || now.Sub(last) >= every
+		if due {
+			s.lastDrift[st.Project] = now
+		}
+		s.mu.Unlock()
+		if !due {
+			continue
+		}
+		if _, err := s.CheckDrift(ctx, st); err != nil {
+			s.logger.Error("compliance: drift check", "project", st.Project, "error", err)
+		}
+	}
+}
+
+// CheckDrift tests every endpoint of each project contract that has a
+// target in the settings, stores the results, and publishes a
+// contract.drift event for each contract the running service no longer
+// matches.
+func (s *Scheduler) CheckDrift(ctx context.Context, st projects.Settings) ([]DriftCheck, error) {
+	specList, err := s.specReg.List(ctx, st.Project)
+	if err != nil {
+		return nil, fmt.Errorf("list specs: %w", err)
+	}
+	s.db.ExecContext(ctx, `DELETE FROM contract_drift WHERE project = ? AND run_at < datetime('now', ?)`,
+		st.Project, fmt.Sprintf("-%d seconds", int(driftRetention.Seconds())))
+
+	var checks []DriftCheck
+	for _, sp := range specList {
+		target := st.ContractTarget(sp.Name)
+		if target == "" {
+			continue
+		}
+		spec, err := s.specReg.Get(ctx, st.Project, sp.Name)
+		if err != nil {
+			continue
+		}
+		contract, err := contracts.Parse(spec.Data)
+		if err != nil {
+			continue // Not a contract spec — skip.
+		}
+		check, err := s.checkContractDrift(ctx, st.Project, sp.Name, target, contract)
+		if err != nil {
+			return checks, err
+		}
+		checks = append(checks, *check)
+	}
+	return checks, nil
+}
+
+func (s *Scheduler) checkContractDrift(ctx context.Context, project, name, target string, contract *contracts.Contract) (*DriftCheck, error) {
+	endpoints := make([]string, 0, len(contract.Endpoints))
+	for ep := range contract.Endpoints {
+		endpoints = append(endpoints, ep)
+	}
+	sort.Strings(endpoints)
+
+	now := time.Now().UTC()
+	check := &DriftCheck{
+		Project: project, Contract: name, Target: target,
+		CheckedAt: &now, Endpoints: []DriftResult{},
+	}
+	runID := uuid.New().String()
+	for _, ep := range endpoints {
+		r := DriftResult{Endpoint: ep}
+		var violations []contracts.Violation
+		tr, err := contracts.TestEndpoint(contract, ep, target, nil)
+		if err != nil {
+			r.Error = err.Error()
+		} else {
+			r.StatusCode = tr.StatusCode
+			r.Error = tr.Error
+			violations = append(tr.RequestViolations, tr.ResponseViolations...)
+		}
+		if violations == nil {
+			violations = []contracts.Violation{}
+		}
+		r.Pass = r.Error == "" && len(violations) == 0
+		r.Violations, _ = json.Marshal(violations)
+		if !r.Pass {
+			check.Failed++
+		}
+
+		passInt := 0
+		if r.Pass {
+			passInt = 1
+		}
+		_, err = s.db.ExecContext(ctx,
+			`INSERT INTO contract_drift (run_id, project, contract, target, endpoint, pass, status_code, violations, error, run_at)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, datetime('now'))`,
+			runID, project, name, target, ep, passInt, r.StatusCode, string(r.Violations), r.Error)
+		if err != nil {
+			return nil, fmt.Errorf("store drift result: %w", err)
+		}
+		check.Endpoints = append(check.Endpoints, r)
+	}
+	check.Drifting = check.Failed > 0
+
+	if check.Drifting {
+		failing := []DriftResult{}
+		for _, r := range check.Endpoints {
+			if !r.Pass {
+				failing = append(failing, r)
+			}
+		}
+		data, _ := json.Marshal(map[string]any{
+			"project":   project,
+			"contract":  name,
+			"target":    target,
+			"failed":    check.Failed,
+			"total":     len(check.Endpoints),
+			"endpoints": failing,
+		})
+		s.eventBus.Publish(ctx, "contract.drift", data, "compliance-scheduler")
+	}
+	return check, nil
+}
+
+// Drift returns the most recent drift check of a contract. Returns
+// sql.ErrNoRows if it has never been checked.
+func (s *Scheduler) Drift(ctx context.Context, project, contract string) (*DriftCheck, error) {
+	var runID string
+	err := s.db.QueryRowContext(ctx,
+		`SELECT run_id FROM contract_drift WHERE project = ? AND contract = ? ORDER BY id DESC LIMIT 1`,
+		project, contract).Scan(&runID)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT target, endpoint, pass, status_code, violations, error, run_at
+		 FROM contract_drift WHERE run_id = ? ORDER BY id`, runID)
+	if err != nil {
+		return nil, fmt.Errorf("query drift results: %w", err)
+	}
+	defer rows.Close()
+
+	check := &DriftCheck{Project: project, Contract: contract, Endpoints: []DriftResult{}}
+	var runAt time.Time
+	for rows.Next() {
+		var r DriftResult
+		var passInt int
+		var violations string
+		if err := rows.Scan(&check.Target, &r.Endpoint, &passInt, &r.StatusCode, &violations, &r.Error, &runAt); err != nil {
+			return nil, fmt.Errorf("scan drift result: %w", err)
+		}
+		r.Pass = passInt == 1
+		r.Violations = json.RawMessage(violations)
+		if !r.Pass {
+			check.Failed++
+		}
+		check.Endpoints = append(check.Endpoints, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(check.Endpoints) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	check.CheckedAt = &runAt
+	check.Drifting = check.Failed > 0
+	return check, nil
+}
@@ -0,0 +1,107 @@
+package compliance_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DavidRHerbert/koor/internal/projects"
+)
+
+func TestCheckDriftPublishesEvent(t *testing.T) {
+	env := setup(t)
+	ctx := context.Background()
+
+	// The running service renamed "id" to "item_id".
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/ping" {
+			w.WriteHeader(200)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"item_id": "1"})
+	}))
+	defer backend.Close()
+
+	env.specReg.Put(ctx, "TW", "api", []byte(`{"kind":"contract","version":1,"endpoints":{
+		"GET /api/items/1":{"response_status":200,"response":{"id":{"type":"string","required":true}}},
+		"GET /ping":{"response_status":200}}}`))
+	env.specReg.Put(ctx, "TW", "notes", []byte(`{"not":"a contract"}`))
+
+	if _, err := env.sched.Drift(ctx, "TW", "api"); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected ErrNoRows before any check, got %v", err)
+	}
+
+	sub := env.eventBus.Subscribe("contract.drift")
+	defer env.eventBus.Unsubscribe(sub)
+
+	st := projects.Defaults("TW")
+	st.ContractTargets = map[string]string{"*": backend.URL}
+	checks, err := env.sched.CheckDrift(ctx, st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(checks) != 1 || !checks[0].Drifting || checks[0].Failed != 1 || len(checks[0].Endpoints) != 2 {
+		t.Fatalf("unexpected checks: %+v", checks)
+	}
+
+	select {
+	case ev := <-sub.Ch:
+		var data struct {
+			Contract  string `json:"contract"`
+			Target    string `json:"target"`
+			Failed    int    `json:"failed"`
+			Endpoints []struct {
+				Endpoint string `json:"endpoint"`
+			} `json:"endpoints"`
+		}
+		json.Unmarshal(ev.Data, &data)
+		if data.Contract != "api" || data.Target != backend.URL || data.Failed != 1 ||
+			len(data.Endpoints) != 1 || data.Endpoints[0].Endpoint != "GET /api/items/1" {
+			t.Errorf("unexpected event data: %s", ev.Data)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected contract.drift event")
+	}
+
+	got, err := env.sched.Drift(ctx, "TW", "api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Drifting || got.Target != backend.URL || len(got.Endpoints) != 2 || got.Endpoints[1].Pass != true {
+		t.Errorf("unexpected stored drift: %+v", got)
+	}
+}
+
+func TestRunDueDriftChecksSkipsRecent(t *testing.T) {
+	env := setup(t)
+	ctx := context.Background()
+
+	var calls atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(200)
+	}))
+	defer backend.Close()
+
+	env.specReg.Put(ctx, "TW", "api", []byte(`{"kind":"contract","version":1,"endpoints":{"GET /ping":{"response_status":200}}}`))
+	settings := projects.New(env.db)
+	settings.Put(ctx, projects.Settings{Project: "TW", ContractTargets: map[string]string{"api": backend.URL}})
+	env.sched.SetProjectSettings(settings)
+
+	env.sched.RunDueDriftChecks(ctx)
+	env.sched.RunDueDriftChecks(ctx)
+	if calls.Load() != 1 {
+		t.Errorf("expected drift check to run once within its interval, ran %d times", calls.Load())
+	}
+	got, err := env.sched.Drift(ctx, "TW", "api")
+	if err != nil || got.Drifting {
+		t.Errorf("expected a passing check, got %+v, %v", got, err)
+	}
+}
@@ -0,0 +1,130 @@
+package compliance
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Sandbox incident kinds reported by agents or controllers.
+const (
+	KindWriteOutsideWorkspace = "write_outside_workspace"
+	KindCrossAgentRead        = "cross_agent_read"
+	KindOther                 = "other"
+)
+
+// ValidIncidentKind reports whether kind is a known sandbox incident kind.
+func ValidIncidentKind(kind string) bool {
+	switch kind {
+	case KindWriteOutsideWorkspace, KindCrossAgentRead, KindOther:
+		return true
+	}
+	return false
+}
+
+// Incident is a suspected sandbox violation by an agent instance.
+type Incident struct {
+	ID         int64     `json:"id"`
+	InstanceID string    `json:"instance_id"`
+	Kind       string    `json:"kind"`
+	Path       string    `json:"path,omitempty"`
+	Detail     string    `json:"detail,omitempty"`
+	ReportedBy string    `json:"reported_by,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// ReportIncident stores a sandbox incident and publishes a
+// compliance.sandbox_violation event, which webhooks can alert on.
+func (s *Scheduler) ReportIncident(ctx context.Context, inc Incident) (*Incident, error) {
+	if !ValidIncidentKind(inc.Kind) {
+		return nil, fmt.Errorf("unknown incident kind: %s", inc.Kind)
+	}
+	res, err := s.db.ExecContext(ctx,
+		`INSERT INTO sandbox_incidents (instance_id, kind, path, detail, reported_by, created_at)
+		 VALUES (?, ?, ?, ?, ?, datetime('now'))`,
+		inc.InstanceID, inc.Kind, inc.Path, inc.Detail, inc.ReportedBy)
+	if err != nil {
+		return nil, fmt.Errorf("insert sandbox incident: %w", err)
+	}
+	inc.ID, _ = res.LastInsertId()
+	inc.CreatedAt = time.Now().UTC()
+
+	data, _ := json.Marshal(inc)
+	s.eventBus.Publish(ctx, "compliance.sandbox_violation", data, "compliance")
+	return &inc, nil
+}
+
+// Incidents returns recent sandbox incidents, newest first, optionally
+// filtered by instance_id.
+func (s *Scheduler) Incidents(ctx context.Context, instanceID string, limit int) ([]Incident, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	query := `SELECT id, instance_id, kind, path, detail, reported_by, created_at FROM sandbox_incidents`
+	args := []any{}
+	if instanceID != "" {
+		query += ` WHERE instance_id = ?`
+		args = append(args, instanceID)
+	}
+	query += ` ORDER BY id DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query sandbox incidents: %w", err)
+	}
+	defer rows.Close()
+
+	var list []Incident
+	for rows.Next() {
+		var inc Incident
+		if err := rows.Scan(&inc.ID, &inc.InstanceID, &inc.Kind, &inc.Path, &inc.Detail, &inc.ReportedBy, &inc.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan sandbox incident: %w", err)
+		}
+		list = append(list, inc)
+	}
+	return list, rows.Err()
+}
+
+// incidentPenalty is the number of points each sandbox incident costs.
+const incidentPenalty = 20
+
+// Score summarises an instance's compliance since a point in time.
+type Score struct {
+	InstanceID string `json:"instance_id"`
+	Runs       int    `json:"runs"`
+	Passed     int    `json:"passed"`
+	Incidents  int    `json:"incidents"`
+	Score      int    `json:"score"`
+}
+
+// Score rates an instance from 0 to 100: the percentage of passing
+// compliance runs (100 if none), minus a fixed penalty per sandbox incident.
+func (s *Scheduler) Score(ctx context.Context, instanceID string, since time.Time) (*Score, error) {
+	sc := &Score{InstanceID: instanceID}
+	sinceStr := since.UTC().Format("2006-01-02 15:04:05")
+	err := s.db.QueryRowContext(ctx,
+		`SELECT COUNT(*), COALESCE(SUM(pass), 0) FROM compliance_runs
+		 WHERE instance_id = ? AND run_at >= ?`, instanceID, sinceStr).
+		Scan(&sc.Runs, &sc.Passed)
+	if err != nil {
+		return nil, fmt.Errorf("count compliance runs: %w", err)
+	}
+	err = s.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM sandbox_incidents WHERE instance_id = ? AND created_at >= ?`,
+		instanceID, sinceStr).Scan(&sc.Incidents)
+	if err != nil {
+		return nil, fmt.Errorf("count sandbox incidents: %w", err)
+	}
+
+	sc.Score = 100
+	if sc.Runs > 0 {
+		sc.Score = sc.Passed * 100 / sc.Runs
+	}
+	sc.Score -= sc.Incidents * incidentPenalty
+	if sc.Score < 0 {
+		sc.Score = 0
+	}
+	return sc, nil
+}
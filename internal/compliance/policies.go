@@ -0,0 +1,468 @@
+package compliance
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/DavidRHerbert/koor/internal/instances"
+	"github.com/DavidRHerbert/koor/internal/observability"
+	"github.com/DavidRHerbert/koor/internal/state"
+	"github.com/DavidRHerbert/koor/internal/tasks"
+	"github.com/google/uuid"
+)
+
+// Built-in policy checks.
+const (
+	CheckHeartbeat      = "heartbeat_freshness"    // params: max_age (default 5m)
+	CheckCapabilities   = "required_capabilities"  // params: capabilities
+	CheckStateKeys      = "required_state_keys"    // params: keys; {name} is the agent's name
+	CheckValidationPass = "recent_validation_pass" // params: within (default 24h)
+	CheckPendingTasks   = "max_pending_tasks"      // params: max
+)
+
+// Policy is a per-project compliance rule: a check with its parameters,
+// evaluated against every active agent of the project on each run.
+type Policy struct {
+	ID          string          `json:"id"`
+	Project     string          `json:"project"`
+	Name        string          `json:"name"`
+	Check       string          `json:"check"`
+	Params      json.RawMessage `json:"params,omitempty"`
+	Severity    string          `json:"severity"` // "error" fails the run; "warning" is only recorded
+	Description string          `json:"description,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+// Finding is one way an agent falls short of a policy.
+type Finding struct {
+	Policy   string `json:"policy"`
+	Check    string `json:"check"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// Check evaluates policies of one type. Validate checks a policy's params
+// when it is stored; Run returns a message for each way an agent falls
+// short of it.
+type Check struct {
+	Validate func(params json.RawMessage) error
+	Run      func(ctx context.Context, s *Scheduler, inst instances.Summary, params json.RawMessage) ([]string, error)
+}
+
+var checks = map[string]Check{
+	CheckHeartbeat:      {validateHeartbeat, runHeartbeat},
+	CheckCapabilities:   {validateCapabilities, runCapabilities},
+	CheckStateKeys:      {validateStateKeys, runStateKeys},
+	CheckValidationPass: {validateValidationPass, runValidationPass},
+	CheckPendingTasks:   {validatePendingTasks, runPendingTasks},
+}
+
+// RegisterCheck adds a policy check type, or replaces a built-in one.
+// It must be called before the scheduler runs.
+func RegisterCheck(name string, c Check) {
+	checks[name] = c
+}
+
+// Checks returns the names of the registered policy checks, sorted.
+func Checks() []string {
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ValidatePolicy checks that a policy is well-formed, defaulting its
+// severity and name.
+func ValidatePolicy(p *Policy) error {
+	if p.Project == "" {
+		return fmt.Errorf("project is required")
+	}
+	c, ok := checks[p.Check]
+	if !ok {
+		return fmt.Errorf("unknown check %q (want one of %s)", p.Check, strings.Join(Checks(), ", "))
+	}
+	switch p.Severity {
+	case "":
+		p.Severity = "error"
+	case "error", "warning":
+	default:
+		return fmt.Errorf("severity must be error or warning")
+	}
+	if p.Name == "" {
+		p.Name = p.Check
+	}
+	if len(p.Params) == 0 {
+		p.Params = json.RawMessage("{}")
+	}
+	if c.Validate != nil {
+		if err := c.Validate(p.Params); err != nil {
+			return fmt.Errorf("%s params: %w", p.Check, err)
+		}
+	}
+	return nil
+}
+
+// SetState attaches the state store used by required_state_keys checks.
+func (s *Scheduler) SetState(st *state.Store) {
+	s.state = st
+}
+
+// SetMetrics attaches the metrics store used by recent_validation_pass
+// checks.
+func (s *Scheduler) SetMetrics(m *observability.Store) {
+	s.metrics = m
+}
+
+// SetTasks attaches the task queue used by max_pending_tasks checks.
+func (s *Scheduler) SetTasks(t *tasks.Store) {
+	s.tasks = t
+}
+
+const selectPolicy = `SELECT id, project, name, check_type, params, severity, description, created_at, updated_at
+	FROM compliance_policies`
+
+func scanPolicy(row rowScanner) (*Policy, error) {
+	var p Policy
+	var params string
+	if err := row.Scan(&p.ID, &p.Project, &p.Name, &p.Check, &params, &p.Severity, &p.Description,
+		&p.CreatedAt, &p.UpdatedAt); err != nil {
+		return nil, err
+	}
+	p.Params = json.RawMessage(params)
+	return &p, nil
+}
+
+// AddPolicy validates and stores a compliance policy.
+func (s *Scheduler) AddPolicy(ctx context.Context, p Policy) (*Policy, error) {
+	if err := ValidatePolicy(&p); err != nil {
+		return nil, err
+	}
+	p.ID = uuid.New().String()
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO compliance_policies (id, project, name, check_type, params, severity, description, created_at, updated_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, datetime('now'), datetime('now'))`,
+		p.ID, p.Project, p.Name, p.Check, string(p.Params), p.Severity, p.Description)
+	if err != nil {
+		return nil, fmt.Errorf("insert compliance policy: %w", err)
+	}
+	return s.GetPolicy(ctx, p.ID)
+}
+
+// UpdatePolicy replaces a policy's definition. Returns sql.ErrNoRows if
+// not found.
+func (s *Scheduler) UpdatePolicy(ctx context.Context, p Policy) (*Policy, error) {
+	if err := ValidatePolicy(&p); err != nil {
+		return nil, err
+	}
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE compliance_policies SET project = ?, name = ?, check_type = ?, params = ?, severity = ?,
+			description = ?, updated_at = datetime('now')
+		 WHERE id = ?`,
+		p.Project, p.Name, p.Check, string(p.Params), p.Severity, p.Description, p.ID)
+	if err != nil {
+		return nil, fmt.Errorf("update compliance policy: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return s.GetPolicy(ctx, p.ID)
+}
+
+// GetPolicy returns a policy by ID. Returns sql.ErrNoRows if not found.
+func (s *Scheduler) GetPolicy(ctx context.Context, id string) (*Policy, error) {
+	return scanPolicy(s.db.QueryRowContext(ctx, selectPolicy+` WHERE id = ?`, id))
+}
+
+// ListPolicies returns the policies of a project, or of every project if
+// project is empty.
+func (s *Scheduler) ListPolicies(ctx context.Context, project string) ([]Policy, error) {
+	query, args := selectPolicy, []any{}
+	if project != "" {
+		query += ` WHERE project = ?`
+		args = append(args, project)
+	}
+	rows, err := s.db.QueryContext(ctx, query+` ORDER BY project, name, id`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query compliance policies: %w", err)
+	}
+	defer rows.Close()
+
+	list := []Policy{}
+	for rows.Next() {
+		p, err := scanPolicy(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan compliance policy: %w", err)
+		}
+		list = append(list, *p)
+	}
+	return list, rows.Err()
+}
+
+// DeletePolicy removes a policy. Returns sql.ErrNoRows if not found.
+func (s *Scheduler) DeletePolicy(ctx context.Context, id string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM compliance_policies WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("delete compliance policy: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// checkPolicies evaluates the policies of an instance's project, storing
+// one run per policy. Policies whose check cannot run are logged and
+// skipped rather than failed.
+func (s *Scheduler) checkPolicies(ctx context.Context, inst instances.Summary) []Run {
+	project := inst.Project
+	if project == "" {
+		project = inst.Workspace
+	}
+	if project == "" {
+		return nil
+	}
+	policies, err := s.ListPolicies(ctx, project)
+	if err != nil {
+		s.logger.Error("compliance: list policies", "project", project, "error", err)
+		return nil
+	}
+
+	var runs []Run
+	for _, p := range policies {
+		c, ok := checks[p.Check]
+		if !ok {
+			s.logger.Warn("compliance: unknown policy check", "policy", p.ID, "check", p.Check)
+			continue
+		}
+		messages, err := c.Run(ctx, s, inst, p.Params)
+		if err != nil {
+			s.logger.Error("compliance: policy check", "policy", p.ID, "instance", inst.ID, "error", err)
+			continue
+		}
+		findings := []Finding{}
+		for _, m := range messages {
+			findings = append(findings, Finding{Policy: p.Name, Check: p.Check, Severity: p.Severity, Message: m})
+		}
+		pass := len(findings) == 0 || p.Severity == "warning"
+
+		run := s.storePolicyRun(ctx, inst.ID, project, p.Name, pass, findings)
+		if run != nil {
+			runs = append(runs, *run)
+		}
+		if !pass {
+			data, _ := json.Marshal(map[string]any{
+				"instance_id": inst.ID,
+				"project":     project,
+				"policy":      p.Name,
+				"findings":    findings,
+			})
+			s.eventBus.Publish(ctx, "compliance.violation", data, "compliance-scheduler")
+		}
+	}
+	return runs
+}
+
+// storePolicyRun persists the result of one policy check.
+func (s *Scheduler) storePolicyRun(ctx context.Context, instanceID, project, policy string, pass bool, findings []Finding) *Run {
+	passInt := 0
+	if pass {
+		passInt = 1
+	}
+	findingsJSON, _ := json.Marshal(findings)
+	res, err := s.db.ExecContext(ctx,
+		`INSERT INTO compliance_runs (instance_id, project, contract, policy, pass, violations, findings, run_at)
+		 VALUES (?, ?, '', ?, ?, '[]', ?, datetime('now'))`,
+		instanceID, project, policy, passInt, string(findingsJSON))
+	if err != nil {
+		s.logger.Error("store compliance run", "error", err)
+		return nil
+	}
+	id, _ := res.LastInsertId()
+	return &Run{
+		ID:         id,
+		InstanceID: instanceID,
+		Project:    project,
+		Policy:     policy,
+		Pass:       pass,
+		Violations: json.RawMessage("[]"),
+		Findings:   findings,
+		RunAt:      time.Now().UTC(),
+	}
+}
+
+// --- Built-in checks ---
+
+// durationParam reads an optional Go duration from params[field].
+func durationParam(params json.RawMessage, field string, def time.Duration) (time.Duration, error) {
+	var p map[string]any
+	if err := json.Unmarshal(params, &p); err != nil {
+		return 0, fmt.Errorf("params must be an object")
+	}
+	v, ok := p[field]
+	if !ok {
+		return def, nil
+	}
+	str, _ := v.(string)
+	d, err := time.ParseDuration(str)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("%s must be a positive duration such as \"5m\"", field)
+	}
+	return d, nil
+}
+
+// listParam reads a non-empty list of strings from params[field].
+func listParam(params json.RawMessage, field string) ([]string, error) {
+	var p map[string]json.RawMessage
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, fmt.Errorf("params must be an object")
+	}
+	var list []string
+	if err := json.Unmarshal(p[field], &list); err != nil || len(list) == 0 {
+		return nil, fmt.Errorf("%s must be a non-empty list of strings", field)
+	}
+	return list, nil
+}
+
+func validateHeartbeat(params json.RawMessage) error {
+	_, err := durationParam(params, "max_age", 5*time.Minute)
+	return err
+}
+
+func runHeartbeat(_ context.Context, _ *Scheduler, inst instances.Summary, params json.RawMessage) ([]string, error) {
+	maxAge, err := durationParam(params, "max_age", 5*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	if age := time.Since(inst.LastSeen); age > maxAge {
+		return []string{fmt.Sprintf("last heartbeat %s ago, more than %s", age.Round(time.Second), maxAge)}, nil
+	}
+	return nil, nil
+}
+
+func validateCapabilities(params json.RawMessage) error {
+	_, err := listParam(params, "capabilities")
+	return err
+}
+
+func runCapabilities(_ context.Context, _ *Scheduler, inst instances.Summary, params json.RawMessage) ([]string, error) {
+	required, err := listParam(params, "capabilities")
+	if err != nil {
+		return nil, err
+	}
+	var messages []string
+	for _, c := range required {
+		if !slices.Contains(inst.Capabilities, c) {
+			messages = append(messages, "missing capability "+c)
+		}
+	}
+	return messages, nil
+}
+
+func validateStateKeys(params json.RawMessage) error {
+	_, err := listParam(params, "keys")
+	return err
+}
+
+func runStateKeys(ctx context.Context, s *Scheduler, inst instances.Summary, params json.RawMessage) ([]string, error) {
+	if s.state == nil {
+		return nil, fmt.Errorf("state store not configured")
+	}
+	keys, err := listParam(params, "keys")
+	if err != nil {
+		return nil, err
+	}
+	var messages []string
+	for _, key := range keys {
+		key = strings.ReplaceAll(key, "{name}", inst.Name)
+		_, err := s.state.Get(ctx, key)
+		if errors.Is(err, sql.ErrNoRows) {
+			messages = append(messages, "missing state key "+key)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return messages, nil
+}
+
+func validateValidationPass(params json.RawMessage) error {
+	_, err := durationParam(params, "within", 24*time.Hour)
+	return err
+}
+
+func runValidationPass(ctx context.Context, s *Scheduler, inst instances.Summary, params json.RawMessage) ([]string, error) {
+	if s.metrics == nil {
+		return nil, fmt.Errorf("metrics store not configured")
+	}
+	within, err := durationParam(params, "within", 24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	total, failed, err := s.metrics.Outcomes(ctx, inst.ID, "validations", time.Now().Add(-within))
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case total == 0:
+		return []string{fmt.Sprintf("no validation in the last %s", within)}, nil
+	case total == failed:
+		return []string{fmt.Sprintf("all %d validations in the last %s failed", total, within)}, nil
+	}
+	return nil, nil
+}
+
+// pendingParams reads the max param of a max_pending_tasks policy.
+func pendingParams(params json.RawMessage) (int, error) {
+	var p struct {
+		Max *int `json:"max"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil || p.Max == nil || *p.Max < 0 {
+		return 0, fmt.Errorf("max must be a non-negative number")
+	}
+	return *p.Max, nil
+}
+
+func validatePendingTasks(params json.RawMessage) error {
+	_, err := pendingParams(params)
+	return err
+}
+
+// runPendingTasks counts the pending tasks in the agent's own queue (its
+// role, by the "{project}-{role}" naming convention). Agents that do not
+// follow the convention have no queue and always pass.
+func runPendingTasks(ctx context.Context, s *Scheduler, inst instances.Summary, params json.RawMessage) ([]string, error) {
+	if s.tasks == nil {
+		return nil, fmt.Errorf("task queue not configured")
+	}
+	limit, err := pendingParams(params)
+	if err != nil {
+		return nil, err
+	}
+	project := inst.Project
+	if project == "" {
+		project = inst.Workspace
+	}
+	queue := tasks.DefaultQueue(project, inst.Name)
+	if queue == "" {
+		return nil, nil
+	}
+	pending, err := s.tasks.List(ctx, tasks.Filter{Project: project, Queue: queue, Status: tasks.StatusPending})
+	if err != nil {
+		return nil, err
+	}
+	if len(pending) > limit {
+		return []string{fmt.Sprintf("%d pending tasks in queue %s, more than %d", len(pending), queue, limit)}, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,136 @@
+package compliance_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/DavidRHerbert/koor/internal/compliance"
+	"github.com/DavidRHerbert/koor/internal/observability"
+	"github.com/DavidRHerbert/koor/internal/state"
+	"github.com/DavidRHerbert/koor/internal/tasks"
+)
+
+func TestValidatePolicy(t *testing.T) {
+	bad := []compliance.Policy{
+		{Check: compliance.CheckHeartbeat},
+		{Project: "TW", Check: "nope"},
+		{Project: "TW", Check: compliance.CheckHeartbeat, Severity: "fatal"},
+		{Project: "TW", Check: compliance.CheckHeartbeat, Params: json.RawMessage(`{"max_age":"soon"}`)},
+		{Project: "TW", Check: compliance.CheckCapabilities},
+		{Project: "TW", Check: compliance.CheckStateKeys, Params: json.RawMessage(`{"keys":[]}`)},
+		{Project: "TW", Check: compliance.CheckPendingTasks, Params: json.RawMessage(`{"max":-1}`)},
+	}
+	for _, p := range bad {
+		if err := compliance.ValidatePolicy(&p); err == nil {
+			t.Errorf("expected %+v to be invalid", p)
+		}
+	}
+	p := compliance.Policy{Project: "TW", Check: compliance.CheckHeartbeat}
+	if err := compliance.ValidatePolicy(&p); err != nil || p.Severity != "error" || p.Name != compliance.CheckHeartbeat {
+		t.Errorf("expected defaults, got %+v, %v", p, err)
+	}
+}
+
+func TestPolicyCRUD(t *testing.T) {
+	env := setup(t)
+	ctx := context.Background()
+
+	p, err := env.sched.AddPolicy(ctx, compliance.Policy{Project: "TW", Check: compliance.CheckCapabilities,
+		Params: json.RawMessage(`{"capabilities":["go"]}`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Severity = "warning"
+	if p, err = env.sched.UpdatePolicy(ctx, *p); err != nil || p.Severity != "warning" {
+		t.Fatalf("update: %+v, %v", p, err)
+	}
+	if list, _ := env.sched.ListPolicies(ctx, "Other"); len(list) != 0 {
+		t.Errorf("expected no policies for Other, got %d", len(list))
+	}
+	if err := env.sched.DeletePolicy(ctx, p.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.sched.GetPolicy(ctx, p.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected ErrNoRows after delete, got %v", err)
+	}
+}
+
+func TestRunAllPolicies(t *testing.T) {
+	env := setup(t)
+	ctx := context.Background()
+	st := state.New(env.db)
+	metrics := observability.New(env.db)
+	queue := tasks.New(env.db, nil)
+	env.sched.SetState(st)
+	env.sched.SetMetrics(metrics)
+	env.sched.SetTasks(queue)
+
+	inst, _ := env.instanceReg.Register(ctx, "TW-backend", "TW", "testing", "go")
+	env.instanceReg.Activate(ctx, inst.ID)
+	env.instanceReg.SetCapabilities(ctx, inst.ID, []string{"go"})
+	st.Put(ctx, "TW/agents/TW-backend", []byte(`{}`), "application/json", "test")
+	metrics.RecordOutcome(ctx, inst.ID, "validations", false)
+	queue.Create(ctx, tasks.Task{Project: "TW", Queue: "backend", Title: "one"})
+	queue.Create(ctx, tasks.Task{Project: "TW", Queue: "backend", Title: "two"})
+
+	add := func(check, params, severity string) {
+		t.Helper()
+		if _, err := env.sched.AddPolicy(ctx, compliance.Policy{Project: "TW", Name: check, Check: check,
+			Params: json.RawMessage(params), Severity: severity}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	add(compliance.CheckHeartbeat, `{"max_age":"1h"}`, "")
+	add(compliance.CheckCapabilities, `{"capabilities":["go","docker"]}`, "")
+	add(compliance.CheckStateKeys, `{"keys":["TW/agents/{name}","TW/config"]}`, "warning")
+	add(compliance.CheckValidationPass, `{"within":"2h"}`, "")
+	add(compliance.CheckPendingTasks, `{"max":1}`, "")
+
+	sub := env.eventBus.Subscribe("compliance.violation")
+	defer env.eventBus.Unsubscribe(sub)
+
+	runs := env.sched.RunAll(ctx)
+	if len(runs) != 5 {
+		t.Fatalf("expected 5 policy runs, got %d", len(runs))
+	}
+	want := map[string]struct {
+		pass    bool
+		finding string
+	}{
+		compliance.CheckHeartbeat:      {true, ""},
+		compliance.CheckCapabilities:   {false, "missing capability docker"},
+		compliance.CheckStateKeys:      {true, "missing state key TW/config"},
+		compliance.CheckValidationPass: {true, ""},
+		compliance.CheckPendingTasks:   {false, "2 pending tasks in queue backend"},
+	}
+	for _, run := range runs {
+		w := want[run.Policy]
+		if run.Pass != w.pass || run.Contract != "" || run.InstanceID != inst.ID {
+			t.Errorf("%s: unexpected run %+v", run.Policy, run)
+		}
+		if w.finding == "" && len(run.Findings) != 0 {
+			t.Errorf("%s: unexpected findings %+v", run.Policy, run.Findings)
+		}
+		if w.finding != "" && (len(run.Findings) != 1 || !strings.HasPrefix(run.Findings[0].Message, w.finding) ||
+			run.Findings[0].Check != run.Policy) {
+			t.Errorf("%s: expected finding %q, got %+v", run.Policy, w.finding, run.Findings)
+		}
+	}
+	if n := len(sub.Ch); n != 2 {
+		t.Errorf("expected 2 compliance.violation events, got %d", n)
+	}
+
+	history, _ := env.sched.History(ctx, inst.ID, 10)
+	if len(history) != 5 || history[0].Policy == "" {
+		t.Fatalf("unexpected history: %+v", history)
+	}
+	for _, run := range history {
+		if run.Policy == compliance.CheckCapabilities && (len(run.Findings) != 1 || run.Findings[0].Severity != "error") {
+			t.Errorf("findings not stored: %+v", run)
+		}
+	}
+}
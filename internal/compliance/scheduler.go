@@ -6,26 +6,35 @@ import (
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"sync"
 	"time"
 
 	"github.com/DavidRHerbert/koor/internal/contracts"
 	"github.com/DavidRHerbert/koor/internal/events"
 	"github.com/DavidRHerbert/koor/internal/instances"
+	"github.com/DavidRHerbert/koor/internal/observability"
+	"github.com/DavidRHerbert/koor/internal/projects"
 	"github.com/DavidRHerbert/koor/internal/specs"
+	"github.com/DavidRHerbert/koor/internal/state"
+	"github.com/DavidRHerbert/koor/internal/tasks"
 )
 
-// Run represents a single compliance check result.
+// Run represents a single compliance check result: of a contract, with
+// its violations, or of a policy, with its findings.
 type Run struct {
 	ID         int64           `json:"id"`
 	InstanceID string          `json:"instance_id"`
 	Project    string          `json:"project"`
 	Contract   string          `json:"contract"`
+	Policy     string          `json:"policy,omitempty"`
 	Pass       bool            `json:"pass"`
 	Violations json.RawMessage `json:"violations"`
+	Findings   []Finding       `json:"findings,omitempty"`
 	RunAt      time.Time       `json:"run_at"`
 }
 
-// Scheduler periodically validates active agents against their contracts.
+// Scheduler periodically validates active agents against their contracts
+// and their projects' policies.
 type Scheduler struct {
 	db          *sql.DB
 	instanceReg *instances.Registry
@@ -34,6 +43,13 @@ type Scheduler struct {
 	interval    time.Duration
 	logger      *slog.Logger
 	stop        chan struct{}
+
+	settings  *projects.Store
+	state     *state.Store
+	metrics   *observability.Store
+	tasks     *tasks.Store
+	mu        sync.Mutex
+	lastDrift map[string]time.Time // project -> last drift check
 }
 
 // New creates a new compliance Scheduler.
@@ -46,6 +62,7 @@ func New(db *sql.DB, instanceReg *instances.Registry, specReg *specs.Registry, e
 		interval:    interval,
 		logger:      logger,
 		stop:        make(chan struct{}),
+		lastDrift:   map[string]time.Time{},
 	}
 }
 
@@ -54,10 +71,17 @@ func (s *Scheduler) Start() {
 	go func() {
 		ticker := time.NewTicker(s.interval)
 		defer ticker.Stop()
+		// Contract test schedules and drift checks have their own
+		// intervals; check them every minute.
+		contractTicker := time.NewTicker(time.Minute)
+		defer contractTicker.Stop()
 		for {
 			select {
 			case <-ticker.C:
 				s.RunAll(context.Background())
+			case <-contractTicker.C:
+				s.RunDueContractTests(context.Background())
+				s.RunDueDriftChecks(context.Background())
 			case <-s.stop:
 				return
 			}
@@ -73,8 +97,8 @@ func (s *Scheduler) Stop() {
 	}
 }
 
-// RunAll validates all active instances against their project contracts.
-// Returns the list of runs performed.
+// RunAll validates all active instances against their project contracts
+// and policies. Returns the list of runs performed.
 func (s *Scheduler) RunAll(ctx context.Context) []Run {
 	active, err := s.instanceReg.ListByStatus(ctx, "active")
 	if err != nil {
@@ -84,8 +108,8 @@ func (s *Scheduler) RunAll(ctx context.Context) []Run {
 
 	var runs []Run
 	for _, inst := range active {
-		instRuns := s.checkInstance(ctx, inst)
-		runs = append(runs, instRuns...)
+		runs = append(runs, s.checkInstance(ctx, inst)...)
+		runs = append(runs, s.checkPolicies(ctx, inst)...)
 	}
 	return runs
 }
@@ -120,20 +144,36 @@ func (s *Scheduler) checkInstance(ctx context.Context, inst instances.Summary) [
 		violations := []contracts.Violation{}
 		if len(contract.Endpoints) == 0 {
 			violations = append(violations, contracts.Violation{
-				Path:    "endpoints",
-				Message: "contract has no endpoints defined",
+				Path:     "endpoints",
+				Message:  "contract has no endpoints defined",
+				Severity: "error",
 			})
 		}
+		today := time.Now().UTC().Format("2006-01-02")
 		for ep, def := range contract.Endpoints {
 			if len(def.Request) == 0 && len(def.Response) == 0 && len(def.ResponseArray) == 0 && len(def.Query) == 0 {
 				violations = append(violations, contracts.Violation{
-					Path:    "endpoints." + ep,
-					Message: "endpoint has no request, response, or query schema defined",
+					Path:     "endpoints." + ep,
+					Message:  "endpoint has no request, response, or query schema defined",
+					Severity: "error",
+				})
+			}
+			if def.Deprecated && def.Sunset != "" && def.Sunset < today {
+				violations = append(violations, contracts.Violation{
+					Path:     "endpoints." + ep,
+					Message:  "deprecated endpoint is past its sunset date " + def.Sunset,
+					Severity: "warning",
 				})
 			}
 		}
 
-		pass := len(violations) == 0
+		// Warnings are recorded but only errors fail the run.
+		pass := true
+		for _, v := range violations {
+			if v.Severity != "warning" {
+				pass = false
+			}
+		}
 		violationsJSON, _ := json.Marshal(violations)
 
 		run := s.storeRun(ctx, inst.ID, project, sp.Name, pass, violationsJSON)
@@ -190,29 +230,57 @@ func (s *Scheduler) History(ctx context.Context, instanceID string, limit int) (
 	var err error
 	if instanceID != "" {
 		rows, err = s.db.QueryContext(ctx,
-			`SELECT id, instance_id, project, contract, pass, violations, run_at
+			`SELECT id, instance_id, project, contract, policy, pass, violations, findings, run_at
 			 FROM compliance_runs WHERE instance_id = ? ORDER BY id DESC LIMIT ?`,
 			instanceID, limit)
 	} else {
 		rows, err = s.db.QueryContext(ctx,
-			`SELECT id, instance_id, project, contract, pass, violations, run_at
+			`SELECT id, instance_id, project, contract, policy, pass, violations, findings, run_at
 			 FROM compliance_runs ORDER BY id DESC LIMIT ?`, limit)
 	}
 	if err != nil {
 		return nil, fmt.Errorf("query compliance runs: %w", err)
 	}
+	return scanRuns(rows)
+}
+
+// Failures returns the failed compliance runs at or after a time, newest
+// first, optionally for one project.
+func (s *Scheduler) Failures(ctx context.Context, project string, since time.Time, limit int) ([]Run, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	query := `SELECT id, instance_id, project, contract, policy, pass, violations, findings, run_at
+	          FROM compliance_runs WHERE pass = 0 AND run_at >= ?`
+	args := []any{since.UTC().Format("2006-01-02 15:04:05")}
+	if project != "" {
+		query += ` AND lower(project) = lower(?)`
+		args = append(args, project)
+	}
+	query += ` ORDER BY id DESC LIMIT ?`
+	args = append(args, limit)
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query compliance failures: %w", err)
+	}
+	return scanRuns(rows)
+}
+
+// scanRuns reads and closes rows of compliance runs.
+func scanRuns(rows *sql.Rows) ([]Run, error) {
 	defer rows.Close()
 
 	var runs []Run
 	for rows.Next() {
 		var r Run
 		var passInt int
-		var runAt, violations string
-		if err := rows.Scan(&r.ID, &r.InstanceID, &r.Project, &r.Contract, &passInt, &violations, &runAt); err != nil {
+		var runAt, violations, findings string
+		if err := rows.Scan(&r.ID, &r.InstanceID, &r.Project, &r.Contract, &r.Policy, &passInt, &violations, &findings, &runAt); err != nil {
 			return nil, fmt.Errorf("scan compliance run: %w", err)
 		}
 		r.Pass = passInt == 1
 		r.Violations = json.RawMessage(violations)
+		json.Unmarshal([]byte(findings), &r.Findings)
 		r.RunAt, _ = time.Parse("2006-01-02 15:04:05", runAt)
 		runs = append(runs, r)
 	}
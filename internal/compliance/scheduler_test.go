@@ -114,6 +114,32 @@ func TestRunAllWithContractFail(t *testing.T) {
 	}
 }
 
+func TestRunAllSunsetIsWarning(t *testing.T) {
+	env := setup(t)
+	ctx := context.Background()
+
+	inst, _ := env.instanceReg.Register(ctx, "agent-1", "MyProject", "testing", "go")
+	env.instanceReg.Activate(ctx, inst.ID)
+
+	contract := `{"kind":"contract","version":1,"endpoints":{"GET /api/old":{"deprecated":true,"sunset":"2020-01-01","response":{"id":{"type":"string"}}}}}`
+	env.specReg.Put(ctx, "MyProject", "api-contract", []byte(contract))
+
+	runs := env.sched.RunAll(ctx)
+	if len(runs) != 1 {
+		t.Fatalf("expected 1 run, got %d", len(runs))
+	}
+	if !runs[0].Pass {
+		t.Error("warnings alone should not fail the run")
+	}
+	var violations []struct {
+		Severity string `json:"severity"`
+	}
+	json.Unmarshal(runs[0].Violations, &violations)
+	if len(violations) != 1 || violations[0].Severity != "warning" {
+		t.Errorf("expected one warning, got %s", runs[0].Violations)
+	}
+}
+
 func TestRunAllSkipsNonContractSpecs(t *testing.T) {
 	env := setup(t)
 	ctx := context.Background()
@@ -242,3 +268,79 @@ func TestHistoryAfterRun(t *testing.T) {
 		t.Errorf("expected 0 runs for nonexistent instance, got %d", len(runs3))
 	}
 }
+
+func TestFailures(t *testing.T) {
+	env := setup(t)
+	ctx := context.Background()
+
+	inst, _ := env.instanceReg.Register(ctx, "agent-1", "MyProject", "testing", "go")
+	env.instanceReg.Activate(ctx, inst.ID)
+	env.specReg.Put(ctx, "MyProject", "bad-contract", []byte(`{"kind":"contract","version":1,"endpoints":{"GET /api/empty":{"response_status":200}}}`))
+	env.sched.RunAll(ctx)
+
+	hourAgo := time.Now().Add(-time.Hour)
+	runs, err := env.sched.Failures(ctx, "myproject", hourAgo, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 1 || runs[0].Contract != "bad-contract" {
+		t.Fatalf("expected the failed run, got %+v", runs)
+	}
+	if runs, _ := env.sched.Failures(ctx, "Other", hourAgo, 10); len(runs) != 0 {
+		t.Errorf("expected no failures for another project, got %+v", runs)
+	}
+	if runs, _ := env.sched.Failures(ctx, "", time.Now().Add(time.Minute), 10); len(runs) != 0 {
+		t.Errorf("expected no failures after the run, got %+v", runs)
+	}
+}
+
+func TestSandboxIncidentsAffectScore(t *testing.T) {
+	env := setup(t)
+	ctx := context.Background()
+	sub := env.eventBus.Subscribe("compliance.sandbox_violation")
+	defer env.eventBus.Unsubscribe(sub)
+
+	if _, err := env.sched.ReportIncident(ctx, compliance.Incident{InstanceID: "a1", Kind: "bogus"}); err == nil {
+		t.Error("expected error for unknown kind")
+	}
+	inc, err := env.sched.ReportIncident(ctx, compliance.Incident{
+		InstanceID: "a1",
+		Kind:       compliance.KindWriteOutsideWorkspace,
+		Path:       "/etc/hosts",
+		ReportedBy: "controller",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inc.ID == 0 {
+		t.Error("expected incident ID")
+	}
+
+	select {
+	case ev := <-sub.Ch:
+		var got compliance.Incident
+		json.Unmarshal(ev.Data, &got)
+		if got.Path != "/etc/hosts" {
+			t.Errorf("unexpected event data: %s", ev.Data)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected compliance.sandbox_violation event")
+	}
+
+	list, err := env.sched.Incidents(ctx, "a1", 10)
+	if err != nil || len(list) != 1 || list[0].Kind != compliance.KindWriteOutsideWorkspace {
+		t.Fatalf("unexpected incidents: %v %+v", err, list)
+	}
+
+	score, err := env.sched.Score(ctx, "a1", time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if score.Incidents != 1 || score.Score != 80 {
+		t.Errorf("expected 1 incident and score 80, got %+v", score)
+	}
+	clean, _ := env.sched.Score(ctx, "b2", time.Now().Add(-time.Hour))
+	if clean.Score != 100 {
+		t.Errorf("expected clean instance to score 100, got %+v", clean)
+	}
+}
@@ -0,0 +1,216 @@
+package contracts
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+)
+
+// Change is one difference between two versions of a contract.
+type Change struct {
+	Path     string `json:"path"`     // e.g. "POST /api/trucks request.owner.name"
+	Kind     string `json:"kind"`     // removed, added, type_changed, now_required, ...
+	Breaking bool   `json:"breaking"` // false means additive: existing consumers keep working
+	Message  string `json:"message"`
+}
+
+// Compatibility is the result of comparing two contract versions.
+type Compatibility struct {
+	FromVersion int      `json:"from_version"` // the contracts' declared versions
+	ToVersion   int      `json:"to_version"`
+	Compatible  bool     `json:"compatible"` // no breaking changes
+	Breaking    []Change `json:"breaking"`
+	Additive    []Change `json:"additive"`
+}
+
+// Shapes sent by consumers (query, request) and shapes they receive
+// (responses, errors) break in opposite ways: a consumer must keep being
+// accepted, and must keep understanding what it gets back.
+const (
+	sent     = true
+	received = false
+)
+
+// Diff compares two contracts and classifies each change as breaking or
+// additive for the consumers of from. Removed endpoints and fields,
+// type changes and new required request fields are breaking; new
+// endpoints and new optional fields are additive.
+func Diff(from, to *Contract) *Compatibility {
+	d := &differ{}
+	for _, name := range endpointNames(from.Endpoints, to.Endpoints) {
+		o, inOld := from.Endpoints[name]
+		n, inNew := to.Endpoints[name]
+		switch {
+		case !inNew:
+			d.add(name, "removed", true, "endpoint removed")
+		case !inOld:
+			d.add(name, "added", false, "endpoint added")
+		default:
+			d.endpoint(name, o, n)
+		}
+	}
+
+	c := &Compatibility{FromVersion: from.Version, ToVersion: to.Version, Breaking: []Change{}, Additive: []Change{}}
+	for _, ch := range d.changes {
+		if ch.Breaking {
+			c.Breaking = append(c.Breaking, ch)
+		} else {
+			c.Additive = append(c.Additive, ch)
+		}
+	}
+	c.Compatible = len(c.Breaking) == 0
+	return c
+}
+
+type differ struct {
+	changes []Change
+}
+
+func (d *differ) add(path, kind string, breaking bool, format string, args ...any) {
+	d.changes = append(d.changes, Change{Path: path, Kind: kind, Breaking: breaking, Message: fmt.Sprintf(format, args...)})
+}
+
+func (d *differ) endpoint(name string, o, n Endpoint) {
+	if n.Deprecated && !o.Deprecated {
+		d.add(name, "deprecated", false, "endpoint deprecated")
+	}
+	d.fields(name+" query", o.Query, n.Query, sent)
+	d.fields(name+" request", o.Request, n.Request, sent)
+
+	switch {
+	case o.Response != nil && n.Response == nil && n.ResponseArray != nil,
+		o.ResponseArray != nil && o.Response == nil && n.Response != nil:
+		d.add(name+" response", "type_changed", true, "response changed between an object and an array")
+	default:
+		d.fields(name+" response", o.Response, n.Response, received)
+		d.fields(name+" response_array", o.ResponseArray, n.ResponseArray, received)
+	}
+	if o.ResponseStatus != n.ResponseStatus && o.ResponseStatus != 0 {
+		d.add(name+" response_status", "status_changed", true, "response status changed from %d to %d", o.ResponseStatus, n.ResponseStatus)
+	}
+	d.fields(name+" error", o.Error, n.Error, received)
+
+	for _, status := range statusCodes(o.Responses, n.Responses) {
+		path := name + " responses." + strconv.Itoa(status)
+		of, inOld := o.Responses[status]
+		nf, inNew := n.Responses[status]
+		switch {
+		case !inNew:
+			d.add(path, "removed", true, "response for status %d removed", status)
+		case !inOld:
+			d.add(path, "added", false, "response for status %d added", status)
+		default:
+			d.fields(path, of, nf, received)
+		}
+	}
+}
+
+// fields compares two field sets at path. sent says whether consumers
+// send these fields (query, request) or receive them.
+func (d *differ) fields(path string, o, n map[string]Field, sent bool) {
+	for _, name := range fieldNames(mergeFields(o, n)) {
+		of, inOld := o[name]
+		nf, inNew := n[name]
+		fp := joinPath(path, name)
+		switch {
+		case !inNew:
+			d.add(fp, "removed", true, "field removed")
+		case !inOld && sent && nf.Required:
+			d.add(fp, "added", true, "new required field")
+		case !inOld:
+			d.add(fp, "added", false, "field added")
+		default:
+			d.field(fp, of, nf, sent)
+		}
+	}
+}
+
+func (d *differ) field(path string, o, n Field, sent bool) {
+	if o.Type != n.Type {
+		d.add(path, "type_changed", true, "type changed from %s to %s", o.Type, n.Type)
+		return
+	}
+	switch {
+	case !o.Required && n.Required:
+		// A consumer that omits it is now rejected; one that reads it can rely on it.
+		d.add(path, "now_required", sent, "field is now required")
+	case o.Required && !n.Required:
+		d.add(path, "now_optional", !sent, "field is now optional")
+	}
+	switch {
+	case o.Nullable && !n.Nullable:
+		d.add(path, "not_nullable", sent, "field no longer accepts null")
+	case !o.Nullable && n.Nullable:
+		d.add(path, "nullable", !sent, "field may now be null")
+	}
+	if len(o.Enum) > 0 || len(n.Enum) > 0 {
+		for _, v := range o.Enum {
+			if len(n.Enum) > 0 && !slices.Contains(n.Enum, v) {
+				d.add(path, "enum_value_removed", sent, "enum value %q removed", v)
+			}
+		}
+		for _, v := range n.Enum {
+			if len(o.Enum) == 0 {
+				d.add(path, "enum_added", sent, "field restricted to an enum")
+				break
+			}
+			if !slices.Contains(o.Enum, v) {
+				d.add(path, "enum_value_added", !sent, "enum value %q added", v)
+			}
+		}
+	}
+	if n.Deprecated && !o.Deprecated {
+		d.add(path, "deprecated", false, "field deprecated")
+	}
+	d.fields(path, o.Fields, n.Fields, sent)
+	switch {
+	case o.Items != nil && n.Items != nil:
+		d.field(path+"[]", *o.Items, *n.Items, sent)
+	case o.Items != nil:
+		d.add(path+"[]", "removed", true, "item schema removed")
+	case n.Items != nil:
+		d.add(path+"[]", "added", sent, "item schema added")
+	}
+}
+
+func mergeFields(a, b map[string]Field) map[string]Field {
+	m := make(map[string]Field, len(a)+len(b))
+	for k, v := range a {
+		m[k] = v
+	}
+	for k, v := range b {
+		m[k] = v
+	}
+	return m
+}
+
+func endpointNames(a, b map[string]Endpoint) []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, m := range []map[string]Endpoint{a, b} {
+		for k := range m {
+			if !seen[k] {
+				seen[k] = true
+				names = append(names, k)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func statusCodes(a, b map[int]map[string]Field) []int {
+	seen := map[int]bool{}
+	var codes []int
+	for _, m := range []map[int]map[string]Field{a, b} {
+		for k := range m {
+			if !seen[k] {
+				seen[k] = true
+				codes = append(codes, k)
+			}
+		}
+	}
+	sort.Ints(codes)
+	return codes
+}
@@ -0,0 +1,105 @@
+package contracts
+
+import "testing"
+
+func TestDiff(t *testing.T) {
+	from := &Contract{
+		Kind:    "contract",
+		Version: 1,
+		Endpoints: map[string]Endpoint{
+			"POST /api/trucks": {
+				Request: map[string]Field{
+					"plate": {Type: "string", Required: true},
+					"size":  {Type: "string", Enum: []string{"small", "large"}},
+					"notes": {Type: "string"},
+				},
+				Response: map[string]Field{
+					"id":    {Type: "string", Required: true},
+					"owner": {Type: "object", Fields: map[string]Field{"name": {Type: "string"}}},
+				},
+			},
+			"GET /api/trucks": {ResponseArray: map[string]Field{"id": {Type: "string"}}},
+		},
+	}
+	to := &Contract{
+		Kind:    "contract",
+		Version: 2,
+		Endpoints: map[string]Endpoint{
+			"POST /api/trucks": {
+				Request: map[string]Field{
+					"plate":  {Type: "string", Required: true},
+					"size":   {Type: "string", Enum: []string{"small", "large", "xl"}},
+					"notes":  {Type: "number"},
+					"driver": {Type: "string", Required: true},
+					"color":  {Type: "string"},
+				},
+				Response: map[string]Field{
+					"id":      {Type: "string", Required: true},
+					"owner":   {Type: "object", Fields: map[string]Field{}},
+					"created": {Type: "string", Required: true},
+				},
+			},
+			"GET /api/washes": {ResponseArray: map[string]Field{"id": {Type: "string"}}},
+		},
+	}
+
+	c := Diff(from, to)
+	if c.Compatible || c.FromVersion != 1 || c.ToVersion != 2 {
+		t.Fatalf("expected an incompatible 1 -> 2 diff: %+v", c)
+	}
+	breaking := map[string]string{}
+	for _, ch := range c.Breaking {
+		breaking[ch.Path] = ch.Kind
+	}
+	for path, kind := range map[string]string{
+		"GET /api/trucks":                      "removed",
+		"POST /api/trucks request.notes":       "type_changed",
+		"POST /api/trucks request.driver":      "added",
+		"POST /api/trucks response.owner.name": "removed",
+	} {
+		if breaking[path] != kind {
+			t.Errorf("expected breaking %s at %s, got %q", kind, path, breaking[path])
+		}
+	}
+	if len(c.Breaking) != 4 {
+		t.Errorf("expected 4 breaking changes, got %+v", c.Breaking)
+	}
+
+	additive := map[string]string{}
+	for _, ch := range c.Additive {
+		additive[ch.Path] = ch.Kind
+	}
+	for path, kind := range map[string]string{
+		"GET /api/washes":                   "added",
+		"POST /api/trucks request.color":    "added",
+		"POST /api/trucks request.size":     "enum_value_added",
+		"POST /api/trucks response.created": "added",
+	} {
+		if additive[path] != kind {
+			t.Errorf("expected additive %s at %s, got %q", kind, path, additive[path])
+		}
+	}
+
+	if c := Diff(from, from); !c.Compatible || len(c.Breaking)+len(c.Additive) != 0 {
+		t.Errorf("expected no changes against itself: %+v", c)
+	}
+}
+
+func TestDiffDirection(t *testing.T) {
+	contract := func(request, response Field) *Contract {
+		return &Contract{Kind: "contract", Endpoints: map[string]Endpoint{
+			"GET /x": {Request: map[string]Field{"f": request}, Response: map[string]Field{"f": response}},
+		}}
+	}
+	// Making a field required breaks senders; making it optional breaks readers.
+	c := Diff(contract(Field{Type: "string"}, Field{Type: "string", Required: true}),
+		contract(Field{Type: "string", Required: true}, Field{Type: "string"}))
+	if len(c.Breaking) != 2 || c.Breaking[0].Kind != "now_required" || c.Breaking[1].Kind != "now_optional" {
+		t.Errorf("expected both required changes to break: %+v", c.Breaking)
+	}
+	c = Diff(contract(Field{Type: "string", Required: true}, Field{Type: "string"}),
+		contract(Field{Type: "string"}, Field{Type: "string", Required: true}))
+	if !c.Compatible || len(c.Additive) != 2 {
+		t.Errorf("expected relaxing a request and tightening a response to be additive: %+v", c)
+	}
+}
@@ -0,0 +1,160 @@
+package contracts
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Warning is a non-fatal validation finding, such as use of a deprecated field.
+type Warning struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+	Sunset  string `json:"sunset,omitempty"`
+}
+
+// DeprecationWarnings reports deprecated endpoints and deprecated fields
+// present in the payload. Deprecated usage never produces a Violation,
+// so payloads still validate while agents migrate.
+func DeprecationWarnings(c *Contract, endpoint, direction string, payload map[string]any) []Warning {
+	ep, ok := c.Endpoints[endpoint]
+	if !ok {
+		return nil
+	}
+
+	var warnings []Warning
+	if ep.Deprecated {
+		warnings = append(warnings, deprecationWarning(endpoint, fmt.Sprintf("endpoint %q is deprecated", endpoint), ep.Sunset))
+	}
+
+	var schema map[string]Field
+	switch direction {
+	case "request":
+		schema = ep.Request
+	case "response":
+		schema = ep.Response
+		if schema == nil {
+			schema = ep.ResponseArray
+		}
+	case "query":
+		schema = ep.Query
+	case "error":
+		schema = ep.Error
+	}
+	return append(warnings, deprecatedFields(schema, payload, direction)...)
+}
+
+// deprecatedFields walks the schema alongside the payload, collecting
+// warnings for deprecated fields that are present.
+func deprecatedFields(schema map[string]Field, payload map[string]any, path string) []Warning {
+	var warnings []Warning
+	for _, name := range fieldNames(schema) {
+		field := schema[name]
+		val, exists := payload[name]
+		if !exists {
+			continue
+		}
+		fieldPath := joinPath(path, name)
+		if field.Deprecated {
+			warnings = append(warnings, deprecationWarning(fieldPath, fmt.Sprintf("field %q is deprecated", name), field.Sunset))
+		}
+
+		switch v := val.(type) {
+		case map[string]any:
+			if field.Fields != nil {
+				warnings = append(warnings, deprecatedFields(field.Fields, v, fieldPath)...)
+			}
+		case []any:
+			if field.Items != nil && field.Items.Fields != nil {
+				for i, item := range v {
+					if obj, ok := item.(map[string]any); ok {
+						warnings = append(warnings, deprecatedFields(field.Items.Fields, obj, fmt.Sprintf("%s[%d]", fieldPath, i))...)
+					}
+				}
+			}
+		}
+	}
+	return warnings
+}
+
+func deprecationWarning(path, msg, sunset string) Warning {
+	if sunset != "" {
+		if t, err := time.Parse("2006-01-02", sunset); err == nil && time.Now().UTC().After(t) {
+			msg += fmt.Sprintf(" (sunset %s has passed)", sunset)
+		} else {
+			msg += fmt.Sprintf(" (sunset %s)", sunset)
+		}
+	}
+	return Warning{Path: path, Message: msg, Sunset: sunset}
+}
+
+// DeprecatedUsage is an aggregated record of deprecated contract usage
+// observed during validation.
+type DeprecatedUsage struct {
+	Project   string    `json:"project"`
+	Contract  string    `json:"contract"`
+	Endpoint  string    `json:"endpoint"`
+	Path      string    `json:"path"`
+	Sunset    string    `json:"sunset,omitempty"`
+	Count     int       `json:"count"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// UsageLog records deprecated usage seen in validations, backed by SQLite.
+type UsageLog struct {
+	db *sql.DB
+}
+
+// NewUsageLog creates a new UsageLog.
+func NewUsageLog(db *sql.DB) *UsageLog {
+	return &UsageLog{db: db}
+}
+
+// Record increments the usage count for each warning.
+func (u *UsageLog) Record(ctx context.Context, project, contract, endpoint string, warnings []Warning) error {
+	for _, w := range warnings {
+		_, err := u.db.ExecContext(ctx,
+			`INSERT INTO contract_deprecation_usage (project, contract, endpoint, path, sunset, count)
+			 VALUES (?, ?, ?, ?, ?, 1)
+			 ON CONFLICT(project, contract, endpoint, path) DO UPDATE SET
+			   sunset = excluded.sunset,
+			   count = count + 1,
+			   last_seen = datetime('now')`,
+			project, contract, endpoint, w.Path, w.Sunset)
+		if err != nil {
+			return fmt.Errorf("record deprecated usage: %w", err)
+		}
+	}
+	return nil
+}
+
+// Report returns deprecated usage for a contract observed since the given time.
+// A zero since returns all recorded usage.
+func (u *UsageLog) Report(ctx context.Context, project, contract string, since time.Time) ([]DeprecatedUsage, error) {
+	query := `SELECT project, contract, endpoint, path, sunset, count, first_seen, last_seen
+		 FROM contract_deprecation_usage WHERE project = ? AND contract = ?`
+	args := []any{project, contract}
+	if !since.IsZero() {
+		query += ` AND last_seen >= ?`
+		args = append(args, since.UTC().Format("2006-01-02 15:04:05"))
+	}
+	query += ` ORDER BY count DESC, last_seen DESC`
+
+	rows, err := u.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query deprecated usage: %w", err)
+	}
+	defer rows.Close()
+
+	var usage []DeprecatedUsage
+	for rows.Next() {
+		var d DeprecatedUsage
+		if err := rows.Scan(&d.Project, &d.Contract, &d.Endpoint, &d.Path, &d.Sunset, &d.Count, &d.FirstSeen, &d.LastSeen); err != nil {
+			return nil, fmt.Errorf("scan deprecated usage: %w", err)
+		}
+		usage = append(usage, d)
+	}
+	return usage, rows.Err()
+}
@@ -0,0 +1,108 @@
+package contracts
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DavidRHerbert/koor/internal/db"
+)
+
+var deprecatedContract = &Contract{
+	Kind:    "contract",
+	Version: 2,
+	Endpoints: map[string]Endpoint{
+		"POST /api/trucks": {
+			Request: map[string]Field{
+				"plate":      {Type: "string", Required: true},
+				"truck_type": {Type: "string", Deprecated: true, Sunset: "2000-01-01"},
+				"owner": {Type: "object", Fields: map[string]Field{
+					"name":  {Type: "string"},
+					"phone": {Type: "string", Deprecated: true},
+				}},
+			},
+		},
+		"GET /api/v1/trucks": {
+			Deprecated: true,
+			Sunset:     "2099-12-31",
+			Query:      map[string]Field{"page": {Type: "number"}},
+		},
+	},
+}
+
+func TestDeprecationWarningsPassValidation(t *testing.T) {
+	payload := map[string]any{"plate": "ABC", "truck_type": "semi"}
+	if v := ValidatePayload(deprecatedContract, "POST /api/trucks", "request", payload); len(v) != 0 {
+		t.Fatalf("deprecated field should not be a violation: %+v", v)
+	}
+	w := DeprecationWarnings(deprecatedContract, "POST /api/trucks", "request", payload)
+	if len(w) != 1 {
+		t.Fatalf("expected 1 warning, got %d: %+v", len(w), w)
+	}
+	if w[0].Path != "request.truck_type" || w[0].Sunset != "2000-01-01" {
+		t.Errorf("unexpected warning: %+v", w[0])
+	}
+	if !strings.Contains(w[0].Message, "has passed") {
+		t.Errorf("expected passed sunset in message: %s", w[0].Message)
+	}
+}
+
+func TestDeprecationWarningsNested(t *testing.T) {
+	payload := map[string]any{"plate": "ABC", "owner": map[string]any{"name": "Bob", "phone": "555"}}
+	w := DeprecationWarnings(deprecatedContract, "POST /api/trucks", "request", payload)
+	if len(w) != 1 || w[0].Path != "request.owner.phone" {
+		t.Errorf("expected nested phone warning, got %+v", w)
+	}
+}
+
+func TestDeprecationWarningsAbsentField(t *testing.T) {
+	w := DeprecationWarnings(deprecatedContract, "POST /api/trucks", "request", map[string]any{"plate": "ABC"})
+	if len(w) != 0 {
+		t.Errorf("unused deprecated fields should not warn: %+v", w)
+	}
+}
+
+func TestDeprecationWarningsEndpoint(t *testing.T) {
+	w := DeprecationWarnings(deprecatedContract, "GET /api/v1/trucks", "query", map[string]any{"page": 1.0})
+	if len(w) != 1 || w[0].Path != "GET /api/v1/trucks" {
+		t.Fatalf("expected endpoint warning, got %+v", w)
+	}
+	if strings.Contains(w[0].Message, "has passed") {
+		t.Errorf("future sunset should not be marked passed: %s", w[0].Message)
+	}
+}
+
+func TestUsageLogRecordAndReport(t *testing.T) {
+	database, err := db.OpenMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+	u := NewUsageLog(database)
+	ctx := context.Background()
+
+	warnings := []Warning{{Path: "request.truck_type", Sunset: "2000-01-01"}}
+	for i := 0; i < 3; i++ {
+		if err := u.Record(ctx, "TW", "api", "POST /api/trucks", warnings); err != nil {
+			t.Fatal(err)
+		}
+	}
+	u.Record(ctx, "Other", "api", "POST /api/trucks", warnings)
+
+	usage, err := u.Report(ctx, "TW", "api", time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(usage) != 1 {
+		t.Fatalf("expected 1 usage row, got %d", len(usage))
+	}
+	if usage[0].Count != 3 || usage[0].Endpoint != "POST /api/trucks" || usage[0].Sunset != "2000-01-01" {
+		t.Errorf("unexpected usage: %+v", usage[0])
+	}
+
+	usage, _ = u.Report(ctx, "TW", "api", time.Now().Add(time.Hour))
+	if len(usage) != 0 {
+		t.Errorf("expected no usage in the future window, got %d", len(usage))
+	}
+}
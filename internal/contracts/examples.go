@@ -0,0 +1,97 @@
+package contracts
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Example is a named payload known to satisfy a contract endpoint, kept
+// alongside the contract so agents have concrete values to mimic.
+type Example struct {
+	Project   string          `json:"project"`
+	Contract  string          `json:"contract"`
+	Name      string          `json:"name"`
+	Endpoint  string          `json:"endpoint"`
+	Direction string          `json:"direction"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// ExampleStore persists contract examples in SQLite.
+type ExampleStore struct {
+	db *sql.DB
+}
+
+// NewExampleStore creates a new ExampleStore.
+func NewExampleStore(db *sql.DB) *ExampleStore {
+	return &ExampleStore{db: db}
+}
+
+// Save stores an example, replacing any existing example with the same name.
+func (s *ExampleStore) Save(ctx context.Context, ex Example) (*Example, error) {
+	if ex.Name == "" || ex.Endpoint == "" {
+		return nil, fmt.Errorf("name and endpoint are required")
+	}
+	if ex.Direction == "" {
+		ex.Direction = "request"
+	}
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO contract_examples (project, contract, name, endpoint, direction, payload, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, datetime('now'))
+		 ON CONFLICT(project, contract, name) DO UPDATE SET
+		   endpoint = excluded.endpoint, direction = excluded.direction,
+		   payload = excluded.payload, created_at = excluded.created_at`,
+		ex.Project, ex.Contract, ex.Name, ex.Endpoint, ex.Direction, string(ex.Payload))
+	if err != nil {
+		return nil, fmt.Errorf("save contract example: %w", err)
+	}
+	ex.CreatedAt = time.Now().UTC()
+	return &ex, nil
+}
+
+// List returns a contract's examples, optionally only those for one endpoint.
+func (s *ExampleStore) List(ctx context.Context, project, contract, endpoint string) ([]Example, error) {
+	query := `SELECT project, contract, name, endpoint, direction, payload, created_at
+		 FROM contract_examples WHERE project = ? AND contract = ?`
+	args := []any{project, contract}
+	if endpoint != "" {
+		query += ` AND endpoint = ?`
+		args = append(args, endpoint)
+	}
+	query += ` ORDER BY endpoint, name`
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query contract examples: %w", err)
+	}
+	defer rows.Close()
+
+	var examples []Example
+	for rows.Next() {
+		var ex Example
+		var payload string
+		if err := rows.Scan(&ex.Project, &ex.Contract, &ex.Name, &ex.Endpoint, &ex.Direction, &payload, &ex.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan contract example: %w", err)
+		}
+		ex.Payload = json.RawMessage(payload)
+		examples = append(examples, ex)
+	}
+	return examples, rows.Err()
+}
+
+// Delete removes a named example. Returns sql.ErrNoRows if it does not exist.
+func (s *ExampleStore) Delete(ctx context.Context, project, contract, name string) error {
+	res, err := s.db.ExecContext(ctx,
+		`DELETE FROM contract_examples WHERE project = ? AND contract = ? AND name = ?`,
+		project, contract, name)
+	if err != nil {
+		return fmt.Errorf("delete contract example: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package contracts
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/DavidRHerbert/koor/internal/db"
+)
+
+func TestExampleStore(t *testing.T) {
+	database, err := db.OpenMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+	store := NewExampleStore(database)
+	ctx := context.Background()
+
+	store.Save(ctx, Example{Project: "TW", Contract: "api", Name: "basic", Endpoint: "POST /api/trucks", Payload: json.RawMessage(`{"plate":"A"}`)})
+	store.Save(ctx, Example{Project: "TW", Contract: "api", Name: "list", Endpoint: "GET /api/trucks", Direction: "response", Payload: json.RawMessage(`[]`)})
+	// Saving under an existing name replaces the example.
+	store.Save(ctx, Example{Project: "TW", Contract: "api", Name: "basic", Endpoint: "POST /api/trucks", Payload: json.RawMessage(`{"plate":"B"}`)})
+
+	all, err := store.List(ctx, "TW", "api", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 2 {
+		t.Fatalf("expected 2 examples, got %d", len(all))
+	}
+	post, _ := store.List(ctx, "TW", "api", "POST /api/trucks")
+	if len(post) != 1 || string(post[0].Payload) != `{"plate":"B"}` || post[0].Direction != "request" {
+		t.Errorf("unexpected example: %+v", post)
+	}
+	if post[0].CreatedAt.IsZero() {
+		t.Error("expected created_at to be set")
+	}
+
+	if err := store.Delete(ctx, "TW", "api", "basic"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete(ctx, "TW", "api", "basic"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows deleting twice, got %v", err)
+	}
+}
@@ -0,0 +1,253 @@
+package contracts
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MockStatusHeader asks a mock for the response of another status code
+// the endpoint declares, e.g. 404, to exercise a client's error paths.
+const MockStatusHeader = "X-Koor-Mock-Status"
+
+// Mock serves made-up responses for a contract's endpoints, so a client
+// can be built before the service behind the contract exists. Requests
+// are checked against the contract; responses are the endpoint's stored
+// response example if there is one, else generated from the field types.
+type Mock struct {
+	contract *Contract
+	routes   []mockRoute
+	examples map[string]json.RawMessage // endpoint -> response example
+}
+
+type mockRoute struct {
+	endpoint string
+	method   string
+	segments []string // "" matches any one segment
+	params   int
+}
+
+// NewMock returns a mock of c. Response examples (Direction "response")
+// are served as they are; later examples for an endpoint win.
+func NewMock(c *Contract, examples []Example) *Mock {
+	m := &Mock{contract: c, examples: map[string]json.RawMessage{}}
+	for key := range c.Endpoints {
+		method, path, ok := strings.Cut(key, " ")
+		if !ok {
+			continue
+		}
+		rt := mockRoute{endpoint: key, method: strings.ToUpper(method)}
+		for _, seg := range splitPath(path) {
+			if strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}") || strings.HasPrefix(seg, ":") {
+				seg = ""
+				rt.params++
+			}
+			rt.segments = append(rt.segments, seg)
+		}
+		m.routes = append(m.routes, rt)
+	}
+	// Literal segments beat parameters: /trucks/new before /trucks/{id}.
+	sort.Slice(m.routes, func(i, j int) bool {
+		if m.routes[i].params != m.routes[j].params {
+			return m.routes[i].params < m.routes[j].params
+		}
+		return m.routes[i].endpoint < m.routes[j].endpoint
+	})
+	for _, ex := range examples {
+		if ex.Direction == "response" {
+			m.examples[ex.Endpoint] = ex.Payload
+		}
+	}
+	return m
+}
+
+// Endpoints returns the contract endpoints the mock serves, sorted.
+func (m *Mock) Endpoints() []string {
+	names := make([]string, 0, len(m.routes))
+	for _, rt := range m.routes {
+		names = append(names, rt.endpoint)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Match returns the contract endpoint that serves method and path. It
+// reports false if no endpoint has the path; an endpoint with the path but
+// another method is returned as "" with allowed set.
+func (m *Mock) Match(method, path string) (endpoint string, allowed []string, ok bool) {
+	segs := splitPath(path)
+	for _, rt := range m.routes {
+		if !rt.matches(segs) {
+			continue
+		}
+		if rt.method == strings.ToUpper(method) {
+			return rt.endpoint, nil, true
+		}
+		allowed = append(allowed, rt.method)
+	}
+	return "", allowed, len(allowed) > 0
+}
+
+func (rt mockRoute) matches(segs []string) bool {
+	if len(segs) != len(rt.segments) {
+		return false
+	}
+	for i, seg := range rt.segments {
+		if seg != "" && seg != segs[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+// ServeHTTP answers a request as the contract says the service would.
+// A request that breaks the contract gets a 400 listing the violations.
+func (m *Mock) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	endpoint, allowed, ok := m.Match(r.Method, r.URL.Path)
+	if !ok {
+		mockError(w, http.StatusNotFound, "no contract endpoint for "+r.Method+" "+r.URL.Path, nil)
+		return
+	}
+	if endpoint == "" {
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		mockError(w, http.StatusMethodNotAllowed, "contract has no "+r.Method+" endpoint for "+r.URL.Path, nil)
+		return
+	}
+	ep := m.contract.Endpoints[endpoint]
+
+	var violations []Violation
+	for _, name := range fieldNames(ep.Query) {
+		if ep.Query[name].Required && !r.URL.Query().Has(name) {
+			violations = append(violations, Violation{Path: "query." + name, Message: "required query parameter missing"})
+		}
+	}
+	if ep.Request != nil {
+		var payload map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			violations = append(violations, Violation{Path: "request", Message: "expected JSON object body"})
+		} else {
+			violations = append(violations, ValidatePayload(m.contract, endpoint, "request", payload)...)
+		}
+	}
+	if len(violations) > 0 {
+		mockError(w, http.StatusBadRequest, "request does not match contract endpoint "+endpoint, violations)
+		return
+	}
+
+	status, body := m.response(endpoint, ep, r.Header.Get(MockStatusHeader))
+	w.Header().Set("X-Koor-Mock-Endpoint", endpoint)
+	if body == nil {
+		w.WriteHeader(status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// response picks the status and body for an endpoint. want is an
+// optional status code the client asked for.
+func (m *Mock) response(endpoint string, ep Endpoint, want string) (int, []byte) {
+	if code, err := strconv.Atoi(want); err == nil {
+		if fields, ok := ep.Responses[code]; ok {
+			return code, sampleJSON(SampleObject(fields))
+		}
+		if code >= 400 && ep.Error != nil {
+			return code, sampleJSON(SampleObject(ep.Error))
+		}
+	}
+	status := ep.ResponseStatus
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if ex, ok := m.examples[endpoint]; ok {
+		return status, ex
+	}
+	switch {
+	case ep.ResponseArray != nil:
+		return status, sampleJSON([]any{SampleObject(ep.ResponseArray)})
+	case ep.Response != nil:
+		return status, sampleJSON(SampleObject(ep.Response))
+	case ep.Responses[status] != nil:
+		return status, sampleJSON(SampleObject(ep.Responses[status]))
+	}
+	return status, nil
+}
+
+func mockError(w http.ResponseWriter, code int, msg string, violations []Violation) {
+	body := map[string]any{"error": msg, "code": code}
+	if violations != nil {
+		body["violations"] = violations
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(body)
+}
+
+func sampleJSON(v any) []byte {
+	data, _ := json.Marshal(v)
+	return data
+}
+
+// SampleObject returns an example value for each non-deprecated field.
+func SampleObject(fields map[string]Field) map[string]any {
+	obj := make(map[string]any, len(fields))
+	for name, f := range fields {
+		if !f.Deprecated {
+			obj[name] = Sample(name, f)
+		}
+	}
+	return obj
+}
+
+// Sample returns an example value of a field's type: its first enum
+// value, or a value suggested by the field name (ids, emails, URLs and
+// timestamps), or a plain value of the type.
+func Sample(name string, f Field) any {
+	if len(f.Enum) > 0 {
+		return f.Enum[0]
+	}
+	switch f.Type {
+	case "string":
+		return sampleString(name)
+	case "number":
+		return 1
+	case "boolean":
+		return true
+	case "object":
+		return SampleObject(f.Fields)
+	case "array":
+		if f.Items == nil {
+			return []any{}
+		}
+		return []any{Sample(name, *f.Items)}
+	}
+	return nil
+}
+
+func sampleString(name string) string {
+	lower := strings.ToLower(name)
+	switch {
+	case lower == "id":
+		return "id-1"
+	case strings.HasSuffix(lower, "_id"):
+		return strings.TrimSuffix(lower, "_id") + "-1"
+	case strings.Contains(lower, "email"):
+		return "user@example.com"
+	case strings.Contains(lower, "url") || strings.Contains(lower, "href"):
+		return "https://example.com"
+	case strings.HasSuffix(lower, "_at") || strings.Contains(lower, "date") || strings.Contains(lower, "time"):
+		return "2026-01-01T00:00:00Z"
+	}
+	return "example " + name
+}
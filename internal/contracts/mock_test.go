@@ -0,0 +1,90 @@
+package contracts
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMock(t *testing.T) {
+	c := &Contract{
+		Kind: "contract",
+		Endpoints: map[string]Endpoint{
+			"GET /api/trucks": {ResponseArray: map[string]Field{
+				"id":   {Type: "string"},
+				"size": {Type: "string", Enum: []string{"small", "large"}},
+			}},
+			"GET /api/trucks/{id}": {
+				Response: map[string]Field{
+					"id":         {Type: "string", Required: true},
+					"owner_id":   {Type: "string"},
+					"created_at": {Type: "string"},
+					"axles":      {Type: "number"},
+					"tags":       {Type: "array", Items: &Field{Type: "string"}},
+					"legacy":     {Type: "string", Deprecated: true},
+				},
+				Responses: map[int]map[string]Field{404: {"error": {Type: "string"}}},
+			},
+			"GET /api/trucks/new": {Response: map[string]Field{"template": {Type: "boolean"}}},
+			"POST /api/trucks": {
+				Request:        map[string]Field{"plate": {Type: "string", Required: true}},
+				Response:       map[string]Field{"id": {Type: "string"}},
+				ResponseStatus: 201,
+			},
+			"DELETE /api/trucks/{id}": {ResponseStatus: 204},
+		},
+	}
+	m := NewMock(c, []Example{{Endpoint: "POST /api/trucks", Direction: "response", Payload: json.RawMessage(`{"id":"T-42"}`)}})
+
+	do := func(method, path, body string, header ...string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if len(header) == 2 {
+			req.Header.Set(header[0], header[1])
+		}
+		rec := httptest.NewRecorder()
+		m.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do("GET", "/api/trucks/T-1", "")
+	var truck map[string]any
+	json.Unmarshal(rec.Body.Bytes(), &truck)
+	if rec.Code != 200 || truck["id"] != "id-1" || truck["owner_id"] != "owner-1" ||
+		truck["created_at"] != "2026-01-01T00:00:00Z" || truck["axles"] != float64(1) {
+		t.Errorf("generated response: %d %s", rec.Code, rec.Body)
+	}
+	if _, ok := truck["legacy"]; ok {
+		t.Error("deprecated field should not be mocked")
+	}
+	if tags, _ := truck["tags"].([]any); len(tags) != 1 {
+		t.Errorf("expected one sample tag, got %v", truck["tags"])
+	}
+
+	if rec := do("GET", "/api/trucks", ""); rec.Code != 200 || rec.Body.String() != `[{"id":"id-1","size":"small"}]` {
+		t.Errorf("array response: %d %s", rec.Code, rec.Body)
+	}
+	if rec := do("GET", "/api/trucks/new", ""); rec.Header().Get("X-Koor-Mock-Endpoint") != "GET /api/trucks/new" {
+		t.Errorf("literal path should beat {id}: %s", rec.Header().Get("X-Koor-Mock-Endpoint"))
+	}
+	if rec := do("POST", "/api/trucks", `{"plate":"AB-12"}`); rec.Code != 201 || rec.Body.String() != `{"id":"T-42"}` {
+		t.Errorf("stored example: %d %s", rec.Code, rec.Body)
+	}
+	if rec := do("POST", "/api/trucks", `{}`); rec.Code != 400 || !strings.Contains(rec.Body.String(), "plate") {
+		t.Errorf("invalid request: %d %s", rec.Code, rec.Body)
+	}
+	if rec := do("DELETE", "/api/trucks/T-1", ""); rec.Code != 204 || rec.Body.Len() != 0 {
+		t.Errorf("no content: %d %s", rec.Code, rec.Body)
+	}
+	if rec := do("GET", "/api/trucks/T-1", "", MockStatusHeader, "404"); rec.Code != 404 || !strings.Contains(rec.Body.String(), `"error"`) {
+		t.Errorf("requested status: %d %s", rec.Code, rec.Body)
+	}
+	if rec := do("PUT", "/api/trucks/T-1", ""); rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != "DELETE, GET" {
+		t.Errorf("wrong method: %d allow %q", rec.Code, rec.Header().Get("Allow"))
+	}
+	if rec := do("GET", "/api/washes", ""); rec.Code != 404 {
+		t.Errorf("unknown path: %d", rec.Code)
+	}
+}
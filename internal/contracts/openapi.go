@@ -0,0 +1,422 @@
+package contracts
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// OpenAPI 3 documents, reduced to what a contract can express. JSON is
+// valid YAML, so both are decoded with the YAML parser.
+type oaDocument struct {
+	OpenAPI    string                `yaml:"openapi"`
+	Swagger    string                `yaml:"swagger"`
+	Paths      map[string]oaPathItem `yaml:"paths"`
+	Components struct {
+		Schemas       map[string]*oaSchema     `yaml:"schemas"`
+		Parameters    map[string]oaParameter   `yaml:"parameters"`
+		RequestBodies map[string]oaRequestBody `yaml:"requestBodies"`
+		Responses     map[string]oaResponse    `yaml:"responses"`
+	} `yaml:"components"`
+}
+
+type oaPathItem struct {
+	Parameters []oaParameter `yaml:"parameters"`
+	Get        *oaOperation  `yaml:"get"`
+	Put        *oaOperation  `yaml:"put"`
+	Post       *oaOperation  `yaml:"post"`
+	Delete     *oaOperation  `yaml:"delete"`
+	Patch      *oaOperation  `yaml:"patch"`
+	Head       *oaOperation  `yaml:"head"`
+	Options    *oaOperation  `yaml:"options"`
+}
+
+type oaOperation struct {
+	Deprecated  bool                  `yaml:"deprecated"`
+	Parameters  []oaParameter         `yaml:"parameters"`
+	RequestBody *oaRequestBody        `yaml:"requestBody"`
+	Responses   map[string]oaResponse `yaml:"responses"`
+}
+
+type oaParameter struct {
+	Ref        string    `yaml:"$ref"`
+	Name       string    `yaml:"name"`
+	In         string    `yaml:"in"`
+	Required   bool      `yaml:"required"`
+	Deprecated bool      `yaml:"deprecated"`
+	Schema     *oaSchema `yaml:"schema"`
+}
+
+type oaRequestBody struct {
+	Ref     string             `yaml:"$ref"`
+	Content map[string]oaMedia `yaml:"content"`
+}
+
+type oaResponse struct {
+	Ref     string             `yaml:"$ref"`
+	Content map[string]oaMedia `yaml:"content"`
+}
+
+type oaMedia struct {
+	Schema *oaSchema `yaml:"schema"`
+}
+
+type oaSchema struct {
+	Ref        string               `yaml:"$ref"`
+	Type       any                  `yaml:"type"` // a string, or a list of them in OpenAPI 3.1
+	Nullable   bool                 `yaml:"nullable"`
+	Deprecated bool                 `yaml:"deprecated"`
+	Enum       []any                `yaml:"enum"`
+	Properties map[string]*oaSchema `yaml:"properties"`
+	Required   []string             `yaml:"required"`
+	Items      *oaSchema            `yaml:"items"`
+	AllOf      []*oaSchema          `yaml:"allOf"`
+	OneOf      []*oaSchema          `yaml:"oneOf"`
+	AnyOf      []*oaSchema          `yaml:"anyOf"`
+}
+
+// FromOpenAPI converts an OpenAPI 3 document (YAML or JSON) into a contract.
+// Every operation becomes an endpoint: query parameters, the JSON request
+// body and the JSON responses, with components/schemas carried over as
+// contract components. The lowest 2xx response becomes the endpoint's
+// response and response_status, other status codes become response
+// variants, and the "default" response becomes the error shape.
+//
+// Constructs a contract cannot express are loosened rather than rejected;
+// the returned warnings list each one.
+func FromOpenAPI(data []byte) (*Contract, []string, error) {
+	var doc oaDocument
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, nil, fmt.Errorf("invalid OpenAPI document: %w", err)
+	}
+	if doc.Swagger != "" {
+		return nil, nil, fmt.Errorf("swagger %s documents are not supported; convert to OpenAPI 3 first", doc.Swagger)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		return nil, nil, fmt.Errorf("not an OpenAPI 3 document (openapi: %q)", doc.OpenAPI)
+	}
+
+	conv := &oaConverter{doc: &doc}
+	c := &Contract{Kind: "contract", Version: 1, Endpoints: map[string]Endpoint{}}
+	if len(doc.Components.Schemas) > 0 {
+		c.Components = make(map[string]Field, len(doc.Components.Schemas))
+		for name, s := range doc.Components.Schemas {
+			c.Components[name] = conv.field(s, "components/"+name)
+		}
+	}
+	conv.components = c.Components
+
+	for path, item := range doc.Paths {
+		ops := []struct {
+			method string
+			op     *oaOperation
+		}{
+			{"GET", item.Get}, {"PUT", item.Put}, {"POST", item.Post}, {"DELETE", item.Delete},
+			{"PATCH", item.Patch}, {"HEAD", item.Head}, {"OPTIONS", item.Options},
+		}
+		for _, o := range ops {
+			if o.op != nil {
+				key := o.method + " " + path
+				c.Endpoints[key] = conv.endpoint(key, item.Parameters, o.op)
+			}
+		}
+	}
+	if len(c.Endpoints) == 0 {
+		return nil, nil, fmt.Errorf("OpenAPI document has no operations")
+	}
+
+	// Check the result the way a stored contract is checked. Parse works on
+	// its own copy, so c keeps its component references.
+	raw, err := json.Marshal(c)
+	if err == nil {
+		_, err = Parse(raw)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("converted contract is invalid: %w", err)
+	}
+
+	sort.Strings(conv.warnings)
+	return c, conv.warnings, nil
+}
+
+type oaConverter struct {
+	doc        *oaDocument
+	components map[string]Field
+	warnings   []string
+}
+
+func (conv *oaConverter) warn(at, format string, args ...any) {
+	conv.warnings = append(conv.warnings, at+": "+fmt.Sprintf(format, args...))
+}
+
+func (conv *oaConverter) endpoint(key string, shared []oaParameter, op *oaOperation) Endpoint {
+	ep := Endpoint{Deprecated: op.Deprecated}
+
+	// Operation parameters override path-level ones with the same name.
+	params := map[string]oaParameter{}
+	for _, p := range append(append([]oaParameter(nil), shared...), op.Parameters...) {
+		if p.Ref != "" {
+			name, ok := strings.CutPrefix(p.Ref, "#/components/parameters/")
+			resolved, found := conv.doc.Components.Parameters[name]
+			if !ok || !found {
+				conv.warn(key, "unresolved parameter reference %q", p.Ref)
+				continue
+			}
+			p = resolved
+		}
+		params[p.In+":"+p.Name] = p
+	}
+	for _, p := range params {
+		if p.In != "query" {
+			continue
+		}
+		if ep.Query == nil {
+			ep.Query = map[string]Field{}
+		}
+		f := conv.field(p.Schema, key+" query "+p.Name)
+		f.Required = p.Required
+		f.Deprecated = f.Deprecated || p.Deprecated
+		ep.Query[p.Name] = f
+	}
+
+	if body := op.RequestBody; body != nil {
+		if body.Ref != "" {
+			name, ok := strings.CutPrefix(body.Ref, "#/components/requestBodies/")
+			resolved, found := conv.doc.Components.RequestBodies[name]
+			if !ok || !found {
+				conv.warn(key, "unresolved request body reference %q", body.Ref)
+			}
+			body = &resolved
+		}
+		if f, ok := conv.mediaField(body.Content, key+" request"); ok {
+			if f.Type == "object" && f.Fields != nil {
+				ep.Request = f.Fields
+			} else {
+				conv.warn(key, "request body is not an object with properties; not checked")
+			}
+		}
+	}
+
+	codes := make([]string, 0, len(op.Responses))
+	for code := range op.Responses {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	for _, code := range codes {
+		resp := op.Responses[code]
+		if resp.Ref != "" {
+			name, ok := strings.CutPrefix(resp.Ref, "#/components/responses/")
+			resolved, found := conv.doc.Components.Responses[name]
+			if !ok || !found {
+				conv.warn(key, "unresolved response reference %q", resp.Ref)
+				continue
+			}
+			resp = resolved
+		}
+		at := key + " response " + code
+		f, hasBody := conv.mediaField(resp.Content, at)
+
+		if code == "default" {
+			if hasBody && f.Type == "object" && f.Fields != nil {
+				ep.Error = f.Fields
+			}
+			continue
+		}
+		status, err := strconv.Atoi(code)
+		if err != nil {
+			conv.warn(key, "response %q is not a status code; skipped", code)
+			continue
+		}
+
+		primary := ep.ResponseStatus == 0 && status >= 200 && status < 300
+		if primary {
+			ep.ResponseStatus = status
+		}
+		if !hasBody {
+			continue
+		}
+		switch {
+		case f.Type == "object" && f.Fields != nil:
+			if primary {
+				ep.Response = f.Fields
+				continue
+			}
+			if ep.Responses == nil {
+				ep.Responses = map[int]map[string]Field{}
+			}
+			ep.Responses[status] = f.Fields
+		case primary && f.Type == "array" && f.Items != nil && f.Items.Type == "object" && f.Items.Fields != nil:
+			ep.ResponseArray = f.Items.Fields
+		default:
+			conv.warn(key, "response %s is not an object with properties; not checked", code)
+		}
+	}
+	return ep
+}
+
+// mediaField converts the schema of a JSON media type, resolving a top-level
+// component reference so its properties can be used directly.
+func (conv *oaConverter) mediaField(content map[string]oaMedia, at string) (Field, bool) {
+	if len(content) == 0 {
+		return Field{}, false
+	}
+	media, ok := content["application/json"]
+	if !ok {
+		types := make([]string, 0, len(content))
+		for t := range content {
+			types = append(types, t)
+		}
+		sort.Strings(types)
+		for _, t := range types {
+			if strings.HasSuffix(t, "+json") {
+				media, ok = content[t], true
+				break
+			}
+		}
+	}
+	if !ok || media.Schema == nil {
+		return Field{}, false
+	}
+	f := conv.resolveTop(conv.field(media.Schema, at))
+	if f.Items != nil {
+		items := conv.resolveTop(*f.Items)
+		f.Items = &items
+	}
+	return f, true
+}
+
+// resolveTop follows a field's chain of component references, so that an
+// endpoint can use the properties of a referenced schema directly. Nested
+// references are left for Parse.
+func (conv *oaConverter) resolveTop(f Field) Field {
+	for depth := 0; f.Ref != "" && depth < 32; depth++ {
+		base, found := conv.components[f.Ref]
+		if !found {
+			return Field{}
+		}
+		f = inherit(base, f)
+		f.Ref = base.Ref
+	}
+	return f
+}
+
+// field converts a schema to a contract field.
+func (conv *oaConverter) field(s *oaSchema, at string) Field {
+	if s == nil {
+		return Field{}
+	}
+	if s.Ref != "" {
+		name, ok := strings.CutPrefix(s.Ref, "#/components/schemas/")
+		if !ok {
+			conv.warn(at, "unsupported reference %q; not checked", s.Ref)
+			return Field{}
+		}
+		return Field{Ref: name, Nullable: s.Nullable, Deprecated: s.Deprecated}
+	}
+
+	f := Field{Nullable: s.Nullable, Deprecated: s.Deprecated}
+	switch t := s.Type.(type) {
+	case string:
+		f.Type = t
+	case []any:
+		for _, v := range t {
+			if v == "null" {
+				f.Nullable = true
+			} else if name, ok := v.(string); ok && f.Type == "" {
+				f.Type = name
+			}
+		}
+	}
+	if f.Type == "integer" {
+		f.Type = "number"
+	}
+	if f.Type == "" && s.Properties != nil {
+		f.Type = "object"
+	}
+	switch f.Type {
+	case "", "string", "number", "boolean", "object", "array":
+	case "null":
+		f.Type, f.Nullable = "", true
+	default:
+		conv.warn(at, "unknown type %q; not checked", f.Type)
+		f.Type = ""
+	}
+
+	if f.Type == "string" {
+		for _, v := range s.Enum {
+			if v == nil {
+				f.Nullable = true
+				continue
+			}
+			f.Enum = append(f.Enum, fmt.Sprint(v))
+		}
+	}
+	if len(s.Properties) > 0 {
+		required := map[string]bool{}
+		for _, name := range s.Required {
+			required[name] = true
+		}
+		f.Fields = make(map[string]Field, len(s.Properties))
+		for name, prop := range s.Properties {
+			pf := conv.field(prop, at+"."+name)
+			pf.Required = required[name]
+			f.Fields[name] = pf
+		}
+	}
+	if s.Items != nil {
+		items := conv.field(s.Items, at+"[]")
+		f.Items = &items
+	}
+
+	if len(s.AllOf) > 0 {
+		f = conv.allOf(f, s.AllOf, at)
+	}
+	if len(s.OneOf) > 0 || len(s.AnyOf) > 0 {
+		conv.warn(at, "oneOf/anyOf cannot be expressed in a contract; not checked")
+		return Field{Nullable: f.Nullable, Deprecated: f.Deprecated}
+	}
+	return f
+}
+
+// allOf merges the members of an allOf into f. The first component
+// reference is kept as the field's ref; everything else is merged inline.
+func (conv *oaConverter) allOf(f Field, members []*oaSchema, at string) Field {
+	for i, m := range members {
+		mat := fmt.Sprintf("%s.allOf[%d]", at, i)
+		mf := conv.field(m, mat)
+		if mf.Ref != "" {
+			if f.Ref == "" {
+				f.Ref = mf.Ref
+				continue
+			}
+			// A field has one ref; copy further components in.
+			base, ok := conv.doc.Components.Schemas[mf.Ref]
+			if !ok || len(base.AllOf) > 0 {
+				conv.warn(mat, "cannot merge component %q; not checked", mf.Ref)
+				continue
+			}
+			mf = conv.field(base, mat)
+		}
+		if f.Type == "" {
+			f.Type = mf.Type
+		}
+		if len(mf.Fields) > 0 {
+			fields := make(map[string]Field, len(f.Fields)+len(mf.Fields))
+			for k, v := range f.Fields {
+				fields[k] = v
+			}
+			for k, v := range mf.Fields {
+				fields[k] = v
+			}
+			f.Fields = fields
+		}
+		if f.Items == nil {
+			f.Items = mf.Items
+		}
+	}
+	return f
+}
@@ -0,0 +1,136 @@
+package contracts
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const truckWashOpenAPI = `
+openapi: 3.0.3
+info: {title: Truck-Wash, version: "1.0"}
+paths:
+  /api/trucks:
+    parameters:
+      - {name: limit, in: query, schema: {type: integer}}
+    get:
+      parameters:
+        - {name: status, in: query, required: true, schema: {type: string, enum: [waiting, washing]}}
+      responses:
+        "200":
+          description: trucks
+          content:
+            application/json:
+              schema: {type: array, items: {$ref: "#/components/schemas/Truck"}}
+    post:
+      requestBody:
+        content:
+          application/json:
+            schema: {$ref: "#/components/schemas/NewTruck"}
+      responses:
+        "201":
+          description: created
+          content:
+            application/json:
+              schema: {$ref: "#/components/schemas/Truck"}
+        "422":
+          $ref: "#/components/responses/Problem"
+        default:
+          $ref: "#/components/responses/Problem"
+  /api/trucks/{id}:
+    delete:
+      deprecated: true
+      responses:
+        "204": {description: deleted}
+    put:
+      requestBody:
+        content:
+          application/json:
+            schema:
+              oneOf: [{$ref: "#/components/schemas/NewTruck"}, {type: string}]
+      responses:
+        "200": {description: ok}
+components:
+  schemas:
+    NewTruck:
+      type: object
+      required: [plate]
+      properties:
+        plate: {type: string}
+        axles: {type: integer, nullable: true}
+    Truck:
+      allOf:
+        - $ref: "#/components/schemas/NewTruck"
+        - type: object
+          required: [id]
+          properties:
+            id: {type: string}
+            tags: {type: array, items: {type: string}}
+  responses:
+    Problem:
+      description: error
+      content:
+        application/problem+json:
+          schema:
+            type: object
+            properties:
+              title: {type: string}
+`
+
+func TestFromOpenAPI(t *testing.T) {
+	c, warnings, err := FromOpenAPI([]byte(truckWashOpenAPI))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list := c.Endpoints["GET /api/trucks"]
+	if !list.Query["status"].Required || list.Query["limit"].Type != "number" || len(list.Query["status"].Enum) != 2 {
+		t.Errorf("unexpected query: %+v", list.Query)
+	}
+	if list.ResponseStatus != 200 || list.ResponseArray["id"].Type != "string" || !list.ResponseArray["plate"].Required {
+		t.Errorf("expected an array of trucks, got %+v", list)
+	}
+
+	create := c.Endpoints["POST /api/trucks"]
+	if !create.Request["plate"].Required || !create.Request["axles"].Nullable {
+		t.Errorf("unexpected request: %+v", create.Request)
+	}
+	if create.ResponseStatus != 201 || !create.Response["id"].Required {
+		t.Errorf("unexpected response: %d %+v", create.ResponseStatus, create.Response)
+	}
+	if _, ok := create.Responses[422]["title"]; !ok {
+		t.Errorf("expected a 422 variant, got %+v", create.Responses)
+	}
+	if _, ok := create.Error["title"]; !ok {
+		t.Errorf("expected the default response as error shape, got %+v", create.Error)
+	}
+
+	del := c.Endpoints["DELETE /api/trucks/{id}"]
+	if !del.Deprecated || del.ResponseStatus != 204 {
+		t.Errorf("unexpected delete endpoint: %+v", del)
+	}
+	if c.Components["Truck"].Ref != "NewTruck" {
+		t.Errorf("expected Truck to extend NewTruck, got %+v", c.Components["Truck"])
+	}
+	if len(warnings) != 2 || !strings.Contains(warnings[0], "PUT /api/trucks/{id}") {
+		t.Errorf("expected oneOf warnings for the PUT body, got %v", warnings)
+	}
+
+	// The converted contract validates payloads like a hand-written one.
+	data, _ := json.Marshal(c)
+	parsed, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := ValidatePayload(parsed, "POST /api/trucks", "request", map[string]any{"axles": 3.0}); len(v) != 1 {
+		t.Errorf("expected a missing plate violation, got %v", v)
+	}
+}
+
+func TestFromOpenAPIRejects(t *testing.T) {
+	for _, doc := range []string{`swagger: "2.0"`, `openapi: 3.1.0`, `{"openapi":"2.0"}`, `: not yaml`} {
+		if _, _, err := FromOpenAPI([]byte(doc)); err == nil {
+			t.Errorf("expected an error for %q", doc)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package contracts
+
+import (
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Exchange is one observed request and the response to it.
+type Exchange struct {
+	Method   string
+	Path     string              // concrete path, e.g. "/trucks/42"
+	Query    map[string][]string // as url.Values
+	Request  []byte              // request body, if any
+	Status   int
+	Response []byte // response body, if any
+}
+
+// Recorder synthesizes a draft contract from observed traffic, for a
+// service that has none yet. Concrete paths are folded into templates
+// (/trucks/42 becomes /trucks/{truck_id}), and bodies of the same endpoint
+// are merged: a field is required if every body had it, nullable if any
+// had null, and typeless if bodies disagree on its type.
+type Recorder struct {
+	mu        sync.Mutex
+	endpoints map[string]*recordedEndpoint
+}
+
+type recordedEndpoint struct {
+	calls     int
+	query     map[string]int // parameter -> calls that sent it
+	request   *Field
+	responses map[int]*Field // status -> merged body
+	statuses  map[int]int    // status -> calls
+}
+
+// NewRecorder returns an empty Recorder. It is safe for concurrent use.
+func NewRecorder() *Recorder {
+	return &Recorder{endpoints: map[string]*recordedEndpoint{}}
+}
+
+// idSegment matches path segments that look like identifiers rather than
+// resource names: numbers, UUIDs and long hex strings.
+var idSegment = regexp.MustCompile(`^(\d+|[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}|[0-9a-fA-F]{16,})$`)
+
+// TemplatePath replaces identifier segments of a concrete path with
+// placeholders named after the segment before them.
+func TemplatePath(path string) string {
+	segments := strings.Split(path, "/")
+	used := map[string]bool{}
+	for i, seg := range segments {
+		if !idSegment.MatchString(seg) {
+			continue
+		}
+		name := "id"
+		if i > 0 && segments[i-1] != "" && !strings.HasPrefix(segments[i-1], "{") {
+			name = strings.NewReplacer("-", "_", ".", "_").Replace(singular(strings.ToLower(segments[i-1]))) + "_id"
+		}
+		for n := 2; used[name]; n++ {
+			name = strings.TrimRight(name, "0123456789") + strconv.Itoa(n)
+		}
+		used[name] = true
+		segments[i] = "{" + name + "}"
+	}
+	return strings.Join(segments, "/")
+}
+
+// singular makes a plural resource name singular, roughly.
+func singular(name string) string {
+	switch {
+	case strings.HasSuffix(name, "ies"):
+		return strings.TrimSuffix(name, "ies") + "y"
+	case strings.HasSuffix(name, "ses"), strings.HasSuffix(name, "xes"), strings.HasSuffix(name, "ches"), strings.HasSuffix(name, "shes"):
+		return strings.TrimSuffix(name, "es")
+	case strings.HasSuffix(name, "s") && !strings.HasSuffix(name, "ss"):
+		return strings.TrimSuffix(name, "s")
+	}
+	return name
+}
+
+// Observe records one exchange and returns the endpoint it was filed
+// under. Bodies that are not JSON are ignored.
+func (r *Recorder) Observe(ex Exchange) string {
+	key := strings.ToUpper(ex.Method) + " " + TemplatePath(ex.Path)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ep := r.endpoints[key]
+	if ep == nil {
+		ep = &recordedEndpoint{query: map[string]int{}, responses: map[int]*Field{}, statuses: map[int]int{}}
+		r.endpoints[key] = ep
+	}
+	ep.calls++
+	for name := range ex.Query {
+		ep.query[name]++
+	}
+	if f, ok := bodyField(ex.Request); ok {
+		ep.request = mergeObserved(ep.request, f)
+	}
+	ep.statuses[ex.Status]++
+	if f, ok := bodyField(ex.Response); ok {
+		ep.responses[ex.Status] = mergeObserved(ep.responses[ex.Status], f)
+	}
+	return key
+}
+
+// Len returns the number of endpoints recorded so far.
+func (r *Recorder) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.endpoints)
+}
+
+// Contract returns the draft contract for everything observed so far.
+// An endpoint's response_status is its most frequent 2xx status; bodies of
+// other statuses go in responses.
+func (r *Recorder) Contract() *Contract {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c := &Contract{Kind: "contract", Version: 1, Endpoints: map[string]Endpoint{}}
+	for key, rec := range r.endpoints {
+		var ep Endpoint
+		for name, n := range rec.query {
+			if ep.Query == nil {
+				ep.Query = map[string]Field{}
+			}
+			ep.Query[name] = Field{Type: "string", Required: n == rec.calls}
+		}
+		if rec.request != nil && rec.request.Type == "object" {
+			ep.Request = rec.request.Fields
+		}
+
+		statuses := make([]int, 0, len(rec.statuses))
+		for status := range rec.statuses {
+			statuses = append(statuses, status)
+		}
+		sort.Ints(statuses)
+		for _, status := range statuses {
+			if status >= 200 && status < 300 && (ep.ResponseStatus == 0 || rec.statuses[status] > rec.statuses[ep.ResponseStatus]) {
+				ep.ResponseStatus = status
+			}
+		}
+		for _, status := range statuses {
+			f := rec.responses[status]
+			if f == nil {
+				continue
+			}
+			switch {
+			case status == ep.ResponseStatus && f.Type == "object":
+				ep.Response = f.Fields
+			case status == ep.ResponseStatus && f.Type == "array" && f.Items != nil && f.Items.Type == "object":
+				ep.ResponseArray = f.Items.Fields
+			case status != ep.ResponseStatus && f.Type == "object":
+				if ep.Responses == nil {
+					ep.Responses = map[int]map[string]Field{}
+				}
+				ep.Responses[status] = f.Fields
+			}
+		}
+		c.Endpoints[key] = ep
+	}
+	return c
+}
+
+// bodyField infers the shape of a JSON body.
+func bodyField(body []byte) (Field, bool) {
+	var v any
+	if len(body) == 0 || json.Unmarshal(body, &v) != nil {
+		return Field{}, false
+	}
+	return InferField(v), true
+}
+
+// mergeObserved merges a newly observed body into the endpoint's shape so
+// far.
+func mergeObserved(seen *Field, f Field) *Field {
+	if seen != nil {
+		f = MergeFields(*seen, f)
+	}
+	return &f
+}
+
+// InferField derives a field schema from a decoded JSON value. Every key
+// present in an object is required; array items are merged so a key that
+// is missing from some items becomes optional. Recording and koor-cli
+// contract init both infer shapes with it.
+func InferField(v any) Field {
+	switch val := v.(type) {
+	case nil:
+		return Field{Nullable: true}
+	case string:
+		return Field{Type: "string"}
+	case float64:
+		return Field{Type: "number"}
+	case bool:
+		return Field{Type: "boolean"}
+	case map[string]any:
+		f := Field{Type: "object", Fields: map[string]Field{}}
+		for k, sub := range val {
+			child := InferField(sub)
+			child.Required = true
+			f.Fields[k] = child
+		}
+		return f
+	case []any:
+		f := Field{Type: "array"}
+		for i, item := range val {
+			item := InferField(item)
+			if i > 0 {
+				item = MergeFields(*f.Items, item)
+			}
+			f.Items = &item
+		}
+		return f
+	}
+	return Field{}
+}
+
+// MergeFields combines two inferred schemas for the same position.
+// Conflicting types drop the type constraint.
+func MergeFields(a, b Field) Field {
+	out := Field{Type: a.Type, Required: a.Required && b.Required, Nullable: a.Nullable || b.Nullable}
+	switch {
+	case a.Type == "" && a.Nullable:
+		out.Type, out.Fields, out.Items = b.Type, b.Fields, b.Items
+		return out
+	case b.Type == "" && b.Nullable:
+		out.Fields, out.Items = a.Fields, a.Items
+		return out
+	case a.Type != b.Type:
+		out.Type = ""
+		return out
+	}
+	if a.Fields != nil || b.Fields != nil {
+		out.Fields = map[string]Field{}
+		for k, fa := range a.Fields {
+			if fb, ok := b.Fields[k]; ok {
+				out.Fields[k] = MergeFields(fa, fb)
+			} else {
+				fa.Required = false
+				out.Fields[k] = fa
+			}
+		}
+		for k, fb := range b.Fields {
+			if _, ok := a.Fields[k]; !ok {
+				fb.Required = false
+				out.Fields[k] = fb
+			}
+		}
+	}
+	switch {
+	case a.Items != nil && b.Items != nil:
+		items := MergeFields(*a.Items, *b.Items)
+		out.Items = &items
+	case a.Items != nil:
+		out.Items = a.Items
+	default:
+		out.Items = b.Items
+	}
+	return out
+}
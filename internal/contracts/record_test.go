@@ -0,0 +1,82 @@
+package contracts
+
+import (
+	"testing"
+)
+
+func TestTemplatePath(t *testing.T) {
+	tests := []struct{ path, want string }{
+		{"/api/trucks", "/api/trucks"},
+		{"/api/trucks/42", "/api/trucks/{truck_id}"},
+		{"/api/trucks/42/washes/7", "/api/trucks/{truck_id}/washes/{wash_id}"},
+		{"/api/categories/3", "/api/categories/{category_id}"},
+		{"/api/statuses/3/notes/4", "/api/statuses/{status_id}/notes/{note_id}"},
+		{"/api/users/5f0c1d2e-8a7b-4c3d-9e1f-0a1b2c3d4e5f/keys/deadbeefdeadbeef", "/api/users/{user_id}/keys/{key_id}"},
+		{"/42/43", "/{id}/{id2}"},
+		{"/api/v1/status", "/api/v1/status"},
+	}
+	for _, tt := range tests {
+		if got := TemplatePath(tt.path); got != tt.want {
+			t.Errorf("TemplatePath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestRecorderContract(t *testing.T) {
+	r := NewRecorder()
+	r.Observe(Exchange{Method: "post", Path: "/api/trucks",
+		Request: []byte(`{"plate":"AB-12","axles":2,"notes":null}`),
+		Status:  201, Response: []byte(`{"id":1,"plate":"AB-12"}`)})
+	r.Observe(Exchange{Method: "POST", Path: "/api/trucks",
+		Request: []byte(`{"plate":"CD-34","notes":"new"}`),
+		Status:  201, Response: []byte(`{"id":2,"plate":"CD-34"}`)})
+	r.Observe(Exchange{Method: "POST", Path: "/api/trucks",
+		Request: []byte(`{"axles":"two"}`),
+		Status:  422, Response: []byte(`{"error":"plate is required"}`)})
+	r.Observe(Exchange{Method: "GET", Path: "/api/trucks", Query: map[string][]string{"limit": {"10"}, "q": {"AB"}},
+		Status: 200, Response: []byte(`[{"id":1,"tags":["new"]},{"id":2,"tags":[]}]`)})
+	r.Observe(Exchange{Method: "GET", Path: "/api/trucks", Query: map[string][]string{"limit": {"5"}},
+		Status: 200, Response: []byte(`not json`)})
+	key := r.Observe(Exchange{Method: "GET", Path: "/api/trucks/2", Status: 404})
+	if key != "GET /api/trucks/{truck_id}" {
+		t.Errorf("Observe returned %q", key)
+	}
+	if r.Len() != 3 {
+		t.Fatalf("Len = %d, want 3", r.Len())
+	}
+
+	c := r.Contract()
+	if c.Kind != "contract" || c.Version != 1 || len(c.Endpoints) != 3 {
+		t.Fatalf("contract = %+v", c)
+	}
+
+	create := c.Endpoints["POST /api/trucks"]
+	if create.ResponseStatus != 201 || !create.Response["id"].Required || create.Response["id"].Type != "number" {
+		t.Errorf("create response: status %d, %+v", create.ResponseStatus, create.Response)
+	}
+	if f := create.Request["plate"]; f.Type != "string" || f.Required {
+		t.Errorf("plate missing from one request should be optional: %+v", f)
+	}
+	if f := create.Request["axles"]; f.Type != "" || f.Required {
+		t.Errorf("axles seen as number and string should be typeless: %+v", f)
+	}
+	if f := create.Request["notes"]; f.Type != "string" || !f.Nullable {
+		t.Errorf("notes seen as null and string should be a nullable string: %+v", f)
+	}
+	if f := create.Responses[422]["error"]; f.Type != "string" || !f.Required {
+		t.Errorf("422 body: %+v", create.Responses)
+	}
+
+	list := c.Endpoints["GET /api/trucks"]
+	if list.ResponseStatus != 200 || list.ResponseArray["tags"].Type != "array" || list.ResponseArray["tags"].Items.Type != "string" {
+		t.Errorf("list response: %+v", list.ResponseArray)
+	}
+	if !list.Query["limit"].Required || list.Query["q"].Required {
+		t.Errorf("query: %+v", list.Query)
+	}
+
+	get := c.Endpoints["GET /api/trucks/{truck_id}"]
+	if get.ResponseStatus != 0 || get.Response != nil || get.Responses != nil {
+		t.Errorf("a 404 without a body should leave the endpoint empty: %+v", get)
+	}
+}
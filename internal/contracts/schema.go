@@ -9,19 +9,40 @@ import (
 // It defines the exact JSON field names, types, and constraints
 // for each endpoint — machine-readable, language-agnostic.
 type Contract struct {
-	Kind      string              `json:"kind"`      // must be "contract"
-	Version   int                 `json:"version"`
-	Endpoints map[string]Endpoint `json:"endpoints"` // key: "METHOD /path"
+	Kind       string              `json:"kind"` // must be "contract"
+	Version    int                 `json:"version"`
+	Components map[string]Field    `json:"components,omitempty"` // shared shapes referenced by name
+	Endpoints  map[string]Endpoint `json:"endpoints"`            // key: "METHOD /path"
 }
 
 // Endpoint defines the request/response schema for a single API endpoint.
 type Endpoint struct {
+	Deprecated     bool             `json:"deprecated,omitempty"`
+	Sunset         string           `json:"sunset,omitempty"` // optional removal date, "2006-01-02"
 	Query          map[string]Field `json:"query,omitempty"`
 	Request        map[string]Field `json:"request,omitempty"`
 	Response       map[string]Field `json:"response,omitempty"`
 	ResponseArray  map[string]Field `json:"response_array,omitempty"`
 	ResponseStatus int              `json:"response_status,omitempty"`
 	Error          map[string]Field `json:"error,omitempty"`
+
+	// Responses maps a status code to the response shape for that status,
+	// e.g. 201 for the created object and 404/422 for error bodies.
+	Responses map[int]map[string]Field `json:"responses,omitempty"`
+
+	// Cases are named example requests with the outcome they should
+	// produce, run together as the contract's test suite.
+	Cases []TestCase `json:"cases,omitempty"`
+}
+
+// TestCase is one named example of an endpoint in a contract test suite.
+type TestCase struct {
+	Name    string         `json:"name"`
+	Path    string         `json:"path,omitempty"`    // concrete path for templated ones, e.g. "/users/42"
+	Payload map[string]any `json:"payload,omitempty"` // request body
+
+	ExpectStatus   int            `json:"expect_status,omitempty"`   // default: the contract's status check
+	ExpectResponse map[string]any `json:"expect_response,omitempty"` // fields the response must contain
 }
 
 // Field describes a single JSON field in a contract.
@@ -32,13 +53,18 @@ type Field struct {
 	Nullable bool             `json:"nullable,omitempty"`
 	Enum     []string         `json:"enum,omitempty"`
 	Fields   map[string]Field `json:"fields,omitempty"` // sub-fields when type=object
-	Items    *Field           `json:"items,omitempty"`   // item schema when type=array
+	Items    *Field           `json:"items,omitempty"`  // item schema when type=array
+	Ref      string           `json:"ref,omitempty"`    // name of a shared component to inherit from
+
+	Deprecated bool   `json:"deprecated,omitempty"`
+	Sunset     string `json:"sunset,omitempty"` // optional removal date, "2006-01-02"
 }
 
 // Violation is a contract validation failure.
 type Violation struct {
-	Path    string `json:"path"`
-	Message string `json:"message"`
+	Path     string `json:"path"`
+	Message  string `json:"message"`
+	Severity string `json:"severity,omitempty"` // "error" or "warning"; empty means error
 }
 
 // Parse decodes JSON bytes into a Contract, validating the kind field.
@@ -53,5 +79,129 @@ func Parse(data []byte) (*Contract, error) {
 	if len(c.Endpoints) == 0 {
 		return nil, fmt.Errorf("contract has no endpoints")
 	}
+	if err := c.resolveRefs(); err != nil {
+		return nil, err
+	}
+	if err := c.checkCases(); err != nil {
+		return nil, err
+	}
 	return &c, nil
 }
+
+// checkCases requires every test case to have a name unique within its endpoint.
+func (c *Contract) checkCases() error {
+	for name, ep := range c.Endpoints {
+		seen := map[string]bool{}
+		for i, tc := range ep.Cases {
+			if tc.Name == "" {
+				return fmt.Errorf("endpoint %q: cases[%d]: name is required", name, i)
+			}
+			if seen[tc.Name] {
+				return fmt.Errorf("endpoint %q: duplicate case %q", name, tc.Name)
+			}
+			seen[tc.Name] = true
+		}
+	}
+	return nil
+}
+
+// resolveRefs replaces every field that references a component with the
+// component's definition. Settings on the referencing field (required,
+// nullable, deprecation, extra sub-fields) override the component's.
+func (c *Contract) resolveRefs() error {
+	for name, ep := range c.Endpoints {
+		maps := []map[string]Field{ep.Query, ep.Request, ep.Response, ep.ResponseArray, ep.Error}
+		for _, m := range ep.Responses {
+			maps = append(maps, m)
+		}
+		for _, m := range maps {
+			if err := c.resolveMap(m, nil); err != nil {
+				return fmt.Errorf("endpoint %q: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Contract) resolveMap(fields map[string]Field, stack []string) error {
+	for name, f := range fields {
+		resolved, err := c.resolveField(f, stack)
+		if err != nil {
+			return fmt.Errorf("field %q: %w", name, err)
+		}
+		fields[name] = resolved
+	}
+	return nil
+}
+
+func (c *Contract) resolveField(f Field, stack []string) (Field, error) {
+	if f.Ref != "" {
+		for _, seen := range stack {
+			if seen == f.Ref {
+				return f, fmt.Errorf("circular component reference %q", f.Ref)
+			}
+		}
+		base, ok := c.Components[f.Ref]
+		if !ok {
+			return f, fmt.Errorf("unknown component %q", f.Ref)
+		}
+		stack = append(stack, f.Ref)
+		base, err := c.resolveField(base, stack)
+		if err != nil {
+			return f, err
+		}
+		f = inherit(base, f)
+	}
+
+	if f.Fields != nil {
+		// Copy so a resolved component shared by several fields is never mutated.
+		fields := make(map[string]Field, len(f.Fields))
+		for k, v := range f.Fields {
+			fields[k] = v
+		}
+		if err := c.resolveMap(fields, stack); err != nil {
+			return f, err
+		}
+		f.Fields = fields
+	}
+	if f.Items != nil {
+		items, err := c.resolveField(*f.Items, stack)
+		if err != nil {
+			return f, err
+		}
+		f.Items = &items
+	}
+	return f, nil
+}
+
+// inherit overlays a referencing field onto its resolved component.
+func inherit(base, f Field) Field {
+	out := base
+	out.Ref = ""
+	if f.Type != "" {
+		out.Type = f.Type
+	}
+	out.Required = f.Required || base.Required
+	out.Nullable = f.Nullable || base.Nullable
+	out.Deprecated = f.Deprecated || base.Deprecated
+	if f.Sunset != "" {
+		out.Sunset = f.Sunset
+	}
+	if len(f.Enum) > 0 {
+		out.Enum = f.Enum
+	}
+	if f.Items != nil {
+		out.Items = f.Items
+	}
+	if len(f.Fields) > 0 {
+		fields := make(map[string]Field, len(base.Fields)+len(f.Fields))
+		for k, v := range base.Fields {
+			fields[k] = v
+		}
+		for k, v := range f.Fields {
+			fields[k] = v
+		}
+		out.Fields = fields
+	}
+	return out
+}
@@ -0,0 +1,85 @@
+package contracts
+
+import (
+	"strings"
+	"testing"
+)
+
+const componentsContract = `{
+	"kind": "contract",
+	"version": 1,
+	"components": {
+		"truck": {"type": "object", "fields": {
+			"id":    {"type": "string", "required": true},
+			"plate": {"type": "string", "required": true},
+			"owner": {"ref": "company"}
+		}},
+		"company": {"type": "object", "fields": {"name": {"type": "string", "required": true}}}
+	},
+	"endpoints": {
+		"GET /api/trucks/{id}": {"response": {"truck": {"ref": "truck", "required": true}}},
+		"GET /api/trucks": {"response": {"trucks": {"type": "array", "items": {"ref": "truck"}}}},
+		"POST /api/trucks/{id}/wash": {"response": {"truck": {"ref": "truck", "fields": {"washed_at": {"type": "string"}}}}}
+	}
+}`
+
+func TestParseResolvesComponents(t *testing.T) {
+	c, err := Parse([]byte(componentsContract))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	truck := c.Endpoints["GET /api/trucks/{id}"].Response["truck"]
+	if truck.Type != "object" || !truck.Required || truck.Ref != "" {
+		t.Errorf("truck not resolved: %+v", truck)
+	}
+	if truck.Fields["owner"].Fields["name"].Type != "string" {
+		t.Errorf("nested component not resolved: %+v", truck.Fields["owner"])
+	}
+
+	items := c.Endpoints["GET /api/trucks"].Response["trucks"].Items
+	if items == nil || items.Fields["plate"].Type != "string" {
+		t.Errorf("array items not resolved: %+v", items)
+	}
+
+	v := ValidatePayload(c, "GET /api/trucks", "response", map[string]any{
+		"trucks": []any{map[string]any{"id": "1"}},
+	})
+	if len(v) != 1 || !strings.Contains(v[0].Path, "plate") {
+		t.Errorf("expected missing plate violation from component, got %+v", v)
+	}
+}
+
+func TestParseComponentExtension(t *testing.T) {
+	c, err := Parse([]byte(componentsContract))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	washed := c.Endpoints["POST /api/trucks/{id}/wash"].Response["truck"]
+	if _, ok := washed.Fields["washed_at"]; !ok {
+		t.Error("extension field missing")
+	}
+	if _, ok := washed.Fields["plate"]; !ok {
+		t.Error("inherited field missing")
+	}
+	if _, ok := c.Endpoints["GET /api/trucks/{id}"].Response["truck"].Fields["washed_at"]; ok {
+		t.Error("extension leaked into another endpoint")
+	}
+}
+
+func TestParseUnknownComponent(t *testing.T) {
+	_, err := Parse([]byte(`{"kind":"contract","version":1,"endpoints":{"GET /x":{"response":{"a":{"ref":"missing"}}}}}`))
+	if err == nil || !strings.Contains(err.Error(), "unknown component") {
+		t.Fatalf("expected unknown component error, got %v", err)
+	}
+}
+
+func TestParseCircularComponent(t *testing.T) {
+	data := `{"kind":"contract","version":1,
+		"components":{"node":{"type":"object","fields":{"next":{"ref":"node"}}}},
+		"endpoints":{"GET /x":{"response":{"a":{"ref":"node"}}}}}`
+	_, err := Parse([]byte(data))
+	if err == nil || !strings.Contains(err.Error(), "circular") {
+		t.Fatalf("expected circular reference error, got %v", err)
+	}
+}
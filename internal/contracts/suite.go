@@ -0,0 +1,186 @@
+package contracts
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CaseResult is the outcome of one test case against a live service.
+type CaseResult struct {
+	Endpoint           string      `json:"endpoint"`
+	Case               string      `json:"case"`
+	Pass               bool        `json:"pass"`
+	StatusCode         int         `json:"status_code,omitempty"`
+	Failures           []string    `json:"failures"` // unmet expect_status / expect_response
+	ResponseViolations []Violation `json:"response_violations"`
+	Error              string      `json:"error,omitempty"`
+}
+
+// SuiteResult is the outcome of a contract's test suite.
+type SuiteResult struct {
+	Cases []CaseResult `json:"cases"`
+	Pass  int          `json:"pass"`
+	Fail  int          `json:"fail"`
+}
+
+// RunSuite sends every test case of the contract to the service at baseURL
+// and checks the response against the case's expectations and the contract.
+// endpoint and caseName, when set, limit the run to matching cases.
+// Request payloads are not validated: a case may send a bad one on purpose.
+func RunSuite(c *Contract, baseURL, endpoint, caseName string) (*SuiteResult, error) {
+	if endpoint != "" {
+		if _, ok := c.Endpoints[endpoint]; !ok {
+			return nil, fmt.Errorf("endpoint %q not in contract", endpoint)
+		}
+	}
+	endpoints := make([]string, 0, len(c.Endpoints))
+	for ep := range c.Endpoints {
+		if endpoint == "" || ep == endpoint {
+			endpoints = append(endpoints, ep)
+		}
+	}
+	sort.Strings(endpoints)
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	res := &SuiteResult{Cases: []CaseResult{}}
+	for _, ep := range endpoints {
+		for _, tc := range c.Endpoints[ep].Cases {
+			if caseName != "" && tc.Name != caseName {
+				continue
+			}
+			cr := runCase(client, c, ep, baseURL, tc)
+			if cr.Pass {
+				res.Pass++
+			} else {
+				res.Fail++
+			}
+			res.Cases = append(res.Cases, cr)
+		}
+	}
+	return res, nil
+}
+
+func runCase(client *http.Client, c *Contract, endpoint, baseURL string, tc TestCase) CaseResult {
+	cr := CaseResult{Endpoint: endpoint, Case: tc.Name, Failures: []string{}, ResponseViolations: []Violation{}}
+	method, path, ok := strings.Cut(endpoint, " ")
+	if !ok {
+		cr.Error = fmt.Sprintf("invalid endpoint format %q (expected \"METHOD /path\")", endpoint)
+		return cr
+	}
+	if tc.Path != "" {
+		path = tc.Path
+	}
+	if strings.Contains(path, "{") {
+		cr.Error = "path has parameters; set the case's path to a concrete one"
+		return cr
+	}
+
+	var body io.Reader
+	if tc.Payload != nil && method != http.MethodGet && method != http.MethodHead {
+		data, err := json.Marshal(tc.Payload)
+		if err != nil {
+			cr.Error = fmt.Sprintf("marshal payload: %v", err)
+			return cr
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, strings.TrimRight(baseURL, "/")+path, body)
+	if err != nil {
+		cr.Error = fmt.Sprintf("create request: %v", err)
+		return cr
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		cr.Error = fmt.Sprintf("HTTP request failed: %v", err)
+		return cr
+	}
+	defer resp.Body.Close()
+	cr.StatusCode = resp.StatusCode
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 10<<20))
+	if err != nil {
+		cr.Error = fmt.Sprintf("read response body: %v", err)
+		return cr
+	}
+
+	if tc.ExpectStatus != 0 {
+		if resp.StatusCode != tc.ExpectStatus {
+			cr.Failures = append(cr.Failures, fmt.Sprintf("expected status %d, got %d", tc.ExpectStatus, resp.StatusCode))
+		}
+	} else if v := ValidateStatus(c, endpoint, resp.StatusCode); v != nil {
+		cr.Failures = append(cr.Failures, v.Message)
+	}
+	// Error responses are only checked when the contract describes them.
+	ep := c.Endpoints[endpoint]
+	if _, described := ep.Responses[resp.StatusCode]; resp.StatusCode < 400 || described || ep.Error != nil {
+		if violations, _ := checkResponse(c, endpoint, resp.StatusCode, respBody); violations != nil {
+			cr.ResponseViolations = violations
+		}
+	}
+	if tc.ExpectResponse != nil {
+		var got any
+		if err := json.Unmarshal(respBody, &got); err != nil {
+			cr.Failures = append(cr.Failures, "expected a JSON response body")
+		} else {
+			cr.Failures = append(cr.Failures, subsetMismatches(tc.ExpectResponse, got, "response")...)
+		}
+	}
+	cr.Pass = len(cr.Failures) == 0 && len(cr.ResponseViolations) == 0
+	return cr
+}
+
+// subsetMismatches reports where got does not contain want: objects must
+// have every expected key (extra keys are fine), arrays must have the same
+// length with each element matching, and other values must be equal.
+func subsetMismatches(want, got any, path string) []string {
+	switch w := want.(type) {
+	case map[string]any:
+		g, ok := got.(map[string]any)
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected an object, got %s", path, jsonText(got))}
+		}
+		keys := make([]string, 0, len(w))
+		for k := range w {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var out []string
+		for _, k := range keys {
+			gv, ok := g[k]
+			if !ok {
+				out = append(out, fmt.Sprintf("%s.%s: missing", path, k))
+				continue
+			}
+			out = append(out, subsetMismatches(w[k], gv, path+"."+k)...)
+		}
+		return out
+	case []any:
+		g, ok := got.([]any)
+		if !ok || len(g) != len(w) {
+			return []string{fmt.Sprintf("%s: expected %s, got %s", path, jsonText(want), jsonText(got))}
+		}
+		var out []string
+		for i := range w {
+			out = append(out, subsetMismatches(w[i], g[i], fmt.Sprintf("%s[%d]", path, i))...)
+		}
+		return out
+	}
+	if !reflect.DeepEqual(want, got) {
+		return []string{fmt.Sprintf("%s: expected %s, got %s", path, jsonText(want), jsonText(got))}
+	}
+	return nil
+}
+
+func jsonText(v any) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
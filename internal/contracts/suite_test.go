@@ -0,0 +1,96 @@
+package contracts
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRunSuite(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method + " " + r.URL.Path {
+		case "GET /api/trucks/T-1":
+			io.WriteString(w, `{"id":"T-1","size":"large","axles":3,"tags":["a"]}`)
+		case "GET /api/trucks/T-9":
+			w.WriteHeader(404)
+			io.WriteString(w, `{"error":"not found"}`)
+		case "POST /api/trucks":
+			body, _ := io.ReadAll(r.Body)
+			if !strings.Contains(string(body), `"plate"`) {
+				w.WriteHeader(422)
+				io.WriteString(w, `{"error":"plate is required"}`)
+				return
+			}
+			w.WriteHeader(201)
+			io.WriteString(w, `{"id":42}`) // wrong type: the contract says string
+		}
+	}))
+	defer ts.Close()
+
+	c, err := Parse([]byte(`{"kind":"contract","version":1,"endpoints":{
+		"GET /api/trucks/{id}": {
+			"response": {"id": {"type":"string"}, "size": {"type":"string"}, "axles": {"type":"number"}, "tags": {"type":"array"}},
+			"response_status": 200,
+			"responses": {"404": {"error": {"type":"string"}}},
+			"cases": [
+				{"name":"existing", "path":"/api/trucks/T-1", "expect_response":{"id":"T-1","axles":3,"tags":["a"]}},
+				{"name":"wrong-size", "path":"/api/trucks/T-1", "expect_response":{"size":"small","owner":"x"}},
+				{"name":"missing", "path":"/api/trucks/T-9", "expect_status":404},
+				{"name":"no-path"}
+			]
+		},
+		"POST /api/trucks": {
+			"request": {"plate": {"type":"string","required":true}},
+			"response": {"id": {"type":"string"}},
+			"response_status": 201,
+			"cases": [
+				{"name":"no-plate", "payload":{}, "expect_status":422},
+				{"name":"create", "payload":{"plate":"AB-123"}, "expect_status":201}
+			]
+		}
+	}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := RunSuite(c, ts.URL, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]CaseResult{}
+	for _, cr := range res.Cases {
+		got[cr.Case] = cr
+	}
+	if len(res.Cases) != 6 || res.Pass != 3 || res.Fail != 3 {
+		t.Fatalf("expected 3 pass and 3 fail, got %d/%d: %+v", res.Pass, res.Fail, res.Cases)
+	}
+	for _, name := range []string{"existing", "missing", "no-plate"} {
+		if !got[name].Pass {
+			t.Errorf("%s: expected pass, got %+v", name, got[name])
+		}
+	}
+	if f := got["wrong-size"].Failures; len(f) != 2 || !strings.Contains(f[0], `response.owner: missing`) || !strings.Contains(f[1], `response.size: expected "small", got "large"`) {
+		t.Errorf("wrong-size: unexpected failures %q", f)
+	}
+	if got["no-path"].Error == "" {
+		t.Error("no-path: expected an error for the templated path")
+	}
+	if cr := got["create"]; cr.Pass || len(cr.ResponseViolations) == 0 {
+		t.Errorf("create: expected a response violation, got %+v", cr)
+	}
+
+	res, _ = RunSuite(c, ts.URL, "POST /api/trucks", "create")
+	if len(res.Cases) != 1 || res.Cases[0].Case != "create" {
+		t.Errorf("filter: expected only the create case, got %+v", res.Cases)
+	}
+	if _, err := RunSuite(c, ts.URL, "GET /nope", ""); err == nil {
+		t.Error("expected an error for an unknown endpoint")
+	}
+
+	if _, err := Parse([]byte(`{"kind":"contract","endpoints":{"GET /x":{"cases":[{"name":"a"},{"name":"a"}]}}}`)); err == nil {
+		t.Error("expected an error for duplicate case names")
+	}
+}
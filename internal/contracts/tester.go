@@ -16,6 +16,7 @@ type TestResult struct {
 	StatusCode         int         `json:"status_code,omitempty"`
 	RequestViolations  []Violation `json:"request_violations"`
 	ResponseViolations []Violation `json:"response_violations"`
+	Warnings           []Warning   `json:"warnings"`
 	Error              string      `json:"error,omitempty"`
 }
 
@@ -31,6 +32,7 @@ func TestEndpoint(c *Contract, endpoint string, baseURL string, testPayload map[
 		Endpoint:           endpoint,
 		RequestViolations:  []Violation{},
 		ResponseViolations: []Violation{},
+		Warnings:           []Warning{},
 	}
 
 	// Parse "METHOD /path" from the endpoint key.
@@ -43,6 +45,9 @@ func TestEndpoint(c *Contract, endpoint string, baseURL string, testPayload map[
 	// Validate request payload before sending (if applicable).
 	if testPayload != nil && ep.Request != nil {
 		result.RequestViolations = ValidatePayload(c, endpoint, "request", testPayload)
+		result.Warnings = append(result.Warnings, DeprecationWarnings(c, endpoint, "request", testPayload)...)
+	} else if ep.Deprecated {
+		result.Warnings = append(result.Warnings, DeprecationWarnings(c, endpoint, "", nil)...)
 	}
 
 	// Build the HTTP request.
@@ -86,22 +91,48 @@ func TestEndpoint(c *Contract, endpoint string, baseURL string, testPayload map[
 		return result, nil
 	}
 
-	if len(respBody) == 0 {
-		return result, nil
+	violations, warnings := checkResponse(c, endpoint, resp.StatusCode, respBody)
+	result.ResponseViolations = append(result.ResponseViolations, violations...)
+	result.Warnings = append(result.Warnings, warnings...)
+	return result, nil
+}
+
+// checkResponse validates a response body against the endpoint's shape
+// for the status it came with.
+func checkResponse(c *Contract, endpoint string, status int, body []byte) ([]Violation, []Warning) {
+	if len(body) == 0 {
+		return nil, nil
+	}
+	ep := c.Endpoints[endpoint]
+
+	// Status-specific variants and error bodies take precedence over the default response.
+	variant, hasVariant := ep.Responses[status]
+	if hasVariant || (status >= 400 && ep.Error != nil) {
+		var obj map[string]any
+		if err := json.Unmarshal(body, &obj); err != nil {
+			return []Violation{{
+				Path:    fmt.Sprintf("response[%d]", status),
+				Message: "expected JSON object body",
+			}}, nil
+		}
+		var warnings []Warning
+		if hasVariant {
+			warnings = deprecatedFields(variant, obj, fmt.Sprintf("response[%d]", status))
+		}
+		return ValidateResponse(c, endpoint, status, obj), warnings
 	}
 
 	// Try to determine if response is array or object.
 	if ep.ResponseArray != nil {
 		var items []any
-		if err := json.Unmarshal(respBody, &items); err == nil {
-			result.ResponseViolations = append(result.ResponseViolations, ValidateResponseArray(c, endpoint, items)...)
+		if err := json.Unmarshal(body, &items); err == nil {
+			return ValidateResponseArray(c, endpoint, items), nil
 		}
 	} else if ep.Response != nil {
 		var obj map[string]any
-		if err := json.Unmarshal(respBody, &obj); err == nil {
-			result.ResponseViolations = append(result.ResponseViolations, ValidatePayload(c, endpoint, "response", obj)...)
+		if err := json.Unmarshal(body, &obj); err == nil {
+			return ValidatePayload(c, endpoint, "response", obj), deprecatedFields(ep.Response, obj, "response")
 		}
 	}
-
-	return result, nil
+	return nil, nil
 }
@@ -68,12 +68,44 @@ func ValidateResponseArray(c *Contract, endpoint string, items []any) []Violatio
 	return violations
 }
 
+// ValidateResponse checks a response body against the shape the contract
+// defines for the given status code. Endpoints without a status-specific
+// variant fall back to error (for 4xx/5xx) or response.
+func ValidateResponse(c *Contract, endpoint string, status int, payload map[string]any) []Violation {
+	ep, ok := c.Endpoints[endpoint]
+	if !ok {
+		return []Violation{{Path: endpoint, Message: fmt.Sprintf("endpoint %q not in contract", endpoint)}}
+	}
+	if schema, ok := ep.Responses[status]; ok {
+		return validateFields(schema, payload, fmt.Sprintf("response[%d]", status))
+	}
+	if status >= 400 && ep.Error != nil {
+		return ValidatePayload(c, endpoint, "error", payload)
+	}
+	return ValidatePayload(c, endpoint, "response", payload)
+}
+
 // ValidateStatus checks the HTTP status code matches the contract.
+// When response variants are defined, any status with a variant is accepted.
 func ValidateStatus(c *Contract, endpoint string, got int) *Violation {
 	ep, ok := c.Endpoints[endpoint]
 	if !ok {
 		return nil
 	}
+	if len(ep.Responses) > 0 {
+		if _, ok := ep.Responses[got]; ok || got == ep.ResponseStatus {
+			return nil
+		}
+		codes := make([]string, 0, len(ep.Responses))
+		for code := range ep.Responses {
+			codes = append(codes, fmt.Sprintf("%d", code))
+		}
+		sort.Strings(codes)
+		return &Violation{
+			Path:    endpoint,
+			Message: fmt.Sprintf("unexpected status %d (contract defines: %s)", got, strings.Join(codes, ", ")),
+		}
+	}
 	if ep.ResponseStatus == 0 {
 		return nil // no status constraint
 	}
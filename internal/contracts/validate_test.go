@@ -463,3 +463,59 @@ func containsAny(s, sub string) bool {
 	}
 	return false
 }
+
+// --- Response variant tests ---
+
+var variantContract = &Contract{
+	Kind:    "contract",
+	Version: 1,
+	Endpoints: map[string]Endpoint{
+		"POST /api/trucks": {
+			Responses: map[int]map[string]Field{
+				201: {"id": {Type: "string", Required: true}},
+				422: {"errors": {Type: "array", Required: true, Items: &Field{Type: "string"}}},
+			},
+			Error: map[string]Field{"message": {Type: "string", Required: true}},
+		},
+	},
+}
+
+func TestValidateResponseVariant(t *testing.T) {
+	if v := ValidateResponse(variantContract, "POST /api/trucks", 201, map[string]any{"id": "t1"}); len(v) != 0 {
+		t.Errorf("201 should pass: %+v", v)
+	}
+	v := ValidateResponse(variantContract, "POST /api/trucks", 422, map[string]any{"message": "bad"})
+	if len(v) != 2 {
+		t.Errorf("422 body should be checked against 422 variant, got %+v", v)
+	}
+}
+
+func TestValidateResponseErrorFallback(t *testing.T) {
+	if v := ValidateResponse(variantContract, "POST /api/trucks", 500, map[string]any{"message": "boom"}); len(v) != 0 {
+		t.Errorf("500 should fall back to error shape: %+v", v)
+	}
+}
+
+func TestValidateStatusVariants(t *testing.T) {
+	if v := ValidateStatus(variantContract, "POST /api/trucks", 422); v != nil {
+		t.Errorf("422 is a defined variant: %+v", v)
+	}
+	v := ValidateStatus(variantContract, "POST /api/trucks", 404)
+	if v == nil {
+		t.Fatal("404 is not a defined variant")
+	}
+	if !containsStr(v.Message, "201, 422") {
+		t.Errorf("message should list defined codes: %s", v.Message)
+	}
+}
+
+func TestParseResponseVariants(t *testing.T) {
+	data := `{"kind":"contract","version":1,"endpoints":{"GET /x":{"responses":{"200":{"id":{"type":"string"}},"404":{"error":{"type":"string"}}}}}}`
+	c, err := Parse([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.Endpoints["GET /x"].Responses[404]; !ok {
+		t.Errorf("expected 404 variant, got %+v", c.Endpoints["GET /x"].Responses)
+	}
+}
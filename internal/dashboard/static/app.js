@@ -43,10 +43,15 @@ async function refreshHealth() {
 
   status.textContent = data.status;
   status.className = 'status ok';
-  el.innerHTML = renderTable([
+  const rows = [
     ['Status', data.status],
     ['Uptime', data.uptime],
-  ]);
+  ];
+  if (data.tenant) {
+    rows.unshift(['Tenant', data.tenant]);
+    document.querySelector('header h1').textContent = 'Koor Dashboard: ' + data.tenant;
+  }
+  el.innerHTML = renderTable(rows);
 }
 
 async function refreshTokenTax() {
@@ -79,6 +84,10 @@ async function refreshTokenTax() {
         <span class="tt-stat-value">${tt.mcp_calls}</span>
         <span class="tt-stat-label">MCP calls</span>
       </div>
+      <div class="tt-stat">
+        <span class="tt-stat-value">${tt.mcp_data_calls || 0}</span>
+        <span class="tt-stat-label">of which data</span>
+      </div>
       <div class="tt-stat">
         <span class="tt-stat-value">${mcpTokens.toLocaleString()}</span>
         <span class="tt-stat-label">MCP tokens used</span>
@@ -118,9 +127,12 @@ async function refreshState() {
   }
 
   let html = '<table>';
-  html += '<tr><td><strong>Key</strong></td><td><strong>Version</strong></td></tr>';
+  html += '<tr><td><strong>Key</strong></td><td><strong>Version</strong></td><td><strong>Owner</strong></td><td><strong>Description</strong></td></tr>';
   for (const item of data) {
-    html += `<tr><td>${esc(item.key)}</td><td>v${item.version}</td></tr>`;
+    const meta = item.meta || {};
+    const tags = (meta.tags || []).map((t) => `<span class="badge">${esc(t)}</span>`).join(' ');
+    html += `<tr><td>${esc(item.key)}</td><td>v${item.version}</td><td>${esc(meta.owner || '-')}</td>
+      <td>${esc(meta.description || '')} ${tags}</td></tr>`;
   }
   html += '</table>';
   el.innerHTML = html;
@@ -145,16 +157,119 @@ async function refreshEvents() {
   el.innerHTML = html;
 }
 
+// burndownSVG draws remaining items (solid) against the ideal line (dashed).
+function burndownSVG(points, total) {
+  if (!points || points.length < 2 || total === 0) return '';
+  const w = 240, h = 60;
+  const x = (i) => (i / (points.length - 1)) * w;
+  const y = (v) => h - (v / total) * h;
+  const line = (key) => points.map((p, i) => `${x(i).toFixed(1)},${y(p[key]).toFixed(1)}`).join(' ');
+  return `<svg class="burndown" viewBox="0 0 ${w} ${h}" preserveAspectRatio="none">
+    <polyline class="burndown-ideal" points="${line('ideal')}" />
+    <polyline class="burndown-actual" points="${line('remaining')}" />
+  </svg>`;
+}
+
+// sparklineSVG draws values scaled to the largest one.
+function sparklineSVG(values) {
+  const w = 120, h = 24;
+  const top = Math.max(...values, 1);
+  const x = (i) => (i / (values.length - 1)) * w;
+  const y = (v) => h - (v / top) * (h - 2) - 1;
+  const points = values.map((v, i) => `${x(i).toFixed(1)},${y(v).toFixed(1)}`).join(' ');
+  return `<svg class="sparkline" viewBox="0 0 ${w} ${h}" preserveAspectRatio="none"><polyline points="${points}" /></svg>`;
+}
+
+const ACTIVITY_METRICS = ['rest_calls', 'mcp_calls', 'rest_errors', 'mcp_errors'];
+
+async function refreshActivity() {
+  const data = await fetchJSON('/api/metrics/agents?agg=sum,p95&group_by=hour&since=24h');
+  const el = document.getElementById('activity-info');
+
+  if (!data || data.length === 0) {
+    el.innerHTML = '<p class="empty">No agent activity</p>';
+    return;
+  }
+
+  // The last 24 hourly buckets, oldest first, as the server names them.
+  const hours = [];
+  for (let i = 23; i >= 0; i--) {
+    hours.push(new Date(Date.now() - i * 3600e3).toISOString().slice(0, 13));
+  }
+  let html = '<table>';
+  html += '<tr><td><strong>Metric</strong></td><td><strong>Per hour</strong></td><td><strong>This hour</strong></td><td><strong>p95 per agent</strong></td></tr>';
+  for (const metric of ACTIVITY_METRICS) {
+    const byHour = {};
+    for (const a of data) {
+      if (a.metric_name === metric) byHour[a.group] = a.values;
+    }
+    const sums = hours.map((hr) => (byHour[hr] ? byHour[hr].sum : 0));
+    const now = byHour[hours[hours.length - 1]];
+    html += `<tr><td>${esc(metric)}</td><td>${sparklineSVG(sums)}</td>
+      <td>${now ? now.sum : 0}</td><td>${now ? now.p95 : '-'}</td></tr>`;
+  }
+  html += '</table>';
+  el.innerHTML = html;
+}
+
+async function refreshMilestones() {
+  const data = await fetchJSON('/api/milestones?burndown=true');
+  const el = document.getElementById('milestones-info');
+
+  if (!data || data.length === 0) {
+    el.innerHTML = '<p class="empty">No milestones</p>';
+    return;
+  }
+
+  let html = '';
+  for (const m of data) {
+    const due = m.due ? m.due.slice(0, 10) : 'no due date';
+    const badge = m.overdue ? '<span class="badge badge-error">overdue</span>' : '';
+    html += `<div class="milestone">
+      <div class="milestone-head"><strong>${esc(m.project)} / ${esc(m.name)}</strong> ${badge}
+        <span class="event-time">${m.completed}/${m.total} &middot; ${esc(due)}</span></div>
+      <div class="tt-bar-container"><div class="tt-bar-fill" style="width:${m.percent}%"></div>
+        <span class="tt-bar-label">${m.percent.toFixed(0)}%</span></div>
+      ${burndownSVG(m.burndown, m.total)}
+    </div>`;
+  }
+  el.innerHTML = html;
+}
+
 async function refresh() {
   await Promise.all([
     refreshTokenTax(),
     refreshHealth(),
+    refreshActivity(),
     refreshInstances(),
     refreshState(),
+    refreshMilestones(),
     refreshEvents(),
   ]);
 }
 
+// Full-text search across resources.
+document.getElementById('search-form').addEventListener('submit', async (e) => {
+  e.preventDefault();
+  const q = document.getElementById('search-q').value.trim();
+  const el = document.getElementById('search-results');
+  if (!q) {
+    el.innerHTML = '';
+    return;
+  }
+  const data = await fetchJSON('/api/search?q=' + encodeURIComponent(q));
+  if (!data || data.count === 0) {
+    el.innerHTML = '<p class="empty">No matches</p>';
+    return;
+  }
+  let html = '<table>';
+  for (const r of data.results) {
+    html += `<tr><td><span class="badge">${esc(r.type)}</span> ${esc(r.title)}</td><td>${esc(r.snippet)}</td></tr>`;
+  }
+  html += '</table>';
+  el.innerHTML = html;
+});
+
 // Reset token tax counters.
 document.getElementById('tt-reset').addEventListener('click', async () => {
   await fetch(API_BASE + '/api/metrics/reset', { method: 'POST' });
@@ -0,0 +1,165 @@
+// Contract playground — validate example payloads against a stored contract
+// and save the valid ones as named examples agents can copy.
+const API_BASE = document.querySelector('meta[name="api-base"]')?.content || '';
+
+const $ = (id) => document.getElementById(id);
+let contract = null;
+let examples = [];
+
+function esc(s) {
+  const d = document.createElement('div');
+  d.textContent = s;
+  return d.innerHTML;
+}
+
+async function fetchJSON(path, opts) {
+  try {
+    const resp = await fetch(API_BASE + path, opts);
+    const data = await resp.json().catch(() => null);
+    return { ok: resp.ok, status: resp.status, data };
+  } catch {
+    return { ok: false, status: 0, data: null };
+  }
+}
+
+function contractPath() {
+  return `/api/contracts/${encodeURIComponent($('c-project').value.trim())}/${encodeURIComponent($('c-name').value)}`;
+}
+
+function options(el, values) {
+  el.innerHTML = values.map((v) => `<option value="${esc(v)}">${esc(v)}</option>`).join('');
+}
+
+// loadContracts lists the project's specs and keeps only contracts.
+async function loadContracts() {
+  const project = $('c-project').value.trim();
+  options($('c-name'), []);
+  options($('c-endpoint'), []);
+  contract = null;
+  if (!project) return;
+  const list = await fetchJSON(`/api/specs/${encodeURIComponent(project)}`);
+  if (!list.ok) return;
+  const names = [];
+  for (const s of list.data.specs) {
+    const spec = await fetchJSON(`/api/specs/${encodeURIComponent(project)}/${encodeURIComponent(s.name)}`);
+    if (spec.ok && spec.data && spec.data.kind === 'contract') names.push(s.name);
+  }
+  options($('c-name'), names);
+  await loadContract();
+}
+
+async function loadContract() {
+  const project = $('c-project').value.trim();
+  const name = $('c-name').value;
+  if (!name) {
+    $('c-examples').innerHTML = '<p class="empty">No contracts in this project</p>';
+    return;
+  }
+  const spec = await fetchJSON(`/api/specs/${encodeURIComponent(project)}/${encodeURIComponent(name)}`);
+  contract = spec.ok ? spec.data : null;
+  options($('c-endpoint'), contract ? Object.keys(contract.endpoints || {}).sort() : []);
+  await loadExamples();
+}
+
+async function loadExamples() {
+  const el = $('c-examples');
+  const res = await fetchJSON(contractPath() + '/examples');
+  examples = res.ok ? res.data : [];
+  if (examples.length === 0) {
+    el.innerHTML = '<p class="empty">No saved examples</p>';
+    return;
+  }
+  let html = '<table>';
+  html += '<tr><td><strong>Name</strong></td><td><strong>Endpoint</strong></td><td><strong>Direction</strong></td><td></td></tr>';
+  examples.forEach((ex, i) => {
+    html += `<tr><td>${esc(ex.name)}</td><td>${esc(ex.endpoint)}</td><td>${esc(ex.direction)}</td>
+      <td><button class="btn btn-sm" data-load="${i}">Load</button></td></tr>`;
+  });
+  html += '</table>';
+  el.innerHTML = html;
+}
+
+function showResult(valid, violations, note) {
+  let html = valid
+    ? '<p><span class="badge badge-ok">valid</span> Payload satisfies the contract.</p>'
+    : '<p><span class="badge badge-error">invalid</span></p>';
+  if (note) html += `<p class="empty">${esc(note)}</p>`;
+  if (violations && violations.length > 0) {
+    html += '<table>';
+    for (const v of violations) {
+      html += `<tr><td>${esc(v.path)}</td><td>${esc(v.message)}</td></tr>`;
+    }
+    html += '</table>';
+  }
+  $('c-result').innerHTML = html;
+  $('c-save').hidden = !valid;
+}
+
+function readPayload() {
+  try {
+    return JSON.parse($('c-payload').value);
+  } catch (err) {
+    showResult(false, [{ path: 'payload', message: 'invalid JSON: ' + err.message }]);
+    return undefined;
+  }
+}
+
+$('c-validate').addEventListener('click', async () => {
+  const payload = readPayload();
+  if (payload === undefined) return;
+  if (Array.isArray(payload)) {
+    // The validate endpoint takes objects; arrays are checked when saved.
+    showResult(true, [], 'Array payloads are checked against response_array when saved.');
+    return;
+  }
+  const res = await fetchJSON(contractPath() + '/validate', {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({ endpoint: $('c-endpoint').value, direction: $('c-direction').value, payload }),
+  });
+  if (!res.ok) {
+    showResult(false, [{ path: '', message: res.data?.error || 'validation failed' }]);
+    return;
+  }
+  showResult(res.data.valid, res.data.violations);
+});
+
+$('c-save').addEventListener('submit', async (e) => {
+  e.preventDefault();
+  const payload = readPayload();
+  if (payload === undefined) return;
+  const res = await fetchJSON(contractPath() + '/examples', {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({
+      name: $('c-example-name').value.trim(),
+      endpoint: $('c-endpoint').value,
+      direction: $('c-direction').value,
+      payload,
+    }),
+  });
+  if (!res.ok) {
+    showResult(false, res.data?.violations || [{ path: '', message: res.data?.error || 'save failed' }]);
+    return;
+  }
+  $('c-example-name').value = '';
+  $('c-save').hidden = true;
+  $('c-result').innerHTML = `<p><span class="badge badge-ok">saved</span> ${esc(res.data.name)}</p>`;
+  loadExamples();
+});
+
+$('c-examples').addEventListener('click', (e) => {
+  const i = e.target.dataset.load;
+  if (i === undefined) return;
+  const ex = examples[i];
+  $('c-endpoint').value = ex.endpoint;
+  $('c-direction').value = ex.direction;
+  $('c-payload').value = JSON.stringify(ex.payload, null, 2);
+  $('c-result').innerHTML = '';
+  $('c-save').hidden = true;
+});
+
+$('contract-form').addEventListener('submit', (e) => e.preventDefault());
+$('c-project').addEventListener('change', loadContracts);
+$('c-name').addEventListener('change', loadContract);
+$('c-payload').addEventListener('input', () => { $('c-save').hidden = true; });
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	_ "modernc.org/sqlite"
 )
@@ -67,6 +68,15 @@ func migrate(db *sql.DB) error {
 			updated_by   TEXT NOT NULL DEFAULT ''
 		)`,
 
+		`CREATE TABLE IF NOT EXISTS state_meta (
+			key         TEXT PRIMARY KEY,
+			owner       TEXT NOT NULL DEFAULT '',
+			description TEXT NOT NULL DEFAULT '',
+			tags        TEXT NOT NULL DEFAULT '[]',
+			schema      TEXT NOT NULL DEFAULT '',
+			updated_at  DATETIME NOT NULL DEFAULT (datetime('now'))
+		)`,
+
 		`CREATE TABLE IF NOT EXISTS state_history (
 			key          TEXT NOT NULL,
 			version      INTEGER NOT NULL,
@@ -78,6 +88,14 @@ func migrate(db *sql.DB) error {
 			PRIMARY KEY (key, version)
 		)`,
 
+		`CREATE TABLE IF NOT EXISTS state_retention (
+			pattern      TEXT PRIMARY KEY,
+			max_versions INTEGER NOT NULL DEFAULT 0,
+			max_age      TEXT NOT NULL DEFAULT '',
+			created_at   DATETIME NOT NULL DEFAULT (datetime('now')),
+			updated_at   DATETIME NOT NULL DEFAULT (datetime('now'))
+		)`,
+
 		`CREATE TABLE IF NOT EXISTS specs (
 			project    TEXT NOT NULL,
 			name       TEXT NOT NULL,
@@ -88,27 +106,68 @@ func migrate(db *sql.DB) error {
 			PRIMARY KEY (project, name)
 		)`,
 
+		`CREATE TABLE IF NOT EXISTS spec_history (
+			project    TEXT NOT NULL,
+			name       TEXT NOT NULL,
+			version    INTEGER NOT NULL,
+			data       BLOB,
+			hash       TEXT NOT NULL,
+			updated_at DATETIME NOT NULL,
+			PRIMARY KEY (project, name, version)
+		)`,
+
 		`CREATE TABLE IF NOT EXISTS events (
 			id         INTEGER PRIMARY KEY AUTOINCREMENT,
 			topic      TEXT NOT NULL,
 			data       BLOB,
 			source     TEXT NOT NULL DEFAULT '',
+			signer     TEXT NOT NULL DEFAULT '',
+			signature  TEXT NOT NULL DEFAULT '',
 			created_at DATETIME NOT NULL DEFAULT (datetime('now'))
 		)`,
 
+		`CREATE TABLE IF NOT EXISTS events_latest (
+			topic      TEXT PRIMARY KEY,
+			event_id   INTEGER NOT NULL,
+			data       BLOB,
+			source     TEXT NOT NULL DEFAULT '',
+			signer     TEXT NOT NULL DEFAULT '',
+			signature  TEXT NOT NULL DEFAULT '',
+			created_at DATETIME NOT NULL
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS event_retention (
+			pattern    TEXT PRIMARY KEY,
+			max_count  INTEGER NOT NULL DEFAULT 0,
+			max_age    TEXT NOT NULL DEFAULT '',
+			created_at DATETIME NOT NULL DEFAULT (datetime('now')),
+			updated_at DATETIME NOT NULL DEFAULT (datetime('now'))
+		)`,
+
 		`CREATE TABLE IF NOT EXISTS instances (
 			id            TEXT PRIMARY KEY,
 			name          TEXT NOT NULL,
 			workspace     TEXT NOT NULL DEFAULT '',
 			intent        TEXT NOT NULL DEFAULT '',
 			stack         TEXT NOT NULL DEFAULT '',
+			project       TEXT NOT NULL DEFAULT '',
 			capabilities  TEXT NOT NULL DEFAULT '[]',
 			status        TEXT NOT NULL DEFAULT 'pending',
 			token         TEXT NOT NULL DEFAULT '',
+			public_key    TEXT NOT NULL DEFAULT '',
 			registered_at DATETIME NOT NULL DEFAULT (datetime('now')),
 			last_seen     DATETIME NOT NULL DEFAULT (datetime('now'))
 		)`,
 
+		`CREATE TABLE IF NOT EXISTS liveness_policies (
+			project          TEXT PRIMARY KEY,
+			event            INTEGER NOT NULL DEFAULT 0,
+			webhook          TEXT NOT NULL DEFAULT '',
+			reassign_tasks   INTEGER NOT NULL DEFAULT 0,
+			deregister_after TEXT NOT NULL DEFAULT '',
+			updated_at       DATETIME NOT NULL DEFAULT (datetime('now'))
+		)`,
+
 		`CREATE TABLE IF NOT EXISTS webhooks (
 			id         TEXT PRIMARY KEY,
 			url        TEXT NOT NULL,
@@ -117,7 +176,10 @@ func migrate(db *sql.DB) error {
 			active     INTEGER NOT NULL DEFAULT 1,
 			created_at DATETIME NOT NULL DEFAULT (datetime('now')),
 			last_fired DATETIME,
-			fail_count INTEGER NOT NULL DEFAULT 0
+			fail_count INTEGER NOT NULL DEFAULT 0,
+			previous_secret       TEXT NOT NULL DEFAULT '',
+			previous_secret_until DATETIME,
+			transform             TEXT NOT NULL DEFAULT ''
 		)`,
 
 		`CREATE TABLE IF NOT EXISTS compliance_runs (
@@ -125,11 +187,25 @@ func migrate(db *sql.DB) error {
 			instance_id TEXT NOT NULL,
 			project     TEXT NOT NULL,
 			contract    TEXT NOT NULL,
+			policy      TEXT NOT NULL DEFAULT '',
 			pass        INTEGER NOT NULL DEFAULT 0,
 			violations  TEXT NOT NULL DEFAULT '[]',
+			findings    TEXT NOT NULL DEFAULT '[]',
 			run_at      DATETIME NOT NULL DEFAULT (datetime('now'))
 		)`,
 
+		`CREATE TABLE IF NOT EXISTS compliance_policies (
+			id          TEXT PRIMARY KEY,
+			project     TEXT NOT NULL,
+			name        TEXT NOT NULL,
+			check_type  TEXT NOT NULL,
+			params      TEXT NOT NULL DEFAULT '{}',
+			severity    TEXT NOT NULL DEFAULT 'error',
+			description TEXT NOT NULL DEFAULT '',
+			created_at  DATETIME NOT NULL DEFAULT (datetime('now')),
+			updated_at  DATETIME NOT NULL DEFAULT (datetime('now'))
+		)`,
+
 		`CREATE TABLE IF NOT EXISTS templates (
 			id          TEXT PRIMARY KEY,
 			name        TEXT NOT NULL,
@@ -137,7 +213,9 @@ func migrate(db *sql.DB) error {
 			kind        TEXT NOT NULL DEFAULT 'rules',
 			data        BLOB NOT NULL,
 			tags        TEXT NOT NULL DEFAULT '[]',
+			params      TEXT NOT NULL DEFAULT '[]',
 			version     INTEGER NOT NULL DEFAULT 1,
+			source      TEXT NOT NULL DEFAULT 'local',
 			created_at  DATETIME NOT NULL DEFAULT (datetime('now')),
 			updated_at  DATETIME NOT NULL DEFAULT (datetime('now'))
 		)`,
@@ -160,6 +238,21 @@ func migrate(db *sql.DB) error {
 			PRIMARY KEY (instance_id, metric_name, period)
 		)`,
 
+		`CREATE TABLE IF NOT EXISTS server_counters (
+			name       TEXT PRIMARY KEY,
+			value      INTEGER NOT NULL DEFAULT 0,
+			updated_at DATETIME NOT NULL DEFAULT (datetime('now'))
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS metrics_resets (
+			id             INTEGER PRIMARY KEY AUTOINCREMENT,
+			actor          TEXT NOT NULL DEFAULT '',
+			mcp_calls      INTEGER NOT NULL DEFAULT 0,
+			mcp_data_calls INTEGER NOT NULL DEFAULT 0,
+			rest_calls     INTEGER NOT NULL DEFAULT 0,
+			reset_at       DATETIME NOT NULL DEFAULT (datetime('now'))
+		)`,
+
 		`CREATE TABLE IF NOT EXISTS validation_rules (
 			project     TEXT NOT NULL,
 			rule_id     TEXT NOT NULL,
@@ -177,6 +270,24 @@ func migrate(db *sql.DB) error {
 			PRIMARY KEY (project, rule_id)
 		)`,
 
+		`CREATE TABLE IF NOT EXISTS validation_baselines (
+			project     TEXT NOT NULL,
+			fingerprint TEXT NOT NULL,
+			rule_id     TEXT NOT NULL,
+			filename    TEXT NOT NULL DEFAULT '',
+			match       TEXT NOT NULL DEFAULT '',
+			count       INTEGER NOT NULL DEFAULT 1,
+			created_at  DATETIME NOT NULL DEFAULT (datetime('now')),
+			PRIMARY KEY (project, fingerprint)
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS rule_auto_accept (
+			project      TEXT PRIMARY KEY,
+			severities   TEXT NOT NULL DEFAULT '[]',
+			min_accepted INTEGER NOT NULL DEFAULT 0,
+			updated_at   DATETIME NOT NULL DEFAULT (datetime('now'))
+		)`,
+
 		`CREATE TABLE IF NOT EXISTS llm_usage (
 			id           INTEGER PRIMARY KEY AUTOINCREMENT,
 			instance_id  TEXT NOT NULL DEFAULT '',
@@ -190,6 +301,273 @@ func migrate(db *sql.DB) error {
 			session_tag  TEXT NOT NULL DEFAULT '',
 			created_at   DATETIME NOT NULL DEFAULT (datetime('now'))
 		)`,
+
+		`CREATE TABLE IF NOT EXISTS contract_deprecation_usage (
+			project    TEXT NOT NULL,
+			contract   TEXT NOT NULL,
+			endpoint   TEXT NOT NULL,
+			path       TEXT NOT NULL,
+			sunset     TEXT NOT NULL DEFAULT '',
+			count      INTEGER NOT NULL DEFAULT 0,
+			first_seen DATETIME NOT NULL DEFAULT (datetime('now')),
+			last_seen  DATETIME NOT NULL DEFAULT (datetime('now')),
+			PRIMARY KEY (project, contract, endpoint, path)
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS contract_schedules (
+			id               TEXT PRIMARY KEY,
+			project          TEXT NOT NULL,
+			contract         TEXT NOT NULL,
+			target           TEXT NOT NULL,
+			interval_seconds INTEGER NOT NULL DEFAULT 3600,
+			created_at       DATETIME NOT NULL DEFAULT (datetime('now')),
+			last_run         DATETIME
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS contract_test_results (
+			id          INTEGER PRIMARY KEY AUTOINCREMENT,
+			schedule_id TEXT NOT NULL,
+			project     TEXT NOT NULL,
+			contract    TEXT NOT NULL,
+			target      TEXT NOT NULL,
+			endpoint    TEXT NOT NULL,
+			pass        INTEGER NOT NULL DEFAULT 0,
+			status_code INTEGER NOT NULL DEFAULT 0,
+			violations  TEXT NOT NULL DEFAULT '[]',
+			error       TEXT NOT NULL DEFAULT '',
+			regression  INTEGER NOT NULL DEFAULT 0,
+			run_at      DATETIME NOT NULL DEFAULT (datetime('now'))
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS contract_drift (
+			id          INTEGER PRIMARY KEY AUTOINCREMENT,
+			run_id      TEXT NOT NULL,
+			project     TEXT NOT NULL,
+			contract    TEXT NOT NULL,
+			target      TEXT NOT NULL,
+			endpoint    TEXT NOT NULL,
+			pass        INTEGER NOT NULL DEFAULT 0,
+			status_code INTEGER NOT NULL DEFAULT 0,
+			violations  TEXT NOT NULL DEFAULT '[]',
+			error       TEXT NOT NULL DEFAULT '',
+			run_at      DATETIME NOT NULL DEFAULT (datetime('now'))
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS sandbox_incidents (
+			id          INTEGER PRIMARY KEY AUTOINCREMENT,
+			instance_id TEXT NOT NULL,
+			kind        TEXT NOT NULL,
+			path        TEXT NOT NULL DEFAULT '',
+			detail      TEXT NOT NULL DEFAULT '',
+			reported_by TEXT NOT NULL DEFAULT '',
+			created_at  DATETIME NOT NULL DEFAULT (datetime('now'))
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS policies (
+			id          TEXT PRIMARY KEY,
+			name        TEXT NOT NULL DEFAULT '',
+			action      TEXT NOT NULL,
+			resource    TEXT NOT NULL,
+			condition   TEXT NOT NULL,
+			description TEXT NOT NULL DEFAULT '',
+			created_at  DATETIME NOT NULL DEFAULT (datetime('now'))
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS milestones (
+			id          TEXT PRIMARY KEY,
+			project     TEXT NOT NULL,
+			name        TEXT NOT NULL,
+			description TEXT NOT NULL DEFAULT '',
+			due         DATETIME,
+			tasks       TEXT NOT NULL DEFAULT '[]',
+			events      TEXT NOT NULL DEFAULT '[]',
+			created_at  DATETIME NOT NULL DEFAULT (datetime('now'))
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS contract_examples (
+			project    TEXT NOT NULL,
+			contract   TEXT NOT NULL,
+			name       TEXT NOT NULL,
+			endpoint   TEXT NOT NULL,
+			direction  TEXT NOT NULL DEFAULT 'request',
+			payload    TEXT NOT NULL,
+			created_at DATETIME NOT NULL DEFAULT (datetime('now')),
+			PRIMARY KEY (project, contract, name)
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS project_settings (
+			project               TEXT PRIMARY KEY,
+			default_stack         TEXT NOT NULL DEFAULT '',
+			validate_state_writes INTEGER NOT NULL DEFAULT 0,
+			global_rules          INTEGER NOT NULL DEFAULT 1,
+			event_retention       TEXT NOT NULL DEFAULT '',
+			webhook_defaults      TEXT NOT NULL DEFAULT '{}',
+			error_budgets         TEXT NOT NULL DEFAULT '[]',
+			contract_targets      TEXT NOT NULL DEFAULT '{}',
+			drift_interval        TEXT NOT NULL DEFAULT '',
+			updated_at            DATETIME NOT NULL DEFAULT (datetime('now'))
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS api_tokens (
+			id           TEXT PRIMARY KEY,
+			name         TEXT NOT NULL,
+			instance_id  TEXT NOT NULL DEFAULT '',
+			scopes       TEXT NOT NULL DEFAULT '[]',
+			hash         TEXT NOT NULL UNIQUE,
+			created_at   DATETIME NOT NULL DEFAULT (datetime('now')),
+			expires_at   DATETIME,
+			last_used_at DATETIME,
+			previous_hash       TEXT NOT NULL DEFAULT '',
+			previous_hash_until DATETIME,
+			project      TEXT NOT NULL DEFAULT '',
+			topics       TEXT NOT NULL DEFAULT ''
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS projects (
+			name        TEXT PRIMARY KEY,
+			description TEXT NOT NULL DEFAULT '',
+			created_at  DATETIME NOT NULL DEFAULT (datetime('now'))
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS rule_packs (
+			project      TEXT NOT NULL,
+			name         TEXT NOT NULL,
+			version      TEXT NOT NULL,
+			description  TEXT NOT NULL DEFAULT '',
+			author       TEXT NOT NULL DEFAULT '',
+			signed_by    TEXT NOT NULL DEFAULT '',
+			rules        TEXT NOT NULL DEFAULT '[]',
+			contracts    TEXT NOT NULL DEFAULT '[]',
+			installed_at DATETIME NOT NULL DEFAULT (datetime('now')),
+			PRIMARY KEY (project, name)
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS projections (
+			id           TEXT PRIMARY KEY,
+			name         TEXT NOT NULL DEFAULT '',
+			topic        TEXT NOT NULL,
+			key          TEXT NOT NULL,
+			strategy     TEXT NOT NULL DEFAULT 'replace',
+			max_items    INTEGER NOT NULL DEFAULT 0,
+			description  TEXT NOT NULL DEFAULT '',
+			applied      INTEGER NOT NULL DEFAULT 0,
+			last_error   TEXT NOT NULL DEFAULT '',
+			last_applied DATETIME,
+			created_at   DATETIME NOT NULL DEFAULT (datetime('now'))
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS schedules (
+			id          TEXT PRIMARY KEY,
+			name        TEXT NOT NULL DEFAULT '',
+			cron        TEXT NOT NULL,
+			timezone    TEXT NOT NULL DEFAULT '',
+			topic       TEXT NOT NULL,
+			payload     TEXT NOT NULL DEFAULT '',
+			description TEXT NOT NULL DEFAULT '',
+			paused      INTEGER NOT NULL DEFAULT 0,
+			fired       INTEGER NOT NULL DEFAULT 0,
+			last_error  TEXT NOT NULL DEFAULT '',
+			last_fired  DATETIME,
+			next_run    DATETIME,
+			created_at  DATETIME NOT NULL DEFAULT (datetime('now'))
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS tenants (
+			id          TEXT PRIMARY KEY,
+			name        TEXT NOT NULL DEFAULT '',
+			description TEXT NOT NULL DEFAULT '',
+			status      TEXT NOT NULL DEFAULT 'active',
+			created_at  DATETIME NOT NULL DEFAULT (datetime('now'))
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS tenant_owners (
+			token_hash TEXT PRIMARY KEY,
+			tenant_id  TEXT NOT NULL
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS tasks (
+			id            TEXT PRIMARY KEY,
+			project       TEXT NOT NULL,
+			queue         TEXT NOT NULL DEFAULT '',
+			title         TEXT NOT NULL,
+			payload       TEXT NOT NULL DEFAULT 'null',
+			priority      INTEGER NOT NULL DEFAULT 0,
+			status        TEXT NOT NULL DEFAULT 'pending',
+			claimed_by    TEXT NOT NULL DEFAULT '',
+			claimed_until DATETIME,
+			attempts      INTEGER NOT NULL DEFAULT 0,
+			max_attempts  INTEGER NOT NULL DEFAULT 3,
+			result        TEXT NOT NULL DEFAULT 'null',
+			error         TEXT NOT NULL DEFAULT '',
+			created_by    TEXT NOT NULL DEFAULT '',
+			created_at    DATETIME NOT NULL DEFAULT (datetime('now')),
+			updated_at    DATETIME NOT NULL DEFAULT (datetime('now'))
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS messages (
+			id         TEXT PRIMARY KEY,
+			sender     TEXT NOT NULL DEFAULT '',
+			recipient  TEXT NOT NULL,
+			capability TEXT NOT NULL DEFAULT '',
+			subject    TEXT NOT NULL DEFAULT '',
+			body       TEXT NOT NULL DEFAULT 'null',
+			reply_to   TEXT NOT NULL DEFAULT '',
+			read_at    DATETIME,
+			created_at DATETIME NOT NULL DEFAULT (datetime('now'))
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS quarantine (
+			id             TEXT PRIMARY KEY,
+			kind           TEXT NOT NULL,
+			ref            TEXT NOT NULL,
+			instance_id    TEXT NOT NULL,
+			data           TEXT NOT NULL,
+			quarantined_at DATETIME NOT NULL DEFAULT (datetime('now'))
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS webhook_deliveries (
+			id            INTEGER PRIMARY KEY AUTOINCREMENT,
+			webhook_id    TEXT NOT NULL,
+			event_id      INTEGER NOT NULL DEFAULT 0,
+			topic         TEXT NOT NULL DEFAULT '',
+			kind          TEXT NOT NULL DEFAULT 'event',
+			attempt       INTEGER NOT NULL DEFAULT 1,
+			success       INTEGER NOT NULL DEFAULT 0,
+			status_code   INTEGER NOT NULL DEFAULT 0,
+			latency_ms    INTEGER NOT NULL DEFAULT 0,
+			response      TEXT NOT NULL DEFAULT '',
+			error         TEXT NOT NULL DEFAULT '',
+			payload       TEXT NOT NULL DEFAULT '',
+			next_retry_at DATETIME,
+			created_at    DATETIME NOT NULL DEFAULT (datetime('now'))
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS webhook_dead_letters (
+			id          INTEGER PRIMARY KEY AUTOINCREMENT,
+			webhook_id  TEXT NOT NULL,
+			event_id    INTEGER NOT NULL,
+			topic       TEXT NOT NULL DEFAULT '',
+			delivery_id INTEGER NOT NULL,
+			attempts    INTEGER NOT NULL,
+			last_error  TEXT NOT NULL DEFAULT '',
+			created_at  DATETIME NOT NULL DEFAULT (datetime('now'))
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS users (
+			id           TEXT PRIMARY KEY,
+			name         TEXT NOT NULL UNIQUE,
+			role         TEXT NOT NULL,
+			hash         TEXT NOT NULL UNIQUE,
+			created_at   DATETIME NOT NULL DEFAULT (datetime('now')),
+			last_seen_at DATETIME
+		)`,
+
+		`CREATE VIRTUAL TABLE IF NOT EXISTS search_index USING fts5(
+			type UNINDEXED,
+			ref UNINDEXED,
+			title,
+			body
+		)`,
 	}
 
 	// Migrate existing databases: add columns that may not exist yet.
@@ -204,6 +582,24 @@ func migrate(db *sql.DB) error {
 		`ALTER TABLE validation_rules ADD COLUMN created_at DATETIME NOT NULL DEFAULT (datetime('now'))`,
 		`ALTER TABLE instances ADD COLUMN status TEXT NOT NULL DEFAULT 'pending'`,
 		`ALTER TABLE instances ADD COLUMN capabilities TEXT NOT NULL DEFAULT '[]'`,
+		`ALTER TABLE instances ADD COLUMN public_key TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE events ADD COLUMN signer TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE events ADD COLUMN signature TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE webhooks ADD COLUMN previous_secret TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE webhooks ADD COLUMN previous_secret_until DATETIME`,
+		`ALTER TABLE project_settings ADD COLUMN error_budgets TEXT NOT NULL DEFAULT '[]'`,
+		`ALTER TABLE api_tokens ADD COLUMN previous_hash TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE api_tokens ADD COLUMN previous_hash_until DATETIME`,
+		`ALTER TABLE project_settings ADD COLUMN contract_targets TEXT NOT NULL DEFAULT '{}'`,
+		`ALTER TABLE project_settings ADD COLUMN drift_interval TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE instances ADD COLUMN project TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE api_tokens ADD COLUMN project TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE templates ADD COLUMN source TEXT NOT NULL DEFAULT 'local'`,
+		`ALTER TABLE compliance_runs ADD COLUMN policy TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE compliance_runs ADD COLUMN findings TEXT NOT NULL DEFAULT '[]'`,
+		`ALTER TABLE templates ADD COLUMN params TEXT NOT NULL DEFAULT '[]'`,
+		`ALTER TABLE api_tokens ADD COLUMN topics TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE webhooks ADD COLUMN transform TEXT NOT NULL DEFAULT ''`,
 	}
 	for _, ddl := range alterMigrations {
 		db.Exec(ddl) // ignore error — column may already exist
@@ -222,8 +618,26 @@ func migrate(db *sql.DB) error {
 		`CREATE INDEX IF NOT EXISTS idx_llm_usage_instance ON llm_usage(instance_id)`,
 		`CREATE INDEX IF NOT EXISTS idx_llm_usage_project ON llm_usage(project)`,
 		`CREATE INDEX IF NOT EXISTS idx_llm_usage_created ON llm_usage(created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_contract_test_results_schedule ON contract_test_results(schedule_id, endpoint)`,
+		`CREATE INDEX IF NOT EXISTS idx_contract_drift_contract ON contract_drift(project, contract)`,
+		`CREATE INDEX IF NOT EXISTS idx_sandbox_incidents_instance ON sandbox_incidents(instance_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_milestones_project ON milestones(project)`,
+		`CREATE INDEX IF NOT EXISTS idx_state_meta_owner ON state_meta(owner)`,
+		`CREATE INDEX IF NOT EXISTS idx_api_tokens_instance ON api_tokens(instance_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_instances_token ON instances(token)`,
+		`CREATE INDEX IF NOT EXISTS idx_instances_project ON instances(project)`,
+		`CREATE INDEX IF NOT EXISTS idx_tasks_queue ON tasks(project, queue, status)`,
+		`CREATE INDEX IF NOT EXISTS idx_tenant_owners_tenant ON tenant_owners(tenant_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_messages_recipient ON messages(recipient, read_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_quarantine_instance ON quarantine(instance_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook ON webhook_deliveries(webhook_id, event_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_retry ON webhook_deliveries(next_retry_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_webhook_dead_letters_webhook ON webhook_dead_letters(webhook_id, event_id)`,
 	}
 
+	var hasRetention int
+	db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'event_retention'`).Scan(&hasRetention)
+
 	for _, ddl := range tables {
 		if _, err := db.Exec(ddl); err != nil {
 			return fmt.Errorf("exec DDL: %w", err)
@@ -235,5 +649,108 @@ func migrate(db *sql.DB) error {
 		}
 	}
 
+	if err := migrateLatestEvents(db); err != nil {
+		return err
+	}
+	if hasRetention == 0 {
+		// Seed the default retention classes once, so deleting them sticks.
+		// Controller decisions are kept far longer than the global cap.
+		if _, err := db.Exec(`INSERT INTO event_retention (pattern, max_count, max_age)
+			VALUES ('*.controller.*', 10000, '2160h')`); err != nil {
+			return fmt.Errorf("seed event retention: %w", err)
+		}
+	}
+	return migrateSearch(db)
+}
+
+// migrateLatestEvents creates the trigger that keeps events_latest holding
+// the newest event of each topic, and backfills it for existing databases.
+// Rows outlive history pruning, so the latest event of a quiet topic stays
+// readable.
+func migrateLatestEvents(db *sql.DB) error {
+	const upsert = `INSERT INTO events_latest (topic, event_id, data, source, signer, signature, created_at)
+		%s
+		ON CONFLICT(topic) DO UPDATE SET
+			event_id = excluded.event_id, data = excluded.data, source = excluded.source,
+			signer = excluded.signer, signature = excluded.signature, created_at = excluded.created_at
+		WHERE excluded.event_id > events_latest.event_id`
+	trigger := `CREATE TRIGGER IF NOT EXISTS events_latest_ai AFTER INSERT ON events BEGIN ` +
+		fmt.Sprintf(upsert, `VALUES (NEW.topic, NEW.id, NEW.data, NEW.source, NEW.signer, NEW.signature, NEW.created_at)`) +
+		`; END`
+	if _, err := db.Exec(trigger); err != nil {
+		return fmt.Errorf("exec latest events trigger: %w", err)
+	}
+
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM events_latest`).Scan(&n); err != nil {
+		return fmt.Errorf("count latest events: %w", err)
+	}
+	if n > 0 {
+		return nil
+	}
+	backfill := fmt.Sprintf(upsert, `SELECT topic, id, data, source, signer, signature, created_at FROM events
+		WHERE id IN (SELECT MAX(id) FROM events GROUP BY topic)`)
+	if _, err := db.Exec(backfill); err != nil {
+		return fmt.Errorf("backfill latest events: %w", err)
+	}
+	return nil
+}
+
+// searchSources maps each searchable table to the search_index row it produces.
+// Columns are written as SQL expressions over a row alias (NEW or OLD).
+// Encrypted state values and specs, which start with a NUL byte, are
+// indexed by key only.
+var searchSources = []struct {
+	table, typ, ref, title, body string
+}{
+	{"state", "state", "%s.key", "%s.key", "CASE WHEN substr(%s.value, 1, 1) = x'00' THEN '' ELSE CAST(%s.value AS TEXT) END"},
+	{"specs", "specs", "%s.project || '/' || %s.name", "%s.project || '/' || %s.name", "CASE WHEN substr(%s.data, 1, 1) = x'00' THEN '' ELSE CAST(%s.data AS TEXT) END"},
+	{"validation_rules", "rules", "%s.project || '/' || %s.rule_id", "%s.project || '/' || %s.rule_id", "%s.pattern || ' ' || %s.message || ' ' || %s.context"},
+	{"events", "events", "CAST(%s.id AS TEXT)", "%s.topic", "%s.topic || ' ' || %s.source || ' ' || CAST(%s.data AS TEXT)"},
+	{"templates", "templates", "%s.id", "%s.name", "%s.description || ' ' || %s.tags || ' ' || CAST(%s.data AS TEXT)"},
+}
+
+// migrateSearch creates the triggers that keep search_index in sync with
+// the source tables, and backfills the index for existing databases.
+func migrateSearch(db *sql.DB) error {
+	expr := func(tmpl, alias string) string {
+		return strings.ReplaceAll(tmpl, "%s", alias)
+	}
+	for _, src := range searchSources {
+		insert := fmt.Sprintf(`INSERT INTO search_index (type, ref, title, body) VALUES ('%s', %s, %s, %s);`,
+			src.typ, expr(src.ref, "NEW"), expr(src.title, "NEW"), expr(src.body, "NEW"))
+		remove := fmt.Sprintf(`DELETE FROM search_index WHERE type = '%s' AND ref = %s;`,
+			src.typ, expr(src.ref, "OLD"))
+		// Recreated on every start, so changes to the expressions apply
+		// to existing databases.
+		triggers := []string{
+			fmt.Sprintf(`DROP TRIGGER IF EXISTS search_%s_ai`, src.table),
+			fmt.Sprintf(`DROP TRIGGER IF EXISTS search_%s_au`, src.table),
+			fmt.Sprintf(`DROP TRIGGER IF EXISTS search_%s_ad`, src.table),
+			fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS search_%s_ai AFTER INSERT ON %s BEGIN %s END`, src.table, src.table, insert),
+			fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS search_%s_au AFTER UPDATE ON %s BEGIN %s %s END`, src.table, src.table, remove, insert),
+			fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS search_%s_ad AFTER DELETE ON %s BEGIN %s END`, src.table, src.table, remove),
+		}
+		for _, ddl := range triggers {
+			if _, err := db.Exec(ddl); err != nil {
+				return fmt.Errorf("exec search trigger: %w", err)
+			}
+		}
+	}
+
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM search_index`).Scan(&n); err != nil {
+		return fmt.Errorf("count search index: %w", err)
+	}
+	if n > 0 {
+		return nil
+	}
+	for _, src := range searchSources {
+		backfill := fmt.Sprintf(`INSERT INTO search_index (type, ref, title, body) SELECT '%s', %s, %s, %s FROM %s AS r`,
+			src.typ, expr(src.ref, "r"), expr(src.title, "r"), expr(src.body, "r"), src.table)
+		if _, err := db.Exec(backfill); err != nil {
+			return fmt.Errorf("backfill search index: %w", err)
+		}
+	}
 	return nil
 }
@@ -0,0 +1,243 @@
+// Package encryption encrypts stored values at rest with AES-256-GCM.
+//
+// A Keyring holds the current key, which encrypts new values, and any
+// previous keys, which still decrypt values written before a rotation.
+// Each encrypted value records the ID of its key, so values under several
+// keys can coexist until they are re-encrypted. Values written before
+// encryption was enabled are returned unchanged, so it can be switched on
+// for an existing database.
+package encryption
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// KeySize is the length of a key: AES-256.
+const KeySize = 32
+
+// prefix marks an encrypted value. It starts with a NUL byte, which
+// neither JSON nor text values do.
+var prefix = []byte("\x00koor-enc1")
+
+const idSize = 8
+
+// ErrNoKey is returned when a value is encrypted but no keyring is
+// configured, or when re-encrypting without one.
+var ErrNoKey = errors.New("encryption not configured")
+
+// ErrUnknownKey is returned for a value encrypted under a key that is not
+// in the keyring.
+var ErrUnknownKey = errors.New("value is encrypted with a key that is not configured")
+
+type key struct {
+	id   [idSize]byte
+	aead cipher.AEAD
+}
+
+// Keyring encrypts with its current key and decrypts with any of its keys.
+// A nil *Keyring stores values in plain text.
+type Keyring struct {
+	keys []key // keys[0] is the current key
+}
+
+// GenerateKey returns a new random key, base64-encoded.
+func GenerateKey() (string, error) {
+	b := make([]byte, KeySize)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate key: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+// ParseKeys reads base64 keys separated by commas, spaces or newlines. The
+// first is the current key; the rest are previous keys kept for rotation.
+func ParseKeys(s string) (*Keyring, error) {
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\n' || r == '\r' || r == '\t'
+	})
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("no encryption key given")
+	}
+	kr := &Keyring{}
+	for i, f := range fields {
+		raw, err := base64.StdEncoding.DecodeString(f)
+		if err != nil || len(raw) != KeySize {
+			return nil, fmt.Errorf("encryption key %d is not %d base64-encoded bytes", i+1, KeySize)
+		}
+		block, err := aes.NewCipher(raw)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(raw)
+		var k key
+		copy(k.id[:], sum[:idSize])
+		k.aead = aead
+		kr.keys = append(kr.keys, k)
+	}
+	return kr, nil
+}
+
+// LoadKeyFile reads keys from a file, one per line, current key first.
+func LoadKeyFile(path string) (*Keyring, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read encryption key file: %w", err)
+	}
+	return ParseKeys(string(data))
+}
+
+// KeyID identifies the current key: the first 16 hex digits of the
+// SHA-256 of the key. It is "" for a nil Keyring.
+func (kr *Keyring) KeyID() string {
+	if kr == nil {
+		return ""
+	}
+	return hex.EncodeToString(kr.keys[0].id[:])
+}
+
+// IsEncrypted reports whether a stored value is encrypted.
+func IsEncrypted(stored []byte) bool {
+	return bytes.HasPrefix(stored, prefix)
+}
+
+// Encrypt encrypts a value with the current key. A nil Keyring returns it
+// unchanged.
+func (kr *Keyring) Encrypt(plain []byte) ([]byte, error) {
+	if kr == nil {
+		return plain, nil
+	}
+	k := kr.keys[0]
+	nonce := make([]byte, k.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("generate nonce: %w", err)
+	}
+	out := make([]byte, 0, len(prefix)+idSize+len(nonce)+len(plain)+k.aead.Overhead())
+	out = append(out, prefix...)
+	out = append(out, k.id[:]...)
+	out = append(out, nonce...)
+	return k.aead.Seal(out, nonce, plain, k.id[:]), nil
+}
+
+// Decrypt returns the plain text of a stored value. Values that are not
+// encrypted are returned unchanged.
+func (kr *Keyring) Decrypt(stored []byte) ([]byte, error) {
+	if !IsEncrypted(stored) {
+		return stored, nil
+	}
+	if kr == nil {
+		return nil, ErrNoKey
+	}
+	rest := stored[len(prefix):]
+	if len(rest) < idSize {
+		return nil, fmt.Errorf("encrypted value is truncated")
+	}
+	id := rest[:idSize]
+	for _, k := range kr.keys {
+		if !bytes.Equal(k.id[:], id) {
+			continue
+		}
+		rest = rest[idSize:]
+		if len(rest) < k.aead.NonceSize() {
+			return nil, fmt.Errorf("encrypted value is truncated")
+		}
+		nonce, sealed := rest[:k.aead.NonceSize()], rest[k.aead.NonceSize():]
+		plain, err := k.aead.Open(nil, nonce, sealed, id)
+		if err != nil {
+			return nil, fmt.Errorf("decrypt value: %w", err)
+		}
+		return plain, nil
+	}
+	return nil, ErrUnknownKey
+}
+
+// Current reports whether a stored value is already encrypted with the
+// current key, so re-encryption can skip it.
+func (kr *Keyring) Current(stored []byte) bool {
+	if kr == nil || !IsEncrypted(stored) || len(stored) < len(prefix)+idSize {
+		return false
+	}
+	return bytes.Equal(stored[len(prefix):len(prefix)+idSize], kr.keys[0].id[:])
+}
+
+// Reencrypt rewrites every value in a table column that is not yet
+// encrypted with the current key: plain values are encrypted, and values
+// under previous keys are decrypted and encrypted again. Rows are
+// identified by keyColumns. It returns the number of values rewritten.
+func (kr *Keyring) Reencrypt(ctx context.Context, db *sql.DB, table, column string, keyColumns ...string) (int, error) {
+	if kr == nil {
+		return 0, ErrNoKey
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin re-encrypt %s: %w", table, err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf(`SELECT %s, %s FROM %s`, strings.Join(keyColumns, ", "), column, table))
+	if err != nil {
+		return 0, fmt.Errorf("query %s: %w", table, err)
+	}
+	type row struct {
+		keys  []any
+		value []byte
+	}
+	var stale []row
+	for rows.Next() {
+		r := row{keys: make([]any, len(keyColumns))}
+		dest := make([]any, len(keyColumns)+1)
+		for i := range keyColumns {
+			dest[i] = &r.keys[i]
+		}
+		dest[len(keyColumns)] = &r.value
+		if err := rows.Scan(dest...); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("scan %s: %w", table, err)
+		}
+		if !kr.Current(r.value) {
+			stale = append(stale, r)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("query %s: %w", table, err)
+	}
+
+	where := make([]string, len(keyColumns))
+	for i, c := range keyColumns {
+		where[i] = c + " = ?"
+	}
+	update := fmt.Sprintf(`UPDATE %s SET %s = ? WHERE %s`, table, column, strings.Join(where, " AND "))
+	for _, r := range stale {
+		plain, err := kr.Decrypt(r.value)
+		if err != nil {
+			return 0, fmt.Errorf("%s %v: %w", table, r.keys, err)
+		}
+		sealed, err := kr.Encrypt(plain)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := tx.ExecContext(ctx, update, append([]any{sealed}, r.keys...)...); err != nil {
+			return 0, fmt.Errorf("update %s: %w", table, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit re-encrypt %s: %w", table, err)
+	}
+	return len(stale), nil
+}
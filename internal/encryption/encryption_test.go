@@ -0,0 +1,127 @@
+package encryption_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DavidRHerbert/koor/internal/db"
+	"github.com/DavidRHerbert/koor/internal/encryption"
+)
+
+func testKeyring(t *testing.T, keys ...string) *encryption.Keyring {
+	t.Helper()
+	var s string
+	for _, k := range keys {
+		s += k + ","
+	}
+	kr, err := encryption.ParseKeys(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kr
+}
+
+func newKey(t *testing.T) string {
+	t.Helper()
+	k, err := encryption.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	kr := testKeyring(t, newKey(t))
+	plain := []byte(`{"secret":"hunter2"}`)
+
+	sealed, err := kr.Encrypt(plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !encryption.IsEncrypted(sealed) || bytes.Contains(sealed, []byte("hunter2")) {
+		t.Fatalf("value not encrypted: %q", sealed)
+	}
+	if again, _ := kr.Encrypt(plain); bytes.Equal(again, sealed) {
+		t.Error("expected a fresh nonce per encryption")
+	}
+	got, err := kr.Decrypt(sealed)
+	if err != nil || !bytes.Equal(got, plain) {
+		t.Fatalf("Decrypt = %q, %v", got, err)
+	}
+
+	// Values from before encryption was enabled read as they are.
+	if got, err := kr.Decrypt(plain); err != nil || !bytes.Equal(got, plain) {
+		t.Errorf("plain value: %q, %v", got, err)
+	}
+	// A nil keyring stores plain text but cannot read encrypted values.
+	var none *encryption.Keyring
+	if got, _ := none.Encrypt(plain); !bytes.Equal(got, plain) {
+		t.Errorf("nil keyring encrypted: %q", got)
+	}
+	if _, err := none.Decrypt(sealed); !errors.Is(err, encryption.ErrNoKey) {
+		t.Errorf("nil keyring: expected ErrNoKey, got %v", err)
+	}
+	if _, err := testKeyring(t, newKey(t)).Decrypt(sealed); !errors.Is(err, encryption.ErrUnknownKey) {
+		t.Errorf("other key: expected ErrUnknownKey, got %v", err)
+	}
+
+	sealed[len(sealed)-1] ^= 1
+	if _, err := kr.Decrypt(sealed); err == nil {
+		t.Error("expected tampered value to fail")
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	for _, s := range []string{"", "not-base64!", "c2hvcnQ="} {
+		if _, err := encryption.ParseKeys(s); err == nil {
+			t.Errorf("ParseKeys(%q): expected an error", s)
+		}
+	}
+	a, b := newKey(t), newKey(t)
+	kr, err := encryption.ParseKeys(a + "\n" + b + "\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kr.KeyID() != testKeyring(t, a).KeyID() || len(kr.KeyID()) != 16 {
+		t.Errorf("expected the first key to be current, got %s", kr.KeyID())
+	}
+}
+
+func TestReencrypt(t *testing.T) {
+	ctx := context.Background()
+	database, err := db.OpenMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+
+	oldKey, newKeyStr := newKey(t), newKey(t)
+	old := testKeyring(t, oldKey)
+	sealed, _ := old.Encrypt([]byte(`"old"`))
+	database.ExecContext(ctx, `INSERT INTO state (key, value, hash) VALUES ('a', ?, ''), ('b', ?, '')`, sealed, []byte(`"plain"`))
+
+	if _, err := (*encryption.Keyring)(nil).Reencrypt(ctx, database, "state", "value", "key"); !errors.Is(err, encryption.ErrNoKey) {
+		t.Errorf("expected ErrNoKey, got %v", err)
+	}
+
+	rotated := testKeyring(t, newKeyStr, oldKey)
+	n, err := rotated.Reencrypt(ctx, database, "state", "value", "key")
+	if err != nil || n != 2 {
+		t.Fatalf("Reencrypt = %d, %v; want 2", n, err)
+	}
+	if n, _ := rotated.Reencrypt(ctx, database, "state", "value", "key"); n != 0 {
+		t.Errorf("second pass rewrote %d values", n)
+	}
+
+	current := testKeyring(t, newKeyStr)
+	for key, want := range map[string]string{"a": `"old"`, "b": `"plain"`} {
+		var stored []byte
+		database.QueryRowContext(ctx, `SELECT value FROM state WHERE key = ?`, key).Scan(&stored)
+		got, err := current.Decrypt(stored)
+		if err != nil || string(got) != want || !current.Current(stored) {
+			t.Errorf("%s = %q, %v; want %s under the new key", key, got, err, want)
+		}
+	}
+}
@@ -4,8 +4,10 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"path"
+	"strings"
 	"sync"
 	"time"
 )
@@ -16,9 +18,20 @@ type Event struct {
 	Topic     string          `json:"topic"`
 	Data      json.RawMessage `json:"data"`
 	Source    string          `json:"source"`
+	Signer    string          `json:"signer,omitempty"`    // instance ID whose key signed the event
+	Signature string          `json:"signature,omitempty"` // base64 Ed25519 signature of topic + "\n" + data
 	CreatedAt time.Time       `json:"created_at"`
 }
 
+// InternalPrefix starts the topics the server uses for its own streams,
+// such as the audit log. Internal events are not stored, cannot be
+// published by clients, and only reach patterns that start with the
+// prefix too, so wildcard subscribers never see them.
+const InternalPrefix = "_internal."
+
+// ErrInternalTopic is returned when publishing to an internal topic.
+var ErrInternalTopic = errors.New("topics starting with " + InternalPrefix + " are reserved")
+
 // Subscriber receives events matching a pattern.
 type Subscriber struct {
 	Pattern string
@@ -32,8 +45,18 @@ type Bus struct {
 	mu          sync.RWMutex
 	subscribers []*Subscriber
 	stopPrune   chan struct{}
+	retention   RetentionFunc
+	project     ProjectFunc
 }
 
+// RetentionFunc reports how long events are kept per topic prefix, for
+// prefixes that expire sooner than the global history cap.
+type RetentionFunc func(ctx context.Context) (map[string]time.Duration, error)
+
+// ProjectFunc is called with every published event, before it is fanned
+// out, to materialize it elsewhere (e.g. as state).
+type ProjectFunc func(ctx context.Context, ev Event)
+
 // New creates a new event Bus.
 func New(db *sql.DB, maxHistory int) *Bus {
 	if maxHistory <= 0 {
@@ -46,8 +69,8 @@ func New(db *sql.DB, maxHistory int) *Bus {
 	}
 }
 
-// StartPruning launches a background goroutine that periodically removes
-// events beyond maxHistory. Call Stop() to shut it down.
+// StartPruning launches a background goroutine that periodically prunes
+// the history (see Prune). Call Stop() to shut it down.
 func (b *Bus) StartPruning(interval time.Duration) {
 	go func() {
 		ticker := time.NewTicker(interval)
@@ -71,12 +94,35 @@ func (b *Bus) Stop() {
 	}
 }
 
-// Prune removes events beyond maxHistory. Called automatically by
+// SetRetention attaches per-prefix retention consulted by Prune.
+func (b *Bus) SetRetention(fn RetentionFunc) {
+	b.retention = fn
+}
+
+// Prune applies the retention classes, removes unclassified events beyond
+// maxHistory, and removes events older than the retention of their topic
+// prefix. Deletes run in small batches. Called automatically by
 // StartPruning, but can also be invoked manually.
 func (b *Bus) Prune() {
-	b.db.Exec(
-		`DELETE FROM events WHERE id NOT IN (SELECT id FROM events ORDER BY id DESC LIMIT ?)`,
-		b.maxHistory)
+	ctx := context.Background()
+	b.pruneClasses(ctx)
+	if b.retention == nil {
+		return
+	}
+	prefixes, err := b.retention(ctx)
+	if err != nil {
+		return
+	}
+	now := time.Now().UTC()
+	for prefix, keep := range prefixes {
+		b.deleteBatched(ctx, `SELECT id FROM events WHERE substr(topic, 1, ?) = ? AND created_at < ?`,
+			len(prefix), prefix, now.Add(-keep).Format("2006-01-02 15:04:05"))
+	}
+}
+
+// SetProjections attaches a ProjectFunc run on every publish.
+func (b *Bus) SetProjections(fn ProjectFunc) {
+	b.project = fn
 }
 
 // Subscribe registers a subscriber for events matching pattern.
@@ -92,6 +138,17 @@ func (b *Bus) Subscribe(pattern string) *Subscriber {
 	return sub
 }
 
+// Depth reports the number of subscribers and the events buffered in their
+// channels but not yet consumed.
+func (b *Bus) Depth() (subscribers, queued int) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, sub := range b.subscribers {
+		queued += len(sub.Ch)
+	}
+	return len(b.subscribers), queued
+}
+
 // Unsubscribe removes a subscriber and closes its channel.
 func (b *Bus) Unsubscribe(sub *Subscriber) {
 	b.mu.Lock()
@@ -108,10 +165,20 @@ func (b *Bus) Unsubscribe(sub *Subscriber) {
 // Publish writes an event to SQLite history, prunes old events,
 // and fans out to matching subscribers.
 func (b *Bus) Publish(ctx context.Context, topic string, data json.RawMessage, source string) (*Event, error) {
+	return b.PublishSigned(ctx, topic, data, source, "", "")
+}
+
+// PublishSigned is Publish for an event whose signature has already been
+// verified; signer and signature are stored so others can re-verify it.
+func (b *Bus) PublishSigned(ctx context.Context, topic string, data json.RawMessage, source, signer, signature string) (*Event, error) {
+	if strings.HasPrefix(topic, InternalPrefix) {
+		return nil, ErrInternalTopic
+	}
+
 	// Insert into SQLite.
 	res, err := b.db.ExecContext(ctx,
-		`INSERT INTO events (topic, data, source, created_at) VALUES (?, ?, ?, datetime('now'))`,
-		topic, []byte(data), source)
+		`INSERT INTO events (topic, data, source, signer, signature, created_at) VALUES (?, ?, ?, ?, ?, datetime('now'))`,
+		topic, []byte(data), source, signer, signature)
 	if err != nil {
 		return nil, fmt.Errorf("insert event: %w", err)
 	}
@@ -123,20 +190,92 @@ func (b *Bus) Publish(ctx context.Context, topic string, data json.RawMessage, s
 		return nil, fmt.Errorf("read back event: %w", err)
 	}
 
-	// Fan out to subscribers.
+	// Project it first, so subscribers that read the projected state
+	// see this event in it.
+	if b.project != nil {
+		b.project(ctx, *ev)
+	}
+
+	b.fanOut(*ev)
+	return ev, nil
+}
+
+// Draft is an event to publish with PublishBatch.
+type Draft struct {
+	Topic     string
+	Data      json.RawMessage
+	Source    string
+	Signer    string
+	Signature string
+}
+
+// PublishBatch stores several events in one transaction, so either all of
+// them are published or none is, then projects and fans them out in order.
+func (b *Bus) PublishBatch(ctx context.Context, drafts []Draft) ([]Event, error) {
+	for _, d := range drafts {
+		if strings.HasPrefix(d.Topic, InternalPrefix) {
+			return nil, ErrInternalTopic
+		}
+	}
+
+	tx, err := b.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	ids := make([]int64, 0, len(drafts))
+	for _, d := range drafts {
+		res, err := tx.ExecContext(ctx,
+			`INSERT INTO events (topic, data, source, signer, signature, created_at) VALUES (?, ?, ?, ?, ?, datetime('now'))`,
+			d.Topic, []byte(d.Data), d.Source, d.Signer, d.Signature)
+		if err != nil {
+			return nil, fmt.Errorf("insert event: %w", err)
+		}
+		id, _ := res.LastInsertId()
+		ids = append(ids, id)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit events: %w", err)
+	}
+
+	published := make([]Event, 0, len(ids))
+	for _, id := range ids {
+		ev, err := b.getByID(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("read back event: %w", err)
+		}
+		if b.project != nil {
+			b.project(ctx, *ev)
+		}
+		b.fanOut(*ev)
+		published = append(published, *ev)
+	}
+	return published, nil
+}
+
+// PublishInternal hands an event on an internal topic to its subscribers
+// without storing it. The event has no ID.
+func (b *Bus) PublishInternal(topic string, data json.RawMessage, source string) {
+	if !strings.HasPrefix(topic, InternalPrefix) {
+		topic = InternalPrefix + topic
+	}
+	b.fanOut(Event{Topic: topic, Data: data, Source: source, CreatedAt: time.Now().UTC()})
+}
+
+// fanOut delivers an event to the matching subscribers.
+func (b *Bus) fanOut(ev Event) {
 	b.mu.RLock()
 	defer b.mu.RUnlock()
 	for _, sub := range b.subscribers {
-		if matchTopic(sub.Pattern, topic) {
+		if matchTopic(sub.Pattern, ev.Topic) {
 			select {
-			case sub.Ch <- *ev:
+			case sub.Ch <- ev:
 			default:
 				// Drop if subscriber is slow.
 			}
 		}
 	}
-
-	return ev, nil
 }
 
 // History returns the last N events, optionally filtered by topic pattern.
@@ -149,12 +288,12 @@ func (b *Bus) History(ctx context.Context, last int, topicPattern string) ([]Eve
 	var err error
 	if topicPattern == "" || topicPattern == "*" {
 		rows, err = b.db.QueryContext(ctx,
-			`SELECT id, topic, data, source, created_at FROM events ORDER BY id DESC LIMIT ?`, last)
+			`SELECT id, topic, data, source, signer, signature, created_at FROM events ORDER BY id DESC LIMIT ?`, last)
 	} else {
 		// For simple prefix patterns like "api.*", use SQL LIKE.
 		// For full glob, fetch all and filter in Go.
 		rows, err = b.db.QueryContext(ctx,
-			`SELECT id, topic, data, source, created_at FROM events ORDER BY id DESC LIMIT ?`, last*5)
+			`SELECT id, topic, data, source, signer, signature, created_at FROM events ORDER BY id DESC LIMIT ?`, last*5)
 	}
 	if err != nil {
 		return nil, fmt.Errorf("query events: %w", err)
@@ -164,11 +303,9 @@ func (b *Bus) History(ctx context.Context, last int, topicPattern string) ([]Eve
 	var events []Event
 	for rows.Next() {
 		var ev Event
-		var createdAt string
-		if err := rows.Scan(&ev.ID, &ev.Topic, &ev.Data, &ev.Source, &createdAt); err != nil {
+		if err := rows.Scan(&ev.ID, &ev.Topic, &ev.Data, &ev.Source, &ev.Signer, &ev.Signature, &ev.CreatedAt); err != nil {
 			return nil, fmt.Errorf("scan event: %w", err)
 		}
-		ev.CreatedAt, _ = time.Parse("2006-01-02 15:04:05", createdAt)
 
 		if topicPattern != "" && topicPattern != "*" {
 			if !matchTopic(topicPattern, ev.Topic) {
@@ -190,7 +327,7 @@ func (b *Bus) HistoryByTimeRange(ctx context.Context, from, to time.Time, source
 		limit = 50
 	}
 
-	query := `SELECT id, topic, data, source, created_at FROM events WHERE 1=1`
+	query := `SELECT id, topic, data, source, signer, signature, created_at FROM events WHERE 1=1`
 	args := []any{}
 
 	if !from.IsZero() {
@@ -218,11 +355,9 @@ func (b *Bus) HistoryByTimeRange(ctx context.Context, from, to time.Time, source
 	var result []Event
 	for rows.Next() {
 		var ev Event
-		var createdAt string
-		if err := rows.Scan(&ev.ID, &ev.Topic, &ev.Data, &ev.Source, &createdAt); err != nil {
+		if err := rows.Scan(&ev.ID, &ev.Topic, &ev.Data, &ev.Source, &ev.Signer, &ev.Signature, &ev.CreatedAt); err != nil {
 			return nil, fmt.Errorf("scan event: %w", err)
 		}
-		ev.CreatedAt, _ = time.Parse("2006-01-02 15:04:05", createdAt)
 
 		if topicPattern != "" && topicPattern != "*" {
 			if !matchTopic(topicPattern, ev.Topic) {
@@ -234,16 +369,159 @@ func (b *Bus) HistoryByTimeRange(ctx context.Context, from, to time.Time, source
 	return result, rows.Err()
 }
 
+// PageQuery selects a page of history between two event IDs (exclusive).
+// With only BeforeID set the page walks backwards, newest first; otherwise
+// it walks forwards, oldest first.
+type PageQuery struct {
+	AfterID  int64
+	BeforeID int64
+	Topic    string // glob pattern; empty or "*" matches all
+	Source   string
+	Limit    int
+}
+
+// Page returns up to q.Limit events matching q and whether more remain in
+// the same direction. Events are ordered by ID, so following the last
+// returned ID never skips or repeats an event.
+func (b *Bus) Page(ctx context.Context, q PageQuery) ([]Event, bool, error) {
+	if q.Limit <= 0 {
+		q.Limit = 50
+	}
+	backward := q.BeforeID > 0 && q.AfterID == 0
+	after, before := q.AfterID, q.BeforeID
+	batch := max(q.Limit*2, 100)
+
+	var page []Event
+	for {
+		query := `SELECT id, topic, data, source, signer, signature, created_at FROM events WHERE id > ?`
+		args := []any{after}
+		if before > 0 {
+			query += ` AND id < ?`
+			args = append(args, before)
+		}
+		if q.Source != "" {
+			query += ` AND source = ?`
+			args = append(args, q.Source)
+		}
+		if backward {
+			query += ` ORDER BY id DESC LIMIT ?`
+		} else {
+			query += ` ORDER BY id ASC LIMIT ?`
+		}
+		args = append(args, batch)
+
+		rows, err := b.db.QueryContext(ctx, query, args...)
+		if err != nil {
+			return nil, false, fmt.Errorf("query events page: %w", err)
+		}
+		n := 0
+		for rows.Next() {
+			var ev Event
+			if err := rows.Scan(&ev.ID, &ev.Topic, &ev.Data, &ev.Source, &ev.Signer, &ev.Signature, &ev.CreatedAt); err != nil {
+				rows.Close()
+				return nil, false, fmt.Errorf("scan event: %w", err)
+			}
+			n++
+			if backward {
+				before = ev.ID
+			} else {
+				after = ev.ID
+			}
+			if q.Topic != "" && q.Topic != "*" && !matchTopic(q.Topic, ev.Topic) {
+				continue
+			}
+			if len(page) == q.Limit {
+				rows.Close()
+				return page, true, nil
+			}
+			page = append(page, ev)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, false, err
+		}
+		if n < batch {
+			return page, false, nil
+		}
+	}
+}
+
+// Range returns up to limit events with IDs from fromID to toID inclusive,
+// oldest first. A toID of 0 means no upper bound.
+func (b *Bus) Range(ctx context.Context, fromID, toID int64, limit int) ([]Event, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	query := `SELECT id, topic, data, source, signer, signature, created_at FROM events WHERE id >= ?`
+	args := []any{fromID}
+	if toID > 0 {
+		query += ` AND id <= ?`
+		args = append(args, toID)
+	}
+	query += ` ORDER BY id ASC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := b.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query events by id range: %w", err)
+	}
+	defer rows.Close()
+
+	var result []Event
+	for rows.Next() {
+		var ev Event
+		if err := rows.Scan(&ev.ID, &ev.Topic, &ev.Data, &ev.Source, &ev.Signer, &ev.Signature, &ev.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan event: %w", err)
+		}
+		result = append(result, ev)
+	}
+	return result, rows.Err()
+}
+
+// Latest returns the newest event of each topic matching topicPattern,
+// newest first. It reads a table kept current on every publish, so it
+// costs one row per topic however long the history is, and a topic's
+// latest event is kept after pruning removes it from the history.
+func (b *Bus) Latest(ctx context.Context, topicPattern string) ([]Event, error) {
+	query := `SELECT event_id, topic, data, source, signer, signature, created_at FROM events_latest`
+	var args []any
+	if !strings.ContainsAny(topicPattern, "*?[") && topicPattern != "" {
+		query += ` WHERE topic = ?`
+		args = append(args, topicPattern)
+	}
+	rows, err := b.db.QueryContext(ctx, query+` ORDER BY event_id DESC`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query latest events: %w", err)
+	}
+	defer rows.Close()
+
+	var result []Event
+	for rows.Next() {
+		var ev Event
+		if err := rows.Scan(&ev.ID, &ev.Topic, &ev.Data, &ev.Source, &ev.Signer, &ev.Signature, &ev.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan latest event: %w", err)
+		}
+		if matchTopic(topicPattern, ev.Topic) {
+			result = append(result, ev)
+		}
+	}
+	return result, rows.Err()
+}
+
+// Get returns a single event by ID. Returns sql.ErrNoRows if not found.
+func (b *Bus) Get(ctx context.Context, id int64) (*Event, error) {
+	return b.getByID(ctx, id)
+}
+
 func (b *Bus) getByID(ctx context.Context, id int64) (*Event, error) {
 	var ev Event
-	var createdAt string
 	err := b.db.QueryRowContext(ctx,
-		`SELECT id, topic, data, source, created_at FROM events WHERE id = ?`, id).
-		Scan(&ev.ID, &ev.Topic, &ev.Data, &ev.Source, &createdAt)
+		`SELECT id, topic, data, source, signer, signature, created_at FROM events WHERE id = ?`, id).
+		Scan(&ev.ID, &ev.Topic, &ev.Data, &ev.Source, &ev.Signer, &ev.Signature, &ev.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
-	ev.CreatedAt, _ = time.Parse("2006-01-02 15:04:05", createdAt)
 	return &ev, nil
 }
 
@@ -251,6 +529,9 @@ func (b *Bus) getByID(ctx context.Context, id int64) (*Event, error) {
 // Both pattern and topic use dot-separated segments.
 // Uses path.Match on each segment.
 func matchTopic(pattern, topic string) bool {
+	if strings.HasPrefix(topic, InternalPrefix) && !strings.HasPrefix(pattern, InternalPrefix) {
+		return false
+	}
 	if pattern == "*" || pattern == "" {
 		return true
 	}
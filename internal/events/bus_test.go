@@ -3,6 +3,7 @@ package events_test
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"testing"
 	"time"
 
@@ -128,6 +129,80 @@ func TestSubscribePatternFiltering(t *testing.T) {
 	}
 }
 
+func TestPublishBatch(t *testing.T) {
+	bus := testBus(t)
+	ctx := context.Background()
+	sub := bus.Subscribe("build.*")
+	defer bus.Unsubscribe(sub)
+
+	published, err := bus.PublishBatch(ctx, []events.Draft{
+		{Topic: "build.started", Data: json.RawMessage(`{"step":1}`)},
+		{Topic: "build.progress", Data: json.RawMessage(`{"step":2}`)},
+		{Topic: "build.done", Data: json.RawMessage(`{"step":3}`)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(published) != 3 || published[0].ID == 0 || published[2].ID <= published[0].ID {
+		t.Fatalf("unexpected batch: %+v", published)
+	}
+	for _, want := range []string{"build.started", "build.progress", "build.done"} {
+		select {
+		case ev := <-sub.Ch:
+			if ev.Topic != want {
+				t.Errorf("got %s, want %s", ev.Topic, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timeout waiting for %s", want)
+		}
+	}
+
+	// An internal topic rejects the whole batch.
+	_, err = bus.PublishBatch(ctx, []events.Draft{
+		{Topic: "build.started", Data: json.RawMessage(`{}`)},
+		{Topic: events.InternalPrefix + "x", Data: json.RawMessage(`{}`)},
+	})
+	if !errors.Is(err, events.ErrInternalTopic) {
+		t.Fatalf("expected ErrInternalTopic, got %v", err)
+	}
+	history, _ := bus.History(ctx, 10, "")
+	if len(history) != 3 {
+		t.Errorf("expected 3 stored events, got %d", len(history))
+	}
+}
+
+func TestInternalTopics(t *testing.T) {
+	bus := testBus(t)
+	ctx := context.Background()
+
+	all := bus.Subscribe("*")
+	defer bus.Unsubscribe(all)
+	internal := bus.Subscribe(events.InternalPrefix + "audit")
+	defer bus.Unsubscribe(internal)
+
+	if _, err := bus.Publish(ctx, events.InternalPrefix+"audit", json.RawMessage(`{}`), ""); !errors.Is(err, events.ErrInternalTopic) {
+		t.Errorf("expected publishing an internal topic to be refused, got %v", err)
+	}
+	bus.PublishInternal("audit", json.RawMessage(`{"id":1}`), "audit")
+
+	select {
+	case ev := <-internal.Ch:
+		if ev.Topic != events.InternalPrefix+"audit" || ev.ID != 0 {
+			t.Errorf("unexpected internal event: %+v", ev)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for internal event")
+	}
+	select {
+	case ev := <-all.Ch:
+		t.Errorf("wildcard subscriber got internal event %s", ev.Topic)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if history, _ := bus.History(ctx, 10, ""); len(history) != 0 {
+		t.Errorf("expected internal events not to be stored, got %d", len(history))
+	}
+}
+
 func TestPruning(t *testing.T) {
 	database, err := db.OpenMemory()
 	if err != nil {
@@ -152,3 +227,198 @@ func TestPruning(t *testing.T) {
 		t.Errorf("expected at most 5 events after pruning, got %d", len(history))
 	}
 }
+
+func TestPruningRetention(t *testing.T) {
+	database, err := db.OpenMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+	bus := events.New(database, 100)
+	ctx := context.Background()
+
+	bus.Publish(ctx, "tw.build.done", json.RawMessage(`1`), "")
+	bus.Publish(ctx, "other.build.done", json.RawMessage(`1`), "")
+	database.Exec(`UPDATE events SET created_at = datetime('now', '-2 hours')`)
+	bus.Publish(ctx, "tw.build.done", json.RawMessage(`2`), "")
+
+	bus.SetRetention(func(context.Context) (map[string]time.Duration, error) {
+		return map[string]time.Duration{"tw.": time.Hour}, nil
+	})
+	bus.Prune()
+
+	history, _ := bus.History(ctx, 100, "")
+	if len(history) != 2 {
+		t.Fatalf("expected the old tw event pruned and 2 left, got %d", len(history))
+	}
+	for _, ev := range history {
+		if ev.Topic == "tw.build.done" && string(ev.Data) != "2" {
+			t.Errorf("old tw event survived pruning: %+v", ev)
+		}
+	}
+}
+
+func TestPruningRetentionClasses(t *testing.T) {
+	database, err := db.OpenMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+	bus := events.New(database, 3)
+	ctx := context.Background()
+
+	// The default class keeps controller decisions beyond the global cap.
+	policies, err := bus.RetentionPolicies(ctx)
+	if err != nil || len(policies) != 1 || policies[0].Pattern != "*.controller.*" {
+		t.Fatalf("expected the default controller class, got %+v, %v", policies, err)
+	}
+	for i := 0; i < 5; i++ {
+		bus.Publish(ctx, "tw.controller.assigned", json.RawMessage(`1`), "")
+		bus.Publish(ctx, "tw.heartbeat", json.RawMessage(`1`), "")
+	}
+	bus.Prune()
+	if got, _ := bus.History(ctx, 100, "tw.controller.*"); len(got) != 5 {
+		t.Errorf("expected all 5 controller events kept, got %d", len(got))
+	}
+	if got, _ := bus.History(ctx, 100, "tw.heartbeat"); len(got) != 3 {
+		t.Errorf("expected heartbeats capped at 3, got %d", len(got))
+	}
+
+	// The most specific pattern wins; a class may cap by count or age.
+	err = bus.SetRetentionPolicies(ctx, []events.RetentionPolicy{
+		{Pattern: "*.controller.*", MaxCount: 4},
+		{Pattern: "tw.controller.assigned", MaxAge: "1h"},
+		{Pattern: "*.heartbeat", MaxCount: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bus.Publish(ctx, "tw.controller.released", json.RawMessage(`1`), "")
+	database.Exec(`UPDATE events SET created_at = datetime('now', '-2 hours') WHERE id = 1`)
+	bus.Prune()
+	if got, _ := bus.History(ctx, 100, "tw.controller.assigned"); len(got) != 4 {
+		t.Errorf("expected only the old assignment pruned, got %d", len(got))
+	}
+	if got, _ := bus.History(ctx, 100, "tw.controller.released"); len(got) != 1 {
+		t.Errorf("expected the release kept, got %d", len(got))
+	}
+	if got, _ := bus.History(ctx, 100, "tw.heartbeat"); len(got) != 1 {
+		t.Errorf("expected heartbeats capped at 1, got %d", len(got))
+	}
+
+	policies, _ = bus.RetentionPolicies(ctx)
+	if len(policies) != 3 || policies[0].Pattern != "tw.controller.assigned" {
+		t.Errorf("expected policies most specific first, got %+v", policies)
+	}
+
+	for _, bad := range [][]events.RetentionPolicy{
+		{{Pattern: "a.*"}},
+		{{Pattern: "", MaxCount: 1}},
+		{{Pattern: "a.[", MaxCount: 1}},
+		{{Pattern: "a.*", MaxAge: "soon"}},
+		{{Pattern: "a.*", MaxCount: 1}, {Pattern: "a.*", MaxCount: 2}},
+	} {
+		if err := bus.SetRetentionPolicies(ctx, bad); err == nil {
+			t.Errorf("expected %+v to be rejected", bad)
+		}
+	}
+	if err := bus.SetRetentionPolicies(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+	if policies, _ := bus.RetentionPolicies(ctx); len(policies) != 0 {
+		t.Errorf("expected all policies removed, got %+v", policies)
+	}
+}
+
+func TestLatest(t *testing.T) {
+	database, err := db.OpenMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+	bus := events.New(database, 2)
+	ctx := context.Background()
+
+	bus.Publish(ctx, "tw.controller.assigned.backend", json.RawMessage(`{"task":"a"}`), "")
+	bus.Publish(ctx, "tw.controller.assigned.frontend", json.RawMessage(`{"task":"b"}`), "")
+	last, _ := bus.Publish(ctx, "tw.controller.assigned.backend", json.RawMessage(`{"task":"c"}`), "")
+	bus.Publish(ctx, "tw.backend.done", json.RawMessage(`{}`), "")
+
+	got, err := bus.Latest(ctx, "tw.controller.assigned.backend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].ID != last.ID || string(got[0].Data) != `{"task":"c"}` {
+		t.Errorf("unexpected latest event: %+v", got)
+	}
+
+	got, _ = bus.Latest(ctx, "tw.controller.assigned.*")
+	if len(got) != 2 || got[0].Topic != "tw.controller.assigned.backend" || got[1].Topic != "tw.controller.assigned.frontend" {
+		t.Errorf("expected the latest of each assigned topic, newest first: %+v", got)
+	}
+
+	// The latest event of a topic outlives history pruning.
+	bus.Prune()
+	got, _ = bus.Latest(ctx, "tw.controller.assigned.frontend")
+	if len(got) != 1 || string(got[0].Data) != `{"task":"b"}` {
+		t.Errorf("expected the frontend assignment after pruning: %+v", got)
+	}
+
+	if got, _ := bus.Latest(ctx, "nothing.here"); len(got) != 0 {
+		t.Errorf("expected no events for an unknown topic: %+v", got)
+	}
+}
+
+func TestPage(t *testing.T) {
+	bus := testBus(t)
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		bus.Publish(ctx, "api.change", json.RawMessage(`1`), "")
+		bus.Publish(ctx, "ui.update", json.RawMessage(`2`), "")
+	}
+
+	// Walk forwards through api.* two at a time; every event appears once.
+	var seen []int64
+	var after int64
+	for {
+		page, more, err := bus.Page(ctx, events.PageQuery{AfterID: after, Topic: "api.*", Limit: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, ev := range page {
+			if ev.Topic != "api.change" {
+				t.Errorf("unexpected topic %s", ev.Topic)
+			}
+			if ev.ID <= after {
+				t.Errorf("event %d out of order after %d", ev.ID, after)
+			}
+			seen = append(seen, ev.ID)
+			after = ev.ID
+		}
+		if !more {
+			break
+		}
+	}
+	if len(seen) != 5 {
+		t.Fatalf("expected 5 api events, got %v", seen)
+	}
+
+	// Backwards from the end, newest first.
+	page, more, err := bus.Page(ctx, events.PageQuery{BeforeID: 11, Limit: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 3 || !more || page[0].ID != 10 || page[2].ID != 8 {
+		t.Errorf("unexpected backward page: more=%v %+v", more, page)
+	}
+	if page[0].CreatedAt.IsZero() {
+		t.Error("expected created_at to be set")
+	}
+
+	// Both bounds are exclusive.
+	page, more, _ = bus.Page(ctx, events.PageQuery{AfterID: 2, BeforeID: 6, Limit: 10})
+	if len(page) != 3 || more || page[0].ID != 3 {
+		t.Errorf("unexpected bounded page: more=%v %+v", more, page)
+	}
+}
@@ -0,0 +1,196 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// pruneBatch bounds how many events a single DELETE removes, so pruning a
+// large backlog does not hold the database lock for long.
+const pruneBatch = 500
+
+// RetentionPolicy is a retention class: events whose topic matches Pattern
+// keep at most MaxCount events and none older than MaxAge. Events in a
+// class are exempt from the global history cap.
+type RetentionPolicy struct {
+	Pattern   string    `json:"pattern"`
+	MaxCount  int       `json:"max_count,omitempty"` // 0 means no count limit
+	MaxAge    string    `json:"max_age,omitempty"`   // Go duration; empty means no age limit
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ValidateRetention checks a set of retention policies.
+func ValidateRetention(policies []RetentionPolicy) error {
+	seen := map[string]bool{}
+	for _, p := range policies {
+		if p.Pattern == "" {
+			return fmt.Errorf("pattern is required")
+		}
+		if _, err := path.Match(p.Pattern, ""); err != nil || strings.Contains(p.Pattern, `\`) {
+			return fmt.Errorf("invalid pattern %q", p.Pattern)
+		}
+		if seen[p.Pattern] {
+			return fmt.Errorf("duplicate pattern %q", p.Pattern)
+		}
+		seen[p.Pattern] = true
+		if p.MaxCount < 0 {
+			return fmt.Errorf("%s: max_count must not be negative", p.Pattern)
+		}
+		if p.MaxAge != "" {
+			d, err := time.ParseDuration(p.MaxAge)
+			if err != nil || d <= 0 {
+				return fmt.Errorf("%s: max_age must be a positive duration", p.Pattern)
+			}
+		}
+		if p.MaxCount == 0 && p.MaxAge == "" {
+			return fmt.Errorf("%s: max_count or max_age is required", p.Pattern)
+		}
+	}
+	return nil
+}
+
+// RetentionPolicies returns the retention classes, most specific first:
+// that is the order in which an event's topic is matched against them.
+func (b *Bus) RetentionPolicies(ctx context.Context) ([]RetentionPolicy, error) {
+	rows, err := b.db.QueryContext(ctx,
+		`SELECT pattern, max_count, max_age, created_at, updated_at FROM event_retention`)
+	if err != nil {
+		return nil, fmt.Errorf("query event retention: %w", err)
+	}
+	defer rows.Close()
+
+	var out []RetentionPolicy
+	for rows.Next() {
+		var p RetentionPolicy
+		if err := rows.Scan(&p.Pattern, &p.MaxCount, &p.MaxAge, &p.CreatedAt, &p.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("scan event retention: %w", err)
+		}
+		out = append(out, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	sortRetention(out)
+	return out, nil
+}
+
+// SetRetentionPolicies replaces the retention classes. Policies whose
+// pattern already existed keep their creation time.
+func (b *Bus) SetRetentionPolicies(ctx context.Context, policies []RetentionPolicy) error {
+	if err := ValidateRetention(policies); err != nil {
+		return err
+	}
+	tx, err := b.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	keep := make([]any, 0, len(policies))
+	for _, p := range policies {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO event_retention (pattern, max_count, max_age, created_at, updated_at)
+			 VALUES (?, ?, ?, datetime('now'), datetime('now'))
+			 ON CONFLICT(pattern) DO UPDATE SET max_count = excluded.max_count,
+			   max_age = excluded.max_age, updated_at = excluded.updated_at`,
+			p.Pattern, p.MaxCount, p.MaxAge); err != nil {
+			return fmt.Errorf("upsert event retention: %w", err)
+		}
+		keep = append(keep, p.Pattern)
+	}
+	query := `DELETE FROM event_retention`
+	if len(keep) > 0 {
+		query += ` WHERE pattern NOT IN (?` + strings.Repeat(", ?", len(keep)-1) + `)`
+	}
+	if _, err := tx.ExecContext(ctx, query, keep...); err != nil {
+		return fmt.Errorf("delete event retention: %w", err)
+	}
+	return tx.Commit()
+}
+
+// sortRetention orders policies by precedence: longer (more specific)
+// patterns first, ties broken alphabetically.
+func sortRetention(policies []RetentionPolicy) {
+	sort.Slice(policies, func(i, j int) bool {
+		a, b := policies[i].Pattern, policies[j].Pattern
+		if len(a) != len(b) {
+			return len(a) > len(b)
+		}
+		return a < b
+	})
+}
+
+// classFilter returns a WHERE fragment selecting the events that belong to
+// policies[i]: their topic matches its pattern and none of the more
+// specific ones before it. SQLite's GLOB lets "*" span dots, like
+// path.Match on topics.
+func classFilter(policies []RetentionPolicy, i int) (string, []any) {
+	where := `topic GLOB ?`
+	args := []any{policies[i].Pattern}
+	for _, p := range policies[:i] {
+		where += ` AND NOT topic GLOB ?`
+		args = append(args, p.Pattern)
+	}
+	return where, args
+}
+
+// deleteBatched runs DELETE FROM events for the selected IDs in batches
+// of pruneBatch until none are left.
+func (b *Bus) deleteBatched(ctx context.Context, selectIDs string, args ...any) {
+	for {
+		res, err := b.db.ExecContext(ctx,
+			`DELETE FROM events WHERE id IN (`+selectIDs+` LIMIT ?)`, append(args, pruneBatch)...)
+		if err != nil {
+			return
+		}
+		if n, _ := res.RowsAffected(); n < pruneBatch {
+			return
+		}
+	}
+}
+
+// pruneClasses applies the retention classes, then caps the events that
+// belong to none of them at maxHistory.
+func (b *Bus) pruneClasses(ctx context.Context) {
+	policies, err := b.RetentionPolicies(ctx)
+	if err != nil {
+		return
+	}
+	now := time.Now().UTC()
+	for i, p := range policies {
+		where, args := classFilter(policies, i)
+		if p.MaxAge != "" {
+			d, _ := time.ParseDuration(p.MaxAge)
+			b.deleteBatched(ctx, `SELECT id FROM events WHERE `+where+` AND created_at < ?`,
+				append(args, now.Add(-d).Format("2006-01-02 15:04:05"))...)
+		}
+		if p.MaxCount > 0 {
+			b.pruneCount(ctx, where, args, p.MaxCount)
+		}
+	}
+
+	where := `1=1`
+	var args []any
+	for _, p := range policies {
+		where += ` AND NOT topic GLOB ?`
+		args = append(args, p.Pattern)
+	}
+	b.pruneCount(ctx, where, args, b.maxHistory)
+}
+
+// pruneCount deletes the events selected by where beyond the newest keep.
+func (b *Bus) pruneCount(ctx context.Context, where string, args []any, keep int) {
+	var cutoff int64
+	err := b.db.QueryRowContext(ctx,
+		`SELECT id FROM events WHERE `+where+` ORDER BY id DESC LIMIT 1 OFFSET ?`,
+		append(args, keep-1)...).Scan(&cutoff)
+	if err != nil {
+		return // fewer than keep events
+	}
+	b.deleteBatched(ctx, `SELECT id FROM events WHERE `+where+` AND id < ?`, append(args, cutoff)...)
+}
@@ -1,22 +1,79 @@
 package events
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"log/slog"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 
 	"nhooyr.io/websocket"
 )
 
+type accessKey struct{}
+
+// Access limits what one subscriber connection sees. The server attaches
+// it to the request context with WithAccess.
+type Access struct {
+	// Allow reports whether an event on topic may be delivered; nil
+	// allows every topic.
+	Allow func(topic string) bool
+	// OnSubscribe, if set, is called with each pattern the connection
+	// subscribes to, e.g. to audit wildcard subscriptions.
+	OnSubscribe func(pattern string, multiplex bool)
+}
+
+// WithAccess returns a context carrying the subscriber's Access.
+func WithAccess(ctx context.Context, a Access) context.Context {
+	return context.WithValue(ctx, accessKey{}, a)
+}
+
+func accessFrom(ctx context.Context) Access {
+	a, _ := ctx.Value(accessKey{}).(Access)
+	if a.Allow == nil {
+		a.Allow = func(string) bool { return true }
+	}
+	if a.OnSubscribe == nil {
+		a.OnSubscribe = func(string, bool) {}
+	}
+	return a
+}
+
 // ServeSubscribe handles WebSocket subscription connections.
 // Query params:
 //   - pattern: glob pattern for topic filtering (default: "*")
+//   - after_id: first replay persisted events with a greater ID, so a
+//     reconnecting client misses nothing, then switch to live delivery
+//   - multiplex: if "1", manage named subscriptions with control frames
+//     instead (see serveMultiplex)
 func ServeSubscribe(bus *Bus, logger *slog.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		if mux := r.URL.Query().Get("multiplex"); mux == "1" || mux == "true" {
+			serveMultiplex(bus, logger, w, r)
+			return
+		}
 		pattern := r.URL.Query().Get("pattern")
 		if pattern == "" {
 			pattern = "*"
 		}
+		if strings.HasPrefix(pattern, InternalPrefix) {
+			http.Error(w, "internal topics have their own streams", http.StatusBadRequest)
+			return
+		}
+		var afterID int64
+		if v := r.URL.Query().Get("after_id"); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || n < 0 {
+				http.Error(w, "after_id must be a non-negative integer", http.StatusBadRequest)
+				return
+			}
+			afterID = n
+		}
 
 		conn, err := websocket.Accept(w, r, &websocket.AcceptOptions{
 			InsecureSkipVerify: true, // Allow any origin for local dev.
@@ -27,12 +84,41 @@ func ServeSubscribe(bus *Bus, logger *slog.Logger) http.HandlerFunc {
 		}
 		defer conn.Close(websocket.StatusNormalClosure, "closing")
 
-		logger.Info("websocket subscriber connected", "pattern", pattern, "remote", r.RemoteAddr)
+		logger.Info("websocket subscriber connected", "pattern", pattern, "after_id", afterID, "remote", r.RemoteAddr)
+		access := accessFrom(r.Context())
+		access.OnSubscribe(pattern, false)
 
 		sub := bus.Subscribe(pattern)
 		defer bus.Unsubscribe(sub)
 
 		ctx := r.Context()
+		write := func(ev Event) bool {
+			if !access.Allow(ev.Topic) {
+				return true
+			}
+			data, err := json.Marshal(ev)
+			if err != nil {
+				logger.Error("marshal event failed", "error", err)
+				return true
+			}
+			if err := conn.Write(ctx, websocket.MessageText, data); err != nil {
+				logger.Debug("websocket write failed", "error", err)
+				return false
+			}
+			return true
+		}
+
+		// Live events are already buffering, so nothing published during
+		// the replay is lost; those it covers are skipped below by ID.
+		cursor := int64(-1)
+		if r.URL.Query().Has("after_id") {
+			var err error
+			if cursor, err = replay(ctx, bus, sub, pattern, afterID, write); err != nil {
+				logger.Debug("event replay stopped", "error", err)
+				return
+			}
+		}
+
 		for {
 			select {
 			case <-ctx.Done():
@@ -41,12 +127,180 @@ func ServeSubscribe(bus *Bus, logger *slog.Logger) http.HandlerFunc {
 				if !ok {
 					return
 				}
-				data, err := json.Marshal(ev)
-				if err != nil {
-					logger.Error("marshal event failed", "error", err)
+				if ev.ID <= cursor {
 					continue
 				}
-				if err := conn.Write(ctx, websocket.MessageText, data); err != nil {
+				if !write(ev) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// replay sends the persisted events matching pattern with IDs above
+// afterID, oldest first, and returns the ID the live stream continues
+// from. The subscriber's buffer is emptied before each page is read: what
+// it held is in that page or an earlier one, and the last page then leaves
+// room for everything published after it.
+func replay(ctx context.Context, bus *Bus, sub *Subscriber, pattern string, afterID int64, write func(Event) bool) (int64, error) {
+	cursor := afterID
+	for {
+	drain:
+		for {
+			select {
+			case <-sub.Ch:
+			default:
+				break drain
+			}
+		}
+		page, more, err := bus.Page(ctx, PageQuery{AfterID: cursor, Topic: pattern, Limit: 100})
+		if err != nil {
+			return 0, err
+		}
+		for _, ev := range page {
+			if !write(ev) {
+				return 0, errors.New("write failed")
+			}
+			cursor = ev.ID
+		}
+		if !more {
+			return cursor, nil
+		}
+	}
+}
+
+// controlFrame is a message from a multiplexed client.
+type controlFrame struct {
+	Op      string         `json:"op"` // "subscribe" or "unsubscribe"
+	ID      string         `json:"id"`
+	Pattern string         `json:"pattern"`
+	Filter  map[string]any `json:"filter,omitempty"`
+}
+
+// muxSub is one named subscription on a multiplexed connection.
+type muxSub struct {
+	pattern string
+	filter  map[string]any
+}
+
+// serveMultiplex runs a connection carrying any number of named
+// subscriptions. The client sends control frames:
+//
+//	{"op":"subscribe","id":"fails","pattern":"build.*","filter":{"status":"failed"}}
+//	{"op":"unsubscribe","id":"fails"}
+//
+// and the server answers each with {"type":"ack",...} or {"type":"error",...}.
+// Subscribing with an existing ID replaces it. A filter maps dotted paths
+// into the event data to the values they must equal. Each matching event is
+// sent once per subscription as {"type":"event","subscription":id,"event":{...}}.
+func serveMultiplex(bus *Bus, logger *slog.Logger, w http.ResponseWriter, r *http.Request) {
+	conn, err := websocket.Accept(w, r, &websocket.AcceptOptions{
+		InsecureSkipVerify: true, // Allow any origin for local dev.
+	})
+	if err != nil {
+		logger.Error("websocket accept failed", "error", err)
+		return
+	}
+	defer conn.Close(websocket.StatusNormalClosure, "closing")
+
+	logger.Info("websocket multiplex subscriber connected", "remote", r.RemoteAddr)
+	access := accessFrom(r.Context())
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	var mu sync.Mutex
+	subs := map[string]muxSub{}
+	send := func(v any) error {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		return conn.Write(ctx, websocket.MessageText, data)
+	}
+
+	// Subscribe before reading control frames, so no event published after
+	// an ack can be missed.
+	sub := bus.Subscribe("*")
+	defer bus.Unsubscribe(sub)
+
+	go func() {
+		defer cancel()
+		for {
+			_, data, err := conn.Read(ctx)
+			if err != nil {
+				return
+			}
+			var f controlFrame
+			if err := json.Unmarshal(data, &f); err != nil {
+				send(map[string]any{"type": "error", "error": "invalid control frame"})
+				continue
+			}
+			if f.ID == "" {
+				send(map[string]any{"type": "error", "op": f.Op, "error": "id is required"})
+				continue
+			}
+			switch f.Op {
+			case "subscribe":
+				if f.Pattern == "" {
+					f.Pattern = "*"
+				}
+				access.OnSubscribe(f.Pattern, true)
+				mu.Lock()
+				subs[f.ID] = muxSub{pattern: f.Pattern, filter: f.Filter}
+				mu.Unlock()
+			case "unsubscribe":
+				mu.Lock()
+				_, ok := subs[f.ID]
+				delete(subs, f.ID)
+				mu.Unlock()
+				if !ok {
+					send(map[string]any{"type": "error", "op": f.Op, "id": f.ID, "error": "no such subscription"})
+					continue
+				}
+			default:
+				send(map[string]any{"type": "error", "op": f.Op, "id": f.ID, "error": "unknown op"})
+				continue
+			}
+			send(map[string]any{"type": "ack", "op": f.Op, "id": f.ID})
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev, ok := <-sub.Ch:
+			if !ok {
+				return
+			}
+			if !access.Allow(ev.Topic) {
+				continue
+			}
+			mu.Lock()
+			var ids []string
+			var data any
+			decoded := false
+			for id, s := range subs {
+				if !matchTopic(s.pattern, ev.Topic) {
+					continue
+				}
+				if len(s.filter) > 0 {
+					if !decoded {
+						json.Unmarshal(ev.Data, &data)
+						decoded = true
+					}
+					if !matchFilter(data, s.filter) {
+						continue
+					}
+				}
+				ids = append(ids, id)
+			}
+			mu.Unlock()
+			slices.Sort(ids)
+			for _, id := range ids {
+				if err := send(map[string]any{"type": "event", "subscription": id, "event": ev}); err != nil {
 					logger.Debug("websocket write failed", "error", err)
 					return
 				}
@@ -54,3 +308,33 @@ func ServeSubscribe(bus *Bus, logger *slog.Logger) http.HandlerFunc {
 		}
 	}
 }
+
+// matchFilter reports whether every dotted path in filter resolves, within
+// data, to a value equal to the one given.
+func matchFilter(data any, filter map[string]any) bool {
+	for path, want := range filter {
+		got, ok := lookupPath(data, path)
+		if !ok {
+			return false
+		}
+		a, _ := json.Marshal(got)
+		b, _ := json.Marshal(want)
+		if !bytes.Equal(a, b) {
+			return false
+		}
+	}
+	return true
+}
+
+func lookupPath(v any, path string) (any, bool) {
+	for _, part := range strings.Split(path, ".") {
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if v, ok = obj[part]; !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
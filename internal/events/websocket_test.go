@@ -0,0 +1,135 @@
+package events_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DavidRHerbert/koor/internal/events"
+	"nhooyr.io/websocket"
+)
+
+func TestServeSubscribeMultiplex(t *testing.T) {
+	bus := testBus(t)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	ts := httptest.NewServer(events.ServeSubscribe(bus, logger))
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, _, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(ts.URL, "http")+"?multiplex=1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(websocket.StatusNormalClosure, "")
+
+	type frame struct {
+		Type         string       `json:"type"`
+		Op           string       `json:"op"`
+		ID           string       `json:"id"`
+		Subscription string       `json:"subscription"`
+		Event        events.Event `json:"event"`
+		Error        string       `json:"error"`
+	}
+	send := func(msg string) {
+		t.Helper()
+		if err := conn.Write(ctx, websocket.MessageText, []byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	recv := func() frame {
+		t.Helper()
+		_, data, err := conn.Read(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var f frame
+		json.Unmarshal(data, &f)
+		return f
+	}
+
+	send(`{"op":"subscribe","id":"all-builds","pattern":"build.*"}`)
+	send(`{"op":"subscribe","id":"failures","pattern":"build.*","filter":{"result.status":"failed"}}`)
+	send(`{"op":"unsubscribe","id":"missing"}`)
+	for _, want := range []string{"ack", "ack", "error"} {
+		if f := recv(); f.Type != want {
+			t.Fatalf("expected %s frame, got %+v", want, f)
+		}
+	}
+
+	bus.Publish(ctx, "build.done", json.RawMessage(`{"result":{"status":"ok"}}`), "")
+	bus.Publish(ctx, "deploy.done", json.RawMessage(`{}`), "")
+	bus.Publish(ctx, "build.done", json.RawMessage(`{"result":{"status":"failed"}}`), "")
+
+	var got []string
+	for range 3 {
+		f := recv()
+		got = append(got, f.Subscription+":"+string(f.Event.Data))
+	}
+	want := []string{
+		`all-builds:{"result":{"status":"ok"}}`,
+		`all-builds:{"result":{"status":"failed"}}`,
+		`failures:{"result":{"status":"failed"}}`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("unexpected events:\n%s", strings.Join(got, "\n"))
+	}
+
+	send(`{"op":"unsubscribe","id":"all-builds"}`)
+	if f := recv(); f.Type != "ack" || f.ID != "all-builds" {
+		t.Fatalf("expected unsubscribe ack, got %+v", f)
+	}
+	bus.Publish(ctx, "build.done", json.RawMessage(`{"result":{"status":"failed"}}`), "")
+	if f := recv(); f.Subscription != "failures" {
+		t.Errorf("expected only the failures subscription, got %+v", f)
+	}
+}
+
+func TestServeSubscribeAfterID(t *testing.T) {
+	bus := testBus(t)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	ts := httptest.NewServer(events.ServeSubscribe(bus, logger))
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	seen, _ := bus.Publish(ctx, "api.change", json.RawMessage(`{"n":1}`), "")
+	bus.Publish(ctx, "build.done", json.RawMessage(`{"n":2}`), "")
+	bus.Publish(ctx, "api.change", json.RawMessage(`{"n":3}`), "")
+
+	base := "ws" + strings.TrimPrefix(ts.URL, "http")
+	if _, resp, err := websocket.Dial(ctx, base+"?after_id=abc", nil); err == nil || resp.StatusCode != 400 {
+		t.Fatalf("expected 400 for a bad after_id, got %v", err)
+	}
+
+	conn, _, err := websocket.Dial(ctx, fmt.Sprintf("%s?pattern=api.*&after_id=%d", base, seen.ID), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(websocket.StatusNormalClosure, "")
+	recv := func() string {
+		t.Helper()
+		_, data, err := conn.Read(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ev events.Event
+		json.Unmarshal(data, &ev)
+		return string(ev.Data)
+	}
+
+	// The missed event is replayed, then live delivery continues.
+	if got := recv(); got != `{"n":3}` {
+		t.Fatalf("expected the missed event first, got %s", got)
+	}
+	bus.Publish(ctx, "api.change", json.RawMessage(`{"n":4}`), "")
+	if got := recv(); got != `{"n":4}` {
+		t.Errorf("expected the live event, got %s", got)
+	}
+}
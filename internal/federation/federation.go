@@ -0,0 +1,231 @@
+// Package federation lets a koor server share its standards with other
+// servers. An upstream server publishes a pack of its accepted local and
+// learned rules and its local templates; a downstream Subscriber pulls the
+// pack on an interval, using the pack's ETag to skip unchanged ones, and
+// keeps the items with source "federated", apart from local proposals.
+package federation
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DavidRHerbert/koor/internal/specs"
+	"github.com/DavidRHerbert/koor/internal/templates"
+)
+
+// Pack is the set of rules and templates a server shares downstream.
+type Pack struct {
+	Rules     []specs.Rule         `json:"rules"`
+	Templates []templates.Template `json:"templates"`
+}
+
+// BuildPack collects a server's shareable rules and templates and returns
+// the pack's JSON encoding with its ETag. Federated items are not shared
+// again, so a chain of servers does not echo packs back upstream.
+func BuildPack(ctx context.Context, reg *specs.Registry, tmpl *templates.Store) ([]byte, string, error) {
+	pack := Pack{Rules: []specs.Rule{}, Templates: []templates.Template{}}
+	rules, err := reg.ExportRules(ctx, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	if rules != nil {
+		pack.Rules = rules
+	}
+	if tmpl != nil {
+		if pack.Templates, err = tmpl.Local(ctx); err != nil {
+			return nil, "", err
+		}
+	}
+	// Timestamps differ between servers and are not part of the pack's content.
+	for i := range pack.Rules {
+		pack.Rules[i].CreatedAt = ""
+	}
+	for i := range pack.Templates {
+		pack.Templates[i].CreatedAt = time.Time{}
+		pack.Templates[i].UpdatedAt = time.Time{}
+	}
+	data, err := json.Marshal(pack)
+	if err != nil {
+		return nil, "", err
+	}
+	sum := sha256.Sum256(data)
+	return data, `"` + hex.EncodeToString(sum[:16]) + `"`, nil
+}
+
+// Status describes a subscriber's federation progress.
+type Status struct {
+	Upstream  string     `json:"upstream"`
+	Interval  string     `json:"interval"`
+	ETag      string     `json:"etag,omitempty"`
+	LastSync  *time.Time `json:"last_sync,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+	Syncs     int64      `json:"syncs"`
+	Rules     int        `json:"rules"`
+	Templates int        `json:"templates"`
+}
+
+// SyncResult describes one pull of the upstream pack.
+type SyncResult struct {
+	Changed          bool `json:"changed"`
+	RulesApplied     int  `json:"rules_applied"`
+	RulesRemoved     int  `json:"rules_removed"`
+	TemplatesApplied int  `json:"templates_applied"`
+	TemplatesRemoved int  `json:"templates_removed"`
+}
+
+// Subscriber periodically pulls the pack of an upstream koor-server and
+// applies it to the local rules and templates.
+type Subscriber struct {
+	upstream string
+	token    string
+	interval time.Duration
+	specReg  *specs.Registry
+	tmpl     *templates.Store
+	client   *http.Client
+	logger   *slog.Logger
+	stop     chan struct{}
+
+	mu     sync.Mutex
+	status Status
+}
+
+// NewSubscriber creates a Subscriber for the upstream server at the given
+// base URL.
+func NewSubscriber(upstream, token string, interval time.Duration, reg *specs.Registry, tmpl *templates.Store, logger *slog.Logger) *Subscriber {
+	if interval <= 0 {
+		interval = 5 * time.Minute
+	}
+	upstream = strings.TrimRight(upstream, "/")
+	return &Subscriber{
+		upstream: upstream,
+		token:    token,
+		interval: interval,
+		specReg:  reg,
+		tmpl:     tmpl,
+		client:   &http.Client{Timeout: time.Minute},
+		logger:   logger,
+		stop:     make(chan struct{}),
+		status:   Status{Upstream: upstream, Interval: interval.String()},
+	}
+}
+
+// Start syncs once, then keeps syncing on the interval in a background goroutine.
+func (s *Subscriber) Start() {
+	go func() {
+		s.syncAndLog()
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.syncAndLog()
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop shuts down the background sync goroutine.
+func (s *Subscriber) Stop() {
+	select {
+	case s.stop <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Subscriber) syncAndLog() {
+	res, err := s.Sync(context.Background())
+	if err != nil {
+		s.logger.Error("federation sync failed", "upstream", s.upstream, "error", err)
+		return
+	}
+	if res.Changed {
+		s.logger.Info("federation pack applied", "upstream", s.upstream,
+			"rules_applied", res.RulesApplied, "rules_removed", res.RulesRemoved,
+			"templates_applied", res.TemplatesApplied, "templates_removed", res.TemplatesRemoved)
+	}
+}
+
+// Sync pulls the upstream pack and applies it if it changed since the
+// last sync.
+func (s *Subscriber) Sync(ctx context.Context) (*SyncResult, error) {
+	s.mu.Lock()
+	etag := s.status.ETag
+	s.mu.Unlock()
+
+	res, newTag, err := s.sync(ctx, etag)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.status.LastError = err.Error()
+		return nil, err
+	}
+	now := time.Now().UTC()
+	s.status.LastSync = &now
+	s.status.LastError = ""
+	s.status.Syncs++
+	if res.Changed {
+		s.status.ETag = newTag
+		s.status.Rules = res.RulesApplied
+		s.status.Templates = res.TemplatesApplied
+	}
+	return res, nil
+}
+
+func (s *Subscriber) sync(ctx context.Context, etag string) (*SyncResult, string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", s.upstream+"/api/federation/pack", nil)
+	if err != nil {
+		return nil, "", err
+	}
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("fetch pack: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		return &SyncResult{}, etag, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, "", fmt.Errorf("fetch pack: status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var pack Pack
+	if err := json.NewDecoder(resp.Body).Decode(&pack); err != nil {
+		return nil, "", fmt.Errorf("decode pack: %w", err)
+	}
+	res := &SyncResult{Changed: true}
+	if res.RulesApplied, res.RulesRemoved, err = s.specReg.SyncFederatedRules(ctx, pack.Rules); err != nil {
+		return nil, "", err
+	}
+	if s.tmpl != nil {
+		if res.TemplatesApplied, res.TemplatesRemoved, err = s.tmpl.SyncFederated(ctx, pack.Templates); err != nil {
+			return nil, "", err
+		}
+	}
+	return res, resp.Header.Get("ETag"), nil
+}
+
+// Status returns the subscriber's current federation status.
+func (s *Subscriber) Status() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
+}
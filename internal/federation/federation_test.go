@@ -0,0 +1,117 @@
+package federation_test
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DavidRHerbert/koor/internal/db"
+	"github.com/DavidRHerbert/koor/internal/federation"
+	"github.com/DavidRHerbert/koor/internal/specs"
+	"github.com/DavidRHerbert/koor/internal/templates"
+)
+
+func openDB(t *testing.T) *sql.DB {
+	t.Helper()
+	database, err := db.OpenMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	return database
+}
+
+func upstreamServer(t *testing.T, reg *specs.Registry, tmpl *templates.Store, requests *int) *httptest.Server {
+	t.Helper()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests++
+		data, etag, err := federation.BuildPack(r.Context(), reg, tmpl)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write(data)
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestSubscriberSync(t *testing.T) {
+	ctx := context.Background()
+	upDB, downDB := openDB(t), openDB(t)
+	upReg, upTmpl := specs.New(upDB), templates.New(upDB)
+	downReg, downTmpl := specs.New(downDB), templates.New(downDB)
+
+	upReg.PutRules(ctx, "org", []specs.Rule{
+		{RuleID: "no-console", Pattern: `console\.log`},
+		{RuleID: "no-todo", Pattern: `TODO`},
+	})
+	upTmpl.Create(ctx, "go-std", "Go standards", "", "rules", []byte(`[]`), []string{"go"}, nil)
+	// The team has its own version of no-todo, and a local proposal.
+	downReg.PutRules(ctx, "org", []specs.Rule{{RuleID: "no-todo", Pattern: `FIXME`}})
+	downReg.ProposeRule(ctx, specs.Rule{Project: "org", RuleID: "team-idea", Pattern: "x"})
+
+	var requests int
+	ts := upstreamServer(t, upReg, upTmpl, &requests)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	sub := federation.NewSubscriber(ts.URL, "", time.Minute, downReg, downTmpl, logger)
+
+	res, err := sub.Sync(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Changed || res.RulesApplied != 1 || res.TemplatesApplied != 1 {
+		t.Fatalf("unexpected first sync: %+v", res)
+	}
+	rule, err := downReg.GetRule(ctx, "org", "no-console")
+	if err != nil || rule.Source != specs.SourceFederated || rule.Status != "accepted" {
+		t.Fatalf("expected accepted federated rule, got %+v, %v", rule, err)
+	}
+	if rule, _ := downReg.GetRule(ctx, "org", "no-todo"); rule.Pattern != "FIXME" || rule.Source != "local" {
+		t.Errorf("local rule was overwritten: %+v", rule)
+	}
+	if rule, _ := downReg.GetRule(ctx, "org", "team-idea"); rule.Status != "proposed" {
+		t.Errorf("local proposal changed: %+v", rule)
+	}
+	if tmpl, err := downTmpl.Get(ctx, "go-std"); err != nil || tmpl.Source != "federated" {
+		t.Fatalf("expected federated template, got %+v, %v", tmpl, err)
+	}
+
+	// Federated items are not shared again downstream.
+	data, _, _ := federation.BuildPack(ctx, downReg, downTmpl)
+	if string(data) == "" || strings.Contains(string(data), "no-console") || strings.Contains(string(data), "go-std") {
+		t.Errorf("downstream pack re-exports federated items: %s", data)
+	}
+
+	// An unchanged pack is not applied again.
+	res, err = sub.Sync(ctx)
+	if err != nil || res.Changed {
+		t.Fatalf("expected unchanged pack, got %+v, %v", res, err)
+	}
+
+	// Rules removed upstream are removed downstream.
+	upReg.DeleteRule(ctx, "org", "no-console")
+	res, err = sub.Sync(ctx)
+	if err != nil || !res.Changed || res.RulesRemoved != 1 {
+		t.Fatalf("expected removal, got %+v, %v", res, err)
+	}
+	if _, err := downReg.GetRule(ctx, "org", "no-console"); err == nil {
+		t.Error("federated rule should have been removed")
+	}
+
+	status := sub.Status()
+	if status.Syncs != 3 || status.ETag == "" || status.Templates != 1 || requests != 3 {
+		t.Errorf("unexpected status: %+v (requests %d)", status, requests)
+	}
+}
@@ -0,0 +1,528 @@
+// Package graphql executes read-only GraphQL queries against a schema of Go
+// resolvers. It implements the part of the language koor needs: queries
+// with arguments, variables, aliases, named and inline fragments, the
+// @skip and @include directives, and __typename. Mutations, subscriptions
+// and introspection queries are not supported; Schema.SDL describes the
+// schema instead.
+//
+// A field without a resolver reads the source value's struct field (or
+// map key) with the same JSON name, so resolvers can return the same
+// structs the REST API encodes.
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Schema is the root of a GraphQL schema.
+type Schema struct {
+	Query *Object
+}
+
+// Object is a GraphQL object type.
+type Object struct {
+	Name        string
+	Description string
+	Fields      []*Field
+}
+
+// Field is a field of an object type.
+type Field struct {
+	Name        string
+	Description string
+	Type        string // as written in the schema, e.g. "[Instance!]!"
+	Args        []Arg
+	Of          *Object // the object type of the value, for fields with subfields
+	Resolve     ResolveFunc
+}
+
+// Arg is an argument of a field.
+type Arg struct {
+	Name        string
+	Type        string
+	Default     string // as written in the schema, e.g. "50"
+	Description string
+}
+
+// ResolveFunc returns a field's value for the source object, which is nil
+// for fields of the query type.
+type ResolveFunc func(ctx context.Context, source any, args Args) (any, error)
+
+// Args are the argument values of a field, with variables substituted.
+// Integers are int64 and floats float64, as in the query or, for
+// variables, as JSON decodes them.
+type Args map[string]any
+
+// String returns a string argument, or "" if it is unset.
+func (a Args) String(name string) string {
+	switch v := a[name].(type) {
+	case string:
+		return v
+	case enumValue:
+		return string(v)
+	}
+	return ""
+}
+
+// Int returns an integer argument, or def if it is unset.
+func (a Args) Int(name string, def int) int {
+	switch v := a[name].(type) {
+	case int64:
+		return int(v)
+	case float64:
+		return int(v)
+	}
+	return def
+}
+
+// Bool returns a boolean argument and whether it is set.
+func (a Args) Bool(name string) (value, ok bool) {
+	value, ok = a[name].(bool)
+	return value, ok
+}
+
+// Request is a GraphQL request as sent over HTTP.
+type Request struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName,omitempty"`
+	Variables     map[string]any `json:"variables,omitempty"`
+}
+
+// Response is the result of a request. Data is nil when the request could
+// not be executed at all; otherwise Errors lists the fields that failed,
+// which are null in Data.
+type Response struct {
+	Data   *Map    `json:"data,omitempty"`
+	Errors []Error `json:"errors,omitempty"`
+}
+
+// Error is a request or field error.
+type Error struct {
+	Message string `json:"message"`
+	Path    []any  `json:"path,omitempty"`
+}
+
+// Map is a JSON object that keeps its keys in insertion order, as GraphQL
+// results follow the order of the query.
+type Map struct {
+	keys   []string
+	values map[string]any
+}
+
+func (m *Map) set(key string, v any) {
+	if m.values == nil {
+		m.values = map[string]any{}
+	}
+	if _, ok := m.values[key]; !ok {
+		m.keys = append(m.keys, key)
+	}
+	m.values[key] = v
+}
+
+// Get returns the value of key.
+func (m *Map) Get(key string) any {
+	return m.values[key]
+}
+
+// MarshalJSON encodes the map with its keys in order.
+func (m *Map) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, k := range m.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(k)
+		buf.Write(key)
+		buf.WriteByte(':')
+		v, err := json.Marshal(m.values[k])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func (o *Object) field(name string) *Field {
+	for _, f := range o.Fields {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// Execute runs a query and returns its result.
+func (s *Schema) Execute(ctx context.Context, req Request) *Response {
+	doc, err := parse(req.Query)
+	if err != nil {
+		return requestError("syntax error: " + err.Error())
+	}
+	op, msg := pickOperation(doc, req.OperationName)
+	if op == nil {
+		return requestError(msg)
+	}
+	if op.kind != "query" {
+		return requestError("only queries are supported; " + op.kind + " is not")
+	}
+
+	ex := &execution{doc: doc, vars: map[string]any{}, defined: map[string]bool{}}
+	for _, v := range op.variables {
+		ex.defined[v.name] = true
+		if val, ok := req.Variables[v.name]; ok {
+			ex.vars[v.name] = val
+		} else if v.hasDef {
+			ex.vars[v.name] = v.def
+		}
+	}
+
+	ex.validate(s.Query, op.selection, map[string]bool{})
+	if len(ex.errors) > 0 {
+		return &Response{Errors: ex.errors}
+	}
+	data := ex.selectionSet(ctx, s.Query, nil, op.selection, nil)
+	return &Response{Data: data, Errors: ex.errors}
+}
+
+func requestError(msg string) *Response {
+	return &Response{Errors: []Error{{Message: msg}}}
+}
+
+func pickOperation(doc *document, name string) (*operation, string) {
+	if name == "" {
+		if len(doc.operations) > 1 {
+			return nil, "operationName is required when the document has several operations"
+		}
+		return doc.operations[0], ""
+	}
+	for _, op := range doc.operations {
+		if op.name == name {
+			return op, ""
+		}
+	}
+	return nil, "unknown operation " + strconv.Quote(name)
+}
+
+type execution struct {
+	doc     *document
+	vars    map[string]any
+	defined map[string]bool
+	errors  []Error
+}
+
+func (ex *execution) fail(path []any, format string, args ...any) {
+	ex.errors = append(ex.errors, Error{Message: fmt.Sprintf(format, args...), Path: path})
+}
+
+// validate checks a selection set against its type before anything is
+// resolved, so a bad query fails as a whole.
+func (ex *execution) validate(obj *Object, set []selection, spreading map[string]bool) {
+	for _, sel := range set {
+		for _, d := range sel.directives {
+			if d.name != "skip" && d.name != "include" {
+				ex.fail(nil, "unknown directive @%s", d.name)
+			}
+			ex.checkValue(d.args)
+		}
+		switch {
+		case sel.spread != "":
+			frag, ok := ex.doc.fragments[sel.spread]
+			if !ok {
+				ex.fail(nil, "unknown fragment %q", sel.spread)
+				continue
+			}
+			if spreading[sel.spread] {
+				ex.fail(nil, "fragment %q spreads itself", sel.spread)
+				continue
+			}
+			if frag.on != obj.Name {
+				ex.fail(nil, "fragment %q on %s cannot be spread on %s", frag.name, frag.on, obj.Name)
+				continue
+			}
+			spreading[sel.spread] = true
+			ex.validate(obj, frag.selection, spreading)
+			delete(spreading, sel.spread)
+		case sel.inline != nil:
+			if sel.inline.on != "" && sel.inline.on != obj.Name {
+				ex.fail(nil, "fragment on %s cannot be spread on %s", sel.inline.on, obj.Name)
+				continue
+			}
+			ex.validate(obj, sel.inline.selection, spreading)
+		default:
+			f := sel.field
+			if f.name == "__typename" {
+				if len(f.selection) > 0 {
+					ex.fail(nil, "field \"__typename\" must not have a selection")
+				}
+				continue
+			}
+			def := obj.field(f.name)
+			if def == nil {
+				ex.fail(nil, "cannot query field %q on type %q", f.name, obj.Name)
+				continue
+			}
+			for name := range f.args {
+				if !hasArg(def, name) {
+					ex.fail(nil, "unknown argument %q on field \"%s.%s\"", name, obj.Name, f.name)
+				}
+			}
+			ex.checkValue(f.args)
+			switch {
+			case def.Of != nil && len(f.selection) == 0:
+				ex.fail(nil, "field %q of type %q must have a selection of subfields", f.name, def.Type)
+			case def.Of == nil && len(f.selection) > 0:
+				ex.fail(nil, "field %q of type %q must not have a selection", f.name, def.Type)
+			case def.Of != nil:
+				ex.validate(def.Of, f.selection, spreading)
+			}
+		}
+	}
+}
+
+func hasArg(f *Field, name string) bool {
+	for _, a := range f.Args {
+		if a.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// checkValue reports variables used in v that the operation does not
+// define.
+func (ex *execution) checkValue(v any) {
+	switch v := v.(type) {
+	case variable:
+		if !ex.defined[string(v)] {
+			ex.fail(nil, "variable $%s is not defined", v)
+		}
+	case []any:
+		for _, item := range v {
+			ex.checkValue(item)
+		}
+	case map[string]any:
+		for _, item := range v {
+			ex.checkValue(item)
+		}
+	}
+}
+
+// value substitutes variables in an argument value.
+func (ex *execution) value(v any) any {
+	switch v := v.(type) {
+	case variable:
+		return ex.vars[string(v)]
+	case []any:
+		out := make([]any, len(v))
+		for i, item := range v {
+			out[i] = ex.value(item)
+		}
+		return out
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, item := range v {
+			out[k] = ex.value(item)
+		}
+		return out
+	}
+	return v
+}
+
+// included applies @skip and @include.
+func (ex *execution) included(directives []directive) bool {
+	for _, d := range directives {
+		cond, _ := ex.value(d.args["if"]).(bool)
+		if d.name == "skip" && cond || d.name == "include" && !cond {
+			return false
+		}
+	}
+	return true
+}
+
+// collect flattens fragments into the fields of a selection set, keyed by
+// response name. Fields selected twice under the same name have their
+// subfields merged.
+func (ex *execution) collect(obj *Object, set []selection, keys *[]string, fields map[string]*field) {
+	for _, sel := range set {
+		if !ex.included(sel.directives) {
+			continue
+		}
+		switch {
+		case sel.spread != "":
+			ex.collect(obj, ex.doc.fragments[sel.spread].selection, keys, fields)
+		case sel.inline != nil:
+			ex.collect(obj, sel.inline.selection, keys, fields)
+		default:
+			key := sel.field.alias
+			if key == "" {
+				key = sel.field.name
+			}
+			if prev, ok := fields[key]; ok {
+				merged := *prev
+				merged.selection = append(append([]selection{}, prev.selection...), sel.field.selection...)
+				fields[key] = &merged
+				continue
+			}
+			*keys = append(*keys, key)
+			fields[key] = sel.field
+		}
+	}
+}
+
+func (ex *execution) selectionSet(ctx context.Context, obj *Object, source any, set []selection, path []any) *Map {
+	var keys []string
+	fields := map[string]*field{}
+	ex.collect(obj, set, &keys, fields)
+
+	result := &Map{}
+	for _, key := range keys {
+		f := fields[key]
+		if f.name == "__typename" {
+			result.set(key, obj.Name)
+			continue
+		}
+		def := obj.field(f.name)
+		fieldPath := append(append([]any{}, path...), key)
+
+		args := Args{}
+		for name, v := range f.args {
+			args[name] = ex.value(v)
+		}
+		var v any
+		var err error
+		if def.Resolve != nil {
+			v, err = def.Resolve(ctx, source, args)
+		} else {
+			v = jsonField(source, f.name)
+		}
+		if err != nil {
+			ex.fail(fieldPath, "%s", err.Error())
+			result.set(key, nil)
+			continue
+		}
+		result.set(key, ex.complete(ctx, def.Of, v, f.selection, fieldPath))
+	}
+	return result
+}
+
+// complete resolves the subfields of an object value, or of each element
+// of a list of objects. Leaf values are returned as they are.
+func (ex *execution) complete(ctx context.Context, obj *Object, v any, set []selection, path []any) any {
+	if obj == nil {
+		return v
+	}
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	if !rv.IsValid() {
+		return nil
+	}
+	if rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+		list := make([]any, rv.Len())
+		for i := range list {
+			list[i] = ex.complete(ctx, obj, rv.Index(i).Interface(), set, append(append([]any{}, path...), i))
+		}
+		return list
+	}
+	return ex.selectionSet(ctx, obj, v, set, path)
+}
+
+// jsonField returns the field of a struct, or the key of a map, with the
+// given JSON name.
+func jsonField(source any, name string) any {
+	rv := reflect.ValueOf(source)
+	for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	switch rv.Kind() {
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return nil
+		}
+		v := rv.MapIndex(reflect.ValueOf(name).Convert(rv.Type().Key()))
+		if !v.IsValid() {
+			return nil
+		}
+		return v.Interface()
+	case reflect.Struct:
+		t := rv.Type()
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			if !sf.IsExported() {
+				continue
+			}
+			tag, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+			if sf.Anonymous && tag == "" {
+				if v := jsonField(rv.Field(i).Interface(), name); v != nil {
+					return v
+				}
+				continue
+			}
+			if tag == name || tag == "" && sf.Name == name {
+				return rv.Field(i).Interface()
+			}
+		}
+	}
+	return nil
+}
+
+// SDL describes the schema in the GraphQL schema definition language.
+func (s *Schema) SDL() string {
+	var b strings.Builder
+	b.WriteString("scalar JSON\nscalar Time\n")
+	seen := map[string]bool{}
+	queue := []*Object{s.Query}
+	for len(queue) > 0 {
+		obj := queue[0]
+		queue = queue[1:]
+		if seen[obj.Name] {
+			continue
+		}
+		seen[obj.Name] = true
+
+		b.WriteString("\n")
+		writeDescription(&b, "", obj.Description)
+		fmt.Fprintf(&b, "type %s {\n", obj.Name)
+		for _, f := range obj.Fields {
+			writeDescription(&b, "  ", f.Description)
+			b.WriteString("  " + f.Name)
+			if len(f.Args) > 0 {
+				args := make([]string, len(f.Args))
+				for i, a := range f.Args {
+					args[i] = a.Name + ": " + a.Type
+					if a.Default != "" {
+						args[i] += " = " + a.Default
+					}
+				}
+				b.WriteString("(" + strings.Join(args, ", ") + ")")
+			}
+			b.WriteString(": " + f.Type + "\n")
+			if f.Of != nil {
+				queue = append(queue, f.Of)
+			}
+		}
+		b.WriteString("}\n")
+	}
+	return b.String()
+}
+
+func writeDescription(b *strings.Builder, indent, desc string) {
+	if desc != "" {
+		fmt.Fprintf(b, "%s%s\n", indent, strconv.Quote(desc))
+	}
+}
@@ -0,0 +1,149 @@
+package graphql_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/DavidRHerbert/koor/internal/graphql"
+)
+
+type agent struct {
+	ID     string   `json:"id"`
+	Name   string   `json:"name"`
+	Skills []string `json:"skills"`
+}
+
+func testSchema() *graphql.Schema {
+	agents := []agent{
+		{ID: "a1", Name: "backend", Skills: []string{"go"}},
+		{ID: "a2", Name: "frontend", Skills: []string{"templ", "css"}},
+	}
+	task := &graphql.Object{Name: "Task", Fields: []*graphql.Field{
+		{Name: "title", Type: "String!"},
+	}}
+	agentType := &graphql.Object{Name: "Agent", Fields: []*graphql.Field{
+		{Name: "id", Type: "String!"},
+		{Name: "name", Type: "String!"},
+		{Name: "skills", Type: "[String!]!"},
+		{Name: "tasks", Type: "[Task!]!", Of: task, Args: []graphql.Arg{{Name: "limit", Type: "Int"}},
+			Resolve: func(ctx context.Context, source any, args graphql.Args) (any, error) {
+				a := source.(agent)
+				list := []map[string]any{{"title": a.Name + " task 1"}, {"title": a.Name + " task 2"}}
+				return list[:min(args.Int("limit", len(list)), len(list))], nil
+			}},
+		{Name: "broken", Type: "String", Resolve: func(context.Context, any, graphql.Args) (any, error) {
+			return nil, errors.New("store unavailable")
+		}},
+	}}
+	query := &graphql.Object{Name: "Query", Fields: []*graphql.Field{
+		{Name: "agents", Type: "[Agent!]!", Of: agentType, Args: []graphql.Arg{{Name: "name", Type: "String"}},
+			Resolve: func(ctx context.Context, source any, args graphql.Args) (any, error) {
+				var out []agent
+				for _, a := range agents {
+					if name := args.String("name"); name == "" || a.Name == name {
+						out = append(out, a)
+					}
+				}
+				return out, nil
+			}},
+		{Name: "agent", Type: "Agent", Of: agentType, Args: []graphql.Arg{{Name: "id", Type: "String!"}},
+			Resolve: func(ctx context.Context, source any, args graphql.Args) (any, error) {
+				for _, a := range agents {
+					if a.ID == args.String("id") {
+						return a, nil
+					}
+				}
+				return nil, nil
+			}},
+	}}
+	return &graphql.Schema{Query: query}
+}
+
+func execJSON(t *testing.T, req graphql.Request) string {
+	t.Helper()
+	out, err := json.Marshal(testSchema().Execute(context.Background(), req))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+func TestExecute(t *testing.T) {
+	tests := []struct {
+		name string
+		req  graphql.Request
+		want string
+	}{
+		{"fields in query order", graphql.Request{Query: `{ agents { name id } }`},
+			`{"data":{"agents":[{"name":"backend","id":"a1"},{"name":"frontend","id":"a2"}]}}`},
+		{"arguments, aliases and nesting", graphql.Request{Query: `
+			# two agents side by side
+			{ b: agent(id: "a1") { name tasks(limit: 1) { title } } f: agent(id: "a2") { skills } }`},
+			`{"data":{"b":{"name":"backend","tasks":[{"title":"backend task 1"}]},"f":{"skills":["templ","css"]}}}`},
+		{"missing object is null", graphql.Request{Query: `{ agent(id: "nope") { name } }`},
+			`{"data":{"agent":null}}`},
+		{"variables and defaults", graphql.Request{
+			Query:     `query Find($name: String, $limit: Int = 1) { agents(name: $name) { tasks(limit: $limit) { title } } }`,
+			Variables: map[string]any{"name": "frontend"}},
+			`{"data":{"agents":[{"tasks":[{"title":"frontend task 1"}]}]}}`},
+		{"fragments and typename", graphql.Request{Query: `
+			query { agents(name: "backend") { ...Basic ... on Agent { skills } __typename } }
+			fragment Basic on Agent { id name }`},
+			`{"data":{"agents":[{"id":"a1","name":"backend","skills":["go"],"__typename":"Agent"}]}}`},
+		{"skip and include", graphql.Request{
+			Query:     `query ($full: Boolean!) { agents(name: "backend") { id name @include(if: $full) skills @skip(if: true) } }`,
+			Variables: map[string]any{"full": false}},
+			`{"data":{"agents":[{"id":"a1"}]}}`},
+		{"field error leaves the rest", graphql.Request{Query: `{ agents(name: "backend") { name broken } }`},
+			`{"data":{"agents":[{"name":"backend","broken":null}]},"errors":[{"message":"store unavailable","path":["agents",0,"broken"]}]}`},
+		{"operation by name", graphql.Request{Query: `query A { agents { id } } query B { agent(id: "a2") { id } }`, OperationName: "B"},
+			`{"data":{"agent":{"id":"a2"}}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := execJSON(t, tt.req); got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExecuteErrors(t *testing.T) {
+	tests := []struct {
+		query, want string
+	}{
+		{`{ agents { name `, "syntax error"},
+		{`{ agents { nickname } }`, `cannot query field \"nickname\" on type \"Agent\"`},
+		{`{ agents(limit: 3) { id } }`, `unknown argument \"limit\"`},
+		{`{ agents }`, "must have a selection of subfields"},
+		{`{ agents { name { x } } }`, "must not have a selection"},
+		{`{ agents(name: $who) { id } }`, "variable $who is not defined"},
+		{`{ agents { ...Missing } }`, `unknown fragment \"Missing\"`},
+		{`{ agents { ...A } } fragment A on Agent { ...A }`, "spreads itself"},
+		{`mutation { agents { id } }`, "only queries are supported"},
+		{`query A { agents { id } } query B { agents { id } }`, "operationName is required"},
+	}
+	for _, tt := range tests {
+		got := execJSON(t, graphql.Request{Query: tt.query})
+		if strings.Contains(got, `"data"`) || !strings.Contains(got, tt.want) {
+			t.Errorf("%s: got %s, want an error containing %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestSDL(t *testing.T) {
+	sdl := testSchema().SDL()
+	for _, want := range []string{
+		"type Query {\n  agents(name: String): [Agent!]!\n",
+		"type Agent {\n  id: String!\n",
+		"  tasks(limit: Int): [Task!]!\n",
+		"type Task {\n  title: String!\n}",
+	} {
+		if !strings.Contains(sdl, want) {
+			t.Errorf("SDL missing %q:\n%s", want, sdl)
+		}
+	}
+}
@@ -0,0 +1,580 @@
+package graphql
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// document is a parsed GraphQL request.
+type document struct {
+	operations []*operation
+	fragments  map[string]*fragment
+}
+
+type operation struct {
+	kind      string // query, mutation or subscription
+	name      string
+	variables []variableDef
+	selection []selection
+}
+
+type variableDef struct {
+	name   string
+	def    any
+	hasDef bool
+}
+
+type fragment struct {
+	name      string
+	on        string
+	selection []selection
+}
+
+// selection is one entry of a selection set: a field, a fragment spread
+// or an inline fragment.
+type selection struct {
+	field      *field
+	spread     string
+	inline     *fragment
+	directives []directive
+}
+
+type field struct {
+	alias     string
+	name      string
+	args      map[string]any
+	selection []selection
+}
+
+type directive struct {
+	name string
+	args map[string]any
+}
+
+// variable is a $name reference in an argument value.
+type variable string
+
+// enumValue is an unquoted name used as an argument value.
+type enumValue string
+
+type token struct {
+	kind string // name, int, float, string, punct or eof
+	text string
+	pos  int
+}
+
+// lexer splits a GraphQL document into tokens. Commas, whitespace and
+// # comments are insignificant.
+type lexer struct {
+	src string
+	pos int
+}
+
+func (l *lexer) next() (token, error) {
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		if c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',' {
+			l.pos++
+			continue
+		}
+		if c == '#' {
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.pos++
+			}
+			continue
+		}
+		break
+	}
+	start := l.pos
+	if l.pos >= len(l.src) {
+		return token{kind: "eof", pos: start}, nil
+	}
+	c := l.src[l.pos]
+	switch {
+	case strings.HasPrefix(l.src[l.pos:], "..."):
+		l.pos += 3
+		return token{kind: "punct", text: "...", pos: start}, nil
+	case strings.ContainsRune("!$():=@[]{}|", rune(c)):
+		l.pos++
+		return token{kind: "punct", text: string(c), pos: start}, nil
+	case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+		for l.pos < len(l.src) && isNameChar(l.src[l.pos]) {
+			l.pos++
+		}
+		return token{kind: "name", text: l.src[start:l.pos], pos: start}, nil
+	case c == '-' || c >= '0' && c <= '9':
+		return l.number()
+	case c == '"':
+		return l.string()
+	}
+	return token{}, fmt.Errorf("unexpected character %q at offset %d", c, start)
+}
+
+func isNameChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+func (l *lexer) number() (token, error) {
+	start := l.pos
+	kind := "int"
+	if l.src[l.pos] == '-' {
+		l.pos++
+	}
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c >= '0' && c <= '9':
+		case c == '.' || c == 'e' || c == 'E':
+			kind = "float"
+		case (c == '+' || c == '-') && kind == "float":
+		default:
+			return token{kind: kind, text: l.src[start:l.pos], pos: start}, nil
+		}
+		l.pos++
+	}
+	return token{kind: kind, text: l.src[start:l.pos], pos: start}, nil
+}
+
+func (l *lexer) string() (token, error) {
+	start := l.pos
+	if strings.HasPrefix(l.src[l.pos:], `"""`) {
+		end := strings.Index(l.src[l.pos+3:], `"""`)
+		if end < 0 {
+			return token{}, fmt.Errorf("unterminated string at offset %d", start)
+		}
+		text := l.src[l.pos+3 : l.pos+3+end]
+		l.pos += end + 6
+		return token{kind: "string", text: strings.TrimSpace(text), pos: start}, nil
+	}
+	l.pos++
+	for l.pos < len(l.src) {
+		switch l.src[l.pos] {
+		case '\\':
+			l.pos += 2
+			continue
+		case '\n':
+			return token{}, fmt.Errorf("unterminated string at offset %d", start)
+		case '"':
+			l.pos++
+			// GraphQL string escapes are JSON's.
+			var text string
+			if err := json.Unmarshal([]byte(l.src[start:l.pos]), &text); err != nil {
+				return token{}, fmt.Errorf("invalid string at offset %d", start)
+			}
+			return token{kind: "string", text: text, pos: start}, nil
+		}
+		l.pos++
+	}
+	return token{}, fmt.Errorf("unterminated string at offset %d", start)
+}
+
+// parser is a recursive descent parser over the lexer's tokens, with one
+// token of lookahead.
+type parser struct {
+	lex lexer
+	tok token
+}
+
+func parse(src string) (*document, error) {
+	p := &parser{lex: lexer{src: src}}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	doc := &document{fragments: map[string]*fragment{}}
+	for p.tok.kind != "eof" {
+		switch {
+		case p.peek("{"):
+			sel, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, &operation{kind: "query", selection: sel})
+		case p.tok.kind == "name" && p.tok.text == "fragment":
+			f, err := p.fragmentDef()
+			if err != nil {
+				return nil, err
+			}
+			if _, dup := doc.fragments[f.name]; dup {
+				return nil, fmt.Errorf("fragment %q is defined more than once", f.name)
+			}
+			doc.fragments[f.name] = f
+		case p.tok.kind == "name" && (p.tok.text == "query" || p.tok.text == "mutation" || p.tok.text == "subscription"):
+			op, err := p.operationDef()
+			if err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, op)
+		default:
+			return nil, p.unexpected()
+		}
+	}
+	if len(doc.operations) == 0 {
+		return nil, fmt.Errorf("document has no operation")
+	}
+	return doc, nil
+}
+
+func (p *parser) advance() error {
+	tok, err := p.lex.next()
+	if err != nil {
+		return err
+	}
+	p.tok = tok
+	return nil
+}
+
+func (p *parser) peek(punct string) bool {
+	return p.tok.kind == "punct" && p.tok.text == punct
+}
+
+func (p *parser) unexpected() error {
+	if p.tok.kind == "eof" {
+		return fmt.Errorf("unexpected end of document")
+	}
+	return fmt.Errorf("unexpected %q at offset %d", p.tok.text, p.tok.pos)
+}
+
+func (p *parser) expect(punct string) error {
+	if !p.peek(punct) {
+		return p.unexpected()
+	}
+	return p.advance()
+}
+
+func (p *parser) name() (string, error) {
+	if p.tok.kind != "name" {
+		return "", p.unexpected()
+	}
+	name := p.tok.text
+	return name, p.advance()
+}
+
+func (p *parser) operationDef() (*operation, error) {
+	op := &operation{kind: p.tok.text}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	if p.tok.kind == "name" {
+		op.name = p.tok.text
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+	if p.peek("(") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		for !p.peek(")") {
+			v, err := p.variableDef()
+			if err != nil {
+				return nil, err
+			}
+			op.variables = append(op.variables, v)
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := p.directives(); err != nil {
+		return nil, err
+	}
+	sel, err := p.selectionSet()
+	if err != nil {
+		return nil, err
+	}
+	op.selection = sel
+	return op, nil
+}
+
+// variableDef parses "$name: Type = default". The type is checked only
+// for syntax; values are coerced by the resolvers that read them.
+func (p *parser) variableDef() (variableDef, error) {
+	var v variableDef
+	if err := p.expect("$"); err != nil {
+		return v, err
+	}
+	name, err := p.name()
+	if err != nil {
+		return v, err
+	}
+	v.name = name
+	if err := p.expect(":"); err != nil {
+		return v, err
+	}
+	if err := p.typeRef(); err != nil {
+		return v, err
+	}
+	if p.peek("=") {
+		if err := p.advance(); err != nil {
+			return v, err
+		}
+		def, err := p.value(true)
+		if err != nil {
+			return v, err
+		}
+		v.def, v.hasDef = def, true
+	}
+	_, err = p.directives()
+	return v, err
+}
+
+func (p *parser) typeRef() error {
+	if p.peek("[") {
+		if err := p.advance(); err != nil {
+			return err
+		}
+		if err := p.typeRef(); err != nil {
+			return err
+		}
+		if err := p.expect("]"); err != nil {
+			return err
+		}
+	} else if _, err := p.name(); err != nil {
+		return err
+	}
+	if p.peek("!") {
+		return p.advance()
+	}
+	return nil
+}
+
+func (p *parser) fragmentDef() (*fragment, error) {
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	if name == "on" {
+		return nil, fmt.Errorf("fragment cannot be named \"on\"")
+	}
+	if p.tok.kind != "name" || p.tok.text != "on" {
+		return nil, p.unexpected()
+	}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	on, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.directives(); err != nil {
+		return nil, err
+	}
+	sel, err := p.selectionSet()
+	if err != nil {
+		return nil, err
+	}
+	return &fragment{name: name, on: on, selection: sel}, nil
+}
+
+func (p *parser) selectionSet() ([]selection, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	var set []selection
+	for !p.peek("}") {
+		sel, err := p.selection()
+		if err != nil {
+			return nil, err
+		}
+		set = append(set, sel)
+	}
+	if len(set) == 0 {
+		return nil, fmt.Errorf("empty selection set at offset %d", p.tok.pos)
+	}
+	return set, p.advance()
+}
+
+func (p *parser) selection() (selection, error) {
+	var sel selection
+	if p.peek("...") {
+		if err := p.advance(); err != nil {
+			return sel, err
+		}
+		if p.tok.kind == "name" && p.tok.text != "on" {
+			sel.spread = p.tok.text
+			if err := p.advance(); err != nil {
+				return sel, err
+			}
+			d, err := p.directives()
+			sel.directives = d
+			return sel, err
+		}
+		inline := &fragment{}
+		if p.tok.kind == "name" {
+			if err := p.advance(); err != nil {
+				return sel, err
+			}
+			on, err := p.name()
+			if err != nil {
+				return sel, err
+			}
+			inline.on = on
+		}
+		d, err := p.directives()
+		if err != nil {
+			return sel, err
+		}
+		sel.directives = d
+		if inline.selection, err = p.selectionSet(); err != nil {
+			return sel, err
+		}
+		sel.inline = inline
+		return sel, nil
+	}
+
+	f := &field{}
+	name, err := p.name()
+	if err != nil {
+		return sel, err
+	}
+	f.name = name
+	if p.peek(":") {
+		if err := p.advance(); err != nil {
+			return sel, err
+		}
+		f.alias = name
+		if f.name, err = p.name(); err != nil {
+			return sel, err
+		}
+	}
+	if p.peek("(") {
+		if f.args, err = p.arguments(); err != nil {
+			return sel, err
+		}
+	}
+	if sel.directives, err = p.directives(); err != nil {
+		return sel, err
+	}
+	if p.peek("{") {
+		if f.selection, err = p.selectionSet(); err != nil {
+			return sel, err
+		}
+	}
+	sel.field = f
+	return sel, nil
+}
+
+func (p *parser) arguments() (map[string]any, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	args := map[string]any{}
+	for !p.peek(")") {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		v, err := p.value(false)
+		if err != nil {
+			return nil, err
+		}
+		args[name] = v
+	}
+	return args, p.advance()
+}
+
+func (p *parser) directives() ([]directive, error) {
+	var list []directive
+	for p.peek("@") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		d := directive{name: name}
+		if p.peek("(") {
+			if d.args, err = p.arguments(); err != nil {
+				return nil, err
+			}
+		}
+		list = append(list, d)
+	}
+	return list, nil
+}
+
+// value parses an argument value. Constant values, such as variable
+// defaults, may not reference variables.
+func (p *parser) value(constant bool) (any, error) {
+	tok := p.tok
+	switch tok.kind {
+	case "int":
+		n, err := strconv.ParseInt(tok.text, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid integer %s", tok.text)
+		}
+		return n, p.advance()
+	case "float":
+		f, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %s", tok.text)
+		}
+		return f, p.advance()
+	case "string":
+		return tok.text, p.advance()
+	case "name":
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		switch tok.text {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		return enumValue(tok.text), nil
+	}
+	switch {
+	case p.peek("$") && !constant:
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		return variable(name), err
+	case p.peek("["):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		list := []any{}
+		for !p.peek("]") {
+			v, err := p.value(constant)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, p.advance()
+	case p.peek("{"):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		obj := map[string]any{}
+		for !p.peek("}") {
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(":"); err != nil {
+				return nil, err
+			}
+			v, err := p.value(constant)
+			if err != nil {
+				return nil, err
+			}
+			obj[name] = v
+		}
+		return obj, p.advance()
+	}
+	return nil, p.unexpected()
+}
@@ -0,0 +1,65 @@
+// Package identity handles Ed25519 agent keys used to sign event payloads.
+// Keys and signatures are exchanged as standard base64 strings.
+package identity
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+)
+
+// GenerateKey creates a new key pair and returns it base64-encoded.
+func GenerateKey() (publicKey, privateKey string, err error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", fmt.Errorf("generate key: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(pub), base64.StdEncoding.EncodeToString(priv), nil
+}
+
+// ParsePublicKey decodes and checks a base64 Ed25519 public key.
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("public key is not base64: %w", err)
+	}
+	if len(b) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("public key must be %d bytes, got %d", ed25519.PublicKeySize, len(b))
+	}
+	return ed25519.PublicKey(b), nil
+}
+
+// EventMessage returns the bytes signed for an event: the topic, a newline,
+// then the data exactly as sent.
+func EventMessage(topic string, data []byte) []byte {
+	msg := make([]byte, 0, len(topic)+1+len(data))
+	msg = append(msg, topic...)
+	msg = append(msg, '\n')
+	return append(msg, data...)
+}
+
+// Sign signs msg with a base64 private key and returns a base64 signature.
+func Sign(privateKey string, msg []byte) (string, error) {
+	b, err := base64.StdEncoding.DecodeString(privateKey)
+	if err != nil {
+		return "", fmt.Errorf("private key is not base64: %w", err)
+	}
+	if len(b) != ed25519.PrivateKeySize {
+		return "", fmt.Errorf("private key must be %d bytes, got %d", ed25519.PrivateKeySize, len(b))
+	}
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(ed25519.PrivateKey(b), msg)), nil
+}
+
+// Verify reports whether signature is a valid signature of msg by publicKey.
+func Verify(publicKey string, msg []byte, signature string) bool {
+	pub, err := ParsePublicKey(publicKey)
+	if err != nil {
+		return false
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	return ed25519.Verify(pub, msg, sig)
+}
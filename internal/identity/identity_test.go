@@ -0,0 +1,42 @@
+package identity_test
+
+import (
+	"testing"
+
+	"github.com/DavidRHerbert/koor/internal/identity"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	pub, priv, err := identity.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := identity.EventMessage("deploy.finished", []byte(`{"ok":true}`))
+	sig, err := identity.Sign(priv, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !identity.Verify(pub, msg, sig) {
+		t.Error("valid signature rejected")
+	}
+	if identity.Verify(pub, identity.EventMessage("deploy.finished", []byte(`{"ok":false}`)), sig) {
+		t.Error("signature accepted for tampered data")
+	}
+	if identity.Verify(pub, identity.EventMessage("deploy.failed", []byte(`{"ok":true}`)), sig) {
+		t.Error("signature accepted for a different topic")
+	}
+
+	otherPub, _, _ := identity.GenerateKey()
+	if identity.Verify(otherPub, msg, sig) {
+		t.Error("signature accepted for the wrong key")
+	}
+}
+
+func TestParsePublicKeyRejectsBadInput(t *testing.T) {
+	if _, err := identity.ParsePublicKey("not base64!"); err == nil {
+		t.Error("expected error for invalid base64")
+	}
+	if _, err := identity.ParsePublicKey("AAAA"); err == nil {
+		t.Error("expected error for short key")
+	}
+}
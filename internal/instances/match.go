@@ -0,0 +1,155 @@
+package instances
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MatchRequest describes the agent a piece of work needs. Capabilities,
+// Stack and Project must match; Prefer, Description and MaxOpenTasks are
+// workload hints that rank or rule out the instances that do.
+type MatchRequest struct {
+	Capabilities []string `json:"capabilities,omitempty"`   // all required
+	Stack        string   `json:"stack,omitempty"`          // exact, case-insensitive
+	Project      string   `json:"project,omitempty"`        // exact, case-insensitive
+	Prefer       []string `json:"prefer,omitempty"`         // nice-to-have capabilities
+	Description  string   `json:"description,omitempty"`    // the work, compared with current intents
+	MaxOpenTasks *int     `json:"max_open_tasks,omitempty"` // skip instances holding more claimed tasks
+	Limit        int      `json:"limit,omitempty"`          // default 5
+}
+
+// Candidate is an instance ranked by Match.
+type Candidate struct {
+	Instance  Summary  `json:"instance"`
+	Score     float64  `json:"score"`
+	OpenTasks int      `json:"open_tasks"`
+	Reasons   []string `json:"reasons"`
+}
+
+// Match scoring weights; a perfect candidate scores 100.
+const (
+	weightLiveness = 30 // heartbeat recency
+	weightWorkload = 40 // fewer claimed tasks
+	weightIntent   = 20 // idle, or already working on related things
+	weightPrefer   = 10 // preferred capabilities
+
+	// matchFreshFor is how long after a heartbeat an instance counts as
+	// fully live; its liveness score then falls to zero over the next
+	// matchFreshFor.
+	matchFreshFor = 2 * time.Minute
+
+	defaultMatchLimit = 5
+)
+
+// Match ranks active instances for a request, best first. openTasks maps
+// instance IDs to the number of tasks they have claimed. Pending and stale
+// instances are never candidates.
+func Match(list []Summary, req MatchRequest, openTasks map[string]int, now time.Time) []Candidate {
+	words := intentWords(req.Description)
+	out := []Candidate{}
+	for _, inst := range list {
+		if inst.Status != "active" ||
+			req.Stack != "" && !strings.EqualFold(inst.Stack, req.Stack) ||
+			req.Project != "" && !strings.EqualFold(inst.Project, req.Project) ||
+			!hasAll(inst.Capabilities, req.Capabilities) {
+			continue
+		}
+		open := openTasks[inst.ID]
+		if req.MaxOpenTasks != nil && open > *req.MaxOpenTasks {
+			continue
+		}
+		c := Candidate{Instance: inst, OpenTasks: open, Reasons: []string{}}
+		if len(req.Capabilities) > 0 {
+			c.Reasons = append(c.Reasons, "has "+strings.Join(req.Capabilities, ", "))
+		}
+
+		age := max(now.Sub(inst.LastSeen), 0)
+		live := 1.0
+		if age > matchFreshFor {
+			live = math.Max(0, 1-float64(age-matchFreshFor)/float64(matchFreshFor))
+		}
+		c.Score += weightLiveness * live
+		c.Reasons = append(c.Reasons, "seen "+age.Round(time.Second).String()+" ago")
+
+		c.Score += weightWorkload / float64(1+open)
+		c.Reasons = append(c.Reasons, fmt.Sprintf("%d open task(s)", open))
+
+		switch {
+		case strings.TrimSpace(inst.Intent) == "":
+			c.Score += weightIntent
+			c.Reasons = append(c.Reasons, "idle")
+		case len(words) > 0:
+			var shared []string
+			for _, w := range intentWords(inst.Intent) {
+				if slices.Contains(words, w) {
+					shared = append(shared, w)
+				}
+			}
+			if len(shared) > 0 {
+				c.Score += weightIntent * float64(len(shared)) / float64(len(words))
+				c.Reasons = append(c.Reasons, "working on related: "+strings.Join(shared, ", "))
+			}
+		}
+
+		if len(req.Prefer) > 0 {
+			n := 0
+			for _, p := range req.Prefer {
+				if hasAll(inst.Capabilities, []string{p}) {
+					n++
+				}
+			}
+			c.Score += weightPrefer * float64(n) / float64(len(req.Prefer))
+			c.Reasons = append(c.Reasons, fmt.Sprintf("has %d/%d preferred capabilities", n, len(req.Prefer)))
+		}
+
+		c.Score = math.Round(c.Score*10) / 10
+		out = append(out, c)
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Score != out[j].Score {
+			return out[i].Score > out[j].Score
+		}
+		if out[i].OpenTasks != out[j].OpenTasks {
+			return out[i].OpenTasks < out[j].OpenTasks
+		}
+		return out[i].Instance.Name < out[j].Instance.Name
+	})
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultMatchLimit
+	}
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
+
+// hasAll reports whether caps contains every capability in want, ignoring
+// case.
+func hasAll(caps, want []string) bool {
+	for _, w := range want {
+		if !slices.ContainsFunc(caps, func(c string) bool { return strings.EqualFold(c, w) }) {
+			return false
+		}
+	}
+	return true
+}
+
+// intentWords returns the distinct lowercase words of at least three
+// letters in a text.
+func intentWords(text string) []string {
+	var words []string
+	for _, w := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !('a' <= r && r <= 'z' || '0' <= r && r <= '9')
+	}) {
+		if len(w) >= 3 && !slices.Contains(words, w) {
+			words = append(words, w)
+		}
+	}
+	return words
+}
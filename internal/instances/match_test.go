@@ -0,0 +1,60 @@
+package instances_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DavidRHerbert/koor/internal/instances"
+)
+
+func TestMatch(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	list := []instances.Summary{
+		{ID: "a", Name: "busy-backend", Stack: "go", Project: "TW", Capabilities: []string{"sql", "Go"}, Status: "active", Intent: "migrating billing", LastSeen: now},
+		{ID: "b", Name: "idle-backend", Stack: "go", Project: "TW", Capabilities: []string{"go", "sql", "docker"}, Status: "active", LastSeen: now.Add(-30 * time.Second)},
+		{ID: "c", Name: "quiet-backend", Stack: "go", Project: "TW", Capabilities: []string{"go", "sql"}, Status: "active", LastSeen: now.Add(-10 * time.Minute)},
+		{ID: "d", Name: "pending-backend", Stack: "go", Project: "TW", Capabilities: []string{"go", "sql"}, Status: "pending", LastSeen: now},
+		{ID: "e", Name: "frontend", Stack: "react", Project: "TW", Capabilities: []string{"go", "sql"}, Status: "active", LastSeen: now},
+		{ID: "f", Name: "no-sql", Stack: "go", Project: "TW", Capabilities: []string{"go"}, Status: "active", LastSeen: now},
+	}
+	open := map[string]int{"a": 2}
+
+	got := instances.Match(list, instances.MatchRequest{
+		Capabilities: []string{"GO", "sql"}, Stack: "Go", Prefer: []string{"docker"},
+	}, open, now)
+	if len(got) != 3 {
+		t.Fatalf("expected 3 candidates, got %+v", got)
+	}
+	if got[0].Instance.ID != "b" || got[0].Score != 100 {
+		t.Errorf("idle, live instance with the preferred capability should rank first at 100: %+v", got[0])
+	}
+	if got[1].Instance.ID != "c" || got[1].Score != 60 {
+		t.Errorf("instance silent for 10m should keep only workload and idle points: %+v", got[1])
+	}
+	if got[2].Instance.ID != "a" || got[2].OpenTasks != 2 || got[2].Score != 43.3 {
+		t.Errorf("instance holding 2 tasks should rank last: %+v", got[2])
+	}
+
+	// Work related to a busy instance's intent scores like idleness.
+	got = instances.Match(list, instances.MatchRequest{
+		Capabilities: []string{"go"}, Project: "tw", Description: "billing", Limit: 2,
+	}, nil, now)
+	if len(got) != 2 || got[0].Instance.ID != "a" || got[0].Score != 90 {
+		t.Fatalf("expected the instance working on billing first, got %+v", got)
+	}
+	if r := got[0].Reasons; r[len(r)-1] != "working on related: billing" {
+		t.Errorf("reasons = %q", r)
+	}
+
+	zero := 0
+	got = instances.Match(list, instances.MatchRequest{Stack: "go", MaxOpenTasks: &zero}, open, now)
+	for _, c := range got {
+		if c.Instance.ID == "a" {
+			t.Errorf("max_open_tasks 0 should exclude an instance with claimed tasks")
+		}
+	}
+
+	if got := instances.Match(list, instances.MatchRequest{Capabilities: []string{"rust"}}, nil, now); len(got) != 0 {
+		t.Errorf("expected no candidates, got %+v", got)
+	}
+}
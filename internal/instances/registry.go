@@ -17,9 +17,11 @@ type Instance struct {
 	Workspace    string    `json:"workspace"`
 	Intent       string    `json:"intent"`
 	Stack        string    `json:"stack"`
+	Project      string    `json:"project,omitempty"`
 	Capabilities []string  `json:"capabilities"`
 	Status       string    `json:"status"`
 	Token        string    `json:"token,omitempty"`
+	PublicKey    string    `json:"public_key,omitempty"` // base64 Ed25519 key for signed events
 	RegisteredAt time.Time `json:"registered_at"`
 	LastSeen     time.Time `json:"last_seen"`
 }
@@ -31,6 +33,7 @@ type Summary struct {
 	Workspace    string    `json:"workspace"`
 	Intent       string    `json:"intent"`
 	Stack        string    `json:"stack"`
+	Project      string    `json:"project,omitempty"`
 	Capabilities []string  `json:"capabilities"`
 	Status       string    `json:"status"`
 	RegisteredAt time.Time `json:"registered_at"`
@@ -66,11 +69,11 @@ func (r *Registry) Register(ctx context.Context, name, workspace, intent, stack
 // Get retrieves an instance by ID. Returns sql.ErrNoRows if not found.
 func (r *Registry) Get(ctx context.Context, id string) (*Instance, error) {
 	var inst Instance
-	var registeredAt, lastSeen, capsStr string
+	var capsStr string
 	err := r.db.QueryRowContext(ctx,
-		`SELECT id, name, workspace, intent, stack, capabilities, status, token, registered_at, last_seen
+		`SELECT id, name, workspace, intent, stack, project, capabilities, status, token, public_key, registered_at, last_seen
 		 FROM instances WHERE id = ?`, id).
-		Scan(&inst.ID, &inst.Name, &inst.Workspace, &inst.Intent, &inst.Stack, &capsStr, &inst.Status, &inst.Token, &registeredAt, &lastSeen)
+		Scan(&inst.ID, &inst.Name, &inst.Workspace, &inst.Intent, &inst.Stack, &inst.Project, &capsStr, &inst.Status, &inst.Token, &inst.PublicKey, &inst.RegisteredAt, &inst.LastSeen)
 	if err != nil {
 		return nil, err
 	}
@@ -78,15 +81,26 @@ func (r *Registry) Get(ctx context.Context, id string) (*Instance, error) {
 	if inst.Capabilities == nil {
 		inst.Capabilities = []string{}
 	}
-	inst.RegisteredAt, _ = time.Parse("2006-01-02 15:04:05", registeredAt)
-	inst.LastSeen, _ = time.Parse("2006-01-02 15:04:05", lastSeen)
 	return &inst, nil
 }
 
+// GetByToken retrieves the instance issued the given registration token.
+// Returns sql.ErrNoRows if no instance holds it.
+func (r *Registry) GetByToken(ctx context.Context, token string) (*Instance, error) {
+	if token == "" {
+		return nil, sql.ErrNoRows
+	}
+	var id string
+	if err := r.db.QueryRowContext(ctx, `SELECT id FROM instances WHERE token = ?`, token).Scan(&id); err != nil {
+		return nil, err
+	}
+	return r.Get(ctx, id)
+}
+
 // List returns summaries of all registered instances (no tokens).
 func (r *Registry) List(ctx context.Context) ([]Summary, error) {
 	rows, err := r.db.QueryContext(ctx,
-		`SELECT id, name, workspace, intent, stack, capabilities, status, registered_at, last_seen
+		`SELECT id, name, workspace, intent, stack, project, capabilities, status, registered_at, last_seen
 		 FROM instances ORDER BY last_seen DESC`)
 	if err != nil {
 		return nil, fmt.Errorf("query instances: %w", err)
@@ -96,7 +110,7 @@ func (r *Registry) List(ctx context.Context) ([]Summary, error) {
 
 // Discover returns instances matching optional name, workspace, stack, and capability filters.
 func (r *Registry) Discover(ctx context.Context, name, workspace, stack, capability string) ([]Summary, error) {
-	query := `SELECT id, name, workspace, intent, stack, capabilities, status, registered_at, last_seen FROM instances WHERE 1=1`
+	query := `SELECT id, name, workspace, intent, stack, project, capabilities, status, registered_at, last_seen FROM instances WHERE 1=1`
 	args := []any{}
 
 	if name != "" {
@@ -190,7 +204,7 @@ func (r *Registry) MarkStale(ctx context.Context, id string) error {
 func (r *Registry) ListStale(ctx context.Context, threshold time.Duration) ([]Summary, error) {
 	cutoff := time.Now().Add(-threshold).UTC().Format("2006-01-02 15:04:05")
 	rows, err := r.db.QueryContext(ctx,
-		`SELECT id, name, workspace, intent, stack, capabilities, status, registered_at, last_seen
+		`SELECT id, name, workspace, intent, stack, project, capabilities, status, registered_at, last_seen
 		 FROM instances WHERE status = 'active' AND last_seen < ?
 		 ORDER BY last_seen ASC`, cutoff)
 	if err != nil {
@@ -202,7 +216,7 @@ func (r *Registry) ListStale(ctx context.Context, threshold time.Duration) ([]Su
 // ListByStatus returns instances with the given status.
 func (r *Registry) ListByStatus(ctx context.Context, status string) ([]Summary, error) {
 	rows, err := r.db.QueryContext(ctx,
-		`SELECT id, name, workspace, intent, stack, capabilities, status, registered_at, last_seen
+		`SELECT id, name, workspace, intent, stack, project, capabilities, status, registered_at, last_seen
 		 FROM instances WHERE status = ?
 		 ORDER BY last_seen DESC`, status)
 	if err != nil {
@@ -227,22 +241,49 @@ func (r *Registry) SetCapabilities(ctx context.Context, id string, capabilities
 	return nil
 }
 
+// SetProject assigns an instance to a project.
+func (r *Registry) SetProject(ctx context.Context, id, project string) error {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE instances SET project = ? WHERE id = ?`, project, id)
+	if err != nil {
+		return fmt.Errorf("set project: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SetPublicKey stores the base64 Ed25519 public key used to verify events
+// signed by an instance.
+func (r *Registry) SetPublicKey(ctx context.Context, id, publicKey string) error {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE instances SET public_key = ? WHERE id = ?`, publicKey, id)
+	if err != nil {
+		return fmt.Errorf("set public key: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
 // scanSummaries scans rows into Summary slices, handling capabilities JSON.
 func scanSummaries(rows *sql.Rows) ([]Summary, error) {
 	defer rows.Close()
 	var items []Summary
 	for rows.Next() {
 		var item Summary
-		var registeredAt, lastSeen, capsStr string
-		if err := rows.Scan(&item.ID, &item.Name, &item.Workspace, &item.Intent, &item.Stack, &capsStr, &item.Status, &registeredAt, &lastSeen); err != nil {
+		var capsStr string
+		if err := rows.Scan(&item.ID, &item.Name, &item.Workspace, &item.Intent, &item.Stack, &item.Project, &capsStr, &item.Status, &item.RegisteredAt, &item.LastSeen); err != nil {
 			return nil, fmt.Errorf("scan instance: %w", err)
 		}
 		json.Unmarshal([]byte(capsStr), &item.Capabilities)
 		if item.Capabilities == nil {
 			item.Capabilities = []string{}
 		}
-		item.RegisteredAt, _ = time.Parse("2006-01-02 15:04:05", registeredAt)
-		item.LastSeen, _ = time.Parse("2006-01-02 15:04:05", lastSeen)
 		items = append(items, item)
 	}
 	return items, rows.Err()
@@ -4,16 +4,25 @@ import (
 	"context"
 	"encoding/json"
 	"log/slog"
+	"strings"
 	"time"
 
 	"github.com/DavidRHerbert/koor/internal/events"
 	"github.com/DavidRHerbert/koor/internal/instances"
+	"github.com/DavidRHerbert/koor/internal/tasks"
+	"github.com/DavidRHerbert/koor/internal/tokens"
+	"github.com/DavidRHerbert/koor/internal/webhooks"
 )
 
-// Monitor periodically checks for stale agent instances and marks them accordingly.
+// Monitor periodically checks for stale agent instances and marks them
+// accordingly, then escalates by the instance's project policy.
 type Monitor struct {
 	registry   *instances.Registry
 	eventBus   *events.Bus
+	policies   *PolicyStore
+	webhooks   *webhooks.Dispatcher
+	tasks      *tasks.Store
+	tokens     *tokens.Store
 	staleAfter time.Duration
 	checkEvery time.Duration
 	stop       chan struct{}
@@ -38,6 +47,31 @@ func New(registry *instances.Registry, eventBus *events.Bus, staleAfter, checkEv
 	}
 }
 
+// SetPolicies enables escalation policies for stale instances.
+func (m *Monitor) SetPolicies(p *PolicyStore) {
+	m.policies = p
+}
+
+// Policies returns the escalation policy store, or nil.
+func (m *Monitor) Policies() *PolicyStore {
+	return m.policies
+}
+
+// SetWebhooks lets policies notify a webhook.
+func (m *Monitor) SetWebhooks(d *webhooks.Dispatcher) {
+	m.webhooks = d
+}
+
+// SetTasks lets policies reassign a stale instance's claimed tasks.
+func (m *Monitor) SetTasks(store *tasks.Store) {
+	m.tasks = store
+}
+
+// SetTokens lets auto-deregistration revoke the instance's tokens.
+func (m *Monitor) SetTokens(store *tokens.Store) {
+	m.tokens = store
+}
+
 // Start begins periodic staleness checks in a background goroutine.
 func (m *Monitor) Start() {
 	go func() {
@@ -63,12 +97,15 @@ func (m *Monitor) Stop() {
 }
 
 // CheckNow runs a single staleness check and returns newly-staled instances.
+// Newly stale instances are escalated by their policy, and stale instances
+// past their policy's deregister_after are deregistered.
 func (m *Monitor) CheckNow(ctx context.Context) []instances.Summary {
 	stale, err := m.registry.ListStale(ctx, m.staleAfter)
 	if err != nil {
 		m.logger.Error("liveness check failed", "error", err)
 		return nil
 	}
+	defer m.deregisterExpired(ctx)
 
 	var marked []instances.Summary
 	for _, inst := range stale {
@@ -85,12 +122,106 @@ func (m *Monitor) CheckNow(ctx context.Context) []instances.Summary {
 			"name":        inst.Name,
 			"workspace":   inst.Workspace,
 			"stack":       inst.Stack,
+			"project":     inst.Project,
 			"last_seen":   inst.LastSeen,
 		})
-		m.eventBus.Publish(ctx, "agent.stale", json.RawMessage(data), "liveness-monitor")
+		ev, err := m.eventBus.Publish(ctx, "agent.stale", json.RawMessage(data), "liveness-monitor")
+		if err != nil {
+			m.logger.Error("publish agent.stale failed", "id", inst.ID, "error", err)
+		}
 
 		inst.Status = "stale"
+		m.escalate(ctx, inst, ev, data)
 		marked = append(marked, inst)
 	}
 	return marked
 }
+
+// policyFor returns the escalation policy for an instance, or nil.
+func (m *Monitor) policyFor(ctx context.Context, inst instances.Summary) *Policy {
+	if m.policies == nil {
+		return nil
+	}
+	p, err := m.policies.For(ctx, inst.Project)
+	if err != nil {
+		m.logger.Error("liveness policy lookup failed", "project", inst.Project, "error", err)
+		return nil
+	}
+	return p
+}
+
+// escalate runs the policy actions for a newly stale instance. ev is the
+// agent.stale event, nil if it could not be published.
+func (m *Monitor) escalate(ctx context.Context, inst instances.Summary, ev *events.Event, data []byte) {
+	p := m.policyFor(ctx, inst)
+	if p == nil {
+		return
+	}
+	if p.Event && inst.Project != "" {
+		topic := strings.ToLower(inst.Project) + ".agent.stale"
+		if _, err := m.eventBus.Publish(ctx, topic, json.RawMessage(data), "liveness-monitor"); err != nil {
+			m.logger.Error("publish stale escalation failed", "topic", topic, "error", err)
+		}
+	}
+	if p.Webhook != "" && m.webhooks != nil && ev != nil {
+		if err := m.webhooks.Notify(ctx, p.Webhook, *ev); err != nil {
+			m.logger.Warn("stale escalation webhook failed", "webhook_id", p.Webhook, "id", inst.ID, "error", err)
+		}
+	}
+	if p.ReassignTasks && m.tasks != nil {
+		released, err := m.tasks.ReleaseClaims(ctx, inst.ID)
+		if err != nil {
+			m.logger.Error("reassign stale instance tasks failed", "id", inst.ID, "error", err)
+		} else if len(released) > 0 {
+			m.logger.Info("stale instance tasks reassigned", "id", inst.ID, "name", inst.Name, "tasks", len(released))
+		}
+	}
+}
+
+// deregisterExpired deregisters stale instances that have not been seen
+// for their policy's deregister_after, revoking their tokens and releasing
+// their tasks. Their state and inbox are left for the orphan cleaner.
+func (m *Monitor) deregisterExpired(ctx context.Context) {
+	if m.policies == nil {
+		return
+	}
+	stale, err := m.registry.ListByStatus(ctx, "stale")
+	if err != nil {
+		m.logger.Error("liveness deregister check failed", "error", err)
+		return
+	}
+	for _, inst := range stale {
+		p := m.policyFor(ctx, inst)
+		if p == nil {
+			continue
+		}
+		after, _ := p.deregisterAfter()
+		if after == 0 || time.Since(inst.LastSeen) < after {
+			continue
+		}
+		if err := m.registry.Deregister(ctx, inst.ID); err != nil {
+			m.logger.Error("auto-deregister failed", "id", inst.ID, "name", inst.Name, "error", err)
+			continue
+		}
+		if m.tokens != nil {
+			if err := m.tokens.RevokeInstance(ctx, inst.ID); err != nil {
+				m.logger.Error("revoke instance tokens failed", "id", inst.ID, "error", err)
+			}
+		}
+		if m.tasks != nil {
+			if _, err := m.tasks.ReleaseClaims(ctx, inst.ID); err != nil {
+				m.logger.Error("release deregistered instance tasks failed", "id", inst.ID, "error", err)
+			}
+		}
+		m.logger.Warn("stale agent deregistered", "id", inst.ID, "name", inst.Name, "last_seen", inst.LastSeen, "after", p.DeregisterAfter)
+
+		data, _ := json.Marshal(map[string]any{
+			"instance_id":      inst.ID,
+			"name":             inst.Name,
+			"project":          inst.Project,
+			"last_seen":        inst.LastSeen,
+			"deregister_after": p.DeregisterAfter,
+		})
+		m.eventBus.Publish(ctx, "agent.deregistered", json.RawMessage(data), "liveness-monitor")
+	}
+}
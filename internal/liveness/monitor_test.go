@@ -4,8 +4,14 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"io"
 	"log/slog"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -13,6 +19,9 @@ import (
 	"github.com/DavidRHerbert/koor/internal/events"
 	"github.com/DavidRHerbert/koor/internal/instances"
 	"github.com/DavidRHerbert/koor/internal/liveness"
+	"github.com/DavidRHerbert/koor/internal/tasks"
+	"github.com/DavidRHerbert/koor/internal/tokens"
+	"github.com/DavidRHerbert/koor/internal/webhooks"
 )
 
 type testEnv struct {
@@ -221,3 +230,151 @@ func TestListByStatus(t *testing.T) {
 		t.Errorf("expected 1 pending, got %d", len(pending))
 	}
 }
+
+func TestPolicyStore(t *testing.T) {
+	env := setup(t)
+	ctx := context.Background()
+	store := liveness.NewPolicyStore(env.db)
+
+	if p, err := store.For(ctx, "truck"); err != nil || p != nil {
+		t.Fatalf("expected no policy, got %+v, %v", p, err)
+	}
+	if _, err := store.Put(ctx, liveness.Policy{Project: "truck", DeregisterAfter: "soon"}); err == nil {
+		t.Error("expected an error for a bad deregister_after")
+	}
+	if _, err := store.Put(ctx, liveness.Policy{Project: liveness.AnyProject, Event: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Put(ctx, liveness.Policy{Project: "truck", ReassignTasks: true, DeregisterAfter: "24h"}); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := store.For(ctx, "truck")
+	if err != nil || p.Project != "truck" || !p.ReassignTasks || p.Event {
+		t.Errorf("expected the truck policy, got %+v, %v", p, err)
+	}
+	p, err = store.For(ctx, "")
+	if err != nil || p.Project != liveness.AnyProject {
+		t.Errorf("expected the * policy for no project, got %+v, %v", p, err)
+	}
+
+	if list, _ := store.List(ctx); len(list) != 2 {
+		t.Errorf("expected 2 policies, got %d", len(list))
+	}
+	if err := store.Delete(ctx, "truck"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete(ctx, "truck"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected ErrNoRows, got %v", err)
+	}
+}
+
+func TestCheckNowEscalates(t *testing.T) {
+	env := setup(t)
+	ctx := context.Background()
+
+	var received atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), `"agent.stale"`) {
+			received.Add(1)
+		}
+		w.WriteHeader(200)
+	}))
+	defer backend.Close()
+	disp := webhooks.New(env.db, env.bus, env.logger)
+	if _, err := disp.Register(ctx, "oncall", backend.URL, []string{"deploy.*"}, "", ""); err != nil {
+		t.Fatal(err)
+	}
+	taskStore := tasks.New(env.db, env.bus)
+
+	policies := liveness.NewPolicyStore(env.db)
+	policies.Put(ctx, liveness.Policy{Project: "Truck", Event: true, Webhook: "oncall", ReassignTasks: true})
+
+	inst := env.registerActive(t, "truck-backend")
+	env.registry.SetProject(ctx, inst.ID, "Truck")
+	taskStore.Create(ctx, tasks.Task{Project: "Truck", Title: "build"})
+	claimed, err := taskStore.Claim(ctx, "Truck", nil, inst.ID, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.backdateLastSeen(t, inst.ID, 10)
+
+	sub := env.bus.Subscribe("truck.agent.stale")
+	defer env.bus.Unsubscribe(sub)
+
+	mon := liveness.New(env.registry, env.bus, 5*time.Minute, time.Minute, env.logger)
+	mon.SetPolicies(policies)
+	mon.SetWebhooks(disp)
+	mon.SetTasks(taskStore)
+	if marked := mon.CheckNow(ctx); len(marked) != 1 {
+		t.Fatalf("expected 1 stale, got %d", len(marked))
+	}
+
+	select {
+	case ev := <-sub.Ch:
+		var data map[string]any
+		json.Unmarshal(ev.Data, &data)
+		if data["instance_id"] != inst.ID || data["project"] != "Truck" {
+			t.Errorf("unexpected project event data: %s", ev.Data)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for truck.agent.stale")
+	}
+	if received.Load() != 1 {
+		t.Errorf("expected the webhook to get agent.stale once, got %d", received.Load())
+	}
+	task, _ := taskStore.Get(ctx, claimed.ID)
+	if task.Status != "pending" || task.ClaimedBy != "" {
+		t.Errorf("expected the task back to pending, got %s claimed by %q", task.Status, task.ClaimedBy)
+	}
+	got, _ := env.registry.Get(ctx, inst.ID)
+	if got == nil || got.Status != "stale" {
+		t.Errorf("expected the instance to stay registered as stale, got %+v", got)
+	}
+}
+
+func TestCheckNowDeregistersAfterPolicy(t *testing.T) {
+	env := setup(t)
+	ctx := context.Background()
+	tokenStore := tokens.New(env.db)
+
+	policies := liveness.NewPolicyStore(env.db)
+	policies.Put(ctx, liveness.Policy{Project: liveness.AnyProject, DeregisterAfter: "1h"})
+
+	old := env.registerActive(t, "agent-old")
+	recent := env.registerActive(t, "agent-recent")
+	if _, _, err := tokenStore.Create(ctx, tokens.Token{Name: "old", Scopes: []string{tokens.ScopeRead}, InstanceID: old.ID}); err != nil {
+		t.Fatal(err)
+	}
+	env.backdateLastSeen(t, old.ID, 90)
+	env.backdateLastSeen(t, recent.ID, 10)
+
+	sub := env.bus.Subscribe("agent.deregistered")
+	defer env.bus.Unsubscribe(sub)
+
+	mon := liveness.New(env.registry, env.bus, 5*time.Minute, time.Minute, env.logger)
+	mon.SetPolicies(policies)
+	mon.SetTokens(tokenStore)
+	mon.CheckNow(ctx)
+
+	if _, err := env.registry.Get(ctx, old.ID); err == nil {
+		t.Error("expected the instance unseen for 90m to be deregistered")
+	}
+	if got, err := env.registry.Get(ctx, recent.ID); err != nil || got.Status != "stale" {
+		t.Errorf("expected the instance unseen for 10m to stay stale, got %+v, %v", got, err)
+	}
+	if list, _ := tokenStore.List(ctx, old.ID); len(list) != 0 {
+		t.Errorf("expected the deregistered instance's token to be revoked, got %d", len(list))
+	}
+	select {
+	case ev := <-sub.Ch:
+		var data map[string]any
+		json.Unmarshal(ev.Data, &data)
+		if data["instance_id"] != old.ID {
+			t.Errorf("unexpected agent.deregistered data: %s", ev.Data)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for agent.deregistered")
+	}
+}
@@ -0,0 +1,149 @@
+package liveness
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// AnyProject is the policy project that covers instances whose project has
+// no policy of its own, including instances registered without a project.
+const AnyProject = "*"
+
+// Policy says what happens when an instance of a project goes stale,
+// beyond the agent.stale event that is always published.
+type Policy struct {
+	Project string `json:"project"`
+
+	// Event publishes "{project}.agent.stale", so project webhooks and
+	// subscribers hear about it.
+	Event bool `json:"event"`
+	// Webhook is the ID of a registered webhook that is sent the
+	// agent.stale event whatever its patterns.
+	Webhook string `json:"webhook,omitempty"`
+	// ReassignTasks puts the tasks the instance has claimed back to pending.
+	ReassignTasks bool `json:"reassign_tasks"`
+	// DeregisterAfter deregisters a stale instance once it has not been
+	// seen for this long, as a Go duration such as "24h".
+	DeregisterAfter string `json:"deregister_after,omitempty"`
+
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Validate checks the policy's fields.
+func (p Policy) Validate() error {
+	if p.Project == "" {
+		return errors.New("project is required")
+	}
+	if _, err := p.deregisterAfter(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// deregisterAfter parses DeregisterAfter; zero means never.
+func (p Policy) deregisterAfter() (time.Duration, error) {
+	if p.DeregisterAfter == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(p.DeregisterAfter)
+	if err != nil {
+		return 0, fmt.Errorf("deregister_after: %w", err)
+	}
+	if d <= 0 {
+		return 0, errors.New("deregister_after must be positive")
+	}
+	return d, nil
+}
+
+// PolicyStore persists stale-instance escalation policies in SQLite.
+type PolicyStore struct {
+	db *sql.DB
+}
+
+// NewPolicyStore creates a new PolicyStore.
+func NewPolicyStore(db *sql.DB) *PolicyStore {
+	return &PolicyStore{db: db}
+}
+
+const policyColumns = `project, event, webhook, reassign_tasks, deregister_after, updated_at`
+
+func scanPolicy(row interface{ Scan(...any) error }) (*Policy, error) {
+	var p Policy
+	if err := row.Scan(&p.Project, &p.Event, &p.Webhook, &p.ReassignTasks, &p.DeregisterAfter, &p.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// List returns every policy, ordered by project.
+func (s *PolicyStore) List(ctx context.Context) ([]Policy, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+policyColumns+` FROM liveness_policies ORDER BY project`)
+	if err != nil {
+		return nil, fmt.Errorf("list liveness policies: %w", err)
+	}
+	defer rows.Close()
+
+	var out []Policy
+	for rows.Next() {
+		p, err := scanPolicy(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan liveness policy: %w", err)
+		}
+		out = append(out, *p)
+	}
+	return out, rows.Err()
+}
+
+// Get returns a project's policy, or sql.ErrNoRows.
+func (s *PolicyStore) Get(ctx context.Context, project string) (*Policy, error) {
+	return scanPolicy(s.db.QueryRowContext(ctx,
+		`SELECT `+policyColumns+` FROM liveness_policies WHERE project = ?`, project))
+}
+
+// For returns the policy that applies to an instance of project: its own,
+// else the AnyProject policy, else nil.
+func (s *PolicyStore) For(ctx context.Context, project string) (*Policy, error) {
+	if project != "" {
+		p, err := s.Get(ctx, project)
+		if !errors.Is(err, sql.ErrNoRows) {
+			return p, err
+		}
+	}
+	p, err := s.Get(ctx, AnyProject)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return p, err
+}
+
+// Put creates or replaces a project's policy.
+func (s *PolicyStore) Put(ctx context.Context, p Policy) (*Policy, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO liveness_policies (`+policyColumns+`) VALUES (?, ?, ?, ?, ?, datetime('now'))
+		 ON CONFLICT(project) DO UPDATE SET
+		   event = excluded.event, webhook = excluded.webhook, reassign_tasks = excluded.reassign_tasks,
+		   deregister_after = excluded.deregister_after, updated_at = excluded.updated_at`,
+		p.Project, p.Event, p.Webhook, p.ReassignTasks, p.DeregisterAfter)
+	if err != nil {
+		return nil, fmt.Errorf("put liveness policy: %w", err)
+	}
+	return s.Get(ctx, p.Project)
+}
+
+// Delete removes a project's policy. Returns sql.ErrNoRows if there is none.
+func (s *PolicyStore) Delete(ctx context.Context, project string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM liveness_policies WHERE project = ?`, project)
+	if err != nil {
+		return fmt.Errorf("delete liveness policy: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
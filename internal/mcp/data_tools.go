@@ -0,0 +1,203 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	mcplib "github.com/mark3labs/mcp-go/mcp"
+)
+
+// Data tools: publish_event, get_state and set_state. Koor keeps data off
+// MCP so it does not pass through the LLM context, but some IDE agents
+// cannot run koor-cli or curl at all. For them the server can enable these
+// tools (--mcp-data-tools). Each tool is a thin wrapper around the REST
+// call it replaces, made in-process with the caller's bearer token, so
+// auth, policies and validation apply unchanged.
+
+type ctxKey string
+
+const authorizationKey ctxKey = "authorization"
+
+// withAuthorization keeps the MCP request's Authorization header for the
+// API calls the data tools make.
+func withAuthorization(ctx context.Context, r *http.Request) context.Context {
+	return context.WithValue(ctx, authorizationKey, r.Header.Get("Authorization"))
+}
+
+// EnableDataTools registers the data tools, which call api (the server's
+// REST handler) on the agent's behalf.
+func (t *Transport) EnableDataTools(api http.Handler) {
+	t.api = api
+
+	t.server.AddTool(
+		mcplib.NewTool("publish_event",
+			mcplib.WithDescription("Publish an event to the Koor event bus. Only for agents that cannot call the REST API or koor-cli: each call costs LLM context."),
+			mcplib.WithString("topic", mcplib.Required(), mcplib.Description("Event topic (e.g. 'truck-wash.backend.done')")),
+			mcplib.WithString("data", mcplib.Description("JSON event data (as a string), default '{}'")),
+			mcplib.WithString("instance_id", mcplib.Description("Instance ID publishing the event, for policies and signatures")),
+		),
+		t.handlePublishEvent,
+	)
+	t.server.AddTool(
+		mcplib.NewTool("get_state",
+			mcplib.WithDescription("Read a shared state key. Only for agents that cannot call the REST API or koor-cli: each call costs LLM context."),
+			mcplib.WithString("key", mcplib.Required(), mcplib.Description("State key (e.g. 'Truck-Wash/backend-task')")),
+		),
+		t.handleGetState,
+	)
+	t.server.AddTool(
+		mcplib.NewTool("set_state",
+			mcplib.WithDescription("Write a shared state key. Only for agents that cannot call the REST API or koor-cli: each call costs LLM context."),
+			mcplib.WithString("key", mcplib.Required(), mcplib.Description("State key (e.g. 'Truck-Wash/backend-task')")),
+			mcplib.WithString("value", mcplib.Required(), mcplib.Description("Value to store, usually JSON (as a string)")),
+			mcplib.WithString("content_type", mcplib.Description("Content type of the value (default: application/json)")),
+			mcplib.WithString("expected_version", mcplib.Description("Only write if the key is at this version ('0' = must not exist)")),
+			mcplib.WithString("instance_id", mcplib.Description("Instance ID making the write, for policies")),
+		),
+		t.handleSetState,
+	)
+}
+
+func (t *Transport) handlePublishEvent(ctx context.Context, req mcplib.CallToolRequest) (*mcplib.CallToolResult, error) {
+	topic := getArg(req, "topic")
+	if topic == "" {
+		return mcplib.NewToolResultError("topic is required"), nil
+	}
+	data := getArg(req, "data")
+	if data == "" {
+		data = "{}"
+	}
+	if !json.Valid([]byte(data)) {
+		return mcplib.NewToolResultError("data must be valid JSON"), nil
+	}
+	body, _ := json.Marshal(map[string]any{"topic": topic, "data": json.RawMessage(data)})
+
+	rec := t.serveAPI(ctx, http.MethodPost, "/api/events/publish", body, map[string]string{
+		"Content-Type":    "application/json",
+		"X-Koor-Instance": getArg(req, "instance_id"),
+	})
+	if rec.status != http.StatusOK {
+		return apiError("publish event", rec), nil
+	}
+	return mcplib.NewToolResultText(rec.body.String()), nil
+}
+
+func (t *Transport) handleGetState(ctx context.Context, req mcplib.CallToolRequest) (*mcplib.CallToolResult, error) {
+	key := getArg(req, "key")
+	if key == "" {
+		return mcplib.NewToolResultError("key is required"), nil
+	}
+	rec := t.serveAPI(ctx, http.MethodGet, statePath(key), nil, nil)
+	if rec.status != http.StatusOK {
+		return apiError("get state", rec), nil
+	}
+
+	value := json.RawMessage(rec.body.Bytes())
+	if !json.Valid(value) {
+		value, _ = json.Marshal(rec.body.String())
+	}
+	data, _ := json.MarshalIndent(map[string]any{
+		"key":          key,
+		"version":      rec.header.Get("X-Koor-Version"),
+		"content_type": rec.header.Get("Content-Type"),
+		"value":        value,
+	}, "", "  ")
+	return mcplib.NewToolResultText(string(data)), nil
+}
+
+func (t *Transport) handleSetState(ctx context.Context, req mcplib.CallToolRequest) (*mcplib.CallToolResult, error) {
+	key := getArg(req, "key")
+	value := getArg(req, "value")
+	if key == "" || value == "" {
+		return mcplib.NewToolResultError("key and value are required"), nil
+	}
+	rec := t.serveAPI(ctx, http.MethodPut, statePath(key), []byte(value), map[string]string{
+		"Content-Type":            getArg(req, "content_type"),
+		"X-Koor-Expected-Version": getArg(req, "expected_version"),
+		"X-Koor-Instance":         getArg(req, "instance_id"),
+	})
+	if rec.status != http.StatusOK {
+		return apiError("set state", rec), nil
+	}
+	return mcplib.NewToolResultText(rec.body.String()), nil
+}
+
+// apiResponse records an in-process API response.
+type apiResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *apiResponse) Header() http.Header { return r.header }
+
+func (r *apiResponse) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+}
+
+func (r *apiResponse) Write(b []byte) (int, error) {
+	r.WriteHeader(http.StatusOK)
+	return r.body.Write(b)
+}
+
+// serveAPI makes an API request with the MCP caller's Authorization
+// header. Empty header values are not sent.
+func (t *Transport) serveAPI(ctx context.Context, method, path string, body []byte, header map[string]string) *apiResponse {
+	rec := &apiResponse{header: http.Header{}}
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, path, r)
+	if err != nil {
+		rec.status = http.StatusBadRequest
+		fmt.Fprintf(&rec.body, `{"error": %q}`, err.Error())
+		return rec
+	}
+	if auth, _ := ctx.Value(authorizationKey).(string); auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	for k, v := range header {
+		if v != "" {
+			req.Header.Set(k, v)
+		}
+	}
+	t.api.ServeHTTP(rec, req)
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	return rec
+}
+
+// statePath returns the API path of a state key, escaping each segment.
+func statePath(key string) string {
+	parts := strings.Split(key, "/")
+	for i, p := range parts {
+		parts[i] = url.PathEscape(p)
+	}
+	return "/api/state/" + strings.Join(parts, "/")
+}
+
+// apiError turns an API error response into a tool error.
+func apiError(what string, rec *apiResponse) *mcplib.CallToolResult {
+	return mcplib.NewToolResultError(fmt.Sprintf("%s failed (%d): %s", what, rec.status, apiMessage(rec)))
+}
+
+// apiMessage returns the error message of an API error response.
+func apiMessage(rec *apiResponse) string {
+	var msg struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(rec.body.Bytes(), &msg) != nil || msg.Error == "" {
+		msg.Error = strings.TrimSpace(rec.body.String())
+	}
+	return msg.Error
+}
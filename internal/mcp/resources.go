@@ -0,0 +1,131 @@
+package mcp
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/DavidRHerbert/koor/internal/contracts"
+	mcplib "github.com/mark3labs/mcp-go/mcp"
+)
+
+// Resources: agents can read specs, contracts and selected state keys as
+// MCP resources instead of spending a tool call on each. Like the data
+// tools, every read is the REST call it stands for, made with the caller's
+// bearer token. Clients are sent notifications/resources/updated when a
+// resource changes.
+
+// Resource URI prefixes.
+const (
+	SpecURIPrefix     = "koor://specs/"
+	ContractURIPrefix = "koor://contracts/"
+	StateURIPrefix    = "koor://state/"
+)
+
+// EnableResources registers the spec and contract resource templates, and
+// the state one if statePrefixes is not empty. Only state keys starting
+// with one of statePrefixes can be read; "" allows every key.
+func (t *Transport) EnableResources(api http.Handler, statePrefixes []string) {
+	t.api = api
+	t.statePrefixes = statePrefixes
+
+	t.server.AddResourceTemplate(
+		mcplib.NewResourceTemplate("koor://specs/{project}/{name}", "spec",
+			mcplib.WithTemplateDescription("A project spec, as stored. Changes are announced with notifications/resources/updated."),
+			mcplib.WithTemplateMIMEType("application/json"),
+		),
+		t.readSpecResource,
+	)
+	t.server.AddResourceTemplate(
+		mcplib.NewResourceTemplate("koor://contracts/{project}/{name}", "contract",
+			mcplib.WithTemplateDescription("An API contract (a spec of kind contract) agreed between a project's agents."),
+			mcplib.WithTemplateMIMEType("application/json"),
+		),
+		t.readContractResource,
+	)
+	if len(statePrefixes) > 0 {
+		t.server.AddResourceTemplate(
+			mcplib.NewResourceTemplate("koor://state/{+key}", "state",
+				mcplib.WithTemplateDescription("A shared state key. Only keys the server exposes as resources can be read."),
+			),
+			t.readStateResource,
+		)
+	}
+}
+
+// ResourceUpdated tells connected clients that the resource at uri changed.
+func (t *Transport) ResourceUpdated(uri string) {
+	t.server.SendNotificationToAllClients(mcplib.MethodNotificationResourceUpdated, map[string]any{"uri": uri})
+}
+
+// StateResourceExposed reports whether a state key can be read as a resource.
+func (t *Transport) StateResourceExposed(key string) bool {
+	for _, p := range t.statePrefixes {
+		if strings.HasPrefix(key, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *Transport) readSpecResource(ctx context.Context, req mcplib.ReadResourceRequest) ([]mcplib.ResourceContents, error) {
+	data, err := t.readSpec(ctx, req.Params.URI, SpecURIPrefix)
+	if err != nil {
+		return nil, err
+	}
+	return []mcplib.ResourceContents{mcplib.TextResourceContents{URI: req.Params.URI, MIMEType: "application/json", Text: string(data)}}, nil
+}
+
+func (t *Transport) readContractResource(ctx context.Context, req mcplib.ReadResourceRequest) ([]mcplib.ResourceContents, error) {
+	data, err := t.readSpec(ctx, req.Params.URI, ContractURIPrefix)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := contracts.Parse(data); err != nil {
+		return nil, fmt.Errorf("%s is not a contract: %w", req.Params.URI, err)
+	}
+	return []mcplib.ResourceContents{mcplib.TextResourceContents{URI: req.Params.URI, MIMEType: "application/json", Text: string(data)}}, nil
+}
+
+// readSpec fetches the spec a "{prefix}{project}/{name}" URI names.
+func (t *Transport) readSpec(ctx context.Context, uri, prefix string) ([]byte, error) {
+	project, name, ok := strings.Cut(strings.TrimPrefix(uri, prefix), "/")
+	project, perr := url.PathUnescape(project)
+	name, nerr := url.PathUnescape(name)
+	if !ok || perr != nil || nerr != nil || project == "" || name == "" || strings.Contains(name, "/") {
+		return nil, fmt.Errorf("invalid resource URI %q (expected %s{project}/{name})", uri, prefix)
+	}
+	rec := t.serveAPI(ctx, http.MethodGet, "/api/specs/"+url.PathEscape(project)+"/"+url.PathEscape(name), nil, nil)
+	if rec.status != http.StatusOK {
+		return nil, resourceError(uri, rec)
+	}
+	return rec.body.Bytes(), nil
+}
+
+func (t *Transport) readStateResource(ctx context.Context, req mcplib.ReadResourceRequest) ([]mcplib.ResourceContents, error) {
+	uri := req.Params.URI
+	key := strings.TrimPrefix(uri, StateURIPrefix)
+	if key == "" || !t.StateResourceExposed(key) {
+		return nil, fmt.Errorf("state key %q is not exposed as a resource", key)
+	}
+	rec := t.serveAPI(ctx, http.MethodGet, statePath(key), nil, nil)
+	if rec.status != http.StatusOK {
+		return nil, resourceError(uri, rec)
+	}
+	contentType := rec.header.Get("Content-Type")
+	if !utf8.Valid(rec.body.Bytes()) {
+		return []mcplib.ResourceContents{mcplib.BlobResourceContents{
+			URI: uri, MIMEType: contentType, Blob: base64.StdEncoding.EncodeToString(rec.body.Bytes()),
+		}}, nil
+	}
+	return []mcplib.ResourceContents{mcplib.TextResourceContents{URI: uri, MIMEType: contentType, Text: rec.body.String()}}, nil
+}
+
+// resourceError turns an API error response into a resource read error.
+func resourceError(uri string, rec *apiResponse) error {
+	return fmt.Errorf("read %s failed (%d): %s", uri, rec.status, apiMessage(rec))
+}
@@ -5,12 +5,17 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/DavidRHerbert/koor/internal/audit"
 	"github.com/DavidRHerbert/koor/internal/contracts"
 	"github.com/DavidRHerbert/koor/internal/instances"
 	"github.com/DavidRHerbert/koor/internal/server/serverconfig"
 	"github.com/DavidRHerbert/koor/internal/specs"
+	"github.com/DavidRHerbert/koor/internal/tasks"
 	mcplib "github.com/mark3labs/mcp-go/mcp"
 	mcpserver "github.com/mark3labs/mcp-go/server"
 )
@@ -19,11 +24,29 @@ import (
 type Transport struct {
 	registry *instances.Registry
 	specReg  *specs.Registry
+	tasks    *tasks.Store
+	audit    *audit.Log
 	config   serverconfig.Endpoints
+	server   *mcpserver.MCPServer
 	handler  http.Handler
+	api      http.Handler // REST API behind the task and data tools and resources; nil until enabled
+
+	statePrefixes []string // state keys readable as resources
+}
+
+// SetTasks attaches the task queue find_agent_for counts open tasks in.
+func (t *Transport) SetTasks(ts *tasks.Store) {
+	t.tasks = ts
+}
+
+// SetAudit attaches the audit log that records rule proposals and
+// auto-accept decisions made through MCP.
+func (t *Transport) SetAudit(a *audit.Log) {
+	t.audit = a
 }
 
-// New creates the MCP transport with 5 discovery/proposal tools.
+// New creates the MCP transport with its discovery, proposal, validation
+// and task tools.
 func New(registry *instances.Registry, specReg *specs.Registry, endpoints serverconfig.Endpoints) *Transport {
 	t := &Transport{
 		registry: registry,
@@ -89,7 +112,7 @@ func New(registry *instances.Registry, specReg *specs.Registry, endpoints server
 			mcplib.WithString("pattern", mcplib.Required(), mcplib.Description("Regex pattern or custom check name")),
 			mcplib.WithString("message", mcplib.Required(), mcplib.Description("Human-readable violation message")),
 			mcplib.WithString("severity", mcplib.Description("'error' or 'warning' (default: error)")),
-			mcplib.WithString("match_type", mcplib.Description("'regex', 'missing', or 'custom' (default: regex)")),
+			mcplib.WithString("match_type", mcplib.Description("'regex', 'missing', 'custom', or 'go-ast' (default: regex)")),
 			mcplib.WithString("stack", mcplib.Description("Technology stack this rule targets (empty = universal)")),
 			mcplib.WithString("proposed_by", mcplib.Description("Instance ID of the proposing agent")),
 			mcplib.WithString("context", mcplib.Description("Description of the issue that led to this rule")),
@@ -106,11 +129,51 @@ func New(registry *instances.Registry, specReg *specs.Registry, endpoints server
 			mcplib.WithString("endpoint", mcplib.Required(), mcplib.Description("Endpoint key (e.g. 'POST /api/trucks')")),
 			mcplib.WithString("direction", mcplib.Required(), mcplib.Description("'request', 'response', 'query', or 'error'")),
 			mcplib.WithString("payload", mcplib.Required(), mcplib.Description("JSON payload to validate (as a string)")),
+			mcplib.WithString("status", mcplib.Description("HTTP status code of the response (e.g. '404'), selects the matching response variant")),
 		),
 		t.handleValidateContract,
 	)
 
-	streamable := mcpserver.NewStreamableHTTPServer(srv)
+	// Tool 7: claim_task
+	srv.AddTool(
+		mcplib.NewTool("claim_task",
+			mcplib.WithDescription("Claim the next task for this agent from a project's task queue. Without a queue, claims from the agent's role queue (e.g. 'backend' for 'Truck-Wash-backend') and the project's shared queue. Complete or fail the task before the visibility timeout expires, or it is handed to another agent."),
+			mcplib.WithString("project", mcplib.Required(), mcplib.Description("Project name (e.g. 'Truck-Wash')")),
+			mcplib.WithString("instance_id", mcplib.Required(), mcplib.Description("Instance ID from register_instance")),
+			mcplib.WithString("queue", mcplib.Description("Queue to claim from (default: the agent's role and the shared queue)")),
+			mcplib.WithString("visibility_timeout", mcplib.Description("How long the claim holds, e.g. '15m' (default: 30m)")),
+		),
+		t.handleClaimTask,
+	)
+
+	// Tool 8: complete_task
+	srv.AddTool(
+		mcplib.NewTool("complete_task",
+			mcplib.WithDescription("Mark a task you claimed as done, with an optional JSON result."),
+			mcplib.WithString("task_id", mcplib.Required(), mcplib.Description("Task ID from claim_task")),
+			mcplib.WithString("instance_id", mcplib.Required(), mcplib.Description("Instance ID that claimed the task")),
+			mcplib.WithString("result", mcplib.Description("JSON result (as a string), e.g. '{\"pr\": 42}'")),
+		),
+		t.handleCompleteTask,
+	)
+
+	// Tool 9: find_agent_for
+	srv.AddTool(
+		mcplib.NewTool("find_agent_for",
+			mcplib.WithDescription("Find the best agents for a piece of work. Returns active instances with the required capabilities, ranked by liveness, open task count and how their current intent relates to the work, with the reasons for each score."),
+			mcplib.WithString("capabilities", mcplib.Description("Required capabilities (comma-separated)")),
+			mcplib.WithString("stack", mcplib.Description("Required technology stack")),
+			mcplib.WithString("project", mcplib.Description("Required project")),
+			mcplib.WithString("prefer", mcplib.Description("Preferred capabilities (comma-separated)")),
+			mcplib.WithString("description", mcplib.Description("What the work is about, compared with each agent's current intent")),
+			mcplib.WithString("max_open_tasks", mcplib.Description("Skip agents holding more claimed tasks than this")),
+			mcplib.WithString("limit", mcplib.Description("Maximum candidates to return (default 5)")),
+		),
+		t.handleFindAgentFor,
+	)
+
+	t.server = srv
+	streamable := mcpserver.NewStreamableHTTPServer(srv, mcpserver.WithHTTPContextFunc(withAuthorization))
 	t.handler = streamable
 
 	return t
@@ -240,6 +303,10 @@ func (t *Transport) handleGetEndpoints(ctx context.Context, req mcplib.CallToolR
 			"rules_export":      "GET /api/rules/export",
 			"rules_import":      "POST /api/rules/import",
 			"instance_activate": "POST /api/instances/{id}/activate",
+			"tasks_list":        "GET /api/tasks",
+			"task_claim":        "POST /api/tasks/claim",
+			"task_complete":     "POST /api/tasks/{id}/complete",
+			"task_fail":         "POST /api/tasks/{id}/fail",
 		},
 		"cli": map[string]string{
 			"install": "go install github.com/DavidRHerbert/koor/cmd/koor-cli@latest",
@@ -282,13 +349,36 @@ func (t *Transport) handleProposeRule(ctx context.Context, req mcplib.CallToolRe
 	if err := t.specReg.ProposeRule(ctx, rule); err != nil {
 		return mcplib.NewToolResultError(fmt.Sprintf("propose rule failed: %v", err)), nil
 	}
+	resource := project + "/" + ruleID
+	if t.audit != nil {
+		t.audit.Append(ctx, rule.ProposedBy, "rule.propose", resource, "{}", "success")
+	}
 
-	data, _ := json.MarshalIndent(map[string]any{
+	result := map[string]any{
 		"project": project,
 		"rule_id": ruleID,
 		"status":  "proposed",
 		"message": "Rule proposed successfully. It will be reviewed by the user before activation.",
-	}, "", "  ")
+	}
+	decision, err := t.specReg.AutoAccept(ctx, project, ruleID)
+	if err == nil && decision != nil {
+		result["auto_accept"] = decision
+		if decision.Accepted {
+			result["status"] = "accepted"
+			result["message"] = "Rule accepted by the project's auto-accept policy and is now active."
+		}
+		if t.audit != nil {
+			outcome := "queued"
+			if decision.Accepted {
+				outcome = "success"
+			}
+			t.audit.Append(ctx, "auto-accept", "rule.auto_accept", resource, audit.DetailJSON(map[string]any{
+				"proposed_by": rule.ProposedBy, "reason": decision.Reason, "prior_accepted": decision.PriorAccepted,
+			}), outcome)
+		}
+	}
+
+	data, _ := json.MarshalIndent(result, "", "  ")
 
 	return mcplib.NewToolResultText(string(data)), nil
 }
@@ -325,17 +415,160 @@ func (t *Transport) handleValidateContract(ctx context.Context, req mcplib.CallT
 		payload = map[string]any{}
 	}
 
-	violations := contracts.ValidatePayload(contract, endpoint, direction, payload)
+	var violations []contracts.Violation
+	if status, _ := strconv.Atoi(getArg(req, "status")); direction == "response" && status != 0 {
+		violations = contracts.ValidateResponse(contract, endpoint, status, payload)
+	} else {
+		violations = contracts.ValidatePayload(contract, endpoint, direction, payload)
+	}
 	if violations == nil {
 		violations = []contracts.Violation{}
 	}
+	warnings := contracts.DeprecationWarnings(contract, endpoint, direction, payload)
+	if warnings == nil {
+		warnings = []contracts.Warning{}
+	}
 
 	data, _ := json.MarshalIndent(map[string]any{
 		"valid":      len(violations) == 0,
 		"endpoint":   endpoint,
 		"direction":  direction,
 		"violations": violations,
+		"warnings":   warnings,
 	}, "", "  ")
 
 	return mcplib.NewToolResultText(string(data)), nil
 }
+
+// handleClaimTask claims through POST /api/tasks/claim with the caller's
+// token, so the tasks:work scope, the token's instance and project apply
+// as they do over REST.
+func (t *Transport) handleClaimTask(ctx context.Context, req mcplib.CallToolRequest) (*mcplib.CallToolResult, error) {
+	if t.api == nil {
+		return mcplib.NewToolResultError("task queue not configured"), nil
+	}
+	project := getArg(req, "project")
+	instanceID := getArg(req, "instance_id")
+	if project == "" || instanceID == "" {
+		return mcplib.NewToolResultError("project and instance_id are required"), nil
+	}
+	body, _ := json.Marshal(map[string]string{
+		"project":            project,
+		"queue":              getArg(req, "queue"),
+		"instance_id":        instanceID,
+		"visibility_timeout": getArg(req, "visibility_timeout"),
+	})
+	rec := t.serveAPI(ctx, http.MethodPost, "/api/tasks/claim", body, map[string]string{
+		"Content-Type": "application/json",
+	})
+	if rec.status == http.StatusNoContent {
+		return mcplib.NewToolResultText(`{"task": null, "message": "No task available."}`), nil
+	}
+	if rec.status != http.StatusOK {
+		return apiError("claim task", rec), nil
+	}
+	var task tasks.Task
+	if err := json.Unmarshal(rec.body.Bytes(), &task); err != nil {
+		return mcplib.NewToolResultError(fmt.Sprintf("claim task failed: %v", err)), nil
+	}
+
+	data, _ := json.MarshalIndent(map[string]any{
+		"task":    task,
+		"message": "Task claimed until " + task.ClaimedUntil.Format(time.RFC3339) + ". Call complete_task when done, or fail it via POST /api/tasks/" + task.ID + "/fail.",
+	}, "", "  ")
+
+	return mcplib.NewToolResultText(string(data)), nil
+}
+
+// handleCompleteTask completes through POST /api/tasks/{id}/complete with
+// the caller's token.
+func (t *Transport) handleCompleteTask(ctx context.Context, req mcplib.CallToolRequest) (*mcplib.CallToolResult, error) {
+	if t.api == nil {
+		return mcplib.NewToolResultError("task queue not configured"), nil
+	}
+	taskID := getArg(req, "task_id")
+	instanceID := getArg(req, "instance_id")
+	if taskID == "" || instanceID == "" {
+		return mcplib.NewToolResultError("task_id and instance_id are required"), nil
+	}
+	payload := map[string]any{"instance_id": instanceID}
+	if result := getArg(req, "result"); result != "" {
+		if !json.Valid([]byte(result)) {
+			return mcplib.NewToolResultError("result must be valid JSON"), nil
+		}
+		payload["result"] = json.RawMessage(result)
+	}
+	body, _ := json.Marshal(payload)
+	rec := t.serveAPI(ctx, http.MethodPost, "/api/tasks/"+url.PathEscape(taskID)+"/complete", body, map[string]string{
+		"Content-Type": "application/json",
+	})
+	if rec.status != http.StatusOK {
+		return apiError("complete task", rec), nil
+	}
+
+	data, _ := json.MarshalIndent(map[string]any{
+		"task":    json.RawMessage(rec.body.Bytes()),
+		"message": "Task completed.",
+	}, "", "  ")
+
+	return mcplib.NewToolResultText(string(data)), nil
+}
+
+func (t *Transport) handleFindAgentFor(ctx context.Context, req mcplib.CallToolRequest) (*mcplib.CallToolResult, error) {
+	match := instances.MatchRequest{
+		Capabilities: splitArg(getArg(req, "capabilities")),
+		Stack:        getArg(req, "stack"),
+		Project:      getArg(req, "project"),
+		Prefer:       splitArg(getArg(req, "prefer")),
+		Description:  getArg(req, "description"),
+	}
+	if v := getArg(req, "max_open_tasks"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return mcplib.NewToolResultError("max_open_tasks must be a non-negative number"), nil
+		}
+		match.MaxOpenTasks = &n
+	}
+	if v := getArg(req, "limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 50 {
+			return mcplib.NewToolResultError("limit must be between 1 and 50"), nil
+		}
+		match.Limit = n
+	}
+
+	list, err := t.registry.List(ctx)
+	if err != nil {
+		return mcplib.NewToolResultError(fmt.Sprintf("list instances failed: %v", err)), nil
+	}
+	var open map[string]int
+	if t.tasks != nil {
+		if open, err = t.tasks.ClaimCounts(ctx); err != nil {
+			return mcplib.NewToolResultError(fmt.Sprintf("count open tasks failed: %v", err)), nil
+		}
+	}
+	candidates := instances.Match(list, match, open, time.Now())
+
+	message := "No active agent matches. Relax the requirements or check discover_instances."
+	if len(candidates) > 0 {
+		message = "Best match: " + candidates[0].Instance.Name + " (" + candidates[0].Instance.ID + "). Send it the work with a message or a task."
+	}
+	data, _ := json.MarshalIndent(map[string]any{
+		"count":      len(candidates),
+		"candidates": candidates,
+		"message":    message,
+	}, "", "  ")
+
+	return mcplib.NewToolResultText(string(data)), nil
+}
+
+// splitArg splits a comma-separated argument, dropping empty items.
+func splitArg(v string) []string {
+	var out []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
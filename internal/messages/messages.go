@@ -0,0 +1,193 @@
+// Package messages is a direct agent-to-agent inbox.
+//
+// A message is addressed to one instance, or to a capability, in which case
+// every active instance holding it gets its own copy. Messages stay unread
+// in the recipient's inbox until it acknowledges them. Each delivery is
+// published as a "message.{recipient}" event, so an agent can subscribe to
+// its own inbox instead of polling it.
+package messages
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/DavidRHerbert/koor/internal/events"
+	"github.com/google/uuid"
+)
+
+// ErrNotRecipient is returned when acknowledging a message addressed to
+// another instance.
+var ErrNotRecipient = errors.New("message is not addressed to this instance")
+
+// Message is one delivered message.
+type Message struct {
+	ID         string          `json:"id"`
+	From       string          `json:"from,omitempty"` // sending instance or actor
+	To         string          `json:"to"`             // recipient instance
+	Capability string          `json:"capability,omitempty"`
+	Subject    string          `json:"subject,omitempty"`
+	Body       json.RawMessage `json:"body,omitempty"`
+	ReplyTo    string          `json:"reply_to,omitempty"`
+	Read       bool            `json:"read"`
+	ReadAt     *time.Time      `json:"read_at,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+// Store persists messages in SQLite and publishes their delivery.
+type Store struct {
+	db  *sql.DB
+	bus *events.Bus
+}
+
+// New creates a new message Store. bus may be nil, in which case no events
+// are published.
+func New(db *sql.DB, bus *events.Bus) *Store {
+	return &Store{db: db, bus: bus}
+}
+
+// Send delivers a copy of m to each recipient and returns the copies.
+func (s *Store) Send(ctx context.Context, m Message, recipients []string) ([]Message, error) {
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("no recipients")
+	}
+	if m.Subject == "" && len(m.Body) == 0 {
+		return nil, fmt.Errorf("subject or body is required")
+	}
+	body := "null"
+	if len(m.Body) > 0 {
+		if !json.Valid(m.Body) {
+			return nil, fmt.Errorf("body: invalid JSON")
+		}
+		body = string(m.Body)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+	ids := make([]string, 0, len(recipients))
+	for _, to := range recipients {
+		id := uuid.New().String()
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO messages (id, sender, recipient, capability, subject, body, reply_to)
+			 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			id, m.From, to, m.Capability, m.Subject, body, m.ReplyTo); err != nil {
+			return nil, fmt.Errorf("insert message: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	out := make([]Message, 0, len(ids))
+	for _, id := range ids {
+		msg, err := s.Get(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if s.bus != nil {
+			data, _ := json.Marshal(msg)
+			s.bus.Publish(ctx, "message."+msg.To, data, "messages")
+		}
+		out = append(out, *msg)
+	}
+	return out, nil
+}
+
+const messageColumns = `id, sender, recipient, capability, subject, body, reply_to, read_at, created_at`
+
+func scanMessage(row interface{ Scan(...any) error }) (*Message, error) {
+	var m Message
+	var body string
+	var readAt sql.NullTime
+	if err := row.Scan(&m.ID, &m.From, &m.To, &m.Capability, &m.Subject, &body, &m.ReplyTo,
+		&readAt, &m.CreatedAt); err != nil {
+		return nil, err
+	}
+	if body != "null" {
+		m.Body = json.RawMessage(body)
+	}
+	if readAt.Valid {
+		m.Read = true
+		m.ReadAt = &readAt.Time
+	}
+	return &m, nil
+}
+
+// Get returns a message by ID. Returns sql.ErrNoRows if not found.
+func (s *Store) Get(ctx context.Context, id string) (*Message, error) {
+	return scanMessage(s.db.QueryRowContext(ctx, `SELECT `+messageColumns+` FROM messages WHERE id = ?`, id))
+}
+
+// Inbox returns the messages delivered to an instance, oldest first.
+// With unreadOnly, acknowledged messages are left out.
+func (s *Store) Inbox(ctx context.Context, instanceID string, unreadOnly bool, limit int) ([]Message, error) {
+	query := `SELECT ` + messageColumns + ` FROM messages WHERE recipient = ?`
+	if unreadOnly {
+		query += ` AND read_at IS NULL`
+	}
+	query += ` ORDER BY rowid`
+	args := []any{instanceID}
+	if limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, limit)
+	}
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query inbox: %w", err)
+	}
+	defer rows.Close()
+
+	var out []Message
+	for rows.Next() {
+		m, err := scanMessage(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan message: %w", err)
+		}
+		out = append(out, *m)
+	}
+	return out, rows.Err()
+}
+
+// Unread counts the unacknowledged messages of an instance.
+func (s *Store) Unread(ctx context.Context, instanceID string) (int, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM messages WHERE recipient = ? AND read_at IS NULL`, instanceID).Scan(&n)
+	return n, err
+}
+
+// Ack marks a message read. instanceID must be the recipient; an empty
+// instanceID (an operator rather than an agent) may acknowledge any
+// message. Acknowledging twice keeps the first read time.
+func (s *Store) Ack(ctx context.Context, id, instanceID string) (*Message, error) {
+	m, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if instanceID != "" && m.To != instanceID {
+		return nil, ErrNotRecipient
+	}
+	if _, err := s.db.ExecContext(ctx,
+		`UPDATE messages SET read_at = datetime('now') WHERE id = ? AND read_at IS NULL`, id); err != nil {
+		return nil, fmt.Errorf("ack message: %w", err)
+	}
+	return s.Get(ctx, id)
+}
+
+// DeleteInbox removes every message delivered to an instance and returns
+// how many there were.
+func (s *Store) DeleteInbox(ctx context.Context, instanceID string) (int, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM messages WHERE recipient = ?`, instanceID)
+	if err != nil {
+		return 0, fmt.Errorf("delete inbox: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
@@ -0,0 +1,87 @@
+package messages_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/DavidRHerbert/koor/internal/db"
+	"github.com/DavidRHerbert/koor/internal/events"
+	"github.com/DavidRHerbert/koor/internal/messages"
+)
+
+func testStore(t *testing.T) (*messages.Store, *events.Bus) {
+	t.Helper()
+	database, err := db.OpenMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	bus := events.New(database, 100)
+	return messages.New(database, bus), bus
+}
+
+func TestSendAndInbox(t *testing.T) {
+	s, bus := testStore(t)
+	ctx := context.Background()
+	sub := bus.Subscribe("message.*")
+	defer bus.Unsubscribe(sub)
+
+	sent, err := s.Send(ctx, messages.Message{From: "lead", Capability: "go", Subject: "review",
+		Body: json.RawMessage(`{"pr":42}`)}, []string{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sent) != 2 || sent[0].To != "a" || sent[1].To != "b" || sent[0].ID == sent[1].ID {
+		t.Fatalf("expected one copy per recipient, got %+v", sent)
+	}
+	if n := len(sub.Ch); n != 2 {
+		t.Errorf("expected 2 message events, got %d", n)
+	}
+	s.Send(ctx, messages.Message{From: "lead", Subject: "second"}, []string{"a"})
+
+	inbox, err := s.Inbox(ctx, "a", true, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inbox) != 2 || inbox[0].Subject != "review" || string(inbox[0].Body) != `{"pr":42}` || inbox[0].Read {
+		t.Fatalf("unexpected inbox: %+v", inbox)
+	}
+
+	if _, err := s.Ack(ctx, inbox[0].ID, "b"); !errors.Is(err, messages.ErrNotRecipient) {
+		t.Errorf("expected ErrNotRecipient, got %v", err)
+	}
+	acked, err := s.Ack(ctx, inbox[0].ID, "a")
+	if err != nil || !acked.Read || acked.ReadAt == nil {
+		t.Fatalf("ack: %+v, %v", acked, err)
+	}
+	if n, _ := s.Unread(ctx, "a"); n != 1 {
+		t.Errorf("expected 1 unread, got %d", n)
+	}
+	if all, _ := s.Inbox(ctx, "a", false, 0); len(all) != 2 {
+		t.Errorf("expected 2 messages including read, got %d", len(all))
+	}
+	if _, err := s.Ack(ctx, "missing", ""); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected ErrNoRows, got %v", err)
+	}
+}
+
+func TestSendValidation(t *testing.T) {
+	s, _ := testStore(t)
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		msg messages.Message
+		to  []string
+	}{
+		{messages.Message{Subject: "x"}, nil},
+		{messages.Message{}, []string{"a"}},
+		{messages.Message{Body: json.RawMessage(`{bad`)}, []string{"a"}},
+	} {
+		if _, err := s.Send(ctx, tc.msg, tc.to); err == nil {
+			t.Errorf("expected %+v to %v to fail", tc.msg, tc.to)
+		}
+	}
+}
@@ -0,0 +1,293 @@
+// Package milestones tracks project milestones and computes their progress
+// from the event history.
+//
+// A milestone links tasks and event topics. A task is complete once a
+// "{project}.*.done" event carries it as "task" or "feature" in its data;
+// an event topic (a glob) is complete once a matching event is published.
+// Only events published after the milestone was created count.
+package milestones
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Milestone is a dated goal within a project.
+type Milestone struct {
+	ID          string     `json:"id"`
+	Project     string     `json:"project"`
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	Due         *time.Time `json:"due,omitempty"`
+	Tasks       []string   `json:"tasks"`
+	Events      []string   `json:"events"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// Item is one linked task or event topic and whether it is complete.
+type Item struct {
+	Kind    string     `json:"kind"` // "task" or "event"
+	Name    string     `json:"name"`
+	Done    bool       `json:"done"`
+	DoneAt  *time.Time `json:"done_at,omitempty"`
+	EventID int64      `json:"event_id,omitempty"`
+}
+
+// Point is one day of a burn-down chart.
+type Point struct {
+	Date      string  `json:"date"`
+	Remaining int     `json:"remaining"`
+	Ideal     float64 `json:"ideal"`
+}
+
+// Progress is a milestone with its computed completion.
+type Progress struct {
+	Milestone
+	Items     []Item  `json:"items"`
+	Completed int     `json:"completed"`
+	Total     int     `json:"total"`
+	Percent   float64 `json:"percent"`
+	Overdue   bool    `json:"overdue"`
+	Burndown  []Point `json:"burndown,omitempty"`
+}
+
+// maxBurndownDays caps the length of a burn-down series.
+const maxBurndownDays = 180
+
+// Store persists milestones in SQLite.
+type Store struct {
+	db *sql.DB
+}
+
+// New creates a new milestone Store.
+func New(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+// Create stores a new milestone and assigns it an ID.
+func (s *Store) Create(ctx context.Context, m Milestone) (*Milestone, error) {
+	if m.Name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	if len(m.Tasks) == 0 && len(m.Events) == 0 {
+		return nil, fmt.Errorf("at least one task or event is required")
+	}
+	m.ID = uuid.New().String()
+	tasksJSON, _ := json.Marshal(nonNil(m.Tasks))
+	eventsJSON, _ := json.Marshal(nonNil(m.Events))
+	var due any
+	if m.Due != nil {
+		due = m.Due.UTC().Format("2006-01-02 15:04:05")
+	}
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO milestones (id, project, name, description, due, tasks, events, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, datetime('now'))`,
+		m.ID, m.Project, m.Name, m.Description, due, string(tasksJSON), string(eventsJSON))
+	if err != nil {
+		return nil, fmt.Errorf("insert milestone: %w", err)
+	}
+	return s.Get(ctx, m.Project, m.ID)
+}
+
+// Get returns a milestone by project and ID. Returns sql.ErrNoRows if not found.
+func (s *Store) Get(ctx context.Context, project, id string) (*Milestone, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, project, name, description, due, tasks, events, created_at
+		 FROM milestones WHERE project = ? AND id = ?`, project, id)
+	if err != nil {
+		return nil, fmt.Errorf("query milestone: %w", err)
+	}
+	list, err := scanMilestones(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &list[0], nil
+}
+
+// List returns a project's milestones ordered by due date, or every
+// project's milestones when project is empty.
+func (s *Store) List(ctx context.Context, project string) ([]Milestone, error) {
+	query := `SELECT id, project, name, description, due, tasks, events, created_at FROM milestones`
+	args := []any{}
+	if project != "" {
+		query += ` WHERE project = ?`
+		args = append(args, project)
+	}
+	query += ` ORDER BY due IS NULL, due, created_at`
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query milestones: %w", err)
+	}
+	return scanMilestones(rows)
+}
+
+// Delete removes a milestone. Returns sql.ErrNoRows if not found.
+func (s *Store) Delete(ctx context.Context, project, id string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM milestones WHERE project = ? AND id = ?`, project, id)
+	if err != nil {
+		return fmt.Errorf("delete milestone: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func scanMilestones(rows *sql.Rows) ([]Milestone, error) {
+	defer rows.Close()
+	var list []Milestone
+	for rows.Next() {
+		var m Milestone
+		var due sql.NullTime
+		var tasks, evs string
+		if err := rows.Scan(&m.ID, &m.Project, &m.Name, &m.Description, &due, &tasks, &evs, &m.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan milestone: %w", err)
+		}
+		if due.Valid {
+			m.Due = &due.Time
+		}
+		json.Unmarshal([]byte(tasks), &m.Tasks)
+		json.Unmarshal([]byte(evs), &m.Events)
+		m.Tasks = nonNil(m.Tasks)
+		m.Events = nonNil(m.Events)
+		list = append(list, m)
+	}
+	return list, rows.Err()
+}
+
+// Progress computes a milestone's completion from the project's events.
+// With burndown set it also builds a daily remaining-items series.
+func (s *Store) Progress(ctx context.Context, m Milestone, burndown bool) (*Progress, error) {
+	slug := strings.ToLower(m.Project)
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, topic, data, created_at FROM events
+		 WHERE topic LIKE ? AND created_at >= ? ORDER BY id`,
+		slug+".%", m.CreatedAt.UTC().Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return nil, fmt.Errorf("query events: %w", err)
+	}
+	defer rows.Close()
+
+	p := &Progress{Milestone: m}
+	for _, t := range m.Tasks {
+		p.Items = append(p.Items, Item{Kind: "task", Name: t})
+	}
+	for _, e := range m.Events {
+		p.Items = append(p.Items, Item{Kind: "event", Name: e})
+	}
+
+	for rows.Next() {
+		var id int64
+		var topic string
+		var data []byte
+		var at time.Time
+		if err := rows.Scan(&id, &topic, &data, &at); err != nil {
+			return nil, fmt.Errorf("scan event: %w", err)
+		}
+		var done struct {
+			Task    string `json:"task"`
+			Feature string `json:"feature"`
+		}
+		if strings.HasSuffix(topic, ".done") {
+			json.Unmarshal(data, &done)
+		}
+		for i := range p.Items {
+			it := &p.Items[i]
+			if it.Done {
+				continue
+			}
+			var hit bool
+			if it.Kind == "task" {
+				hit = strings.HasSuffix(topic, ".done") && (done.Task == it.Name || done.Feature == it.Name)
+			} else {
+				hit, _ = path.Match(it.Name, topic)
+			}
+			if hit {
+				at := at
+				it.Done, it.DoneAt, it.EventID = true, &at, id
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	p.Total = len(p.Items)
+	for _, it := range p.Items {
+		if it.Done {
+			p.Completed++
+		}
+	}
+	if p.Total > 0 {
+		p.Percent = float64(p.Completed) * 100 / float64(p.Total)
+	}
+	now := time.Now().UTC()
+	p.Overdue = m.Due != nil && now.After(*m.Due) && p.Completed < p.Total
+	if burndown {
+		p.Burndown = buildBurndown(p, now)
+	}
+	return p, nil
+}
+
+// buildBurndown returns one point per day from creation to today (or the
+// due date, if later). Ideal falls linearly from the total to zero at the due
+// date; without a due date it stays at the total.
+func buildBurndown(p *Progress, now time.Time) []Point {
+	day := func(t time.Time) time.Time {
+		t = t.UTC()
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	start := day(p.CreatedAt)
+	end := day(now)
+	if p.Due != nil && day(*p.Due).After(end) {
+		end = day(*p.Due)
+	}
+	if days := int(end.Sub(start).Hours() / 24); days > maxBurndownDays {
+		start = end.AddDate(0, 0, -maxBurndownDays)
+	}
+
+	var span float64
+	if p.Due != nil {
+		span = day(*p.Due).Sub(day(p.CreatedAt)).Hours() / 24
+	}
+
+	var points []Point
+	for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+		remaining := p.Total
+		if !d.After(day(now)) {
+			for _, it := range p.Items {
+				if it.Done && !day(*it.DoneAt).After(d) {
+					remaining--
+				}
+			}
+		}
+		ideal := float64(p.Total)
+		if span > 0 {
+			elapsed := d.Sub(day(p.CreatedAt)).Hours() / 24
+			ideal = float64(p.Total) * (1 - elapsed/span)
+			if ideal < 0 {
+				ideal = 0
+			}
+		}
+		points = append(points, Point{Date: d.Format("2006-01-02"), Remaining: remaining, Ideal: ideal})
+	}
+	return points
+}
+
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
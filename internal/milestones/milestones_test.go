@@ -0,0 +1,74 @@
+package milestones_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DavidRHerbert/koor/internal/db"
+	"github.com/DavidRHerbert/koor/internal/events"
+	"github.com/DavidRHerbert/koor/internal/milestones"
+)
+
+func TestMilestoneProgress(t *testing.T) {
+	database, err := db.OpenMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+	ctx := context.Background()
+	store := milestones.New(database)
+	bus := events.New(database, 1000)
+
+	if _, err := store.Create(ctx, milestones.Milestone{Project: "Truck-Wash", Name: "empty"}); err == nil {
+		t.Error("expected error for milestone without tasks or events")
+	}
+
+	due := time.Now().Add(72 * time.Hour)
+	m, err := store.Create(ctx, milestones.Milestone{
+		Project: "Truck-Wash",
+		Name:    "MVP",
+		Due:     &due,
+		Tasks:   []string{"login", "trucks-crud"},
+		Events:  []string{"truck-wash.deploy.*"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bus.Publish(ctx, "truck-wash.frontend.done", json.RawMessage(`{"feature":"login"}`), "")
+	bus.Publish(ctx, "truck-wash.backend.done", json.RawMessage(`{"task":"something-else"}`), "")
+	bus.Publish(ctx, "other.backend.done", json.RawMessage(`{"task":"trucks-crud"}`), "")
+	bus.Publish(ctx, "truck-wash.deploy.staging", json.RawMessage(`{}`), "")
+
+	p, err := store.Progress(ctx, *m, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Total != 3 || p.Completed != 2 {
+		t.Errorf("expected 2/3 complete, got %d/%d: %+v", p.Completed, p.Total, p.Items)
+	}
+	if p.Overdue {
+		t.Error("milestone due in the future should not be overdue")
+	}
+	if len(p.Burndown) != 4 {
+		t.Fatalf("expected 4 burndown days (today + 3), got %d", len(p.Burndown))
+	}
+	if p.Burndown[0].Remaining != 1 || p.Burndown[0].Ideal != 3 {
+		t.Errorf("unexpected first burndown point: %+v", p.Burndown[0])
+	}
+
+	list, _ := store.List(ctx, "Truck-Wash")
+	if len(list) != 1 || list[0].Due == nil {
+		t.Errorf("unexpected list: %+v", list)
+	}
+	if err := store.Delete(ctx, "Truck-Wash", m.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get(ctx, "Truck-Wash", m.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected ErrNoRows after delete, got %v", err)
+	}
+}
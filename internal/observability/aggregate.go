@@ -0,0 +1,159 @@
+package observability
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AggregateQuery selects the hourly metric buckets to aggregate and how.
+// Each bucket (one instance, one metric, one hour) is a sample; GroupBy
+// decides which samples are aggregated together, per metric:
+//
+//	""          all matching samples
+//	"hour"      samples from the same hour, i.e. across agents
+//	"day"       samples from the same day
+//	"instance"  samples from the same agent, i.e. across hours
+type AggregateQuery struct {
+	InstanceID string
+	Metric     string
+	Period     string    // period prefix, as in QueryAll
+	Since      time.Time // zero means no lower bound
+	GroupBy    string
+	Funcs      []string // sum, avg, min, max, or pNN for a percentile
+}
+
+// Aggregate is the result for one group and metric. Values holds one
+// entry per requested function.
+type Aggregate struct {
+	Group      string             `json:"group,omitempty"`
+	MetricName string             `json:"metric_name"`
+	Samples    int                `json:"samples"`
+	Values     map[string]float64 `json:"values"`
+}
+
+// ValidateAggregate checks the grouping and functions of q.
+func ValidateAggregate(q AggregateQuery) error {
+	switch q.GroupBy {
+	case "", "hour", "day", "instance":
+	default:
+		return fmt.Errorf("group_by must be hour, day or instance")
+	}
+	if len(q.Funcs) == 0 {
+		return fmt.Errorf("at least one aggregate is required")
+	}
+	for _, fn := range q.Funcs {
+		if _, ok := percentile(fn); ok {
+			continue
+		}
+		switch fn {
+		case "sum", "avg", "min", "max":
+		default:
+			return fmt.Errorf("unknown aggregate %q (use sum, avg, min, max or p1-p100)", fn)
+		}
+	}
+	return nil
+}
+
+// percentile parses "p95" as 95.
+func percentile(fn string) (float64, bool) {
+	if !strings.HasPrefix(fn, "p") {
+		return 0, false
+	}
+	p, err := strconv.ParseFloat(fn[1:], 64)
+	if err != nil || p <= 0 || p > 100 {
+		return 0, false
+	}
+	return p, true
+}
+
+// Aggregate computes q.Funcs over the matching hourly buckets, per group
+// and metric. Groups of time come out oldest first; percentiles use the
+// nearest-rank method.
+func (s *Store) Aggregate(ctx context.Context, q AggregateQuery) ([]Aggregate, error) {
+	if err := ValidateAggregate(q); err != nil {
+		return nil, err
+	}
+	query := `SELECT instance_id, metric_name, metric_value, period FROM agent_metrics WHERE 1=1`
+	args := []any{}
+	if q.InstanceID != "" {
+		query += ` AND instance_id = ?`
+		args = append(args, q.InstanceID)
+	}
+	if q.Metric != "" {
+		query += ` AND metric_name = ?`
+		args = append(args, q.Metric)
+	}
+	if q.Period != "" {
+		query += ` AND period LIKE ?`
+		args = append(args, q.Period+"%")
+	}
+	if !q.Since.IsZero() {
+		query += ` AND period >= ?`
+		args = append(args, q.Since.UTC().Format("2006-01-02T15"))
+	}
+	rows, err := s.queryMetrics(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	type groupKey struct{ group, metric string }
+	samples := map[groupKey][]float64{}
+	for _, m := range rows {
+		var g string
+		switch q.GroupBy {
+		case "hour":
+			g = m.Period
+		case "day":
+			g = m.Period[:min(len(m.Period), 10)]
+		case "instance":
+			g = m.InstanceID
+		}
+		k := groupKey{g, m.MetricName}
+		samples[k] = append(samples[k], float64(m.MetricValue))
+	}
+
+	out := make([]Aggregate, 0, len(samples))
+	for k, values := range samples {
+		sort.Float64s(values)
+		a := Aggregate{Group: k.group, MetricName: k.metric, Samples: len(values), Values: map[string]float64{}}
+		for _, fn := range q.Funcs {
+			a.Values[fn] = aggregate(fn, values)
+		}
+		out = append(out, a)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Group != out[j].Group {
+			return out[i].Group < out[j].Group
+		}
+		return out[i].MetricName < out[j].MetricName
+	})
+	return out, nil
+}
+
+// aggregate applies fn to sorted, non-empty values.
+func aggregate(fn string, values []float64) float64 {
+	if p, ok := percentile(fn); ok {
+		rank := int(math.Ceil(p / 100 * float64(len(values))))
+		return values[max(rank, 1)-1]
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	switch fn {
+	case "sum":
+		return sum
+	case "avg":
+		return math.Round(sum/float64(len(values))*100) / 100
+	case "min":
+		return values[0]
+	case "max":
+		return values[len(values)-1]
+	}
+	return 0
+}
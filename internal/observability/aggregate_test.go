@@ -0,0 +1,81 @@
+package observability_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DavidRHerbert/koor/internal/db"
+	"github.com/DavidRHerbert/koor/internal/observability"
+)
+
+func TestAggregate(t *testing.T) {
+	database, err := db.OpenMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	s := observability.New(database)
+	ctx := context.Background()
+
+	// rest_calls per agent and hour.
+	for _, m := range []struct {
+		id, period string
+		value      int64
+	}{
+		{"a", "2026-02-16T10", 10},
+		{"b", "2026-02-16T10", 30},
+		{"a", "2026-02-16T11", 20},
+		{"b", "2026-02-16T11", 40},
+		{"c", "2026-02-16T11", 100},
+		{"a", "2026-02-17T09", 5},
+	} {
+		if _, err := database.Exec(`INSERT INTO agent_metrics (instance_id, metric_name, metric_value, period)
+			VALUES (?, 'rest_calls', ?, ?)`, m.id, m.value, m.period); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	aggs, err := s.Aggregate(ctx, observability.AggregateQuery{Funcs: []string{"sum", "p50", "p95", "max", "avg"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(aggs) != 1 || aggs[0].Samples != 6 {
+		t.Fatalf("expected one aggregate over 6 samples, got %+v", aggs)
+	}
+	want := map[string]float64{"sum": 205, "p50": 20, "p95": 100, "max": 100, "avg": 34.17}
+	for fn, v := range want {
+		if aggs[0].Values[fn] != v {
+			t.Errorf("%s: expected %v, got %v", fn, v, aggs[0].Values[fn])
+		}
+	}
+
+	aggs, err = s.Aggregate(ctx, observability.AggregateQuery{GroupBy: "hour", Period: "2026-02-16", Funcs: []string{"p50", "max"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(aggs) != 2 || aggs[0].Group != "2026-02-16T10" || aggs[1].Group != "2026-02-16T11" {
+		t.Fatalf("expected the two hours of 2026-02-16 in order, got %+v", aggs)
+	}
+	if aggs[1].Values["p50"] != 40 || aggs[1].Values["max"] != 100 {
+		t.Errorf("unexpected 11:00 aggregate: %+v", aggs[1])
+	}
+
+	aggs, err = s.Aggregate(ctx, observability.AggregateQuery{GroupBy: "instance", Funcs: []string{"sum"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(aggs) != 3 || aggs[0].Group != "a" || aggs[0].Values["sum"] != 35 {
+		t.Errorf("expected per-instance sums, got %+v", aggs)
+	}
+
+	for _, q := range []observability.AggregateQuery{
+		{GroupBy: "week", Funcs: []string{"sum"}},
+		{Funcs: []string{"median"}},
+		{Funcs: []string{"p0"}},
+		{},
+	} {
+		if _, err := s.Aggregate(ctx, q); err == nil {
+			t.Errorf("expected error for %+v", q)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package observability
+
+import (
+	"context"
+	"fmt"
+)
+
+// Reset records a reset of the server's token tax counters and the values
+// they held when they were cleared.
+type Reset struct {
+	ID           int64  `json:"id"`
+	Actor        string `json:"actor"`
+	MCPCalls     int64  `json:"mcp_calls"`
+	MCPDataCalls int64  `json:"mcp_data_calls"`
+	RESTCalls    int64  `json:"rest_calls"`
+	ResetAt      string `json:"reset_at"`
+}
+
+// LoadCounters returns the server counters saved by SaveCounters, by name.
+func (s *Store) LoadCounters(ctx context.Context) (map[string]int64, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT name, value FROM server_counters`)
+	if err != nil {
+		return nil, fmt.Errorf("load counters: %w", err)
+	}
+	defer rows.Close()
+	counters := map[string]int64{}
+	for rows.Next() {
+		var name string
+		var value int64
+		if err := rows.Scan(&name, &value); err != nil {
+			return nil, fmt.Errorf("scan counter: %w", err)
+		}
+		counters[name] = value
+	}
+	return counters, rows.Err()
+}
+
+// SaveCounters stores the current values of the named server counters,
+// replacing the saved ones.
+func (s *Store) SaveCounters(ctx context.Context, counters map[string]int64) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("save counters: %w", err)
+	}
+	defer tx.Rollback()
+	for name, value := range counters {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO server_counters (name, value, updated_at) VALUES (?, ?, datetime('now'))
+			 ON CONFLICT(name) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at`,
+			name, value)
+		if err != nil {
+			return fmt.Errorf("save counter %s: %w", name, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("save counters: %w", err)
+	}
+	return nil
+}
+
+// RecordReset adds a reset to the history and zeroes the saved counters
+// in the same transaction.
+func (s *Store) RecordReset(ctx context.Context, r Reset) (*Reset, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("record reset: %w", err)
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx,
+		`INSERT INTO metrics_resets (actor, mcp_calls, mcp_data_calls, rest_calls) VALUES (?, ?, ?, ?)`,
+		r.Actor, r.MCPCalls, r.MCPDataCalls, r.RESTCalls)
+	if err != nil {
+		return nil, fmt.Errorf("record reset: %w", err)
+	}
+	r.ID, _ = res.LastInsertId()
+	if _, err := tx.ExecContext(ctx, `UPDATE server_counters SET value = 0, updated_at = datetime('now')`); err != nil {
+		return nil, fmt.Errorf("clear counters: %w", err)
+	}
+	if err := tx.QueryRowContext(ctx, `SELECT reset_at FROM metrics_resets WHERE id = ?`, r.ID).Scan(&r.ResetAt); err != nil {
+		return nil, fmt.Errorf("record reset: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("record reset: %w", err)
+	}
+	return &r, nil
+}
+
+// Resets returns the most recent counter resets, newest first.
+func (s *Store) Resets(ctx context.Context, limit int) ([]Reset, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, actor, mcp_calls, mcp_data_calls, rest_calls, reset_at
+		 FROM metrics_resets ORDER BY id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list resets: %w", err)
+	}
+	defer rows.Close()
+	resets := []Reset{}
+	for rows.Next() {
+		var r Reset
+		if err := rows.Scan(&r.ID, &r.Actor, &r.MCPCalls, &r.MCPDataCalls, &r.RESTCalls, &r.ResetAt); err != nil {
+			return nil, fmt.Errorf("scan reset: %w", err)
+		}
+		resets = append(resets, r)
+	}
+	return resets, rows.Err()
+}
@@ -56,6 +56,74 @@ func (s *Store) IncrementBy(ctx context.Context, instanceID, metricName string,
 	return nil
 }
 
+// AddAll adds each delta to its metric for the given instance in the
+// current hourly bucket, in one transaction. Zero deltas are skipped.
+func (s *Store) AddAll(ctx context.Context, instanceID string, deltas map[string]int64) error {
+	period := currentPeriod()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+	for name, delta := range deltas {
+		if delta == 0 {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO agent_metrics (instance_id, metric_name, metric_value, period)
+			 VALUES (?, ?, ?, ?)
+			 ON CONFLICT (instance_id, metric_name, period)
+			 DO UPDATE SET metric_value = agent_metrics.metric_value + ?`,
+			instanceID, name, delta, period, delta); err != nil {
+			return fmt.Errorf("add metric %s: %w", name, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// FailedSuffix names the counter of failures that RecordOutcome keeps next
+// to each outcome metric: "validations" and "validations.failed".
+const FailedSuffix = ".failed"
+
+// RecordOutcome counts one attempt of metric for an instance, and one
+// failure if failed is set.
+func (s *Store) RecordOutcome(ctx context.Context, instanceID, metric string, failed bool) error {
+	if err := s.Increment(ctx, instanceID, metric); err != nil {
+		return err
+	}
+	if failed {
+		return s.Increment(ctx, instanceID, metric+FailedSuffix)
+	}
+	return nil
+}
+
+// Outcomes returns an instance's attempts and failures of metric in the
+// hourly buckets from since onwards (the bucket containing since included).
+func (s *Store) Outcomes(ctx context.Context, instanceID, metric string, since time.Time) (total, failed int64, err error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT metric_name, SUM(metric_value) FROM agent_metrics
+		 WHERE instance_id = ? AND metric_name IN (?, ?) AND period >= ?
+		 GROUP BY metric_name`,
+		instanceID, metric, metric+FailedSuffix, since.UTC().Format("2006-01-02T15"))
+	if err != nil {
+		return 0, 0, fmt.Errorf("query outcomes: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		var sum int64
+		if err := rows.Scan(&name, &sum); err != nil {
+			return 0, 0, fmt.Errorf("scan outcomes: %w", err)
+		}
+		if name == metric {
+			total = sum
+		} else {
+			failed = sum
+		}
+	}
+	return total, failed, rows.Err()
+}
+
 // QueryAgent returns all metrics for a specific agent, optionally filtered by period prefix.
 // If period is empty, returns all periods. If period is e.g. "2026-02-16", returns all hours that day.
 func (s *Store) QueryAgent(ctx context.Context, instanceID, period string) ([]AgentMetric, error) {
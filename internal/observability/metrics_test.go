@@ -3,6 +3,7 @@ package observability_test
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/DavidRHerbert/koor/internal/db"
 	"github.com/DavidRHerbert/koor/internal/observability"
@@ -65,6 +66,32 @@ func TestIncrementBy(t *testing.T) {
 	}
 }
 
+func TestAddAll(t *testing.T) {
+	s := testStore(t)
+	ctx := context.Background()
+
+	deltas := map[string]int64{"rest_calls": 1, "rest_latency_ms": 12, "rest_errors": 0}
+	if err := s.AddAll(ctx, "agent-1", deltas); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddAll(ctx, "agent-1", deltas); err != nil {
+		t.Fatal(err)
+	}
+
+	metrics, err := s.QueryAgent(ctx, "agent-1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(metrics) != 2 {
+		t.Fatalf("expected 2 metrics (zero deltas skipped), got %d", len(metrics))
+	}
+	for _, m := range metrics {
+		if want := 2 * deltas[m.MetricName]; m.MetricValue != want {
+			t.Errorf("%s: expected %d, got %d", m.MetricName, want, m.MetricValue)
+		}
+	}
+}
+
 func TestQueryAll(t *testing.T) {
 	s := testStore(t)
 	ctx := context.Background()
@@ -128,3 +155,65 @@ func TestQueryAgentEmpty(t *testing.T) {
 		t.Errorf("expected nil for empty result, got %v", metrics)
 	}
 }
+
+func TestOutcomes(t *testing.T) {
+	s := testStore(t)
+	ctx := context.Background()
+
+	for i := 0; i < 4; i++ {
+		s.RecordOutcome(ctx, "agent-1", "validations", i == 0)
+	}
+	s.RecordOutcome(ctx, "agent-2", "validations", true)
+
+	total, failed, err := s.Outcomes(ctx, "agent-1", "validations", time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 4 || failed != 1 {
+		t.Errorf("expected 4 attempts and 1 failure, got %d and %d", total, failed)
+	}
+	total, _, _ = s.Outcomes(ctx, "agent-1", "validations", time.Now().Add(time.Hour))
+	if total != 0 {
+		t.Errorf("buckets before since should be excluded, got %d", total)
+	}
+}
+
+func TestCountersAndResets(t *testing.T) {
+	s := testStore(t)
+	ctx := context.Background()
+
+	if err := s.SaveCounters(ctx, map[string]int64{"mcp_calls": 4, "rest_calls": 10}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveCounters(ctx, map[string]int64{"rest_calls": 12}); err != nil {
+		t.Fatal(err)
+	}
+	counters, err := s.LoadCounters(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counters["mcp_calls"] != 4 || counters["rest_calls"] != 12 {
+		t.Errorf("counters = %v, want mcp_calls 4 and rest_calls 12", counters)
+	}
+
+	r, err := s.RecordReset(ctx, observability.Reset{Actor: "ops", MCPCalls: 4, RESTCalls: 12})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.ID == 0 || r.ResetAt == "" {
+		t.Errorf("reset = %+v, want an ID and time", r)
+	}
+	counters, _ = s.LoadCounters(ctx)
+	if counters["mcp_calls"] != 0 || counters["rest_calls"] != 0 {
+		t.Errorf("counters after reset = %v, want zeros", counters)
+	}
+
+	s.RecordReset(ctx, observability.Reset{Actor: "admin", RESTCalls: 1})
+	resets, err := s.Resets(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resets) != 2 || resets[0].Actor != "admin" || resets[1].RESTCalls != 12 {
+		t.Errorf("resets = %+v, want newest first", resets)
+	}
+}
@@ -0,0 +1,176 @@
+package observability
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PrometheusContentType is the media type of the Prometheus text exposition format.
+const PrometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// LatencyBuckets are the upper bounds, in seconds, of the request latency histogram.
+var LatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// PromWriter writes metric families in the Prometheus text exposition format.
+// The first write error is kept and returned by Err; later writes are no-ops.
+type PromWriter struct {
+	w   io.Writer
+	err error
+}
+
+// NewPromWriter returns a PromWriter that writes to w.
+func NewPromWriter(w io.Writer) *PromWriter {
+	return &PromWriter{w: w}
+}
+
+// Err returns the first error encountered while writing.
+func (p *PromWriter) Err() error {
+	return p.err
+}
+
+// Family writes the HELP and TYPE lines that precede a metric's samples.
+// typ is "counter", "gauge" or "histogram".
+func (p *PromWriter) Family(name, typ, help string) {
+	help = strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+	p.printf("# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// Sample writes one sample. labels alternate names and values and are
+// written in the order given.
+func (p *PromWriter) Sample(name string, value float64, labels ...string) {
+	p.printf("%s%s %s\n", name, formatLabels(labels), formatValue(value))
+}
+
+// Histogram writes the _bucket, _sum and _count samples of h.
+func (p *PromWriter) Histogram(name string, h *Histogram, labels ...string) {
+	var cumulative uint64
+	for i, le := range h.Bounds {
+		cumulative += h.Counts[i]
+		p.Sample(name+"_bucket", float64(cumulative), append(slices.Clip(labels), "le", formatValue(le))...)
+	}
+	p.Sample(name+"_bucket", float64(h.Count), append(slices.Clip(labels), "le", "+Inf")...)
+	p.Sample(name+"_sum", h.Sum, labels...)
+	p.Sample(name+"_count", float64(h.Count), labels...)
+}
+
+func (p *PromWriter) printf(format string, args ...any) {
+	if p.err != nil {
+		return
+	}
+	_, p.err = fmt.Fprintf(p.w, format, args...)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatLabels(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i+1 < len(labels); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(labels[i])
+		b.WriteString(`="`)
+		b.WriteString(labelEscaper.Replace(labels[i+1]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Histogram counts observations into buckets with fixed upper bounds.
+// Counts are per bucket, not cumulative. It is not safe for concurrent use.
+type Histogram struct {
+	Bounds []float64
+	Counts []uint64
+	Sum    float64
+	Count  uint64
+}
+
+// NewHistogram returns an empty histogram with the given ascending bucket bounds.
+func NewHistogram(bounds []float64) *Histogram {
+	return &Histogram{Bounds: bounds, Counts: make([]uint64, len(bounds))}
+}
+
+// Observe records one value.
+func (h *Histogram) Observe(v float64) {
+	if i, _ := slices.BinarySearch(h.Bounds, v); i < len(h.Bounds) {
+		h.Counts[i]++
+	}
+	h.Sum += v
+	h.Count++
+}
+
+// RouteKey identifies a route in RequestStats.
+type RouteKey struct {
+	Method string
+	Route  string // the mux pattern without its method, e.g. "/api/state/{key...}"
+}
+
+// RouteStats is the request count by status code and the latency
+// histogram of one route.
+type RouteStats struct {
+	Codes   map[int]uint64
+	Latency *Histogram
+}
+
+// RequestStats aggregates HTTP request counts and latencies by route. It is
+// safe for concurrent use.
+type RequestStats struct {
+	mu     sync.Mutex
+	routes map[RouteKey]*RouteStats
+}
+
+// NewRequestStats returns empty request statistics.
+func NewRequestStats() *RequestStats {
+	return &RequestStats{routes: map[RouteKey]*RouteStats{}}
+}
+
+// Observe records a request to route that finished with status after d.
+func (s *RequestStats) Observe(method, route string, status int, d time.Duration) {
+	key := RouteKey{Method: method, Route: route}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rs, ok := s.routes[key]
+	if !ok {
+		rs = &RouteStats{Codes: map[int]uint64{}, Latency: NewHistogram(LatencyBuckets)}
+		s.routes[key] = rs
+	}
+	rs.Codes[status]++
+	rs.Latency.Observe(d.Seconds())
+}
+
+// Snapshot returns a copy of the statistics, keyed by route.
+func (s *RequestStats) Snapshot() map[RouteKey]RouteStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[RouteKey]RouteStats, len(s.routes))
+	for key, rs := range s.routes {
+		h := *rs.Latency
+		h.Counts = slices.Clone(h.Counts)
+		out[key] = RouteStats{Codes: maps.Clone(rs.Codes), Latency: &h}
+	}
+	return out
+}
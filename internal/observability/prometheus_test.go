@@ -0,0 +1,66 @@
+package observability_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DavidRHerbert/koor/internal/observability"
+)
+
+func TestPromWriter(t *testing.T) {
+	var b strings.Builder
+	p := observability.NewPromWriter(&b)
+	p.Family("koor_things", "gauge", "Things with a \\ and a\nnewline.")
+	p.Sample("koor_things", 3, "name", `say "hi"`)
+	p.Sample("koor_things", 0.25)
+
+	h := observability.NewHistogram([]float64{0.1, 1})
+	h.Observe(0.05)
+	h.Observe(0.5)
+	h.Observe(5)
+	p.Histogram("koor_latency_seconds", h, "route", "/x")
+	if err := p.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `# HELP koor_things Things with a \\ and a\nnewline.
+# TYPE koor_things gauge
+koor_things{name="say \"hi\""} 3
+koor_things 0.25
+koor_latency_seconds_bucket{route="/x",le="0.1"} 1
+koor_latency_seconds_bucket{route="/x",le="1"} 2
+koor_latency_seconds_bucket{route="/x",le="+Inf"} 3
+koor_latency_seconds_sum{route="/x"} 5.55
+koor_latency_seconds_count{route="/x"} 3
+`
+	if b.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", b.String(), want)
+	}
+}
+
+func TestRequestStats(t *testing.T) {
+	s := observability.NewRequestStats()
+	s.Observe("GET", "/api/state", 200, 3*time.Millisecond)
+	s.Observe("GET", "/api/state", 200, 30*time.Millisecond)
+	s.Observe("GET", "/api/state", 500, time.Millisecond)
+	s.Observe("PUT", "/api/state/{key...}", 200, time.Millisecond)
+
+	snap := s.Snapshot()
+	get := snap[observability.RouteKey{Method: "GET", Route: "/api/state"}]
+	if get.Codes[200] != 2 || get.Codes[500] != 1 || get.Latency.Count != 3 {
+		t.Fatalf("unexpected GET stats: %+v", get)
+	}
+	if get.Latency.Counts[0] != 2 { // 1ms and 3ms are both under 5ms
+		t.Errorf("expected 2 observations in the first bucket, got %d", get.Latency.Counts[0])
+	}
+
+	// The snapshot is a copy.
+	s.Observe("GET", "/api/state", 200, time.Millisecond)
+	if get.Codes[200] != 2 || get.Latency.Counts[0] != 2 {
+		t.Error("snapshot changed after a later observation")
+	}
+	if len(snap) != 2 {
+		t.Errorf("expected 2 routes, got %d", len(snap))
+	}
+}
@@ -0,0 +1,415 @@
+// Package orphans cleans up data left behind by deregistered instances.
+//
+// Deregistering an instance with cascade removes its data at once; without
+// it, the state keys it owned, the messages in its inbox and the tasks it
+// had claimed linger. The Cleaner sweeps for them periodically: state keys
+// and messages are moved into a quarantine table, where an operator can
+// restore or purge them, and claimed tasks are released so other agents
+// can pick them up. Each sweep publishes an "instance.orphans.quarantined"
+// event per deregistered instance it found data for.
+package orphans
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/DavidRHerbert/koor/internal/events"
+	"github.com/DavidRHerbert/koor/internal/tasks"
+	"github.com/google/uuid"
+)
+
+// Kinds of quarantined data.
+const (
+	KindState   = "state"
+	KindMessage = "message"
+)
+
+// Errors returned by Restore.
+var (
+	ErrNotRestorable = errors.New("only state entries can be restored; messages to a deregistered instance cannot be delivered")
+	ErrExists        = errors.New("state key exists again")
+)
+
+// Item is one quarantined state entry or message. Data holds the original
+// row; state values stay encrypted if they were stored encrypted.
+type Item struct {
+	ID            string          `json:"id"`
+	Kind          string          `json:"kind"`
+	Ref           string          `json:"ref"` // state key or message ID
+	InstanceID    string          `json:"instance_id"`
+	Data          json.RawMessage `json:"data"`
+	QuarantinedAt time.Time       `json:"quarantined_at"`
+}
+
+// Sweep reports what one sweep found for a deregistered instance.
+type Sweep struct {
+	InstanceID    string   `json:"instance_id"`
+	StateKeys     []string `json:"state_keys"`
+	Messages      int      `json:"messages"`
+	TasksReleased []string `json:"tasks_released"`
+}
+
+// stateRow is the quarantined form of a state entry and its metadata.
+type stateRow struct {
+	Value       []byte    `json:"value"`
+	Version     int64     `json:"version"`
+	Hash        string    `json:"hash"`
+	ContentType string    `json:"content_type"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	UpdatedBy   string    `json:"updated_by"`
+	Description string    `json:"description,omitempty"`
+	Tags        string    `json:"tags,omitempty"`
+	Schema      string    `json:"schema,omitempty"`
+}
+
+// messageRow is the quarantined form of a message.
+type messageRow struct {
+	ID         string          `json:"id"`
+	From       string          `json:"from,omitempty"`
+	To         string          `json:"to"`
+	Capability string          `json:"capability,omitempty"`
+	Subject    string          `json:"subject,omitempty"`
+	Body       json.RawMessage `json:"body"`
+	ReplyTo    string          `json:"reply_to,omitempty"`
+	ReadAt     *time.Time      `json:"read_at,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+// Cleaner periodically quarantines data that references deregistered
+// instances.
+type Cleaner struct {
+	db       *sql.DB
+	eventBus *events.Bus
+	tasks    *tasks.Store
+	interval time.Duration
+	logger   *slog.Logger
+	stop     chan struct{}
+}
+
+// New creates a new Cleaner that sweeps every interval once started.
+func New(db *sql.DB, eventBus *events.Bus, interval time.Duration, logger *slog.Logger) *Cleaner {
+	if interval <= 0 {
+		interval = 10 * time.Minute
+	}
+	return &Cleaner{
+		db:       db,
+		eventBus: eventBus,
+		interval: interval,
+		logger:   logger,
+		stop:     make(chan struct{}),
+	}
+}
+
+// SetTasks enables releasing tasks claimed by deregistered instances.
+func (c *Cleaner) SetTasks(store *tasks.Store) {
+	c.tasks = store
+}
+
+// Start begins periodic sweeps in a background goroutine.
+func (c *Cleaner) Start() {
+	go func() {
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := c.SweepNow(context.Background()); err != nil {
+					c.logger.Error("orphan sweep failed", "error", err)
+				}
+			case <-c.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop shuts down the background sweeps.
+func (c *Cleaner) Stop() {
+	select {
+	case c.stop <- struct{}{}:
+	default:
+	}
+}
+
+// notRegistered matches a column that names no registered instance.
+const notRegistered = ` NOT IN (SELECT id FROM instances)`
+
+// SweepNow quarantines the state keys and messages of deregistered
+// instances, releases their task claims, and returns what it found per
+// instance.
+func (c *Cleaner) SweepNow(ctx context.Context) ([]Sweep, error) {
+	found := map[string]*Sweep{}
+	sweep := func(id string) *Sweep {
+		if found[id] == nil {
+			found[id] = &Sweep{InstanceID: id, StateKeys: []string{}, TasksReleased: []string{}}
+		}
+		return found[id]
+	}
+
+	owned, err := c.pairs(ctx, `SELECT key, owner FROM state_meta WHERE owner != '' AND owner`+notRegistered)
+	if err != nil {
+		return nil, fmt.Errorf("find orphaned state: %w", err)
+	}
+	for _, p := range owned {
+		moved, err := c.quarantineState(ctx, p[0], p[1])
+		if err != nil {
+			return nil, err
+		}
+		if moved {
+			s := sweep(p[1])
+			s.StateKeys = append(s.StateKeys, p[0])
+		}
+	}
+
+	inboxes, err := c.pairs(ctx, `SELECT id, recipient FROM messages WHERE recipient`+notRegistered)
+	if err != nil {
+		return nil, fmt.Errorf("find orphaned messages: %w", err)
+	}
+	for _, p := range inboxes {
+		moved, err := c.quarantineMessage(ctx, p[0], p[1])
+		if err != nil {
+			return nil, err
+		}
+		if moved {
+			sweep(p[1]).Messages++
+		}
+	}
+
+	if c.tasks != nil {
+		claimers, err := c.pairs(ctx, `SELECT DISTINCT claimed_by, '' FROM tasks
+			WHERE status = 'claimed' AND claimed_by != '' AND claimed_by`+notRegistered)
+		if err != nil {
+			return nil, fmt.Errorf("find orphaned tasks: %w", err)
+		}
+		for _, p := range claimers {
+			released, err := c.tasks.ReleaseClaims(ctx, p[0])
+			if err != nil {
+				return nil, err
+			}
+			for _, t := range released {
+				s := sweep(p[0])
+				s.TasksReleased = append(s.TasksReleased, t.ID)
+			}
+		}
+	}
+
+	out := make([]Sweep, 0, len(found))
+	for _, s := range found {
+		out = append(out, *s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].InstanceID < out[j].InstanceID })
+	for _, s := range out {
+		c.logger.Warn("quarantined data of deregistered instance", "instance_id", s.InstanceID,
+			"state_keys", len(s.StateKeys), "messages", s.Messages, "tasks_released", len(s.TasksReleased))
+		if c.eventBus != nil {
+			data, _ := json.Marshal(s)
+			c.eventBus.Publish(ctx, "instance.orphans.quarantined", data, "orphan-cleaner")
+		}
+	}
+	return out, nil
+}
+
+// pairs runs a query selecting two text columns.
+func (c *Cleaner) pairs(ctx context.Context, query string) ([][2]string, error) {
+	rows, err := c.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out [][2]string
+	for rows.Next() {
+		var p [2]string
+		if err := rows.Scan(&p[0], &p[1]); err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+// quarantineState moves a state entry and its metadata into quarantine.
+// It reports false if the key was changed or deleted meanwhile.
+func (c *Cleaner) quarantineState(ctx context.Context, key, owner string) (bool, error) {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	var row stateRow
+	err = tx.QueryRowContext(ctx,
+		`SELECT s.value, s.version, s.hash, s.content_type, s.updated_at, s.updated_by, m.description, m.tags, m.schema
+		 FROM state s JOIN state_meta m ON m.key = s.key WHERE s.key = ? AND m.owner = ?`, key, owner).
+		Scan(&row.Value, &row.Version, &row.Hash, &row.ContentType, &row.UpdatedAt, &row.UpdatedBy,
+			&row.Description, &row.Tags, &row.Schema)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("read orphaned state: %w", err)
+	}
+	if err := insertItem(ctx, tx, KindState, key, owner, row); err != nil {
+		return false, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM state WHERE key = ?`, key); err != nil {
+		return false, fmt.Errorf("delete orphaned state: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM state_meta WHERE key = ?`, key); err != nil {
+		return false, fmt.Errorf("delete orphaned state meta: %w", err)
+	}
+	return true, tx.Commit()
+}
+
+// quarantineMessage moves a message into quarantine.
+func (c *Cleaner) quarantineMessage(ctx context.Context, id, recipient string) (bool, error) {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	var m messageRow
+	var body string
+	var readAt sql.NullTime
+	err = tx.QueryRowContext(ctx,
+		`SELECT id, sender, recipient, capability, subject, body, reply_to, read_at, created_at
+		 FROM messages WHERE id = ?`, id).
+		Scan(&m.ID, &m.From, &m.To, &m.Capability, &m.Subject, &body, &m.ReplyTo, &readAt, &m.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("read orphaned message: %w", err)
+	}
+	m.Body = json.RawMessage(body)
+	if readAt.Valid {
+		m.ReadAt = &readAt.Time
+	}
+	if err := insertItem(ctx, tx, KindMessage, id, recipient, m); err != nil {
+		return false, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM messages WHERE id = ?`, id); err != nil {
+		return false, fmt.Errorf("delete orphaned message: %w", err)
+	}
+	return true, tx.Commit()
+}
+
+func insertItem(ctx context.Context, tx *sql.Tx, kind, ref, instanceID string, data any) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO quarantine (id, kind, ref, instance_id, data) VALUES (?, ?, ?, ?, ?)`,
+		uuid.New().String(), kind, ref, instanceID, string(b))
+	if err != nil {
+		return fmt.Errorf("quarantine %s: %w", kind, err)
+	}
+	return nil
+}
+
+const itemColumns = `id, kind, ref, instance_id, data, quarantined_at`
+
+func scanItem(row interface{ Scan(...any) error }) (*Item, error) {
+	var it Item
+	var data string
+	if err := row.Scan(&it.ID, &it.Kind, &it.Ref, &it.InstanceID, &data, &it.QuarantinedAt); err != nil {
+		return nil, err
+	}
+	it.Data = json.RawMessage(data)
+	return &it, nil
+}
+
+// List returns quarantined items, newest first. Empty kind or instanceID
+// match everything.
+func (c *Cleaner) List(ctx context.Context, kind, instanceID string) ([]Item, error) {
+	query := `SELECT ` + itemColumns + ` FROM quarantine WHERE (? = '' OR kind = ?) AND (? = '' OR instance_id = ?)
+		ORDER BY quarantined_at DESC, ref`
+	rows, err := c.db.QueryContext(ctx, query, kind, kind, instanceID, instanceID)
+	if err != nil {
+		return nil, fmt.Errorf("list quarantine: %w", err)
+	}
+	defer rows.Close()
+	out := []Item{}
+	for rows.Next() {
+		it, err := scanItem(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan quarantine: %w", err)
+		}
+		out = append(out, *it)
+	}
+	return out, rows.Err()
+}
+
+// Get returns a quarantined item. Returns sql.ErrNoRows if not found.
+func (c *Cleaner) Get(ctx context.Context, id string) (*Item, error) {
+	return scanItem(c.db.QueryRowContext(ctx, `SELECT `+itemColumns+` FROM quarantine WHERE id = ?`, id))
+}
+
+// Restore puts a quarantined state entry back, without an owner so it is
+// not quarantined again, and removes it from quarantine. It fails with
+// ErrExists, returning the item, if the key has been set again since.
+func (c *Cleaner) Restore(ctx context.Context, id string) (*Item, error) {
+	it, err := c.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if it.Kind != KindState {
+		return nil, ErrNotRestorable
+	}
+	var row stateRow
+	if err := json.Unmarshal(it.Data, &row); err != nil {
+		return nil, fmt.Errorf("decode quarantined state: %w", err)
+	}
+
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+	var exists int
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM state WHERE key = ?`, it.Ref).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if exists > 0 {
+		return it, ErrExists
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO state (key, value, version, hash, content_type, updated_at, updated_by) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		it.Ref, row.Value, row.Version, row.Hash, row.ContentType, row.UpdatedAt.UTC().Format("2006-01-02 15:04:05"), row.UpdatedBy); err != nil {
+		return nil, fmt.Errorf("restore state: %w", err)
+	}
+	if row.Description != "" || row.Schema != "" || row.Tags != "" && row.Tags != "[]" {
+		if row.Tags == "" {
+			row.Tags = "[]"
+		}
+		if _, err := tx.ExecContext(ctx,
+			`INSERT OR REPLACE INTO state_meta (key, description, tags, schema) VALUES (?, ?, ?, ?)`,
+			it.Ref, row.Description, row.Tags, row.Schema); err != nil {
+			return nil, fmt.Errorf("restore state meta: %w", err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM quarantine WHERE id = ?`, id); err != nil {
+		return nil, err
+	}
+	return it, tx.Commit()
+}
+
+// Purge deletes a quarantined item for good. Returns sql.ErrNoRows if not
+// found.
+func (c *Cleaner) Purge(ctx context.Context, id string) error {
+	res, err := c.db.ExecContext(ctx, `DELETE FROM quarantine WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("purge quarantine: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
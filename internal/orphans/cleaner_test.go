@@ -0,0 +1,238 @@
+package orphans_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"slices"
+	"testing"
+
+	"github.com/DavidRHerbert/koor/internal/db"
+	"github.com/DavidRHerbert/koor/internal/events"
+	"github.com/DavidRHerbert/koor/internal/instances"
+	"github.com/DavidRHerbert/koor/internal/messages"
+	"github.com/DavidRHerbert/koor/internal/orphans"
+	"github.com/DavidRHerbert/koor/internal/state"
+	"github.com/DavidRHerbert/koor/internal/tasks"
+)
+
+type fixture struct {
+	cleaner  *orphans.Cleaner
+	bus      *events.Bus
+	state    *state.Store
+	messages *messages.Store
+	tasks    *tasks.Store
+	alive    string // a registered instance
+	gone     string // a deregistered instance
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	database, err := db.OpenMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	ctx := context.Background()
+	bus := events.New(database, 100)
+	reg := instances.New(database)
+	alive, err := reg.Register(ctx, "alive", "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gone, err := reg.Register(ctx, "gone", "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.Deregister(ctx, gone.ID); err != nil {
+		t.Fatal(err)
+	}
+	f := &fixture{
+		cleaner:  orphans.New(database, bus, 0, slog.New(slog.NewTextHandler(io.Discard, nil))),
+		bus:      bus,
+		state:    state.New(database),
+		messages: messages.New(database, bus),
+		tasks:    tasks.New(database, bus),
+		alive:    alive.ID,
+		gone:     gone.ID,
+	}
+	f.cleaner.SetTasks(f.tasks)
+	return f
+}
+
+// putOwned writes a state key owned by instance (none if empty).
+func (f *fixture) putOwned(t *testing.T, key, owner string) {
+	t.Helper()
+	ctx := context.Background()
+	if _, err := f.state.Put(ctx, key, []byte(`{"v":1}`), "application/json", "test"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.state.PutMeta(ctx, state.Meta{Key: key, Owner: owner, Description: "d", Tags: []string{"t"}}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSweepNow(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+	sub := f.bus.Subscribe("instance.orphans.*")
+	defer f.bus.Unsubscribe(sub)
+
+	stateTests := []struct {
+		key         string
+		owner       string
+		quarantined bool
+	}{
+		{"TW/gone-config", f.gone, true},
+		{"TW/alive-config", f.alive, false},
+		{"TW/shared", "", false},
+	}
+	for _, tt := range stateTests {
+		f.putOwned(t, tt.key, tt.owner)
+	}
+	messageTests := []struct {
+		to          string
+		quarantined bool
+	}{
+		{f.gone, true},
+		{f.alive, false},
+	}
+	for _, tt := range messageTests {
+		if _, err := f.messages.Send(ctx, messages.Message{Subject: "hi"}, []string{tt.to}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	task, _ := f.tasks.Create(ctx, tasks.Task{Project: "TW", Title: "build"})
+	if _, err := f.tasks.Claim(ctx, "TW", []string{""}, f.gone, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	sweeps, err := f.cleaner.SweepNow(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sweeps) != 1 || sweeps[0].InstanceID != f.gone {
+		t.Fatalf("sweeps = %+v, want one for the deregistered instance", sweeps)
+	}
+	s := sweeps[0]
+	if !slices.Equal(s.StateKeys, []string{"TW/gone-config"}) || s.Messages != 1 || !slices.Equal(s.TasksReleased, []string{task.ID}) {
+		t.Errorf("sweep = %+v", s)
+	}
+	for _, tt := range stateTests {
+		_, err := f.state.Get(ctx, tt.key)
+		if kept := err == nil; kept == tt.quarantined {
+			t.Errorf("%s: kept = %v, want %v", tt.key, kept, !tt.quarantined)
+		}
+	}
+	for _, tt := range messageTests {
+		inbox, err := f.messages.Inbox(ctx, tt.to, false, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if kept := len(inbox) == 1; kept == tt.quarantined {
+			t.Errorf("inbox of %s: kept = %v, want %v", tt.to, kept, !tt.quarantined)
+		}
+	}
+	if got, _ := f.tasks.Get(ctx, task.ID); got.Status != tasks.StatusPending || got.ClaimedBy != "" {
+		t.Errorf("task should be released, got %s claimed by %q", got.Status, got.ClaimedBy)
+	}
+	if n := len(sub.Ch); n != 1 {
+		t.Errorf("expected one quarantined event, got %d", n)
+	}
+
+	items, _ := f.cleaner.List(ctx, "", f.gone)
+	if len(items) != 2 {
+		t.Errorf("quarantine = %+v, want the state key and the message", items)
+	}
+
+	// A second sweep finds nothing new.
+	if sweeps, _ := f.cleaner.SweepNow(ctx); len(sweeps) != 0 {
+		t.Errorf("second sweep = %+v, want none", sweeps)
+	}
+}
+
+func TestRestoreAndPurge(t *testing.T) {
+	tests := []struct {
+		name    string
+		kind    string
+		setup   func(t *testing.T, f *fixture) // runs after the sweep
+		purge   bool
+		wantErr error
+	}{
+		{name: "restore state", kind: orphans.KindState},
+		{name: "restore message", kind: orphans.KindMessage, wantErr: orphans.ErrNotRestorable},
+		{name: "restore over a new value", kind: orphans.KindState, wantErr: orphans.ErrExists,
+			setup: func(t *testing.T, f *fixture) { f.putOwned(t, "TW/config", "") }},
+		{name: "restore missing", wantErr: sql.ErrNoRows},
+		{name: "purge state", kind: orphans.KindState, purge: true},
+		{name: "purge message", kind: orphans.KindMessage, purge: true},
+		{name: "purge missing", purge: true, wantErr: sql.ErrNoRows},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t)
+			ctx := context.Background()
+			f.putOwned(t, "TW/config", f.gone)
+			if _, err := f.messages.Send(ctx, messages.Message{Subject: "hi"}, []string{f.gone}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := f.cleaner.SweepNow(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if tt.setup != nil {
+				tt.setup(t, f)
+			}
+			id := "missing"
+			if tt.kind != "" {
+				items, _ := f.cleaner.List(ctx, tt.kind, "")
+				if len(items) != 1 {
+					t.Fatalf("quarantined %s = %+v, want one", tt.kind, items)
+				}
+				id = items[0].ID
+			}
+
+			var err error
+			if tt.purge {
+				err = f.cleaner.Purge(ctx, id)
+			} else {
+				_, err = f.cleaner.Restore(ctx, id)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if _, err := f.cleaner.Get(ctx, id); !errors.Is(err, sql.ErrNoRows) {
+				t.Errorf("item should leave quarantine, got %v", err)
+			}
+			if tt.purge {
+				return
+			}
+
+			// A restored key comes back with its metadata, unowned.
+			entry, err := f.state.Get(ctx, "TW/config")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var v map[string]int
+			json.Unmarshal(entry.Value, &v)
+			if v["v"] != 1 {
+				t.Errorf("restored value = %s", entry.Value)
+			}
+			meta, err := f.state.GetMeta(ctx, "TW/config")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if meta.Owner != "" || meta.Description != "d" || !slices.Equal(meta.Tags, []string{"t"}) {
+				t.Errorf("restored meta = %+v", meta)
+			}
+			if sweeps, _ := f.cleaner.SweepNow(ctx); len(sweeps) != 0 {
+				t.Errorf("restored key should not be quarantined again: %+v", sweeps)
+			}
+		})
+	}
+}
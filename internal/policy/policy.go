@@ -0,0 +1,281 @@
+// Package policy authorizes writes with simple rules evaluated against the
+// calling agent instance.
+//
+// A policy applies to one action ("event.publish" or "state.write") and a
+// resource pattern (topic or state key). Every applicable policy's condition
+// must hold for the write to proceed. A condition is one or more clauses
+// joined by "&&", each "field=value" or "field!=value":
+//
+//	role=controller                  the caller has capability "controller"
+//	resource=agents/{name}/*         the key is under the caller's own slug
+//	stack=goth && name!=legacy-*     several clauses must all hold
+//
+// Fields are id, name, stack, workspace, capability (alias role) and
+// resource. Values are glob patterns where "*" matches any run of characters
+// (including "/" and "."), and may reference the caller as {id}, {name},
+// {stack} or {workspace}.
+package policy
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Actions a policy can govern.
+const (
+	ActionEventPublish = "event.publish"
+	ActionStateWrite   = "state.write"
+)
+
+// Policy is a stored authorization rule.
+type Policy struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Action      string    `json:"action"`
+	Resource    string    `json:"resource"`
+	Condition   string    `json:"condition"`
+	Description string    `json:"description,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Subject is the caller a policy is evaluated against.
+type Subject struct {
+	ID           string
+	Name         string
+	Stack        string
+	Workspace    string
+	Capabilities []string
+}
+
+// Decision is the outcome of evaluating the policies for one write.
+type Decision struct {
+	Allowed  bool    `json:"allowed"`
+	DeniedBy *Policy `json:"denied_by,omitempty"`
+	Reason   string  `json:"reason,omitempty"`
+}
+
+type clause struct {
+	field, value string
+	negate       bool
+}
+
+var validFields = map[string]bool{
+	"id": true, "name": true, "stack": true, "workspace": true,
+	"capability": true, "role": true, "resource": true,
+}
+
+// parseCondition checks a condition's syntax and returns its clauses.
+func parseCondition(cond string) ([]clause, error) {
+	var clauses []clause
+	for _, part := range strings.Split(cond, "&&") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			return nil, fmt.Errorf("empty clause in condition %q", cond)
+		}
+		var c clause
+		if field, value, ok := strings.Cut(part, "!="); ok {
+			c = clause{field: strings.TrimSpace(field), value: strings.TrimSpace(value), negate: true}
+		} else if field, value, ok := strings.Cut(part, "="); ok {
+			c = clause{field: strings.TrimSpace(field), value: strings.TrimSpace(value)}
+		} else {
+			return nil, fmt.Errorf("clause %q must be field=value or field!=value", part)
+		}
+		if !validFields[c.field] {
+			return nil, fmt.Errorf("unknown field %q in clause %q", c.field, part)
+		}
+		clauses = append(clauses, c)
+	}
+	return clauses, nil
+}
+
+// Validate checks that a policy is well-formed.
+func Validate(p Policy) error {
+	if p.Action != ActionEventPublish && p.Action != ActionStateWrite {
+		return fmt.Errorf("action must be %s or %s", ActionEventPublish, ActionStateWrite)
+	}
+	if p.Resource == "" {
+		return fmt.Errorf("resource is required")
+	}
+	if strings.TrimSpace(p.Condition) == "" {
+		return fmt.Errorf("condition is required")
+	}
+	_, err := parseCondition(p.Condition)
+	return err
+}
+
+// Allows reports whether subj satisfies the policy's condition for resource.
+// A nil subject (an unidentified caller) never satisfies a condition.
+func (p Policy) Allows(subj *Subject, resource string) bool {
+	if subj == nil {
+		return false
+	}
+	clauses, err := parseCondition(p.Condition)
+	if err != nil {
+		return false
+	}
+	expand := strings.NewReplacer("{id}", subj.ID, "{name}", subj.Name, "{stack}", subj.Stack, "{workspace}", subj.Workspace)
+	for _, c := range clauses {
+		pattern := expand.Replace(c.value)
+		var ok bool
+		switch c.field {
+		case "id":
+			ok = Match(pattern, subj.ID)
+		case "name":
+			ok = Match(pattern, subj.Name)
+		case "stack":
+			ok = Match(pattern, subj.Stack)
+		case "workspace":
+			ok = Match(pattern, subj.Workspace)
+		case "resource":
+			ok = Match(pattern, resource)
+		case "capability", "role":
+			for _, capability := range subj.Capabilities {
+				if Match(pattern, capability) {
+					ok = true
+					break
+				}
+			}
+		}
+		if ok == c.negate {
+			return false
+		}
+	}
+	return true
+}
+
+// Match reports whether s matches the glob pattern, where "*" matches any
+// sequence of characters and "?" matches exactly one.
+func Match(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			if pattern == "" {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if Match(pattern, s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if s == "" {
+				return false
+			}
+			pattern, s = pattern[1:], s[1:]
+		default:
+			if s == "" || s[0] != pattern[0] {
+				return false
+			}
+			pattern, s = pattern[1:], s[1:]
+		}
+	}
+	return s == ""
+}
+
+// Store persists policies in SQLite.
+type Store struct {
+	db *sql.DB
+}
+
+// New creates a new policy Store.
+func New(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+// Create validates and stores a policy, assigning it an ID.
+func (s *Store) Create(ctx context.Context, p Policy) (*Policy, error) {
+	if err := Validate(p); err != nil {
+		return nil, err
+	}
+	p.ID = uuid.New().String()
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO policies (id, name, action, resource, condition, description, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, datetime('now'))`,
+		p.ID, p.Name, p.Action, p.Resource, p.Condition, p.Description)
+	if err != nil {
+		return nil, fmt.Errorf("insert policy: %w", err)
+	}
+	return s.Get(ctx, p.ID)
+}
+
+// Get returns a policy by ID. Returns sql.ErrNoRows if not found.
+func (s *Store) Get(ctx context.Context, id string) (*Policy, error) {
+	var p Policy
+	err := s.db.QueryRowContext(ctx,
+		`SELECT id, name, action, resource, condition, description, created_at FROM policies WHERE id = ?`, id).
+		Scan(&p.ID, &p.Name, &p.Action, &p.Resource, &p.Condition, &p.Description, &p.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// List returns all policies, optionally only those for one action.
+func (s *Store) List(ctx context.Context, action string) ([]Policy, error) {
+	query := `SELECT id, name, action, resource, condition, description, created_at FROM policies`
+	args := []any{}
+	if action != "" {
+		query += ` WHERE action = ?`
+		args = append(args, action)
+	}
+	query += ` ORDER BY created_at, id`
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query policies: %w", err)
+	}
+	defer rows.Close()
+
+	var list []Policy
+	for rows.Next() {
+		var p Policy
+		if err := rows.Scan(&p.ID, &p.Name, &p.Action, &p.Resource, &p.Condition, &p.Description, &p.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan policy: %w", err)
+		}
+		list = append(list, p)
+	}
+	return list, rows.Err()
+}
+
+// Delete removes a policy. Returns sql.ErrNoRows if not found.
+func (s *Store) Delete(ctx context.Context, id string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM policies WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("delete policy: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// Evaluate checks every policy for action whose resource pattern matches
+// resource. The write is allowed only if all of them allow subj.
+func (s *Store) Evaluate(ctx context.Context, action, resource string, subj *Subject) (Decision, error) {
+	list, err := s.List(ctx, action)
+	if err != nil {
+		return Decision{}, err
+	}
+	for _, p := range list {
+		if !Match(p.Resource, resource) {
+			continue
+		}
+		if !p.Allows(subj, resource) {
+			reason := "condition not met: " + p.Condition
+			if subj == nil {
+				reason = "caller is not an identified instance"
+			}
+			return Decision{Allowed: false, DeniedBy: &p, Reason: reason}, nil
+		}
+	}
+	return Decision{Allowed: true}, nil
+}
@@ -0,0 +1,86 @@
+package policy_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DavidRHerbert/koor/internal/db"
+	"github.com/DavidRHerbert/koor/internal/policy"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern, s string
+		want       bool
+	}{
+		{"*", "anything/at.all", true},
+		{"*.controller.*", "tw.controller.deploy", true},
+		{"*.controller.*", "tw.agent.deploy", false},
+		{"agents/frontend/*", "agents/frontend/tasks/1", true},
+		{"agents/frontend/*", "agents/backend/x", false},
+		{"v?", "v2", true},
+		{"v?", "v10", false},
+	}
+	for _, tt := range tests {
+		if got := policy.Match(tt.pattern, tt.s); got != tt.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", tt.pattern, tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	bad := []policy.Policy{
+		{Action: "spec.write", Resource: "*", Condition: "role=x"},
+		{Action: policy.ActionStateWrite, Condition: "role=x"},
+		{Action: policy.ActionStateWrite, Resource: "*", Condition: "colour=blue"},
+		{Action: policy.ActionStateWrite, Resource: "*", Condition: "role=x && "},
+		{Action: policy.ActionStateWrite, Resource: "*", Condition: "role"},
+	}
+	for _, p := range bad {
+		if err := policy.Validate(p); err == nil {
+			t.Errorf("expected error for %+v", p)
+		}
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	database, err := db.OpenMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+	store := policy.New(database)
+	ctx := context.Background()
+
+	store.Create(ctx, policy.Policy{Name: "controller topics", Action: policy.ActionEventPublish, Resource: "*.controller.*", Condition: "role=controller"})
+	store.Create(ctx, policy.Policy{Name: "own namespace", Action: policy.ActionStateWrite, Resource: "agents/*", Condition: "resource=agents/{name}/*"})
+
+	controller := &policy.Subject{ID: "c1", Name: "lead", Capabilities: []string{"controller"}}
+	agent := &policy.Subject{ID: "a1", Name: "frontend"}
+
+	cases := []struct {
+		action, resource string
+		subj             *policy.Subject
+		want             bool
+	}{
+		{policy.ActionEventPublish, "tw.controller.plan", controller, true},
+		{policy.ActionEventPublish, "tw.controller.plan", agent, false},
+		{policy.ActionEventPublish, "tw.controller.plan", nil, false},
+		{policy.ActionEventPublish, "tw.agent.done", nil, true},
+		{policy.ActionStateWrite, "agents/frontend/status", agent, true},
+		{policy.ActionStateWrite, "agents/backend/status", agent, false},
+		{policy.ActionStateWrite, "config/db", agent, true},
+	}
+	for _, c := range cases {
+		d, err := store.Evaluate(ctx, c.action, c.resource, c.subj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.Allowed != c.want {
+			t.Errorf("%s %s by %+v: allowed=%v, want %v (%s)", c.action, c.resource, c.subj, d.Allowed, c.want, d.Reason)
+		}
+		if !d.Allowed && d.DeniedBy == nil {
+			t.Errorf("%s %s: denial without policy", c.action, c.resource)
+		}
+	}
+}
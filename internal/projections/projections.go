@@ -0,0 +1,344 @@
+// Package projections materializes events as state. A projection maps a
+// topic pattern to a state key template; each matching event published on
+// the bus is written to the key, replacing it, merged into it, or appended
+// to a list kept there.
+//
+// Key templates may reference the event as {topic}, {source} and {id},
+// the topic's dot-separated segments as {1}, {2}, ..., and fields of its
+// data as {data.field} or {data.nested.field}:
+//
+//	topic "ci.*.build"    key "ci/{2}/last-build"        latest build per repo
+//	topic "agent.status"  key "agents/{data.name}/status" status per agent
+package projections
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DavidRHerbert/koor/internal/events"
+	"github.com/DavidRHerbert/koor/internal/state"
+	"github.com/google/uuid"
+)
+
+// Merge strategies.
+const (
+	StrategyReplace = "replace" // the key holds the latest event's data
+	StrategyMerge   = "merge"   // the data's fields are merged into the stored object
+	StrategyAppend  = "append"  // the data is appended to a list of the last max_items events
+)
+
+// defaultMaxItems caps append projections that do not set max_items.
+const defaultMaxItems = 100
+
+// Projection is a stored event-to-state projection.
+type Projection struct {
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	Topic       string     `json:"topic"`
+	Key         string     `json:"key"`
+	Strategy    string     `json:"strategy"`
+	MaxItems    int        `json:"max_items,omitempty"`
+	Description string     `json:"description,omitempty"`
+	Applied     int64      `json:"applied"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastApplied *time.Time `json:"last_applied,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// Validate checks that a projection is well-formed, defaulting its strategy.
+func Validate(p *Projection) error {
+	if p.Topic == "" {
+		return fmt.Errorf("topic is required")
+	}
+	if _, err := path.Match(p.Topic, ""); err != nil {
+		return fmt.Errorf("invalid topic pattern %q", p.Topic)
+	}
+	if p.Key == "" {
+		return fmt.Errorf("key is required")
+	}
+	if _, err := placeholders(p.Key); err != nil {
+		return err
+	}
+	switch p.Strategy {
+	case "":
+		p.Strategy = StrategyReplace
+	case StrategyReplace, StrategyMerge, StrategyAppend:
+	default:
+		return fmt.Errorf("strategy must be %s, %s or %s", StrategyReplace, StrategyMerge, StrategyAppend)
+	}
+	if p.MaxItems < 0 {
+		return fmt.Errorf("max_items must not be negative")
+	}
+	return nil
+}
+
+// placeholders returns the names of the {placeholders} in a key template.
+func placeholders(tmpl string) ([]string, error) {
+	var names []string
+	for rest := tmpl; ; {
+		start := strings.IndexByte(rest, '{')
+		if start < 0 {
+			return names, nil
+		}
+		end := strings.IndexByte(rest[start:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("unclosed { in key %q", tmpl)
+		}
+		name := rest[start+1 : start+end]
+		switch {
+		case name == "topic", name == "source", name == "id", strings.HasPrefix(name, "data."):
+		default:
+			if n, err := strconv.Atoi(name); err != nil || n < 1 {
+				return nil, fmt.Errorf("unknown placeholder {%s} in key %q", name, tmpl)
+			}
+		}
+		names = append(names, name)
+		rest = rest[start+end+1:]
+	}
+}
+
+// KeyFor expands the projection's key template for an event.
+func (p Projection) KeyFor(ev events.Event) (string, error) {
+	names, err := placeholders(p.Key)
+	if err != nil {
+		return "", err
+	}
+	segments := strings.Split(ev.Topic, ".")
+	var data any
+	json.Unmarshal(ev.Data, &data)
+
+	key := p.Key
+	for _, name := range names {
+		var value string
+		switch {
+		case name == "topic":
+			value = ev.Topic
+		case name == "source":
+			value = ev.Source
+		case name == "id":
+			value = strconv.FormatInt(ev.ID, 10)
+		case strings.HasPrefix(name, "data."):
+			v := data
+			for _, field := range strings.Split(strings.TrimPrefix(name, "data."), ".") {
+				obj, _ := v.(map[string]any)
+				v = obj[field]
+			}
+			switch v := v.(type) {
+			case string:
+				value = v
+			case float64:
+				value = strconv.FormatFloat(v, 'f', -1, 64)
+			case bool:
+				value = strconv.FormatBool(v)
+			}
+		default:
+			if n, _ := strconv.Atoi(name); n <= len(segments) {
+				value = segments[n-1]
+			}
+		}
+		if value == "" {
+			return "", fmt.Errorf("event %d has no value for {%s}", ev.ID, name)
+		}
+		key = strings.Replace(key, "{"+name+"}", value, 1)
+	}
+	return key, nil
+}
+
+// Value computes the new value of the projected key from its current
+// value (nil if the key does not exist) and an event's data.
+func (p Projection) Value(current []byte, data json.RawMessage) ([]byte, error) {
+	switch p.Strategy {
+	case StrategyMerge:
+		var obj, fields map[string]any
+		if json.Unmarshal(data, &fields) != nil || fields == nil {
+			return data, nil
+		}
+		if json.Unmarshal(current, &obj) != nil || obj == nil {
+			obj = map[string]any{}
+		}
+		for k, v := range fields {
+			obj[k] = v
+		}
+		return json.Marshal(obj)
+	case StrategyAppend:
+		var list []json.RawMessage
+		json.Unmarshal(current, &list)
+		list = append(list, data)
+		limit := p.MaxItems
+		if limit == 0 {
+			limit = defaultMaxItems
+		}
+		if len(list) > limit {
+			list = list[len(list)-limit:]
+		}
+		return json.Marshal(list)
+	default:
+		return data, nil
+	}
+}
+
+// Store persists projections and applies them to published events.
+type Store struct {
+	db    *sql.DB
+	state *state.Store
+}
+
+// New creates a projection Store that writes to the given state store.
+func New(db *sql.DB, st *state.Store) *Store {
+	return &Store{db: db, state: st}
+}
+
+const selectProjection = `SELECT id, name, topic, key, strategy, max_items, description,
+	applied, last_error, last_applied, created_at FROM projections`
+
+func scanProjection(row interface{ Scan(...any) error }) (*Projection, error) {
+	var p Projection
+	var lastApplied sql.NullTime
+	if err := row.Scan(&p.ID, &p.Name, &p.Topic, &p.Key, &p.Strategy, &p.MaxItems, &p.Description,
+		&p.Applied, &p.LastError, &lastApplied, &p.CreatedAt); err != nil {
+		return nil, err
+	}
+	if lastApplied.Valid {
+		p.LastApplied = &lastApplied.Time
+	}
+	return &p, nil
+}
+
+// Create validates and stores a projection, assigning it an ID.
+func (s *Store) Create(ctx context.Context, p Projection) (*Projection, error) {
+	if err := Validate(&p); err != nil {
+		return nil, err
+	}
+	p.ID = uuid.New().String()
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO projections (id, name, topic, key, strategy, max_items, description, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, datetime('now'))`,
+		p.ID, p.Name, p.Topic, p.Key, p.Strategy, p.MaxItems, p.Description)
+	if err != nil {
+		return nil, fmt.Errorf("insert projection: %w", err)
+	}
+	return s.Get(ctx, p.ID)
+}
+
+// Update replaces a projection's definition, keeping its counters.
+// Returns sql.ErrNoRows if not found.
+func (s *Store) Update(ctx context.Context, p Projection) (*Projection, error) {
+	if err := Validate(&p); err != nil {
+		return nil, err
+	}
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE projections SET name = ?, topic = ?, key = ?, strategy = ?, max_items = ?, description = ?
+		 WHERE id = ?`,
+		p.Name, p.Topic, p.Key, p.Strategy, p.MaxItems, p.Description, p.ID)
+	if err != nil {
+		return nil, fmt.Errorf("update projection: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return s.Get(ctx, p.ID)
+}
+
+// Get returns a projection by ID. Returns sql.ErrNoRows if not found.
+func (s *Store) Get(ctx context.Context, id string) (*Projection, error) {
+	return scanProjection(s.db.QueryRowContext(ctx, selectProjection+` WHERE id = ?`, id))
+}
+
+// List returns all projections.
+func (s *Store) List(ctx context.Context) ([]Projection, error) {
+	rows, err := s.db.QueryContext(ctx, selectProjection+` ORDER BY created_at, id`)
+	if err != nil {
+		return nil, fmt.Errorf("query projections: %w", err)
+	}
+	defer rows.Close()
+
+	list := []Projection{}
+	for rows.Next() {
+		p, err := scanProjection(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan projection: %w", err)
+		}
+		list = append(list, *p)
+	}
+	return list, rows.Err()
+}
+
+// Delete removes a projection. Returns sql.ErrNoRows if not found.
+func (s *Store) Delete(ctx context.Context, id string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM projections WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("delete projection: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// Apply writes an event to the state key of every projection whose topic
+// pattern matches it. It is an events.ProjectFunc: failures do not stop
+// the publish, and are recorded on the projection as last_error instead.
+func (s *Store) Apply(ctx context.Context, ev events.Event) {
+	list, err := s.List(ctx)
+	if err != nil {
+		return
+	}
+	for _, p := range list {
+		if matched, _ := path.Match(p.Topic, ev.Topic); !matched {
+			continue
+		}
+		if err := s.apply(ctx, p, ev); err != nil {
+			s.db.ExecContext(ctx, `UPDATE projections SET last_error = ? WHERE id = ?`, err.Error(), p.ID)
+			continue
+		}
+		s.db.ExecContext(ctx,
+			`UPDATE projections SET applied = applied + 1, last_error = '', last_applied = datetime('now') WHERE id = ?`,
+			p.ID)
+	}
+}
+
+// apply writes one event through one projection. Merges and appends are
+// conditional on the version they read, and retried if another write got
+// in between.
+func (s *Store) apply(ctx context.Context, p Projection, ev events.Event) error {
+	key, err := p.KeyFor(ev)
+	if err != nil {
+		return err
+	}
+	by := "projection:" + p.ID
+	if p.Name != "" {
+		by = "projection:" + p.Name
+	}
+	if p.Strategy == StrategyReplace {
+		_, err := s.state.Put(ctx, key, ev.Data, "application/json", by)
+		return err
+	}
+	for attempt := 0; attempt < 3; attempt++ {
+		var current []byte
+		version := int64(0)
+		entry, err := s.state.Get(ctx, key)
+		switch {
+		case err == nil:
+			current, version = entry.Value, entry.Version
+		case !errors.Is(err, sql.ErrNoRows):
+			return err
+		}
+		value, err := p.Value(current, ev.Data)
+		if err != nil {
+			return err
+		}
+		_, err = s.state.PutIf(ctx, key, value, "application/json", by, state.Precondition{Version: &version})
+		if !errors.Is(err, state.ErrConflict) {
+			return err
+		}
+	}
+	return fmt.Errorf("key %s kept changing while projecting event %d", key, ev.ID)
+}
@@ -0,0 +1,108 @@
+package projections_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/DavidRHerbert/koor/internal/db"
+	"github.com/DavidRHerbert/koor/internal/events"
+	"github.com/DavidRHerbert/koor/internal/projections"
+	"github.com/DavidRHerbert/koor/internal/state"
+)
+
+func TestKeyFor(t *testing.T) {
+	ev := events.Event{ID: 7, Topic: "ci.koor.build", Source: "runner-1", Data: json.RawMessage(`{"repo":{"name":"koor"},"ok":true}`)}
+	tests := []struct {
+		key, want string
+	}{
+		{"ci/{2}/last-build", "ci/koor/last-build"},
+		{"events/{topic}", "events/ci.koor.build"},
+		{"builds/{data.repo.name}/{data.ok}", "builds/koor/true"},
+		{"runners/{source}/{id}", "runners/runner-1/7"},
+	}
+	for _, tt := range tests {
+		got, err := projections.Projection{Key: tt.key}.KeyFor(ev)
+		if err != nil || got != tt.want {
+			t.Errorf("KeyFor(%q) = %q, %v; want %q", tt.key, got, err, tt.want)
+		}
+	}
+	for _, key := range []string{"x/{4}", "x/{data.missing}"} {
+		if _, err := (projections.Projection{Key: key}).KeyFor(ev); err == nil {
+			t.Errorf("KeyFor(%q): expected an error", key)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	bad := []projections.Projection{
+		{Key: "x"},
+		{Topic: "a.*"},
+		{Topic: "a.*", Key: "x/{nope}"},
+		{Topic: "a.*", Key: "x/{1"},
+		{Topic: "a.*", Key: "x", Strategy: "sum"},
+		{Topic: "[", Key: "x"},
+	}
+	for _, p := range bad {
+		if err := projections.Validate(&p); err == nil {
+			t.Errorf("expected %+v to be invalid", p)
+		}
+	}
+	p := projections.Projection{Topic: "a.*", Key: "x/{2}"}
+	if err := projections.Validate(&p); err != nil || p.Strategy != projections.StrategyReplace {
+		t.Errorf("expected valid replace projection, got %+v, %v", p, err)
+	}
+}
+
+func TestApply(t *testing.T) {
+	ctx := context.Background()
+	database, err := db.OpenMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+	st := state.New(database)
+	store := projections.New(database, st)
+	bus := events.New(database, 100)
+	bus.SetProjections(store.Apply)
+
+	store.Create(ctx, projections.Projection{Name: "last-build", Topic: "ci.*.build", Key: "ci/{2}/last-build"})
+	status, _ := store.Create(ctx, projections.Projection{Topic: "agent.status", Key: "agents/{data.name}", Strategy: projections.StrategyMerge})
+	log, _ := store.Create(ctx, projections.Projection{Topic: "ci.*.build", Key: "ci/log", Strategy: projections.StrategyAppend, MaxItems: 2})
+
+	bus.Publish(ctx, "ci.koor.build", json.RawMessage(`{"n":1}`), "ci")
+	bus.Publish(ctx, "ci.koor.build", json.RawMessage(`{"n":2}`), "ci")
+	bus.Publish(ctx, "ci.koor.build", json.RawMessage(`{"n":3}`), "ci")
+	bus.Publish(ctx, "agent.status", json.RawMessage(`{"name":"fe","status":"busy"}`), "fe")
+	bus.Publish(ctx, "agent.status", json.RawMessage(`{"name":"fe","task":"T-1"}`), "fe")
+	bus.Publish(ctx, "agent.status", json.RawMessage(`{"status":"lost"}`), "?")
+
+	want := map[string]string{
+		"ci/koor/last-build": `{"n":3}`,
+		"ci/log":             `[{"n":2},{"n":3}]`,
+		"agents/fe":          `{"name":"fe","status":"busy","task":"T-1"}`,
+	}
+	for key, value := range want {
+		entry, err := st.Get(ctx, key)
+		if err != nil {
+			t.Errorf("%s: %v", key, err)
+			continue
+		}
+		if string(entry.Value) != value {
+			t.Errorf("%s = %s, want %s", key, entry.Value, value)
+		}
+	}
+	if entry, _ := st.Get(ctx, "ci/koor/last-build"); entry.UpdatedBy != "projection:last-build" || entry.Version != 3 {
+		t.Errorf("unexpected entry: %+v", entry)
+	}
+
+	if list, _ := store.List(ctx); len(list) != 3 {
+		t.Fatalf("expected 3 projections, got %d", len(list))
+	}
+	if p, _ := store.Get(ctx, status.ID); p.Applied != 2 || p.LastError == "" {
+		t.Errorf("expected 2 applied and the missing name recorded, got %+v", p)
+	}
+	if p, _ := store.Get(ctx, log.ID); p.Applied != 3 || p.LastApplied == nil {
+		t.Errorf("unexpected counters: %+v", p)
+	}
+}
@@ -0,0 +1,88 @@
+package projects
+
+import (
+	"fmt"
+	"time"
+)
+
+// Metrics an error budget can watch. Each is recorded per instance as a
+// count of attempts plus a "<metric>.failed" count of the failures among
+// them (see observability.RecordOutcome).
+const (
+	BudgetRequests            = "requests"             // REST calls; 4xx/5xx responses fail
+	BudgetValidations         = "validations"          // POST /api/validate; error-severity violations fail
+	BudgetContractValidations = "contract_validations" // contract validate calls; invalid payloads fail
+)
+
+// DefaultBudgetWindow and DefaultBudgetMinSamples apply to budgets that
+// omit window and min_samples.
+const (
+	DefaultBudgetWindow     = 24 * time.Hour
+	DefaultBudgetMinSamples = 10
+)
+
+// ErrorBudget caps how often a project's agents may fail at something, e.g.
+// "backend agents may fail at most 5% of contract validations per day".
+type ErrorBudget struct {
+	Name string `json:"name"`
+	// Role limits the budget to agents named "{project}-{role}"; empty
+	// applies it to every agent of the project.
+	Role           string  `json:"role,omitempty"`
+	Metric         string  `json:"metric"`
+	MaxFailureRate float64 `json:"max_failure_rate"` // fraction: 0.05 is 5%
+	// Window is the Go duration the rate is measured over, in whole
+	// hours (metrics are kept in hourly buckets). Default 24h.
+	Window string `json:"window,omitempty"`
+	// MinSamples is how many attempts are needed in the window before the
+	// budget can be blown, so one early failure is not a 100% rate.
+	MinSamples int64 `json:"min_samples,omitempty"`
+}
+
+// WindowDuration parses Window, defaulting to DefaultBudgetWindow.
+func (b ErrorBudget) WindowDuration() (time.Duration, error) {
+	if b.Window == "" {
+		return DefaultBudgetWindow, nil
+	}
+	d, err := time.ParseDuration(b.Window)
+	if err != nil {
+		return 0, fmt.Errorf("error budget %s: window: %w", b.Name, err)
+	}
+	if d < time.Hour || d%time.Hour != 0 {
+		return 0, fmt.Errorf("error budget %s: window must be a whole number of hours", b.Name)
+	}
+	return d, nil
+}
+
+// Samples returns MinSamples, defaulting to DefaultBudgetMinSamples.
+func (b ErrorBudget) Samples() int64 {
+	if b.MinSamples <= 0 {
+		return DefaultBudgetMinSamples
+	}
+	return b.MinSamples
+}
+
+func validateBudgets(budgets []ErrorBudget) error {
+	seen := map[string]bool{}
+	for _, b := range budgets {
+		if b.Name == "" {
+			return fmt.Errorf("error budget name is required")
+		}
+		if seen[b.Name] {
+			return fmt.Errorf("duplicate error budget %s", b.Name)
+		}
+		seen[b.Name] = true
+		switch b.Metric {
+		case BudgetRequests, BudgetValidations, BudgetContractValidations:
+		default:
+			return fmt.Errorf("error budget %s: unknown metric %q (want %s, %s or %s)",
+				b.Name, b.Metric, BudgetRequests, BudgetValidations, BudgetContractValidations)
+		}
+		if b.MaxFailureRate < 0 || b.MaxFailureRate >= 1 {
+			return fmt.Errorf("error budget %s: max_failure_rate must be in [0, 1)", b.Name)
+		}
+		if _, err := b.WindowDuration(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
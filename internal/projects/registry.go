@@ -0,0 +1,81 @@
+package projects
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// Project is a registered project. Registration is what project-scoped
+// tokens are issued against; a project's data needs no registration.
+type Project struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// validName matches project names that can prefix state keys ("{name}/")
+// and, lowercased, event topics ("{name}.").
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+// Create registers a project. Returns an error if the name is taken.
+func (s *Store) Create(ctx context.Context, p Project) (*Project, error) {
+	if !validName.MatchString(p.Name) {
+		return nil, fmt.Errorf("invalid project name %q: use letters, digits, '-' and '_'", p.Name)
+	}
+	if _, err := s.Project(ctx, p.Name); err == nil {
+		return nil, fmt.Errorf("project %s already exists", p.Name)
+	}
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO projects (name, description) VALUES (?, ?)`, p.Name, p.Description)
+	if err != nil {
+		return nil, fmt.Errorf("create project: %w", err)
+	}
+	return s.Project(ctx, p.Name)
+}
+
+// Project returns a registered project. Returns sql.ErrNoRows if there is
+// none by that name.
+func (s *Store) Project(ctx context.Context, name string) (*Project, error) {
+	var p Project
+	err := s.db.QueryRowContext(ctx,
+		`SELECT name, description, created_at FROM projects WHERE name = ?`, name).
+		Scan(&p.Name, &p.Description, &p.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Projects returns every registered project, by name.
+func (s *Store) Projects(ctx context.Context) ([]Project, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT name, description, created_at FROM projects ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("list projects: %w", err)
+	}
+	defer rows.Close()
+	list := []Project{}
+	for rows.Next() {
+		var p Project
+		if err := rows.Scan(&p.Name, &p.Description, &p.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan project: %w", err)
+		}
+		list = append(list, p)
+	}
+	return list, rows.Err()
+}
+
+// Unregister removes a project from the registry. Its data is left alone.
+// Returns sql.ErrNoRows if it is not registered.
+func (s *Store) Unregister(ctx context.Context, name string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM projects WHERE name = ?`, name)
+	if err != nil {
+		return fmt.Errorf("unregister project: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
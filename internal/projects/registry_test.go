@@ -0,0 +1,56 @@
+package projects_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/DavidRHerbert/koor/internal/db"
+	"github.com/DavidRHerbert/koor/internal/projects"
+)
+
+func TestRegistry(t *testing.T) {
+	database, err := db.OpenMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+	ctx := context.Background()
+	store := projects.New(database)
+
+	for _, name := range []string{"", "Truck Wash", "a/b", "-x"} {
+		if _, err := store.Create(ctx, projects.Project{Name: name}); err == nil {
+			t.Errorf("expected %q to be rejected", name)
+		}
+	}
+	p, err := store.Create(ctx, projects.Project{Name: "Truck-Wash", Description: "wash booking"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Description != "wash booking" || p.CreatedAt.IsZero() {
+		t.Errorf("unexpected project %+v", p)
+	}
+	if _, err := store.Create(ctx, projects.Project{Name: "Truck-Wash"}); err == nil {
+		t.Error("expected a duplicate project to be rejected")
+	}
+	store.Create(ctx, projects.Project{Name: "Alpha"})
+
+	list, err := store.Projects(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].Name != "Alpha" {
+		t.Errorf("expected Alpha and Truck-Wash by name, got %+v", list)
+	}
+
+	if err := store.Unregister(ctx, "Truck-Wash"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Project(ctx, "Truck-Wash"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected ErrNoRows after unregister, got %v", err)
+	}
+	if err := store.Unregister(ctx, "Truck-Wash"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected ErrNoRows unregistering twice, got %v", err)
+	}
+}
@@ -0,0 +1,247 @@
+// Package projects stores per-project settings that override server-wide
+// defaults.
+//
+// A project without stored settings uses Defaults: no default stack, global
+// rules apply, state writes are not validated, events follow the global
+// history cap and webhooks subscribe to every topic. Projects own the state
+// keys under "{project}/" and the event topics under "{project}." (with the
+// project lowercased, as agents publish them).
+//
+// Projects can also be registered, which lets project-scoped tokens be
+// issued for them and instances be assigned to them.
+package projects
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// WebhookDefaults apply to webhooks created for a project that omit them.
+type WebhookDefaults struct {
+	Patterns []string `json:"patterns,omitempty"`
+	Secret   string   `json:"secret,omitempty"`
+}
+
+// Settings is one project's configuration.
+type Settings struct {
+	Project string `json:"project"`
+	// DefaultStack is used when a validation request names no stack.
+	DefaultStack string `json:"default_stack"`
+	// ValidateStateWrites rejects state writes under "{project}/" that
+	// fail the project's validation rules.
+	ValidateStateWrites bool `json:"validate_state_writes"`
+	// GlobalRules controls whether _global rules apply to the project.
+	GlobalRules bool `json:"global_rules"`
+	// EventRetention is how long "{project}.*" events are kept, as a Go
+	// duration. Empty keeps them until the global history cap drops them.
+	EventRetention string          `json:"event_retention,omitempty"`
+	Webhooks       WebhookDefaults `json:"webhook_defaults"`
+	// ErrorBudgets alert when the project's agents fail too often.
+	ErrorBudgets []ErrorBudget `json:"error_budgets,omitempty"`
+	// ContractTargets maps a contract name to the base URL of the running
+	// service that implements it, which is checked for drift from the
+	// contract. "*" covers every contract without its own entry.
+	ContractTargets map[string]string `json:"contract_targets,omitempty"`
+	// DriftInterval is how often the targets are checked, as a Go
+	// duration of at least 1m. Default 1h.
+	DriftInterval string     `json:"drift_interval,omitempty"`
+	UpdatedAt     *time.Time `json:"updated_at,omitempty"`
+}
+
+// DefaultDriftInterval applies to projects that set contract targets but
+// no drift_interval.
+const DefaultDriftInterval = time.Hour
+
+// DriftEvery parses DriftInterval, defaulting to DefaultDriftInterval.
+func (s Settings) DriftEvery() (time.Duration, error) {
+	if s.DriftInterval == "" {
+		return DefaultDriftInterval, nil
+	}
+	d, err := time.ParseDuration(s.DriftInterval)
+	if err != nil {
+		return 0, fmt.Errorf("drift_interval: %w", err)
+	}
+	if d < time.Minute {
+		return 0, fmt.Errorf("drift_interval must be at least 1m")
+	}
+	return d, nil
+}
+
+// ContractTarget returns the base URL contract is checked against, or ""
+// if it has none.
+func (s Settings) ContractTarget(contract string) string {
+	if t, ok := s.ContractTargets[contract]; ok {
+		return t
+	}
+	return s.ContractTargets["*"]
+}
+
+// Defaults returns the settings of a project that has none stored.
+func Defaults(project string) Settings {
+	return Settings{Project: project, GlobalRules: true}
+}
+
+// Retention parses EventRetention; zero means no project-specific limit.
+func (s Settings) Retention() (time.Duration, error) {
+	if s.EventRetention == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s.EventRetention)
+	if err != nil {
+		return 0, fmt.Errorf("event_retention: %w", err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("event_retention must be positive")
+	}
+	return d, nil
+}
+
+// Validate checks the settings that can be malformed.
+func (s Settings) Validate() error {
+	if _, err := s.Retention(); err != nil {
+		return err
+	}
+	if _, err := s.DriftEvery(); err != nil {
+		return err
+	}
+	for name, target := range s.ContractTargets {
+		if u, err := url.Parse(target); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("contract_targets[%s]: want an http(s) base URL, got %q", name, target)
+		}
+	}
+	return validateBudgets(s.ErrorBudgets)
+}
+
+// ProjectOfKey returns the project that owns a state key ("{project}/..."),
+// or "" if the key has no project segment.
+func ProjectOfKey(key string) string {
+	if i := strings.Index(key, "/"); i > 0 {
+		return key[:i]
+	}
+	return ""
+}
+
+// Store persists project settings in SQLite.
+type Store struct {
+	db *sql.DB
+}
+
+// New creates a new settings Store.
+func New(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+// Get returns a project's settings, or Defaults if none are stored.
+func (s *Store) Get(ctx context.Context, project string) (Settings, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT project, default_stack, validate_state_writes, global_rules, event_retention, webhook_defaults, error_budgets, contract_targets, drift_interval, updated_at
+		 FROM project_settings WHERE project = ?`, project)
+	if err != nil {
+		return Settings{}, fmt.Errorf("query project settings: %w", err)
+	}
+	list, err := scanSettings(rows)
+	if err != nil {
+		return Settings{}, err
+	}
+	if len(list) == 0 {
+		return Defaults(project), nil
+	}
+	return list[0], nil
+}
+
+// Put stores a project's settings, replacing any existing ones.
+func (s *Store) Put(ctx context.Context, st Settings) (Settings, error) {
+	if st.Project == "" {
+		return Settings{}, fmt.Errorf("project is required")
+	}
+	if err := st.Validate(); err != nil {
+		return Settings{}, err
+	}
+	hooks, _ := json.Marshal(st.Webhooks)
+	budgets, _ := json.Marshal(st.ErrorBudgets)
+	targets, _ := json.Marshal(st.ContractTargets)
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO project_settings (project, default_stack, validate_state_writes, global_rules, event_retention, webhook_defaults, error_budgets, contract_targets, drift_interval, updated_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, datetime('now'))
+		 ON CONFLICT(project) DO UPDATE SET
+			default_stack = excluded.default_stack,
+			validate_state_writes = excluded.validate_state_writes,
+			global_rules = excluded.global_rules,
+			event_retention = excluded.event_retention,
+			webhook_defaults = excluded.webhook_defaults,
+			error_budgets = excluded.error_budgets,
+			contract_targets = excluded.contract_targets,
+			drift_interval = excluded.drift_interval,
+			updated_at = excluded.updated_at`,
+		st.Project, st.DefaultStack, st.ValidateStateWrites, st.GlobalRules, st.EventRetention, string(hooks), string(budgets),
+		string(targets), st.DriftInterval)
+	if err != nil {
+		return Settings{}, fmt.Errorf("put project settings: %w", err)
+	}
+	return s.Get(ctx, st.Project)
+}
+
+// Delete removes a project's settings so it falls back to Defaults.
+func (s *Store) Delete(ctx context.Context, project string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM project_settings WHERE project = ?`, project)
+	if err != nil {
+		return fmt.Errorf("delete project settings: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// List returns every project with stored settings.
+func (s *Store) List(ctx context.Context) ([]Settings, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT project, default_stack, validate_state_writes, global_rules, event_retention, webhook_defaults, error_budgets, contract_targets, drift_interval, updated_at
+		 FROM project_settings ORDER BY project`)
+	if err != nil {
+		return nil, fmt.Errorf("query project settings: %w", err)
+	}
+	return scanSettings(rows)
+}
+
+// EventRetention maps each project's topic prefix (the lowercased project
+// followed by ".") to its event retention, for projects that set one. It has the signature of
+// events.RetentionFunc.
+func (s *Store) EventRetention(ctx context.Context) (map[string]time.Duration, error) {
+	list, err := s.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]time.Duration)
+	for _, st := range list {
+		if d, err := st.Retention(); err == nil && d > 0 {
+			out[strings.ToLower(st.Project)+"."] = d
+		}
+	}
+	return out, nil
+}
+
+func scanSettings(rows *sql.Rows) ([]Settings, error) {
+	defer rows.Close()
+	var list []Settings
+	for rows.Next() {
+		var st Settings
+		var hooks, budgets, targets string
+		var updated time.Time
+		if err := rows.Scan(&st.Project, &st.DefaultStack, &st.ValidateStateWrites, &st.GlobalRules,
+			&st.EventRetention, &hooks, &budgets, &targets, &st.DriftInterval, &updated); err != nil {
+			return nil, fmt.Errorf("scan project settings: %w", err)
+		}
+		json.Unmarshal([]byte(hooks), &st.Webhooks)
+		json.Unmarshal([]byte(budgets), &st.ErrorBudgets)
+		json.Unmarshal([]byte(targets), &st.ContractTargets)
+		st.UpdatedAt = &updated
+		list = append(list, st)
+	}
+	return list, rows.Err()
+}
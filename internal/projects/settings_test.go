@@ -0,0 +1,73 @@
+package projects_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DavidRHerbert/koor/internal/db"
+	"github.com/DavidRHerbert/koor/internal/projects"
+)
+
+func TestSettingsStore(t *testing.T) {
+	database, err := db.OpenMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+	ctx := context.Background()
+	store := projects.New(database)
+
+	st, err := store.Get(ctx, "Truck-Wash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !st.GlobalRules || st.ValidateStateWrites || st.UpdatedAt != nil {
+		t.Errorf("expected defaults for a project without settings, got %+v", st)
+	}
+
+	if _, err := store.Put(ctx, projects.Settings{Project: "Truck-Wash", EventRetention: "soon"}); err == nil {
+		t.Error("expected error for invalid event_retention")
+	}
+
+	st.DefaultStack = "goth"
+	st.EventRetention = "72h"
+	st.Webhooks.Patterns = []string{"truck-wash.*"}
+	saved, err := store.Put(ctx, st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.DefaultStack != "goth" || saved.UpdatedAt == nil || len(saved.Webhooks.Patterns) != 1 {
+		t.Errorf("unexpected saved settings: %+v", saved)
+	}
+
+	ret, err := store.EventRetention(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ret["truck-wash."] != 72*time.Hour {
+		t.Errorf("expected 72h retention for truck-wash., got %v", ret)
+	}
+
+	if err := store.Delete(ctx, "Truck-Wash"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete(ctx, "Truck-Wash"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected ErrNoRows deleting twice, got %v", err)
+	}
+}
+
+func TestProjectOfKey(t *testing.T) {
+	cases := map[string]string{
+		"Truck-Wash/config": "Truck-Wash",
+		"config":            "",
+		"/leading":          "",
+	}
+	for key, want := range cases {
+		if got := projects.ProjectOfKey(key); got != want {
+			t.Errorf("ProjectOfKey(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
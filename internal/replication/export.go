@@ -0,0 +1,309 @@
+package replication
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// ExportFormat identifies a logical JSON export.
+const ExportFormat = "koor-export"
+
+// Export is a logical, JSON copy of the database: every table's columns and
+// rows. BLOB values are written as {"b64": "..."} so they survive the round
+// trip; everything else is plain JSON.
+type Export struct {
+	Format    string                 `json:"format"`
+	Version   int                    `json:"version"`
+	CreatedAt time.Time              `json:"created_at"`
+	Tables    map[string]ExportTable `json:"tables"`
+}
+
+// ExportTable is one table of an Export.
+type ExportTable struct {
+	Columns []string `json:"columns"`
+	Rows    [][]any  `json:"rows"`
+}
+
+// blob is how an Export writes BLOB values.
+type blob struct {
+	B64 string `json:"b64"`
+}
+
+// ErrBadArchive is returned by Restore for input that is neither a SQLite
+// snapshot nor a JSON export.
+var ErrBadArchive = errors.New("archive is neither a SQLite snapshot nor a koor JSON export")
+
+// sqliteHeader starts every SQLite database file.
+var sqliteHeader = []byte("SQLite format 3\x00")
+
+// WriteExport writes a consistent logical export of every table to w as JSON.
+func (s *Source) WriteExport(ctx context.Context, w io.Writer) error {
+	// A read transaction sees one snapshot of the database throughout.
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	tables, err := listTables(ctx, tx)
+	if err != nil {
+		return err
+	}
+	exp := Export{Format: ExportFormat, Version: 1, CreatedAt: time.Now().UTC(), Tables: map[string]ExportTable{}}
+	for _, table := range tables {
+		t, err := exportTable(ctx, tx, table)
+		if err != nil {
+			return err
+		}
+		exp.Tables[table] = t
+	}
+	return json.NewEncoder(w).Encode(exp)
+}
+
+func exportTable(ctx context.Context, tx *sql.Tx, table string) (ExportTable, error) {
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf(`SELECT * FROM "%s"`, table))
+	if err != nil {
+		return ExportTable{}, fmt.Errorf("read %s: %w", table, err)
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return ExportTable{}, fmt.Errorf("columns of %s: %w", table, err)
+	}
+	t := ExportTable{Columns: cols, Rows: [][]any{}}
+	for rows.Next() {
+		vals := make([]any, len(cols))
+		ptrs := make([]any, len(cols))
+		for i := range vals {
+			ptrs[i] = &vals[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return ExportTable{}, fmt.Errorf("scan %s: %w", table, err)
+		}
+		for i, v := range vals {
+			switch v := v.(type) {
+			case []byte:
+				vals[i] = blob{B64: base64.StdEncoding.EncodeToString(v)}
+			case time.Time:
+				// The driver parses DATETIME columns; write them back the way
+				// SQLite's datetime() does.
+				vals[i] = v.UTC().Format("2006-01-02 15:04:05.999999999")
+			}
+		}
+		t.Rows = append(t.Rows, vals)
+	}
+	return t, rows.Err()
+}
+
+// listTables lists the database's ordinary tables, skipping SQLite
+// internals and the search index, which triggers rebuild.
+func listTables(ctx context.Context, tx *sql.Tx) ([]string, error) {
+	rows, err := tx.QueryContext(ctx,
+		`SELECT name FROM sqlite_master
+		 WHERE type = 'table' AND name NOT LIKE 'sqlite_%' AND name NOT LIKE 'search_index%'
+		 ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("list tables: %w", err)
+	}
+	defer rows.Close()
+
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("scan table name: %w", err)
+		}
+		tables = append(tables, name)
+	}
+	return tables, rows.Err()
+}
+
+// RestoreResult reports what Restore replaced.
+type RestoreResult struct {
+	Format string         `json:"format"` // "sqlite" or "json"
+	Tables map[string]int `json:"tables"` // rows restored per table
+}
+
+// Restore replaces the contents of every table named in an archive made by
+// WriteSnapshot (a SQLite file) or WriteExport (JSON), in a single
+// transaction. Local tables missing from the archive are left alone, and
+// columns are matched by name, as in Apply.
+func (s *Source) Restore(ctx context.Context, r io.Reader) (*RestoreResult, error) {
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(len(sqliteHeader))
+	if !bytes.Equal(head, sqliteHeader) {
+		var exp Export
+		dec := json.NewDecoder(br)
+		dec.UseNumber()
+		if err := dec.Decode(&exp); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrBadArchive, err)
+		}
+		if exp.Format != ExportFormat {
+			return nil, fmt.Errorf("%w: unknown format %q", ErrBadArchive, exp.Format)
+		}
+		return restoreExport(ctx, s.db, &exp)
+	}
+
+	tmp, err := os.CreateTemp("", "koor-restore-*.db")
+	if err != nil {
+		return nil, fmt.Errorf("create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, br); err != nil {
+		tmp.Close()
+		return nil, fmt.Errorf("read snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+	if err := Apply(ctx, s.db, tmp.Name()); err != nil {
+		return nil, err
+	}
+	return countRows(ctx, s.db, tmp.Name())
+}
+
+// countRows counts the rows of the snapshot's tables after Apply.
+func countRows(ctx context.Context, db *sql.DB, path string) (*RestoreResult, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get connection: %w", err)
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, `ATTACH DATABASE ? AS src`, path); err != nil {
+		return nil, fmt.Errorf("attach snapshot: %w", err)
+	}
+	defer conn.ExecContext(context.Background(), `DETACH DATABASE src`)
+
+	tables, err := replicatedTables(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	res := &RestoreResult{Format: "sqlite", Tables: map[string]int{}}
+	for _, table := range tables {
+		var n int
+		if err := conn.QueryRowContext(ctx, fmt.Sprintf(`SELECT COUNT(*) FROM main."%s"`, table)).Scan(&n); err != nil {
+			return nil, fmt.Errorf("count %s: %w", table, err)
+		}
+		res.Tables[table] = n
+	}
+	return res, nil
+}
+
+func restoreExport(ctx context.Context, db *sql.DB, exp *Export) (*RestoreResult, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	local, err := listTables(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	res := &RestoreResult{Format: "json", Tables: map[string]int{}}
+	for _, table := range local {
+		t, ok := exp.Tables[table]
+		if !ok {
+			continue
+		}
+		n, err := restoreTable(ctx, tx, table, t)
+		if err != nil {
+			return nil, err
+		}
+		res.Tables[table] = n
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return res, nil
+}
+
+func restoreTable(ctx context.Context, tx *sql.Tx, table string, t ExportTable) (int, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return 0, fmt.Errorf("columns of %s: %w", table, err)
+	}
+	localCols := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("scan column: %w", err)
+		}
+		localCols[name] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	// Export columns are matched by name; unknown ones are dropped.
+	var cols []string
+	var idx []int
+	for i, c := range t.Columns {
+		if localCols[c] {
+			cols = append(cols, c)
+			idx = append(idx, i)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM "%s"`, table)); err != nil {
+		return 0, fmt.Errorf("clear %s: %w", table, err)
+	}
+	if len(cols) == 0 {
+		return 0, nil
+	}
+	stmt, err := tx.PrepareContext(ctx, fmt.Sprintf(`INSERT INTO "%s" ("%s") VALUES (%s)`,
+		table, strings.Join(cols, `", "`), strings.TrimSuffix(strings.Repeat("?, ", len(cols)), ", ")))
+	if err != nil {
+		return 0, fmt.Errorf("prepare %s: %w", table, err)
+	}
+	defer stmt.Close()
+
+	for n, row := range t.Rows {
+		if len(row) != len(t.Columns) {
+			return 0, fmt.Errorf("%w: %s row %d: %d values for %d columns", ErrBadArchive, table, n, len(row), len(t.Columns))
+		}
+		args := make([]any, len(idx))
+		for j, i := range idx {
+			v, err := importValue(row[i])
+			if err != nil {
+				return 0, fmt.Errorf("%w: %s row %d, %s: %v", ErrBadArchive, table, n, t.Columns[i], err)
+			}
+			args[j] = v
+		}
+		if _, err := stmt.ExecContext(ctx, args...); err != nil {
+			return 0, fmt.Errorf("insert into %s: %w", table, err)
+		}
+	}
+	return len(t.Rows), nil
+}
+
+// importValue turns a decoded export value back into a column value.
+func importValue(v any) (any, error) {
+	switch v := v.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n, nil
+		}
+		return v.Float64()
+	case map[string]any:
+		s, ok := v["b64"].(string)
+		if !ok || len(v) != 1 {
+			return nil, errors.New(`object values must be {"b64": "..."}`)
+		}
+		return base64.StdEncoding.DecodeString(s)
+	case []any:
+		return nil, errors.New("array values are not supported")
+	}
+	return v, nil
+}
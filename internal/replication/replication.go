@@ -0,0 +1,273 @@
+package replication
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Source serves snapshots of the primary's database to followers.
+type Source struct {
+	db *sql.DB
+}
+
+// NewSource creates a new snapshot Source.
+func NewSource(db *sql.DB) *Source {
+	return &Source{db: db}
+}
+
+// WriteSnapshot writes a consistent copy of the database to w as a SQLite file.
+func (s *Source) WriteSnapshot(ctx context.Context, w io.Writer) error {
+	dir, err := os.MkdirTemp("", "koor-snapshot-")
+	if err != nil {
+		return fmt.Errorf("create temp dir: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "snapshot.db")
+	if _, err := s.db.ExecContext(ctx, `VACUUM INTO ?`, path); err != nil {
+		return fmt.Errorf("vacuum into snapshot: %w", err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("open snapshot: %w", err)
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// Apply replaces the contents of every table in db with the rows from the
+// SQLite snapshot at path, in a single transaction. Tables are matched by
+// name and columns by name, so schemas that differ only in column order or
+// in columns added by later migrations still replicate.
+func Apply(ctx context.Context, db *sql.DB, path string) error {
+	// ATTACH is per-connection, so pin one for the whole apply.
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("get connection: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `ATTACH DATABASE ? AS src`, path); err != nil {
+		return fmt.Errorf("attach snapshot: %w", err)
+	}
+	defer conn.ExecContext(context.Background(), `DETACH DATABASE src`)
+
+	tables, err := replicatedTables(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, table := range tables {
+		cols, err := sharedColumns(ctx, tx, table)
+		if err != nil {
+			return err
+		}
+		if len(cols) == 0 {
+			continue
+		}
+		list := `"` + strings.Join(cols, `", "`) + `"`
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM main."%s"`, table)); err != nil {
+			return fmt.Errorf("clear %s: %w", table, err)
+		}
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf(`INSERT INTO main."%s" (%s) SELECT %s FROM src."%s"`, table, list, list, table)); err != nil {
+			return fmt.Errorf("copy %s: %w", table, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// replicatedTables lists the snapshot's ordinary tables that also exist
+// locally. SQLite internals and the search index (rebuilt by triggers) are skipped.
+func replicatedTables(ctx context.Context, conn *sql.Conn) ([]string, error) {
+	rows, err := conn.QueryContext(ctx,
+		`SELECT s.name FROM src.sqlite_master s
+		 JOIN main.sqlite_master m ON m.name = s.name AND m.type = 'table'
+		 WHERE s.type = 'table' AND s.name NOT LIKE 'sqlite_%' AND s.name NOT LIKE 'search_index%'
+		 ORDER BY s.name`)
+	if err != nil {
+		return nil, fmt.Errorf("list snapshot tables: %w", err)
+	}
+	defer rows.Close()
+
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("scan table name: %w", err)
+		}
+		tables = append(tables, name)
+	}
+	return tables, rows.Err()
+}
+
+func sharedColumns(ctx context.Context, tx *sql.Tx, table string) ([]string, error) {
+	rows, err := tx.QueryContext(ctx,
+		`SELECT m.name FROM pragma_table_info(?, 'main') m
+		 JOIN pragma_table_info(?, 'src') s ON s.name = m.name
+		 ORDER BY m.cid`, table, table)
+	if err != nil {
+		return nil, fmt.Errorf("columns of %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	var cols []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("scan column: %w", err)
+		}
+		cols = append(cols, name)
+	}
+	return cols, rows.Err()
+}
+
+// Status describes a follower's replication progress.
+type Status struct {
+	Primary   string     `json:"primary"`
+	Interval  string     `json:"interval"`
+	LastSync  *time.Time `json:"last_sync,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+	Syncs     int64      `json:"syncs"`
+}
+
+// Follower periodically pulls a snapshot from a primary koor-server and
+// applies it to the local database.
+type Follower struct {
+	db       *sql.DB
+	primary  string
+	token    string
+	interval time.Duration
+	client   *http.Client
+	logger   *slog.Logger
+	stop     chan struct{}
+
+	mu     sync.Mutex
+	status Status
+}
+
+// NewFollower creates a Follower for the primary at the given base URL.
+func NewFollower(db *sql.DB, primary, token string, interval time.Duration, logger *slog.Logger) *Follower {
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	primary = strings.TrimRight(primary, "/")
+	return &Follower{
+		db:       db,
+		primary:  primary,
+		token:    token,
+		interval: interval,
+		client:   &http.Client{Timeout: 5 * time.Minute},
+		logger:   logger,
+		stop:     make(chan struct{}),
+		status:   Status{Primary: primary, Interval: interval.String()},
+	}
+}
+
+// Primary returns the base URL of the primary server.
+func (f *Follower) Primary() string {
+	return f.primary
+}
+
+// Start syncs once, then keeps syncing on the interval in a background goroutine.
+func (f *Follower) Start() {
+	go func() {
+		f.syncAndLog()
+		ticker := time.NewTicker(f.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				f.syncAndLog()
+			case <-f.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop shuts down the background sync goroutine.
+func (f *Follower) Stop() {
+	select {
+	case f.stop <- struct{}{}:
+	default:
+	}
+}
+
+func (f *Follower) syncAndLog() {
+	if err := f.Sync(context.Background()); err != nil {
+		f.logger.Error("replication sync failed", "primary", f.primary, "error", err)
+	}
+}
+
+// Sync downloads a snapshot from the primary and applies it.
+func (f *Follower) Sync(ctx context.Context) error {
+	err := f.sync(ctx)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err != nil {
+		f.status.LastError = err.Error()
+		return err
+	}
+	now := time.Now().UTC()
+	f.status.LastSync = &now
+	f.status.LastError = ""
+	f.status.Syncs++
+	return nil
+}
+
+func (f *Follower) sync(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", f.primary+"/api/replication/snapshot", nil)
+	if err != nil {
+		return err
+	}
+	if f.token != "" {
+		req.Header.Set("Authorization", "Bearer "+f.token)
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("fetch snapshot: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("fetch snapshot: status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	tmp, err := os.CreateTemp("", "koor-replica-*.db")
+	if err != nil {
+		return fmt.Errorf("create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, resp.Body); err != nil {
+		tmp.Close()
+		return fmt.Errorf("download snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return Apply(ctx, f.db, tmp.Name())
+}
+
+// Status returns the follower's current replication status.
+func (f *Follower) Status() Status {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.status
+}
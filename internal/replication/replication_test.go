@@ -0,0 +1,155 @@
+package replication_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DavidRHerbert/koor/internal/db"
+	"github.com/DavidRHerbert/koor/internal/replication"
+	"github.com/DavidRHerbert/koor/internal/specs"
+	"github.com/DavidRHerbert/koor/internal/state"
+)
+
+func openDB(t *testing.T) *sql.DB {
+	t.Helper()
+	database, err := db.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	return database
+}
+
+func primaryServer(t *testing.T, database *sql.DB, token string) *httptest.Server {
+	t.Helper()
+	src := replication.NewSource(database)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token != "" && r.Header.Get("Authorization") != "Bearer "+token {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if err := src.WriteSnapshot(r.Context(), w); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestFollowerSync(t *testing.T) {
+	ctx := context.Background()
+	primary := openDB(t)
+	replica := openDB(t)
+
+	state.New(primary).Put(ctx, "config/db", []byte(`{"host":"a"}`), "application/json", "")
+	specs.New(primary).Put(ctx, "TW", "api", []byte(`{"kind":"contract"}`))
+	state.New(replica).Put(ctx, "local-only", []byte(`1`), "application/json", "")
+
+	ts := primaryServer(t, primary, "secret")
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	f := replication.NewFollower(replica, ts.URL, "secret", time.Minute, logger)
+
+	if err := f.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	entry, err := state.New(replica).Get(ctx, "config/db")
+	if err != nil || string(entry.Value) != `{"host":"a"}` {
+		t.Fatalf("state not replicated: %v %+v", err, entry)
+	}
+	if _, err := specs.New(replica).Get(ctx, "TW", "api"); err != nil {
+		t.Errorf("spec not replicated: %v", err)
+	}
+	if _, err := state.New(replica).Get(ctx, "local-only"); err == nil {
+		t.Error("replica-only key should be replaced by the primary's data")
+	}
+
+	// Later writes on the primary arrive on the next sync.
+	state.New(primary).Put(ctx, "config/db", []byte(`{"host":"b"}`), "application/json", "")
+	f.Sync(ctx)
+	entry, _ = state.New(replica).Get(ctx, "config/db")
+	if string(entry.Value) != `{"host":"b"}` || entry.Version != 2 {
+		t.Errorf("update not replicated: %s v%d", entry.Value, entry.Version)
+	}
+
+	st := f.Status()
+	if st.Syncs != 2 || st.LastSync == nil || st.LastError != "" {
+		t.Errorf("unexpected status: %+v", st)
+	}
+}
+
+func TestFollowerSyncError(t *testing.T) {
+	primary := openDB(t)
+	replica := openDB(t)
+	ts := primaryServer(t, primary, "secret")
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	f := replication.NewFollower(replica, ts.URL, "wrong", time.Minute, logger)
+	if err := f.Sync(context.Background()); err == nil {
+		t.Fatal("expected error with bad token")
+	}
+	if st := f.Status(); st.LastError == "" || st.Syncs != 0 {
+		t.Errorf("unexpected status: %+v", st)
+	}
+}
+
+func TestExportRestore(t *testing.T) {
+	ctx := context.Background()
+	source := openDB(t)
+	target := openDB(t)
+
+	state.New(source).Put(ctx, "config/db", []byte(`{"host":"a"}`), "application/json", "")
+	state.New(source).Put(ctx, "config/db", []byte(`{"host":"b"}`), "application/json", "")
+	state.New(source).Put(ctx, "bin", []byte{0, 1, 2, 255}, "application/octet-stream", "")
+	specs.New(source).Put(ctx, "TW", "api", []byte(`{"kind":"contract"}`))
+	state.New(target).Put(ctx, "target-only", []byte(`1`), "application/json", "")
+
+	for _, format := range []string{"json", "sqlite"} {
+		var buf bytes.Buffer
+		src := replication.NewSource(source)
+		write := src.WriteSnapshot
+		if format == "json" {
+			write = src.WriteExport
+		}
+		if err := write(ctx, &buf); err != nil {
+			t.Fatal(err)
+		}
+
+		res, err := replication.NewSource(target).Restore(ctx, &buf)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if res.Format != format || res.Tables["state"] != 2 || res.Tables["specs"] != 1 {
+			t.Errorf("%s: unexpected result: %+v", format, res)
+		}
+		entry, err := state.New(target).Get(ctx, "config/db")
+		if err != nil || string(entry.Value) != `{"host":"b"}` || entry.Version != 2 {
+			t.Errorf("%s: state not restored: %v %+v", format, err, entry)
+		}
+		if entry, _ := state.New(target).Get(ctx, "bin"); entry == nil || !bytes.Equal(entry.Value, []byte{0, 1, 2, 255}) {
+			t.Errorf("%s: binary value not restored: %+v", format, entry)
+		}
+		if hist, _ := state.New(target).History(ctx, "config/db", 10); len(hist) != 2 {
+			t.Errorf("%s: expected 2 history versions, got %d", format, len(hist))
+		}
+		if _, err := specs.New(target).Get(ctx, "TW", "api"); err != nil {
+			t.Errorf("%s: spec not restored: %v", format, err)
+		}
+		if _, err := state.New(target).Get(ctx, "target-only"); err == nil {
+			t.Errorf("%s: target-only key should be replaced", format)
+		}
+	}
+
+	_, err := replication.NewSource(target).Restore(ctx, strings.NewReader(`{"format":"other"}`))
+	if !errors.Is(err, replication.ErrBadArchive) {
+		t.Errorf("expected ErrBadArchive, got %v", err)
+	}
+}
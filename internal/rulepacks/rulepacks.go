@@ -0,0 +1,408 @@
+// Package rulepacks installs rule packs: versioned bundles of validation
+// rules and contracts, optionally signed, that are shared between teams.
+//
+// A pack is installed into a project. Its rules are stored with source
+// "pack:<name>" and its contracts as specs, and the install is recorded so
+// a later version can replace it: rules and contracts the new version
+// drops are removed, and rules or specs the project owns itself are never
+// overwritten.
+package rulepacks
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DavidRHerbert/koor/internal/identity"
+	"github.com/DavidRHerbert/koor/internal/specs"
+)
+
+// Pack is a rule pack as distributed.
+type Pack struct {
+	Name        string       `json:"name"`
+	Version     string       `json:"version"`
+	Description string       `json:"description,omitempty"`
+	Author      string       `json:"author,omitempty"`
+	Rules       []specs.Rule `json:"rules"`
+	Contracts   []Contract   `json:"contracts,omitempty"`
+	Signature   *Signature   `json:"signature,omitempty"`
+}
+
+// Contract is a contract spec shipped in a pack, stored as the project's
+// spec of the same name.
+type Contract struct {
+	Name string          `json:"name"`
+	Spec json.RawMessage `json:"spec"`
+}
+
+// Signature is an Ed25519 signature of the pack's signing bytes.
+type Signature struct {
+	PublicKey string `json:"public_key"`
+	Value     string `json:"value"`
+}
+
+// Installed is a pack installed in a project.
+type Installed struct {
+	Project     string    `json:"project"`
+	Name        string    `json:"name"`
+	Version     string    `json:"version"`
+	Description string    `json:"description"`
+	Author      string    `json:"author"`
+	SignedBy    string    `json:"signed_by,omitempty"` // fingerprint of the signing key
+	Rules       []string  `json:"rules"`
+	Contracts   []string  `json:"contracts"`
+	InstalledAt time.Time `json:"installed_at"`
+}
+
+// Result describes what an install changed.
+type Result struct {
+	Project          string   `json:"project"`
+	Pack             string   `json:"pack"`
+	Version          string   `json:"version"`
+	PreviousVersion  string   `json:"previous_version,omitempty"`
+	Action           string   `json:"action"` // install, upgrade, downgrade, reinstall
+	SignedBy         string   `json:"signed_by,omitempty"`
+	RulesAdded       []string `json:"rules_added"`
+	RulesUpdated     []string `json:"rules_updated"`
+	RulesRemoved     []string `json:"rules_removed"`
+	ContractsStored  []string `json:"contracts_stored"`
+	ContractsRemoved []string `json:"contracts_removed"`
+	// Skipped lists rules and contracts left alone because the project
+	// already has its own with the same ID or name.
+	Skipped []string `json:"skipped"`
+}
+
+// ErrDowngrade is returned when installing an older version than the
+// installed one without allowing downgrades.
+var ErrDowngrade = errors.New("pack is older than the installed version")
+
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Parse decodes a pack and checks its fields and, if it is signed, its
+// signature.
+func Parse(data []byte) (*Pack, error) {
+	var p Pack
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("invalid pack JSON: %w", err)
+	}
+	if !namePattern.MatchString(p.Name) {
+		return nil, fmt.Errorf("invalid pack name %q", p.Name)
+	}
+	if _, err := parseVersion(p.Version); err != nil {
+		return nil, err
+	}
+	if len(p.Rules) == 0 && len(p.Contracts) == 0 {
+		return nil, fmt.Errorf("pack has no rules or contracts")
+	}
+	seen := map[string]bool{}
+	for i, rule := range p.Rules {
+		if rule.RuleID == "" || rule.Pattern == "" {
+			return nil, fmt.Errorf("rule %d: rule_id and pattern are required", i)
+		}
+		if seen[rule.RuleID] {
+			return nil, fmt.Errorf("duplicate rule_id %q", rule.RuleID)
+		}
+		seen[rule.RuleID] = true
+	}
+	names := map[string]bool{}
+	for i, c := range p.Contracts {
+		if c.Name == "" || len(c.Spec) == 0 || !json.Valid(c.Spec) {
+			return nil, fmt.Errorf("contract %d: name and a JSON spec are required", i)
+		}
+		if names[c.Name] {
+			return nil, fmt.Errorf("duplicate contract %q", c.Name)
+		}
+		names[c.Name] = true
+	}
+	if p.Signature != nil {
+		msg, err := SigningBytes(data)
+		if err != nil {
+			return nil, err
+		}
+		if !identity.Verify(p.Signature.PublicKey, msg, p.Signature.Value) {
+			return nil, fmt.Errorf("pack signature does not verify")
+		}
+	}
+	return &p, nil
+}
+
+// SigningBytes returns the bytes a pack's signature covers: the pack JSON
+// without its "signature" field, re-encoded with sorted keys and no
+// whitespace, so any tool can reproduce it.
+func SigningBytes(data []byte) ([]byte, error) {
+	var m map[string]any
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("invalid pack JSON: %w", err)
+	}
+	delete(m, "signature")
+	return json.Marshal(m)
+}
+
+// Fingerprint identifies a signing key: the first 16 hex digits of the
+// SHA-256 of the raw public key.
+func Fingerprint(publicKey string) string {
+	b, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:8])
+}
+
+// parseVersion reads a dotted numeric version such as "1.4.0" or "v2.1",
+// ignoring any pre-release or build suffix.
+func parseVersion(v string) ([]int, error) {
+	core := strings.TrimPrefix(v, "v")
+	if i := strings.IndexAny(core, "-+"); i >= 0 {
+		core = core[:i]
+	}
+	var parts []int
+	for _, s := range strings.Split(core, ".") {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid pack version %q (want e.g. 1.2.0)", v)
+		}
+		parts = append(parts, n)
+	}
+	return parts, nil
+}
+
+// compareVersions returns -1, 0 or 1 as a is older than, the same as or
+// newer than b.
+func compareVersions(a, b string) int {
+	va, _ := parseVersion(a)
+	vb, _ := parseVersion(b)
+	for len(va) < len(vb) {
+		va = append(va, 0)
+	}
+	for len(vb) < len(va) {
+		vb = append(vb, 0)
+	}
+	return slices.Compare(va, vb)
+}
+
+// Store installs packs and records which rules and contracts came from
+// which pack.
+type Store struct {
+	db    *sql.DB
+	specs *specs.Registry
+}
+
+// New creates a rule pack Store.
+func New(db *sql.DB, reg *specs.Registry) *Store {
+	return &Store{db: db, specs: reg}
+}
+
+// List returns the installed packs, of one project or of all of them.
+func (s *Store) List(ctx context.Context, project string) ([]Installed, error) {
+	query := `SELECT project, name, version, description, author, signed_by, rules, contracts, installed_at
+	          FROM rule_packs`
+	var args []any
+	if project != "" {
+		query += ` WHERE project = ?`
+		args = append(args, project)
+	}
+	query += ` ORDER BY project, name`
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list rule packs: %w", err)
+	}
+	defer rows.Close()
+
+	list := []Installed{}
+	for rows.Next() {
+		var p Installed
+		var rules, contracts string
+		if err := rows.Scan(&p.Project, &p.Name, &p.Version, &p.Description, &p.Author, &p.SignedBy,
+			&rules, &contracts, &p.InstalledAt); err != nil {
+			return nil, fmt.Errorf("scan rule pack: %w", err)
+		}
+		json.Unmarshal([]byte(rules), &p.Rules)
+		json.Unmarshal([]byte(contracts), &p.Contracts)
+		list = append(list, p)
+	}
+	return list, rows.Err()
+}
+
+// Get returns a pack installed in a project, or sql.ErrNoRows.
+func (s *Store) Get(ctx context.Context, project, name string) (*Installed, error) {
+	list, err := s.List(ctx, project)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range list {
+		if p.Name == name {
+			return &p, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+// Install installs a pack into a project, or replaces the installed
+// version of it. Installing an older version fails with ErrDowngrade
+// unless allowDowngrade is set.
+func (s *Store) Install(ctx context.Context, project string, pack *Pack, allowDowngrade bool) (*Result, error) {
+	if project == "" {
+		return nil, fmt.Errorf("project is required")
+	}
+	res := &Result{
+		Project: project, Pack: pack.Name, Version: pack.Version, Action: "install",
+		RulesAdded: []string{}, RulesUpdated: []string{}, RulesRemoved: []string{},
+		ContractsStored: []string{}, ContractsRemoved: []string{}, Skipped: []string{},
+	}
+	if pack.Signature != nil {
+		res.SignedBy = Fingerprint(pack.Signature.PublicKey)
+	}
+
+	prev, err := s.Get(ctx, project, pack.Name)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if prev != nil {
+		res.PreviousVersion = prev.Version
+		switch c := compareVersions(pack.Version, prev.Version); {
+		case c > 0:
+			res.Action = "upgrade"
+		case c == 0:
+			res.Action = "reinstall"
+		case !allowDowngrade:
+			return nil, fmt.Errorf("%w: %s %s is installed, got %s", ErrDowngrade, pack.Name, prev.Version, pack.Version)
+		default:
+			res.Action = "downgrade"
+		}
+	} else {
+		prev = &Installed{}
+	}
+
+	// Contracts first: they are stored through the spec registry, which
+	// keeps their version history.
+	var contracts []string
+	for _, c := range pack.Contracts {
+		existing, err := s.specs.Get(ctx, project, c.Name)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		if existing != nil && !slices.Contains(prev.Contracts, c.Name) {
+			res.Skipped = append(res.Skipped, "contract:"+c.Name)
+			continue
+		}
+		if existing == nil || string(existing.Data) != string(c.Spec) {
+			if _, err := s.specs.Put(ctx, project, c.Name, c.Spec); err != nil {
+				return nil, fmt.Errorf("store contract %s: %w", c.Name, err)
+			}
+		}
+		contracts = append(contracts, c.Name)
+		res.ContractsStored = append(res.ContractsStored, c.Name)
+	}
+	for _, name := range prev.Contracts {
+		if slices.Contains(contracts, name) {
+			continue
+		}
+		if err := s.specs.Delete(ctx, project, name); err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("remove contract %s: %w", name, err)
+		}
+		res.ContractsRemoved = append(res.ContractsRemoved, name)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	source := "pack:" + pack.Name
+	var rules []string
+	for _, rule := range pack.Rules {
+		var current string
+		err := tx.QueryRowContext(ctx,
+			`SELECT source FROM validation_rules WHERE project = ? AND rule_id = ?`,
+			project, rule.RuleID).Scan(&current)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			res.RulesAdded = append(res.RulesAdded, rule.RuleID)
+		case err != nil:
+			return nil, fmt.Errorf("check rule %s: %w", rule.RuleID, err)
+		case current != source:
+			res.Skipped = append(res.Skipped, "rule:"+rule.RuleID)
+			continue
+		default:
+			res.RulesUpdated = append(res.RulesUpdated, rule.RuleID)
+		}
+
+		if rule.Severity == "" {
+			rule.Severity = "error"
+		}
+		if rule.MatchType == "" {
+			rule.MatchType = "regex"
+		}
+		appliesTo, _ := json.Marshal(rule.AppliesTo)
+		if rule.AppliesTo == nil {
+			appliesTo = []byte(`["*"]`)
+		}
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO validation_rules (project, rule_id, severity, match_type, pattern, message, stack, applies_to, source, status, context)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, 'accepted', ?)
+			 ON CONFLICT (project, rule_id) DO UPDATE SET
+			   severity = excluded.severity, match_type = excluded.match_type,
+			   pattern = excluded.pattern, message = excluded.message,
+			   stack = excluded.stack, applies_to = excluded.applies_to,
+			   context = excluded.context, status = 'accepted'`,
+			project, rule.RuleID, rule.Severity, rule.MatchType, rule.Pattern,
+			rule.Message, rule.Stack, string(appliesTo), source, rule.Context)
+		if err != nil {
+			return nil, fmt.Errorf("install rule %s: %w", rule.RuleID, err)
+		}
+		rules = append(rules, rule.RuleID)
+	}
+	for _, id := range prev.Rules {
+		if slices.Contains(rules, id) {
+			continue
+		}
+		r, err := tx.ExecContext(ctx,
+			`DELETE FROM validation_rules WHERE project = ? AND rule_id = ? AND source = ?`,
+			project, id, source)
+		if err != nil {
+			return nil, fmt.Errorf("remove rule %s: %w", id, err)
+		}
+		if n, _ := r.RowsAffected(); n > 0 {
+			res.RulesRemoved = append(res.RulesRemoved, id)
+		}
+	}
+
+	rulesJSON, _ := json.Marshal(nonNil(rules))
+	contractsJSON, _ := json.Marshal(nonNil(contracts))
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO rule_packs (project, name, version, description, author, signed_by, rules, contracts, installed_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, datetime('now'))
+		 ON CONFLICT (project, name) DO UPDATE SET
+		   version = excluded.version, description = excluded.description,
+		   author = excluded.author, signed_by = excluded.signed_by,
+		   rules = excluded.rules, contracts = excluded.contracts,
+		   installed_at = excluded.installed_at`,
+		project, pack.Name, pack.Version, pack.Description, pack.Author, res.SignedBy,
+		string(rulesJSON), string(contractsJSON))
+	if err != nil {
+		return nil, fmt.Errorf("record rule pack: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit rule pack: %w", err)
+	}
+	return res, nil
+}
+
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
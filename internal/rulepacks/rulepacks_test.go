@@ -0,0 +1,145 @@
+package rulepacks_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/DavidRHerbert/koor/internal/db"
+	"github.com/DavidRHerbert/koor/internal/identity"
+	"github.com/DavidRHerbert/koor/internal/rulepacks"
+	"github.com/DavidRHerbert/koor/internal/specs"
+)
+
+func setup(t *testing.T) (*rulepacks.Store, *specs.Registry) {
+	t.Helper()
+	database, err := db.OpenMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	reg := specs.New(database)
+	return rulepacks.New(database, reg), reg
+}
+
+func parse(t *testing.T, data string) *rulepacks.Pack {
+	t.Helper()
+	pack, err := rulepacks.Parse([]byte(data))
+	if err != nil {
+		t.Fatalf("parse pack: %v", err)
+	}
+	return pack
+}
+
+func TestInstallUpgradeDowngrade(t *testing.T) {
+	ctx := context.Background()
+	store, reg := setup(t)
+	reg.PutRules(ctx, "app", []specs.Rule{{RuleID: "no-todo", Pattern: "FIXME"}})
+
+	v1 := parse(t, `{"name":"web-basics","version":"1.0.0","rules":[
+		{"rule_id":"no-console","pattern":"console\\.log"},
+		{"rule_id":"no-eval","pattern":"eval\\("},
+		{"rule_id":"no-todo","pattern":"TODO"}],
+		"contracts":[{"name":"api","spec":{"endpoints":{}}}]}`)
+	res, err := store.Install(ctx, "app", v1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Action != "install" || len(res.RulesAdded) != 2 || !slices.Equal(res.Skipped, []string{"rule:no-todo"}) {
+		t.Fatalf("unexpected install result: %+v", res)
+	}
+	rule, err := reg.GetRule(ctx, "app", "no-console")
+	if err != nil || rule.Source != "pack:web-basics" || rule.Status != "accepted" || rule.Severity != "error" {
+		t.Fatalf("expected pack rule, got %+v, %v", rule, err)
+	}
+	if rule, _ := reg.GetRule(ctx, "app", "no-todo"); rule.Pattern != "FIXME" {
+		t.Errorf("local rule was overwritten: %+v", rule)
+	}
+	if _, err := reg.Get(ctx, "app", "api"); err != nil {
+		t.Fatalf("expected contract spec: %v", err)
+	}
+
+	// 1.1.0 drops no-eval and the contract.
+	v2 := parse(t, `{"name":"web-basics","version":"1.1.0","rules":[
+		{"rule_id":"no-console","pattern":"console\\.(log|debug)"}]}`)
+	res, err = store.Install(ctx, "app", v2, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Action != "upgrade" || res.PreviousVersion != "1.0.0" ||
+		!slices.Equal(res.RulesRemoved, []string{"no-eval"}) || !slices.Equal(res.ContractsRemoved, []string{"api"}) {
+		t.Fatalf("unexpected upgrade result: %+v", res)
+	}
+	if _, err := reg.GetRule(ctx, "app", "no-eval"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("no-eval should have been removed, got %v", err)
+	}
+	if _, err := reg.GetRule(ctx, "app", "no-todo"); err != nil {
+		t.Errorf("local rule should be kept: %v", err)
+	}
+
+	// Going back needs allowDowngrade.
+	if _, err := store.Install(ctx, "app", v1, false); !errors.Is(err, rulepacks.ErrDowngrade) {
+		t.Fatalf("expected ErrDowngrade, got %v", err)
+	}
+	res, err = store.Install(ctx, "app", v1, true)
+	if err != nil || res.Action != "downgrade" || len(res.RulesAdded) != 1 {
+		t.Fatalf("unexpected downgrade result: %+v, %v", res, err)
+	}
+
+	list, err := store.List(ctx, "app")
+	if err != nil || len(list) != 1 {
+		t.Fatalf("expected 1 installed pack, got %+v, %v", list, err)
+	}
+	if list[0].Version != "1.0.0" || !slices.Equal(list[0].Rules, []string{"no-console", "no-eval"}) {
+		t.Errorf("unexpected installed pack: %+v", list[0])
+	}
+}
+
+func TestParseSignature(t *testing.T) {
+	pub, priv, err := identity.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsigned := []byte(`{"name":"sec","version":"v2.0","author":"platform",
+		"rules":[{"rule_id":"no-secrets","pattern":"AKIA[0-9A-Z]{16}"}]}`)
+	msg, err := rulepacks.SigningBytes(unsigned)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := identity.Sign(priv, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]any
+	json.Unmarshal(unsigned, &m)
+	m["signature"] = map[string]string{"public_key": pub, "value": sig}
+	signed, _ := json.MarshalIndent(m, "", "  ")
+
+	pack, err := rulepacks.Parse(signed)
+	if err != nil {
+		t.Fatalf("signed pack rejected: %v", err)
+	}
+	if rulepacks.Fingerprint(pack.Signature.PublicKey) == "" {
+		t.Error("expected a key fingerprint")
+	}
+
+	m["author"] = "someone else"
+	tampered, _ := json.Marshal(m)
+	if _, err := rulepacks.Parse(tampered); err == nil {
+		t.Error("tampered pack should be rejected")
+	}
+
+	for _, bad := range []string{
+		`{"name":"x","version":"one","rules":[{"rule_id":"a","pattern":"b"}]}`,
+		`{"name":"../x","version":"1.0","rules":[{"rule_id":"a","pattern":"b"}]}`,
+		`{"name":"x","version":"1.0","rules":[{"rule_id":"a"}]}`,
+		`{"name":"x","version":"1.0"}`,
+	} {
+		if _, err := rulepacks.Parse([]byte(bad)); err == nil {
+			t.Errorf("expected %s to be rejected", bad)
+		}
+	}
+}
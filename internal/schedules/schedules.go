@@ -0,0 +1,367 @@
+// Package schedules publishes events on a timetable. A schedule pairs a
+// cron expression with a topic and a payload template; the Scheduler
+// checks for due schedules in the background and publishes their events,
+// so agents can subscribe to e.g. a nightly "truck-wash.standup" instead
+// of keeping their own timers.
+//
+// Payload templates may use these placeholders in string values:
+//
+//	{schedule}   the schedule's name, or its ID when unnamed
+//	{id}         the schedule's ID
+//	{timestamp}  the run time, RFC 3339
+//	{date}       the run date, YYYY-MM-DD
+//	{time}       the run time of day, HH:MM
+//	{weekday}    the run day, e.g. Monday
+//
+// Dates and times are in the schedule's timezone.
+package schedules
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/DavidRHerbert/koor/internal/events"
+	"github.com/google/uuid"
+)
+
+// defaultPayload is published by schedules that set no payload.
+const defaultPayload = `{"schedule":"{schedule}","timestamp":"{timestamp}"}`
+
+// Schedule is a stored cron schedule.
+type Schedule struct {
+	ID          string          `json:"id"`
+	Name        string          `json:"name"`
+	Cron        string          `json:"cron"`
+	Timezone    string          `json:"timezone,omitempty"`
+	Topic       string          `json:"topic"`
+	Payload     json.RawMessage `json:"payload,omitempty"`
+	Description string          `json:"description,omitempty"`
+	Paused      bool            `json:"paused"`
+	Fired       int64           `json:"fired"`
+	LastError   string          `json:"last_error,omitempty"`
+	LastFired   *time.Time      `json:"last_fired,omitempty"`
+	NextRun     *time.Time      `json:"next_run,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+// Validate checks that a schedule is well-formed.
+func Validate(s *Schedule) error {
+	if s.Cron == "" {
+		return fmt.Errorf("cron is required")
+	}
+	if _, err := ParseCron(s.Cron); err != nil {
+		return err
+	}
+	if _, err := time.LoadLocation(s.Timezone); err != nil {
+		return fmt.Errorf("unknown timezone %q", s.Timezone)
+	}
+	if s.Topic == "" {
+		return fmt.Errorf("topic is required")
+	}
+	if strings.HasPrefix(s.Topic, events.InternalPrefix) {
+		return events.ErrInternalTopic
+	}
+	if strings.ContainsAny(s.Topic, "*?[") {
+		return fmt.Errorf("topic %q must not contain wildcards", s.Topic)
+	}
+	if len(s.Payload) > 0 && !json.Valid(s.Payload) {
+		return fmt.Errorf("payload must be valid JSON")
+	}
+	return nil
+}
+
+// nextRun returns the schedule's first run after t, or nil if its
+// expression never matches again.
+func (s Schedule) nextRun(t time.Time) *time.Time {
+	c, err := ParseCron(s.Cron)
+	if err != nil {
+		return nil
+	}
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return nil
+	}
+	next := c.Next(t.In(loc))
+	if next.IsZero() {
+		return nil
+	}
+	next = next.UTC()
+	return &next
+}
+
+// Render expands the schedule's payload template for a run at t.
+func (s Schedule) Render(t time.Time) (json.RawMessage, error) {
+	if loc, err := time.LoadLocation(s.Timezone); err == nil {
+		t = t.In(loc)
+	}
+	name := s.Name
+	if name == "" {
+		name = s.ID
+	}
+	r := strings.NewReplacer(
+		"{schedule}", name,
+		"{id}", s.ID,
+		"{timestamp}", t.Format(time.RFC3339),
+		"{date}", t.Format("2006-01-02"),
+		"{time}", t.Format("15:04"),
+		"{weekday}", t.Weekday().String(),
+	)
+	tmpl := s.Payload
+	if len(tmpl) == 0 {
+		tmpl = json.RawMessage(defaultPayload)
+	}
+	var v any
+	if err := json.Unmarshal(tmpl, &v); err != nil {
+		return nil, fmt.Errorf("decode payload: %w", err)
+	}
+	return json.Marshal(expand(v, r))
+}
+
+// expand replaces placeholders in every string of a decoded JSON value.
+func expand(v any, r *strings.Replacer) any {
+	switch v := v.(type) {
+	case string:
+		return r.Replace(v)
+	case []any:
+		for i := range v {
+			v[i] = expand(v[i], r)
+		}
+	case map[string]any:
+		for k := range v {
+			v[k] = expand(v[k], r)
+		}
+	}
+	return v
+}
+
+// source is the event source of the schedule's events.
+func (s Schedule) source() string {
+	if s.Name != "" {
+		return "schedule:" + s.Name
+	}
+	return "schedule:" + s.ID
+}
+
+// Scheduler stores schedules and publishes their events when due.
+type Scheduler struct {
+	db       *sql.DB
+	eventBus *events.Bus
+	interval time.Duration
+	logger   *slog.Logger
+	stop     chan struct{}
+}
+
+// New creates a Scheduler that checks for due schedules every interval
+// once started.
+func New(db *sql.DB, eventBus *events.Bus, interval time.Duration, logger *slog.Logger) *Scheduler {
+	if interval <= 0 {
+		interval = 15 * time.Second
+	}
+	return &Scheduler{
+		db:       db,
+		eventBus: eventBus,
+		interval: interval,
+		logger:   logger,
+		stop:     make(chan struct{}),
+	}
+}
+
+// Start begins checking for due schedules in a background goroutine.
+func (s *Scheduler) Start() {
+	go func() {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := s.FireDue(context.Background(), time.Now()); err != nil {
+					s.logger.Error("schedule check failed", "error", err)
+				}
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop shuts down the background checks.
+func (s *Scheduler) Stop() {
+	select {
+	case s.stop <- struct{}{}:
+	default:
+	}
+}
+
+const selectSchedule = `SELECT id, name, cron, timezone, topic, payload, description, paused,
+	fired, last_error, last_fired, next_run, created_at FROM schedules`
+
+func scanSchedule(row interface{ Scan(...any) error }) (*Schedule, error) {
+	var sc Schedule
+	var payload string
+	var lastFired, nextRun sql.NullTime
+	if err := row.Scan(&sc.ID, &sc.Name, &sc.Cron, &sc.Timezone, &sc.Topic, &payload, &sc.Description,
+		&sc.Paused, &sc.Fired, &sc.LastError, &lastFired, &nextRun, &sc.CreatedAt); err != nil {
+		return nil, err
+	}
+	if payload != "" {
+		sc.Payload = json.RawMessage(payload)
+	}
+	if lastFired.Valid {
+		sc.LastFired = &lastFired.Time
+	}
+	if nextRun.Valid && !sc.Paused {
+		sc.NextRun = &nextRun.Time
+	}
+	return &sc, nil
+}
+
+// dbTime formats a time for a DATETIME column, or NULL for nil.
+func dbTime(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return t.UTC().Format("2006-01-02 15:04:05")
+}
+
+// Create validates and stores a schedule, assigning it an ID and its
+// first run time.
+func (s *Scheduler) Create(ctx context.Context, sc Schedule) (*Schedule, error) {
+	if err := Validate(&sc); err != nil {
+		return nil, err
+	}
+	sc.ID = uuid.New().String()
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO schedules (id, name, cron, timezone, topic, payload, description, paused, next_run, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, datetime('now'))`,
+		sc.ID, sc.Name, sc.Cron, sc.Timezone, sc.Topic, string(sc.Payload), sc.Description, sc.Paused,
+		dbTime(sc.nextRun(time.Now())))
+	if err != nil {
+		return nil, fmt.Errorf("insert schedule: %w", err)
+	}
+	return s.Get(ctx, sc.ID)
+}
+
+// Update replaces a schedule's definition, keeping its counters, and
+// recomputes its next run. Returns sql.ErrNoRows if not found.
+func (s *Scheduler) Update(ctx context.Context, sc Schedule) (*Schedule, error) {
+	if err := Validate(&sc); err != nil {
+		return nil, err
+	}
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE schedules SET name = ?, cron = ?, timezone = ?, topic = ?, payload = ?, description = ?,
+		 paused = ?, next_run = ? WHERE id = ?`,
+		sc.Name, sc.Cron, sc.Timezone, sc.Topic, string(sc.Payload), sc.Description, sc.Paused,
+		dbTime(sc.nextRun(time.Now())), sc.ID)
+	if err != nil {
+		return nil, fmt.Errorf("update schedule: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return s.Get(ctx, sc.ID)
+}
+
+// Get returns a schedule by ID. Returns sql.ErrNoRows if not found.
+func (s *Scheduler) Get(ctx context.Context, id string) (*Schedule, error) {
+	return scanSchedule(s.db.QueryRowContext(ctx, selectSchedule+` WHERE id = ?`, id))
+}
+
+// List returns all schedules.
+func (s *Scheduler) List(ctx context.Context) ([]Schedule, error) {
+	return s.query(ctx, selectSchedule+` ORDER BY created_at, id`)
+}
+
+func (s *Scheduler) query(ctx context.Context, query string, args ...any) ([]Schedule, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query schedules: %w", err)
+	}
+	defer rows.Close()
+
+	list := []Schedule{}
+	for rows.Next() {
+		sc, err := scanSchedule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan schedule: %w", err)
+		}
+		list = append(list, *sc)
+	}
+	return list, rows.Err()
+}
+
+// Delete removes a schedule. Returns sql.ErrNoRows if not found.
+func (s *Scheduler) Delete(ctx context.Context, id string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM schedules WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("delete schedule: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// FireDue publishes the event of every active schedule whose next run is
+// at or before now, and moves each to its next run after now. A schedule
+// that missed several runs, e.g. while the server was down, fires once.
+func (s *Scheduler) FireDue(ctx context.Context, now time.Time) ([]events.Event, error) {
+	due, err := s.query(ctx, selectSchedule+` WHERE paused = 0 AND next_run IS NOT NULL AND next_run <= ?
+		ORDER BY next_run, id`, dbTime(&now))
+	if err != nil {
+		return nil, err
+	}
+	var fired []events.Event
+	for _, sc := range due {
+		ev, err := s.fire(ctx, sc, now)
+		if _, uerr := s.db.ExecContext(ctx, `UPDATE schedules SET next_run = ? WHERE id = ?`,
+			dbTime(sc.nextRun(now)), sc.ID); uerr != nil {
+			return fired, fmt.Errorf("advance schedule: %w", uerr)
+		}
+		if err != nil {
+			s.logger.Warn("scheduled event failed", "schedule", sc.ID, "topic", sc.Topic, "error", err)
+			continue
+		}
+		fired = append(fired, *ev)
+	}
+	return fired, nil
+}
+
+// Run publishes a schedule's event now, without changing its next run.
+// Returns sql.ErrNoRows if not found.
+func (s *Scheduler) Run(ctx context.Context, id string) (*events.Event, error) {
+	sc, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.fire(ctx, *sc, time.Now())
+}
+
+// fire publishes one run of a schedule and records the outcome on it.
+func (s *Scheduler) fire(ctx context.Context, sc Schedule, at time.Time) (*events.Event, error) {
+	ev, err := s.publish(ctx, sc, at)
+	if err != nil {
+		s.db.ExecContext(ctx, `UPDATE schedules SET last_error = ? WHERE id = ?`, err.Error(), sc.ID)
+		return nil, err
+	}
+	s.db.ExecContext(ctx,
+		`UPDATE schedules SET fired = fired + 1, last_error = '', last_fired = ? WHERE id = ?`,
+		dbTime(&at), sc.ID)
+	return ev, nil
+}
+
+func (s *Scheduler) publish(ctx context.Context, sc Schedule, at time.Time) (*events.Event, error) {
+	if s.eventBus == nil {
+		return nil, errors.New("no event bus")
+	}
+	data, err := sc.Render(at)
+	if err != nil {
+		return nil, err
+	}
+	return s.eventBus.Publish(ctx, sc.Topic, data, sc.source())
+}
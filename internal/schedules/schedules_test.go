@@ -0,0 +1,177 @@
+package schedules_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/DavidRHerbert/koor/internal/db"
+	"github.com/DavidRHerbert/koor/internal/events"
+	"github.com/DavidRHerbert/koor/internal/schedules"
+)
+
+func TestCronNext(t *testing.T) {
+	// Wednesday 2026-10-14 08:30 UTC.
+	from := time.Date(2026, 10, 14, 8, 30, 0, 0, time.UTC)
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"0 9 * * *", time.Date(2026, 10, 14, 9, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2026, 10, 14, 8, 45, 0, 0, time.UTC)},
+		{"30 8 * * *", time.Date(2026, 10, 15, 8, 30, 0, 0, time.UTC)},
+		{"0 9 * * mon-fri", time.Date(2026, 10, 14, 9, 0, 0, 0, time.UTC)},
+		{"0 9 * * sat,sun", time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC)},
+		{"0 0 1 jan *", time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 12 1 * 5", time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)}, // day 1 or a Friday
+		{"0 0 * * 7", time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2026, 10, 14, 9, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		c, err := schedules.ParseCron(tt.expr)
+		if err != nil {
+			t.Errorf("ParseCron(%q): %v", tt.expr, err)
+			continue
+		}
+		if got := c.Next(from); !got.Equal(tt.want) {
+			t.Errorf("Next(%q) = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+
+	c, _ := schedules.ParseCron("0 0 30 2 *")
+	if got := c.Next(from); !got.IsZero() {
+		t.Errorf("Feb 30 should never match, got %v", got)
+	}
+
+	for _, bad := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "5-1 * * * *", "*/0 * * * *", "* * * foo *"} {
+		if _, err := schedules.ParseCron(bad); err == nil {
+			t.Errorf("ParseCron(%q): expected an error", bad)
+		}
+	}
+}
+
+func TestCronNextInZone(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Skip("no tz database")
+	}
+	c, _ := schedules.ParseCron("0 9 * * *")
+	// The day after the clocks go back, 9:00 local is 9:00 UTC again.
+	got := c.Next(time.Date(2026, 10, 25, 10, 0, 0, 0, loc))
+	if want := time.Date(2026, 10, 26, 9, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("Next = %v, want %v", got.UTC(), want)
+	}
+}
+
+func TestRender(t *testing.T) {
+	sc := schedules.Schedule{ID: "s1", Name: "standup", Timezone: "UTC",
+		Payload: json.RawMessage(`{"kind":"{schedule}","on":"{date} {time}","day":["{weekday}"],"n":1,"keep":"{other}"}`)}
+	got, err := sc.Render(time.Date(2026, 10, 15, 9, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"day":["Thursday"],"keep":"{other}","kind":"standup","n":1,"on":"2026-10-15 09:00"}`
+	if string(got) != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	got, _ = schedules.Schedule{ID: "s1"}.Render(time.Date(2026, 10, 15, 9, 0, 0, 0, time.UTC))
+	if want := `{"schedule":"s1","timestamp":"2026-10-15T09:00:00Z"}`; string(got) != want {
+		t.Errorf("default payload = %s, want %s", got, want)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	bad := []schedules.Schedule{
+		{Topic: "a.b"},
+		{Cron: "0 9 * * *"},
+		{Cron: "0 9 * * *", Topic: "a.*"},
+		{Cron: "0 9 * * *", Topic: "_internal.audit"},
+		{Cron: "0 9 * * *", Topic: "a.b", Timezone: "Mars/Olympus"},
+		{Cron: "0 9 * * *", Topic: "a.b", Payload: json.RawMessage(`{`)},
+		{Cron: "0 25 * * *", Topic: "a.b"},
+	}
+	for _, sc := range bad {
+		if err := schedules.Validate(&sc); err == nil {
+			t.Errorf("expected %+v to be invalid", sc)
+		}
+	}
+}
+
+func TestFireDue(t *testing.T) {
+	database, err := db.OpenMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+	bus := events.New(database, 100)
+	sched := schedules.New(database, bus, 0, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	ctx := context.Background()
+
+	sc, err := sched.Create(ctx, schedules.Schedule{Name: "standup", Cron: "0 9 * * *", Topic: "truck-wash.standup",
+		Payload: json.RawMessage(`{"date":"{date}"}`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sc.NextRun == nil || sc.NextRun.Hour() != 9 || sc.NextRun.Minute() != 0 {
+		t.Fatalf("next_run = %v, want 09:00", sc.NextRun)
+	}
+	paused, err := sched.Create(ctx, schedules.Schedule{Cron: "* * * * *", Topic: "never.fires", Paused: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if paused.NextRun != nil {
+		t.Errorf("paused schedule has next_run %v", paused.NextRun)
+	}
+
+	before := sc.NextRun.Add(-time.Minute)
+	if fired, _ := sched.FireDue(ctx, before); len(fired) != 0 {
+		t.Fatalf("fired %d events before the run time", len(fired))
+	}
+
+	// Two days late: fires once and moves to the next 09:00 after now.
+	late := sc.NextRun.Add(48*time.Hour + 5*time.Minute)
+	fired, err := sched.FireDue(ctx, late)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fired) != 1 || fired[0].Topic != "truck-wash.standup" || fired[0].Source != "schedule:standup" {
+		t.Fatalf("fired = %+v", fired)
+	}
+	if want := `{"date":"` + late.UTC().Format("2006-01-02") + `"}`; string(fired[0].Data) != want {
+		t.Errorf("data = %s, want %s", fired[0].Data, want)
+	}
+	got, _ := sched.Get(ctx, sc.ID)
+	if got.Fired != 1 || got.LastFired == nil || !got.NextRun.After(late) || got.NextRun.Sub(late) > 24*time.Hour {
+		t.Errorf("after firing: fired=%d last_fired=%v next_run=%v", got.Fired, got.LastFired, got.NextRun)
+	}
+	if fired, _ := sched.FireDue(ctx, late); len(fired) != 0 {
+		t.Errorf("fired again at the same time: %d", len(fired))
+	}
+
+	ev, err := sched.Run(ctx, sc.ID)
+	if err != nil || ev.Topic != "truck-wash.standup" {
+		t.Fatalf("Run = %+v, %v", ev, err)
+	}
+	if again, _ := sched.Get(ctx, sc.ID); again.Fired != 2 || !again.NextRun.Equal(*got.NextRun) {
+		t.Errorf("Run should count but keep next_run: fired=%d next_run=%v", again.Fired, again.NextRun)
+	}
+
+	sc.Paused = true
+	if updated, err := sched.Update(ctx, *sc); err != nil || updated.NextRun != nil || updated.Fired != 2 {
+		t.Errorf("pause: %+v, %v", updated, err)
+	}
+	if err := sched.Delete(ctx, sc.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sched.Get(ctx, sc.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Get after delete: %v", err)
+	}
+}
@@ -0,0 +1,100 @@
+package search
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Types lists the resource types that are indexed for search.
+var Types = []string{"state", "specs", "rules", "events", "templates"}
+
+// Result is a single search hit.
+type Result struct {
+	Type    string  `json:"type"`
+	Ref     string  `json:"ref"`
+	Title   string  `json:"title"`
+	Snippet string  `json:"snippet"`
+	Score   float64 `json:"score"`
+}
+
+// Index provides full-text search over the search_index FTS5 table,
+// which is kept in sync with the source tables by triggers.
+type Index struct {
+	db *sql.DB
+}
+
+// New creates a new search Index.
+func New(db *sql.DB) *Index {
+	return &Index{db: db}
+}
+
+// Search runs a full-text query. types restricts results to the given
+// resource types; empty means all. Results are ordered by relevance.
+func (idx *Index) Search(ctx context.Context, q string, types []string, limit int) ([]Result, error) {
+	if limit <= 0 {
+		limit = 20
+	}
+	match := matchExpr(q)
+	if match == "" {
+		return nil, fmt.Errorf("query is empty")
+	}
+	for _, t := range types {
+		if !validType(t) {
+			return nil, fmt.Errorf("unknown type %q (use %s)", t, strings.Join(Types, ", "))
+		}
+	}
+
+	query := `SELECT type, ref, title, snippet(search_index, 3, '[', ']', '...', 12), bm25(search_index)
+		FROM search_index WHERE search_index MATCH ?`
+	args := []any{match}
+	if len(types) > 0 {
+		query += ` AND type IN (?` + strings.Repeat(", ?", len(types)-1) + `)`
+		for _, t := range types {
+			args = append(args, t)
+		}
+	}
+	query += ` ORDER BY bm25(search_index) LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := idx.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("search: %w", err)
+	}
+	defer rows.Close()
+
+	var results []Result
+	for rows.Next() {
+		var r Result
+		if err := rows.Scan(&r.Type, &r.Ref, &r.Title, &r.Snippet, &r.Score); err != nil {
+			return nil, fmt.Errorf("scan search result: %w", err)
+		}
+		// bm25 is lower-is-better; flip it so higher scores rank first.
+		r.Score = -r.Score
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// matchExpr turns free text into an FTS5 expression: each term is quoted
+// so punctuation is taken literally, and the last term matches as a prefix.
+func matchExpr(q string) string {
+	terms := strings.Fields(q)
+	for i, t := range terms {
+		terms[i] = `"` + strings.ReplaceAll(t, `"`, `""`) + `"`
+	}
+	if len(terms) > 0 {
+		terms[len(terms)-1] += "*"
+	}
+	return strings.Join(terms, " ")
+}
+
+func validType(t string) bool {
+	for _, known := range Types {
+		if t == known {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+package search_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"testing"
+
+	"github.com/DavidRHerbert/koor/internal/db"
+	"github.com/DavidRHerbert/koor/internal/events"
+	"github.com/DavidRHerbert/koor/internal/search"
+	"github.com/DavidRHerbert/koor/internal/specs"
+	"github.com/DavidRHerbert/koor/internal/state"
+)
+
+type testEnv struct {
+	db    *sql.DB
+	state *state.Store
+	specs *specs.Registry
+	bus   *events.Bus
+	idx   *search.Index
+}
+
+func setup(t *testing.T) *testEnv {
+	t.Helper()
+	database, err := db.OpenMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	return &testEnv{
+		db:    database,
+		state: state.New(database),
+		specs: specs.New(database),
+		bus:   events.New(database, 100),
+		idx:   search.New(database),
+	}
+}
+
+func TestSearchAcrossTypes(t *testing.T) {
+	env := setup(t)
+	ctx := context.Background()
+
+	env.state.Put(ctx, "config/database", []byte(`{"host":"postgres.internal"}`), "application/json", "")
+	env.specs.Put(ctx, "TW", "api-contract", []byte(`{"kind":"contract","endpoints":{"GET /api/trucks":{}}}`))
+	env.bus.Publish(ctx, "deploy.finished", json.RawMessage(`{"service":"trucks"}`), "ci")
+
+	results, err := env.idx.Search(ctx, "trucks", nil, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d: %+v", len(results), results)
+	}
+	types := map[string]bool{}
+	for _, r := range results {
+		types[r.Type] = true
+	}
+	if !types["specs"] || !types["events"] {
+		t.Errorf("expected specs and events hits, got %+v", results)
+	}
+
+	results, _ = env.idx.Search(ctx, "trucks", []string{"specs"}, 10)
+	if len(results) != 1 || results[0].Ref != "TW/api-contract" {
+		t.Errorf("type filter failed: %+v", results)
+	}
+}
+
+func TestSearchPrefixAndPunctuation(t *testing.T) {
+	env := setup(t)
+	ctx := context.Background()
+	env.state.Put(ctx, "config/database", []byte(`{"host":"postgres.internal"}`), "application/json", "")
+
+	results, err := env.idx.Search(ctx, "postg", nil, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Ref != "config/database" {
+		t.Errorf("prefix search failed: %+v", results)
+	}
+
+	if _, err := env.idx.Search(ctx, `host:"a" OR (`, nil, 10); err != nil {
+		t.Errorf("punctuation should be treated literally: %v", err)
+	}
+}
+
+func TestSearchTracksUpdatesAndDeletes(t *testing.T) {
+	env := setup(t)
+	ctx := context.Background()
+
+	env.state.Put(ctx, "notes", []byte(`"alpha"`), "application/json", "")
+	env.state.Put(ctx, "notes", []byte(`"bravo"`), "application/json", "")
+
+	if r, _ := env.idx.Search(ctx, "alpha", nil, 10); len(r) != 0 {
+		t.Errorf("stale value still indexed: %+v", r)
+	}
+	if r, _ := env.idx.Search(ctx, "bravo", nil, 10); len(r) != 1 {
+		t.Errorf("updated value not indexed: %+v", r)
+	}
+
+	env.state.Delete(ctx, "notes", "")
+	if r, _ := env.idx.Search(ctx, "bravo", nil, 10); len(r) != 0 {
+		t.Errorf("deleted key still indexed: %+v", r)
+	}
+}
+
+func TestSearchRejectsUnknownType(t *testing.T) {
+	env := setup(t)
+	if _, err := env.idx.Search(context.Background(), "x", []string{"widgets"}, 10); err == nil {
+		t.Error("expected error for unknown type")
+	}
+	if _, err := env.idx.Search(context.Background(), "  ", nil, 10); err == nil {
+		t.Error("expected error for empty query")
+	}
+}
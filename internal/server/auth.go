@@ -1,19 +1,233 @@
 package server
 
-import "net/http"
+import (
+	"context"
+	"net/http"
+	"strings"
 
-// authMiddleware validates the Bearer token on every request.
-// If token is empty (local mode), all requests pass through.
-func authMiddleware(token string, next http.Handler) http.Handler {
-	if token == "" {
-		return next
-	}
-	expected := "Bearer " + token
+	"github.com/DavidRHerbert/koor/internal/tokens"
+	"github.com/DavidRHerbert/koor/internal/users"
+)
+
+const identityKey ctxKey = "identity"
+
+// authMiddleware authenticates the bearer token on every request.
+//
+// The global --auth-token grants full access. Any other bearer token is
+// resolved to an identity (an API token, a user, or an instance's
+// registration token) and checked against its scopes or, for users, role. If no global token is set (local
+// mode), requests without a recognised token pass through unchecked.
+func (s *Server) authMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.Header.Get("Authorization") != expected {
+		bearer, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if s.config.AuthToken != "" && bearer == s.config.AuthToken {
+			next.ServeHTTP(w, r)
+			return
+		}
+		id := s.resolveIdentity(r.Context(), bearer)
+		if id == nil {
+			if s.config.AuthToken == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
 			writeError(w, http.StatusUnauthorized, "invalid or missing bearer token")
 			return
 		}
-		next.ServeHTTP(w, r)
+		if id.Role != "" {
+			if perm := routeGroup(r); !users.Allows(id.Role, perm) {
+				s.logger.Warn("request denied by role", "user", id.Name, "role", id.Role, "method", r.Method, "path", r.URL.Path)
+				writeError(w, http.StatusForbidden, "user "+id.Name+" (role "+id.Role+") may not "+perm)
+				return
+			}
+		} else if reason := authorize(r, id); reason != "" {
+			s.logger.Warn("request denied by token scope", "token", id.Name, "method", r.Method, "path", r.URL.Path)
+			writeError(w, http.StatusForbidden, "token "+id.Name+" "+reason)
+			return
+		}
+		if reason := s.projectAccess(r, id); reason != "" {
+			s.logger.Warn("request denied by token project", "token", id.Name, "project", id.Project, "method", r.Method, "path", r.URL.Path)
+			writeError(w, http.StatusForbidden, "token "+id.Name+" "+reason)
+			return
+		}
+
+		// The token, not the client, decides who is calling.
+		r.Header.Del("X-Koor-Instance")
+		if id.InstanceID != "" {
+			r.Header.Set("X-Koor-Instance", id.InstanceID)
+		}
+		r.Header.Set("X-Koor-Actor", id.Name)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), identityKey, id)))
 	})
 }
+
+// resolveIdentity maps a bearer token to an identity, or nil if unknown.
+func (s *Server) resolveIdentity(ctx context.Context, bearer string) *tokens.Identity {
+	if bearer == "" {
+		return nil
+	}
+	if s.tokens != nil {
+		if t, err := s.tokens.Resolve(ctx, bearer); err == nil {
+			id := &tokens.Identity{TokenID: t.ID, Name: t.Name, InstanceID: t.InstanceID, Project: t.Project, Scopes: t.Scopes, Topics: t.Topics}
+			if t.InstanceID != "" {
+				inst, err := s.instanceReg.Get(ctx, t.InstanceID)
+				if err != nil {
+					return nil // bound to an instance that no longer exists
+				}
+				id.InstanceName = inst.Name
+			}
+			return id
+		}
+	}
+	if s.users != nil {
+		if u, err := s.users.Resolve(ctx, bearer); err == nil {
+			return &tokens.Identity{Name: u.Name, Role: u.Role, Scopes: []string{}}
+		}
+	}
+	if inst, err := s.instanceReg.GetByToken(ctx, bearer); err == nil {
+		return &tokens.Identity{
+			Name:         inst.Name,
+			InstanceID:   inst.ID,
+			InstanceName: inst.Name,
+			Scopes:       tokens.DefaultInstanceScopes,
+		}
+	}
+	return nil
+}
+
+// identityFromRequest returns the scoped identity of the caller, or nil for
+// the global token and unauthenticated local-mode requests.
+func identityFromRequest(r *http.Request) *tokens.Identity {
+	id, _ := r.Context().Value(identityKey).(*tokens.Identity)
+	return id
+}
+
+// adminRoute reports whether a request needs the admin scope or, for users,
+// the admin permission. It is the one list of admin-only routes, shared by
+// authorize and routeGroup.
+func adminRoute(r *http.Request) bool {
+	path := r.URL.Path
+	read := r.Method == http.MethodGet
+	switch {
+	case path == "/api/tokens/whoami":
+		return false
+	case strings.HasPrefix(path, "/api/tokens"), strings.HasPrefix(path, "/api/apikeys"), strings.HasPrefix(path, "/api/users"),
+		strings.HasPrefix(path, "/api/admin/"), strings.HasPrefix(path, "/api/replication/"),
+		path == "/api/metrics/reset", path == "/api/federation/sync":
+		return true
+	case path == "/api/projects" && r.Method == http.MethodPost:
+		return true
+	case path == "/api/policies/evaluate":
+		return false // a dry run: it changes nothing
+	case strings.HasPrefix(path, "/api/policies"), path == "/api/events/retention",
+		strings.HasPrefix(path, "/api/state-retention"), strings.HasPrefix(path, "/api/liveness/policies"),
+		strings.HasPrefix(path, "/api/projections"), strings.HasPrefix(path, "/api/schedules"):
+		return !read
+	}
+	return false
+}
+
+// authorize checks a request against an identity's scopes and returns why
+// it is denied, or "" if it is allowed.
+func authorize(r *http.Request, id *tokens.Identity) string {
+	path := r.URL.Path
+	if id.Has(tokens.ScopeAdmin) {
+		return ""
+	}
+	if path == "/api/tokens/whoami" {
+		return ""
+	}
+	if adminRoute(r) {
+		return "requires scope " + tokens.ScopeAdmin
+	}
+	switch {
+	case r.Method == http.MethodGet, r.Method == http.MethodHead, r.Method == http.MethodOptions,
+		isMockTraffic(path):
+		if id.Has(tokens.ScopeRead) {
+			return ""
+		}
+		return "requires scope " + tokens.ScopeRead
+	}
+	if (path == "/mcp" || path == "/api/graphql" || path == "/api/instances/match") && id.Has(tokens.ScopeRead) {
+		return ""
+	}
+
+	if key, ok := strings.CutPrefix(path, "/api/state/"); ok {
+		key = strings.TrimSuffix(key, "/meta")
+		if id.CanWriteState(key) {
+			return ""
+		}
+		return "may not write state key " + key
+	}
+	if id.Has(tokens.ScopeWrite) {
+		return ""
+	}
+	if path == "/api/events/publish" || path == "/api/events/publish-batch" {
+		if id.Has(tokens.ScopeEventsPublish) {
+			return ""
+		}
+		return "requires scope " + tokens.ScopeEventsPublish
+	}
+	if rest, ok := strings.CutPrefix(path, "/api/tasks/"); ok && id.Has(tokens.ScopeTasksWork) && id.InstanceID != "" {
+		// The task store only lets an instance finish its own claims.
+		_, action, _ := strings.Cut(rest, "/")
+		if rest == "claim" || action == "complete" || action == "fail" {
+			return ""
+		}
+	}
+	if rest, ok := strings.CutPrefix(path, "/api/messages"); ok && id.Has(tokens.ScopeMessages) && id.InstanceID != "" {
+		// The sender is the token's instance, and the message store only
+		// lets an instance acknowledge its own messages.
+		if rest == "" || strings.HasSuffix(rest, "/ack") {
+			return ""
+		}
+	}
+	if rest, ok := strings.CutPrefix(path, "/api/instances/"); ok && rest != "register" {
+		target, action, _ := strings.Cut(rest, "/")
+		self := action == "" && r.Method == http.MethodDelete ||
+			action == "heartbeat" || action == "activate" || action == "capabilities"
+		if self && id.Has(tokens.ScopeInstanceSelf) && target == id.InstanceID && target != "" {
+			return ""
+		}
+		return "may only manage its own instance"
+	}
+	return "requires scope " + tokens.ScopeWrite
+}
+
+// routeGroup maps a request to the users permission that covers it.
+func routeGroup(r *http.Request) string {
+	path := r.URL.Path
+	switch {
+	case path == "/api/tokens/whoami":
+		return users.PermRead
+	case adminRoute(r):
+		return users.PermAdmin
+	case strings.HasPrefix(path, "/api/audit"):
+		return users.PermAuditRead
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return users.PermRead
+	}
+	switch {
+	case path == "/mcp", path == "/api/graphql", path == "/api/instances/match", isMockTraffic(path):
+		return users.PermRead
+	case strings.HasPrefix(path, "/api/state/"):
+		return users.PermStateWrite
+	case (strings.HasPrefix(path, "/api/rules/") || strings.HasPrefix(path, "/rules/")) &&
+		(strings.HasSuffix(path, "/accept") || strings.HasSuffix(path, "/reject")):
+		return users.PermRulesReview
+	case strings.HasPrefix(path, "/api/rules/") && strings.HasSuffix(path, "/auto-accept"):
+		// An auto-accept policy accepts rules on the reviewers' behalf.
+		return users.PermRulesReview
+	case path == "/api/templates" || strings.HasPrefix(path, "/api/templates/") && !strings.HasSuffix(path, "/apply"):
+		return users.PermTemplatesManage
+	}
+	return users.PermWrite
+}
+
+// isMockTraffic reports whether path is a request to a running contract
+// mock, which changes nothing whatever its method.
+func isMockTraffic(path string) bool {
+	rest, ok := strings.CutPrefix(path, "/api/mocks/")
+	return ok && strings.Count(rest, "/") >= 2
+}
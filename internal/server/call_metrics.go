@@ -0,0 +1,47 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+)
+
+// --- Per-agent call metrics ---
+
+// countingBody counts the request body bytes a handler reads.
+type countingBody struct {
+	io.ReadCloser
+	n int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	return n, err
+}
+
+// recordCall adds one REST or MCP call (kind "rest" or "mcp") to the calling
+// instance's hourly metrics: {kind}_calls, {kind}_errors (status >= 400),
+// {kind}_latency_ms, bytes_in and bytes_out. The instance is the one the
+// token is bound to, else X-Koor-Instance; anonymous calls are not tracked.
+func (s *Server) recordCall(r *http.Request, kind string, rec *statusRecorder, body *countingBody, start time.Time) {
+	instanceID := r.Header.Get("X-Koor-Instance")
+	if s.metricsStore == nil || instanceID == "" {
+		return
+	}
+	var errors int64
+	if rec.status >= 400 {
+		errors = 1
+	}
+	err := s.metricsStore.AddAll(context.WithoutCancel(r.Context()), instanceID, map[string]int64{
+		kind + "_calls":      1,
+		kind + "_errors":     errors,
+		kind + "_latency_ms": time.Since(start).Milliseconds(),
+		"bytes_in":           body.n,
+		"bytes_out":          rec.bytes,
+	})
+	if err != nil {
+		s.logger.Error("record call metrics failed", "instance", instanceID, "kind", kind, "error", err)
+	}
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/DavidRHerbert/koor/internal/state"
+)
+
+// changeFilter decides which state keys and spec paths publish change events.
+// It is built from Config.ChangeEvents, a comma-separated list of entries:
+//
+//	"*"                all state and spec writes
+//	state              all state writes
+//	state:config/      state keys starting with "config/"
+//	specs:Truck-Wash/  specs whose "project/name" starts with "Truck-Wash/"
+type changeFilter struct {
+	state []string
+	specs []string
+}
+
+func parseChangeFilter(cfg string) changeFilter {
+	var f changeFilter
+	for _, entry := range strings.Split(cfg, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if entry == "*" {
+			f.state = append(f.state, "")
+			f.specs = append(f.specs, "")
+			continue
+		}
+		kind, prefix, _ := strings.Cut(entry, ":")
+		prefix = strings.TrimSuffix(prefix, "*")
+		switch kind {
+		case "state":
+			f.state = append(f.state, prefix)
+		case "spec", "specs":
+			f.specs = append(f.specs, prefix)
+		}
+	}
+	return f
+}
+
+func matchPrefix(prefixes []string, name string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(name, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// actorFromRequest returns the caller identity from the X-Koor-Actor header, if any.
+func actorFromRequest(r *http.Request) string {
+	return r.Header.Get("X-Koor-Actor")
+}
+
+// publishStateChange is the state store's change hook: it notifies MCP
+// clients reading the key as a resource and emits a state.changed event if
+// the key is enabled. Writes made by projections publish no event, since a
+// projection of state.changed would otherwise feed itself.
+func (s *Server) publishStateChange(ctx context.Context, c state.Change) {
+	s.notifyStateResource(c.Key)
+	if !matchPrefix(s.changes.state, c.Key) || strings.HasPrefix(c.Actor, "projection:") {
+		return
+	}
+	data, _ := json.Marshal(map[string]any{
+		"op":          c.Op,
+		"key":         c.Key,
+		"old_version": c.OldVersion,
+		"new_version": c.NewVersion,
+		"actor":       c.Actor,
+	})
+	if _, err := s.eventBus.Publish(ctx, "state.changed", data, c.Actor); err != nil {
+		s.logger.Error("publish state.changed failed", "key", c.Key, "error", err)
+	}
+}
+
+// publishSpecChange emits a spec.changed event if the spec path is enabled,
+// and notifies MCP clients reading it as a resource.
+func (s *Server) publishSpecChange(ctx context.Context, op, project, name string, oldVersion, newVersion int64, actor string) {
+	s.notifySpecResource(project, name)
+	if !matchPrefix(s.changes.specs, project+"/"+name) {
+		return
+	}
+	data, _ := json.Marshal(map[string]any{
+		"op":          op,
+		"project":     project,
+		"name":        name,
+		"old_version": oldVersion,
+		"new_version": newVersion,
+		"actor":       actor,
+	})
+	if _, err := s.eventBus.Publish(ctx, "spec.changed", data, actor); err != nil {
+		s.logger.Error("publish spec.changed failed", "project", project, "name", name, "error", err)
+	}
+}
+
+// publishRotation announces a credential rotation, so systems holding the
+// old credential know to fetch the new one before previous_valid_until.
+// The new credential itself is never published.
+func (s *Server) publishRotation(ctx context.Context, topic, id string, until *time.Time, actor string) {
+	data, _ := json.Marshal(map[string]any{
+		"id":                   id,
+		"previous_valid_until": until,
+		"actor":                actor,
+	})
+	if _, err := s.eventBus.Publish(ctx, topic, data, actor); err != nil {
+		s.logger.Error("publish "+topic+" failed", "id", id, "error", err)
+	}
+}
@@ -0,0 +1,222 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// fieldError names one offending field of a request body.
+type fieldError struct {
+	Field   string `json:"field"`
+	Problem string `json:"problem"`
+}
+
+// decodeBody decodes the JSON request body into v. With Config.StrictJSON,
+// unknown fields and mistyped values are rejected with a 422 that lists
+// every offending field; otherwise unknown fields are ignored, as before.
+// It writes the error response and reports false on failure.
+func (s *Server) decodeBody(w http.ResponseWriter, r *http.Request, v any) bool {
+	if !s.config.StrictJSON {
+		if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+			writeError(w, http.StatusBadRequest, invalidBodyMessage(err))
+			return false
+		}
+		return true
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, 10<<20)) // 10 MB limit
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "cannot read body")
+		return false
+	}
+	var fields []fieldError
+	if err := json.Unmarshal(data, v); err != nil {
+		var te *json.UnmarshalTypeError
+		if !errors.As(err, &te) {
+			writeError(w, http.StatusBadRequest, invalidBodyMessage(err))
+			return false
+		}
+		fields = append(fields, fieldError{Field: bodyField(te.Field), Problem: "must be " + jsonKind(te.Type)})
+	}
+	fields = append(fields, unknownFields(data, reflect.TypeOf(v), "")...)
+	if len(fields) > 0 {
+		sort.SliceStable(fields, func(i, j int) bool { return fields[i].Field < fields[j].Field })
+		writeFieldErrors(w, "invalid request body", fields)
+		return false
+	}
+	return true
+}
+
+// rejectFields reports a request body that decoded but failed the
+// endpoint's own checks. With Config.StrictJSON it is a 422 listing the
+// fields; otherwise it is the 400 with msg that clients already handle.
+func (s *Server) rejectFields(w http.ResponseWriter, msg string, fields ...fieldError) {
+	if !s.config.StrictJSON {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+	writeFieldErrors(w, msg, fields)
+}
+
+// requiredFields takes name, value pairs and returns an error for each
+// value that is empty.
+func requiredFields(pairs ...string) []fieldError {
+	var fields []fieldError
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if pairs[i+1] == "" {
+			fields = append(fields, fieldError{Field: pairs[i], Problem: "is required"})
+		}
+	}
+	return fields
+}
+
+func writeFieldErrors(w http.ResponseWriter, msg string, fields []fieldError) {
+	writeJSON(w, http.StatusUnprocessableEntity, map[string]any{
+		"error":  msg,
+		"code":   http.StatusUnprocessableEntity,
+		"fields": fields,
+	})
+}
+
+// invalidBodyMessage is the 400 message for a body that is not valid JSON
+// or has the wrong shape at the top level.
+func invalidBodyMessage(err error) string {
+	var te *json.UnmarshalTypeError
+	if errors.As(err, &te) && te.Field == "" {
+		return "invalid JSON body: expected " + jsonKind(te.Type)
+	}
+	return "invalid JSON body"
+}
+
+func bodyField(field string) string {
+	if field == "" {
+		return "(body)"
+	}
+	return field
+}
+
+// jsonKind describes the JSON value a Go type decodes from.
+func jsonKind(t reflect.Type) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Struct, reflect.Map:
+		return "an object"
+	}
+	return "a " + t.Kind().String()
+}
+
+var unmarshalerType = reflect.TypeFor[json.Unmarshaler]()
+
+// unknownFields walks data alongside the Go type it decodes into and
+// returns the object keys that type has no field for. Like encoding/json,
+// keys match field names case-insensitively. Types that decode themselves
+// (json.RawMessage among them) and interfaces accept anything.
+func unknownFields(data []byte, t reflect.Type, path string) []fieldError {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if reflect.PointerTo(t).Implements(unmarshalerType) {
+		return nil
+	}
+	var fields []fieldError
+	switch t.Kind() {
+	case reflect.Struct:
+		var obj map[string]json.RawMessage
+		if json.Unmarshal(data, &obj) != nil {
+			return nil
+		}
+		known := structFields(t)
+		keys := make([]string, 0, len(obj))
+		for k := range obj {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			ft, ok := known[strings.ToLower(k)]
+			if !ok {
+				fields = append(fields, fieldError{Field: joinField(path, k), Problem: "unknown field"})
+				continue
+			}
+			fields = append(fields, unknownFields(obj[k], ft, joinField(path, k))...)
+		}
+	case reflect.Map:
+		var obj map[string]json.RawMessage
+		if json.Unmarshal(data, &obj) != nil {
+			return nil
+		}
+		for k, v := range obj {
+			fields = append(fields, unknownFields(v, t.Elem(), joinField(path, k))...)
+		}
+	case reflect.Slice, reflect.Array:
+		var items []json.RawMessage
+		if json.Unmarshal(data, &items) != nil {
+			return nil
+		}
+		for i, v := range items {
+			fields = append(fields, unknownFields(v, t.Elem(), path+"["+strconv.Itoa(i)+"]")...)
+		}
+	}
+	return fields
+}
+
+// structFields maps the lower-cased JSON names of t's fields to their
+// types, including the fields of untagged embedded structs.
+func structFields(t reflect.Type) map[string]reflect.Type {
+	known := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			et := f.Type
+			if et.Kind() == reflect.Pointer {
+				et = et.Elem()
+			}
+			if et.Kind() == reflect.Struct {
+				for k, v := range structFields(et) {
+					if _, ok := known[k]; !ok {
+						known[k] = v
+					}
+				}
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		known[strings.ToLower(name)] = f.Type
+	}
+	return known
+}
+
+func joinField(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/DavidRHerbert/koor/internal/specs"
+)
+
+// isDryRun reports whether the request asks to preview changes with ?dry_run=1.
+func isDryRun(r *http.Request) bool {
+	switch r.URL.Query().Get("dry_run") {
+	case "1", "true", "yes":
+		return true
+	}
+	return false
+}
+
+// changePlan lists the resources a write would create, update, or delete.
+// Entries are "type:id", e.g. "spec:Truck-Wash/api" or "state:config/db".
+type changePlan struct {
+	Created []string `json:"created"`
+	Updated []string `json:"updated"`
+	Deleted []string `json:"deleted"`
+}
+
+func newChangePlan() *changePlan {
+	return &changePlan{Created: []string{}, Updated: []string{}, Deleted: []string{}}
+}
+
+// add records id as created or updated depending on whether it exists.
+func (p *changePlan) add(id string, exists bool) {
+	if exists {
+		p.Updated = append(p.Updated, id)
+	} else {
+		p.Created = append(p.Created, id)
+	}
+}
+
+// writeDryRun responds with the plan instead of applying it.
+func writeDryRun(w http.ResponseWriter, p *changePlan) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"dry_run": true,
+		"created": p.Created,
+		"updated": p.Updated,
+		"deleted": p.Deleted,
+		"counts": map[string]int{
+			"created": len(p.Created),
+			"updated": len(p.Updated),
+			"deleted": len(p.Deleted),
+		},
+	})
+}
+
+// planRules records the rules ImportRules would write, skipping the same
+// incomplete entries it skips.
+func (s *Server) planRules(ctx context.Context, p *changePlan, rules []specs.Rule) {
+	for _, rule := range rules {
+		if rule.Project == "" || rule.RuleID == "" || rule.Pattern == "" {
+			continue
+		}
+		_, err := s.specReg.GetRule(ctx, rule.Project, rule.RuleID)
+		p.add("rule:"+rule.Project+"/"+rule.RuleID, err == nil)
+	}
+}
+
+// planSpec records a spec write.
+func (s *Server) planSpec(ctx context.Context, p *changePlan, project, name string) {
+	_, err := s.specReg.Get(ctx, project, name)
+	p.add("spec:"+project+"/"+name, err == nil)
+}
@@ -0,0 +1,374 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DavidRHerbert/koor/internal/audit"
+	"github.com/DavidRHerbert/koor/internal/encryption"
+	"github.com/DavidRHerbert/koor/internal/replication"
+)
+
+// GC categories reported by /api/admin/gc-report and cleaned by /api/admin/gc.
+var gcCategories = []string{"state", "rules", "webhooks", "templates"}
+
+// defaultGCFailures is how many consecutive delivery failures mark a
+// webhook URL as dead.
+const defaultGCFailures = 3
+
+// gcItem is one orphaned resource and why it was flagged.
+type gcItem struct {
+	ID     string `json:"id"`
+	Reason string `json:"reason"`
+}
+
+// gcReport lists orphaned resources by category.
+type gcReport struct {
+	GeneratedAt time.Time           `json:"generated_at"`
+	Categories  map[string][]gcItem `json:"categories"`
+	Counts      map[string]int      `json:"counts"`
+	Skipped     map[string]string   `json:"skipped,omitempty"`
+}
+
+// buildGCReport finds orphaned resources:
+//
+//   - state: keys whose metadata owner is no longer a registered instance
+//   - rules: rules of projects with no specs, state keys or settings left
+//   - webhooks: disabled webhooks, or ones failing minFailures times in a row
+//   - templates: templates never applied to a project (needs the audit log)
+func (s *Server) buildGCReport(ctx context.Context, minFailures int) (*gcReport, error) {
+	rep := &gcReport{
+		GeneratedAt: time.Now().UTC(),
+		Categories:  map[string][]gcItem{},
+		Counts:      map[string]int{},
+		Skipped:     map[string]string{},
+	}
+	for _, c := range gcCategories {
+		rep.Categories[c] = []gcItem{}
+	}
+
+	keys, err := s.stateStore.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	live := map[string]bool{}
+	stateProjects := map[string]bool{}
+	for _, k := range keys {
+		if i := strings.Index(k.Key, "/"); i > 0 {
+			stateProjects[k.Key[:i]] = true
+		}
+		if k.Meta == nil || k.Meta.Owner == "" {
+			continue
+		}
+		owner := k.Meta.Owner
+		if _, seen := live[owner]; !seen {
+			_, err := s.instanceReg.Get(ctx, owner)
+			live[owner] = err == nil
+		}
+		if !live[owner] {
+			rep.Categories["state"] = append(rep.Categories["state"], gcItem{ID: k.Key, Reason: "owner " + owner + " is not registered"})
+		}
+	}
+
+	rules, err := s.specReg.ListAllRules(ctx, "", "", "", "")
+	if err != nil {
+		return nil, err
+	}
+	projectLive := map[string]bool{}
+	for _, rule := range rules {
+		if rule.Project == "_global" {
+			continue
+		}
+		alive, seen := projectLive[rule.Project]
+		if !seen {
+			specList, _ := s.specReg.List(ctx, rule.Project)
+			alive = len(specList) > 0 || stateProjects[rule.Project] || s.settingsFor(ctx, rule.Project).UpdatedAt != nil
+			projectLive[rule.Project] = alive
+		}
+		if !alive {
+			rep.Categories["rules"] = append(rep.Categories["rules"], gcItem{
+				ID: rule.Project + "/" + rule.RuleID, Reason: "project " + rule.Project + " has no specs, state or settings",
+			})
+		}
+	}
+
+	if s.webhookDisp == nil {
+		rep.Skipped["webhooks"] = "webhooks not configured"
+	} else {
+		hooks, err := s.webhookDisp.List(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, h := range hooks {
+			switch {
+			case !h.Active:
+				rep.Categories["webhooks"] = append(rep.Categories["webhooks"], gcItem{ID: h.ID, Reason: "disabled after repeated failures: " + h.URL})
+			case h.FailCount >= minFailures:
+				rep.Categories["webhooks"] = append(rep.Categories["webhooks"], gcItem{ID: h.ID, Reason: strconv.Itoa(h.FailCount) + " consecutive failures: " + h.URL})
+			}
+		}
+	}
+
+	switch {
+	case s.templateStore == nil:
+		rep.Skipped["templates"] = "templates not configured"
+	case s.auditLog == nil:
+		rep.Skipped["templates"] = "audit log not configured; template use is unknown"
+	default:
+		tmpls, err := s.templateStore.List(ctx, "", "")
+		if err != nil {
+			return nil, err
+		}
+		entries, err := s.auditLog.Query(ctx, "", "template.apply", "", "", 100000)
+		if err != nil {
+			return nil, err
+		}
+		applied := map[string]bool{}
+		for _, e := range entries {
+			if e.Outcome == "success" {
+				applied[e.Resource] = true
+			}
+		}
+		for _, t := range tmpls {
+			if !applied[t.ID] {
+				rep.Categories["templates"] = append(rep.Categories["templates"], gcItem{ID: t.ID, Reason: "never applied"})
+			}
+		}
+	}
+
+	for c, items := range rep.Categories {
+		rep.Counts[c] = len(items)
+	}
+	return rep, nil
+}
+
+// --- Admin handlers ---
+
+func (s *Server) handleGCReport(w http.ResponseWriter, r *http.Request) {
+	minFailures := defaultGCFailures
+	if v := r.URL.Query().Get("min_failures"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, "min_failures must be a positive integer")
+			return
+		}
+		minFailures = n
+	}
+	rep, err := s.buildGCReport(r.Context(), minFailures)
+	if err != nil {
+		s.logger.Error("gc report failed", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to build gc report")
+		return
+	}
+	writeJSON(w, http.StatusOK, rep)
+}
+
+// handleGC deletes the orphaned resources in the selected categories, as
+// found by a fresh GC report. Supports ?dry_run=1.
+func (s *Server) handleGC(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Categories  []string `json:"categories"`
+		MinFailures int      `json:"min_failures"`
+	}
+	if !s.decodeBody(w, r, &req) {
+		return
+	}
+	if len(req.Categories) == 0 {
+		s.rejectFields(w, "categories is required: "+strings.Join(gcCategories, ", "),
+			fieldError{Field: "categories", Problem: "is required"})
+		return
+	}
+	for _, c := range req.Categories {
+		if !slices.Contains(gcCategories, c) {
+			s.rejectFields(w, "unknown category: "+c,
+				fieldError{Field: "categories", Problem: "must be one of " + strings.Join(gcCategories, ", ")})
+			return
+		}
+	}
+	if req.MinFailures <= 0 {
+		req.MinFailures = defaultGCFailures
+	}
+
+	ctx := r.Context()
+	rep, err := s.buildGCReport(ctx, req.MinFailures)
+	if err != nil {
+		s.logger.Error("gc report failed", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to build gc report")
+		return
+	}
+
+	plan := newChangePlan()
+	for _, c := range req.Categories {
+		for _, item := range rep.Categories[c] {
+			plan.Deleted = append(plan.Deleted, gcResource(c)+":"+item.ID)
+		}
+	}
+	if isDryRun(r) {
+		writeDryRun(w, plan)
+		return
+	}
+
+	deleted := map[string]int{}
+	for _, c := range req.Categories {
+		for _, item := range rep.Categories[c] {
+			var err error
+			switch c {
+			case "state":
+				err = s.stateStore.Delete(ctx, item.ID, actorFromRequest(r))
+			case "rules":
+				project, ruleID, _ := strings.Cut(item.ID, "/")
+				err = s.specReg.DeleteRule(ctx, project, ruleID)
+			case "webhooks":
+				err = s.webhookDisp.Delete(ctx, item.ID)
+			case "templates":
+				err = s.templateStore.Delete(ctx, item.ID)
+			}
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				s.logger.Error("gc delete failed", "category", c, "id", item.ID, "error", err)
+				writeError(w, http.StatusInternalServerError, "failed to delete "+c+" "+item.ID)
+				return
+			}
+			deleted[c]++
+		}
+	}
+
+	s.logger.Info("gc completed", "deleted", deleted)
+	s.audit(ctx, actorFromRequest(r), "admin.gc", strings.Join(req.Categories, ","), audit.DetailJSON(map[string]any{
+		"deleted": deleted,
+	}), "success")
+	writeJSON(w, http.StatusOK, map[string]any{
+		"deleted": plan.Deleted,
+		"counts":  deleted,
+	})
+}
+
+// gcResource names a category's resources the way change plans do.
+func gcResource(category string) string {
+	switch category {
+	case "rules":
+		return "rule"
+	case "webhooks":
+		return "webhook"
+	case "templates":
+		return "template"
+	}
+	return category
+}
+
+// handleAdminRotateKey re-encrypts stored state values and specs under the
+// current encryption key. After restarting with a new key first and the
+// old keys after it, run this once; the old keys can then be dropped.
+func (s *Server) handleAdminRotateKey(w http.ResponseWriter, r *http.Request) {
+	if s.encryption == nil {
+		writeError(w, http.StatusServiceUnavailable, "encryption not configured")
+		return
+	}
+	ctx := r.Context()
+	keyID := s.encryption.KeyID()
+	counts := map[string]int{}
+	for _, c := range []struct {
+		name      string
+		reencrypt func(context.Context) (int, error)
+	}{
+		{"state", s.stateStore.Reencrypt},
+		{"specs", s.specReg.Reencrypt},
+	} {
+		n, err := c.reencrypt(ctx)
+		if errors.Is(err, encryption.ErrNoKey) {
+			writeError(w, http.StatusServiceUnavailable, "encryption not configured")
+			return
+		}
+		if err != nil {
+			s.logger.Error("re-encrypt failed", "category", c.name, "key_id", keyID, "error", err)
+			s.audit(ctx, actorFromRequest(r), "admin.rotate_key", keyID, audit.DetailJSON(map[string]any{
+				"category": c.name, "error": err.Error(),
+			}), "failure")
+			writeError(w, http.StatusInternalServerError, "failed to re-encrypt "+c.name)
+			return
+		}
+		counts[c.name] = n
+	}
+
+	s.logger.Info("encryption key rotated", "key_id", keyID, "reencrypted", counts)
+	s.audit(ctx, actorFromRequest(r), "admin.rotate_key", keyID, audit.DetailJSON(map[string]any{
+		"reencrypted": counts,
+	}), "success")
+	writeJSON(w, http.StatusOK, map[string]any{
+		"key_id":      keyID,
+		"reencrypted": counts,
+	})
+}
+
+// handleAdminSnapshot streams a copy of the whole database: a SQLite file
+// (the default) or, with ?format=json, a logical export. Either restores
+// through /api/admin/restore.
+func (s *Server) handleAdminSnapshot(w http.ResponseWriter, r *http.Request) {
+	if s.replSource == nil {
+		writeError(w, http.StatusServiceUnavailable, "snapshots not configured")
+		return
+	}
+	format := r.URL.Query().Get("format")
+	var write func(context.Context, io.Writer) error
+	var contentType, ext string
+	switch format {
+	case "", "sqlite":
+		format, write, contentType, ext = "sqlite", s.replSource.WriteSnapshot, "application/vnd.sqlite3", ".db"
+	case "json":
+		write, contentType, ext = s.replSource.WriteExport, "application/json", ".json"
+	default:
+		writeError(w, http.StatusBadRequest, "format must be sqlite or json")
+		return
+	}
+
+	ctx := r.Context()
+	name := "koor-snapshot-" + time.Now().UTC().Format("20060102T150405Z") + ext
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	if err := write(ctx, w); err != nil {
+		// Headers may already be sent; the truncated archive fails to restore.
+		s.logger.Error("admin snapshot failed", "format", format, "error", err)
+		s.audit(ctx, actorFromRequest(r), "admin.snapshot", format, audit.DetailJSON(map[string]any{
+			"error": err.Error(),
+		}), "failure")
+		return
+	}
+	s.logger.Info("admin snapshot taken", "format", format)
+	s.audit(ctx, actorFromRequest(r), "admin.snapshot", format, "", "success")
+}
+
+// handleAdminRestore replaces the database contents with a snapshot from
+// /api/admin/snapshot, sent as the request body. The format is detected.
+func (s *Server) handleAdminRestore(w http.ResponseWriter, r *http.Request) {
+	if s.replSource == nil {
+		writeError(w, http.StatusServiceUnavailable, "snapshots not configured")
+		return
+	}
+	ctx := r.Context()
+	res, err := s.replSource.Restore(ctx, r.Body)
+	if errors.Is(err, replication.ErrBadArchive) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		s.logger.Error("admin restore failed", "error", err)
+		s.audit(ctx, actorFromRequest(r), "admin.restore", "", audit.DetailJSON(map[string]any{
+			"error": err.Error(),
+		}), "failure")
+		writeError(w, http.StatusInternalServerError, "failed to restore snapshot")
+		return
+	}
+
+	// The audit log was replaced too; this entry is the first after the restore.
+	s.logger.Info("admin restore completed", "format", res.Format, "tables", len(res.Tables))
+	s.audit(ctx, actorFromRequest(r), "admin.restore", res.Format, audit.DetailJSON(map[string]any{
+		"tables": res.Tables,
+	}), "success")
+	writeJSON(w, http.StatusOK, res)
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/DavidRHerbert/koor/internal/annotations"
+	"github.com/DavidRHerbert/koor/internal/contracts"
+	"github.com/DavidRHerbert/koor/internal/specs"
+)
+
+// --- Review annotation helpers ---
+
+// writeAnnotations answers a validation or contract-test run requested with
+// ?format=github|gitlab as a review annotation array instead of the usual
+// result object.
+func (s *Server) writeAnnotations(w http.ResponseWriter, format string, findings []annotations.Finding) {
+	out, err := annotations.Render(format, findings)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// violationFindings keys rule violations to the validated file.
+func violationFindings(file string, violations []specs.Violation) []annotations.Finding {
+	findings := make([]annotations.Finding, 0, len(violations))
+	for _, v := range violations {
+		findings = append(findings, annotations.Finding{
+			File: file, Line: v.Line, Severity: v.Severity, Rule: v.RuleID, Message: v.Message,
+		})
+	}
+	return findings
+}
+
+// diffViolationFindings keys diff violations to the files they are in.
+func diffViolationFindings(violations []specs.DiffViolation) []annotations.Finding {
+	findings := make([]annotations.Finding, 0, len(violations))
+	for _, v := range violations {
+		findings = append(findings, annotations.Finding{
+			File: v.Filename, Line: v.Line, Severity: v.Severity, Rule: v.RuleID, Message: v.Message,
+		})
+	}
+	return findings
+}
+
+// contractTestFindings reports a contract test run against file. Contract
+// violations name a payload path rather than a source line, so they are
+// attached to the top of the file with the path in the message.
+func contractTestFindings(file string, result *contracts.TestResult) []annotations.Finding {
+	var findings []annotations.Finding
+	add := func(rule, severity, path, message string) {
+		if path != "" {
+			message = result.Endpoint + " " + path + ": " + message
+		} else {
+			message = result.Endpoint + ": " + message
+		}
+		findings = append(findings, annotations.Finding{File: file, Severity: severity, Rule: rule, Message: message})
+	}
+	if result.Error != "" {
+		add("contract-test", "error", "", result.Error)
+	}
+	for _, v := range result.RequestViolations {
+		add("contract-request", v.Severity, v.Path, v.Message)
+	}
+	for _, v := range result.ResponseViolations {
+		add("contract-response", v.Severity, v.Path, v.Message)
+	}
+	for _, wn := range result.Warnings {
+		add("contract-deprecation", "warning", wn.Path, wn.Message)
+	}
+	return findings
+}
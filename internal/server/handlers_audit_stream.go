@@ -0,0 +1,167 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DavidRHerbert/koor/internal/audit"
+	"github.com/DavidRHerbert/koor/internal/events"
+	"nhooyr.io/websocket"
+)
+
+// --- Audit stream handlers ---
+
+// auditStreamKeepalive is how often an idle SSE stream sends a comment,
+// so proxies do not close it.
+const auditStreamKeepalive = 30 * time.Second
+
+// handleAuditStream follows the audit log as entries are appended: over a
+// WebSocket when the request asks to upgrade, else as server-sent events.
+// ?actor= and ?action= filter by exact match. ?after_id= (or an SSE
+// client's Last-Event-ID) first replays the stored entries after that ID,
+// so a client that reconnects misses nothing.
+func (s *Server) handleAuditStream(w http.ResponseWriter, r *http.Request) {
+	if s.auditLog == nil || s.eventBus == nil {
+		writeError(w, http.StatusServiceUnavailable, "audit log not configured")
+		return
+	}
+	q := r.URL.Query()
+	actor, action := q.Get("actor"), q.Get("action")
+	after := q.Get("after_id")
+	if after == "" {
+		after = r.Header.Get("Last-Event-ID")
+	}
+	afterID := int64(-1)
+	if after != "" {
+		n, err := strconv.ParseInt(after, 10, 64)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "after_id must be a non-negative integer")
+			return
+		}
+		afterID = n
+	}
+
+	ctx := r.Context()
+	var send func(audit.Entry) bool
+	var keepalive func() bool
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		conn, err := websocket.Accept(w, r, &websocket.AcceptOptions{
+			InsecureSkipVerify: true, // Allow any origin for local dev.
+		})
+		if err != nil {
+			s.logger.Error("websocket accept failed", "error", err)
+			return
+		}
+		defer conn.Close(websocket.StatusNormalClosure, "closing")
+		// Reads handle pings and notice the client going away.
+		ctx = conn.CloseRead(ctx)
+		send = func(e audit.Entry) bool {
+			data, _ := json.Marshal(e)
+			return conn.Write(ctx, websocket.MessageText, data) == nil
+		}
+		keepalive = func() bool { return conn.Ping(ctx) == nil }
+	} else {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			writeError(w, http.StatusInternalServerError, "streaming not supported")
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+		send = func(e audit.Entry) bool {
+			data, _ := json.Marshal(e)
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: audit\ndata: %s\n\n", e.ID, data); err != nil {
+				return false
+			}
+			flusher.Flush()
+			return true
+		}
+		keepalive = func() bool {
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return false
+			}
+			flusher.Flush()
+			return true
+		}
+	}
+
+	// Subscribe before replaying, so nothing appended meanwhile is lost;
+	// live entries the replay already covered are skipped by ID.
+	sub := s.eventBus.Subscribe(audit.Topic)
+	defer s.eventBus.Unsubscribe(sub)
+	cursor := afterID
+	if afterID >= 0 {
+		var err error
+		if cursor, err = s.replayAudit(ctx, sub.Ch, afterID, actor, action, send); err != nil {
+			s.logger.Debug("audit replay stopped", "error", err)
+			return
+		}
+	}
+
+	s.logger.Info("audit stream connected", "actor", actor, "action", action, "after_id", afterID, "remote", r.RemoteAddr)
+	ticker := time.NewTicker(auditStreamKeepalive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !keepalive() {
+				return
+			}
+		case ev, ok := <-sub.Ch:
+			if !ok {
+				return
+			}
+			var e audit.Entry
+			if json.Unmarshal(ev.Data, &e) != nil || e.ID <= cursor {
+				continue
+			}
+			if actor != "" && e.Actor != actor || action != "" && e.Action != action {
+				continue
+			}
+			if !send(e) {
+				return
+			}
+		}
+	}
+}
+
+// replayAudit sends the stored entries after afterID, oldest first, and
+// returns the ID the live stream continues from. The live buffer is
+// emptied before each page is read: what it held is in that page or an
+// earlier one.
+func (s *Server) replayAudit(ctx context.Context, live chan events.Event, afterID int64, actor, action string, send func(audit.Entry) bool) (int64, error) {
+	const page = 500
+	cursor := afterID
+	for {
+	drain:
+		for {
+			select {
+			case <-live:
+			default:
+				break drain
+			}
+		}
+		entries, err := s.auditLog.Since(ctx, cursor, actor, action, page)
+		if err != nil {
+			return 0, err
+		}
+		for _, e := range entries {
+			if !send(e) {
+				return 0, fmt.Errorf("write failed")
+			}
+			cursor = e.ID
+		}
+		if len(entries) < page {
+			return cursor, nil
+		}
+	}
+}
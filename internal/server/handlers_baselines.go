@@ -0,0 +1,98 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/DavidRHerbert/koor/internal/audit"
+	"github.com/DavidRHerbert/koor/internal/specs"
+)
+
+// --- Validation baseline handlers ---
+
+// handleBaselineCapture validates the given files and makes the violations
+// found the project's baseline, replacing the previous one. Validation of
+// the project then reports only violations the baseline does not cover.
+func (s *Server) handleBaselineCapture(w http.ResponseWriter, r *http.Request) {
+	project := r.PathValue("project")
+	var body struct {
+		Files []specs.BaselineFile `json:"files"`
+		Stack string               `json:"stack"`
+	}
+	if !s.decodeBody(w, r, &body) {
+		return
+	}
+	if len(body.Files) == 0 {
+		s.rejectFields(w, "files is required", fieldError{Field: "files", Problem: "required"})
+		return
+	}
+
+	st := s.settingsFor(r.Context(), project)
+	req := specs.ValidateRequest{Stack: body.Stack, SkipGlobal: !st.GlobalRules}
+	if req.Stack == "" {
+		req.Stack = st.DefaultStack
+	}
+	entries, err := s.specReg.CaptureBaseline(r.Context(), project, body.Files, req)
+	if err != nil {
+		s.logger.Error("capture baseline failed", "project", project, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to capture baseline")
+		return
+	}
+	if entries == nil {
+		entries = []specs.BaselineEntry{}
+	}
+	violations := 0
+	for _, e := range entries {
+		violations += e.Count
+	}
+
+	s.logger.Info("validation baseline captured", "project", project, "files", len(body.Files), "violations", violations)
+	s.audit(r.Context(), actorFromRequest(r), "validate.baseline", project, audit.DetailJSON(map[string]any{
+		"files":      len(body.Files),
+		"violations": violations,
+	}), "success")
+	writeJSON(w, http.StatusOK, map[string]any{
+		"project":    project,
+		"entries":    entries,
+		"violations": violations,
+	})
+}
+
+// handleBaselineGet returns a project's baseline.
+func (s *Server) handleBaselineGet(w http.ResponseWriter, r *http.Request) {
+	project := r.PathValue("project")
+	entries, err := s.specReg.Baseline(r.Context(), project)
+	if err != nil {
+		s.logger.Error("get baseline failed", "project", project, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to get baseline")
+		return
+	}
+	if entries == nil {
+		entries = []specs.BaselineEntry{}
+	}
+	violations := 0
+	for _, e := range entries {
+		violations += e.Count
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"project":    project,
+		"entries":    entries,
+		"violations": violations,
+	})
+}
+
+// handleBaselineDelete removes a project's baseline, so validation reports
+// every violation again.
+func (s *Server) handleBaselineDelete(w http.ResponseWriter, r *http.Request) {
+	project := r.PathValue("project")
+	n, err := s.specReg.DeleteBaseline(r.Context(), project)
+	if err != nil {
+		s.logger.Error("delete baseline failed", "project", project, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to delete baseline")
+		return
+	}
+	s.logger.Info("validation baseline deleted", "project", project, "entries", n)
+	s.audit(r.Context(), actorFromRequest(r), "validate.baseline.delete", project, audit.DetailJSON(map[string]any{
+		"entries": n,
+	}), "success")
+	writeJSON(w, http.StatusOK, map[string]any{"project": project, "deleted": n})
+}
@@ -0,0 +1,221 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/DavidRHerbert/koor/internal/projects"
+)
+
+// --- Error budget handlers ---
+
+// statusRecorder captures the status code a handler writes and counts the
+// response bytes.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *statusRecorder) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusRecorder) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Flush lets streaming handlers that assert http.Flusher (the MCP
+// transport does) flush through the recorder.
+func (w *statusRecorder) Flush() {
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *statusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// budgetStatus is one agent's standing against one error budget.
+type budgetStatus struct {
+	Budget         string  `json:"budget"`
+	Metric         string  `json:"metric"`
+	Role           string  `json:"role,omitempty"`
+	InstanceID     string  `json:"instance_id"`
+	Agent          string  `json:"agent"`
+	Total          int64   `json:"total"`
+	Failed         int64   `json:"failed"`
+	FailureRate    float64 `json:"failure_rate"`
+	MaxFailureRate float64 `json:"max_failure_rate"`
+	Window         string  `json:"window"`
+	Exceeded       bool    `json:"exceeded"`
+}
+
+// recordOutcome counts an attempt of an error budget metric for the calling
+// instance (X-Koor-Instance) and re-checks its budgets. Anonymous calls are
+// not tracked.
+func (s *Server) recordOutcome(r *http.Request, metric string, failed bool) {
+	instanceID := r.Header.Get("X-Koor-Instance")
+	if s.metricsStore == nil || instanceID == "" {
+		return
+	}
+	ctx := context.WithoutCancel(r.Context())
+	if err := s.metricsStore.RecordOutcome(ctx, instanceID, metric, failed); err != nil {
+		s.logger.Error("record outcome failed", "instance", instanceID, "metric", metric, "error", err)
+		return
+	}
+	s.checkBudgets(ctx, instanceID)
+}
+
+// checkBudgets evaluates every error budget that applies to an instance and
+// publishes "{project}.budget.exceeded" when one is blown, and
+// "{project}.budget.recovered" when it is back within budget. Project
+// webhooks receive these like any other project event.
+func (s *Server) checkBudgets(ctx context.Context, instanceID string) {
+	if s.settings == nil {
+		return
+	}
+	list, err := s.settings.List(ctx)
+	if err != nil {
+		s.logger.Error("error budget check failed", "instance", instanceID, "error", err)
+		return
+	}
+	if !slices.ContainsFunc(list, func(st projects.Settings) bool { return len(st.ErrorBudgets) > 0 }) {
+		return
+	}
+	inst, err := s.instanceReg.Get(ctx, instanceID)
+	if err != nil {
+		return
+	}
+	for _, st := range list {
+		role, ok := agentRole(st.Project, inst.Name, inst.Workspace)
+		if !ok {
+			continue
+		}
+		for _, b := range st.ErrorBudgets {
+			if b.Role != "" && b.Role != role {
+				continue
+			}
+			status, err := s.budgetStatus(ctx, b, inst.ID, inst.Name)
+			if err != nil {
+				s.logger.Error("error budget check failed", "budget", b.Name, "instance", instanceID, "error", err)
+				continue
+			}
+			key := st.Project + "/" + b.Name
+			s.budgetMu.Lock()
+			was := s.budgetBlown[instanceID][key]
+			if status.Exceeded {
+				if s.budgetBlown == nil {
+					s.budgetBlown = map[string]map[string]bool{}
+				}
+				if s.budgetBlown[instanceID] == nil {
+					s.budgetBlown[instanceID] = map[string]bool{}
+				}
+				s.budgetBlown[instanceID][key] = true
+			} else {
+				delete(s.budgetBlown[instanceID], key)
+			}
+			s.budgetMu.Unlock()
+
+			topic := ""
+			switch {
+			case status.Exceeded && !was:
+				topic = strings.ToLower(st.Project) + ".budget.exceeded"
+				s.logger.Warn("error budget exceeded", "project", st.Project, "budget", b.Name,
+					"agent", inst.Name, "failure_rate", status.FailureRate)
+			case !status.Exceeded && was:
+				topic = strings.ToLower(st.Project) + ".budget.recovered"
+			default:
+				continue
+			}
+			data, _ := json.Marshal(struct {
+				Project string `json:"project"`
+				budgetStatus
+			}{st.Project, status})
+			if _, err := s.eventBus.Publish(ctx, topic, data, "error-budgets"); err != nil {
+				s.logger.Error("publish budget event failed", "topic", topic, "error", err)
+			}
+		}
+	}
+}
+
+// agentRole reports whether an instance belongs to a project, by the
+// "{project}-{role}" naming convention or by workspace, and its role.
+func agentRole(project, name, workspace string) (string, bool) {
+	role, ok := strings.CutPrefix(strings.ToLower(name), strings.ToLower(project)+"-")
+	return role, ok || workspace == project
+}
+
+// budgetStatus measures one instance against one budget.
+func (s *Server) budgetStatus(ctx context.Context, b projects.ErrorBudget, instanceID, name string) (budgetStatus, error) {
+	window, err := b.WindowDuration()
+	if err != nil {
+		return budgetStatus{}, err
+	}
+	total, failed, err := s.metricsStore.Outcomes(ctx, instanceID, b.Metric, time.Now().Add(-window+time.Hour))
+	if err != nil {
+		return budgetStatus{}, err
+	}
+	st := budgetStatus{
+		Budget: b.Name, Metric: b.Metric, Role: b.Role,
+		InstanceID: instanceID, Agent: name,
+		Total: total, Failed: failed,
+		MaxFailureRate: b.MaxFailureRate,
+		Window:         strings.TrimSuffix(window.String(), "0m0s"), // whole hours
+	}
+	if total > 0 {
+		st.FailureRate = float64(failed) / float64(total)
+	}
+	st.Exceeded = total >= b.Samples() && st.FailureRate > b.MaxFailureRate
+	return st, nil
+}
+
+// handleProjectBudgets reports every agent's standing against the
+// project's error budgets.
+func (s *Server) handleProjectBudgets(w http.ResponseWriter, r *http.Request) {
+	if s.settings == nil || s.metricsStore == nil {
+		writeError(w, http.StatusServiceUnavailable, "error budgets not configured")
+		return
+	}
+	ctx := r.Context()
+	project := r.PathValue("project")
+	st := s.settingsFor(ctx, project)
+	agents, err := s.projectAgents(ctx, project)
+	if err != nil {
+		s.logger.Error("project budgets failed", "project", project, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to list instances")
+		return
+	}
+
+	statuses := []budgetStatus{}
+	exceeded := 0
+	for _, b := range st.ErrorBudgets {
+		for _, a := range agents {
+			if b.Role != "" && b.Role != a.Role {
+				continue
+			}
+			status, err := s.budgetStatus(ctx, b, a.ID, a.Name)
+			if err != nil {
+				s.logger.Error("project budgets failed", "project", project, "budget", b.Name, "error", err)
+				writeError(w, http.StatusInternalServerError, "failed to read metrics")
+				return
+			}
+			if status.Exceeded {
+				exceeded++
+			}
+			statuses = append(statuses, status)
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"project":  project,
+		"budgets":  st.ErrorBudgets,
+		"agents":   statuses,
+		"exceeded": exceeded,
+	})
+}
@@ -0,0 +1,138 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/DavidRHerbert/koor/internal/audit"
+	"github.com/DavidRHerbert/koor/internal/compliance"
+)
+
+// --- Compliance policy handlers ---
+
+// decodePolicy reads a policy from the request body. The project may also
+// be given as ?project=, which is how project-bound tokens are narrowed.
+// It writes the error response and reports false on failure.
+func (s *Server) decodePolicy(w http.ResponseWriter, r *http.Request) (*compliance.Policy, bool) {
+	var p compliance.Policy
+	if !s.decodeBody(w, r, &p) {
+		return nil, false
+	}
+	if project := r.URL.Query().Get("project"); project != "" {
+		if p.Project != "" && p.Project != project {
+			s.rejectFields(w, "project in body does not match ?project="+project,
+				fieldError{Field: "project", Problem: "does not match ?project=" + project})
+			return nil, false
+		}
+		p.Project = project
+	}
+	if err := compliance.ValidatePolicy(&p); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+	return &p, true
+}
+
+func (s *Server) handleCompliancePolicyCreate(w http.ResponseWriter, r *http.Request) {
+	if s.compSched == nil {
+		writeError(w, http.StatusServiceUnavailable, "compliance scheduler not configured")
+		return
+	}
+	req, ok := s.decodePolicy(w, r)
+	if !ok {
+		return
+	}
+	p, err := s.compSched.AddPolicy(r.Context(), *req)
+	if err != nil {
+		s.logger.Error("compliance policy create failed", "project", req.Project, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to create compliance policy")
+		return
+	}
+	s.logger.Info("compliance policy created", "id", p.ID, "project", p.Project, "check", p.Check)
+	s.audit(r.Context(), actorFromRequest(r), "compliance_policy.create", p.ID, audit.DetailJSON(map[string]any{
+		"project": p.Project, "name": p.Name, "check": p.Check, "severity": p.Severity,
+	}), "success")
+	writeJSON(w, http.StatusOK, p)
+}
+
+func (s *Server) handleCompliancePolicyList(w http.ResponseWriter, r *http.Request) {
+	if s.compSched == nil {
+		writeError(w, http.StatusServiceUnavailable, "compliance scheduler not configured")
+		return
+	}
+	list, err := s.compSched.ListPolicies(r.Context(), r.URL.Query().Get("project"))
+	if err != nil {
+		s.logger.Error("compliance policy list failed", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to list compliance policies")
+		return
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (s *Server) handleCompliancePolicyGet(w http.ResponseWriter, r *http.Request) {
+	if s.compSched == nil {
+		writeError(w, http.StatusServiceUnavailable, "compliance scheduler not configured")
+		return
+	}
+	id := r.PathValue("id")
+	p, err := s.compSched.GetPolicy(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "compliance policy not found: "+id)
+		return
+	}
+	if err != nil {
+		s.logger.Error("compliance policy get failed", "id", id, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to get compliance policy")
+		return
+	}
+	writeJSON(w, http.StatusOK, p)
+}
+
+func (s *Server) handleCompliancePolicyUpdate(w http.ResponseWriter, r *http.Request) {
+	if s.compSched == nil {
+		writeError(w, http.StatusServiceUnavailable, "compliance scheduler not configured")
+		return
+	}
+	req, ok := s.decodePolicy(w, r)
+	if !ok {
+		return
+	}
+	req.ID = r.PathValue("id")
+	p, err := s.compSched.UpdatePolicy(r.Context(), *req)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "compliance policy not found: "+req.ID)
+		return
+	}
+	if err != nil {
+		s.logger.Error("compliance policy update failed", "id", req.ID, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to update compliance policy")
+		return
+	}
+	s.logger.Info("compliance policy updated", "id", p.ID, "project", p.Project, "check", p.Check)
+	s.audit(r.Context(), actorFromRequest(r), "compliance_policy.update", p.ID, audit.DetailJSON(map[string]any{
+		"project": p.Project, "name": p.Name, "check": p.Check, "severity": p.Severity,
+	}), "success")
+	writeJSON(w, http.StatusOK, p)
+}
+
+func (s *Server) handleCompliancePolicyDelete(w http.ResponseWriter, r *http.Request) {
+	if s.compSched == nil {
+		writeError(w, http.StatusServiceUnavailable, "compliance scheduler not configured")
+		return
+	}
+	id := r.PathValue("id")
+	err := s.compSched.DeletePolicy(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "compliance policy not found: "+id)
+		return
+	}
+	if err != nil {
+		s.logger.Error("compliance policy delete failed", "id", id, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to delete compliance policy")
+		return
+	}
+	s.logger.Info("compliance policy deleted", "id", id)
+	s.audit(r.Context(), actorFromRequest(r), "compliance_policy.delete", id, "{}", "success")
+	writeJSON(w, http.StatusOK, map[string]any{"deleted": id})
+}
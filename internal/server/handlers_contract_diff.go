@@ -0,0 +1,135 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/DavidRHerbert/koor/internal/contracts"
+)
+
+// --- Contract diff handlers ---
+
+// contractDiff is a compatibility report between two stored versions of a
+// contract (v2 is 0 for a proposed contract that is not stored yet).
+type contractDiff struct {
+	Project string `json:"project"`
+	Name    string `json:"name"`
+	V1      int64  `json:"v1"`
+	V2      int64  `json:"v2,omitempty"`
+	*contracts.Compatibility
+}
+
+// handleContractDiff compares two versions of a stored contract:
+// ?v2= defaults to the latest and ?v1= to the version before v2.
+func (s *Server) handleContractDiff(w http.ResponseWriter, r *http.Request) {
+	project := r.PathValue("project")
+	name := r.PathValue("name")
+
+	latest, err := s.specReg.Get(r.Context(), project, name)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "contract not found: "+project+"/"+name)
+		return
+	}
+	if err != nil {
+		s.logger.Error("contract diff failed", "project", project, "name", name, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to get contract")
+		return
+	}
+	v2, ok := versionParam(w, r, "v2", latest.Version)
+	if !ok {
+		return
+	}
+	v1, ok := versionParam(w, r, "v1", v2-1)
+	if !ok {
+		return
+	}
+	from, ok := s.contractVersion(w, r, project, name, v1)
+	if !ok {
+		return
+	}
+	to, ok := s.contractVersion(w, r, project, name, v2)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, contractDiff{Project: project, Name: name, V1: v1, V2: v2,
+		Compatibility: contracts.Diff(from, to)})
+}
+
+// handleContractDiffProposed compares a contract in the request body with
+// a stored version (?v1=, default the latest), so a change can be checked
+// before it is stored.
+func (s *Server) handleContractDiffProposed(w http.ResponseWriter, r *http.Request) {
+	project := r.PathValue("project")
+	name := r.PathValue("name")
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 10<<20)) // 10 MB limit
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "cannot read body")
+		return
+	}
+	to, err := contracts.Parse(body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	latest, err := s.specReg.Get(r.Context(), project, name)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "contract not found: "+project+"/"+name)
+		return
+	}
+	if err != nil {
+		s.logger.Error("contract diff failed", "project", project, "name", name, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to get contract")
+		return
+	}
+	v1, ok := versionParam(w, r, "v1", latest.Version)
+	if !ok {
+		return
+	}
+	from, ok := s.contractVersion(w, r, project, name, v1)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, contractDiff{Project: project, Name: name, V1: v1,
+		Compatibility: contracts.Diff(from, to)})
+}
+
+// versionParam reads a positive version query parameter, or def if it is
+// absent. It writes a 400 and reports false if the value is invalid.
+func versionParam(w http.ResponseWriter, r *http.Request, name string, def int64) (int64, bool) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, true
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 1 {
+		writeError(w, http.StatusBadRequest, name+" must be a positive integer")
+		return 0, false
+	}
+	return n, true
+}
+
+// contractVersion loads and parses one version of a stored contract,
+// writing the error response and reporting false on failure.
+func (s *Server) contractVersion(w http.ResponseWriter, r *http.Request, project, name string, version int64) (*contracts.Contract, bool) {
+	spec, err := s.specReg.GetVersion(r.Context(), project, name, version)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("version %d not found for contract: %s/%s", version, project, name))
+		return nil, false
+	}
+	if err != nil {
+		s.logger.Error("contract version failed", "project", project, "name", name, "version", version, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to get contract version")
+		return nil, false
+	}
+	c, err := contracts.Parse(spec.Data)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("version %d is not a valid contract: %v", version, err))
+		return nil, false
+	}
+	return c, true
+}
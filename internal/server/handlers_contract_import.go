@@ -0,0 +1,84 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/DavidRHerbert/koor/internal/audit"
+	"github.com/DavidRHerbert/koor/internal/contracts"
+)
+
+// --- Contract import handlers ---
+
+// handleContractImport converts an API description in another format into a
+// contract and stores it as the spec project/name. Only ?format=openapi
+// (OpenAPI 3, YAML or JSON) is supported. With ?dry_run=1 the converted
+// contract is returned without storing it.
+func (s *Server) handleContractImport(w http.ResponseWriter, r *http.Request) {
+	project := r.PathValue("project")
+	name := r.PathValue("name")
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "openapi"
+	}
+	if format != "openapi" {
+		writeError(w, http.StatusBadRequest, "unsupported import format "+format+" (want openapi)")
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, 10<<20)) // 10 MB limit
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "cannot read body")
+		return
+	}
+	if len(body) == 0 {
+		writeError(w, http.StatusBadRequest, "empty body")
+		return
+	}
+
+	contract, warnings, err := contracts.FromOpenAPI(body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if warnings == nil {
+		warnings = []string{}
+	}
+
+	if isDryRun(r) {
+		plan := newChangePlan()
+		s.planSpec(r.Context(), plan, project, name)
+		writeJSON(w, http.StatusOK, map[string]any{
+			"dry_run":  true,
+			"created":  plan.Created,
+			"updated":  plan.Updated,
+			"contract": contract,
+			"warnings": warnings,
+		})
+		return
+	}
+
+	data, _ := json.MarshalIndent(contract, "", "  ")
+	spec, err := s.specReg.Put(r.Context(), project, name, data)
+	if err != nil {
+		s.logger.Error("contract import failed", "project", project, "name", name, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to write spec")
+		return
+	}
+
+	s.logger.Info("contract imported", "project", project, "name", name, "format", format,
+		"endpoints", len(contract.Endpoints), "version", spec.Version)
+	s.audit(r.Context(), actorFromRequest(r), "contract.import", project+"/"+name, audit.DetailJSON(map[string]any{
+		"format": format, "endpoints": len(contract.Endpoints), "warnings": len(warnings), "version": spec.Version,
+	}), "success")
+	s.publishSpecChange(r.Context(), "put", project, name, spec.Version-1, spec.Version, actorFromRequest(r))
+	writeJSON(w, http.StatusOK, map[string]any{
+		"project":   spec.Project,
+		"name":      spec.Name,
+		"version":   spec.Version,
+		"hash":      spec.Hash,
+		"endpoints": len(contract.Endpoints),
+		"warnings":  warnings,
+	})
+}
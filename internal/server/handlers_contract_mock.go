@@ -0,0 +1,154 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/DavidRHerbert/koor/internal/audit"
+	"github.com/DavidRHerbert/koor/internal/contracts"
+)
+
+// --- Contract mock handlers ---
+
+// mockInfo describes a running contract mock.
+type mockInfo struct {
+	Project   string    `json:"project"`
+	Name      string    `json:"name"`
+	Version   int64     `json:"version"`
+	URL       string    `json:"url"`
+	Endpoints []string  `json:"endpoints"`
+	StartedAt time.Time `json:"started_at"`
+	Calls     int64     `json:"calls"`
+}
+
+// contractMock is a running mock of one contract version, served under
+// /api/mocks/{project}/{name}/.
+type contractMock struct {
+	mockInfo
+	mock  *contracts.Mock
+	calls atomic.Int64
+}
+
+func (m *contractMock) info() mockInfo {
+	info := m.mockInfo
+	info.Calls = m.calls.Load()
+	return info
+}
+
+func mockURL(project, name string) string {
+	return "/api/mocks/" + project + "/" + name
+}
+
+// handleContractMockStart starts a mock of a contract version (body
+// {"version": N}, default the latest), replacing any mock already running
+// for the contract. Stored response examples are served as they are.
+func (s *Server) handleContractMockStart(w http.ResponseWriter, r *http.Request) {
+	project, name := r.PathValue("project"), r.PathValue("name")
+	var req struct {
+		Version int64 `json:"version"`
+	}
+	if r.ContentLength != 0 && !s.decodeBody(w, r, &req) {
+		return
+	}
+	if req.Version == 0 {
+		latest, err := s.specReg.Get(r.Context(), project, name)
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "contract not found: "+project+"/"+name)
+			return
+		}
+		if err != nil {
+			s.logger.Error("contract mock failed", "project", project, "name", name, "error", err)
+			writeError(w, http.StatusInternalServerError, "failed to get contract")
+			return
+		}
+		req.Version = latest.Version
+	}
+	c, ok := s.contractVersion(w, r, project, name, req.Version)
+	if !ok {
+		return
+	}
+	var examples []contracts.Example
+	if s.examples != nil {
+		var err error
+		if examples, err = s.examples.List(r.Context(), project, name, ""); err != nil {
+			s.logger.Error("contract example list failed", "project", project, "name", name, "error", err)
+			writeError(w, http.StatusInternalServerError, "failed to list contract examples")
+			return
+		}
+	}
+
+	m := &contractMock{mockInfo: mockInfo{
+		Project: project, Name: name, Version: req.Version,
+		URL: mockURL(project, name), StartedAt: time.Now().UTC(),
+	}, mock: contracts.NewMock(c, examples)}
+	m.Endpoints = m.mock.Endpoints()
+	s.mockMu.Lock()
+	if s.mocks == nil {
+		s.mocks = map[string]*contractMock{}
+	}
+	s.mocks[project+"/"+name] = m
+	s.mockMu.Unlock()
+
+	s.logger.Info("contract mock started", "project", project, "name", name, "version", req.Version)
+	s.audit(r.Context(), actorFromRequest(r), "contract.mock_start", project+"/"+name, audit.DetailJSON(map[string]any{
+		"version": req.Version,
+	}), "success")
+	writeJSON(w, http.StatusOK, m.info())
+}
+
+func (s *Server) handleContractMockStop(w http.ResponseWriter, r *http.Request) {
+	project, name := r.PathValue("project"), r.PathValue("name")
+	key := project + "/" + name
+	s.mockMu.Lock()
+	m, ok := s.mocks[key]
+	delete(s.mocks, key)
+	s.mockMu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "no mock running for contract: "+key)
+		return
+	}
+	s.logger.Info("contract mock stopped", "project", project, "name", name, "calls", m.calls.Load())
+	s.audit(r.Context(), actorFromRequest(r), "contract.mock_stop", key, audit.DetailJSON(map[string]any{
+		"calls": m.calls.Load(),
+	}), "success")
+	writeJSON(w, http.StatusOK, map[string]any{"stopped": key, "calls": m.calls.Load()})
+}
+
+// handleMockList lists the running mocks, only the caller's own project's
+// for a project-bound token.
+func (s *Server) handleMockList(w http.ResponseWriter, r *http.Request) {
+	id := identityFromRequest(r)
+	s.mockMu.Lock()
+	list := make([]mockInfo, 0, len(s.mocks))
+	for _, m := range s.mocks {
+		if id != nil && !id.OwnsProject(m.Project) {
+			continue
+		}
+		list = append(list, m.info())
+	}
+	s.mockMu.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].URL < list[j].URL })
+	writeJSON(w, http.StatusOK, list)
+}
+
+// handleMockServe answers a request to a running mock; the path after
+// /api/mocks/{project}/{name} is matched against the contract endpoints.
+func (s *Server) handleMockServe(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("project") + "/" + r.PathValue("name")
+	s.mockMu.Lock()
+	m, ok := s.mocks[key]
+	s.mockMu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "no mock running for contract: "+key+"; start one with POST /api/contracts/"+key+"/mock/start")
+		return
+	}
+	m.calls.Add(1)
+	r2 := r.Clone(r.Context())
+	r2.URL.Path = "/" + r.PathValue("path")
+	r2.URL.RawPath = ""
+	m.mock.ServeHTTP(w, r2)
+}
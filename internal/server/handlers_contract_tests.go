@@ -0,0 +1,226 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/DavidRHerbert/koor/internal/audit"
+	"github.com/DavidRHerbert/koor/internal/compliance"
+	"github.com/DavidRHerbert/koor/internal/contracts"
+)
+
+// --- Scheduled contract test handlers ---
+
+func (s *Server) handleContractScheduleCreate(w http.ResponseWriter, r *http.Request) {
+	if s.compSched == nil {
+		writeError(w, http.StatusServiceUnavailable, "compliance scheduler not configured")
+		return
+	}
+	var req struct {
+		Project  string `json:"project"`
+		Contract string `json:"contract"`
+		Target   string `json:"target"`
+		Interval string `json:"interval"`
+	}
+	if !s.decodeBody(w, r, &req) {
+		return
+	}
+	if missing := requiredFields("project", req.Project, "contract", req.Contract, "target", req.Target); len(missing) > 0 {
+		s.rejectFields(w, "project, contract, and target are required", missing...)
+		return
+	}
+	interval := time.Hour
+	if req.Interval != "" {
+		d, err := time.ParseDuration(req.Interval)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid interval: "+req.Interval)
+			return
+		}
+		interval = d
+	}
+	if _, err := s.specReg.Get(r.Context(), req.Project, req.Contract); errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "contract not found: "+req.Project+"/"+req.Contract)
+		return
+	}
+
+	cs, err := s.compSched.AddContractSchedule(r.Context(), req.Project, req.Contract, req.Target, interval)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.logger.Info("contract test scheduled", "id", cs.ID, "project", cs.Project, "contract", cs.Contract, "target", cs.Target)
+	s.audit(r.Context(), "", "contract_schedule.create", cs.ID, audit.DetailJSON(map[string]any{
+		"project": cs.Project, "contract": cs.Contract, "target": cs.Target, "interval": cs.Interval,
+	}), "success")
+	writeJSON(w, http.StatusOK, cs)
+}
+
+func (s *Server) handleContractScheduleList(w http.ResponseWriter, r *http.Request) {
+	if s.compSched == nil {
+		writeError(w, http.StatusServiceUnavailable, "compliance scheduler not configured")
+		return
+	}
+	list, err := s.compSched.ListContractSchedules(r.Context())
+	if err != nil {
+		s.logger.Error("contract schedule list failed", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to list contract schedules")
+		return
+	}
+	if list == nil {
+		list = []compliance.ContractSchedule{}
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (s *Server) handleContractScheduleDelete(w http.ResponseWriter, r *http.Request) {
+	if s.compSched == nil {
+		writeError(w, http.StatusServiceUnavailable, "compliance scheduler not configured")
+		return
+	}
+	id := r.PathValue("id")
+	err := s.compSched.DeleteContractSchedule(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "contract schedule not found: "+id)
+		return
+	}
+	if err != nil {
+		s.logger.Error("contract schedule delete failed", "id", id, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to delete contract schedule")
+		return
+	}
+	s.audit(r.Context(), "", "contract_schedule.delete", id, "", "success")
+	writeJSON(w, http.StatusOK, map[string]string{"deleted": id})
+}
+
+func (s *Server) handleContractScheduleRun(w http.ResponseWriter, r *http.Request) {
+	if s.compSched == nil {
+		writeError(w, http.StatusServiceUnavailable, "compliance scheduler not configured")
+		return
+	}
+	id := r.PathValue("id")
+	results, err := s.compSched.RunContractSchedule(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "contract schedule not found: "+id)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if results == nil {
+		results = []compliance.ContractTestResult{}
+	}
+	pass := 0
+	for _, res := range results {
+		if res.Pass {
+			pass++
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"schedule_id": id,
+		"results":     results,
+		"pass":        pass,
+		"fail":        len(results) - pass,
+	})
+}
+
+func (s *Server) handleContractScheduleResults(w http.ResponseWriter, r *http.Request) {
+	if s.compSched == nil {
+		writeError(w, http.StatusServiceUnavailable, "compliance scheduler not configured")
+		return
+	}
+	id := r.PathValue("id")
+	limit := 50
+	if v := r.URL.Query().Get("limit"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			limit = n
+		}
+	}
+	results, err := s.compSched.ContractTestHistory(r.Context(), id, limit)
+	if err != nil {
+		s.logger.Error("contract test history failed", "id", id, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to get contract test results")
+		return
+	}
+	if results == nil {
+		results = []compliance.ContractTestResult{}
+	}
+	writeJSON(w, http.StatusOK, results)
+}
+
+// handleContractDrift returns the latest drift check of a contract against
+// the running service named in its project's contract_targets setting.
+func (s *Server) handleContractDrift(w http.ResponseWriter, r *http.Request) {
+	if s.compSched == nil {
+		writeError(w, http.StatusServiceUnavailable, "compliance scheduler not configured")
+		return
+	}
+	project, name := r.PathValue("project"), r.PathValue("name")
+	check, err := s.compSched.Drift(r.Context(), project, name)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Never checked: no target configured, or not yet due.
+		writeJSON(w, http.StatusOK, compliance.DriftCheck{
+			Project: project, Contract: name, Endpoints: []compliance.DriftResult{},
+		})
+		return
+	}
+	if err != nil {
+		s.logger.Error("contract drift failed", "project", project, "name", name, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to get contract drift")
+		return
+	}
+	writeJSON(w, http.StatusOK, check)
+}
+
+// --- Contract test suite handler ---
+
+// handleContractTestSuite runs the named test cases stored in a contract
+// against a live service and reports each case.
+func (s *Server) handleContractTestSuite(w http.ResponseWriter, r *http.Request) {
+	project, name := r.PathValue("project"), r.PathValue("name")
+	var req struct {
+		BaseURL  string `json:"base_url"`
+		Endpoint string `json:"endpoint"`
+		Case     string `json:"case"`
+	}
+	if !s.decodeBody(w, r, &req) {
+		return
+	}
+	if req.BaseURL == "" {
+		s.rejectFields(w, "base_url is required", fieldError{Field: "base_url", Problem: "is required"})
+		return
+	}
+
+	spec, err := s.specReg.Get(r.Context(), project, name)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "contract not found: "+project+"/"+name)
+		return
+	}
+	if err != nil {
+		s.logger.Error("contract get failed", "project", project, "name", name, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to get contract")
+		return
+	}
+	contract, err := contracts.Parse(spec.Data)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "stored spec is not a valid contract: "+err.Error())
+		return
+	}
+
+	res, err := contracts.RunSuite(contract, req.BaseURL, req.Endpoint, req.Case)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"project":  project,
+		"contract": name,
+		"passed":   res.Fail == 0,
+		"cases":    res.Cases,
+		"pass":     res.Pass,
+		"fail":     res.Fail,
+	})
+}
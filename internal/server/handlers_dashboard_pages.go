@@ -0,0 +1,196 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DavidRHerbert/koor/internal/dashboard"
+	"github.com/DavidRHerbert/koor/internal/events"
+	"github.com/DavidRHerbert/koor/internal/instances"
+	"github.com/DavidRHerbert/koor/internal/state"
+)
+
+// --- Dashboard instance, event and state pages ---
+
+// renderDashboard writes a dashboard template, logging render errors.
+func (s *Server) renderDashboard(w http.ResponseWriter, name string, data any) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := dashboard.Templates.ExecuteTemplate(w, name, data); err != nil {
+		s.logger.Error("render dashboard", "template", name, "error", err)
+	}
+}
+
+// dashboardInstance is an instance row with how long ago it was last seen.
+type dashboardInstance struct {
+	instances.Summary
+	Ago string
+}
+
+// handleDashboardInstances renders the instances page; the table is
+// loaded and refreshed from /instances/list.
+func (s *Server) handleDashboardInstances(w http.ResponseWriter, r *http.Request) {
+	s.renderDashboard(w, "instances.html", nil)
+}
+
+// handleDashboardInstancesList renders the instances table fragment
+// (HTMX partial), stale instances first.
+func (s *Server) handleDashboardInstancesList(w http.ResponseWriter, r *http.Request) {
+	list, err := s.instanceReg.List(r.Context())
+	if err != nil {
+		s.logger.Error("dashboard list instances", "error", err)
+		http.Error(w, "failed to list instances", http.StatusInternalServerError)
+		return
+	}
+	rows := []dashboardInstance{}
+	for _, inst := range list {
+		if inst.Status == "stale" {
+			rows = append(rows, dashboardInstance{inst, sinceText(inst.LastSeen)})
+		}
+	}
+	for _, inst := range list {
+		if inst.Status != "stale" {
+			rows = append(rows, dashboardInstance{inst, sinceText(inst.LastSeen)})
+		}
+	}
+	s.renderDashboard(w, "instances_table.html", rows)
+}
+
+// handleDashboardEvents renders the event feed page; the feed is loaded
+// and refreshed from /events/list with the page's filters.
+func (s *Server) handleDashboardEvents(w http.ResponseWriter, r *http.Request) {
+	s.renderDashboard(w, "events.html", nil)
+}
+
+// handleDashboardEventsList renders the event feed fragment (HTMX
+// partial), newest first, filtered by topic pattern and source.
+func (s *Server) handleDashboardEventsList(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit := 50
+	if n, err := strconv.Atoi(q.Get("limit")); err == nil && n > 0 && n <= 500 {
+		limit = n
+	}
+	list, err := s.eventBus.History(r.Context(), limit, q.Get("topic"))
+	if err != nil {
+		s.logger.Error("dashboard list events", "error", err)
+		http.Error(w, "failed to list events", http.StatusInternalServerError)
+		return
+	}
+	feed := []events.Event{}
+	source := q.Get("source")
+	for _, ev := range visibleEvents(r, list) {
+		if source == "" || ev.Source == source {
+			feed = append(feed, ev)
+		}
+	}
+	s.renderDashboard(w, "events_feed.html", feed)
+}
+
+// handleDashboardState renders the state browser page.
+func (s *Server) handleDashboardState(w http.ResponseWriter, r *http.Request) {
+	s.renderDashboard(w, "state.html", nil)
+}
+
+// handleDashboardStateList renders the state keys fragment (HTMX
+// partial), filtered by key prefix.
+func (s *Server) handleDashboardStateList(w http.ResponseWriter, r *http.Request) {
+	list, err := s.stateStore.List(r.Context())
+	if err != nil {
+		s.logger.Error("dashboard list state", "error", err)
+		http.Error(w, "failed to list state", http.StatusInternalServerError)
+		return
+	}
+	prefix := r.URL.Query().Get("prefix")
+	keys := []state.Summary{}
+	for _, item := range list {
+		if strings.HasPrefix(item.Key, prefix) {
+			keys = append(keys, item)
+		}
+	}
+	s.renderDashboard(w, "state_table.html", keys)
+}
+
+// handleDashboardStateView renders a key's current value and version
+// history (HTMX partial).
+func (s *Server) handleDashboardStateView(w http.ResponseWriter, r *http.Request) {
+	key := r.URL.Query().Get("key")
+	entry, err := s.stateStore.Get(r.Context(), key)
+	if err != nil {
+		http.Error(w, "state key not found: "+key, http.StatusNotFound)
+		return
+	}
+	history, err := s.stateStore.History(r.Context(), key, 20)
+	if err != nil {
+		s.logger.Error("dashboard state history", "key", key, "error", err)
+		http.Error(w, "failed to get history", http.StatusInternalServerError)
+		return
+	}
+	s.renderDashboard(w, "state_view.html", struct {
+		Entry   *state.Entry
+		Value   string
+		History []state.HistoryEntry
+	}{entry, prettyValue(entry.Value), history})
+}
+
+// handleDashboardStateDiff renders the differences between two versions
+// of a key (HTMX partial).
+func (s *Server) handleDashboardStateDiff(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	key := q.Get("key")
+	v1, err1 := strconv.ParseInt(q.Get("v1"), 10, 64)
+	v2, err2 := strconv.ParseInt(q.Get("v2"), 10, 64)
+	if err1 != nil || err2 != nil {
+		http.Error(w, "v1 and v2 must be versions", http.StatusBadRequest)
+		return
+	}
+	diffs, err := s.stateStore.Diff(r.Context(), key, v1, v2)
+	data := struct {
+		Key    string
+		V1, V2 int64
+		Diffs  []dashboardDiff
+		Error  string
+	}{Key: key, V1: v1, V2: v2, Diffs: []dashboardDiff{}}
+	if err != nil {
+		data.Error = err.Error()
+	}
+	for _, d := range diffs {
+		oldJSON, _ := json.Marshal(d.Old)
+		newJSON, _ := json.Marshal(d.New)
+		data.Diffs = append(data.Diffs, dashboardDiff{Path: d.Path, Kind: d.Kind, Old: string(oldJSON), New: string(newJSON)})
+	}
+	s.renderDashboard(w, "state_diff.html", data)
+}
+
+// dashboardDiff is a state diff entry with its values as JSON text.
+type dashboardDiff struct {
+	Path, Kind string
+	Old, New   string
+}
+
+// prettyValue indents a JSON value for display; other values are shown
+// as they are.
+func prettyValue(v []byte) string {
+	var buf bytes.Buffer
+	if json.Indent(&buf, v, "", "  ") != nil {
+		return string(v)
+	}
+	return buf.String()
+}
+
+// sinceText describes how long ago t was, to the nearest unit.
+func sinceText(t time.Time) string {
+	d := time.Since(t)
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return strconv.Itoa(int(d.Minutes())) + "m ago"
+	case d < 48*time.Hour:
+		return strconv.Itoa(int(d.Hours())) + "h ago"
+	default:
+		return strconv.Itoa(int(d.Hours()/24)) + "d ago"
+	}
+}
@@ -0,0 +1,315 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DavidRHerbert/koor/internal/events"
+)
+
+// --- Digest handlers ---
+
+// digestWindow caps the events, state keys, rules and compliance failures
+// one digest covers. A digest that hits it is marked truncated.
+const digestWindow = 1000
+
+type digestEvent struct {
+	ID    int64     `json:"id"`
+	Topic string    `json:"topic"`
+	At    time.Time `json:"at"`
+	Data  string    `json:"data"` // one-line snippet
+}
+
+type digestAgent struct {
+	Agent    string        `json:"agent"` // the topic before .done or .request
+	Done     []digestEvent `json:"done"`
+	Requests []digestEvent `json:"requests"`
+}
+
+type digestKey struct {
+	Key       string    `json:"key"`
+	Version   int64     `json:"version"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type digestRule struct {
+	Project    string `json:"project"`
+	RuleID     string `json:"rule_id"`
+	Message    string `json:"message"`
+	ProposedBy string `json:"proposed_by,omitempty"`
+}
+
+type digestFailure struct {
+	InstanceID string    `json:"instance_id"`
+	Project    string    `json:"project"`
+	Check      string    `json:"check"` // contract or "policy:" + policy name
+	RunAt      time.Time `json:"run_at"`
+}
+
+// digest summarizes what happened after a checkpoint, so a controller can
+// catch up without re-reading the event history.
+type digest struct {
+	Project            string          `json:"project,omitempty"`
+	SinceEventID       int64           `json:"since_event_id,omitempty"`
+	Since              time.Time       `json:"since"`
+	LastEventID        int64           `json:"last_event_id"`
+	Events             int             `json:"events"` // all events after the checkpoint
+	Truncated          bool            `json:"truncated"`
+	Agents             []digestAgent   `json:"agents"`
+	StateChanged       []digestKey     `json:"state_changed"`
+	RulesProposed      []digestRule    `json:"rules_proposed"`
+	ComplianceFailures []digestFailure `json:"compliance_failures"`
+	Summary            string          `json:"summary"`
+}
+
+// handleDigest returns a compact summary of activity after ?since, an
+// event ID, an RFC 3339 time or a duration such as 1h: done and request
+// events grouped by agent, state keys changed, rules proposed and failed
+// compliance checks. ?project= narrows it to one project. last_event_id is
+// the checkpoint for the next call; ?format=markdown returns the summary
+// alone.
+func (s *Server) handleDigest(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	project := r.URL.Query().Get("project")
+	fail := func(what string, err error) {
+		s.logger.Error("digest failed", "project", project, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to "+what)
+	}
+
+	d := digest{
+		Project:            project,
+		Agents:             []digestAgent{},
+		StateChanged:       []digestKey{},
+		RulesProposed:      []digestRule{},
+		ComplianceFailures: []digestFailure{},
+	}
+	v := r.URL.Query().Get("since")
+	if v == "" {
+		writeError(w, http.StatusBadRequest, "since is required: an event ID, an RFC 3339 time or a duration")
+		return
+	}
+	if id, err := strconv.ParseInt(v, 10, 64); err == nil && id >= 0 {
+		d.SinceEventID = id
+	} else if t, err := time.Parse(time.RFC3339, v); err == nil {
+		d.Since = t.UTC()
+	} else if dur, err := time.ParseDuration(v); err == nil && dur > 0 {
+		d.Since = time.Now().Add(-dur).UTC()
+	} else {
+		writeError(w, http.StatusBadRequest, "invalid since: "+v+" (expected an event ID, an RFC 3339 time or a duration)")
+		return
+	}
+
+	// Events: after the checkpoint ID, or the newest ones after the time.
+	pattern := "*"
+	if project != "" {
+		pattern = strings.ToLower(project) + ".*"
+	}
+	var evs []events.Event
+	if d.SinceEventID > 0 || d.Since.IsZero() {
+		page, more, err := s.eventBus.Page(ctx, events.PageQuery{AfterID: d.SinceEventID, Topic: pattern, Limit: digestWindow})
+		if err != nil {
+			fail("read events", err)
+			return
+		}
+		evs, d.Truncated = page, more
+		// Keys, rules and checks are compared by time: that of the
+		// checkpoint event, or of the first one after it if it has been
+		// pruned.
+		if d.SinceEventID > 0 {
+			d.Since = time.Now().UTC()
+			if first, err := s.eventBus.Range(ctx, d.SinceEventID, 0, 1); err == nil && len(first) > 0 {
+				d.Since = first[0].CreatedAt.UTC()
+			}
+		}
+	} else {
+		history, err := s.eventBus.History(ctx, digestWindow, pattern)
+		if err != nil {
+			fail("read events", err)
+			return
+		}
+		for i := len(history) - 1; i >= 0; i-- {
+			if history[i].CreatedAt.After(d.Since) {
+				evs = append(evs, history[i])
+			}
+		}
+		d.Truncated = len(history) == digestWindow && len(evs) == len(history)
+	}
+	d.Events = len(evs)
+	// Keys, rules and checks are stored to the second, so anything in the
+	// checkpoint's second is included.
+	d.Since = d.Since.Truncate(time.Second)
+
+	byAgent := map[string]*digestAgent{}
+	for _, ev := range evs {
+		agent, isDone := strings.CutSuffix(ev.Topic, ".done")
+		isRequest := false
+		if !isDone {
+			agent, isRequest = strings.CutSuffix(ev.Topic, ".request")
+		}
+		if !isDone && !isRequest {
+			continue
+		}
+		a := byAgent[agent]
+		if a == nil {
+			a = &digestAgent{Agent: agent, Done: []digestEvent{}, Requests: []digestEvent{}}
+			byAgent[agent] = a
+		}
+		item := digestEvent{ID: ev.ID, Topic: ev.Topic, At: ev.CreatedAt, Data: snippet(ev.Data)}
+		if isDone {
+			a.Done = append(a.Done, item)
+		} else {
+			a.Requests = append(a.Requests, item)
+		}
+	}
+	for _, a := range byAgent {
+		d.Agents = append(d.Agents, *a)
+	}
+	sort.Slice(d.Agents, func(i, j int) bool { return d.Agents[i].Agent < d.Agents[j].Agent })
+
+	keys, err := s.stateStore.List(ctx)
+	if err != nil {
+		fail("list state", err)
+		return
+	}
+	for _, k := range keys {
+		if project != "" && !strings.HasPrefix(k.Key, project+"/") {
+			continue
+		}
+		if !k.UpdatedAt.Before(d.Since) {
+			d.StateChanged = append(d.StateChanged, digestKey{Key: k.Key, Version: k.Version, UpdatedAt: k.UpdatedAt})
+		}
+	}
+	sort.Slice(d.StateChanged, func(i, j int) bool { return d.StateChanged[i].UpdatedAt.After(d.StateChanged[j].UpdatedAt) })
+	if len(d.StateChanged) > digestWindow {
+		d.StateChanged, d.Truncated = d.StateChanged[:digestWindow], true
+	}
+
+	proposed, err := s.specReg.ListAllRules(ctx, project, "", "", "proposed")
+	if err != nil {
+		fail("list rules", err)
+		return
+	}
+	for _, rule := range proposed {
+		if project != "" && !strings.EqualFold(rule.Project, project) {
+			continue
+		}
+		if created, ok := parseDBTime(rule.CreatedAt); ok && created.Before(d.Since) {
+			continue
+		}
+		d.RulesProposed = append(d.RulesProposed, digestRule{
+			Project: rule.Project, RuleID: rule.RuleID, Message: rule.Message, ProposedBy: rule.ProposedBy,
+		})
+	}
+
+	if s.compSched != nil {
+		runs, err := s.compSched.Failures(ctx, project, d.Since, digestWindow)
+		if err != nil {
+			fail("list compliance failures", err)
+			return
+		}
+		for _, run := range runs {
+			check := run.Contract
+			if run.Policy != "" {
+				check = "policy:" + run.Policy
+			}
+			d.ComplianceFailures = append(d.ComplianceFailures, digestFailure{
+				InstanceID: run.InstanceID, Project: run.Project, Check: check, RunAt: run.RunAt,
+			})
+		}
+	}
+
+	// The next checkpoint: the newest event, or the last one covered if
+	// the events were cut short.
+	d.LastEventID = d.SinceEventID
+	if d.Truncated && d.SinceEventID > 0 && len(evs) > 0 {
+		d.LastEventID = evs[len(evs)-1].ID
+	} else if recent, err := s.eventBus.History(ctx, 1, ""); err == nil && len(recent) > 0 && recent[0].ID > d.LastEventID {
+		d.LastEventID = recent[0].ID
+	}
+
+	d.Summary = d.markdown()
+	if r.URL.Query().Get("format") == "markdown" {
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, d.Summary)
+		return
+	}
+	writeJSON(w, http.StatusOK, d)
+}
+
+// parseDBTime parses a timestamp as SQLite or the driver formats it.
+func parseDBTime(v string) (time.Time, bool) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05"} {
+		if t, err := time.Parse(layout, v); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// markdown renders the digest as a short summary for a language model.
+func (d *digest) markdown() string {
+	var b strings.Builder
+	b.WriteString("# Digest")
+	if d.Project != "" {
+		fmt.Fprintf(&b, ": %s", d.Project)
+	}
+	b.WriteString("\n\n")
+	if d.SinceEventID > 0 {
+		fmt.Fprintf(&b, "Since event #%d", d.SinceEventID)
+	} else {
+		fmt.Fprintf(&b, "Since %s", d.Since.Format(time.RFC3339))
+	}
+	fmt.Fprintf(&b, ": %d events, up to #%d.", d.Events, d.LastEventID)
+	if d.Truncated {
+		b.WriteString(" Truncated; ask again from the last event ID.")
+	}
+	b.WriteString("\n")
+
+	if len(d.Agents) == 0 && len(d.StateChanged) == 0 && len(d.RulesProposed) == 0 && len(d.ComplianceFailures) == 0 {
+		b.WriteString("\nNothing new.\n")
+		return b.String()
+	}
+	if len(d.Agents) > 0 {
+		b.WriteString("\n## Agents\n\n")
+		for _, a := range d.Agents {
+			fmt.Fprintf(&b, "- %s: %d done, %d requests\n", a.Agent, len(a.Done), len(a.Requests))
+			for _, ev := range a.Done {
+				fmt.Fprintf(&b, "  - done #%d: %s\n", ev.ID, ev.Data)
+			}
+			for _, ev := range a.Requests {
+				fmt.Fprintf(&b, "  - request #%d: %s\n", ev.ID, ev.Data)
+			}
+		}
+	}
+	if len(d.StateChanged) > 0 {
+		b.WriteString("\n## State changed\n\n")
+		for _, k := range d.StateChanged {
+			fmt.Fprintf(&b, "- %s (v%d)\n", k.Key, k.Version)
+		}
+	}
+	if len(d.RulesProposed) > 0 {
+		b.WriteString("\n## Rules proposed\n\n")
+		for _, rule := range d.RulesProposed {
+			fmt.Fprintf(&b, "- %s/%s", rule.Project, rule.RuleID)
+			if rule.Message != "" {
+				fmt.Fprintf(&b, ": %s", rule.Message)
+			}
+			if rule.ProposedBy != "" {
+				fmt.Fprintf(&b, " (by %s)", rule.ProposedBy)
+			}
+			b.WriteString("\n")
+		}
+	}
+	if len(d.ComplianceFailures) > 0 {
+		b.WriteString("\n## Compliance failures\n\n")
+		for _, f := range d.ComplianceFailures {
+			fmt.Fprintf(&b, "- %s failed %s at %s\n", f.InstanceID, f.Check, f.RunAt.Format(time.RFC3339))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,48 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/DavidRHerbert/koor/internal/audit"
+	"github.com/DavidRHerbert/koor/internal/events"
+)
+
+// --- Event retention handlers ---
+
+// handleEventRetentionGet lists the retention classes in the order topics
+// are matched against them, most specific first.
+func (s *Server) handleEventRetentionGet(w http.ResponseWriter, r *http.Request) {
+	policies, err := s.eventBus.RetentionPolicies(r.Context())
+	if err != nil {
+		s.logger.Error("list event retention failed", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to list event retention")
+		return
+	}
+	if policies == nil {
+		policies = []events.RetentionPolicy{}
+	}
+	writeJSON(w, http.StatusOK, policies)
+}
+
+// handleEventRetentionPut replaces the retention classes. The pruning loop
+// picks them up on its next run.
+func (s *Server) handleEventRetentionPut(w http.ResponseWriter, r *http.Request) {
+	var policies []events.RetentionPolicy
+	if !s.decodeBody(w, r, &policies) {
+		return
+	}
+	if err := events.ValidateRetention(policies); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := s.eventBus.SetRetentionPolicies(r.Context(), policies); err != nil {
+		s.logger.Error("set event retention failed", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to set event retention")
+		return
+	}
+	s.logger.Info("event retention updated", "policies", len(policies))
+	s.audit(r.Context(), actorFromRequest(r), "events.retention", "", audit.DetailJSON(map[string]any{
+		"policies": policies,
+	}), "success")
+	s.handleEventRetentionGet(w, r)
+}
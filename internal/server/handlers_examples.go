@@ -0,0 +1,127 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/DavidRHerbert/koor/internal/audit"
+	"github.com/DavidRHerbert/koor/internal/contracts"
+)
+
+// --- Contract example handlers ---
+
+func (s *Server) handleContractExampleList(w http.ResponseWriter, r *http.Request) {
+	if s.examples == nil {
+		writeError(w, http.StatusServiceUnavailable, "contract examples not configured")
+		return
+	}
+	project, name := r.PathValue("project"), r.PathValue("name")
+	list, err := s.examples.List(r.Context(), project, name, r.URL.Query().Get("endpoint"))
+	if err != nil {
+		s.logger.Error("contract example list failed", "project", project, "name", name, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to list contract examples")
+		return
+	}
+	if list == nil {
+		list = []contracts.Example{}
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// handleContractExampleSave stores a named example after checking that it
+// satisfies the contract; invalid payloads are rejected with their violations.
+func (s *Server) handleContractExampleSave(w http.ResponseWriter, r *http.Request) {
+	if s.examples == nil {
+		writeError(w, http.StatusServiceUnavailable, "contract examples not configured")
+		return
+	}
+	project, name := r.PathValue("project"), r.PathValue("name")
+
+	var req contracts.Example
+	if !s.decodeBody(w, r, &req) {
+		return
+	}
+	if missing := requiredFields("name", req.Name, "endpoint", req.Endpoint, "payload", string(req.Payload)); len(missing) > 0 {
+		s.rejectFields(w, "name, endpoint and payload are required", missing...)
+		return
+	}
+	if req.Direction == "" {
+		req.Direction = "request"
+	}
+
+	spec, err := s.specReg.Get(r.Context(), project, name)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "contract not found: "+project+"/"+name)
+		return
+	}
+	if err != nil {
+		s.logger.Error("contract get failed", "project", project, "name", name, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to get contract")
+		return
+	}
+	contract, err := contracts.Parse(spec.Data)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "stored spec is not a valid contract: "+err.Error())
+		return
+	}
+	if violations := validateExample(contract, req); len(violations) > 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]any{
+			"error":      "example does not satisfy the contract",
+			"code":       http.StatusBadRequest,
+			"violations": violations,
+		})
+		return
+	}
+
+	req.Project, req.Contract = project, name
+	ex, err := s.examples.Save(r.Context(), req)
+	if err != nil {
+		s.logger.Error("contract example save failed", "project", project, "name", name, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to save contract example")
+		return
+	}
+	s.logger.Info("contract example saved", "project", project, "contract", name, "example", ex.Name)
+	s.audit(r.Context(), actorFromRequest(r), "contract.example.save", project+"/"+name, audit.DetailJSON(map[string]any{
+		"name": ex.Name, "endpoint": ex.Endpoint, "direction": ex.Direction,
+	}), "success")
+	writeJSON(w, http.StatusOK, ex)
+}
+
+func (s *Server) handleContractExampleDelete(w http.ResponseWriter, r *http.Request) {
+	if s.examples == nil {
+		writeError(w, http.StatusServiceUnavailable, "contract examples not configured")
+		return
+	}
+	project, name, example := r.PathValue("project"), r.PathValue("name"), r.PathValue("example")
+	err := s.examples.Delete(r.Context(), project, name, example)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "contract example not found: "+example)
+		return
+	}
+	if err != nil {
+		s.logger.Error("contract example delete failed", "project", project, "name", name, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to delete contract example")
+		return
+	}
+	s.logger.Info("contract example deleted", "project", project, "contract", name, "example", example)
+	s.audit(r.Context(), actorFromRequest(r), "contract.example.delete", project+"/"+name, audit.DetailJSON(map[string]any{
+		"name": example,
+	}), "success")
+	writeJSON(w, http.StatusOK, map[string]any{"deleted": example})
+}
+
+// validateExample checks an example payload the same way the validate
+// endpoint would. Array payloads are checked against response_array.
+func validateExample(c *contracts.Contract, ex contracts.Example) []contracts.Violation {
+	var items []any
+	if ex.Direction == "response" && json.Unmarshal(ex.Payload, &items) == nil {
+		return contracts.ValidateResponseArray(c, ex.Endpoint, items)
+	}
+	var payload map[string]any
+	if err := json.Unmarshal(ex.Payload, &payload); err != nil {
+		return []contracts.Violation{{Path: ex.Direction, Message: "payload must be a JSON object"}}
+	}
+	return contracts.ValidatePayload(c, ex.Endpoint, ex.Direction, payload)
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/DavidRHerbert/koor/internal/audit"
+	"github.com/DavidRHerbert/koor/internal/federation"
+)
+
+// --- Federation handlers ---
+
+// handleFederationPack serves this server's shareable rules and templates
+// to downstream servers.
+func (s *Server) handleFederationPack(w http.ResponseWriter, r *http.Request) {
+	data, etag, err := federation.BuildPack(r.Context(), s.specReg, s.templateStore)
+	if err != nil {
+		s.logger.Error("federation pack failed", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to build federation pack")
+		return
+	}
+
+	// Support ETag caching.
+	w.Header().Set("ETag", etag)
+	if match := r.Header.Get("If-None-Match"); match == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+func (s *Server) handleFederationStatus(w http.ResponseWriter, r *http.Request) {
+	if s.federation == nil {
+		writeError(w, http.StatusServiceUnavailable, "federation not configured")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.federation.Status())
+}
+
+// handleFederationSync pulls the upstream pack now rather than waiting for
+// the next interval.
+func (s *Server) handleFederationSync(w http.ResponseWriter, r *http.Request) {
+	if s.federation == nil {
+		writeError(w, http.StatusServiceUnavailable, "federation not configured")
+		return
+	}
+	status := s.federation.Status()
+	res, err := s.federation.Sync(r.Context())
+	if err != nil {
+		s.audit(r.Context(), actorFromRequest(r), "federation.sync", status.Upstream, audit.DetailJSON(map[string]any{"error": err.Error()}), "failure")
+		writeError(w, http.StatusBadGateway, "federation sync failed: "+err.Error())
+		return
+	}
+	s.logger.Info("federation synced", "upstream", status.Upstream, "changed", res.Changed)
+	s.audit(r.Context(), actorFromRequest(r), "federation.sync", status.Upstream, audit.DetailJSON(map[string]any{
+		"changed": res.Changed, "rules_applied": res.RulesApplied, "rules_removed": res.RulesRemoved,
+		"templates_applied": res.TemplatesApplied, "templates_removed": res.TemplatesRemoved,
+	}), "success")
+	writeJSON(w, http.StatusOK, map[string]any{"synced": true, "result": res, "status": s.federation.Status()})
+}
@@ -0,0 +1,286 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/DavidRHerbert/koor/internal/compliance"
+	"github.com/DavidRHerbert/koor/internal/events"
+	"github.com/DavidRHerbert/koor/internal/graphql"
+	"github.com/DavidRHerbert/koor/internal/instances"
+	"github.com/DavidRHerbert/koor/internal/specs"
+	"github.com/DavidRHerbert/koor/internal/state"
+)
+
+// --- GraphQL handlers ---
+
+// handleGraphQL runs a read-only GraphQL query over instances, state,
+// events, rules and compliance runs, so a dashboard can fetch an overview
+// in one round trip. GET without ?query= returns the schema.
+func (s *Server) handleGraphQL(w http.ResponseWriter, r *http.Request) {
+	var req graphql.Request
+	if r.Method == http.MethodGet {
+		q := r.URL.Query()
+		if !q.Has("query") {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.Write([]byte(s.graphqlSchema(r).SDL()))
+			return
+		}
+		req.Query, req.OperationName = q.Get("query"), q.Get("operationName")
+		if v := q.Get("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+				writeError(w, http.StatusBadRequest, "variables must be a JSON object")
+				return
+			}
+		}
+	} else if !s.decodeBody(w, r, &req) {
+		return
+	}
+	if strings.TrimSpace(req.Query) == "" {
+		s.rejectFields(w, "query is required", fieldError{Field: "query", Problem: "is required"})
+		return
+	}
+
+	resp := s.graphqlSchema(r).Execute(r.Context(), req)
+	status := http.StatusOK
+	if resp.Data == nil {
+		status = http.StatusBadRequest
+	}
+	writeJSON(w, status, resp)
+}
+
+// graphqlSchema builds the query schema for one request. Resolvers apply
+// the same project and topic limits as the REST endpoints they mirror.
+func (s *Server) graphqlSchema(r *http.Request) *graphql.Schema {
+	run := &graphql.Object{Name: "ComplianceRun", Fields: []*graphql.Field{
+		{Name: "id", Type: "Int!"},
+		{Name: "instance_id", Type: "String!"},
+		{Name: "project", Type: "String!"},
+		{Name: "contract", Type: "String!"},
+		{Name: "policy", Type: "String!"},
+		{Name: "pass", Type: "Boolean!"},
+		{Name: "violations", Type: "JSON"},
+		{Name: "findings", Type: "JSON"},
+		{Name: "run_at", Type: "Time!"},
+	}}
+	stateEntry := &graphql.Object{Name: "StateEntry", Fields: []*graphql.Field{
+		{Name: "key", Type: "String!"},
+		{Name: "version", Type: "Int!"},
+		{Name: "content_type", Type: "String!"},
+		{Name: "updated_at", Type: "Time!"},
+		{Name: "owner", Type: "String", Description: "Owning instance ID, from the key's metadata",
+			Resolve: stateMeta(func(m *state.Meta) any { return m.Owner })},
+		{Name: "description", Type: "String",
+			Resolve: stateMeta(func(m *state.Meta) any { return m.Description })},
+		{Name: "tags", Type: "[String!]",
+			Resolve: stateMeta(func(m *state.Meta) any { return m.Tags })},
+		{Name: "value", Type: "JSON", Description: "The value; JSON values are returned as JSON, others as a string",
+			Resolve: s.gqlStateValue},
+	}}
+	instance := &graphql.Object{Name: "Instance", Fields: []*graphql.Field{
+		{Name: "id", Type: "String!"},
+		{Name: "name", Type: "String!"},
+		{Name: "workspace", Type: "String!"},
+		{Name: "intent", Type: "String!"},
+		{Name: "stack", Type: "String!"},
+		{Name: "project", Type: "String!"},
+		{Name: "capabilities", Type: "[String!]"},
+		{Name: "status", Type: "String!"},
+		{Name: "registered_at", Type: "Time!"},
+		{Name: "last_seen", Type: "Time!"},
+		{Name: "state", Type: "[StateEntry!]!", Of: stateEntry, Description: "State keys the instance owns",
+			Resolve: func(ctx context.Context, source any, args graphql.Args) (any, error) {
+				return s.gqlState(r, "", source.(instances.Summary).ID, "", 0)
+			}},
+		{Name: "compliance", Type: "[ComplianceRun!]!", Of: run, Description: "The instance's latest compliance runs",
+			Args: []graphql.Arg{{Name: "limit", Type: "Int", Default: "10"}},
+			Resolve: func(ctx context.Context, source any, args graphql.Args) (any, error) {
+				return s.gqlComplianceRuns(r, source.(instances.Summary).ID, "", nil, args.Int("limit", 10))
+			}},
+	}}
+	event := &graphql.Object{Name: "Event", Fields: []*graphql.Field{
+		{Name: "id", Type: "Int!"},
+		{Name: "topic", Type: "String!"},
+		{Name: "data", Type: "JSON"},
+		{Name: "source", Type: "String!"},
+		{Name: "signer", Type: "String"},
+		{Name: "created_at", Type: "Time!"},
+	}}
+	rule := &graphql.Object{Name: "Rule", Fields: []*graphql.Field{
+		{Name: "project", Type: "String!"},
+		{Name: "rule_id", Type: "String!"},
+		{Name: "severity", Type: "String!"},
+		{Name: "match_type", Type: "String!"},
+		{Name: "pattern", Type: "String!"},
+		{Name: "message", Type: "String!"},
+		{Name: "stack", Type: "String!"},
+		{Name: "applies_to", Type: "[String!]"},
+		{Name: "source", Type: "String!"},
+		{Name: "status", Type: "String!"},
+		{Name: "proposed_by", Type: "String"},
+		{Name: "created_at", Type: "String"},
+	}}
+
+	query := &graphql.Object{Name: "Query", Fields: []*graphql.Field{
+		{Name: "instances", Type: "[Instance!]!", Of: instance, Description: "Registered agent instances",
+			Args: []graphql.Arg{{Name: "project", Type: "String"}, {Name: "name", Type: "String"},
+				{Name: "stack", Type: "String"}, {Name: "capability", Type: "String"}, {Name: "status", Type: "String"}},
+			Resolve: func(ctx context.Context, _ any, args graphql.Args) (any, error) {
+				items, err := s.instanceReg.Discover(ctx, args.String("name"), "", args.String("stack"), args.String("capability"))
+				if err != nil {
+					return nil, errors.New("failed to list instances")
+				}
+				out := []instances.Summary{}
+				for _, item := range ownInstances(r, items) {
+					if p := args.String("project"); p != "" && item.Project != p {
+						continue
+					}
+					if st := args.String("status"); st != "" && item.Status != st {
+						continue
+					}
+					out = append(out, item)
+				}
+				return out, nil
+			}},
+		{Name: "state", Type: "[StateEntry!]!", Of: stateEntry, Description: "State keys, without their values unless value is selected",
+			Args: []graphql.Arg{{Name: "prefix", Type: "String"}, {Name: "owner", Type: "String"},
+				{Name: "tag", Type: "String"}, {Name: "limit", Type: "Int"}},
+			Resolve: func(ctx context.Context, _ any, args graphql.Args) (any, error) {
+				return s.gqlState(r, args.String("prefix"), args.String("owner"), args.String("tag"), args.Int("limit", 0))
+			}},
+		{Name: "events", Type: "[Event!]!", Of: event, Description: "Recent events, newest first",
+			Args: []graphql.Arg{{Name: "topic", Type: "String", Description: "Topic or glob pattern"},
+				{Name: "source", Type: "String"}, {Name: "last", Type: "Int", Default: "50"}},
+			Resolve: func(ctx context.Context, _ any, args graphql.Args) (any, error) {
+				return s.gqlEvents(r, args.String("topic"), args.String("source"), args.Int("last", 50))
+			}},
+		{Name: "rules", Type: "[Rule!]!", Of: rule, Description: "Validation rules of every status",
+			Args: []graphql.Arg{{Name: "project", Type: "String"}, {Name: "stack", Type: "String"},
+				{Name: "source", Type: "String"}, {Name: "status", Type: "String"}},
+			Resolve: func(ctx context.Context, _ any, args graphql.Args) (any, error) {
+				list, err := s.specReg.ListAllRules(ctx, args.String("project"), args.String("stack"), args.String("source"), args.String("status"))
+				if err != nil {
+					return nil, errors.New("failed to list rules")
+				}
+				out := []specs.Rule{}
+				id := identityFromRequest(r)
+				for _, rule := range list {
+					if id == nil || id.OwnsProject(rule.Project) {
+						out = append(out, rule)
+					}
+				}
+				return out, nil
+			}},
+		{Name: "compliance_runs", Type: "[ComplianceRun!]!", Of: run, Description: "Latest compliance runs, newest first",
+			Args: []graphql.Arg{{Name: "instance_id", Type: "String"}, {Name: "project", Type: "String"},
+				{Name: "pass", Type: "Boolean"}, {Name: "limit", Type: "Int", Default: "50"}},
+			Resolve: func(ctx context.Context, _ any, args graphql.Args) (any, error) {
+				var pass *bool
+				if v, ok := args.Bool("pass"); ok {
+					pass = &v
+				}
+				return s.gqlComplianceRuns(r, args.String("instance_id"), args.String("project"), pass, args.Int("limit", 50))
+			}},
+	}}
+	return &graphql.Schema{Query: query}
+}
+
+// stateMeta resolves a field of a state entry's metadata.
+func stateMeta(get func(*state.Meta) any) graphql.ResolveFunc {
+	return func(ctx context.Context, source any, args graphql.Args) (any, error) {
+		if m := source.(state.Summary).Meta; m != nil {
+			return get(m), nil
+		}
+		return nil, nil
+	}
+}
+
+func (s *Server) gqlStateValue(ctx context.Context, source any, args graphql.Args) (any, error) {
+	e, err := s.stateStore.Get(ctx, source.(state.Summary).Key)
+	if err != nil {
+		return nil, errors.New("failed to get state value")
+	}
+	if json.Valid(e.Value) {
+		return json.RawMessage(e.Value), nil
+	}
+	return string(e.Value), nil
+}
+
+// gqlState lists the state keys the caller may read, filtered by key
+// prefix, owner and tag.
+func (s *Server) gqlState(r *http.Request, prefix, owner, tag string, limit int) ([]state.Summary, error) {
+	items, err := s.stateStore.List(r.Context())
+	if err != nil {
+		return nil, errors.New("failed to list state")
+	}
+	id := identityFromRequest(r)
+	out := []state.Summary{}
+	for _, item := range items {
+		switch {
+		case id != nil && !id.OwnsKey(item.Key),
+			!strings.HasPrefix(item.Key, prefix),
+			owner != "" && (item.Meta == nil || item.Meta.Owner != owner),
+			tag != "" && !item.Meta.HasTag(tag):
+			continue
+		}
+		out = append(out, item)
+		if limit > 0 && len(out) == limit {
+			break
+		}
+	}
+	return out, nil
+}
+
+// gqlEvents returns recent events the caller may see. Callers limited to
+// a project default to its topics, as on GET /api/events/history.
+func (s *Server) gqlEvents(r *http.Request, topic, source string, last int) ([]events.Event, error) {
+	if id := identityFromRequest(r); id != nil && !id.CrossProject() {
+		if topic == "" {
+			topic = strings.ToLower(id.Project) + ".*"
+		} else if !id.OwnsTopic(topic) {
+			return nil, errors.New("token " + id.Name + " is limited to project " + id.Project)
+		}
+	}
+	var list []events.Event
+	var err error
+	if source != "" {
+		list, err = s.eventBus.HistoryByTimeRange(r.Context(), time.Time{}, time.Time{}, source, topic, last)
+	} else {
+		list, err = s.eventBus.History(r.Context(), last, topic)
+	}
+	if err != nil {
+		return nil, errors.New("failed to get event history")
+	}
+	if list == nil {
+		list = []events.Event{}
+	}
+	return visibleEvents(r, list), nil
+}
+
+// gqlComplianceRuns returns the latest compliance runs, filtered by
+// project and outcome after the limit is applied.
+func (s *Server) gqlComplianceRuns(r *http.Request, instanceID, project string, pass *bool, limit int) ([]compliance.Run, error) {
+	if s.compSched == nil {
+		return nil, errors.New("compliance scheduler not configured")
+	}
+	runs, err := s.compSched.History(r.Context(), instanceID, limit)
+	if err != nil {
+		return nil, errors.New("failed to get compliance history")
+	}
+	id := identityFromRequest(r)
+	out := []compliance.Run{}
+	for _, run := range runs {
+		switch {
+		case id != nil && !id.OwnsProject(run.Project),
+			project != "" && run.Project != project,
+			pass != nil && run.Pass != *pass:
+			continue
+		}
+		out = append(out, run)
+	}
+	return out, nil
+}
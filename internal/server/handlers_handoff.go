@@ -0,0 +1,334 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DavidRHerbert/koor/internal/tasks"
+)
+
+// --- Project handoff handlers ---
+
+// handoffDecisions is how many recent controller events a handoff includes
+// by default.
+const handoffDecisions = 10
+
+// handoffSnippet caps the JSON shown per item in the markdown briefing.
+const handoffSnippet = 200
+
+type handoffMilestone struct {
+	Name      string     `json:"name"`
+	Due       *time.Time `json:"due,omitempty"`
+	Completed int        `json:"completed"`
+	Total     int        `json:"total"`
+	Percent   float64    `json:"percent"`
+	Overdue   bool       `json:"overdue"`
+	Remaining []string   `json:"remaining"`
+}
+
+type handoffPlan struct {
+	Notes      json.RawMessage    `json:"notes,omitempty"` // state key "{Project}/plan"
+	Milestones []handoffMilestone `json:"milestones"`
+	Tasks      map[string]int     `json:"tasks"` // queue tasks by status
+}
+
+type handoffAgent struct {
+	Name     string          `json:"name"`
+	Role     string          `json:"role"`
+	Status   string          `json:"status"`
+	Intent   string          `json:"intent,omitempty"`
+	LastSeen time.Time       `json:"last_seen"`
+	Task     json.RawMessage `json:"task,omitempty"`
+}
+
+type handoffApproval struct {
+	Kind  string          `json:"kind"` // request or proposed_rule
+	Ref   string          `json:"ref"`
+	Title string          `json:"title"`
+	Since time.Time       `json:"since"`
+	Data  json.RawMessage `json:"data,omitempty"`
+}
+
+type handoffDecision struct {
+	EventID   int64           `json:"event_id"`
+	Topic     string          `json:"topic"`
+	RequestID int64           `json:"request_id,omitempty"`
+	Data      json.RawMessage `json:"data"`
+	At        time.Time       `json:"at"`
+}
+
+// handoff is everything a fresh controller session needs to pick up a
+// project: where the plan stands, what each agent is doing, what waits on
+// the controller and what it decided recently.
+type handoff struct {
+	Project     string            `json:"project"`
+	GeneratedAt time.Time         `json:"generated_at"`
+	LastEventID int64             `json:"last_event_id"`
+	Plan        handoffPlan       `json:"plan"`
+	Agents      []handoffAgent    `json:"agents"`
+	Approvals   []handoffApproval `json:"approvals"`
+	Decisions   []handoffDecision `json:"decisions"`
+	Briefing    string            `json:"briefing"`
+}
+
+// handleProjectHandoff returns a compact briefing a newly started
+// controller session can resume from in one call, instead of replaying
+// the event history. The JSON carries the same facts as the markdown
+// "briefing" field; ?format=markdown returns the briefing alone.
+// ?decisions=N changes how many recent controller events are included.
+func (s *Server) handleProjectHandoff(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	project := r.PathValue("project")
+	slug := strings.ToLower(project)
+	fail := func(what string, err error) {
+		s.logger.Error("project handoff failed", "project", project, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to "+what)
+	}
+
+	limit := handoffDecisions
+	if v := r.URL.Query().Get("decisions"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "decisions must be a non-negative integer")
+			return
+		}
+		limit = n
+	}
+
+	h := handoff{
+		Project:     project,
+		GeneratedAt: time.Now().UTC(),
+		Plan:        handoffPlan{Milestones: []handoffMilestone{}, Tasks: map[string]int{}},
+		Agents:      []handoffAgent{},
+		Approvals:   []handoffApproval{},
+		Decisions:   []handoffDecision{},
+	}
+
+	// Plan: free-form notes, milestone progress and the task queue.
+	if entry, err := s.stateStore.Get(ctx, project+"/plan"); err == nil {
+		h.Plan.Notes = json.RawMessage(entry.Value)
+		if !json.Valid(h.Plan.Notes) {
+			h.Plan.Notes, _ = json.Marshal(string(entry.Value))
+		}
+	}
+	if s.milestones != nil {
+		list, err := s.milestones.List(ctx, project)
+		if err != nil {
+			fail("list milestones", err)
+			return
+		}
+		for _, m := range list {
+			p, err := s.milestones.Progress(ctx, m, false)
+			if err != nil {
+				continue
+			}
+			hm := handoffMilestone{
+				Name: m.Name, Due: m.Due, Completed: p.Completed, Total: p.Total,
+				Percent: p.Percent, Overdue: p.Overdue, Remaining: []string{},
+			}
+			for _, it := range p.Items {
+				if !it.Done {
+					hm.Remaining = append(hm.Remaining, it.Name)
+				}
+			}
+			h.Plan.Milestones = append(h.Plan.Milestones, hm)
+		}
+	}
+	if s.tasks != nil {
+		list, err := s.tasks.List(ctx, tasks.Filter{Project: project})
+		if err != nil {
+			fail("list tasks", err)
+			return
+		}
+		for _, t := range list {
+			h.Plan.Tasks[t.Status]++
+		}
+	}
+
+	// Agents, with the task each one holds.
+	roleTasks, err := s.projectTasks(ctx, project)
+	if err != nil {
+		fail("list state", err)
+		return
+	}
+	members, err := s.projectAgents(ctx, project)
+	if err != nil {
+		fail("list instances", err)
+		return
+	}
+	for _, inst := range members {
+		a := handoffAgent{
+			Name: inst.Name, Role: inst.Role, Status: inst.Status,
+			Intent: inst.Intent, LastSeen: inst.LastSeen,
+		}
+		if t := roleTasks[inst.Role]; t != nil {
+			a.Task = t.Value
+		}
+		h.Agents = append(h.Agents, a)
+	}
+	sort.Slice(h.Agents, func(i, j int) bool { return h.Agents[i].Name < h.Agents[j].Name })
+
+	// Open approvals: unanswered requests, then rule proposals.
+	requests, _, err := s.projectRequests(ctx, project)
+	if err != nil {
+		fail("read events", err)
+		return
+	}
+	for i := len(requests) - 1; i >= 0; i-- {
+		ev := requests[i]
+		h.Approvals = append(h.Approvals, handoffApproval{
+			Kind: "request", Ref: strconv.FormatInt(ev.ID, 10), Title: ev.Topic,
+			Since: ev.CreatedAt, Data: ev.Data,
+		})
+	}
+	proposed, err := s.specReg.ListAllRules(ctx, project, "", "", "proposed")
+	if err != nil {
+		fail("list rules", err)
+		return
+	}
+	for _, rule := range proposed {
+		since, _ := time.Parse(time.RFC3339, rule.CreatedAt)
+		title := rule.Message
+		if title == "" {
+			title = rule.Pattern
+		}
+		h.Approvals = append(h.Approvals, handoffApproval{
+			Kind: "proposed_rule", Ref: rule.Project + "/" + rule.RuleID, Title: title, Since: since,
+		})
+	}
+
+	// Recent decisions: the controller's own events, newest first.
+	if limit > 0 {
+		history, err := s.eventBus.History(ctx, statusEventWindow, slug+".controller.*")
+		if err != nil {
+			fail("read events", err)
+			return
+		}
+		for _, ev := range history {
+			if len(h.Decisions) == limit {
+				break
+			}
+			var ref struct {
+				RequestID int64 `json:"request_id"`
+			}
+			json.Unmarshal(ev.Data, &ref)
+			h.Decisions = append(h.Decisions, handoffDecision{
+				EventID: ev.ID, Topic: ev.Topic, RequestID: ref.RequestID, Data: ev.Data, At: ev.CreatedAt,
+			})
+		}
+	}
+
+	// Resume point for a subscription that should not miss anything.
+	if recent, err := s.eventBus.History(ctx, 1, ""); err == nil && len(recent) > 0 {
+		h.LastEventID = recent[0].ID
+	}
+
+	h.Briefing = h.markdown()
+	if r.URL.Query().Get("format") == "markdown" {
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, h.Briefing)
+		return
+	}
+	writeJSON(w, http.StatusOK, h)
+}
+
+// markdown renders the handoff as a short briefing for a language model.
+func (h *handoff) markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Handoff: %s\n\n", h.Project)
+	fmt.Fprintf(&b, "Generated %s. Events up to #%d are summarized here.\n\n",
+		h.GeneratedAt.Format(time.RFC3339), h.LastEventID)
+
+	b.WriteString("## Plan\n\n")
+	if len(h.Plan.Notes) > 0 {
+		fmt.Fprintf(&b, "Notes: %s\n\n", snippet(h.Plan.Notes))
+	}
+	for _, m := range h.Plan.Milestones {
+		fmt.Fprintf(&b, "- Milestone %s: %d/%d done (%.0f%%)", m.Name, m.Completed, m.Total, m.Percent)
+		if m.Due != nil {
+			fmt.Fprintf(&b, ", due %s", m.Due.Format("2006-01-02"))
+		}
+		if m.Overdue {
+			b.WriteString(", OVERDUE")
+		}
+		if len(m.Remaining) > 0 {
+			fmt.Fprintf(&b, "; remaining: %s", strings.Join(m.Remaining, ", "))
+		}
+		b.WriteString("\n")
+	}
+	if len(h.Plan.Tasks) > 0 {
+		statuses := make([]string, 0, len(h.Plan.Tasks))
+		for st := range h.Plan.Tasks {
+			statuses = append(statuses, st)
+		}
+		sort.Strings(statuses)
+		parts := make([]string, len(statuses))
+		for i, st := range statuses {
+			parts[i] = fmt.Sprintf("%d %s", h.Plan.Tasks[st], st)
+		}
+		fmt.Fprintf(&b, "- Task queue: %s\n", strings.Join(parts, ", "))
+	}
+	if len(h.Plan.Notes) == 0 && len(h.Plan.Milestones) == 0 && len(h.Plan.Tasks) == 0 {
+		b.WriteString("No plan recorded.\n")
+	}
+
+	b.WriteString("\n## Agents\n\n")
+	if len(h.Agents) == 0 {
+		b.WriteString("No agents registered.\n")
+	}
+	for _, a := range h.Agents {
+		fmt.Fprintf(&b, "- %s (%s): %s, last seen %s", a.Name, a.Role, a.Status, a.LastSeen.UTC().Format(time.RFC3339))
+		if a.Intent != "" {
+			fmt.Fprintf(&b, "; intent: %s", a.Intent)
+		}
+		if len(a.Task) > 0 {
+			fmt.Fprintf(&b, "; task: %s", snippet(a.Task))
+		}
+		b.WriteString("\n")
+	}
+
+	b.WriteString("\n## Open approvals\n\n")
+	if len(h.Approvals) == 0 {
+		b.WriteString("Nothing is waiting on the controller.\n")
+	}
+	for _, a := range h.Approvals {
+		switch a.Kind {
+		case "request":
+			fmt.Fprintf(&b, "- Request #%s on %s since %s", a.Ref, a.Title, a.Since.UTC().Format(time.RFC3339))
+			if len(a.Data) > 0 {
+				fmt.Fprintf(&b, ": %s", snippet(a.Data))
+			}
+		default:
+			fmt.Fprintf(&b, "- Proposed rule %s: %s", a.Ref, a.Title)
+		}
+		b.WriteString("\n")
+	}
+
+	b.WriteString("\n## Recent decisions\n\n")
+	if len(h.Decisions) == 0 {
+		b.WriteString("None.\n")
+	}
+	for _, d := range h.Decisions {
+		fmt.Fprintf(&b, "- #%d %s", d.EventID, d.Topic)
+		if d.RequestID != 0 {
+			fmt.Fprintf(&b, " (answers #%d)", d.RequestID)
+		}
+		fmt.Fprintf(&b, ": %s\n", snippet(d.Data))
+	}
+	return b.String()
+}
+
+// snippet returns raw JSON on one line, cut to handoffSnippet bytes.
+func snippet(raw json.RawMessage) string {
+	s := strings.Join(strings.Fields(string(raw)), " ")
+	if len(s) > handoffSnippet {
+		s = s[:handoffSnippet] + "..."
+	}
+	return s
+}
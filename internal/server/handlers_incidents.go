@@ -0,0 +1,122 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/DavidRHerbert/koor/internal/audit"
+	"github.com/DavidRHerbert/koor/internal/compliance"
+)
+
+// --- Sandbox incident handlers ---
+
+func (s *Server) handleIncidentReport(w http.ResponseWriter, r *http.Request) {
+	if s.compSched == nil {
+		writeError(w, http.StatusServiceUnavailable, "compliance scheduler not configured")
+		return
+	}
+	var req compliance.Incident
+	if !s.decodeBody(w, r, &req) {
+		return
+	}
+	if missing := requiredFields("instance_id", req.InstanceID, "kind", req.Kind); len(missing) > 0 {
+		s.rejectFields(w, "instance_id and kind are required", missing...)
+		return
+	}
+	if !compliance.ValidIncidentKind(req.Kind) {
+		s.rejectFields(w, "kind must be write_outside_workspace, cross_agent_read, or other",
+			fieldError{Field: "kind", Problem: "must be write_outside_workspace, cross_agent_read, or other"})
+		return
+	}
+	if _, err := s.instanceReg.Get(r.Context(), req.InstanceID); errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "instance not found: "+req.InstanceID)
+		return
+	}
+	if req.ReportedBy == "" {
+		req.ReportedBy = actorFromRequest(r)
+	}
+
+	inc, err := s.compSched.ReportIncident(r.Context(), req)
+	if err != nil {
+		s.logger.Error("incident report failed", "instance", req.InstanceID, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to store incident")
+		return
+	}
+	s.logger.Warn("sandbox incident reported", "id", inc.ID, "instance", inc.InstanceID, "kind", inc.Kind, "path", inc.Path)
+	s.audit(r.Context(), inc.ReportedBy, "incident.report", inc.InstanceID, audit.DetailJSON(map[string]any{
+		"id": inc.ID, "kind": inc.Kind, "path": inc.Path,
+	}), "success")
+	writeJSON(w, http.StatusOK, inc)
+}
+
+func (s *Server) handleIncidentList(w http.ResponseWriter, r *http.Request) {
+	if s.compSched == nil {
+		writeError(w, http.StatusServiceUnavailable, "compliance scheduler not configured")
+		return
+	}
+	limit := 50
+	if v := r.URL.Query().Get("limit"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			limit = n
+		}
+	}
+	list, err := s.compSched.Incidents(r.Context(), r.URL.Query().Get("instance_id"), limit)
+	if err != nil {
+		s.logger.Error("incident list failed", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to list incidents")
+		return
+	}
+	if list == nil {
+		list = []compliance.Incident{}
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// handleComplianceScore scores one instance, or every registered instance
+// when instance_id is omitted, over the window given by ?since= (default 7 days).
+func (s *Server) handleComplianceScore(w http.ResponseWriter, r *http.Request) {
+	if s.compSched == nil {
+		writeError(w, http.StatusServiceUnavailable, "compliance scheduler not configured")
+		return
+	}
+	window := 7 * 24 * time.Hour
+	if v := r.URL.Query().Get("since"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid since duration: "+v)
+			return
+		}
+		window = d
+	}
+	since := time.Now().Add(-window)
+
+	ids := []string{}
+	if id := r.URL.Query().Get("instance_id"); id != "" {
+		ids = append(ids, id)
+	} else {
+		list, err := s.instanceReg.List(r.Context())
+		if err != nil {
+			s.logger.Error("compliance score failed", "error", err)
+			writeError(w, http.StatusInternalServerError, "failed to list instances")
+			return
+		}
+		for _, inst := range list {
+			ids = append(ids, inst.ID)
+		}
+	}
+
+	scores := []compliance.Score{}
+	for _, id := range ids {
+		sc, err := s.compSched.Score(r.Context(), id, since)
+		if err != nil {
+			s.logger.Error("compliance score failed", "instance", id, "error", err)
+			writeError(w, http.StatusInternalServerError, "failed to compute score")
+			return
+		}
+		scores = append(scores, *sc)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"since": since.UTC(), "scores": scores})
+}
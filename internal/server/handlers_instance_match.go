@@ -0,0 +1,52 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/DavidRHerbert/koor/internal/instances"
+)
+
+// maxMatchLimit caps how many candidates one match request returns.
+const maxMatchLimit = 50
+
+// --- Instance matchmaking handlers ---
+
+// handleInstancesMatch ranks the active instances that can take on a piece
+// of work, so a controller need not pick an agent by hand.
+func (s *Server) handleInstancesMatch(w http.ResponseWriter, r *http.Request) {
+	var req instances.MatchRequest
+	if !s.decodeBody(w, r, &req) {
+		return
+	}
+	if req.Limit < 0 || req.Limit > maxMatchLimit {
+		s.rejectFields(w, "limit must be between 1 and 50",
+			fieldError{Field: "limit", Problem: "must be between 1 and 50"})
+		return
+	}
+	if req.MaxOpenTasks != nil && *req.MaxOpenTasks < 0 {
+		s.rejectFields(w, "max_open_tasks must not be negative",
+			fieldError{Field: "max_open_tasks", Problem: "must not be negative"})
+		return
+	}
+
+	list, err := s.instanceReg.List(r.Context())
+	if err != nil {
+		s.logger.Error("instance match failed", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to list instances")
+		return
+	}
+	var open map[string]int
+	if s.tasks != nil {
+		if open, err = s.tasks.ClaimCounts(r.Context()); err != nil {
+			s.logger.Error("instance match: count claims failed", "error", err)
+			writeError(w, http.StatusInternalServerError, "failed to count open tasks")
+			return
+		}
+	}
+	candidates := instances.Match(ownInstances(r, list), req, open, time.Now())
+	writeJSON(w, http.StatusOK, map[string]any{
+		"count":      len(candidates),
+		"candidates": candidates,
+	})
+}
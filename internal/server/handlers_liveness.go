@@ -0,0 +1,120 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/DavidRHerbert/koor/internal/audit"
+	"github.com/DavidRHerbert/koor/internal/liveness"
+)
+
+// --- Liveness policy handlers ---
+
+// livenessPolicies returns the monitor's policy store, or writes a 503.
+func (s *Server) livenessPolicies(w http.ResponseWriter) *liveness.PolicyStore {
+	if s.liveness == nil || s.liveness.Policies() == nil {
+		writeError(w, http.StatusServiceUnavailable, "liveness policies not configured")
+		return nil
+	}
+	return s.liveness.Policies()
+}
+
+// handleLivenessPolicyList lists every stale-instance escalation policy.
+func (s *Server) handleLivenessPolicyList(w http.ResponseWriter, r *http.Request) {
+	store := s.livenessPolicies(w)
+	if store == nil {
+		return
+	}
+	list, err := store.List(r.Context())
+	if err != nil {
+		s.logger.Error("list liveness policies failed", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to list liveness policies")
+		return
+	}
+	if list == nil {
+		list = []liveness.Policy{}
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// handleLivenessPolicyGet returns one project's policy. "*" is the policy
+// for projects without one.
+func (s *Server) handleLivenessPolicyGet(w http.ResponseWriter, r *http.Request) {
+	store := s.livenessPolicies(w)
+	if store == nil {
+		return
+	}
+	project := r.PathValue("project")
+	p, err := store.Get(r.Context(), project)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "no liveness policy for project: "+project)
+		return
+	}
+	if err != nil {
+		s.logger.Error("get liveness policy failed", "project", project, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to get liveness policy")
+		return
+	}
+	writeJSON(w, http.StatusOK, p)
+}
+
+// handleLivenessPolicyPut creates or replaces a project's policy.
+func (s *Server) handleLivenessPolicyPut(w http.ResponseWriter, r *http.Request) {
+	store := s.livenessPolicies(w)
+	if store == nil {
+		return
+	}
+	var p liveness.Policy
+	if !s.decodeBody(w, r, &p) {
+		return
+	}
+	p.Project = r.PathValue("project")
+	if err := p.Validate(); err != nil {
+		s.rejectFields(w, err.Error(), fieldError{Field: "deregister_after", Problem: err.Error()})
+		return
+	}
+	if p.Webhook != "" && s.webhookDisp != nil {
+		if _, err := s.webhookDisp.Get(r.Context(), p.Webhook); errors.Is(err, sql.ErrNoRows) {
+			s.rejectFields(w, "webhook not found: "+p.Webhook, fieldError{Field: "webhook", Problem: "not found"})
+			return
+		}
+	}
+
+	saved, err := store.Put(r.Context(), p)
+	if err != nil {
+		s.logger.Error("put liveness policy failed", "project", p.Project, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to save liveness policy")
+		return
+	}
+	s.logger.Info("liveness policy set", "project", saved.Project)
+	s.audit(r.Context(), actorFromRequest(r), "liveness.policy.set", saved.Project, audit.DetailJSON(map[string]any{
+		"event":            saved.Event,
+		"webhook":          saved.Webhook,
+		"reassign_tasks":   saved.ReassignTasks,
+		"deregister_after": saved.DeregisterAfter,
+	}), "success")
+	writeJSON(w, http.StatusOK, saved)
+}
+
+// handleLivenessPolicyDelete removes a project's policy.
+func (s *Server) handleLivenessPolicyDelete(w http.ResponseWriter, r *http.Request) {
+	store := s.livenessPolicies(w)
+	if store == nil {
+		return
+	}
+	project := r.PathValue("project")
+	err := store.Delete(r.Context(), project)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "no liveness policy for project: "+project)
+		return
+	}
+	if err != nil {
+		s.logger.Error("delete liveness policy failed", "project", project, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to delete liveness policy")
+		return
+	}
+	s.logger.Info("liveness policy deleted", "project", project)
+	s.audit(r.Context(), actorFromRequest(r), "liveness.policy.delete", project, "", "success")
+	writeJSON(w, http.StatusOK, map[string]any{"deleted": project})
+}
@@ -27,16 +27,15 @@ func (s *Server) handleLLMUsageRecord(w http.ResponseWriter, r *http.Request) {
 		RequestType string  `json:"request_type"`
 		SessionTag  string  `json:"session_tag"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid JSON body")
+	if !s.decodeBody(w, r, &req) {
 		return
 	}
 	if req.Provider == "" {
-		writeError(w, http.StatusBadRequest, "provider is required")
+		s.rejectFields(w, "provider is required", fieldError{Field: "provider", Problem: "is required"})
 		return
 	}
 	if req.Model == "" {
-		writeError(w, http.StatusBadRequest, "model is required")
+		s.rejectFields(w, "model is required", fieldError{Field: "model", Problem: "is required"})
 		return
 	}
 
@@ -0,0 +1,183 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/DavidRHerbert/koor/internal/audit"
+	"github.com/DavidRHerbert/koor/internal/instances"
+	"github.com/DavidRHerbert/koor/internal/messages"
+)
+
+// --- Message handlers ---
+
+// handleMessageSend delivers a message to one instance (to) or to every
+// active instance with a capability, optionally within a project. The
+// sender is the calling instance, else the body's from, else the actor.
+func (s *Server) handleMessageSend(w http.ResponseWriter, r *http.Request) {
+	if s.messages == nil {
+		writeError(w, http.StatusServiceUnavailable, "messages not configured")
+		return
+	}
+	var req struct {
+		To         string          `json:"to"`
+		Capability string          `json:"capability"`
+		Project    string          `json:"project"`
+		From       string          `json:"from"`
+		Subject    string          `json:"subject"`
+		Body       json.RawMessage `json:"body"`
+		ReplyTo    string          `json:"reply_to"`
+	}
+	if !s.decodeBody(w, r, &req) {
+		return
+	}
+	if (req.To == "") == (req.Capability == "") {
+		s.rejectFields(w, "exactly one of to or capability is required",
+			fieldError{Field: "to", Problem: "exactly one of to or capability is required"},
+			fieldError{Field: "capability", Problem: "exactly one of to or capability is required"})
+		return
+	}
+
+	var recipients []instances.Summary
+	if req.To != "" {
+		inst, err := s.instanceReg.Get(r.Context(), req.To)
+		if err != nil {
+			writeError(w, http.StatusNotFound, "instance not found: "+req.To)
+			return
+		}
+		recipients = ownInstances(r, []instances.Summary{{ID: inst.ID, Project: inst.Project}})
+		if len(recipients) == 0 {
+			writeError(w, http.StatusForbidden, "instance "+req.To+" is in another project")
+			return
+		}
+	} else {
+		found, err := s.instanceReg.Discover(r.Context(), "", "", "", req.Capability)
+		if err != nil {
+			s.logger.Error("message recipients lookup failed", "capability", req.Capability, "error", err)
+			writeError(w, http.StatusInternalServerError, "failed to find recipients")
+			return
+		}
+		for _, inst := range ownInstances(r, found) {
+			if inst.Status == "active" && (req.Project == "" || inst.Project == req.Project) {
+				recipients = append(recipients, inst)
+			}
+		}
+		if len(recipients) == 0 {
+			writeError(w, http.StatusNotFound, "no active instance with capability "+req.Capability)
+			return
+		}
+	}
+
+	from := taskInstance(r, req.From)
+	if from == "" {
+		from = actorFromRequest(r)
+	}
+	to := make([]string, len(recipients))
+	for i, inst := range recipients {
+		to[i] = inst.ID
+	}
+	sent, err := s.messages.Send(r.Context(), messages.Message{
+		From:       from,
+		Capability: req.Capability,
+		Subject:    req.Subject,
+		Body:       req.Body,
+		ReplyTo:    req.ReplyTo,
+	}, to)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.logger.Info("message sent", "from", from, "recipients", len(sent), "subject", req.Subject)
+	s.audit(r.Context(), actorFromRequest(r), "message.send", sent[0].ID, audit.DetailJSON(map[string]any{
+		"from": from, "to": to, "capability": req.Capability, "subject": req.Subject,
+	}), "success")
+	writeJSON(w, http.StatusCreated, sent)
+}
+
+// handleMessageInbox lists an instance's messages, oldest first.
+// ?unread=1 leaves out acknowledged ones.
+func (s *Server) handleMessageInbox(w http.ResponseWriter, r *http.Request) {
+	if s.messages == nil {
+		writeError(w, http.StatusServiceUnavailable, "messages not configured")
+		return
+	}
+	instanceID := r.PathValue("instance_id")
+	q := r.URL.Query()
+	unread := q.Get("unread") == "1" || q.Get("unread") == "true"
+	limit := 0
+	if l := q.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "limit must be a non-negative integer")
+			return
+		}
+		limit = n
+	}
+	list, err := s.messages.Inbox(r.Context(), instanceID, unread, limit)
+	if err != nil {
+		s.logger.Error("message inbox failed", "instance", instanceID, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to read inbox")
+		return
+	}
+	if list == nil {
+		list = []messages.Message{}
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (s *Server) handleMessageGet(w http.ResponseWriter, r *http.Request) {
+	if s.messages == nil {
+		writeError(w, http.StatusServiceUnavailable, "messages not configured")
+		return
+	}
+	id := r.PathValue("id")
+	m, err := s.messages.Get(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "message not found: "+id)
+		return
+	}
+	if err != nil {
+		s.logger.Error("message get failed", "id", id, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to get message")
+		return
+	}
+	writeJSON(w, http.StatusOK, m)
+}
+
+// handleMessageAck marks a message read. An agent may only acknowledge
+// its own messages; callers without an instance may acknowledge any.
+func (s *Server) handleMessageAck(w http.ResponseWriter, r *http.Request) {
+	if s.messages == nil {
+		writeError(w, http.StatusServiceUnavailable, "messages not configured")
+		return
+	}
+	var req struct {
+		InstanceID string `json:"instance_id"`
+	}
+	if r.ContentLength != 0 {
+		if !s.decodeBody(w, r, &req) {
+			return
+		}
+	}
+	id := r.PathValue("id")
+	m, err := s.messages.Ack(r.Context(), id, taskInstance(r, req.InstanceID))
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		writeError(w, http.StatusNotFound, "message not found: "+id)
+		return
+	case errors.Is(err, messages.ErrNotRecipient):
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	case err != nil:
+		s.logger.Error("message ack failed", "id", id, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to acknowledge message")
+		return
+	}
+	s.audit(r.Context(), actorFromRequest(r), "message.ack", id, audit.DetailJSON(map[string]any{
+		"instance_id": m.To,
+	}), "success")
+	writeJSON(w, http.StatusOK, m)
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/DavidRHerbert/koor/internal/audit"
+	"github.com/DavidRHerbert/koor/internal/milestones"
+)
+
+// --- Milestone handlers ---
+
+func (s *Server) handleMilestoneCreate(w http.ResponseWriter, r *http.Request) {
+	if s.milestones == nil {
+		writeError(w, http.StatusServiceUnavailable, "milestones not configured")
+		return
+	}
+	project := r.PathValue("project")
+	var req struct {
+		Name        string   `json:"name"`
+		Description string   `json:"description"`
+		Due         string   `json:"due"`
+		Tasks       []string `json:"tasks"`
+		Events      []string `json:"events"`
+	}
+	if !s.decodeBody(w, r, &req) {
+		return
+	}
+	m := milestones.Milestone{
+		Project: project, Name: req.Name, Description: req.Description,
+		Tasks: req.Tasks, Events: req.Events,
+	}
+	if req.Due != "" {
+		due, err := time.Parse(time.RFC3339, req.Due)
+		if err != nil {
+			due, err = time.Parse("2006-01-02", req.Due)
+		}
+		if err != nil {
+			s.rejectFields(w, "due must be RFC 3339 or YYYY-MM-DD: "+req.Due,
+				fieldError{Field: "due", Problem: "must be RFC 3339 or YYYY-MM-DD"})
+			return
+		}
+		m.Due = &due
+	}
+
+	created, err := s.milestones.Create(r.Context(), m)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.logger.Info("milestone created", "project", project, "id", created.ID, "name", created.Name)
+	s.audit(r.Context(), "", "milestone.create", project+"/"+created.ID, audit.DetailJSON(map[string]any{
+		"name": created.Name, "tasks": len(created.Tasks), "events": len(created.Events),
+	}), "success")
+	writeJSON(w, http.StatusOK, created)
+}
+
+// handleMilestoneList lists milestones with progress, for one project or,
+// on /api/milestones, for all of them.
+func (s *Server) handleMilestoneList(w http.ResponseWriter, r *http.Request) {
+	if s.milestones == nil {
+		writeError(w, http.StatusServiceUnavailable, "milestones not configured")
+		return
+	}
+	list, err := s.milestones.List(r.Context(), r.PathValue("project"))
+	if err != nil {
+		s.logger.Error("milestone list failed", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to list milestones")
+		return
+	}
+	burndown := r.URL.Query().Get("burndown") == "true"
+	id := identityFromRequest(r)
+	out := []milestones.Progress{}
+	for _, m := range list {
+		if id != nil && !id.OwnsProject(m.Project) {
+			continue
+		}
+		p, err := s.milestones.Progress(r.Context(), m, burndown)
+		if err != nil {
+			s.logger.Error("milestone progress failed", "id", m.ID, "error", err)
+			writeError(w, http.StatusInternalServerError, "failed to compute progress")
+			return
+		}
+		out = append(out, *p)
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) handleMilestoneGet(w http.ResponseWriter, r *http.Request) {
+	if s.milestones == nil {
+		writeError(w, http.StatusServiceUnavailable, "milestones not configured")
+		return
+	}
+	project, id := r.PathValue("project"), r.PathValue("id")
+	m, err := s.milestones.Get(r.Context(), project, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "milestone not found: "+id)
+		return
+	}
+	if err != nil {
+		s.logger.Error("milestone get failed", "id", id, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to get milestone")
+		return
+	}
+	p, err := s.milestones.Progress(r.Context(), *m, true)
+	if err != nil {
+		s.logger.Error("milestone progress failed", "id", id, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to compute progress")
+		return
+	}
+	writeJSON(w, http.StatusOK, p)
+}
+
+func (s *Server) handleMilestoneDelete(w http.ResponseWriter, r *http.Request) {
+	if s.milestones == nil {
+		writeError(w, http.StatusServiceUnavailable, "milestones not configured")
+		return
+	}
+	project, id := r.PathValue("project"), r.PathValue("id")
+	err := s.milestones.Delete(r.Context(), project, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "milestone not found: "+id)
+		return
+	}
+	if err != nil {
+		s.logger.Error("milestone delete failed", "id", id, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to delete milestone")
+		return
+	}
+	s.logger.Info("milestone deleted", "project", project, "id", id)
+	s.audit(r.Context(), "", "milestone.delete", project+"/"+id, "{}", "success")
+	writeJSON(w, http.StatusOK, map[string]any{"deleted": id})
+}
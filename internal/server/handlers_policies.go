@@ -0,0 +1,178 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/DavidRHerbert/koor/internal/audit"
+	"github.com/DavidRHerbert/koor/internal/policy"
+)
+
+// --- Policy handlers ---
+
+// policySubject resolves the calling instance from the X-Koor-Instance
+// header. It returns nil when the header is absent or names no instance.
+func (s *Server) policySubject(ctx context.Context, instanceID string) *policy.Subject {
+	if instanceID == "" {
+		return nil
+	}
+	inst, err := s.instanceReg.Get(ctx, instanceID)
+	if err != nil {
+		return nil
+	}
+	return &policy.Subject{
+		ID:           inst.ID,
+		Name:         inst.Name,
+		Stack:        inst.Stack,
+		Workspace:    inst.Workspace,
+		Capabilities: inst.Capabilities,
+	}
+}
+
+// enforcePolicy evaluates the policies for a write and responds 403 if any
+// denies it. It returns true when the handler should proceed.
+func (s *Server) enforcePolicy(w http.ResponseWriter, r *http.Request, action, resource string) bool {
+	if s.policies == nil {
+		return true
+	}
+	subj := s.policySubject(r.Context(), r.Header.Get("X-Koor-Instance"))
+	d, err := s.policies.Evaluate(r.Context(), action, resource, subj)
+	if err != nil {
+		s.logger.Error("policy evaluation failed", "action", action, "resource", resource, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to evaluate policies")
+		return false
+	}
+	if d.Allowed {
+		return true
+	}
+	caller := ""
+	if subj != nil {
+		caller = subj.Name
+	}
+	s.logger.Warn("write denied by policy", "action", action, "resource", resource, "policy", d.DeniedBy.ID, "caller", caller)
+	s.audit(r.Context(), caller, "policy.deny", resource, audit.DetailJSON(map[string]any{
+		"action": action, "policy": d.DeniedBy.ID, "reason": d.Reason,
+	}), "failure")
+	writeError(w, http.StatusForbidden, "denied by policy "+policyLabel(d.DeniedBy)+": "+d.Reason)
+	return false
+}
+
+func policyLabel(p *policy.Policy) string {
+	if p.Name != "" {
+		return p.Name
+	}
+	return p.ID
+}
+
+func (s *Server) handlePolicyCreate(w http.ResponseWriter, r *http.Request) {
+	if s.policies == nil {
+		writeError(w, http.StatusServiceUnavailable, "policies not configured")
+		return
+	}
+	var req policy.Policy
+	if !s.decodeBody(w, r, &req) {
+		return
+	}
+	if err := policy.Validate(req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	p, err := s.policies.Create(r.Context(), req)
+	if err != nil {
+		s.logger.Error("policy create failed", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to create policy")
+		return
+	}
+	s.logger.Info("policy created", "id", p.ID, "action", p.Action, "resource", p.Resource)
+	s.audit(r.Context(), "", "policy.create", p.ID, audit.DetailJSON(map[string]any{
+		"name": p.Name, "action": p.Action, "resource": p.Resource, "condition": p.Condition,
+	}), "success")
+	writeJSON(w, http.StatusOK, p)
+}
+
+func (s *Server) handlePolicyList(w http.ResponseWriter, r *http.Request) {
+	if s.policies == nil {
+		writeError(w, http.StatusServiceUnavailable, "policies not configured")
+		return
+	}
+	list, err := s.policies.List(r.Context(), r.URL.Query().Get("action"))
+	if err != nil {
+		s.logger.Error("policy list failed", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to list policies")
+		return
+	}
+	if list == nil {
+		list = []policy.Policy{}
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (s *Server) handlePolicyGet(w http.ResponseWriter, r *http.Request) {
+	if s.policies == nil {
+		writeError(w, http.StatusServiceUnavailable, "policies not configured")
+		return
+	}
+	id := r.PathValue("id")
+	p, err := s.policies.Get(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "policy not found: "+id)
+		return
+	}
+	if err != nil {
+		s.logger.Error("policy get failed", "id", id, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to get policy")
+		return
+	}
+	writeJSON(w, http.StatusOK, p)
+}
+
+func (s *Server) handlePolicyDelete(w http.ResponseWriter, r *http.Request) {
+	if s.policies == nil {
+		writeError(w, http.StatusServiceUnavailable, "policies not configured")
+		return
+	}
+	id := r.PathValue("id")
+	err := s.policies.Delete(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "policy not found: "+id)
+		return
+	}
+	if err != nil {
+		s.logger.Error("policy delete failed", "id", id, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to delete policy")
+		return
+	}
+	s.logger.Info("policy deleted", "id", id)
+	s.audit(r.Context(), "", "policy.delete", id, "{}", "success")
+	writeJSON(w, http.StatusOK, map[string]any{"deleted": id})
+}
+
+// handlePolicyEvaluate reports whether an instance may perform a write,
+// without performing it.
+func (s *Server) handlePolicyEvaluate(w http.ResponseWriter, r *http.Request) {
+	if s.policies == nil {
+		writeError(w, http.StatusServiceUnavailable, "policies not configured")
+		return
+	}
+	var req struct {
+		Action     string `json:"action"`
+		Resource   string `json:"resource"`
+		InstanceID string `json:"instance_id"`
+	}
+	if !s.decodeBody(w, r, &req) {
+		return
+	}
+	if missing := requiredFields("action", req.Action, "resource", req.Resource); len(missing) > 0 {
+		s.rejectFields(w, "action and resource are required", missing...)
+		return
+	}
+	d, err := s.policies.Evaluate(r.Context(), req.Action, req.Resource, s.policySubject(r.Context(), req.InstanceID))
+	if err != nil {
+		s.logger.Error("policy evaluation failed", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to evaluate policies")
+		return
+	}
+	writeJSON(w, http.StatusOK, d)
+}
@@ -0,0 +1,271 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/DavidRHerbert/koor/internal/audit"
+	"github.com/DavidRHerbert/koor/internal/instances"
+	"github.com/DavidRHerbert/koor/internal/projects"
+	"github.com/DavidRHerbert/koor/internal/tokens"
+)
+
+// --- Project registry handlers ---
+
+// projectRegistered reports whether a project is registered, writing a
+// 400 if it is not.
+func (s *Server) projectRegistered(w http.ResponseWriter, r *http.Request, name string) bool {
+	if s.settings == nil {
+		writeError(w, http.StatusServiceUnavailable, "projects not configured")
+		return false
+	}
+	if _, err := s.settings.Project(r.Context(), name); err != nil {
+		writeError(w, http.StatusBadRequest, "project not registered: "+name)
+		return false
+	}
+	return true
+}
+
+func (s *Server) handleProjectList(w http.ResponseWriter, r *http.Request) {
+	if s.settings == nil {
+		writeError(w, http.StatusServiceUnavailable, "projects not configured")
+		return
+	}
+	list, err := s.settings.Projects(r.Context())
+	if err != nil {
+		s.logger.Error("list projects failed", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to list projects")
+		return
+	}
+	if id := identityFromRequest(r); id != nil && !id.CrossProject() {
+		own := []projects.Project{}
+		for _, p := range list {
+			if p.Name == id.Project {
+				own = append(own, p)
+			}
+		}
+		list = own
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (s *Server) handleProjectCreate(w http.ResponseWriter, r *http.Request) {
+	if s.settings == nil {
+		writeError(w, http.StatusServiceUnavailable, "projects not configured")
+		return
+	}
+	var req projects.Project
+	if !s.decodeBody(w, r, &req) {
+		return
+	}
+	p, err := s.settings.Create(r.Context(), req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.logger.Info("project registered", "project", p.Name)
+	s.audit(r.Context(), actorFromRequest(r), "project.create", p.Name, audit.DetailJSON(map[string]any{"description": p.Description}), "success")
+	writeJSON(w, http.StatusOK, p)
+}
+
+func (s *Server) handleProjectGet(w http.ResponseWriter, r *http.Request) {
+	if s.settings == nil {
+		writeError(w, http.StatusServiceUnavailable, "projects not configured")
+		return
+	}
+	name := r.PathValue("project")
+	p, err := s.settings.Project(r.Context(), name)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "project not registered: "+name)
+		return
+	}
+	if err != nil {
+		s.logger.Error("get project failed", "project", name, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to get project")
+		return
+	}
+	writeJSON(w, http.StatusOK, p)
+}
+
+// projectAccess checks that a project-bound identity stays inside its
+// project and returns why it is denied, or "" if it is allowed. Access is
+// denied unless the route is listed here: state keys, specs, rules, rule
+// packs, compliance policies, validation, contracts, mocks, liveness
+// policies, project routes, event topics, tasks, webhooks, instances and
+// their messages belong to a project; search, milestone and template
+// reads are filtered or shared. Everything else (audit, admin, metrics,
+// schedules, projections, MCP, the dashboard, ...) spans projects.
+// History, latest and subscribe requests without a topic filter are
+// narrowed to the project's topics.
+func (s *Server) projectAccess(r *http.Request, id *tokens.Identity) string {
+	if id.CrossProject() {
+		return ""
+	}
+	path := r.URL.Path
+	denied := "is limited to project " + id.Project
+	switch path {
+	case "/api/", "/api/tokens/whoami":
+		return ""
+	case "/api/projects", "/api/instances", "/api/instances/stale", "/api/instances/register", "/api/instances/match",
+		"/api/events/publish", "/api/events/publish-batch", "/api/rules/propose", "/api/messages", "/api/mocks",
+		"/api/graphql", "/api/search", "/api/tasks/claim", "/api/milestones", "/api/webhooks":
+		return "" // filtered or checked by the handler
+	case "/api/rulepacks", "/api/rulepacks/install", "/api/compliance/policies", "/api/digest":
+		if !narrowQuery(r, "project", id.Project, id.OwnsProject) {
+			return denied
+		}
+		return ""
+	case "/api/tasks":
+		if r.Method == http.MethodGet && !narrowQuery(r, "project", id.Project, id.OwnsProject) {
+			return denied
+		}
+		return "" // creation is checked by the handler
+	case "/api/rules/export":
+		if !narrowQuery(r, "source", id.Project, id.OwnsProject) {
+			return denied
+		}
+		return ""
+	case "/api/events/history", "/api/events/latest":
+		if !narrowQuery(r, "topic", strings.ToLower(id.Project)+".*", id.OwnsTopic) {
+			return denied
+		}
+		return ""
+	case "/api/state":
+		// List by prefix: narrowed to the project's keys, or denied if
+		// the prefix reaches outside them.
+		own := id.Project + "/"
+		q := r.URL.Query()
+		if prefix := q.Get("prefix"); !strings.HasPrefix(prefix, own) {
+			if !strings.HasPrefix(own, prefix) {
+				return denied
+			}
+			q.Set("prefix", own)
+			r.URL.RawQuery = q.Encode()
+		}
+		return ""
+	case "/api/events/subscribe":
+		if mux := r.URL.Query().Get("multiplex"); mux == "1" || mux == "true" {
+			return denied // subscriptions are chosen later, over the socket
+		}
+		if !narrowQuery(r, "pattern", strings.ToLower(id.Project)+".*", id.OwnsTopic) {
+			return denied
+		}
+		return ""
+	case "/api/templates":
+		if r.Method != http.MethodGet {
+			return denied // templates are shared by every project
+		}
+		return ""
+	}
+	if key, ok := strings.CutPrefix(path, "/api/state/"); ok {
+		if !id.OwnsKey(strings.TrimSuffix(key, "/meta")) {
+			return denied
+		}
+		return ""
+	}
+	for _, prefix := range []string{"/api/specs/", "/api/rules/", "/api/validate/", "/api/contracts/", "/api/mocks/",
+		"/api/projects/", "/api/liveness/policies/"} {
+		if rest, ok := strings.CutPrefix(path, prefix); ok {
+			project, _, _ := strings.Cut(rest, "/")
+			if !id.OwnsProject(project) {
+				return denied
+			}
+			return ""
+		}
+	}
+	if rest, ok := strings.CutPrefix(path, "/api/events/"); ok && strings.HasSuffix(rest, "/verify") {
+		return "" // hidden by the handler outside the project's topics
+	}
+	if rest, ok := strings.CutPrefix(path, "/api/templates/"); ok {
+		if r.Method != http.MethodGet && !strings.HasSuffix(rest, "/apply") {
+			return denied
+		}
+		return "" // the handler checks the project a template is applied to
+	}
+	if rest, ok := strings.CutPrefix(path, "/api/tasks/"); ok && s.tasks != nil {
+		target, _, _ := strings.Cut(rest, "/")
+		t, err := s.tasks.Get(r.Context(), target)
+		if err == nil && !id.OwnsProject(t.Project) {
+			return denied
+		}
+		return ""
+	}
+	if rest, ok := strings.CutPrefix(path, "/api/webhooks/"); ok && s.webhookDisp != nil {
+		target, _, _ := strings.Cut(rest, "/")
+		wh, err := s.webhookDisp.Get(r.Context(), target)
+		if err == nil && !ownsPatterns(id, wh.Patterns) {
+			return denied
+		}
+		return ""
+	}
+	if rest, ok := strings.CutPrefix(path, "/api/instances/"); ok {
+		target, _, _ := strings.Cut(rest, "/")
+		inst, err := s.instanceReg.Get(r.Context(), target)
+		if err == nil && inst.Project != id.Project {
+			return denied
+		}
+		return ""
+	}
+	if rest, ok := strings.CutPrefix(path, "/api/messages/"); ok && s.messages != nil {
+		// An inbox belongs to its instance's project, a message to its
+		// recipient's.
+		target, action, _ := strings.Cut(rest, "/")
+		if target == "inbox" {
+			target = action
+		} else if m, err := s.messages.Get(r.Context(), target); err == nil {
+			target = m.To
+		}
+		inst, err := s.instanceReg.Get(r.Context(), target)
+		if err == nil && inst.Project != id.Project {
+			return denied
+		}
+		return ""
+	}
+	return denied
+}
+
+// ownsPatterns reports whether every topic pattern is inside the
+// identity's project.
+func ownsPatterns(id *tokens.Identity, patterns []string) bool {
+	for _, p := range patterns {
+		if !id.OwnsTopic(p) {
+			return false
+		}
+	}
+	return true
+}
+
+// narrowQuery checks a comma-separated query filter against owns, or sets
+// it to def when it is empty. It reports false if any value is not owned.
+func narrowQuery(r *http.Request, name, def string, owns func(string) bool) bool {
+	q := r.URL.Query()
+	v := q.Get(name)
+	if v == "" {
+		q.Set(name, def)
+		r.URL.RawQuery = q.Encode()
+		return true
+	}
+	for _, part := range strings.Split(v, ",") {
+		if !owns(part) {
+			return false
+		}
+	}
+	return true
+}
+
+// ownInstances keeps the instances a project-bound caller may see.
+func ownInstances(r *http.Request, items []instances.Summary) []instances.Summary {
+	id := identityFromRequest(r)
+	if id == nil || id.CrossProject() {
+		return items
+	}
+	own := []instances.Summary{}
+	for _, item := range items {
+		if item.Project == id.Project {
+			own = append(own, item)
+		}
+	}
+	return own
+}
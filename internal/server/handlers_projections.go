@@ -0,0 +1,123 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/DavidRHerbert/koor/internal/audit"
+	"github.com/DavidRHerbert/koor/internal/projections"
+)
+
+// --- Projection handlers ---
+
+func (s *Server) handleProjectionCreate(w http.ResponseWriter, r *http.Request) {
+	if s.projections == nil {
+		writeError(w, http.StatusServiceUnavailable, "projections not configured")
+		return
+	}
+	var req projections.Projection
+	if !s.decodeBody(w, r, &req) {
+		return
+	}
+	if err := projections.Validate(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	p, err := s.projections.Create(r.Context(), req)
+	if err != nil {
+		s.logger.Error("projection create failed", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to create projection")
+		return
+	}
+	s.logger.Info("projection created", "id", p.ID, "topic", p.Topic, "key", p.Key)
+	s.audit(r.Context(), actorFromRequest(r), "projection.create", p.ID, audit.DetailJSON(map[string]any{
+		"name": p.Name, "topic": p.Topic, "key": p.Key, "strategy": p.Strategy,
+	}), "success")
+	writeJSON(w, http.StatusOK, p)
+}
+
+func (s *Server) handleProjectionList(w http.ResponseWriter, r *http.Request) {
+	if s.projections == nil {
+		writeError(w, http.StatusServiceUnavailable, "projections not configured")
+		return
+	}
+	list, err := s.projections.List(r.Context())
+	if err != nil {
+		s.logger.Error("projection list failed", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to list projections")
+		return
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (s *Server) handleProjectionGet(w http.ResponseWriter, r *http.Request) {
+	if s.projections == nil {
+		writeError(w, http.StatusServiceUnavailable, "projections not configured")
+		return
+	}
+	id := r.PathValue("id")
+	p, err := s.projections.Get(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "projection not found: "+id)
+		return
+	}
+	if err != nil {
+		s.logger.Error("projection get failed", "id", id, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to get projection")
+		return
+	}
+	writeJSON(w, http.StatusOK, p)
+}
+
+func (s *Server) handleProjectionUpdate(w http.ResponseWriter, r *http.Request) {
+	if s.projections == nil {
+		writeError(w, http.StatusServiceUnavailable, "projections not configured")
+		return
+	}
+	var req projections.Projection
+	if !s.decodeBody(w, r, &req) {
+		return
+	}
+	req.ID = r.PathValue("id")
+	if err := projections.Validate(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	p, err := s.projections.Update(r.Context(), req)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "projection not found: "+req.ID)
+		return
+	}
+	if err != nil {
+		s.logger.Error("projection update failed", "id", req.ID, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to update projection")
+		return
+	}
+	s.logger.Info("projection updated", "id", p.ID, "topic", p.Topic, "key", p.Key)
+	s.audit(r.Context(), actorFromRequest(r), "projection.update", p.ID, audit.DetailJSON(map[string]any{
+		"name": p.Name, "topic": p.Topic, "key": p.Key, "strategy": p.Strategy,
+	}), "success")
+	writeJSON(w, http.StatusOK, p)
+}
+
+func (s *Server) handleProjectionDelete(w http.ResponseWriter, r *http.Request) {
+	if s.projections == nil {
+		writeError(w, http.StatusServiceUnavailable, "projections not configured")
+		return
+	}
+	id := r.PathValue("id")
+	err := s.projections.Delete(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "projection not found: "+id)
+		return
+	}
+	if err != nil {
+		s.logger.Error("projection delete failed", "id", id, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to delete projection")
+		return
+	}
+	s.logger.Info("projection deleted", "id", id)
+	s.audit(r.Context(), actorFromRequest(r), "projection.delete", id, "{}", "success")
+	writeJSON(w, http.StatusOK, map[string]any{"deleted": id})
+}
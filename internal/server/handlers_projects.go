@@ -0,0 +1,468 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/DavidRHerbert/koor/internal/audit"
+	"github.com/DavidRHerbert/koor/internal/projects"
+	"github.com/DavidRHerbert/koor/internal/specs"
+	"github.com/DavidRHerbert/koor/internal/templates"
+	"github.com/DavidRHerbert/koor/internal/webhooks"
+)
+
+// bundleKind and bundleVersion identify a project export document.
+const (
+	bundleKind    = "koor-project"
+	bundleVersion = 1
+)
+
+// projectBundle is a portable snapshot of one project's configuration.
+// Specs include contracts. State holds the keys under StatePrefix.
+type projectBundle struct {
+	Kind        string               `json:"kind"`
+	Version     int                  `json:"version"`
+	Project     string               `json:"project"`
+	ExportedAt  time.Time            `json:"exported_at"`
+	StatePrefix string               `json:"state_prefix"`
+	Specs       []bundleSpec         `json:"specs"`
+	Rules       []specs.Rule         `json:"rules"`
+	State       []bundleState        `json:"state"`
+	Templates   []templates.Template `json:"templates"`
+	Webhooks    []webhooks.Webhook   `json:"webhooks"`
+	Settings    *projects.Settings   `json:"settings,omitempty"`
+}
+
+// bundleSpec holds a spec's data inline when it is JSON, base64 otherwise.
+type bundleSpec struct {
+	Name     string          `json:"name"`
+	Encoding string          `json:"encoding,omitempty"` // "" (JSON) or "base64"
+	Data     json.RawMessage `json:"data"`
+}
+
+type bundleState struct {
+	Key         string          `json:"key"`
+	ContentType string          `json:"content_type"`
+	Encoding    string          `json:"encoding,omitempty"`
+	Value       json.RawMessage `json:"value"`
+}
+
+// encodeBundleData returns data as inline JSON if valid, else as a base64 JSON string.
+func encodeBundleData(data []byte) (json.RawMessage, string) {
+	if len(data) > 0 && json.Valid(data) {
+		return json.RawMessage(data), ""
+	}
+	enc, _ := json.Marshal(base64.StdEncoding.EncodeToString(data))
+	return enc, "base64"
+}
+
+func decodeBundleData(data json.RawMessage, encoding string) ([]byte, error) {
+	if encoding != "base64" {
+		return data, nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(s)
+}
+
+// --- Project export/import handlers ---
+
+func (s *Server) handleProjectExport(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	project := r.PathValue("project")
+	q := r.URL.Query()
+	statePrefix := project + "/"
+	if q.Has("state_prefix") {
+		statePrefix = q.Get("state_prefix")
+	}
+
+	b := projectBundle{
+		Kind:        bundleKind,
+		Version:     bundleVersion,
+		Project:     project,
+		ExportedAt:  time.Now().UTC(),
+		StatePrefix: statePrefix,
+		Specs:       []bundleSpec{},
+		Rules:       []specs.Rule{},
+		State:       []bundleState{},
+		Templates:   []templates.Template{},
+		Webhooks:    []webhooks.Webhook{},
+	}
+
+	summaries, err := s.specReg.List(ctx, project)
+	if err != nil {
+		s.logger.Error("export specs failed", "project", project, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to export specs")
+		return
+	}
+	for _, sum := range summaries {
+		spec, err := s.specReg.Get(ctx, project, sum.Name)
+		if err != nil {
+			continue
+		}
+		data, enc := encodeBundleData(spec.Data)
+		b.Specs = append(b.Specs, bundleSpec{Name: sum.Name, Encoding: enc, Data: data})
+	}
+
+	rules, err := s.specReg.ListAllRules(ctx, project, "", "", "accepted")
+	if err != nil {
+		s.logger.Error("export rules failed", "project", project, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to export rules")
+		return
+	}
+	for _, rule := range rules {
+		// ListAllRules matches projects by substring; keep exact matches only.
+		if rule.Project == project {
+			b.Rules = append(b.Rules, rule)
+		}
+	}
+
+	if statePrefix != "" {
+		keys, err := s.stateStore.List(ctx)
+		if err != nil {
+			s.logger.Error("export state failed", "project", project, "error", err)
+			writeError(w, http.StatusInternalServerError, "failed to export state")
+			return
+		}
+		for _, k := range keys {
+			if !strings.HasPrefix(k.Key, statePrefix) {
+				continue
+			}
+			entry, err := s.stateStore.Get(ctx, k.Key)
+			if err != nil {
+				continue
+			}
+			value, enc := encodeBundleData(entry.Value)
+			b.State = append(b.State, bundleState{Key: k.Key, ContentType: entry.ContentType, Encoding: enc, Value: value})
+		}
+	}
+
+	if s.templateStore != nil {
+		for _, id := range s.appliedTemplates(r, project) {
+			if t, err := s.templateStore.Get(ctx, id); err == nil {
+				b.Templates = append(b.Templates, *t)
+			}
+		}
+	}
+
+	if s.webhookDisp != nil && q.Get("webhooks") != "false" {
+		hooks, err := s.webhookDisp.List(ctx)
+		if err == nil {
+			includeSecrets := q.Get("secrets") == "true"
+			for _, h := range hooks {
+				if !includeSecrets {
+					h.Secret = ""
+				}
+				b.Webhooks = append(b.Webhooks, h)
+			}
+		}
+	}
+
+	if st := s.settingsFor(ctx, project); st.UpdatedAt != nil {
+		b.Settings = &st
+	}
+
+	s.audit(ctx, "", "project.export", project, audit.DetailJSON(map[string]any{
+		"specs": len(b.Specs), "rules": len(b.Rules), "state": len(b.State),
+	}), "success")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+project+`.koor.json"`)
+	writeJSON(w, http.StatusOK, b)
+}
+
+// appliedTemplates returns the IDs of templates applied to a project, from the audit log.
+func (s *Server) appliedTemplates(r *http.Request, project string) []string {
+	if s.auditLog == nil {
+		return nil
+	}
+	entries, err := s.auditLog.Query(r.Context(), "", "template.apply", "", "", 10000)
+	if err != nil {
+		return nil
+	}
+	seen := map[string]bool{}
+	var ids []string
+	for _, e := range entries {
+		var detail struct {
+			Project string `json:"project"`
+		}
+		json.Unmarshal([]byte(e.Detail), &detail)
+		if detail.Project != project || e.Outcome != "success" || seen[e.Resource] {
+			continue
+		}
+		seen[e.Resource] = true
+		ids = append(ids, e.Resource)
+	}
+	return ids
+}
+
+// handleProjectImport loads a bundle into the project named in the path, which
+// may differ from the bundle's own project. State keys under the bundle's
+// prefix are moved to state_prefix (default "<project>/").
+func (s *Server) handleProjectImport(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	project := r.PathValue("project")
+	var b projectBundle
+	if !s.decodeBody(w, r, &b) {
+		return
+	}
+	if b.Kind != bundleKind {
+		writeError(w, http.StatusBadRequest, "not a koor project bundle")
+		return
+	}
+	if b.Version > bundleVersion {
+		writeError(w, http.StatusBadRequest, "unsupported bundle version")
+		return
+	}
+	statePrefix := project + "/"
+	if r.URL.Query().Has("state_prefix") {
+		statePrefix = r.URL.Query().Get("state_prefix")
+	}
+	for i := range b.Rules {
+		b.Rules[i].Project = project
+	}
+	withWebhooks := s.webhookDisp != nil && r.URL.Query().Get("webhooks") != "false"
+
+	if isDryRun(r) {
+		plan := newChangePlan()
+		for _, sp := range b.Specs {
+			s.planSpec(ctx, plan, project, sp.Name)
+		}
+		s.planRules(ctx, plan, b.Rules)
+		for _, st := range b.State {
+			key := statePrefix + strings.TrimPrefix(st.Key, b.StatePrefix)
+			_, err := s.stateStore.Get(ctx, key)
+			plan.add("state:"+key, err == nil)
+		}
+		if s.templateStore != nil {
+			for _, t := range b.Templates {
+				if _, err := s.templateStore.Get(ctx, t.ID); errors.Is(err, sql.ErrNoRows) {
+					plan.add("template:"+t.ID, false)
+				}
+			}
+		}
+		if withWebhooks {
+			for _, h := range b.Webhooks {
+				if _, err := s.webhookDisp.Get(ctx, h.ID); err != nil {
+					plan.add("webhook:"+h.ID, false)
+				}
+			}
+		}
+		if b.Settings != nil && s.settings != nil {
+			plan.add("settings:"+project, s.settingsFor(ctx, project).UpdatedAt != nil)
+		}
+		writeDryRun(w, plan)
+		return
+	}
+
+	for _, sp := range b.Specs {
+		data, err := decodeBundleData(sp.Data, sp.Encoding)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid data for spec "+sp.Name)
+			return
+		}
+		if _, err := s.specReg.Put(ctx, project, sp.Name, data); err != nil {
+			s.logger.Error("import spec failed", "project", project, "name", sp.Name, "error", err)
+			writeError(w, http.StatusInternalServerError, "failed to import spec "+sp.Name)
+			return
+		}
+	}
+
+	rulesImported := 0
+	if len(b.Rules) > 0 {
+		n, err := s.specReg.ImportRules(ctx, b.Rules)
+		if err != nil {
+			s.logger.Error("import rules failed", "project", project, "error", err)
+			writeError(w, http.StatusInternalServerError, "failed to import rules")
+			return
+		}
+		rulesImported = n
+	}
+
+	for _, st := range b.State {
+		value, err := decodeBundleData(st.Value, st.Encoding)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid value for state key "+st.Key)
+			return
+		}
+		key := statePrefix + strings.TrimPrefix(st.Key, b.StatePrefix)
+		if _, err := s.stateStore.Put(ctx, key, value, st.ContentType, actorFromRequest(r)); err != nil {
+			s.logger.Error("import state failed", "key", key, "error", err)
+			writeError(w, http.StatusInternalServerError, "failed to import state key "+key)
+			return
+		}
+	}
+
+	templatesImported := 0
+	if s.templateStore != nil {
+		for _, t := range b.Templates {
+			// Keep any existing template with the same ID.
+			if _, err := s.templateStore.Get(ctx, t.ID); !errors.Is(err, sql.ErrNoRows) {
+				continue
+			}
+			if _, err := s.templateStore.Create(ctx, t.ID, t.Name, t.Description, t.Kind, t.Data, t.Tags, t.Params); err == nil {
+				templatesImported++
+			}
+		}
+	}
+
+	webhooksImported := 0
+	if withWebhooks {
+		for _, h := range b.Webhooks {
+			if _, err := s.webhookDisp.Get(ctx, h.ID); err == nil {
+				continue
+			}
+			if _, err := s.webhookDisp.Register(ctx, h.ID, h.URL, h.Patterns, h.Secret, h.Transform); err == nil {
+				webhooksImported++
+			}
+		}
+	}
+
+	if b.Settings != nil && s.settings != nil {
+		st := *b.Settings
+		st.Project = project
+		if _, err := s.settings.Put(ctx, st); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid project settings: "+err.Error())
+			return
+		}
+	}
+
+	result := map[string]any{
+		"project":   project,
+		"source":    b.Project,
+		"specs":     len(b.Specs),
+		"rules":     rulesImported,
+		"state":     len(b.State),
+		"templates": templatesImported,
+		"webhooks":  webhooksImported,
+	}
+	s.logger.Info("project imported", "project", project, "source", b.Project)
+	s.audit(ctx, "", "project.import", project, audit.DetailJSON(result), "success")
+	writeJSON(w, http.StatusOK, result)
+}
+
+// handleProjectDelete removes a project's specs, rules, settings, and the
+// state keys under state_prefix (default "<project>/"). Templates and webhooks are
+// shared across projects and are left alone.
+func (s *Server) handleProjectDelete(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	project := r.PathValue("project")
+	statePrefix := project + "/"
+	if r.URL.Query().Has("state_prefix") {
+		statePrefix = r.URL.Query().Get("state_prefix")
+	}
+
+	summaries, err := s.specReg.List(ctx, project)
+	if err != nil {
+		s.logger.Error("list specs failed", "project", project, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to list specs")
+		return
+	}
+	allRules, err := s.specReg.ListAllRules(ctx, project, "", "", "")
+	if err != nil {
+		s.logger.Error("list rules failed", "project", project, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to list rules")
+		return
+	}
+	var stateKeys []string
+	if statePrefix != "" {
+		keys, err := s.stateStore.List(ctx)
+		if err != nil {
+			s.logger.Error("list state failed", "error", err)
+			writeError(w, http.StatusInternalServerError, "failed to list state")
+			return
+		}
+		for _, k := range keys {
+			if strings.HasPrefix(k.Key, statePrefix) {
+				stateKeys = append(stateKeys, k.Key)
+			}
+		}
+	}
+
+	plan := newChangePlan()
+	for _, sum := range summaries {
+		plan.Deleted = append(plan.Deleted, "spec:"+project+"/"+sum.Name)
+	}
+	var rules []specs.Rule
+	for _, rule := range allRules {
+		if rule.Project == project {
+			rules = append(rules, rule)
+			plan.Deleted = append(plan.Deleted, "rule:"+project+"/"+rule.RuleID)
+		}
+	}
+	for _, key := range stateKeys {
+		plan.Deleted = append(plan.Deleted, "state:"+key)
+	}
+	hasSettings := s.settingsFor(ctx, project).UpdatedAt != nil
+	if hasSettings {
+		plan.Deleted = append(plan.Deleted, "settings:"+project)
+	}
+	registered := false
+	if s.settings != nil {
+		_, err := s.settings.Project(ctx, project)
+		registered = err == nil
+	}
+	if registered {
+		plan.Deleted = append(plan.Deleted, "project:"+project)
+	}
+	if len(plan.Deleted) == 0 {
+		writeError(w, http.StatusNotFound, "project not found: "+project)
+		return
+	}
+	if isDryRun(r) {
+		writeDryRun(w, plan)
+		return
+	}
+
+	for _, sum := range summaries {
+		if err := s.specReg.Delete(ctx, project, sum.Name); err != nil && !errors.Is(err, sql.ErrNoRows) {
+			s.logger.Error("delete spec failed", "project", project, "name", sum.Name, "error", err)
+			writeError(w, http.StatusInternalServerError, "failed to delete spec "+sum.Name)
+			return
+		}
+	}
+	for _, rule := range rules {
+		if err := s.specReg.DeleteRule(ctx, project, rule.RuleID); err != nil && !errors.Is(err, sql.ErrNoRows) {
+			s.logger.Error("delete rule failed", "project", project, "rule_id", rule.RuleID, "error", err)
+			writeError(w, http.StatusInternalServerError, "failed to delete rule "+rule.RuleID)
+			return
+		}
+	}
+	for _, key := range stateKeys {
+		if err := s.stateStore.Delete(ctx, key, actorFromRequest(r)); err != nil && !errors.Is(err, sql.ErrNoRows) {
+			s.logger.Error("delete state failed", "key", key, "error", err)
+			writeError(w, http.StatusInternalServerError, "failed to delete state key "+key)
+			return
+		}
+	}
+
+	if hasSettings {
+		if err := s.settings.Delete(ctx, project); err != nil && !errors.Is(err, sql.ErrNoRows) {
+			s.logger.Error("delete project settings failed", "project", project, "error", err)
+			writeError(w, http.StatusInternalServerError, "failed to delete project settings")
+			return
+		}
+	}
+	if registered {
+		if err := s.settings.Unregister(ctx, project); err != nil && !errors.Is(err, sql.ErrNoRows) {
+			s.logger.Error("unregister project failed", "project", project, "error", err)
+			writeError(w, http.StatusInternalServerError, "failed to unregister project")
+			return
+		}
+	}
+
+	result := map[string]any{
+		"deleted": project,
+		"specs":   len(summaries),
+		"rules":   len(rules),
+		"state":   len(stateKeys),
+	}
+	s.logger.Info("project deleted", "project", project)
+	s.audit(ctx, "", "project.delete", project, audit.DetailJSON(result), "success")
+	writeJSON(w, http.StatusOK, result)
+}
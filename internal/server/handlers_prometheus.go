@@ -0,0 +1,114 @@
+package server
+
+import (
+	"cmp"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DavidRHerbert/koor/internal/observability"
+)
+
+// --- Prometheus handler ---
+
+// observeRequest records a finished request against its mux route.
+func (s *Server) observeRequest(r *http.Request, status int, start time.Time) {
+	route := r.Pattern
+	if _, path, ok := strings.Cut(route, " "); ok {
+		route = path
+	}
+	s.requests.Observe(r.Method, route, status, time.Since(start))
+}
+
+// handlePrometheus serves server metrics in the Prometheus text format, for
+// scraping into Grafana and the like. /api/metrics stays the JSON view the
+// dashboard reads.
+func (s *Server) handlePrometheus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", observability.PrometheusContentType)
+	p := observability.NewPromWriter(w)
+
+	p.Family("koor_uptime_seconds", "gauge", "Seconds since the server started.")
+	p.Sample("koor_uptime_seconds", time.Since(s.startTime).Seconds())
+
+	stats := s.requests.Snapshot()
+	keys := make([]observability.RouteKey, 0, len(stats))
+	for k := range stats {
+		keys = append(keys, k)
+	}
+	slices.SortFunc(keys, func(a, b observability.RouteKey) int {
+		return cmp.Or(cmp.Compare(a.Route, b.Route), cmp.Compare(a.Method, b.Method))
+	})
+	p.Family("koor_http_requests_total", "counter", "REST API requests by route and status code.")
+	for _, k := range keys {
+		codes := make([]int, 0, len(stats[k].Codes))
+		for code := range stats[k].Codes {
+			codes = append(codes, code)
+		}
+		slices.Sort(codes)
+		for _, code := range codes {
+			p.Sample("koor_http_requests_total", float64(stats[k].Codes[code]),
+				"method", k.Method, "route", k.Route, "code", strconv.Itoa(code))
+		}
+	}
+	p.Family("koor_http_request_duration_seconds", "histogram", "REST API request latency by route.")
+	for _, k := range keys {
+		p.Histogram("koor_http_request_duration_seconds", stats[k].Latency, "method", k.Method, "route", k.Route)
+	}
+
+	subscribers, queued := s.eventBus.Depth()
+	p.Family("koor_event_bus_subscribers", "gauge", "Live event bus subscribers (WebSocket clients, webhook dispatcher).")
+	p.Sample("koor_event_bus_subscribers", float64(subscribers))
+	p.Family("koor_event_bus_queued_events", "gauge", "Events buffered for subscribers but not yet consumed.")
+	p.Sample("koor_event_bus_queued_events", float64(queued))
+	if recent, err := s.eventBus.History(r.Context(), 1, ""); err == nil {
+		var last int64
+		if len(recent) > 0 {
+			last = recent[0].ID
+		}
+		p.Family("koor_event_last_id", "gauge", "ID of the most recently published event.")
+		p.Sample("koor_event_last_id", float64(last))
+	}
+
+	if s.webhookDisp != nil {
+		delivered, failed := s.webhookDisp.DeliveryCounts()
+		p.Family("koor_webhook_deliveries_total", "counter", "Webhook delivery attempts by result.")
+		p.Sample("koor_webhook_deliveries_total", float64(delivered), "result", "success")
+		p.Sample("koor_webhook_deliveries_total", float64(failed), "result", "failure")
+	}
+
+	if list, err := s.instanceReg.List(r.Context()); err == nil {
+		counts := map[string]int{}
+		for _, inst := range list {
+			counts[inst.Status]++
+		}
+		statuses := make([]string, 0, len(counts))
+		for status := range counts {
+			statuses = append(statuses, status)
+		}
+		slices.Sort(statuses)
+		p.Family("koor_instances", "gauge", "Registered agent instances by status.")
+		for _, status := range statuses {
+			p.Sample("koor_instances", float64(counts[status]), "status", status)
+		}
+	} else {
+		s.logger.Error("prometheus: list instances failed", "error", err)
+	}
+
+	mcpCount, restCount := s.mcpCalls.Load(), s.restCalls.Load()
+	p.Family("koor_mcp_calls_total", "counter", "MCP tool calls (routed through the LLM context).")
+	p.Sample("koor_mcp_calls_total", float64(mcpCount))
+	p.Family("koor_mcp_data_calls_total", "counter", "MCP data tool calls (publish_event, get_state, set_state), included in koor_mcp_calls_total.")
+	p.Sample("koor_mcp_data_calls_total", float64(s.mcpData.Load()))
+	p.Family("koor_rest_calls_total", "counter", "REST/CLI calls (bypassing the LLM context).")
+	p.Sample("koor_rest_calls_total", float64(restCount))
+	p.Family("koor_mcp_estimated_tokens_total", "counter", "Estimated LLM tokens spent on MCP calls.")
+	p.Sample("koor_mcp_estimated_tokens_total", float64(mcpCount*estimatedTokensPerMCPCall))
+	p.Family("koor_rest_tokens_saved_total", "counter", "Estimated LLM tokens saved by using REST instead of MCP.")
+	p.Sample("koor_rest_tokens_saved_total", float64(restCount*estimatedTokensPerMCPCall))
+
+	if err := p.Err(); err != nil {
+		s.logger.Warn("prometheus: write failed", "error", err)
+	}
+}
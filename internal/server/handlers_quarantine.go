@@ -0,0 +1,101 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/DavidRHerbert/koor/internal/audit"
+	"github.com/DavidRHerbert/koor/internal/orphans"
+)
+
+// --- Quarantine handlers ---
+
+func (s *Server) handleQuarantineList(w http.ResponseWriter, r *http.Request) {
+	if s.orphans == nil {
+		writeError(w, http.StatusServiceUnavailable, "orphan cleanup not configured")
+		return
+	}
+	q := r.URL.Query()
+	kind := q.Get("kind")
+	if kind != "" && kind != orphans.KindState && kind != orphans.KindMessage {
+		writeError(w, http.StatusBadRequest, "kind must be state or message")
+		return
+	}
+	items, err := s.orphans.List(r.Context(), kind, q.Get("instance"))
+	if err != nil {
+		s.logger.Error("list quarantine failed", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to list quarantine")
+		return
+	}
+	writeJSON(w, http.StatusOK, items)
+}
+
+// handleQuarantineSweep runs the orphan cleaner now instead of waiting for
+// its next pass.
+func (s *Server) handleQuarantineSweep(w http.ResponseWriter, r *http.Request) {
+	if s.orphans == nil {
+		writeError(w, http.StatusServiceUnavailable, "orphan cleanup not configured")
+		return
+	}
+	sweeps, err := s.orphans.SweepNow(r.Context())
+	if err != nil {
+		s.logger.Error("orphan sweep failed", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to sweep orphans")
+		return
+	}
+	s.audit(r.Context(), actorFromRequest(r), "admin.orphans_sweep", "", audit.DetailJSON(map[string]any{
+		"instances": len(sweeps),
+	}), "success")
+	writeJSON(w, http.StatusOK, sweeps)
+}
+
+func (s *Server) handleQuarantineRestore(w http.ResponseWriter, r *http.Request) {
+	if s.orphans == nil {
+		writeError(w, http.StatusServiceUnavailable, "orphan cleanup not configured")
+		return
+	}
+	id := r.PathValue("id")
+	it, err := s.orphans.Restore(r.Context(), id)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		writeError(w, http.StatusNotFound, "quarantined item not found: "+id)
+		return
+	case errors.Is(err, orphans.ErrNotRestorable):
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	case errors.Is(err, orphans.ErrExists):
+		writeError(w, http.StatusConflict, "state key "+it.Ref+" exists again; delete it or purge the quarantined copy")
+		return
+	case err != nil:
+		s.logger.Error("quarantine restore failed", "id", id, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to restore")
+		return
+	}
+	s.logger.Info("quarantined state restored", "id", id, "key", it.Ref)
+	s.audit(r.Context(), actorFromRequest(r), "quarantine.restore", it.Ref, audit.DetailJSON(map[string]any{
+		"id": id, "instance_id": it.InstanceID,
+	}), "success")
+	writeJSON(w, http.StatusOK, map[string]any{"restored": it.Ref, "id": id})
+}
+
+func (s *Server) handleQuarantinePurge(w http.ResponseWriter, r *http.Request) {
+	if s.orphans == nil {
+		writeError(w, http.StatusServiceUnavailable, "orphan cleanup not configured")
+		return
+	}
+	id := r.PathValue("id")
+	err := s.orphans.Purge(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "quarantined item not found: "+id)
+		return
+	}
+	if err != nil {
+		s.logger.Error("quarantine purge failed", "id", id, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to purge")
+		return
+	}
+	s.logger.Info("quarantined item purged", "id", id)
+	s.audit(r.Context(), actorFromRequest(r), "quarantine.purge", id, "{}", "success")
+	writeJSON(w, http.StatusOK, map[string]any{"deleted": id})
+}
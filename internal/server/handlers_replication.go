@@ -0,0 +1,48 @@
+package server
+
+import (
+	"net/http"
+)
+
+// readOnlyMiddleware rejects writes while the server runs as a replica.
+// Reads are served from the local copy; writes must go to the primary.
+func (s *Server) readOnlyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.replica == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+		default:
+			w.Header().Set("X-Koor-Primary", s.replica.Primary())
+			writeError(w, http.StatusServiceUnavailable, "read-only replica: send writes to "+s.replica.Primary())
+		}
+	})
+}
+
+// --- Replication handlers ---
+
+func (s *Server) handleReplicationSnapshot(w http.ResponseWriter, r *http.Request) {
+	if s.replSource == nil {
+		writeError(w, http.StatusServiceUnavailable, "replication not configured")
+		return
+	}
+	w.Header().Set("Content-Type", "application/vnd.sqlite3")
+	if err := s.replSource.WriteSnapshot(r.Context(), w); err != nil {
+		// Headers may already be sent; the follower rejects the truncated file.
+		s.logger.Error("replication snapshot failed", "error", err)
+	}
+}
+
+func (s *Server) handleReplicationStatus(w http.ResponseWriter, r *http.Request) {
+	if s.replica == nil {
+		writeJSON(w, http.StatusOK, map[string]any{"role": "primary"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"role":    "replica",
+		"replica": s.replica.Status(),
+	})
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/DavidRHerbert/koor/internal/audit"
+	"github.com/DavidRHerbert/koor/internal/specs"
+)
+
+// --- Rule review handlers ---
+
+// autoAcceptRule applies the project's auto-accept policy to a rule just
+// proposed and records the decision in the audit log. It returns nil if
+// the project has no policy.
+func (s *Server) autoAcceptRule(ctx context.Context, rule specs.Rule) *specs.AutoAcceptDecision {
+	decision, err := s.specReg.AutoAccept(ctx, rule.Project, rule.RuleID)
+	if err != nil {
+		s.logger.Error("auto-accept failed", "project", rule.Project, "rule_id", rule.RuleID, "error", err)
+		return nil
+	}
+	if decision == nil {
+		return nil
+	}
+	outcome := "queued"
+	if decision.Accepted {
+		outcome = "success"
+		s.logger.Info("rule auto-accepted", "project", rule.Project, "rule_id", rule.RuleID, "reason", decision.Reason)
+	}
+	s.audit(ctx, "auto-accept", "rule.auto_accept", rule.Project+"/"+rule.RuleID, audit.DetailJSON(map[string]any{
+		"proposed_by": rule.ProposedBy, "reason": decision.Reason, "prior_accepted": decision.PriorAccepted,
+	}), outcome)
+	return decision
+}
+
+// handleRulesAcceptBulk accepts the listed proposed rules of a project,
+// or all of them with "all": true.
+func (s *Server) handleRulesAcceptBulk(w http.ResponseWriter, r *http.Request) {
+	project := r.PathValue("project")
+	var req struct {
+		RuleIDs []string `json:"rule_ids"`
+		All     bool     `json:"all"`
+	}
+	if !s.decodeBody(w, r, &req) {
+		return
+	}
+	if len(req.RuleIDs) == 0 && !req.All {
+		s.rejectFields(w, "rule_ids or all is required",
+			fieldError{Field: "rule_ids", Problem: "rule_ids or all is required"})
+		return
+	}
+	if req.All {
+		req.RuleIDs = nil
+	}
+
+	accepted, err := s.specReg.AcceptRules(r.Context(), project, req.RuleIDs)
+	if err != nil {
+		s.logger.Error("bulk accept failed", "project", project, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to accept rules")
+		return
+	}
+	for _, id := range accepted {
+		s.audit(r.Context(), "", "rule.accept", project+"/"+id, `{"bulk":true}`, "success")
+	}
+	s.logger.Info("rules accepted", "project", project, "count", len(accepted))
+	writeJSON(w, http.StatusOK, map[string]any{"project": project, "accepted": accepted})
+}
+
+func (s *Server) handleAutoAcceptGet(w http.ResponseWriter, r *http.Request) {
+	project := r.PathValue("project")
+	policy, err := s.specReg.GetAutoAccept(r.Context(), project)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "no auto-accept policy for project: "+project)
+		return
+	}
+	if err != nil {
+		s.logger.Error("get auto-accept policy failed", "project", project, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to get auto-accept policy")
+		return
+	}
+	writeJSON(w, http.StatusOK, policy)
+}
+
+func (s *Server) handleAutoAcceptPut(w http.ResponseWriter, r *http.Request) {
+	project := r.PathValue("project")
+	var policy specs.AutoAcceptPolicy
+	if !s.decodeBody(w, r, &policy) {
+		return
+	}
+	policy.Project = project
+	if err := s.specReg.PutAutoAccept(r.Context(), policy); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	saved, err := s.specReg.GetAutoAccept(r.Context(), project)
+	if err != nil {
+		s.logger.Error("get auto-accept policy failed", "project", project, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to get auto-accept policy")
+		return
+	}
+	s.logger.Info("auto-accept policy set", "project", project, "severities", saved.Severities, "min_accepted", saved.MinAccepted)
+	s.audit(r.Context(), "", "rule.auto_accept_policy", project, audit.DetailJSON(map[string]any{
+		"severities": saved.Severities, "min_accepted": saved.MinAccepted,
+	}), "success")
+	writeJSON(w, http.StatusOK, saved)
+}
+
+func (s *Server) handleAutoAcceptDelete(w http.ResponseWriter, r *http.Request) {
+	project := r.PathValue("project")
+	err := s.specReg.DeleteAutoAccept(r.Context(), project)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "no auto-accept policy for project: "+project)
+		return
+	}
+	if err != nil {
+		s.logger.Error("delete auto-accept policy failed", "project", project, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to delete auto-accept policy")
+		return
+	}
+	s.logger.Info("auto-accept policy deleted", "project", project)
+	s.audit(r.Context(), "", "rule.auto_accept_policy.delete", project, "{}", "success")
+	writeJSON(w, http.StatusOK, map[string]string{"deleted": project})
+}
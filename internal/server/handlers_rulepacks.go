@@ -0,0 +1,69 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/DavidRHerbert/koor/internal/audit"
+	"github.com/DavidRHerbert/koor/internal/rulepacks"
+)
+
+// --- Rule pack handlers ---
+
+// handleRulePackInstall installs the pack in the request body into the
+// project named by ?project=, replacing any installed version of it.
+func (s *Server) handleRulePackInstall(w http.ResponseWriter, r *http.Request) {
+	if s.rulePacks == nil {
+		writeError(w, http.StatusServiceUnavailable, "rule packs not configured")
+		return
+	}
+	project := r.URL.Query().Get("project")
+	if project == "" {
+		writeError(w, http.StatusBadRequest, "project query parameter is required")
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, 10<<20)) // 10 MB limit
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "failed to read body")
+		return
+	}
+	pack, err := rulepacks.Parse(body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	allow := r.URL.Query().Get("allow_downgrade")
+	res, err := s.rulePacks.Install(r.Context(), project, pack, allow == "1" || allow == "true")
+	if errors.Is(err, rulepacks.ErrDowngrade) {
+		writeError(w, http.StatusConflict, err.Error()+" (use allow_downgrade=true)")
+		return
+	}
+	if err != nil {
+		s.logger.Error("install rule pack failed", "project", project, "pack", pack.Name, "error", err)
+		s.audit(r.Context(), actorFromRequest(r), "rulepack.install", project+"/"+pack.Name, audit.DetailJSON(map[string]any{"version": pack.Version, "error": err.Error()}), "failure")
+		writeError(w, http.StatusInternalServerError, "failed to install rule pack")
+		return
+	}
+
+	s.logger.Info("rule pack installed", "project", project, "pack", pack.Name, "version", pack.Version, "action", res.Action)
+	s.audit(r.Context(), actorFromRequest(r), "rulepack.install", project+"/"+pack.Name, audit.DetailJSON(map[string]any{
+		"version": pack.Version, "previous_version": res.PreviousVersion, "action": res.Action,
+		"signed_by": res.SignedBy, "rules_added": len(res.RulesAdded), "rules_removed": len(res.RulesRemoved),
+	}), "success")
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (s *Server) handleRulePackList(w http.ResponseWriter, r *http.Request) {
+	if s.rulePacks == nil {
+		writeError(w, http.StatusServiceUnavailable, "rule packs not configured")
+		return
+	}
+	list, err := s.rulePacks.List(r.Context(), r.URL.Query().Get("project"))
+	if err != nil {
+		s.logger.Error("list rule packs failed", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to list rule packs")
+		return
+	}
+	writeJSON(w, http.StatusOK, list)
+}
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/DavidRHerbert/koor/internal/audit"
+	"github.com/DavidRHerbert/koor/internal/schedules"
+)
+
+// --- Schedule handlers ---
+
+func (s *Server) handleScheduleCreate(w http.ResponseWriter, r *http.Request) {
+	if s.schedules == nil {
+		writeError(w, http.StatusServiceUnavailable, "schedules not configured")
+		return
+	}
+	var req schedules.Schedule
+	if !s.decodeBody(w, r, &req) {
+		return
+	}
+	if err := schedules.Validate(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	sc, err := s.schedules.Create(r.Context(), req)
+	if err != nil {
+		s.logger.Error("schedule create failed", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to create schedule")
+		return
+	}
+	s.logger.Info("schedule created", "id", sc.ID, "cron", sc.Cron, "topic", sc.Topic)
+	s.audit(r.Context(), actorFromRequest(r), "schedule.create", sc.ID, audit.DetailJSON(map[string]any{
+		"name": sc.Name, "cron": sc.Cron, "timezone": sc.Timezone, "topic": sc.Topic,
+	}), "success")
+	writeJSON(w, http.StatusOK, sc)
+}
+
+func (s *Server) handleScheduleList(w http.ResponseWriter, r *http.Request) {
+	if s.schedules == nil {
+		writeError(w, http.StatusServiceUnavailable, "schedules not configured")
+		return
+	}
+	list, err := s.schedules.List(r.Context())
+	if err != nil {
+		s.logger.Error("schedule list failed", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to list schedules")
+		return
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (s *Server) handleScheduleGet(w http.ResponseWriter, r *http.Request) {
+	if s.schedules == nil {
+		writeError(w, http.StatusServiceUnavailable, "schedules not configured")
+		return
+	}
+	id := r.PathValue("id")
+	sc, err := s.schedules.Get(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "schedule not found: "+id)
+		return
+	}
+	if err != nil {
+		s.logger.Error("schedule get failed", "id", id, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to get schedule")
+		return
+	}
+	writeJSON(w, http.StatusOK, sc)
+}
+
+func (s *Server) handleScheduleUpdate(w http.ResponseWriter, r *http.Request) {
+	if s.schedules == nil {
+		writeError(w, http.StatusServiceUnavailable, "schedules not configured")
+		return
+	}
+	var req schedules.Schedule
+	if !s.decodeBody(w, r, &req) {
+		return
+	}
+	req.ID = r.PathValue("id")
+	if err := schedules.Validate(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	sc, err := s.schedules.Update(r.Context(), req)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "schedule not found: "+req.ID)
+		return
+	}
+	if err != nil {
+		s.logger.Error("schedule update failed", "id", req.ID, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to update schedule")
+		return
+	}
+	s.logger.Info("schedule updated", "id", sc.ID, "cron", sc.Cron, "topic", sc.Topic, "paused", sc.Paused)
+	s.audit(r.Context(), actorFromRequest(r), "schedule.update", sc.ID, audit.DetailJSON(map[string]any{
+		"name": sc.Name, "cron": sc.Cron, "timezone": sc.Timezone, "topic": sc.Topic, "paused": sc.Paused,
+	}), "success")
+	writeJSON(w, http.StatusOK, sc)
+}
+
+func (s *Server) handleScheduleDelete(w http.ResponseWriter, r *http.Request) {
+	if s.schedules == nil {
+		writeError(w, http.StatusServiceUnavailable, "schedules not configured")
+		return
+	}
+	id := r.PathValue("id")
+	err := s.schedules.Delete(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "schedule not found: "+id)
+		return
+	}
+	if err != nil {
+		s.logger.Error("schedule delete failed", "id", id, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to delete schedule")
+		return
+	}
+	s.logger.Info("schedule deleted", "id", id)
+	s.audit(r.Context(), actorFromRequest(r), "schedule.delete", id, "{}", "success")
+	writeJSON(w, http.StatusOK, map[string]any{"deleted": id})
+}
+
+// handleScheduleRun publishes a schedule's event at once, e.g. to try it
+// out, without moving its next run.
+func (s *Server) handleScheduleRun(w http.ResponseWriter, r *http.Request) {
+	if s.schedules == nil {
+		writeError(w, http.StatusServiceUnavailable, "schedules not configured")
+		return
+	}
+	id := r.PathValue("id")
+	ev, err := s.schedules.Run(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "schedule not found: "+id)
+		return
+	}
+	if err != nil {
+		s.logger.Error("schedule run failed", "id", id, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to run schedule: "+err.Error())
+		return
+	}
+	s.logger.Info("schedule run", "id", id, "topic", ev.Topic, "event_id", ev.ID)
+	s.audit(r.Context(), actorFromRequest(r), "schedule.run", id, audit.DetailJSON(map[string]any{
+		"topic": ev.Topic, "event_id": ev.ID,
+	}), "success")
+	writeJSON(w, http.StatusOK, ev)
+}
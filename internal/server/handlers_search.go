@@ -0,0 +1,68 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/DavidRHerbert/koor/internal/search"
+)
+
+// --- Search handlers ---
+
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	if s.searchIndex == nil {
+		writeError(w, http.StatusServiceUnavailable, "search not configured")
+		return
+	}
+	q := r.URL.Query().Get("q")
+	if strings.TrimSpace(q) == "" {
+		writeError(w, http.StatusBadRequest, "q is required")
+		return
+	}
+	var types []string
+	if v := r.URL.Query().Get("types"); v != "" {
+		for _, t := range strings.Split(v, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				types = append(types, t)
+			}
+		}
+	}
+	limit := 20
+	if v := r.URL.Query().Get("limit"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			limit = n
+		}
+	}
+
+	results, err := s.searchIndex.Search(r.Context(), q, types, limit)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	results = ownResults(r, results)
+	writeJSON(w, http.StatusOK, map[string]any{
+		"query":   q,
+		"results": results,
+		"count":   len(results),
+	})
+}
+
+// ownResults keeps the search hits a project-bound caller may see: its
+// state keys, specs, rules and event topics. Templates are shared by every
+// project.
+func ownResults(r *http.Request, results []search.Result) []search.Result {
+	id := identityFromRequest(r)
+	own := []search.Result{}
+	for _, res := range results {
+		project, _, _ := strings.Cut(res.Ref, "/")
+		switch {
+		case id == nil || res.Type == "templates",
+			res.Type == "state" && id.OwnsKey(res.Ref),
+			(res.Type == "specs" || res.Type == "rules") && id.OwnsProject(project),
+			res.Type == "events" && id.CanSeeTopic(res.Title):
+			own = append(own, res)
+		}
+	}
+	return own
+}
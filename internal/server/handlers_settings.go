@@ -0,0 +1,140 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/DavidRHerbert/koor/internal/audit"
+	"github.com/DavidRHerbert/koor/internal/projects"
+	"github.com/DavidRHerbert/koor/internal/specs"
+)
+
+// settingsFor returns a project's settings, falling back to the defaults
+// when no settings store is attached or the lookup fails.
+func (s *Server) settingsFor(ctx context.Context, project string) projects.Settings {
+	if s.settings == nil || project == "" {
+		return projects.Defaults(project)
+	}
+	st, err := s.settings.Get(ctx, project)
+	if err != nil {
+		s.logger.Error("project settings lookup failed", "project", project, "error", err)
+		return projects.Defaults(project)
+	}
+	return st
+}
+
+// enforceStateValidation runs the owning project's rules over a state write
+// when the project requires it. It writes a 422 and returns false if any
+// violation has error severity.
+func (s *Server) enforceStateValidation(w http.ResponseWriter, r *http.Request, key string, value []byte) bool {
+	project := projects.ProjectOfKey(key)
+	st := s.settingsFor(r.Context(), project)
+	if !st.ValidateStateWrites {
+		return true
+	}
+	violations, err := s.specReg.Validate(r.Context(), project, specs.ValidateRequest{
+		Filename:   key,
+		Content:    string(value),
+		Stack:      st.DefaultStack,
+		SkipGlobal: !st.GlobalRules,
+	})
+	if err != nil {
+		s.logger.Error("state validation failed", "key", key, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to validate state")
+		return false
+	}
+	var blocking []specs.Violation
+	for _, v := range violations {
+		if v.Severity == "error" {
+			blocking = append(blocking, v)
+		}
+	}
+	if len(blocking) == 0 {
+		return true
+	}
+	s.logger.Warn("state write rejected by validation", "key", key, "violations", len(blocking))
+	s.audit(r.Context(), actorFromRequest(r), "state.put", key, audit.DetailJSON(map[string]any{
+		"project": project, "violations": len(blocking),
+	}), "failure")
+	writeJSON(w, http.StatusUnprocessableEntity, map[string]any{
+		"error":      "state value fails " + project + " validation rules",
+		"code":       http.StatusUnprocessableEntity,
+		"violations": blocking,
+	})
+	return false
+}
+
+// --- Project settings handlers ---
+
+func (s *Server) handleProjectSettingsGet(w http.ResponseWriter, r *http.Request) {
+	if s.settings == nil {
+		writeError(w, http.StatusServiceUnavailable, "project settings not configured")
+		return
+	}
+	project := r.PathValue("project")
+	st, err := s.settings.Get(r.Context(), project)
+	if err != nil {
+		s.logger.Error("project settings get failed", "project", project, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to get project settings")
+		return
+	}
+	writeJSON(w, http.StatusOK, st)
+}
+
+// handleProjectSettingsPut replaces a project's settings. Fields missing
+// from the body take their default values.
+func (s *Server) handleProjectSettingsPut(w http.ResponseWriter, r *http.Request) {
+	if s.settings == nil {
+		writeError(w, http.StatusServiceUnavailable, "project settings not configured")
+		return
+	}
+	project := r.PathValue("project")
+	st := projects.Defaults(project)
+	if !s.decodeBody(w, r, &st) {
+		return
+	}
+	st.Project = project
+	if err := st.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	saved, err := s.settings.Put(r.Context(), st)
+	if err != nil {
+		s.logger.Error("project settings put failed", "project", project, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to save project settings")
+		return
+	}
+	s.logger.Info("project settings updated", "project", project)
+	s.audit(r.Context(), actorFromRequest(r), "project.settings", project, audit.DetailJSON(map[string]any{
+		"default_stack":         saved.DefaultStack,
+		"validate_state_writes": saved.ValidateStateWrites,
+		"global_rules":          saved.GlobalRules,
+		"event_retention":       saved.EventRetention,
+		"error_budgets":         len(saved.ErrorBudgets),
+	}), "success")
+	writeJSON(w, http.StatusOK, saved)
+}
+
+func (s *Server) handleProjectSettingsDelete(w http.ResponseWriter, r *http.Request) {
+	if s.settings == nil {
+		writeError(w, http.StatusServiceUnavailable, "project settings not configured")
+		return
+	}
+	project := r.PathValue("project")
+	err := s.settings.Delete(r.Context(), project)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "no settings stored for project: "+project)
+		return
+	}
+	if err != nil {
+		s.logger.Error("project settings delete failed", "project", project, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to delete project settings")
+		return
+	}
+	s.logger.Info("project settings reset", "project", project)
+	s.audit(r.Context(), actorFromRequest(r), "project.settings.reset", project, "{}", "success")
+	writeJSON(w, http.StatusOK, projects.Defaults(project))
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/DavidRHerbert/koor/internal/audit"
+	"github.com/DavidRHerbert/koor/internal/policy"
+	"github.com/DavidRHerbert/koor/internal/state"
+)
+
+// --- State history retention handlers ---
+
+// handleStateRetentionGet lists the history retention policies in the
+// order keys are matched against them, most specific first.
+func (s *Server) handleStateRetentionGet(w http.ResponseWriter, r *http.Request) {
+	policies, err := s.stateStore.RetentionPolicies(r.Context())
+	if err != nil {
+		s.logger.Error("list state retention failed", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to list state retention")
+		return
+	}
+	if policies == nil {
+		policies = []state.RetentionPolicy{}
+	}
+	writeJSON(w, http.StatusOK, policies)
+}
+
+// handleStateRetentionPut replaces the history retention policies. The
+// compaction job applies them on its next run.
+func (s *Server) handleStateRetentionPut(w http.ResponseWriter, r *http.Request) {
+	var policies []state.RetentionPolicy
+	if !s.decodeBody(w, r, &policies) {
+		return
+	}
+	if err := state.ValidateRetention(policies); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := s.stateStore.SetRetentionPolicies(r.Context(), policies); err != nil {
+		s.logger.Error("set state retention failed", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to set state retention")
+		return
+	}
+	s.logger.Info("state retention updated", "policies", len(policies))
+	s.audit(r.Context(), actorFromRequest(r), "state.retention", "", audit.DetailJSON(map[string]any{
+		"policies": policies,
+	}), "success")
+	s.handleStateRetentionGet(w, r)
+}
+
+// handleStateRetentionCompact runs the compaction job now, over every key.
+func (s *Server) handleStateRetentionCompact(w http.ResponseWriter, r *http.Request) {
+	res, err := s.stateStore.CompactAll(r.Context())
+	if err != nil {
+		s.logger.Error("state compaction failed", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to compact state history")
+		return
+	}
+	s.logger.Info("state history compacted", "keys", res.Keys, "reclaimed", res.Reclaimed)
+	s.audit(r.Context(), actorFromRequest(r), "state.compact", "*", audit.DetailJSON(map[string]any{
+		"keys": res.Keys, "reclaimed": res.Reclaimed,
+	}), "success")
+	writeJSON(w, http.StatusOK, res)
+}
+
+// handleStateCompact compacts one key's history: POST
+// /api/state/{key}?compact=1. ?keep=N and ?max_age= override the key's
+// retention policy; a key without one needs either.
+func (s *Server) handleStateCompact(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	if !s.enforcePolicy(w, r, policy.ActionStateWrite, key) {
+		return
+	}
+	q := r.URL.Query()
+	var p state.RetentionPolicy
+	if q.Get("keep") != "" || q.Get("max_age") != "" {
+		if v := q.Get("max_age"); v != "" {
+			if d, err := time.ParseDuration(v); err != nil || d <= 0 {
+				writeError(w, http.StatusBadRequest, "max_age must be a positive duration")
+				return
+			}
+			p.MaxAge = v
+		}
+		if v := q.Get("keep"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				writeError(w, http.StatusBadRequest, "keep must be a positive integer")
+				return
+			}
+			p.MaxVersions = n
+		}
+	} else {
+		found, err := s.stateStore.RetentionFor(r.Context(), key)
+		if err != nil {
+			s.logger.Error("state compaction failed", "key", key, "error", err)
+			writeError(w, http.StatusInternalServerError, "failed to compact state history")
+			return
+		}
+		if found == nil {
+			writeError(w, http.StatusBadRequest, "no retention policy covers key "+key+"; pass ?keep=N or ?max_age=<duration>")
+			return
+		}
+		p = *found
+	}
+
+	reclaimed, err := s.stateStore.Compact(r.Context(), key, p)
+	if err != nil {
+		s.logger.Error("state compaction failed", "key", key, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to compact state history")
+		return
+	}
+	s.logger.Info("state history compacted", "key", key, "reclaimed", reclaimed)
+	s.audit(r.Context(), actorFromRequest(r), "state.compact", key, audit.DetailJSON(map[string]any{
+		"reclaimed": reclaimed, "max_versions": p.MaxVersions, "max_age": p.MaxAge,
+	}), "success")
+	writeJSON(w, http.StatusOK, map[string]any{
+		"key":          key,
+		"reclaimed":    reclaimed,
+		"pattern":      p.Pattern,
+		"max_versions": p.MaxVersions,
+		"max_age":      p.MaxAge,
+	})
+}
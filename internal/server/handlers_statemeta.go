@@ -0,0 +1,132 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/DavidRHerbert/koor/internal/audit"
+	"github.com/DavidRHerbert/koor/internal/policy"
+	"github.com/DavidRHerbert/koor/internal/state"
+)
+
+// stateMetaKey reports whether a /api/state/{key...} request addresses the
+// key's metadata ("{key}/meta") and returns the underlying key.
+func stateMetaKey(r *http.Request) (string, bool) {
+	return strings.CutSuffix(r.PathValue("key"), "/meta")
+}
+
+// filterStateList applies the ?owner=, ?tag= and ?orphaned=true filters of
+// GET /api/state. A key is orphaned when its owner is no longer registered.
+func (s *Server) filterStateList(r *http.Request, items []state.Summary) []state.Summary {
+	q := r.URL.Query()
+	owner, tag, orphaned := q.Get("owner"), q.Get("tag"), q.Get("orphaned") == "true"
+	if owner == "" && tag == "" && !orphaned {
+		return items
+	}
+	live := map[string]bool{}
+	out := []state.Summary{}
+	for _, item := range items {
+		if owner != "" && (item.Meta == nil || item.Meta.Owner != owner) {
+			continue
+		}
+		if tag != "" && !item.Meta.HasTag(tag) {
+			continue
+		}
+		if orphaned {
+			if item.Meta == nil || item.Meta.Owner == "" {
+				continue
+			}
+			id := item.Meta.Owner
+			if _, seen := live[id]; !seen {
+				_, err := s.instanceReg.Get(r.Context(), id)
+				live[id] = err == nil
+			}
+			if live[id] {
+				continue
+			}
+		}
+		out = append(out, item)
+	}
+	return out
+}
+
+// --- State metadata handlers ---
+
+func (s *Server) handleStateMetaGet(w http.ResponseWriter, r *http.Request, key string) {
+	m, err := s.stateStore.GetMeta(r.Context(), key)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "no metadata for key: "+key)
+		return
+	}
+	if err != nil {
+		s.logger.Error("state meta get failed", "key", key, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to get state metadata")
+		return
+	}
+	writeJSON(w, http.StatusOK, m)
+}
+
+// handleStateMetaPut replaces a key's metadata. The owner defaults to the
+// calling instance (X-Koor-Instance); a schema must name an existing spec.
+func (s *Server) handleStateMetaPut(w http.ResponseWriter, r *http.Request, key string) {
+	var m state.Meta
+	if !s.decodeBody(w, r, &m) {
+		return
+	}
+	m.Key = key
+	if m.Owner == "" {
+		m.Owner = r.Header.Get("X-Koor-Instance")
+	}
+	if m.Schema != "" {
+		project, name, ok := strings.Cut(m.Schema, "/")
+		if !ok {
+			s.rejectFields(w, "schema must be a spec reference: project/name",
+				fieldError{Field: "schema", Problem: "must be a spec reference: project/name"})
+			return
+		}
+		if _, err := s.specReg.Get(r.Context(), project, name); err != nil {
+			writeError(w, http.StatusBadRequest, "schema spec not found: "+m.Schema)
+			return
+		}
+	}
+	if !s.enforcePolicy(w, r, policy.ActionStateWrite, key) {
+		return
+	}
+
+	saved, err := s.stateStore.PutMeta(r.Context(), m)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "key not found: "+key)
+		return
+	}
+	if err != nil {
+		s.logger.Error("state meta put failed", "key", key, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to write state metadata")
+		return
+	}
+	s.logger.Info("state metadata updated", "key", key, "owner", saved.Owner)
+	s.audit(r.Context(), actorFromRequest(r), "state.meta", key, audit.DetailJSON(map[string]any{
+		"owner": saved.Owner, "tags": saved.Tags, "schema": saved.Schema,
+	}), "success")
+	writeJSON(w, http.StatusOK, saved)
+}
+
+func (s *Server) handleStateMetaDelete(w http.ResponseWriter, r *http.Request, key string) {
+	if !s.enforcePolicy(w, r, policy.ActionStateWrite, key) {
+		return
+	}
+	err := s.stateStore.DeleteMeta(r.Context(), key)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "no metadata for key: "+key)
+		return
+	}
+	if err != nil {
+		s.logger.Error("state meta delete failed", "key", key, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to delete state metadata")
+		return
+	}
+	s.logger.Info("state metadata deleted", "key", key)
+	s.audit(r.Context(), actorFromRequest(r), "state.meta.delete", key, "{}", "success")
+	writeJSON(w, http.StatusOK, map[string]any{"deleted": key + "/meta"})
+}
@@ -0,0 +1,348 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DavidRHerbert/koor/internal/compliance"
+	"github.com/DavidRHerbert/koor/internal/events"
+	"github.com/DavidRHerbert/koor/internal/instances"
+	"github.com/DavidRHerbert/koor/internal/milestones"
+	"github.com/DavidRHerbert/koor/internal/specs"
+)
+
+// --- Project status handlers ---
+
+// statusEventWindow is how many recent project events the status snapshot
+// scans for requests, approvals and milestones.
+const statusEventWindow = 500
+
+type statusTask struct {
+	Key       string          `json:"key"`
+	Value     json.RawMessage `json:"value"`
+	Version   int64           `json:"version"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+type statusAgent struct {
+	ID         string            `json:"id"`
+	Name       string            `json:"name"`
+	Role       string            `json:"role"`
+	Status     string            `json:"status"`
+	Intent     string            `json:"intent"`
+	Stack      string            `json:"stack"`
+	LastSeen   time.Time         `json:"last_seen"`
+	Task       *statusTask       `json:"task,omitempty"`
+	Compliance *compliance.Score `json:"compliance,omitempty"`
+}
+
+// projectAgent is an instance belonging to a project, with its role.
+type projectAgent struct {
+	instances.Summary
+	Role string
+}
+
+// projectTasks returns the project's task entries, state keys
+// "{Project}/{role}-task", keyed by role.
+func (s *Server) projectTasks(ctx context.Context, project string) (map[string]*statusTask, error) {
+	tasks := map[string]*statusTask{}
+	keys, err := s.stateStore.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range keys {
+		rest, ok := strings.CutPrefix(k.Key, project+"/")
+		if !ok || !strings.HasSuffix(rest, "-task") || strings.Contains(rest, "/") {
+			continue
+		}
+		entry, err := s.stateStore.Get(ctx, k.Key)
+		if err != nil {
+			continue
+		}
+		value := json.RawMessage(entry.Value)
+		if !json.Valid(value) {
+			value, _ = json.Marshal(string(entry.Value))
+		}
+		tasks[strings.TrimSuffix(rest, "-task")] = &statusTask{
+			Key: entry.Key, Value: value, Version: entry.Version, UpdatedAt: entry.UpdatedAt,
+		}
+	}
+	return tasks, nil
+}
+
+// projectAgents returns the instances named "{project}-{role}" or whose
+// workspace is the project.
+func (s *Server) projectAgents(ctx context.Context, project string) ([]projectAgent, error) {
+	all, err := s.instanceReg.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var agents []projectAgent
+	for _, inst := range all {
+		role, ok := agentRole(project, inst.Name, inst.Workspace)
+		if !ok {
+			continue
+		}
+		agents = append(agents, projectAgent{Summary: inst, Role: role})
+	}
+	return agents, nil
+}
+
+// projectRequests scans the project's recent events, newest first, for
+// requests not yet answered and for progress markers. A request is pending
+// until a later controller event references it with "request_id"; done
+// and milestone events are progress markers.
+func (s *Server) projectRequests(ctx context.Context, project string) (pending, progress []events.Event, err error) {
+	slug := strings.ToLower(project)
+	history, err := s.eventBus.History(ctx, statusEventWindow, slug+".*")
+	if err != nil {
+		return nil, nil, err
+	}
+	answered := map[int64]bool{}
+	for _, ev := range history {
+		if strings.HasPrefix(ev.Topic, slug+".controller.") {
+			var ref struct {
+				RequestID int64 `json:"request_id"`
+			}
+			if json.Unmarshal(ev.Data, &ref) == nil && ref.RequestID != 0 {
+				answered[ref.RequestID] = true
+			}
+		}
+	}
+	pending = []events.Event{}
+	progress = []events.Event{}
+	for _, ev := range history {
+		switch {
+		case strings.HasSuffix(ev.Topic, ".request") && !answered[ev.ID]:
+			pending = append(pending, ev)
+		case strings.HasSuffix(ev.Topic, ".done") || strings.HasPrefix(ev.Topic, slug+".milestone."):
+			progress = append(progress, ev)
+		}
+	}
+	return pending, progress, nil
+}
+
+// handleProjectStatus builds a single snapshot of a project following the
+// multi-agent naming conventions: agents named "{project}-{role}", tasks
+// in state keys "{Project}/{role}-task", and events under "{project}.".
+func (s *Server) handleProjectStatus(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	project := r.PathValue("project")
+
+	tasks, err := s.projectTasks(ctx, project)
+	if err != nil {
+		s.logger.Error("project status failed", "project", project, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to list state")
+		return
+	}
+
+	// Agents, with their task and compliance score.
+	members, err := s.projectAgents(ctx, project)
+	if err != nil {
+		s.logger.Error("project status failed", "project", project, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to list instances")
+		return
+	}
+	agents := []statusAgent{}
+	minScore := -1
+	for _, inst := range members {
+		a := statusAgent{
+			ID: inst.ID, Name: inst.Name, Role: inst.Role, Status: inst.Status,
+			Intent: inst.Intent, Stack: inst.Stack, LastSeen: inst.LastSeen,
+			Task: tasks[inst.Role],
+		}
+		if s.compSched != nil {
+			if sc, err := s.compSched.Score(ctx, inst.ID, time.Now().Add(-7*24*time.Hour)); err == nil {
+				a.Compliance = sc
+				if minScore < 0 || sc.Score < minScore {
+					minScore = sc.Score
+				}
+			}
+		}
+		agents = append(agents, a)
+	}
+	sort.Slice(agents, func(i, j int) bool { return agents[i].Name < agents[j].Name })
+
+	pending, recent, err := s.projectRequests(ctx, project)
+	if err != nil {
+		s.logger.Error("project status failed", "project", project, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to read events")
+		return
+	}
+	if len(recent) > 10 {
+		recent = recent[:10]
+	}
+
+	proposed, err := s.specReg.ListAllRules(ctx, project, "", "", "proposed")
+	if err != nil {
+		s.logger.Error("project status failed", "project", project, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to list rules")
+		return
+	}
+	if proposed == nil {
+		proposed = []specs.Rule{}
+	}
+
+	resp := map[string]any{
+		"project":          project,
+		"generated_at":     time.Now().UTC(),
+		"agents":           agents,
+		"tasks":            tasks,
+		"pending_requests": pending,
+		"pending_rules":    proposed,
+		"milestones":       recent,
+	}
+	if s.milestones != nil {
+		progress := []milestones.Progress{}
+		if list, err := s.milestones.List(ctx, project); err == nil {
+			for _, m := range list {
+				if p, err := s.milestones.Progress(ctx, m, false); err == nil {
+					progress = append(progress, *p)
+				}
+			}
+		}
+		resp["milestone_progress"] = progress
+	}
+	if s.compSched != nil {
+		incidents := 0
+		for _, a := range agents {
+			if a.Compliance != nil {
+				incidents += a.Compliance.Incidents
+			}
+		}
+		summary := map[string]any{"incidents": incidents}
+		if minScore >= 0 {
+			summary["min_score"] = minScore
+		}
+		resp["compliance"] = summary
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// Pending item priorities, most urgent first.
+const (
+	priorityHigh   = 1
+	priorityNormal = 2
+	priorityLow    = 3
+)
+
+// pendingItem is one thing waiting on the Controller.
+type pendingItem struct {
+	Kind     string          `json:"kind"` // request, stale_agent, unclaimed_task, proposed_rule
+	Priority int             `json:"priority"`
+	Ref      string          `json:"ref"`
+	Title    string          `json:"title"`
+	Since    time.Time       `json:"since"`
+	Action   string          `json:"action"`
+	Data     json.RawMessage `json:"data,omitempty"`
+}
+
+// handleProjectPending lists what the Controller should look at, most
+// urgent and then oldest first: unanswered requests and stale agents, then
+// tasks no active agent holds, then rule proposals awaiting review.
+func (s *Server) handleProjectPending(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	project := r.PathValue("project")
+	slug := strings.ToLower(project)
+	fail := func(what string, err error) {
+		s.logger.Error("project pending failed", "project", project, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to "+what)
+	}
+
+	items := []pendingItem{}
+
+	requests, _, err := s.projectRequests(ctx, project)
+	if err != nil {
+		fail("read events", err)
+		return
+	}
+	for _, ev := range requests {
+		items = append(items, pendingItem{
+			Kind: "request", Priority: priorityHigh, Ref: strconv.FormatInt(ev.ID, 10),
+			Title:  ev.Topic,
+			Since:  ev.CreatedAt,
+			Action: fmt.Sprintf(`answer with a %s.controller.* event whose data has "request_id": %d`, slug, ev.ID),
+			Data:   ev.Data,
+		})
+	}
+
+	agents, err := s.projectAgents(ctx, project)
+	if err != nil {
+		fail("list instances", err)
+		return
+	}
+	active := map[string]bool{}
+	for _, a := range agents {
+		switch a.Status {
+		case "active":
+			active[a.Role] = true
+		case "stale":
+			items = append(items, pendingItem{
+				Kind: "stale_agent", Priority: priorityHigh, Ref: a.ID,
+				Title:  a.Name + " stopped sending heartbeats",
+				Since:  a.LastSeen,
+				Action: "check on the agent or deregister it",
+			})
+		}
+	}
+
+	tasks, err := s.projectTasks(ctx, project)
+	if err != nil {
+		fail("list state", err)
+		return
+	}
+	for role, t := range tasks {
+		if active[role] {
+			continue
+		}
+		items = append(items, pendingItem{
+			Kind: "unclaimed_task", Priority: priorityNormal, Ref: t.Key,
+			Title:  "no active " + role + " agent holds this task",
+			Since:  t.UpdatedAt,
+			Action: "start or reassign a " + role + " agent",
+			Data:   t.Value,
+		})
+	}
+
+	proposed, err := s.specReg.ListAllRules(ctx, project, "", "", "proposed")
+	if err != nil {
+		fail("list rules", err)
+		return
+	}
+	for _, rule := range proposed {
+		since, _ := time.Parse(time.RFC3339, rule.CreatedAt)
+		title := rule.Message
+		if title == "" {
+			title = rule.Pattern
+		}
+		items = append(items, pendingItem{
+			Kind: "proposed_rule", Priority: priorityLow, Ref: rule.Project + "/" + rule.RuleID,
+			Title:  title,
+			Since:  since,
+			Action: "accept or reject the proposal",
+		})
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].Priority != items[j].Priority {
+			return items[i].Priority < items[j].Priority
+		}
+		return items[i].Since.Before(items[j].Since)
+	})
+	counts := map[string]int{}
+	for _, it := range items {
+		counts[it.Kind]++
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"project":      project,
+		"generated_at": time.Now().UTC(),
+		"items":        items,
+		"counts":       counts,
+	})
+}
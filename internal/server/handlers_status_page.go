@@ -0,0 +1,163 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/DavidRHerbert/koor/internal/dashboard"
+)
+
+// --- Public status page ---
+
+// StatusSections are the parts of a project the public status page can
+// expose, as named in Config.StatusExpose.
+var StatusSections = []string{"agents", "milestones", "last_event"}
+
+// ParseStatusExpose parses a comma-separated list of StatusSections.
+func ParseStatusExpose(v string) (map[string]bool, error) {
+	expose := map[string]bool{}
+	for _, part := range strings.Split(v, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		known := false
+		for _, s := range StatusSections {
+			known = known || s == part
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown status section %q (want %s)", part, strings.Join(StatusSections, ", "))
+		}
+		expose[part] = true
+	}
+	return expose, nil
+}
+
+type publicAgent struct {
+	Name     string    `json:"name"`
+	Role     string    `json:"role"`
+	Status   string    `json:"status"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+type publicMilestone struct {
+	Name      string     `json:"name"`
+	Due       *time.Time `json:"due,omitempty"`
+	Completed int        `json:"completed"`
+	Total     int        `json:"total"`
+	Percent   float64    `json:"percent"`
+	Overdue   bool       `json:"overdue"`
+}
+
+// publicProject is what the status page shows of a project. Sections that
+// are not exposed are left out.
+type publicProject struct {
+	Project    string            `json:"project"`
+	Agents     []publicAgent     `json:"agents,omitempty"`
+	Milestones []publicMilestone `json:"milestones,omitempty"`
+	LastEvent  *time.Time        `json:"last_event,omitempty"`
+}
+
+type publicStatus struct {
+	GeneratedAt time.Time       `json:"generated_at"`
+	Projects    []publicProject `json:"projects"`
+}
+
+// StatusHandler returns the HTTP handler for the public status page
+// (separate port). It needs no sign-in and serves only the projects in
+// Config.StatusProjects and the sections in Config.StatusExpose, so
+// stakeholders can follow progress without an API token. Nothing else
+// of the API or dashboard is reachable through it.
+func (s *Server) StatusHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /health", s.handleHealth)
+	mux.HandleFunc("GET /{$}", s.handleStatusPage)
+	mux.HandleFunc("GET /status.json", s.handleStatusPageJSON)
+	mux.Handle("GET /style.css", dashboard.Handler())
+	return mux
+}
+
+// publicStatus collects the exposed sections of the configured projects.
+func (s *Server) publicStatus(ctx context.Context) (*publicStatus, error) {
+	expose, err := ParseStatusExpose(s.config.StatusExpose)
+	if err != nil {
+		return nil, err
+	}
+	st := &publicStatus{GeneratedAt: time.Now().UTC(), Projects: []publicProject{}}
+	for _, project := range strings.Split(s.config.StatusProjects, ",") {
+		project = strings.TrimSpace(project)
+		if project == "" {
+			continue
+		}
+		p := publicProject{Project: project}
+
+		if expose["agents"] {
+			members, err := s.projectAgents(ctx, project)
+			if err != nil {
+				return nil, err
+			}
+			p.Agents = []publicAgent{}
+			for _, inst := range members {
+				p.Agents = append(p.Agents, publicAgent{
+					Name: inst.Name, Role: inst.Role, Status: inst.Status, LastSeen: inst.LastSeen,
+				})
+			}
+		}
+
+		if expose["milestones"] && s.milestones != nil {
+			list, err := s.milestones.List(ctx, project)
+			if err != nil {
+				return nil, err
+			}
+			p.Milestones = []publicMilestone{}
+			for _, m := range list {
+				pr, err := s.milestones.Progress(ctx, m, false)
+				if err != nil {
+					continue
+				}
+				p.Milestones = append(p.Milestones, publicMilestone{
+					Name: m.Name, Due: m.Due, Completed: pr.Completed, Total: pr.Total,
+					Percent: pr.Percent, Overdue: pr.Overdue,
+				})
+			}
+		}
+
+		if expose["last_event"] {
+			recent, err := s.eventBus.History(ctx, statusEventWindow, strings.ToLower(project)+".*")
+			if err != nil {
+				return nil, err
+			}
+			if len(recent) > 0 {
+				p.LastEvent = &recent[0].CreatedAt
+			}
+		}
+		st.Projects = append(st.Projects, p)
+	}
+	return st, nil
+}
+
+func (s *Server) handleStatusPageJSON(w http.ResponseWriter, r *http.Request) {
+	st, err := s.publicStatus(r.Context())
+	if err != nil {
+		s.logger.Error("status page failed", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to build status")
+		return
+	}
+	writeJSON(w, http.StatusOK, st)
+}
+
+func (s *Server) handleStatusPage(w http.ResponseWriter, r *http.Request) {
+	st, err := s.publicStatus(r.Context())
+	if err != nil {
+		s.logger.Error("status page failed", "error", err)
+		http.Error(w, "status unavailable", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := dashboard.Templates.ExecuteTemplate(w, "status.html", st); err != nil {
+		s.logger.Error("render status page", "error", err)
+	}
+}
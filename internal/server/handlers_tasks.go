@@ -0,0 +1,277 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/DavidRHerbert/koor/internal/audit"
+	"github.com/DavidRHerbert/koor/internal/tasks"
+)
+
+// --- Task handlers ---
+
+// taskInstance returns the instance acting on a task: the X-Koor-Instance
+// header (set from the token when authenticated), else the body's
+// instance_id.
+func taskInstance(r *http.Request, bodyID string) string {
+	if id := r.Header.Get("X-Koor-Instance"); id != "" {
+		return id
+	}
+	return bodyID
+}
+
+// writeTaskError maps task store errors to HTTP statuses.
+func (s *Server) writeTaskError(w http.ResponseWriter, id, op string, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		writeError(w, http.StatusNotFound, "task not found: "+id)
+	case errors.Is(err, tasks.ErrNotClaimed):
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		s.logger.Error("task "+op+" failed", "id", id, "error", err)
+		writeError(w, http.StatusBadRequest, err.Error())
+	}
+}
+
+func (s *Server) handleTaskCreate(w http.ResponseWriter, r *http.Request) {
+	if s.tasks == nil {
+		writeError(w, http.StatusServiceUnavailable, "task queue not configured")
+		return
+	}
+	var req struct {
+		Project     string          `json:"project"`
+		Queue       string          `json:"queue"`
+		Title       string          `json:"title"`
+		Payload     json.RawMessage `json:"payload"`
+		Priority    int             `json:"priority"`
+		MaxAttempts int             `json:"max_attempts"`
+	}
+	if !s.decodeBody(w, r, &req) {
+		return
+	}
+	if id := identityFromRequest(r); id != nil && !id.OwnsProject(req.Project) {
+		writeError(w, http.StatusForbidden, "token "+id.Name+" is limited to project "+id.Project)
+		return
+	}
+	// Pin the payload's spec_ref, so the task is worked against the spec
+	// version current when it was assigned.
+	payload, err := s.specReg.PinPayloadRef(r.Context(), req.Payload)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	t, err := s.tasks.Create(r.Context(), tasks.Task{
+		Project:     req.Project,
+		Queue:       req.Queue,
+		Title:       req.Title,
+		Payload:     payload,
+		Priority:    req.Priority,
+		MaxAttempts: req.MaxAttempts,
+		CreatedBy:   actorFromRequest(r),
+	})
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.logger.Info("task created", "id", t.ID, "project", t.Project, "queue", t.Queue)
+	s.audit(r.Context(), actorFromRequest(r), "task.create", t.ID, audit.DetailJSON(map[string]any{
+		"project": t.Project, "queue": t.Queue, "title": t.Title, "priority": t.Priority,
+	}), "success")
+	writeJSON(w, http.StatusCreated, t)
+}
+
+func (s *Server) handleTaskList(w http.ResponseWriter, r *http.Request) {
+	if s.tasks == nil {
+		writeError(w, http.StatusServiceUnavailable, "task queue not configured")
+		return
+	}
+	q := r.URL.Query()
+	f := tasks.Filter{
+		Project:   q.Get("project"),
+		Queue:     q.Get("queue"),
+		Status:    q.Get("status"),
+		ClaimedBy: q.Get("claimed_by"),
+	}
+	if l := q.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "limit must be a non-negative integer")
+			return
+		}
+		f.Limit = n
+	}
+	list, err := s.tasks.List(r.Context(), f)
+	if err != nil {
+		s.logger.Error("task list failed", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to list tasks")
+		return
+	}
+	if list == nil {
+		list = []tasks.Task{}
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (s *Server) handleTaskGet(w http.ResponseWriter, r *http.Request) {
+	if s.tasks == nil {
+		writeError(w, http.StatusServiceUnavailable, "task queue not configured")
+		return
+	}
+	id := r.PathValue("id")
+	t, err := s.tasks.Get(r.Context(), id)
+	if err != nil {
+		s.writeTaskError(w, id, "get", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, t)
+}
+
+// handleTaskClaim hands the calling instance its next task. Without an
+// explicit queue the instance works its role's queue (see
+// tasks.DefaultQueue) and the project's shared "" queue. Responds 204 when
+// nothing is available.
+func (s *Server) handleTaskClaim(w http.ResponseWriter, r *http.Request) {
+	if s.tasks == nil {
+		writeError(w, http.StatusServiceUnavailable, "task queue not configured")
+		return
+	}
+	var req struct {
+		Project           string `json:"project"`
+		Queue             string `json:"queue"`
+		InstanceID        string `json:"instance_id"`
+		VisibilityTimeout string `json:"visibility_timeout"`
+	}
+	if !s.decodeBody(w, r, &req) {
+		return
+	}
+	if req.Project == "" {
+		s.rejectFields(w, "project is required", fieldError{Field: "project", Problem: "is required"})
+		return
+	}
+	if id := identityFromRequest(r); id != nil && !id.OwnsProject(req.Project) {
+		writeError(w, http.StatusForbidden, "token "+id.Name+" is limited to project "+id.Project)
+		return
+	}
+	instanceID := taskInstance(r, req.InstanceID)
+	if instanceID == "" {
+		writeError(w, http.StatusBadRequest, "instance_id or X-Koor-Instance is required")
+		return
+	}
+	inst, err := s.instanceReg.Get(r.Context(), instanceID)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "instance not found: "+instanceID)
+		return
+	}
+	var visibility time.Duration
+	if req.VisibilityTimeout != "" {
+		visibility, err = time.ParseDuration(req.VisibilityTimeout)
+		if err != nil || visibility <= 0 {
+			s.rejectFields(w, "visibility_timeout must be a positive duration, e.g. 15m",
+				fieldError{Field: "visibility_timeout", Problem: "must be a positive duration, e.g. 15m"})
+			return
+		}
+	}
+	queues := []string{req.Queue}
+	if req.Queue == "" {
+		if role := tasks.DefaultQueue(req.Project, inst.Name); role != "" {
+			queues = append(queues, role)
+		}
+	}
+
+	t, err := s.tasks.Claim(r.Context(), req.Project, queues, inst.ID, visibility)
+	if errors.Is(err, sql.ErrNoRows) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if err != nil {
+		s.logger.Error("task claim failed", "project", req.Project, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to claim task")
+		return
+	}
+	s.logger.Info("task claimed", "id", t.ID, "instance", inst.ID, "attempt", t.Attempts)
+	s.audit(r.Context(), actorFromRequest(r), "task.claim", t.ID, audit.DetailJSON(map[string]any{
+		"instance_id": inst.ID, "attempt": t.Attempts,
+	}), "success")
+	writeJSON(w, http.StatusOK, t)
+}
+
+func (s *Server) handleTaskComplete(w http.ResponseWriter, r *http.Request) {
+	if s.tasks == nil {
+		writeError(w, http.StatusServiceUnavailable, "task queue not configured")
+		return
+	}
+	var req struct {
+		InstanceID string          `json:"instance_id"`
+		Result     json.RawMessage `json:"result"`
+	}
+	if !s.decodeBody(w, r, &req) {
+		return
+	}
+	id := r.PathValue("id")
+	t, err := s.tasks.Complete(r.Context(), id, taskInstance(r, req.InstanceID), req.Result)
+	if err != nil {
+		s.writeTaskError(w, id, "complete", err)
+		return
+	}
+	s.logger.Info("task completed", "id", id, "instance", t.ClaimedBy)
+	s.audit(r.Context(), actorFromRequest(r), "task.complete", id, audit.DetailJSON(map[string]any{
+		"instance_id": t.ClaimedBy,
+	}), "success")
+	writeJSON(w, http.StatusOK, t)
+}
+
+func (s *Server) handleTaskFail(w http.ResponseWriter, r *http.Request) {
+	if s.tasks == nil {
+		writeError(w, http.StatusServiceUnavailable, "task queue not configured")
+		return
+	}
+	var req struct {
+		InstanceID string `json:"instance_id"`
+		Error      string `json:"error"`
+	}
+	if !s.decodeBody(w, r, &req) {
+		return
+	}
+	id := r.PathValue("id")
+	t, err := s.tasks.Fail(r.Context(), id, taskInstance(r, req.InstanceID), req.Error)
+	if err != nil {
+		s.writeTaskError(w, id, "fail", err)
+		return
+	}
+	s.logger.Info("task failed", "id", id, "status", t.Status, "attempts", t.Attempts)
+	s.audit(r.Context(), actorFromRequest(r), "task.fail", id, audit.DetailJSON(map[string]any{
+		"error": req.Error, "status": t.Status, "attempts": t.Attempts,
+	}), "success")
+	writeJSON(w, http.StatusOK, t)
+}
+
+func (s *Server) handleTaskRequeue(w http.ResponseWriter, r *http.Request) {
+	if s.tasks == nil {
+		writeError(w, http.StatusServiceUnavailable, "task queue not configured")
+		return
+	}
+	var req struct {
+		Queue    *string `json:"queue"`
+		Priority *int    `json:"priority"`
+	}
+	if r.ContentLength != 0 {
+		if !s.decodeBody(w, r, &req) {
+			return
+		}
+	}
+	id := r.PathValue("id")
+	t, err := s.tasks.Requeue(r.Context(), id, req.Queue, req.Priority)
+	if err != nil {
+		s.writeTaskError(w, id, "requeue", err)
+		return
+	}
+	s.logger.Info("task requeued", "id", id, "queue", t.Queue, "priority", t.Priority)
+	s.audit(r.Context(), actorFromRequest(r), "task.requeue", id, audit.DetailJSON(map[string]any{
+		"queue": t.Queue, "priority": t.Priority,
+	}), "success")
+	writeJSON(w, http.StatusOK, t)
+}
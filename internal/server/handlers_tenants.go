@@ -0,0 +1,198 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/DavidRHerbert/koor/internal/audit"
+	"github.com/DavidRHerbert/koor/internal/tenants"
+)
+
+// tenantHeader names the tenant a request is for.
+const tenantHeader = "X-Koor-Tenant"
+
+// --- Tenant dispatch ---
+
+// tenantDispatch hands requests for a tenant to that tenant's own stack,
+// which authenticates them against the tenant's tokens and users. Other
+// requests are the host's and go to next.
+func (s *Server) tenantDispatch(next http.Handler, handler func(*tenants.Stack) http.Handler) http.Handler {
+	if s.tenants == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := s.resolveTenant(r)
+		if id == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		st, err := s.tenants.Stack(r.Context(), id)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			writeError(w, http.StatusNotFound, "tenant not found: "+id)
+		case errors.Is(err, tenants.ErrSuspended):
+			writeError(w, http.StatusForbidden, "tenant "+id+" is suspended")
+		case err != nil:
+			s.logger.Error("tenant start failed", "tenant", id, "error", err)
+			writeError(w, http.StatusInternalServerError, "failed to start tenant "+id)
+		default:
+			handler(st).ServeHTTP(w, r)
+		}
+	})
+}
+
+// resolveTenant returns the tenant a request is for: the one named by the
+// X-Koor-Tenant header, else the one whose token, user or instance the
+// bearer token (or dashboard sign-in secret) is. "" means the host.
+func (s *Server) resolveTenant(r *http.Request) string {
+	if id := r.Header.Get(tenantHeader); id != "" {
+		return id
+	}
+	bearer, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if bearer == "" {
+		if c, err := r.Cookie(sessionCookie); err == nil {
+			bearer = c.Value
+		} else if r.Method == http.MethodPost && r.URL.Path == "/login" {
+			bearer = strings.TrimSpace(r.FormValue("secret"))
+		}
+	}
+	if bearer == "" || bearer == s.config.AuthToken || s.KnowsToken(r.Context(), bearer) {
+		return ""
+	}
+	return s.tenants.Owner(r.Context(), bearer)
+}
+
+// KnowsToken reports whether a bearer token is one of this server's API
+// tokens, users or instance registration tokens.
+func (s *Server) KnowsToken(ctx context.Context, bearer string) bool {
+	return s.resolveIdentity(ctx, bearer) != nil
+}
+
+// --- Tenant handlers ---
+
+func (s *Server) handleTenantCreate(w http.ResponseWriter, r *http.Request) {
+	if s.tenants == nil {
+		writeError(w, http.StatusServiceUnavailable, "tenants not configured")
+		return
+	}
+	var req tenants.Tenant
+	if !s.decodeBody(w, r, &req) {
+		return
+	}
+	if err := tenants.Validate(&req); err != nil {
+		s.rejectFields(w, err.Error(), fieldError{Field: "id", Problem: err.Error()})
+		return
+	}
+	t, st, err := s.tenants.Create(r.Context(), req)
+	if errors.Is(err, tenants.ErrExists) {
+		writeError(w, http.StatusConflict, "tenant already exists: "+req.ID)
+		return
+	}
+	if err != nil {
+		s.logger.Error("tenant create failed", "tenant", req.ID, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to create tenant")
+		return
+	}
+	s.logger.Info("tenant created", "tenant", t.ID, "name", t.Name)
+	s.audit(r.Context(), actorFromRequest(r), "tenant.create", t.ID, audit.DetailJSON(map[string]any{
+		"name": t.Name,
+	}), "success")
+	resp := map[string]any{"tenant": t, "data_dir": s.tenants.Dir(t.ID)}
+	if st.AdminSecret != "" {
+		resp["admin_secret"] = st.AdminSecret
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleTenantList(w http.ResponseWriter, r *http.Request) {
+	if s.tenants == nil {
+		writeError(w, http.StatusServiceUnavailable, "tenants not configured")
+		return
+	}
+	list, err := s.tenants.List(r.Context())
+	if err != nil {
+		s.logger.Error("tenant list failed", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to list tenants")
+		return
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (s *Server) handleTenantGet(w http.ResponseWriter, r *http.Request) {
+	if s.tenants == nil {
+		writeError(w, http.StatusServiceUnavailable, "tenants not configured")
+		return
+	}
+	id := r.PathValue("id")
+	t, err := s.tenants.Get(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "tenant not found: "+id)
+		return
+	}
+	if err != nil {
+		s.logger.Error("tenant get failed", "tenant", id, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to get tenant")
+		return
+	}
+	writeJSON(w, http.StatusOK, t)
+}
+
+// handleTenantSuspend stops a tenant's stack and refuses its requests until
+// it is resumed. Its data is kept.
+func (s *Server) handleTenantSuspend(w http.ResponseWriter, r *http.Request) {
+	s.setTenantStatus(w, r, tenants.StatusSuspended, "tenant.suspend")
+}
+
+func (s *Server) handleTenantResume(w http.ResponseWriter, r *http.Request) {
+	s.setTenantStatus(w, r, tenants.StatusActive, "tenant.resume")
+}
+
+func (s *Server) setTenantStatus(w http.ResponseWriter, r *http.Request, status, action string) {
+	if s.tenants == nil {
+		writeError(w, http.StatusServiceUnavailable, "tenants not configured")
+		return
+	}
+	id := r.PathValue("id")
+	t, err := s.tenants.SetStatus(r.Context(), id, status)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "tenant not found: "+id)
+		return
+	}
+	if err != nil {
+		s.logger.Error("tenant status change failed", "tenant", id, "status", status, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to update tenant")
+		return
+	}
+	s.logger.Info("tenant "+status, "tenant", id)
+	s.audit(r.Context(), actorFromRequest(r), action, id, "{}", "success")
+	writeJSON(w, http.StatusOK, t)
+}
+
+// handleTenantDelete removes a tenant. Its data directory is kept unless
+// ?purge=1, so a tenant created again with the same ID gets its data back.
+func (s *Server) handleTenantDelete(w http.ResponseWriter, r *http.Request) {
+	if s.tenants == nil {
+		writeError(w, http.StatusServiceUnavailable, "tenants not configured")
+		return
+	}
+	id := r.PathValue("id")
+	purge := r.URL.Query().Get("purge") == "1" || r.URL.Query().Get("purge") == "true"
+	err := s.tenants.Delete(r.Context(), id, purge)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "tenant not found: "+id)
+		return
+	}
+	if err != nil {
+		s.logger.Error("tenant delete failed", "tenant", id, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to delete tenant")
+		return
+	}
+	s.logger.Info("tenant deleted", "tenant", id, "purged", purge)
+	s.audit(r.Context(), actorFromRequest(r), "tenant.delete", id, audit.DetailJSON(map[string]any{
+		"purged": purge,
+	}), "success")
+	writeJSON(w, http.StatusOK, map[string]any{"deleted": id, "purged": purge})
+}
@@ -0,0 +1,211 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DavidRHerbert/koor/internal/audit"
+	"github.com/DavidRHerbert/koor/internal/tokens"
+)
+
+// --- Token handlers ---
+
+func (s *Server) handleTokenCreate(w http.ResponseWriter, r *http.Request) {
+	if s.tokens == nil {
+		writeError(w, http.StatusServiceUnavailable, "tokens not configured")
+		return
+	}
+	var req struct {
+		Name       string           `json:"name"`
+		InstanceID string           `json:"instance_id"`
+		Project    string           `json:"project"`
+		Scopes     []string         `json:"scopes"`
+		ExpiresIn  string           `json:"expires_in"`
+		Topics     *tokens.TopicACL `json:"topics"`
+	}
+	if !s.decodeBody(w, r, &req) {
+		return
+	}
+	t := tokens.Token{Name: req.Name, InstanceID: req.InstanceID, Project: req.Project, Scopes: req.Scopes, Topics: req.Topics}
+	if req.InstanceID != "" {
+		inst, err := s.instanceReg.Get(r.Context(), req.InstanceID)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "instance not found: "+req.InstanceID)
+			return
+		}
+		if len(t.Scopes) == 0 {
+			t.Scopes = tokens.DefaultInstanceScopes
+		}
+		// A token bound to a project's instance belongs to that project.
+		if t.Project == "" {
+			t.Project = inst.Project
+		} else if inst.Project != "" && inst.Project != t.Project {
+			writeError(w, http.StatusBadRequest, "instance "+inst.ID+" belongs to project "+inst.Project)
+			return
+		}
+	}
+	if t.Project != "" && !s.projectRegistered(w, r, t.Project) {
+		return
+	}
+	if req.ExpiresIn != "" {
+		d, err := time.ParseDuration(req.ExpiresIn)
+		if err != nil || d <= 0 {
+			writeError(w, http.StatusBadRequest, "expires_in must be a positive duration, e.g. 720h")
+			return
+		}
+		exp := time.Now().UTC().Add(d).Truncate(time.Second)
+		t.ExpiresAt = &exp
+	}
+	for _, scope := range t.Scopes {
+		if err := tokens.ValidateScope(scope); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	created, secret, err := s.tokens.Create(r.Context(), t)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.logger.Info("token created", "id", created.ID, "name", created.Name, "instance", created.InstanceID, "project", created.Project)
+	s.audit(r.Context(), actorFromRequest(r), "token.create", created.ID, audit.DetailJSON(map[string]any{
+		"name": created.Name, "instance_id": created.InstanceID, "project": created.Project, "scopes": created.Scopes, "topics": created.Topics,
+	}), "success")
+	writeJSON(w, http.StatusOK, map[string]any{"token": secret, "info": created})
+}
+
+func (s *Server) handleTokenList(w http.ResponseWriter, r *http.Request) {
+	if s.tokens == nil {
+		writeError(w, http.StatusServiceUnavailable, "tokens not configured")
+		return
+	}
+	list, err := s.tokens.List(r.Context(), r.URL.Query().Get("instance_id"))
+	if err != nil {
+		s.logger.Error("token list failed", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to list tokens")
+		return
+	}
+	if list == nil {
+		list = []tokens.Token{}
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (s *Server) handleTokenRevoke(w http.ResponseWriter, r *http.Request) {
+	if s.tokens == nil {
+		writeError(w, http.StatusServiceUnavailable, "tokens not configured")
+		return
+	}
+	id := r.PathValue("id")
+	err := s.tokens.Revoke(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "token not found: "+id)
+		return
+	}
+	if err != nil {
+		s.logger.Error("token revoke failed", "id", id, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to revoke token")
+		return
+	}
+	s.logger.Info("token revoked", "id", id)
+	s.audit(r.Context(), actorFromRequest(r), "token.revoke", id, "{}", "success")
+	writeJSON(w, http.StatusOK, map[string]any{"deleted": id})
+}
+
+func (s *Server) handleTokenRotate(w http.ResponseWriter, r *http.Request) {
+	if s.tokens == nil {
+		writeError(w, http.StatusServiceUnavailable, "tokens not configured")
+		return
+	}
+	id := r.PathValue("id")
+	var req struct {
+		Grace string `json:"grace"`
+	}
+	if r.ContentLength != 0 {
+		if !s.decodeBody(w, r, &req) {
+			return
+		}
+	}
+	grace, ok := parseGrace(w, req.Grace)
+	if !ok {
+		return
+	}
+	t, secret, err := s.tokens.Rotate(r.Context(), id, grace)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "token not found: "+id)
+		return
+	}
+	if err != nil {
+		s.logger.Error("token rotate failed", "id", id, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to rotate token")
+		return
+	}
+	actor := actorFromRequest(r)
+	s.logger.Info("token rotated", "id", id, "grace", grace)
+	s.audit(r.Context(), actor, "token.rotate", id, audit.DetailJSON(map[string]any{
+		"name": t.Name, "grace": grace.String(),
+	}), "success")
+	s.publishRotation(r.Context(), "token.rotated", id, t.PreviousValidUntil, actor)
+	writeJSON(w, http.StatusOK, map[string]any{"token": secret, "info": t})
+}
+
+// handleTokenTopics replaces a token's topic ACL. A body without allow or
+// deny patterns removes it, so the token sees every topic again.
+func (s *Server) handleTokenTopics(w http.ResponseWriter, r *http.Request) {
+	if s.tokens == nil {
+		writeError(w, http.StatusServiceUnavailable, "tokens not configured")
+		return
+	}
+	id := r.PathValue("id")
+	var acl tokens.TopicACL
+	if !s.decodeBody(w, r, &acl) {
+		return
+	}
+	var fields []fieldError
+	for name, patterns := range map[string][]string{"allow": acl.Allow, "deny": acl.Deny} {
+		for i, p := range patterns {
+			if strings.TrimSpace(p) == "" {
+				fields = append(fields, fieldError{Field: name + "[" + strconv.Itoa(i) + "]", Problem: "must not be empty"})
+			}
+		}
+	}
+	if len(fields) > 0 {
+		sort.Slice(fields, func(i, j int) bool { return fields[i].Field < fields[j].Field })
+		s.rejectFields(w, "topic patterns must not be empty", fields...)
+		return
+	}
+	t, err := s.tokens.SetTopics(r.Context(), id, &acl)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "token not found: "+id)
+		return
+	}
+	if err != nil {
+		s.logger.Error("token topics update failed", "id", id, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to update token topics")
+		return
+	}
+	s.logger.Info("token topics updated", "id", id, "allow", acl.Allow, "deny", acl.Deny)
+	s.audit(r.Context(), actorFromRequest(r), "token.topics", id, audit.DetailJSON(map[string]any{
+		"allow": acl.Allow, "deny": acl.Deny,
+	}), "success")
+	writeJSON(w, http.StatusOK, t)
+}
+
+// handleTokenWhoami reports the identity and scopes of the calling token.
+func (s *Server) handleTokenWhoami(w http.ResponseWriter, r *http.Request) {
+	if id := identityFromRequest(r); id != nil {
+		writeJSON(w, http.StatusOK, id)
+		return
+	}
+	name := "local"
+	if s.config.AuthToken != "" {
+		name = "global"
+	}
+	writeJSON(w, http.StatusOK, tokens.Identity{Name: name, Scopes: []string{tokens.ScopeAdmin}})
+}
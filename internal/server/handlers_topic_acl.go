@@ -0,0 +1,51 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/DavidRHerbert/koor/internal/audit"
+	"github.com/DavidRHerbert/koor/internal/events"
+)
+
+// --- Event topic ACLs ---
+
+// subscribeAccess wraps the event subscription handler: a token's topic
+// ACL decides which events reach the connection, and subscriptions to
+// wildcard patterns are audited as events.subscribe, so it is on record
+// who listens to everything.
+func (s *Server) subscribeAccess(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actor := actorFromRequest(r)
+		access := events.Access{
+			OnSubscribe: func(pattern string, multiplex bool) {
+				if !strings.ContainsAny(pattern, "*?[") {
+					return
+				}
+				s.audit(context.WithoutCancel(r.Context()), actor, "events.subscribe", pattern, audit.DetailJSON(map[string]any{
+					"multiplex": multiplex, "remote": r.RemoteAddr,
+				}), "success")
+			},
+		}
+		if id := identityFromRequest(r); id != nil && id.Topics != nil {
+			access.Allow = id.CanSeeTopic
+		}
+		next.ServeHTTP(w, r.WithContext(events.WithAccess(r.Context(), access)))
+	})
+}
+
+// visibleEvents drops the events the caller's project or topic ACL hides.
+func visibleEvents(r *http.Request, list []events.Event) []events.Event {
+	id := identityFromRequest(r)
+	if id == nil || id.Topics == nil && id.CrossProject() {
+		return list
+	}
+	visible := make([]events.Event, 0, len(list))
+	for _, ev := range list {
+		if id.CanSeeTopic(ev.Topic) {
+			visible = append(visible, ev)
+		}
+	}
+	return visible
+}
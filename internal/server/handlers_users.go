@@ -0,0 +1,206 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/DavidRHerbert/koor/internal/audit"
+	"github.com/DavidRHerbert/koor/internal/dashboard"
+	"github.com/DavidRHerbert/koor/internal/users"
+)
+
+// --- User handlers ---
+
+func (s *Server) handleUserList(w http.ResponseWriter, r *http.Request) {
+	if s.users == nil {
+		writeError(w, http.StatusServiceUnavailable, "users not configured")
+		return
+	}
+	list, err := s.users.List(r.Context())
+	if err != nil {
+		s.logger.Error("user list failed", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to list users")
+		return
+	}
+	if list == nil {
+		list = []users.User{}
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (s *Server) handleUserCreate(w http.ResponseWriter, r *http.Request) {
+	if s.users == nil {
+		writeError(w, http.StatusServiceUnavailable, "users not configured")
+		return
+	}
+	var req struct {
+		Name string `json:"name"`
+		Role string `json:"role"`
+	}
+	if !s.decodeBody(w, r, &req) {
+		return
+	}
+	u, secret, err := s.users.Create(r.Context(), req.Name, req.Role)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.logger.Info("user created", "name", u.Name, "role", u.Role)
+	s.audit(r.Context(), actorFromRequest(r), "user.create", u.Name, audit.DetailJSON(map[string]any{"role": u.Role}), "success")
+	writeJSON(w, http.StatusOK, map[string]any{"secret": secret, "user": u})
+}
+
+func (s *Server) handleUserSetRole(w http.ResponseWriter, r *http.Request) {
+	if s.users == nil {
+		writeError(w, http.StatusServiceUnavailable, "users not configured")
+		return
+	}
+	name := r.PathValue("name")
+	var req struct {
+		Role string `json:"role"`
+	}
+	if !s.decodeBody(w, r, &req) {
+		return
+	}
+	if err := users.ValidateRole(req.Role); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	u, err := s.users.SetRole(r.Context(), name, req.Role)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "user not found: "+name)
+		return
+	}
+	if errors.Is(err, users.ErrLastAdmin) {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		s.logger.Error("user role change failed", "name", name, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to change role")
+		return
+	}
+	s.logger.Info("user role changed", "name", name, "role", u.Role)
+	s.audit(r.Context(), actorFromRequest(r), "user.set_role", name, audit.DetailJSON(map[string]any{"role": u.Role}), "success")
+	writeJSON(w, http.StatusOK, u)
+}
+
+func (s *Server) handleUserReset(w http.ResponseWriter, r *http.Request) {
+	if s.users == nil {
+		writeError(w, http.StatusServiceUnavailable, "users not configured")
+		return
+	}
+	name := r.PathValue("name")
+	secret, err := s.users.Reset(r.Context(), name)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "user not found: "+name)
+		return
+	}
+	if err != nil {
+		s.logger.Error("user reset failed", "name", name, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to reset user")
+		return
+	}
+	s.logger.Info("user secret reset", "name", name)
+	s.audit(r.Context(), actorFromRequest(r), "user.reset", name, "{}", "success")
+	writeJSON(w, http.StatusOK, map[string]any{"name": name, "secret": secret})
+}
+
+func (s *Server) handleUserDelete(w http.ResponseWriter, r *http.Request) {
+	if s.users == nil {
+		writeError(w, http.StatusServiceUnavailable, "users not configured")
+		return
+	}
+	name := r.PathValue("name")
+	err := s.users.Delete(r.Context(), name)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "user not found: "+name)
+		return
+	}
+	if errors.Is(err, users.ErrLastAdmin) {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		s.logger.Error("user delete failed", "name", name, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to delete user")
+		return
+	}
+	s.logger.Info("user deleted", "name", name)
+	s.audit(r.Context(), actorFromRequest(r), "user.delete", name, "{}", "success")
+	writeJSON(w, http.StatusOK, map[string]any{"deleted": name})
+}
+
+// --- Dashboard sign-in ---
+
+const sessionCookie = "koor_session"
+
+// dashboardAuth applies the API's authentication and role checks to the
+// dashboard. A browser signs in at /login with a user secret (or any other
+// bearer token), which is kept in a cookie and presented as the bearer
+// token of each later request. Pages redirect to /login when a sign-in is
+// required; static assets are always served.
+func (s *Server) dashboardAuth(next http.Handler) http.Handler {
+	guarded := s.authMiddleware(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c, err := r.Cookie(sessionCookie); err == nil && r.Header.Get("Authorization") == "" {
+			r.Header.Set("Authorization", "Bearer "+c.Value)
+		}
+		path := r.URL.Path
+		switch {
+		case path == "/health" || path == "/login" || path == "/logout":
+			next.ServeHTTP(w, r)
+		case r.Method == http.MethodGet && (strings.HasSuffix(path, ".js") || strings.HasSuffix(path, ".css")):
+			next.ServeHTTP(w, r)
+		case r.Method == http.MethodGet && !strings.HasPrefix(path, "/api/") && !s.signedIn(r):
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+		default:
+			guarded.ServeHTTP(w, r)
+		}
+	})
+}
+
+// signedIn reports whether the request's bearer token is accepted, or none
+// is needed (local mode).
+func (s *Server) signedIn(r *http.Request) bool {
+	bearer, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if bearer == "" {
+		return s.config.AuthToken == ""
+	}
+	return bearer == s.config.AuthToken || s.resolveIdentity(r.Context(), bearer) != nil
+}
+
+func (s *Server) renderLogin(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := dashboard.Templates.ExecuteTemplate(w, "login.html", struct{ Error string }{msg}); err != nil {
+		s.logger.Error("render login page", "error", err)
+	}
+}
+
+func (s *Server) handleDashboardLoginPage(w http.ResponseWriter, r *http.Request) {
+	s.renderLogin(w, http.StatusOK, "")
+}
+
+// handleDashboardLogin checks the submitted secret and stores it in the
+// session cookie.
+func (s *Server) handleDashboardLogin(w http.ResponseWriter, r *http.Request) {
+	secret := strings.TrimSpace(r.FormValue("secret"))
+	r.Header.Set("Authorization", "Bearer "+secret)
+	if secret == "" || !s.signedIn(r) {
+		s.renderLogin(w, http.StatusUnauthorized, "Unknown secret.")
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name: sessionCookie, Value: secret, Path: "/",
+		HttpOnly: true, SameSite: http.SameSiteStrictMode,
+	})
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+func (s *Server) handleDashboardLogout(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Path: "/", MaxAge: -1})
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
@@ -0,0 +1,280 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DavidRHerbert/koor/internal/audit"
+	"github.com/DavidRHerbert/koor/internal/webhooks"
+)
+
+// --- Webhook update, replay and secret rotation handlers ---
+
+// handleWebhookUpdate changes a webhook's url, patterns, active flag or
+// transform; fields left out of the body are kept.
+func (s *Server) handleWebhookUpdate(w http.ResponseWriter, r *http.Request) {
+	if s.webhookDisp == nil {
+		writeError(w, http.StatusServiceUnavailable, "webhooks not configured")
+		return
+	}
+	id := r.PathValue("id")
+	var req webhooks.Update
+	if !s.decodeBody(w, r, &req) {
+		return
+	}
+	if req.URL != nil && *req.URL == "" {
+		s.rejectFields(w, "url must not be empty", fieldError{Field: "url", Problem: "must not be empty"})
+		return
+	}
+	if req.Transform != nil && !s.checkTransform(w, *req.Transform) {
+		return
+	}
+	if id := identityFromRequest(r); id != nil && req.Patterns != nil && !ownsPatterns(id, *req.Patterns) {
+		writeError(w, http.StatusForbidden, "token "+id.Name+" may only watch "+strings.ToLower(id.Project)+".* topics")
+		return
+	}
+
+	wh, err := s.webhookDisp.Update(r.Context(), id, req)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "webhook not found: "+id)
+		return
+	}
+	if err != nil {
+		s.logger.Error("webhook update failed", "id", id, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to update webhook")
+		return
+	}
+	s.logger.Info("webhook updated", "id", id)
+	s.audit(r.Context(), actorFromRequest(r), "webhook.update", id, audit.DetailJSON(map[string]any{
+		"url": wh.URL, "patterns": wh.Patterns, "active": wh.Active, "transform": wh.Transform,
+	}), "success")
+	writeJSON(w, http.StatusOK, wh)
+}
+
+// checkTransform rejects a webhook transform that is neither a preset nor
+// a template producing JSON, and reports whether it was accepted.
+func (s *Server) checkTransform(w http.ResponseWriter, transform string) bool {
+	if transform == "" {
+		return true
+	}
+	if err := webhooks.CheckTransform(transform); err != nil {
+		s.rejectFields(w, "invalid transform: "+err.Error(), fieldError{
+			Field:   "transform",
+			Problem: "must be a preset (" + strings.Join(webhooks.PresetNames(), ", ") + ") or a template producing JSON",
+		})
+		return false
+	}
+	return true
+}
+
+func (s *Server) handleWebhookReplay(w http.ResponseWriter, r *http.Request) {
+	if s.webhookDisp == nil {
+		writeError(w, http.StatusServiceUnavailable, "webhooks not configured")
+		return
+	}
+	id := r.PathValue("id")
+	var req struct {
+		EventID int64 `json:"event_id"`
+		FromID  int64 `json:"from_id"`
+		ToID    int64 `json:"to_id"`
+	}
+	if !s.decodeBody(w, r, &req) {
+		return
+	}
+	switch {
+	case req.EventID > 0 && (req.FromID > 0 || req.ToID > 0):
+		s.rejectFields(w, "use either event_id or from_id/to_id, not both",
+			fieldError{Field: "event_id", Problem: "cannot be combined with from_id/to_id"})
+		return
+	case req.EventID > 0:
+		req.FromID, req.ToID = req.EventID, req.EventID
+	case req.FromID <= 0:
+		s.rejectFields(w, "event_id or from_id is required",
+			fieldError{Field: "from_id", Problem: "event_id or from_id is required"})
+		return
+	case req.ToID > 0 && req.ToID < req.FromID:
+		s.rejectFields(w, "to_id must not be less than from_id",
+			fieldError{Field: "to_id", Problem: "must not be less than from_id"})
+		return
+	}
+
+	res, err := s.webhookDisp.Replay(r.Context(), id, req.FromID, req.ToID)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "webhook not found: "+id)
+		return
+	}
+	if err != nil {
+		s.logger.Error("webhook replay failed", "id", id, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to replay events")
+		return
+	}
+	s.logger.Info("webhook replayed", "id", id, "from_id", req.FromID, "to_id", req.ToID, "delivered", res.Delivered, "failed", len(res.Failed))
+	s.audit(r.Context(), actorFromRequest(r), "webhook.replay", id, audit.DetailJSON(map[string]any{
+		"from_id": req.FromID, "to_id": req.ToID, "delivered": res.Delivered, "failed": len(res.Failed),
+	}), "success")
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (s *Server) handleWebhookRotateSecret(w http.ResponseWriter, r *http.Request) {
+	if s.webhookDisp == nil {
+		writeError(w, http.StatusServiceUnavailable, "webhooks not configured")
+		return
+	}
+	id := r.PathValue("id")
+	var req struct {
+		Secret string `json:"secret"`
+		Grace  string `json:"grace"`
+	}
+	if !s.decodeBody(w, r, &req) {
+		return
+	}
+	grace, ok := parseGrace(w, req.Grace)
+	if !ok {
+		return
+	}
+	if req.Secret == "" {
+		secret, err := webhooks.GenerateSecret()
+		if err != nil {
+			s.logger.Error("webhook secret rotation failed", "id", id, "error", err)
+			writeError(w, http.StatusInternalServerError, "failed to generate secret")
+			return
+		}
+		req.Secret = secret
+	}
+
+	wh, err := s.webhookDisp.RotateSecret(r.Context(), id, req.Secret, grace)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "webhook not found: "+id)
+		return
+	}
+	if err != nil {
+		s.logger.Error("webhook secret rotation failed", "id", id, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to rotate webhook secret")
+		return
+	}
+	actor := actorFromRequest(r)
+	s.logger.Info("webhook secret rotated", "id", id, "grace", grace)
+	s.audit(r.Context(), actor, "webhook.rotate_secret", id, audit.DetailJSON(map[string]any{
+		"grace": grace.String(),
+	}), "success")
+	s.publishRotation(r.Context(), "webhook.secret_rotated", id, wh.PreviousSecretUntil, actor)
+	writeJSON(w, http.StatusOK, wh)
+}
+
+// parseGrace reads a rotation's overlap window, 24h by default. It writes
+// a 400 and returns false if the value is not a duration.
+func parseGrace(w http.ResponseWriter, v string) (time.Duration, bool) {
+	if v == "" {
+		return 24 * time.Hour, true
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		writeError(w, http.StatusBadRequest, "grace must be a duration like 24h")
+		return 0, false
+	}
+	return d, true
+}
+
+// --- Webhook delivery log handlers ---
+
+func (s *Server) handleWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	if s.webhookDisp == nil {
+		writeError(w, http.StatusServiceUnavailable, "webhooks not configured")
+		return
+	}
+	id := r.PathValue("id")
+	q := r.URL.Query()
+	f := webhooks.DeliveryFilter{Status: q.Get("status")}
+	if v := q.Get("event_id"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, "event_id must be a positive integer")
+			return
+		}
+		f.EventID = n
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		f.Limit = n
+	}
+	switch f.Status {
+	case "", "success", "failed", "retrying":
+	default:
+		writeError(w, http.StatusBadRequest, "status must be success, failed or retrying")
+		return
+	}
+
+	if _, err := s.webhookDisp.Get(r.Context(), id); errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "webhook not found: "+id)
+		return
+	}
+	dels, err := s.webhookDisp.Deliveries(r.Context(), id, f)
+	if err != nil {
+		s.logger.Error("webhook deliveries failed", "id", id, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to list deliveries")
+		return
+	}
+	if dels == nil {
+		dels = []webhooks.Delivery{}
+	}
+	writeJSON(w, http.StatusOK, dels)
+}
+
+func (s *Server) handleWebhookDeadLetters(w http.ResponseWriter, r *http.Request) {
+	if s.webhookDisp == nil {
+		writeError(w, http.StatusServiceUnavailable, "webhooks not configured")
+		return
+	}
+	id := r.PathValue("id")
+	if _, err := s.webhookDisp.Get(r.Context(), id); errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "webhook not found: "+id)
+		return
+	}
+	dls, err := s.webhookDisp.DeadLetters(r.Context(), id)
+	if err != nil {
+		s.logger.Error("webhook dead letters failed", "id", id, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to list dead letters")
+		return
+	}
+	if dls == nil {
+		dls = []webhooks.DeadLetter{}
+	}
+	writeJSON(w, http.StatusOK, dls)
+}
+
+func (s *Server) handleWebhookRedeliver(w http.ResponseWriter, r *http.Request) {
+	if s.webhookDisp == nil {
+		writeError(w, http.StatusServiceUnavailable, "webhooks not configured")
+		return
+	}
+	id := r.PathValue("id")
+	n, err := strconv.ParseInt(r.PathValue("n"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid delivery id")
+		return
+	}
+
+	del, err := s.webhookDisp.Redeliver(r.Context(), id, n)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "delivery not found: "+r.PathValue("n"))
+		return
+	}
+	if err != nil {
+		s.logger.Error("webhook redeliver failed", "id", id, "delivery", n, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to redeliver")
+		return
+	}
+	s.logger.Info("webhook redelivered", "id", id, "delivery", n, "success", del.Success)
+	s.audit(r.Context(), actorFromRequest(r), "webhook.redeliver", id, audit.DetailJSON(map[string]any{
+		"delivery_id": n, "event_id": del.EventID, "success": del.Success,
+	}), "success")
+	writeJSON(w, http.StatusOK, del)
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// --- MCP data tools ---
+
+// mcpDataKey marks API requests made on behalf of an MCP data tool, so
+// countREST leaves them to the MCP counters.
+const mcpDataKey ctxKey = "mcp-data"
+
+// mcpDataToolHost is implemented by an MCP handler that can offer data
+// tools (publish_event, get_state, set_state) backed by the REST API.
+type mcpDataToolHost interface {
+	EnableDataTools(api http.Handler)
+}
+
+// mcpDataAPI returns the handler MCP data tools call. It is the full API,
+// authentication included, so a tool call is checked, validated, audited
+// and published exactly like the REST call it stands for. Each call counts
+// as an MCP data call rather than a REST call.
+func (s *Server) mcpDataAPI() http.Handler {
+	var once sync.Once
+	var api http.Handler
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		once.Do(func() { api = s.Handler() })
+		s.mcpData.Add(1)
+		api.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), mcpDataKey, true)))
+	})
+}
+
+// --- MCP resources ---
+
+// mcpResourceHost is implemented by an MCP handler that can offer specs,
+// contracts and state keys as resources, read through the REST API.
+type mcpResourceHost interface {
+	EnableResources(api http.Handler, statePrefixes []string)
+	ResourceUpdated(uri string)
+	StateResourceExposed(key string) bool
+}
+
+// parseResourcePrefixes parses Config.MCPStateResources: comma-separated
+// state key prefixes, a trailing "*" ignored, with "*" alone for every key.
+func parseResourcePrefixes(cfg string) []string {
+	var prefixes []string
+	for _, entry := range strings.Split(cfg, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		prefixes = append(prefixes, strings.TrimSuffix(entry, "*"))
+	}
+	return prefixes
+}
+
+// notifySpecResource tells MCP clients that a spec, and the contract it may
+// be, changed.
+func (s *Server) notifySpecResource(project, name string) {
+	if s.mcpResources == nil {
+		return
+	}
+	path := url.PathEscape(project) + "/" + url.PathEscape(name)
+	s.mcpResources.ResourceUpdated("koor://specs/" + path)
+	s.mcpResources.ResourceUpdated("koor://contracts/" + path)
+}
+
+// notifyStateResource tells MCP clients that a state key exposed as a
+// resource changed.
+func (s *Server) notifyStateResource(key string) {
+	if s.mcpResources == nil || !s.mcpResources.StateResourceExposed(key) {
+		return
+	}
+	s.mcpResources.ResourceUpdated("koor://state/" + key)
+}
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/DavidRHerbert/koor/internal/audit"
+	"github.com/DavidRHerbert/koor/internal/observability"
+)
+
+// --- Token tax counter persistence ---
+
+// Names of the token tax counters saved in the observability store.
+const (
+	counterMCPCalls     = "mcp_calls"
+	counterMCPDataCalls = "mcp_data_calls"
+	counterRESTCalls    = "rest_calls"
+)
+
+// loadCounters adds the counters saved in the observability store to the
+// in-memory ones, so savings reports survive a restart.
+func (s *Server) loadCounters() {
+	if s.metricsStore == nil {
+		return
+	}
+	saved, err := s.metricsStore.LoadCounters(context.Background())
+	if err != nil {
+		s.logger.Error("load token tax counters", "error", err)
+		return
+	}
+	s.mcpCalls.Add(saved[counterMCPCalls])
+	s.mcpData.Add(saved[counterMCPDataCalls])
+	s.restCalls.Add(saved[counterRESTCalls])
+}
+
+// FlushCounters saves the token tax counters to the observability store.
+func (s *Server) FlushCounters(ctx context.Context) error {
+	if s.metricsStore == nil {
+		return nil
+	}
+	s.counterMu.Lock()
+	defer s.counterMu.Unlock()
+	return s.metricsStore.SaveCounters(ctx, map[string]int64{
+		counterMCPCalls:     s.mcpCalls.Load(),
+		counterMCPDataCalls: s.mcpData.Load(),
+		counterRESTCalls:    s.restCalls.Load(),
+	})
+}
+
+// StartCounterFlush saves the token tax counters every interval until
+// StopCounterFlush is called.
+func (s *Server) StartCounterFlush(interval time.Duration) {
+	s.stopFlush = make(chan struct{})
+	s.flushDone = make(chan struct{})
+	go func() {
+		defer close(s.flushDone)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := s.FlushCounters(context.Background()); err != nil {
+					s.logger.Error("flush token tax counters", "error", err)
+				}
+			case <-s.stopFlush:
+				return
+			}
+		}
+	}()
+}
+
+// StopCounterFlush stops the flush loop and saves the counters one last
+// time.
+func (s *Server) StopCounterFlush() {
+	if s.stopFlush == nil {
+		return
+	}
+	close(s.stopFlush)
+	<-s.flushDone
+	if err := s.FlushCounters(context.Background()); err != nil {
+		s.logger.Error("flush token tax counters", "error", err)
+	}
+}
+
+// handleMetricsReset clears the token tax counters and records the values
+// they held in the reset history.
+func (s *Server) handleMetricsReset(w http.ResponseWriter, r *http.Request) {
+	s.counterMu.Lock()
+	cleared := observability.Reset{
+		Actor:        actorFromRequest(r),
+		MCPCalls:     s.mcpCalls.Swap(0),
+		MCPDataCalls: s.mcpData.Swap(0),
+		RESTCalls:    s.restCalls.Swap(0),
+	}
+	reset := &cleared
+	var err error
+	if s.metricsStore != nil {
+		reset, err = s.metricsStore.RecordReset(r.Context(), cleared)
+	}
+	s.counterMu.Unlock()
+	if err != nil {
+		s.logger.Error("record metrics reset failed", "error", err)
+		writeError(w, http.StatusInternalServerError, "counters cleared but the reset was not recorded")
+		return
+	}
+
+	s.logger.Info("metrics reset", "actor", cleared.Actor, "mcp_calls", cleared.MCPCalls, "rest_calls", cleared.RESTCalls)
+	s.audit(r.Context(), cleared.Actor, "metrics.reset", "token_tax", audit.DetailJSON(map[string]any{
+		"mcp_calls": cleared.MCPCalls, "mcp_data_calls": cleared.MCPDataCalls, "rest_calls": cleared.RESTCalls,
+	}), "success")
+	writeJSON(w, http.StatusOK, map[string]any{"reset": true, "cleared": reset})
+}
+
+// handleMetricsResets lists the token tax counter resets, newest first.
+func (s *Server) handleMetricsResets(w http.ResponseWriter, r *http.Request) {
+	if s.metricsStore == nil {
+		writeError(w, http.StatusServiceUnavailable, "observability not configured")
+		return
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	resets, err := s.metricsStore.Resets(r.Context(), limit)
+	if err != nil {
+		s.logger.Error("list metrics resets failed", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to list resets")
+		return
+	}
+	writeJSON(w, http.StatusOK, resets)
+}
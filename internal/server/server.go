@@ -8,9 +8,12 @@ import (
 	"io"
 	"log/slog"
 	"net/http"
+	"slices"
+	"sync"
 	"sync/atomic"
 	"time"
 
+	"encoding/csv"
 	"encoding/json"
 	"strconv"
 	"strings"
@@ -19,14 +22,31 @@ import (
 	"github.com/DavidRHerbert/koor/internal/compliance"
 	"github.com/DavidRHerbert/koor/internal/contracts"
 	"github.com/DavidRHerbert/koor/internal/dashboard"
+	"github.com/DavidRHerbert/koor/internal/encryption"
 	"github.com/DavidRHerbert/koor/internal/events"
+	"github.com/DavidRHerbert/koor/internal/federation"
+	"github.com/DavidRHerbert/koor/internal/identity"
 	"github.com/DavidRHerbert/koor/internal/instances"
 	"github.com/DavidRHerbert/koor/internal/liveness"
 	"github.com/DavidRHerbert/koor/internal/llmcost"
+	"github.com/DavidRHerbert/koor/internal/messages"
+	"github.com/DavidRHerbert/koor/internal/milestones"
 	"github.com/DavidRHerbert/koor/internal/observability"
+	"github.com/DavidRHerbert/koor/internal/orphans"
+	"github.com/DavidRHerbert/koor/internal/policy"
+	"github.com/DavidRHerbert/koor/internal/projections"
+	"github.com/DavidRHerbert/koor/internal/schedules"
+	"github.com/DavidRHerbert/koor/internal/projects"
+	"github.com/DavidRHerbert/koor/internal/replication"
+	"github.com/DavidRHerbert/koor/internal/rulepacks"
+	"github.com/DavidRHerbert/koor/internal/search"
 	"github.com/DavidRHerbert/koor/internal/specs"
 	"github.com/DavidRHerbert/koor/internal/state"
+	"github.com/DavidRHerbert/koor/internal/tasks"
 	"github.com/DavidRHerbert/koor/internal/templates"
+	"github.com/DavidRHerbert/koor/internal/tenants"
+	"github.com/DavidRHerbert/koor/internal/tokens"
+	"github.com/DavidRHerbert/koor/internal/users"
 	"github.com/DavidRHerbert/koor/internal/webhooks"
 )
 
@@ -36,6 +56,19 @@ type Config struct {
 	DashboardBind string
 	DataDir       string
 	AuthToken     string
+	ChangeEvents  string // state/spec prefixes that publish change events, e.g. "state:config/,specs:*"
+	MCPDataTools  bool   // offer publish_event, get_state and set_state over MCP
+
+	MCPStateResources string // state key prefixes readable as MCP resources, e.g. "config/,Truck-Wash/" or "*" (empty = none)
+
+	StatusBind     string // public status page listen address (empty = disabled)
+	StatusProjects string // comma-separated projects shown on the status page
+	StatusExpose   string // comma-separated StatusSections shown on the status page
+
+	RequireSignedEvents bool // reject event publishes without a valid instance signature
+	StrictJSON          bool // reject unknown request body fields; report invalid bodies as 422 with the offending fields
+
+	Tenant string // tenant this server serves (empty = the host)
 }
 
 // Server is the Koor HTTP server.
@@ -52,25 +85,72 @@ type Server struct {
 	auditLog      *audit.Log
 	metricsStore  *observability.Store
 	llmCostStore  *llmcost.Store
+	deprecations  *contracts.UsageLog
+	examples      *contracts.ExampleStore
+	settings      *projects.Store
+	changes       changeFilter
+	searchIndex   *search.Index
+	replSource    *replication.Source
+	replica       *replication.Follower
+	federation    *federation.Subscriber
+	rulePacks     *rulepacks.Store
+	policies      *policy.Store
+	projections   *projections.Store
+	schedules     *schedules.Scheduler
+	tenants       *tenants.Manager // nil unless hosting tenants
+	encryption    *encryption.Keyring
+	milestones    *milestones.Store
+	tokens        *tokens.Store
+	users         *users.Store
+	tasks         *tasks.Store
+	messages      *messages.Store
+	orphans       *orphans.Cleaner
 	mcpHandler    http.Handler
+	mcpResources  mcpResourceHost // nil if the MCP handler offers no resources
 	startTime   time.Time
 	logger      *slog.Logger
 	mcpCalls    atomic.Int64 // MCP tool calls (go through LLM context)
+	mcpData     atomic.Int64 // of which data tool calls (publish_event, get_state, set_state)
 	restCalls   atomic.Int64 // REST/CLI calls (bypass LLM context)
+	counterMu   sync.Mutex    // serialises counter flushes and resets
+	stopFlush   chan struct{} // stops the counter flush loop
+	flushDone   chan struct{} // closed when the flush loop has exited
+	requests    *observability.RequestStats
+
+	budgetMu    sync.Mutex
+	budgetBlown map[string]map[string]bool // instance ID -> "project/budget" currently exceeded
+
+	mockMu sync.Mutex
+	mocks  map[string]*contractMock // "project/name" -> running contract mock
 }
 
 // New creates a new Server.
 func New(cfg Config, stateStore *state.Store, specReg *specs.Registry, eventBus *events.Bus, instanceReg *instances.Registry, mcpHandler http.Handler, logger *slog.Logger) *Server {
-	return &Server{
+	s := &Server{
 		config:      cfg,
 		stateStore:  stateStore,
 		specReg:     specReg,
 		eventBus:    eventBus,
 		instanceReg: instanceReg,
 		mcpHandler:  mcpHandler,
+		changes:     parseChangeFilter(cfg.ChangeEvents),
+		requests:    observability.NewRequestStats(),
 		startTime:   time.Now(),
 		logger:      logger,
 	}
+	if cfg.MCPDataTools {
+		if host, ok := mcpHandler.(mcpDataToolHost); ok {
+			host.EnableDataTools(s.mcpDataAPI())
+		}
+	}
+	if host, ok := mcpHandler.(mcpResourceHost); ok {
+		host.EnableResources(s.mcpDataAPI(), parseResourcePrefixes(cfg.MCPStateResources))
+		s.mcpResources = host
+	}
+	if stateStore != nil {
+		stateStore.SetChangeHook(s.publishStateChange)
+	}
+	return s
 }
 
 // SetLiveness attaches a liveness monitor to the server for the /api/liveness endpoints.
@@ -98,9 +178,11 @@ func (s *Server) SetAudit(a *audit.Log) {
 	s.auditLog = a
 }
 
-// SetObservability attaches an observability metrics store.
+// SetObservability attaches an observability metrics store and restores
+// the token tax counters saved in it.
 func (s *Server) SetObservability(o *observability.Store) {
 	s.metricsStore = o
+	s.loadCounters()
 }
 
 // SetLLMCost attaches an LLM cost tracking store.
@@ -108,26 +190,150 @@ func (s *Server) SetLLMCost(lc *llmcost.Store) {
 	s.llmCostStore = lc
 }
 
+// SetSearch attaches a full-text search index.
+func (s *Server) SetSearch(idx *search.Index) {
+	s.searchIndex = idx
+}
+
+// SetPolicies attaches a policy store; its policies are enforced on writes.
+func (s *Server) SetPolicies(p *policy.Store) {
+	s.policies = p
+}
+
+// SetProjections attaches a projection store. The store is applied to
+// published events by the event bus; the server only manages it.
+func (s *Server) SetProjections(p *projections.Store) {
+	s.projections = p
+}
+
+// SetSchedules attaches the scheduler that publishes cron events.
+func (s *Server) SetSchedules(sc *schedules.Scheduler) {
+	s.schedules = sc
+}
+
+// SetTenants makes the server host tenants: requests for a tenant are
+// handed to the tenant's own stack, and tenants are managed under
+// /api/admin/tenants.
+func (s *Server) SetTenants(m *tenants.Manager) {
+	s.tenants = m
+}
+
+// SetEncryption records the keyring the state store and spec registry
+// encrypt values with, enabling key rotation through the admin API.
+func (s *Server) SetEncryption(kr *encryption.Keyring) {
+	s.encryption = kr
+}
+
+// SetMilestones attaches a milestone store.
+func (s *Server) SetMilestones(m *milestones.Store) {
+	s.milestones = m
+}
+
+// SetReplicationSource lets followers pull database snapshots from this server.
+func (s *Server) SetReplicationSource(src *replication.Source) {
+	s.replSource = src
+}
+
+// SetReplica puts the server in read-only follower mode, replicating from f's primary.
+func (s *Server) SetReplica(f *replication.Follower) {
+	s.replica = f
+}
+
+// SetFederation makes the server pull rules and templates from the
+// upstream server of sub.
+func (s *Server) SetFederation(sub *federation.Subscriber) {
+	s.federation = sub
+}
+
+// SetRulePacks attaches a rule pack store.
+func (s *Server) SetRulePacks(p *rulepacks.Store) {
+	s.rulePacks = p
+}
+
+// SetDeprecations attaches a log of deprecated contract usage.
+func (s *Server) SetDeprecations(u *contracts.UsageLog) {
+	s.deprecations = u
+}
+
+// SetContractExamples attaches a store of named contract examples.
+func (s *Server) SetContractExamples(e *contracts.ExampleStore) {
+	s.examples = e
+}
+
+// SetProjectSettings attaches per-project settings consulted by validation,
+// state writes and webhook creation.
+func (s *Server) SetProjectSettings(p *projects.Store) {
+	s.settings = p
+}
+
+// SetTokens attaches a store of scoped API tokens checked by the auth
+// middleware and managed under /api/tokens.
+func (s *Server) SetTokens(t *tokens.Store) {
+	s.tokens = t
+}
+
+// SetUsers attaches a store of users whose roles are checked by the auth
+// middleware on the API and dashboard, managed under /api/users.
+func (s *Server) SetUsers(u *users.Store) {
+	s.users = u
+}
+
+// SetTasks attaches the task queue served under /api/tasks.
+func (s *Server) SetTasks(t *tasks.Store) {
+	s.tasks = t
+}
+
+// SetMessages attaches the agent inboxes served under /api/messages.
+func (s *Server) SetMessages(m *messages.Store) {
+	s.messages = m
+}
+
+// SetOrphans attaches the orphan cleaner whose quarantine is served under
+// /api/admin/quarantine.
+func (s *Server) SetOrphans(c *orphans.Cleaner) {
+	s.orphans = c
+}
+
 type ctxKey string
 
 const dashboardKey ctxKey = "dashboard"
 
-// countREST wraps a handler to count REST/CLI calls.
-// Requests from the dashboard proxy are excluded (they carry the dashboardKey context value).
+// countREST wraps a handler to count REST/CLI calls and record their status
+// and latency per route. Calls made by an instance are also recorded in its
+// agent metrics and count towards its "requests" error budget metric.
+// Requests from the dashboard proxy are excluded (they carry the dashboardKey context value),
+// as are MCP data tool calls, which count as MCP calls.
 func (s *Server) countREST(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Context().Value(dashboardKey) == nil {
-			s.restCalls.Add(1)
+		if r.Context().Value(dashboardKey) != nil || r.Context().Value(mcpDataKey) != nil {
+			next(w, r)
+			return
+		}
+		s.restCalls.Add(1)
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		body := &countingBody{ReadCloser: r.Body}
+		r.Body = body
+		start := time.Now()
+		next(rec, r)
+		s.observeRequest(r, rec.status, start)
+		s.recordCall(r, "rest", rec, body, start)
+		if r.Header.Get("X-Koor-Instance") != "" && s.metricsStore != nil {
+			s.recordOutcome(r, projects.BudgetRequests, rec.status >= 400)
 		}
-		next(w, r)
 	}
 }
 
-// countMCP wraps a handler to count MCP calls.
+// countMCP wraps a handler to count MCP calls and record them in the
+// calling instance's agent metrics.
 func (s *Server) countMCP(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		s.mcpCalls.Add(1)
-		next.ServeHTTP(w, r)
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		body := &countingBody{ReadCloser: r.Body}
+		r.Body = body
+		start := time.Now()
+		next.ServeHTTP(rec, r)
+		s.recordCall(r, "mcp", rec, body, start)
 	})
 }
 
@@ -142,6 +348,9 @@ func (s *Server) Handler() http.Handler {
 	mux.HandleFunc("PUT /api/state/{key...}", s.countREST(s.handleStatePut))
 	mux.HandleFunc("POST /api/state/{key...}", s.countREST(s.handleStateRollback))
 	mux.HandleFunc("DELETE /api/state/{key...}", s.countREST(s.handleStateDelete))
+	mux.HandleFunc("GET /api/state-retention", s.countREST(s.handleStateRetentionGet))
+	mux.HandleFunc("PUT /api/state-retention", s.countREST(s.handleStateRetentionPut))
+	mux.HandleFunc("POST /api/state-retention/compact", s.countREST(s.handleStateRetentionCompact))
 
 	// Specs endpoints.
 	mux.HandleFunc("GET /api/specs/{project}", s.countREST(s.handleSpecsList))
@@ -151,33 +360,64 @@ func (s *Server) Handler() http.Handler {
 
 	// Events endpoints.
 	mux.HandleFunc("POST /api/events/publish", s.countREST(s.handleEventsPublish))
+	mux.HandleFunc("POST /api/events/publish-batch", s.countREST(s.handleEventsPublishBatch))
 	mux.HandleFunc("GET /api/events/history", s.countREST(s.handleEventsHistory))
-	mux.Handle("GET /api/events/subscribe", events.ServeSubscribe(s.eventBus, s.logger))
+	mux.HandleFunc("GET /api/events/latest", s.countREST(s.handleEventsLatest))
+	mux.HandleFunc("GET /api/events/{id}/verify", s.countREST(s.handleEventVerify))
+	mux.HandleFunc("GET /api/events/retention", s.countREST(s.handleEventRetentionGet))
+	mux.HandleFunc("PUT /api/events/retention", s.countREST(s.handleEventRetentionPut))
+	mux.Handle("GET /api/events/subscribe", s.subscribeAccess(events.ServeSubscribe(s.eventBus, s.logger)))
 
 	// Instance endpoints.
 	mux.HandleFunc("GET /api/instances", s.countREST(s.handleInstancesList))
 	mux.HandleFunc("GET /api/instances/stale", s.countREST(s.handleInstancesStale))
 	mux.HandleFunc("GET /api/instances/{id}", s.countREST(s.handleInstanceGet))
 	mux.HandleFunc("POST /api/instances/register", s.countREST(s.handleInstanceRegister))
+	mux.HandleFunc("POST /api/instances/match", s.countREST(s.handleInstancesMatch))
 	mux.HandleFunc("POST /api/instances/{id}/activate", s.countREST(s.handleInstanceActivate))
 	mux.HandleFunc("POST /api/instances/{id}/heartbeat", s.countREST(s.handleInstanceHeartbeat))
 	mux.HandleFunc("DELETE /api/instances/{id}", s.countREST(s.handleInstanceDeregister))
 
 	// Liveness endpoints.
 	mux.HandleFunc("POST /api/liveness/check", s.countREST(s.handleLivenessCheck))
+	mux.HandleFunc("GET /api/liveness/policies", s.countREST(s.handleLivenessPolicyList))
+	mux.HandleFunc("GET /api/liveness/policies/{project}", s.countREST(s.handleLivenessPolicyGet))
+	mux.HandleFunc("PUT /api/liveness/policies/{project}", s.countREST(s.handleLivenessPolicyPut))
+	mux.HandleFunc("DELETE /api/liveness/policies/{project}", s.countREST(s.handleLivenessPolicyDelete))
 
 	// Validation endpoints.
 	mux.HandleFunc("GET /api/validate/{project}/rules", s.countREST(s.handleValidateRulesList))
 	mux.HandleFunc("PUT /api/validate/{project}/rules", s.countREST(s.handleValidateRulesPut))
 	mux.HandleFunc("POST /api/validate/{project}", s.countREST(s.handleValidate))
+	mux.HandleFunc("POST /api/validate/{project}/diff", s.countREST(s.handleValidateDiff))
+	mux.HandleFunc("GET /api/validate/{project}/baseline", s.countREST(s.handleBaselineGet))
+	mux.HandleFunc("POST /api/validate/{project}/baseline", s.countREST(s.handleBaselineCapture))
+	mux.HandleFunc("DELETE /api/validate/{project}/baseline", s.countREST(s.handleBaselineDelete))
 
 	// Contract validation endpoints.
 	mux.HandleFunc("POST /api/contracts/{project}/{name}/validate", s.countREST(s.handleContractValidate))
 	mux.HandleFunc("POST /api/contracts/{project}/{name}/test", s.countREST(s.handleContractTest))
+	mux.HandleFunc("POST /api/contracts/{project}/{name}/test-suite", s.countREST(s.handleContractTestSuite))
+	mux.HandleFunc("POST /api/contracts/{project}/{name}/import", s.countREST(s.handleContractImport))
+	mux.HandleFunc("GET /api/contracts/{project}/{name}/deprecations", s.countREST(s.handleContractDeprecations))
+	mux.HandleFunc("GET /api/contracts/{project}/{name}/drift", s.countREST(s.handleContractDrift))
+	mux.HandleFunc("GET /api/contracts/{project}/{name}/diff", s.countREST(s.handleContractDiff))
+	mux.HandleFunc("POST /api/contracts/{project}/{name}/diff", s.countREST(s.handleContractDiffProposed))
+	mux.HandleFunc("GET /api/contracts/{project}/{name}/examples", s.countREST(s.handleContractExampleList))
+	mux.HandleFunc("POST /api/contracts/{project}/{name}/examples", s.countREST(s.handleContractExampleSave))
+	mux.HandleFunc("DELETE /api/contracts/{project}/{name}/examples/{example}", s.countREST(s.handleContractExampleDelete))
+	mux.HandleFunc("POST /api/contracts/{project}/{name}/mock/start", s.countREST(s.handleContractMockStart))
+	mux.HandleFunc("POST /api/contracts/{project}/{name}/mock/stop", s.countREST(s.handleContractMockStop))
+	mux.HandleFunc("GET /api/mocks", s.countREST(s.handleMockList))
+	mux.HandleFunc("/api/mocks/{project}/{name}/{path...}", s.countREST(s.handleMockServe))
 
 	// Rules management endpoints.
 	mux.HandleFunc("POST /api/rules/propose", s.countREST(s.handleRulesPropose))
 	mux.HandleFunc("POST /api/rules/{project}/{ruleID}/accept", s.countREST(s.handleRulesAccept))
+	mux.HandleFunc("POST /api/rules/{project}/accept", s.countREST(s.handleRulesAcceptBulk))
+	mux.HandleFunc("GET /api/rules/{project}/auto-accept", s.countREST(s.handleAutoAcceptGet))
+	mux.HandleFunc("PUT /api/rules/{project}/auto-accept", s.countREST(s.handleAutoAcceptPut))
+	mux.HandleFunc("DELETE /api/rules/{project}/auto-accept", s.countREST(s.handleAutoAcceptDelete))
 	mux.HandleFunc("POST /api/rules/{project}/{ruleID}/reject", s.countREST(s.handleRulesReject))
 	mux.HandleFunc("GET /api/rules/export", s.countREST(s.handleRulesExport))
 	mux.HandleFunc("POST /api/rules/import", s.countREST(s.handleRulesImport))
@@ -185,12 +425,31 @@ func (s *Server) Handler() http.Handler {
 	// Webhook endpoints.
 	mux.HandleFunc("POST /api/webhooks", s.countREST(s.handleWebhookCreate))
 	mux.HandleFunc("GET /api/webhooks", s.countREST(s.handleWebhookList))
+	mux.HandleFunc("PATCH /api/webhooks/{id}", s.countREST(s.handleWebhookUpdate))
 	mux.HandleFunc("DELETE /api/webhooks/{id}", s.countREST(s.handleWebhookDelete))
 	mux.HandleFunc("POST /api/webhooks/{id}/test", s.countREST(s.handleWebhookTest))
+	mux.HandleFunc("POST /api/webhooks/{id}/replay", s.countREST(s.handleWebhookReplay))
+	mux.HandleFunc("POST /api/webhooks/{id}/rotate-secret", s.countREST(s.handleWebhookRotateSecret))
+	mux.HandleFunc("GET /api/webhooks/{id}/deliveries", s.countREST(s.handleWebhookDeliveries))
+	mux.HandleFunc("POST /api/webhooks/{id}/deliveries/{n}/redeliver", s.countREST(s.handleWebhookRedeliver))
+	mux.HandleFunc("GET /api/webhooks/{id}/dead-letters", s.countREST(s.handleWebhookDeadLetters))
 
 	// Compliance endpoints.
 	mux.HandleFunc("GET /api/compliance/history", s.countREST(s.handleComplianceHistory))
 	mux.HandleFunc("POST /api/compliance/run", s.countREST(s.handleComplianceRun))
+	mux.HandleFunc("GET /api/compliance/score", s.countREST(s.handleComplianceScore))
+	mux.HandleFunc("POST /api/compliance/incidents", s.countREST(s.handleIncidentReport))
+	mux.HandleFunc("GET /api/compliance/incidents", s.countREST(s.handleIncidentList))
+	mux.HandleFunc("POST /api/compliance/contract-tests", s.countREST(s.handleContractScheduleCreate))
+	mux.HandleFunc("GET /api/compliance/contract-tests", s.countREST(s.handleContractScheduleList))
+	mux.HandleFunc("DELETE /api/compliance/contract-tests/{id}", s.countREST(s.handleContractScheduleDelete))
+	mux.HandleFunc("POST /api/compliance/contract-tests/{id}/run", s.countREST(s.handleContractScheduleRun))
+	mux.HandleFunc("GET /api/compliance/contract-tests/{id}/results", s.countREST(s.handleContractScheduleResults))
+	mux.HandleFunc("GET /api/compliance/policies", s.countREST(s.handleCompliancePolicyList))
+	mux.HandleFunc("POST /api/compliance/policies", s.countREST(s.handleCompliancePolicyCreate))
+	mux.HandleFunc("GET /api/compliance/policies/{id}", s.countREST(s.handleCompliancePolicyGet))
+	mux.HandleFunc("PUT /api/compliance/policies/{id}", s.countREST(s.handleCompliancePolicyUpdate))
+	mux.HandleFunc("DELETE /api/compliance/policies/{id}", s.countREST(s.handleCompliancePolicyDelete))
 
 	// Capabilities endpoint.
 	mux.HandleFunc("POST /api/instances/{id}/capabilities", s.countREST(s.handleInstanceSetCapabilities))
@@ -205,14 +464,136 @@ func (s *Server) Handler() http.Handler {
 	// Audit endpoints.
 	mux.HandleFunc("GET /api/audit", s.countREST(s.handleAuditQuery))
 	mux.HandleFunc("GET /api/audit/summary", s.countREST(s.handleAuditSummary))
+	mux.HandleFunc("GET /api/audit/export", s.countREST(s.handleAuditExport))
+	mux.HandleFunc("GET /api/audit/stream", s.handleAuditStream)
 
 	// Agent metrics endpoints.
 	mux.HandleFunc("GET /api/metrics/agents", s.countREST(s.handleAgentMetrics))
 	mux.HandleFunc("GET /api/metrics/agents/{id}", s.countREST(s.handleAgentMetricsGet))
 
+	// Policy endpoints.
+	mux.HandleFunc("GET /api/policies", s.countREST(s.handlePolicyList))
+	mux.HandleFunc("POST /api/policies", s.countREST(s.handlePolicyCreate))
+	mux.HandleFunc("POST /api/policies/evaluate", s.countREST(s.handlePolicyEvaluate))
+	mux.HandleFunc("GET /api/policies/{id}", s.countREST(s.handlePolicyGet))
+	mux.HandleFunc("DELETE /api/policies/{id}", s.countREST(s.handlePolicyDelete))
+
+	// Projection endpoints.
+	mux.HandleFunc("GET /api/projections", s.countREST(s.handleProjectionList))
+	mux.HandleFunc("POST /api/projections", s.countREST(s.handleProjectionCreate))
+	mux.HandleFunc("GET /api/projections/{id}", s.countREST(s.handleProjectionGet))
+	mux.HandleFunc("PUT /api/projections/{id}", s.countREST(s.handleProjectionUpdate))
+	mux.HandleFunc("DELETE /api/projections/{id}", s.countREST(s.handleProjectionDelete))
+
+	// Schedule endpoints.
+	mux.HandleFunc("GET /api/schedules", s.countREST(s.handleScheduleList))
+	mux.HandleFunc("POST /api/schedules", s.countREST(s.handleScheduleCreate))
+	mux.HandleFunc("GET /api/schedules/{id}", s.countREST(s.handleScheduleGet))
+	mux.HandleFunc("PUT /api/schedules/{id}", s.countREST(s.handleScheduleUpdate))
+	mux.HandleFunc("DELETE /api/schedules/{id}", s.countREST(s.handleScheduleDelete))
+	mux.HandleFunc("POST /api/schedules/{id}/run", s.countREST(s.handleScheduleRun))
+
+	// Search endpoint.
+	mux.HandleFunc("GET /api/search", s.countREST(s.handleSearch))
+
+	// GraphQL (read-only)
+	mux.HandleFunc("GET /api/graphql", s.countREST(s.handleGraphQL))
+	mux.HandleFunc("POST /api/graphql", s.countREST(s.handleGraphQL))
+
+	// Project registry endpoints.
+	mux.HandleFunc("GET /api/projects", s.countREST(s.handleProjectList))
+	mux.HandleFunc("POST /api/projects", s.countREST(s.handleProjectCreate))
+	mux.HandleFunc("GET /api/projects/{project}", s.countREST(s.handleProjectGet))
+	mux.HandleFunc("DELETE /api/projects/{project}", s.countREST(s.handleProjectDelete))
+
+	// Project status and briefing endpoints.
+	mux.HandleFunc("GET /api/projects/{project}/status", s.countREST(s.handleProjectStatus))
+	mux.HandleFunc("GET /api/projects/{project}/pending", s.countREST(s.handleProjectPending))
+	mux.HandleFunc("GET /api/projects/{project}/handoff", s.countREST(s.handleProjectHandoff))
+	mux.HandleFunc("GET /api/digest", s.countREST(s.handleDigest))
+	mux.HandleFunc("GET /api/projects/{project}/budgets", s.countREST(s.handleProjectBudgets))
+
+	// Project settings endpoints.
+	mux.HandleFunc("GET /api/projects/{project}/settings", s.countREST(s.handleProjectSettingsGet))
+	mux.HandleFunc("PUT /api/projects/{project}/settings", s.countREST(s.handleProjectSettingsPut))
+	mux.HandleFunc("DELETE /api/projects/{project}/settings", s.countREST(s.handleProjectSettingsDelete))
+
+	// Milestone endpoints.
+	mux.HandleFunc("GET /api/projects/{project}/milestones", s.countREST(s.handleMilestoneList))
+	mux.HandleFunc("POST /api/projects/{project}/milestones", s.countREST(s.handleMilestoneCreate))
+	mux.HandleFunc("GET /api/projects/{project}/milestones/{id}", s.countREST(s.handleMilestoneGet))
+	mux.HandleFunc("DELETE /api/projects/{project}/milestones/{id}", s.countREST(s.handleMilestoneDelete))
+	mux.HandleFunc("GET /api/milestones", s.countREST(s.handleMilestoneList))
+
+	// Project export/import endpoints.
+	mux.HandleFunc("GET /api/projects/{project}/export", s.countREST(s.handleProjectExport))
+	mux.HandleFunc("POST /api/projects/{project}/import", s.countREST(s.handleProjectImport))
+
+	// Admin endpoints.
+	mux.HandleFunc("GET /api/admin/gc-report", s.countREST(s.handleGCReport))
+	mux.HandleFunc("POST /api/admin/gc", s.countREST(s.handleGC))
+	mux.HandleFunc("POST /api/admin/rotate-key", s.countREST(s.handleAdminRotateKey))
+	mux.HandleFunc("POST /api/admin/snapshot", s.countREST(s.handleAdminSnapshot))
+	mux.HandleFunc("POST /api/admin/restore", s.countREST(s.handleAdminRestore))
+	mux.HandleFunc("GET /api/admin/quarantine", s.countREST(s.handleQuarantineList))
+	mux.HandleFunc("POST /api/admin/quarantine/sweep", s.countREST(s.handleQuarantineSweep))
+	mux.HandleFunc("POST /api/admin/quarantine/{id}/restore", s.countREST(s.handleQuarantineRestore))
+	mux.HandleFunc("GET /api/admin/tenants", s.countREST(s.handleTenantList))
+	mux.HandleFunc("POST /api/admin/tenants", s.countREST(s.handleTenantCreate))
+	mux.HandleFunc("GET /api/admin/tenants/{id}", s.countREST(s.handleTenantGet))
+	mux.HandleFunc("POST /api/admin/tenants/{id}/suspend", s.countREST(s.handleTenantSuspend))
+	mux.HandleFunc("POST /api/admin/tenants/{id}/resume", s.countREST(s.handleTenantResume))
+	mux.HandleFunc("DELETE /api/admin/tenants/{id}", s.countREST(s.handleTenantDelete))
+	mux.HandleFunc("DELETE /api/admin/quarantine/{id}", s.countREST(s.handleQuarantinePurge))
+
+	// Token endpoints.
+	mux.HandleFunc("GET /api/tokens", s.countREST(s.handleTokenList))
+	mux.HandleFunc("POST /api/tokens", s.countREST(s.handleTokenCreate))
+	mux.HandleFunc("GET /api/tokens/whoami", s.countREST(s.handleTokenWhoami))
+	mux.HandleFunc("DELETE /api/tokens/{id}", s.countREST(s.handleTokenRevoke))
+	mux.HandleFunc("POST /api/tokens/{id}/rotate", s.countREST(s.handleTokenRotate))
+	// API keys are tokens; /api/apikeys/{id}/rotate is an alias.
+	mux.HandleFunc("POST /api/apikeys/{id}/rotate", s.countREST(s.handleTokenRotate))
+	mux.HandleFunc("PUT /api/tokens/{id}/topics", s.countREST(s.handleTokenTopics))
+	mux.HandleFunc("GET /api/users", s.countREST(s.handleUserList))
+	mux.HandleFunc("POST /api/users", s.countREST(s.handleUserCreate))
+	mux.HandleFunc("PUT /api/users/{name}", s.countREST(s.handleUserSetRole))
+	mux.HandleFunc("POST /api/users/{name}/reset", s.countREST(s.handleUserReset))
+	mux.HandleFunc("DELETE /api/users/{name}", s.countREST(s.handleUserDelete))
+
+	// Task queue endpoints.
+	mux.HandleFunc("GET /api/tasks", s.countREST(s.handleTaskList))
+	mux.HandleFunc("POST /api/tasks", s.countREST(s.handleTaskCreate))
+	mux.HandleFunc("POST /api/tasks/claim", s.countREST(s.handleTaskClaim))
+	mux.HandleFunc("GET /api/tasks/{id}", s.countREST(s.handleTaskGet))
+	mux.HandleFunc("POST /api/tasks/{id}/complete", s.countREST(s.handleTaskComplete))
+	mux.HandleFunc("POST /api/tasks/{id}/fail", s.countREST(s.handleTaskFail))
+	mux.HandleFunc("POST /api/tasks/{id}/requeue", s.countREST(s.handleTaskRequeue))
+
+	// Agent message endpoints.
+	mux.HandleFunc("POST /api/messages", s.countREST(s.handleMessageSend))
+	mux.HandleFunc("GET /api/messages/inbox/{instance_id}", s.countREST(s.handleMessageInbox))
+	mux.HandleFunc("GET /api/messages/{id}", s.countREST(s.handleMessageGet))
+	mux.HandleFunc("POST /api/messages/{id}/ack", s.countREST(s.handleMessageAck))
+
+	// Rule pack endpoints.
+	mux.HandleFunc("GET /api/rulepacks", s.countREST(s.handleRulePackList))
+	mux.HandleFunc("POST /api/rulepacks/install", s.countREST(s.handleRulePackInstall))
+
+	// Replication endpoints.
+	mux.HandleFunc("GET /api/replication/snapshot", s.handleReplicationSnapshot)
+	mux.HandleFunc("GET /api/replication/status", s.handleReplicationStatus)
+
+	// Federation endpoints.
+	mux.HandleFunc("GET /api/federation/pack", s.handleFederationPack)
+	mux.HandleFunc("GET /api/federation/status", s.handleFederationStatus)
+	mux.HandleFunc("POST /api/federation/sync", s.handleFederationSync)
+
 	// Token tax metrics endpoints (NOT counted — infrastructure, not agent calls).
 	mux.HandleFunc("GET /api/metrics", s.handleMetrics)
 	mux.HandleFunc("POST /api/metrics/reset", s.handleMetricsReset)
+	mux.HandleFunc("GET /api/metrics/resets", s.handleMetricsResets)
+	mux.HandleFunc("GET /metrics/prometheus", s.handlePrometheus)
 
 	// LLM cost tracking endpoints.
 	mux.HandleFunc("POST /api/llm/usage", s.countREST(s.handleLLMUsageRecord))
@@ -227,18 +608,22 @@ func (s *Server) Handler() http.Handler {
 	// Outer mux: health is public, everything else goes through auth.
 	outer := http.NewServeMux()
 	outer.HandleFunc("GET /health", s.handleHealth)
-	outer.Handle("/", authMiddleware(s.config.AuthToken, mux))
+	outer.Handle("/", s.authMiddleware(s.readOnlyMiddleware(mux)))
 
-	return outer
+	return s.tenantDispatch(outer, func(st *tenants.Stack) http.Handler { return st.API })
 }
 
 // DashboardHandler returns the HTTP handler for the dashboard (separate port).
-// It proxies /api/* and /health to the API server, serves HTMX rules pages, and embedded static files.
+// It proxies /api/* and /health to the API server, serves HTMX pages for
+// instances, events, state and rules, and embedded static files.
+// Requests are authenticated like API requests, from the session cookie set by /login.
 func (s *Server) DashboardHandler() http.Handler {
 	mux := http.NewServeMux()
 	mux.HandleFunc("GET /health", s.handleHealth)
 	mux.HandleFunc("GET /api/", s.dashboardProxy)
 	mux.HandleFunc("POST /api/metrics/reset", s.dashboardProxy)
+	mux.HandleFunc("POST /api/contracts/{project}/{name}/validate", s.dashboardProxy)
+	mux.HandleFunc("POST /api/contracts/{project}/{name}/examples", s.dashboardProxy)
 
 	// Dashboard rules HTMX routes.
 	mux.HandleFunc("GET /rules", s.handleDashboardRules)
@@ -249,12 +634,29 @@ func (s *Server) DashboardHandler() http.Handler {
 	mux.HandleFunc("POST /rules/{project}/{ruleID}/accept", s.handleDashboardRuleAccept)
 	mux.HandleFunc("POST /rules/{project}/{ruleID}/reject", s.handleDashboardRuleReject)
 
+	// Dashboard instance, event and state HTMX routes.
+	mux.HandleFunc("GET /instances", s.handleDashboardInstances)
+	mux.HandleFunc("GET /instances/list", s.handleDashboardInstancesList)
+	mux.HandleFunc("GET /events", s.handleDashboardEvents)
+	mux.HandleFunc("GET /events/list", s.handleDashboardEventsList)
+	mux.HandleFunc("GET /state", s.handleDashboardState)
+	mux.HandleFunc("GET /state/list", s.handleDashboardStateList)
+	mux.HandleFunc("GET /state/view", s.handleDashboardStateView)
+	mux.HandleFunc("GET /state/diff", s.handleDashboardStateDiff)
+
+	// Sign-in; the secret is kept in a session cookie.
+	mux.HandleFunc("GET /login", s.handleDashboardLoginPage)
+	mux.HandleFunc("POST /login", s.handleDashboardLogin)
+	mux.HandleFunc("GET /logout", s.handleDashboardLogout)
+
 	// Static files (CSS, JS, overview page).
 	mux.Handle("GET /", dashboard.Handler())
-	return mux
+	return s.tenantDispatch(s.dashboardAuth(s.readOnlyMiddleware(mux)),
+		func(st *tenants.Stack) http.Handler { return st.Dashboard })
 }
 
-// ListenAndServe starts the API server and optionally the dashboard server.
+// ListenAndServe starts the API server and optionally the dashboard and
+// status page servers.
 // It blocks until the context is cancelled.
 func (s *Server) ListenAndServe(ctx context.Context) error {
 	apiSrv := &http.Server{
@@ -289,6 +691,24 @@ func (s *Server) ListenAndServe(ctx context.Context) error {
 		}()
 	}
 
+	// Start the public status page on its own port if configured.
+	var statusSrv *http.Server
+	if s.config.StatusBind != "" {
+		statusSrv = &http.Server{
+			Addr:         s.config.StatusBind,
+			Handler:      s.StatusHandler(),
+			ReadTimeout:  10 * time.Second,
+			WriteTimeout: 30 * time.Second,
+			IdleTimeout:  60 * time.Second,
+		}
+		go func() {
+			s.logger.Info("status page listening", "bind", s.config.StatusBind)
+			if err := statusSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				errCh <- fmt.Errorf("status page: %w", err)
+			}
+		}()
+	}
+
 	select {
 	case err := <-errCh:
 		return err
@@ -299,6 +719,9 @@ func (s *Server) ListenAndServe(ctx context.Context) error {
 		if dashSrv != nil {
 			dashSrv.Shutdown(shutdownCtx)
 		}
+		if statusSrv != nil {
+			statusSrv.Shutdown(shutdownCtx)
+		}
 		return apiSrv.Shutdown(shutdownCtx)
 	}
 }
@@ -316,15 +739,28 @@ func (s *Server) dashboardProxy(w http.ResponseWriter, r *http.Request) {
 // --- Health ---
 
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
-	writeJSON(w, http.StatusOK, map[string]any{
+	role := "primary"
+	if s.replica != nil {
+		role = "replica"
+	}
+	resp := map[string]any{
 		"status": "ok",
 		"uptime": time.Since(s.startTime).Truncate(time.Second).String(),
-	})
+		"role":   role,
+	}
+	if s.config.Tenant != "" {
+		resp["tenant"] = s.config.Tenant
+	}
+	writeJSON(w, http.StatusOK, resp)
 }
 
 // --- State handlers ---
 
 func (s *Server) handleStateList(w http.ResponseWriter, r *http.Request) {
+	if q := r.URL.Query(); q.Has("limit") || q.Has("cursor") {
+		s.handleStatePage(w, r)
+		return
+	}
 	items, err := s.stateStore.List(r.Context())
 	if err != nil {
 		s.logger.Error("state list failed", "error", err)
@@ -334,10 +770,58 @@ func (s *Server) handleStateList(w http.ResponseWriter, r *http.Request) {
 	if items == nil {
 		items = []state.Summary{}
 	}
-	writeJSON(w, http.StatusOK, items)
+	id := identityFromRequest(r)
+	if prefix := r.URL.Query().Get("prefix"); prefix != "" || id != nil && !id.CrossProject() {
+		own := []state.Summary{}
+		for _, item := range items {
+			if strings.HasPrefix(item.Key, prefix) && (id == nil || id.OwnsKey(item.Key)) {
+				own = append(own, item)
+			}
+		}
+		items = own
+	}
+	writeJSON(w, http.StatusOK, s.filterStateList(r, items))
+}
+
+// handleStatePage serves the key list a page at a time, in key order.
+// Pass the returned cursor as the next ?cursor= until has_more is false.
+func (s *Server) handleStatePage(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	pq := state.PageQuery{Prefix: q.Get("prefix"), After: q.Get("cursor"), Owner: q.Get("owner"), Tag: q.Get("tag"), Limit: 100}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		pq.Limit = min(n, 1000)
+	}
+
+	page, hasMore, err := s.stateStore.Page(r.Context(), pq)
+	if err != nil {
+		s.logger.Error("state list page failed", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to list state")
+		return
+	}
+	if page == nil {
+		page = []state.Summary{}
+	}
+	cursor := pq.After
+	if len(page) > 0 {
+		cursor = page[len(page)-1].Key
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"keys":     s.filterStateList(r, page),
+		"has_more": hasMore,
+		"cursor":   cursor,
+	})
 }
 
 func (s *Server) handleStateGet(w http.ResponseWriter, r *http.Request) {
+	if key, ok := stateMetaKey(r); ok {
+		s.handleStateMetaGet(w, r, key)
+		return
+	}
 	key := r.PathValue("key")
 	q := r.URL.Query()
 
@@ -446,7 +930,19 @@ func (s *Server) handleStateGet(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) handleStatePut(w http.ResponseWriter, r *http.Request) {
+	if key, ok := stateMetaKey(r); ok {
+		s.handleStateMetaPut(w, r, key)
+		return
+	}
 	key := r.PathValue("key")
+	if !s.enforcePolicy(w, r, policy.ActionStateWrite, key) {
+		return
+	}
+	pre, err := statePrecondition(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
 	body, err := io.ReadAll(io.LimitReader(r.Body, 10<<20)) // 10 MB limit
 	if err != nil {
@@ -458,12 +954,25 @@ func (s *Server) handleStatePut(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !s.enforceStateValidation(w, r, key, body) {
+		return
+	}
+	if err := s.specReg.CheckPayloadRef(r.Context(), body); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	ct := r.Header.Get("Content-Type")
 	if ct == "" {
 		ct = "application/json"
 	}
 
-	entry, err := s.stateStore.Put(r.Context(), key, body, ct, "")
+	actor := actorFromRequest(r)
+	entry, err := s.stateStore.PutIf(r.Context(), key, body, ct, actor, pre)
+	if errors.Is(err, state.ErrConflict) {
+		s.writeStateConflict(w, r, key, pre)
+		return
+	}
 	if err != nil {
 		s.logger.Error("state put failed", "key", key, "error", err)
 		writeError(w, http.StatusInternalServerError, "failed to write state")
@@ -472,6 +981,7 @@ func (s *Server) handleStatePut(w http.ResponseWriter, r *http.Request) {
 
 	s.logger.Info("state updated", "key", key, "version", entry.Version)
 	s.audit(r.Context(), "", "state.put", key, audit.DetailJSON(map[string]any{"version": entry.Version}), "success")
+	w.Header().Set("ETag", `"`+entry.Hash+`"`)
 	writeJSON(w, http.StatusOK, map[string]any{
 		"key":          entry.Key,
 		"version":      entry.Version,
@@ -481,7 +991,54 @@ func (s *Server) handleStatePut(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// statePrecondition reads the optimistic concurrency headers of a state
+// write: If-Match with the ETag (value hash) a GET returned, and/or
+// X-Koor-Expected-Version with the version the caller last read, 0 meaning
+// the key must not exist yet.
+func statePrecondition(r *http.Request) (state.Precondition, error) {
+	var pre state.Precondition
+	if match := strings.TrimSpace(r.Header.Get("If-Match")); match != "" {
+		match = strings.TrimPrefix(match, "W/")
+		pre.Hash = strings.Trim(match, `"`)
+	}
+	if v := r.Header.Get("X-Koor-Expected-Version"); v != "" {
+		version, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || version < 0 {
+			return pre, fmt.Errorf("X-Koor-Expected-Version must be a non-negative integer")
+		}
+		pre.Version = &version
+	}
+	return pre, nil
+}
+
+// writeStateConflict answers a failed conditional write with 409 and the
+// key's current version, so the caller can re-read and retry.
+func (s *Server) writeStateConflict(w http.ResponseWriter, r *http.Request, key string, pre state.Precondition) {
+	resp := map[string]any{
+		"error":           "state precondition failed: " + key + " was modified",
+		"code":            http.StatusConflict,
+		"key":             key,
+		"current_version": 0,
+	}
+	if cur, err := s.stateStore.Get(r.Context(), key); err == nil {
+		resp["current_version"] = cur.Version
+		resp["current_hash"] = cur.Hash
+		w.Header().Set("ETag", `"`+cur.Hash+`"`)
+		if pre.Version != nil && *pre.Version == 0 {
+			resp["error"] = "state precondition failed: " + key + " already exists"
+		}
+	} else {
+		resp["error"] = "state precondition failed: " + key + " does not exist"
+	}
+	s.logger.Info("state write conflict", "key", key, "actor", actorFromRequest(r))
+	writeJSON(w, http.StatusConflict, resp)
+}
+
 func (s *Server) handleStateRollback(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Has("compact") {
+		s.handleStateCompact(w, r)
+		return
+	}
 	key := r.PathValue("key")
 	versionParam := r.URL.Query().Get("rollback")
 	if versionParam == "" {
@@ -493,8 +1050,22 @@ func (s *Server) handleStateRollback(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, "rollback version must be an integer")
 		return
 	}
+	if !s.enforcePolicy(w, r, policy.ActionStateWrite, key) {
+		return
+	}
 
-	entry, err := s.stateStore.Rollback(r.Context(), key, version)
+	if isDryRun(r) {
+		if _, err := s.stateStore.GetVersion(r.Context(), key, version); err != nil {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("version %d not found for key: %s", version, key))
+			return
+		}
+		plan := newChangePlan()
+		plan.add("state:"+key, true)
+		writeDryRun(w, plan)
+		return
+	}
+
+	entry, err := s.stateStore.Rollback(r.Context(), key, version, actorFromRequest(r))
 	if errors.Is(err, sql.ErrNoRows) {
 		writeError(w, http.StatusNotFound, fmt.Sprintf("version %d not found for key: %s", version, key))
 		return
@@ -517,9 +1088,16 @@ func (s *Server) handleStateRollback(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) handleStateDelete(w http.ResponseWriter, r *http.Request) {
+	if key, ok := stateMetaKey(r); ok {
+		s.handleStateMetaDelete(w, r, key)
+		return
+	}
 	key := r.PathValue("key")
+	if !s.enforcePolicy(w, r, policy.ActionStateWrite, key) {
+		return
+	}
 
-	err := s.stateStore.Delete(r.Context(), key)
+	err := s.stateStore.Delete(r.Context(), key, actorFromRequest(r))
 	if errors.Is(err, sql.ErrNoRows) {
 		writeError(w, http.StatusNotFound, "key not found: "+key)
 		return
@@ -559,7 +1137,23 @@ func (s *Server) handleSpecsGet(w http.ResponseWriter, r *http.Request) {
 	project := r.PathValue("project")
 	name := r.PathValue("name")
 
-	spec, err := s.specReg.Get(r.Context(), project, name)
+	// ?version=N — get a specific version, e.g. one a spec_ref is pinned to.
+	var spec *specs.Spec
+	var err error
+	if v := r.URL.Query().Get("version"); v != "" {
+		version, perr := strconv.ParseInt(v, 10, 64)
+		if perr != nil {
+			writeError(w, http.StatusBadRequest, "version must be an integer")
+			return
+		}
+		spec, err = s.specReg.GetVersion(r.Context(), project, name, version)
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("version %d not found for spec: %s/%s", version, project, name))
+			return
+		}
+	} else {
+		spec, err = s.specReg.Get(r.Context(), project, name)
+	}
 	if errors.Is(err, sql.ErrNoRows) {
 		writeError(w, http.StatusNotFound, "spec not found: "+project+"/"+name)
 		return
@@ -606,6 +1200,7 @@ func (s *Server) handleSpecsPut(w http.ResponseWriter, r *http.Request) {
 
 	s.logger.Info("spec updated", "project", project, "name", name, "version", spec.Version)
 	s.audit(r.Context(), "", "spec.put", project+"/"+name, audit.DetailJSON(map[string]any{"version": spec.Version}), "success")
+	s.publishSpecChange(r.Context(), "put", project, name, spec.Version-1, spec.Version, actorFromRequest(r))
 	writeJSON(w, http.StatusOK, map[string]any{
 		"project":    spec.Project,
 		"name":       spec.Name,
@@ -619,6 +1214,10 @@ func (s *Server) handleSpecsDelete(w http.ResponseWriter, r *http.Request) {
 	project := r.PathValue("project")
 	name := r.PathValue("name")
 
+	var oldVersion int64
+	if prev, err := s.specReg.Get(r.Context(), project, name); err == nil {
+		oldVersion = prev.Version
+	}
 	err := s.specReg.Delete(r.Context(), project, name)
 	if errors.Is(err, sql.ErrNoRows) {
 		writeError(w, http.StatusNotFound, "spec not found: "+project+"/"+name)
@@ -632,6 +1231,7 @@ func (s *Server) handleSpecsDelete(w http.ResponseWriter, r *http.Request) {
 
 	s.logger.Info("spec deleted", "project", project, "name", name)
 	s.audit(r.Context(), "", "spec.delete", project+"/"+name, "{}", "success")
+	s.publishSpecChange(r.Context(), "delete", project, name, oldVersion, 0, actorFromRequest(r))
 	writeJSON(w, http.StatusOK, map[string]any{"deleted": project + "/" + name})
 }
 
@@ -642,16 +1242,31 @@ func (s *Server) handleEventsPublish(w http.ResponseWriter, r *http.Request) {
 		Topic string          `json:"topic"`
 		Data  json.RawMessage `json:"data"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid JSON body")
+	if !s.decodeBody(w, r, &req) {
 		return
 	}
 	if req.Topic == "" {
-		writeError(w, http.StatusBadRequest, "topic is required")
+		s.rejectFields(w, "topic is required", fieldError{Field: "topic", Problem: "is required"})
+		return
+	}
+	if id := identityFromRequest(r); id != nil && !id.OwnsTopic(req.Topic) {
+		writeError(w, http.StatusForbidden, "token "+id.Name+" may only publish "+strings.ToLower(id.Project)+".* topics")
+		return
+	}
+
+	signer, signature, ok := s.checkEventSignature(w, r, req.Topic, req.Data)
+	if !ok {
+		return
+	}
+	if !s.enforcePolicy(w, r, policy.ActionEventPublish, req.Topic) {
 		return
 	}
 
-	ev, err := s.eventBus.Publish(r.Context(), req.Topic, req.Data, "")
+	ev, err := s.eventBus.PublishSigned(r.Context(), req.Topic, req.Data, "", signer, signature)
+	if errors.Is(err, events.ErrInternalTopic) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 	if err != nil {
 		s.logger.Error("event publish failed", "topic", req.Topic, "error", err)
 		writeError(w, http.StatusInternalServerError, "failed to publish event")
@@ -662,6 +1277,84 @@ func (s *Server) handleEventsPublish(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, ev)
 }
 
+// maxPublishBatch caps the events accepted by one publish-batch request.
+const maxPublishBatch = 1000
+
+// handleEventsPublishBatch publishes an array of events in one transaction:
+// every event is checked first, and one bad event rejects the batch. Each
+// event may carry a signature made by the X-Koor-Instance instance.
+func (s *Server) handleEventsPublishBatch(w http.ResponseWriter, r *http.Request) {
+	var req []struct {
+		Topic     string          `json:"topic"`
+		Data      json.RawMessage `json:"data"`
+		Signature string          `json:"signature"`
+	}
+	if !s.decodeBody(w, r, &req) {
+		return
+	}
+	if len(req) == 0 {
+		s.rejectFields(w, "at least one event is required", fieldError{Field: "(body)", Problem: "is empty"})
+		return
+	}
+	if len(req) > maxPublishBatch {
+		s.rejectFields(w, "at most "+strconv.Itoa(maxPublishBatch)+" events per batch",
+			fieldError{Field: "(body)", Problem: "has more than " + strconv.Itoa(maxPublishBatch) + " events"})
+		return
+	}
+	for i, ev := range req {
+		if ev.Topic == "" {
+			field := "[" + strconv.Itoa(i) + "].topic"
+			s.rejectFields(w, field+" is required", fieldError{Field: field, Problem: "is required"})
+			return
+		}
+	}
+
+	id := identityFromRequest(r)
+	instance := r.Header.Get("X-Koor-Instance")
+	drafts := make([]events.Draft, 0, len(req))
+	topics := map[string]bool{}
+	for _, ev := range req {
+		if id != nil && !id.OwnsTopic(ev.Topic) {
+			writeError(w, http.StatusForbidden, "token "+id.Name+" may only publish "+strings.ToLower(id.Project)+".* topics")
+			return
+		}
+		signer, signature, ok := s.verifyEventSignature(w, r, instance, ev.Signature, ev.Topic, ev.Data)
+		if !ok {
+			return
+		}
+		if !topics[ev.Topic] && !s.enforcePolicy(w, r, policy.ActionEventPublish, ev.Topic) {
+			return
+		}
+		topics[ev.Topic] = true
+		if len(ev.Data) == 0 {
+			ev.Data = json.RawMessage("null")
+		}
+		drafts = append(drafts, events.Draft{Topic: ev.Topic, Data: ev.Data, Signer: signer, Signature: signature})
+	}
+
+	published, err := s.eventBus.PublishBatch(r.Context(), drafts)
+	if errors.Is(err, events.ErrInternalTopic) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		s.logger.Error("event batch publish failed", "count", len(drafts), "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to publish events")
+		return
+	}
+
+	s.logger.Info("event batch published", "count", len(published), "topics", len(topics))
+	s.audit(r.Context(), actorFromRequest(r), "event.publish_batch", "bulk", audit.DetailJSON(map[string]any{
+		"count":    len(published),
+		"first_id": published[0].ID,
+		"last_id":  published[len(published)-1].ID,
+	}), "success")
+	writeJSON(w, http.StatusOK, map[string]any{
+		"published": len(published),
+		"events":    published,
+	})
+}
+
 func (s *Server) handleEventsHistory(w http.ResponseWriter, r *http.Request) {
 	last := 50
 	if v := r.URL.Query().Get("last"); v != "" {
@@ -674,6 +1367,12 @@ func (s *Server) handleEventsHistory(w http.ResponseWriter, r *http.Request) {
 	fromStr := r.URL.Query().Get("from")
 	toStr := r.URL.Query().Get("to")
 
+	// Cursor pagination: ?after_id= and/or ?before_id= page by event ID.
+	if r.URL.Query().Has("after_id") || r.URL.Query().Has("before_id") {
+		s.handleEventsPage(w, r, topic, source)
+		return
+	}
+
 	// If time-range or source filters are provided, use HistoryByTimeRange.
 	if fromStr != "" || toStr != "" || source != "" {
 		var from, to time.Time
@@ -693,7 +1392,7 @@ func (s *Server) handleEventsHistory(w http.ResponseWriter, r *http.Request) {
 		if history == nil {
 			history = []events.Event{}
 		}
-		writeJSON(w, http.StatusOK, history)
+		writeJSON(w, http.StatusOK, visibleEvents(r, history))
 		return
 	}
 
@@ -706,7 +1405,70 @@ func (s *Server) handleEventsHistory(w http.ResponseWriter, r *http.Request) {
 	if history == nil {
 		history = []events.Event{}
 	}
-	writeJSON(w, http.StatusOK, history)
+	writeJSON(w, http.StatusOK, visibleEvents(r, history))
+}
+
+// handleEventsLatest returns the newest event of each topic matching
+// ?topic= (a topic or glob pattern; all topics if omitted), without
+// scanning the history.
+func (s *Server) handleEventsLatest(w http.ResponseWriter, r *http.Request) {
+	latest, err := s.eventBus.Latest(r.Context(), r.URL.Query().Get("topic"))
+	if err != nil {
+		s.logger.Error("latest events failed", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to get latest events")
+		return
+	}
+	if latest == nil {
+		latest = []events.Event{}
+	}
+	writeJSON(w, http.StatusOK, visibleEvents(r, latest))
+}
+
+// handleEventsPage serves cursor-paginated history. Pass the returned
+// cursor as the next after_id (or before_id, when paging backwards).
+func (s *Server) handleEventsPage(w http.ResponseWriter, r *http.Request, topic, source string) {
+	q := events.PageQuery{Topic: topic, Source: source}
+	for name, dst := range map[string]*int64{"after_id": &q.AfterID, "before_id": &q.BeforeID} {
+		if v := r.URL.Query().Get(name); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || n < 0 {
+				writeError(w, http.StatusBadRequest, name+" must be a non-negative integer")
+				return
+			}
+			*dst = n
+		}
+	}
+	for _, name := range []string{"limit", "last"} {
+		if v := r.URL.Query().Get(name); v != "" {
+			if n, err := strconv.Atoi(v); err == nil && n > 0 {
+				q.Limit = min(n, 1000)
+				break
+			}
+		}
+	}
+
+	page, hasMore, err := s.eventBus.Page(r.Context(), q)
+	if err != nil {
+		s.logger.Error("event history page failed", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to get event history")
+		return
+	}
+	if page == nil {
+		page = []events.Event{}
+	}
+	cursor := q.AfterID
+	if q.AfterID == 0 && q.BeforeID > 0 {
+		cursor = q.BeforeID
+	}
+	if len(page) > 0 {
+		cursor = page[len(page)-1].ID
+	}
+	// The cursor moves past hidden events too, so paging carries on.
+	writeJSON(w, http.StatusOK, map[string]any{
+		"events":   visibleEvents(r, page),
+		"has_more": hasMore,
+		"cursor":   cursor,
+	})
 }
 
 // --- Instance handlers ---
@@ -733,7 +1495,7 @@ func (s *Server) handleInstancesList(w http.ResponseWriter, r *http.Request) {
 	if items == nil {
 		items = []instances.Summary{}
 	}
-	writeJSON(w, http.StatusOK, items)
+	writeJSON(w, http.StatusOK, ownInstances(r, items))
 }
 
 func (s *Server) handleInstanceGet(w http.ResponseWriter, r *http.Request) {
@@ -757,6 +1519,7 @@ func (s *Server) handleInstanceGet(w http.ResponseWriter, r *http.Request) {
 		Workspace:    inst.Workspace,
 		Intent:       inst.Intent,
 		Stack:        inst.Stack,
+		Project:      inst.Project,
 		Capabilities: inst.Capabilities,
 		Status:       inst.Status,
 		RegisteredAt: inst.RegisteredAt,
@@ -770,15 +1533,45 @@ func (s *Server) handleInstanceRegister(w http.ResponseWriter, r *http.Request)
 		Workspace string `json:"workspace"`
 		Intent    string `json:"intent"`
 		Stack     string `json:"stack"`
+		Project   string `json:"project"`
+		PublicKey string `json:"public_key"`
+		Signing   bool   `json:"signing"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid JSON body")
+	if !s.decodeBody(w, r, &req) {
 		return
 	}
 	if req.Name == "" {
-		writeError(w, http.StatusBadRequest, "name is required")
+		s.rejectFields(w, "name is required", fieldError{Field: "name", Problem: "is required"})
 		return
 	}
+	if id := identityFromRequest(r); id != nil && !id.CrossProject() {
+		if req.Project != "" && req.Project != id.Project {
+			writeError(w, http.StatusForbidden, "token "+id.Name+" is limited to project "+id.Project)
+			return
+		}
+		req.Project = id.Project
+	} else if req.Project != "" && !s.projectRegistered(w, r, req.Project) {
+		return
+	}
+	if req.PublicKey != "" {
+		if _, err := identity.ParsePublicKey(req.PublicKey); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	// With "signing": true and no key of its own, the instance gets a
+	// server-generated key pair. The private key is returned only here.
+	var privateKey string
+	if req.PublicKey == "" && req.Signing {
+		pub, priv, err := identity.GenerateKey()
+		if err != nil {
+			s.logger.Error("instance key generation failed", "name", req.Name, "error", err)
+			writeError(w, http.StatusInternalServerError, "failed to generate key")
+			return
+		}
+		req.PublicKey, privateKey = pub, priv
+	}
 
 	inst, err := s.instanceReg.Register(r.Context(), req.Name, req.Workspace, req.Intent, req.Stack)
 	if err != nil {
@@ -787,9 +1580,29 @@ func (s *Server) handleInstanceRegister(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	s.logger.Info("instance registered", "id", inst.ID, "name", inst.Name)
-	s.audit(r.Context(), inst.Name, "instance.register", inst.ID, audit.DetailJSON(map[string]any{"workspace": req.Workspace}), "success")
-	writeJSON(w, http.StatusOK, inst)
+	if req.Project != "" {
+		if err := s.instanceReg.SetProject(r.Context(), inst.ID, req.Project); err != nil {
+			s.logger.Error("instance set project failed", "id", inst.ID, "error", err)
+			writeError(w, http.StatusInternalServerError, "failed to register instance")
+			return
+		}
+		inst.Project = req.Project
+	}
+	if req.PublicKey != "" {
+		if err := s.instanceReg.SetPublicKey(r.Context(), inst.ID, req.PublicKey); err != nil {
+			s.logger.Error("instance set public key failed", "id", inst.ID, "error", err)
+			writeError(w, http.StatusInternalServerError, "failed to register instance")
+			return
+		}
+		inst.PublicKey = req.PublicKey
+	}
+
+	s.logger.Info("instance registered", "id", inst.ID, "name", inst.Name, "signing", inst.PublicKey != "")
+	s.audit(r.Context(), inst.Name, "instance.register", inst.ID, audit.DetailJSON(map[string]any{"workspace": req.Workspace, "project": inst.Project, "signing": inst.PublicKey != ""}), "success")
+	writeJSON(w, http.StatusOK, struct {
+		*instances.Instance
+		PrivateKey string `json:"private_key,omitempty"`
+	}{inst, privateKey})
 }
 
 func (s *Server) handleInstanceActivate(w http.ResponseWriter, r *http.Request) {
@@ -842,9 +1655,59 @@ func (s *Server) handleInstanceDeregister(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	if s.tokens != nil {
+		if err := s.tokens.RevokeInstance(r.Context(), id); err != nil {
+			s.logger.Error("revoke instance tokens failed", "id", id, "error", err)
+		}
+	}
+	resp := map[string]any{"deleted": id}
+	detail := "{}"
+	if c := r.URL.Query().Get("cascade"); c == "1" || c == "true" {
+		// What fails here is left for the orphan cleaner to quarantine.
+		removed := s.cascadeInstance(r.Context(), id)
+		resp["cascade"] = removed
+		detail = audit.DetailJSON(map[string]any{"cascade": map[string]int{
+			"state_keys": len(removed.StateKeys), "messages": removed.Messages, "tasks_released": len(removed.TasksReleased),
+		}})
+	}
 	s.logger.Info("instance deregistered", "id", id)
-	s.audit(r.Context(), "", "instance.deregister", id, "{}", "success")
-	writeJSON(w, http.StatusOK, map[string]any{"deleted": id})
+	s.audit(r.Context(), "", "instance.deregister", id, detail, "success")
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// cascadeInstance removes what a deregistered instance leaves behind: the
+// state keys it owns and its inbox are deleted, and its task claims are
+// released.
+func (s *Server) cascadeInstance(ctx context.Context, id string) orphans.Sweep {
+	removed := orphans.Sweep{InstanceID: id, StateKeys: []string{}, TasksReleased: []string{}}
+	keys, err := s.stateStore.OwnedBy(ctx, id)
+	if err != nil {
+		s.logger.Error("cascade: list owned state failed", "id", id, "error", err)
+	}
+	for _, k := range keys {
+		if err := s.stateStore.Delete(ctx, k, "cascade:"+id); err != nil && !errors.Is(err, sql.ErrNoRows) {
+			s.logger.Error("cascade: delete state failed", "id", id, "key", k, "error", err)
+			continue
+		}
+		removed.StateKeys = append(removed.StateKeys, k)
+	}
+	if s.messages != nil {
+		n, err := s.messages.DeleteInbox(ctx, id)
+		if err != nil {
+			s.logger.Error("cascade: delete inbox failed", "id", id, "error", err)
+		}
+		removed.Messages = n
+	}
+	if s.tasks != nil {
+		released, err := s.tasks.ReleaseClaims(ctx, id)
+		if err != nil {
+			s.logger.Error("cascade: release tasks failed", "id", id, "error", err)
+		}
+		for _, t := range released {
+			removed.TasksReleased = append(removed.TasksReleased, t.ID)
+		}
+	}
+	return removed
 }
 
 // --- Validation handlers ---
@@ -886,8 +1749,7 @@ func (s *Server) handleValidateRulesPut(w http.ResponseWriter, r *http.Request)
 	project := r.PathValue("project")
 
 	var rules []specs.Rule
-	if err := json.NewDecoder(r.Body).Decode(&rules); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid JSON body")
+	if !s.decodeBody(w, r, &rules) {
 		return
 	}
 
@@ -913,25 +1775,105 @@ func (s *Server) handleValidate(w http.ResponseWriter, r *http.Request) {
 	project := r.PathValue("project")
 
 	var req specs.ValidateRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid JSON body")
+	if !s.decodeBody(w, r, &req) {
 		return
 	}
 
+	st := s.settingsFor(r.Context(), project)
+	if req.Stack == "" {
+		req.Stack = st.DefaultStack
+	}
+	req.SkipGlobal = !st.GlobalRules
+
 	violations, err := s.specReg.Validate(r.Context(), project, req)
 	if err != nil {
 		s.logger.Error("validation failed", "project", project, "error", err)
 		writeError(w, http.StatusInternalServerError, "validation failed")
 		return
 	}
+	// Violations in the project's baseline are not reported unless
+	// ?baseline=false.
+	baselined := 0
+	if r.URL.Query().Get("baseline") != "false" {
+		violations, baselined, err = s.specReg.FilterBaseline(r.Context(), project, req.Filename, req.Content, violations)
+		if err != nil {
+			s.logger.Error("validation baseline failed", "project", project, "error", err)
+			writeError(w, http.StatusInternalServerError, "validation failed")
+			return
+		}
+	}
 	if violations == nil {
 		violations = []specs.Violation{}
 	}
+	failed := slices.ContainsFunc(violations, func(v specs.Violation) bool { return v.Severity == "error" })
+	s.recordOutcome(r, projects.BudgetValidations, failed)
+	if format := r.URL.Query().Get("format"); format != "" {
+		s.writeAnnotations(w, format, violationFindings(req.Filename, violations))
+		return
+	}
 
 	writeJSON(w, http.StatusOK, map[string]any{
 		"project":    project,
 		"violations": violations,
 		"count":      len(violations),
+		"baselined":  baselined,
+	})
+}
+
+// handleValidateDiff validates the lines a unified diff adds, so a patch is
+// judged by what it changes rather than by the file it lands in.
+func (s *Server) handleValidateDiff(w http.ResponseWriter, r *http.Request) {
+	project := r.PathValue("project")
+
+	var req struct {
+		Diff  string `json:"diff"`
+		Stack string `json:"stack"`
+	}
+	if !s.decodeBody(w, r, &req) {
+		return
+	}
+	if strings.TrimSpace(req.Diff) == "" {
+		s.rejectFields(w, "diff is required", fieldError{Field: "diff", Problem: "is required"})
+		return
+	}
+	files, err := specs.ParseDiff(req.Diff)
+	if err != nil {
+		s.rejectFields(w, "invalid diff: "+err.Error(), fieldError{Field: "diff", Problem: err.Error()})
+		return
+	}
+
+	st := s.settingsFor(r.Context(), project)
+	vreq := specs.ValidateRequest{Stack: req.Stack, SkipGlobal: !st.GlobalRules}
+	if vreq.Stack == "" {
+		vreq.Stack = st.DefaultStack
+	}
+	skipBaseline := r.URL.Query().Get("baseline") == "false"
+	violations, baselined, err := s.specReg.ValidateDiff(r.Context(), project, files, vreq, skipBaseline)
+	if err != nil {
+		s.logger.Error("diff validation failed", "project", project, "error", err)
+		writeError(w, http.StatusInternalServerError, "validation failed")
+		return
+	}
+	if violations == nil {
+		violations = []specs.DiffViolation{}
+	}
+	failed := slices.ContainsFunc(violations, func(v specs.DiffViolation) bool { return v.Severity == "error" })
+	s.recordOutcome(r, projects.BudgetValidations, failed)
+	if format := r.URL.Query().Get("format"); format != "" {
+		s.writeAnnotations(w, format, diffViolationFindings(violations))
+		return
+	}
+
+	names := make([]string, len(files))
+	for i, f := range files {
+		names[i] = f.Filename
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"project":    project,
+		"files":      names,
+		"violations": violations,
+		"count":      len(violations),
+		"baselined":  baselined,
 	})
 }
 
@@ -962,28 +1904,87 @@ func (s *Server) handleContractValidate(w http.ResponseWriter, r *http.Request)
 	var req struct {
 		Endpoint  string         `json:"endpoint"`
 		Direction string         `json:"direction"`
+		Status    int            `json:"status"`
 		Payload   map[string]any `json:"payload"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid JSON body")
+	if !s.decodeBody(w, r, &req) {
 		return
 	}
 	if req.Endpoint == "" {
-		writeError(w, http.StatusBadRequest, "endpoint is required")
+		s.rejectFields(w, "endpoint is required", fieldError{Field: "endpoint", Problem: "is required"})
 		return
 	}
 	if req.Direction == "" {
 		req.Direction = "request"
 	}
 
-	violations := contracts.ValidatePayload(contract, req.Endpoint, req.Direction, req.Payload)
+	var violations []contracts.Violation
+	if req.Direction == "response" && req.Status != 0 {
+		violations = contracts.ValidateResponse(contract, req.Endpoint, req.Status, req.Payload)
+	} else {
+		violations = contracts.ValidatePayload(contract, req.Endpoint, req.Direction, req.Payload)
+	}
 	if violations == nil {
 		violations = []contracts.Violation{}
 	}
 
+	warnings := contracts.DeprecationWarnings(contract, req.Endpoint, req.Direction, req.Payload)
+	if warnings == nil {
+		warnings = []contracts.Warning{}
+	}
+	s.recordDeprecations(r.Context(), project, name, req.Endpoint, warnings)
+	s.recordOutcome(r, projects.BudgetContractValidations, len(violations) > 0)
+
 	writeJSON(w, http.StatusOK, map[string]any{
 		"valid":      len(violations) == 0,
 		"violations": violations,
+		"warnings":   warnings,
+	})
+}
+
+// recordDeprecations logs deprecated usage if a usage log is attached.
+func (s *Server) recordDeprecations(ctx context.Context, project, name, endpoint string, warnings []contracts.Warning) {
+	if s.deprecations == nil || len(warnings) == 0 {
+		return
+	}
+	if err := s.deprecations.Record(ctx, project, name, endpoint, warnings); err != nil {
+		s.logger.Error("record deprecated usage failed", "project", project, "name", name, "error", err)
+	}
+}
+
+func (s *Server) handleContractDeprecations(w http.ResponseWriter, r *http.Request) {
+	if s.deprecations == nil {
+		writeError(w, http.StatusServiceUnavailable, "deprecation tracking not configured")
+		return
+	}
+	project := r.PathValue("project")
+	name := r.PathValue("name")
+
+	var since time.Time
+	if v := r.URL.Query().Get("since"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid since duration: "+v)
+			return
+		}
+		since = time.Now().Add(-d)
+	}
+
+	usage, err := s.deprecations.Report(r.Context(), project, name, since)
+	if err != nil {
+		s.logger.Error("deprecation report failed", "project", project, "name", name, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to get deprecation report")
+		return
+	}
+	if usage == nil {
+		usage = []contracts.DeprecatedUsage{}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"project": project,
+		"name":    name,
+		"usage":   usage,
+		"count":   len(usage),
 	})
 }
 
@@ -1014,16 +2015,15 @@ func (s *Server) handleContractTest(w http.ResponseWriter, r *http.Request) {
 		BaseURL  string         `json:"base_url"`
 		TestData map[string]any `json:"test_data"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid JSON body")
+	if !s.decodeBody(w, r, &req) {
 		return
 	}
 	if req.Endpoint == "" {
-		writeError(w, http.StatusBadRequest, "endpoint is required")
+		s.rejectFields(w, "endpoint is required", fieldError{Field: "endpoint", Problem: "is required"})
 		return
 	}
 	if req.BaseURL == "" {
-		writeError(w, http.StatusBadRequest, "base_url is required")
+		s.rejectFields(w, "base_url is required", fieldError{Field: "base_url", Problem: "is required"})
 		return
 	}
 
@@ -1032,6 +2032,15 @@ func (s *Server) handleContractTest(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
+	s.recordDeprecations(r.Context(), project, name, req.Endpoint, result.Warnings)
+	if format := r.URL.Query().Get("format"); format != "" {
+		file := r.URL.Query().Get("file")
+		if file == "" {
+			file = project + "/" + name
+		}
+		s.writeAnnotations(w, format, contractTestFindings(file, result))
+		return
+	}
 
 	writeJSON(w, http.StatusOK, map[string]any{
 		"valid":               len(result.RequestViolations) == 0 && len(result.ResponseViolations) == 0 && result.Error == "",
@@ -1039,6 +2048,7 @@ func (s *Server) handleContractTest(w http.ResponseWriter, r *http.Request) {
 		"status_code":         result.StatusCode,
 		"request_violations":  result.RequestViolations,
 		"response_violations": result.ResponseViolations,
+		"warnings":            result.Warnings,
 		"error":               result.Error,
 	})
 }
@@ -1047,20 +2057,23 @@ func (s *Server) handleContractTest(w http.ResponseWriter, r *http.Request) {
 
 func (s *Server) handleRulesPropose(w http.ResponseWriter, r *http.Request) {
 	var rule specs.Rule
-	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid JSON body")
+	if !s.decodeBody(w, r, &rule) {
 		return
 	}
 	if rule.Project == "" {
-		writeError(w, http.StatusBadRequest, "project is required")
+		s.rejectFields(w, "project is required", fieldError{Field: "project", Problem: "is required"})
+		return
+	}
+	if id := identityFromRequest(r); id != nil && !id.OwnsProject(rule.Project) {
+		writeError(w, http.StatusForbidden, "token "+id.Name+" is limited to project "+id.Project)
 		return
 	}
 	if rule.RuleID == "" {
-		writeError(w, http.StatusBadRequest, "rule_id is required")
+		s.rejectFields(w, "rule_id is required", fieldError{Field: "rule_id", Problem: "is required"})
 		return
 	}
 	if rule.Pattern == "" {
-		writeError(w, http.StatusBadRequest, "pattern is required")
+		s.rejectFields(w, "pattern is required", fieldError{Field: "pattern", Problem: "is required"})
 		return
 	}
 
@@ -1072,11 +2085,18 @@ func (s *Server) handleRulesPropose(w http.ResponseWriter, r *http.Request) {
 
 	s.logger.Info("rule proposed", "project", rule.Project, "rule_id", rule.RuleID, "proposed_by", rule.ProposedBy)
 	s.audit(r.Context(), rule.ProposedBy, "rule.propose", rule.Project+"/"+rule.RuleID, "{}", "success")
-	writeJSON(w, http.StatusOK, map[string]any{
+	resp := map[string]any{
 		"project": rule.Project,
 		"rule_id": rule.RuleID,
 		"status":  "proposed",
-	})
+	}
+	if decision := s.autoAcceptRule(r.Context(), rule); decision != nil {
+		resp["auto_accept"] = decision
+		if decision.Accepted {
+			resp["status"] = "accepted"
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
 }
 
 func (s *Server) handleRulesAccept(w http.ResponseWriter, r *http.Request) {
@@ -1149,14 +2169,19 @@ func (s *Server) handleRulesExport(w http.ResponseWriter, r *http.Request) {
 
 func (s *Server) handleRulesImport(w http.ResponseWriter, r *http.Request) {
 	var rules []specs.Rule
-	if err := json.NewDecoder(r.Body).Decode(&rules); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid JSON body")
+	if !s.decodeBody(w, r, &rules) {
 		return
 	}
 	if len(rules) == 0 {
 		writeError(w, http.StatusBadRequest, "empty rules array")
 		return
 	}
+	if isDryRun(r) {
+		plan := newChangePlan()
+		s.planRules(r.Context(), plan, rules)
+		writeDryRun(w, plan)
+		return
+	}
 
 	count, err := s.specReg.ImportRules(r.Context(), rules)
 	if err != nil {
@@ -1191,6 +2216,7 @@ func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
 
 	// Token tax calculations.
 	mcpCount := s.mcpCalls.Load()
+	dataCount := min(s.mcpData.Load(), mcpCount)
 	restCount := s.restCalls.Load()
 	total := mcpCount + restCount
 	savingsPercent := 0.0
@@ -1207,6 +2233,8 @@ func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
 		"dashboard_bind": s.config.DashboardBind,
 		"token_tax": map[string]any{
 			"mcp_calls":            mcpCount,
+			"mcp_data_calls":       dataCount,
+			"mcp_discovery_calls":  mcpCount - dataCount,
 			"rest_calls":           restCount,
 			"total_calls":          total,
 			"mcp_estimated_tokens": mcpCount * estimatedTokensPerMCPCall,
@@ -1216,12 +2244,6 @@ func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func (s *Server) handleMetricsReset(w http.ResponseWriter, r *http.Request) {
-	s.mcpCalls.Store(0)
-	s.restCalls.Store(0)
-	writeJSON(w, http.StatusOK, map[string]any{"reset": true})
-}
-
 // --- Dashboard HTMX handlers ---
 
 // handleDashboardRules renders the full rules page.
@@ -1382,7 +2404,7 @@ func (s *Server) handleInstancesStale(w http.ResponseWriter, r *http.Request) {
 	if items == nil {
 		items = []instances.Summary{}
 	}
-	writeJSON(w, http.StatusOK, items)
+	writeJSON(w, http.StatusOK, ownInstances(r, items))
 }
 
 // handleLivenessCheck forces an immediate liveness check and returns newly-staled instances.
@@ -1414,20 +2436,41 @@ func (s *Server) handleWebhookCreate(w http.ResponseWriter, r *http.Request) {
 		ID       string   `json:"id"`
 		URL      string   `json:"url"`
 		Patterns []string `json:"patterns"`
-		Secret   string   `json:"secret"`
+		Secret    string   `json:"secret"`
+		Project   string   `json:"project"`
+		Transform string   `json:"transform"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid JSON body")
+	if !s.decodeBody(w, r, &req) {
 		return
 	}
-	if req.ID == "" || req.URL == "" {
-		writeError(w, http.StatusBadRequest, "id and url are required")
+	if missing := requiredFields("id", req.ID, "url", req.URL); len(missing) > 0 {
+		s.rejectFields(w, "id and url are required", missing...)
 		return
 	}
+	if !s.checkTransform(w, req.Transform) {
+		return
+	}
+	if req.Project != "" {
+		defaults := s.settingsFor(r.Context(), req.Project).Webhooks
+		if len(req.Patterns) == 0 {
+			req.Patterns = defaults.Patterns
+		}
+		if req.Secret == "" {
+			req.Secret = defaults.Secret
+		}
+	}
+	id := identityFromRequest(r)
 	if len(req.Patterns) == 0 {
 		req.Patterns = []string{"*"}
+		if id != nil && !id.CrossProject() {
+			req.Patterns = []string{strings.ToLower(id.Project) + ".*"}
+		}
+	}
+	if id != nil && (req.Project != "" && !id.OwnsProject(req.Project) || !ownsPatterns(id, req.Patterns)) {
+		writeError(w, http.StatusForbidden, "token "+id.Name+" may only watch "+strings.ToLower(id.Project)+".* topics")
+		return
 	}
-	wh, err := s.webhookDisp.Register(r.Context(), req.ID, req.URL, req.Patterns, req.Secret)
+	wh, err := s.webhookDisp.Register(r.Context(), req.ID, req.URL, req.Patterns, req.Secret, req.Transform)
 	if err != nil {
 		s.logger.Error("webhook create failed", "id", req.ID, "error", err)
 		writeError(w, http.StatusInternalServerError, "failed to create webhook")
@@ -1449,10 +2492,14 @@ func (s *Server) handleWebhookList(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusInternalServerError, "failed to list webhooks")
 		return
 	}
-	if hooks == nil {
-		hooks = []webhooks.Webhook{}
+	id := identityFromRequest(r)
+	own := []webhooks.Webhook{}
+	for _, wh := range hooks {
+		if id == nil || ownsPatterns(id, wh.Patterns) {
+			own = append(own, wh)
+		}
 	}
-	writeJSON(w, http.StatusOK, hooks)
+	writeJSON(w, http.StatusOK, own)
 }
 
 func (s *Server) handleWebhookDelete(w http.ResponseWriter, r *http.Request) {
@@ -1544,8 +2591,7 @@ func (s *Server) handleInstanceSetCapabilities(w http.ResponseWriter, r *http.Re
 	var req struct {
 		Capabilities []string `json:"capabilities"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid JSON body")
+	if !s.decodeBody(w, r, &req) {
 		return
 	}
 	if req.Capabilities == nil {
@@ -1580,20 +2626,24 @@ func (s *Server) handleTemplateCreate(w http.ResponseWriter, r *http.Request) {
 		Kind        string   `json:"kind"`
 		Data        json.RawMessage `json:"data"`
 		Tags        []string `json:"tags"`
+		Params      []templates.Param `json:"params"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid JSON body")
+	if !s.decodeBody(w, r, &req) {
 		return
 	}
-	if req.ID == "" || req.Name == "" {
-		writeError(w, http.StatusBadRequest, "id and name are required")
+	if missing := requiredFields("id", req.ID, "name", req.Name); len(missing) > 0 {
+		s.rejectFields(w, "id and name are required", missing...)
 		return
 	}
 	if req.Tags == nil {
 		req.Tags = []string{}
 	}
+	if err := templates.ValidateParams(req.Params); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
-	tmpl, err := s.templateStore.Create(r.Context(), req.ID, req.Name, req.Description, req.Kind, req.Data, req.Tags)
+	tmpl, err := s.templateStore.Create(r.Context(), req.ID, req.Name, req.Description, req.Kind, req.Data, req.Tags, req.Params)
 	if err != nil {
 		s.logger.Error("template create failed", "id", req.ID, "error", err)
 		writeError(w, http.StatusInternalServerError, "failed to create template")
@@ -1671,36 +2721,43 @@ func (s *Server) handleTemplateApply(w http.ResponseWriter, r *http.Request) {
 	}
 	id := r.PathValue("id")
 	var req struct {
-		Project string `json:"project"`
+		Project string         `json:"project"`
+		Vars    map[string]any `json:"vars"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid JSON body")
+	if !s.decodeBody(w, r, &req) {
 		return
 	}
 	if req.Project == "" {
-		writeError(w, http.StatusBadRequest, "project is required")
+		s.rejectFields(w, "project is required", fieldError{Field: "project", Problem: "is required"})
+		return
+	}
+	if id := identityFromRequest(r); id != nil && !id.OwnsProject(req.Project) {
+		writeError(w, http.StatusForbidden, "token "+id.Name+" is limited to project "+id.Project)
+		return
+	}
+	vars, err := templates.StringVars(req.Vars)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	data, kind, err := s.templateStore.Apply(r.Context(), id)
+	data, kind, err := s.templateStore.Apply(r.Context(), id, vars)
 	if errors.Is(err, sql.ErrNoRows) {
 		writeError(w, http.StatusNotFound, "template not found: "+id)
 		return
 	}
+	if errors.Is(err, templates.ErrInvalidVars) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 	if err != nil {
 		s.logger.Error("template apply failed", "id", id, "error", err)
 		writeError(w, http.StatusInternalServerError, "failed to apply template")
 		return
 	}
 
-	// Apply based on kind.
-	switch kind {
-	case "contracts":
-		// Store as a spec.
-		_, err = s.specReg.Put(r.Context(), req.Project, id, data)
-	case "rules":
-		// Import rules via the spec registry's import mechanism.
-		var rules []specs.Rule
+	var rules []specs.Rule
+	if kind == "rules" {
 		if jsonErr := json.Unmarshal(data, &rules); jsonErr != nil {
 			writeError(w, http.StatusBadRequest, "template data is not valid rules JSON")
 			return
@@ -1708,6 +2765,26 @@ func (s *Server) handleTemplateApply(w http.ResponseWriter, r *http.Request) {
 		for i := range rules {
 			rules[i].Project = req.Project
 		}
+	}
+
+	if isDryRun(r) {
+		plan := newChangePlan()
+		if kind == "rules" {
+			s.planRules(r.Context(), plan, rules)
+		} else {
+			s.planSpec(r.Context(), plan, req.Project, id)
+		}
+		writeDryRun(w, plan)
+		return
+	}
+
+	// Apply based on kind.
+	switch kind {
+	case "contracts":
+		// Store as a spec.
+		_, err = s.specReg.Put(r.Context(), req.Project, id, data)
+	case "rules":
+		// Import rules via the spec registry's import mechanism.
 		_, err = s.specReg.ImportRules(r.Context(), rules)
 	default:
 		// For "bundle" or unknown kinds, store as a spec.
@@ -1720,7 +2797,7 @@ func (s *Server) handleTemplateApply(w http.ResponseWriter, r *http.Request) {
 	}
 
 	s.logger.Info("template applied", "id", id, "project", req.Project, "kind", kind)
-	s.audit(r.Context(), "", "template.apply", id, audit.DetailJSON(map[string]any{"project": req.Project, "kind": kind}), "success")
+	s.audit(r.Context(), "", "template.apply", id, audit.DetailJSON(map[string]any{"project": req.Project, "kind": kind, "vars": vars}), "success")
 	writeJSON(w, http.StatusOK, map[string]any{"applied": id, "project": req.Project, "kind": kind})
 }
 
@@ -1743,7 +2820,18 @@ func (s *Server) handleAuditQuery(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	entries, err := s.auditLog.Query(r.Context(), actor, action, from, to, limit)
+	var entries []audit.Entry
+	var err error
+	if v := q.Get("after_id"); v != "" {
+		afterID, perr := strconv.ParseInt(v, 10, 64)
+		if perr != nil || afterID < 0 {
+			writeError(w, http.StatusBadRequest, "after_id must be a non-negative integer")
+			return
+		}
+		entries, err = s.auditLog.Since(r.Context(), afterID, actor, action, limit)
+	} else {
+		entries, err = s.auditLog.Query(r.Context(), actor, action, from, to, limit)
+	}
 	if err != nil {
 		s.logger.Error("audit query failed", "error", err)
 		writeError(w, http.StatusInternalServerError, "failed to query audit log")
@@ -1772,27 +2860,145 @@ func (s *Server) handleAuditSummary(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, summary)
 }
 
+// handleAuditExport streams every entry in the range as NDJSON (default)
+// or CSV, oldest first, for archiving before retention prunes it.
+func (s *Server) handleAuditExport(w http.ResponseWriter, r *http.Request) {
+	if s.auditLog == nil {
+		writeError(w, http.StatusServiceUnavailable, "audit log not configured")
+		return
+	}
+	q := r.URL.Query()
+	format := q.Get("format")
+	if format == "" {
+		format = "ndjson"
+	}
+
+	var write func(audit.Entry) error
+	var flush func() error
+	switch format {
+	case "ndjson":
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		enc := json.NewEncoder(w)
+		write = func(e audit.Entry) error { return enc.Encode(e) }
+		flush = func() error { return nil }
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"id", "timestamp", "actor", "action", "resource", "detail", "outcome"})
+		write = func(e audit.Entry) error {
+			return cw.Write([]string{
+				strconv.FormatInt(e.ID, 10), e.Timestamp.UTC().Format(time.RFC3339),
+				e.Actor, e.Action, e.Resource, e.Detail, e.Outcome,
+			})
+		}
+		flush = func() error { cw.Flush(); return cw.Error() }
+	default:
+		writeError(w, http.StatusBadRequest, "format must be ndjson or csv")
+		return
+	}
+	w.Header().Set("Content-Disposition", `attachment; filename="koor-audit.`+format+`"`)
+
+	err := s.auditLog.Export(r.Context(), q.Get("actor"), q.Get("action"), q.Get("from"), q.Get("to"), write)
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		// Headers are already sent; the truncated body is all we can signal.
+		s.logger.Error("audit export failed", "error", err)
+	}
+}
+
 // --- Agent metrics handlers ---
 
 func (s *Server) handleAgentMetrics(w http.ResponseWriter, r *http.Request) {
+	s.serveAgentMetrics(w, r, r.URL.Query().Get("instance_id"))
+}
+
+func (s *Server) handleAgentMetricsGet(w http.ResponseWriter, r *http.Request) {
+	s.serveAgentMetrics(w, r, r.PathValue("id"))
+}
+
+// serveAgentMetrics answers both agent metrics endpoints: per-period rows
+// for one agent, per-agent totals for all of them, or, with ?agg or
+// ?group_by, aggregates over the hourly buckets. ?format=csv returns any of
+// them as CSV.
+func (s *Server) serveAgentMetrics(w http.ResponseWriter, r *http.Request, instanceID string) {
 	if s.metricsStore == nil {
 		writeError(w, http.StatusServiceUnavailable, "agent metrics not configured")
 		return
 	}
-	instanceID := r.URL.Query().Get("instance_id")
-	period := r.URL.Query().Get("period")
+	q := r.URL.Query()
+	period := q.Get("period")
+	format := q.Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		writeError(w, http.StatusBadRequest, "format must be json or csv")
+		return
+	}
+
+	if q.Has("agg") || q.Has("group_by") {
+		aq := observability.AggregateQuery{
+			InstanceID: instanceID,
+			Metric:     q.Get("metric"),
+			Period:     period,
+			GroupBy:    q.Get("group_by"),
+			Funcs:      []string{"sum"},
+		}
+		if v := q.Get("agg"); v != "" {
+			aq.Funcs = strings.Split(v, ",")
+		}
+		if v := q.Get("since"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				writeError(w, http.StatusBadRequest, "invalid since duration: "+v)
+				return
+			}
+			aq.Since = time.Now().Add(-d)
+		}
+		if err := observability.ValidateAggregate(aq); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		aggs, err := s.metricsStore.Aggregate(r.Context(), aq)
+		if err != nil {
+			s.logger.Error("agent metrics aggregate failed", "error", err)
+			writeError(w, http.StatusInternalServerError, "failed to aggregate agent metrics")
+			return
+		}
+		if format != "csv" {
+			writeJSON(w, http.StatusOK, aggs)
+			return
+		}
+		rows := [][]string{append([]string{"group", "metric_name", "samples"}, aq.Funcs...)}
+		for _, a := range aggs {
+			row := []string{a.Group, a.MetricName, strconv.Itoa(a.Samples)}
+			for _, fn := range aq.Funcs {
+				row = append(row, strconv.FormatFloat(a.Values[fn], 'f', -1, 64))
+			}
+			rows = append(rows, row)
+		}
+		writeCSV(w, "koor-metrics.csv", rows)
+		return
+	}
 
 	if instanceID != "" {
 		metrics, err := s.metricsStore.QueryAgent(r.Context(), instanceID, period)
 		if err != nil {
-			s.logger.Error("agent metrics query failed", "error", err)
+			s.logger.Error("agent metrics query failed", "id", instanceID, "error", err)
 			writeError(w, http.StatusInternalServerError, "failed to query agent metrics")
 			return
 		}
 		if metrics == nil {
 			metrics = []observability.AgentMetric{}
 		}
-		writeJSON(w, http.StatusOK, metrics)
+		if format != "csv" {
+			writeJSON(w, http.StatusOK, metrics)
+			return
+		}
+		rows := [][]string{{"instance_id", "metric_name", "metric_value", "period"}}
+		for _, m := range metrics {
+			rows = append(rows, []string{m.InstanceID, m.MetricName, formatInt(m.MetricValue), m.Period})
+		}
+		writeCSV(w, "koor-metrics.csv", rows)
 		return
 	}
 
@@ -1806,27 +3012,30 @@ func (s *Server) handleAgentMetrics(w http.ResponseWriter, r *http.Request) {
 	if summaries == nil {
 		summaries = []observability.AgentSummary{}
 	}
-	writeJSON(w, http.StatusOK, summaries)
-}
-
-func (s *Server) handleAgentMetricsGet(w http.ResponseWriter, r *http.Request) {
-	if s.metricsStore == nil {
-		writeError(w, http.StatusServiceUnavailable, "agent metrics not configured")
+	if format != "csv" {
+		writeJSON(w, http.StatusOK, summaries)
 		return
 	}
-	id := r.PathValue("id")
-	period := r.URL.Query().Get("period")
-
-	metrics, err := s.metricsStore.QueryAgent(r.Context(), id, period)
-	if err != nil {
-		s.logger.Error("agent metrics get failed", "id", id, "error", err)
-		writeError(w, http.StatusInternalServerError, "failed to get agent metrics")
-		return
-	}
-	if metrics == nil {
-		metrics = []observability.AgentMetric{}
+	rows := [][]string{{"instance_id", "metric_name", "total"}}
+	for _, sum := range summaries {
+		names := make([]string, 0, len(sum.Metrics))
+		for name := range sum.Metrics {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			rows = append(rows, []string{sum.InstanceID, name, formatInt(sum.Metrics[name])})
+		}
 	}
-	writeJSON(w, http.StatusOK, metrics)
+	writeCSV(w, "koor-metrics.csv", rows)
+}
+
+// writeCSV writes rows, the first being the header, as a CSV attachment.
+func writeCSV(w http.ResponseWriter, filename string, rows [][]string) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	cw := csv.NewWriter(w)
+	cw.WriteAll(rows)
 }
 
 // audit is a helper that logs to the audit log if configured. Errors are logged but don't fail the request.
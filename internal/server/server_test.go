@@ -1,27 +1,51 @@
 package server_test
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"maps"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
-	"github.com/DavidRHerbert/koor/internal/audit"
-	"github.com/DavidRHerbert/koor/internal/compliance"
+	"github.com/DavidRHerbert/koor/internal/contracts"
 	"github.com/DavidRHerbert/koor/internal/db"
+	"github.com/DavidRHerbert/koor/internal/encryption"
 	"github.com/DavidRHerbert/koor/internal/events"
+	"github.com/DavidRHerbert/koor/internal/federation"
+	"github.com/DavidRHerbert/koor/internal/identity"
 	"github.com/DavidRHerbert/koor/internal/instances"
+	"github.com/DavidRHerbert/koor/internal/liveness"
+	"github.com/DavidRHerbert/koor/internal/messages"
+	"github.com/DavidRHerbert/koor/internal/milestones"
 	"github.com/DavidRHerbert/koor/internal/observability"
+	"github.com/DavidRHerbert/koor/internal/orphans"
+	"github.com/DavidRHerbert/koor/internal/projects"
+	"github.com/DavidRHerbert/koor/internal/replication"
+	"github.com/DavidRHerbert/koor/internal/search"
 	"github.com/DavidRHerbert/koor/internal/server"
 	"github.com/DavidRHerbert/koor/internal/specs"
 	"github.com/DavidRHerbert/koor/internal/state"
-	"github.com/DavidRHerbert/koor/internal/templates"
+	"github.com/DavidRHerbert/koor/internal/tasks"
+	"github.com/DavidRHerbert/koor/internal/tenants"
+	"github.com/DavidRHerbert/koor/internal/tokens"
+	"github.com/DavidRHerbert/koor/internal/users"
 	"github.com/DavidRHerbert/koor/internal/webhooks"
+	"github.com/DavidRHerbert/koor/pkg/koortest"
+	"nhooyr.io/websocket"
 )
 
 func testServer(t *testing.T, authToken string) *httptest.Server {
@@ -114,6 +138,63 @@ func TestStateList(t *testing.T) {
 	}
 }
 
+func TestStateListPrefixAndPages(t *testing.T) {
+	env := koortest.New(t)
+	ctx := context.Background()
+	for _, key := range []string{"TW/a", "TW/b", "TW/c", "TWX/d", "Other/e"} {
+		env.SeedState(key, `1`)
+	}
+
+	var list []state.Summary
+	resp, _ := http.Get(env.URL + "/api/state?prefix=TW/")
+	json.NewDecoder(resp.Body).Decode(&list)
+	resp.Body.Close()
+	if len(list) != 3 || list[0].Key != "TW/a" {
+		t.Errorf("prefix list = %+v", list)
+	}
+
+	type page struct {
+		Keys    []state.Summary `json:"keys"`
+		HasMore bool            `json:"has_more"`
+		Cursor  string          `json:"cursor"`
+	}
+	get := func(token, query string) (int, page) {
+		t.Helper()
+		req, _ := http.NewRequest("GET", env.URL+"/api/state?"+query, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var p page
+		json.NewDecoder(resp.Body).Decode(&p)
+		return resp.StatusCode, p
+	}
+	_, p := get("", "prefix=TW/&limit=2")
+	if len(p.Keys) != 2 || !p.HasMore || p.Cursor != "TW/b" {
+		t.Fatalf("first page = %+v", p)
+	}
+	_, p = get("", "prefix=TW/&limit=2&cursor="+url.QueryEscape(p.Cursor))
+	if len(p.Keys) != 1 || p.Keys[0].Key != "TW/c" || p.HasMore || p.Cursor != "TW/c" {
+		t.Errorf("second page = %+v", p)
+	}
+	if status, _ := get("", "limit=zero"); status != 400 {
+		t.Errorf("bad limit: expected 400, got %d", status)
+	}
+
+	// A project token is narrowed to its keys, and may not list others.
+	_, tok, _ := env.Tokens.Create(ctx, tokens.Token{Name: "tw", Project: "TW", Scopes: []string{"read"}})
+	if _, p = get(tok, "limit=10"); len(p.Keys) != 3 || p.HasMore {
+		t.Errorf("project token page = %+v", p)
+	}
+	if status, _ := get(tok, "prefix=Other/&limit=10"); status != 403 {
+		t.Errorf("foreign prefix: expected 403, got %d", status)
+	}
+}
+
 func TestStateDelete(t *testing.T) {
 	ts := testServer(t, "")
 
@@ -145,6 +226,55 @@ func TestStateGetNotFound(t *testing.T) {
 	}
 }
 
+func TestStateConditionalPut(t *testing.T) {
+	ts := testServer(t, "")
+	put := func(value string, headers map[string]string) (*http.Response, map[string]any) {
+		req, _ := http.NewRequest("PUT", ts.URL+"/api/state/shared", strings.NewReader(value))
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var body map[string]any
+		json.NewDecoder(resp.Body).Decode(&body)
+		return resp, body
+	}
+
+	resp, _ := put(`{"n":1}`, map[string]string{"X-Koor-Expected-Version": "0"})
+	if resp.StatusCode != 200 {
+		t.Fatalf("create-only: expected 200, got %d", resp.StatusCode)
+	}
+	etag := resp.Header.Get("ETag")
+
+	// Two agents read version 1; the first write wins.
+	resp, _ = put(`{"n":2}`, map[string]string{"If-Match": etag})
+	if resp.StatusCode != 200 {
+		t.Fatalf("If-Match current: expected 200, got %d", resp.StatusCode)
+	}
+	resp, body := put(`{"n":3}`, map[string]string{"If-Match": etag})
+	if resp.StatusCode != 409 {
+		t.Fatalf("If-Match stale: expected 409, got %d", resp.StatusCode)
+	}
+	if body["current_version"] != float64(2) || resp.Header.Get("ETag") == etag {
+		t.Errorf("conflict should report the current version: %v", body)
+	}
+	resp, _ = put(`{"n":3}`, map[string]string{"X-Koor-Expected-Version": "1"})
+	if resp.StatusCode != 409 {
+		t.Errorf("stale expected version: expected 409, got %d", resp.StatusCode)
+	}
+	resp, _ = put(`{"n":3}`, map[string]string{"X-Koor-Expected-Version": "2"})
+	if resp.StatusCode != 200 {
+		t.Errorf("current expected version: expected 200, got %d", resp.StatusCode)
+	}
+	resp, _ = put(`{"n":4}`, map[string]string{"X-Koor-Expected-Version": "two"})
+	if resp.StatusCode != 400 {
+		t.Errorf("bad expected version: expected 400, got %d", resp.StatusCode)
+	}
+}
+
 func TestSpecsRoundTrip(t *testing.T) {
 	ts := testServer(t, "")
 
@@ -186,6 +316,56 @@ func TestSpecsList(t *testing.T) {
 	}
 }
 
+func TestSpecVersionRefs(t *testing.T) {
+	env := koortest.New(t)
+	ctx := context.Background()
+	env.Specs.Put(ctx, "TW", "api", []byte(`{"v":1}`))
+	env.Specs.Put(ctx, "TW", "api", []byte(`{"v":2}`))
+
+	resp, _ := http.Get(env.URL + "/api/specs/TW/api?version=1")
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || string(body) != `{"v":1}` || resp.Header.Get("X-Koor-Version") != "1" {
+		t.Errorf("version 1: expected old data, got %d %s", resp.StatusCode, body)
+	}
+	resp, _ = http.Get(env.URL + "/api/specs/TW/api?version=5")
+	resp.Body.Close()
+	if resp.StatusCode != 404 {
+		t.Errorf("unknown version: expected 404, got %d", resp.StatusCode)
+	}
+
+	// A task's unversioned spec_ref is pinned when the task is created.
+	resp, _ = http.Post(env.URL+"/api/tasks", "application/json",
+		strings.NewReader(`{"project":"TW","title":"build client","payload":{"spec_ref":"TW/api"}}`))
+	var task struct {
+		Payload map[string]any `json:"payload"`
+	}
+	json.NewDecoder(resp.Body).Decode(&task)
+	resp.Body.Close()
+	if resp.StatusCode != 201 || task.Payload["spec_ref"] != "TW/api@v2" {
+		t.Errorf("task create: expected spec_ref pinned to v2, got %d %v", resp.StatusCode, task.Payload)
+	}
+	resp, _ = http.Post(env.URL+"/api/tasks", "application/json",
+		strings.NewReader(`{"project":"TW","title":"x","payload":{"spec_ref":"TW/missing"}}`))
+	resp.Body.Close()
+	if resp.StatusCode != 400 {
+		t.Errorf("task with unknown spec_ref: expected 400, got %d", resp.StatusCode)
+	}
+
+	// State values may reference a version, which must exist.
+	for body, want := range map[string]int{
+		`{"spec_ref":"TW/api@v1","status":"building"}`: 200,
+		`{"spec_ref":"TW/api@v9"}`:                     400,
+	} {
+		req, _ := http.NewRequest("PUT", env.URL+"/api/state/TW/client", strings.NewReader(body))
+		resp, _ := http.DefaultClient.Do(req)
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("state put %s: expected %d, got %d", body, want, resp.StatusCode)
+		}
+	}
+}
+
 func TestAuthRequired(t *testing.T) {
 	ts := testServer(t, "secret123")
 
@@ -280,6 +460,46 @@ func TestEventsPublishValidation(t *testing.T) {
 	}
 }
 
+func TestEventsPublishBatch(t *testing.T) {
+	env := koortest.New(t)
+	ctx := context.Background()
+
+	resp, err := http.Post(env.URL+"/api/events/publish-batch", "application/json", strings.NewReader(
+		`[{"topic":"build.started","data":{"step":1}},{"topic":"build.progress","data":{"step":2}},{"topic":"build.done"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result struct {
+		Published int            `json:"published"`
+		Events    []events.Event `json:"events"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || result.Published != 3 || len(result.Events) != 3 {
+		t.Fatalf("publish-batch: status %d, result %+v", resp.StatusCode, result)
+	}
+	if result.Events[0].Topic != "build.started" || result.Events[2].ID <= result.Events[0].ID {
+		t.Errorf("events out of order: %+v", result.Events)
+	}
+	entries, _ := env.Audit.Query(ctx, "", "event.publish_batch", "", "", 0)
+	if len(entries) != 1 {
+		t.Errorf("expected 1 event.publish_batch audit entry, got %d", len(entries))
+	}
+
+	// One bad event rejects the whole batch.
+	for _, body := range []string{`[]`, `[{"topic":"build.x"},{"data":1}]`, `[{"topic":"build.x"},{"topic":"_internal.x"}]`} {
+		resp, _ = http.Post(env.URL+"/api/events/publish-batch", "application/json", strings.NewReader(body))
+		resp.Body.Close()
+		if resp.StatusCode != 400 {
+			t.Errorf("%s: expected 400, got %d", body, resp.StatusCode)
+		}
+	}
+	history, _ := env.Events.History(ctx, 10, "")
+	if len(history) != 3 {
+		t.Errorf("expected 3 stored events, got %d", len(history))
+	}
+}
+
 func TestEventsHistoryEmpty(t *testing.T) {
 	ts := testServer(t, "")
 	resp, _ := http.Get(ts.URL + "/api/events/history")
@@ -293,6 +513,95 @@ func TestEventsHistoryEmpty(t *testing.T) {
 	}
 }
 
+func TestEventsLatest(t *testing.T) {
+	ts := testServer(t, "")
+	for _, body := range []string{
+		`{"topic":"tw.controller.assigned.backend","data":{"task":"a"}}`,
+		`{"topic":"tw.controller.assigned.frontend","data":{"task":"b"}}`,
+		`{"topic":"tw.controller.assigned.backend","data":{"task":"c"}}`,
+	} {
+		resp, _ := http.Post(ts.URL+"/api/events/publish", "application/json", strings.NewReader(body))
+		resp.Body.Close()
+	}
+
+	resp, _ := http.Get(ts.URL + "/api/events/latest?topic=tw.controller.assigned.backend")
+	var latest []struct {
+		Topic string          `json:"topic"`
+		Data  json.RawMessage `json:"data"`
+	}
+	json.NewDecoder(resp.Body).Decode(&latest)
+	resp.Body.Close()
+	if len(latest) != 1 || string(latest[0].Data) != `{"task":"c"}` {
+		t.Errorf("unexpected latest backend assignment: %+v", latest)
+	}
+
+	resp, _ = http.Get(ts.URL + "/api/events/latest?topic=tw.controller.assigned.*")
+	json.NewDecoder(resp.Body).Decode(&latest)
+	resp.Body.Close()
+	if len(latest) != 2 {
+		t.Errorf("expected one event per assigned topic: %+v", latest)
+	}
+
+	resp, _ = http.Get(ts.URL + "/api/events/latest?topic=nothing")
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || string(body) != "[]\n" {
+		t.Errorf("expected empty array, got %d: %s", resp.StatusCode, body)
+	}
+}
+
+func TestEventsHistoryCursor(t *testing.T) {
+	ts := testServer(t, "")
+	for _, topic := range []string{"api.a", "ui.b", "api.c", "api.d"} {
+		resp, _ := http.Post(ts.URL+"/api/events/publish", "application/json",
+			strings.NewReader(`{"topic":"`+topic+`","data":1}`))
+		resp.Body.Close()
+	}
+
+	type page struct {
+		Events  []struct{ ID int64 } `json:"events"`
+		HasMore bool                 `json:"has_more"`
+		Cursor  int64                `json:"cursor"`
+	}
+	get := func(query string) page {
+		t.Helper()
+		resp, err := http.Get(ts.URL + "/api/events/history?" + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != 200 {
+			t.Fatalf("%s: expected 200, got %d", query, resp.StatusCode)
+		}
+		var p page
+		json.NewDecoder(resp.Body).Decode(&p)
+		return p
+	}
+
+	p := get("after_id=0&topic=api.*&limit=2")
+	if len(p.Events) != 2 || !p.HasMore || p.Cursor != 3 {
+		t.Errorf("first page: %+v", p)
+	}
+	p = get("after_id=3&topic=api.*&limit=2")
+	if len(p.Events) != 1 || p.HasMore || p.Cursor != 4 {
+		t.Errorf("second page: %+v", p)
+	}
+	p = get("after_id=4")
+	if len(p.Events) != 0 || p.HasMore || p.Cursor != 4 {
+		t.Errorf("empty page should keep the cursor: %+v", p)
+	}
+	p = get("before_id=4&limit=2")
+	if len(p.Events) != 2 || p.Events[0].ID != 3 || !p.HasMore {
+		t.Errorf("backward page: %+v", p)
+	}
+
+	resp, _ := http.Get(ts.URL + "/api/events/history?after_id=abc")
+	resp.Body.Close()
+	if resp.StatusCode != 400 {
+		t.Errorf("expected 400 for bad after_id, got %d", resp.StatusCode)
+	}
+}
+
 func TestInstanceRegisterAndList(t *testing.T) {
 	ts := testServer(t, "")
 
@@ -557,6 +866,121 @@ func TestValidateEndpoint(t *testing.T) {
 	}
 }
 
+func TestValidateDiff(t *testing.T) {
+	ts := testServer(t, "")
+	rules := `[{"rule_id":"no-eval","severity":"error","match_type":"regex","pattern":"\\beval\\(","message":"eval bad"}]`
+	req, _ := http.NewRequest("PUT", ts.URL+"/api/validate/proj/rules", strings.NewReader(rules))
+	req.Header.Set("Content-Type", "application/json")
+	resp, _ := http.DefaultClient.Do(req)
+	resp.Body.Close()
+
+	patch := "--- a/app.js\n+++ b/app.js\n@@ -1,2 +1,3 @@\n var a = eval('old');\n+var b = eval('new');\n var c = 3;\n"
+	payload, _ := json.Marshal(map[string]string{"diff": patch})
+	resp, _ = http.Post(ts.URL+"/api/validate/proj/diff", "application/json", bytes.NewReader(payload))
+	var result struct {
+		Count      int                   `json:"count"`
+		Files      []string              `json:"files"`
+		Violations []specs.DiffViolation `json:"violations"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || result.Count != 1 || len(result.Files) != 1 {
+		t.Fatalf("diff validate: %d %+v", resp.StatusCode, result)
+	}
+	if v := result.Violations[0]; v.Filename != "app.js" || v.Line != 2 || v.Hunk != 1 || v.DiffLine != 5 {
+		t.Errorf("only the added line should be reported: %+v", v)
+	}
+
+	resp, _ = http.Post(ts.URL+"/api/validate/proj/diff", "application/json", strings.NewReader(`{"diff":"+++ b/x\n@@ bad @@\n"}`))
+	resp.Body.Close()
+	if resp.StatusCode != 400 {
+		t.Errorf("malformed diff: expected 400, got %d", resp.StatusCode)
+	}
+}
+
+func TestValidateAnnotations(t *testing.T) {
+	ts := testServer(t, "")
+	rules := `[{"rule_id":"no-eval","severity":"error","match_type":"regex","pattern":"\\beval\\(","message":"eval bad"}]`
+	req, _ := http.NewRequest("PUT", ts.URL+"/api/validate/proj/rules", strings.NewReader(rules))
+	req.Header.Set("Content-Type", "application/json")
+	resp, _ := http.DefaultClient.Do(req)
+	resp.Body.Close()
+
+	payload := `{"content":"ok\nvar x = eval('bad');","filename":"web/app.js"}`
+	resp, _ = http.Post(ts.URL+"/api/validate/proj?format=github", "application/json", strings.NewReader(payload))
+	var gh []map[string]any
+	json.NewDecoder(resp.Body).Decode(&gh)
+	resp.Body.Close()
+	if len(gh) != 1 || gh[0]["path"] != "web/app.js" || gh[0]["start_line"] != float64(2) ||
+		gh[0]["annotation_level"] != "failure" || gh[0]["title"] != "no-eval" {
+		t.Errorf("github annotations: %v", gh)
+	}
+
+	resp, _ = http.Post(ts.URL+"/api/validate/proj?format=gitlab", "application/json", strings.NewReader(payload))
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), `"check_name":"no-eval"`) || !strings.Contains(string(body), `"lines":{"begin":2}`) ||
+		!strings.Contains(string(body), `"severity":"major"`) {
+		t.Errorf("gitlab report: %s", body)
+	}
+
+	resp, _ = http.Post(ts.URL+"/api/validate/proj?format=sarif", "application/json", strings.NewReader(payload))
+	resp.Body.Close()
+	if resp.StatusCode != 400 {
+		t.Errorf("unknown format: expected 400, got %d", resp.StatusCode)
+	}
+}
+
+func TestValidationBaseline(t *testing.T) {
+	ts := testServer(t, "")
+	rules := `[{"rule_id":"no-eval","severity":"error","match_type":"regex","pattern":"\\beval\\(","message":"eval bad"}]`
+	req, _ := http.NewRequest("PUT", ts.URL+"/api/validate/proj/rules", strings.NewReader(rules))
+	resp, _ := http.DefaultClient.Do(req)
+	resp.Body.Close()
+
+	resp, _ = http.Post(ts.URL+"/api/validate/proj/baseline", "application/json",
+		strings.NewReader(`{"files":[{"filename":"legacy.js","content":"eval(a);\neval(b);"}]}`))
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || !strings.Contains(string(body), `"violations":2`) {
+		t.Fatalf("capture baseline: %d %s", resp.StatusCode, body)
+	}
+	resp, _ = http.Post(ts.URL+"/api/validate/proj/baseline", "application/json", strings.NewReader(`{"files":[]}`))
+	resp.Body.Close()
+	if resp.StatusCode != 400 {
+		t.Errorf("empty files: expected 400, got %d", resp.StatusCode)
+	}
+
+	validate := func(query string) (count, baselined int) {
+		resp, _ := http.Post(ts.URL+"/api/validate/proj"+query, "application/json",
+			strings.NewReader(`{"filename":"legacy.js","content":"// new line\neval(b);\neval(c);\neval(a);"}`))
+		var out struct {
+			Count     int `json:"count"`
+			Baselined int `json:"baselined"`
+		}
+		json.NewDecoder(resp.Body).Decode(&out)
+		resp.Body.Close()
+		return out.Count, out.Baselined
+	}
+	if count, baselined := validate(""); count != 1 || baselined != 2 {
+		t.Errorf("expected 1 new violation and 2 baselined, got %d and %d", count, baselined)
+	}
+	if count, baselined := validate("?baseline=false"); count != 3 || baselined != 0 {
+		t.Errorf("?baseline=false: expected 3 violations, got %d (%d baselined)", count, baselined)
+	}
+
+	req, _ = http.NewRequest("DELETE", ts.URL+"/api/validate/proj/baseline", nil)
+	resp, _ = http.DefaultClient.Do(req)
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), `"deleted":2`) {
+		t.Errorf("delete baseline: %s", body)
+	}
+	if count, _ := validate(""); count != 3 {
+		t.Errorf("after delete: expected 3 violations, got %d", count)
+	}
+}
+
 func TestRulesProposeAcceptReject(t *testing.T) {
 	ts := testServer(t, "")
 
@@ -656,6 +1080,68 @@ func TestRulesAcceptRejectNotFound(t *testing.T) {
 	}
 }
 
+func TestRulesAutoAccept(t *testing.T) {
+	env := koortest.New(t)
+	ctx := context.Background()
+	env.Specs.ProposeRule(ctx, specs.Rule{Project: "proj", RuleID: "earlier", Pattern: "x", ProposedBy: "inst-1"})
+	env.Specs.AcceptRule(ctx, "proj", "earlier")
+
+	req, _ := http.NewRequest("PUT", env.URL+"/api/rules/proj/auto-accept", strings.NewReader(`{"severities":["warning"],"min_accepted":1}`))
+	resp, _ := http.DefaultClient.Do(req)
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("put policy: expected 200, got %d", resp.StatusCode)
+	}
+
+	propose := func(body string) map[string]any {
+		resp, err := http.Post(env.URL+"/api/rules/propose", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var out map[string]any
+		json.NewDecoder(resp.Body).Decode(&out)
+		return out
+	}
+	if out := propose(`{"project":"proj","rule_id":"no-foo","severity":"warning","pattern":"foo","proposed_by":"inst-1"}`); out["status"] != "accepted" {
+		t.Errorf("expected warning from a trusted proposer to be auto-accepted: %v", out)
+	}
+	if out := propose(`{"project":"proj","rule_id":"no-bar","severity":"error","pattern":"bar","proposed_by":"inst-1"}`); out["status"] != "proposed" || out["auto_accept"] == nil {
+		t.Errorf("expected error rule to be queued with a decision: %v", out)
+	}
+
+	entries, _ := env.Audit.Query(ctx, "auto-accept", "rule.auto_accept", "", "", 10)
+	if len(entries) != 2 || entries[0].Outcome != "queued" || entries[1].Outcome != "success" {
+		t.Errorf("expected both decisions in the audit log, got %+v", entries)
+	}
+
+	// Bulk accept picks up the queued rule.
+	resp, _ = http.Post(env.URL+"/api/rules/proj/accept", "application/json", strings.NewReader(`{"all":true}`))
+	var bulk struct {
+		Accepted []string `json:"accepted"`
+	}
+	json.NewDecoder(resp.Body).Decode(&bulk)
+	resp.Body.Close()
+	if len(bulk.Accepted) != 1 || bulk.Accepted[0] != "no-bar" {
+		t.Errorf("expected bulk accept of no-bar, got %+v", bulk)
+	}
+
+	resp, _ = http.Post(env.URL+"/api/rules/proj/accept", "application/json", strings.NewReader(`{}`))
+	resp.Body.Close()
+	if resp.StatusCode != 400 {
+		t.Errorf("expected 400 without rule_ids or all, got %d", resp.StatusCode)
+	}
+
+	req, _ = http.NewRequest("DELETE", env.URL+"/api/rules/proj/auto-accept", nil)
+	resp, _ = http.DefaultClient.Do(req)
+	resp.Body.Close()
+	resp, _ = http.Get(env.URL + "/api/rules/proj/auto-accept")
+	resp.Body.Close()
+	if resp.StatusCode != 404 {
+		t.Errorf("expected 404 after deleting the policy, got %d", resp.StatusCode)
+	}
+}
+
 func TestRulesExportImport(t *testing.T) {
 	ts := testServer(t, "")
 
@@ -716,6 +1202,106 @@ func TestRulesImportEmpty(t *testing.T) {
 
 // --- Contract validation integration tests ---
 
+func TestChangeEventsByPrefix(t *testing.T) {
+	database, err := db.OpenMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	eventBus := events.New(database, 1000)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cfg := server.Config{Bind: "localhost:0", ChangeEvents: "state:config/,specs:TW/"}
+	srv := server.New(cfg, state.New(database), specs.New(database), eventBus, instances.New(database), nil, logger)
+	ts := httptest.NewServer(srv.Handler())
+	t.Cleanup(ts.Close)
+
+	put := func(path, body string) {
+		req, _ := http.NewRequest("PUT", ts.URL+path, strings.NewReader(body))
+		req.Header.Set("X-Koor-Actor", "agent-1")
+		resp, _ := http.DefaultClient.Do(req)
+		resp.Body.Close()
+	}
+	put("/api/state/config/db", `{"host":"a"}`)
+	put("/api/state/config/db", `{"host":"b"}`)
+	put("/api/state/scratch/tmp", `{"x":1}`) // not enabled
+	put("/api/specs/TW/api", `{"kind":"contract"}`)
+	put("/api/specs/Other/api", `{"kind":"contract"}`) // not enabled
+	req, _ := http.NewRequest("DELETE", ts.URL+"/api/state/config/db", nil)
+	resp, _ := http.DefaultClient.Do(req)
+	resp.Body.Close()
+
+	resp, _ = http.Get(ts.URL + "/api/events/history?last=50")
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	var history []struct {
+		Topic  string         `json:"topic"`
+		Data   map[string]any `json:"data"`
+		Source string         `json:"source"`
+	}
+	if err := json.Unmarshal(body, &history); err != nil {
+		t.Fatalf("decode history: %v: %s", err, body)
+	}
+	if len(history) != 4 {
+		t.Fatalf("expected 4 change events, got %d: %s", len(history), body)
+	}
+	if strings.Contains(string(body), "scratch/tmp") || strings.Contains(string(body), `"project":"Other"`) {
+		t.Errorf("events published for disabled prefixes: %s", body)
+	}
+	if !strings.Contains(string(body), `"op":"delete"`) || !strings.Contains(string(body), `"old_version":2`) {
+		t.Errorf("expected delete event with old_version 2: %s", body)
+	}
+	if !strings.Contains(string(body), `"topic":"spec.changed"`) || !strings.Contains(string(body), `"actor":"agent-1"`) {
+		t.Errorf("expected spec.changed with actor: %s", body)
+	}
+}
+
+func TestChangeEventsFromIndirectWrites(t *testing.T) {
+	database, err := db.OpenMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cfg := server.Config{Bind: "localhost:0", ChangeEvents: "state"}
+	srv := server.New(cfg, state.New(database), specs.New(database), events.New(database, 1000), instances.New(database), nil, logger)
+	ts := httptest.NewServer(srv.Handler())
+	t.Cleanup(ts.Close)
+
+	req, _ := http.NewRequest("PUT", ts.URL+"/api/state/TW/config", strings.NewReader(`{"port":8080}`))
+	resp, _ := http.DefaultClient.Do(req)
+	resp.Body.Close()
+
+	// Deleting the project removes its state without going through the
+	// state endpoints; the store still reports it.
+	req, _ = http.NewRequest("DELETE", ts.URL+"/api/projects/TW", nil)
+	req.Header.Set("X-Koor-Actor", "admin-1")
+	resp, _ = http.DefaultClient.Do(req)
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("delete project: expected 200, got %d", resp.StatusCode)
+	}
+
+	resp, _ = http.Get(ts.URL + "/api/events/history?topic=state.changed")
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	var history []struct {
+		Data map[string]any `json:"data"`
+	}
+	if err := json.Unmarshal(body, &history); err != nil {
+		t.Fatalf("decode history: %v: %s", err, body)
+	}
+	if len(history) != 2 {
+		t.Fatalf("expected 2 state.changed events, got %d: %s", len(history), body)
+	}
+	last := history[0].Data // newest first
+	if last["op"] != "delete" || last["key"] != "TW/config" || last["actor"] != "admin-1" {
+		t.Errorf("expected delete of TW/config by admin-1, got %v", last)
+	}
+}
+
 func TestContractValidatePass(t *testing.T) {
 	ts := testServer(t, "")
 
@@ -776,6 +1362,38 @@ func TestContractValidateNotFound(t *testing.T) {
 	}
 }
 
+func TestContractValidateDeprecatedField(t *testing.T) {
+	ts := testServerWithPhase13(t)
+
+	contract := `{"kind":"contract","version":1,"endpoints":{"POST /api/trucks":{"request":{"plate":{"type":"string","required":true},"truck_type":{"type":"string","deprecated":true,"sunset":"2099-01-01"}}}}}`
+	req, _ := http.NewRequest("PUT", ts.URL+"/api/specs/TW/api", strings.NewReader(contract))
+	resp, _ := http.DefaultClient.Do(req)
+	resp.Body.Close()
+
+	vBody := `{"endpoint":"POST /api/trucks","direction":"request","payload":{"plate":"ABC-123","truck_type":"semi"}}`
+	for i := 0; i < 2; i++ {
+		resp, _ = http.Post(ts.URL+"/api/contracts/TW/api/validate", "application/json", strings.NewReader(vBody))
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if !strings.Contains(string(body), `"valid":true`) {
+			t.Errorf("deprecated field should still validate: %s", body)
+		}
+		if !strings.Contains(string(body), "truck_type") || !strings.Contains(string(body), "2099-01-01") {
+			t.Errorf("expected deprecation warning for truck_type: %s", body)
+		}
+	}
+
+	resp, _ = http.Get(ts.URL + "/api/contracts/TW/api/deprecations?since=1h")
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("deprecations: expected 200, got %d: %s", resp.StatusCode, body)
+	}
+	if !strings.Contains(string(body), `"path":"request.truck_type"`) || !strings.Contains(string(body), `"count":2`) {
+		t.Errorf("expected truck_type usage counted twice: %s", body)
+	}
+}
+
 func TestContractTestLive(t *testing.T) {
 	ts := testServer(t, "")
 
@@ -812,15 +1430,49 @@ func TestContractTestLive(t *testing.T) {
 	}
 }
 
-func TestContractTestLiveFail(t *testing.T) {
+func TestContractTestLiveResponseVariant(t *testing.T) {
 	ts := testServer(t, "")
 
-	// Backend returns wrong field names.
+	// Backend returns a 404 with an error body.
 	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(201)
-		json.NewEncoder(w).Encode(map[string]any{
-			"id":           "1",
+		w.WriteHeader(404)
+		json.NewEncoder(w).Encode(map[string]any{"error": "truck not found"})
+	}))
+	defer backend.Close()
+
+	contract := `{"kind":"contract","version":1,"endpoints":{"GET /api/trucks/1":{"responses":{"200":{"id":{"type":"string","required":true}},"404":{"error":{"type":"string","required":true}}}}}}`
+	req, _ := http.NewRequest("PUT", ts.URL+"/api/specs/TW/api", strings.NewReader(contract))
+	resp, _ := http.DefaultClient.Do(req)
+	resp.Body.Close()
+
+	testBody := fmt.Sprintf(`{"endpoint":"GET /api/trucks/1","base_url":"%s"}`, backend.URL)
+	resp, _ = http.Post(ts.URL+"/api/contracts/TW/api/test", "application/json", strings.NewReader(testBody))
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), `"valid":true`) || !strings.Contains(string(body), `"status_code":404`) {
+		t.Errorf("404 variant should validate: %s", body)
+	}
+
+	// Validating directly with a status selects the same variant.
+	vBody := `{"endpoint":"GET /api/trucks/1","direction":"response","status":404,"payload":{"id":"1"}}`
+	resp, _ = http.Post(ts.URL+"/api/contracts/TW/api/validate", "application/json", strings.NewReader(vBody))
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), `"valid":false`) || !strings.Contains(string(body), "response[404].error") {
+		t.Errorf("expected 404 variant violations: %s", body)
+	}
+}
+
+func TestContractTestLiveFail(t *testing.T) {
+	ts := testServer(t, "")
+
+	// Backend returns wrong field names.
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(201)
+		json.NewEncoder(w).Encode(map[string]any{
+			"id":           "1",
 			"plate_number": "ABC", // wrong — contract says "plate"
 		})
 	}))
@@ -843,6 +1495,73 @@ func TestContractTestLiveFail(t *testing.T) {
 	}
 }
 
+func TestContractTestSuite(t *testing.T) {
+	ts := testServer(t, "")
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/api/trucks/1" {
+			json.NewEncoder(w).Encode(map[string]any{"id": "1", "plate": "ABC"})
+			return
+		}
+		w.WriteHeader(404)
+		json.NewEncoder(w).Encode(map[string]any{"error": "truck not found"})
+	}))
+	defer backend.Close()
+
+	contract := `{"kind":"contract","version":1,"endpoints":{"GET /api/trucks/{id}":{
+		"responses":{"200":{"id":{"type":"string"},"plate":{"type":"string"}},"404":{"error":{"type":"string"}}},
+		"cases":[
+			{"name":"found","path":"/api/trucks/1","expect_status":200,"expect_response":{"plate":"ABC"}},
+			{"name":"renamed","path":"/api/trucks/1","expect_response":{"plate":"XYZ"}},
+			{"name":"missing","path":"/api/trucks/2","expect_status":404}
+		]}}}`
+	req, _ := http.NewRequest("PUT", ts.URL+"/api/specs/TW/api", strings.NewReader(contract))
+	resp, _ := http.DefaultClient.Do(req)
+	resp.Body.Close()
+
+	testBody := fmt.Sprintf(`{"base_url":"%s"}`, backend.URL)
+	resp, _ = http.Post(ts.URL+"/api/contracts/TW/api/test-suite", "application/json", strings.NewReader(testBody))
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("test-suite: expected 200, got %d: %s", resp.StatusCode, body)
+	}
+	var result struct {
+		Passed bool `json:"passed"`
+		Pass   int  `json:"pass"`
+		Fail   int  `json:"fail"`
+		Cases  []struct {
+			Case     string   `json:"case"`
+			Pass     bool     `json:"pass"`
+			Failures []string `json:"failures"`
+		} `json:"cases"`
+	}
+	json.Unmarshal(body, &result)
+	if result.Passed || result.Pass != 2 || result.Fail != 1 {
+		t.Fatalf("expected 2 pass and 1 fail: %s", body)
+	}
+	for _, c := range result.Cases {
+		if c.Case == "renamed" && (c.Pass || len(c.Failures) != 1 || !strings.Contains(c.Failures[0], "response.plate")) {
+			t.Errorf("renamed: expected a response.plate mismatch, got %+v", c)
+		}
+	}
+
+	testBody = fmt.Sprintf(`{"base_url":"%s","case":"missing"}`, backend.URL)
+	resp, _ = http.Post(ts.URL+"/api/contracts/TW/api/test-suite", "application/json", strings.NewReader(testBody))
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), `"passed":true`) || !strings.Contains(string(body), `"pass":1`) {
+		t.Errorf("single case: expected it to pass alone: %s", body)
+	}
+
+	resp, _ = http.Post(ts.URL+"/api/contracts/TW/nope/test-suite", "application/json", strings.NewReader(testBody))
+	resp.Body.Close()
+	if resp.StatusCode != 404 {
+		t.Errorf("unknown contract: expected 404, got %d", resp.StatusCode)
+	}
+}
+
 func TestMetrics(t *testing.T) {
 	ts := testServer(t, "")
 	resp, _ := http.Get(ts.URL + "/api/metrics")
@@ -862,6 +1581,43 @@ func TestMetrics(t *testing.T) {
 	}
 }
 
+func TestPrometheusMetrics(t *testing.T) {
+	env := koortest.New(t)
+	env.SeedInstance("frontend", "/ws")
+	for _, key := range []string{"a", "b"} {
+		req, _ := http.NewRequest("PUT", env.URL+"/api/state/"+key, strings.NewReader(`{"x":1}`))
+		resp, _ := http.DefaultClient.Do(req)
+		resp.Body.Close()
+	}
+	resp, _ := http.Get(env.URL + "/api/state/missing")
+	resp.Body.Close()
+
+	resp, _ = http.Get(env.URL + "/metrics/prometheus")
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("unexpected content type %q", ct)
+	}
+	for _, want := range []string{
+		`koor_http_requests_total{method="PUT",route="/api/state/{key...}",code="200"} 2`,
+		`koor_http_requests_total{method="GET",route="/api/state/{key...}",code="404"} 1`,
+		`koor_http_request_duration_seconds_count{method="PUT",route="/api/state/{key...}"} 2`,
+		`koor_http_request_duration_seconds_bucket{method="PUT",route="/api/state/{key...}",le="+Inf"} 2`,
+		"# TYPE koor_event_bus_subscribers gauge",
+		`koor_webhook_deliveries_total{result="failure"} 0`,
+		`koor_instances{status="active"} 1`,
+		"koor_rest_calls_total 3",
+		"koor_mcp_calls_total 0",
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("missing %q in:\n%s", want, body)
+		}
+	}
+}
+
 func TestTokenTaxCounting(t *testing.T) {
 	ts := testServer(t, "")
 
@@ -904,6 +1660,85 @@ func TestTokenTaxCounting(t *testing.T) {
 	}
 }
 
+func TestMetricsResetPersistence(t *testing.T) {
+	env := koortest.New(t)
+	ctx := context.Background()
+	_, writer, _ := env.Tokens.Create(ctx, tokens.Token{Name: "ci", Scopes: []string{"read", "write"}})
+	_, admin, _ := env.Tokens.Create(ctx, tokens.Token{Name: "ops", Scopes: []string{"admin"}})
+
+	for i := 0; i < 3; i++ {
+		resp, _ := http.Get(env.URL + "/api/state")
+		resp.Body.Close()
+	}
+	reset := func(token string) *http.Response {
+		req, _ := http.NewRequest("POST", env.URL+"/api/metrics/reset", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	// Only admins may reset.
+	resp := reset(writer)
+	resp.Body.Close()
+	if resp.StatusCode != 403 {
+		t.Fatalf("reset with a write token: expected 403, got %d", resp.StatusCode)
+	}
+
+	// The counters survive a restart on the same database.
+	if err := env.Koor.FlushCounters(ctx); err != nil {
+		t.Fatal(err)
+	}
+	restarted := server.New(server.Config{}, env.State, env.Specs, env.Events, env.Instances, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	restarted.SetObservability(env.Metrics)
+	ts := httptest.NewServer(restarted.Handler())
+	defer ts.Close()
+	resp, _ = http.Get(ts.URL + "/api/metrics")
+	var metrics struct {
+		TokenTax struct {
+			RESTCalls int64 `json:"rest_calls"`
+		} `json:"token_tax"`
+	}
+	json.NewDecoder(resp.Body).Decode(&metrics)
+	resp.Body.Close()
+	if metrics.TokenTax.RESTCalls < 3 {
+		t.Errorf("expected at least 3 REST calls after restart, got %d", metrics.TokenTax.RESTCalls)
+	}
+
+	resp = reset(admin)
+	var result struct {
+		Reset   bool                `json:"reset"`
+		Cleared observability.Reset `json:"cleared"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || !result.Reset {
+		t.Fatalf("reset: expected 200, got %d", resp.StatusCode)
+	}
+	if result.Cleared.Actor != "ops" || result.Cleared.RESTCalls < 3 {
+		t.Errorf("cleared = %+v, want actor ops and at least 3 REST calls", result.Cleared)
+	}
+
+	// The saved counters are cleared too, and the reset is kept.
+	saved, _ := env.Metrics.LoadCounters(ctx)
+	if saved["rest_calls"] != 0 {
+		t.Errorf("saved rest_calls after reset = %d, want 0", saved["rest_calls"])
+	}
+	resp, _ = http.Get(env.URL + "/api/metrics/resets")
+	var resets []observability.Reset
+	json.NewDecoder(resp.Body).Decode(&resets)
+	resp.Body.Close()
+	if len(resets) != 1 || resets[0].ID != result.Cleared.ID {
+		t.Errorf("resets = %+v, want the one reset", resets)
+	}
+	entries, _ := env.Audit.Query(ctx, "", "metrics.reset", "", "", 0)
+	if len(entries) != 1 {
+		t.Errorf("expected 1 metrics.reset audit entry, got %d", len(entries))
+	}
+}
+
 // --- Phase 10: State History + Rollback endpoint tests ---
 
 func TestStateHistory(t *testing.T) {
@@ -1022,6 +1857,50 @@ func TestStateRollbackNotFound(t *testing.T) {
 	}
 }
 
+func TestStateCompact(t *testing.T) {
+	env := koortest.New(t)
+	ctx := context.Background()
+	for i := 0; i < 5; i++ {
+		env.State.Put(ctx, "Truck/heartbeat", []byte(fmt.Sprint(i)), "text/plain", "")
+	}
+	compact := func(path string) (int, map[string]any) {
+		resp, _ := http.Post(env.URL+path, "application/json", nil)
+		var out map[string]any
+		json.NewDecoder(resp.Body).Decode(&out)
+		resp.Body.Close()
+		return resp.StatusCode, out
+	}
+
+	if code, _ := compact("/api/state/Truck/heartbeat?compact=1"); code != 400 {
+		t.Errorf("compact without a policy: expected 400, got %d", code)
+	}
+	code, out := compact("/api/state/Truck/heartbeat?compact=1&keep=2")
+	if code != 200 || out["reclaimed"] != float64(2) {
+		t.Errorf("compact keep=2: expected 2 rows reclaimed, got %d %v", code, out)
+	}
+
+	req, _ := http.NewRequest("PUT", env.URL+"/api/state-retention", strings.NewReader(`[{"pattern":"Truck/*","max_versions":1}]`))
+	resp, _ := http.DefaultClient.Do(req)
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("set retention: expected 200, got %d", resp.StatusCode)
+	}
+	code, out = compact("/api/state/Truck/heartbeat?compact=1")
+	if code != 200 || out["reclaimed"] != float64(1) || out["pattern"] != "Truck/*" {
+		t.Errorf("compact by policy: expected 1 row reclaimed, got %d %v", code, out)
+	}
+	history, _ := env.State.History(ctx, "Truck/heartbeat", 0)
+	if len(history) != 2 {
+		t.Errorf("expected the current value and one archived version, got %d", len(history))
+	}
+
+	env.State.Put(ctx, "Truck/heartbeat", []byte("5"), "text/plain", "")
+	code, out = compact("/api/state-retention/compact")
+	if code != 200 || out["reclaimed"] != float64(1) || out["keys"] != float64(1) {
+		t.Errorf("compact all: expected 1 row from 1 key, got %d %v", code, out)
+	}
+}
+
 func TestStateDiff(t *testing.T) {
 	ts := testServer(t, "")
 
@@ -1058,33 +1937,7 @@ func TestStateDiff(t *testing.T) {
 
 func testServerWithPhase11(t *testing.T) *httptest.Server {
 	t.Helper()
-	database, err := db.OpenMemory()
-	if err != nil {
-		t.Fatal(err)
-	}
-	t.Cleanup(func() { database.Close() })
-
-	stateStore := state.New(database)
-	specReg := specs.New(database)
-	eventBus := events.New(database, 1000)
-	instanceReg := instances.New(database)
-	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
-
-	cfg := server.Config{Bind: "localhost:0"}
-	srv := server.New(cfg, stateStore, specReg, eventBus, instanceReg, nil, logger)
-
-	webhookDisp := webhooks.New(database, eventBus, logger)
-	srv.SetWebhooks(webhookDisp)
-
-	compSched := compliance.New(database, instanceReg, specReg, eventBus, 1*time.Hour, logger)
-	srv.SetCompliance(compSched)
-
-	templateStore := templates.New(database)
-	srv.SetTemplates(templateStore)
-
-	ts := httptest.NewServer(srv.Handler())
-	t.Cleanup(ts.Close)
-	return ts
+	return koortest.New(t).Server
 }
 
 func TestWebhookCreateAndList(t *testing.T) {
@@ -1137,6 +1990,361 @@ func TestWebhookDeleteAndNotFound(t *testing.T) {
 	}
 }
 
+func TestWebhookReplay(t *testing.T) {
+	var delivered atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Koor-Replay") == "true" {
+			delivered.Add(1)
+		}
+	}))
+	defer backend.Close()
+
+	env := koortest.New(t)
+	ctx := context.Background()
+	first, _ := env.Events.Publish(ctx, "agent.a", json.RawMessage(`{}`), "")
+	last, _ := env.Events.Publish(ctx, "agent.b", json.RawMessage(`{}`), "")
+	env.Webhooks.Register(ctx, "wh-r", backend.URL, []string{"agent.*"}, "", "")
+
+	resp, _ := http.Post(env.URL+"/api/webhooks/wh-r/replay", "application/json",
+		strings.NewReader(fmt.Sprintf(`{"from_id":%d,"to_id":%d}`, first.ID, last.ID)))
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || !strings.Contains(string(body), `"delivered":2`) {
+		t.Fatalf("replay: expected 2 delivered, got %d: %s", resp.StatusCode, body)
+	}
+	if delivered.Load() != 2 {
+		t.Errorf("expected 2 replayed deliveries, got %d", delivered.Load())
+	}
+
+	resp, _ = http.Post(env.URL+"/api/webhooks/wh-r/replay", "application/json", strings.NewReader(`{}`))
+	resp.Body.Close()
+	if resp.StatusCode != 400 {
+		t.Errorf("replay without event ids: expected 400, got %d", resp.StatusCode)
+	}
+	resp, _ = http.Post(env.URL+"/api/webhooks/missing/replay", "application/json", strings.NewReader(`{"event_id":1}`))
+	resp.Body.Close()
+	if resp.StatusCode != 404 {
+		t.Errorf("replay unknown webhook: expected 404, got %d", resp.StatusCode)
+	}
+}
+
+func TestWebhookDeliveries(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+
+	env := koortest.New(t)
+	ctx := context.Background()
+	ev, _ := env.Events.Publish(ctx, "agent.a", json.RawMessage(`{}`), "")
+	env.Webhooks.Register(ctx, "wh-d", backend.URL, []string{"agent.*"}, "", "")
+	env.Webhooks.Replay(ctx, "wh-d", ev.ID, ev.ID)
+
+	resp, _ := http.Get(env.URL + "/api/webhooks/wh-d/deliveries?status=success")
+	var dels []webhooks.Delivery
+	json.NewDecoder(resp.Body).Decode(&dels)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || len(dels) != 1 || dels[0].EventID != ev.ID || dels[0].Response != "ok" {
+		t.Fatalf("deliveries: expected the replayed delivery, got %d: %+v", resp.StatusCode, dels)
+	}
+
+	resp, _ = http.Post(fmt.Sprintf("%s/api/webhooks/wh-d/deliveries/%d/redeliver", env.URL, dels[0].ID), "application/json", nil)
+	var del webhooks.Delivery
+	json.NewDecoder(resp.Body).Decode(&del)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || !del.Success || del.Kind != webhooks.KindRedeliver {
+		t.Errorf("redeliver: expected a successful redelivery, got %d: %+v", resp.StatusCode, del)
+	}
+
+	resp, _ = http.Post(env.URL+"/api/webhooks/wh-d/deliveries/9999/redeliver", "application/json", nil)
+	resp.Body.Close()
+	if resp.StatusCode != 404 {
+		t.Errorf("redeliver unknown delivery: expected 404, got %d", resp.StatusCode)
+	}
+	resp, _ = http.Get(env.URL + "/api/webhooks/wh-d/deliveries?status=bogus")
+	resp.Body.Close()
+	if resp.StatusCode != 400 {
+		t.Errorf("deliveries with bad status: expected 400, got %d", resp.StatusCode)
+	}
+	resp, _ = http.Get(env.URL + "/api/webhooks/missing/deliveries")
+	resp.Body.Close()
+	if resp.StatusCode != 404 {
+		t.Errorf("deliveries of unknown webhook: expected 404, got %d", resp.StatusCode)
+	}
+	resp, _ = http.Get(env.URL + "/api/webhooks/wh-d/dead-letters")
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || strings.TrimSpace(string(body)) != "[]" {
+		t.Errorf("dead letters: expected empty list, got %d: %s", resp.StatusCode, body)
+	}
+}
+
+func TestWebhookRotateSecret(t *testing.T) {
+	env := koortest.New(t)
+	env.Webhooks.Register(context.Background(), "wh-s", "http://example.com/hook", []string{"*"}, "old", "")
+
+	resp, _ := http.Post(env.URL+"/api/webhooks/wh-s/rotate-secret", "application/json",
+		strings.NewReader(`{"secret":"new","grace":"1h"}`))
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || !strings.Contains(string(body), "previous_secret_until") {
+		t.Fatalf("rotate: expected 200 with grace window, got %d: %s", resp.StatusCode, body)
+	}
+	wh, _ := env.Webhooks.Get(context.Background(), "wh-s")
+	if wh.Secret != "new" || wh.PreviousSecret != "old" {
+		t.Errorf("expected secret new with previous old, got %q/%q", wh.Secret, wh.PreviousSecret)
+	}
+
+	// Without a secret one is generated, and the rotation is announced.
+	resp, _ = http.Post(env.URL+"/api/webhooks/wh-s/rotate-secret", "application/json", strings.NewReader(`{}`))
+	var rotated webhooks.Webhook
+	json.NewDecoder(resp.Body).Decode(&rotated)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || !strings.HasPrefix(rotated.Secret, "whsec_") {
+		t.Errorf("rotate without secret: expected a generated secret, got %d %q", resp.StatusCode, rotated.Secret)
+	}
+	evs, _ := env.Events.History(context.Background(), 10, "webhook.secret_rotated")
+	if len(evs) != 2 || strings.Contains(string(evs[0].Data), rotated.Secret) {
+		t.Errorf("expected 2 rotation events without the secret, got %+v", evs)
+	}
+
+	resp, _ = http.Post(env.URL+"/api/webhooks/wh-s/rotate-secret", "application/json", strings.NewReader(`{"grace":"soon"}`))
+	resp.Body.Close()
+	if resp.StatusCode != 400 {
+		t.Errorf("rotate with a bad grace: expected 400, got %d", resp.StatusCode)
+	}
+}
+
+func TestWebhookUpdate(t *testing.T) {
+	env := koortest.New(t)
+	env.Webhooks.Register(context.Background(), "wh-u", "http://example.com/hook", []string{"*"}, "", "")
+	patch := func(id, body string) (*http.Response, []byte) {
+		req, _ := http.NewRequest("PATCH", env.URL+"/api/webhooks/"+id, strings.NewReader(body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return resp, b
+	}
+
+	resp, body := patch("wh-u", `{"transform":"slack","patterns":["agent.*"]}`)
+	var wh webhooks.Webhook
+	json.Unmarshal(body, &wh)
+	if resp.StatusCode != 200 || wh.Transform != "slack" || wh.Patterns[0] != "agent.*" || wh.URL != "http://example.com/hook" {
+		t.Fatalf("patch: expected the transform and patterns changed, got %d: %s", resp.StatusCode, body)
+	}
+
+	resp, body = patch("wh-u", `{"transform":"{\"text\": {{.topic}}}"}`)
+	if resp.StatusCode != 400 || !strings.Contains(string(body), "transform") {
+		t.Errorf("patch with a transform producing invalid JSON: expected 400, got %d: %s", resp.StatusCode, body)
+	}
+	if resp, _ := patch("nope", `{"active":false}`); resp.StatusCode != 404 {
+		t.Errorf("patch of an unknown webhook: expected 404, got %d", resp.StatusCode)
+	}
+
+	resp, _ = http.Post(env.URL+"/api/webhooks", "application/json",
+		strings.NewReader(`{"id":"wh-c","url":"http://example.com/c","transform":"discord"}`))
+	resp.Body.Close()
+	if created, _ := env.Webhooks.Get(context.Background(), "wh-c"); resp.StatusCode != 200 || created == nil || created.Transform != "discord" {
+		t.Errorf("create with a transform: got %d, %+v", resp.StatusCode, created)
+	}
+}
+
+func TestProjectScopedTokens(t *testing.T) {
+	env := koortest.New(t)
+	ctx := context.Background()
+	call := func(method, path, token, body string) *http.Response {
+		req, _ := http.NewRequest(method, env.URL+path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	expect := func(resp *http.Response, code int, what string) {
+		t.Helper()
+		resp.Body.Close()
+		if resp.StatusCode != code {
+			t.Errorf("%s: expected %d, got %d", what, code, resp.StatusCode)
+		}
+	}
+
+	// Tokens can only be issued for registered projects.
+	expect(call("POST", "/api/tokens", "", `{"name":"tw","project":"Truck-Wash","scopes":["read","write"]}`), 400, "token for unregistered project")
+	expect(call("POST", "/api/projects", "", `{"name":"Truck-Wash"}`), 200, "register project")
+	env.Settings.Create(ctx, projects.Project{Name: "Other"})
+	resp := call("POST", "/api/tokens", "", `{"name":"tw","project":"Truck-Wash","scopes":["read","write"]}`)
+	var created struct {
+		Token string `json:"token"`
+	}
+	json.NewDecoder(resp.Body).Decode(&created)
+	expect(resp, 200, "token for registered project")
+	tw := created.Token
+
+	// State, specs and events are confined to the project.
+	expect(call("PUT", "/api/state/Truck-Wash/status", tw, `{"ok":true}`), 200, "own state write")
+	expect(call("PUT", "/api/state/Other/status", tw, `{"ok":true}`), 403, "other state write")
+	env.State.Put(ctx, "Other/config", []byte(`{}`), "application/json", "")
+	expect(call("GET", "/api/state/Other/config", tw, ""), 403, "other state read")
+	resp = call("GET", "/api/state", tw, "")
+	var keys []state.Summary
+	json.NewDecoder(resp.Body).Decode(&keys)
+	expect(resp, 200, "state list")
+	if len(keys) != 1 || keys[0].Key != "Truck-Wash/status" {
+		t.Errorf("state list = %+v, want only Truck-Wash/status", keys)
+	}
+	expect(call("PUT", "/api/specs/Other/api", tw, `{}`), 403, "other spec write")
+	expect(call("POST", "/api/events/publish", tw, `{"topic":"truck-wash.backend.done","data":{}}`), 200, "own topic")
+	expect(call("POST", "/api/events/publish", tw, `{"topic":"other.done","data":{}}`), 403, "other topic")
+	env.Events.Publish(ctx, "other.started", []byte(`{}`), "")
+	resp = call("GET", "/api/events/history", tw, "")
+	var history []events.Event
+	json.NewDecoder(resp.Body).Decode(&history)
+	expect(resp, 200, "history")
+	if len(history) != 1 || history[0].Topic != "truck-wash.backend.done" {
+		t.Errorf("history = %+v, want only the project's event", history)
+	}
+	expect(call("GET", "/api/events/history?topic=other.*", tw, ""), 403, "other history")
+	expect(call("POST", "/api/rules/propose", tw, `{"project":"Other","rule_id":"r","pattern":"x"}`), 403, "other rule")
+
+	// Instances registered with the token join the project.
+	resp = call("POST", "/api/instances/register", tw, `{"name":"tw-backend"}`)
+	var inst instances.Instance
+	json.NewDecoder(resp.Body).Decode(&inst)
+	expect(resp, 200, "register")
+	if inst.Project != "Truck-Wash" {
+		t.Errorf("registered instance project = %q, want Truck-Wash", inst.Project)
+	}
+	other := env.SeedInstance("other-agent", "")
+	resp = call("GET", "/api/instances", tw, "")
+	var list []instances.Summary
+	json.NewDecoder(resp.Body).Decode(&list)
+	expect(resp, 200, "instances list")
+	if len(list) != 1 || list[0].ID != inst.ID {
+		t.Errorf("instances = %+v, want only tw-backend", list)
+	}
+	expect(call("GET", "/api/instances/"+other.ID, tw, ""), 403, "other instance")
+
+	// Routes that span projects are denied unless listed.
+	for _, path := range []string{"/api/audit", "/api/admin/gc-report", "/api/metrics", "/api/llm/usage", "/api/events/retention"} {
+		expect(call("GET", path, tw, ""), 403, path)
+	}
+	expect(call("POST", "/mcp", tw, `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`), 403, "mcp")
+
+	// Search hits, tasks and milestones are filtered to the project.
+	env.State.Put(ctx, "Truck-Wash/notes", []byte(`{"text":"wheelbase"}`), "application/json", "")
+	env.State.Put(ctx, "Other/notes", []byte(`{"text":"wheelbase"}`), "application/json", "")
+	resp = call("GET", "/api/search?q=wheelbase", tw, "")
+	var found struct {
+		Results []search.Result `json:"results"`
+	}
+	json.NewDecoder(resp.Body).Decode(&found)
+	expect(resp, 200, "search")
+	if len(found.Results) != 1 || found.Results[0].Ref != "Truck-Wash/notes" {
+		t.Errorf("search = %+v, want only Truck-Wash/notes", found.Results)
+	}
+	expect(call("POST", "/api/tasks", tw, `{"project":"Truck-Wash","title":"wash"}`), 201, "own task")
+	expect(call("POST", "/api/tasks", tw, `{"project":"Other","title":"paint"}`), 403, "other task")
+	otherTask, _ := env.Tasks.Create(ctx, tasks.Task{Project: "Other", Title: "paint"})
+	resp = call("GET", "/api/tasks", tw, "")
+	var taskList []tasks.Task
+	json.NewDecoder(resp.Body).Decode(&taskList)
+	expect(resp, 200, "task list")
+	if len(taskList) != 1 || taskList[0].Project != "Truck-Wash" {
+		t.Errorf("tasks = %+v, want only the project's task", taskList)
+	}
+	expect(call("GET", "/api/tasks?project=Other", tw, ""), 403, "other task list")
+	expect(call("GET", "/api/tasks/"+otherTask.ID, tw, ""), 403, "other task")
+	if _, err := env.Milestones.Create(ctx, milestones.Milestone{Project: "Other", Name: "v2", Tasks: []string{otherTask.ID}}); err != nil {
+		t.Fatal(err)
+	}
+	resp = call("GET", "/api/milestones", tw, "")
+	var progress []milestones.Progress
+	json.NewDecoder(resp.Body).Decode(&progress)
+	expect(resp, 200, "milestones")
+	if len(progress) != 0 {
+		t.Errorf("milestones = %+v, want none", progress)
+	}
+
+	// Webhooks may only watch the project's topics.
+	expect(call("POST", "/api/webhooks", tw, `{"id":"wh-all","url":"http://example.com","patterns":["*"]}`), 403, "webhook on every topic")
+	expect(call("POST", "/api/webhooks", tw, `{"id":"wh-other","url":"http://example.com","patterns":["other.*"]}`), 403, "webhook on other topics")
+	resp = call("POST", "/api/webhooks", tw, `{"id":"wh-tw","url":"http://example.com"}`)
+	var hook webhooks.Webhook
+	json.NewDecoder(resp.Body).Decode(&hook)
+	expect(resp, 200, "own webhook")
+	if len(hook.Patterns) != 1 || hook.Patterns[0] != "truck-wash.*" {
+		t.Errorf("default patterns = %v, want [truck-wash.*]", hook.Patterns)
+	}
+	expect(call("PATCH", "/api/webhooks/wh-tw", tw, `{"patterns":["*"]}`), 403, "widen own webhook")
+	env.Webhooks.Register(ctx, "wh-ops", "http://example.com", []string{"*"}, "", "")
+	resp = call("GET", "/api/webhooks", tw, "")
+	var hooks []webhooks.Webhook
+	json.NewDecoder(resp.Body).Decode(&hooks)
+	expect(resp, 200, "webhook list")
+	if len(hooks) != 1 || hooks[0].ID != "wh-tw" {
+		t.Errorf("webhooks = %+v, want only wh-tw", hooks)
+	}
+	expect(call("GET", "/api/webhooks/wh-ops/deliveries", tw, ""), 403, "other webhook deliveries")
+	expect(call("DELETE", "/api/webhooks/wh-ops", tw, ""), 403, "other webhook delete")
+
+	// Admin tokens cross projects.
+	_, admin, _ := env.Tokens.Create(ctx, tokens.Token{Name: "ops", Scopes: []string{"admin"}})
+	expect(call("GET", "/api/state/Other/config", admin, ""), 200, "admin cross-project read")
+	expect(call("POST", "/api/projects", tw, `{"name":"Third"}`), 403, "project token registering a project")
+}
+
+func TestTokenRotate(t *testing.T) {
+	env := koortest.New(t)
+	ctx := context.Background()
+	_, old, _ := env.Tokens.Create(ctx, tokens.Token{Name: "ci", Scopes: []string{"read"}})
+	tok, _, _ := env.Tokens.Create(ctx, tokens.Token{Name: "deploy", Scopes: []string{"read"}})
+
+	resp, _ := http.Post(env.URL+"/api/tokens/"+tok.ID+"/rotate", "application/json", strings.NewReader(`{"grace":"1h"}`))
+	var rotated struct {
+		Token string       `json:"token"`
+		Info  tokens.Token `json:"info"`
+	}
+	json.NewDecoder(resp.Body).Decode(&rotated)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || rotated.Token == "" || rotated.Info.PreviousValidUntil == nil {
+		t.Fatalf("rotate: unexpected response %d %+v", resp.StatusCode, rotated)
+	}
+	if got, err := env.Tokens.Resolve(ctx, rotated.Token); err != nil || got.ID != tok.ID {
+		t.Errorf("new secret should resolve: %v", err)
+	}
+	if evs, _ := env.Events.History(ctx, 10, "token.rotated"); len(evs) != 1 {
+		t.Errorf("expected a token.rotated event, got %d", len(evs))
+	}
+
+	// With no grace the old secret stops working at once.
+	resp, _ = http.Post(env.URL+"/api/tokens/"+tok.ID+"/rotate", "application/json", strings.NewReader(`{"grace":"0s"}`))
+	resp.Body.Close()
+	if _, err := env.Tokens.Resolve(ctx, rotated.Token); err == nil {
+		t.Error("previous secret should be rejected after a rotation without grace")
+	}
+	if _, err := env.Tokens.Resolve(ctx, old); err != nil {
+		t.Errorf("other tokens should be unaffected: %v", err)
+	}
+
+	resp, _ = http.Post(env.URL+"/api/tokens/missing/rotate", "application/json", nil)
+	resp.Body.Close()
+	if resp.StatusCode != 404 {
+		t.Errorf("rotate missing token: expected 404, got %d", resp.StatusCode)
+	}
+	// /api/apikeys/{id}/rotate is the same endpoint.
+	resp, _ = http.Post(env.URL+"/api/apikeys/"+tok.ID+"/rotate", "application/json", strings.NewReader(`{"grace":"0s"}`))
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Errorf("rotate via /api/apikeys: expected 200, got %d", resp.StatusCode)
+	}
+}
+
 func TestWebhookCreateValidation(t *testing.T) {
 	ts := testServerWithPhase11(t)
 
@@ -1186,34 +2394,91 @@ func TestComplianceHistoryAndRun(t *testing.T) {
 	}
 }
 
-// --- Phase 12: Capabilities + Templates endpoint tests ---
-
-func TestInstanceSetCapabilities(t *testing.T) {
-	ts := testServerWithPhase11(t)
+func TestCompliancePolicies(t *testing.T) {
+	env := koortest.New(t)
+	inst := env.SeedInstance("TW-backend", "TW")
+	env.Instances.Activate(context.Background(), inst.ID)
 
-	// Register an instance.
-	id := registerInstance(t, ts.URL, "cap-agent")
-
-	// Set capabilities.
-	resp, _ := http.Post(ts.URL+"/api/instances/"+id+"/capabilities", "application/json",
-		strings.NewReader(`{"capabilities":["code-review","testing"]}`))
-	body, _ := io.ReadAll(resp.Body)
+	resp, _ := http.Post(env.URL+"/api/compliance/policies?project=TW", "application/json",
+		strings.NewReader(`{"check":"required_capabilities","params":{"capabilities":["go"]}}`))
+	var p struct {
+		ID       string `json:"id"`
+		Project  string `json:"project"`
+		Severity string `json:"severity"`
+	}
+	json.NewDecoder(resp.Body).Decode(&p)
 	resp.Body.Close()
-	if resp.StatusCode != 200 {
-		t.Fatalf("set capabilities: expected 200, got %d: %s", resp.StatusCode, body)
+	if resp.StatusCode != 200 || p.Project != "TW" || p.Severity != "error" {
+		t.Fatalf("create: %d %+v", resp.StatusCode, p)
 	}
-	if !strings.Contains(string(body), "code-review") {
-		t.Errorf("response should contain code-review: %s", body)
+	for _, body := range []string{`{"project":"TW","check":"vibes"}`, `{"project":"Other","check":"heartbeat_freshness"}`} {
+		resp, _ = http.Post(env.URL+"/api/compliance/policies?project=TW", "application/json", strings.NewReader(body))
+		resp.Body.Close()
+		if resp.StatusCode != 400 {
+			t.Errorf("%s: expected 400, got %d", body, resp.StatusCode)
+		}
 	}
 
-	// Verify via GET.
-	resp, _ = http.Get(ts.URL + "/api/instances/" + id)
-	body, _ = io.ReadAll(resp.Body)
+	resp, _ = http.Post(env.URL+"/api/compliance/run", "application/json", nil)
+	body, _ := io.ReadAll(resp.Body)
 	resp.Body.Close()
-	if !strings.Contains(string(body), "code-review") {
-		t.Errorf("instance GET should include capabilities: %s", body)
+	if !strings.Contains(string(body), `"policy":"required_capabilities"`) ||
+		!strings.Contains(string(body), `"findings":[{"policy":"required_capabilities","check":"required_capabilities","severity":"error","message":"missing capability go"}]`) {
+		t.Errorf("expected a policy finding in the run: %s", body)
 	}
-}
+
+	req, _ := http.NewRequest("PUT", env.URL+"/api/compliance/policies/"+p.ID,
+		strings.NewReader(`{"project":"TW","check":"required_capabilities","params":{"capabilities":["go"]},"severity":"warning"}`))
+	resp, _ = http.DefaultClient.Do(req)
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("update: %d", resp.StatusCode)
+	}
+	resp, _ = http.Get(env.URL + "/api/compliance/policies?project=TW")
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), `"severity":"warning"`) {
+		t.Errorf("unexpected list: %s", body)
+	}
+
+	req, _ = http.NewRequest("DELETE", env.URL+"/api/compliance/policies/"+p.ID, nil)
+	resp, _ = http.DefaultClient.Do(req)
+	resp.Body.Close()
+	resp, _ = http.Get(env.URL + "/api/compliance/policies/" + p.ID)
+	resp.Body.Close()
+	if resp.StatusCode != 404 {
+		t.Errorf("deleted policy: expected 404, got %d", resp.StatusCode)
+	}
+}
+
+// --- Phase 12: Capabilities + Templates endpoint tests ---
+
+func TestInstanceSetCapabilities(t *testing.T) {
+	ts := testServerWithPhase11(t)
+
+	// Register an instance.
+	id := registerInstance(t, ts.URL, "cap-agent")
+
+	// Set capabilities.
+	resp, _ := http.Post(ts.URL+"/api/instances/"+id+"/capabilities", "application/json",
+		strings.NewReader(`{"capabilities":["code-review","testing"]}`))
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("set capabilities: expected 200, got %d: %s", resp.StatusCode, body)
+	}
+	if !strings.Contains(string(body), "code-review") {
+		t.Errorf("response should contain code-review: %s", body)
+	}
+
+	// Verify via GET.
+	resp, _ = http.Get(ts.URL + "/api/instances/" + id)
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), "code-review") {
+		t.Errorf("instance GET should include capabilities: %s", body)
+	}
+}
 
 func TestInstanceFilterByCapability(t *testing.T) {
 	ts := testServerWithPhase11(t)
@@ -1241,6 +2506,52 @@ func TestInstanceFilterByCapability(t *testing.T) {
 	}
 }
 
+func TestInstancesMatch(t *testing.T) {
+	env := koortest.New(t)
+	ctx := context.Background()
+
+	ids := map[string]string{}
+	for _, name := range []string{"busy", "idle", "no-docker"} {
+		inst, _ := env.Instances.Register(ctx, name, "/ws/"+name, "", "go")
+		env.Instances.Activate(ctx, inst.ID)
+		caps := []string{"go", "docker"}
+		if name == "no-docker" {
+			caps = []string{"go"}
+		}
+		env.Instances.SetCapabilities(ctx, inst.ID, caps)
+		ids[name] = inst.ID
+	}
+	env.Tasks.Create(ctx, tasks.Task{Project: "TW", Title: "build"})
+	if _, err := env.Tasks.Claim(ctx, "TW", nil, ids["busy"], time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, _ := http.Post(env.URL+"/api/instances/match", "application/json",
+		strings.NewReader(`{"capabilities":["docker"],"stack":"go"}`))
+	var result struct {
+		Count      int `json:"count"`
+		Candidates []struct {
+			Instance  instances.Summary `json:"instance"`
+			Score     float64           `json:"score"`
+			OpenTasks int               `json:"open_tasks"`
+		} `json:"candidates"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || result.Count != 2 {
+		t.Fatalf("match: %d %+v", resp.StatusCode, result)
+	}
+	if result.Candidates[0].Instance.Name != "idle" || result.Candidates[1].OpenTasks != 1 {
+		t.Errorf("expected the idle instance ahead of the one holding a task: %+v", result.Candidates)
+	}
+
+	resp, _ = http.Post(env.URL+"/api/instances/match", "application/json", strings.NewReader(`{"limit":500}`))
+	resp.Body.Close()
+	if resp.StatusCode != 400 {
+		t.Errorf("limit 500: expected 400, got %d", resp.StatusCode)
+	}
+}
+
 func TestTemplateCreateAndList(t *testing.T) {
 	ts := testServerWithPhase11(t)
 
@@ -1302,143 +2613,3340 @@ func TestTemplateDeleteAndNotFound(t *testing.T) {
 	}
 }
 
+func TestTemplateApplyVariables(t *testing.T) {
+	ts := testServerWithPhase11(t)
+
+	resp, _ := http.Post(ts.URL+"/api/templates", "application/json",
+		strings.NewReader(`{"id":"tpl-bad","name":"Bad","data":{},"params":[{"name":"x","type":"date"}]}`))
+	resp.Body.Close()
+	if resp.StatusCode != 400 {
+		t.Errorf("invalid params: expected 400, got %d", resp.StatusCode)
+	}
+
+	resp, _ = http.Post(ts.URL+"/api/templates", "application/json",
+		strings.NewReader(`{"id":"tpl-svc","name":"Service","kind":"contracts","data":{"service":"{{service}}","replicas":"{{replicas}}"},`+
+			`"params":[{"name":"service"},{"name":"replicas","type":"number","default":2}]}`))
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("create: expected 200, got %d", resp.StatusCode)
+	}
+
+	for body, want := range map[string]int{
+		`{"project":"TW"}`: 400, // service missing
+		`{"project":"TW","vars":{"service":"api","replicas":"x"}}`: 400,
+		`{"project":"TW","vars":{"service":"api","region":"eu"}}`:  400,
+		`{"project":"TW","vars":{"service":"api","replicas":3}}`:   200,
+	} {
+		resp, _ = http.Post(ts.URL+"/api/templates/tpl-svc/apply", "application/json", strings.NewReader(body))
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("apply %s: expected %d, got %d", body, want, resp.StatusCode)
+		}
+	}
+
+	resp, _ = http.Get(ts.URL + "/api/specs/TW/tpl-svc")
+	got, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(got), `"service":"api"`) || !strings.Contains(string(got), `"replicas":3`) {
+		t.Errorf("expected substituted spec, got %s", got)
+	}
+}
+
 // --- Phase 13 tests ---
 
 func testServerWithPhase13(t *testing.T) *httptest.Server {
 	t.Helper()
-	database, err := db.OpenMemory()
-	if err != nil {
-		t.Fatal(err)
-	}
-	t.Cleanup(func() { database.Close() })
+	return koortest.New(t).Server
+}
 
-	stateStore := state.New(database)
-	specReg := specs.New(database)
-	eventBus := events.New(database, 1000)
-	instanceReg := instances.New(database)
-	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+func TestContractScheduleEndpoints(t *testing.T) {
+	ts := testServerWithPhase13(t)
 
-	cfg := server.Config{Bind: "localhost:0"}
-	srv := server.New(cfg, stateStore, specReg, eventBus, instanceReg, nil, logger)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"id": "1"})
+	}))
+	defer backend.Close()
+
+	contract := `{"kind":"contract","version":1,"endpoints":{"GET /api/items/1":{"response_status":200,"response":{"id":{"type":"string","required":true}}}}}`
+	req, _ := http.NewRequest("PUT", ts.URL+"/api/specs/TW/api", strings.NewReader(contract))
+	resp, _ := http.DefaultClient.Do(req)
+	resp.Body.Close()
 
-	webhookDisp := webhooks.New(database, eventBus, logger)
-	srv.SetWebhooks(webhookDisp)
+	// Unknown contract is rejected.
+	resp, _ = http.Post(ts.URL+"/api/compliance/contract-tests", "application/json",
+		strings.NewReader(`{"project":"TW","contract":"missing","target":"http://x"}`))
+	resp.Body.Close()
+	if resp.StatusCode != 404 {
+		t.Errorf("expected 404 for unknown contract, got %d", resp.StatusCode)
+	}
 
-	compSched := compliance.New(database, instanceReg, specReg, eventBus, 1*time.Hour, logger)
-	srv.SetCompliance(compSched)
+	body := fmt.Sprintf(`{"project":"TW","contract":"api","target":"%s","interval":"15m"}`, backend.URL)
+	resp, _ = http.Post(ts.URL+"/api/compliance/contract-tests", "application/json", strings.NewReader(body))
+	data, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("create: expected 200, got %d: %s", resp.StatusCode, data)
+	}
+	var cs struct {
+		ID       string `json:"id"`
+		Interval string `json:"interval"`
+	}
+	json.Unmarshal(data, &cs)
+	if cs.ID == "" || cs.Interval != "15m0s" {
+		t.Fatalf("unexpected schedule: %s", data)
+	}
 
-	templateStore := templates.New(database)
-	srv.SetTemplates(templateStore)
+	resp, _ = http.Post(ts.URL+"/api/compliance/contract-tests/"+cs.ID+"/run", "application/json", nil)
+	data, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(data), `"pass":1`) || !strings.Contains(string(data), `"fail":0`) {
+		t.Errorf("expected passing run: %s", data)
+	}
 
-	auditLog := audit.New(database)
-	srv.SetAudit(auditLog)
+	resp, _ = http.Get(ts.URL + "/api/compliance/contract-tests/" + cs.ID + "/results")
+	data, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(data), `"endpoint":"GET /api/items/1"`) {
+		t.Errorf("expected stored result: %s", data)
+	}
 
-	metricsStore := observability.New(database)
-	srv.SetObservability(metricsStore)
+	req, _ = http.NewRequest("DELETE", ts.URL+"/api/compliance/contract-tests/"+cs.ID, nil)
+	resp, _ = http.DefaultClient.Do(req)
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Errorf("delete: expected 200, got %d", resp.StatusCode)
+	}
+}
 
-	ts := httptest.NewServer(srv.Handler())
-	t.Cleanup(ts.Close)
-	return ts
+func TestGraphQL(t *testing.T) {
+	env := koortest.New(t)
+	ctx := context.Background()
+	backend := env.SeedInstance("backend", "/ws/backend")
+	env.Instances.SetProject(ctx, backend.ID, "TW")
+	other := env.SeedInstance("other", "/ws/other")
+	env.Instances.SetProject(ctx, other.ID, "Other")
+	env.SeedState("TW/config", `{"port":8080}`)
+	env.State.PutMeta(ctx, state.Meta{Key: "TW/config", Owner: backend.ID, Tags: []string{"config"}})
+	env.SeedState("Other/config", `{}`)
+	env.Events.Publish(ctx, "tw.build.done", json.RawMessage(`{"ok":true}`), "ci")
+	env.Events.Publish(ctx, "other.build.done", json.RawMessage(`{"ok":false}`), "ci")
+	env.SeedRules("TW", specs.Rule{RuleID: "no-todo", Pattern: "TODO"})
+	env.SeedRules("Other", specs.Rule{RuleID: "no-fixme", Pattern: "FIXME"})
+
+	type response struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []any           `json:"errors"`
+	}
+	query := func(token, body string) (int, response) {
+		t.Helper()
+		req, _ := http.NewRequest("POST", env.URL+"/api/graphql", strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var out response
+		json.NewDecoder(resp.Body).Decode(&out)
+		return resp.StatusCode, out
+	}
+
+	// One round trip across entities, nested through the instance.
+	status, out := query("", `{"query":"query($p: String) { instances(project: $p) { name state { key tags value } } events(topic: \"tw.*\") { topic data } rules(project: \"TW\") { rule_id } }","variables":{"p":"TW"}}`)
+	if status != 200 || out.Errors != nil {
+		t.Fatalf("query: status %d, errors %v", status, out.Errors)
+	}
+	want := `{"instances":[{"name":"backend","state":[{"key":"TW/config","tags":["config"],"value":{"port":8080}}]}],"events":[{"topic":"tw.build.done","data":{"ok":true}}],"rules":[{"rule_id":"no-todo"}]}`
+	if string(out.Data) != want {
+		t.Errorf("data = %s\nwant %s", out.Data, want)
+	}
+
+	// A token bound to a project sees only that project.
+	_, tok, _ := env.Tokens.Create(ctx, tokens.Token{Name: "tw", Project: "TW", Scopes: []string{"read"}})
+	status, out = query(tok, `{"query":"{ instances { name } state { key } events { topic } rules { rule_id } }"}`)
+	want = `{"instances":[{"name":"backend"}],"state":[{"key":"TW/config"}],"events":[{"topic":"tw.build.done"}],"rules":[{"rule_id":"no-todo"}]}`
+	if status != 200 || string(out.Data) != want {
+		t.Errorf("scoped: status %d, data %s\nwant %s", status, out.Data, want)
+	}
+	status, out = query(tok, `{"query":"{ events(topic: \"other.*\") { topic } }"}`)
+	if status != 200 || out.Errors == nil {
+		t.Errorf("scoped foreign topic: status %d, data %s", status, out.Data)
+	}
+
+	// Bad queries fail as a whole with 400.
+	for _, body := range []string{`{"query":"{ instances { token } }"}`, `{"query":"mutation { instances { id } }"}`, `{"query":""}`} {
+		if status, _ := query("", body); status != 400 {
+			t.Errorf("%s: expected 400, got %d", body, status)
+		}
+	}
+
+	// GET without a query returns the schema.
+	resp, _ := http.Get(env.URL + "/api/graphql")
+	sdl, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(sdl), "compliance_runs(") || !strings.Contains(string(sdl), "type Instance {") {
+		t.Errorf("unexpected schema:\n%s", sdl)
+	}
+	resp, _ = http.Get(env.URL + "/api/graphql?query=" + url.QueryEscape("{ instances(name: \"other\") { project } }"))
+	var result struct {
+		Data struct {
+			Instances []instances.Summary `json:"instances"`
+		} `json:"data"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	resp.Body.Close()
+	if len(result.Data.Instances) != 1 || result.Data.Instances[0].Project != "Other" {
+		t.Errorf("GET query: %+v", result)
+	}
 }
 
-func TestAuditQueryEmpty(t *testing.T) {
+func TestSearchEndpoint(t *testing.T) {
 	ts := testServerWithPhase13(t)
 
-	resp, _ := http.Get(ts.URL + "/api/audit")
+	req, _ := http.NewRequest("PUT", ts.URL+"/api/state/config/db", strings.NewReader(`{"host":"postgres.internal"}`))
+	resp, _ := http.DefaultClient.Do(req)
+	resp.Body.Close()
+
+	resp, _ = http.Get(ts.URL + "/api/search?q=postgres&types=state,specs")
 	body, _ := io.ReadAll(resp.Body)
 	resp.Body.Close()
 	if resp.StatusCode != 200 {
 		t.Fatalf("expected 200, got %d: %s", resp.StatusCode, body)
 	}
-	if string(body) != "[]\n" {
-		t.Errorf("expected empty array, got %s", body)
+	if !strings.Contains(string(body), `"type":"state"`) || !strings.Contains(string(body), `"ref":"config/db"`) {
+		t.Errorf("expected state hit: %s", body)
+	}
+
+	resp, _ = http.Get(ts.URL + "/api/search?q=postgres&types=bogus")
+	resp.Body.Close()
+	if resp.StatusCode != 400 {
+		t.Errorf("unknown type: expected 400, got %d", resp.StatusCode)
 	}
 }
 
-func TestAuditAfterStatePut(t *testing.T) {
+func TestProjectExportImport(t *testing.T) {
 	ts := testServerWithPhase13(t)
 
-	// Put state to trigger audit.
-	resp, _ := http.NewRequest("PUT", ts.URL+"/api/state/test-key", strings.NewReader(`{"hello":"world"}`))
-	resp2, _ := http.DefaultClient.Do(resp)
-	resp2.Body.Close()
-	if resp2.StatusCode != 200 {
-		t.Fatalf("state put: expected 200, got %d", resp2.StatusCode)
+	put := func(path, body string) {
+		req, _ := http.NewRequest("PUT", ts.URL+path, strings.NewReader(body))
+		resp, _ := http.DefaultClient.Do(req)
+		resp.Body.Close()
 	}
+	put("/api/specs/TW/api-contract", `{"kind":"contract","endpoints":{}}`)
+	put("/api/state/TW/config", `{"port":8080}`)
+	put("/api/state/other/config", `{"port":9090}`)
+	resp, _ := http.Post(ts.URL+"/api/rules/import", "application/json",
+		strings.NewReader(`[{"project":"TW","rule_id":"no-todo","pattern":"TODO"}]`))
+	resp.Body.Close()
 
-	// Query audit log.
-	resp3, _ := http.Get(ts.URL + "/api/audit")
-	body, _ := io.ReadAll(resp3.Body)
-	resp3.Body.Close()
-	if resp3.StatusCode != 200 {
-		t.Fatalf("audit: expected 200, got %d", resp3.StatusCode)
+	resp, _ = http.Get(ts.URL + "/api/projects/TW/export")
+	bundle, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("export: expected 200, got %d: %s", resp.StatusCode, bundle)
+	}
+	if strings.Contains(string(bundle), "other/config") {
+		t.Errorf("export included state outside the project prefix: %s", bundle)
 	}
 
-	var entries []map[string]any
-	json.Unmarshal(body, &entries)
-	if len(entries) != 1 {
-		t.Fatalf("expected 1 audit entry, got %d", len(entries))
+	resp, _ = http.Post(ts.URL+"/api/projects/TW2/import", "application/json", strings.NewReader(string(bundle)))
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("import: expected 200, got %d: %s", resp.StatusCode, body)
 	}
-	if entries[0]["action"] != "state.put" {
-		t.Errorf("expected action state.put, got %v", entries[0]["action"])
+
+	resp, _ = http.Get(ts.URL + "/api/specs/TW2/api-contract")
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Errorf("imported spec: expected 200, got %d", resp.StatusCode)
 	}
-	if entries[0]["resource"] != "test-key" {
-		t.Errorf("expected resource test-key, got %v", entries[0]["resource"])
+	resp, _ = http.Get(ts.URL + "/api/state/TW2/config")
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || !strings.Contains(string(body), "8080") {
+		t.Errorf("state key not remapped to TW2/: %d %s", resp.StatusCode, body)
+	}
+	resp, _ = http.Get(ts.URL + "/api/validate/TW2/rules")
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), "no-todo") {
+		t.Errorf("rule not imported into TW2: %s", body)
+	}
+
+	resp, _ = http.Post(ts.URL+"/api/projects/TW2/import", "application/json", strings.NewReader(`{"kind":"other"}`))
+	resp.Body.Close()
+	if resp.StatusCode != 400 {
+		t.Errorf("non-bundle import: expected 400, got %d", resp.StatusCode)
 	}
 }
 
-func TestAuditSummary(t *testing.T) {
-	ts := testServerWithPhase13(t)
+func TestReplicaServesReadsAndRejectsWrites(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	newServer := func() (*server.Server, *sql.DB, *httptest.Server) {
+		database, err := db.Open(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { database.Close() })
+		srv := server.New(server.Config{Bind: "localhost:0"}, state.New(database), specs.New(database),
+			events.New(database, 1000), instances.New(database), nil, logger)
+		srv.SetReplicationSource(replication.NewSource(database))
+		ts := httptest.NewServer(srv.Handler())
+		t.Cleanup(ts.Close)
+		return srv, database, ts
+	}
+
+	_, primaryDB, primary := newServer()
+	state.New(primaryDB).Put(context.Background(), "config/db", []byte(`{"host":"a"}`), "application/json", "")
+
+	replicaSrv, replicaDB, replica := newServer()
+	follower := replication.NewFollower(replicaDB, primary.URL, "", time.Minute, logger)
+	replicaSrv.SetReplica(follower)
+	if err := follower.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
 
-	// Create some audit entries via mutations.
-	req, _ := http.NewRequest("PUT", ts.URL+"/api/state/key1", strings.NewReader(`{"a":1}`))
-	r, _ := http.DefaultClient.Do(req)
-	r.Body.Close()
+	resp, _ := http.Get(replica.URL + "/api/state/config/db")
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || string(body) != `{"host":"a"}` {
+		t.Errorf("replica read: %d %s", resp.StatusCode, body)
+	}
 
-	req, _ = http.NewRequest("DELETE", ts.URL+"/api/state/key1", nil)
-	r, _ = http.DefaultClient.Do(req)
-	r.Body.Close()
+	req, _ := http.NewRequest("PUT", replica.URL+"/api/state/config/db", strings.NewReader(`{"host":"b"}`))
+	resp, _ = http.DefaultClient.Do(req)
+	resp.Body.Close()
+	if resp.StatusCode != 503 || resp.Header.Get("X-Koor-Primary") != primary.URL {
+		t.Errorf("replica write: expected 503 with primary header, got %d %q", resp.StatusCode, resp.Header.Get("X-Koor-Primary"))
+	}
 
-	// Get summary.
-	resp, _ := http.Get(ts.URL + "/api/audit/summary")
+	resp, _ = http.Get(replica.URL + "/api/replication/status")
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), `"role":"replica"`) || !strings.Contains(string(body), `"syncs":1`) {
+		t.Errorf("unexpected replication status: %s", body)
+	}
+}
+
+func TestFederation(t *testing.T) {
+	up := koortest.New(t)
+	up.SeedRules("org", specs.Rule{RuleID: "no-console", Pattern: `console\.log`, Source: "local"})
+	down := koortest.New(t)
+
+	resp, _ := http.Get(up.URL + "/api/federation/pack")
 	body, _ := io.ReadAll(resp.Body)
 	resp.Body.Close()
-	if resp.StatusCode != 200 {
-		t.Fatalf("expected 200, got %d: %s", resp.StatusCode, body)
+	etag := resp.Header.Get("ETag")
+	if resp.StatusCode != 200 || etag == "" || !strings.Contains(string(body), "no-console") {
+		t.Fatalf("pack: %d %q %s", resp.StatusCode, etag, body)
+	}
+	req, _ := http.NewRequest("GET", up.URL+"/api/federation/pack", nil)
+	req.Header.Set("If-None-Match", etag)
+	resp, _ = http.DefaultClient.Do(req)
+	resp.Body.Close()
+	if resp.StatusCode != 304 {
+		t.Errorf("pack with matching ETag: expected 304, got %d", resp.StatusCode)
 	}
 
-	var summary map[string]any
-	json.Unmarshal(body, &summary)
-	total := summary["total_entries"].(float64)
-	if total != 2 {
-		t.Errorf("expected 2 total entries, got %v", total)
+	resp, _ = http.Post(down.URL+"/api/federation/sync", "application/json", nil)
+	resp.Body.Close()
+	if resp.StatusCode != 503 {
+		t.Errorf("sync without federation: expected 503, got %d", resp.StatusCode)
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	down.Koor.SetFederation(federation.NewSubscriber(up.URL, "", time.Minute, down.Specs, down.Templates, logger))
+	resp, _ = http.Post(down.URL+"/api/federation/sync", "application/json", nil)
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || !strings.Contains(string(body), `"rules_applied":1`) {
+		t.Fatalf("sync: %d %s", resp.StatusCode, body)
+	}
+	rule, err := down.Specs.GetRule(context.Background(), "org", "no-console")
+	if err != nil || rule.Source != "federated" {
+		t.Errorf("expected federated rule downstream, got %+v, %v", rule, err)
+	}
+
+	resp, _ = http.Get(down.URL + "/api/federation/status")
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), `"syncs":1`) || !strings.Contains(string(body), `"upstream":"`+up.URL+`"`) {
+		t.Errorf("unexpected federation status: %s", body)
+	}
+	entries, _ := down.Audit.Query(context.Background(), "", "federation.sync", "", "", 10)
+	if len(entries) != 1 {
+		t.Errorf("expected 1 federation.sync audit entry, got %d", len(entries))
 	}
 }
 
-func TestAgentMetricsEmpty(t *testing.T) {
-	ts := testServerWithPhase13(t)
+func TestRulePacks(t *testing.T) {
+	env := koortest.New(t)
+	pack := func(version, rules string) io.Reader {
+		return strings.NewReader(`{"name":"web-basics","version":"` + version + `","rules":[` + rules + `]}`)
+	}
+	noConsole := `{"rule_id":"no-console","pattern":"console\\.log"}`
+	noEval := `{"rule_id":"no-eval","pattern":"eval\\("}`
 
-	resp, _ := http.Get(ts.URL + "/api/metrics/agents")
+	resp, _ := http.Post(env.URL+"/api/rulepacks/install", "application/json", pack("1.0.0", noConsole))
+	resp.Body.Close()
+	if resp.StatusCode != 400 {
+		t.Errorf("install without project: expected 400, got %d", resp.StatusCode)
+	}
+	resp, _ = http.Post(env.URL+"/api/rulepacks/install?project=app", "application/json", pack("1.0.0", noConsole+","+noEval))
 	body, _ := io.ReadAll(resp.Body)
 	resp.Body.Close()
-	if resp.StatusCode != 200 {
-		t.Fatalf("expected 200, got %d: %s", resp.StatusCode, body)
+	if resp.StatusCode != 200 || !strings.Contains(string(body), `"action":"install"`) {
+		t.Fatalf("install: %d %s", resp.StatusCode, body)
 	}
-	if string(body) != "[]\n" {
-		t.Errorf("expected empty array, got %s", body)
+	resp, _ = http.Post(env.URL+"/api/rulepacks/install?project=app", "application/json", pack("1.1.0", noConsole))
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || !strings.Contains(string(body), `"rules_removed":["no-eval"]`) {
+		t.Fatalf("upgrade: %d %s", resp.StatusCode, body)
+	}
+	resp, _ = http.Post(env.URL+"/api/rulepacks/install?project=app", "application/json", pack("1.0.0", noConsole))
+	resp.Body.Close()
+	if resp.StatusCode != 409 {
+		t.Errorf("downgrade: expected 409, got %d", resp.StatusCode)
+	}
+
+	resp, _ = http.Get(env.URL + "/api/rulepacks?project=app")
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), `"version":"1.1.0"`) || !strings.Contains(string(body), `"rules":["no-console"]`) {
+		t.Errorf("unexpected rule pack list: %s", body)
+	}
+	entries, _ := env.Audit.Query(context.Background(), "", "rulepack.install", "", "", 10)
+	if len(entries) != 2 {
+		t.Errorf("expected 2 rulepack.install audit entries, got %d", len(entries))
 	}
 }
 
-func TestAgentMetricsGetById(t *testing.T) {
-	ts := testServerWithPhase13(t)
+func TestEventRetention(t *testing.T) {
+	env := koortest.New(t)
 
-	resp, _ := http.Get(ts.URL + "/api/metrics/agents/nonexistent")
+	resp, _ := http.Get(env.URL + "/api/events/retention")
 	body, _ := io.ReadAll(resp.Body)
 	resp.Body.Close()
-	if resp.StatusCode != 200 {
-		t.Fatalf("expected 200, got %d: %s", resp.StatusCode, body)
+	if resp.StatusCode != 200 || !strings.Contains(string(body), `"pattern":"*.controller.*"`) {
+		t.Fatalf("default retention: %d %s", resp.StatusCode, body)
 	}
-	if string(body) != "[]\n" {
+
+	put := func(body string) int {
+		req, _ := http.NewRequest("PUT", env.URL+"/api/events/retention", strings.NewReader(body))
+		resp, _ := http.DefaultClient.Do(req)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := put(`[{"pattern":"*.heartbeat"}]`); code != 400 {
+		t.Errorf("policy without limits: expected 400, got %d", code)
+	}
+	if code := put(`{"pattern":"*.heartbeat"}`); code != 400 {
+		t.Errorf("non-array body: expected 400, got %d", code)
+	}
+	if code := put(`[{"pattern":"*.heartbeat","max_count":1},{"pattern":"*.controller.*","max_age":"720h"}]`); code != 200 {
+		t.Fatalf("set retention: expected 200, got %d", code)
+	}
+
+	for i := 0; i < 3; i++ {
+		resp, _ = http.Post(env.URL+"/api/events/publish", "application/json",
+			strings.NewReader(`{"topic":"tw.heartbeat","data":{}}`))
+		resp.Body.Close()
+	}
+	env.Events.Prune()
+	resp, _ = http.Get(env.URL + "/api/events/history?topic=tw.heartbeat")
+	var history []events.Event
+	json.NewDecoder(resp.Body).Decode(&history)
+	resp.Body.Close()
+	if len(history) != 1 {
+		t.Errorf("expected heartbeats pruned to 1, got %d", len(history))
+	}
+
+	resp, _ = http.Get(env.URL + "/api/events/retention")
+	var policies []events.RetentionPolicy
+	json.NewDecoder(resp.Body).Decode(&policies)
+	resp.Body.Close()
+	if len(policies) != 2 || policies[0].Pattern != "*.controller.*" || policies[0].MaxAge != "720h" {
+		t.Errorf("unexpected retention: %+v", policies)
+	}
+}
+
+func TestLivenessPolicies(t *testing.T) {
+	env := koortest.New(t)
+
+	put := func(project, body string) (int, string) {
+		req, _ := http.NewRequest("PUT", env.URL+"/api/liveness/policies/"+project, strings.NewReader(body))
+		resp, _ := http.DefaultClient.Do(req)
+		data, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return resp.StatusCode, string(data)
+	}
+	if code, _ := put("Truck", `{"deregister_after":"soon"}`); code != 400 {
+		t.Errorf("bad deregister_after: expected 400, got %d", code)
+	}
+	if code, _ := put("Truck", `{"webhook":"nope"}`); code != 400 {
+		t.Errorf("unknown webhook: expected 400, got %d", code)
+	}
+	code, body := put("Truck", `{"event":true,"reassign_tasks":true,"deregister_after":"1h"}`)
+	if code != 200 || !strings.Contains(body, `"project":"Truck"`) || !strings.Contains(body, `"deregister_after":"1h"`) {
+		t.Fatalf("set policy: %d %s", code, body)
+	}
+
+	resp, _ := http.Get(env.URL + "/api/liveness/policies")
+	var list []liveness.Policy
+	json.NewDecoder(resp.Body).Decode(&list)
+	resp.Body.Close()
+	if len(list) != 1 || !list[0].ReassignTasks {
+		t.Errorf("unexpected policies: %+v", list)
+	}
+
+	ctx := context.Background()
+	inst, _ := env.Instances.Register(ctx, "truck-backend", "/ws", "task", "go")
+	env.Instances.Activate(ctx, inst.ID)
+	env.Instances.SetProject(ctx, inst.ID, "Truck")
+	env.DB.Exec(`UPDATE instances SET last_seen = datetime('now', '-2 hours') WHERE id = ?`, inst.ID)
+	resp, _ = http.Post(env.URL+"/api/liveness/check", "application/json", nil)
+	resp.Body.Close()
+	if _, err := env.Instances.Get(ctx, inst.ID); err == nil {
+		t.Error("expected the instance unseen past deregister_after to be deregistered")
+	}
+	history, _ := env.Events.History(ctx, 10, "truck.agent.stale")
+	if len(history) != 1 {
+		t.Errorf("expected 1 truck.agent.stale event, got %d", len(history))
+	}
+
+	req, _ := http.NewRequest("DELETE", env.URL+"/api/liveness/policies/Truck", nil)
+	resp, _ = http.DefaultClient.Do(req)
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Errorf("delete: expected 200, got %d", resp.StatusCode)
+	}
+	resp, _ = http.Get(env.URL + "/api/liveness/policies/Truck")
+	resp.Body.Close()
+	if resp.StatusCode != 404 {
+		t.Errorf("deleted policy: expected 404, got %d", resp.StatusCode)
+	}
+}
+
+func TestProjections(t *testing.T) {
+	env := koortest.New(t)
+
+	resp, _ := http.Post(env.URL+"/api/projections", "application/json",
+		strings.NewReader(`{"name":"latest-build","topic":"ci.*.build","key":"ci/{2}/last-build"}`))
+	var p struct {
+		ID       string `json:"id"`
+		Strategy string `json:"strategy"`
+	}
+	json.NewDecoder(resp.Body).Decode(&p)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || p.ID == "" || p.Strategy != "replace" {
+		t.Fatalf("create: %d %+v", resp.StatusCode, p)
+	}
+	resp, _ = http.Post(env.URL+"/api/projections", "application/json", strings.NewReader(`{"topic":"x","key":"{bad}"}`))
+	resp.Body.Close()
+	if resp.StatusCode != 400 {
+		t.Errorf("invalid projection: expected 400, got %d", resp.StatusCode)
+	}
+
+	resp, _ = http.Post(env.URL+"/api/events/publish", "application/json",
+		strings.NewReader(`{"topic":"ci.koor.build","data":{"status":"green"}}`))
+	resp.Body.Close()
+	resp, _ = http.Get(env.URL + "/api/state/ci/koor/last-build")
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || string(body) != `{"status":"green"}` {
+		t.Fatalf("projected state: %d %s", resp.StatusCode, body)
+	}
+
+	req, _ := http.NewRequest("PUT", env.URL+"/api/projections/"+p.ID, strings.NewReader(`{"topic":"ci.*.build","key":"ci/builds","strategy":"append"}`))
+	resp, _ = http.DefaultClient.Do(req)
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("update: %d", resp.StatusCode)
+	}
+	resp, _ = http.Get(env.URL + "/api/projections/" + p.ID)
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), `"strategy":"append"`) || !strings.Contains(string(body), `"applied":1`) {
+		t.Errorf("unexpected projection: %s", body)
+	}
+
+	req, _ = http.NewRequest("DELETE", env.URL+"/api/projections/"+p.ID, nil)
+	resp, _ = http.DefaultClient.Do(req)
+	resp.Body.Close()
+	resp, _ = http.Get(env.URL + "/api/projections/" + p.ID)
+	resp.Body.Close()
+	if resp.StatusCode != 404 {
+		t.Errorf("deleted projection: expected 404, got %d", resp.StatusCode)
+	}
+}
+
+func TestSchedules(t *testing.T) {
+	env := koortest.New(t)
+
+	resp, _ := http.Post(env.URL+"/api/schedules", "application/json",
+		strings.NewReader(`{"name":"standup","cron":"0 9 * * 1-5","timezone":"UTC","topic":"truck-wash.standup","payload":{"day":"{weekday}"}}`))
+	var sc struct {
+		ID      string     `json:"id"`
+		NextRun *time.Time `json:"next_run"`
+	}
+	json.NewDecoder(resp.Body).Decode(&sc)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || sc.ID == "" || sc.NextRun == nil || sc.NextRun.Hour() != 9 {
+		t.Fatalf("create: %d %+v", resp.StatusCode, sc)
+	}
+	for _, body := range []string{`{"cron":"0 9 * *","topic":"a.b"}`, `{"cron":"0 9 * * *","topic":"a.*"}`, `{"cron":"0 9 * * *"}`} {
+		resp, _ = http.Post(env.URL+"/api/schedules", "application/json", strings.NewReader(body))
+		resp.Body.Close()
+		if resp.StatusCode != 400 {
+			t.Errorf("%s: expected 400, got %d", body, resp.StatusCode)
+		}
+	}
+
+	sub := env.Events.Subscribe("truck-wash.*")
+	defer env.Events.Unsubscribe(sub)
+	resp, _ = http.Post(env.URL+"/api/schedules/"+sc.ID+"/run", "application/json", nil)
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("run: %d", resp.StatusCode)
+	}
+	select {
+	case ev := <-sub.Ch:
+		if ev.Source != "schedule:standup" || !strings.HasPrefix(string(ev.Data), `{"day":"`) {
+			t.Errorf("unexpected event: %+v", ev)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no event from run")
+	}
+
+	req, _ := http.NewRequest("PUT", env.URL+"/api/schedules/"+sc.ID,
+		strings.NewReader(`{"name":"standup","cron":"0 9 * * 1-5","topic":"truck-wash.standup","paused":true}`))
+	resp, _ = http.DefaultClient.Do(req)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || !strings.Contains(string(body), `"paused":true`) || !strings.Contains(string(body), `"fired":1`) ||
+		strings.Contains(string(body), "next_run") {
+		t.Fatalf("pause: %d %s", resp.StatusCode, body)
+	}
+	if entries, _ := env.Audit.Query(context.Background(), "", "schedule.update", "", "", 0); len(entries) != 1 {
+		t.Errorf("expected one schedule.update audit entry, got %d", len(entries))
+	}
+
+	req, _ = http.NewRequest("DELETE", env.URL+"/api/schedules/"+sc.ID, nil)
+	resp, _ = http.DefaultClient.Do(req)
+	resp.Body.Close()
+	resp, _ = http.Get(env.URL + "/api/schedules/" + sc.ID)
+	resp.Body.Close()
+	if resp.StatusCode != 404 {
+		t.Errorf("deleted schedule: expected 404, got %d", resp.StatusCode)
+	}
+}
+
+func TestTenants(t *testing.T) {
+	host := koortest.New(t, koortest.WithAuthToken("operator"))
+	// A tenant's env outlives its stack, as its data directory would.
+	envs := map[string]*koortest.Env{}
+	mgr := tenants.New(host.DB, t.TempDir(), func(tn tenants.Tenant, dir string) (*tenants.Stack, error) {
+		env := envs[tn.ID]
+		if env == nil {
+			env = koortest.New(t, koortest.WithAuthToken("operator"))
+			envs[tn.ID] = env
+		}
+		secret, err := env.Users.EnsureAdmin(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		return &tenants.Stack{API: env.Koor.Handler(), Dashboard: env.Koor.DashboardHandler(),
+			Knows: env.Koor.KnowsToken, AdminSecret: secret, Close: func() {}}, nil
+	}, slog.Default())
+	host.Koor.SetTenants(mgr)
+	ts := httptest.NewServer(host.Koor.Handler())
+	defer ts.Close()
+
+	do := func(token, tenant, method, path, body string) (int, string) {
+		t.Helper()
+		req, _ := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		if tenant != "" {
+			req.Header.Set("X-Koor-Tenant", tenant)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(data)
+	}
+
+	code, body := do("operator", "", "POST", "/api/admin/tenants", `{"id":"team-a","name":"Team A"}`)
+	var created struct {
+		AdminSecret string `json:"admin_secret"`
+	}
+	json.Unmarshal([]byte(body), &created)
+	if code != 200 || created.AdminSecret == "" {
+		t.Fatalf("create: %d %s", code, body)
+	}
+	if code, _ := do("operator", "", "POST", "/api/admin/tenants", `{"id":"team-a"}`); code != 409 {
+		t.Errorf("duplicate: expected 409, got %d", code)
+	}
+	if code, _ := do("operator", "", "POST", "/api/admin/tenants", `{"id":"Team A"}`); code != 400 {
+		t.Errorf("invalid id: expected 400, got %d", code)
+	}
+
+	// The tenant's own secret finds its tenant; its data stays there.
+	if code, body := do(created.AdminSecret, "", "PUT", "/api/state/config/db", `{"host":"a"}`); code != 200 {
+		t.Fatalf("tenant write: %d %s", code, body)
+	}
+	if code, _ := do("operator", "", "GET", "/api/state/config/db", ""); code != 404 {
+		t.Errorf("host should not see tenant state, got %d", code)
+	}
+	if code, _ := do("operator", "team-a", "GET", "/api/state/config/db", ""); code != 200 {
+		t.Errorf("operator with tenant header: expected 200, got %d", code)
+	}
+	if code, _ := do("operator", "team-b", "GET", "/api/state", ""); code != 404 {
+		t.Errorf("unknown tenant: expected 404, got %d", code)
+	}
+	if code, _ := do(created.AdminSecret, "", "GET", "/api/admin/tenants", ""); code != 503 {
+		t.Errorf("tenants are not managed inside a tenant, got %d", code)
+	}
+
+	if code, _ := do("operator", "", "POST", "/api/admin/tenants/team-a/suspend", ""); code != 200 {
+		t.Fatalf("suspend: %d", code)
+	}
+	if code, _ := do("operator", "team-a", "GET", "/api/state", ""); code != 403 {
+		t.Errorf("suspended tenant: expected 403, got %d", code)
+	}
+	do("operator", "", "POST", "/api/admin/tenants/team-a/resume", "")
+	if code, _ := do(created.AdminSecret, "", "GET", "/api/state/config/db", ""); code != 200 {
+		t.Errorf("resumed tenant: expected 200, got %d", code)
+	}
+
+	if code, body := do("operator", "", "GET", "/api/admin/tenants", ""); code != 200 || !strings.Contains(body, `"name":"Team A"`) {
+		t.Errorf("list: %d %s", code, body)
+	}
+	if code, _ := do("operator", "", "DELETE", "/api/admin/tenants/team-a?purge=1", ""); code != 200 {
+		t.Errorf("delete: %d", code)
+	}
+	entries, _ := host.Audit.Query(context.Background(), "", "tenant.create", "", "", 0)
+	if len(entries) != 1 {
+		t.Errorf("expected a tenant.create audit entry, got %d", len(entries))
+	}
+}
+
+func TestAdminRotateKey(t *testing.T) {
+	env := koortest.New(t)
+	env.SeedState("TW/config", `{"v":1}`)
+	env.Specs.Put(context.Background(), "TW", "api", []byte(`{"openapi":"3.1"}`))
+
+	resp, _ := http.Post(env.URL+"/api/admin/rotate-key", "application/json", nil)
+	resp.Body.Close()
+	if resp.StatusCode != 503 {
+		t.Fatalf("without a key: expected 503, got %d", resp.StatusCode)
+	}
+
+	key, _ := encryption.GenerateKey()
+	kr, _ := encryption.ParseKeys(key)
+	env.State.SetKeyring(kr)
+	env.Specs.SetKeyring(kr)
+	env.Koor.SetEncryption(kr)
+
+	resp, _ = http.Post(env.URL+"/api/admin/rotate-key", "application/json", nil)
+	var out struct {
+		KeyID       string         `json:"key_id"`
+		Reencrypted map[string]int `json:"reencrypted"`
+	}
+	json.NewDecoder(resp.Body).Decode(&out)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || out.KeyID != kr.KeyID() || out.Reencrypted["state"] != 1 || out.Reencrypted["specs"] != 1 {
+		t.Fatalf("rotate: %d %+v", resp.StatusCode, out)
+	}
+
+	var raw []byte
+	env.DB.QueryRow(`SELECT value FROM state WHERE key = 'TW/config'`).Scan(&raw)
+	if !kr.Current(raw) {
+		t.Errorf("state not encrypted: %q", raw)
+	}
+	resp, _ = http.Get(env.URL + "/api/state/TW/config")
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != `{"v":1}` {
+		t.Errorf("expected the plain value over the API, got %s", body)
+	}
+	resp, _ = http.Get(env.URL + "/api/specs/TW/api")
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != `{"openapi":"3.1"}` {
+		t.Errorf("expected the plain spec over the API, got %s", body)
+	}
+}
+
+func TestDryRunDoesNotCommit(t *testing.T) {
+	env := koortest.New(t)
+	env.SeedRules("TW", specs.Rule{RuleID: "no-todo", Pattern: "TODO"})
+	env.SeedState("TW/config", `{"v":1}`)
+	env.SeedState("TW/config", `{"v":2}`)
+
+	rules := `[{"project":"TW","rule_id":"no-todo","pattern":"FIXME"},{"project":"TW","rule_id":"no-print","pattern":"print"}]`
+	resp, _ := http.Post(env.URL+"/api/rules/import?dry_run=1", "application/json", strings.NewReader(rules))
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	var plan struct {
+		DryRun  bool     `json:"dry_run"`
+		Created []string `json:"created"`
+		Updated []string `json:"updated"`
+		Deleted []string `json:"deleted"`
+	}
+	json.Unmarshal(body, &plan)
+	if !plan.DryRun || len(plan.Created) != 1 || plan.Created[0] != "rule:TW/no-print" ||
+		len(plan.Updated) != 1 || plan.Updated[0] != "rule:TW/no-todo" {
+		t.Errorf("unexpected rules plan: %s", body)
+	}
+	if r, _ := env.Specs.GetRule(context.Background(), "TW", "no-todo"); r.Pattern != "TODO" {
+		t.Errorf("dry run changed rule pattern to %q", r.Pattern)
+	}
+
+	resp, _ = http.Post(env.URL+"/api/state/TW/config?rollback=1&dry_run=1", "", nil)
+	resp.Body.Close()
+	if e, _ := env.State.Get(context.Background(), "TW/config"); e.Version != 2 {
+		t.Errorf("dry-run rollback created version %d", e.Version)
+	}
+
+	req, _ := http.NewRequest("DELETE", env.URL+"/api/projects/TW?dry_run=1", nil)
+	resp, _ = http.DefaultClient.Do(req)
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	plan.Deleted = nil
+	json.Unmarshal(body, &plan)
+	if len(plan.Deleted) != 2 {
+		t.Errorf("expected rule and state key in delete plan: %s", body)
+	}
+	if _, err := env.State.Get(context.Background(), "TW/config"); err != nil {
+		t.Error("dry-run delete removed state")
+	}
+
+	req, _ = http.NewRequest("DELETE", env.URL+"/api/projects/TW", nil)
+	resp, _ = http.DefaultClient.Do(req)
+	resp.Body.Close()
+	if _, err := env.State.Get(context.Background(), "TW/config"); err == nil {
+		t.Error("project delete should remove state under the project prefix")
+	}
+	req, _ = http.NewRequest("DELETE", env.URL+"/api/projects/TW", nil)
+	resp, _ = http.DefaultClient.Do(req)
+	resp.Body.Close()
+	if resp.StatusCode != 404 {
+		t.Errorf("deleting an empty project: expected 404, got %d", resp.StatusCode)
+	}
+}
+
+func TestAuditQueryEmpty(t *testing.T) {
+	ts := testServerWithPhase13(t)
+
+	resp, _ := http.Get(ts.URL + "/api/audit")
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("expected 200, got %d: %s", resp.StatusCode, body)
+	}
+	if string(body) != "[]\n" {
+		t.Errorf("expected empty array, got %s", body)
+	}
+}
+
+func TestAuditAfterStatePut(t *testing.T) {
+	ts := testServerWithPhase13(t)
+
+	// Put state to trigger audit.
+	resp, _ := http.NewRequest("PUT", ts.URL+"/api/state/test-key", strings.NewReader(`{"hello":"world"}`))
+	resp2, _ := http.DefaultClient.Do(resp)
+	resp2.Body.Close()
+	if resp2.StatusCode != 200 {
+		t.Fatalf("state put: expected 200, got %d", resp2.StatusCode)
+	}
+
+	// Query audit log.
+	resp3, _ := http.Get(ts.URL + "/api/audit")
+	body, _ := io.ReadAll(resp3.Body)
+	resp3.Body.Close()
+	if resp3.StatusCode != 200 {
+		t.Fatalf("audit: expected 200, got %d", resp3.StatusCode)
+	}
+
+	var entries []map[string]any
+	json.Unmarshal(body, &entries)
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 audit entry, got %d", len(entries))
+	}
+	if entries[0]["action"] != "state.put" {
+		t.Errorf("expected action state.put, got %v", entries[0]["action"])
+	}
+	if entries[0]["resource"] != "test-key" {
+		t.Errorf("expected resource test-key, got %v", entries[0]["resource"])
+	}
+}
+
+func TestAuditSummary(t *testing.T) {
+	ts := testServerWithPhase13(t)
+
+	// Create some audit entries via mutations.
+	req, _ := http.NewRequest("PUT", ts.URL+"/api/state/key1", strings.NewReader(`{"a":1}`))
+	r, _ := http.DefaultClient.Do(req)
+	r.Body.Close()
+
+	req, _ = http.NewRequest("DELETE", ts.URL+"/api/state/key1", nil)
+	r, _ = http.DefaultClient.Do(req)
+	r.Body.Close()
+
+	// Get summary.
+	resp, _ := http.Get(ts.URL + "/api/audit/summary")
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("expected 200, got %d: %s", resp.StatusCode, body)
+	}
+
+	var summary map[string]any
+	json.Unmarshal(body, &summary)
+	total := summary["total_entries"].(float64)
+	if total != 2 {
+		t.Errorf("expected 2 total entries, got %v", total)
+	}
+}
+
+func TestAuditExport(t *testing.T) {
+	ts := testServerWithPhase13(t)
+
+	for _, key := range []string{"key1", "key2"} {
+		req, _ := http.NewRequest("PUT", ts.URL+"/api/state/"+key, strings.NewReader(`{"a":1}`))
+		r, _ := http.DefaultClient.Do(req)
+		r.Body.Close()
+	}
+
+	resp, _ := http.Get(ts.URL + "/api/audit/export")
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || resp.Header.Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("expected ndjson, got %d %s: %s", resp.StatusCode, resp.Header.Get("Content-Type"), body)
+	}
+	lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %q", body)
+	}
+	var first map[string]any
+	json.Unmarshal([]byte(lines[0]), &first)
+	if first["resource"] != "key1" {
+		t.Errorf("expected oldest entry first, got %v", first)
+	}
+
+	resp, _ = http.Get(ts.URL + "/api/audit/export?format=csv")
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	records, err := csv.NewReader(bytes.NewReader(body)).ReadAll()
+	if err != nil || len(records) != 3 || records[0][0] != "id" || records[2][4] != "key2" {
+		t.Errorf("unexpected csv export (%v): %q", err, body)
+	}
+
+	resp, _ = http.Get(ts.URL + "/api/audit/export?format=xml")
+	resp.Body.Close()
+	if resp.StatusCode != 400 {
+		t.Errorf("expected 400 for unknown format, got %d", resp.StatusCode)
+	}
+}
+
+func TestAgentMetricsEmpty(t *testing.T) {
+	ts := testServerWithPhase13(t)
+
+	resp, _ := http.Get(ts.URL + "/api/metrics/agents")
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("expected 200, got %d: %s", resp.StatusCode, body)
+	}
+	if string(body) != "[]\n" {
 		t.Errorf("expected empty array, got %s", body)
 	}
 }
+
+func TestAgentMetricsGetById(t *testing.T) {
+	ts := testServerWithPhase13(t)
+
+	resp, _ := http.Get(ts.URL + "/api/metrics/agents/nonexistent")
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("expected 200, got %d: %s", resp.StatusCode, body)
+	}
+	if string(body) != "[]\n" {
+		t.Errorf("expected empty array, got %s", body)
+	}
+}
+
+func TestAgentMetricsRecordedFromTraffic(t *testing.T) {
+	env := koortest.New(t)
+	ctx := context.Background()
+	viaHeader := env.SeedInstance("tw-backend", "")
+	viaToken := env.SeedInstance("tw-frontend", "")
+	_, token, _ := env.Tokens.Create(ctx, tokens.Token{Name: "fe", InstanceID: viaToken.ID, Scopes: []string{"read", "write"}})
+
+	call := func(method, path, body string, header ...string) {
+		req, _ := http.NewRequest(method, env.URL+path, strings.NewReader(body))
+		req.Header.Set(header[0], header[1])
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	call("PUT", "/api/state/cfg", `{"a":1}`, "X-Koor-Instance", viaHeader.ID)
+	call("GET", "/api/state/cfg", "", "X-Koor-Instance", viaHeader.ID)
+	call("GET", "/api/state/missing", "", "X-Koor-Instance", viaHeader.ID)
+	// The token decides the instance, whatever the header says.
+	call("GET", "/api/state/cfg", "", "Authorization", "Bearer "+token)
+	call("GET", "/api/state", "", "X-Koor-Instance", "")
+
+	resp, _ := http.Get(env.URL + "/api/metrics/agents")
+	var summaries []observability.AgentSummary
+	json.NewDecoder(resp.Body).Decode(&summaries)
+	resp.Body.Close()
+	got := map[string]map[string]int64{}
+	for _, s := range summaries {
+		got[s.InstanceID] = s.Metrics
+	}
+	if len(got) != 2 {
+		t.Fatalf("expected metrics for 2 instances, got %v", got)
+	}
+	be := got[viaHeader.ID]
+	if be["rest_calls"] != 3 || be["rest_errors"] != 1 || be["bytes_in"] != 7 || be["bytes_out"] == 0 {
+		t.Errorf("header-attributed metrics: %v", be)
+	}
+	if be["requests"] != 3 || be["requests.failed"] != 1 {
+		t.Errorf("requests budget metric should still be recorded: %v", be)
+	}
+	if fe := got[viaToken.ID]; fe["rest_calls"] != 1 || fe["rest_errors"] != 0 {
+		t.Errorf("token-attributed metrics: %v", fe)
+	}
+}
+
+func TestAgentMetricsAggregateAndCSV(t *testing.T) {
+	env := koortest.New(t)
+	ctx := context.Background()
+	env.Metrics.IncrementBy(ctx, "agent-a", "rest_calls", 10)
+	env.Metrics.IncrementBy(ctx, "agent-b", "rest_calls", 30)
+	env.Metrics.IncrementBy(ctx, "agent-b", "rest_errors", 2)
+
+	get := func(path string) (int, string, string) {
+		resp, _ := http.Get(env.URL + path)
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return resp.StatusCode, resp.Header.Get("Content-Type"), string(body)
+	}
+
+	code, _, body := get("/api/metrics/agents?agg=p50,max&group_by=hour&metric=rest_calls&since=1h")
+	if code != 200 {
+		t.Fatalf("aggregate: expected 200, got %d: %s", code, body)
+	}
+	var aggs []observability.Aggregate
+	json.Unmarshal([]byte(body), &aggs)
+	if len(aggs) != 1 || aggs[0].Samples != 2 || aggs[0].Values["p50"] != 10 || aggs[0].Values["max"] != 30 {
+		t.Errorf("unexpected aggregate: %s", body)
+	}
+
+	code, ct, body := get("/api/metrics/agents?agg=sum,p95&format=csv")
+	if code != 200 || !strings.HasPrefix(ct, "text/csv") {
+		t.Fatalf("aggregate csv: expected 200 text/csv, got %d %s: %s", code, ct, body)
+	}
+	if body != "group,metric_name,samples,sum,p95\n,rest_calls,2,40,30\n,rest_errors,1,2,2\n" {
+		t.Errorf("unexpected aggregate csv:\n%s", body)
+	}
+
+	_, _, body = get("/api/metrics/agents?format=csv")
+	if body != "instance_id,metric_name,total\nagent-a,rest_calls,10\nagent-b,rest_calls,30\nagent-b,rest_errors,2\n" {
+		t.Errorf("unexpected summary csv:\n%s", body)
+	}
+	_, _, body = get("/api/metrics/agents/agent-b?format=csv")
+	if !strings.HasPrefix(body, "instance_id,metric_name,metric_value,period\nagent-b,rest_calls,30,") {
+		t.Errorf("unexpected detail csv:\n%s", body)
+	}
+
+	for _, path := range []string{
+		"/api/metrics/agents?agg=median",
+		"/api/metrics/agents?group_by=week",
+		"/api/metrics/agents?agg=sum&since=soon",
+		"/api/metrics/agents?format=xml",
+	} {
+		if code, _, body := get(path); code != 400 {
+			t.Errorf("%s: expected 400, got %d: %s", path, code, body)
+		}
+	}
+}
+
+func TestSignedEvents(t *testing.T) {
+	env := koortest.New(t, koortest.WithRequireSignedEvents())
+
+	resp, _ := http.Post(env.URL+"/api/instances/register", "application/json",
+		strings.NewReader(`{"name":"signer","signing":true}`))
+	var inst struct {
+		ID         string `json:"id"`
+		PublicKey  string `json:"public_key"`
+		PrivateKey string `json:"private_key"`
+	}
+	json.NewDecoder(resp.Body).Decode(&inst)
+	resp.Body.Close()
+	if inst.PublicKey == "" || inst.PrivateKey == "" {
+		t.Fatalf("expected generated key pair, got %+v", inst)
+	}
+
+	publish := func(data, instance, sig string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest("POST", env.URL+"/api/events/publish",
+			strings.NewReader(`{"topic":"deploy.finished","data":`+data+`}`))
+		if instance != "" {
+			req.Header.Set("X-Koor-Instance", instance)
+			req.Header.Set("X-Koor-Signature", sig)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	data := `{"ok":true}`
+	sig, err := identity.Sign(inst.PrivateKey, identity.EventMessage("deploy.finished", []byte(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Unsigned and tampered events are rejected.
+	if resp := publish(data, "", ""); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("unsigned publish: expected 401, got %d", resp.StatusCode)
+	}
+	if resp := publish(`{"ok":false}`, inst.ID, sig); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("tampered publish: expected 401, got %d", resp.StatusCode)
+	}
+
+	resp = publish(data, inst.ID, sig)
+	var ev events.Event
+	json.NewDecoder(resp.Body).Decode(&ev)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || ev.Signer != inst.ID || ev.Signature != sig {
+		t.Fatalf("signed publish: status %d, event %+v", resp.StatusCode, ev)
+	}
+
+	resp, _ = http.Get(fmt.Sprintf("%s/api/events/%d/verify", env.URL, ev.ID))
+	var verify map[string]any
+	json.NewDecoder(resp.Body).Decode(&verify)
+	resp.Body.Close()
+	if verify["signed"] != true || verify["verified"] != true || verify["signer"] != inst.ID {
+		t.Errorf("unexpected verify result: %v", verify)
+	}
+}
+
+func TestSandboxIncidentReport(t *testing.T) {
+	env := koortest.New(t)
+	inst := env.SeedInstance("frontend", "/projects/frontend")
+	rec := env.CaptureEvents("compliance.*")
+
+	resp, _ := http.Post(env.URL+"/api/compliance/incidents", "application/json",
+		strings.NewReader(`{"instance_id":"`+inst.ID+`","kind":"cross_agent_read","path":"/projects/backend/.env"}`))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	resp.Body.Close()
+
+	resp, _ = http.Post(env.URL+"/api/compliance/incidents", "application/json",
+		strings.NewReader(`{"instance_id":"nope","kind":"cross_agent_read"}`))
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown instance: expected 404, got %d", resp.StatusCode)
+	}
+	resp.Body.Close()
+
+	if _, ok := rec.Wait("compliance.sandbox_violation", time.Second); !ok {
+		t.Error("expected compliance.sandbox_violation event")
+	}
+
+	resp, _ = http.Get(env.URL + "/api/compliance/score?instance_id=" + inst.ID)
+	var body struct {
+		Scores []struct {
+			Incidents int `json:"incidents"`
+			Score     int `json:"score"`
+		} `json:"scores"`
+	}
+	json.NewDecoder(resp.Body).Decode(&body)
+	resp.Body.Close()
+	if len(body.Scores) != 1 || body.Scores[0].Incidents != 1 || body.Scores[0].Score != 80 {
+		t.Errorf("unexpected scores: %+v", body.Scores)
+	}
+}
+
+func TestPoliciesEnforcedOnWrites(t *testing.T) {
+	env := koortest.New(t)
+	frontend := env.SeedInstance("frontend", "/projects/frontend")
+	lead := env.SeedInstance("lead", "/projects")
+	env.Instances.SetCapabilities(context.Background(), lead.ID, []string{"controller"})
+
+	for _, body := range []string{
+		`{"name":"controller topics","action":"event.publish","resource":"*.controller.*","condition":"role=controller"}`,
+		`{"name":"own namespace","action":"state.write","resource":"agents/*","condition":"resource=agents/{name}/*"}`,
+	} {
+		resp, _ := http.Post(env.URL+"/api/policies", "application/json", strings.NewReader(body))
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("create policy: expected 200, got %d", resp.StatusCode)
+		}
+		resp.Body.Close()
+	}
+	resp, _ := http.Post(env.URL+"/api/policies", "application/json",
+		strings.NewReader(`{"action":"state.write","resource":"*","condition":"colour=blue"}`))
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("invalid policy: expected 400, got %d", resp.StatusCode)
+	}
+	resp.Body.Close()
+
+	do := func(method, path, instance, body string) int {
+		t.Helper()
+		req, _ := http.NewRequest(method, env.URL+path, strings.NewReader(body))
+		if instance != "" {
+			req.Header.Set("X-Koor-Instance", instance)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	publish := `{"topic":"tw.controller.plan","data":{}}`
+	if code := do("POST", "/api/events/publish", frontend.ID, publish); code != http.StatusForbidden {
+		t.Errorf("agent publishing controller topic: expected 403, got %d", code)
+	}
+	if code := do("POST", "/api/events/publish", "", publish); code != http.StatusForbidden {
+		t.Errorf("anonymous publishing controller topic: expected 403, got %d", code)
+	}
+	if code := do("POST", "/api/events/publish", lead.ID, publish); code != http.StatusOK {
+		t.Errorf("controller publishing controller topic: expected 200, got %d", code)
+	}
+
+	if code := do("PUT", "/api/state/agents/frontend/status", frontend.ID, `{"ok":true}`); code != http.StatusOK {
+		t.Errorf("own namespace write: expected 200, got %d", code)
+	}
+	if code := do("PUT", "/api/state/agents/lead/status", frontend.ID, `{"ok":true}`); code != http.StatusForbidden {
+		t.Errorf("other namespace write: expected 403, got %d", code)
+	}
+	if code := do("DELETE", "/api/state/agents/frontend/status", lead.ID, ""); code != http.StatusForbidden {
+		t.Errorf("other namespace delete: expected 403, got %d", code)
+	}
+	if code := do("PUT", "/api/state/config/db", "", `{"ok":true}`); code != http.StatusOK {
+		t.Errorf("ungoverned key: expected 200, got %d", code)
+	}
+
+	resp, _ = http.Post(env.URL+"/api/policies/evaluate", "application/json",
+		strings.NewReader(`{"action":"state.write","resource":"agents/lead/x","instance_id":"`+lead.ID+`"}`))
+	var d struct {
+		Allowed bool `json:"allowed"`
+	}
+	json.NewDecoder(resp.Body).Decode(&d)
+	resp.Body.Close()
+	if !d.Allowed {
+		t.Error("expected evaluate to allow lead writing its own namespace")
+	}
+}
+
+func TestProjectStatus(t *testing.T) {
+	env := koortest.New(t)
+	ctx := context.Background()
+	env.SeedInstance("truck-wash-frontend", "")
+	env.SeedInstance("other-backend", "")
+	env.SeedState("Truck-Wash/frontend-task", `{"task":"dark mode"}`)
+	env.Specs.ProposeRule(ctx, specs.Rule{Project: "Truck-Wash", RuleID: "no-todo", Pattern: "TODO", Message: "no TODOs"})
+
+	answered, _ := env.Events.Publish(ctx, "truck-wash.frontend.request", json.RawMessage(`{"need":"PATCH"}`), "")
+	env.Events.Publish(ctx, "truck-wash.backend.request", json.RawMessage(`{"need":"auth"}`), "")
+	env.Events.Publish(ctx, "truck-wash.controller.approved", json.RawMessage(fmt.Sprintf(`{"request_id":%d}`, answered.ID)), "")
+	env.Events.Publish(ctx, "truck-wash.frontend.done", json.RawMessage(`{"feature":"login"}`), "")
+
+	resp, err := http.Get(env.URL + "/api/projects/Truck-Wash/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var status struct {
+		Agents []struct {
+			Name string `json:"name"`
+			Role string `json:"role"`
+			Task *struct {
+				Value json.RawMessage `json:"value"`
+			} `json:"task"`
+		} `json:"agents"`
+		PendingRequests []events.Event `json:"pending_requests"`
+		PendingRules    []specs.Rule   `json:"pending_rules"`
+		Milestones      []events.Event `json:"milestones"`
+		Compliance      map[string]any `json:"compliance"`
+	}
+	json.NewDecoder(resp.Body).Decode(&status)
+
+	if len(status.Agents) != 1 || status.Agents[0].Role != "frontend" || status.Agents[0].Task == nil {
+		t.Fatalf("unexpected agents: %+v", status.Agents)
+	}
+	if string(status.Agents[0].Task.Value) != `{"task":"dark mode"}` {
+		t.Errorf("unexpected task: %s", status.Agents[0].Task.Value)
+	}
+	if len(status.PendingRequests) != 1 || status.PendingRequests[0].Topic != "truck-wash.backend.request" {
+		t.Errorf("unexpected pending requests: %+v", status.PendingRequests)
+	}
+	if len(status.PendingRules) != 1 || status.PendingRules[0].RuleID != "no-todo" {
+		t.Errorf("unexpected pending rules: %+v", status.PendingRules)
+	}
+	if len(status.Milestones) != 1 || status.Milestones[0].Topic != "truck-wash.frontend.done" {
+		t.Errorf("unexpected milestones: %+v", status.Milestones)
+	}
+	if status.Compliance == nil {
+		t.Error("expected compliance summary")
+	}
+}
+
+func TestProjectPending(t *testing.T) {
+	env := koortest.New(t)
+	ctx := context.Background()
+	frontend := env.SeedInstance("truck-wash-frontend", "")
+	env.SeedInstance("truck-wash-qa", "")
+	env.Instances.MarkStale(ctx, frontend.ID)
+	env.SeedState("Truck-Wash/frontend-task", `{"task":"dark mode"}`)
+	env.SeedState("Truck-Wash/qa-task", `{"task":"smoke tests"}`)
+	env.Specs.ProposeRule(ctx, specs.Rule{Project: "Truck-Wash", RuleID: "no-todo", Pattern: "TODO", Message: "no TODOs"})
+	answered, _ := env.Events.Publish(ctx, "truck-wash.frontend.request", json.RawMessage(`{"need":"PATCH"}`), "")
+	env.Events.Publish(ctx, "truck-wash.backend.request", json.RawMessage(`{"need":"auth"}`), "")
+	env.Events.Publish(ctx, "truck-wash.controller.approved", json.RawMessage(fmt.Sprintf(`{"request_id":%d}`, answered.ID)), "")
+
+	resp, err := http.Get(env.URL + "/api/projects/Truck-Wash/pending")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var pending struct {
+		Items []struct {
+			Kind     string    `json:"kind"`
+			Priority int       `json:"priority"`
+			Ref      string    `json:"ref"`
+			Since    time.Time `json:"since"`
+		} `json:"items"`
+		Counts map[string]int `json:"counts"`
+	}
+	json.NewDecoder(resp.Body).Decode(&pending)
+
+	got := map[string]int{}
+	for i, it := range pending.Items {
+		got[it.Kind+":"+it.Ref] = it.Priority
+		if it.Since.IsZero() {
+			t.Errorf("%s %s has no timestamp", it.Kind, it.Ref)
+		}
+		if i > 0 && it.Priority < pending.Items[i-1].Priority {
+			t.Errorf("items not ordered by priority: %+v", pending.Items)
+		}
+	}
+	// The qa task is held by an active agent, the frontend one is not.
+	want := map[string]int{
+		"stale_agent:" + frontend.ID:                      1,
+		"request:" + strconv.FormatInt(answered.ID+1, 10): 1,
+		"unclaimed_task:Truck-Wash/frontend-task":         2,
+		"proposed_rule:Truck-Wash/no-todo":                3,
+	}
+	if !maps.Equal(got, want) {
+		t.Errorf("unexpected pending items:\n got %v\nwant %v", got, want)
+	}
+	if pending.Counts["request"] != 1 || pending.Counts["unclaimed_task"] != 1 {
+		t.Errorf("unexpected counts: %v", pending.Counts)
+	}
+}
+
+func TestProjectHandoff(t *testing.T) {
+	env := koortest.New(t)
+	ctx := context.Background()
+	env.SeedInstance("truck-wash-backend", "")
+	env.SeedState("Truck-Wash/backend-task", `{"task":"auth API"}`)
+	env.SeedState("Truck-Wash/plan", `{"phase":"MVP"}`)
+	answered, _ := env.Events.Publish(ctx, "truck-wash.frontend.request", json.RawMessage(`{"need":"PATCH"}`), "")
+	open, _ := env.Events.Publish(ctx, "truck-wash.backend.request", json.RawMessage(`{"need":"schema"}`), "")
+	decision, _ := env.Events.Publish(ctx, "truck-wash.controller.approved", json.RawMessage(fmt.Sprintf(`{"request_id":%d}`, answered.ID)), "")
+
+	resp, err := http.Get(env.URL + "/api/projects/Truck-Wash/handoff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var h struct {
+		LastEventID int64 `json:"last_event_id"`
+		Plan        struct {
+			Notes json.RawMessage `json:"notes"`
+		} `json:"plan"`
+		Agents []struct {
+			Name string          `json:"name"`
+			Role string          `json:"role"`
+			Task json.RawMessage `json:"task"`
+		} `json:"agents"`
+		Approvals []struct {
+			Kind string `json:"kind"`
+			Ref  string `json:"ref"`
+		} `json:"approvals"`
+		Decisions []struct {
+			EventID   int64 `json:"event_id"`
+			RequestID int64 `json:"request_id"`
+		} `json:"decisions"`
+		Briefing string `json:"briefing"`
+	}
+	json.NewDecoder(resp.Body).Decode(&h)
+
+	if h.LastEventID != decision.ID {
+		t.Errorf("last_event_id = %d, want %d", h.LastEventID, decision.ID)
+	}
+	if string(h.Plan.Notes) != `{"phase":"MVP"}` {
+		t.Errorf("plan notes = %s", h.Plan.Notes)
+	}
+	if len(h.Agents) != 1 || h.Agents[0].Role != "backend" || string(h.Agents[0].Task) != `{"task":"auth API"}` {
+		t.Errorf("unexpected agents: %+v", h.Agents)
+	}
+	if len(h.Approvals) != 1 || h.Approvals[0].Ref != strconv.FormatInt(open.ID, 10) {
+		t.Errorf("unexpected approvals: %+v", h.Approvals)
+	}
+	if len(h.Decisions) != 1 || h.Decisions[0].RequestID != answered.ID {
+		t.Errorf("unexpected decisions: %+v", h.Decisions)
+	}
+	if !strings.Contains(h.Briefing, "truck-wash-backend (backend)") {
+		t.Errorf("briefing does not mention the agent:\n%s", h.Briefing)
+	}
+
+	resp, err = http.Get(env.URL + "/api/projects/Truck-Wash/handoff?format=markdown&decisions=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/markdown") {
+		t.Errorf("content type = %q", ct)
+	}
+	if !strings.HasPrefix(string(body), "# Handoff: Truck-Wash") || !strings.Contains(string(body), "## Recent decisions\n\nNone.") {
+		t.Errorf("unexpected markdown:\n%s", body)
+	}
+}
+
+func TestDigest(t *testing.T) {
+	env := koortest.New(t)
+	ctx := context.Background()
+	checkpoint, _ := env.Events.Publish(ctx, "truck-wash.controller.started", json.RawMessage(`{}`), "")
+	env.Events.Publish(ctx, "truck-wash.backend.done", json.RawMessage(`{"task":"auth API"}`), "")
+	env.Events.Publish(ctx, "truck-wash.backend.done", json.RawMessage(`{"task":"login"}`), "")
+	env.Events.Publish(ctx, "truck-wash.frontend.request", json.RawMessage(`{"need":"PATCH"}`), "")
+	last, _ := env.Events.Publish(ctx, "other.api.done", json.RawMessage(`{}`), "")
+	env.SeedState("Truck-Wash/backend-task", `{"task":"next"}`)
+	env.SeedState("Other/notes", `{}`)
+	env.Specs.ProposeRule(ctx, specs.Rule{Project: "Truck-Wash", RuleID: "no-todo", Pattern: "TODO", ProposedBy: "backend"})
+
+	resp, err := http.Get(env.URL + "/api/digest?project=Truck-Wash&since=" + strconv.FormatInt(checkpoint.ID, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var d struct {
+		LastEventID int64 `json:"last_event_id"`
+		Events      int   `json:"events"`
+		Agents      []struct {
+			Agent    string            `json:"agent"`
+			Done     []json.RawMessage `json:"done"`
+			Requests []json.RawMessage `json:"requests"`
+		} `json:"agents"`
+		StateChanged []struct {
+			Key string `json:"key"`
+		} `json:"state_changed"`
+		RulesProposed []struct {
+			RuleID string `json:"rule_id"`
+		} `json:"rules_proposed"`
+		Summary string `json:"summary"`
+	}
+	json.NewDecoder(resp.Body).Decode(&d)
+
+	if d.LastEventID != last.ID || d.Events != 3 {
+		t.Errorf("last_event_id = %d (want %d), events = %d (want 3)", d.LastEventID, last.ID, d.Events)
+	}
+	if len(d.Agents) != 2 || d.Agents[0].Agent != "truck-wash.backend" || len(d.Agents[0].Done) != 2 ||
+		d.Agents[1].Agent != "truck-wash.frontend" || len(d.Agents[1].Requests) != 1 {
+		t.Errorf("unexpected agents: %+v", d.Agents)
+	}
+	if len(d.StateChanged) != 1 || d.StateChanged[0].Key != "Truck-Wash/backend-task" {
+		t.Errorf("unexpected state changes: %+v", d.StateChanged)
+	}
+	if len(d.RulesProposed) != 1 || d.RulesProposed[0].RuleID != "no-todo" {
+		t.Errorf("unexpected proposed rules: %+v", d.RulesProposed)
+	}
+	if !strings.Contains(d.Summary, "truck-wash.backend: 2 done, 0 requests") {
+		t.Errorf("summary does not group the agent's events:\n%s", d.Summary)
+	}
+
+	// Nothing has happened in the project.
+	resp, err = http.Get(env.URL + "/api/digest?project=Quiet&format=markdown&since=" + strconv.FormatInt(checkpoint.ID, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), "Nothing new.") {
+		t.Errorf("expected an empty digest, got:\n%s", body)
+	}
+
+	for _, since := range []string{"", "yesterday"} {
+		resp, _ := http.Get(env.URL + "/api/digest?since=" + since)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("since=%q: expected 400, got %d", since, resp.StatusCode)
+		}
+	}
+}
+
+func TestPublicStatusPage(t *testing.T) {
+	env := koortest.New(t, koortest.WithAuthToken("secret"),
+		koortest.WithStatusPage("Truck-Wash", "agents,milestones,last_event"))
+	status := httptest.NewServer(env.Koor.StatusHandler())
+	defer status.Close()
+
+	env.SeedInstance("Truck-Wash-backend", "/work/truck-wash")
+	env.SeedInstance("Hidden-backend", "/work/hidden")
+	env.Milestones.Create(context.Background(), milestones.Milestone{Project: "Truck-Wash", Name: "MVP", Tasks: []string{"login"}})
+	env.Events.Publish(context.Background(), "truck-wash.frontend.done", json.RawMessage(`{"feature":"login"}`), "")
+
+	// No token needed.
+	resp, _ := http.Get(status.URL + "/status.json")
+	data, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status.json: expected 200, got %d: %s", resp.StatusCode, data)
+	}
+	var st struct {
+		Projects []struct {
+			Project    string `json:"project"`
+			Agents     []struct{ Name, Status string }
+			Milestones []struct {
+				Name      string `json:"name"`
+				Completed int    `json:"completed"`
+			} `json:"milestones"`
+			LastEvent *time.Time `json:"last_event"`
+		} `json:"projects"`
+	}
+	json.Unmarshal(data, &st)
+	if len(st.Projects) != 1 || st.Projects[0].Project != "Truck-Wash" {
+		t.Fatalf("expected only Truck-Wash: %s", data)
+	}
+	p := st.Projects[0]
+	if len(p.Agents) != 1 || p.Agents[0].Name != "Truck-Wash-backend" || len(p.Milestones) != 1 ||
+		p.Milestones[0].Completed != 1 || p.LastEvent == nil {
+		t.Errorf("unexpected project status: %s", data)
+	}
+	if strings.Contains(string(data), "intent") || strings.Contains(string(data), "/work/") {
+		t.Errorf("status leaks agent details: %s", data)
+	}
+
+	resp, _ = http.Get(status.URL + "/")
+	data, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(data), "MVP") || !strings.Contains(string(data), "Truck-Wash-backend") {
+		t.Errorf("status page: %d: %s", resp.StatusCode, data)
+	}
+
+	// The API is not reachable through the status port.
+	for _, path := range []string{"/api/state", "/api/instances", "/rules"} {
+		resp, _ = http.Get(status.URL + path)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("GET %s: expected 404, got %d", path, resp.StatusCode)
+		}
+	}
+}
+
+func TestPublicStatusPageExposeAllowlist(t *testing.T) {
+	env := koortest.New(t, koortest.WithStatusPage("Truck-Wash", "last_event"))
+	status := httptest.NewServer(env.Koor.StatusHandler())
+	defer status.Close()
+	env.SeedInstance("Truck-Wash-backend", "/work/truck-wash")
+
+	resp, _ := http.Get(status.URL + "/status.json")
+	data, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if strings.Contains(string(data), "agents") || strings.Contains(string(data), "milestones") {
+		t.Errorf("expected only last_event to be exposed: %s", data)
+	}
+
+	if _, err := server.ParseStatusExpose("agents,secrets"); err == nil {
+		t.Error("expected error for unknown section")
+	}
+}
+
+// mcpCall makes one MCP JSON-RPC request and returns the result, starting
+// a session on the first call.
+func mcpCall(t *testing.T, url string, session *string, method string, params any) json.RawMessage {
+	t.Helper()
+	return mcpCallAs(t, url, "", session, method, params)
+}
+
+// mcpCallAs is mcpCall with a bearer token.
+func mcpCallAs(t *testing.T, url, token string, session *string, method string, params any) json.RawMessage {
+	t.Helper()
+	body, _ := json.Marshal(map[string]any{"jsonrpc": "2.0", "id": 1, "method": method, "params": params})
+	req, _ := http.NewRequest("POST", url+"/mcp", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if *session != "" {
+		req.Header.Set("Mcp-Session-Id", *session)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if id := resp.Header.Get("Mcp-Session-Id"); id != "" {
+		*session = id
+	}
+	var out struct {
+		Result json.RawMessage `json:"result"`
+		Error  any             `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil || out.Error != nil {
+		t.Fatalf("%s: status %d, error %v %v", method, resp.StatusCode, err, out.Error)
+	}
+	return out.Result
+}
+
+func TestMCPDataTools(t *testing.T) {
+	env := koortest.New(t, koortest.WithMCPDataTools())
+	var session string
+	mcpCall(t, env.URL, &session, "initialize", map[string]any{
+		"protocolVersion": "2025-03-26", "capabilities": map[string]any{},
+		"clientInfo": map[string]any{"name": "test", "version": "1"},
+	})
+
+	tools := string(mcpCall(t, env.URL, &session, "tools/list", map[string]any{}))
+	for _, name := range []string{"publish_event", "get_state", "set_state"} {
+		if !strings.Contains(tools, `"`+name+`"`) {
+			t.Errorf("tools/list missing %s", name)
+		}
+	}
+
+	call := func(name string, args map[string]any) (string, bool) {
+		var res struct {
+			Content []struct {
+				Text string `json:"text"`
+			} `json:"content"`
+			IsError bool `json:"isError"`
+		}
+		json.Unmarshal(mcpCall(t, env.URL, &session, "tools/call", map[string]any{"name": name, "arguments": args}), &res)
+		if len(res.Content) == 0 {
+			t.Fatalf("%s: empty result", name)
+		}
+		return res.Content[0].Text, res.IsError
+	}
+
+	if text, isErr := call("set_state", map[string]any{"key": "Truck-Wash/backend-task", "value": `{"step":1}`}); isErr {
+		t.Fatalf("set_state: %s", text)
+	}
+	if text, isErr := call("set_state", map[string]any{"key": "Truck-Wash/backend-task", "value": `{"step":2}`, "expected_version": "5"}); !isErr || !strings.Contains(text, "409") {
+		t.Errorf("set_state with a stale version should fail with 409: %s", text)
+	}
+	text, isErr := call("get_state", map[string]any{"key": "Truck-Wash/backend-task"})
+	if isErr || !strings.Contains(text, `"step": 1`) || !strings.Contains(text, `"version": "1"`) {
+		t.Errorf("get_state: %s", text)
+	}
+	if text, isErr := call("get_state", map[string]any{"key": "missing"}); !isErr || !strings.Contains(text, "404") {
+		t.Errorf("get_state of a missing key should fail with 404: %s", text)
+	}
+	if text, isErr := call("publish_event", map[string]any{"topic": "truck-wash.backend.done", "data": `{"feature":"login"}`}); isErr {
+		t.Fatalf("publish_event: %s", text)
+	}
+	history, _ := env.Events.History(context.Background(), 1, "truck-wash.*")
+	if len(history) != 1 || string(history[0].Data) != `{"feature":"login"}` {
+		t.Errorf("expected the published event, got %+v", history)
+	}
+
+	// Data tool calls count as MCP calls, not REST calls.
+	resp, _ := http.Get(env.URL + "/api/metrics")
+	var m struct {
+		TokenTax struct {
+			MCPCalls  int64 `json:"mcp_calls"`
+			DataCalls int64 `json:"mcp_data_calls"`
+			RESTCalls int64 `json:"rest_calls"`
+		} `json:"token_tax"`
+	}
+	json.NewDecoder(resp.Body).Decode(&m)
+	resp.Body.Close()
+	if m.TokenTax.DataCalls != 5 || m.TokenTax.MCPCalls < 7 || m.TokenTax.RESTCalls != 0 {
+		t.Errorf("unexpected token tax: %+v", m.TokenTax)
+	}
+}
+
+func TestMCPDataToolsDisabledByDefault(t *testing.T) {
+	env := koortest.New(t)
+	var session string
+	mcpCall(t, env.URL, &session, "initialize", map[string]any{
+		"protocolVersion": "2025-03-26", "capabilities": map[string]any{},
+		"clientInfo": map[string]any{"name": "test", "version": "1"},
+	})
+	if tools := string(mcpCall(t, env.URL, &session, "tools/list", map[string]any{})); strings.Contains(tools, "set_state") {
+		t.Errorf("data tools should be off by default: %s", tools)
+	}
+}
+
+func TestMCPTaskToolsUseCallerToken(t *testing.T) {
+	env := koortest.New(t, koortest.WithAuthToken("root"))
+	ctx := context.Background()
+	worker := env.SeedInstance("TW-backend", "")
+	_, reader, _ := env.Tokens.Create(ctx, tokens.Token{Name: "viewer", Scopes: []string{"read"}})
+	_, agent, _ := env.Tokens.Create(ctx, tokens.Token{Name: "backend", InstanceID: worker.ID, Scopes: []string{"read", "tasks:work"}})
+	task, _ := env.Tasks.Create(ctx, tasks.Task{Project: "TW", Title: "build"})
+
+	call := func(token, name string, args map[string]any) (string, bool) {
+		t.Helper()
+		var session string
+		mcpCallAs(t, env.URL, token, &session, "initialize", map[string]any{
+			"protocolVersion": "2025-03-26", "capabilities": map[string]any{},
+			"clientInfo": map[string]any{"name": "test", "version": "1"},
+		})
+		var res struct {
+			Content []struct {
+				Text string `json:"text"`
+			} `json:"content"`
+			IsError bool `json:"isError"`
+		}
+		json.Unmarshal(mcpCallAs(t, env.URL, token, &session, "tools/call", map[string]any{"name": name, "arguments": args}), &res)
+		if len(res.Content) == 0 {
+			t.Fatalf("%s: empty result", name)
+		}
+		return res.Content[0].Text, res.IsError
+	}
+
+	// A read-only token may not claim or complete work for another agent.
+	claim := map[string]any{"project": "TW", "instance_id": worker.ID}
+	if text, isErr := call(reader, "claim_task", claim); !isErr || !strings.Contains(text, "403") {
+		t.Errorf("claim_task with a read-only token should fail with 403: %s", text)
+	}
+	if text, isErr := call(agent, "claim_task", claim); isErr || !strings.Contains(text, task.ID) {
+		t.Fatalf("claim_task: %s", text)
+	}
+	complete := map[string]any{"task_id": task.ID, "instance_id": worker.ID, "result": `{"pr":42}`}
+	if text, isErr := call(reader, "complete_task", complete); !isErr || !strings.Contains(text, "403") {
+		t.Errorf("complete_task with a read-only token should fail with 403: %s", text)
+	}
+	if text, isErr := call(agent, "complete_task", complete); isErr || !strings.Contains(text, `"status": "done"`) {
+		t.Errorf("complete_task: %s", text)
+	}
+}
+
+func TestMCPResources(t *testing.T) {
+	env := koortest.New(t, koortest.WithMCPStateResources("config/"))
+	env.SeedContract("Truck-Wash", "api", `{"kind":"contract","endpoints":{"GET /api/trucks":{"response":{"id":{"type":"string"}}}}}`)
+	env.Specs.Put(context.Background(), "Truck-Wash", "notes", []byte(`{"todo":["login"]}`))
+	env.SeedState("config/flags", `{"dark":true}`)
+	env.SeedState("secret/key", `"x"`)
+
+	var session string
+	mcpCall(t, env.URL, &session, "initialize", map[string]any{
+		"protocolVersion": "2025-03-26", "capabilities": map[string]any{},
+		"clientInfo": map[string]any{"name": "test", "version": "1"},
+	})
+	templates := string(mcpCall(t, env.URL, &session, "resources/templates/list", map[string]any{}))
+	for _, uri := range []string{"koor://specs/{project}/{name}", "koor://contracts/{project}/{name}", "koor://state/{+key}"} {
+		if !strings.Contains(templates, uri) {
+			t.Errorf("resources/templates/list missing %s: %s", uri, templates)
+		}
+	}
+
+	read := func(uri string) (string, bool) {
+		body, _ := json.Marshal(map[string]any{"jsonrpc": "2.0", "id": 1, "method": "resources/read", "params": map[string]any{"uri": uri}})
+		req, _ := http.NewRequest("POST", env.URL+"/mcp", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json, text/event-stream")
+		req.Header.Set("Mcp-Session-Id", session)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var out struct {
+			Result struct {
+				Contents []struct {
+					Text string `json:"text"`
+				} `json:"contents"`
+			} `json:"result"`
+			Error any `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&out)
+		if out.Error != nil || len(out.Result.Contents) == 0 {
+			return fmt.Sprint(out.Error), false
+		}
+		return out.Result.Contents[0].Text, true
+	}
+
+	if text, ok := read("koor://specs/Truck-Wash/notes"); !ok || text != `{"todo":["login"]}` {
+		t.Errorf("spec resource: %v %s", ok, text)
+	}
+	if text, ok := read("koor://contracts/Truck-Wash/api"); !ok || !strings.Contains(text, "GET /api/trucks") {
+		t.Errorf("contract resource: %v %s", ok, text)
+	}
+	if text, ok := read("koor://contracts/Truck-Wash/notes"); ok {
+		t.Errorf("a spec that is not a contract should not read as one: %s", text)
+	}
+	if text, ok := read("koor://specs/Truck-Wash/missing"); ok || !strings.Contains(text, "404") {
+		t.Errorf("missing spec: %v %s", ok, text)
+	}
+	if text, ok := read("koor://state/config/flags"); !ok || text != `{"dark":true}` {
+		t.Errorf("state resource: %v %s", ok, text)
+	}
+	if text, ok := read("koor://state/secret/key"); ok || !strings.Contains(text, "not exposed") {
+		t.Errorf("unexposed state key should not be readable: %v %s", ok, text)
+	}
+
+	// A spec write is announced on the session's notification stream.
+	req, _ := http.NewRequest("GET", env.URL+"/mcp", nil)
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Mcp-Session-Id", session)
+	stream, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Body.Close()
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(stream.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	put, _ := http.NewRequest("PUT", env.URL+"/api/specs/Truck-Wash/notes", strings.NewReader(`{"todo":[]}`))
+	resp, _ := http.DefaultClient.Do(put)
+	resp.Body.Close()
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				t.Fatal("notification stream closed")
+			}
+			if strings.Contains(line, "notifications/resources/updated") && strings.Contains(line, "koor://specs/Truck-Wash/notes") {
+				return
+			}
+		case <-timeout:
+			t.Fatal("timed out waiting for notifications/resources/updated")
+		}
+	}
+}
+
+func TestMilestonesAPI(t *testing.T) {
+	env := koortest.New(t)
+
+	resp, _ := http.Post(env.URL+"/api/projects/Truck-Wash/milestones", "application/json",
+		strings.NewReader(`{"name":"MVP","due":"2099-01-01","tasks":["login","trucks-crud"]}`))
+	var m struct {
+		ID string `json:"id"`
+	}
+	json.NewDecoder(resp.Body).Decode(&m)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || m.ID == "" {
+		t.Fatalf("create milestone: status %d", resp.StatusCode)
+	}
+
+	resp, _ = http.Post(env.URL+"/api/projects/Truck-Wash/milestones", "application/json",
+		strings.NewReader(`{"name":"bad","due":"soon","tasks":["x"]}`))
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("bad due date: expected 400, got %d", resp.StatusCode)
+	}
+	resp.Body.Close()
+
+	env.Events.Publish(context.Background(), "truck-wash.frontend.done", json.RawMessage(`{"feature":"login"}`), "")
+
+	resp, _ = http.Get(env.URL + "/api/projects/Truck-Wash/milestones/" + m.ID)
+	var p struct {
+		Completed int               `json:"completed"`
+		Total     int               `json:"total"`
+		Burndown  []json.RawMessage `json:"burndown"`
+	}
+	json.NewDecoder(resp.Body).Decode(&p)
+	resp.Body.Close()
+	if p.Completed != 1 || p.Total != 2 || len(p.Burndown) == 0 {
+		t.Errorf("unexpected progress: %+v", p)
+	}
+
+	resp, _ = http.Get(env.URL + "/api/milestones")
+	var all []json.RawMessage
+	json.NewDecoder(resp.Body).Decode(&all)
+	resp.Body.Close()
+	if len(all) != 1 {
+		t.Errorf("expected 1 milestone across projects, got %d", len(all))
+	}
+
+	req, _ := http.NewRequest("DELETE", env.URL+"/api/projects/Truck-Wash/milestones/"+m.ID, nil)
+	resp, _ = http.DefaultClient.Do(req)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("delete: expected 200, got %d", resp.StatusCode)
+	}
+}
+
+func TestContractDrift(t *testing.T) {
+	env := koortest.New(t)
+	ctx := context.Background()
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"item_id": "1"})
+	}))
+	defer backend.Close()
+
+	env.SeedContract("TW", "api", `{"kind":"contract","version":1,"endpoints":{"GET /api/items/1":{"response_status":200,"response":{"id":{"type":"string","required":true}}}}}`)
+
+	// Not checked yet.
+	resp, _ := http.Get(env.URL + "/api/contracts/TW/api/drift")
+	data, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || !strings.Contains(string(data), `"drifting":false`) || !strings.Contains(string(data), `"endpoints":[]`) {
+		t.Fatalf("expected empty drift, got %d: %s", resp.StatusCode, data)
+	}
+
+	body := fmt.Sprintf(`{"contract_targets":{"api":%q},"drift_interval":"10m"}`, backend.URL)
+	req, _ := http.NewRequest("PUT", env.URL+"/api/projects/TW/settings", strings.NewReader(body))
+	resp, _ = http.DefaultClient.Do(req)
+	data, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("settings: expected 200, got %d: %s", resp.StatusCode, data)
+	}
+	env.Compliance.RunDueDriftChecks(ctx)
+
+	resp, _ = http.Get(env.URL + "/api/contracts/TW/api/drift")
+	var drift struct {
+		Target    string `json:"target"`
+		Drifting  bool   `json:"drifting"`
+		Failed    int    `json:"failed"`
+		Endpoints []struct {
+			Endpoint string `json:"endpoint"`
+			Pass     bool   `json:"pass"`
+		} `json:"endpoints"`
+	}
+	json.NewDecoder(resp.Body).Decode(&drift)
+	resp.Body.Close()
+	if !drift.Drifting || drift.Target != backend.URL || drift.Failed != 1 || len(drift.Endpoints) != 1 || drift.Endpoints[0].Pass {
+		t.Errorf("unexpected drift: %+v", drift)
+	}
+
+	history, _ := env.Events.History(ctx, 10, "contract.drift")
+	if len(history) != 1 {
+		t.Errorf("expected one contract.drift event, got %d", len(history))
+	}
+
+	// A target must be an http(s) URL.
+	req, _ = http.NewRequest("PUT", env.URL+"/api/projects/TW/settings", strings.NewReader(`{"contract_targets":{"api":"localhost:8080"}}`))
+	resp, _ = http.DefaultClient.Do(req)
+	resp.Body.Close()
+	if resp.StatusCode != 400 {
+		t.Errorf("expected 400 for a bad target, got %d", resp.StatusCode)
+	}
+}
+
+func TestContractDiff(t *testing.T) {
+	env := koortest.New(t)
+
+	env.SeedContract("TW", "api", `{"kind":"contract","version":1,"endpoints":{"POST /api/trucks":{"request":{"plate":{"type":"string","required":true}},"response":{"id":{"type":"string"}}}}}`)
+	env.SeedContract("TW", "api", `{"kind":"contract","version":2,"endpoints":{"POST /api/trucks":{"request":{"plate":{"type":"string","required":true},"color":{"type":"string"}},"response":{"id":{"type":"string"}}}}}`)
+
+	resp, _ := http.Get(env.URL + "/api/contracts/TW/api/diff")
+	var diff struct {
+		V1, V2     int64
+		Compatible bool
+		Breaking   []contracts.Change
+		Additive   []contracts.Change
+	}
+	json.NewDecoder(resp.Body).Decode(&diff)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || diff.V1 != 1 || diff.V2 != 2 || !diff.Compatible ||
+		len(diff.Additive) != 1 || diff.Additive[0].Path != "POST /api/trucks request.color" {
+		t.Fatalf("diff 1..2: %d %+v", resp.StatusCode, diff)
+	}
+
+	// A proposed contract is compared with the latest stored version.
+	resp, _ = http.Post(env.URL+"/api/contracts/TW/api/diff", "application/json",
+		strings.NewReader(`{"kind":"contract","version":3,"endpoints":{"POST /api/trucks":{"request":{"plate":{"type":"number","required":true}}}}}`))
+	diff.Breaking = nil
+	json.NewDecoder(resp.Body).Decode(&diff)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || diff.V1 != 2 || diff.Compatible || len(diff.Breaking) != 3 {
+		t.Fatalf("proposed diff: %d %+v", resp.StatusCode, diff)
+	}
+
+	for path, want := range map[string]int{
+		"/api/contracts/TW/api/diff?v1=9":      404,
+		"/api/contracts/TW/api/diff?v2=x":      400,
+		"/api/contracts/TW/missing/diff":       404,
+		"/api/contracts/TW/api/diff?v1=2&v2=1": 200,
+	} {
+		resp, _ := http.Get(env.URL + path)
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("%s: expected %d, got %d", path, want, resp.StatusCode)
+		}
+	}
+}
+
+func TestContractExamples(t *testing.T) {
+	env := koortest.New(t)
+	env.SeedContract("TW", "api", `{"kind":"contract","version":1,"endpoints":{"POST /api/trucks":{"request":{"plate":{"type":"string","required":true}},"response_status":201}}}`)
+	base := env.URL + "/api/contracts/TW/api/examples"
+
+	// A payload that violates the contract is rejected with its violations.
+	resp, _ := http.Post(base, "application/json",
+		strings.NewReader(`{"name":"bad","endpoint":"POST /api/trucks","payload":{"plate":42}}`))
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 400 || !strings.Contains(string(body), "violations") {
+		t.Fatalf("invalid example: expected 400 with violations, got %d: %s", resp.StatusCode, body)
+	}
+
+	resp, _ = http.Post(base, "application/json",
+		strings.NewReader(`{"name":"basic","endpoint":"POST /api/trucks","payload":{"plate":"AB-123"}}`))
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("save example: expected 200, got %d", resp.StatusCode)
+	}
+
+	resp, _ = http.Get(base + "?endpoint=" + url.QueryEscape("POST /api/trucks"))
+	var list []map[string]any
+	json.NewDecoder(resp.Body).Decode(&list)
+	resp.Body.Close()
+	if len(list) != 1 || list[0]["name"] != "basic" || list[0]["direction"] != "request" {
+		t.Fatalf("unexpected examples: %v", list)
+	}
+
+	resp, _ = http.Post(env.URL+"/api/contracts/TW/missing/examples", "application/json",
+		strings.NewReader(`{"name":"x","endpoint":"POST /api/trucks","payload":{}}`))
+	resp.Body.Close()
+	if resp.StatusCode != 404 {
+		t.Errorf("unknown contract: expected 404, got %d", resp.StatusCode)
+	}
+
+	req, _ := http.NewRequest("DELETE", base+"/basic", nil)
+	resp, _ = http.DefaultClient.Do(req)
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Errorf("delete: expected 200, got %d", resp.StatusCode)
+	}
+	resp, _ = http.DefaultClient.Do(req)
+	resp.Body.Close()
+	if resp.StatusCode != 404 {
+		t.Errorf("second delete: expected 404, got %d", resp.StatusCode)
+	}
+}
+
+func TestProjectSettings(t *testing.T) {
+	env := koortest.New(t)
+	env.SeedRules("TW", specs.Rule{RuleID: "no-todo", Pattern: "TODO", Message: "no TODOs", Severity: "error", MatchType: "regex"})
+	env.SeedRules("_global", specs.Rule{RuleID: "no-fixme", Pattern: "FIXME", Message: "no FIXMEs", Severity: "error", MatchType: "regex"})
+
+	put := func(path, body string) *http.Response {
+		req, _ := http.NewRequest("PUT", env.URL+path, strings.NewReader(body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	// Without settings, state writes are not validated.
+	resp := put("/api/state/TW/notes", `"TODO later"`)
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("unvalidated write: expected 200, got %d", resp.StatusCode)
+	}
+
+	resp = put("/api/projects/TW/settings", `{"event_retention":"-1h"}`)
+	resp.Body.Close()
+	if resp.StatusCode != 400 {
+		t.Errorf("bad retention: expected 400, got %d", resp.StatusCode)
+	}
+
+	resp = put("/api/projects/TW/settings", `{"validate_state_writes":true,"global_rules":false,"webhook_defaults":{"patterns":["tw.*"]}}`)
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("put settings: expected 200, got %d", resp.StatusCode)
+	}
+
+	resp = put("/api/state/TW/notes", `"TODO later"`)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 422 || !strings.Contains(string(body), "no-todo") {
+		t.Errorf("validated write: expected 422 naming no-todo, got %d: %s", resp.StatusCode, body)
+	}
+	resp = put("/api/state/Other/notes", `"TODO later"`)
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Errorf("other project write: expected 200, got %d", resp.StatusCode)
+	}
+
+	// global_rules=false drops _global rules from validation.
+	resp, _ = http.Post(env.URL+"/api/validate/TW", "application/json", strings.NewReader(`{"content":"FIXME"}`))
+	var result struct {
+		Count int `json:"count"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	resp.Body.Close()
+	if result.Count != 0 {
+		t.Errorf("expected _global rules skipped, got %d violations", result.Count)
+	}
+
+	resp, _ = http.Post(env.URL+"/api/webhooks", "application/json",
+		strings.NewReader(`{"id":"wh-tw","url":"http://example.com/hook","project":"TW"}`))
+	resp.Body.Close()
+	wh, err := env.Webhooks.Get(context.Background(), "wh-tw")
+	if err != nil || len(wh.Patterns) != 1 || wh.Patterns[0] != "tw.*" {
+		t.Errorf("expected webhook default patterns [tw.*], got %+v (%v)", wh, err)
+	}
+
+	req, _ := http.NewRequest("DELETE", env.URL+"/api/projects/TW/settings", nil)
+	resp, _ = http.DefaultClient.Do(req)
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Errorf("reset settings: expected 200, got %d", resp.StatusCode)
+	}
+	resp = put("/api/state/TW/notes", `"TODO later"`)
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Errorf("write after reset: expected 200, got %d", resp.StatusCode)
+	}
+}
+
+func TestScopedTokens(t *testing.T) {
+	env := koortest.New(t, koortest.WithAuthToken("root"))
+	backend := env.SeedInstance("backend", "/tmp/be")
+	frontend := env.SeedInstance("frontend", "/tmp/fe")
+
+	do := func(token, method, path, body string) int {
+		t.Helper()
+		req, _ := http.NewRequest(method, env.URL+path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// The registration token is scoped to the instance's own namespace.
+	tok := backend.Token
+	for _, tc := range []struct {
+		method, path string
+		want         int
+	}{
+		{"GET", "/api/state", 200},
+		{"PUT", "/api/state/agents/backend/status", 200},
+		{"PUT", "/api/state/agents/frontend/status", 403},
+		{"PUT", "/api/state/config/db", 403},
+		{"POST", "/api/instances/" + backend.ID + "/heartbeat", 200},
+		{"POST", "/api/instances/" + frontend.ID + "/heartbeat", 403},
+		{"DELETE", "/api/instances/" + frontend.ID, 403},
+		{"POST", "/api/events/publish", 200},
+		{"PUT", "/api/specs/TW/api", 403},
+		{"GET", "/api/tokens", 403},
+	} {
+		body := `{"ok":true}`
+		if tc.path == "/api/events/publish" {
+			body = `{"topic":"build.done","data":1}`
+		}
+		if got := do(tok, tc.method, tc.path, body); got != tc.want {
+			t.Errorf("%s %s: expected %d, got %d", tc.method, tc.path, tc.want, got)
+		}
+	}
+	if do("bogus", "GET", "/api/state", "") != 401 {
+		t.Error("unknown token should be rejected")
+	}
+
+	// The caller recorded for a scoped write comes from the token, not headers.
+	req, _ := http.NewRequest("PUT", env.URL+"/api/state/agents/backend/status/meta", strings.NewReader(`{}`))
+	req.Header.Set("Authorization", "Bearer "+tok)
+	req.Header.Set("X-Koor-Instance", frontend.ID)
+	req.Header.Set("X-Koor-Actor", "frontend")
+	resp, _ := http.DefaultClient.Do(req)
+	resp.Body.Close()
+	meta, _ := env.State.GetMeta(context.Background(), "agents/backend/status")
+	if meta == nil || meta.Owner != backend.ID {
+		t.Errorf("expected meta owned by %s, got %+v", backend.ID, meta)
+	}
+	entry, _ := env.State.Get(context.Background(), "agents/backend/status")
+	if entry == nil || entry.UpdatedBy != "backend" {
+		t.Errorf("expected write attributed to backend, got %+v", entry)
+	}
+
+	// API tokens are issued by an admin and can be narrowed and revoked.
+	req, _ = http.NewRequest("POST", env.URL+"/api/tokens",
+		strings.NewReader(`{"name":"ci","scopes":["read","state:write:ci/*"]}`))
+	req.Header.Set("Authorization", "Bearer root")
+	resp, _ = http.DefaultClient.Do(req)
+	var created struct {
+		Token string `json:"token"`
+		Info  struct {
+			ID string `json:"id"`
+		} `json:"info"`
+	}
+	json.NewDecoder(resp.Body).Decode(&created)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || created.Token == "" {
+		t.Fatalf("create token: %d", resp.StatusCode)
+	}
+	if do(created.Token, "PUT", "/api/state/ci/run", `1`) != 200 {
+		t.Error("ci token should write under ci/")
+	}
+	if do(created.Token, "POST", "/api/events/publish", `{"topic":"x","data":1}`) != 403 {
+		t.Error("ci token should not publish events")
+	}
+	if do(created.Token, "GET", "/api/tokens/whoami", "") != 200 {
+		t.Error("any token may call whoami")
+	}
+	if do("root", "DELETE", "/api/tokens/"+created.Info.ID, "") != 200 {
+		t.Fatal("revoke failed")
+	}
+	if do(created.Token, "GET", "/api/state", "") != 401 {
+		t.Error("revoked token should be rejected")
+	}
+}
+
+func TestAdminRoutesNeedAdminScope(t *testing.T) {
+	env := koortest.New(t, koortest.WithAuthToken("root"))
+	_, writer, _ := env.Tokens.Create(context.Background(), tokens.Token{Name: "writer", Scopes: []string{"read", "write"}})
+
+	do := func(token, method, path, body string) int {
+		t.Helper()
+		req, _ := http.NewRequest(method, env.URL+path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	for _, tc := range []struct{ method, path string }{
+		{"GET", "/api/admin/gc-report"},
+		{"POST", "/api/admin/gc"},
+		{"GET", "/api/admin/quarantine"},
+		{"POST", "/api/admin/quarantine/sweep"},
+		{"POST", "/api/admin/quarantine/q1/restore"},
+		{"DELETE", "/api/admin/quarantine/q1"},
+		{"POST", "/api/policies"},
+		{"DELETE", "/api/policies/p1"},
+	} {
+		if got := do(writer, tc.method, tc.path, `{}`); got != 403 {
+			t.Errorf("%s %s without admin scope: expected 403, got %d", tc.method, tc.path, got)
+		}
+		if got := do("root", tc.method, tc.path, `{}`); got == 403 {
+			t.Errorf("%s %s with the global token: unexpected 403", tc.method, tc.path)
+		}
+	}
+	// Reading and dry-running policies stay open to ordinary tokens.
+	if got := do(writer, "GET", "/api/policies", ""); got == 403 {
+		t.Errorf("GET /api/policies: unexpected 403")
+	}
+	if got := do(writer, "POST", "/api/policies/evaluate", `{}`); got == 403 {
+		t.Errorf("POST /api/policies/evaluate: unexpected 403")
+	}
+}
+
+func TestUserRoles(t *testing.T) {
+	env := koortest.New(t, koortest.WithAuthToken("root"))
+	ctx := context.Background()
+	secrets := map[string]string{}
+	for _, role := range users.Roles {
+		_, secret, err := env.Users.Create(ctx, role+"-user", role)
+		if err != nil {
+			t.Fatal(err)
+		}
+		secrets[role] = secret
+	}
+	env.SeedState("TW/config", `1`)
+
+	do := func(token, method, path, body string) int {
+		t.Helper()
+		req, _ := http.NewRequest(method, env.URL+path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// Expected status for viewer, agent, controller, admin.
+	for _, tc := range []struct {
+		method, path, body string
+		want               [4]int
+	}{
+		{"GET", "/api/state/TW/config", "", [4]int{200, 200, 200, 200}},
+		{"PUT", "/api/state/TW/config", `2`, [4]int{403, 200, 200, 200}},
+		{"GET", "/api/audit", "", [4]int{403, 403, 200, 200}},
+		{"POST", "/api/rules/TW/missing/accept", "", [4]int{403, 403, 404, 404}},
+		{"POST", "/api/templates", `{}`, [4]int{403, 403, 400, 400}},
+		{"GET", "/api/users", "", [4]int{403, 403, 403, 200}},
+		{"PUT", "/api/rules/TW/auto-accept", `{"severities":["info"]}`, [4]int{403, 403, 200, 200}},
+		{"DELETE", "/api/rules/TW/auto-accept", "", [4]int{403, 403, 200, 404}}, // the controller deleted it
+		{"POST", "/api/policies", `{}`, [4]int{403, 403, 403, 400}},
+		{"DELETE", "/api/policies/missing", "", [4]int{403, 403, 403, 404}},
+		{"POST", "/api/admin/gc", `{}`, [4]int{403, 403, 403, 400}},
+		{"POST", "/api/admin/quarantine/sweep", "", [4]int{403, 403, 403, 200}},
+		{"POST", "/api/admin/quarantine/missing/restore", "", [4]int{403, 403, 403, 404}},
+		{"DELETE", "/api/admin/quarantine/missing", "", [4]int{403, 403, 403, 404}},
+	} {
+		for i, role := range users.Roles {
+			if got := do(secrets[role], tc.method, tc.path, tc.body); got != tc.want[i] {
+				t.Errorf("%s %s as %s: expected %d, got %d", tc.method, tc.path, role, tc.want[i], got)
+			}
+		}
+	}
+
+	// Admins manage users; the last admin cannot be demoted.
+	if do(secrets["admin"], "POST", "/api/users", `{"name":"ops","role":"viewer"}`) != 200 {
+		t.Error("admin should create users")
+	}
+	if do(secrets["admin"], "PUT", "/api/users/ops", `{"role":"controller"}`) != 200 {
+		t.Error("admin should change roles")
+	}
+	if do(secrets["admin"], "PUT", "/api/users/admin-user", `{"role":"viewer"}`) != 409 {
+		t.Error("demoting the last admin should conflict")
+	}
+	if do("root", "DELETE", "/api/users/ops", "") != 200 {
+		t.Error("global token should delete users")
+	}
+	if do(secrets["viewer"], "GET", "/api/tokens/whoami", "") != 200 {
+		t.Error("any user may call whoami")
+	}
+}
+
+func TestDashboardLogin(t *testing.T) {
+	env := koortest.New(t, koortest.WithAuthToken("root"))
+	_, secret, _ := env.Users.Create(context.Background(), "ana", users.RoleViewer)
+	dash := httptest.NewServer(env.Koor.DashboardHandler())
+	defer dash.Close()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+
+	resp, _ := client.Get(dash.URL + "/rules")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSeeOther || resp.Header.Get("Location") != "/login" {
+		t.Fatalf("expected redirect to /login, got %d %s", resp.StatusCode, resp.Header.Get("Location"))
+	}
+
+	resp, _ = client.PostForm(dash.URL+"/login", url.Values{"secret": {"wrong"}})
+	resp.Body.Close()
+	if resp.StatusCode != 401 {
+		t.Errorf("bad secret: expected 401, got %d", resp.StatusCode)
+	}
+	resp, _ = client.PostForm(dash.URL+"/login", url.Values{"secret": {secret}})
+	resp.Body.Close()
+	cookies := resp.Cookies()
+	if resp.StatusCode != http.StatusSeeOther || len(cookies) != 1 {
+		t.Fatalf("login: expected redirect with a session cookie, got %d %v", resp.StatusCode, cookies)
+	}
+
+	do := func(method, path string) int {
+		req, _ := http.NewRequest(method, dash.URL+path, nil)
+		req.AddCookie(cookies[0])
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if got := do("GET", "/rules"); got != 200 {
+		t.Errorf("rules page when signed in: expected 200, got %d", got)
+	}
+	if got := do("GET", "/api/state"); got != 200 {
+		t.Errorf("proxied read as viewer: expected 200, got %d", got)
+	}
+	if got := do("POST", "/rules/TW/r1/accept"); got != 403 {
+		t.Errorf("rule accept as viewer: expected 403, got %d", got)
+	}
+}
+
+func TestDashboardPages(t *testing.T) {
+	env := koortest.New(t)
+	ctx := context.Background()
+	dash := httptest.NewServer(env.Koor.DashboardHandler())
+	defer dash.Close()
+
+	stale := env.SeedInstance("truck-wash-backend", "")
+	env.SeedInstance("truck-wash-frontend", "")
+	env.Instances.MarkStale(ctx, stale.ID)
+	env.Events.Publish(ctx, "truck-wash.backend.done", json.RawMessage(`{"feature":"login"}`), "backend")
+	env.Events.Publish(ctx, "other.frontend.done", json.RawMessage(`{}`), "frontend")
+	env.SeedState("TW/config", `{"port":8080}`)
+	env.State.Put(ctx, "TW/config", []byte(`{"port":9090}`), "application/json", "")
+
+	get := func(path string) string {
+		t.Helper()
+		resp, err := http.Get(dash.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != 200 {
+			t.Fatalf("%s: expected 200, got %d: %s", path, resp.StatusCode, body)
+		}
+		return string(body)
+	}
+
+	for _, page := range []string{"/instances", "/events", "/state"} {
+		if body := get(page); !strings.Contains(body, `href="`+page+`" class="active"`) {
+			t.Errorf("%s: expected page with active nav link", page)
+		}
+	}
+
+	instances := get("/instances/list")
+	if !strings.Contains(instances, `class="row-stale"`) || strings.Index(instances, "truck-wash-backend") > strings.Index(instances, "truck-wash-frontend") {
+		t.Errorf("expected stale instance highlighted and listed first: %s", instances)
+	}
+
+	feed := get("/events/list?topic=truck-wash.*")
+	if !strings.Contains(feed, "truck-wash.backend.done") || strings.Contains(feed, "other.frontend.done") {
+		t.Errorf("expected feed filtered by topic: %s", feed)
+	}
+	if feed := get("/events/list?source=frontend"); strings.Contains(feed, "truck-wash.backend.done") {
+		t.Errorf("expected feed filtered by source: %s", feed)
+	}
+
+	if keys := get("/state/list?prefix=TW/"); !strings.Contains(keys, "TW/config") {
+		t.Errorf("expected key in state list: %s", keys)
+	}
+	if view := get("/state/view?key=TW%2Fconfig"); !strings.Contains(view, "9090") || !strings.Contains(view, "v1=1&amp;v2=2") {
+		t.Errorf("expected current value and a diff link to v1: %s", view)
+	}
+	if diff := get("/state/diff?key=TW%2Fconfig&v1=1&v2=2"); !strings.Contains(diff, "changed") || !strings.Contains(diff, "8080") {
+		t.Errorf("expected changed port in diff: %s", diff)
+	}
+}
+
+func TestStateMeta(t *testing.T) {
+	env := koortest.New(t)
+	env.SeedState("TW/config", `{"port":8080}`)
+	env.SeedState("TW/notes", `"hi"`)
+	owner := env.SeedInstance("backend", "/tmp/tw")
+
+	req, _ := http.NewRequest("PUT", env.URL+"/api/state/TW/config/meta",
+		strings.NewReader(`{"description":"build config","tags":["config"]}`))
+	req.Header.Set("X-Koor-Instance", owner.ID)
+	resp, _ := http.DefaultClient.Do(req)
+	var m map[string]any
+	json.NewDecoder(resp.Body).Decode(&m)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || m["owner"] != owner.ID {
+		t.Fatalf("put meta: expected 200 owned by caller, got %d: %v", resp.StatusCode, m)
+	}
+
+	req, _ = http.NewRequest("PUT", env.URL+"/api/state/TW/config/meta", strings.NewReader(`{"schema":"TW/missing"}`))
+	resp, _ = http.DefaultClient.Do(req)
+	resp.Body.Close()
+	if resp.StatusCode != 400 {
+		t.Errorf("unknown schema: expected 400, got %d", resp.StatusCode)
+	}
+
+	// The value itself is unchanged and still readable.
+	resp, _ = http.Get(env.URL + "/api/state/TW/config")
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != `{"port":8080}` {
+		t.Errorf("value changed by meta write: %s", body)
+	}
+
+	list := func(query string) []map[string]any {
+		resp, err := http.Get(env.URL + "/api/state" + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var items []map[string]any
+		json.NewDecoder(resp.Body).Decode(&items)
+		return items
+	}
+	if items := list("?tag=config"); len(items) != 1 || items[0]["key"] != "TW/config" {
+		t.Errorf("tag filter: expected TW/config, got %v", items)
+	}
+	if items := list("?orphaned=true"); len(items) != 0 {
+		t.Errorf("expected no orphans while the owner is registered, got %v", items)
+	}
+	env.Instances.Deregister(context.Background(), owner.ID)
+	if items := list("?orphaned=true"); len(items) != 1 {
+		t.Errorf("expected TW/config orphaned after deregistration, got %v", items)
+	}
+
+	req, _ = http.NewRequest("DELETE", env.URL+"/api/state/TW/config/meta", nil)
+	resp, _ = http.DefaultClient.Do(req)
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Errorf("delete meta: expected 200, got %d", resp.StatusCode)
+	}
+	resp, _ = http.Get(env.URL + "/api/state/TW/config")
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Errorf("key should survive metadata delete, got %d", resp.StatusCode)
+	}
+}
+
+func TestGCReport(t *testing.T) {
+	env := koortest.New(t)
+	ctx := context.Background()
+	env.SeedContract("Live", "api", `{"kind":"contract","version":1,"endpoints":{"GET /ping":{"response_status":200}}}`)
+	env.SeedRules("Live", specs.Rule{RuleID: "keep", Pattern: "x"})
+	env.SeedRules("Gone", specs.Rule{RuleID: "stale", Pattern: "x"})
+	env.SeedState("Live/config", `{}`)
+	env.State.PutMeta(ctx, state.Meta{Key: "Live/config", Owner: "deregistered-instance"})
+	env.Webhooks.Register(ctx, "wh-dead", "http://127.0.0.1:1/hook", []string{"*"}, "", "")
+	env.DB.Exec(`UPDATE webhooks SET fail_count = 5 WHERE id = 'wh-dead'`)
+	env.Templates.Create(ctx, "unused", "Unused", "", "rules", []byte(`[]`), nil, nil)
+
+	resp, _ := http.Get(env.URL + "/api/admin/gc-report")
+	var rep struct {
+		Categories map[string][]struct {
+			ID string `json:"id"`
+		} `json:"categories"`
+	}
+	json.NewDecoder(resp.Body).Decode(&rep)
+	resp.Body.Close()
+	want := map[string]string{"state": "Live/config", "rules": "Gone/stale", "webhooks": "wh-dead", "templates": "unused"}
+	for c, id := range want {
+		if items := rep.Categories[c]; len(items) != 1 || items[0].ID != id {
+			t.Errorf("%s: expected [%s], got %v", c, id, items)
+		}
+	}
+
+	resp, _ = http.Post(env.URL+"/api/admin/gc?dry_run=1", "application/json", strings.NewReader(`{"categories":["rules"]}`))
+	resp.Body.Close()
+	if _, err := env.Specs.GetRule(ctx, "Gone", "stale"); err != nil {
+		t.Fatal("dry run should not delete anything")
+	}
+
+	resp, _ = http.Post(env.URL+"/api/admin/gc", "application/json", strings.NewReader(`{"categories":["bogus"]}`))
+	resp.Body.Close()
+	if resp.StatusCode != 400 {
+		t.Errorf("unknown category: expected 400, got %d", resp.StatusCode)
+	}
+
+	resp, _ = http.Post(env.URL+"/api/admin/gc", "application/json", strings.NewReader(`{"categories":["rules","webhooks"]}`))
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("gc: expected 200, got %d", resp.StatusCode)
+	}
+	if _, err := env.Specs.GetRule(ctx, "Gone", "stale"); err == nil {
+		t.Error("orphaned rule should be deleted")
+	}
+	if _, err := env.Specs.GetRule(ctx, "Live", "keep"); err != nil {
+		t.Error("live project's rule should be kept")
+	}
+	if _, err := env.Webhooks.Get(ctx, "wh-dead"); err == nil {
+		t.Error("dead webhook should be deleted")
+	}
+	if _, err := env.State.Get(ctx, "Live/config"); err != nil {
+		t.Error("state was not a selected category and should be kept")
+	}
+}
+
+func TestAdminSnapshotRestore(t *testing.T) {
+	env := koortest.New(t)
+	ctx := context.Background()
+	env.SeedState("TW/config", `{"v":1}`)
+	env.SeedContract("TW", "api", `{"kind":"contract","version":1,"endpoints":{"GET /ping":{"response_status":200}}}`)
+
+	for _, format := range []string{"sqlite", "json"} {
+		resp, err := http.Post(env.URL+"/api/admin/snapshot?format="+format, "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		archive, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != 200 || !strings.Contains(resp.Header.Get("Content-Disposition"), "koor-snapshot-") {
+			t.Fatalf("%s snapshot: %d %s", format, resp.StatusCode, resp.Header)
+		}
+
+		env.SeedState("TW/config", `{"v":2}`)
+		env.SeedState("TW/scratch", `{}`)
+
+		resp, _ = http.Post(env.URL+"/api/admin/restore", "application/octet-stream", bytes.NewReader(archive))
+		var res struct {
+			Format string         `json:"format"`
+			Tables map[string]int `json:"tables"`
+		}
+		json.NewDecoder(resp.Body).Decode(&res)
+		resp.Body.Close()
+		if resp.StatusCode != 200 || res.Format != format || res.Tables["specs"] != 1 {
+			t.Fatalf("%s restore: %d %+v", format, resp.StatusCode, res)
+		}
+		entry, err := env.State.Get(ctx, "TW/config")
+		if err != nil || string(entry.Value) != `{"v":1}` {
+			t.Errorf("%s restore: expected the snapshot value, got %v %+v", format, err, entry)
+		}
+		if _, err := env.State.Get(ctx, "TW/scratch"); err == nil {
+			t.Errorf("%s restore: key written after the snapshot should be gone", format)
+		}
+	}
+
+	// The json snapshot already held the sqlite restore's entry.
+	entries, _ := env.Audit.Query(ctx, "", "admin.restore", "", "", 10)
+	if len(entries) != 2 {
+		t.Errorf("expected both restores in the restored audit log, got %+v", entries)
+	}
+
+	resp, _ := http.Post(env.URL+"/api/admin/snapshot?format=tar", "", nil)
+	resp.Body.Close()
+	if resp.StatusCode != 400 {
+		t.Errorf("unknown format: expected 400, got %d", resp.StatusCode)
+	}
+	resp, _ = http.Post(env.URL+"/api/admin/restore", "application/json", strings.NewReader(`not an archive`))
+	resp.Body.Close()
+	if resp.StatusCode != 400 {
+		t.Errorf("bad archive: expected 400, got %d", resp.StatusCode)
+	}
+}
+
+func TestErrorBudgets(t *testing.T) {
+	env := koortest.New(t)
+	backend := env.SeedInstance("tw-backend", "")
+	frontend := env.SeedInstance("tw-frontend", "")
+	env.SeedContract("TW", "api", `{"kind":"contract","version":1,"endpoints":{"POST /api/trucks":{"request":{"plate":{"type":"string","required":true}},"response_status":201}}}`)
+	rec := env.CaptureEvents("tw.budget.*")
+
+	putSettings := func(body string) *http.Response {
+		req, _ := http.NewRequest("PUT", env.URL+"/api/projects/TW/settings", strings.NewReader(body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	resp := putSettings(`{"error_budgets":[{"name":"contracts","role":"backend","metric":"contract_validations","max_failure_rate":0.2,"min_samples":3}]}`)
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("settings: expected 200, got %d", resp.StatusCode)
+	}
+	resp = putSettings(`{"error_budgets":[{"name":"x","metric":"bogus"}]}`)
+	resp.Body.Close()
+	if resp.StatusCode != 400 {
+		t.Errorf("unknown metric: expected 400, got %d", resp.StatusCode)
+	}
+
+	validate := func(inst string, valid bool) {
+		payload := `{"endpoint":"POST /api/trucks","payload":{}}`
+		if valid {
+			payload = `{"endpoint":"POST /api/trucks","payload":{"plate":"AB-1"}}`
+		}
+		req, _ := http.NewRequest("POST", env.URL+"/api/contracts/TW/api/validate", strings.NewReader(payload))
+		req.Header.Set("X-Koor-Instance", inst)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	// The frontend has no budget; the backend blows its budget on the
+	// third attempt, when it has enough samples.
+	validate(frontend.ID, false)
+	validate(frontend.ID, false)
+	validate(frontend.ID, false)
+	validate(backend.ID, false)
+	validate(backend.ID, false)
+	if len(rec.Topics()) != 0 {
+		t.Fatalf("no budget is blown below min_samples, got %v", rec.Topics())
+	}
+	validate(backend.ID, true)
+	ev, ok := rec.Wait("tw.budget.exceeded", time.Second)
+	if !ok {
+		t.Fatal("expected tw.budget.exceeded")
+	}
+	var alert struct {
+		Project  string `json:"project"`
+		Budget   string `json:"budget"`
+		Agent    string `json:"agent"`
+		Failed   int64  `json:"failed"`
+		Total    int64  `json:"total"`
+		Exceeded bool   `json:"exceeded"`
+	}
+	json.Unmarshal(ev.Data, &alert)
+	if alert.Project != "TW" || alert.Budget != "contracts" || alert.Agent != "tw-backend" || alert.Failed != 2 || alert.Total != 3 {
+		t.Errorf("unexpected alert: %+v", alert)
+	}
+
+	resp, _ = http.Get(env.URL + "/api/projects/TW/budgets")
+	var report struct {
+		Agents []struct {
+			Agent    string `json:"agent"`
+			Exceeded bool   `json:"exceeded"`
+		} `json:"agents"`
+		Exceeded int `json:"exceeded"`
+	}
+	json.NewDecoder(resp.Body).Decode(&report)
+	resp.Body.Close()
+	if report.Exceeded != 1 || len(report.Agents) != 1 || report.Agents[0].Agent != "tw-backend" {
+		t.Errorf("budget report: %+v", report)
+	}
+
+	// Enough successes bring the rate back under 20%; the alert fires once.
+	for i := 0; i < 7; i++ {
+		validate(backend.ID, true)
+	}
+	if _, ok := rec.Wait("tw.budget.recovered", time.Second); !ok {
+		t.Fatal("expected tw.budget.recovered")
+	}
+	if topics := rec.Topics(); len(topics) != 2 {
+		t.Errorf("expected one exceeded and one recovered event, got %v", topics)
+	}
+}
+
+func TestTaskQueue(t *testing.T) {
+	env := koortest.New(t)
+	backend := env.SeedInstance("tw-backend", "")
+	frontend := env.SeedInstance("tw-frontend", "")
+	rec := env.CaptureEvents("tw.task.*")
+
+	post := func(path, instanceID, body string) *http.Response {
+		req, _ := http.NewRequest("POST", env.URL+path, strings.NewReader(body))
+		if instanceID != "" {
+			req.Header.Set("X-Koor-Instance", instanceID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	resp := post("/api/tasks", "", `{"project":"TW","queue":"backend","title":"add trucks endpoint","payload":{"spec":"api"}}`)
+	var task tasks.Task
+	json.NewDecoder(resp.Body).Decode(&task)
+	resp.Body.Close()
+	if resp.StatusCode != 201 || task.Status != tasks.StatusPending || task.MaxAttempts != tasks.DefaultMaxAttempts {
+		t.Fatalf("create: expected 201 and a pending task, got %d %+v", resp.StatusCode, task)
+	}
+
+	// The frontend works its own queue; the backend task is not for it.
+	resp = post("/api/tasks/claim", frontend.ID, `{"project":"TW"}`)
+	resp.Body.Close()
+	if resp.StatusCode != 204 {
+		t.Fatalf("frontend claim: expected 204, got %d", resp.StatusCode)
+	}
+	resp = post("/api/tasks/claim", backend.ID, `{"project":"TW","visibility_timeout":"5m"}`)
+	var claimed tasks.Task
+	json.NewDecoder(resp.Body).Decode(&claimed)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || claimed.ID != task.ID || claimed.ClaimedBy != backend.ID {
+		t.Fatalf("backend claim: expected the task, got %d %+v", resp.StatusCode, claimed)
+	}
+
+	resp = post("/api/tasks/"+task.ID+"/complete", frontend.ID, `{}`)
+	resp.Body.Close()
+	if resp.StatusCode != 409 {
+		t.Errorf("completing another agent's claim: expected 409, got %d", resp.StatusCode)
+	}
+	resp = post("/api/tasks/"+task.ID+"/complete", backend.ID, `{"result":{"pr":42}}`)
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("complete: expected 200, got %d", resp.StatusCode)
+	}
+	if _, ok := rec.Wait("tw.task.completed", time.Second); !ok {
+		t.Errorf("expected tw.task.completed, got %v", rec.Topics())
+	}
+
+	resp, _ = http.Get(env.URL + "/api/tasks?project=TW&status=done")
+	var list []tasks.Task
+	json.NewDecoder(resp.Body).Decode(&list)
+	resp.Body.Close()
+	if len(list) != 1 || string(list[0].Result) != `{"pr":42}` {
+		t.Errorf("expected the completed task with its result, got %+v", list)
+	}
+	resp = post("/api/tasks/missing/requeue", "", ``)
+	resp.Body.Close()
+	if resp.StatusCode != 404 {
+		t.Errorf("requeue unknown task: expected 404, got %d", resp.StatusCode)
+	}
+}
+
+func TestTaskQueueInstanceToken(t *testing.T) {
+	env := koortest.New(t, koortest.WithAuthToken("secret"))
+	backend := env.SeedInstance("tw-backend", "")
+	env.Tasks.Create(context.Background(), tasks.Task{Project: "TW", Title: "shared work"})
+
+	do := func(path, body string) int {
+		req, _ := http.NewRequest("POST", env.URL+path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+backend.Token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := do("/api/tasks", `{"project":"TW","title":"more"}`); code != 403 {
+		t.Errorf("instance token creating a task: expected 403, got %d", code)
+	}
+	// The instance comes from the token, not the body.
+	if code := do("/api/tasks/claim", `{"project":"TW"}`); code != 200 {
+		t.Errorf("instance token claiming: expected 200, got %d", code)
+	}
+}
+
+func TestMessages(t *testing.T) {
+	env := koortest.New(t, koortest.WithAuthToken("secret"))
+	ctx := context.Background()
+	lead := env.SeedInstance("tw-lead", "")
+	backend := env.SeedInstance("tw-backend", "")
+	worker := env.SeedInstance("tw-worker", "")
+	env.Instances.SetCapabilities(ctx, backend.ID, []string{"go"})
+	env.Instances.SetCapabilities(ctx, worker.ID, []string{"go", "docker"})
+	rec := env.CaptureEvents("message.*")
+
+	do := func(method, path, token, body string) *http.Response {
+		req, _ := http.NewRequest(method, env.URL+path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	// A registration token may send; the sender comes from the token.
+	resp := do("POST", "/api/messages", lead.Token, `{"capability":"go","subject":"review PR 42","body":{"pr":42}}`)
+	var sent []messages.Message
+	json.NewDecoder(resp.Body).Decode(&sent)
+	resp.Body.Close()
+	if resp.StatusCode != 201 || len(sent) != 2 || sent[0].From != lead.ID {
+		t.Fatalf("send to capability: expected 2 messages from the lead, got %d %+v", resp.StatusCode, sent)
+	}
+	if _, ok := rec.Wait("message."+backend.ID, time.Second); !ok {
+		t.Errorf("expected message.%s, got %v", backend.ID, rec.Topics())
+	}
+	for body, want := range map[string]int{
+		`{"subject":"x"}`: 400,
+		`{"to":"` + backend.ID + `","capability":"go","subject":"x"}`: 400,
+		`{"to":"missing","subject":"x"}`:                              404,
+		`{"capability":"rust","subject":"x"}`:                         404,
+	} {
+		resp = do("POST", "/api/messages", "secret", body)
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("send %s: expected %d, got %d", body, want, resp.StatusCode)
+		}
+	}
+
+	resp = do("GET", "/api/messages/inbox/"+backend.ID+"?unread=1", backend.Token, "")
+	var inbox []messages.Message
+	json.NewDecoder(resp.Body).Decode(&inbox)
+	resp.Body.Close()
+	if len(inbox) != 1 || inbox[0].Subject != "review PR 42" || inbox[0].Capability != "go" {
+		t.Fatalf("unexpected inbox: %+v", inbox)
+	}
+
+	resp = do("POST", "/api/messages/"+inbox[0].ID+"/ack", worker.Token, "")
+	resp.Body.Close()
+	if resp.StatusCode != 409 {
+		t.Errorf("acking another agent's message: expected 409, got %d", resp.StatusCode)
+	}
+	resp = do("POST", "/api/messages/"+inbox[0].ID+"/ack", backend.Token, "")
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("ack: expected 200, got %d", resp.StatusCode)
+	}
+	resp = do("GET", "/api/messages/inbox/"+backend.ID+"?unread=1", backend.Token, "")
+	inbox = nil
+	json.NewDecoder(resp.Body).Decode(&inbox)
+	resp.Body.Close()
+	if len(inbox) != 0 {
+		t.Errorf("expected an empty unread inbox after ack, got %+v", inbox)
+	}
+}
+
+func TestContractImportOpenAPI(t *testing.T) {
+	env := koortest.New(t)
+	spec := `openapi: 3.0.3
+paths:
+  /api/trucks:
+    post:
+      requestBody:
+        content:
+          application/json:
+            schema:
+              type: object
+              required: [plate]
+              properties:
+                plate: {type: string}
+      responses:
+        "201": {description: created}
+`
+	resp, _ := http.Post(env.URL+"/api/contracts/TW/api/import?dry_run=1", "application/yaml", strings.NewReader(spec))
+	var preview struct {
+		DryRun   bool     `json:"dry_run"`
+		Created  []string `json:"created"`
+		Warnings []string `json:"warnings"`
+	}
+	json.NewDecoder(resp.Body).Decode(&preview)
+	resp.Body.Close()
+	if !preview.DryRun || len(preview.Created) != 1 || preview.Warnings == nil {
+		t.Fatalf("unexpected dry run: %+v", preview)
+	}
+	if _, err := env.Specs.Get(context.Background(), "TW", "api"); err == nil {
+		t.Fatal("dry run should not store the contract")
+	}
+
+	resp, _ = http.Post(env.URL+"/api/contracts/TW/api/import?format=openapi", "application/yaml", strings.NewReader(spec))
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("import: expected 200, got %d", resp.StatusCode)
+	}
+	resp, _ = http.Post(env.URL+"/api/contracts/TW/api/validate", "application/json",
+		strings.NewReader(`{"endpoint":"POST /api/trucks","direction":"request","payload":{}}`))
+	var result struct {
+		Valid bool `json:"valid"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	resp.Body.Close()
+	if result.Valid {
+		t.Error("the imported contract should require plate")
+	}
+
+	for _, path := range []string{"/api/contracts/TW/api/import?format=raml", "/api/contracts/TW/api/import"} {
+		resp, _ = http.Post(env.URL+path, "application/yaml", strings.NewReader(`swagger: "2.0"`))
+		resp.Body.Close()
+		if resp.StatusCode != 400 {
+			t.Errorf("%s: expected 400, got %d", path, resp.StatusCode)
+		}
+	}
+}
+
+func TestInstanceDeregisterCascade(t *testing.T) {
+	env := koortest.New(t)
+	ctx := context.Background()
+	rec := env.CaptureEvents("instance.orphans.*")
+
+	// Give each of two agents a state key, a claimed task and a message.
+	seed := func(name string) *instances.Instance {
+		inst := env.SeedInstance(name, "")
+		env.Instances.SetProject(ctx, inst.ID, "tw")
+		env.SeedState("tw/"+name, `{"n":1}`)
+		if _, err := env.State.PutMeta(ctx, state.Meta{Key: "tw/" + name, Owner: inst.ID, Description: "scratch"}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := env.Tasks.Create(ctx, tasks.Task{Project: "tw", Title: "work for " + name}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := env.Tasks.Claim(ctx, "tw", nil, inst.ID, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := env.Messages.Send(ctx, messages.Message{Subject: "hi"}, []string{inst.ID}); err != nil {
+			t.Fatal(err)
+		}
+		return inst
+	}
+	a := seed("tw-a")
+	b := seed("tw-b")
+
+	do := func(method, path string) (int, []byte) {
+		req, _ := http.NewRequest(method, env.URL+path, nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, body
+	}
+
+	// With cascade, the agent's data goes with it.
+	code, body := do("DELETE", "/api/instances/"+a.ID+"?cascade=1")
+	var deregistered struct {
+		Cascade orphans.Sweep `json:"cascade"`
+	}
+	json.Unmarshal(body, &deregistered)
+	if code != 200 || len(deregistered.Cascade.StateKeys) != 1 || deregistered.Cascade.Messages != 1 || len(deregistered.Cascade.TasksReleased) != 1 {
+		t.Fatalf("cascade deregister: %d %s", code, body)
+	}
+	if _, err := env.State.Get(ctx, "tw/tw-a"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected the owned key to be deleted, got %v", err)
+	}
+	if task, _ := env.Tasks.Get(ctx, deregistered.Cascade.TasksReleased[0]); task.Status != tasks.StatusPending || task.ClaimedBy != "" {
+		t.Errorf("expected the claim to be released, got %+v", task)
+	}
+
+	// Without it, the data lingers until the orphan cleaner quarantines it.
+	if code, _ := do("DELETE", "/api/instances/"+b.ID); code != 200 {
+		t.Fatalf("deregister: %d", code)
+	}
+	if _, err := env.State.Get(ctx, "tw/tw-b"); err != nil {
+		t.Fatalf("expected the key to linger: %v", err)
+	}
+	code, body = do("POST", "/api/admin/quarantine/sweep")
+	var sweeps []orphans.Sweep
+	json.Unmarshal(body, &sweeps)
+	if code != 200 || len(sweeps) != 1 || sweeps[0].InstanceID != b.ID || sweeps[0].Messages != 1 || len(sweeps[0].TasksReleased) != 1 {
+		t.Fatalf("sweep: %d %s", code, body)
+	}
+	if _, ok := rec.Wait("instance.orphans.quarantined", time.Second); !ok {
+		t.Errorf("expected instance.orphans.quarantined, got %v", rec.Topics())
+	}
+	if _, err := env.State.Get(ctx, "tw/tw-b"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected the key to be quarantined, got %v", err)
+	}
+	if code, body = do("POST", "/api/admin/quarantine/sweep"); string(body) != "[]\n" {
+		t.Errorf("expected a second sweep to find nothing: %d %s", code, body)
+	}
+
+	code, body = do("GET", "/api/admin/quarantine?instance="+b.ID)
+	var items []orphans.Item
+	json.Unmarshal(body, &items)
+	if code != 200 || len(items) != 2 {
+		t.Fatalf("quarantine list: %d %s", code, body)
+	}
+	byKind := map[string]orphans.Item{}
+	for _, it := range items {
+		byKind[it.Kind] = it
+	}
+	if code, _ := do("GET", "/api/admin/quarantine?kind=task"); code != 400 {
+		t.Errorf("unknown kind: expected 400, got %d", code)
+	}
+
+	// State can be restored, without its owner; messages can only be purged.
+	if code, body := do("POST", "/api/admin/quarantine/"+byKind["message"].ID+"/restore"); code != 400 {
+		t.Errorf("restore message: expected 400, got %d %s", code, body)
+	}
+	if code, body := do("POST", "/api/admin/quarantine/"+byKind["state"].ID+"/restore"); code != 200 {
+		t.Fatalf("restore state: %d %s", code, body)
+	}
+	if e, err := env.State.Get(ctx, "tw/tw-b"); err != nil || string(e.Value) != `{"n":1}` {
+		t.Errorf("expected the key back, got %+v %v", e, err)
+	}
+	if m, err := env.State.GetMeta(ctx, "tw/tw-b"); err != nil || m.Owner != "" || m.Description != "scratch" {
+		t.Errorf("expected the metadata back without an owner, got %+v %v", m, err)
+	}
+	if code, _ := do("POST", "/api/admin/quarantine/"+byKind["state"].ID+"/restore"); code != 404 {
+		t.Errorf("restore twice: expected 404, got %d", code)
+	}
+	if code, _ := do("DELETE", "/api/admin/quarantine/"+byKind["message"].ID); code != 200 {
+		t.Errorf("purge: expected 200, got %d", code)
+	}
+	if code, _ := do("DELETE", "/api/admin/quarantine/"+byKind["message"].ID); code != 404 {
+		t.Errorf("purge twice: expected 404, got %d", code)
+	}
+}
+
+func TestAuditStream(t *testing.T) {
+	env := koortest.New(t)
+	put := func(method, key string) {
+		t.Helper()
+		req, _ := http.NewRequest(method, env.URL+"/api/state/"+key, strings.NewReader(`{"n":1}`))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	put("PUT", "tw/a")
+
+	// Server-sent events: the stored entry is replayed, then new ones follow.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", env.URL+"/api/audit/stream?after_id=0&action=state.put", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("sse: %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	lines := bufio.NewScanner(resp.Body)
+	next := func() map[string]any {
+		t.Helper()
+		for lines.Scan() {
+			if data, ok := strings.CutPrefix(lines.Text(), "data: "); ok {
+				var e map[string]any
+				json.Unmarshal([]byte(data), &e)
+				return e
+			}
+		}
+		t.Fatalf("stream ended: %v", lines.Err())
+		return nil
+	}
+	if e := next(); e["resource"] != "tw/a" {
+		t.Errorf("expected the replayed entry for tw/a, got %v", e)
+	}
+	put("DELETE", "tw/a") // filtered out
+	put("PUT", "tw/b")
+	if e := next(); e["action"] != "state.put" || e["resource"] != "tw/b" {
+		t.Errorf("expected the live entry for tw/b, got %v", e)
+	}
+
+	// WebSocket.
+	conn, _, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(env.URL, "http")+"/api/audit/stream?action=state.delete", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(websocket.StatusNormalClosure, "")
+	time.Sleep(50 * time.Millisecond) // let the handler subscribe
+	put("DELETE", "tw/b")
+	_, data, err := conn.Read(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var e map[string]any
+	json.Unmarshal(data, &e)
+	if e["action"] != "state.delete" || e["resource"] != "tw/b" {
+		t.Errorf("websocket: expected state.delete of tw/b, got %s", data)
+	}
+
+	// The internal topic is not reachable through the event routes.
+	r2, _ := http.Get(env.URL + "/api/events/subscribe?pattern=_internal.audit")
+	r2.Body.Close()
+	if r2.StatusCode != 400 {
+		t.Errorf("subscribe to internal topic: expected 400, got %d", r2.StatusCode)
+	}
+	r2, _ = http.Post(env.URL+"/api/events/publish", "application/json", strings.NewReader(`{"topic":"_internal.audit","data":{}}`))
+	r2.Body.Close()
+	if r2.StatusCode != 400 {
+		t.Errorf("publish to internal topic: expected 400, got %d", r2.StatusCode)
+	}
+	if r2, _ = http.Get(env.URL + "/api/audit/stream?after_id=x"); r2.StatusCode != 400 {
+		t.Errorf("bad after_id: expected 400, got %d", r2.StatusCode)
+	}
+	r2.Body.Close()
+}
+
+func TestTokenTopicACL(t *testing.T) {
+	env := koortest.New(t)
+	ctx := context.Background()
+
+	do := func(method, path, token, body string) (int, []byte) {
+		t.Helper()
+		req, _ := http.NewRequest(method, env.URL+path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, data
+	}
+	code, data := do("POST", "/api/tokens", "", `{"name":"wall","scopes":["read"],"topics":{"allow":["tw.*"],"deny":["tw.secrets.*"]}}`)
+	var created struct {
+		Token string       `json:"token"`
+		Info  tokens.Token `json:"info"`
+	}
+	json.Unmarshal(data, &created)
+	if code != 200 || created.Info.Topics == nil {
+		t.Fatalf("create: %d %s", code, data)
+	}
+	wall := created.Token
+
+	conn, _, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(env.URL, "http")+"/api/events/subscribe?pattern=*",
+		&websocket.DialOptions{HTTPHeader: http.Header{"Authorization": {"Bearer " + wall}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(websocket.StatusNormalClosure, "")
+	time.Sleep(50 * time.Millisecond) // let the handler subscribe
+
+	var secretID int64
+	for _, topic := range []string{"billing.invoiced", "tw.secrets.rotated", "tw.api.changed"} {
+		ev, err := env.Events.Publish(ctx, topic, json.RawMessage(`{}`), "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if topic == "tw.secrets.rotated" {
+			secretID = ev.ID
+		}
+	}
+	readCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	_, msg, err := conn.Read(readCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(msg), `"tw.api.changed"`) {
+		t.Errorf("subscription: expected only tw.api.changed first, got %s", msg)
+	}
+
+	var history []events.Event
+	_, data = do("GET", "/api/events/history?last=10", wall, "")
+	json.Unmarshal(data, &history)
+	if len(history) != 1 || history[0].Topic != "tw.api.changed" {
+		t.Errorf("history: expected only tw.api.changed, got %s", data)
+	}
+	if code, _ := do("GET", "/api/events/"+strconv.FormatInt(secretID, 10)+"/verify", wall, ""); code != 404 {
+		t.Errorf("verify hidden event: expected 404, got %d", code)
+	}
+	_, data = do("GET", "/api/events/history?last=10", "", "")
+	json.Unmarshal(data, &history)
+	if len(history) != 3 {
+		t.Errorf("history without a token ACL: expected 3 events, got %d", len(history))
+	}
+
+	entries, _ := env.Audit.Query(ctx, "", "events.subscribe", "", "", 10)
+	if len(entries) != 1 || entries[0].Resource != "*" || entries[0].Actor != "wall" {
+		t.Errorf("expected the wildcard subscription to be audited, got %+v", entries)
+	}
+
+	if code, _ := do("PUT", "/api/tokens/"+created.Info.ID+"/topics", "", `{"deny":[""]}`); code != 400 {
+		t.Errorf("empty pattern: expected 400, got %d", code)
+	}
+	if code, data := do("PUT", "/api/tokens/"+created.Info.ID+"/topics", "", `{}`); code != 200 || strings.Contains(string(data), `"topics"`) {
+		t.Errorf("clear ACL: %d %s", code, data)
+	}
+	_, data = do("GET", "/api/events/history?last=10", wall, "")
+	json.Unmarshal(data, &history)
+	if len(history) != 3 {
+		t.Errorf("history after clearing the ACL: expected 3 events, got %d", len(history))
+	}
+	if code, _ := do("PUT", "/api/tokens/missing/topics", "", `{}`); code != 404 {
+		t.Errorf("unknown token: expected 404, got %d", code)
+	}
+}
+
+func TestStrictJSON(t *testing.T) {
+	post := func(url, path, body string) (int, map[string]any) {
+		t.Helper()
+		resp, err := http.Post(url+path, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var out map[string]any
+		json.NewDecoder(resp.Body).Decode(&out)
+		return resp.StatusCode, out
+	}
+	typo := `{"project":"p","rule_id":"r1","patern":"TODO"}`
+
+	// Without the flag, unknown fields are ignored as before.
+	lenient := koortest.New(t)
+	if code, out := post(lenient.URL, "/api/rules/propose", typo); code != 400 || out["error"] != "pattern is required" {
+		t.Errorf("lenient: expected 400 pattern is required, got %d %v", code, out)
+	}
+
+	env := koortest.New(t, koortest.WithStrictJSON())
+	fields := func(out map[string]any) map[string]string {
+		got := map[string]string{}
+		list, _ := out["fields"].([]any)
+		for _, f := range list {
+			m := f.(map[string]any)
+			got[m["field"].(string)] = m["problem"].(string)
+		}
+		return got
+	}
+	code, out := post(env.URL, "/api/rules/propose", typo)
+	if code != 422 || fields(out)["patern"] != "unknown field" {
+		t.Errorf("typo: expected 422 naming patern, got %d %v", code, out)
+	}
+
+	// Mistyped values and unknown keys inside nested arrays are listed too.
+	code, out = post(env.URL, "/api/tasks", `{"project":"p","priority":"high"}`)
+	if code != 422 || fields(out)["priority"] != "must be an integer" {
+		t.Errorf("mistyped: expected 422 naming priority, got %d %v", code, out)
+	}
+	code, out = post(env.URL, "/api/rules/import", `[{"project":"p","rule_id":"a","pattern":"x","severty":"error"}]`)
+	if code != 422 || fields(out)["[0].severty"] != "unknown field" {
+		t.Errorf("nested: expected 422 naming [0].severty, got %d %v", code, out)
+	}
+
+	// Endpoint checks list every missing field.
+	code, out = post(env.URL, "/api/webhooks", `{}`)
+	if f := fields(out); code != 422 || out["error"] != "id and url are required" || f["id"] != "is required" || f["url"] != "is required" {
+		t.Errorf("missing: expected 422 listing id and url, got %d %v", code, out)
+	}
+
+	// Malformed JSON is still a 400; case-insensitive keys and free-form
+	// data are accepted.
+	if code, _ := post(env.URL, "/api/events/publish", `{"topic":`); code != 400 {
+		t.Errorf("malformed: expected 400, got %d", code)
+	}
+	if code, out := post(env.URL, "/api/events/publish", `{"Topic":"a.b","data":{"anything":1}}`); code != 200 {
+		t.Errorf("valid: expected 200, got %d %v", code, out)
+	}
+}
+
+func TestContractMock(t *testing.T) {
+	env := koortest.New(t, koortest.WithAuthToken("root"))
+	env.SeedContract("TW", "api", `{"kind":"contract","version":1,"endpoints":{"GET /api/trucks/{id}":{"response":{"id":{"type":"string"}}}}}`)
+	env.SeedContract("TW", "api", `{"kind":"contract","version":2,"endpoints":{"GET /api/trucks/{id}":{"response":{"id":{"type":"string"},"size":{"type":"string","enum":["small","large"]}}},"POST /api/trucks":{"request":{"plate":{"type":"string","required":true}},"response_status":201}}}`)
+
+	call := func(token, method, path, body string) (int, string) {
+		t.Helper()
+		req, _ := http.NewRequest(method, env.URL+path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(data)
+	}
+
+	if code, body := call("root", "GET", "/api/mocks/TW/api/api/trucks/T1", ""); code != 404 || !strings.Contains(body, "mock/start") {
+		t.Errorf("before start: expected 404 naming mock/start, got %d %s", code, body)
+	}
+	code, body := call("root", "POST", "/api/contracts/TW/api/mock/start", "")
+	if code != 200 || !strings.Contains(body, `"version":2`) || !strings.Contains(body, `"url":"/api/mocks/TW/api"`) {
+		t.Fatalf("start: %d %s", code, body)
+	}
+	if code, body := call("root", "GET", "/api/mocks/TW/api/api/trucks/T1", ""); code != 200 || body != `{"id":"id-1","size":"small"}` {
+		t.Errorf("mock GET: %d %s", code, body)
+	}
+
+	// Mock traffic only needs read access, whatever its method.
+	code, body = call("root", "POST", "/api/tokens", `{"name":"frontend","scopes":["read"]}`)
+	var created struct {
+		Token string `json:"token"`
+	}
+	json.Unmarshal([]byte(body), &created)
+	if code != 200 || created.Token == "" {
+		t.Fatalf("create token: %d %s", code, body)
+	}
+	if code, _ := call(created.Token, "POST", "/api/mocks/TW/api/api/trucks", `{"plate":"AB-1"}`); code != 201 {
+		t.Errorf("mock POST with read token: expected 201, got %d", code)
+	}
+	if code, body := call(created.Token, "POST", "/api/mocks/TW/api/api/trucks", `{}`); code != 400 || !strings.Contains(body, "violations") {
+		t.Errorf("invalid mock POST: expected 400 with violations, got %d %s", code, body)
+	}
+	if code, _ := call(created.Token, "POST", "/api/contracts/TW/api/mock/stop", ""); code != 403 {
+		t.Errorf("stop with read token: expected 403, got %d", code)
+	}
+
+	// Restarting pins another version.
+	if code, body := call("root", "POST", "/api/contracts/TW/api/mock/start", `{"version":1}`); code != 200 || !strings.Contains(body, `"version":1`) {
+		t.Fatalf("restart at v1: %d %s", code, body)
+	}
+	if code, body := call("root", "GET", "/api/mocks", ""); code != 200 || !strings.Contains(body, `"version":1`) || !strings.Contains(body, `"calls":0`) {
+		t.Errorf("list: %d %s", code, body)
+	}
+	if code, _ := call("root", "POST", "/api/mocks/TW/api/api/trucks/T1", `{"plate":"AB-1"}`); code != 405 {
+		t.Errorf("v1 has no POST: expected 405, got %d", code)
+	}
+	if code, _ := call("root", "POST", "/api/contracts/TW/api/mock/stop", ""); code != 200 {
+		t.Errorf("stop: %d", code)
+	}
+	if code, _ := call("root", "POST", "/api/contracts/TW/api/mock/stop", ""); code != 404 {
+		t.Errorf("second stop: expected 404, got %d", code)
+	}
+	if code, _ := call("root", "POST", "/api/contracts/TW/nope/mock/start", ""); code != 404 {
+		t.Errorf("unknown contract: expected 404, got %d", code)
+	}
+}
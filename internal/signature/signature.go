@@ -0,0 +1,27 @@
+// Package signature computes the HMAC-SHA256 signatures Koor sends with
+// webhook deliveries. The dispatcher signs with it and pkg/client verifies
+// with it, so both sides agree on the signed message and header names.
+package signature
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// Headers carried by a signed delivery.
+const (
+	HeaderSignature = "X-Koor-Signature-256"
+	HeaderTimestamp = "X-Koor-Timestamp"
+	HeaderEventID   = "X-Koor-Event-Id"
+)
+
+// Sign returns the HeaderSignature value for a delivery: "sha256="
+// followed by the hex HMAC-SHA256 of "{timestamp}.{eventID}.{body}" under
+// secret.
+func Sign(secret, timestamp, eventID string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + eventID + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,21 @@
+package signature_test
+
+import (
+	"testing"
+
+	"github.com/DavidRHerbert/koor/internal/signature"
+)
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"topic":"x"}`)
+	want := "sha256=4963a0d8e10646472083966eec9cc77baad75806c2d20f6cc1593e5165426b5a"
+	if got := signature.Sign("s", "1700000000", "7", body); got != want {
+		t.Errorf("Sign = %s, want %s", got, want)
+	}
+	if signature.Sign("s", "1700000000", "8", body) == want {
+		t.Error("the event ID should be signed")
+	}
+	if signature.Sign("other", "1700000000", "7", body) == want {
+		t.Error("the secret should change the signature")
+	}
+}
@@ -0,0 +1,187 @@
+package specs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// AutoAcceptPolicy lets a project accept proposed rules without review
+// when they come from an instance with a track record. Rules of a
+// severity not listed in Severities are always queued for a human.
+type AutoAcceptPolicy struct {
+	Project string `json:"project"`
+	// Severities that may be auto-accepted, e.g. ["warning", "info"].
+	Severities []string `json:"severities"`
+	// MinAccepted is how many of the proposer's earlier rules in the
+	// project must have been accepted.
+	MinAccepted int    `json:"min_accepted"`
+	UpdatedAt   string `json:"updated_at,omitempty"`
+}
+
+// AutoAcceptDecision is the outcome of applying a project's policy to a
+// proposed rule.
+type AutoAcceptDecision struct {
+	Accepted bool   `json:"accepted"`
+	Reason   string `json:"reason"`
+	// PriorAccepted is the proposer's count of accepted rules in the
+	// project, before this one.
+	PriorAccepted int `json:"prior_accepted"`
+}
+
+// ruleSeverities are the severities a rule can have.
+var ruleSeverities = []string{"error", "warning", "info"}
+
+// GetAutoAccept returns a project's auto-accept policy, or sql.ErrNoRows
+// if it has none.
+func (r *Registry) GetAutoAccept(ctx context.Context, project string) (*AutoAcceptPolicy, error) {
+	var p AutoAcceptPolicy
+	var severities string
+	err := r.db.QueryRowContext(ctx,
+		`SELECT project, severities, min_accepted, updated_at FROM rule_auto_accept WHERE project = ?`,
+		project).Scan(&p.Project, &severities, &p.MinAccepted, &p.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	json.Unmarshal([]byte(severities), &p.Severities)
+	return &p, nil
+}
+
+// PutAutoAccept creates or replaces a project's auto-accept policy.
+func (r *Registry) PutAutoAccept(ctx context.Context, p AutoAcceptPolicy) error {
+	if p.Project == "" {
+		return fmt.Errorf("project is required")
+	}
+	if len(p.Severities) == 0 {
+		return fmt.Errorf("severities is required")
+	}
+	for _, sev := range p.Severities {
+		if !slices.Contains(ruleSeverities, sev) {
+			return fmt.Errorf("unknown severity %q (want %s)", sev, strings.Join(ruleSeverities, ", "))
+		}
+	}
+	if p.MinAccepted < 0 {
+		return fmt.Errorf("min_accepted must not be negative")
+	}
+	severities, _ := json.Marshal(p.Severities)
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO rule_auto_accept (project, severities, min_accepted, updated_at)
+		 VALUES (?, ?, ?, datetime('now'))
+		 ON CONFLICT(project) DO UPDATE SET
+		   severities = excluded.severities,
+		   min_accepted = excluded.min_accepted,
+		   updated_at = excluded.updated_at`,
+		p.Project, string(severities), p.MinAccepted)
+	if err != nil {
+		return fmt.Errorf("put auto-accept policy: %w", err)
+	}
+	return nil
+}
+
+// DeleteAutoAccept removes a project's auto-accept policy, so every
+// proposed rule is queued again.
+func (r *Registry) DeleteAutoAccept(ctx context.Context, project string) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM rule_auto_accept WHERE project = ?`, project)
+	if err != nil {
+		return fmt.Errorf("delete auto-accept policy: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// AutoAccept applies the project's auto-accept policy to a proposed rule
+// and accepts it if the policy allows. It returns nil when the project
+// has no policy, so the rule stays queued without a decision to record.
+func (r *Registry) AutoAccept(ctx context.Context, project, ruleID string) (*AutoAcceptDecision, error) {
+	policy, err := r.GetAutoAccept(ctx, project)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("auto-accept policy: %w", err)
+	}
+	rule, err := r.GetRule(ctx, project, ruleID)
+	if err != nil {
+		return nil, err
+	}
+	if rule.Status != "proposed" {
+		return nil, sql.ErrNoRows
+	}
+
+	d := &AutoAcceptDecision{}
+	if rule.ProposedBy != "" {
+		err = r.db.QueryRowContext(ctx,
+			`SELECT COUNT(*) FROM validation_rules
+			 WHERE project = ? AND proposed_by = ? AND status = 'accepted' AND rule_id != ?`,
+			project, rule.ProposedBy, ruleID).Scan(&d.PriorAccepted)
+		if err != nil {
+			return nil, fmt.Errorf("count accepted rules: %w", err)
+		}
+	}
+
+	switch {
+	case !slices.Contains(policy.Severities, rule.Severity):
+		d.Reason = fmt.Sprintf("%s rules are queued for review", rule.Severity)
+	case rule.ProposedBy == "":
+		d.Reason = "rule has no proposer"
+	case d.PriorAccepted < policy.MinAccepted:
+		d.Reason = fmt.Sprintf("%s has %d accepted rules, policy requires %d", rule.ProposedBy, d.PriorAccepted, policy.MinAccepted)
+	default:
+		if err := r.AcceptRule(ctx, project, ruleID); err != nil {
+			return nil, err
+		}
+		d.Accepted = true
+		d.Reason = fmt.Sprintf("%s has %d accepted rules", rule.ProposedBy, d.PriorAccepted)
+	}
+	return d, nil
+}
+
+// AcceptRules accepts several proposed rules in one transaction and
+// returns the IDs that were accepted. IDs that are not proposed rules of
+// the project are skipped. With no IDs, every proposed rule of the
+// project is accepted.
+func (r *Registry) AcceptRules(ctx context.Context, project string, ruleIDs []string) ([]string, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("accept rules: %w", err)
+	}
+	defer tx.Rollback()
+
+	if len(ruleIDs) == 0 {
+		rows, err := tx.QueryContext(ctx,
+			`SELECT rule_id FROM validation_rules WHERE project = ? AND status = 'proposed' ORDER BY rule_id`, project)
+		if err != nil {
+			return nil, fmt.Errorf("accept rules: %w", err)
+		}
+		for rows.Next() {
+			var id string
+			rows.Scan(&id)
+			ruleIDs = append(ruleIDs, id)
+		}
+		rows.Close()
+	}
+
+	accepted := []string{}
+	for _, id := range ruleIDs {
+		res, err := tx.ExecContext(ctx,
+			`UPDATE validation_rules SET status = 'accepted' WHERE project = ? AND rule_id = ? AND status = 'proposed'`,
+			project, id)
+		if err != nil {
+			return nil, fmt.Errorf("accept rule %s: %w", id, err)
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			accepted = append(accepted, id)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("accept rules: %w", err)
+	}
+	return accepted, nil
+}
@@ -0,0 +1,79 @@
+package specs_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DavidRHerbert/koor/internal/specs"
+)
+
+func TestAutoAccept(t *testing.T) {
+	reg := testRegistryWithRules(t)
+	ctx := context.Background()
+
+	propose := func(id, severity string) {
+		t.Helper()
+		if err := reg.ProposeRule(ctx, specs.Rule{Project: "proj", RuleID: id, Severity: severity, Pattern: id, ProposedBy: "inst-1"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Without a policy there is no decision.
+	propose("first", "warning")
+	if d, err := reg.AutoAccept(ctx, "proj", "first"); err != nil || d != nil {
+		t.Fatalf("expected no decision without a policy, got %+v, %v", d, err)
+	}
+
+	if err := reg.PutAutoAccept(ctx, specs.AutoAcceptPolicy{Project: "proj", Severities: []string{"warning"}, MinAccepted: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	// No track record yet: queued.
+	d, err := reg.AutoAccept(ctx, "proj", "first")
+	if err != nil || d.Accepted || d.PriorAccepted != 0 {
+		t.Fatalf("expected first rule to be queued, got %+v, %v", d, err)
+	}
+	reg.AcceptRule(ctx, "proj", "first")
+
+	// One accepted rule: warnings are accepted, errors are still queued.
+	propose("second", "warning")
+	d, _ = reg.AutoAccept(ctx, "proj", "second")
+	if !d.Accepted || d.PriorAccepted != 1 {
+		t.Errorf("expected second rule to be auto-accepted, got %+v", d)
+	}
+	if got, _ := reg.GetRule(ctx, "proj", "second"); got.Status != "accepted" {
+		t.Errorf("expected accepted status, got %s", got.Status)
+	}
+	propose("third", "error")
+	d, _ = reg.AutoAccept(ctx, "proj", "third")
+	if d.Accepted {
+		t.Errorf("expected error rule to be queued, got %+v", d)
+	}
+
+	if err := reg.PutAutoAccept(ctx, specs.AutoAcceptPolicy{Project: "proj", Severities: []string{"fatal"}}); err == nil {
+		t.Error("expected unknown severity to be rejected")
+	}
+}
+
+func TestAcceptRules(t *testing.T) {
+	reg := testRegistryWithRules(t)
+	ctx := context.Background()
+
+	for _, id := range []string{"a", "b", "c"} {
+		reg.ProposeRule(ctx, specs.Rule{Project: "proj", RuleID: id, Pattern: id})
+	}
+	reg.RejectRule(ctx, "proj", "c")
+
+	accepted, err := reg.AcceptRules(ctx, "proj", []string{"a", "c", "missing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accepted) != 1 || accepted[0] != "a" {
+		t.Errorf("expected only a to be accepted, got %v", accepted)
+	}
+
+	accepted, _ = reg.AcceptRules(ctx, "proj", nil)
+	if len(accepted) != 1 || accepted[0] != "b" {
+		t.Errorf("expected all remaining proposed rules (b) to be accepted, got %v", accepted)
+	}
+}
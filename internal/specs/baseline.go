@@ -0,0 +1,169 @@
+package specs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// BaselineEntry is a known violation that validation no longer reports.
+// Violations are matched by fingerprint: the rule, the file and the text of
+// the offending line, so a baseline survives lines moving around. Count
+// covers that many identical findings; more are reported as new.
+type BaselineEntry struct {
+	Fingerprint string    `json:"fingerprint"`
+	RuleID      string    `json:"rule_id"`
+	Filename    string    `json:"filename,omitempty"`
+	Match       string    `json:"match,omitempty"` // the offending line, trimmed
+	Count       int       `json:"count"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Fingerprint identifies a violation of content independently of its line
+// number.
+func Fingerprint(filename, content string, v Violation) string {
+	sum := sha256.Sum256([]byte(v.RuleID + "\x00" + filename + "\x00" + violationLine(content, v)))
+	return hex.EncodeToString(sum[:12])
+}
+
+// violationLine returns the trimmed text of the line a violation is on, or
+// "" for a violation of the whole file.
+func violationLine(content string, v Violation) string {
+	if v.Line < 1 {
+		return ""
+	}
+	lines := strings.Split(content, "\n")
+	if v.Line > len(lines) {
+		return ""
+	}
+	return strings.TrimSpace(lines[v.Line-1])
+}
+
+// BaselineFile is one file's content for CaptureBaseline.
+type BaselineFile struct {
+	Filename string `json:"filename"`
+	Content  string `json:"content"`
+}
+
+// CaptureBaseline validates files and replaces the project's baseline with
+// the violations found. Returns the new baseline.
+func (r *Registry) CaptureBaseline(ctx context.Context, project string, files []BaselineFile, req ValidateRequest) ([]BaselineEntry, error) {
+	entries := map[string]*BaselineEntry{}
+	var order []string
+	for _, f := range files {
+		req.Filename, req.Content = f.Filename, f.Content
+		violations, err := r.Validate(ctx, project, req)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range violations {
+			fp := Fingerprint(f.Filename, f.Content, v)
+			if e, ok := entries[fp]; ok {
+				e.Count++
+				continue
+			}
+			entries[fp] = &BaselineEntry{Fingerprint: fp, RuleID: v.RuleID, Filename: f.Filename, Match: violationLine(f.Content, v), Count: 1}
+			order = append(order, fp)
+		}
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `DELETE FROM validation_baselines WHERE project = ?`, project); err != nil {
+		return nil, fmt.Errorf("clear baseline: %w", err)
+	}
+	for _, fp := range order {
+		e := entries[fp]
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO validation_baselines (project, fingerprint, rule_id, filename, match, count) VALUES (?, ?, ?, ?, ?, ?)`,
+			project, e.Fingerprint, e.RuleID, e.Filename, e.Match, e.Count); err != nil {
+			return nil, fmt.Errorf("insert baseline entry: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return r.Baseline(ctx, project)
+}
+
+// Baseline returns a project's baseline, ordered by file and rule.
+func (r *Registry) Baseline(ctx context.Context, project string) ([]BaselineEntry, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT fingerprint, rule_id, filename, match, count, created_at
+		 FROM validation_baselines WHERE project = ? ORDER BY filename, rule_id, match`, project)
+	if err != nil {
+		return nil, fmt.Errorf("query baseline: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []BaselineEntry
+	for rows.Next() {
+		var e BaselineEntry
+		if err := rows.Scan(&e.Fingerprint, &e.RuleID, &e.Filename, &e.Match, &e.Count, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan baseline entry: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// DeleteBaseline removes a project's baseline. Returns the number of
+// entries removed.
+func (r *Registry) DeleteBaseline(ctx context.Context, project string) (int, error) {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM validation_baselines WHERE project = ?`, project)
+	if err != nil {
+		return 0, fmt.Errorf("delete baseline: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
+
+// FilterBaseline drops the violations of content that the project's
+// baseline covers. Returns the remaining, new violations and how many
+// were dropped.
+func (r *Registry) FilterBaseline(ctx context.Context, project, filename, content string, violations []Violation) ([]Violation, int, error) {
+	if len(violations) == 0 {
+		return violations, 0, nil
+	}
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT fingerprint, count FROM validation_baselines WHERE project = ? AND filename = ?`, project, filename)
+	if err != nil {
+		return nil, 0, fmt.Errorf("query baseline: %w", err)
+	}
+	known := map[string]int{}
+	for rows.Next() {
+		var fp string
+		var n int
+		if err := rows.Scan(&fp, &n); err != nil {
+			rows.Close()
+			return nil, 0, fmt.Errorf("scan baseline entry: %w", err)
+		}
+		known[fp] = n
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	if len(known) == 0 {
+		return violations, 0, nil
+	}
+
+	var kept []Violation
+	dropped := 0
+	for _, v := range violations {
+		fp := Fingerprint(filename, content, v)
+		if known[fp] > 0 {
+			known[fp]--
+			dropped++
+			continue
+		}
+		kept = append(kept, v)
+	}
+	return kept, dropped, nil
+}
@@ -0,0 +1,198 @@
+package specs
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DiffFile is one file's changes in a unified diff.
+type DiffFile struct {
+	Filename string     `json:"filename"`
+	Hunks    []DiffHunk `json:"hunks"`
+}
+
+// DiffHunk is one hunk of a DiffFile. Lines holds the hunk's new-side
+// lines: its context and added lines, in order.
+type DiffHunk struct {
+	Header   string     `json:"header"`
+	NewStart int        `json:"new_start"`
+	Lines    []DiffLine `json:"lines"`
+}
+
+// DiffLine is a new-side line of a hunk.
+type DiffLine struct {
+	Text     string `json:"text"`
+	Added    bool   `json:"added"`
+	Line     int    `json:"line"`      // line number in the new file
+	DiffLine int    `json:"diff_line"` // line number in the diff itself
+}
+
+// DiffViolation is a violation on a line a diff adds. Line is the line
+// number in the new file.
+type DiffViolation struct {
+	Violation
+	Filename   string `json:"filename"`
+	Hunk       int    `json:"hunk"` // 1-based index within the file
+	HunkHeader string `json:"hunk_header"`
+	DiffLine   int    `json:"diff_line"`
+}
+
+// ParseDiff parses a unified diff, as written by git diff or diff -u.
+// Deleted files are left out, since they add no lines.
+func ParseDiff(diff string) ([]DiffFile, error) {
+	var files []DiffFile
+	var file *DiffFile
+	var hunk *DiffHunk
+	newLine, oldLeft, newLeft := 0, 0, 0
+
+	lines := strings.Split(strings.ReplaceAll(diff, "\r\n", "\n"), "\n")
+	for i, text := range lines {
+		inHunk := hunk != nil && (oldLeft > 0 || newLeft > 0)
+		switch {
+		case inHunk && strings.HasPrefix(text, "+"):
+			hunk.Lines = append(hunk.Lines, DiffLine{Text: text[1:], Added: true, Line: newLine, DiffLine: i + 1})
+			newLine++
+			newLeft--
+		case inHunk && strings.HasPrefix(text, "-"):
+			oldLeft--
+		case inHunk && (strings.HasPrefix(text, " ") || text == ""):
+			hunk.Lines = append(hunk.Lines, DiffLine{Text: strings.TrimPrefix(text, " "), Line: newLine, DiffLine: i + 1})
+			newLine++
+			oldLeft--
+			newLeft--
+		case strings.HasPrefix(text, `\`):
+			// "\ No newline at end of file"
+		case strings.HasPrefix(text, "+++ "):
+			name := diffPath(strings.TrimPrefix(text, "+++ "))
+			files = append(files, DiffFile{Filename: name})
+			file, hunk = &files[len(files)-1], nil
+		case strings.HasPrefix(text, "@@"):
+			if file == nil {
+				return nil, fmt.Errorf("line %d: hunk before any +++ file header", i+1)
+			}
+			var err error
+			if oldLeft, newLine, newLeft, err = parseHunkHeader(text); err != nil {
+				return nil, fmt.Errorf("line %d: %w", i+1, err)
+			}
+			file.Hunks = append(file.Hunks, DiffHunk{Header: text, NewStart: newLine})
+			hunk = &file.Hunks[len(file.Hunks)-1]
+		default:
+			// git's "diff --git", "index" and "---" lines, or commentary
+			// around the diff.
+			hunk = nil
+		}
+	}
+
+	kept := files[:0]
+	for _, f := range files {
+		if f.Filename != "" {
+			kept = append(kept, f)
+		}
+	}
+	return kept, nil
+}
+
+// diffPath returns the file named by a +++ header, without git's b/
+// prefix or a trailing timestamp, and "" for /dev/null.
+func diffPath(header string) string {
+	name, _, _ := strings.Cut(header, "\t")
+	name = strings.TrimSpace(name)
+	if name == "/dev/null" {
+		return ""
+	}
+	if unquoted, err := strconv.Unquote(name); err == nil {
+		name = unquoted
+	}
+	if rest, ok := strings.CutPrefix(name, "b/"); ok {
+		name = rest
+	}
+	return name
+}
+
+// parseHunkHeader parses "@@ -oldStart,oldCount +newStart,newCount @@".
+func parseHunkHeader(header string) (oldCount, newStart, newCount int, err error) {
+	fields := strings.Fields(header)
+	if len(fields) < 4 || fields[0] != "@@" || fields[3] != "@@" ||
+		!strings.HasPrefix(fields[1], "-") || !strings.HasPrefix(fields[2], "+") {
+		return 0, 0, 0, fmt.Errorf("malformed hunk header %q", header)
+	}
+	rangeOf := func(s string) (start, count int, ok bool) {
+		startStr, countStr, found := strings.Cut(s, ",")
+		start, err := strconv.Atoi(startStr)
+		if err != nil {
+			return 0, 0, false
+		}
+		count = 1
+		if found {
+			if count, err = strconv.Atoi(countStr); err != nil {
+				return 0, 0, false
+			}
+		}
+		return start, count, true
+	}
+	_, oldCount, ok1 := rangeOf(fields[1][1:])
+	newStart, newCount, ok2 := rangeOf(fields[2][1:])
+	if !ok1 || !ok2 {
+		return 0, 0, 0, fmt.Errorf("malformed hunk header %q", header)
+	}
+	return oldCount, newStart, newCount, nil
+}
+
+// ValidateDiff runs a project's rules against the lines the diff adds.
+// Each file's hunks are validated as one fragment, so rules see context
+// lines (and inline suppressions in them), but only violations on added
+// lines are reported. Rules that need the whole file, missing and go-ast,
+// are not applied. Unless skipBaseline, violations in the project's
+// baseline are dropped; the number dropped is returned.
+func (r *Registry) ValidateDiff(ctx context.Context, project string, files []DiffFile, req ValidateRequest, skipBaseline bool) ([]DiffViolation, int, error) {
+	req.LinesOnly = true
+	var result []DiffViolation
+	baselined := 0
+	for _, f := range files {
+		var lines []string
+		type origin struct {
+			hunk int
+			line DiffLine
+		}
+		var origins []origin
+		for h, hunk := range f.Hunks {
+			for _, l := range hunk.Lines {
+				lines = append(lines, l.Text)
+				origins = append(origins, origin{h, l})
+			}
+		}
+		if len(lines) == 0 {
+			continue
+		}
+		req.Filename, req.Content = f.Filename, strings.Join(lines, "\n")
+		all, err := r.Validate(ctx, project, req)
+		if err != nil {
+			return nil, 0, err
+		}
+		var violations []Violation
+		for _, v := range all {
+			if v.Line >= 1 && v.Line <= len(origins) && origins[v.Line-1].line.Added {
+				violations = append(violations, v)
+			}
+		}
+		if !skipBaseline {
+			var n int
+			violations, n, err = r.FilterBaseline(ctx, project, req.Filename, req.Content, violations)
+			if err != nil {
+				return nil, 0, err
+			}
+			baselined += n
+		}
+		for _, v := range violations {
+			o := origins[v.Line-1]
+			v.Line = o.line.Line
+			result = append(result, DiffViolation{
+				Violation: v, Filename: f.Filename,
+				Hunk: o.hunk + 1, HunkHeader: f.Hunks[o.hunk].Header, DiffLine: o.line.DiffLine,
+			})
+		}
+	}
+	return result, baselined, nil
+}
@@ -0,0 +1,78 @@
+package specs_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DavidRHerbert/koor/internal/specs"
+)
+
+const testPatch = `diff --git a/web/app.js b/web/app.js
+index 83db48f..bf269f4 100644
+--- a/web/app.js
++++ b/web/app.js
+@@ -1,4 +1,5 @@
+ var a = eval('old');
+-var b = 2;
++var b = eval('new');
++var c = 3;
+ var d = 4;
+ var e = 5;
+@@ -20,2 +21,3 @@ function tail() {
+ // koor-ignore-next-line: no-eval
++eval('allowed');
++x.eval('also new');
+diff --git a/old.js b/old.js
+deleted file mode 100644
+--- a/old.js
++++ /dev/null
+@@ -1 +0,0 @@
+-eval('gone');
+`
+
+func TestParseDiff(t *testing.T) {
+	files, err := specs.ParseDiff(testPatch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Filename != "web/app.js" || len(files[0].Hunks) != 2 {
+		t.Fatalf("expected web/app.js with 2 hunks, got %+v", files)
+	}
+	h := files[0].Hunks[1]
+	if h.NewStart != 21 || len(h.Lines) != 3 {
+		t.Fatalf("second hunk: %+v", h)
+	}
+	if l := h.Lines[2]; !l.Added || l.Line != 23 || l.DiffLine != 15 || l.Text != "x.eval('also new');" {
+		t.Errorf("last added line: %+v", l)
+	}
+
+	if _, err := specs.ParseDiff("+++ b/x\n@@ -1 +1,x @@\n"); err == nil {
+		t.Error("expected a malformed hunk header to be rejected")
+	}
+}
+
+func TestValidateDiff(t *testing.T) {
+	reg := testRegistryWithRules(t)
+	ctx := context.Background()
+	reg.PutRules(ctx, "proj", []specs.Rule{
+		{RuleID: "no-eval", MatchType: "regex", Pattern: `eval\(`},
+		{RuleID: "need-strict", MatchType: "missing", Pattern: `use strict`},
+	})
+
+	files, _ := specs.ParseDiff(testPatch)
+	violations, _, err := reg.ValidateDiff(ctx, "proj", files, specs.ValidateRequest{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Context line 1 and the suppressed line 22 are not reported, nor is
+	// the missing rule, which needs the whole file.
+	if len(violations) != 2 {
+		t.Fatalf("expected 2 violations, got %+v", violations)
+	}
+	if v := violations[0]; v.Line != 2 || v.Hunk != 1 || v.DiffLine != 8 || v.Filename != "web/app.js" {
+		t.Errorf("first violation: %+v", v)
+	}
+	if v := violations[1]; v.Line != 23 || v.Hunk != 2 || v.HunkHeader != "@@ -20,2 +21,3 @@ function tail() {" {
+		t.Errorf("second violation: %+v", v)
+	}
+}
@@ -0,0 +1,87 @@
+package specs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// SourceFederated marks rules pulled from an upstream koor server.
+const SourceFederated = "federated"
+
+// SyncFederatedRules makes the federated rules match an upstream pack. The
+// rules are stored accepted with source "federated"; a local rule with the
+// same project and rule_id is kept and the upstream one skipped. Federated
+// rules no longer in the pack are removed. It returns how many rules were
+// applied and removed.
+func (r *Registry) SyncFederatedRules(ctx context.Context, rules []Rule) (applied, removed int, err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	keep := map[[2]string]bool{}
+	for _, rule := range rules {
+		if rule.Project == "" || rule.RuleID == "" || rule.Pattern == "" {
+			continue
+		}
+		if rule.Severity == "" {
+			rule.Severity = "error"
+		}
+		if rule.MatchType == "" {
+			rule.MatchType = "regex"
+		}
+		appliesTo, _ := json.Marshal(rule.AppliesTo)
+		if rule.AppliesTo == nil {
+			appliesTo = []byte(`["*"]`)
+		}
+
+		res, err := tx.ExecContext(ctx,
+			`INSERT INTO validation_rules (project, rule_id, severity, match_type, pattern, message, stack, applies_to, source, status, proposed_by, context)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, 'federated', 'accepted', ?, ?)
+			 ON CONFLICT (project, rule_id) DO UPDATE SET
+			   severity = excluded.severity, match_type = excluded.match_type,
+			   pattern = excluded.pattern, message = excluded.message,
+			   stack = excluded.stack, applies_to = excluded.applies_to,
+			   proposed_by = excluded.proposed_by, context = excluded.context
+			 WHERE validation_rules.source = 'federated'`,
+			rule.Project, rule.RuleID, rule.Severity, rule.MatchType, rule.Pattern,
+			rule.Message, rule.Stack, string(appliesTo), rule.ProposedBy, rule.Context)
+		if err != nil {
+			return 0, 0, fmt.Errorf("sync federated rule %s/%s: %w", rule.Project, rule.RuleID, err)
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			keep[[2]string{rule.Project, rule.RuleID}] = true
+			applied++
+		}
+	}
+
+	rows, err := tx.QueryContext(ctx,
+		`SELECT project, rule_id FROM validation_rules WHERE source = 'federated'`)
+	if err != nil {
+		return 0, 0, fmt.Errorf("list federated rules: %w", err)
+	}
+	var stale [][2]string
+	for rows.Next() {
+		var key [2]string
+		if err := rows.Scan(&key[0], &key[1]); err != nil {
+			rows.Close()
+			return 0, 0, fmt.Errorf("scan federated rule: %w", err)
+		}
+		if !keep[key] {
+			stale = append(stale, key)
+		}
+	}
+	rows.Close()
+	for _, key := range stale {
+		if _, err := tx.ExecContext(ctx,
+			`DELETE FROM validation_rules WHERE project = ? AND rule_id = ? AND source = 'federated'`,
+			key[0], key[1]); err != nil {
+			return 0, 0, fmt.Errorf("remove federated rule %s/%s: %w", key[0], key[1], err)
+		}
+		removed++
+	}
+
+	return applied, removed, tx.Commit()
+}
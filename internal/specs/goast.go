@@ -0,0 +1,150 @@
+package specs
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"strings"
+)
+
+// goASTQuery is a parsed go-ast pattern. Patterns are one of:
+//
+//	call to fmt.Println                   calls of a package-level function
+//	call to panic                         calls of a builtin or local function
+//	import of package os/exec             an import of the package
+//	exported function without comment    exported functions and methods with no doc comment
+//
+// Because they match the syntax tree, go-ast rules never fire inside
+// strings or comments, unlike regex rules.
+type goASTQuery struct {
+	kind string // "call", "import" or "undocumented"
+	pkg  string // import path of a call's package, "" for an unqualified call
+	name string // called function or imported package path
+}
+
+// parseGoASTPattern parses a go-ast pattern.
+func parseGoASTPattern(pattern string) (goASTQuery, error) {
+	p := strings.Join(strings.Fields(pattern), " ")
+	switch {
+	case strings.HasPrefix(p, "call to "):
+		target := strings.TrimPrefix(p, "call to ")
+		if strings.ContainsAny(target, " ()") {
+			return goASTQuery{}, fmt.Errorf("call to: expected a function such as fmt.Println, got %q", target)
+		}
+		q := goASTQuery{kind: "call", name: target}
+		if i := strings.LastIndex(target, "."); i >= 0 {
+			q.pkg, q.name = target[:i], target[i+1:]
+		}
+		if q.name == "" || q.pkg == "" && strings.Contains(target, ".") {
+			return goASTQuery{}, fmt.Errorf("call to: expected a function such as fmt.Println, got %q", target)
+		}
+		return q, nil
+	case strings.HasPrefix(p, "import of package "):
+		target := strings.Trim(strings.TrimPrefix(p, "import of package "), `"`)
+		if target == "" || strings.Contains(target, " ") {
+			return goASTQuery{}, fmt.Errorf("import of package: expected an import path, got %q", target)
+		}
+		return goASTQuery{kind: "import", name: target}, nil
+	case p == "exported function without comment":
+		return goASTQuery{kind: "undocumented"}, nil
+	}
+	return goASTQuery{}, fmt.Errorf(`unknown go-ast pattern %q (expected "call to <pkg>.<func>", "import of package <path>" or "exported function without comment")`, pattern)
+}
+
+// CheckGoASTPattern reports whether pattern is a valid go-ast pattern.
+func CheckGoASTPattern(pattern string) error {
+	_, err := parseGoASTPattern(pattern)
+	return err
+}
+
+// validateGoAST parses content as Go source and flags the nodes the rule's
+// pattern matches.
+func validateGoAST(rule Rule, content string) []Violation {
+	q, err := parseGoASTPattern(rule.Pattern)
+	if err != nil {
+		return []Violation{{
+			RuleID:   rule.RuleID,
+			Severity: "error",
+			Message:  fmt.Sprintf("invalid go-ast pattern: %v", err),
+		}}
+	}
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", content, parser.ParseComments|parser.SkipObjectResolution)
+	if file == nil {
+		return []Violation{{
+			RuleID:   rule.RuleID,
+			Severity: "error",
+			Message:  fmt.Sprintf("content is not Go source: %v", err),
+		}}
+	}
+
+	var violations []Violation
+	flag := func(pos token.Pos, match, fallback string) {
+		msg := rule.Message
+		if msg == "" {
+			msg = fallback
+		}
+		violations = append(violations, Violation{
+			RuleID:   rule.RuleID,
+			Severity: rule.Severity,
+			Message:  msg,
+			Line:     fset.Position(pos).Line,
+			Match:    match,
+		})
+	}
+
+	switch q.kind {
+	case "import":
+		for _, imp := range file.Imports {
+			if path, _ := strconv.Unquote(imp.Path.Value); path == q.name {
+				flag(imp.Pos(), imp.Path.Value, fmt.Sprintf("import of package %s", q.name))
+			}
+		}
+	case "undocumented":
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if ok && fn.Name.IsExported() && fn.Doc == nil {
+				flag(fn.Pos(), "func "+fn.Name.Name, fmt.Sprintf("exported function %s has no doc comment", fn.Name.Name))
+			}
+		}
+	case "call":
+		// The names the file gives the package, by its import's alias or
+		// the last element of its path.
+		local := map[string]bool{}
+		for _, imp := range file.Imports {
+			path, _ := strconv.Unquote(imp.Path.Value)
+			if path != q.pkg {
+				continue
+			}
+			if imp.Name != nil {
+				local[imp.Name.Name] = true
+			} else {
+				local[path[strings.LastIndex(path, "/")+1:]] = true
+			}
+		}
+		target := q.name
+		if q.pkg != "" {
+			target = q.pkg + "." + q.name
+		}
+		ast.Inspect(file, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			switch fun := call.Fun.(type) {
+			case *ast.Ident:
+				if q.pkg == "" && fun.Name == q.name {
+					flag(call.Pos(), fun.Name, fmt.Sprintf("call to %s", target))
+				}
+			case *ast.SelectorExpr:
+				if x, ok := fun.X.(*ast.Ident); ok && local[x.Name] && fun.Sel.Name == q.name {
+					flag(call.Pos(), x.Name+"."+fun.Sel.Name, fmt.Sprintf("call to %s", target))
+				}
+			}
+			return true
+		})
+	}
+	return violations
+}
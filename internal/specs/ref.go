@@ -0,0 +1,120 @@
+package specs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// RefField is the JSON field of a state value or task payload that names
+// the spec it was built against.
+const RefField = "spec_ref"
+
+// Ref points at a spec, optionally at a fixed version: "project/name" for
+// the latest version, or "project/name@v7" for version 7.
+type Ref struct {
+	Project string
+	Name    string
+	Version int64 // 0 means the latest version
+}
+
+// ParseRef parses "project/name" or "project/name@vN".
+func ParseRef(s string) (Ref, error) {
+	path, version, pinned := strings.Cut(s, "@")
+	project, name, ok := strings.Cut(path, "/")
+	if !ok || project == "" || name == "" || strings.Contains(name, "/") {
+		return Ref{}, fmt.Errorf("invalid spec ref %q: want project/name or project/name@vN", s)
+	}
+	ref := Ref{Project: project, Name: name}
+	if pinned {
+		n, err := strconv.ParseInt(strings.TrimPrefix(version, "v"), 10, 64)
+		if err != nil || n < 1 {
+			return Ref{}, fmt.Errorf("invalid spec ref %q: version must look like @v7", s)
+		}
+		ref.Version = n
+	}
+	return ref, nil
+}
+
+// String formats the ref as ParseRef accepts it.
+func (ref Ref) String() string {
+	if ref.Version == 0 {
+		return ref.Project + "/" + ref.Name
+	}
+	return fmt.Sprintf("%s/%s@v%d", ref.Project, ref.Name, ref.Version)
+}
+
+// Resolve returns the spec a ref points at. Returns sql.ErrNoRows if the
+// spec or the pinned version does not exist.
+func (r *Registry) Resolve(ctx context.Context, ref Ref) (*Spec, error) {
+	if ref.Version == 0 {
+		return r.Get(ctx, ref.Project, ref.Name)
+	}
+	return r.GetVersion(ctx, ref.Project, ref.Name, ref.Version)
+}
+
+// PayloadRef returns the spec ref in a JSON object's spec_ref field, and
+// false if the payload is not an object or has no such string field.
+func PayloadRef(payload []byte) (Ref, bool, error) {
+	var obj map[string]json.RawMessage
+	if json.Unmarshal(payload, &obj) != nil {
+		return Ref{}, false, nil
+	}
+	raw, ok := obj[RefField]
+	if !ok {
+		return Ref{}, false, nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return Ref{}, false, fmt.Errorf("%s must be a string", RefField)
+	}
+	ref, err := ParseRef(s)
+	return ref, true, err
+}
+
+// CheckPayloadRef returns an error if a JSON object's spec_ref is malformed
+// or names a spec or version that does not exist. Payloads without a
+// spec_ref pass.
+func (r *Registry) CheckPayloadRef(ctx context.Context, payload []byte) error {
+	_, _, err := r.resolvePayloadRef(ctx, payload)
+	return err
+}
+
+// PinPayloadRef rewrites an unversioned spec_ref in a JSON object to the
+// spec's current version, so the payload keeps pointing at the contract it
+// was written against even after the spec moves on. The payload is returned
+// unchanged if it has no spec_ref or the ref is already pinned. Errors are
+// those of CheckPayloadRef.
+func (r *Registry) PinPayloadRef(ctx context.Context, payload []byte) ([]byte, error) {
+	ref, spec, err := r.resolvePayloadRef(ctx, payload)
+	if spec == nil || err != nil || ref.Version != 0 {
+		return payload, err
+	}
+	ref.Version = spec.Version
+
+	var obj map[string]json.RawMessage
+	json.Unmarshal(payload, &obj)
+	obj[RefField], _ = json.Marshal(ref.String())
+	return json.Marshal(obj)
+}
+
+// resolvePayloadRef returns the payload's spec ref and the spec it points
+// at, or a nil spec if the payload has no ref.
+func (r *Registry) resolvePayloadRef(ctx context.Context, payload []byte) (Ref, *Spec, error) {
+	ref, ok, err := PayloadRef(payload)
+	if !ok || err != nil {
+		return ref, nil, err
+	}
+	spec, err := r.Resolve(ctx, ref)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ref, nil, fmt.Errorf("%s %s: spec not found", RefField, ref)
+	}
+	if err != nil {
+		return ref, nil, err
+	}
+	return ref, spec, nil
+}
@@ -0,0 +1,85 @@
+package specs_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/DavidRHerbert/koor/internal/specs"
+)
+
+func TestParseRef(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want specs.Ref
+		ok   bool
+	}{
+		{"TW/api", specs.Ref{Project: "TW", Name: "api"}, true},
+		{"TW/api@v7", specs.Ref{Project: "TW", Name: "api", Version: 7}, true},
+		{"TW/api@7", specs.Ref{Project: "TW", Name: "api", Version: 7}, true},
+		{"TW", specs.Ref{}, false},
+		{"TW/api/extra", specs.Ref{}, false},
+		{"TW/api@v0", specs.Ref{}, false},
+		{"TW/api@latest", specs.Ref{}, false},
+	} {
+		got, err := specs.ParseRef(tc.in)
+		if (err == nil) != tc.ok || got != tc.want {
+			t.Errorf("ParseRef(%q) = %+v, %v", tc.in, got, err)
+		}
+	}
+	if s := (specs.Ref{Project: "TW", Name: "api", Version: 3}).String(); s != "TW/api@v3" {
+		t.Errorf("String() = %q", s)
+	}
+}
+
+func TestSpecGetVersion(t *testing.T) {
+	r := testRegistry(t)
+	ctx := context.Background()
+	r.Put(ctx, "TW", "api", []byte(`{"v":1}`))
+	r.Put(ctx, "TW", "api", []byte(`{"v":2}`))
+
+	old, err := r.GetVersion(ctx, "TW", "api", 1)
+	if err != nil || string(old.Data) != `{"v":1}` || old.Version != 1 {
+		t.Fatalf("version 1: %v %+v", err, old)
+	}
+	cur, err := r.GetVersion(ctx, "TW", "api", 2)
+	if err != nil || string(cur.Data) != `{"v":2}` {
+		t.Fatalf("version 2: %v %+v", err, cur)
+	}
+	if _, err := r.GetVersion(ctx, "TW", "api", 3); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected ErrNoRows for a future version, got %v", err)
+	}
+
+	// Deleting a spec drops its history, so a re-created spec starts clean.
+	r.Delete(ctx, "TW", "api")
+	r.Put(ctx, "TW", "api", []byte(`{"v":"new"}`))
+	if _, err := r.GetVersion(ctx, "TW", "api", 2); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected history to be gone after delete, got %v", err)
+	}
+}
+
+func TestPinPayloadRef(t *testing.T) {
+	r := testRegistry(t)
+	ctx := context.Background()
+	r.Put(ctx, "TW", "api", []byte(`{}`))
+	r.Put(ctx, "TW", "api", []byte(`{"x":1}`))
+
+	got, err := r.PinPayloadRef(ctx, []byte(`{"spec_ref":"TW/api","step":1}`))
+	if err != nil || string(got) != `{"spec_ref":"TW/api@v2","step":1}` {
+		t.Errorf("pin latest: %s %v", got, err)
+	}
+	got, err = r.PinPayloadRef(ctx, []byte(`{"spec_ref":"TW/api@v1"}`))
+	if err != nil || string(got) != `{"spec_ref":"TW/api@v1"}` {
+		t.Errorf("already pinned: %s %v", got, err)
+	}
+	if got, err := r.PinPayloadRef(ctx, []byte(`[1,2]`)); err != nil || string(got) != `[1,2]` {
+		t.Errorf("non-object payload: %s %v", got, err)
+	}
+	if _, err := r.PinPayloadRef(ctx, []byte(`{"spec_ref":"TW/api@v9"}`)); err == nil {
+		t.Error("expected error for a missing version")
+	}
+	if err := r.CheckPayloadRef(ctx, []byte(`{"spec_ref":42}`)); err == nil {
+		t.Error("expected error for a non-string spec_ref")
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"database/sql"
 	"fmt"
 	"time"
+
+	"github.com/DavidRHerbert/koor/internal/encryption"
 )
 
 // Spec is a full specification entry including its data.
@@ -27,7 +29,8 @@ type Summary struct {
 
 // Registry provides CRUD operations on the specs table.
 type Registry struct {
-	db *sql.DB
+	db   *sql.DB
+	keys *encryption.Keyring
 }
 
 // New creates a new Registry.
@@ -35,6 +38,23 @@ func New(db *sql.DB) *Registry {
 	return &Registry{db: db}
 }
 
+// SetKeyring encrypts spec data written from now on with kr, and decrypts
+// spec data read with it.
+func (r *Registry) SetKeyring(kr *encryption.Keyring) {
+	r.keys = kr
+}
+
+// Reencrypt encrypts every current and archived spec with the keyring's
+// current key. It returns the number of specs rewritten.
+func (r *Registry) Reencrypt(ctx context.Context) (int, error) {
+	n, err := r.keys.Reencrypt(ctx, r.db, "specs", "data", "project", "name")
+	if err != nil {
+		return n, err
+	}
+	m, err := r.keys.Reencrypt(ctx, r.db, "spec_history", "data", "project", "name", "version")
+	return n + m, err
+}
+
 // List returns summaries of all specs for a project (no data blobs).
 func (r *Registry) List(ctx context.Context, project string) ([]Summary, error) {
 	rows, err := r.db.QueryContext(ctx,
@@ -68,15 +88,65 @@ func (r *Registry) Get(ctx context.Context, project, name string) (*Spec, error)
 	if err != nil {
 		return nil, err
 	}
+	if s.Data, err = r.keys.Decrypt(s.Data); err != nil {
+		return nil, fmt.Errorf("spec %s/%s: %w", project, name, err)
+	}
+	s.UpdatedAt, _ = time.Parse("2006-01-02 15:04:05", updatedAt)
+	return &s, nil
+}
+
+// GetVersion retrieves a specific version of a spec. If the version is the
+// current one, it returns the current spec; otherwise it looks in
+// spec_history. Returns sql.ErrNoRows if not found.
+func (r *Registry) GetVersion(ctx context.Context, project, name string, version int64) (*Spec, error) {
+	current, err := r.Get(ctx, project, name)
+	if err != nil {
+		return nil, err
+	}
+	if current.Version == version {
+		return current, nil
+	}
+
+	var s Spec
+	var updatedAt string
+	err = r.db.QueryRowContext(ctx,
+		`SELECT project, name, data, version, hash, updated_at
+		 FROM spec_history WHERE project = ? AND name = ? AND version = ?`, project, name, version).
+		Scan(&s.Project, &s.Name, &s.Data, &s.Version, &s.Hash, &updatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if s.Data, err = r.keys.Decrypt(s.Data); err != nil {
+		return nil, fmt.Errorf("spec %s/%s: %w", project, name, err)
+	}
 	s.UpdatedAt, _ = time.Parse("2006-01-02 15:04:05", updatedAt)
 	return &s, nil
 }
 
 // Put creates or updates a spec. Version auto-increments on update.
+// Before overwriting, the current version is archived to spec_history.
 func (r *Registry) Put(ctx context.Context, project, name string, data []byte) (*Spec, error) {
 	hash := fmt.Sprintf("%x", sha256.Sum256(data))
+	data, err := r.keys.Encrypt(data)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin spec put: %w", err)
+	}
+	defer tx.Rollback()
 
-	_, err := r.db.ExecContext(ctx,
+	_, err = tx.ExecContext(ctx,
+		`INSERT OR REPLACE INTO spec_history (project, name, version, data, hash, updated_at)
+		 SELECT project, name, version, data, hash, updated_at
+		 FROM specs WHERE project = ? AND name = ?`, project, name)
+	if err != nil {
+		return nil, fmt.Errorf("archive spec: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx,
 		`INSERT INTO specs (project, name, data, version, hash, updated_at)
 		 VALUES (?, ?, ?, 1, ?, datetime('now'))
 		 ON CONFLICT(project, name) DO UPDATE SET
@@ -88,11 +158,14 @@ func (r *Registry) Put(ctx context.Context, project, name string, data []byte) (
 	if err != nil {
 		return nil, fmt.Errorf("upsert spec: %w", err)
 	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit spec put: %w", err)
+	}
 
 	return r.Get(ctx, project, name)
 }
 
-// Delete removes a spec by project and name.
+// Delete removes a spec by project and name, with its history.
 func (r *Registry) Delete(ctx context.Context, project, name string) error {
 	res, err := r.db.ExecContext(ctx, `DELETE FROM specs WHERE project = ? AND name = ?`, project, name)
 	if err != nil {
@@ -102,5 +175,6 @@ func (r *Registry) Delete(ctx context.Context, project, name string) error {
 	if n == 0 {
 		return sql.ErrNoRows
 	}
+	r.db.ExecContext(ctx, `DELETE FROM spec_history WHERE project = ? AND name = ?`, project, name)
 	return nil
 }
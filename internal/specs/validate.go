@@ -124,10 +124,16 @@ type ValidateRequest struct {
 	Filename string `json:"filename"`
 	Content  string `json:"content"`
 	Stack    string `json:"stack"`
+	// SkipGlobal leaves out _global rules, for projects that opt out of them.
+	SkipGlobal bool `json:"-"`
+	// LinesOnly leaves out rules that judge the whole file (missing and
+	// go-ast), for content that is only part of a file.
+	LinesOnly bool `json:"-"`
 }
 
 // Validate runs all rules for a project against the given content.
-// It also includes _global rules (external rules that apply across all projects).
+// It also includes _global rules (external rules that apply across all projects)
+// unless req.SkipGlobal is set.
 func (r *Registry) Validate(ctx context.Context, project string, req ValidateRequest) ([]Violation, error) {
 	rules, err := r.ListRules(ctx, project)
 	if err != nil {
@@ -135,7 +141,7 @@ func (r *Registry) Validate(ctx context.Context, project string, req ValidateReq
 	}
 
 	// Include _global rules (external rules that apply to all projects).
-	if project != "_global" {
+	if project != "_global" && !req.SkipGlobal {
 		globalRules, err := r.ListRules(ctx, "_global")
 		if err == nil {
 			rules = append(rules, globalRules...)
@@ -159,6 +165,10 @@ func (r *Registry) Validate(ctx context.Context, project string, req ValidateReq
 			continue
 		}
 
+		if req.LinesOnly && (rule.MatchType == "missing" || rule.MatchType == "go-ast") {
+			continue
+		}
+
 		switch rule.MatchType {
 		case "regex":
 			violations = append(violations, validateRegex(rule, req.Content)...)
@@ -166,10 +176,67 @@ func (r *Registry) Validate(ctx context.Context, project string, req ValidateReq
 			violations = append(violations, validateMissing(rule, req.Content)...)
 		case "custom":
 			violations = append(violations, validateCustom(rule, req.Content)...)
+		case "go-ast":
+			// Only Go files parse; other files are never go-ast violations.
+			if req.Filename != "" && path.Ext(req.Filename) != ".go" {
+				continue
+			}
+			violations = append(violations, validateGoAST(rule, req.Content)...)
 		}
 	}
 
-	return violations, nil
+	return unsuppressed(req.Content, violations), nil
+}
+
+// suppressComment matches an inline suppression in any comment syntax:
+//
+//	koor-ignore: rule-a, rule-b         this line
+//	koor-ignore-next-line: rule-a       the next line
+//	koor-ignore-file: rule-a            the whole file
+//
+// Without rule IDs, every rule is suppressed.
+var suppressComment = regexp.MustCompile(`koor-ignore(-next-line|-file)?(?::[ \t]*([\w.\-]+(?:[ \t]*,[ \t]*[\w.\-]+)*))?`)
+
+// unsuppressed drops the violations that content suppresses inline.
+func unsuppressed(content string, violations []Violation) []Violation {
+	if len(violations) == 0 || !strings.Contains(content, "koor-ignore") {
+		return violations
+	}
+	byLine := map[int][]string{} // line -> rule IDs, "" for all
+	var file []string
+	for i, line := range strings.Split(content, "\n") {
+		for _, m := range suppressComment.FindAllStringSubmatch(line, -1) {
+			ids := []string{""}
+			if m[2] != "" {
+				ids = strings.FieldsFunc(m[2], func(r rune) bool { return r == ',' || r == ' ' || r == '\t' })
+			}
+			switch m[1] {
+			case "":
+				byLine[i+1] = append(byLine[i+1], ids...)
+			case "-next-line":
+				byLine[i+2] = append(byLine[i+2], ids...)
+			case "-file":
+				file = append(file, ids...)
+			}
+		}
+	}
+	covers := func(ids []string, ruleID string) bool {
+		for _, id := range ids {
+			if id == "" || id == ruleID {
+				return true
+			}
+		}
+		return false
+	}
+
+	var kept []Violation
+	for _, v := range violations {
+		if covers(file, v.RuleID) || v.Line > 0 && covers(byLine[v.Line], v.RuleID) {
+			continue
+		}
+		kept = append(kept, v)
+	}
+	return kept
 }
 
 // ProposeRule inserts a rule with source=learned, status=proposed.
@@ -2,6 +2,8 @@ package specs_test
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/DavidRHerbert/koor/internal/db"
@@ -121,6 +123,69 @@ func TestValidateMissing(t *testing.T) {
 	}
 }
 
+func TestValidateGoAST(t *testing.T) {
+	reg := testRegistryWithRules(t)
+	ctx := context.Background()
+
+	reg.PutRules(ctx, "proj", []specs.Rule{
+		{RuleID: "no-println", MatchType: "go-ast", Pattern: "call to fmt.Println"},
+		{RuleID: "no-exec", MatchType: "go-ast", Pattern: "import of package os/exec"},
+		{RuleID: "doc-exported", Severity: "warning", MatchType: "go-ast", Pattern: "exported function without comment"},
+	})
+
+	src := `package main
+
+import (
+	f "fmt"
+	"os/exec"
+)
+
+// Run is documented.
+func Run() {
+	// fmt.Println("in a comment")
+	s := "fmt.Println(1)"
+	f.Println(s)
+	exec.Command("ls")
+}
+
+func Helper() {}
+
+func helper() {}
+`
+	violations, err := reg.Validate(ctx, "proj", specs.ValidateRequest{Filename: "main.go", Content: src})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]specs.Violation{}
+	for _, v := range violations {
+		if _, dup := got[v.RuleID]; dup {
+			t.Errorf("%s matched more than once: %+v", v.RuleID, violations)
+		}
+		got[v.RuleID] = v
+	}
+	if v := got["no-println"]; v.Line != 12 || v.Match != "f.Println" {
+		t.Errorf("aliased call outside strings and comments: %+v", v)
+	}
+	if v := got["no-exec"]; v.Line != 5 || v.Match != `"os/exec"` {
+		t.Errorf("import: %+v", v)
+	}
+	if v := got["doc-exported"]; v.Line != 16 || v.Match != "func Helper" || v.Severity != "warning" {
+		t.Errorf("undocumented export: %+v", v)
+	}
+
+	// go-ast rules skip non-Go files.
+	violations, _ = reg.Validate(ctx, "proj", specs.ValidateRequest{Filename: "app.js", Content: "fmt.Println(1)"})
+	if len(violations) != 0 {
+		t.Errorf("expected no violations for a .js file, got %+v", violations)
+	}
+
+	reg.PutRules(ctx, "bad", []specs.Rule{{RuleID: "bad", MatchType: "go-ast", Pattern: "calls of fmt.Println"}})
+	violations, _ = reg.Validate(ctx, "bad", specs.ValidateRequest{Content: "package x"})
+	if len(violations) != 1 || !strings.Contains(violations[0].Message, "invalid go-ast pattern") {
+		t.Errorf("expected an invalid pattern violation, got %+v", violations)
+	}
+}
+
 func TestValidateAppliesTo(t *testing.T) {
 	reg := testRegistryWithRules(t)
 	ctx := context.Background()
@@ -527,3 +592,71 @@ func TestValidateNoRules(t *testing.T) {
 		t.Errorf("expected 0 violations with no rules, got %d", len(violations))
 	}
 }
+
+func TestInlineSuppression(t *testing.T) {
+	reg := testRegistryWithRules(t)
+	ctx := context.Background()
+	reg.PutRules(ctx, "proj", []specs.Rule{
+		{RuleID: "no-eval", Pattern: `\beval\(`},
+		{RuleID: "no-todo", Severity: "warning", Pattern: `TODO`},
+		{RuleID: "need-strict", MatchType: "missing", Pattern: `"use strict"`},
+	})
+
+	content := `eval(a) // koor-ignore: no-eval
+eval(b) // TODO koor-ignore: no-todo
+// koor-ignore-next-line: no-eval, no-todo
+eval(c) // TODO
+eval(d) /* koor-ignore */ // TODO
+eval(e)
+# koor-ignore-file: need-strict`
+	violations, err := reg.Validate(ctx, "proj", specs.ValidateRequest{Content: content})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, v := range violations {
+		got = append(got, fmt.Sprintf("%s:%d", v.RuleID, v.Line))
+	}
+	if want := "no-eval:2 no-eval:6"; strings.Join(got, " ") != want {
+		t.Errorf("expected %s, got %v", want, got)
+	}
+}
+
+func TestBaseline(t *testing.T) {
+	reg := testRegistryWithRules(t)
+	ctx := context.Background()
+	reg.PutRules(ctx, "proj", []specs.Rule{{RuleID: "no-eval", Pattern: `\beval\(`}})
+
+	legacy := "eval(a)\neval(a)\neval(b)\n"
+	entries, err := reg.CaptureBaseline(ctx, "proj", []specs.BaselineFile{{Filename: "old.js", Content: legacy}}, specs.ValidateRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Match != "eval(a)" || entries[0].Count != 2 {
+		t.Fatalf("unexpected baseline: %+v", entries)
+	}
+
+	// Moved lines stay baselined; a third eval(a) and a new eval(c) do not.
+	content := "// header\neval(b)\neval(a)\neval(a)\neval(a)\neval(c)\n"
+	violations, _ := reg.Validate(ctx, "proj", specs.ValidateRequest{Filename: "old.js", Content: content})
+	kept, dropped, err := reg.FilterBaseline(ctx, "proj", "old.js", content, violations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dropped != 3 || len(kept) != 2 || kept[0].Line != 5 || kept[1].Line != 6 {
+		t.Errorf("expected lines 5 and 6 to be new, got %+v (%d baselined)", kept, dropped)
+	}
+
+	// The baseline is per file.
+	kept, _, _ = reg.FilterBaseline(ctx, "proj", "new.js", "eval(a)", []specs.Violation{{RuleID: "no-eval", Line: 1}})
+	if len(kept) != 1 {
+		t.Errorf("expected the baseline not to cover another file, got %+v", kept)
+	}
+
+	if n, err := reg.DeleteBaseline(ctx, "proj"); err != nil || n != 2 {
+		t.Errorf("delete: %d, %v", n, err)
+	}
+	if entries, _ := reg.Baseline(ctx, "proj"); len(entries) != 0 {
+		t.Errorf("expected an empty baseline, got %+v", entries)
+	}
+}
@@ -0,0 +1,103 @@
+package state
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Meta annotates a state key with who owns it and what it holds.
+type Meta struct {
+	Key         string    `json:"key"`
+	Owner       string    `json:"owner,omitempty"` // owning instance ID
+	Description string    `json:"description,omitempty"`
+	Tags        []string  `json:"tags,omitempty"`
+	Schema      string    `json:"schema,omitempty"` // spec reference, e.g. "Truck-Wash/config-schema"
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// HasTag reports whether the metadata carries tag.
+func (m *Meta) HasTag(tag string) bool {
+	if m == nil {
+		return false
+	}
+	for _, t := range m.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// GetMeta returns a key's metadata. Returns sql.ErrNoRows if none is set.
+func (s *Store) GetMeta(ctx context.Context, key string) (*Meta, error) {
+	var m Meta
+	var tags string
+	err := s.db.QueryRowContext(ctx,
+		`SELECT key, owner, description, tags, schema, updated_at FROM state_meta WHERE key = ?`, key).
+		Scan(&m.Key, &m.Owner, &m.Description, &tags, &m.Schema, &m.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	json.Unmarshal([]byte(tags), &m.Tags)
+	return &m, nil
+}
+
+// PutMeta replaces a key's metadata. The key must exist; returns
+// sql.ErrNoRows otherwise.
+func (s *Store) PutMeta(ctx context.Context, m Meta) (*Meta, error) {
+	var exists int
+	if err := s.db.QueryRowContext(ctx, `SELECT 1 FROM state WHERE key = ?`, m.Key).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if m.Tags == nil {
+		m.Tags = []string{}
+	}
+	tags, _ := json.Marshal(m.Tags)
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO state_meta (key, owner, description, tags, schema, updated_at)
+		 VALUES (?, ?, ?, ?, ?, datetime('now'))
+		 ON CONFLICT(key) DO UPDATE SET
+			owner = excluded.owner,
+			description = excluded.description,
+			tags = excluded.tags,
+			schema = excluded.schema,
+			updated_at = excluded.updated_at`,
+		m.Key, m.Owner, m.Description, string(tags), m.Schema)
+	if err != nil {
+		return nil, fmt.Errorf("upsert state meta: %w", err)
+	}
+	return s.GetMeta(ctx, m.Key)
+}
+
+// DeleteMeta removes a key's metadata. Returns sql.ErrNoRows if none is set.
+func (s *Store) DeleteMeta(ctx context.Context, key string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM state_meta WHERE key = ?`, key)
+	if err != nil {
+		return fmt.Errorf("delete state meta: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// OwnedBy returns the keys whose metadata names owner, sorted.
+func (s *Store) OwnedBy(ctx context.Context, owner string) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT key FROM state_meta WHERE owner = ? ORDER BY key`, owner)
+	if err != nil {
+		return nil, fmt.Errorf("query owned keys: %w", err)
+	}
+	defer rows.Close()
+	var keys []string
+	for rows.Next() {
+		var k string
+		if err := rows.Scan(&k); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
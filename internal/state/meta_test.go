@@ -0,0 +1,43 @@
+package state_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/DavidRHerbert/koor/internal/state"
+)
+
+func TestMeta(t *testing.T) {
+	s := testStore(t)
+	ctx := context.Background()
+
+	if _, err := s.PutMeta(ctx, state.Meta{Key: "missing"}); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected ErrNoRows for metadata on a missing key, got %v", err)
+	}
+
+	s.Put(ctx, "TW/config", []byte(`{}`), "application/json", "")
+	s.Put(ctx, "TW/notes", []byte(`{}`), "application/json", "")
+	m, err := s.PutMeta(ctx, state.Meta{Key: "TW/config", Owner: "inst-1", Description: "build config", Tags: []string{"config"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Owner != "inst-1" || !m.HasTag("config") || m.UpdatedAt.IsZero() {
+		t.Errorf("unexpected metadata: %+v", m)
+	}
+
+	items, err := s.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 || items[0].Meta == nil || items[0].Meta.Description != "build config" || items[1].Meta != nil {
+		t.Errorf("expected metadata on TW/config only, got %+v", items)
+	}
+
+	// Deleting the key drops its metadata.
+	s.Delete(ctx, "TW/config", "")
+	if _, err := s.GetMeta(ctx, "TW/config"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected metadata removed with the key, got %v", err)
+	}
+}
@@ -0,0 +1,259 @@
+package state
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// RetentionPolicy limits the archived versions of the keys matching
+// Pattern: at most MaxVersions of them, and none written more than MaxAge
+// ago. The current value of a key is never removed. Pattern uses SQLite
+// GLOB syntax, where "*" also matches "/"; "*" alone is the global policy.
+type RetentionPolicy struct {
+	Pattern     string    `json:"pattern"`
+	MaxVersions int       `json:"max_versions,omitempty"` // 0 means no count limit
+	MaxAge      string    `json:"max_age,omitempty"`      // Go duration; empty means no age limit
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// CompactResult reports what a compaction removed.
+type CompactResult struct {
+	Keys      int   `json:"keys"`      // keys that lost archived versions
+	Reclaimed int64 `json:"reclaimed"` // state_history rows deleted
+}
+
+// ValidateRetention checks a set of retention policies.
+func ValidateRetention(policies []RetentionPolicy) error {
+	seen := map[string]bool{}
+	for _, p := range policies {
+		if p.Pattern == "" {
+			return fmt.Errorf("pattern is required")
+		}
+		if _, err := path.Match(p.Pattern, ""); err != nil || strings.Contains(p.Pattern, `\`) {
+			return fmt.Errorf("invalid pattern %q", p.Pattern)
+		}
+		if seen[p.Pattern] {
+			return fmt.Errorf("duplicate pattern %q", p.Pattern)
+		}
+		seen[p.Pattern] = true
+		if err := p.validateLimits(); err != nil {
+			return fmt.Errorf("%s: %w", p.Pattern, err)
+		}
+	}
+	return nil
+}
+
+func (p RetentionPolicy) validateLimits() error {
+	if p.MaxVersions < 0 {
+		return fmt.Errorf("max_versions must not be negative")
+	}
+	if p.MaxAge != "" {
+		d, err := time.ParseDuration(p.MaxAge)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("max_age must be a positive duration")
+		}
+	}
+	if p.MaxVersions == 0 && p.MaxAge == "" {
+		return fmt.Errorf("max_versions or max_age is required")
+	}
+	return nil
+}
+
+// RetentionPolicies returns the retention policies, most specific first:
+// that is the order in which a key is matched against them.
+func (s *Store) RetentionPolicies(ctx context.Context) ([]RetentionPolicy, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT pattern, max_versions, max_age, created_at, updated_at FROM state_retention`)
+	if err != nil {
+		return nil, fmt.Errorf("query state retention: %w", err)
+	}
+	defer rows.Close()
+
+	var out []RetentionPolicy
+	for rows.Next() {
+		var p RetentionPolicy
+		if err := rows.Scan(&p.Pattern, &p.MaxVersions, &p.MaxAge, &p.CreatedAt, &p.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("scan state retention: %w", err)
+		}
+		out = append(out, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i].Pattern, out[j].Pattern
+		if len(a) != len(b) {
+			return len(a) > len(b)
+		}
+		return a < b
+	})
+	return out, nil
+}
+
+// SetRetentionPolicies replaces the retention policies. Policies whose
+// pattern already existed keep their creation time.
+func (s *Store) SetRetentionPolicies(ctx context.Context, policies []RetentionPolicy) error {
+	if err := ValidateRetention(policies); err != nil {
+		return err
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	keep := make([]any, 0, len(policies))
+	for _, p := range policies {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO state_retention (pattern, max_versions, max_age, created_at, updated_at)
+			 VALUES (?, ?, ?, datetime('now'), datetime('now'))
+			 ON CONFLICT(pattern) DO UPDATE SET max_versions = excluded.max_versions,
+			   max_age = excluded.max_age, updated_at = excluded.updated_at`,
+			p.Pattern, p.MaxVersions, p.MaxAge); err != nil {
+			return fmt.Errorf("upsert state retention: %w", err)
+		}
+		keep = append(keep, p.Pattern)
+	}
+	query := `DELETE FROM state_retention`
+	if len(keep) > 0 {
+		query += ` WHERE pattern NOT IN (?` + strings.Repeat(", ?", len(keep)-1) + `)`
+	}
+	if _, err := tx.ExecContext(ctx, query, keep...); err != nil {
+		return fmt.Errorf("delete state retention: %w", err)
+	}
+	return tx.Commit()
+}
+
+// RetentionFor returns the policy that applies to key, or nil if none does.
+func (s *Store) RetentionFor(ctx context.Context, key string) (*RetentionPolicy, error) {
+	policies, err := s.RetentionPolicies(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range policies {
+		var match bool
+		if err := s.db.QueryRowContext(ctx, `SELECT ? GLOB ?`, key, p.Pattern).Scan(&match); err != nil {
+			return nil, fmt.Errorf("match state retention: %w", err)
+		}
+		if match {
+			return &p, nil
+		}
+	}
+	return nil, nil
+}
+
+// Compact deletes the archived versions of key that p does not keep and
+// returns how many were deleted.
+func (s *Store) Compact(ctx context.Context, key string, p RetentionPolicy) (int64, error) {
+	if err := p.validateLimits(); err != nil {
+		return 0, err
+	}
+	var reclaimed int64
+	if p.MaxAge != "" {
+		d, _ := time.ParseDuration(p.MaxAge)
+		res, err := s.db.ExecContext(ctx,
+			`DELETE FROM state_history WHERE key = ? AND updated_at < ?`,
+			key, time.Now().UTC().Add(-d).Format("2006-01-02 15:04:05"))
+		if err != nil {
+			return 0, fmt.Errorf("compact state history: %w", err)
+		}
+		n, _ := res.RowsAffected()
+		reclaimed += n
+	}
+	if p.MaxVersions > 0 {
+		res, err := s.db.ExecContext(ctx,
+			`DELETE FROM state_history WHERE key = ? AND version <= (
+				SELECT version FROM state_history WHERE key = ? ORDER BY version DESC LIMIT 1 OFFSET ?)`,
+			key, key, p.MaxVersions)
+		if err != nil {
+			return 0, fmt.Errorf("compact state history: %w", err)
+		}
+		n, _ := res.RowsAffected()
+		reclaimed += n
+	}
+	return reclaimed, nil
+}
+
+// CompactAll applies the retention policies to every key with archived
+// versions. Each key follows the most specific policy matching it; keys
+// that match none keep their whole history. Called periodically by
+// StartCompaction, but can also be invoked manually.
+func (s *Store) CompactAll(ctx context.Context) (CompactResult, error) {
+	var result CompactResult
+	policies, err := s.RetentionPolicies(ctx)
+	if err != nil {
+		return result, err
+	}
+	for i, p := range policies {
+		// The keys in this policy's class: matching it and none of the
+		// more specific ones before it.
+		where := `key GLOB ?`
+		args := []any{p.Pattern}
+		for _, prev := range policies[:i] {
+			where += ` AND NOT key GLOB ?`
+			args = append(args, prev.Pattern)
+		}
+		keys, err := s.historyKeys(ctx, where, args)
+		if err != nil {
+			return result, err
+		}
+		for _, key := range keys {
+			n, err := s.Compact(ctx, key, p)
+			if err != nil {
+				return result, err
+			}
+			if n > 0 {
+				result.Keys++
+				result.Reclaimed += n
+			}
+		}
+	}
+	return result, nil
+}
+
+func (s *Store) historyKeys(ctx context.Context, where string, args []any) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT DISTINCT key FROM state_history WHERE `+where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query state history keys: %w", err)
+	}
+	defer rows.Close()
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, fmt.Errorf("scan state history key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// StartCompaction launches a background goroutine that runs CompactAll
+// every interval. Call Stop to shut it down.
+func (s *Store) StartCompaction(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.CompactAll(context.Background())
+			case <-s.stopCompact:
+				return
+			}
+		}
+	}()
+}
+
+// Stop shuts down the background compaction goroutine.
+func (s *Store) Stop() {
+	select {
+	case s.stopCompact <- struct{}{}:
+	default:
+	}
+}
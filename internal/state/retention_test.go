@@ -0,0 +1,95 @@
+package state_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DavidRHerbert/koor/internal/db"
+	"github.com/DavidRHerbert/koor/internal/state"
+)
+
+func TestValidateStateRetention(t *testing.T) {
+	bad := [][]state.RetentionPolicy{
+		{{MaxVersions: 5}},
+		{{Pattern: "a/*"}},
+		{{Pattern: "a/*", MaxVersions: -1}},
+		{{Pattern: "a/*", MaxAge: "forever"}},
+		{{Pattern: "a/*", MaxVersions: 5}, {Pattern: "a/*", MaxAge: "1h"}},
+	}
+	for _, policies := range bad {
+		if err := state.ValidateRetention(policies); err == nil {
+			t.Errorf("expected %+v to be rejected", policies)
+		}
+	}
+	if err := state.ValidateRetention([]state.RetentionPolicy{{Pattern: "*", MaxAge: "720h"}, {Pattern: "Truck/*", MaxVersions: 10}}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCompact(t *testing.T) {
+	s := testStore(t)
+	ctx := context.Background()
+	for i := 0; i < 6; i++ {
+		s.Put(ctx, "Truck/heartbeat", []byte{byte('0' + i)}, "text/plain", "")
+	}
+
+	n, err := s.Compact(ctx, "Truck/heartbeat", state.RetentionPolicy{MaxVersions: 2})
+	if err != nil || n != 3 {
+		t.Fatalf("expected 3 rows reclaimed, got %d, %v", n, err)
+	}
+	history, _ := s.History(ctx, "Truck/heartbeat", 0)
+	if len(history) != 3 || history[0].Version != 6 || history[2].Version != 4 {
+		t.Errorf("expected the current value and versions 5 and 4, got %+v", history)
+	}
+	if n, _ := s.Compact(ctx, "Truck/heartbeat", state.RetentionPolicy{MaxVersions: 2}); n != 0 {
+		t.Errorf("a second compaction should reclaim nothing, got %d", n)
+	}
+	if _, err := s.Compact(ctx, "Truck/heartbeat", state.RetentionPolicy{}); err == nil {
+		t.Error("expected a policy without limits to be rejected")
+	}
+}
+
+func TestCompactAll(t *testing.T) {
+	database, err := db.OpenMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	s := state.New(database)
+	ctx := context.Background()
+
+	for _, key := range []string{"Truck/heartbeat", "Truck/config", "Other/notes"} {
+		for i := 0; i < 5; i++ {
+			s.Put(ctx, key, []byte{byte('0' + i)}, "text/plain", "")
+		}
+	}
+	// Truck/config's old versions were written long ago.
+	database.Exec(`UPDATE state_history SET updated_at = datetime('now', '-60 days') WHERE key = 'Truck/config'`)
+
+	err = s.SetRetentionPolicies(ctx, []state.RetentionPolicy{
+		{Pattern: "Truck/*", MaxAge: "720h"},
+		{Pattern: "Truck/heartbeat", MaxVersions: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p, _ := s.RetentionFor(ctx, "Truck/heartbeat"); p == nil || p.MaxVersions != 1 {
+		t.Errorf("expected the most specific policy, got %+v", p)
+	}
+	if p, _ := s.RetentionFor(ctx, "Other/notes"); p != nil {
+		t.Errorf("expected no policy for Other/notes, got %+v", p)
+	}
+
+	res, err := s.CompactAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Keys != 2 || res.Reclaimed != 7 {
+		t.Errorf("expected 7 rows reclaimed from 2 keys, got %+v", res)
+	}
+	for key, want := range map[string]int{"Truck/heartbeat": 2, "Truck/config": 1, "Other/notes": 5} {
+		if history, _ := s.History(ctx, key, 0); len(history) != want {
+			t.Errorf("%s: expected %d versions left, got %d", key, want, len(history))
+		}
+	}
+}
@@ -5,9 +5,12 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"sort"
 	"time"
+
+	"github.com/DavidRHerbert/koor/internal/encryption"
 )
 
 // Entry is a full state entry including its value.
@@ -27,35 +30,142 @@ type Summary struct {
 	Version     int64     `json:"version"`
 	ContentType string    `json:"content_type"`
 	UpdatedAt   time.Time `json:"updated_at"`
+	Meta        *Meta     `json:"meta,omitempty"`
 }
 
 // Store provides CRUD operations on the state table.
 type Store struct {
-	db *sql.DB
+	db          *sql.DB
+	keys        *encryption.Keyring
+	onChange    ChangeFunc
+	stopCompact chan struct{}
+}
+
+// Change describes a successful write to a state key.
+type Change struct {
+	Op         string // "put", "rollback" or "delete"
+	Key        string
+	OldVersion int64 // 0 when the key was created
+	NewVersion int64 // 0 when the key was deleted
+	Actor      string
 }
 
+// ChangeFunc is called after each write to a state key.
+type ChangeFunc func(ctx context.Context, c Change)
+
 // New creates a new Store.
 func New(db *sql.DB) *Store {
-	return &Store{db: db}
+	return &Store{db: db, stopCompact: make(chan struct{})}
+}
+
+// SetKeyring encrypts values written from now on with kr, and decrypts
+// values read with it. Hashes are of the plain values, so they do not
+// change when a value is encrypted or re-encrypted.
+func (s *Store) SetKeyring(kr *encryption.Keyring) {
+	s.keys = kr
+}
+
+// SetChangeHook registers fn to be called after every put, rollback and
+// delete, whoever makes it.
+func (s *Store) SetChangeHook(fn ChangeFunc) {
+	s.onChange = fn
 }
 
-// List returns summaries of all state keys (no values).
+func (s *Store) changed(ctx context.Context, c Change) {
+	if s.onChange != nil {
+		s.onChange(ctx, c)
+	}
+}
+
+// Reencrypt encrypts every current and archived value with the keyring's
+// current key, for enabling encryption on existing data or retiring an
+// old key. It returns the number of values rewritten.
+func (s *Store) Reencrypt(ctx context.Context) (int, error) {
+	n, err := s.keys.Reencrypt(ctx, s.db, "state", "value", "key")
+	if err != nil {
+		return n, err
+	}
+	m, err := s.keys.Reencrypt(ctx, s.db, "state_history", "value", "key", "version")
+	return n + m, err
+}
+
+const summaryQuery = `SELECT s.key, s.version, s.content_type, s.updated_at,
+		        m.owner, m.description, m.tags, m.schema, m.updated_at
+		 FROM state s LEFT JOIN state_meta m ON m.key = s.key`
+
+// List returns summaries of all state keys (no values), with their
+// metadata where set.
 func (s *Store) List(ctx context.Context) ([]Summary, error) {
-	rows, err := s.db.QueryContext(ctx,
-		`SELECT key, version, content_type, updated_at FROM state ORDER BY key`)
+	rows, err := s.db.QueryContext(ctx, summaryQuery+` ORDER BY s.key`)
 	if err != nil {
 		return nil, fmt.Errorf("query state list: %w", err)
 	}
-	defer rows.Close()
+	return scanSummaries(rows)
+}
+
+// PageQuery selects a page of state keys in key order.
+type PageQuery struct {
+	Prefix string // only keys starting with Prefix, e.g. "Truck-Wash/"
+	After  string // only keys after this one: the previous page's cursor
+	Owner  string // only keys whose metadata names this owner
+	Tag    string // only keys tagged with Tag
+	Limit  int
+}
+
+// Page returns up to q.Limit summaries matching q and whether more remain.
+// Keys are unique and ordered, so following the last returned key never
+// skips or repeats one.
+func (s *Store) Page(ctx context.Context, q PageQuery) ([]Summary, bool, error) {
+	if q.Limit <= 0 {
+		q.Limit = 100
+	}
+	query := summaryQuery + ` WHERE s.key > ?`
+	args := []any{q.After}
+	if q.Prefix != "" {
+		query += ` AND substr(s.key, 1, length(?)) = ?`
+		args = append(args, q.Prefix, q.Prefix)
+	}
+	if q.Owner != "" {
+		query += ` AND m.owner = ?`
+		args = append(args, q.Owner)
+	}
+	if q.Tag != "" {
+		query += ` AND m.tags LIKE ?`
+		args = append(args, `%"`+q.Tag+`"%`)
+	}
+	query += ` ORDER BY s.key LIMIT ?`
+	args = append(args, q.Limit+1)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, false, fmt.Errorf("query state page: %w", err)
+	}
+	items, err := scanSummaries(rows)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(items) > q.Limit {
+		return items[:q.Limit], true, nil
+	}
+	return items, false, nil
+}
 
+func scanSummaries(rows *sql.Rows) ([]Summary, error) {
+	defer rows.Close()
 	var items []Summary
 	for rows.Next() {
 		var item Summary
-		var updatedAt string
-		if err := rows.Scan(&item.Key, &item.Version, &item.ContentType, &updatedAt); err != nil {
+		var owner, description, tags, schema sql.NullString
+		var metaUpdated sql.NullTime
+		if err := rows.Scan(&item.Key, &item.Version, &item.ContentType, &item.UpdatedAt,
+			&owner, &description, &tags, &schema, &metaUpdated); err != nil {
 			return nil, fmt.Errorf("scan state row: %w", err)
 		}
-		item.UpdatedAt, _ = time.Parse("2006-01-02 15:04:05", updatedAt)
+		if metaUpdated.Valid {
+			item.Meta = &Meta{Key: item.Key, Owner: owner.String, Description: description.String,
+				Schema: schema.String, UpdatedAt: metaUpdated.Time}
+			json.Unmarshal([]byte(tags.String), &item.Meta.Tags)
+		}
 		items = append(items, item)
 	}
 	return items, rows.Err()
@@ -64,57 +174,129 @@ func (s *Store) List(ctx context.Context) ([]Summary, error) {
 // Get retrieves a state entry by key. Returns sql.ErrNoRows if not found.
 func (s *Store) Get(ctx context.Context, key string) (*Entry, error) {
 	var e Entry
-	var updatedAt string
 	err := s.db.QueryRowContext(ctx,
 		`SELECT key, value, version, hash, content_type, updated_at, updated_by
 		 FROM state WHERE key = ?`, key).
-		Scan(&e.Key, &e.Value, &e.Version, &e.Hash, &e.ContentType, &updatedAt, &e.UpdatedBy)
+		Scan(&e.Key, &e.Value, &e.Version, &e.Hash, &e.ContentType, &e.UpdatedAt, &e.UpdatedBy)
 	if err != nil {
 		return nil, err
 	}
-	e.UpdatedAt, _ = time.Parse("2006-01-02 15:04:05", updatedAt)
+	if e.Value, err = s.keys.Decrypt(e.Value); err != nil {
+		return nil, fmt.Errorf("state %s: %w", key, err)
+	}
 	return &e, nil
 }
 
 // Put creates or updates a state entry. Version auto-increments on update.
 // Before overwriting, the current value is archived to state_history.
 func (s *Store) Put(ctx context.Context, key string, value []byte, contentType, updatedBy string) (*Entry, error) {
+	return s.PutIf(ctx, key, value, contentType, updatedBy, Precondition{})
+}
+
+// ErrConflict is returned by PutIf when the key's current state does not
+// satisfy the precondition.
+var ErrConflict = errors.New("state precondition failed")
+
+// Precondition makes a write conditional on the key's current state, so
+// that concurrent writers cannot silently overwrite each other. The zero
+// value always matches.
+type Precondition struct {
+	// Hash the current value must have. "*" matches any existing value.
+	Hash string
+	// Version the key must currently be at. 0 means the key must not
+	// exist yet.
+	Version *int64
+}
+
+// PutIf is Put, but only writes if the precondition holds at the moment of
+// the write. Returns ErrConflict otherwise, leaving the entry and its
+// history untouched.
+func (s *Store) PutIf(ctx context.Context, key string, value []byte, contentType, updatedBy string, pre Precondition) (*Entry, error) {
+	entry, err := s.write(ctx, key, value, contentType, updatedBy, pre)
+	if err != nil {
+		return nil, err
+	}
+	s.changed(ctx, Change{Op: "put", Key: key, OldVersion: entry.Version - 1, NewVersion: entry.Version, Actor: updatedBy})
+	return entry, nil
+}
+
+// write stores a value under a precondition, archiving the one it replaces.
+func (s *Store) write(ctx context.Context, key string, value []byte, contentType, updatedBy string, pre Precondition) (*Entry, error) {
 	hash := fmt.Sprintf("%x", sha256.Sum256(value))
+	value, err := s.keys.Encrypt(value)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin state put: %w", err)
+	}
+	defer tx.Rollback()
 
 	// Archive current version before overwrite.
-	s.db.ExecContext(ctx,
+	tx.ExecContext(ctx,
 		`INSERT OR IGNORE INTO state_history (key, version, value, hash, content_type, updated_at, updated_by)
 		 SELECT key, version, value, hash, content_type, updated_at, updated_by
 		 FROM state WHERE key = ?`, key)
 
-	_, err := s.db.ExecContext(ctx,
-		`INSERT INTO state (key, value, version, hash, content_type, updated_at, updated_by)
-		 VALUES (?, ?, 1, ?, ?, datetime('now'), ?)
-		 ON CONFLICT(key) DO UPDATE SET
-			value = excluded.value,
-			version = state.version + 1,
-			hash = excluded.hash,
-			content_type = excluded.content_type,
-			updated_at = datetime('now'),
-			updated_by = excluded.updated_by`,
-		key, value, hash, contentType, updatedBy)
+	var res sql.Result
+	if pre.Hash != "" || pre.Version != nil && *pre.Version > 0 {
+		// The key must exist: a conditional update, checked in the same
+		// statement that writes.
+		version := int64(-1)
+		if pre.Version != nil {
+			version = *pre.Version
+		}
+		res, err = tx.ExecContext(ctx,
+			`UPDATE state SET
+				value = ?, version = version + 1, hash = ?, content_type = ?,
+				updated_at = datetime('now'), updated_by = ?
+			 WHERE key = ? AND (? IN ('', '*') OR hash = ?) AND (? < 0 OR version = ?)`,
+			value, hash, contentType, updatedBy, key, pre.Hash, pre.Hash, version, version)
+	} else {
+		// Version 0 means create only: an existing key turns the upsert
+		// into a no-op.
+		createOnly := pre.Version != nil
+		res, err = tx.ExecContext(ctx,
+			`INSERT INTO state (key, value, version, hash, content_type, updated_at, updated_by)
+			 VALUES (?, ?, 1, ?, ?, datetime('now'), ?)
+			 ON CONFLICT(key) DO UPDATE SET
+				value = excluded.value,
+				version = state.version + 1,
+				hash = excluded.hash,
+				content_type = excluded.content_type,
+				updated_at = datetime('now'),
+				updated_by = excluded.updated_by
+			 WHERE NOT ?`,
+			key, value, hash, contentType, updatedBy, createOnly)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("upsert state: %w", err)
 	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, ErrConflict
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit state put: %w", err)
+	}
 
 	return s.Get(ctx, key)
 }
 
-// Delete removes a state entry by key.
-func (s *Store) Delete(ctx context.Context, key string) error {
-	res, err := s.db.ExecContext(ctx, `DELETE FROM state WHERE key = ?`, key)
+// Delete removes a state entry by key, along with its metadata. deletedBy
+// is reported to the change hook.
+func (s *Store) Delete(ctx context.Context, key, deletedBy string) error {
+	var version int64
+	err := s.db.QueryRowContext(ctx, `DELETE FROM state WHERE key = ? RETURNING version`, key).Scan(&version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
 	if err != nil {
 		return fmt.Errorf("delete state: %w", err)
 	}
-	n, _ := res.RowsAffected()
-	if n == 0 {
-		return sql.ErrNoRows
-	}
+	s.db.ExecContext(ctx, `DELETE FROM state_meta WHERE key = ?`, key)
+	s.changed(ctx, Change{Op: "delete", Key: key, OldVersion: version, Actor: deletedBy})
 	return nil
 }
 
@@ -149,11 +331,9 @@ func (s *Store) History(ctx context.Context, key string, limit int) ([]HistoryEn
 	var entries []HistoryEntry
 	for rows.Next() {
 		var e HistoryEntry
-		var updatedAt string
-		if err := rows.Scan(&e.Key, &e.Version, &e.Hash, &e.ContentType, &updatedAt, &e.UpdatedBy); err != nil {
+		if err := rows.Scan(&e.Key, &e.Version, &e.Hash, &e.ContentType, &e.UpdatedAt, &e.UpdatedBy); err != nil {
 			return nil, fmt.Errorf("scan state history: %w", err)
 		}
-		e.UpdatedAt, _ = time.Parse("2006-01-02 15:04:05", updatedAt)
 		entries = append(entries, e)
 	}
 	return entries, rows.Err()
@@ -171,27 +351,34 @@ func (s *Store) GetVersion(ctx context.Context, key string, version int64) (*Ent
 
 	// Look in history.
 	var e Entry
-	var updatedAt string
 	err = s.db.QueryRowContext(ctx,
 		`SELECT key, value, version, hash, content_type, updated_at, updated_by
 		 FROM state_history WHERE key = ? AND version = ?`, key, version).
-		Scan(&e.Key, &e.Value, &e.Version, &e.Hash, &e.ContentType, &updatedAt, &e.UpdatedBy)
+		Scan(&e.Key, &e.Value, &e.Version, &e.Hash, &e.ContentType, &e.UpdatedAt, &e.UpdatedBy)
 	if err != nil {
 		return nil, err
 	}
-	e.UpdatedAt, _ = time.Parse("2006-01-02 15:04:05", updatedAt)
+	if e.Value, err = s.keys.Decrypt(e.Value); err != nil {
+		return nil, fmt.Errorf("state %s v%d: %w", key, version, err)
+	}
 	return &e, nil
 }
 
 // Rollback restores a key to a previous version. The current value is archived
 // first, then the historical version becomes the new current value.
-// Returns the new entry. Returns sql.ErrNoRows if version not found.
-func (s *Store) Rollback(ctx context.Context, key string, version int64) (*Entry, error) {
+// Returns the new entry. Returns sql.ErrNoRows if version not found. actor
+// is reported to the change hook.
+func (s *Store) Rollback(ctx context.Context, key string, version int64, actor string) (*Entry, error) {
 	old, err := s.GetVersion(ctx, key, version)
 	if err != nil {
 		return nil, err
 	}
-	return s.Put(ctx, key, old.Value, old.ContentType, "rollback:v"+fmt.Sprint(version))
+	entry, err := s.write(ctx, key, old.Value, old.ContentType, "rollback:v"+fmt.Sprint(version), Precondition{})
+	if err != nil {
+		return nil, err
+	}
+	s.changed(ctx, Change{Op: "rollback", Key: key, OldVersion: entry.Version - 1, NewVersion: entry.Version, Actor: actor})
+	return entry, nil
 }
 
 // DiffEntry represents a single field difference between two versions.
@@ -2,11 +2,15 @@ package state_test
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/DavidRHerbert/koor/internal/db"
+	"github.com/DavidRHerbert/koor/internal/encryption"
 	"github.com/DavidRHerbert/koor/internal/state"
 )
 
@@ -83,6 +87,48 @@ func TestList(t *testing.T) {
 	}
 }
 
+func TestPage(t *testing.T) {
+	s := testStore(t)
+	ctx := context.Background()
+
+	for i := range 5 {
+		s.Put(ctx, fmt.Sprintf("Truck-Wash/key-%d", i), []byte("x"), "text/plain", "")
+	}
+	s.Put(ctx, "Truck-Washer/other", []byte("x"), "text/plain", "")
+	s.Put(ctx, "alpha", []byte("a"), "text/plain", "")
+	s.PutMeta(ctx, state.Meta{Key: "Truck-Wash/key-3", Owner: "inst-1", Tags: []string{"config"}})
+
+	var keys []string
+	cursor := ""
+	for pages := 0; ; pages++ {
+		page, more, err := s.Page(ctx, state.PageQuery{Prefix: "Truck-Wash/", After: cursor, Limit: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, item := range page {
+			keys = append(keys, item.Key)
+		}
+		if !more {
+			if pages != 2 {
+				t.Errorf("expected 3 pages, got %d", pages+1)
+			}
+			break
+		}
+		cursor = page[len(page)-1].Key
+	}
+	want := "Truck-Wash/key-0 Truck-Wash/key-1 Truck-Wash/key-2 Truck-Wash/key-3 Truck-Wash/key-4"
+	if got := strings.Join(keys, " "); got != want {
+		t.Errorf("keys = %s, want %s", got, want)
+	}
+
+	for _, q := range []state.PageQuery{{Owner: "inst-1"}, {Tag: "config"}} {
+		page, more, _ := s.Page(ctx, q)
+		if len(page) != 1 || page[0].Key != "Truck-Wash/key-3" || page[0].Meta == nil || more {
+			t.Errorf("%+v: got %+v, more %v", q, page, more)
+		}
+	}
+}
+
 func TestGetNotFound(t *testing.T) {
 	s := testStore(t)
 	ctx := context.Background()
@@ -99,7 +145,7 @@ func TestDelete(t *testing.T) {
 
 	s.Put(ctx, "to-delete", []byte("data"), "text/plain", "")
 
-	if err := s.Delete(ctx, "to-delete"); err != nil {
+	if err := s.Delete(ctx, "to-delete", ""); err != nil {
 		t.Fatal(err)
 	}
 
@@ -113,12 +159,53 @@ func TestDeleteNotFound(t *testing.T) {
 	s := testStore(t)
 	ctx := context.Background()
 
-	err := s.Delete(ctx, "nonexistent")
+	err := s.Delete(ctx, "nonexistent", "")
 	if err != sql.ErrNoRows {
 		t.Errorf("expected sql.ErrNoRows, got %v", err)
 	}
 }
 
+func TestPutIf(t *testing.T) {
+	s := testStore(t)
+	ctx := context.Background()
+	version := func(v int64) *int64 { return &v }
+
+	if _, err := s.PutIf(ctx, "k", []byte(`1`), "application/json", "a", state.Precondition{Hash: "*"}); err != state.ErrConflict {
+		t.Fatalf("If-Match * on a missing key: expected ErrConflict, got %v", err)
+	}
+	first, err := s.PutIf(ctx, "k", []byte(`1`), "application/json", "a", state.Precondition{Version: version(0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.PutIf(ctx, "k", []byte(`2`), "application/json", "b", state.Precondition{Version: version(0)}); err != state.ErrConflict {
+		t.Fatalf("create-only on an existing key: expected ErrConflict, got %v", err)
+	}
+
+	second, err := s.PutIf(ctx, "k", []byte(`2`), "application/json", "a", state.Precondition{Hash: first.Hash, Version: version(1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.Version != 2 {
+		t.Errorf("expected version 2, got %d", second.Version)
+	}
+
+	// A writer that read version 1 loses.
+	if _, err := s.PutIf(ctx, "k", []byte(`3`), "application/json", "b", state.Precondition{Version: version(1)}); err != state.ErrConflict {
+		t.Fatalf("stale version: expected ErrConflict, got %v", err)
+	}
+	if _, err := s.PutIf(ctx, "k", []byte(`3`), "application/json", "b", state.Precondition{Hash: first.Hash}); err != state.ErrConflict {
+		t.Fatalf("stale hash: expected ErrConflict, got %v", err)
+	}
+	got, _ := s.Get(ctx, "k")
+	if string(got.Value) != `2` || got.Version != 2 {
+		t.Errorf("failed writes must not change the entry, got v%d %s", got.Version, got.Value)
+	}
+	history, _ := s.History(ctx, "k", 10)
+	if len(history) != 2 {
+		t.Errorf("failed writes must not archive versions, got %d history entries", len(history))
+	}
+}
+
 func TestHashChangesOnUpdate(t *testing.T) {
 	s := testStore(t)
 	ctx := context.Background()
@@ -232,7 +319,7 @@ func TestRollback(t *testing.T) {
 	s.Put(ctx, "k", []byte(`{"bad":"data"}`), "application/json", "rogue-agent")
 
 	// Rollback to version 1.
-	entry, err := s.Rollback(ctx, "k", 1)
+	entry, err := s.Rollback(ctx, "k", 1, "")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -253,12 +340,45 @@ func TestRollbackNotFound(t *testing.T) {
 
 	s.Put(ctx, "k", []byte(`{"v":1}`), "application/json", "")
 
-	_, err := s.Rollback(ctx, "k", 99)
+	_, err := s.Rollback(ctx, "k", 99, "")
 	if err == nil {
 		t.Error("expected error for nonexistent rollback version")
 	}
 }
 
+func TestChangeHook(t *testing.T) {
+	s := testStore(t)
+	ctx := context.Background()
+
+	var got []state.Change
+	s.SetChangeHook(func(_ context.Context, c state.Change) {
+		got = append(got, c)
+	})
+
+	s.Put(ctx, "k", []byte(`{"v":1}`), "application/json", "agent-a")
+	s.Put(ctx, "k", []byte(`{"v":2}`), "application/json", "agent-b")
+	s.Rollback(ctx, "k", 1, "agent-c")
+	s.Delete(ctx, "k", "agent-d")
+	s.Delete(ctx, "k", "agent-d") // already gone: no change
+	v := int64(7)
+	s.PutIf(ctx, "k", []byte(`{}`), "application/json", "agent-e", state.Precondition{Version: &v}) // conflict: no change
+
+	want := []state.Change{
+		{Op: "put", Key: "k", OldVersion: 0, NewVersion: 1, Actor: "agent-a"},
+		{Op: "put", Key: "k", OldVersion: 1, NewVersion: 2, Actor: "agent-b"},
+		{Op: "rollback", Key: "k", OldVersion: 2, NewVersion: 3, Actor: "agent-c"},
+		{Op: "delete", Key: "k", OldVersion: 3, NewVersion: 0, Actor: "agent-d"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d changes, got %d: %+v", len(want), len(got), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("change %d: expected %+v, got %+v", i, want[i], got[i])
+		}
+	}
+}
+
 func TestDiff(t *testing.T) {
 	s := testStore(t)
 	ctx := context.Background()
@@ -311,7 +431,7 @@ func TestRollbackPreservesHistory(t *testing.T) {
 
 	s.Put(ctx, "k", []byte(`{"v":1}`), "application/json", "")
 	s.Put(ctx, "k", []byte(`{"v":2}`), "application/json", "")
-	s.Rollback(ctx, "k", 1) // creates version 3
+	s.Rollback(ctx, "k", 1, "") // creates version 3
 
 	history, err := s.History(ctx, "k", 50)
 	if err != nil {
@@ -325,3 +445,55 @@ func TestRollbackPreservesHistory(t *testing.T) {
 		t.Errorf("expected latest version 3, got %d", history[0].Version)
 	}
 }
+
+func TestEncryptedValues(t *testing.T) {
+	database, err := db.OpenMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+	ctx := context.Background()
+	s := state.New(database)
+
+	// Written before encryption is enabled.
+	s.Put(ctx, "cfg", []byte(`{"token":"v1"}`), "application/json", "test")
+
+	key, _ := encryption.GenerateKey()
+	kr, _ := encryption.ParseKeys(key)
+	s.SetKeyring(kr)
+	plainHash := sha256Hex(`{"token":"v2"}`)
+	entry, err := s.Put(ctx, "cfg", []byte(`{"token":"v2"}`), "application/json", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(entry.Value) != `{"token":"v2"}` || entry.Hash != plainHash {
+		t.Errorf("unexpected entry: %s %s", entry.Value, entry.Hash)
+	}
+
+	var raw []byte
+	database.QueryRowContext(ctx, `SELECT value FROM state WHERE key = 'cfg'`).Scan(&raw)
+	if !encryption.IsEncrypted(raw) {
+		t.Errorf("stored value is not encrypted: %q", raw)
+	}
+	if old, err := s.GetVersion(ctx, "cfg", 1); err != nil || string(old.Value) != `{"token":"v1"}` {
+		t.Errorf("plain history: %v, %v", old, err)
+	}
+
+	// Re-encryption covers the plain history entry too.
+	if n, err := s.Reencrypt(ctx); err != nil || n != 1 {
+		t.Errorf("Reencrypt = %d, %v; want 1", n, err)
+	}
+	database.QueryRowContext(ctx, `SELECT value FROM state_history WHERE key = 'cfg'`).Scan(&raw)
+	if !kr.Current(raw) {
+		t.Errorf("history not re-encrypted: %q", raw)
+	}
+
+	s.SetKeyring(nil)
+	if _, err := s.Get(ctx, "cfg"); !errors.Is(err, encryption.ErrNoKey) {
+		t.Errorf("without a key: expected ErrNoKey, got %v", err)
+	}
+}
+
+func sha256Hex(s string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(s)))
+}
@@ -0,0 +1,395 @@
+// Package tasks is a per-project work queue with claim/ack semantics.
+//
+// A task is created pending in a queue. By convention a queue is named after
+// the agent role that works it ("backend" for the agent
+// "{project}-backend"); tasks in the empty queue can be claimed by any agent
+// of the project. Claiming hands out the pending task with the highest
+// priority (oldest first among equals) and hides it from other agents for a
+// visibility timeout. The claimer then completes or fails it. A claim that
+// is neither completed nor failed before its timeout expires makes the task
+// claimable again, so work held by a crashed agent is not lost. Failed
+// tasks are retried until they reach MaxAttempts.
+//
+// Every transition is published as a "{project}.task.<verb>" event (project
+// lowercased), so controllers and webhooks can follow the queue.
+package tasks
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/DavidRHerbert/koor/internal/events"
+	"github.com/google/uuid"
+)
+
+// Task statuses.
+const (
+	StatusPending = "pending"
+	StatusClaimed = "claimed"
+	StatusDone    = "done"
+	StatusFailed  = "failed"
+)
+
+// Defaults for tasks and claims that do not set them.
+const (
+	DefaultMaxAttempts = 3
+	DefaultVisibility  = 30 * time.Minute
+)
+
+// ErrNotClaimed is returned when completing or failing a task that is not
+// currently claimed by the caller.
+var ErrNotClaimed = errors.New("task is not claimed by this instance")
+
+// Task is one unit of work.
+type Task struct {
+	ID           string          `json:"id"`
+	Project      string          `json:"project"`
+	Queue        string          `json:"queue"`
+	Title        string          `json:"title"`
+	Payload      json.RawMessage `json:"payload,omitempty"`
+	Priority     int             `json:"priority"` // higher is claimed first
+	Status       string          `json:"status"`
+	ClaimedBy    string          `json:"claimed_by,omitempty"`
+	ClaimedUntil *time.Time      `json:"claimed_until,omitempty"`
+	Attempts     int             `json:"attempts"`
+	MaxAttempts  int             `json:"max_attempts"`
+	Result       json.RawMessage `json:"result,omitempty"`
+	Error        string          `json:"error,omitempty"`
+	CreatedBy    string          `json:"created_by,omitempty"`
+	CreatedAt    time.Time       `json:"created_at"`
+	UpdatedAt    time.Time       `json:"updated_at"`
+}
+
+// Filter selects tasks for List. Empty fields match everything.
+type Filter struct {
+	Project   string
+	Queue     string
+	Status    string
+	ClaimedBy string
+	Limit     int
+}
+
+// DefaultQueue returns the queue an agent works by the naming convention:
+// the role in "{project}-{role}", or "" if the name does not follow it.
+func DefaultQueue(project, instanceName string) string {
+	role, ok := strings.CutPrefix(strings.ToLower(instanceName), strings.ToLower(project)+"-")
+	if !ok {
+		return ""
+	}
+	return role
+}
+
+// Store persists tasks in SQLite and publishes their transitions.
+type Store struct {
+	db  *sql.DB
+	bus *events.Bus
+}
+
+// New creates a new task Store. bus may be nil, in which case no events
+// are published.
+func New(db *sql.DB, bus *events.Bus) *Store {
+	return &Store{db: db, bus: bus}
+}
+
+func sqlTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05")
+}
+
+// jsonText stores a raw JSON value, "null" when unset.
+func jsonText(v json.RawMessage) (string, error) {
+	if len(v) == 0 {
+		return "null", nil
+	}
+	if !json.Valid(v) {
+		return "", fmt.Errorf("invalid JSON")
+	}
+	return string(v), nil
+}
+
+// Create stores a new pending task.
+func (s *Store) Create(ctx context.Context, t Task) (*Task, error) {
+	if t.Project == "" {
+		return nil, fmt.Errorf("project is required")
+	}
+	if t.Title == "" {
+		return nil, fmt.Errorf("title is required")
+	}
+	if t.MaxAttempts <= 0 {
+		t.MaxAttempts = DefaultMaxAttempts
+	}
+	payload, err := jsonText(t.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("payload: %w", err)
+	}
+	t.ID = uuid.New().String()
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO tasks (id, project, queue, title, payload, priority, max_attempts, created_by)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		t.ID, t.Project, t.Queue, t.Title, payload, t.Priority, t.MaxAttempts, t.CreatedBy)
+	if err != nil {
+		return nil, fmt.Errorf("create task: %w", err)
+	}
+	return s.transitioned(ctx, t.ID, "created")
+}
+
+const taskColumns = `id, project, queue, title, payload, priority, status, claimed_by, claimed_until,
+	attempts, max_attempts, result, error, created_by, created_at, updated_at`
+
+func scanTask(row interface{ Scan(...any) error }) (*Task, error) {
+	var t Task
+	var payload, result string
+	var until sql.NullTime
+	if err := row.Scan(&t.ID, &t.Project, &t.Queue, &t.Title, &payload, &t.Priority, &t.Status,
+		&t.ClaimedBy, &until, &t.Attempts, &t.MaxAttempts, &result, &t.Error, &t.CreatedBy,
+		&t.CreatedAt, &t.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if payload != "null" {
+		t.Payload = json.RawMessage(payload)
+	}
+	if result != "null" {
+		t.Result = json.RawMessage(result)
+	}
+	if until.Valid {
+		t.ClaimedUntil = &until.Time
+	}
+	return &t, nil
+}
+
+// Get returns a task by ID. Returns sql.ErrNoRows if not found.
+func (s *Store) Get(ctx context.Context, id string) (*Task, error) {
+	return scanTask(s.db.QueryRowContext(ctx, `SELECT `+taskColumns+` FROM tasks WHERE id = ?`, id))
+}
+
+// List returns tasks matching f, in the order they would be claimed.
+func (s *Store) List(ctx context.Context, f Filter) ([]Task, error) {
+	query := `SELECT ` + taskColumns + ` FROM tasks WHERE 1=1`
+	var args []any
+	for _, c := range []struct{ col, val string }{
+		{"project", f.Project}, {"queue", f.Queue}, {"status", f.Status}, {"claimed_by", f.ClaimedBy},
+	} {
+		if c.val != "" {
+			query += ` AND ` + c.col + ` = ?`
+			args = append(args, c.val)
+		}
+	}
+	query += ` ORDER BY priority DESC, created_at, id`
+	if f.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, f.Limit)
+	}
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list tasks: %w", err)
+	}
+	defer rows.Close()
+
+	var out []Task
+	for rows.Next() {
+		t, err := scanTask(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan task: %w", err)
+		}
+		out = append(out, *t)
+	}
+	return out, rows.Err()
+}
+
+// claimable matches pending tasks and claims whose visibility timeout has
+// expired. It takes the current time as its one parameter.
+const claimable = `(status = 'pending' OR (status = 'claimed' AND claimed_until < ?))`
+
+// Claim gives instanceID the next task in one of queues of a project and
+// hides it from other agents for visibility. Returns sql.ErrNoRows if no
+// task is available.
+func (s *Store) Claim(ctx context.Context, project string, queues []string, instanceID string, visibility time.Duration) (*Task, error) {
+	if instanceID == "" {
+		return nil, fmt.Errorf("instance is required to claim a task")
+	}
+	if len(queues) == 0 {
+		queues = []string{""}
+	}
+	if visibility <= 0 {
+		visibility = DefaultVisibility
+	}
+	in := strings.TrimSuffix(strings.Repeat("?, ", len(queues)), ", ")
+
+	// Another agent may claim the same candidate first; then try the next.
+	for {
+		now := time.Now()
+		args := []any{project}
+		for _, q := range queues {
+			args = append(args, q)
+		}
+		args = append(args, sqlTime(now))
+		var id string
+		err := s.db.QueryRowContext(ctx,
+			`SELECT id FROM tasks WHERE project = ? AND queue IN (`+in+`) AND `+claimable+`
+			 ORDER BY priority DESC, created_at, id LIMIT 1`, args...).Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		res, err := s.db.ExecContext(ctx,
+			`UPDATE tasks SET status = 'claimed', claimed_by = ?, claimed_until = ?,
+				attempts = attempts + 1, updated_at = datetime('now')
+			 WHERE id = ? AND `+claimable,
+			instanceID, sqlTime(now.Add(visibility)), id, sqlTime(now))
+		if err != nil {
+			return nil, fmt.Errorf("claim task: %w", err)
+		}
+		if n, _ := res.RowsAffected(); n == 1 {
+			return s.transitioned(ctx, id, "claimed")
+		}
+	}
+}
+
+// Complete marks a task claimed by instanceID as done. An empty instanceID
+// (an operator rather than an agent) may complete any claimed task.
+func (s *Store) Complete(ctx context.Context, id, instanceID string, result json.RawMessage) (*Task, error) {
+	text, err := jsonText(result)
+	if err != nil {
+		return nil, fmt.Errorf("result: %w", err)
+	}
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE tasks SET status = 'done', result = ?, error = '', claimed_until = NULL, updated_at = datetime('now')
+		 WHERE id = ? AND status = 'claimed' AND (? = '' OR claimed_by = ?)`,
+		text, id, instanceID, instanceID)
+	if err != nil {
+		return nil, fmt.Errorf("complete task: %w", err)
+	}
+	if err := s.checkUpdated(ctx, res, id); err != nil {
+		return nil, err
+	}
+	return s.transitioned(ctx, id, "completed")
+}
+
+// Fail records that a claimed task failed. It goes back to pending for
+// another attempt, or is marked failed once it has used MaxAttempts.
+func (s *Store) Fail(ctx context.Context, id, instanceID, reason string) (*Task, error) {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE tasks SET
+			status = CASE WHEN attempts >= max_attempts THEN 'failed' ELSE 'pending' END,
+			claimed_by = CASE WHEN attempts >= max_attempts THEN claimed_by ELSE '' END,
+			claimed_until = NULL, error = ?, updated_at = datetime('now')
+		 WHERE id = ? AND status = 'claimed' AND (? = '' OR claimed_by = ?)`,
+		reason, id, instanceID, instanceID)
+	if err != nil {
+		return nil, fmt.Errorf("fail task: %w", err)
+	}
+	if err := s.checkUpdated(ctx, res, id); err != nil {
+		return nil, err
+	}
+	t, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	verb := "retrying"
+	if t.Status == StatusFailed {
+		verb = "failed"
+	}
+	return s.transitioned(ctx, id, verb)
+}
+
+// Requeue puts a task of any status back to pending with a fresh set of
+// attempts, optionally moving it to another queue or priority. Controllers
+// use it to reassign work.
+func (s *Store) Requeue(ctx context.Context, id string, queue *string, priority *int) (*Task, error) {
+	t, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if queue != nil {
+		t.Queue = *queue
+	}
+	if priority != nil {
+		t.Priority = *priority
+	}
+	_, err = s.db.ExecContext(ctx,
+		`UPDATE tasks SET status = 'pending', queue = ?, priority = ?, claimed_by = '', claimed_until = NULL,
+			attempts = 0, result = 'null', error = '', updated_at = datetime('now')
+		 WHERE id = ?`, t.Queue, t.Priority, id)
+	if err != nil {
+		return nil, fmt.Errorf("requeue task: %w", err)
+	}
+	return s.transitioned(ctx, id, "requeued")
+}
+
+// ReleaseClaims puts the tasks claimed by instanceID back to pending,
+// keeping their attempts, so other agents can pick them up without
+// waiting for the visibility timeout. Used when an instance goes away.
+func (s *Store) ReleaseClaims(ctx context.Context, instanceID string) ([]Task, error) {
+	claimed, err := s.List(ctx, Filter{Status: StatusClaimed, ClaimedBy: instanceID})
+	if err != nil {
+		return nil, err
+	}
+	var out []Task
+	for _, c := range claimed {
+		res, err := s.db.ExecContext(ctx,
+			`UPDATE tasks SET status = 'pending', claimed_by = '', claimed_until = NULL, updated_at = datetime('now')
+			 WHERE id = ? AND status = 'claimed' AND claimed_by = ?`, c.ID, instanceID)
+		if err != nil {
+			return nil, fmt.Errorf("release task: %w", err)
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			continue // completed or failed meanwhile
+		}
+		t, err := s.transitioned(ctx, c.ID, "released")
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *t)
+	}
+	return out, nil
+}
+
+// ClaimCounts returns, per instance, how many tasks it holds an unexpired
+// claim on.
+func (s *Store) ClaimCounts(ctx context.Context) (map[string]int, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT claimed_by, COUNT(*) FROM tasks WHERE status = 'claimed' AND claimed_until >= ? GROUP BY claimed_by`,
+		sqlTime(time.Now()))
+	if err != nil {
+		return nil, fmt.Errorf("count claims: %w", err)
+	}
+	defer rows.Close()
+	out := map[string]int{}
+	for rows.Next() {
+		var id string
+		var n int
+		if err := rows.Scan(&id, &n); err != nil {
+			return nil, fmt.Errorf("scan claim count: %w", err)
+		}
+		out[id] = n
+	}
+	return out, rows.Err()
+}
+
+// checkUpdated turns a conditional update that matched nothing into
+// sql.ErrNoRows (unknown task) or ErrNotClaimed.
+func (s *Store) checkUpdated(ctx context.Context, res sql.Result, id string) error {
+	if n, _ := res.RowsAffected(); n > 0 {
+		return nil
+	}
+	if _, err := s.Get(ctx, id); err != nil {
+		return err
+	}
+	return ErrNotClaimed
+}
+
+// transitioned reloads a task and publishes "{project}.task.<verb>".
+func (s *Store) transitioned(ctx context.Context, id, verb string) (*Task, error) {
+	t, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if s.bus != nil {
+		data, _ := json.Marshal(t)
+		s.bus.Publish(ctx, strings.ToLower(t.Project)+".task."+verb, data, "task-queue")
+	}
+	return t, nil
+}
@@ -0,0 +1,125 @@
+package tasks_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DavidRHerbert/koor/internal/db"
+	"github.com/DavidRHerbert/koor/internal/events"
+	"github.com/DavidRHerbert/koor/internal/tasks"
+)
+
+func testStore(t *testing.T) (*tasks.Store, *sql.DB) {
+	t.Helper()
+	database, err := db.OpenMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	return tasks.New(database, events.New(database, 100)), database
+}
+
+func TestClaimOrder(t *testing.T) {
+	s, _ := testStore(t)
+	ctx := context.Background()
+
+	s.Create(ctx, tasks.Task{Project: "TW", Queue: "backend", Title: "low"})
+	high, _ := s.Create(ctx, tasks.Task{Project: "TW", Queue: "backend", Title: "high", Priority: 5})
+	s.Create(ctx, tasks.Task{Project: "TW", Queue: "frontend", Title: "other queue", Priority: 9})
+	shared, _ := s.Create(ctx, tasks.Task{Project: "TW", Title: "anyone", Priority: 1})
+
+	got, err := s.Claim(ctx, "TW", []string{"backend", ""}, "agent-1", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != high.ID || got.Status != tasks.StatusClaimed || got.ClaimedBy != "agent-1" || got.Attempts != 1 {
+		t.Errorf("expected the high priority task claimed by agent-1, got %+v", got)
+	}
+	got, _ = s.Claim(ctx, "TW", []string{"backend", ""}, "agent-2", time.Minute)
+	if got.ID != shared.ID {
+		t.Errorf("expected the shared task next, got %s", got.Title)
+	}
+	got, _ = s.Claim(ctx, "TW", []string{"backend", ""}, "agent-2", time.Minute)
+	if got.Title != "low" {
+		t.Errorf("expected the low priority task last, got %s", got.Title)
+	}
+	if _, err := s.Claim(ctx, "TW", []string{"backend", ""}, "agent-2", time.Minute); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("empty queue: expected sql.ErrNoRows, got %v", err)
+	}
+}
+
+func TestVisibilityTimeout(t *testing.T) {
+	s, database := testStore(t)
+	ctx := context.Background()
+	task, _ := s.Create(ctx, tasks.Task{Project: "TW", Title: "build"})
+
+	s.Claim(ctx, "TW", nil, "agent-1", time.Minute)
+	if _, err := s.Claim(ctx, "TW", nil, "agent-2", time.Minute); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("a claimed task should be hidden, got %v", err)
+	}
+
+	// agent-1 goes quiet past its visibility timeout.
+	database.Exec(`UPDATE tasks SET claimed_until = datetime('now', '-1 minute') WHERE id = ?`, task.ID)
+	got, err := s.Claim(ctx, "TW", nil, "agent-2", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ClaimedBy != "agent-2" || got.Attempts != 2 {
+		t.Errorf("expected agent-2 on attempt 2, got %+v", got)
+	}
+	if _, err := s.Complete(ctx, task.ID, "agent-1", nil); !errors.Is(err, tasks.ErrNotClaimed) {
+		t.Errorf("the expired claimer may not complete: got %v", err)
+	}
+	done, err := s.Complete(ctx, task.ID, "agent-2", json.RawMessage(`{"pr":12}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if done.Status != tasks.StatusDone || string(done.Result) != `{"pr":12}` {
+		t.Errorf("unexpected completed task: %+v", done)
+	}
+}
+
+func TestFailRetriesThenFails(t *testing.T) {
+	s, _ := testStore(t)
+	ctx := context.Background()
+	task, _ := s.Create(ctx, tasks.Task{Project: "TW", Title: "flaky", MaxAttempts: 2})
+
+	s.Claim(ctx, "TW", nil, "agent-1", time.Minute)
+	got, err := s.Fail(ctx, task.ID, "agent-1", "tests failed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != tasks.StatusPending || got.Error != "tests failed" {
+		t.Errorf("first failure should retry, got %+v", got)
+	}
+	s.Claim(ctx, "TW", nil, "agent-1", time.Minute)
+	got, _ = s.Fail(ctx, task.ID, "agent-1", "tests failed again")
+	if got.Status != tasks.StatusFailed {
+		t.Errorf("failure on the last attempt should fail the task, got %s", got.Status)
+	}
+	if _, err := s.Fail(ctx, task.ID, "agent-1", "again"); !errors.Is(err, tasks.ErrNotClaimed) {
+		t.Errorf("failing an unclaimed task: expected ErrNotClaimed, got %v", err)
+	}
+
+	queue := "qa"
+	got, err = s.Requeue(ctx, task.ID, &queue, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != tasks.StatusPending || got.Queue != "qa" || got.Attempts != 0 {
+		t.Errorf("requeue should reset the task into the new queue, got %+v", got)
+	}
+}
+
+func TestDefaultQueue(t *testing.T) {
+	if q := tasks.DefaultQueue("Truck-Wash", "truck-wash-backend"); q != "backend" {
+		t.Errorf("expected backend, got %q", q)
+	}
+	if q := tasks.DefaultQueue("Truck-Wash", "reviewer"); q != "" {
+		t.Errorf("expected no queue, got %q", q)
+	}
+}
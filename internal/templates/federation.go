@@ -0,0 +1,113 @@
+package templates
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Local returns the full local templates, the ones a server shares with
+// servers federating from it.
+func (s *Store) Local(ctx context.Context) ([]Template, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id FROM templates WHERE source = 'local' ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("list local templates: %w", err)
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scan template: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	list := []Template{}
+	for _, id := range ids {
+		t, err := s.Get(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("get template %s: %w", id, err)
+		}
+		list = append(list, *t)
+	}
+	return list, nil
+}
+
+// SyncFederated makes the federated templates match an upstream pack. The
+// templates keep their upstream ID and version and are stored with source
+// "federated"; a local template with the same ID is kept and the upstream
+// one skipped. Federated templates no longer in the pack are removed. It
+// returns how many templates were applied and removed.
+func (s *Store) SyncFederated(ctx context.Context, list []Template) (applied, removed int, err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	keep := map[string]bool{}
+	for _, t := range list {
+		if t.ID == "" || t.Name == "" {
+			continue
+		}
+		if t.Kind == "" {
+			t.Kind = "rules"
+		}
+		if t.Version < 1 {
+			t.Version = 1
+		}
+		tagsJSON, _ := json.Marshal(t.Tags)
+		if t.Tags == nil {
+			tagsJSON = []byte("[]")
+		}
+		paramsJSON, _ := json.Marshal(t.Params)
+		if t.Params == nil {
+			paramsJSON = []byte("[]")
+		}
+		res, err := tx.ExecContext(ctx,
+			`INSERT INTO templates (id, name, description, kind, data, tags, params, version, source, created_at, updated_at)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, 'federated', datetime('now'), datetime('now'))
+			 ON CONFLICT (id) DO UPDATE SET
+			   name = excluded.name, description = excluded.description,
+			   kind = excluded.kind, data = excluded.data, tags = excluded.tags,
+			   params = excluded.params, version = excluded.version, updated_at = excluded.updated_at
+			 WHERE templates.source = 'federated'`,
+			t.ID, t.Name, t.Description, t.Kind, t.Data, string(tagsJSON), string(paramsJSON), t.Version)
+		if err != nil {
+			return 0, 0, fmt.Errorf("sync federated template %s: %w", t.ID, err)
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			keep[t.ID] = true
+			applied++
+		}
+	}
+
+	rows, err := tx.QueryContext(ctx, `SELECT id FROM templates WHERE source = 'federated'`)
+	if err != nil {
+		return 0, 0, fmt.Errorf("list federated templates: %w", err)
+	}
+	var stale []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, 0, fmt.Errorf("scan template: %w", err)
+		}
+		if !keep[id] {
+			stale = append(stale, id)
+		}
+	}
+	rows.Close()
+	for _, id := range stale {
+		if _, err := tx.ExecContext(ctx,
+			`DELETE FROM templates WHERE id = ? AND source = 'federated'`, id); err != nil {
+			return 0, 0, fmt.Errorf("remove federated template %s: %w", id, err)
+		}
+		removed++
+	}
+
+	return applied, removed, tx.Commit()
+}
@@ -0,0 +1,204 @@
+package templates
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// ErrInvalidVars is returned by Apply when the supplied variables do not
+// satisfy the template's declared parameters.
+var ErrInvalidVars = errors.New("invalid template variables")
+
+// Param declares a variable that template data may reference as {{name}}.
+type Param struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`              // "string" (default), "number", "bool"
+	Default     any    `json:"default,omitempty"` // nil means the variable is required
+	Description string `json:"description,omitempty"`
+}
+
+var (
+	paramName   = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	placeholder = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+)
+
+// ValidateParams checks parameter declarations and fills in the default type.
+func ValidateParams(params []Param) error {
+	seen := map[string]bool{}
+	for i := range params {
+		p := &params[i]
+		if !paramName.MatchString(p.Name) {
+			return fmt.Errorf("invalid parameter name %q", p.Name)
+		}
+		if seen[p.Name] {
+			return fmt.Errorf("duplicate parameter %q", p.Name)
+		}
+		seen[p.Name] = true
+		switch p.Type {
+		case "":
+			p.Type = "string"
+		case "string", "number", "bool":
+		default:
+			return fmt.Errorf("parameter %s: unknown type %q (want string, number or bool)", p.Name, p.Type)
+		}
+		if p.Default == nil {
+			continue
+		}
+		v, ok := scalarString(p.Default)
+		if !ok {
+			return fmt.Errorf("parameter %s: default must be a string, number or bool", p.Name)
+		}
+		if err := checkType(p, v); err != nil {
+			return fmt.Errorf("parameter %s: default %w", p.Name, err)
+		}
+	}
+	return nil
+}
+
+// StringVars converts JSON-decoded variable values to the strings Apply
+// expects. Only strings, numbers and booleans are accepted.
+func StringVars(in map[string]any) (map[string]string, error) {
+	out := make(map[string]string, len(in))
+	for k, v := range in {
+		s, ok := scalarString(v)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s must be a string, number or bool", ErrInvalidVars, k)
+		}
+		out[k] = s
+	}
+	return out, nil
+}
+
+func scalarString(v any) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case bool:
+		return strconv.FormatBool(v), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case int:
+		return strconv.Itoa(v), true
+	}
+	return "", false
+}
+
+func checkType(p *Param, v string) error {
+	switch p.Type {
+	case "number":
+		// Parsed as JSON so the value can be emitted as a bare literal.
+		var f float64
+		if err := json.Unmarshal([]byte(v), &f); err != nil {
+			return fmt.Errorf("%q is not a number", v)
+		}
+	case "bool":
+		if _, err := strconv.ParseBool(v); err != nil {
+			return fmt.Errorf("%q is not a bool", v)
+		}
+	}
+	return nil
+}
+
+// resolve checks vars against the declared parameters and returns the
+// value for every parameter, falling back to defaults.
+func resolve(params []Param, vars map[string]string) (map[string]string, error) {
+	declared := map[string]*Param{}
+	for i := range params {
+		declared[params[i].Name] = &params[i]
+	}
+	for k := range vars {
+		if declared[k] == nil {
+			return nil, fmt.Errorf("%w: unknown variable %q", ErrInvalidVars, k)
+		}
+	}
+	values := map[string]string{}
+	for i := range params {
+		p := &params[i]
+		v, ok := vars[p.Name]
+		if !ok {
+			if p.Default == nil {
+				return nil, fmt.Errorf("%w: missing value for %q", ErrInvalidVars, p.Name)
+			}
+			v, _ = scalarString(p.Default)
+		}
+		if err := checkType(p, v); err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidVars, p.Name, err)
+		}
+		if p.Type == "bool" {
+			b, _ := strconv.ParseBool(v)
+			v = strconv.FormatBool(b)
+		}
+		values[p.Name] = v
+	}
+	return values, nil
+}
+
+// substitute replaces {{name}} placeholders for declared parameters in
+// JSON data. A number or bool placeholder that makes up a whole string
+// ("{{port}}") becomes a bare JSON literal; anywhere else the value is
+// spliced into the string. Placeholders for undeclared names are left
+// untouched, and templates without parameters are returned verbatim.
+func substitute(data []byte, params []Param, values map[string]string) ([]byte, error) {
+	if len(params) == 0 {
+		return data, nil
+	}
+	types := map[string]string{}
+	for _, p := range params {
+		types[p.Name] = p.Type
+	}
+	replace := func(s string) string {
+		return placeholder.ReplaceAllStringFunc(s, func(m string) string {
+			if v, ok := values[placeholder.FindStringSubmatch(m)[1]]; ok {
+				return v
+			}
+			return m
+		})
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		// Not JSON: plain text substitution.
+		return []byte(replace(string(data))), nil
+	}
+	var walk func(v any) any
+	walk = func(v any) any {
+		switch v := v.(type) {
+		case string:
+			if m := placeholder.FindStringSubmatch(v); m != nil && m[0] == v {
+				switch types[m[1]] {
+				case "number":
+					return json.Number(values[m[1]])
+				case "bool":
+					return values[m[1]] == "true"
+				}
+			}
+			return replace(v)
+		case []any:
+			for i := range v {
+				v[i] = walk(v[i])
+			}
+		case map[string]any:
+			out := make(map[string]any, len(v))
+			for k, e := range v {
+				out[replace(k)] = walk(e)
+			}
+			return out
+		}
+		return v
+	}
+	doc = walk(doc)
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(doc); err != nil {
+		return nil, fmt.Errorf("encode template data: %w", err)
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
@@ -16,7 +16,9 @@ type Template struct {
 	Kind        string    `json:"kind"` // "rules", "contracts", "bundle"
 	Data        []byte    `json:"data"`
 	Tags        []string  `json:"tags"`
+	Params      []Param   `json:"params"`
 	Version     int64     `json:"version"`
+	Source      string    `json:"source"` // "local", or "federated" if pulled from an upstream server
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 }
@@ -29,6 +31,7 @@ type Summary struct {
 	Kind        string    `json:"kind"`
 	Tags        []string  `json:"tags"`
 	Version     int64     `json:"version"`
+	Source      string    `json:"source"` // "local", or "federated" if pulled from an upstream server
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 }
@@ -43,16 +46,24 @@ func New(db *sql.DB) *Store {
 	return &Store{db: db}
 }
 
-// Create inserts a new template.
-func (s *Store) Create(ctx context.Context, id, name, description, kind string, data []byte, tags []string) (*Template, error) {
+// Create inserts a new template. params declares the variables its data
+// may reference; it may be nil.
+func (s *Store) Create(ctx context.Context, id, name, description, kind string, data []byte, tags []string, params []Param) (*Template, error) {
 	if kind == "" {
 		kind = "rules"
 	}
+	if err := ValidateParams(params); err != nil {
+		return nil, err
+	}
+	if params == nil {
+		params = []Param{}
+	}
 	tagsJSON, _ := json.Marshal(tags)
+	paramsJSON, _ := json.Marshal(params)
 	_, err := s.db.ExecContext(ctx,
-		`INSERT INTO templates (id, name, description, kind, data, tags, version, created_at, updated_at)
-		 VALUES (?, ?, ?, ?, ?, ?, 1, datetime('now'), datetime('now'))`,
-		id, name, description, kind, data, string(tagsJSON))
+		`INSERT INTO templates (id, name, description, kind, data, tags, params, version, created_at, updated_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, 1, datetime('now'), datetime('now'))`,
+		id, name, description, kind, data, string(tagsJSON), string(paramsJSON))
 	if err != nil {
 		return nil, fmt.Errorf("insert template: %w", err)
 	}
@@ -62,11 +73,11 @@ func (s *Store) Create(ctx context.Context, id, name, description, kind string,
 // Get retrieves a template by ID.
 func (s *Store) Get(ctx context.Context, id string) (*Template, error) {
 	var t Template
-	var tagsStr, createdAt, updatedAt string
+	var tagsStr, paramsStr, createdAt, updatedAt string
 	err := s.db.QueryRowContext(ctx,
-		`SELECT id, name, description, kind, data, tags, version, created_at, updated_at
+		`SELECT id, name, description, kind, data, tags, params, version, source, created_at, updated_at
 		 FROM templates WHERE id = ?`, id).
-		Scan(&t.ID, &t.Name, &t.Description, &t.Kind, &t.Data, &tagsStr, &t.Version, &createdAt, &updatedAt)
+		Scan(&t.ID, &t.Name, &t.Description, &t.Kind, &t.Data, &tagsStr, &paramsStr, &t.Version, &t.Source, &createdAt, &updatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -74,6 +85,10 @@ func (s *Store) Get(ctx context.Context, id string) (*Template, error) {
 	if t.Tags == nil {
 		t.Tags = []string{}
 	}
+	json.Unmarshal([]byte(paramsStr), &t.Params)
+	if t.Params == nil {
+		t.Params = []Param{}
+	}
 	t.CreatedAt, _ = time.Parse("2006-01-02 15:04:05", createdAt)
 	t.UpdatedAt, _ = time.Parse("2006-01-02 15:04:05", updatedAt)
 	return &t, nil
@@ -81,7 +96,7 @@ func (s *Store) Get(ctx context.Context, id string) (*Template, error) {
 
 // List returns template summaries, optionally filtered by kind and tag.
 func (s *Store) List(ctx context.Context, kind, tag string) ([]Summary, error) {
-	query := `SELECT id, name, description, kind, tags, version, created_at, updated_at FROM templates WHERE 1=1`
+	query := `SELECT id, name, description, kind, tags, version, source, created_at, updated_at FROM templates WHERE 1=1`
 	args := []any{}
 
 	if kind != "" {
@@ -104,7 +119,7 @@ func (s *Store) List(ctx context.Context, kind, tag string) ([]Summary, error) {
 	for rows.Next() {
 		var item Summary
 		var tagsStr, createdAt, updatedAt string
-		if err := rows.Scan(&item.ID, &item.Name, &item.Description, &item.Kind, &tagsStr, &item.Version, &createdAt, &updatedAt); err != nil {
+		if err := rows.Scan(&item.ID, &item.Name, &item.Description, &item.Kind, &tagsStr, &item.Version, &item.Source, &createdAt, &updatedAt); err != nil {
 			return nil, fmt.Errorf("scan template: %w", err)
 		}
 		json.Unmarshal([]byte(tagsStr), &item.Tags)
@@ -131,12 +146,22 @@ func (s *Store) Delete(ctx context.Context, id string) error {
 	return nil
 }
 
-// Apply reads a template's data and returns it for the caller to apply
-// to the target project (rules import, contract creation, etc.).
-func (s *Store) Apply(ctx context.Context, id string) ([]byte, string, error) {
+// Apply reads a template's data, substitutes vars for its {{parameters}},
+// and returns it for the caller to apply to the target project (rules
+// import, contract creation, etc.). Unknown, missing or mistyped variables
+// are reported as ErrInvalidVars.
+func (s *Store) Apply(ctx context.Context, id string, vars map[string]string) ([]byte, string, error) {
 	t, err := s.Get(ctx, id)
 	if err != nil {
 		return nil, "", err
 	}
-	return t.Data, t.Kind, nil
+	values, err := resolve(t.Params, vars)
+	if err != nil {
+		return nil, "", err
+	}
+	data, err := substitute(t.Data, t.Params, values)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, t.Kind, nil
 }
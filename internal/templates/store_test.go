@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"testing"
 
 	"github.com/DavidRHerbert/koor/internal/db"
@@ -25,7 +26,7 @@ func TestCreateAndGet(t *testing.T) {
 	ctx := context.Background()
 
 	data, _ := json.Marshal([]map[string]string{{"rule_id": "no-eval", "pattern": "eval"}})
-	tmpl, err := store.Create(ctx, "tpl-1", "No Eval Rules", "Blocks eval usage", "rules", data, []string{"security", "js"})
+	tmpl, err := store.Create(ctx, "tpl-1", "No Eval Rules", "Blocks eval usage", "rules", data, []string{"security", "js"}, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -62,8 +63,8 @@ func TestList(t *testing.T) {
 	store := testStore(t)
 	ctx := context.Background()
 
-	store.Create(ctx, "tpl-rules", "Rules", "", "rules", []byte(`[]`), []string{"security"})
-	store.Create(ctx, "tpl-contract", "Contract", "", "contracts", []byte(`{}`), []string{"api"})
+	store.Create(ctx, "tpl-rules", "Rules", "", "rules", []byte(`[]`), []string{"security"}, nil)
+	store.Create(ctx, "tpl-contract", "Contract", "", "contracts", []byte(`{}`), []string{"api"}, nil)
 
 	// List all.
 	items, err := store.List(ctx, "", "")
@@ -103,7 +104,7 @@ func TestDelete(t *testing.T) {
 	store := testStore(t)
 	ctx := context.Background()
 
-	store.Create(ctx, "tpl-del", "Temp", "", "rules", []byte(`[]`), []string{})
+	store.Create(ctx, "tpl-del", "Temp", "", "rules", []byte(`[]`), []string{}, nil)
 	err := store.Delete(ctx, "tpl-del")
 	if err != nil {
 		t.Fatal(err)
@@ -130,9 +131,9 @@ func TestApply(t *testing.T) {
 	ctx := context.Background()
 
 	data := []byte(`[{"rule_id":"no-eval","pattern":"eval"}]`)
-	store.Create(ctx, "tpl-apply", "Apply Test", "", "rules", data, []string{})
+	store.Create(ctx, "tpl-apply", "Apply Test", "", "rules", data, []string{}, nil)
 
-	got, kind, err := store.Apply(ctx, "tpl-apply")
+	got, kind, err := store.Apply(ctx, "tpl-apply", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -148,8 +149,71 @@ func TestApplyNotFound(t *testing.T) {
 	store := testStore(t)
 	ctx := context.Background()
 
-	_, _, err := store.Apply(ctx, "nonexistent")
+	_, _, err := store.Apply(ctx, "nonexistent", nil)
 	if err != sql.ErrNoRows {
 		t.Errorf("expected sql.ErrNoRows, got %v", err)
 	}
 }
+
+func TestApplyVariables(t *testing.T) {
+	store := testStore(t)
+	ctx := context.Background()
+
+	data := []byte(`{"name":"{{service}}-api","port":"{{port}}","tls":"{{ tls }}","note":"say \"{{service}}\" on {{port}}","raw":"{{other}}"}`)
+	params := []templates.Param{
+		{Name: "service"},
+		{Name: "port", Type: "number", Default: float64(8080)},
+		{Name: "tls", Type: "bool", Default: false},
+	}
+	if _, err := store.Create(ctx, "tpl-vars", "Vars", "", "contracts", data, nil, params); err != nil {
+		t.Fatal(err)
+	}
+
+	got, _, err := store.Apply(ctx, "tpl-vars", map[string]string{"service": `pay"ments`, "tls": "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(got, &doc); err != nil {
+		t.Fatalf("applied data is not JSON: %s", got)
+	}
+	want := map[string]any{
+		"name": `pay"ments-api`, "port": float64(8080), "tls": true,
+		"note": `say "pay"ments" on 8080`, "raw": "{{other}}",
+	}
+	for k, v := range want {
+		if doc[k] != v {
+			t.Errorf("%s: expected %#v, got %#v", k, v, doc[k])
+		}
+	}
+
+	for _, vars := range []map[string]string{
+		nil,                                // service is required
+		{"service": "x", "nope": "1"},      // unknown variable
+		{"service": "x", "port": "eighty"}, // not a number
+		{"service": "x", "tls": "maybe"},   // not a bool
+	} {
+		if _, _, err := store.Apply(ctx, "tpl-vars", vars); !errors.Is(err, templates.ErrInvalidVars) {
+			t.Errorf("vars %v: expected ErrInvalidVars, got %v", vars, err)
+		}
+	}
+}
+
+func TestValidateParams(t *testing.T) {
+	bad := [][]templates.Param{
+		{{Name: "1st"}},
+		{{Name: "a"}, {Name: "a"}},
+		{{Name: "a", Type: "date"}},
+		{{Name: "a", Type: "number", Default: "many"}},
+		{{Name: "a", Default: []any{"x"}}},
+	}
+	for _, params := range bad {
+		if err := templates.ValidateParams(params); err == nil {
+			t.Errorf("expected %+v to be invalid", params)
+		}
+	}
+	params := []templates.Param{{Name: "a"}}
+	if err := templates.ValidateParams(params); err != nil || params[0].Type != "string" {
+		t.Errorf("expected default type string, got %+v, %v", params, err)
+	}
+}
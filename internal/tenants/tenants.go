@@ -0,0 +1,356 @@
+// Package tenants lets one koor-server host several independent teams.
+// Each tenant has its own SQLite database in its own data directory, and
+// so its own state, specs, events, instances, tokens and users. The
+// tenants themselves are registered in the host's database.
+//
+// A tenant's server stack is started on first use and stays open until the
+// tenant is suspended or deleted, or the Manager is closed.
+package tenants
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/DavidRHerbert/koor/internal/tokens"
+)
+
+// Tenant statuses.
+const (
+	StatusActive    = "active"
+	StatusSuspended = "suspended"
+)
+
+var (
+	// ErrExists is returned by Create for a tenant ID already in use.
+	ErrExists = errors.New("tenant already exists")
+	// ErrSuspended is returned by Stack for a suspended tenant.
+	ErrSuspended = errors.New("tenant is suspended")
+)
+
+// maxOwners bounds the caches of which tenant a bearer token belongs to
+// and of tokens that belong to none.
+const maxOwners = 10000
+
+// missTTL is how long a token no tenant knows is remembered as unknown, so
+// repeated requests with it do not check every tenant again.
+const missTTL = time.Minute
+
+// Tenant is a registered tenant.
+type Tenant struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Status      string    `json:"status"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// validID keeps tenant IDs safe as directory names and header values.
+var validID = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// Validate checks that a tenant is well-formed.
+func Validate(t *Tenant) error {
+	if !validID.MatchString(t.ID) {
+		return fmt.Errorf("id must be 1-63 lowercase letters, digits or hyphens, starting with a letter or digit")
+	}
+	return nil
+}
+
+// Stack is a tenant's running server.
+type Stack struct {
+	API       http.Handler
+	Dashboard http.Handler
+	// Knows reports whether a bearer token is one of the tenant's own
+	// tokens, users or instance registrations.
+	Knows func(ctx context.Context, secret string) bool
+	// AdminSecret is the secret of the admin user created when the
+	// tenant's database was new, or "".
+	AdminSecret string
+	Close       func()
+}
+
+// BuildFunc starts the stack of a tenant whose data lives in dir.
+type BuildFunc func(t Tenant, dir string) (*Stack, error)
+
+// Manager registers tenants and runs their stacks.
+type Manager struct {
+	db     *sql.DB
+	dir    string
+	build  BuildFunc
+	logger *slog.Logger
+
+	mu     sync.Mutex
+	open   map[string]*Stack    // tenant ID -> running stack
+	owners map[string]string    // token hash -> tenant ID
+	misses map[string]time.Time // token hash -> when no tenant knew it
+}
+
+// New creates a Manager that keeps tenant data directories under dir.
+func New(db *sql.DB, dir string, build BuildFunc, logger *slog.Logger) *Manager {
+	return &Manager{
+		db: db, dir: dir, build: build, logger: logger,
+		open: map[string]*Stack{}, owners: map[string]string{}, misses: map[string]time.Time{},
+	}
+}
+
+// Dir returns the data directory of a tenant.
+func (m *Manager) Dir(id string) string {
+	return filepath.Join(m.dir, id)
+}
+
+const selectTenant = `SELECT id, name, description, status, created_at FROM tenants`
+
+func scanTenant(row interface{ Scan(...any) error }) (*Tenant, error) {
+	var t Tenant
+	if err := row.Scan(&t.ID, &t.Name, &t.Description, &t.Status, &t.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// Create registers a tenant and starts its stack, which creates its
+// database. The returned stack's AdminSecret is set if the database is new;
+// a tenant deleted without purging its data picks that data up again.
+func (m *Manager) Create(ctx context.Context, t Tenant) (*Tenant, *Stack, error) {
+	if err := Validate(&t); err != nil {
+		return nil, nil, err
+	}
+	if t.Name == "" {
+		t.Name = t.ID
+	}
+	if _, err := m.Get(ctx, t.ID); err == nil {
+		return nil, nil, ErrExists
+	}
+	_, err := m.db.ExecContext(ctx,
+		`INSERT INTO tenants (id, name, description, status, created_at) VALUES (?, ?, ?, ?, datetime('now'))`,
+		t.ID, t.Name, t.Description, StatusActive)
+	if err != nil {
+		return nil, nil, fmt.Errorf("insert tenant: %w", err)
+	}
+	created, err := m.Get(ctx, t.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	m.forgetMisses()
+	st, err := m.Stack(ctx, t.ID)
+	if err != nil {
+		m.db.ExecContext(ctx, `DELETE FROM tenants WHERE id = ?`, t.ID)
+		return nil, nil, err
+	}
+	return created, st, nil
+}
+
+// Get returns a tenant. Returns sql.ErrNoRows if not found.
+func (m *Manager) Get(ctx context.Context, id string) (*Tenant, error) {
+	return scanTenant(m.db.QueryRowContext(ctx, selectTenant+` WHERE id = ?`, id))
+}
+
+// List returns all tenants.
+func (m *Manager) List(ctx context.Context) ([]Tenant, error) {
+	rows, err := m.db.QueryContext(ctx, selectTenant+` ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("query tenants: %w", err)
+	}
+	defer rows.Close()
+
+	list := []Tenant{}
+	for rows.Next() {
+		t, err := scanTenant(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan tenant: %w", err)
+		}
+		list = append(list, *t)
+	}
+	return list, rows.Err()
+}
+
+// SetStatus suspends or resumes a tenant. Suspending stops its stack.
+// Returns sql.ErrNoRows if not found.
+func (m *Manager) SetStatus(ctx context.Context, id, status string) (*Tenant, error) {
+	if status != StatusActive && status != StatusSuspended {
+		return nil, fmt.Errorf("unknown tenant status %q", status)
+	}
+	res, err := m.db.ExecContext(ctx, `UPDATE tenants SET status = ? WHERE id = ?`, status, id)
+	if err != nil {
+		return nil, fmt.Errorf("update tenant: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, sql.ErrNoRows
+	}
+	if status == StatusSuspended {
+		m.stop(id)
+	} else {
+		m.forgetMisses()
+	}
+	return m.Get(ctx, id)
+}
+
+// Delete stops a tenant and removes its registration. With purge it also
+// deletes the tenant's data directory. Returns sql.ErrNoRows if not found.
+func (m *Manager) Delete(ctx context.Context, id string, purge bool) error {
+	res, err := m.db.ExecContext(ctx, `DELETE FROM tenants WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("delete tenant: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	m.stop(id)
+	if _, err := m.db.ExecContext(ctx, `DELETE FROM tenant_owners WHERE tenant_id = ?`, id); err != nil {
+		return fmt.Errorf("delete tenant owners: %w", err)
+	}
+	if purge {
+		if err := os.RemoveAll(m.Dir(id)); err != nil {
+			return fmt.Errorf("purge tenant data: %w", err)
+		}
+	}
+	return nil
+}
+
+// Stack returns a tenant's running stack, starting it if needed. Returns
+// sql.ErrNoRows for an unknown tenant and ErrSuspended for a suspended one.
+func (m *Manager) Stack(ctx context.Context, id string) (*Stack, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if st := m.open[id]; st != nil {
+		return st, nil
+	}
+	t, err := m.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if t.Status == StatusSuspended {
+		return nil, ErrSuspended
+	}
+	st, err := m.build(*t, m.Dir(id))
+	if err != nil {
+		return nil, fmt.Errorf("start tenant %s: %w", id, err)
+	}
+	m.open[id] = st
+	m.logger.Info("tenant started", "tenant", id, "dir", m.Dir(id))
+	return st, nil
+}
+
+// Owner returns the ID of the active tenant a bearer token belongs to, or
+// "" if none. Tokens seen before are looked up in the tenant_owners index,
+// which starts only the owning tenant's stack. Other tokens are checked
+// against every active tenant, starting those not yet running; a token no
+// tenant knows is not checked again for missTTL.
+func (m *Manager) Owner(ctx context.Context, secret string) string {
+	hash := tokens.Hash(secret)
+	m.mu.Lock()
+	id, ok := m.owners[hash]
+	missed, isMiss := m.misses[hash]
+	m.mu.Unlock()
+	if ok {
+		return id
+	}
+	if isMiss && time.Since(missed) < missTTL {
+		return ""
+	}
+
+	var indexed string
+	err := m.db.QueryRowContext(ctx, `SELECT tenant_id FROM tenant_owners WHERE token_hash = ?`, hash).Scan(&indexed)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+	case err != nil:
+		m.logger.Error("tenant lookup failed", "error", err)
+		return ""
+	default:
+		st, err := m.Stack(ctx, indexed)
+		if errors.Is(err, ErrSuspended) {
+			return ""
+		}
+		if err == nil && st.Knows(ctx, secret) {
+			m.remember(hash, indexed)
+			return indexed
+		}
+		// The token was revoked or its tenant is gone.
+		m.db.ExecContext(ctx, `DELETE FROM tenant_owners WHERE token_hash = ?`, hash)
+	}
+
+	list, err := m.List(ctx)
+	if err != nil {
+		m.logger.Error("tenant lookup failed", "error", err)
+		return ""
+	}
+	for _, t := range list {
+		if t.Status != StatusActive || t.ID == indexed {
+			continue
+		}
+		st, err := m.Stack(ctx, t.ID)
+		if err != nil {
+			m.logger.Error("tenant lookup failed", "tenant", t.ID, "error", err)
+			continue
+		}
+		if st.Knows(ctx, secret) {
+			m.remember(hash, t.ID)
+			if _, err := m.db.ExecContext(ctx,
+				`INSERT OR REPLACE INTO tenant_owners (token_hash, tenant_id) VALUES (?, ?)`,
+				hash, t.ID); err != nil {
+				m.logger.Error("tenant owner index failed", "tenant", t.ID, "error", err)
+			}
+			return t.ID
+		}
+	}
+
+	m.mu.Lock()
+	if len(m.misses) >= maxOwners {
+		clear(m.misses)
+	}
+	m.misses[hash] = time.Now()
+	m.mu.Unlock()
+	return ""
+}
+
+// remember caches the tenant a token hash belongs to.
+func (m *Manager) remember(hash, id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.owners) >= maxOwners {
+		clear(m.owners)
+	}
+	m.owners[hash] = id
+}
+
+// forgetMisses drops the cache of unknown tokens, for when a tenant
+// becomes active and may know some of them.
+func (m *Manager) forgetMisses() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	clear(m.misses)
+}
+
+// stop closes a tenant's stack, if running, and forgets its tokens.
+func (m *Manager) stop(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if st := m.open[id]; st != nil {
+		st.Close()
+		delete(m.open, id)
+		m.logger.Info("tenant stopped", "tenant", id)
+	}
+	for hash, owner := range m.owners {
+		if owner == id {
+			delete(m.owners, hash)
+		}
+	}
+}
+
+// Close stops every running tenant stack.
+func (m *Manager) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, st := range m.open {
+		st.Close()
+		delete(m.open, id)
+	}
+}
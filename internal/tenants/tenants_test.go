@@ -0,0 +1,178 @@
+package tenants_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"os"
+	"testing"
+
+	"github.com/DavidRHerbert/koor/internal/db"
+	"github.com/DavidRHerbert/koor/internal/tenants"
+)
+
+// fakeStacks builds stacks that know one secret per tenant, "<id>-secret",
+// and records how often stacks were built and closed.
+type fakeStacks struct {
+	built, closed map[string]int
+}
+
+func (f *fakeStacks) build(t tenants.Tenant, dir string) (*tenants.Stack, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	f.built[t.ID]++
+	return &tenants.Stack{
+		Knows:       func(_ context.Context, secret string) bool { return secret == t.ID+"-secret" },
+		AdminSecret: "admin-" + t.ID,
+		Close:       func() { f.closed[t.ID]++ },
+	}, nil
+}
+
+func testManager(t *testing.T) (*tenants.Manager, *fakeStacks) {
+	t.Helper()
+	database, err := db.OpenMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	f := &fakeStacks{built: map[string]int{}, closed: map[string]int{}}
+	return tenants.New(database, t.TempDir(), f.build, slog.Default()), f
+}
+
+func TestCreateAndStack(t *testing.T) {
+	m, f := testManager(t)
+	ctx := context.Background()
+
+	created, st, err := m.Create(ctx, tenants.Tenant{ID: "team-a", Description: "Truck Wash team"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.Name != "team-a" || created.Status != tenants.StatusActive || st.AdminSecret != "admin-team-a" {
+		t.Errorf("unexpected tenant %+v, stack %+v", created, st)
+	}
+	if _, _, err := m.Create(ctx, tenants.Tenant{ID: "team-a"}); !errors.Is(err, tenants.ErrExists) {
+		t.Errorf("duplicate: expected ErrExists, got %v", err)
+	}
+	if _, _, err := m.Create(ctx, tenants.Tenant{ID: "../etc"}); err == nil {
+		t.Error("expected an invalid ID to be rejected")
+	}
+
+	if _, err := m.Stack(ctx, "team-a"); err != nil {
+		t.Fatal(err)
+	}
+	if f.built["team-a"] != 1 {
+		t.Errorf("a running stack should be reused, built %d times", f.built["team-a"])
+	}
+	if _, err := m.Stack(ctx, "nobody"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("unknown tenant: expected sql.ErrNoRows, got %v", err)
+	}
+
+	list, err := m.List(ctx)
+	if err != nil || len(list) != 1 || list[0].Description != "Truck Wash team" {
+		t.Errorf("list: %+v, %v", list, err)
+	}
+}
+
+func TestOwner(t *testing.T) {
+	m, f := testManager(t)
+	ctx := context.Background()
+	m.Create(ctx, tenants.Tenant{ID: "team-a"})
+	m.Create(ctx, tenants.Tenant{ID: "team-b"})
+
+	if got := m.Owner(ctx, "team-b-secret"); got != "team-b" {
+		t.Errorf("Owner = %q, want team-b", got)
+	}
+	if got := m.Owner(ctx, "unknown"); got != "" {
+		t.Errorf("Owner of an unknown secret = %q", got)
+	}
+
+	// An unknown secret is not checked against every tenant again.
+	m.Close()
+	m.Owner(ctx, "unknown")
+	if len(f.built) != 2 || f.built["team-a"] != 1 || f.built["team-b"] != 1 {
+		t.Errorf("a known miss should start no stacks, built %v", f.built)
+	}
+
+	// A suspended tenant's tokens no longer resolve.
+	m.SetStatus(ctx, "team-b", tenants.StatusSuspended)
+	if got := m.Owner(ctx, "team-b-secret"); got != "" {
+		t.Errorf("Owner after suspend = %q", got)
+	}
+}
+
+func TestOwnerIndex(t *testing.T) {
+	database, err := db.OpenMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	ctx := context.Background()
+	dir := t.TempDir()
+	f := &fakeStacks{built: map[string]int{}, closed: map[string]int{}}
+	m := tenants.New(database, dir, f.build, slog.Default())
+	m.Create(ctx, tenants.Tenant{ID: "team-a"})
+	m.Create(ctx, tenants.Tenant{ID: "team-b"})
+	m.Owner(ctx, "team-b-secret")
+	m.Close()
+
+	// After a restart, a token seen before starts only its own tenant.
+	f = &fakeStacks{built: map[string]int{}, closed: map[string]int{}}
+	m = tenants.New(database, dir, f.build, slog.Default())
+	if got := m.Owner(ctx, "team-b-secret"); got != "team-b" {
+		t.Errorf("Owner = %q, want team-b", got)
+	}
+	if len(f.built) != 1 || f.built["team-b"] != 1 {
+		t.Errorf("expected only team-b to start, built %v", f.built)
+	}
+
+	// Deleting the tenant drops its tokens from the index.
+	if err := m.Delete(ctx, "team-b", false); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.Owner(ctx, "team-b-secret"); got != "" {
+		t.Errorf("Owner after delete = %q", got)
+	}
+}
+
+func TestSuspendAndDelete(t *testing.T) {
+	m, f := testManager(t)
+	ctx := context.Background()
+	m.Create(ctx, tenants.Tenant{ID: "team-a"})
+
+	suspended, err := m.SetStatus(ctx, "team-a", tenants.StatusSuspended)
+	if err != nil || suspended.Status != tenants.StatusSuspended {
+		t.Fatalf("suspend: %+v, %v", suspended, err)
+	}
+	if f.closed["team-a"] != 1 {
+		t.Errorf("suspending should stop the stack, closed %d times", f.closed["team-a"])
+	}
+	if _, err := m.Stack(ctx, "team-a"); !errors.Is(err, tenants.ErrSuspended) {
+		t.Errorf("expected ErrSuspended, got %v", err)
+	}
+	if _, err := m.SetStatus(ctx, "team-a", tenants.StatusActive); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Stack(ctx, "team-a"); err != nil || f.built["team-a"] != 2 {
+		t.Errorf("resume: built %d times, %v", f.built["team-a"], err)
+	}
+
+	// Without purge the data stays; with it the directory goes.
+	if err := m.Delete(ctx, "team-a", false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(m.Dir("team-a")); err != nil {
+		t.Errorf("data should be kept without purge: %v", err)
+	}
+	m.Create(ctx, tenants.Tenant{ID: "team-a"})
+	if err := m.Delete(ctx, "team-a", true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(m.Dir("team-a")); !os.IsNotExist(err) {
+		t.Errorf("purge should remove the data directory: %v", err)
+	}
+	if err := m.Delete(ctx, "team-a", false); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows, got %v", err)
+	}
+}
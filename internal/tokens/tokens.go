@@ -0,0 +1,427 @@
+// Package tokens issues scoped API tokens, optionally bound to an agent
+// instance, and resolves presented bearer tokens to an identity.
+//
+// A token carries a list of scopes:
+//
+//	admin                     everything, including token management
+//	read                      any GET request
+//	write                     any write except token management
+//	events:publish            POST /api/events/publish
+//	instance:self             heartbeat, activate, set capabilities on, or
+//	                          deregister the bound instance
+//	tasks:work                claim tasks and complete or fail the tasks
+//	                          the bound instance holds
+//	state:write:<pattern>     write state keys matching pattern, where "*"
+//	                          matches any run of characters and {id} and
+//	                          {name} expand to the bound instance
+//
+// A token may also be bound to a project. It can then only reach that
+// project's state keys, specs, rules, event topics and instances; see
+// Identity.OwnsKey and Identity.OwnsTopic.
+//
+// Independently, a token's topic ACL (allow and deny patterns) limits the
+// events it receives from subscriptions and history; see
+// Identity.CanSeeTopic.
+//
+// Only a SHA-256 hash of each token is stored; the plaintext is returned
+// once, by Create.
+package tokens
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/DavidRHerbert/koor/internal/policy"
+	"github.com/google/uuid"
+)
+
+// Scopes a token can hold. State write scopes are StateWritePrefix
+// followed by a key pattern.
+const (
+	ScopeAdmin         = "admin"
+	ScopeRead          = "read"
+	ScopeWrite         = "write"
+	ScopeEventsPublish = "events:publish"
+	ScopeInstanceSelf  = "instance:self"
+	ScopeTasksWork     = "tasks:work"
+	ScopeMessages      = "messages"
+	StateWritePrefix   = "state:write:"
+)
+
+// DefaultInstanceScopes are granted to the token an instance receives at
+// registration: it may read, publish, look after itself, work tasks, send
+// and acknowledge messages, and write its own namespace under agents/{name}/.
+var DefaultInstanceScopes = []string{
+	ScopeRead, ScopeEventsPublish, ScopeInstanceSelf, ScopeTasksWork, ScopeMessages, StateWritePrefix + "agents/{name}/*",
+}
+
+// Token is a stored API token. The secret itself is never stored.
+type Token struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	InstanceID string     `json:"instance_id,omitempty"`
+	Project    string     `json:"project,omitempty"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+
+	// After a rotation the previous secret keeps working until then.
+	PreviousValidUntil *time.Time `json:"previous_valid_until,omitempty"`
+
+	Topics *TopicACL `json:"topics,omitempty"`
+}
+
+// TopicACL limits the event topics a token sees. A topic is visible if it
+// matches no Deny pattern and, when Allow is set, some Allow pattern. In
+// patterns "*" matches any run of characters, dots included.
+type TopicACL struct {
+	Allow []string `json:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty"`
+}
+
+// Allows reports whether the ACL lets topic through. A nil ACL allows
+// every topic.
+func (a *TopicACL) Allows(topic string) bool {
+	if a == nil {
+		return true
+	}
+	for _, p := range a.Deny {
+		if policy.Match(p, topic) {
+			return false
+		}
+	}
+	if len(a.Allow) == 0 {
+		return true
+	}
+	for _, p := range a.Allow {
+		if policy.Match(p, topic) {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks the ACL's patterns.
+func (a *TopicACL) Validate() error {
+	for _, p := range slices.Concat(a.Allow, a.Deny) {
+		if strings.TrimSpace(p) == "" {
+			return fmt.Errorf("topic patterns must not be empty")
+		}
+	}
+	return nil
+}
+
+// empty reports whether the ACL restricts nothing.
+func (a *TopicACL) empty() bool {
+	return a == nil || len(a.Allow) == 0 && len(a.Deny) == 0
+}
+
+// Identity is the caller a bearer token resolved to.
+type Identity struct {
+	TokenID      string    `json:"token_id,omitempty"`
+	Name         string    `json:"name"`
+	InstanceID   string    `json:"instance_id,omitempty"`
+	InstanceName string    `json:"instance_name,omitempty"`
+	Project      string    `json:"project,omitempty"`
+	Scopes       []string  `json:"scopes"`
+	Role         string    `json:"role,omitempty"` // users are authorized by role, not scopes
+	Topics       *TopicACL `json:"topics,omitempty"`
+}
+
+// Has reports whether the identity holds scope, or admin.
+func (id *Identity) Has(scope string) bool {
+	return slices.Contains(id.Scopes, ScopeAdmin) || slices.Contains(id.Scopes, scope)
+}
+
+// CrossProject reports whether the identity may reach every project: it
+// is not bound to one, or it holds admin.
+func (id *Identity) CrossProject() bool {
+	return id.Project == "" || slices.Contains(id.Scopes, ScopeAdmin)
+}
+
+// OwnsKey reports whether the identity may reach the state key. A
+// project owns the keys under "{project}/".
+func (id *Identity) OwnsKey(key string) bool {
+	return id.CrossProject() || strings.HasPrefix(key, id.Project+"/")
+}
+
+// OwnsTopic reports whether the identity may reach the event topic or
+// topic pattern. A project owns the topics under "{project}." with the
+// project lowercased, as agents publish them.
+func (id *Identity) OwnsTopic(topic string) bool {
+	return id.CrossProject() || strings.HasPrefix(topic, strings.ToLower(id.Project)+".")
+}
+
+// CanSeeTopic reports whether the identity may receive events on topic:
+// the topic is in its project, if it is bound to one, and its topic ACL
+// lets it through. Unlike OwnsTopic it takes a topic, not a pattern.
+func (id *Identity) CanSeeTopic(topic string) bool {
+	return id.OwnsTopic(topic) && id.Topics.Allows(topic)
+}
+
+// OwnsProject reports whether the identity may reach the named project.
+func (id *Identity) OwnsProject(project string) bool {
+	return id.CrossProject() || project == id.Project
+}
+
+// CanWriteState reports whether the identity may write the state key.
+func (id *Identity) CanWriteState(key string) bool {
+	if id.Has(ScopeWrite) {
+		return true
+	}
+	expand := strings.NewReplacer("{id}", id.InstanceID, "{name}", id.InstanceName)
+	for _, scope := range id.Scopes {
+		pattern, ok := strings.CutPrefix(scope, StateWritePrefix)
+		if ok && policy.Match(expand.Replace(pattern), key) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateScope checks that scope is one a token can hold.
+func ValidateScope(scope string) error {
+	switch scope {
+	case ScopeAdmin, ScopeRead, ScopeWrite, ScopeEventsPublish, ScopeInstanceSelf, ScopeTasksWork, ScopeMessages:
+		return nil
+	}
+	if pattern, ok := strings.CutPrefix(scope, StateWritePrefix); ok && pattern != "" {
+		return nil
+	}
+	return fmt.Errorf("unknown scope %q", scope)
+}
+
+// Hash returns the stored form of a token secret.
+func Hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// Store persists API tokens in SQLite.
+type Store struct {
+	db *sql.DB
+}
+
+// New creates a new token Store.
+func New(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+func newSecret() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generate token: %w", err)
+	}
+	return "koor_" + hex.EncodeToString(buf), nil
+}
+
+// Create stores a new token and returns it with its plaintext secret.
+func (s *Store) Create(ctx context.Context, t Token) (*Token, string, error) {
+	if t.Name == "" {
+		return nil, "", fmt.Errorf("name is required")
+	}
+	if len(t.Scopes) == 0 {
+		return nil, "", fmt.Errorf("at least one scope is required")
+	}
+	for _, scope := range t.Scopes {
+		if err := ValidateScope(scope); err != nil {
+			return nil, "", err
+		}
+	}
+	if t.Project != "" && slices.Contains(t.Scopes, ScopeAdmin) {
+		return nil, "", fmt.Errorf("a project token cannot hold the %s scope", ScopeAdmin)
+	}
+	topics, err := encodeTopics(t.Topics)
+	if err != nil {
+		return nil, "", err
+	}
+	secret, err := newSecret()
+	if err != nil {
+		return nil, "", err
+	}
+	t.ID = uuid.New().String()
+	scopes, _ := json.Marshal(t.Scopes)
+
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO api_tokens (id, name, instance_id, project, scopes, topics, hash, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		t.ID, t.Name, t.InstanceID, t.Project, string(scopes), topics, Hash(secret), t.ExpiresAt)
+	if err != nil {
+		return nil, "", fmt.Errorf("create token: %w", err)
+	}
+	created, err := s.Get(ctx, t.ID)
+	if err != nil {
+		return nil, "", err
+	}
+	return created, secret, nil
+}
+
+// encodeTopics returns the stored form of a topic ACL, "" for none.
+func encodeTopics(acl *TopicACL) (string, error) {
+	if acl.empty() {
+		return "", nil
+	}
+	if err := acl.Validate(); err != nil {
+		return "", err
+	}
+	data, _ := json.Marshal(acl)
+	return string(data), nil
+}
+
+const tokenColumns = `id, name, instance_id, project, scopes, topics, created_at, expires_at, last_used_at, previous_hash_until`
+
+func scanToken(row interface{ Scan(...any) error }) (*Token, error) {
+	var t Token
+	var scopes, topics string
+	var expires, lastUsed, previousUntil sql.NullTime
+	if err := row.Scan(&t.ID, &t.Name, &t.InstanceID, &t.Project, &scopes, &topics, &t.CreatedAt, &expires, &lastUsed, &previousUntil); err != nil {
+		return nil, err
+	}
+	if topics != "" {
+		json.Unmarshal([]byte(topics), &t.Topics)
+	}
+	if previousUntil.Valid {
+		t.PreviousValidUntil = &previousUntil.Time
+	}
+	json.Unmarshal([]byte(scopes), &t.Scopes)
+	if expires.Valid {
+		t.ExpiresAt = &expires.Time
+	}
+	if lastUsed.Valid {
+		t.LastUsedAt = &lastUsed.Time
+	}
+	return &t, nil
+}
+
+// Get returns a token by ID. Returns sql.ErrNoRows if not found.
+func (s *Store) Get(ctx context.Context, id string) (*Token, error) {
+	return scanToken(s.db.QueryRowContext(ctx,
+		`SELECT `+tokenColumns+` FROM api_tokens WHERE id = ?`, id))
+}
+
+// List returns all tokens, optionally only those bound to instanceID.
+func (s *Store) List(ctx context.Context, instanceID string) ([]Token, error) {
+	query := `SELECT ` + tokenColumns + ` FROM api_tokens`
+	args := []any{}
+	if instanceID != "" {
+		query += ` WHERE instance_id = ?`
+		args = append(args, instanceID)
+	}
+	query += ` ORDER BY created_at, id`
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list tokens: %w", err)
+	}
+	defer rows.Close()
+
+	var out []Token
+	for rows.Next() {
+		t, err := scanToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan token: %w", err)
+		}
+		out = append(out, *t)
+	}
+	return out, rows.Err()
+}
+
+// Revoke deletes a token. Returns sql.ErrNoRows if not found.
+func (s *Store) Revoke(ctx context.Context, id string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM api_tokens WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("revoke token: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SetTopics replaces a token's topic ACL; a nil or empty ACL removes it.
+// Returns sql.ErrNoRows if not found.
+func (s *Store) SetTopics(ctx context.Context, id string, acl *TopicACL) (*Token, error) {
+	topics, err := encodeTopics(acl)
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.db.ExecContext(ctx, `UPDATE api_tokens SET topics = ? WHERE id = ?`, topics, id)
+	if err != nil {
+		return nil, fmt.Errorf("set token topics: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return s.Get(ctx, id)
+}
+
+// RevokeInstance deletes every token bound to an instance.
+func (s *Store) RevokeInstance(ctx context.Context, instanceID string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM api_tokens WHERE instance_id = ?`, instanceID)
+	return err
+}
+
+// Rotate replaces a token's secret and returns the token with the new
+// one. For the grace period the old secret keeps working too, so whoever
+// holds it can switch over without downtime; a grace of 0 invalidates it
+// at once. Returns sql.ErrNoRows if not found.
+func (s *Store) Rotate(ctx context.Context, id string, grace time.Duration) (*Token, string, error) {
+	secret, err := newSecret()
+	if err != nil {
+		return nil, "", err
+	}
+	// SET reads the row as it was, so previous_hash takes the old hash.
+	var res sql.Result
+	if grace > 0 {
+		res, err = s.db.ExecContext(ctx,
+			`UPDATE api_tokens SET previous_hash = hash, previous_hash_until = ?, hash = ? WHERE id = ?`,
+			time.Now().UTC().Add(grace), Hash(secret), id)
+	} else {
+		res, err = s.db.ExecContext(ctx,
+			`UPDATE api_tokens SET previous_hash = '', previous_hash_until = NULL, hash = ? WHERE id = ?`,
+			Hash(secret), id)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("rotate token: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, "", sql.ErrNoRows
+	}
+	t, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, "", err
+	}
+	return t, secret, nil
+}
+
+// Resolve looks up an unexpired token by its secret, or by its previous
+// secret during a rotation's grace period, and records its use. Returns
+// sql.ErrNoRows if the secret is unknown or expired.
+func (s *Store) Resolve(ctx context.Context, secret string) (*Token, error) {
+	hash := Hash(secret)
+	t, err := scanToken(s.db.QueryRowContext(ctx,
+		`SELECT `+tokenColumns+` FROM api_tokens WHERE hash = ?`, hash))
+	if errors.Is(err, sql.ErrNoRows) {
+		t, err = scanToken(s.db.QueryRowContext(ctx,
+			`SELECT `+tokenColumns+` FROM api_tokens WHERE previous_hash = ?`, hash))
+		if err == nil && (t.PreviousValidUntil == nil || time.Now().After(*t.PreviousValidUntil)) {
+			return nil, sql.ErrNoRows
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if t.ExpiresAt != nil && time.Now().After(*t.ExpiresAt) {
+		return nil, sql.ErrNoRows
+	}
+	s.db.ExecContext(ctx, `UPDATE api_tokens SET last_used_at = datetime('now') WHERE id = ?`, t.ID)
+	return t, nil
+}
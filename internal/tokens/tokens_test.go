@@ -0,0 +1,196 @@
+package tokens_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DavidRHerbert/koor/internal/db"
+	"github.com/DavidRHerbert/koor/internal/tokens"
+)
+
+func TestStore(t *testing.T) {
+	database, err := db.OpenMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+	store := tokens.New(database)
+	ctx := context.Background()
+
+	if _, _, err := store.Create(ctx, tokens.Token{Name: "ci", Scopes: []string{"deploy"}}); err == nil {
+		t.Error("expected error for unknown scope")
+	}
+
+	tok, secret, err := store.Create(ctx, tokens.Token{Name: "ci", InstanceID: "inst-1", Scopes: []string{"read"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret == "" || tok.ID == "" || tok.CreatedAt.IsZero() {
+		t.Fatalf("unexpected token: %q %+v", secret, tok)
+	}
+
+	got, err := store.Resolve(ctx, secret)
+	if err != nil || got.ID != tok.ID {
+		t.Fatalf("resolve: %v %+v", err, got)
+	}
+	if _, err := store.Resolve(ctx, "koor_wrong"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected ErrNoRows for unknown secret, got %v", err)
+	}
+	if got, _ := store.Get(ctx, tok.ID); got.LastUsedAt == nil {
+		t.Error("expected last_used_at after resolve")
+	}
+
+	past := time.Now().Add(-time.Minute)
+	_, expired, _ := store.Create(ctx, tokens.Token{Name: "old", Scopes: []string{"read"}, ExpiresAt: &past})
+	if _, err := store.Resolve(ctx, expired); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected expired token to be rejected, got %v", err)
+	}
+
+	if list, _ := store.List(ctx, "inst-1"); len(list) != 1 {
+		t.Errorf("expected 1 token for inst-1, got %d", len(list))
+	}
+	if err := store.RevokeInstance(ctx, "inst-1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Revoke(ctx, tok.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected ErrNoRows revoking a removed token, got %v", err)
+	}
+}
+
+func TestIdentityScopes(t *testing.T) {
+	id := &tokens.Identity{InstanceID: "i1", InstanceName: "backend", Scopes: tokens.DefaultInstanceScopes}
+	if !id.CanWriteState("agents/backend/status") {
+		t.Error("instance should write its own namespace")
+	}
+	if id.CanWriteState("agents/frontend/status") || id.CanWriteState("config/db") {
+		t.Error("instance should not write outside its namespace")
+	}
+	if id.Has(tokens.ScopeWrite) {
+		t.Error("default instance scopes should not include write")
+	}
+	admin := &tokens.Identity{Scopes: []string{tokens.ScopeAdmin}}
+	if !admin.Has(tokens.ScopeEventsPublish) || !admin.CanWriteState("anything") {
+		t.Error("admin should imply every scope")
+	}
+}
+
+func TestIdentityProject(t *testing.T) {
+	id := &tokens.Identity{Project: "Truck-Wash", Scopes: []string{tokens.ScopeRead, tokens.ScopeWrite}}
+	if !id.OwnsKey("Truck-Wash/status") || id.OwnsKey("Other/status") || id.OwnsKey("Truck-Wash-2/status") {
+		t.Error("project token should own only the keys under its project")
+	}
+	if !id.OwnsTopic("truck-wash.backend.done") || id.OwnsTopic("other.done") || id.OwnsTopic("*") {
+		t.Error("project token should own only its lowercased topic prefix")
+	}
+	if !id.OwnsProject("Truck-Wash") || id.OwnsProject("Other") {
+		t.Error("project token should own only its project")
+	}
+	admin := &tokens.Identity{Project: "Truck-Wash", Scopes: []string{tokens.ScopeAdmin}}
+	if !admin.OwnsKey("Other/status") || !admin.OwnsProject("Other") {
+		t.Error("admin should reach every project")
+	}
+
+	database, err := db.OpenMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+	store := tokens.New(database)
+	if _, _, err := store.Create(context.Background(), tokens.Token{Name: "x", Project: "Truck-Wash", Scopes: []string{tokens.ScopeAdmin}}); err == nil {
+		t.Error("expected a project token with admin scope to be rejected")
+	}
+	tok, _, err := store.Create(context.Background(), tokens.Token{Name: "tw", Project: "Truck-Wash", Scopes: []string{tokens.ScopeRead}})
+	if err != nil || tok.Project != "Truck-Wash" {
+		t.Fatalf("create project token: %v %+v", err, tok)
+	}
+}
+
+func TestRotate(t *testing.T) {
+	database, err := db.OpenMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+	store := tokens.New(database)
+	ctx := context.Background()
+
+	tok, old, err := store.Create(ctx, tokens.Token{Name: "ci", Scopes: []string{"read"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, fresh, err := store.Rotate(ctx, tok.ID, time.Hour)
+	if err != nil || fresh == old {
+		t.Fatalf("rotate: %v", err)
+	}
+	for _, secret := range []string{old, fresh} {
+		if got, err := store.Resolve(ctx, secret); err != nil || got.ID != tok.ID {
+			t.Errorf("expected both secrets to resolve during the grace period: %v", err)
+		}
+	}
+
+	// The grace period ends: only the new secret works.
+	database.Exec(`UPDATE api_tokens SET previous_hash_until = ? WHERE id = ?`, time.Now().Add(-time.Minute), tok.ID)
+	if _, err := store.Resolve(ctx, old); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected the old secret to be rejected after the grace period, got %v", err)
+	}
+	if _, err := store.Resolve(ctx, fresh); err != nil {
+		t.Errorf("new secret: %v", err)
+	}
+
+	if _, _, err := store.Rotate(ctx, "missing", time.Hour); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected ErrNoRows rotating an unknown token, got %v", err)
+	}
+}
+
+func TestTopicACL(t *testing.T) {
+	acl := &tokens.TopicACL{Allow: []string{"tw.*", "deploy.*"}, Deny: []string{"tw.secrets.*"}}
+	for topic, want := range map[string]bool{
+		"tw.api.changed":   true,
+		"deploy.done":      true,
+		"tw.secrets.dbkey": false,
+		"billing.invoiced": false,
+	} {
+		if got := acl.Allows(topic); got != want {
+			t.Errorf("Allows(%q) = %v, want %v", topic, got, want)
+		}
+	}
+	if !(*tokens.TopicACL)(nil).Allows("anything") {
+		t.Error("nil ACL should allow every topic")
+	}
+	denyOnly := &tokens.TopicACL{Deny: []string{"billing.*"}}
+	if !denyOnly.Allows("tw.x") || denyOnly.Allows("billing.x") {
+		t.Error("deny-only ACL should allow everything else")
+	}
+
+	id := &tokens.Identity{Project: "TW", Scopes: []string{"read"}, Topics: &tokens.TopicACL{Deny: []string{"tw.secrets.*"}}}
+	if !id.CanSeeTopic("tw.api") || id.CanSeeTopic("tw.secrets.x") || id.CanSeeTopic("other.api") {
+		t.Error("CanSeeTopic should apply both the project and the ACL")
+	}
+
+	database, err := db.OpenMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+	store := tokens.New(database)
+	ctx := context.Background()
+	if _, _, err := store.Create(ctx, tokens.Token{Name: "x", Scopes: []string{"read"}, Topics: &tokens.TopicACL{Allow: []string{" "}}}); err == nil {
+		t.Error("expected error for an empty pattern")
+	}
+	tok, secret, err := store.Create(ctx, tokens.Token{Name: "wall", Scopes: []string{"read"}, Topics: acl})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := store.Resolve(ctx, secret); got.Topics == nil || len(got.Topics.Deny) != 1 {
+		t.Errorf("expected the ACL to be stored, got %+v", got.Topics)
+	}
+	if got, err := store.SetTopics(ctx, tok.ID, &tokens.TopicACL{}); err != nil || got.Topics != nil {
+		t.Errorf("empty ACL should clear it: %+v %v", got, err)
+	}
+	if _, err := store.SetTopics(ctx, "missing", acl); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected ErrNoRows, got %v", err)
+	}
+}
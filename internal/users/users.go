@@ -0,0 +1,265 @@
+// Package users stores the people who use the REST API and dashboard,
+// each with a role that decides which route groups they may call.
+//
+// Roles, from least to most privileged:
+//
+//	viewer      read everything except the audit log
+//	agent       viewer, plus writes: state, events, tasks, specs, ...
+//	controller  agent, plus rule review, template management and audit read
+//	admin       everything, including user and token management
+//
+// Each user authenticates with a bearer secret. Only a SHA-256 hash of the
+// secret is stored; the plaintext is returned once, by Create and Reset.
+package users
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/DavidRHerbert/koor/internal/tokens"
+	"github.com/google/uuid"
+)
+
+// Roles a user can hold.
+const (
+	RoleAdmin      = "admin"
+	RoleController = "controller"
+	RoleAgent      = "agent"
+	RoleViewer     = "viewer"
+)
+
+// Roles lists every role, least privileged first.
+var Roles = []string{RoleViewer, RoleAgent, RoleController, RoleAdmin}
+
+// Route groups a role can be granted. The server maps each request to one.
+const (
+	PermRead            = "read"             // any GET not covered below
+	PermWrite           = "write"            // any write not covered below
+	PermStateWrite      = "state:write"      // PUT/DELETE /api/state/...
+	PermRulesReview     = "rules:review"     // accept or reject proposed rules
+	PermTemplatesManage = "templates:manage" // create or delete templates
+	PermAuditRead       = "audit:read"       // GET /api/audit...
+	PermAdmin           = "admin"            // users, tokens, replication
+)
+
+var rolePerms = map[string][]string{
+	RoleViewer:     {PermRead},
+	RoleAgent:      {PermRead, PermWrite, PermStateWrite},
+	RoleController: {PermRead, PermWrite, PermStateWrite, PermRulesReview, PermTemplatesManage, PermAuditRead},
+	RoleAdmin:      {PermRead, PermWrite, PermStateWrite, PermRulesReview, PermTemplatesManage, PermAuditRead, PermAdmin},
+}
+
+// Allows reports whether role grants perm.
+func Allows(role, perm string) bool {
+	return slices.Contains(rolePerms[role], perm)
+}
+
+// ValidateRole checks that role is one a user can hold.
+func ValidateRole(role string) error {
+	if _, ok := rolePerms[role]; !ok {
+		return fmt.Errorf("unknown role %q (want viewer, agent, controller or admin)", role)
+	}
+	return nil
+}
+
+// ErrLastAdmin is returned when a change would leave no admin.
+var ErrLastAdmin = errors.New("cannot remove the last admin")
+
+// User is a stored user. The secret itself is never stored.
+type User struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Role       string     `json:"role"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt *time.Time `json:"last_seen_at,omitempty"`
+}
+
+// Store persists users in SQLite.
+type Store struct {
+	db *sql.DB
+}
+
+// New creates a new user Store.
+func New(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+func newSecret() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generate secret: %w", err)
+	}
+	return "koor_u_" + hex.EncodeToString(buf), nil
+}
+
+// Create stores a new user and returns it with its plaintext secret.
+func (s *Store) Create(ctx context.Context, name, role string) (*User, string, error) {
+	if name == "" {
+		return nil, "", fmt.Errorf("name is required")
+	}
+	if err := ValidateRole(role); err != nil {
+		return nil, "", err
+	}
+	var exists int
+	s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM users WHERE name = ?`, name).Scan(&exists)
+	if exists > 0 {
+		return nil, "", fmt.Errorf("user %q already exists", name)
+	}
+	secret, err := newSecret()
+	if err != nil {
+		return nil, "", err
+	}
+	id := uuid.New().String()
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO users (id, name, role, hash) VALUES (?, ?, ?, ?)`,
+		id, name, role, tokens.Hash(secret))
+	if err != nil {
+		return nil, "", fmt.Errorf("create user: %w", err)
+	}
+	u, err := s.Get(ctx, name)
+	if err != nil {
+		return nil, "", err
+	}
+	return u, secret, nil
+}
+
+// EnsureAdmin creates an "admin" user if there are no users yet and
+// returns its secret. It returns "" if users already exist.
+func (s *Store) EnsureAdmin(ctx context.Context) (string, error) {
+	var n int
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM users`).Scan(&n); err != nil {
+		return "", fmt.Errorf("count users: %w", err)
+	}
+	if n > 0 {
+		return "", nil
+	}
+	_, secret, err := s.Create(ctx, "admin", RoleAdmin)
+	return secret, err
+}
+
+const userColumns = `id, name, role, created_at, last_seen_at`
+
+func scanUser(row interface{ Scan(...any) error }) (*User, error) {
+	var u User
+	var lastSeen sql.NullTime
+	if err := row.Scan(&u.ID, &u.Name, &u.Role, &u.CreatedAt, &lastSeen); err != nil {
+		return nil, err
+	}
+	if lastSeen.Valid {
+		u.LastSeenAt = &lastSeen.Time
+	}
+	return &u, nil
+}
+
+// Get returns a user by name. Returns sql.ErrNoRows if not found.
+func (s *Store) Get(ctx context.Context, name string) (*User, error) {
+	return scanUser(s.db.QueryRowContext(ctx,
+		`SELECT `+userColumns+` FROM users WHERE name = ?`, name))
+}
+
+// List returns all users by name.
+func (s *Store) List(ctx context.Context) ([]User, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+userColumns+` FROM users ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("list users: %w", err)
+	}
+	defer rows.Close()
+
+	var out []User
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan user: %w", err)
+		}
+		out = append(out, *u)
+	}
+	return out, rows.Err()
+}
+
+// SetRole changes a user's role. Returns sql.ErrNoRows if not found.
+func (s *Store) SetRole(ctx context.Context, name, role string) (*User, error) {
+	if err := ValidateRole(role); err != nil {
+		return nil, err
+	}
+	if role != RoleAdmin {
+		if err := s.keepAnAdmin(ctx, name); err != nil {
+			return nil, err
+		}
+	}
+	res, err := s.db.ExecContext(ctx, `UPDATE users SET role = ? WHERE name = ?`, role, name)
+	if err != nil {
+		return nil, fmt.Errorf("set role: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return s.Get(ctx, name)
+}
+
+// Reset replaces a user's secret and returns the new one. Returns
+// sql.ErrNoRows if not found.
+func (s *Store) Reset(ctx context.Context, name string) (string, error) {
+	secret, err := newSecret()
+	if err != nil {
+		return "", err
+	}
+	res, err := s.db.ExecContext(ctx, `UPDATE users SET hash = ? WHERE name = ?`, tokens.Hash(secret), name)
+	if err != nil {
+		return "", fmt.Errorf("reset user: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return "", sql.ErrNoRows
+	}
+	return secret, nil
+}
+
+// Delete removes a user. Returns sql.ErrNoRows if not found.
+func (s *Store) Delete(ctx context.Context, name string) error {
+	if err := s.keepAnAdmin(ctx, name); err != nil {
+		return err
+	}
+	res, err := s.db.ExecContext(ctx, `DELETE FROM users WHERE name = ?`, name)
+	if err != nil {
+		return fmt.Errorf("delete user: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// keepAnAdmin refuses to demote or delete the last admin.
+func (s *Store) keepAnAdmin(ctx context.Context, name string) error {
+	var others int
+	err := s.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM users WHERE role = ? AND name != ?`, RoleAdmin, name).Scan(&others)
+	if err != nil {
+		return fmt.Errorf("count admins: %w", err)
+	}
+	if others > 0 {
+		return nil
+	}
+	u, err := s.Get(ctx, name)
+	if err == nil && u.Role == RoleAdmin {
+		return ErrLastAdmin
+	}
+	return nil
+}
+
+// Resolve looks up a user by secret and records the visit. Returns
+// sql.ErrNoRows if the secret is unknown.
+func (s *Store) Resolve(ctx context.Context, secret string) (*User, error) {
+	u, err := scanUser(s.db.QueryRowContext(ctx,
+		`SELECT `+userColumns+` FROM users WHERE hash = ?`, tokens.Hash(secret)))
+	if err != nil {
+		return nil, err
+	}
+	s.db.ExecContext(ctx, `UPDATE users SET last_seen_at = datetime('now') WHERE id = ?`, u.ID)
+	return u, nil
+}
@@ -0,0 +1,87 @@
+package users_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/DavidRHerbert/koor/internal/db"
+	"github.com/DavidRHerbert/koor/internal/users"
+)
+
+func TestStore(t *testing.T) {
+	database, err := db.OpenMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+	store := users.New(database)
+	ctx := context.Background()
+
+	secret, err := store.EnsureAdmin(ctx)
+	if err != nil || secret == "" {
+		t.Fatalf("seed admin: %q %v", secret, err)
+	}
+	if again, _ := store.EnsureAdmin(ctx); again != "" {
+		t.Error("expected no second admin once users exist")
+	}
+	u, err := store.Resolve(ctx, secret)
+	if err != nil || u.Name != "admin" || u.Role != users.RoleAdmin {
+		t.Fatalf("resolve admin: %v %+v", err, u)
+	}
+
+	if _, _, err := store.Create(ctx, "ana", "owner"); err == nil {
+		t.Error("expected error for unknown role")
+	}
+	if _, _, err := store.Create(ctx, "ana", users.RoleViewer); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := store.Create(ctx, "ana", users.RoleAgent); err == nil {
+		t.Error("expected error for duplicate name")
+	}
+
+	if _, err := store.SetRole(ctx, "admin", users.RoleViewer); !errors.Is(err, users.ErrLastAdmin) {
+		t.Errorf("expected ErrLastAdmin demoting the only admin, got %v", err)
+	}
+	if _, err := store.SetRole(ctx, "ana", users.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete(ctx, "admin"); err != nil {
+		t.Errorf("delete with another admin left: %v", err)
+	}
+	if err := store.Delete(ctx, "ana"); !errors.Is(err, users.ErrLastAdmin) {
+		t.Errorf("expected ErrLastAdmin deleting the only admin, got %v", err)
+	}
+
+	fresh, err := store.Reset(ctx, "ana")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Resolve(ctx, fresh); err != nil {
+		t.Errorf("new secret should resolve: %v", err)
+	}
+	if err := store.Delete(ctx, "nobody"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected ErrNoRows for unknown user, got %v", err)
+	}
+}
+
+func TestAllows(t *testing.T) {
+	for _, tc := range []struct {
+		role, perm string
+		want       bool
+	}{
+		{users.RoleViewer, users.PermRead, true},
+		{users.RoleViewer, users.PermStateWrite, false},
+		{users.RoleAgent, users.PermStateWrite, true},
+		{users.RoleAgent, users.PermRulesReview, false},
+		{users.RoleController, users.PermAuditRead, true},
+		{users.RoleController, users.PermAdmin, false},
+		{users.RoleAdmin, users.PermAdmin, true},
+		{"owner", users.PermRead, false},
+	} {
+		if got := users.Allows(tc.role, tc.perm); got != tc.want {
+			t.Errorf("Allows(%s, %s) = %v, want %v", tc.role, tc.perm, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,348 @@
+package webhooks
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Delivery kinds.
+const (
+	KindEvent     = "event"     // first attempt at delivering an event
+	KindRetry     = "retry"     // automatic retry of a failed event delivery
+	KindTest      = "test"      // TestFire
+	KindReplay    = "replay"    // Replay
+	KindRedeliver = "redeliver" // manual Redeliver of a logged delivery
+)
+
+// DeliveryRetention is how long the delivery log is kept. Dead letters are
+// kept until they are redelivered or their webhook is deleted.
+const DeliveryRetention = 7 * 24 * time.Hour
+
+const (
+	retryInterval   = 5 * time.Second // how often due retries are looked for
+	retryBatch      = 100             // most retries sent per pass
+	responseSnippet = 512             // bytes of the receiver's response kept in the log
+)
+
+// RetryPolicy controls how failed event deliveries are retried. Each retry
+// waits twice as long as the one before, up to MaxDelay. An event still
+// failing after MaxAttempts is moved to the dead-letter queue.
+type RetryPolicy struct {
+	MaxAttempts int           // attempts per event, including the first
+	BaseDelay   time.Duration // wait before the first retry
+	MaxDelay    time.Duration
+}
+
+// DefaultRetryPolicy retries after 30s, 1m, 2m and 4m.
+var DefaultRetryPolicy = RetryPolicy{MaxAttempts: 5, BaseDelay: 30 * time.Second, MaxDelay: time.Hour}
+
+// delay returns the wait after the given failed attempt (1-based).
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < attempt && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	return min(d, p.MaxDelay)
+}
+
+// SetRetryPolicy replaces DefaultRetryPolicy. Call it before Start.
+func (d *Dispatcher) SetRetryPolicy(p RetryPolicy) {
+	if p.MaxAttempts < 1 {
+		p.MaxAttempts = 1
+	}
+	if p.MaxDelay < p.BaseDelay {
+		p.MaxDelay = p.BaseDelay
+	}
+	d.retry = p
+}
+
+// Delivery is one logged attempt to deliver a payload to a webhook.
+type Delivery struct {
+	ID          int64      `json:"id"`
+	WebhookID   string     `json:"webhook_id"`
+	EventID     int64      `json:"event_id"` // 0 for test fires
+	Topic       string     `json:"topic"`
+	Kind        string     `json:"kind"`
+	Attempt     int        `json:"attempt"`
+	Success     bool       `json:"success"`
+	StatusCode  int        `json:"status_code,omitempty"` // 0 if no response was received
+	LatencyMS   int64      `json:"latency_ms"`
+	Response    string     `json:"response,omitempty"` // start of the response body
+	Error       string     `json:"error,omitempty"`
+	NextRetryAt *time.Time `json:"next_retry_at,omitempty"` // set while a retry is pending
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// DeadLetter is an event that could not be delivered within the retry policy.
+type DeadLetter struct {
+	ID         int64     `json:"id"`
+	WebhookID  string    `json:"webhook_id"`
+	EventID    int64     `json:"event_id"`
+	Topic      string    `json:"topic"`
+	DeliveryID int64     `json:"delivery_id"` // the last attempt; redeliver it to retry
+	Attempts   int       `json:"attempts"`
+	LastError  string    `json:"last_error"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// DeliveryFilter narrows Deliveries.
+type DeliveryFilter struct {
+	EventID int64
+	Status  string // "success", "failed" or "retrying"; empty for all
+	Limit   int    // default 100
+}
+
+// DeliveryCounts reports the number of successful and failed deliveries
+// since the dispatcher was created.
+func (d *Dispatcher) DeliveryCounts() (delivered, failed int64) {
+	return d.delivered.Load(), d.failed.Load()
+}
+
+// deliver sends payload to wh and logs the attempt. The returned delivery
+// is the logged row; the error is the delivery failure, if any.
+func (d *Dispatcher) deliver(ctx context.Context, wh *Webhook, del Delivery, payload []byte) (*Delivery, error) {
+	start := time.Now()
+	code, snippet, err := d.post(wh, payload, del.EventID, del.Kind == KindReplay)
+	del.WebhookID = wh.ID
+	del.StatusCode = code
+	del.LatencyMS = time.Since(start).Milliseconds()
+	del.Response = snippet
+	del.Success = err == nil
+	del.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	if err != nil {
+		del.Error = err.Error()
+		d.failed.Add(1)
+	} else {
+		d.delivered.Add(1)
+	}
+
+	res, lerr := d.db.ExecContext(ctx,
+		`INSERT INTO webhook_deliveries
+		 (webhook_id, event_id, topic, kind, attempt, success, status_code, latency_ms, response, error, payload, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		del.WebhookID, del.EventID, del.Topic, del.Kind, del.Attempt, del.Success, del.StatusCode,
+		del.LatencyMS, del.Response, del.Error, string(payload), sqlTime(del.CreatedAt))
+	if lerr != nil {
+		d.logger.Error("log webhook delivery", "webhook_id", wh.ID, "error", lerr)
+	} else {
+		del.ID, _ = res.LastInsertId()
+	}
+	return &del, err
+}
+
+// scheduleRetry arranges the next attempt after a failed event delivery,
+// or dead-letters the event once the retry policy is used up.
+func (d *Dispatcher) scheduleRetry(ctx context.Context, del *Delivery, cause error) {
+	if del.ID == 0 {
+		return // not logged, so there is nothing to retry from
+	}
+	if del.Attempt >= d.retry.MaxAttempts {
+		d.deadLetter(ctx, del, cause.Error())
+		return
+	}
+	at := time.Now().UTC().Add(d.retry.delay(del.Attempt))
+	if _, err := d.db.ExecContext(ctx,
+		`UPDATE webhook_deliveries SET next_retry_at = ? WHERE id = ?`, sqlTime(at), del.ID); err != nil {
+		d.logger.Error("schedule webhook retry", "delivery_id", del.ID, "error", err)
+	}
+}
+
+func (d *Dispatcher) deadLetter(ctx context.Context, del *Delivery, reason string) {
+	_, err := d.db.ExecContext(ctx,
+		`INSERT INTO webhook_dead_letters (webhook_id, event_id, topic, delivery_id, attempts, last_error)
+		 VALUES (?, ?, ?, ?, ?, ?)`,
+		del.WebhookID, del.EventID, del.Topic, del.ID, del.Attempt, reason)
+	if err != nil {
+		d.logger.Error("dead-letter webhook delivery", "delivery_id", del.ID, "error", err)
+		return
+	}
+	d.logger.Warn("webhook delivery dead-lettered", "webhook_id", del.WebhookID, "event_id", del.EventID,
+		"attempts", del.Attempt, "error", reason)
+}
+
+// ProcessRetries re-sends failed event deliveries whose retry is due and
+// returns how many it sent. Start runs it every few seconds.
+func (d *Dispatcher) ProcessRetries(ctx context.Context) (int, error) {
+	rows, err := d.db.QueryContext(ctx,
+		`SELECT id, webhook_id, event_id, topic, attempt, payload FROM webhook_deliveries
+		 WHERE next_retry_at IS NOT NULL AND next_retry_at <= ?
+		 ORDER BY next_retry_at, id LIMIT ?`, sqlTime(time.Now()), retryBatch)
+	if err != nil {
+		return 0, fmt.Errorf("query due retries: %w", err)
+	}
+	type due struct {
+		prev    Delivery
+		payload string
+	}
+	var batch []due
+	for rows.Next() {
+		var r due
+		if err := rows.Scan(&r.prev.ID, &r.prev.WebhookID, &r.prev.EventID, &r.prev.Topic, &r.prev.Attempt, &r.payload); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("scan retry: %w", err)
+		}
+		batch = append(batch, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, r := range batch {
+		// Claim the retry so a concurrent pass does not send it twice.
+		res, err := d.db.ExecContext(ctx,
+			`UPDATE webhook_deliveries SET next_retry_at = NULL WHERE id = ? AND next_retry_at IS NOT NULL`, r.prev.ID)
+		if err != nil {
+			return sent, fmt.Errorf("claim retry: %w", err)
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			continue
+		}
+		wh, err := d.Get(ctx, r.prev.WebhookID)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return sent, err
+		}
+		if !wh.Active {
+			d.deadLetter(ctx, &r.prev, "webhook disabled")
+			continue
+		}
+		next, err := d.deliver(ctx, wh, Delivery{
+			EventID: r.prev.EventID, Topic: r.prev.Topic, Kind: KindRetry, Attempt: r.prev.Attempt + 1,
+		}, []byte(r.payload))
+		sent++
+		if err != nil {
+			d.scheduleRetry(ctx, next, err)
+			continue
+		}
+		d.db.ExecContext(ctx,
+			`UPDATE webhooks SET last_fired = datetime('now'), fail_count = 0 WHERE id = ?`, wh.ID)
+	}
+	return sent, nil
+}
+
+// Redeliver sends the payload of a logged delivery to its webhook again,
+// whether or not the webhook is active. Success clears the event from the
+// dead-letter queue and cancels its pending retries. The returned delivery
+// records the outcome; the error is only for a missing delivery (sql.ErrNoRows)
+// or a database failure.
+func (d *Dispatcher) Redeliver(ctx context.Context, webhookID string, deliveryID int64) (*Delivery, error) {
+	var eventID int64
+	var topic, payload string
+	err := d.db.QueryRowContext(ctx,
+		`SELECT event_id, topic, payload FROM webhook_deliveries WHERE id = ? AND webhook_id = ?`,
+		deliveryID, webhookID).Scan(&eventID, &topic, &payload)
+	if err != nil {
+		return nil, err
+	}
+	wh, err := d.Get(ctx, webhookID)
+	if err != nil {
+		return nil, err
+	}
+	del, err := d.deliver(ctx, wh, Delivery{EventID: eventID, Topic: topic, Kind: KindRedeliver, Attempt: 1}, []byte(payload))
+	if err != nil || eventID == 0 {
+		return del, nil
+	}
+	if _, err := d.db.ExecContext(ctx,
+		`DELETE FROM webhook_dead_letters WHERE webhook_id = ? AND event_id = ?`, webhookID, eventID); err != nil {
+		return del, fmt.Errorf("clear dead letter: %w", err)
+	}
+	if _, err := d.db.ExecContext(ctx,
+		`UPDATE webhook_deliveries SET next_retry_at = NULL WHERE webhook_id = ? AND event_id = ?`, webhookID, eventID); err != nil {
+		return del, fmt.Errorf("cancel retries: %w", err)
+	}
+	return del, nil
+}
+
+// Deliveries returns a webhook's logged deliveries, newest first.
+func (d *Dispatcher) Deliveries(ctx context.Context, webhookID string, f DeliveryFilter) ([]Delivery, error) {
+	query := `SELECT id, webhook_id, event_id, topic, kind, attempt, success, status_code, latency_ms,
+		response, error, next_retry_at, created_at
+		FROM webhook_deliveries WHERE webhook_id = ?`
+	args := []any{webhookID}
+	if f.EventID > 0 {
+		query += ` AND event_id = ?`
+		args = append(args, f.EventID)
+	}
+	switch f.Status {
+	case "":
+	case "success":
+		query += ` AND success = 1`
+	case "failed":
+		query += ` AND success = 0`
+	case "retrying":
+		query += ` AND next_retry_at IS NOT NULL`
+	default:
+		return nil, fmt.Errorf("unknown status %q (want success, failed or retrying)", f.Status)
+	}
+	if f.Limit <= 0 {
+		f.Limit = 100
+	}
+	query += ` ORDER BY id DESC LIMIT ?`
+	args = append(args, f.Limit)
+
+	rows, err := d.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query deliveries: %w", err)
+	}
+	defer rows.Close()
+	var out []Delivery
+	for rows.Next() {
+		var del Delivery
+		var next sql.NullTime
+		if err := rows.Scan(&del.ID, &del.WebhookID, &del.EventID, &del.Topic, &del.Kind, &del.Attempt,
+			&del.Success, &del.StatusCode, &del.LatencyMS, &del.Response, &del.Error, &next, &del.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan delivery: %w", err)
+		}
+		if next.Valid {
+			del.NextRetryAt = &next.Time
+		}
+		out = append(out, del)
+	}
+	return out, rows.Err()
+}
+
+// DeadLetters returns a webhook's dead-lettered events, newest first.
+func (d *Dispatcher) DeadLetters(ctx context.Context, webhookID string) ([]DeadLetter, error) {
+	rows, err := d.db.QueryContext(ctx,
+		`SELECT id, webhook_id, event_id, topic, delivery_id, attempts, last_error, created_at
+		 FROM webhook_dead_letters WHERE webhook_id = ? ORDER BY id DESC`, webhookID)
+	if err != nil {
+		return nil, fmt.Errorf("query dead letters: %w", err)
+	}
+	defer rows.Close()
+	var out []DeadLetter
+	for rows.Next() {
+		var dl DeadLetter
+		if err := rows.Scan(&dl.ID, &dl.WebhookID, &dl.EventID, &dl.Topic, &dl.DeliveryID, &dl.Attempts,
+			&dl.LastError, &dl.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan dead letter: %w", err)
+		}
+		out = append(out, dl)
+	}
+	return out, rows.Err()
+}
+
+// PruneDeliveries removes log entries older than DeliveryRetention, except
+// those with a retry still pending.
+func (d *Dispatcher) PruneDeliveries(ctx context.Context) (int64, error) {
+	res, err := d.db.ExecContext(ctx,
+		`DELETE FROM webhook_deliveries WHERE created_at < ? AND next_retry_at IS NULL`,
+		sqlTime(time.Now().Add(-DeliveryRetention)))
+	if err != nil {
+		return 0, fmt.Errorf("prune deliveries: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// sqlTime formats t the way SQLite's datetime() does, so it compares
+// correctly with column defaults.
+func sqlTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05")
+}
@@ -4,18 +4,24 @@ import (
 	"bytes"
 	"context"
 	"crypto/hmac"
+	"crypto/rand"
 	"crypto/sha256"
 	"database/sql"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
 	"path"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/DavidRHerbert/koor/internal/events"
+	"github.com/DavidRHerbert/koor/internal/signature"
 )
 
 // Webhook represents a registered webhook.
@@ -28,6 +34,15 @@ type Webhook struct {
 	CreatedAt time.Time `json:"created_at"`
 	LastFired time.Time `json:"last_fired,omitempty"`
 	FailCount int       `json:"fail_count"`
+
+	// Transform reshapes the payload before delivery: a preset name or a
+	// Go template. See Transform.
+	Transform string `json:"transform,omitempty"`
+
+	// During a secret rotation, deliveries are signed with both the new
+	// and the previous secret until PreviousSecretUntil.
+	PreviousSecret      string     `json:"-"`
+	PreviousSecretUntil *time.Time `json:"previous_secret_until,omitempty"`
 }
 
 // Dispatcher manages webhooks and dispatches events to matching URLs.
@@ -37,8 +52,13 @@ type Dispatcher struct {
 	sub    *events.Subscriber
 	logger *slog.Logger
 	client *http.Client
+	retry  RetryPolicy
 	stop   chan struct{}
+	halt   sync.Once
 	wg     sync.WaitGroup
+
+	delivered atomic.Int64 // successful deliveries, including tests and replays
+	failed    atomic.Int64 // failed deliveries
 }
 
 // New creates a new webhook Dispatcher.
@@ -48,11 +68,13 @@ func New(db *sql.DB, bus *events.Bus, logger *slog.Logger) *Dispatcher {
 		bus:    bus,
 		logger: logger,
 		client: &http.Client{Timeout: 10 * time.Second},
+		retry:  DefaultRetryPolicy,
 		stop:   make(chan struct{}),
 	}
 }
 
-// Start subscribes to all events and dispatches to matching webhooks.
+// Start subscribes to all events and dispatches to matching webhooks, and
+// starts retrying failed deliveries.
 func (d *Dispatcher) Start() {
 	d.sub = d.bus.Subscribe("*")
 	d.wg.Add(1)
@@ -70,14 +92,33 @@ func (d *Dispatcher) Start() {
 			}
 		}
 	}()
+
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		ticker := time.NewTicker(retryInterval)
+		defer ticker.Stop()
+		lastPrune := time.Now()
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := d.ProcessRetries(context.Background()); err != nil {
+					d.logger.Error("webhook retries failed", "error", err)
+				}
+				if time.Since(lastPrune) >= time.Hour {
+					d.PruneDeliveries(context.Background())
+					lastPrune = time.Now()
+				}
+			case <-d.stop:
+				return
+			}
+		}
+	}()
 }
 
 // Stop shuts down the dispatcher.
 func (d *Dispatcher) Stop() {
-	select {
-	case d.stop <- struct{}{}:
-	default:
-	}
+	d.halt.Do(func() { close(d.stop) })
 	if d.sub != nil {
 		d.bus.Unsubscribe(d.sub)
 	}
@@ -85,12 +126,12 @@ func (d *Dispatcher) Stop() {
 }
 
 // Register adds a new webhook. Returns the created webhook.
-func (d *Dispatcher) Register(ctx context.Context, id, url string, patterns []string, secret string) (*Webhook, error) {
+func (d *Dispatcher) Register(ctx context.Context, id, url string, patterns []string, secret, transform string) (*Webhook, error) {
 	patternsJSON, _ := json.Marshal(patterns)
 	_, err := d.db.ExecContext(ctx,
-		`INSERT INTO webhooks (id, url, patterns, secret, active, created_at)
-		 VALUES (?, ?, ?, ?, 1, datetime('now'))`,
-		id, url, string(patternsJSON), secret)
+		`INSERT INTO webhooks (id, url, patterns, secret, transform, active, created_at)
+		 VALUES (?, ?, ?, ?, ?, 1, datetime('now'))`,
+		id, url, string(patternsJSON), secret, transform)
 	if err != nil {
 		return nil, fmt.Errorf("insert webhook: %w", err)
 	}
@@ -102,15 +143,19 @@ func (d *Dispatcher) Get(ctx context.Context, id string) (*Webhook, error) {
 	var w Webhook
 	var patternsStr, createdAt string
 	var lastFired sql.NullString
+	var prevUntil sql.NullTime
 	var active int
 	err := d.db.QueryRowContext(ctx,
-		`SELECT id, url, patterns, secret, active, created_at, last_fired, fail_count
+		`SELECT id, url, patterns, secret, active, created_at, last_fired, fail_count, previous_secret, previous_secret_until, transform
 		 FROM webhooks WHERE id = ?`, id).
-		Scan(&w.ID, &w.URL, &patternsStr, &w.Secret, &active, &createdAt, &lastFired, &w.FailCount)
+		Scan(&w.ID, &w.URL, &patternsStr, &w.Secret, &active, &createdAt, &lastFired, &w.FailCount, &w.PreviousSecret, &prevUntil, &w.Transform)
 	if err != nil {
 		return nil, err
 	}
 	w.Active = active == 1
+	if prevUntil.Valid {
+		w.PreviousSecretUntil = &prevUntil.Time
+	}
 	w.CreatedAt, _ = time.Parse("2006-01-02 15:04:05", createdAt)
 	if lastFired.Valid {
 		w.LastFired, _ = time.Parse("2006-01-02 15:04:05", lastFired.String)
@@ -122,7 +167,7 @@ func (d *Dispatcher) Get(ctx context.Context, id string) (*Webhook, error) {
 // List returns all webhooks.
 func (d *Dispatcher) List(ctx context.Context) ([]Webhook, error) {
 	rows, err := d.db.QueryContext(ctx,
-		`SELECT id, url, patterns, secret, active, created_at, last_fired, fail_count
+		`SELECT id, url, patterns, secret, active, created_at, last_fired, fail_count, previous_secret, previous_secret_until, transform
 		 FROM webhooks ORDER BY created_at DESC`)
 	if err != nil {
 		return nil, fmt.Errorf("query webhooks: %w", err)
@@ -134,11 +179,15 @@ func (d *Dispatcher) List(ctx context.Context) ([]Webhook, error) {
 		var w Webhook
 		var patternsStr, createdAt string
 		var lastFired sql.NullString
+		var prevUntil sql.NullTime
 		var active int
-		if err := rows.Scan(&w.ID, &w.URL, &patternsStr, &w.Secret, &active, &createdAt, &lastFired, &w.FailCount); err != nil {
+		if err := rows.Scan(&w.ID, &w.URL, &patternsStr, &w.Secret, &active, &createdAt, &lastFired, &w.FailCount, &w.PreviousSecret, &prevUntil, &w.Transform); err != nil {
 			return nil, fmt.Errorf("scan webhook: %w", err)
 		}
 		w.Active = active == 1
+		if prevUntil.Valid {
+			w.PreviousSecretUntil = &prevUntil.Time
+		}
 		w.CreatedAt, _ = time.Parse("2006-01-02 15:04:05", createdAt)
 		if lastFired.Valid {
 			w.LastFired, _ = time.Parse("2006-01-02 15:04:05", lastFired.String)
@@ -149,6 +198,50 @@ func (d *Dispatcher) List(ctx context.Context) ([]Webhook, error) {
 	return hooks, rows.Err()
 }
 
+// Update is a partial change to a webhook; nil fields are left alone.
+type Update struct {
+	URL       *string   `json:"url"`
+	Patterns  *[]string `json:"patterns"`
+	Active    *bool     `json:"active"`
+	Transform *string   `json:"transform"`
+}
+
+// Update applies a partial change to a webhook and returns the result.
+// Reactivating a webhook resets its failure count.
+func (d *Dispatcher) Update(ctx context.Context, id string, u Update) (*Webhook, error) {
+	wh, err := d.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if u.URL != nil {
+		wh.URL = *u.URL
+	}
+	if u.Patterns != nil {
+		wh.Patterns = *u.Patterns
+	}
+	if u.Active != nil {
+		if *u.Active && !wh.Active {
+			wh.FailCount = 0
+		}
+		wh.Active = *u.Active
+	}
+	if u.Transform != nil {
+		wh.Transform = *u.Transform
+	}
+	patternsJSON, _ := json.Marshal(wh.Patterns)
+	active := 0
+	if wh.Active {
+		active = 1
+	}
+	_, err = d.db.ExecContext(ctx,
+		`UPDATE webhooks SET url = ?, patterns = ?, active = ?, fail_count = ?, transform = ? WHERE id = ?`,
+		wh.URL, string(patternsJSON), active, wh.FailCount, wh.Transform, id)
+	if err != nil {
+		return nil, fmt.Errorf("update webhook: %w", err)
+	}
+	return d.Get(ctx, id)
+}
+
 // Delete removes a webhook by ID.
 func (d *Dispatcher) Delete(ctx context.Context, id string) error {
 	res, err := d.db.ExecContext(ctx, `DELETE FROM webhooks WHERE id = ?`, id)
@@ -159,9 +252,43 @@ func (d *Dispatcher) Delete(ctx context.Context, id string) error {
 	if n == 0 {
 		return sql.ErrNoRows
 	}
+	d.db.ExecContext(ctx, `DELETE FROM webhook_deliveries WHERE webhook_id = ?`, id)
+	d.db.ExecContext(ctx, `DELETE FROM webhook_dead_letters WHERE webhook_id = ?`, id)
 	return nil
 }
 
+// GenerateSecret returns a random webhook signing secret.
+func GenerateSecret() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generate secret: %w", err)
+	}
+	return "whsec_" + hex.EncodeToString(buf), nil
+}
+
+// RotateSecret replaces a webhook's secret. For the grace period the old
+// secret stays valid: deliveries carry signatures from both, so receivers
+// can switch to the new secret at their own pace.
+func (d *Dispatcher) RotateSecret(ctx context.Context, id, secret string, grace time.Duration) (*Webhook, error) {
+	wh, err := d.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	var until any
+	prev := ""
+	if grace > 0 && wh.Secret != "" {
+		prev = wh.Secret
+		until = time.Now().UTC().Add(grace)
+	}
+	_, err = d.db.ExecContext(ctx,
+		`UPDATE webhooks SET secret = ?, previous_secret = ?, previous_secret_until = ? WHERE id = ?`,
+		secret, prev, until, id)
+	if err != nil {
+		return nil, fmt.Errorf("rotate webhook secret: %w", err)
+	}
+	return d.Get(ctx, id)
+}
+
 // TestFire sends a test event payload to a specific webhook.
 func (d *Dispatcher) TestFire(ctx context.Context, id string) error {
 	wh, err := d.Get(ctx, id)
@@ -173,7 +300,26 @@ func (d *Dispatcher) TestFire(ctx context.Context, id string) error {
 		"data":   map[string]any{"webhook_id": id, "test": true},
 		"source": "koor",
 	})
-	return d.sendToWebhook(wh, testPayload)
+	_, err = d.deliver(ctx, wh, Delivery{Topic: "webhook.test", Kind: KindTest, Attempt: 1}, testPayload)
+	return err
+}
+
+// Notify delivers an event to one webhook whatever its patterns, logged
+// and retried like any delivery. A webhook whose patterns already match
+// the event gets it from the dispatcher, so it is not sent twice.
+func (d *Dispatcher) Notify(ctx context.Context, id string, ev events.Event) error {
+	wh, err := d.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if wh.Active && matchesAny(wh.Patterns, ev.Topic) {
+		return nil
+	}
+	del, err := d.deliver(ctx, wh, Delivery{EventID: ev.ID, Topic: ev.Topic, Kind: KindEvent, Attempt: 1}, eventPayload(ev))
+	if err != nil {
+		d.scheduleRetry(ctx, del, err)
+	}
+	return err
 }
 
 // dispatch sends an event to all matching active webhooks.
@@ -185,13 +331,7 @@ func (d *Dispatcher) dispatch(ev events.Event) {
 		return
 	}
 
-	payload, _ := json.Marshal(map[string]any{
-		"topic":      ev.Topic,
-		"data":       ev.Data,
-		"source":     ev.Source,
-		"event_id":   ev.ID,
-		"created_at": ev.CreatedAt,
-	})
+	payload := eventPayload(ev)
 
 	for i := range hooks {
 		wh := &hooks[i]
@@ -202,8 +342,10 @@ func (d *Dispatcher) dispatch(ev events.Event) {
 			continue
 		}
 
-		if err := d.sendToWebhook(wh, payload); err != nil {
+		del, err := d.deliver(ctx, wh, Delivery{EventID: ev.ID, Topic: ev.Topic, Kind: KindEvent, Attempt: 1}, payload)
+		if err != nil {
 			d.logger.Warn("webhook dispatch failed", "webhook_id", wh.ID, "url", wh.URL, "error", err)
+			d.scheduleRetry(ctx, del, err)
 			d.db.ExecContext(ctx,
 				`UPDATE webhooks SET fail_count = fail_count + 1 WHERE id = ?`, wh.ID)
 			// Auto-disable after 10 consecutive failures.
@@ -219,31 +361,118 @@ func (d *Dispatcher) dispatch(ev events.Event) {
 	}
 }
 
-func (d *Dispatcher) sendToWebhook(wh *Webhook, payload []byte) error {
+// MaxReplay is the most events a single Replay call will deliver.
+const MaxReplay = 1000
+
+// ReplayFailure records an event that could not be re-delivered.
+type ReplayFailure struct {
+	EventID int64  `json:"event_id"`
+	Error   string `json:"error"`
+}
+
+// ReplayResult summarises a Replay call.
+type ReplayResult struct {
+	WebhookID string          `json:"webhook_id"`
+	Delivered int             `json:"delivered"`
+	Skipped   int             `json:"skipped"` // events whose topic the webhook does not subscribe to
+	Failed    []ReplayFailure `json:"failed"`
+}
+
+// Replay re-delivers stored events with IDs from fromID to toID (inclusive)
+// to a single webhook, oldest first. Events outside the webhook's patterns
+// are skipped. Replays are sent with an X-Koor-Replay header, are logged
+// but not retried, and do not affect the webhook's fail count or active flag.
+func (d *Dispatcher) Replay(ctx context.Context, id string, fromID, toID int64) (*ReplayResult, error) {
+	wh, err := d.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	evs, err := d.bus.Range(ctx, fromID, toID, MaxReplay)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ReplayResult{WebhookID: id, Failed: []ReplayFailure{}}
+	for _, ev := range evs {
+		if !matchesAny(wh.Patterns, ev.Topic) {
+			result.Skipped++
+			continue
+		}
+		del := Delivery{EventID: ev.ID, Topic: ev.Topic, Kind: KindReplay, Attempt: 1}
+		if _, err := d.deliver(ctx, wh, del, eventPayload(ev)); err != nil {
+			result.Failed = append(result.Failed, ReplayFailure{EventID: ev.ID, Error: err.Error()})
+			continue
+		}
+		result.Delivered++
+	}
+	return result, nil
+}
+
+// eventPayload is the JSON body delivered to webhooks for an event.
+func eventPayload(ev events.Event) []byte {
+	payload, _ := json.Marshal(map[string]any{
+		"topic":      ev.Topic,
+		"data":       ev.Data,
+		"source":     ev.Source,
+		"event_id":   ev.ID,
+		"created_at": ev.CreatedAt,
+	})
+	return payload
+}
+
+// post sends one delivery and returns the receiver's status code and the
+// start of its response body. The payload goes through the webhook's
+// transform first, so the signatures cover the body as sent.
+func (d *Dispatcher) post(wh *Webhook, payload []byte, eventID int64, replay bool) (int, string, error) {
+	payload, err := Transform(wh.Transform, payload)
+	if err != nil {
+		return 0, "", err
+	}
 	req, err := http.NewRequest("POST", wh.URL, bytes.NewReader(payload))
 	if err != nil {
-		return fmt.Errorf("create request: %w", err)
+		return 0, "", fmt.Errorf("create request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("X-Koor-Event", "true")
+	if replay {
+		req.Header.Set("X-Koor-Replay", "true")
+	}
 
-	// HMAC signature if secret is set.
+	// HMAC signatures if a secret is set. X-Koor-Signature covers the body
+	// only and is kept for existing receivers; X-Koor-Signature-256 also
+	// covers the delivery timestamp and event ID so captured requests
+	// cannot be replayed later.
 	if wh.Secret != "" {
 		mac := hmac.New(sha256.New, []byte(wh.Secret))
 		mac.Write(payload)
 		sig := hex.EncodeToString(mac.Sum(nil))
 		req.Header.Set("X-Koor-Signature", sig)
+
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		id := strconv.FormatInt(eventID, 10)
+		secrets := []string{wh.Secret}
+		if wh.PreviousSecret != "" && wh.PreviousSecretUntil != nil && time.Now().Before(*wh.PreviousSecretUntil) {
+			secrets = append(secrets, wh.PreviousSecret)
+		}
+		sigs := make([]string, len(secrets))
+		for i, secret := range secrets {
+			sigs[i] = signature.Sign(secret, ts, id, payload)
+		}
+		req.Header.Set(signature.HeaderTimestamp, ts)
+		req.Header.Set(signature.HeaderEventID, id)
+		req.Header.Set(signature.HeaderSignature, strings.Join(sigs, ","))
 	}
 
 	resp, err := d.client.Do(req)
 	if err != nil {
-		return err
+		return 0, "", err
 	}
-	resp.Body.Close()
+	defer resp.Body.Close()
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, responseSnippet))
 	if resp.StatusCode >= 400 {
-		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+		return resp.StatusCode, string(snippet), fmt.Errorf("webhook returned status %d", resp.StatusCode)
 	}
-	return nil
+	return resp.StatusCode, string(snippet), nil
 }
 
 // matchesAny checks if topic matches any of the glob patterns.
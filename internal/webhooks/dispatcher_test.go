@@ -2,15 +2,21 @@ package webhooks_test
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"io"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"sync/atomic"
 	"testing"
 	"time"
+	"unicode/utf8"
 
 	"github.com/DavidRHerbert/koor/internal/db"
 	"github.com/DavidRHerbert/koor/internal/events"
@@ -40,7 +46,7 @@ func TestRegisterAndList(t *testing.T) {
 	env := setup(t)
 	ctx := context.Background()
 
-	wh, err := env.disp.Register(ctx, "wh-1", "http://example.com/hook", []string{"agent.*"}, "mysecret")
+	wh, err := env.disp.Register(ctx, "wh-1", "http://example.com/hook", []string{"agent.*"}, "mysecret", "")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -67,7 +73,7 @@ func TestDelete(t *testing.T) {
 	env := setup(t)
 	ctx := context.Background()
 
-	env.disp.Register(ctx, "wh-del", "http://example.com/hook", []string{"*"}, "")
+	env.disp.Register(ctx, "wh-del", "http://example.com/hook", []string{"*"}, "", "")
 	err := env.disp.Delete(ctx, "wh-del")
 	if err != nil {
 		t.Fatal(err)
@@ -109,7 +115,7 @@ func TestDispatchToMatchingWebhook(t *testing.T) {
 	}))
 	defer backend.Close()
 
-	env.disp.Register(ctx, "wh-match", backend.URL, []string{"agent.*"}, "")
+	env.disp.Register(ctx, "wh-match", backend.URL, []string{"agent.*"}, "", "")
 	env.disp.Start()
 	defer env.disp.Stop()
 
@@ -135,7 +141,7 @@ func TestDispatchSkipsNonMatching(t *testing.T) {
 	defer backend.Close()
 
 	// Only subscribe to compliance.* pattern.
-	env.disp.Register(ctx, "wh-nomatch", backend.URL, []string{"compliance.*"}, "")
+	env.disp.Register(ctx, "wh-nomatch", backend.URL, []string{"compliance.*"}, "", "")
 	env.disp.Start()
 	defer env.disp.Stop()
 
@@ -159,7 +165,7 @@ func TestHMACSignature(t *testing.T) {
 	}))
 	defer backend.Close()
 
-	env.disp.Register(ctx, "wh-hmac", backend.URL, []string{"*"}, "secret123")
+	env.disp.Register(ctx, "wh-hmac", backend.URL, []string{"*"}, "secret123", "")
 	env.disp.Start()
 	defer env.disp.Stop()
 
@@ -181,7 +187,7 @@ func TestFailCountIncrement(t *testing.T) {
 	}))
 	defer backend.Close()
 
-	env.disp.Register(ctx, "wh-fail", backend.URL, []string{"*"}, "")
+	env.disp.Register(ctx, "wh-fail", backend.URL, []string{"*"}, "", "")
 	env.disp.Start()
 	defer env.disp.Stop()
 
@@ -214,7 +220,7 @@ func TestTestFire(t *testing.T) {
 	}))
 	defer backend.Close()
 
-	env.disp.Register(ctx, "wh-test", backend.URL, []string{"*"}, "")
+	env.disp.Register(ctx, "wh-test", backend.URL, []string{"*"}, "", "")
 
 	err := env.disp.TestFire(ctx, "wh-test")
 	if err != nil {
@@ -234,3 +240,237 @@ func TestTestFireNotFound(t *testing.T) {
 		t.Error("expected error for nonexistent webhook")
 	}
 }
+
+func TestReplay(t *testing.T) {
+	env := setup(t)
+	ctx := context.Background()
+
+	var received []int64
+	var replayHeader atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			EventID int64 `json:"event_id"`
+		}
+		json.NewDecoder(r.Body).Decode(&payload)
+		received = append(received, payload.EventID)
+		if r.Header.Get("X-Koor-Replay") == "true" {
+			replayHeader.Add(1)
+		}
+		w.WriteHeader(200)
+	}))
+	defer backend.Close()
+
+	first, _ := env.bus.Publish(ctx, "agent.started", json.RawMessage(`{}`), "test")
+	env.bus.Publish(ctx, "build.done", json.RawMessage(`{}`), "test")
+	last, _ := env.bus.Publish(ctx, "agent.stopped", json.RawMessage(`{}`), "test")
+	env.bus.Publish(ctx, "agent.later", json.RawMessage(`{}`), "test")
+
+	env.disp.Register(ctx, "wh-replay", backend.URL, []string{"agent.*"}, "", "")
+	res, err := env.disp.Replay(ctx, "wh-replay", first.ID, last.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Delivered != 2 || res.Skipped != 1 || len(res.Failed) != 0 {
+		t.Errorf("unexpected result: %+v", res)
+	}
+	if len(received) != 2 || received[0] != first.ID || received[1] != last.ID {
+		t.Errorf("expected events %d and %d in order, got %v", first.ID, last.ID, received)
+	}
+	if replayHeader.Load() != 2 {
+		t.Errorf("expected X-Koor-Replay on every delivery, got %d", replayHeader.Load())
+	}
+
+	if _, err := env.disp.Replay(ctx, "nonexistent", first.ID, last.ID); err == nil {
+		t.Error("expected error for nonexistent webhook")
+	}
+}
+
+func TestRetryThenDeadLetter(t *testing.T) {
+	env := setup(t)
+	ctx := context.Background()
+
+	var calls atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(503)
+		w.Write([]byte("try later"))
+	}))
+	defer backend.Close()
+
+	env.disp.SetRetryPolicy(webhooks.RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond})
+	env.disp.Register(ctx, "wh-retry", backend.URL, []string{"*"}, "", "")
+	env.disp.Start()
+	defer env.disp.Stop()
+
+	ev, _ := env.bus.Publish(ctx, "build.failed", json.RawMessage(`{}`), "")
+	time.Sleep(200 * time.Millisecond)
+
+	dels, err := env.disp.Deliveries(ctx, "wh-retry", webhooks.DeliveryFilter{Status: "retrying"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dels) != 1 || dels[0].EventID != ev.ID || dels[0].StatusCode != 503 || dels[0].Response != "try later" {
+		t.Fatalf("expected one pending retry for event %d, got %+v", ev.ID, dels)
+	}
+
+	n, err := env.disp.ProcessRetries(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 || calls.Load() != 2 {
+		t.Errorf("expected 1 retry and 2 calls, got %d retries and %d calls", n, calls.Load())
+	}
+
+	dels, _ = env.disp.Deliveries(ctx, "wh-retry", webhooks.DeliveryFilter{})
+	if len(dels) != 2 || dels[0].Kind != webhooks.KindRetry || dels[0].Attempt != 2 || dels[0].NextRetryAt != nil {
+		t.Errorf("expected a final retry attempt 2 with nothing pending, got %+v", dels)
+	}
+	dls, err := env.disp.DeadLetters(ctx, "wh-retry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dls) != 1 || dls[0].EventID != ev.ID || dls[0].Attempts != 2 || dls[0].DeliveryID != dels[0].ID {
+		t.Errorf("expected event %d dead-lettered after 2 attempts, got %+v", ev.ID, dls)
+	}
+}
+
+func TestRedeliver(t *testing.T) {
+	env := setup(t)
+	ctx := context.Background()
+
+	var healthy atomic.Bool
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy.Load() {
+			w.WriteHeader(500)
+			return
+		}
+		w.WriteHeader(200)
+	}))
+	defer backend.Close()
+
+	env.disp.SetRetryPolicy(webhooks.RetryPolicy{MaxAttempts: 1})
+	env.disp.Register(ctx, "wh-redeliver", backend.URL, []string{"*"}, "", "")
+	env.disp.Start()
+	defer env.disp.Stop()
+
+	env.bus.Publish(ctx, "deploy.done", json.RawMessage(`{}`), "")
+	time.Sleep(200 * time.Millisecond)
+
+	dls, _ := env.disp.DeadLetters(ctx, "wh-redeliver")
+	if len(dls) != 1 {
+		t.Fatalf("expected 1 dead letter, got %d", len(dls))
+	}
+
+	healthy.Store(true)
+	del, err := env.disp.Redeliver(ctx, "wh-redeliver", dls[0].DeliveryID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !del.Success || del.Kind != webhooks.KindRedeliver || del.StatusCode != 200 {
+		t.Errorf("unexpected redelivery: %+v", del)
+	}
+	if dls, _ := env.disp.DeadLetters(ctx, "wh-redeliver"); len(dls) != 0 {
+		t.Errorf("expected dead letter to be cleared, got %+v", dls)
+	}
+
+	if _, err := env.disp.Redeliver(ctx, "wh-redeliver", 9999); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows for unknown delivery, got %v", err)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	env := setup(t)
+	ctx := context.Background()
+
+	env.disp.Register(ctx, "wh-up", "http://example.com/hook", []string{"*"}, "", "")
+	url, active, transform := "http://example.com/other", false, "slack"
+	wh, err := env.disp.Update(ctx, "wh-up", webhooks.Update{URL: &url, Active: &active, Transform: &transform})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wh.URL != url || wh.Active || wh.Transform != "slack" || len(wh.Patterns) != 1 {
+		t.Errorf("unexpected webhook after update: %+v", wh)
+	}
+	if _, err := env.disp.Update(ctx, "nonexistent", webhooks.Update{}); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows, got %v", err)
+	}
+}
+
+func TestTransform(t *testing.T) {
+	payload := []byte(`{"topic":"truck.agent.done","data":{"task":"wash"},"source":"koor","event_id":7}`)
+
+	for _, preset := range webhooks.PresetNames() {
+		if err := webhooks.CheckTransform(preset); err != nil {
+			t.Errorf("preset %s: %v", preset, err)
+		}
+	}
+
+	out, err := webhooks.Transform("slack", payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var slack struct {
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(out, &slack); err != nil {
+		t.Fatalf("slack output is not JSON: %s", out)
+	}
+	if !strings.Contains(slack.Text, "*truck.agent.done* (event #7)") || !strings.Contains(slack.Text, `"task": "wash"`) {
+		t.Errorf("unexpected slack text %q", slack.Text)
+	}
+
+	out, err = webhooks.Transform(`{"msg": {{json (printf "%s: %s" .topic .data.task)}}}`, payload)
+	if err != nil || string(out) != `{"msg": "truck.agent.done: wash"}` {
+		t.Errorf("custom template: %s, %v", out, err)
+	}
+	if out, _ := webhooks.Transform("", payload); string(out) != string(payload) {
+		t.Errorf("an empty transform should leave the payload alone, got %s", out)
+	}
+
+	// Truncation never splits a multi-byte character.
+	out, err = webhooks.Transform(`{"s": {{json (truncate 10 .data.task)}}}`,
+		[]byte(`{"topic":"t","data":{"task":"Waschstraße"}}`))
+	if err != nil || string(out) != `{"s": "Waschstra..."}` {
+		t.Errorf("truncate: %s, %v", out, err)
+	}
+	out, err = webhooks.Transform(`{{truncate 3 .data.task}}`, []byte(`{"topic":"t","data":{"task":"日本"}}`))
+	if err != nil || string(out) != "日..." || !utf8.Valid(out) {
+		t.Errorf("truncate inside a character: %q, %v", out, err)
+	}
+
+	if err := webhooks.CheckTransform(`{"text": {{.topic}}}`); err == nil {
+		t.Error("expected a template producing invalid JSON to be rejected")
+	}
+	if err := webhooks.CheckTransform(`{{.topic`); err == nil {
+		t.Error("expected a malformed template to be rejected")
+	}
+}
+
+func TestTransformedDelivery(t *testing.T) {
+	env := setup(t)
+	ctx := context.Background()
+
+	var body []byte
+	var sig string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		sig = r.Header.Get("X-Koor-Signature")
+		w.WriteHeader(200)
+	}))
+	defer backend.Close()
+
+	env.disp.Register(ctx, "wh-discord", backend.URL, []string{"*"}, "secret", "discord")
+	if err := env.disp.TestFire(ctx, "wh-discord"); err != nil {
+		t.Fatal(err)
+	}
+	var msg map[string]string
+	if err := json.Unmarshal(body, &msg); err != nil || !strings.HasPrefix(msg["content"], "**webhook.test**") {
+		t.Errorf("unexpected discord body %s", body)
+	}
+	// The signature covers the body as sent.
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(body)
+	if sig != hex.EncodeToString(mac.Sum(nil)) {
+		t.Error("signature does not match the transformed body")
+	}
+}
@@ -0,0 +1,139 @@
+package webhooks
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/DavidRHerbert/koor/internal/events"
+)
+
+// Presets are ready-made transforms. A webhook's transform is either one
+// of their names or a Go text/template.
+var Presets = map[string]string{
+	// A Slack incoming-webhook message.
+	"slack": `{"text": {{json (message . "*" 2900)}}}`,
+	// A Discord webhook message; Discord rejects content over 2000 characters.
+	"discord": `{"content": {{json (message . "**" 1800)}}}`,
+	// A flat object for generic JSON receivers.
+	"json": `{"title": {{json .topic}}, "text": {{json (compact .data)}}, "source": {{json .source}}, "event_id": {{json .event_id}}, "timestamp": {{json .created_at}}}`,
+}
+
+// PresetNames returns the names of the presets, sorted.
+func PresetNames() []string {
+	names := make([]string, 0, len(Presets))
+	for name := range Presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+var transformFuncs = template.FuncMap{
+	// json encodes a value as JSON, so strings come out quoted and escaped.
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	// compact renders a value as one line of JSON, or a string as it is.
+	"compact": compact,
+	// truncate cuts a string to at most n bytes, keeping whole characters.
+	"truncate": func(n int, s string) string { return truncate(s, n) },
+	// message renders an event for a chat channel: its topic in bold and
+	// its data in a code block of at most n bytes.
+	"message": func(p map[string]any, bold string, n int) string {
+		head := fmt.Sprintf("%s%v%s", bold, p["topic"], bold)
+		if id, ok := p["event_id"]; ok {
+			head += fmt.Sprintf(" (event #%v)", id)
+		}
+		data, _ := json.MarshalIndent(p["data"], "", "  ")
+		return head + "\n```\n" + truncate(string(data), n) + "\n```"
+	},
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+// parseTransform parses a transform, resolving preset names.
+func parseTransform(src string) (*template.Template, error) {
+	if preset, ok := Presets[src]; ok {
+		src = preset
+	}
+	return template.New("transform").Funcs(transformFuncs).Parse(src)
+}
+
+// CheckTransform reports whether src is a usable transform: a preset name,
+// or a template that renders a sample event as valid JSON.
+func CheckTransform(src string) error {
+	tmpl, err := parseTransform(src)
+	if err != nil {
+		return err
+	}
+	out, err := render(tmpl, eventPayload(events.Event{
+		ID: 1, Topic: "project.agent.done", Source: "koor",
+		Data:      json.RawMessage(`{"task":"sample","note":"a \"quoted\"\nline"}`),
+		CreatedAt: time.Now().UTC(),
+	}))
+	if err != nil {
+		return err
+	}
+	if !json.Valid(out) {
+		return fmt.Errorf("output is not valid JSON for a sample event: %s", truncate(string(out), 200))
+	}
+	return nil
+}
+
+// Transform renders a payload through a webhook's transform. The template
+// sees the payload's fields: .topic, .data, .source, .event_id and
+// .created_at. An empty transform leaves the payload as it is.
+func Transform(src string, payload []byte) ([]byte, error) {
+	if src == "" {
+		return payload, nil
+	}
+	tmpl, err := parseTransform(src)
+	if err != nil {
+		return nil, fmt.Errorf("transform: %w", err)
+	}
+	out, err := render(tmpl, payload)
+	if err != nil {
+		return nil, fmt.Errorf("transform: %w", err)
+	}
+	return out, nil
+}
+
+func render(tmpl *template.Template, payload []byte) ([]byte, error) {
+	var fields map[string]any
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.UseNumber()
+	if err := dec.Decode(&fields); err != nil {
+		return nil, fmt.Errorf("payload is not a JSON object: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, fields); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func compact(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	// Back up to the start of a character so the cut stays valid UTF-8.
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n] + "..."
+}
@@ -0,0 +1,346 @@
+package wizard
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Definition is a declarative project definition, read from a koor.yaml,
+// that scaffolds workspaces and pre-loads the server without prompts:
+//
+//	project: Truck-Wash
+//	description: Fleet wash booking
+//	server: http://localhost:9800
+//	parent_dir: .
+//	agents:
+//	  - {name: backend, stack: go-api, db: postgres}
+//	  - {name: frontend, stack: goth}
+//	contracts:
+//	  - {name: api, file: contracts/api.json}
+//	rules:
+//	  - {rule_id: no-console-log, match_type: regex, pattern: 'console\.log\(', message: Remove console.log}
+//	templates:
+//	  - {id: strict-api-rules, vars: {service: wash-api}}
+type Definition struct {
+	Project     string           `yaml:"project"`
+	Description string           `yaml:"description"`
+	Server      string           `yaml:"server"`
+	ParentDir   string           `yaml:"parent_dir"`
+	Agents      []AgentDef       `yaml:"agents"`
+	Contracts   []ContractDef    `yaml:"contracts"`
+	Rules       []map[string]any `yaml:"rules"`
+	Templates   []TemplateDef    `yaml:"templates"`
+}
+
+// AgentDef is one agent of a Definition.
+type AgentDef struct {
+	Name  string `yaml:"name"`
+	Stack string `yaml:"stack"`
+	DB    string `yaml:"db"` // "sqlite" (default), "postgres", "memory" — only for go-api stack
+}
+
+// ContractDef is a contract spec of a Definition, either in its own JSON
+// or YAML file (relative to the definition) or written inline.
+type ContractDef struct {
+	Name string         `yaml:"name"`
+	File string         `yaml:"file"`
+	Spec map[string]any `yaml:"spec"`
+
+	data []byte // the spec as JSON, filled in by LoadDefinition
+}
+
+// TemplateDef is a server template to apply to the project.
+type TemplateDef struct {
+	ID   string         `yaml:"id"`
+	Vars map[string]any `yaml:"vars"`
+}
+
+// dbTypes are the database backends a go-api agent may use.
+var dbTypes = []string{"sqlite", "postgres", "memory"}
+
+// LoadDefinition reads and checks a project definition file. Contract
+// files are read relative to the definition's directory.
+func LoadDefinition(path string) (*Definition, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var def Definition
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&def); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if def.Server == "" {
+		def.Server = "http://localhost:9800"
+	}
+	if def.ParentDir == "" {
+		def.ParentDir = "."
+	}
+	if err := def.check(filepath.Dir(path)); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &def, nil
+}
+
+// check validates the definition and loads its contract specs.
+func (d *Definition) check(baseDir string) error {
+	if err := ValidateProjectName(d.Project); err != nil {
+		return err
+	}
+	if len(d.Agents) == 0 {
+		return fmt.Errorf("at least one agent is required")
+	}
+	seen := map[string]bool{}
+	for i := range d.Agents {
+		a := &d.Agents[i]
+		if err := ValidateAgentName(a.Name); err != nil {
+			return fmt.Errorf("agents[%d]: %w", i, err)
+		}
+		if seen[Slug(a.Name)] {
+			return fmt.Errorf("agents[%d]: duplicate agent %q", i, a.Name)
+		}
+		seen[Slug(a.Name)] = true
+		if a.Stack == "" {
+			a.Stack = "generic"
+		}
+		if _, ok := Registry[a.Stack]; !ok {
+			return fmt.Errorf("agent %s: unknown stack %q (want one of %s)", a.Name, a.Stack, strings.Join(StackIDs(), ", "))
+		}
+		switch {
+		case a.Stack != "go-api" && a.DB != "":
+			return fmt.Errorf("agent %s: db is only used by the go-api stack", a.Name)
+		case a.Stack == "go-api" && a.DB == "":
+			a.DB = "sqlite"
+		case a.Stack == "go-api" && !slices.Contains(dbTypes, a.DB):
+			return fmt.Errorf("agent %s: unknown db %q (want one of %s)", a.Name, a.DB, strings.Join(dbTypes, ", "))
+		}
+	}
+
+	for i := range d.Contracts {
+		c := &d.Contracts[i]
+		if c.Name == "" {
+			return fmt.Errorf("contracts[%d]: name is required", i)
+		}
+		if (c.File == "") == (c.Spec == nil) {
+			return fmt.Errorf("contract %s: set exactly one of file and spec", c.Name)
+		}
+		spec := c.Spec
+		if c.File != "" {
+			path := c.File
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(baseDir, path)
+			}
+			raw, err := os.ReadFile(path)
+			if err != nil {
+				return fmt.Errorf("contract %s: %w", c.Name, err)
+			}
+			// YAML is a superset of JSON, so this reads either.
+			if err := yaml.Unmarshal(raw, &spec); err != nil {
+				return fmt.Errorf("contract %s: parse %s: %w", c.Name, c.File, err)
+			}
+		}
+		data, err := json.Marshal(jsonValue(spec))
+		if err != nil {
+			return fmt.Errorf("contract %s: %w", c.Name, err)
+		}
+		c.data = data
+	}
+
+	for i, r := range d.Rules {
+		jsonValue(r)
+		if id, _ := r["rule_id"].(string); id == "" {
+			return fmt.Errorf("rules[%d]: rule_id is required", i)
+		}
+		if p, ok := r["project"]; ok && p != d.Project {
+			return fmt.Errorf("rules[%d]: project must be omitted or %q", i, d.Project)
+		}
+	}
+	for i, t := range d.Templates {
+		if t.ID == "" {
+			return fmt.Errorf("templates[%d]: id is required", i)
+		}
+		jsonValue(t.Vars)
+	}
+	return nil
+}
+
+// jsonValue converts the maps YAML decodes with non-string keys, such as
+// a contract's "responses: {404: ...}", into JSON objects.
+func jsonValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			v[k] = jsonValue(e)
+		}
+		return v
+	case map[any]any:
+		m := make(map[string]any, len(v))
+		for k, e := range v {
+			m[fmt.Sprint(k)] = jsonValue(e)
+		}
+		return m
+	case []any:
+		for i, e := range v {
+			v[i] = jsonValue(e)
+		}
+		return v
+	}
+	return v
+}
+
+// ProjectConfig returns the scaffold configuration for the definition.
+func (d *Definition) ProjectConfig(cliPath string, templates Templates) ProjectConfig {
+	agents := make([]AgentInfo, len(d.Agents))
+	for i, a := range d.Agents {
+		agents[i] = AgentInfo{Name: a.Name, Stack: a.Stack, DBType: a.DB}
+	}
+	return ProjectConfig{
+		ProjectName: d.Project,
+		ServerURL:   d.Server,
+		ParentDir:   d.ParentDir,
+		Agents:      agents,
+		CLIPath:     cliPath,
+		Templates:   templates,
+	}
+}
+
+// PreloadResult counts what Preload stored on the server.
+type PreloadResult struct {
+	Registered bool     `json:"registered"` // the project was registered by this run
+	Contracts  []string `json:"contracts"`
+	Rules      int      `json:"rules"`
+	Templates  []string `json:"templates"`
+}
+
+// Preload loads the definition into a Koor server: it registers the
+// project if the server keeps a project registry and it is not registered
+// yet, stores the contracts as specs, imports the rules (accepted) and
+// applies the templates. Each step is an upsert, so running it again
+// brings the server up to date with the file. token may be empty.
+func Preload(ctx context.Context, d *Definition, serverURL, token string) (*PreloadResult, error) {
+	call := func(method, path string, body []byte) (int, []byte, error) {
+		req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(serverURL, "/")+path, bytes.NewReader(body))
+		if err != nil {
+			return 0, nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return 0, nil, err
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, data, nil
+	}
+	expect := func(what, method, path string, body []byte) error {
+		code, data, err := call(method, path, body)
+		if err != nil {
+			return fmt.Errorf("%s: %w", what, err)
+		}
+		if code != http.StatusOK {
+			return fmt.Errorf("%s: server returned %d: %s", what, code, strings.TrimSpace(string(data)))
+		}
+		return nil
+	}
+
+	project := url.PathEscape(d.Project)
+	res := &PreloadResult{Contracts: []string{}, Templates: []string{}}
+
+	// The registry is optional: 503 means the server does not keep one.
+	code, _, err := call("GET", "/api/projects/"+project, nil)
+	if err != nil {
+		return nil, fmt.Errorf("connect to %s: %w", serverURL, err)
+	}
+	if code == http.StatusNotFound {
+		body, _ := json.Marshal(map[string]string{"name": d.Project, "description": d.Description})
+		if err := expect("register project", "POST", "/api/projects", body); err != nil {
+			return res, err
+		}
+		res.Registered = true
+	}
+
+	for _, c := range d.Contracts {
+		if err := expect("contract "+c.Name, "PUT", "/api/specs/"+project+"/"+url.PathEscape(c.Name), c.data); err != nil {
+			return res, err
+		}
+		res.Contracts = append(res.Contracts, c.Name)
+	}
+
+	if len(d.Rules) > 0 {
+		rules := make([]map[string]any, len(d.Rules))
+		for i, r := range d.Rules {
+			rule := make(map[string]any, len(r)+1)
+			for k, v := range r {
+				rule[k] = v
+			}
+			rule["project"] = d.Project
+			rules[i] = rule
+		}
+		body, err := json.Marshal(rules)
+		if err != nil {
+			return res, fmt.Errorf("rules: %w", err)
+		}
+		if err := expect("import rules", "POST", "/api/rules/import", body); err != nil {
+			return res, err
+		}
+		res.Rules = len(rules)
+	}
+
+	for _, t := range d.Templates {
+		body, err := json.Marshal(map[string]any{"project": d.Project, "vars": t.Vars})
+		if err != nil {
+			return res, fmt.Errorf("template %s: %w", t.ID, err)
+		}
+		if err := expect("template "+t.ID, "POST", "/api/templates/"+url.PathEscape(t.ID)+"/apply", body); err != nil {
+			return res, err
+		}
+		res.Templates = append(res.Templates, t.ID)
+	}
+	return res, nil
+}
+
+// RunFromFile is the non-interactive wizard: it scaffolds the workspaces of
+// the project definition at path and pre-loads the server named in it.
+func RunFromFile(path string, opts Options) error {
+	def, err := LoadDefinition(path)
+	if err != nil {
+		return err
+	}
+	cfg := def.ProjectConfig(FindCLI(), opts.Templates)
+	if err := ScaffoldProject(cfg); err != nil {
+		return fmt.Errorf("scaffold failed: %w", err)
+	}
+	printNewProjectSuccess(cfg)
+	if opts.NoPreload {
+		return nil
+	}
+
+	res, err := Preload(context.Background(), def, def.Server, opts.Token)
+	if err != nil {
+		return fmt.Errorf("preload %s: %w", def.Server, err)
+	}
+	fmt.Printf("\nServer %s pre-loaded:\n", def.Server)
+	if res.Registered {
+		fmt.Printf("  Project:   %s registered\n", def.Project)
+	}
+	fmt.Printf("  Contracts: %d %s\n", len(res.Contracts), strings.Join(res.Contracts, ", "))
+	fmt.Printf("  Rules:     %d\n", res.Rules)
+	fmt.Printf("  Templates: %d %s\n", len(res.Templates), strings.Join(res.Templates, ", "))
+	return nil
+}
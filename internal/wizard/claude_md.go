@@ -1,40 +1,38 @@
 package wizard
 
-import (
-	"bytes"
-	"strings"
-	"text/template"
-)
+import "strings"
 
-// controllerData is passed to the controller CLAUDE.md template.
+// controllerData is passed to the controller CLAUDE.md template. Its fields
+// are the variables available to a controller template override.
 type controllerData struct {
-	ProjectName string
-	ProjectSlug string
-	ServerURL   string
-	TopicPrefix string
-	Agents      []agentSummary
+	ProjectName string         // e.g. "Truck-Wash"
+	ProjectSlug string         // e.g. "truck-wash"
+	ServerURL   string         // Koor server URL
+	TopicPrefix string         // event topic prefix, the project slug
+	Agents      []agentSummary // every agent of the project
 }
 
 type agentSummary struct {
 	Name         string
-	Stack        string
+	Stack        string // stack display name, e.g. "Go REST API"
 	WorkspaceDir string
 }
 
-// agentData is passed to the agent CLAUDE.md template.
+// agentData is passed to the agent CLAUDE.md template. Its fields are the
+// variables available to an agent template override.
 type agentData struct {
 	ProjectName      string
 	ProjectSlug      string
-	AgentName        string
+	AgentName        string // e.g. "backend"
 	AgentSlug        string
-	Stack            string
+	Stack            string // stack ID, e.g. "go-api"
 	StackDisplayName string
 	DBType           string // "sqlite", "postgres", "memory" — only for go-api stack
 	ServerURL        string
 	TopicPrefix      string
 	WorkspaceDir     string
-	Instructions     []string
-	BuildCmd         string
+	Instructions     []string // stack-specific instructions
+	BuildCmd         string   // empty if the stack has none
 	TestCmd          string
 	DevCmd           string
 }
@@ -44,46 +42,22 @@ func Slug(name string) string {
 	return strings.ToLower(strings.ReplaceAll(name, " ", "-"))
 }
 
-// RenderControllerCLAUDEMD renders the Controller's CLAUDE.md.
+// RenderControllerCLAUDEMD renders the Controller's CLAUDE.md from the
+// built-in template.
 func RenderControllerCLAUDEMD(data controllerData) (string, error) {
-	tmpl, err := template.New("controller").Parse(controllerTemplate)
-	if err != nil {
-		return "", err
-	}
-	var buf bytes.Buffer
-	if err := tmpl.Execute(&buf, data); err != nil {
-		return "", err
-	}
-	return buf.String(), nil
+	return Templates{}.RenderController(data)
 }
 
-// RenderAgentCLAUDEMD renders an agent's CLAUDE.md.
+// RenderAgentCLAUDEMD renders an agent's CLAUDE.md from the built-in
+// template.
 func RenderAgentCLAUDEMD(data agentData) (string, error) {
-	tmpl, err := template.New("agent").Parse(agentTemplate)
-	if err != nil {
-		return "", err
-	}
-	var buf bytes.Buffer
-	if err := tmpl.Execute(&buf, data); err != nil {
-		return "", err
-	}
-	return buf.String(), nil
+	return Templates{}.RenderAgent(data)
 }
 
-// RenderOverviewMD renders the plan/overview.md placeholder.
+// RenderOverviewMD renders the plan/overview.md placeholder from the
+// built-in template.
 func RenderOverviewMD(projectName string, agents []agentSummary) (string, error) {
-	tmpl, err := template.New("overview").Parse(overviewTemplate)
-	if err != nil {
-		return "", err
-	}
-	var buf bytes.Buffer
-	if err := tmpl.Execute(&buf, struct {
-		ProjectName string
-		Agents      []agentSummary
-	}{projectName, agents}); err != nil {
-		return "", err
-	}
-	return buf.String(), nil
+	return Templates{}.RenderOverview(projectName, agents)
 }
 
 const controllerTemplate = `# {{.ProjectName}} Controller
@@ -118,14 +92,14 @@ When assigning work to an agent:
 
 ### Checking Requests
 When the user says "check requests":
-1. Read events: ` + "`./koor-cli events history --last 20 --topic \"{{.TopicPrefix}}.*.request\"`" + `
+1. List pending work: ` + "`./koor-cli projects pending {{.ProjectName}}`" + ` (unanswered requests, stale agents, unclaimed tasks, rule proposals)
 2. Evaluate each request against plan/overview.md
 3. Ask the user: "Agent X wants Y. Approve? yes/no"
 4. If approved:
    - Update the plan if needed
    - Log decision in plan/decisions/
    - Write updated task to Koor state for the target agent
-   - Publish approval event: ` + "`./koor-cli events publish {{.TopicPrefix}}.controller.approved --data '{...}'`" + `
+   - Publish approval event: ` + "`./koor-cli events publish {{.TopicPrefix}}.controller.approved --data '{\"request_id\":<id>,...}'`" + `
    - Tell user: "Approved. Go to [agent] and say 'next'."
 
 ### Giving Status
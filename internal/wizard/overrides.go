@@ -0,0 +1,155 @@
+package wizard
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// Names of the instruction templates. An override for one is a file named
+// "<name>.md.tmpl", or "<name>.<lang>.md.tmpl" for a language variant, in
+// the templates directory.
+const (
+	TemplateController = "controller"
+	TemplateAgent      = "agent"
+	TemplateOverview   = "overview"
+)
+
+var builtinTemplates = map[string]string{
+	TemplateController: controllerTemplate,
+	TemplateAgent:      agentTemplate,
+	TemplateOverview:   overviewTemplate,
+}
+
+// Templates selects the instruction templates used to scaffold workspaces.
+// The zero value uses the built-in English templates.
+type Templates struct {
+	Dir  string // directory of override files; "" for none
+	Lang string // language variant to prefer, e.g. "de"; "" for the default
+}
+
+// DefaultTemplateDir returns the user templates directory: $KOOR_TEMPLATES
+// if set, else koor/templates under the user config directory if it exists,
+// else "".
+func DefaultTemplateDir() string {
+	if dir := os.Getenv("KOOR_TEMPLATES"); dir != "" {
+		return dir
+	}
+	cfg, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	dir := filepath.Join(cfg, "koor", "templates")
+	if info, err := os.Stat(dir); err == nil && info.IsDir() {
+		return dir
+	}
+	return ""
+}
+
+// LangFromEnv returns the language of the user's locale from $KOOR_LANG or
+// $LANG, e.g. "de" for "de_DE.UTF-8", or "" for the C/POSIX locale.
+func LangFromEnv() string {
+	lang := os.Getenv("KOOR_LANG")
+	if lang == "" {
+		lang = os.Getenv("LANG")
+	}
+	lang, _, _ = strings.Cut(lang, ".")
+	lang, _, _ = strings.Cut(lang, "_")
+	if lang == "C" || lang == "POSIX" {
+		return ""
+	}
+	return strings.ToLower(lang)
+}
+
+// Source returns the text of the named template and where it came from:
+// the language variant in Dir, the plain override in Dir, or "builtin".
+func (t Templates) Source(name string) (text, origin string, err error) {
+	builtin, ok := builtinTemplates[name]
+	if !ok {
+		return "", "", fmt.Errorf("unknown template %q", name)
+	}
+	if t.Dir != "" {
+		var files []string
+		if t.Lang != "" {
+			files = append(files, name+"."+t.Lang+".md.tmpl")
+		}
+		for _, file := range append(files, name+".md.tmpl") {
+			path := filepath.Join(t.Dir, file)
+			data, err := os.ReadFile(path)
+			if err == nil {
+				return string(data), path, nil
+			}
+			if !errors.Is(err, fs.ErrNotExist) {
+				return "", "", err
+			}
+		}
+	}
+	return builtin, "builtin", nil
+}
+
+func (t Templates) render(name string, data any) (string, error) {
+	text, origin, err := t.Source(name)
+	if err != nil {
+		return "", err
+	}
+	tmpl, err := template.New(name).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("template %s: %w", origin, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("template %s: %w", origin, err)
+	}
+	return buf.String(), nil
+}
+
+// RenderController renders the Controller's CLAUDE.md.
+func (t Templates) RenderController(data controllerData) (string, error) {
+	return t.render(TemplateController, data)
+}
+
+// RenderAgent renders an agent's CLAUDE.md.
+func (t Templates) RenderAgent(data agentData) (string, error) {
+	return t.render(TemplateAgent, data)
+}
+
+// RenderOverview renders the plan/overview.md placeholder.
+func (t Templates) RenderOverview(projectName string, agents []agentSummary) (string, error) {
+	return t.render(TemplateOverview, struct {
+		ProjectName string
+		Agents      []agentSummary
+	}{projectName, agents})
+}
+
+// ExportTemplates writes the built-in templates into dir as a starting point
+// for overrides. Existing files are left alone. Returns the paths written.
+func ExportTemplates(dir string) ([]string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("mkdir %s: %w", dir, err)
+	}
+	var written []string
+	for _, name := range []string{TemplateController, TemplateAgent, TemplateOverview} {
+		path := filepath.Join(dir, name+".md.tmpl")
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0o644)
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return written, fmt.Errorf("create %s: %w", path, err)
+		}
+		_, err = f.WriteString(builtinTemplates[name])
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return written, fmt.Errorf("write %s: %w", path, err)
+		}
+		written = append(written, path)
+	}
+	return written, nil
+}
@@ -16,7 +16,8 @@ type ProjectConfig struct {
 	ServerURL   string
 	ParentDir   string
 	Agents      []AgentInfo
-	CLIPath     string // path to koor-cli binary (empty = skip copy)
+	CLIPath     string    // path to koor-cli binary (empty = skip copy)
+	Templates   Templates // instruction template overrides (zero = built-in)
 }
 
 // AgentConfig holds data needed to scaffold a single agent.
@@ -27,7 +28,8 @@ type AgentConfig struct {
 	DBType       string // "sqlite", "postgres", "memory" — only for go-api stack
 	ServerURL    string
 	WorkspaceDir string
-	CLIPath      string // path to koor-cli binary (empty = skip copy)
+	CLIPath      string    // path to koor-cli binary (empty = skip copy)
+	Templates    Templates // instruction template overrides (zero = built-in)
 }
 
 // AgentInfo is the per-agent data collected during the wizard.
@@ -71,6 +73,7 @@ func ScaffoldProject(cfg ProjectConfig) error {
 			ServerURL:    cfg.ServerURL,
 			WorkspaceDir: agentDir,
 			CLIPath:      cfg.CLIPath,
+			Templates:    cfg.Templates,
 		}
 		if err := ScaffoldAgent(agentCfg); err != nil {
 			return fmt.Errorf("agent %s: %w", a.Name, err)
@@ -111,7 +114,7 @@ func scaffoldController(dir string, cfg ProjectConfig, agents []agentSummary) er
 
 	// Render instructions content (shared between CLAUDE.md and .cursorrules).
 	slug := Slug(cfg.ProjectName)
-	claudeContent, err := RenderControllerCLAUDEMD(controllerData{
+	claudeContent, err := cfg.Templates.RenderController(controllerData{
 		ProjectName: cfg.ProjectName,
 		ProjectSlug: slug,
 		ServerURL:   cfg.ServerURL,
@@ -131,7 +134,7 @@ func scaffoldController(dir string, cfg ProjectConfig, agents []agentSummary) er
 	}
 
 	// Write plan/overview.md.
-	overviewContent, err := RenderOverviewMD(cfg.ProjectName, agents)
+	overviewContent, err := cfg.Templates.RenderOverview(cfg.ProjectName, agents)
 	if err != nil {
 		return fmt.Errorf("render overview.md: %w", err)
 	}
@@ -191,7 +194,7 @@ func ScaffoldAgent(cfg AgentConfig) error {
 	agentSlug := Slug(cfg.AgentName)
 
 	// Render instructions content (shared between CLAUDE.md and .cursorrules).
-	claudeContent, err := RenderAgentCLAUDEMD(agentData{
+	claudeContent, err := cfg.Templates.RenderAgent(agentData{
 		ProjectName:      cfg.ProjectName,
 		ProjectSlug:      slug,
 		AgentName:        cfg.AgentName,
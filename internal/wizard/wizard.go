@@ -11,6 +11,9 @@ import (
 // Options configures the wizard behavior.
 type Options struct {
 	Accessible bool
+	Templates  Templates // instruction template overrides for generated workspaces
+	Token      string    // bearer token for pre-loading the server (RunFromFile)
+	NoPreload  bool      // RunFromFile only scaffolds the workspaces
 }
 
 // Run runs the unified wizard flow.
@@ -171,6 +174,7 @@ func runNewProject(opts Options) error {
 		ParentDir:   parentDir,
 		Agents:      agents,
 		CLIPath:     cliPath,
+		Templates:   opts.Templates,
 	}
 	if err := ScaffoldProject(cfg); err != nil {
 		return fmt.Errorf("scaffold failed: %w", err)
@@ -280,6 +284,7 @@ func runAddAgent(opts Options) error {
 		ServerURL:    serverURL,
 		WorkspaceDir: workspaceDir,
 		CLIPath:      cliPath,
+		Templates:    opts.Templates,
 	}
 	if err := ScaffoldAgent(cfg); err != nil {
 		return fmt.Errorf("scaffold failed: %w", err)
@@ -1,11 +1,15 @@
 package wizard
 
 import (
+	"context"
 	"encoding/json"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+
+	"github.com/DavidRHerbert/koor/internal/templates"
+	"github.com/DavidRHerbert/koor/pkg/koortest"
 )
 
 func TestRegistryHasAllStacks(t *testing.T) {
@@ -647,3 +651,187 @@ func TestOverviewMD(t *testing.T) {
 		}
 	}
 }
+
+func TestTemplateOverrides(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "agent.md.tmpl"), []byte("# {{.AgentName}} agent for {{.ProjectName}}\n"), 0o644)
+	os.WriteFile(filepath.Join(dir, "agent.de.md.tmpl"), []byte("# Agent {{.AgentName}} für {{.ProjectName}}\n"), 0o644)
+
+	data := agentData{ProjectName: "Truck-Wash", AgentName: "backend"}
+	cases := []struct {
+		tmpl Templates
+		want string
+	}{
+		{Templates{Dir: dir}, "# backend agent for Truck-Wash\n"},
+		{Templates{Dir: dir, Lang: "de"}, "# Agent backend für Truck-Wash\n"},
+		{Templates{Dir: dir, Lang: "fr"}, "# backend agent for Truck-Wash\n"}, // no fr variant
+	}
+	for _, c := range cases {
+		got, err := c.tmpl.RenderAgent(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != c.want {
+			t.Errorf("lang %q: got %q, want %q", c.tmpl.Lang, got, c.want)
+		}
+	}
+
+	// Templates without an override fall back to the built-in.
+	content, err := Templates{Dir: dir, Lang: "de"}.RenderController(controllerData{ProjectName: "Truck-Wash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(content, "Truck-Wash Controller") {
+		t.Error("controller without an override should use the built-in template")
+	}
+
+	os.WriteFile(filepath.Join(dir, "overview.md.tmpl"), []byte("{{.Unknown}}"), 0o644)
+	if _, err := (Templates{Dir: dir}).RenderOverview("Truck-Wash", nil); err == nil || !strings.Contains(err.Error(), "overview.md.tmpl") {
+		t.Errorf("expected an error naming the override file, got %v", err)
+	}
+}
+
+func TestScaffoldAgentWithTemplates(t *testing.T) {
+	dir := t.TempDir()
+	tmplDir := filepath.Join(dir, "templates")
+	written, err := ExportTemplates(tmplDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(written) != 3 {
+		t.Fatalf("expected 3 exported templates, got %v", written)
+	}
+	os.WriteFile(filepath.Join(tmplDir, "agent.md.tmpl"), []byte("custom {{.TopicPrefix}}.{{.AgentSlug}}.done\n"), 0o644)
+	if written, _ := ExportTemplates(tmplDir); len(written) != 0 {
+		t.Errorf("export should not overwrite existing files, wrote %v", written)
+	}
+
+	agentDir := filepath.Join(dir, "my-project-api")
+	err = ScaffoldAgent(AgentConfig{
+		ProjectName:  "My-Project",
+		AgentName:    "api",
+		Stack:        "go-api",
+		ServerURL:    "http://localhost:9800",
+		WorkspaceDir: agentDir,
+		Templates:    Templates{Dir: tmplDir},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{"CLAUDE.md", ".cursorrules"} {
+		data, _ := os.ReadFile(filepath.Join(agentDir, f))
+		if string(data) != "custom my-project.api.done\n" {
+			t.Errorf("%s: expected the override, got %q", f, data)
+		}
+	}
+}
+
+func TestLangFromEnv(t *testing.T) {
+	cases := map[string]string{"de_DE.UTF-8": "de", "fr": "fr", "C.UTF-8": "", "POSIX": "", "": ""}
+	t.Setenv("KOOR_LANG", "")
+	for env, want := range cases {
+		t.Setenv("LANG", env)
+		if got := LangFromEnv(); got != want {
+			t.Errorf("LANG=%q: got %q, want %q", env, got, want)
+		}
+	}
+	t.Setenv("KOOR_LANG", "es")
+	if got := LangFromEnv(); got != "es" {
+		t.Errorf("KOOR_LANG should win, got %q", got)
+	}
+}
+
+func TestLoadDefinition(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "contracts"), 0o755)
+	os.WriteFile(filepath.Join(dir, "contracts", "api.yaml"), []byte("kind: contract\nendpoints:\n  GET /api/trucks/{id}:\n    responses:\n      404: {error: {type: string}}\n"), 0o644)
+	path := filepath.Join(dir, "koor.yaml")
+	os.WriteFile(path, []byte(`
+project: Truck-Wash
+agents:
+  - {name: backend, stack: go-api}
+  - {name: frontend, stack: goth}
+  - {name: docs}
+contracts:
+  - {name: api, file: contracts/api.yaml}
+rules:
+  - {rule_id: no-console-log, match_type: regex, pattern: 'console\.log\('}
+`), 0o644)
+
+	def, err := LoadDefinition(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if def.Server != "http://localhost:9800" || def.ParentDir != "." {
+		t.Errorf("defaults: server %q, parent_dir %q", def.Server, def.ParentDir)
+	}
+	if def.Agents[0].DB != "sqlite" || def.Agents[2].Stack != "generic" {
+		t.Errorf("agent defaults: %+v", def.Agents)
+	}
+	if got := string(def.Contracts[0].data); !strings.Contains(got, `"404":{"error":{"type":"string"}}`) {
+		t.Errorf("contract file should convert to JSON with string keys, got %s", got)
+	}
+	cfg := def.ProjectConfig("", Templates{})
+	if len(cfg.Agents) != 3 || cfg.Agents[0].DBType != "sqlite" || cfg.ProjectName != "Truck-Wash" {
+		t.Errorf("project config: %+v", cfg)
+	}
+
+	bad := map[string]string{
+		"unknown key":   "project: TW\nagent: []\n",
+		"no agents":     "project: TW\n",
+		"unknown stack": "project: TW\nagents: [{name: a, stack: cobol}]\n",
+		"db on goth":    "project: TW\nagents: [{name: a, stack: goth, db: postgres}]\n",
+		"unknown db":    "project: TW\nagents: [{name: a, stack: go-api, db: oracle}]\n",
+		"duplicate":     "project: TW\nagents: [{name: a}, {name: A}]\n",
+		"file and spec": "project: TW\nagents: [{name: a}]\ncontracts: [{name: c}]\n",
+		"missing file":  "project: TW\nagents: [{name: a}]\ncontracts: [{name: c, file: nope.json}]\n",
+		"rule id":       "project: TW\nagents: [{name: a}]\nrules: [{pattern: x}]\n",
+		"rule project":  "project: TW\nagents: [{name: a}]\nrules: [{rule_id: r, project: other}]\n",
+	}
+	for name, yml := range bad {
+		os.WriteFile(path, []byte(yml), 0o644)
+		if _, err := LoadDefinition(path); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestPreload(t *testing.T) {
+	env := koortest.New(t)
+	ctx := context.Background()
+	env.Templates.Create(ctx, "todo-rule", "TODO rule", "", "rules",
+		[]byte(`[{"rule_id":"no-todo-{{service}}","match_type":"regex","pattern":"TODO"}]`), nil,
+		[]templates.Param{{Name: "service"}})
+
+	def := &Definition{
+		Project:   "TW",
+		Agents:    []AgentDef{{Name: "backend", Stack: "go-api", DB: "sqlite"}},
+		Contracts: []ContractDef{{Name: "api", data: []byte(`{"kind":"contract","endpoints":{}}`)}},
+		Rules:     []map[string]any{{"rule_id": "no-console-log", "match_type": "regex", "pattern": `console\.log\(`}},
+		Templates: []TemplateDef{{ID: "todo-rule", Vars: map[string]any{"service": "wash"}}},
+	}
+	res, err := Preload(ctx, def, env.URL, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Contracts) != 1 || res.Rules != 1 || len(res.Templates) != 1 {
+		t.Errorf("unexpected result: %+v", res)
+	}
+	if _, err := env.Specs.Get(ctx, "TW", "api"); err != nil {
+		t.Errorf("contract not stored: %v", err)
+	}
+	for _, id := range []string{"no-console-log", "no-todo-wash"} {
+		if rule, err := env.Specs.GetRule(ctx, "TW", id); err != nil || rule.Status != "accepted" {
+			t.Errorf("rule %s not imported as accepted: %+v %v", id, rule, err)
+		}
+	}
+
+	// Re-running brings the server up to date instead of failing.
+	if _, err := Preload(ctx, def, env.URL, ""); err != nil {
+		t.Errorf("second preload: %v", err)
+	}
+	def.Templates = []TemplateDef{{ID: "missing"}}
+	if _, err := Preload(ctx, def, env.URL, ""); err == nil || !strings.Contains(err.Error(), "template missing") {
+		t.Errorf("expected template error, got %v", err)
+	}
+}
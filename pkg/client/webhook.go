@@ -0,0 +1,106 @@
+// Package client holds helpers for programs that integrate with a Koor
+// server from the outside, such as services receiving its webhooks.
+package client
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DavidRHerbert/koor/internal/signature"
+)
+
+// DefaultTolerance is how far a webhook's X-Koor-Timestamp may be from the
+// receiver's clock before VerifyWebhook rejects it as a possible replay.
+const DefaultTolerance = 5 * time.Minute
+
+// maxWebhookBody caps the body WebhookHandler reads.
+const maxWebhookBody = 10 << 20 // 10 MB
+
+var (
+	// ErrMissingSignature means the request has no X-Koor-Signature-256,
+	// X-Koor-Timestamp or X-Koor-Event-Id header.
+	ErrMissingSignature = errors.New("missing koor webhook signature headers")
+	// ErrStaleTimestamp means the delivery is older (or newer) than the tolerance.
+	ErrStaleTimestamp = errors.New("koor webhook timestamp outside tolerance")
+	// ErrInvalidSignature means no signature matched the secret.
+	ErrInvalidSignature = errors.New("invalid koor webhook signature")
+)
+
+// VerifyWebhook checks a webhook delivery from Koor against secret.
+// header and body must be the request's headers and raw, unparsed body.
+//
+// Koor signs "{X-Koor-Timestamp}.{X-Koor-Event-Id}.{body}" with HMAC-SHA256
+// and sends it as X-Koor-Signature-256: sha256=<hex>. While a secret is
+// being rotated the header carries one comma-separated signature per
+// valid secret, and any match is accepted. A tolerance of 0 uses
+// DefaultTolerance.
+//
+//	func handle(w http.ResponseWriter, r *http.Request) {
+//		body, _ := io.ReadAll(r.Body)
+//		if err := client.VerifyWebhook(secret, r.Header, body, 0); err != nil {
+//			http.Error(w, err.Error(), http.StatusUnauthorized)
+//			return
+//		}
+//		// ... handle the event ...
+//	}
+func VerifyWebhook(secret string, header http.Header, body []byte, tolerance time.Duration) error {
+	sigHeader := header.Get(signature.HeaderSignature)
+	ts := header.Get(signature.HeaderTimestamp)
+	eventID := header.Get(signature.HeaderEventID)
+	if sigHeader == "" || ts == "" || eventID == "" {
+		return ErrMissingSignature
+	}
+	if tolerance <= 0 {
+		tolerance = DefaultTolerance
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return ErrStaleTimestamp
+	}
+	if age := time.Since(time.Unix(unix, 0)); age > tolerance || age < -tolerance {
+		return ErrStaleTimestamp
+	}
+
+	expected := []byte(SignWebhook(secret, ts, eventID, body))
+	for _, sig := range strings.Split(sigHeader, ",") {
+		if hmac.Equal([]byte(strings.TrimSpace(sig)), expected) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+// SignWebhook returns the X-Koor-Signature-256 value for a delivery:
+// "sha256=" followed by the hex HMAC-SHA256 of "{timestamp}.{eventID}.{body}"
+// under secret. Koor signs its deliveries with it; tests can use it to
+// build deliveries for a receiver.
+func SignWebhook(secret, timestamp, eventID string, body []byte) string {
+	return signature.Sign(secret, timestamp, eventID, body)
+}
+
+// WebhookHandler wraps a webhook receiver so it only sees deliveries that
+// pass VerifyWebhook. Others are answered with 401. The body is read once
+// and handed on to next unchanged.
+//
+//	http.Handle("/koor", client.WebhookHandler(secret, 0, http.HandlerFunc(handle)))
+func WebhookHandler(secret string, tolerance time.Duration, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBody))
+		if err != nil {
+			http.Error(w, "read body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := VerifyWebhook(secret, r.Header, body, tolerance); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,97 @@
+package client_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DavidRHerbert/koor/pkg/client"
+	"github.com/DavidRHerbert/koor/pkg/koortest"
+)
+
+func TestVerifyWebhook(t *testing.T) {
+	env := koortest.New(t)
+	ctx := context.Background()
+
+	results := make(chan [2]error, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		results <- [2]error{
+			client.VerifyWebhook("new-secret", r.Header, body, 0),
+			client.VerifyWebhook("old-secret", r.Header, body, 0),
+		}
+	}))
+	defer receiver.Close()
+
+	env.Webhooks.Register(ctx, "wh", receiver.URL, []string{"*"}, "old-secret", "")
+	if _, err := env.Webhooks.RotateSecret(ctx, "wh", "new-secret", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.Webhooks.TestFire(ctx, "wh"); err != nil {
+		t.Fatal(err)
+	}
+	got := <-results
+	if got[0] != nil || got[1] != nil {
+		t.Fatalf("both secrets should verify during the grace window: %v", got)
+	}
+
+	// Without a grace window only the new secret is valid.
+	env.Webhooks.RotateSecret(ctx, "wh", "newer-secret", 0)
+	env.Webhooks.TestFire(ctx, "wh")
+	got = <-results
+	if got[0] != client.ErrInvalidSignature || got[1] != client.ErrInvalidSignature {
+		t.Errorf("old secrets should be rejected after rotation: %v", got)
+	}
+}
+
+func TestVerifyWebhookRejectsTampering(t *testing.T) {
+	body := []byte(`{"topic":"x"}`)
+	h := http.Header{}
+	if err := client.VerifyWebhook("s", h, body, 0); err != client.ErrMissingSignature {
+		t.Errorf("expected ErrMissingSignature, got %v", err)
+	}
+
+	old := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	h.Set("X-Koor-Timestamp", old)
+	h.Set("X-Koor-Event-Id", "1")
+	h.Set("X-Koor-Signature-256", "sha256=00")
+	if err := client.VerifyWebhook("s", h, body, 0); err != client.ErrStaleTimestamp {
+		t.Errorf("expected ErrStaleTimestamp, got %v", err)
+	}
+
+	h.Set("X-Koor-Timestamp", strconv.FormatInt(time.Now().Unix(), 10))
+	if err := client.VerifyWebhook("s", h, body, 0); err != client.ErrInvalidSignature {
+		t.Errorf("expected ErrInvalidSignature, got %v", err)
+	}
+}
+
+func TestWebhookHandler(t *testing.T) {
+	var got string
+	h := client.WebhookHandler("s", 0, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got = string(body)
+	}))
+
+	body := `{"topic":"x"}`
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	deliver := func(secret string) int {
+		req := httptest.NewRequest("POST", "/koor", strings.NewReader(body))
+		req.Header.Set("X-Koor-Timestamp", ts)
+		req.Header.Set("X-Koor-Event-Id", "7")
+		req.Header.Set("X-Koor-Signature-256", client.SignWebhook(secret, ts, "7", []byte(body)))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	if code := deliver("other"); code != http.StatusUnauthorized || got != "" {
+		t.Errorf("wrong secret: expected 401 and no call, got %d %q", code, got)
+	}
+	if code := deliver("s"); code != http.StatusOK || got != body {
+		t.Errorf("expected the body passed on, got %d %q", code, got)
+	}
+}
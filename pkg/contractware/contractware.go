@@ -0,0 +1,444 @@
+// Package contractware is HTTP middleware that enforces a Koor API contract
+// inside a running Go service. It fetches the contract from the Koor server,
+// validates incoming requests and outgoing responses against it, and
+// reports violations as "contract.violation" events, so contract drift shows
+// up while the service is used rather than only in pre-flight checks.
+//
+//	cw, err := contractware.New(contractware.Config{
+//		Server:   "http://localhost:9800",
+//		Token:    os.Getenv("KOOR_TOKEN"),
+//		Project:  "truck-wash",
+//		Contract: "api",
+//		Source:   "truck-wash-backend",
+//	})
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	http.ListenAndServe(":8080", cw.Handler(mux))
+package contractware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DavidRHerbert/koor/internal/contracts"
+)
+
+// Topic is the event topic violations are published on.
+const Topic = "contract.violation"
+
+// Mode decides what happens to a request that violates the contract.
+type Mode int
+
+const (
+	// Report lets invalid requests through and only reports them.
+	Report Mode = iota
+	// Enforce rejects invalid requests with 422 before they reach the
+	// handler. Responses are always report-only: by the time they can be
+	// checked they have been sent.
+	Enforce
+)
+
+// Defaults for the zero values of Config.
+const (
+	DefaultRefresh     = 30 * time.Second
+	DefaultReportEvery = time.Minute
+	maxBody            = 1 << 20 // bodies larger than this are not validated
+)
+
+// Config configures the middleware.
+type Config struct {
+	Server   string // Koor server URL, e.g. "http://localhost:9800"
+	Token    string // bearer token; needs the read and events:publish scopes when auth is on
+	Project  string
+	Contract string // name of the contract spec within Project
+	Source   string // names the service in reported violations
+
+	Mode Mode
+
+	// Refresh is how often the contract is re-checked with the server. The
+	// check sends the cached ETag, so an unchanged contract costs a 304.
+	Refresh time.Duration
+
+	// ReportEvery limits how often the same violation (endpoint, direction
+	// and messages) is published; repeats in between are counted and sent
+	// with the next report.
+	ReportEvery time.Duration
+
+	// OnViolation, if set, is called for every violation found, including
+	// those not published because of ReportEvery.
+	OnViolation func(Violation)
+
+	Client *http.Client // defaults to a client with a 10s timeout
+	Logger *slog.Logger // defaults to slog.Default()
+}
+
+// Violation describes a request or response that broke the contract.
+type Violation struct {
+	Project    string                `json:"project"`
+	Contract   string                `json:"contract"`
+	Source     string                `json:"source,omitempty"`
+	Endpoint   string                `json:"endpoint"`  // contract key, e.g. "GET /api/trucks/{id}"
+	Direction  string                `json:"direction"` // "request", "query" or "response"
+	Method     string                `json:"method"`
+	Path       string                `json:"path"`
+	Status     int                   `json:"status,omitempty"` // response status, for direction "response"
+	Rejected   bool                  `json:"rejected,omitempty"`
+	Violations []contracts.Violation `json:"violations"`
+	Repeats    int                   `json:"repeats,omitempty"` // suppressed duplicates since the last report
+}
+
+// Middleware validates traffic against one contract. Create it with New.
+type Middleware struct {
+	cfg Config
+
+	mu       sync.RWMutex
+	contract *contracts.Contract
+	routes   []route
+	etag     string
+	checked  time.Time
+
+	reportMu sync.Mutex
+	reported map[string]*reportState
+}
+
+type reportState struct {
+	last    time.Time
+	repeats int
+}
+
+// New returns middleware for cfg. The contract is fetched on first use; call
+// Refresh to fetch it up front and fail fast on a bad configuration.
+func New(cfg Config) (*Middleware, error) {
+	if cfg.Server == "" || cfg.Project == "" || cfg.Contract == "" {
+		return nil, errors.New("contractware: Server, Project and Contract are required")
+	}
+	cfg.Server = strings.TrimRight(cfg.Server, "/")
+	if cfg.Refresh <= 0 {
+		cfg.Refresh = DefaultRefresh
+	}
+	if cfg.ReportEvery <= 0 {
+		cfg.ReportEvery = DefaultReportEvery
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
+	}
+	return &Middleware{cfg: cfg, reported: map[string]*reportState{}}, nil
+}
+
+// Refresh fetches the contract from the server, sending the ETag of the
+// cached copy so an unchanged contract is not downloaded again.
+func (m *Middleware) Refresh(ctx context.Context) error {
+	m.mu.RLock()
+	etag := m.etag
+	m.mu.RUnlock()
+
+	path := "/api/specs/" + url.PathEscape(m.cfg.Project) + "/" + url.PathEscape(m.cfg.Contract)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.cfg.Server+path, nil)
+	if err != nil {
+		return fmt.Errorf("contractware: %w", err)
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	m.authorize(req)
+	resp, err := m.cfg.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("contractware: fetch contract: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		m.mu.Lock()
+		m.checked = time.Now()
+		m.mu.Unlock()
+		return nil
+	case http.StatusOK:
+	default:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("contractware: fetch contract %s/%s: HTTP %d: %s",
+			m.cfg.Project, m.cfg.Contract, resp.StatusCode, bytes.TrimSpace(body))
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("contractware: read contract: %w", err)
+	}
+	c, err := contracts.Parse(data)
+	if err != nil {
+		return fmt.Errorf("contractware: %s/%s: %w", m.cfg.Project, m.cfg.Contract, err)
+	}
+	m.mu.Lock()
+	m.contract = c
+	m.routes = compileRoutes(c)
+	m.etag = resp.Header.Get("ETag")
+	m.checked = time.Now()
+	m.mu.Unlock()
+	return nil
+}
+
+// Contract returns the cached contract, or nil if none has been fetched.
+func (m *Middleware) Contract() *contracts.Contract {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.contract
+}
+
+// current returns the contract and its routes, refreshing them first when
+// they are due. Only one request refreshes at a time; a failed refresh keeps
+// serving the cached copy, and with no copy at all traffic passes through
+// unchecked.
+func (m *Middleware) current(ctx context.Context) (*contracts.Contract, []route) {
+	m.mu.Lock()
+	due := time.Since(m.checked) >= m.cfg.Refresh
+	if due {
+		m.checked = time.Now()
+	}
+	m.mu.Unlock()
+	if due {
+		if err := m.Refresh(context.WithoutCancel(ctx)); err != nil {
+			m.cfg.Logger.Warn("contract refresh failed", "error", err)
+		}
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.contract, m.routes
+}
+
+// Handler wraps next with contract validation.
+func (m *Middleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, routes := m.current(r.Context())
+		endpoint := matchRoute(routes, r.Method, r.URL.Path)
+		if c == nil || endpoint == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ep := c.Endpoints[endpoint]
+		base := Violation{
+			Project: m.cfg.Project, Contract: m.cfg.Contract, Source: m.cfg.Source,
+			Endpoint: endpoint, Method: r.Method, Path: r.URL.Path,
+		}
+
+		var found []Violation
+		if len(ep.Query) > 0 {
+			if vs := contracts.ValidatePayload(c, endpoint, "query", queryPayload(ep.Query, r.URL.Query())); len(vs) > 0 {
+				v := base
+				v.Direction, v.Violations = "query", vs
+				found = append(found, v)
+			}
+		}
+		if len(ep.Request) > 0 && r.Body != nil {
+			body, err := io.ReadAll(io.LimitReader(r.Body, maxBody+1))
+			r.Body.Close()
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			if err == nil && len(body) <= maxBody {
+				var vs []contracts.Violation
+				var payload map[string]any
+				if err := json.Unmarshal(body, &payload); err != nil {
+					vs = []contracts.Violation{{Path: "request", Message: "body is not a JSON object"}}
+				} else {
+					vs = contracts.ValidatePayload(c, endpoint, "request", payload)
+				}
+				if len(vs) > 0 {
+					v := base
+					v.Direction, v.Violations = "request", vs
+					found = append(found, v)
+				}
+			}
+		}
+		if len(found) > 0 && m.cfg.Mode == Enforce {
+			var all []contracts.Violation
+			for i := range found {
+				found[i].Rejected = true
+				m.report(found[i])
+				all = append(all, found[i].Violations...)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			json.NewEncoder(w).Encode(map[string]any{
+				"error":      "request violates contract " + m.cfg.Project + "/" + m.cfg.Contract + " (" + endpoint + ")",
+				"violations": all,
+			})
+			return
+		}
+		for _, v := range found {
+			m.report(v)
+		}
+
+		rec := &recorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		if vs := checkResponse(c, endpoint, rec); len(vs) > 0 {
+			v := base
+			v.Direction, v.Status, v.Violations = "response", rec.status, vs
+			m.report(v)
+		}
+	})
+}
+
+// checkResponse validates a recorded response: its status, and its body
+// when it is JSON and small enough to have been captured.
+func checkResponse(c *contracts.Contract, endpoint string, rec *recorder) []contracts.Violation {
+	var vs []contracts.Violation
+	if v := contracts.ValidateStatus(c, endpoint, rec.status); v != nil {
+		vs = append(vs, *v)
+	}
+	if rec.overflow || rec.body.Len() == 0 || !strings.Contains(rec.Header().Get("Content-Type"), "json") {
+		return vs
+	}
+	var body any
+	if err := json.Unmarshal(rec.body.Bytes(), &body); err != nil {
+		return append(vs, contracts.Violation{Path: "response", Message: "body is not valid JSON"})
+	}
+	ep := c.Endpoints[endpoint]
+	_, variant := ep.Responses[rec.status]
+	success := rec.status < 400 && !variant
+	switch b := body.(type) {
+	case []any:
+		switch {
+		case success && ep.ResponseArray != nil:
+			vs = append(vs, contracts.ValidateResponseArray(c, endpoint, b)...)
+		case success && ep.Response != nil, variant:
+			vs = append(vs, contracts.Violation{Path: "response", Message: "expected a JSON object, got an array"})
+		}
+	case map[string]any:
+		switch {
+		case success && ep.Response == nil && ep.ResponseArray != nil:
+			vs = append(vs, contracts.Violation{Path: "response", Message: "expected a JSON array, got an object"})
+		case variant, success && ep.Response != nil, rec.status >= 400 && ep.Error != nil:
+			vs = append(vs, contracts.ValidateResponse(c, endpoint, rec.status, b)...)
+		}
+	}
+	return vs
+}
+
+// queryPayload converts query parameters to the JSON types the contract
+// declares for them, so "?limit=10" checks as a number.
+func queryPayload(schema map[string]contracts.Field, q url.Values) map[string]any {
+	out := make(map[string]any, len(q))
+	for name, vals := range q {
+		val := vals[0]
+		switch schema[name].Type {
+		case "number":
+			if n, err := strconv.ParseFloat(val, 64); err == nil {
+				out[name] = n
+				continue
+			}
+		case "boolean":
+			if b, err := strconv.ParseBool(val); err == nil {
+				out[name] = b
+				continue
+			}
+		case "array":
+			items := make([]any, len(vals))
+			for i, v := range vals {
+				items[i] = v
+			}
+			out[name] = items
+			continue
+		}
+		out[name] = val
+	}
+	return out
+}
+
+// report passes v to OnViolation and publishes it, unless the same
+// violation was published less than ReportEvery ago.
+func (m *Middleware) report(v Violation) {
+	if m.cfg.OnViolation != nil {
+		m.cfg.OnViolation(v)
+	}
+	key := v.Endpoint + "\x00" + v.Direction
+	for _, vv := range v.Violations {
+		key += "\x00" + vv.Path + ":" + vv.Message
+	}
+	m.reportMu.Lock()
+	st, ok := m.reported[key]
+	if ok && time.Since(st.last) < m.cfg.ReportEvery {
+		st.repeats++
+		m.reportMu.Unlock()
+		return
+	}
+	if !ok {
+		st = &reportState{}
+		m.reported[key] = st
+	}
+	v.Repeats, st.repeats, st.last = st.repeats, 0, time.Now()
+	m.reportMu.Unlock()
+
+	go m.publish(v)
+}
+
+func (m *Middleware) publish(v Violation) {
+	data, _ := json.Marshal(map[string]any{"topic": Topic, "data": v})
+	req, err := http.NewRequest(http.MethodPost, m.cfg.Server+"/api/events/publish", bytes.NewReader(data))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	m.authorize(req)
+	resp, err := m.cfg.Client.Do(req)
+	if err != nil {
+		m.cfg.Logger.Warn("contract violation report failed", "endpoint", v.Endpoint, "error", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		m.cfg.Logger.Warn("contract violation report rejected", "endpoint", v.Endpoint, "status", resp.StatusCode)
+	}
+}
+
+func (m *Middleware) authorize(req *http.Request) {
+	if m.cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+m.cfg.Token)
+	}
+}
+
+// recorder passes a response through while keeping the status and a copy
+// of the body for validation.
+type recorder struct {
+	http.ResponseWriter
+	status   int
+	body     bytes.Buffer
+	overflow bool
+	wrote    bool
+}
+
+func (r *recorder) WriteHeader(code int) {
+	if !r.wrote {
+		r.status, r.wrote = code, true
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *recorder) Write(p []byte) (int, error) {
+	r.wrote = true
+	if !r.overflow {
+		if r.body.Len()+len(p) > maxBody {
+			r.overflow = true
+			r.body.Reset()
+		} else {
+			r.body.Write(p)
+		}
+	}
+	return r.ResponseWriter.Write(p)
+}
+
+func (r *recorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
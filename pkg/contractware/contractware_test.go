@@ -0,0 +1,212 @@
+package contractware_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DavidRHerbert/koor/pkg/contractware"
+	"github.com/DavidRHerbert/koor/pkg/koortest"
+)
+
+const truckContract = `{
+  "kind": "contract",
+  "version": 1,
+  "endpoints": {
+    "POST /api/trucks": {
+      "request": {"plate": {"type": "string", "required": true}},
+      "response": {"id": {"type": "number", "required": true}},
+      "response_status": 201
+    },
+    "GET /api/trucks/{id}": {
+      "response": {"id": {"type": "number", "required": true}, "plate": {"type": "string"}}
+    },
+    "GET /api/trucks/stats": {
+      "query": {"days": {"type": "number"}},
+      "response": {"count": {"type": "number", "required": true}}
+    }
+  }
+}`
+
+// service is a stand-in backend; its responses break the contract on purpose
+// for plate "BAD".
+func service() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/trucks", func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]any
+		json.NewDecoder(r.Body).Decode(&req)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		if req["plate"] == "BAD" {
+			w.Write([]byte(`{"id":"seven"}`))
+			return
+		}
+		w.Write([]byte(`{"id":7}`))
+	})
+	mux.HandleFunc("GET /api/trucks/stats", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"count":3}`))
+	})
+	mux.HandleFunc("GET /api/health", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	return mux
+}
+
+type collector struct {
+	mu sync.Mutex
+	vs []contractware.Violation
+}
+
+func (c *collector) add(v contractware.Violation) {
+	c.mu.Lock()
+	c.vs = append(c.vs, v)
+	c.mu.Unlock()
+}
+
+func (c *collector) all() []contractware.Violation {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]contractware.Violation(nil), c.vs...)
+}
+
+func newMiddleware(t *testing.T, env *koortest.Env, mode contractware.Mode, got *collector) *contractware.Middleware {
+	t.Helper()
+	cw, err := contractware.New(contractware.Config{
+		Server: env.URL, Project: "tw", Contract: "api", Source: "tw-backend",
+		Mode: mode, OnViolation: got.add,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cw
+}
+
+func post(t *testing.T, url, body string) *http.Response {
+	t.Helper()
+	resp, err := http.Post(url, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func TestReportMode(t *testing.T) {
+	env := koortest.New(t)
+	env.SeedContract("tw", "api", truckContract)
+	rec := env.CaptureEvents(contractware.Topic)
+	var got collector
+	app := httptest.NewServer(newMiddleware(t, env, contractware.Report, &got).Handler(service()))
+	defer app.Close()
+
+	if resp := post(t, app.URL+"/api/trucks", `{"plate":"AB-12"}`); resp.StatusCode != 201 {
+		t.Fatalf("valid request: expected 201, got %d", resp.StatusCode)
+	}
+	if vs := got.all(); len(vs) != 0 {
+		t.Fatalf("valid traffic reported violations: %+v", vs)
+	}
+
+	// Report mode lets a bad request through, then also catches the bad response.
+	if resp := post(t, app.URL+"/api/trucks", `{"plate":"BAD","colour":"red"}`); resp.StatusCode != 201 {
+		t.Fatalf("report mode should not reject, got %d", resp.StatusCode)
+	}
+	vs := got.all()
+	if len(vs) != 2 || vs[0].Direction != "request" || vs[1].Direction != "response" {
+		t.Fatalf("expected a request and a response violation, got %+v", vs)
+	}
+	if vs[0].Endpoint != "POST /api/trucks" || vs[1].Status != 201 {
+		t.Errorf("unexpected violation details: %+v", vs)
+	}
+
+	ev, ok := rec.Wait(contractware.Topic, 2*time.Second)
+	if !ok {
+		t.Fatal("no contract.violation event published")
+	}
+	var data contractware.Violation
+	json.Unmarshal(ev.Data, &data)
+	if data.Project != "tw" || data.Contract != "api" || data.Source != "tw-backend" || len(data.Violations) == 0 {
+		t.Errorf("unexpected event data: %s", ev.Data)
+	}
+
+	// Query parameters are checked with the contract's types; routes not in
+	// the contract pass through.
+	resp, _ := http.Get(app.URL + "/api/trucks/stats?days=7")
+	resp.Body.Close()
+	resp, _ = http.Get(app.URL + "/api/health")
+	resp.Body.Close()
+	if n := len(got.all()); n != 2 {
+		t.Errorf("expected no new violations, got %+v", got.all()[2:])
+	}
+	resp, _ = http.Get(app.URL + "/api/trucks/stats?days=week")
+	resp.Body.Close()
+	if vs := got.all(); len(vs) != 3 || vs[2].Direction != "query" {
+		t.Errorf("expected a query violation, got %+v", vs)
+	}
+}
+
+func TestEnforceMode(t *testing.T) {
+	env := koortest.New(t)
+	env.SeedContract("tw", "api", truckContract)
+	var got collector
+	app := httptest.NewServer(newMiddleware(t, env, contractware.Enforce, &got).Handler(service()))
+	defer app.Close()
+
+	resp, err := http.Post(app.URL+"/api/trucks", "application/json", strings.NewReader(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422, got %d", resp.StatusCode)
+	}
+	var body struct {
+		Violations []struct {
+			Path string `json:"path"`
+		} `json:"violations"`
+	}
+	json.NewDecoder(resp.Body).Decode(&body)
+	if len(body.Violations) != 1 || body.Violations[0].Path != "request.plate" {
+		t.Errorf("unexpected violations: %+v", body.Violations)
+	}
+	if vs := got.all(); len(vs) != 1 || !vs[0].Rejected {
+		t.Errorf("expected one rejected violation, got %+v", vs)
+	}
+}
+
+func TestRefreshUsesETag(t *testing.T) {
+	env := koortest.New(t)
+	env.SeedContract("tw", "api", truckContract)
+	var got collector
+	cw := newMiddleware(t, env, contractware.Report, &got)
+	ctx := context.Background()
+
+	if err := cw.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	first := cw.Contract()
+	if err := cw.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if cw.Contract() != first {
+		t.Error("an unchanged contract should be kept, not re-parsed")
+	}
+
+	env.SeedContract("tw", "api", strings.Replace(truckContract, `"version": 1`, `"version": 2`, 1))
+	if err := cw.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if cw.Contract().Version != 2 {
+		t.Errorf("expected the updated contract, got version %d", cw.Contract().Version)
+	}
+
+	missing, _ := contractware.New(contractware.Config{Server: env.URL, Project: "tw", Contract: "nope"})
+	if err := missing.Refresh(ctx); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("expected a 404 error, got %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package contractware
+
+import (
+	"strings"
+
+	"github.com/DavidRHerbert/koor/internal/contracts"
+)
+
+// route is a contract endpoint key split for matching, e.g.
+// "GET /api/trucks/{id}" becomes GET and ["api", "trucks", "{id}"].
+type route struct {
+	key      string
+	method   string
+	segments []string
+	literals int // segments that are not parameters; more specific routes win
+}
+
+func compileRoutes(c *contracts.Contract) []route {
+	routes := make([]route, 0, len(c.Endpoints))
+	for key := range c.Endpoints {
+		method, path, ok := strings.Cut(key, " ")
+		if !ok {
+			continue
+		}
+		rt := route{key: key, method: strings.ToUpper(method), segments: splitPath(path)}
+		for _, seg := range rt.segments {
+			if !isParam(seg) {
+				rt.literals++
+			}
+		}
+		routes = append(routes, rt)
+	}
+	return routes
+}
+
+// matchRoute returns the contract key of the route matching method and
+// path, preferring the one with the most literal segments, or "" if none
+// matches. Path parameters are written {name} or :name.
+func matchRoute(routes []route, method, path string) string {
+	segs := splitPath(path)
+	best, bestLiterals := "", -1
+	for _, rt := range routes {
+		if rt.method != method || len(rt.segments) != len(segs) || rt.literals < bestLiterals {
+			continue
+		}
+		matched := true
+		for i, seg := range rt.segments {
+			if !isParam(seg) && seg != segs[i] {
+				matched = false
+				break
+			}
+		}
+		if matched && (rt.literals > bestLiterals || rt.key < best) {
+			best, bestLiterals = rt.key, rt.literals
+		}
+	}
+	return best
+}
+
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+func isParam(seg string) bool {
+	return strings.HasPrefix(seg, ":") || strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}")
+}
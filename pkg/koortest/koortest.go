@@ -0,0 +1,345 @@
+// Package koortest provides fixtures for testing against a Koor server:
+// an in-memory server with every subsystem wired, helpers to seed
+// instances, rules and contracts, and a recorder for published events.
+//
+//	env := koortest.New(t)
+//	env.SeedContract("Truck-Wash", "api", contractJSON)
+//	rec := env.CaptureEvents("deploy.*")
+//	// ... exercise env.URL ...
+//	ev, ok := rec.Wait("deploy.finished", time.Second)
+package koortest
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DavidRHerbert/koor/internal/audit"
+	"github.com/DavidRHerbert/koor/internal/compliance"
+	"github.com/DavidRHerbert/koor/internal/contracts"
+	"github.com/DavidRHerbert/koor/internal/db"
+	"github.com/DavidRHerbert/koor/internal/events"
+	"github.com/DavidRHerbert/koor/internal/instances"
+	"github.com/DavidRHerbert/koor/internal/liveness"
+	"github.com/DavidRHerbert/koor/internal/llmcost"
+	koormcp "github.com/DavidRHerbert/koor/internal/mcp"
+	"github.com/DavidRHerbert/koor/internal/messages"
+	"github.com/DavidRHerbert/koor/internal/milestones"
+	"github.com/DavidRHerbert/koor/internal/observability"
+	"github.com/DavidRHerbert/koor/internal/orphans"
+	"github.com/DavidRHerbert/koor/internal/policy"
+	"github.com/DavidRHerbert/koor/internal/projections"
+	"github.com/DavidRHerbert/koor/internal/projects"
+	"github.com/DavidRHerbert/koor/internal/replication"
+	"github.com/DavidRHerbert/koor/internal/rulepacks"
+	"github.com/DavidRHerbert/koor/internal/schedules"
+	"github.com/DavidRHerbert/koor/internal/search"
+	"github.com/DavidRHerbert/koor/internal/server"
+	"github.com/DavidRHerbert/koor/internal/server/serverconfig"
+	"github.com/DavidRHerbert/koor/internal/specs"
+	"github.com/DavidRHerbert/koor/internal/state"
+	"github.com/DavidRHerbert/koor/internal/tasks"
+	"github.com/DavidRHerbert/koor/internal/templates"
+	"github.com/DavidRHerbert/koor/internal/tokens"
+	"github.com/DavidRHerbert/koor/internal/users"
+	"github.com/DavidRHerbert/koor/internal/webhooks"
+)
+
+// Env is a running test server and direct access to its stores.
+// Background workers (liveness checks, webhook dispatch, compliance runs)
+// are wired but not started; call their methods directly when needed.
+type Env struct {
+	URL    string
+	Server *httptest.Server
+	Koor   *server.Server
+	DB     *sql.DB
+
+	State       *state.Store
+	Specs       *specs.Registry
+	Events      *events.Bus
+	Instances   *instances.Registry
+	Liveness    *liveness.Monitor
+	Webhooks    *webhooks.Dispatcher
+	Compliance  *compliance.Scheduler
+	Templates   *templates.Store
+	RulePacks   *rulepacks.Store
+	Audit       *audit.Log
+	Metrics     *observability.Store
+	LLMCost     *llmcost.Store
+	Search      *search.Index
+	Deprecation *contracts.UsageLog
+	Examples    *contracts.ExampleStore
+	Policies    *policy.Store
+	Projections *projections.Store
+	Schedules   *schedules.Scheduler
+	Settings    *projects.Store
+	Milestones  *milestones.Store
+	Tokens      *tokens.Store
+	Users       *users.Store
+	Tasks       *tasks.Store
+	Messages    *messages.Store
+	Orphans     *orphans.Cleaner
+
+	t testing.TB
+}
+
+// Option customises the server built by New.
+type Option func(*server.Config)
+
+// WithAuthToken requires the given bearer token on API requests.
+func WithAuthToken(token string) Option {
+	return func(c *server.Config) { c.AuthToken = token }
+}
+
+// WithChangeEvents enables state.changed/spec.changed events, using the
+// same syntax as koor-server's --change-events flag.
+func WithChangeEvents(cfg string) Option {
+	return func(c *server.Config) { c.ChangeEvents = cfg }
+}
+
+// WithRequireSignedEvents rejects event publishes without a valid
+// instance signature, like koor-server's --require-signed-events flag.
+func WithRequireSignedEvents() Option {
+	return func(c *server.Config) { c.RequireSignedEvents = true }
+}
+
+// WithMCPDataTools offers publish_event, get_state and set_state over MCP,
+// like koor-server's --mcp-data-tools flag.
+func WithMCPDataTools() Option {
+	return func(c *server.Config) { c.MCPDataTools = true }
+}
+
+// WithMCPStateResources lets MCP clients read state keys starting with one
+// of prefixes (comma-separated) as resources, like koor-server's
+// --mcp-state-resources flag.
+func WithMCPStateResources(prefixes string) Option {
+	return func(c *server.Config) { c.MCPStateResources = prefixes }
+}
+
+// WithStrictJSON rejects unknown request body fields and reports invalid
+// bodies as 422 with the offending fields, like koor-server's --strict-json
+// flag.
+func WithStrictJSON() Option {
+	return func(c *server.Config) { c.StrictJSON = true }
+}
+
+// WithStatusPage configures the public status page served by
+// Koor.StatusHandler, like koor-server's --status-projects and
+// --status-expose flags.
+func WithStatusPage(projects, expose string) Option {
+	return func(c *server.Config) { c.StatusProjects, c.StatusExpose = projects, expose }
+}
+
+// New starts an in-memory Koor server for the duration of the test.
+func New(t testing.TB, opts ...Option) *Env {
+	t.Helper()
+	database, err := db.OpenMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	cfg := server.Config{Bind: "localhost:0"}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	env := &Env{
+		DB:          database,
+		State:       state.New(database),
+		Specs:       specs.New(database),
+		Events:      events.New(database, 1000),
+		Instances:   instances.New(database),
+		Templates:   templates.New(database),
+		Audit:       audit.New(database),
+		Metrics:     observability.New(database),
+		LLMCost:     llmcost.New(database),
+		Search:      search.New(database),
+		Deprecation: contracts.NewUsageLog(database),
+		Examples:    contracts.NewExampleStore(database),
+		Policies:    policy.New(database),
+		Settings:    projects.New(database),
+		Milestones:  milestones.New(database),
+		Tokens:      tokens.New(database),
+		Users:       users.New(database),
+		t:           t,
+	}
+	env.Liveness = liveness.New(env.Instances, env.Events, 5*time.Minute, time.Minute, logger)
+	env.Webhooks = webhooks.New(database, env.Events, logger)
+	env.Compliance = compliance.New(database, env.Instances, env.Specs, env.Events, time.Hour, logger)
+	env.Compliance.SetProjectSettings(env.Settings)
+	env.Events.SetRetention(env.Settings.EventRetention)
+	env.Tasks = tasks.New(database, env.Events)
+	env.Liveness.SetPolicies(liveness.NewPolicyStore(database))
+	env.Liveness.SetWebhooks(env.Webhooks)
+	env.Liveness.SetTasks(env.Tasks)
+	env.Liveness.SetTokens(env.Tokens)
+	env.Messages = messages.New(database, env.Events)
+	env.Orphans = orphans.New(database, env.Events, time.Hour, logger)
+	env.Orphans.SetTasks(env.Tasks)
+	env.Compliance.SetState(env.State)
+	env.Compliance.SetMetrics(env.Metrics)
+	env.Compliance.SetTasks(env.Tasks)
+	env.Projections = projections.New(database, env.State)
+	env.Events.SetProjections(env.Projections.Apply)
+	env.Schedules = schedules.New(database, env.Events, time.Hour, logger)
+	env.RulePacks = rulepacks.New(database, env.Specs)
+
+	// The MCP transport needs the API base URL, so listen before building it.
+	ts := httptest.NewUnstartedServer(nil)
+	base := "http://" + ts.Listener.Addr().String()
+	mcpTransport := koormcp.New(env.Instances, env.Specs, serverconfig.Endpoints{APIBase: base})
+	mcpTransport.SetTasks(env.Tasks)
+	mcpTransport.SetAudit(env.Audit)
+
+	srv := server.New(cfg, env.State, env.Specs, env.Events, env.Instances, mcpTransport, logger)
+	srv.SetLiveness(env.Liveness)
+	srv.SetWebhooks(env.Webhooks)
+	srv.SetCompliance(env.Compliance)
+	srv.SetTemplates(env.Templates)
+	srv.SetRulePacks(env.RulePacks)
+	env.Audit.SetEvents(env.Events)
+	srv.SetAudit(env.Audit)
+	srv.SetObservability(env.Metrics)
+	srv.SetLLMCost(env.LLMCost)
+	srv.SetSearch(env.Search)
+	srv.SetPolicies(env.Policies)
+	srv.SetProjections(env.Projections)
+	srv.SetSchedules(env.Schedules)
+	srv.SetMilestones(env.Milestones)
+	srv.SetDeprecations(env.Deprecation)
+	srv.SetContractExamples(env.Examples)
+	srv.SetProjectSettings(env.Settings)
+	srv.SetTokens(env.Tokens)
+	srv.SetUsers(env.Users)
+	srv.SetTasks(env.Tasks)
+	srv.SetMessages(env.Messages)
+	srv.SetOrphans(env.Orphans)
+	srv.SetReplicationSource(replication.NewSource(database))
+
+	ts.Config.Handler = srv.Handler()
+	ts.Start()
+	t.Cleanup(ts.Close)
+
+	env.URL = ts.URL
+	env.Server = ts
+	env.Koor = srv
+	return env
+}
+
+// SeedInstance registers and activates an agent instance.
+func (e *Env) SeedInstance(name, workspace string) *instances.Instance {
+	e.t.Helper()
+	ctx := context.Background()
+	inst, err := e.Instances.Register(ctx, name, workspace, "", "")
+	if err != nil {
+		e.t.Fatalf("seed instance %s: %v", name, err)
+	}
+	if err := e.Instances.Activate(ctx, inst.ID); err != nil {
+		e.t.Fatalf("activate instance %s: %v", name, err)
+	}
+	inst.Status = "active"
+	return inst
+}
+
+// SeedRules imports accepted validation rules into a project.
+func (e *Env) SeedRules(project string, rules ...specs.Rule) {
+	e.t.Helper()
+	for i := range rules {
+		rules[i].Project = project
+	}
+	if _, err := e.Specs.ImportRules(context.Background(), rules); err != nil {
+		e.t.Fatalf("seed rules for %s: %v", project, err)
+	}
+}
+
+// SeedContract stores a contract spec after checking that it parses.
+func (e *Env) SeedContract(project, name, contract string) {
+	e.t.Helper()
+	if _, err := contracts.Parse([]byte(contract)); err != nil {
+		e.t.Fatalf("seed contract %s/%s: %v", project, name, err)
+	}
+	if _, err := e.Specs.Put(context.Background(), project, name, []byte(contract)); err != nil {
+		e.t.Fatalf("seed contract %s/%s: %v", project, name, err)
+	}
+}
+
+// SeedState stores a JSON state value.
+func (e *Env) SeedState(key, value string) {
+	e.t.Helper()
+	if _, err := e.State.Put(context.Background(), key, []byte(value), "application/json", ""); err != nil {
+		e.t.Fatalf("seed state %s: %v", key, err)
+	}
+}
+
+// Recorder collects events published on the bus that match a pattern.
+type Recorder struct {
+	mu     sync.Mutex
+	events []events.Event
+	notify chan struct{}
+}
+
+// CaptureEvents starts recording events matching pattern (e.g. "agent.*").
+// Recording stops when the test ends.
+func (e *Env) CaptureEvents(pattern string) *Recorder {
+	rec := &Recorder{notify: make(chan struct{}, 1)}
+	sub := e.Events.Subscribe(pattern)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for ev := range sub.Ch {
+			rec.mu.Lock()
+			rec.events = append(rec.events, ev)
+			rec.mu.Unlock()
+			select {
+			case rec.notify <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	e.t.Cleanup(func() {
+		e.Events.Unsubscribe(sub)
+		<-done
+	})
+	return rec
+}
+
+// Events returns the events recorded so far, oldest first.
+func (r *Recorder) Events() []events.Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]events.Event(nil), r.events...)
+}
+
+// Topics returns the topics of the events recorded so far.
+func (r *Recorder) Topics() []string {
+	var topics []string
+	for _, ev := range r.Events() {
+		topics = append(topics, ev.Topic)
+	}
+	return topics
+}
+
+// Wait returns the first recorded event with the given topic, waiting up to
+// timeout for it to arrive. ok is false if it never did.
+func (r *Recorder) Wait(topic string, timeout time.Duration) (ev events.Event, ok bool) {
+	deadline := time.After(timeout)
+	for {
+		for _, ev := range r.Events() {
+			if ev.Topic == topic {
+				return ev, true
+			}
+		}
+		select {
+		case <-r.notify:
+		case <-deadline:
+			return events.Event{}, false
+		}
+	}
+}
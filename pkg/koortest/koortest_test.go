@@ -0,0 +1,121 @@
+package koortest_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DavidRHerbert/koor/internal/events"
+	"github.com/DavidRHerbert/koor/internal/policy"
+	"github.com/DavidRHerbert/koor/internal/specs"
+	"github.com/DavidRHerbert/koor/pkg/koortest"
+)
+
+func TestEnvSeedsAndServes(t *testing.T) {
+	env := koortest.New(t)
+	env.SeedInstance("frontend", "/work/app")
+	env.SeedRules("TW", specs.Rule{RuleID: "no-todo", Pattern: "TODO"})
+	env.SeedContract("TW", "api", `{"kind":"contract","version":1,"endpoints":{"GET /ping":{"response_status":200}}}`)
+
+	for _, path := range []string{"/api/instances", "/api/validate/TW/rules", "/api/specs/TW/api"} {
+		resp, err := http.Get(env.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != 200 {
+			t.Errorf("%s: expected 200, got %d: %s", path, resp.StatusCode, body)
+		}
+	}
+
+	resp, _ := http.Get(env.URL + "/api/instances")
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), `"status":"active"`) {
+		t.Errorf("seeded instance should be active: %s", body)
+	}
+}
+
+func TestRecorderWait(t *testing.T) {
+	env := koortest.New(t)
+	rec := env.CaptureEvents("deploy.*")
+
+	env.Events.Publish(context.Background(), "build.started", json.RawMessage(`{}`), "ci")
+	env.Events.Publish(context.Background(), "deploy.finished", json.RawMessage(`{"ok":true}`), "ci")
+
+	ev, ok := rec.Wait("deploy.finished", time.Second)
+	if !ok || string(ev.Data) != `{"ok":true}` {
+		t.Fatalf("expected deploy.finished, got %+v ok=%v", ev, ok)
+	}
+	if topics := rec.Topics(); len(topics) != 1 {
+		t.Errorf("recorder should only capture matching topics: %v", topics)
+	}
+	if _, ok := rec.Wait("deploy.failed", 10*time.Millisecond); ok {
+		t.Error("Wait should time out for an unpublished topic")
+	}
+}
+
+func TestWithAuthToken(t *testing.T) {
+	env := koortest.New(t, koortest.WithAuthToken("secret"))
+	resp, _ := http.Get(env.URL + "/api/state")
+	resp.Body.Close()
+	if resp.StatusCode != 401 {
+		t.Errorf("expected 401 without token, got %d", resp.StatusCode)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	ctx := context.Background()
+
+	// Record some traffic on one server.
+	live := koortest.New(t)
+	req, _ := live.Events.Publish(ctx, "truck-wash.backend.request", json.RawMessage(`{"need":"schema"}`), "backend")
+	live.Events.Publish(ctx, "truck-wash.controller.approved", json.RawMessage(fmt.Sprintf(`{"request_id":%d}`, req.ID)), "lead")
+	live.Events.Publish(ctx, "truck-wash.controller.deploy", json.RawMessage(`{}`), "intruder")
+	resp, err := http.Get(live.URL + "/api/events/history?last=10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	history, err := koortest.LoadEvents(resp.Body)
+	resp.Body.Close()
+	if err != nil || len(history) != 3 {
+		t.Fatalf("load events: %v (%d events)", err, len(history))
+	}
+
+	// Replay it against a fresh one with a new policy.
+	env := koortest.New(t)
+	lead := env.SeedInstance("truck-wash-lead", "")
+	env.Policies.Create(ctx, policy.Policy{
+		Action: policy.ActionEventPublish, Resource: "truck-wash.controller.*", Condition: "name=truck-wash-lead",
+	})
+	var answered int64
+	res, err := env.Replay(ctx, history, koortest.ReplayOptions{
+		Speed:     1000,
+		Instances: map[string]string{"lead": lead.ID},
+		OnEvent: func(original, replayed events.Event) error {
+			if original.Topic == "truck-wash.controller.approved" {
+				var data struct {
+					RequestID int64 `json:"request_id"`
+				}
+				json.Unmarshal(replayed.Data, &data)
+				answered = data.RequestID
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Published != 2 || len(res.Denied) != 1 || res.Denied[0].Event.Source != "intruder" || res.Denied[0].Status != 403 {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+	if answered == 0 || answered != res.IDs[req.ID] {
+		t.Errorf("request_id should point at the replayed request: got %d, want %d", answered, res.IDs[req.ID])
+	}
+}
@@ -0,0 +1,210 @@
+package koortest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/DavidRHerbert/koor/internal/events"
+)
+
+// Simulation: a project's recorded events can be replayed against a fresh
+// Env, at accelerated speed, to check that a change to rules, policies or
+// workflows still copes with real agent traffic before it is deployed:
+//
+//	env := koortest.New(t)
+//	env.ImportProject("Truck-Wash", bundle) // koor-cli projects export
+//	env.Policies.Create(ctx, newPolicy)     // the change under test
+//	history, _ := koortest.LoadEvents(file) // GET /api/events/history
+//	res, err := env.Replay(ctx, history, koortest.ReplayOptions{Speed: 1000})
+//	// ... assert on res.Denied, env.State, env.Tasks, ...
+
+// ReplayOptions controls Env.Replay.
+type ReplayOptions struct {
+	// Speed divides the recorded gap between consecutive events: 60 plays
+	// an hour of traffic in a minute. 0 publishes back to back.
+	Speed float64
+	// MaxGap caps the wait between two events after scaling. 0 means no cap.
+	MaxGap time.Duration
+	// Instances maps an event's source to the instance ID it is published
+	// as (the X-Koor-Instance header), so policies see the original caller.
+	Instances map[string]string
+	// OnEvent runs after each event is replayed, whether or not the server
+	// accepted it; replayed is the zero Event if it was denied. Returning
+	// an error stops the replay with that error.
+	OnEvent func(original, replayed events.Event) error
+}
+
+// ReplayResult summarises a replay.
+type ReplayResult struct {
+	Published int
+	Denied    []ReplayDenial
+	IDs       map[int64]int64 // recorded event ID -> replayed event ID
+	Elapsed   time.Duration
+}
+
+// ReplayDenial is a recorded event the server refused to publish.
+type ReplayDenial struct {
+	Event  events.Event
+	Status int
+	Error  string
+}
+
+// LoadEvents reads recorded events, either a JSON array as returned by
+// GET /api/events/history or a page ({"events": [...]}) as returned with
+// ?after_id=.
+func LoadEvents(r io.Reader) ([]events.Event, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var list []events.Event
+	if err := json.Unmarshal(data, &list); err == nil {
+		return list, nil
+	}
+	var page struct {
+		Events []events.Event `json:"events"`
+	}
+	if err := json.Unmarshal(data, &page); err != nil {
+		return nil, fmt.Errorf("parse events: want a JSON array or {\"events\": [...]}: %w", err)
+	}
+	return page.Events, nil
+}
+
+// ImportProject loads a project bundle written by
+// GET /api/projects/{project}/export (koor-cli projects export) into the
+// Env: its specs, rules, state, templates, webhooks and settings.
+func (e *Env) ImportProject(project string, bundle []byte) {
+	e.t.Helper()
+	resp, err := http.Post(e.URL+"/api/projects/"+url.PathEscape(project)+"/import",
+		"application/json", bytes.NewReader(bundle))
+	if err != nil {
+		e.t.Fatalf("import project %s: %v", project, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		e.t.Fatalf("import project %s: status %d: %s", project, resp.StatusCode, body)
+	}
+}
+
+// Replay publishes recorded events through the Env's REST API, oldest
+// first, so everything a live publish triggers (signature and policy
+// checks, subscribers, webhooks, task and budget logic) runs as it would
+// have. A "request_id" in an event's data that names an earlier recorded
+// event is rewritten to that event's replayed ID, so answered requests
+// stay answered. Events the server refuses are collected in Denied rather
+// than stopping the replay.
+func (e *Env) Replay(ctx context.Context, history []events.Event, opts ReplayOptions) (*ReplayResult, error) {
+	ordered := append([]events.Event(nil), history...)
+	sort.SliceStable(ordered, func(i, j int) bool { return ordered[i].ID < ordered[j].ID })
+
+	res := &ReplayResult{IDs: map[int64]int64{}}
+	start := time.Now()
+	defer func() { res.Elapsed = time.Since(start) }()
+
+	for i, ev := range ordered {
+		if i > 0 && opts.Speed > 0 {
+			wait := time.Duration(float64(ev.CreatedAt.Sub(ordered[i-1].CreatedAt)) / opts.Speed)
+			if opts.MaxGap > 0 {
+				wait = min(wait, opts.MaxGap)
+			}
+			if wait > 0 {
+				select {
+				case <-time.After(wait):
+				case <-ctx.Done():
+					return res, ctx.Err()
+				}
+			}
+		}
+
+		replayed, denial, err := e.publishRecorded(ctx, ev, res.IDs, opts.Instances[ev.Source])
+		if err != nil {
+			return res, fmt.Errorf("replay event %d (%s): %w", ev.ID, ev.Topic, err)
+		}
+		if denial != nil {
+			res.Denied = append(res.Denied, *denial)
+		} else {
+			res.Published++
+			res.IDs[ev.ID] = replayed.ID
+		}
+		if opts.OnEvent != nil {
+			var got events.Event
+			if replayed != nil {
+				got = *replayed
+			}
+			if err := opts.OnEvent(ev, got); err != nil {
+				return res, err
+			}
+		}
+	}
+	return res, nil
+}
+
+// publishRecorded publishes one recorded event. A 4xx response is a denial,
+// not an error.
+func (e *Env) publishRecorded(ctx context.Context, ev events.Event, ids map[int64]int64, instanceID string) (*events.Event, *ReplayDenial, error) {
+	body, _ := json.Marshal(map[string]any{"topic": ev.Topic, "data": remapRequestID(ev.Data, ids)})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.URL+"/api/events/publish", bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if instanceID != "" {
+		req.Header.Set("X-Koor-Instance", instanceID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		var out events.Event
+		if err := json.Unmarshal(data, &out); err != nil {
+			return nil, nil, err
+		}
+		return &out, nil, nil
+	case resp.StatusCode >= 400 && resp.StatusCode < 500:
+		var msg struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(data, &msg) != nil || msg.Error == "" {
+			msg.Error = strings.TrimSpace(string(data))
+		}
+		return nil, &ReplayDenial{Event: ev, Status: resp.StatusCode, Error: msg.Error}, nil
+	default:
+		return nil, nil, fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+}
+
+// remapRequestID rewrites a top-level "request_id" naming a replayed event.
+func remapRequestID(data json.RawMessage, ids map[int64]int64) json.RawMessage {
+	var obj map[string]json.RawMessage
+	if json.Unmarshal(data, &obj) != nil {
+		return data
+	}
+	var old int64
+	if json.Unmarshal(obj["request_id"], &old) != nil {
+		return data
+	}
+	id, ok := ids[old]
+	if !ok {
+		return data
+	}
+	obj["request_id"], _ = json.Marshal(id)
+	out, err := json.Marshal(obj)
+	if err != nil {
+		return data
+	}
+	return out
+}